@@ -133,11 +133,11 @@ func TestZoneAwareReplication(t *testing.T) {
 	// SIGKILL 1 ingester in the 2nd zone
 	require.NoError(t, ingester3.Kill())
 
-	// Query back any series => fail (either because of a timeout or 500)
+	// Query back any series => fail (either because of a timeout, 500 or 503 if the ingester is unavailable)
 	result, _, err := client.QueryRaw("series_1")
 	if !errors.Is(err, context.DeadlineExceeded) {
 		require.NoError(t, err)
-		require.Equal(t, 500, result.StatusCode)
+		require.Contains(t, []int{500, 503}, result.StatusCode)
 	}
 
 	// SIGKILL 1 more ingester in the 2nd zone (all ingesters in 2nd zone have been killed)
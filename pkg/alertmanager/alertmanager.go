@@ -80,6 +80,10 @@ type Config struct {
 	Replicator        Replicator
 	Store             alertstore.AlertStore
 	PersisterConfig   PersisterConfig
+
+	// Maximum time spent reading the state from the other replicas on the initial state sync,
+	// before falling back to reading it from storage. 0 to use the default.
+	StateSyncTimeout time.Duration
 }
 
 // An Alertmanager manages the alerts for one user.
@@ -113,7 +117,13 @@ type Alertmanager struct {
 	// hence we need to generate the metric ourselves.
 	configHashMetric prometheus.Gauge
 
-	rateLimitedNotifications *prometheus.CounterVec
+	rateLimitedNotifications     *prometheus.CounterVec
+	firewallBlockedNotifications *prometheus.CounterVec
+
+	// The last notifications sent to the receivers.
+	notificationHistory *notificationHistory
+	// The count of the notifications sent to the receivers by hour, replicated to the other replicas.
+	notificationCounter *notificationCounter
 }
 
 var (
@@ -168,6 +178,13 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 			Help: "Number of rate-limited notifications per integration.",
 		}, []string{"integration"}), // "integration" is consistent with other alertmanager metrics.
 
+		firewallBlockedNotifications: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "alertmanager_notification_firewall_blocked_total",
+			Help: "Number of notifications blocked by the receivers firewall per integration.",
+		}, []string{"integration"}),
+
+		notificationHistory: newNotificationHistory(),
+		notificationCounter: newNotificationCounter(),
 	}
 
 	am.registry = reg
@@ -183,6 +200,9 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 	} else if cfg.ShardingEnabled {
 		level.Debug(am.logger).Log("msg", "starting tenant alertmanager with ring-based replication")
 		state := newReplicatedStates(cfg.UserID, cfg.ReplicationFactor, cfg.Replicator, cfg.Store, am.logger, am.registry)
+		if cfg.StateSyncTimeout > 0 {
+			state.settleReadTimeout = cfg.StateSyncTimeout
+		}
 		am.state = state
 		am.persister = newStatePersister(cfg.PersisterConfig, cfg.UserID, state, cfg.Store, am.logger, am.registry)
 	} else {
@@ -222,6 +242,9 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 	c = am.state.AddState("sil:"+cfg.UserID, am.silences, am.registry)
 	am.silences.SetBroadcast(c.Broadcast)
 
+	c = am.state.AddState("ntc:"+cfg.UserID, am.notificationCounter, am.registry)
+	am.notificationCounter.SetBroadcast(c.Broadcast)
+
 	// State replication needs to be started after the state keys are defined.
 	if service, ok := am.state.(services.Service); ok {
 		if err := service.StartAsync(context.Background()); err != nil {
@@ -244,8 +267,10 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 	}()
 
 	var callback mem.AlertStoreCallback
+	var alertsLimiter *alertsLimiter
 	if am.cfg.Limits != nil {
-		callback = newAlertsLimiter(am.cfg.UserID, am.cfg.Limits, reg)
+		alertsLimiter = newAlertsLimiter(am.cfg.UserID, am.cfg.Limits, reg)
+		callback = alertsLimiter
 	}
 
 	am.alerts, err = mem.NewAlerts(context.Background(), am.marker, 30*time.Minute, callback, am.logger)
@@ -274,6 +299,14 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 	ui.Register(router, webReload, log.With(am.logger, "component", "ui"))
 	am.mux = am.api.Register(router, am.cfg.ExternalURL.Path)
 
+	// The alerts and silences exceeding the limits are rejected before reaching the API.
+	if am.cfg.Limits != nil {
+		silencesLimiter := newSilencesLimiter(am.cfg.UserID, am.cfg.Limits, am.silences, reg)
+		apiMux := am.mux
+		am.mux = http.NewServeMux()
+		am.mux.Handle("/", newLimitsHandler(apiMux, am.cfg.ExternalURL.Path, alertsLimiter, silencesLimiter))
+	}
+
 	// Override some extra paths registered in the router (eg. /metrics which by default exposes prometheus.DefaultRegisterer).
 	// Entire router is registered in Mux to "/" path, so there is no conflict with overwriting specific paths.
 	for _, p := range []string{"/metrics", "/-/reload", "/debug/"} {
@@ -284,6 +317,8 @@ func New(cfg *Config, reg *prometheus.Registry) (*Alertmanager, error) {
 		}
 		am.mux.Handle(a, http.NotFoundHandler())
 	}
+	am.mux.Handle(path.Join(am.cfg.ExternalURL.Path, "/api/v1/notifications"), am.notificationHistory)
+	am.mux.Handle(path.Join(am.cfg.ExternalURL.Path, "/api/v1/notifications/count"), am.notificationCounter)
 
 	am.dispatcherMetrics = dispatch.NewDispatcherMetrics(true, am.registry)
 
@@ -353,6 +388,8 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 	firewallDialer := util_net.NewFirewallDialer(newFirewallDialerConfigProvider(userID, am.cfg.Limits))
 
 	integrationsMap, err := buildIntegrationsMap(conf.Receivers, tmpl, firewallDialer, am.logger, func(integrationName string, notifier notify.Notifier) notify.Notifier {
+		notifier = newFirewallNotifier(notifier, am.firewallBlockedNotifications.WithLabelValues(integrationName))
+
 		if am.cfg.Limits != nil {
 			rl := &tenantRateLimits{
 				tenant:      userID,
@@ -360,9 +397,9 @@ func (am *Alertmanager) ApplyConfig(userID string, conf *config.Config, rawCfg s
 				integration: integrationName,
 			}
 
-			return newRateLimitedNotifier(notifier, rl, 10*time.Second, am.rateLimitedNotifications.WithLabelValues(integrationName))
+			notifier = newRateLimitedNotifier(notifier, rl, 10*time.Second, am.rateLimitedNotifications.WithLabelValues(integrationName))
 		}
-		return notifier
+		return newDeliveryTracingNotifier(notifier, integrationName, am.notificationHistory, am.notificationCounter, am.logger)
 	})
 	if err != nil {
 		return nil
@@ -450,6 +487,11 @@ func (am *Alertmanager) mergePartialExternalState(part *clusterpb.Part) error {
 
 func (am *Alertmanager) getFullState() (*clusterpb.FullState, error) {
 	if state, ok := am.state.(*state); ok {
+		// The state is only shared once synced, so that the replicas syncing at the same time, like
+		// on scale-up, don't take each other's empty state as the synced one.
+		if !state.Ready() {
+			return nil, errStateNotSynced
+		}
 		return state.GetFullState()
 	}
 	return nil, errors.New("ring-based sharding not enabled")
@@ -572,6 +614,18 @@ func (p firewallDialerConfigProvider) BlockPrivateAddresses() bool {
 	return p.limits.AlertmanagerReceiversBlockPrivateAddresses(p.userID)
 }
 
+func (p firewallDialerConfigProvider) AllowCIDRNetworks() []flagext.CIDR {
+	return p.limits.AlertmanagerReceiversAllowCIDRNetworks(p.userID)
+}
+
+func (p firewallDialerConfigProvider) BlockHostnames() []string {
+	return p.limits.AlertmanagerReceiversBlockHostnames(p.userID)
+}
+
+func (p firewallDialerConfigProvider) AllowHostnames() []string {
+	return p.limits.AlertmanagerReceiversAllowHostnames(p.userID)
+}
+
 type tenantRateLimits struct {
 	tenant      string
 	integration string
@@ -677,6 +731,48 @@ func (a *alertsLimiter) PreStore(alert *types.Alert, existing bool) error {
 	return nil
 }
 
+// checkAlerts returns an error if storing the alerts would add alerts or grow their size
+// above the limits. The alerts already above the limits are kept.
+func (a *alertsLimiter) checkAlerts(alerts []model.Alert) error {
+	countLimit := a.limits.AlertmanagerMaxAlertsCount(a.tenant)
+	sizeLimit := a.limits.AlertmanagerMaxAlertsSizeBytes(a.tenant)
+	if countLimit <= 0 && sizeLimit <= 0 {
+		return nil
+	}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	count, totalSize := a.count, a.totalSize
+	sizes := make(map[model.Fingerprint]int, len(alerts))
+	for _, alert := range alerts {
+		fp := alert.Fingerprint()
+		size := alertSize(alert)
+
+		prev, existing := sizes[fp]
+		if !existing {
+			prev, existing = a.sizes[fp]
+		}
+		if !existing {
+			count++
+		}
+		totalSize += size - prev
+		sizes[fp] = size
+	}
+
+	if countLimit > 0 && count > a.count && count > countLimit {
+		a.failureCounter.Add(float64(len(alerts)))
+		return fmt.Errorf(errTooManyAlerts, countLimit)
+	}
+
+	if sizeLimit > 0 && totalSize > a.totalSize && totalSize > sizeLimit {
+		a.failureCounter.Add(float64(len(alerts)))
+		return fmt.Errorf(errAlertsTooBig, sizeLimit)
+	}
+
+	return nil
+}
+
 func (a *alertsLimiter) PostStore(alert *types.Alert, existing bool) {
 	if alert == nil {
 		return
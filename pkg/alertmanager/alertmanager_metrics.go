@@ -56,14 +56,17 @@ type alertmanagerMetrics struct {
 	initialSyncTotal        *prometheus.Desc
 	initialSyncCompleted    *prometheus.Desc
 	initialSyncDuration     *prometheus.Desc
+	initialSyncFallbacks    *prometheus.Desc
 	persistTotal            *prometheus.Desc
 	persistFailed           *prometheus.Desc
 
 	notificationRateLimited                 *prometheus.Desc
+	notificationFirewallBlocked             *prometheus.Desc
 	dispatcherAggregationGroupsLimitReached *prometheus.Desc
 	insertAlertFailures                     *prometheus.Desc
 	alertsLimiterAlertsCount                *prometheus.Desc
 	alertsLimiterAlertsSize                 *prometheus.Desc
+	insertSilenceFailures                   *prometheus.Desc
 }
 
 func newAlertmanagerMetrics() *alertmanagerMetrics {
@@ -201,6 +204,10 @@ func newAlertmanagerMetrics() *alertmanagerMetrics {
 			"cortex_alertmanager_state_initial_sync_duration_seconds",
 			"Time spent syncing initial state from peers or storage.",
 			nil, nil),
+		initialSyncFallbacks: prometheus.NewDesc(
+			"cortex_alertmanager_state_initial_sync_fallbacks_total",
+			"Number of times the initial state sync has fallen back to reading the state from storage, by reason.",
+			[]string{"reason"}, nil),
 		persistTotal: prometheus.NewDesc(
 			"cortex_alertmanager_state_persist_total",
 			"Number of times we have tried to persist the running state to storage.",
@@ -213,6 +220,10 @@ func newAlertmanagerMetrics() *alertmanagerMetrics {
 			"cortex_alertmanager_notification_rate_limited_total",
 			"Total number of rate-limited notifications per integration.",
 			[]string{"user", "integration"}, nil),
+		notificationFirewallBlocked: prometheus.NewDesc(
+			"cortex_alertmanager_notification_firewall_blocked_total",
+			"Total number of notifications blocked by the receivers firewall per integration.",
+			[]string{"user", "integration"}, nil),
 		dispatcherAggregationGroupsLimitReached: prometheus.NewDesc(
 			"cortex_alertmanager_dispatcher_aggregation_group_limit_reached_total",
 			"Number of times when dispatcher failed to create new aggregation group due to limit.",
@@ -229,6 +240,10 @@ func newAlertmanagerMetrics() *alertmanagerMetrics {
 			"cortex_alertmanager_alerts_limiter_current_alerts_size_bytes",
 			"Total size of alerts tracked by alerts limiter.",
 			[]string{"user"}, nil),
+		insertSilenceFailures: prometheus.NewDesc(
+			"cortex_alertmanager_silences_insert_limited_total",
+			"Total number of silences rejected due to hitting alertmanager limits.",
+			[]string{"user"}, nil),
 	}
 }
 
@@ -276,13 +291,16 @@ func (m *alertmanagerMetrics) Describe(out chan<- *prometheus.Desc) {
 	out <- m.initialSyncTotal
 	out <- m.initialSyncCompleted
 	out <- m.initialSyncDuration
+	out <- m.initialSyncFallbacks
 	out <- m.persistTotal
 	out <- m.persistFailed
 	out <- m.notificationRateLimited
+	out <- m.notificationFirewallBlocked
 	out <- m.dispatcherAggregationGroupsLimitReached
 	out <- m.insertAlertFailures
 	out <- m.alertsLimiterAlertsCount
 	out <- m.alertsLimiterAlertsSize
+	out <- m.insertSilenceFailures
 }
 
 func (m *alertmanagerMetrics) Collect(out chan<- prometheus.Metric) {
@@ -326,12 +344,15 @@ func (m *alertmanagerMetrics) Collect(out chan<- prometheus.Metric) {
 	data.SendSumOfCounters(out, m.initialSyncTotal, "alertmanager_state_initial_sync_total")
 	data.SendSumOfCountersWithLabels(out, m.initialSyncCompleted, "alertmanager_state_initial_sync_completed_total", "outcome")
 	data.SendSumOfHistograms(out, m.initialSyncDuration, "alertmanager_state_initial_sync_duration_seconds")
+	data.SendSumOfCountersWithLabels(out, m.initialSyncFallbacks, "alertmanager_state_initial_sync_fallbacks_total", "reason")
 	data.SendSumOfCounters(out, m.persistTotal, "alertmanager_state_persist_total")
 	data.SendSumOfCounters(out, m.persistFailed, "alertmanager_state_persist_failed_total")
 
 	data.SendSumOfCountersPerUserWithLabels(out, m.notificationRateLimited, "alertmanager_notification_rate_limited_total", "integration")
+	data.SendSumOfCountersPerUserWithLabels(out, m.notificationFirewallBlocked, "alertmanager_notification_firewall_blocked_total", "integration")
 	data.SendSumOfCountersPerUser(out, m.dispatcherAggregationGroupsLimitReached, "alertmanager_dispatcher_aggregation_group_limit_reached_total")
 	data.SendSumOfCountersPerUser(out, m.insertAlertFailures, "alertmanager_alerts_insert_limited_total")
 	data.SendSumOfGaugesPerUser(out, m.alertsLimiterAlertsCount, "alertmanager_alerts_limiter_current_alerts")
 	data.SendSumOfGaugesPerUser(out, m.alertsLimiterAlertsSize, "alertmanager_alerts_limiter_current_alerts_size_bytes")
+	data.SendSumOfCountersPerUser(out, m.insertSilenceFailures, "alertmanager_silences_insert_limited_total")
 }
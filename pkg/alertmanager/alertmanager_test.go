@@ -1,6 +1,7 @@
 package alertmanager
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
@@ -35,6 +36,38 @@ func TestDispatcherGroupLimits(t *testing.T) {
 	}
 }
 
+func TestAlertmanager_ShouldNotShareTheStateBeforeItIsSynced(t *testing.T) {
+	// The other replicas never respond, so the state is synced from storage on timeout.
+	replicator := newFakeReplicator()
+	replicator.read = readStateResult{blocking: true}
+
+	am, err := New(&Config{
+		UserID:            "user-1",
+		Logger:            log.NewNopLogger(),
+		Limits:            &mockAlertManagerLimits{},
+		TenantDataDir:     t.TempDir(),
+		ExternalURL:       &url.URL{Path: "/am"},
+		ShardingEnabled:   true,
+		ReplicationFactor: 2,
+		Replicator:        replicator,
+		Store:             newFakeAlertStore(),
+		PersisterConfig:   PersisterConfig{Interval: time.Hour},
+		StateSyncTimeout:  500 * time.Millisecond,
+	}, prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	defer am.StopAndWait()
+
+	_, err = am.getFullState()
+	require.Equal(t, errStateNotSynced, err)
+
+	require.NoError(t, am.WaitInitialStateSync(context.Background()))
+
+	fullState, err := am.getFullState()
+	require.NoError(t, err)
+	assert.Len(t, fullState.Parts, 3)
+	assert.Equal(t, float64(1), testutil.ToFloat64(am.state.(*state).initialSyncFallbacks.WithLabelValues(fallbackTimeout)))
+}
+
 func createAlertmanagerAndSendAlerts(t *testing.T, alertGroups, groupsLimit, expectedFailures int) {
 	user := "test"
 
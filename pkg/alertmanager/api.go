@@ -15,12 +15,15 @@ import (
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/concurrency"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
+	util_net "github.com/cortexproject/cortex/pkg/util/net"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
 	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
 	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
 	commoncfg "github.com/prometheus/common/config"
 	"gopkg.in/yaml.v2"
 )
@@ -53,6 +56,10 @@ var (
 type UserConfig struct {
 	TemplateFiles      map[string]string `yaml:"template_files"`
 	AlertmanagerConfig string            `yaml:"alertmanager_config"`
+
+	// Fallback is set when the user has no configuration and the returned one is the
+	// fallback configuration. It's ignored when the configuration is uploaded.
+	Fallback bool `yaml:"fallback,omitempty"`
 }
 
 func (am *MultitenantAlertmanager) GetUserConfig(w http.ResponseWriter, r *http.Request) {
@@ -66,6 +73,10 @@ func (am *MultitenantAlertmanager) GetUserConfig(w http.ResponseWriter, r *http.
 	}
 
 	cfg, err := am.store.GetAlertConfig(r.Context(), userID)
+	if err == alertspb.ErrNotFound && am.fallbackConfig != "" {
+		// The users without a configuration run the fallback one.
+		cfg, err = alertspb.ToProto("", nil, userID), nil
+	}
 	if err != nil {
 		if err == alertspb.ErrNotFound {
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -75,10 +86,16 @@ func (am *MultitenantAlertmanager) GetUserConfig(w http.ResponseWriter, r *http.
 		return
 	}
 
-	d, err := yaml.Marshal(&UserConfig{
+	userCfg := &UserConfig{
 		TemplateFiles:      alertspb.ParseTemplates(cfg),
 		AlertmanagerConfig: cfg.RawConfig,
-	})
+	}
+	if cfg.RawConfig == "" && am.fallbackConfig != "" {
+		userCfg.AlertmanagerConfig = am.fallbackConfig
+		userCfg.Fallback = true
+	}
+
+	d, err := yaml.Marshal(userCfg)
 
 	if err != nil {
 		level.Error(logger).Log("msg", errMarshallingYAML, "err", err, "user", userID)
@@ -102,6 +119,70 @@ func (am *MultitenantAlertmanager) SetUserConfig(w http.ResponseWriter, r *http.
 		return
 	}
 
+	cfgDesc, err := am.readUserConfig(r, userID)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to read the Alertmanager config", "err", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := validateUserConfig(logger, cfgDesc, am.limits, am.secretProvider, userID); err != nil {
+		level.Warn(logger).Log("msg", errValidatingConfig, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errValidatingConfig, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	err = am.store.SetAlertConfig(r.Context(), cfgDesc)
+	if err != nil {
+		level.Error(logger).Log("msg", errStoringConfiguration, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errStoringConfiguration, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// ConfigValidationResult is the result of the validation of an Alertmanager config.
+type ConfigValidationResult struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+// ValidateUserConfig validates the Alertmanager config of the request like SetUserConfig does,
+// without storing it, and returns the validation errors and warnings in JSON format.
+func (am *MultitenantAlertmanager) ValidateUserConfig(w http.ResponseWriter, r *http.Request) {
+	logger := util_log.WithContext(r.Context(), am.logger)
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		level.Error(logger).Log("msg", errNoOrgID, "err", err.Error())
+		http.Error(w, fmt.Sprintf("%s: %s", errNoOrgID, err.Error()), http.StatusUnauthorized)
+		return
+	}
+
+	result := ConfigValidationResult{Errors: []string{}, Warnings: []string{}}
+
+	cfgDesc, err := am.readUserConfig(r, userID)
+	if err == nil {
+		var warnings []string
+		warnings, err = validateUserConfig(logger, cfgDesc, am.limits, am.secretProvider, userID)
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+
+	if multiErr, ok := err.(*types.MultiError); ok {
+		for _, err := range multiErr.Errors() {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	} else if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	result.Valid = len(result.Errors) == 0
+
+	util.WriteJSONResponse(w, result)
+}
+
+// readUserConfig reads the Alertmanager config of the request, enforcing the max config size.
+func (am *MultitenantAlertmanager) readUserConfig(r *http.Request, userID string) (alertspb.AlertConfigDesc, error) {
 	var input io.Reader
 	maxConfigSize := am.limits.AlertmanagerMaxConfigSize(userID)
 	if maxConfigSize > 0 {
@@ -114,41 +195,19 @@ func (am *MultitenantAlertmanager) SetUserConfig(w http.ResponseWriter, r *http.
 
 	payload, err := ioutil.ReadAll(input)
 	if err != nil {
-		level.Error(logger).Log("msg", errReadingConfiguration, "err", err.Error())
-		http.Error(w, fmt.Sprintf("%s: %s", errReadingConfiguration, err.Error()), http.StatusBadRequest)
-		return
+		return alertspb.AlertConfigDesc{}, fmt.Errorf("%s: %s", errReadingConfiguration, err.Error())
 	}
 
 	if maxConfigSize > 0 && len(payload) > maxConfigSize {
-		msg := fmt.Sprintf(errConfigurationTooBig, maxConfigSize)
-		level.Warn(logger).Log("msg", msg)
-		http.Error(w, msg, http.StatusBadRequest)
-		return
+		return alertspb.AlertConfigDesc{}, fmt.Errorf(errConfigurationTooBig, maxConfigSize)
 	}
 
 	cfg := &UserConfig{}
-	err = yaml.Unmarshal(payload, cfg)
-	if err != nil {
-		level.Error(logger).Log("msg", errMarshallingYAML, "err", err.Error())
-		http.Error(w, fmt.Sprintf("%s: %s", errMarshallingYAML, err.Error()), http.StatusBadRequest)
-		return
-	}
-
-	cfgDesc := alertspb.ToProto(cfg.AlertmanagerConfig, cfg.TemplateFiles, userID)
-	if err := validateUserConfig(logger, cfgDesc, am.limits, userID); err != nil {
-		level.Warn(logger).Log("msg", errValidatingConfig, "err", err.Error())
-		http.Error(w, fmt.Sprintf("%s: %s", errValidatingConfig, err.Error()), http.StatusBadRequest)
-		return
-	}
-
-	err = am.store.SetAlertConfig(r.Context(), cfgDesc)
-	if err != nil {
-		level.Error(logger).Log("msg", errStoringConfiguration, "err", err.Error())
-		http.Error(w, fmt.Sprintf("%s: %s", errStoringConfiguration, err.Error()), http.StatusInternalServerError)
-		return
+	if err := yaml.Unmarshal(payload, cfg); err != nil {
+		return alertspb.AlertConfigDesc{}, fmt.Errorf("%s: %s", errMarshallingYAML, err.Error())
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	return alertspb.ToProto(cfg.AlertmanagerConfig, cfg.TemplateFiles, userID), nil
 }
 
 // DeleteUserConfig is exposed via user-visible API (if enabled, uses DELETE method), but also as an internal endpoint using POST method.
@@ -173,49 +232,45 @@ func (am *MultitenantAlertmanager) DeleteUserConfig(w http.ResponseWriter, r *ht
 }
 
 // Partially copied from: https://github.com/prometheus/alertmanager/blob/8e861c646bf67599a1704fc843c6a94d519ce312/cli/check_config.go#L65-L96
-func validateUserConfig(logger log.Logger, cfg alertspb.AlertConfigDesc, limits Limits, user string) error {
+// It returns the warnings about the config, like the use of deprecated settings, if it's valid.
+// This is the validation of the configs stored by the API, so it must not drift from how they're
+// applied by the Alertmanager.
+func validateUserConfig(logger log.Logger, cfg alertspb.AlertConfigDesc, limits Limits, secrets SecretProvider, user string) ([]string, error) {
 	// We don't have a valid use case for empty configurations. If a tenant does not have a
 	// configuration set and issue a request to the Alertmanager, we'll a) upload an empty
 	// config and b) immediately start an Alertmanager instance for them if a fallback
 	// configuration is provisioned.
 	if cfg.RawConfig == "" {
-		return fmt.Errorf("configuration provided is empty, if you'd like to remove your configuration please use the delete configuration endpoint")
+		return nil, fmt.Errorf("configuration provided is empty, if you'd like to remove your configuration please use the delete configuration endpoint")
 	}
 
-	amCfg, err := config.Load(cfg.RawConfig)
+	// The secret references are resolved too, so that the configs referencing unknown secrets are rejected.
+	amCfg, _, err := loadConfigWithSecrets(cfg.RawConfig, user, secrets)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Validate the config recursively scanning it.
 	if err := validateAlertmanagerConfig(amCfg); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Validate templates referenced in the alertmanager config.
 	for _, name := range amCfg.Templates {
 		if err := validateTemplateFilename(name); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	// Check template limits.
-	if l := limits.AlertmanagerMaxTemplatesCount(user); l > 0 && len(cfg.Templates) > l {
-		return fmt.Errorf(errTooManyTemplates, len(cfg.Templates), l)
-	}
-
-	if maxSize := limits.AlertmanagerMaxTemplateSize(user); maxSize > 0 {
-		for _, tmpl := range cfg.Templates {
-			if size := len(tmpl.GetBody()); size > maxSize {
-				return fmt.Errorf(errTemplateTooBig, tmpl.GetFilename(), size, maxSize)
-			}
-		}
+	if err := validateTemplateLimits(cfg, user, limits); err != nil {
+		return nil, err
 	}
 
 	// Validate template files.
 	for _, tmpl := range cfg.Templates {
 		if err := validateTemplateFilename(tmpl.Filename); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -226,7 +281,7 @@ func validateUserConfig(logger log.Logger, cfg alertspb.AlertConfigDesc, limits
 	// we see this in the wild.
 	userTempDir, err := ioutil.TempDir("", "validate-config-"+cfg.User)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer os.RemoveAll(userTempDir)
 
@@ -234,12 +289,12 @@ func validateUserConfig(logger log.Logger, cfg alertspb.AlertConfigDesc, limits
 		templateFilepath, err := safeTemplateFilepath(userTempDir, tmpl.Filename)
 		if err != nil {
 			level.Error(logger).Log("msg", "unable to create template file path", "err", err, "user", cfg.User)
-			return err
+			return nil, err
 		}
 
 		if _, err = storeTemplateFile(templateFilepath, tmpl.Body); err != nil {
 			level.Error(logger).Log("msg", "unable to store template file", "err", err, "user", cfg.User)
-			return fmt.Errorf("unable to store template file '%s'", tmpl.Filename)
+			return nil, fmt.Errorf("unable to store template file '%s'", tmpl.Filename)
 		}
 	}
 
@@ -248,9 +303,15 @@ func validateUserConfig(logger log.Logger, cfg alertspb.AlertConfigDesc, limits
 		templateFiles[i] = filepath.Join(userTempDir, t)
 	}
 
-	_, err = template.FromGlobs(templateFiles...)
+	tmpl, err := template.FromGlobs(templateFiles...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Build the receiver integrations like the Alertmanager applying the config does.
+	firewallDialer := util_net.NewFirewallDialer(newFirewallDialerConfigProvider(user, limits))
+	if _, err := buildIntegrationsMap(amCfg.Receivers, tmpl, firewallDialer, logger, func(_ string, n notify.Notifier) notify.Notifier { return n }); err != nil {
+		return nil, err
 	}
 
 	// Note: Not validating the MultitenantAlertmanager.transformConfig function as that
@@ -258,7 +319,45 @@ func validateUserConfig(logger log.Logger, cfg alertspb.AlertConfigDesc, limits
 	// autoWebhookURL itself is broken. In that case, I would argue, we should accept the config
 	// not reject it.
 
-	return nil
+	return configWarnings(amCfg, firewallDialer), nil
+}
+
+// configWarnings returns the warnings about a valid config: the use of the deprecated matchers
+// syntax, and the webhook URLs blocked by the receivers firewall of the tenant.
+func configWarnings(cfg *config.Config, firewallDialer *util_net.FirewallDialer) []string {
+	var warnings []string
+
+	var checkRoute func(route *config.Route, path string)
+	checkRoute = func(route *config.Route, path string) {
+		if len(route.Match) > 0 || len(route.MatchRE) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: match and match_re are deprecated, use matchers instead", path))
+		}
+		for ix, child := range route.Routes {
+			checkRoute(child, fmt.Sprintf("%s.routes[%d]", path, ix))
+		}
+	}
+	if cfg.Route != nil {
+		checkRoute(cfg.Route, "route")
+	}
+
+	for ix, rule := range cfg.InhibitRules {
+		if len(rule.SourceMatch) > 0 || len(rule.SourceMatchRE) > 0 {
+			warnings = append(warnings, fmt.Sprintf("inhibit_rules[%d]: source_match and source_match_re are deprecated, use source_matchers instead", ix))
+		}
+		if len(rule.TargetMatch) > 0 || len(rule.TargetMatchRE) > 0 {
+			warnings = append(warnings, fmt.Sprintf("inhibit_rules[%d]: target_match and target_match_re are deprecated, use target_matchers instead", ix))
+		}
+	}
+
+	for _, rcv := range cfg.Receivers {
+		for _, c := range rcv.WebhookConfigs {
+			if c.URL != nil && firewallDialer.BlocksHost(c.URL.Hostname()) {
+				warnings = append(warnings, fmt.Sprintf("receiver %s: the webhook URL %s is blocked by the firewall", rcv.Name, c.URL.String()))
+			}
+		}
+	}
+
+	return warnings
 }
 
 func (am *MultitenantAlertmanager) ListAllConfigs(w http.ResponseWriter, r *http.Request) {
@@ -454,3 +553,38 @@ func validateVictorOpsConfig(cfg config.VictorOpsConfig) error {
 	}
 	return nil
 }
+
+// validateTemplateLimits checks the number and size of the templates against the limits of the user.
+func validateTemplateLimits(cfg alertspb.AlertConfigDesc, user string, limits Limits) error {
+	if l := limits.AlertmanagerMaxTemplatesCount(user); l > 0 && len(cfg.Templates) > l {
+		return fmt.Errorf(errTooManyTemplates, len(cfg.Templates), l)
+	}
+
+	if maxSize := limits.AlertmanagerMaxTemplateSize(user); maxSize > 0 {
+		for _, tmpl := range cfg.Templates {
+			if size := len(tmpl.GetBody()); size > maxSize {
+				return fmt.Errorf(errTemplateTooBig, tmpl.GetFilename(), size, maxSize)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateConfigLimits checks the configuration loaded from the store against the limits of the user.
+// The configurations uploaded via the API are checked when read, but the ones written to the store
+// out of band, or before the limits were lowered, are only checked here. The size of the configuration
+// is the size of the Alertmanager configuration and of its templates.
+func validateConfigLimits(cfg alertspb.AlertConfigDesc, limits Limits) error {
+	if maxConfigSize := limits.AlertmanagerMaxConfigSize(cfg.User); maxConfigSize > 0 {
+		size := len(cfg.RawConfig)
+		for _, tmpl := range cfg.Templates {
+			size += len(tmpl.GetFilename()) + len(tmpl.GetBody())
+		}
+		if size > maxConfigSize {
+			return fmt.Errorf(errConfigurationTooBig, maxConfigSize)
+		}
+	}
+
+	return validateTemplateLimits(cfg, cfg.User, limits)
+}
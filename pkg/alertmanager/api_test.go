@@ -3,10 +3,13 @@ package alertmanager
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/go-kit/kit/log"
@@ -374,6 +377,50 @@ alertmanager_config: |
 `,
 			err: errors.Wrap(errOAuth2SecretFileNotAllowed, "error validating Alertmanager config"),
 		},
+		{
+			name: "Should pass if receiver's OAuth2 and authorization are set",
+			cfg: `
+alertmanager_config: |
+  receivers:
+    - name: default-receiver
+      webhook_configs:
+        - url: http://localhost
+          http_config:
+            oauth2:
+              client_id: test
+              client_secret: secret
+              token_url: http://example.com
+        - url: http://localhost
+          http_config:
+            authorization:
+              type: Bearer
+              credentials: secret
+
+  route:
+    receiver: 'default-receiver'
+`,
+			err: nil,
+		},
+		{
+			name: "Should return error if secret_ref is set but no secret provider is configured",
+			cfg: `
+alertmanager_config: |
+  receivers:
+    - name: default-receiver
+      webhook_configs:
+        - url: http://localhost
+          http_config:
+            oauth2:
+              client_id: test
+              client_secret:
+                secret_ref: client-secret
+              token_url: http://example.com
+
+  route:
+    receiver: 'default-receiver'
+`,
+			err: errors.Wrap(errSecretProviderNotConfigured, "error validating Alertmanager config"),
+		},
 		{
 			name: "Should return error if receiver's HTTP proxy_url is set",
 			cfg: `
@@ -586,6 +633,170 @@ template_files:
 	}
 }
 
+func TestAMConfigValidationAPI_SecretRefs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "testing"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "testing", "client-secret"), []byte("s3cr3t\n"), 0600))
+
+	cfgTemplate := `
+alertmanager_config: |
+  receivers:
+    - name: default-receiver
+      webhook_configs:
+        - url: http://localhost
+          http_config:
+            oauth2:
+              client_id: test
+              client_secret:
+                secret_ref: %s
+              token_url: http://example.com
+
+  route:
+    receiver: 'default-receiver'
+`
+
+	am := &MultitenantAlertmanager{
+		store:          prepareInMemoryAlertStore(),
+		logger:         util_log.Logger,
+		limits:         &mockAlertManagerLimits{},
+		secretProvider: fileSecretProvider{dir: dir},
+	}
+
+	for name, tc := range map[string]struct {
+		secretName     string
+		expectedStatus int
+		expectedBody   string
+	}{
+		"should pass if the referenced secret exists": {
+			secretName:     "client-secret",
+			expectedStatus: http.StatusCreated,
+		},
+		"should return error if the referenced secret doesn't exist": {
+			secretName:     "unknown",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "error validating Alertmanager config: unknown secret \"unknown\" referenced by secret_ref\n",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://alertmanager/api/v1/alerts", bytes.NewReader([]byte(fmt.Sprintf(cfgTemplate, tc.secretName))))
+			ctx := user.InjectOrgID(req.Context(), "testing")
+			w := httptest.NewRecorder()
+			am.SetUserConfig(w, req.WithContext(ctx))
+			resp := w.Result()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedStatus, resp.StatusCode)
+			require.Equal(t, tc.expectedBody, string(body))
+		})
+	}
+
+	// The stored config contains the secret reference, not the secret.
+	cfg, err := am.store.GetAlertConfig(context.Background(), "testing")
+	require.NoError(t, err)
+	assert.Contains(t, cfg.RawConfig, "secret_ref: client-secret")
+	assert.NotContains(t, cfg.RawConfig, "s3cr3t")
+}
+
+func TestAMConfigValidationAPI_ValidateUserConfig(t *testing.T) {
+	am := &MultitenantAlertmanager{
+		store:  prepareInMemoryAlertStore(),
+		logger: util_log.Logger,
+		limits: &mockAlertManagerLimits{blockPrivateAddresses: true},
+	}
+
+	for name, tc := range map[string]struct {
+		cfg      string
+		expected ConfigValidationResult
+	}{
+		"should pass if the config is valid": {
+			cfg: `
+alertmanager_config: |
+  route:
+    receiver: 'default-receiver'
+  receivers:
+    - name: default-receiver
+      webhook_configs:
+        - url: http://example.com/alerts
+`,
+			expected: ConfigValidationResult{Valid: true, Errors: []string{}, Warnings: []string{}},
+		},
+		"should return the warnings of a valid config": {
+			cfg: `
+alertmanager_config: |
+  route:
+    receiver: 'default-receiver'
+    routes:
+      - receiver: 'default-receiver'
+        match:
+          severity: critical
+  inhibit_rules:
+    - source_match:
+        severity: critical
+      target_matchers:
+        - severity="warning"
+  receivers:
+    - name: default-receiver
+      webhook_configs:
+        - url: http://10.0.0.1/alerts
+`,
+			expected: ConfigValidationResult{Valid: true, Errors: []string{}, Warnings: []string{
+				"route.routes[0]: match and match_re are deprecated, use matchers instead",
+				"inhibit_rules[0]: source_match and source_match_re are deprecated, use source_matchers instead",
+				"receiver default-receiver: the webhook URL http://10.0.0.1/alerts is blocked by the firewall",
+			}},
+		},
+		"should return error if a template is invalid": {
+			cfg: `
+alertmanager_config: |
+  route:
+    receiver: 'default-receiver'
+  receivers:
+    - name: default-receiver
+  templates:
+    - "bad.tmpl"
+template_files:
+  "bad.tmpl": "{{ define \"bad\" }}{{ .Missing"
+`,
+			expected: ConfigValidationResult{Valid: false, Warnings: []string{}},
+		},
+		"should return error if the scheme of a webhook URL is unsupported": {
+			cfg: `
+alertmanager_config: |
+  route:
+    receiver: 'default-receiver'
+  receivers:
+    - name: default-receiver
+      webhook_configs:
+        - url: ftp://example.com/alerts
+`,
+			expected: ConfigValidationResult{Valid: false, Errors: []string{`unsupported scheme "ftp" for URL`}, Warnings: []string{}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://alertmanager/api/v1/alerts/validate", bytes.NewReader([]byte(tc.cfg)))
+			w := httptest.NewRecorder()
+			am.ValidateUserConfig(w, req.WithContext(user.InjectOrgID(req.Context(), "testing")))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var actual ConfigValidationResult
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &actual))
+
+			// The template errors mention the path of the temporary template file.
+			if !tc.expected.Valid && tc.expected.Errors == nil {
+				require.Len(t, actual.Errors, 1)
+				assert.Contains(t, actual.Errors[0], "bad.tmpl")
+				actual.Errors = nil
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+
+	// Nothing has been stored.
+	_, err := am.store.GetAlertConfig(context.Background(), "testing")
+	assert.Equal(t, alertspb.ErrNotFound, err)
+}
+
 func TestMultitenantAlertmanager_DeleteUserConfig(t *testing.T) {
 	storage := objstore.NewInMemBucket()
 	alertStore := bucketclient.NewBucketAlertStore(storage, nil, log.NewNopLogger())
@@ -16,6 +16,7 @@ import (
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/user"
 
@@ -27,6 +28,10 @@ import (
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 )
 
+// proxiedRequestHeader marks the requests proxied to an alertmanager owning the tenant, which are
+// never proxied again.
+const proxiedRequestHeader = "X-Cortex-Alertmanager-Proxied"
+
 // Distributor forwards requests to individual alertmanagers.
 type Distributor struct {
 	services.Service
@@ -39,6 +44,8 @@ type Distributor struct {
 	alertmanagerClientsPool ClientsPool
 
 	logger log.Logger
+
+	proxiedRequests prometheus.Counter
 }
 
 // NewDistributor constructs a new Distributor
@@ -53,6 +60,10 @@ func NewDistributor(cfg ClientConfig, maxRecvMsgSize int64, alertmanagersRing *r
 		maxRecvMsgSize:          maxRecvMsgSize,
 		alertmanagerRing:        alertmanagersRing,
 		alertmanagerClientsPool: alertmanagerClientsPool,
+		proxiedRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_alertmanager_distributor_proxied_requests_total",
+			Help: "Total number of requests proxied to an alertmanager owning the tenant.",
+		}),
 	}
 
 	d.Service = services.NewBasicService(nil, d.running, nil)
@@ -106,6 +117,9 @@ func (d *Distributor) isQuorumReadPath(p string) (bool, merger.Merger) {
 	if strings.HasSuffix(path.Dir(p), "/v2/silence") {
 		return true, merger.V2SilenceID{}
 	}
+	if strings.HasSuffix(p, "/v1/notifications/count") {
+		return true, merger.V1NotificationsCount{}
+	}
 	return false, nil
 }
 
@@ -160,6 +174,36 @@ func (d *Distributor) DistributeRequest(w http.ResponseWriter, r *http.Request)
 	http.Error(w, "route not supported by distributor", http.StatusNotFound)
 }
 
+// ProxyRequest proxies the request to one of the alertmanagers owning the tenant and relays its
+// response. The proxied request is marked, so that it's served by the receiving alertmanager
+// even if it doesn't own the tenant, like when the ring has changed in the meantime.
+func (d *Distributor) ProxyRequest(w http.ResponseWriter, r *http.Request) {
+	d.requestsInFlight.Add(1)
+	defer d.requestsInFlight.Done()
+
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set(proxiedRequestHeader, "true")
+
+	// The requests received via gRPC have no request URI.
+	if r.RequestURI == "" {
+		r.RequestURI = r.URL.RequestURI()
+	}
+
+	d.proxiedRequests.Inc()
+	d.doUnary(userID, w, r, util_log.WithContext(r.Context(), d.logger))
+}
+
+// isProxiedRequest returns whether the request has been proxied by another alertmanager.
+func isProxiedRequest(r *http.Request) bool {
+	return r.Header.Get(proxiedRequestHeader) != ""
+}
+
 func (d *Distributor) doQuorum(userID string, w http.ResponseWriter, r *http.Request, logger log.Logger, m merger.Merger) {
 	var body []byte
 	var err error
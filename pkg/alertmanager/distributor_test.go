@@ -168,6 +168,16 @@ func TestDistributor_DistributeRequest(t *testing.T) {
 			responseBody:       []byte(`{"id":"aaa","updatedAt":"2020-01-01T00:00:00Z"}`),
 		},
 		{
+			name:               "Read /v1/notifications/count is sent to 3 AMs",
+			numAM:              5,
+			numHappyAM:         5,
+			replicationFactor:  3,
+			isRead:             true,
+			expStatusCode:      http.StatusOK,
+			expectedTotalCalls: 3,
+			route:              "/v1/notifications/count",
+			responseBody:       []byte(`[{"sender":"a","hour":"2021-04-28T17:00:00Z","count":2}]`),
+		}, {
 			name:                "Write /silence/id not supported",
 			numAM:               5,
 			numHappyAM:          5,
@@ -280,26 +290,27 @@ func TestDistributor_DistributeRequest(t *testing.T) {
 
 func TestDistributor_IsPathSupported(t *testing.T) {
 	supported := map[string]bool{
-		"/alertmanager/api/v1/alerts":           true,
-		"/alertmanager/api/v1/alerts/groups":    false,
-		"/alertmanager/api/v1/silences":         true,
-		"/alertmanager/api/v1/silence/id":       true,
-		"/alertmanager/api/v1/silence/anything": true,
-		"/alertmanager/api/v1/silence/really":   true,
-		"/alertmanager/api/v1/status":           true,
-		"/alertmanager/api/v1/receivers":        true,
-		"/alertmanager/api/v1/other":            false,
-		"/alertmanager/api/v2/alerts":           true,
-		"/alertmanager/api/v2/alerts/groups":    true,
-		"/alertmanager/api/v2/silences":         true,
-		"/alertmanager/api/v2/silence/id":       true,
-		"/alertmanager/api/v2/silence/anything": true,
-		"/alertmanager/api/v2/silence/really":   true,
-		"/alertmanager/api/v2/status":           true,
-		"/alertmanager/api/v2/receivers":        true,
-		"/alertmanager/api/v2/other":            false,
-		"/alertmanager/other":                   false,
-		"/other":                                false,
+		"/alertmanager/api/v1/alerts":              true,
+		"/alertmanager/api/v1/alerts/groups":       false,
+		"/alertmanager/api/v1/silences":            true,
+		"/alertmanager/api/v1/silence/id":          true,
+		"/alertmanager/api/v1/silence/anything":    true,
+		"/alertmanager/api/v1/silence/really":      true,
+		"/alertmanager/api/v1/status":              true,
+		"/alertmanager/api/v1/receivers":           true,
+		"/alertmanager/api/v1/notifications/count": true,
+		"/alertmanager/api/v1/other":               false,
+		"/alertmanager/api/v2/alerts":              true,
+		"/alertmanager/api/v2/alerts/groups":       true,
+		"/alertmanager/api/v2/silences":            true,
+		"/alertmanager/api/v2/silence/id":          true,
+		"/alertmanager/api/v2/silence/anything":    true,
+		"/alertmanager/api/v2/silence/really":      true,
+		"/alertmanager/api/v2/status":              true,
+		"/alertmanager/api/v2/receivers":           true,
+		"/alertmanager/api/v2/other":               false,
+		"/alertmanager/other":                      false,
+		"/other":                                   false,
 	}
 
 	for path, isSupported := range supported {
@@ -0,0 +1,40 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+
+	util_net "github.com/cortexproject/cortex/pkg/util/net"
+)
+
+var errBlockedByFirewall = errors.New("failed to notify because the receiver destination is blocked by the firewall")
+
+// firewallNotifier fails the notifications whose delivery has been blocked by the receivers
+// firewall, without retrying them, and counts them.
+type firewallNotifier struct {
+	upstream notify.Notifier
+	counter  prometheus.Counter
+}
+
+func newFirewallNotifier(upstream notify.Notifier, counter prometheus.Counter) *firewallNotifier {
+	return &firewallNotifier{
+		upstream: upstream,
+		counter:  counter,
+	}
+}
+
+func (n *firewallNotifier) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	retry, err := n.upstream.Notify(ctx, alerts...)
+	if err != nil && errors.Is(err, util_net.ErrBlockedAddress) {
+		n.counter.Inc()
+		// Don't retry this notification later, it would be blocked again.
+		return false, fmt.Errorf("%w: %s", errBlockedByFirewall, err)
+	}
+
+	return retry, err
+}
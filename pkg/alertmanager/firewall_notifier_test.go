@@ -0,0 +1,140 @@
+package alertmanager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	util_net "github.com/cortexproject/cortex/pkg/util/net"
+)
+
+func TestFirewallNotifier(t *testing.T) {
+	serverInvoked := atomic.NewBool(false)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		serverInvoked.Store(true)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	parseCIDR := func(s string) flagext.CIDR {
+		cidr := flagext.CIDR{}
+		require.NoError(t, cidr.Set(s))
+		return cidr
+	}
+
+	tests := map[string]struct {
+		url           string
+		limits        *mockAlertManagerLimits
+		expectBlocked bool
+	}{
+		"should deliver to a loopback address without firewall": {
+			url:    server.URL,
+			limits: &mockAlertManagerLimits{},
+		},
+		"should reject the delivery to a loopback address when blocking the private addresses": {
+			url:           server.URL,
+			limits:        &mockAlertManagerLimits{blockPrivateAddresses: true},
+			expectBlocked: true,
+		},
+		"should reject the delivery to a blocked CIDR": {
+			url:           "http://192.0.2.1/alerts",
+			limits:        &mockAlertManagerLimits{blockCIDRNetworks: []flagext.CIDR{parseCIDR("192.0.2.0/24")}},
+			expectBlocked: true,
+		},
+		"should reject the delivery to a blocked hostname before resolving it": {
+			url:           "http://localhost:" + serverURL.Port(),
+			limits:        &mockAlertManagerLimits{blockHostnames: []string{"localhost"}},
+			expectBlocked: true,
+		},
+		"should reject the delivery to a hostname resolving to a blocked address": {
+			url:           "http://localhost:" + serverURL.Port(),
+			limits:        &mockAlertManagerLimits{blockPrivateAddresses: true},
+			expectBlocked: true,
+		},
+		"should deliver to a loopback address in the allowed CIDRs": {
+			url: server.URL,
+			limits: &mockAlertManagerLimits{
+				blockPrivateAddresses: true,
+				allowCIDRNetworks:     []flagext.CIDR{parseCIDR("127.0.0.0/8")},
+			},
+		},
+		"should deliver to an allowed hostname resolving to a blocked address": {
+			url: "http://localhost:" + serverURL.Port(),
+			limits: &mockAlertManagerLimits{
+				blockPrivateAddresses: true,
+				allowHostnames:        []string{"localhost"},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			serverInvoked.Store(false)
+
+			webhookURL, err := url.Parse(testData.url)
+			require.NoError(t, err)
+
+			tmpl, err := template.FromGlobs()
+			require.NoError(t, err)
+			tmpl.ExternalURL = &url.URL{}
+
+			counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "blocked_total"})
+			firewallDialer := util_net.NewFirewallDialer(newFirewallDialerConfigProvider("user-1", testData.limits))
+			integrations, err := buildReceiverIntegrations(&config.Receiver{
+				Name: "test",
+				WebhookConfigs: []*config.WebhookConfig{{
+					NotifierConfig: config.NotifierConfig{VSendResolved: true},
+					HTTPConfig:     &commoncfg.HTTPClientConfig{},
+					URL:            &config.URL{URL: webhookURL},
+				}},
+			}, tmpl, firewallDialer, log.NewNopLogger(), func(_ string, n notify.Notifier) notify.Notifier {
+				return newFirewallNotifier(n, counter)
+			})
+			require.NoError(t, err)
+			require.Len(t, integrations, 1)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ctx = notify.WithGroupKey(ctx, "1")
+
+			retry, err := integrations[0].Notify(ctx, &types.Alert{Alert: model.Alert{
+				Labels:   model.LabelSet{model.AlertNameLabel: "test"},
+				StartsAt: time.Now(),
+			}})
+
+			if testData.expectBlocked {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, errBlockedByFirewall))
+				assert.Contains(t, err.Error(), util_net.ErrBlockedAddress.Error())
+				assert.False(t, retry)
+				assert.False(t, serverInvoked.Load())
+				assert.Equal(t, float64(1), testutil.ToFloat64(counter))
+			} else {
+				require.NoError(t, err)
+				assert.True(t, serverInvoked.Load())
+				assert.Equal(t, float64(0), testutil.ToFloat64(counter))
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+)
+
+var (
+	errTooManySilences = "too many silences, limit: %d"
+	errSilenceTooBig   = "silence too big, size: %d bytes (limit: %d bytes)"
+)
+
+// limitsHandler rejects the alerts and silences posted to the Alertmanager API which exceed
+// the limits of the tenant with a 400 status code, before handing the requests to next.
+// The alerts are still checked by the alerts limiter once stored, since the alerts posted
+// concurrently may exceed the limits together.
+type limitsHandler struct {
+	next     http.Handler
+	alerts   *alertsLimiter
+	silences *silencesLimiter
+
+	alertsPaths   map[string]struct{}
+	silencesPaths map[string]struct{}
+}
+
+func newLimitsHandler(next http.Handler, prefix string, alerts *alertsLimiter, silences *silencesLimiter) *limitsHandler {
+	return &limitsHandler{
+		next:     next,
+		alerts:   alerts,
+		silences: silences,
+		alertsPaths: map[string]struct{}{
+			path.Join(prefix, "/api/v1/alerts"): {},
+			path.Join(prefix, "/api/v2/alerts"): {},
+		},
+		silencesPaths: map[string]struct{}{
+			path.Join(prefix, "/api/v1/silences"): {},
+			path.Join(prefix, "/api/v2/silences"): {},
+		},
+	}
+}
+
+func (h *limitsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		h.next.ServeHTTP(w, req)
+		return
+	}
+
+	_, isAlerts := h.alertsPaths[req.URL.Path]
+	_, isSilences := h.silencesPaths[req.URL.Path]
+	if !isAlerts && !isSilences {
+		h.next.ServeHTTP(w, req)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// The requests which can't be decoded are left to the API, which reports the error.
+	if isAlerts {
+		var alerts []model.Alert
+		if err := json.Unmarshal(body, &alerts); err == nil {
+			if err := h.alerts.checkAlerts(alerts); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	} else {
+		var sil postedSilence
+		if err := json.Unmarshal(body, &sil); err == nil {
+			if err := h.silences.checkSilence(sil); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	h.next.ServeHTTP(w, req)
+}
+
+// postedSilence is a silence posted to the Alertmanager API. The v1 and v2 APIs share the
+// same JSON format for the fields needed to check the limits.
+type postedSilence struct {
+	ID       string `json:"id"`
+	Matchers []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"matchers"`
+	CreatedBy string `json:"createdBy"`
+	Comment   string `json:"comment"`
+}
+
+func (s postedSilence) size() int {
+	size := len(s.CreatedBy) + len(s.Comment)
+	for _, m := range s.Matchers {
+		size += len(m.Name) + len(m.Value)
+	}
+	return size
+}
+
+// silencesLimiter limits the number of active and pending silences of a tenant, and the size
+// of each silence. The expired silences are kept until the end of the retention period, but
+// don't count towards the limit. The silences above the limits which are already stored,
+// like the ones loaded from a snapshot after a restart, are kept.
+type silencesLimiter struct {
+	tenant   string
+	limits   Limits
+	silences *silence.Silences
+
+	failureCounter prometheus.Counter
+}
+
+func newSilencesLimiter(tenant string, limits Limits, silences *silence.Silences, reg prometheus.Registerer) *silencesLimiter {
+	return &silencesLimiter{
+		tenant:   tenant,
+		limits:   limits,
+		silences: silences,
+		failureCounter: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "alertmanager_silences_insert_limited_total",
+			Help: "Number of silences rejected because of the limits.",
+		}),
+	}
+}
+
+func (s *silencesLimiter) checkSilence(sil postedSilence) error {
+	if sizeLimit := s.limits.AlertmanagerMaxSilenceSizeBytes(s.tenant); sizeLimit > 0 && sil.size() > sizeLimit {
+		s.failureCounter.Inc()
+		return fmt.Errorf(errSilenceTooBig, sil.size(), sizeLimit)
+	}
+
+	countLimit := s.limits.AlertmanagerMaxSilencesCount(s.tenant)
+	if countLimit <= 0 {
+		return nil
+	}
+
+	// Updating a silence which is not expired doesn't change the number of active and pending
+	// silences, even when the updated silence replaces it.
+	if sil.ID != "" {
+		if prev, err := s.silences.QueryOne(silence.QIDs(sil.ID)); err == nil && types.CalcSilenceState(prev.StartsAt, prev.EndsAt) != types.SilenceStateExpired {
+			return nil
+		}
+	}
+
+	// Counting the silences only fails on invalid query parameters.
+	count, err := s.silences.CountState(types.SilenceStateActive, types.SilenceStatePending)
+	if err != nil {
+		return nil
+	}
+	if count+1 > countLimit {
+		s.failureCounter.Inc()
+		return fmt.Errorf(errTooManySilences, countLimit)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAlertmanagerWithLimits(t *testing.T, limits *mockAlertManagerLimits) (*Alertmanager, *prometheus.Registry) {
+	reg := prometheus.NewPedanticRegistry()
+	am, err := New(&Config{
+		UserID:        "user-1",
+		Logger:        log.NewNopLogger(),
+		Limits:        limits,
+		TenantDataDir: t.TempDir(),
+		ExternalURL:   &url.URL{Path: "/am"},
+	}, reg)
+	require.NoError(t, err)
+	t.Cleanup(am.StopAndWait)
+
+	cfgRaw := `route:
+  receiver: dummy
+receivers:
+  - name: dummy`
+
+	cfg, err := config.Load(cfgRaw)
+	require.NoError(t, err)
+	require.NoError(t, am.ApplyConfig("user-1", cfg, cfgRaw))
+
+	return am, reg
+}
+
+func postToAlertmanager(t *testing.T, am *Alertmanager, path string, payload interface{}) *httptest.ResponseRecorder {
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	am.mux.ServeHTTP(w, req)
+	return w
+}
+
+func testSilence(id, comment string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        id,
+		"matchers":  []map[string]interface{}{{"name": "alertname", "value": "test", "isRegex": false}},
+		"startsAt":  time.Now().Format(time.RFC3339),
+		"endsAt":    time.Now().Add(time.Hour).Format(time.RFC3339),
+		"createdBy": "test",
+		"comment":   comment,
+	}
+}
+
+func TestAlertmanager_ShouldRejectTheSilencesExceedingTheLimits(t *testing.T) {
+	am, reg := newAlertmanagerWithLimits(t, &mockAlertManagerLimits{maxSilencesCount: 2, maxSilenceSizeBytes: 50})
+
+	for _, path := range []string{"/am/api/v1/silences", "/am/api/v2/silences"} {
+		w := postToAlertmanager(t, am, path, testSilence("", "first"))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// A third silence exceeds the count limit.
+	w := postToAlertmanager(t, am, "/am/api/v2/silences", testSilence("", "third"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, fmt.Sprintf(errTooManySilences, 2), strings.TrimSpace(w.Body.String()))
+
+	// The existing silences can still be updated.
+	silences, _, err := am.silences.Query()
+	require.NoError(t, err)
+	require.Len(t, silences, 2)
+	w = postToAlertmanager(t, am, "/am/api/v2/silences", testSilence(silences[0].Id, "updated"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// A silence bigger than the size limit is rejected, even when updating an existing silence.
+	w = postToAlertmanager(t, am, "/am/api/v2/silences", testSilence(silences[0].Id, strings.Repeat("x", 50)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, fmt.Sprintf(errSilenceTooBig, len("alertname")+len("test")+len("test")+50, 50), strings.TrimSpace(w.Body.String()))
+
+	// Once a silence is expired, a new one can be created.
+	require.NoError(t, am.silences.Expire(silences[1].Id))
+	w = postToAlertmanager(t, am, "/am/api/v2/silences", testSilence("", "third"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP alertmanager_silences_insert_limited_total Number of silences rejected because of the limits.
+		# TYPE alertmanager_silences_insert_limited_total counter
+		alertmanager_silences_insert_limited_total 2
+	`), "alertmanager_silences_insert_limited_total"))
+}
+
+func TestAlertmanager_ShouldKeepTheSilencesAboveTheLimitsAlreadyStored(t *testing.T) {
+	limits := &mockAlertManagerLimits{}
+	am, _ := newAlertmanagerWithLimits(t, limits)
+
+	// The silences are stored before the limit is set, like the silences loaded after a restart.
+	for i := 0; i < 3; i++ {
+		_, err := am.silences.Set(&silencepb.Silence{
+			Matchers:  []*silencepb.Matcher{{Name: "alertname", Pattern: fmt.Sprintf("test-%d", i)}},
+			StartsAt:  time.Now(),
+			EndsAt:    time.Now().Add(time.Hour),
+			CreatedBy: "test",
+			Comment:   "test",
+		})
+		require.NoError(t, err)
+	}
+	limits.maxSilencesCount = 2
+
+	w := postToAlertmanager(t, am, "/am/api/v2/silences", testSilence("", "new"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	count, err := am.silences.CountState(types.SilenceStateActive)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	_, err = am.silences.QueryOne(silence.QMatches(model.LabelSet{"alertname": "test-2"}))
+	assert.NoError(t, err)
+}
+
+func TestAlertmanager_ShouldRejectTheAlertsExceedingTheLimits(t *testing.T) {
+	testAlert := func(name, annotation string) map[string]interface{} {
+		return map[string]interface{}{
+			"labels":      map[string]string{"alertname": name},
+			"annotations": map[string]string{"summary": annotation},
+			"startsAt":    time.Now().Format(time.RFC3339),
+		}
+	}
+
+	t.Run("max alerts count", func(t *testing.T) {
+		am, reg := newAlertmanagerWithLimits(t, &mockAlertManagerLimits{maxAlertsCount: 2})
+
+		w := postToAlertmanager(t, am, "/am/api/v2/alerts", []interface{}{testAlert("first", ""), testAlert("second", "")})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		// The request adding an alert is rejected as a whole.
+		w = postToAlertmanager(t, am, "/am/api/v1/alerts", []interface{}{testAlert("first", "updated"), testAlert("third", "")})
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, fmt.Sprintf(errTooManyAlerts, 2), strings.TrimSpace(w.Body.String()))
+
+		// The existing alerts can still be updated.
+		w = postToAlertmanager(t, am, "/am/api/v2/alerts", []interface{}{testAlert("first", "updated")})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP alertmanager_alerts_insert_limited_total Number of failures to insert new alerts to in-memory alert store.
+			# TYPE alertmanager_alerts_insert_limited_total counter
+			alertmanager_alerts_insert_limited_total 2
+		`), "alertmanager_alerts_insert_limited_total"))
+	})
+
+	t.Run("max alerts size", func(t *testing.T) {
+		am, _ := newAlertmanagerWithLimits(t, &mockAlertManagerLimits{maxAlertsSizeBytes: 100})
+
+		w := postToAlertmanager(t, am, "/am/api/v2/alerts", []interface{}{testAlert("first", "")})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = postToAlertmanager(t, am, "/am/api/v2/alerts", []interface{}{testAlert("first", strings.Repeat("x", 100))})
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, fmt.Sprintf(errAlertsTooBig, 100), strings.TrimSpace(w.Body.String()))
+	})
+}
@@ -0,0 +1,50 @@
+package merger
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// V1NotificationsCount implements the Merger interface for GET /v1/notifications/count. The
+// highest count of each sender and hour is kept, like the replicas do when merging their counts.
+type V1NotificationsCount struct{}
+
+func (V1NotificationsCount) MergeResponses(in [][]byte) ([]byte, error) {
+	type notificationsCount struct {
+		Sender string    `json:"sender"`
+		Hour   time.Time `json:"hour"`
+		Count  uint64    `json:"count"`
+	}
+	type key struct {
+		sender string
+		hour   int64
+	}
+
+	counts := map[key]notificationsCount{}
+	for _, body := range in {
+		var parsed []notificationsCount
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return nil, err
+		}
+		for _, c := range parsed {
+			k := key{sender: c.Sender, hour: c.Hour.Unix()}
+			if existing, ok := counts[k]; !ok || c.Count > existing.Count {
+				counts[k] = c
+			}
+		}
+	}
+
+	merged := make([]notificationsCount, 0, len(counts))
+	for _, c := range counts {
+		merged = append(merged, c)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if !merged[i].Hour.Equal(merged[j].Hour) {
+			return merged[i].Hour.Before(merged[j].Hour)
+		}
+		return merged[i].Sender < merged[j].Sender
+	})
+
+	return json.Marshal(merged)
+}
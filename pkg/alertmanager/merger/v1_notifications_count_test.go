@@ -0,0 +1,31 @@
+package merger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestV1NotificationsCount(t *testing.T) {
+	in := [][]byte{
+		[]byte(`[` +
+			`{"sender":"a","hour":"2021-04-28T17:00:00Z","count":3},` +
+			`{"sender":"a","hour":"2021-04-28T18:00:00Z","count":1}` +
+			`]`),
+		[]byte(`[` +
+			`{"sender":"a","hour":"2021-04-28T18:00:00Z","count":2},` +
+			`{"sender":"b","hour":"2021-04-28T17:00:00Z","count":5}` +
+			`]`),
+		[]byte(`[]`),
+	}
+
+	expected := []byte(`[` +
+		`{"sender":"a","hour":"2021-04-28T17:00:00Z","count":3},` +
+		`{"sender":"b","hour":"2021-04-28T17:00:00Z","count":5},` +
+		`{"sender":"a","hour":"2021-04-28T18:00:00Z","count":2}` +
+		`]`)
+
+	out, err := V1NotificationsCount{}.MergeResponses(in)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(out))
+}
@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -88,6 +90,11 @@ type MultitenantAlertmanagerConfig struct {
 
 	// For the state persister.
 	Persister PersisterConfig `yaml:",inline"`
+
+	// For the secrets referenced by the tenants' configs.
+	SecretProvider SecretProviderConfig `yaml:"secret_provider"`
+
+	StateSyncTimeout time.Duration `yaml:"state_sync_timeout"`
 }
 
 type ClusterConfig struct {
@@ -119,9 +126,11 @@ func (cfg *MultitenantAlertmanagerConfig) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.EnableAPI, "experimental.alertmanager.enable-api", false, "Enable the experimental alertmanager config api.")
 
 	f.BoolVar(&cfg.ShardingEnabled, "alertmanager.sharding-enabled", false, "Shard tenants across multiple alertmanager instances.")
+	f.DurationVar(&cfg.StateSyncTimeout, "alertmanager.state-sync-timeout", defaultSettleReadTimeout, "Maximum time spent reading the silences and notification log of a tenant from the other replicas when starting its Alertmanager with sharding enabled, before falling back to reading them from storage. The instance only becomes ACTIVE in the ring once the state of all its tenants has been synced.")
 
 	cfg.AlertmanagerClient.RegisterFlagsWithPrefix("alertmanager.alertmanager-client", f)
 	cfg.Persister.RegisterFlagsWithPrefix("alertmanager", f)
+	cfg.SecretProvider.RegisterFlagsWithPrefix("alertmanager.secret-provider.", f)
 	cfg.ShardingRing.RegisterFlags(f)
 	cfg.Store.RegisterFlags(f)
 	cfg.Cluster.RegisterFlags(f)
@@ -151,6 +160,10 @@ func (cfg *MultitenantAlertmanagerConfig) Validate(storageCfg alertstore.Config)
 		return err
 	}
 
+	if err := cfg.SecretProvider.Validate(); err != nil {
+		return errors.Wrap(err, "invalid secret provider config")
+	}
+
 	if cfg.ShardingEnabled {
 		if !cfg.Store.IsDefaults() {
 			return errShardingLegacyStorage
@@ -169,6 +182,7 @@ func (cfg *MultitenantAlertmanagerConfig) Validate(storageCfg alertstore.Config)
 type multitenantAlertmanagerMetrics struct {
 	lastReloadSuccessful          *prometheus.GaugeVec
 	lastReloadSuccessfulTimestamp *prometheus.GaugeVec
+	configInvalid                 *prometheus.GaugeVec
 }
 
 func newMultitenantAlertmanagerMetrics(reg prometheus.Registerer) *multitenantAlertmanagerMetrics {
@@ -186,6 +200,12 @@ func newMultitenantAlertmanagerMetrics(reg prometheus.Registerer) *multitenantAl
 		Help:      "Timestamp of the last successful configuration reload.",
 	}, []string{"user"})
 
+	m.configInvalid = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cortex",
+		Name:      "alertmanager_config_invalid",
+		Help:      "Boolean set to 1 whenever the configuration of the user is invalid or exceeds the limits and has not been applied.",
+	}, []string{"user"})
+
 	return m
 }
 
@@ -199,6 +219,18 @@ type Limits interface {
 	// in the Alertmanager receivers for the given user.
 	AlertmanagerReceiversBlockPrivateAddresses(user string) bool
 
+	// AlertmanagerReceiversAllowCIDRNetworks returns the list of network CIDRs that should be allowed
+	// in the Alertmanager receivers for the given user, even if blocked by the other rules.
+	AlertmanagerReceiversAllowCIDRNetworks(user string) []flagext.CIDR
+
+	// AlertmanagerReceiversBlockHostnames returns the list of hostnames that should be blocked
+	// in the Alertmanager receivers for the given user.
+	AlertmanagerReceiversBlockHostnames(user string) []string
+
+	// AlertmanagerReceiversAllowHostnames returns the list of hostnames that should be allowed
+	// in the Alertmanager receivers for the given user, even if blocked by the other rules.
+	AlertmanagerReceiversAllowHostnames(user string) []string
+
 	// NotificationRateLimit methods return limit used by rate-limiter for given integration.
 	// If set to 0, no notifications are allowed.
 	// rate.Inf = all notifications are allowed.
@@ -230,6 +262,13 @@ type Limits interface {
 	// AlertmanagerMaxAlertsSizeBytes returns total max size of alerts that tenant can have active at the same time. 0 = no limit.
 	// Size of the alert is computed from alert labels, annotations and generator URL.
 	AlertmanagerMaxAlertsSizeBytes(tenant string) int
+
+	// AlertmanagerMaxSilencesCount returns max number of active and pending silences that tenant can have. 0 = no limit.
+	AlertmanagerMaxSilencesCount(tenant string) int
+
+	// AlertmanagerMaxSilenceSizeBytes returns max size of a single silence. 0 = no limit.
+	// Size of the silence is computed from silence matchers, comment and creator.
+	AlertmanagerMaxSilenceSizeBytes(tenant string) int
 }
 
 // A MultitenantAlertmanager manages Alertmanager instances for multiple
@@ -245,6 +284,8 @@ type MultitenantAlertmanager struct {
 	// When sharding is enabled:
 	//   ServeHTTP() -> distributor.DistributeRequest() -> (sends to other AM or even the current)
 	//     -> HandleRequest() (gRPC call) -> grpcServer() -> handlerForGRPCServer.ServeHTTP() -> serveRequest().
+	// The paths not supported by the distributor are served by serveRequest(), which proxies the
+	// requests of the tenants owned by other AMs with distributor.ProxyRequest().
 	ringLifecycler *ring.BasicLifecycler
 	ring           *ring.Ring
 	distributor    *Distributor
@@ -270,6 +311,12 @@ type MultitenantAlertmanager struct {
 	// Stores the current set of configurations we're running in each tenant's Alertmanager.
 	// Used for comparing configurations as we synchronize them.
 	cfgs map[string]alertspb.AlertConfigDesc
+	// Stores the secrets referenced by the configurations we're running, so that the
+	// configurations are applied again whenever the secrets change.
+	cfgSecrets map[string]map[string]string
+
+	// Resolves the secrets referenced by the configurations (nil if not configured).
+	secretProvider SecretProvider
 
 	logger              log.Logger
 	alertmanagerMetrics *alertmanagerMetrics
@@ -284,6 +331,7 @@ type MultitenantAlertmanager struct {
 	ringCheckErrors   prometheus.Counter
 	tenantsOwned      prometheus.Gauge
 	tenantsDiscovered prometheus.Gauge
+	tenantsFallback   prometheus.Gauge
 	syncTotal         *prometheus.CounterVec
 	syncFailures      *prometheus.CounterVec
 }
@@ -359,6 +407,7 @@ func createMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, fallbackC
 		cfg:                 cfg,
 		fallbackConfig:      string(fallbackConfig),
 		cfgs:                map[string]alertspb.AlertConfigDesc{},
+		cfgSecrets:          map[string]map[string]string{},
 		alertmanagers:       map[string]*Alertmanager{},
 		alertmanagerMetrics: newAlertmanagerMetrics(),
 		multitenantMetrics:  newMultitenantAlertmanagerMetrics(registerer),
@@ -387,6 +436,16 @@ func createMultitenantAlertmanager(cfg *MultitenantAlertmanagerConfig, fallbackC
 			Name: "cortex_alertmanager_tenants_owned",
 			Help: "Current number of tenants owned by the Alertmanager instance.",
 		}),
+		tenantsFallback: promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_alertmanager_tenants_using_fallback",
+			Help: "Current number of tenants without an Alertmanager configuration running the fallback configuration.",
+		}),
+	}
+
+	var err error
+	am.secretProvider, err = NewSecretProvider(cfg.SecretProvider)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Alertmanager's secret provider")
 	}
 
 	// Initialize the top-level metrics.
@@ -786,10 +845,14 @@ func (am *MultitenantAlertmanager) syncConfigs(cfgs map[string]alertspb.AlertCon
 		err := am.setConfig(cfg)
 		if err != nil {
 			am.multitenantMetrics.lastReloadSuccessful.WithLabelValues(user).Set(float64(0))
+			if errors.As(err, &invalidConfigError{}) {
+				am.multitenantMetrics.configInvalid.WithLabelValues(user).Set(float64(1))
+			}
 			level.Warn(am.logger).Log("msg", "error applying config", "err", err)
 			continue
 		}
 
+		am.multitenantMetrics.configInvalid.WithLabelValues(user).Set(float64(0))
 		am.multitenantMetrics.lastReloadSuccessful.WithLabelValues(user).Set(float64(1))
 		am.multitenantMetrics.lastReloadSuccessfulTimestamp.WithLabelValues(user).SetToCurrentTime()
 	}
@@ -802,11 +865,14 @@ func (am *MultitenantAlertmanager) syncConfigs(cfgs map[string]alertspb.AlertCon
 			userAlertmanagersToStop[userID] = userAM
 			delete(am.alertmanagers, userID)
 			delete(am.cfgs, userID)
+			delete(am.cfgSecrets, userID)
 			am.multitenantMetrics.lastReloadSuccessful.DeleteLabelValues(userID)
 			am.multitenantMetrics.lastReloadSuccessfulTimestamp.DeleteLabelValues(userID)
+			am.multitenantMetrics.configInvalid.DeleteLabelValues(userID)
 			am.alertmanagerMetrics.removeUserRegistry(userID)
 		}
 	}
+	am.updateTenantsUsingFallback()
 	am.alertmanagersMtx.Unlock()
 
 	// Now stop alertmanagers and wait until they are really stopped, without holding lock.
@@ -817,13 +883,32 @@ func (am *MultitenantAlertmanager) syncConfigs(cfgs map[string]alertspb.AlertCon
 	}
 }
 
+// invalidConfigError is returned by setConfig when the configuration of the user is rejected
+// because it's invalid or exceeds the limits.
+type invalidConfigError struct {
+	err error
+}
+
+func (e invalidConfigError) Error() string {
+	return e.err.Error()
+}
+
 // setConfig applies the given configuration to the alertmanager for `userID`,
 // creating an alertmanager if it doesn't already exist.
 func (am *MultitenantAlertmanager) setConfig(cfg alertspb.AlertConfigDesc) error {
 	var userAmConfig *amconfig.Config
+	var userSecrets map[string]string
 	var err error
 	var hasTemplateChanges bool
 
+	// The limits are checked before storing the templates, so that the user keeps running
+	// the last known working configuration, along with its templates.
+	if am.limits != nil {
+		if err := validateConfigLimits(cfg, am.limits); err != nil {
+			return invalidConfigError{err: fmt.Errorf("Cortex configuration for %v exceeds the limits: %v", cfg.User, err)}
+		}
+	}
+
 	for _, tmpl := range cfg.Templates {
 		templateFilepath, err := safeTemplateFilepath(filepath.Join(am.getTenantDirectory(cfg.User), templatesDir), tmpl.Filename)
 		if err != nil {
@@ -858,12 +943,12 @@ func (am *MultitenantAlertmanager) setConfig(cfg alertspb.AlertConfigDesc) error
 		}
 		rawCfg = am.fallbackConfig
 	} else {
-		userAmConfig, err = amconfig.Load(cfg.RawConfig)
+		userAmConfig, userSecrets, err = loadConfigWithSecrets(cfg.RawConfig, cfg.User, am.secretProvider)
 		if err != nil && hasExisting {
 			// This means that if a user has a working config and
 			// they submit a broken one, the Manager will keep running the last known
 			// working configuration.
-			return fmt.Errorf("invalid Cortex configuration for %v: %v", cfg.User, err)
+			return invalidConfigError{err: fmt.Errorf("invalid Cortex configuration for %v: %v", cfg.User, err)}
 		}
 	}
 
@@ -872,6 +957,9 @@ func (am *MultitenantAlertmanager) setConfig(cfg alertspb.AlertConfigDesc) error
 	// 2) then, submitted a non-working configuration (and we kept running the prev working config)
 	// 3) finally, the cortex AM instance is restarted and the running version is no longer present
 	if userAmConfig == nil {
+		if err != nil {
+			return invalidConfigError{err: fmt.Errorf("no usable Alertmanager configuration for %v: %v", cfg.User, err)}
+		}
 		return fmt.Errorf("no usable Alertmanager configuration for %v", cfg.User)
 	}
 
@@ -899,7 +987,7 @@ func (am *MultitenantAlertmanager) setConfig(cfg alertspb.AlertConfigDesc) error
 			return err
 		}
 		am.alertmanagers[cfg.User] = newAM
-	} else if am.cfgs[cfg.User].RawConfig != cfg.RawConfig || hasTemplateChanges {
+	} else if am.cfgs[cfg.User].RawConfig != cfg.RawConfig || hasTemplateChanges || !reflect.DeepEqual(am.cfgSecrets[cfg.User], userSecrets) {
 		level.Info(am.logger).Log("msg", "updating new per-tenant alertmanager", "user", cfg.User)
 		// If the config changed, apply the new one.
 		err := existing.ApplyConfig(cfg.User, userAmConfig, rawCfg)
@@ -909,9 +997,23 @@ func (am *MultitenantAlertmanager) setConfig(cfg alertspb.AlertConfigDesc) error
 	}
 
 	am.cfgs[cfg.User] = cfg
+	am.cfgSecrets[cfg.User] = userSecrets
+	am.updateTenantsUsingFallback()
 	return nil
 }
 
+// updateTenantsUsingFallback updates the number of tenants running the fallback configuration.
+// Must be called with the alertmanagersMtx lock held.
+func (am *MultitenantAlertmanager) updateTenantsUsingFallback() {
+	count := 0
+	for _, cfg := range am.cfgs {
+		if cfg.RawConfig == "" {
+			count++
+		}
+	}
+	am.tenantsFallback.Set(float64(count))
+}
+
 func (am *MultitenantAlertmanager) getTenantDirectory(userID string) string {
 	return filepath.Join(am.cfg.DataDir, userID)
 }
@@ -939,6 +1041,7 @@ func (am *MultitenantAlertmanager) newAlertmanager(userID string, amConfig *amco
 		Store:             am.store,
 		PersisterConfig:   am.cfg.Persister,
 		Limits:            am.limits,
+		StateSyncTimeout:  am.cfg.StateSyncTimeout,
 	}, reg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to start Alertmanager for user %v: %v", userID, err)
@@ -985,6 +1088,16 @@ func (am *MultitenantAlertmanager) ServeHTTP(w http.ResponseWriter, req *http.Re
 		return
 	}
 
+	// The silences listing is paginated and filtered once the silences of the replicas are merged.
+	if req.Method == http.MethodGet && req.URL.Path == am.silencesPath() && isSilencesPageRequest(req.URL.Query()) {
+		silencesPaginationHandler{next: http.HandlerFunc(am.routeRequest)}.ServeHTTP(w, req)
+		return
+	}
+
+	am.routeRequest(w, req)
+}
+
+func (am *MultitenantAlertmanager) routeRequest(w http.ResponseWriter, req *http.Request) {
 	if am.cfg.ShardingEnabled && am.distributor.IsPathSupported(req.URL.Path) {
 		am.distributor.DistributeRequest(w, req)
 		return
@@ -995,6 +1108,14 @@ func (am *MultitenantAlertmanager) ServeHTTP(w http.ResponseWriter, req *http.Re
 	am.serveRequest(w, req)
 }
 
+func (am *MultitenantAlertmanager) silencesPath() string {
+	return path.Join(am.cfg.ExternalURL.Path, "/api/v2/silences")
+}
+
+func (am *MultitenantAlertmanager) notificationsCountPath() string {
+	return path.Join(am.cfg.ExternalURL.Path, "/api/v1/notifications/count")
+}
+
 // HandleRequest implements gRPC Alertmanager service, which receives request from AlertManager-Distributor.
 func (am *MultitenantAlertmanager) HandleRequest(ctx context.Context, in *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
 	return am.grpcServer.Handle(ctx, in)
@@ -1007,6 +1128,13 @@ func (am *MultitenantAlertmanager) serveRequest(w http.ResponseWriter, req *http
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+
+	// The tenants owned by other instances are served by them, unless the request has already been
+	// proxied by another instance, to prevent proxying loops while the ring changes.
+	if am.cfg.ShardingEnabled && !isProxiedRequest(req) && !am.isUserOwned(userID) {
+		am.distributor.ProxyRequest(w, req)
+		return
+	}
 	am.alertmanagersMtx.Lock()
 	userAM, ok := am.alertmanagers[userID]
 	am.alertmanagersMtx.Unlock()
@@ -1016,6 +1144,13 @@ func (am *MultitenantAlertmanager) serveRequest(w http.ResponseWriter, req *http
 		return
 	}
 
+	// The notifications count is polled by the usage API, which must not store the fallback config
+	// of the tenants without one: they haven't sent any notification.
+	if req.URL.Path == am.notificationsCountPath() {
+		util.WriteJSONResponse(w, []NotificationsCount{})
+		return
+	}
+
 	if am.fallbackConfig != "" {
 		userAM, err = am.alertmanagerFromFallbackConfig(userID)
 		if err != nil {
@@ -24,6 +24,8 @@ import (
 	"github.com/prometheus/alertmanager/cluster/clusterpb"
 	"github.com/prometheus/alertmanager/notify"
 	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/silence"
+	"github.com/prometheus/alertmanager/silence/silencepb"
 	"github.com/prometheus/alertmanager/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
@@ -36,6 +38,7 @@ import (
 	"go.uber.org/atomic"
 	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
+	"gopkg.in/yaml.v2"
 
 	"github.com/cortexproject/cortex/pkg/alertmanager/alertmanagerpb"
 	"github.com/cortexproject/cortex/pkg/alertmanager/alertspb"
@@ -321,6 +324,156 @@ templates:
 	`), "cortex_alertmanager_config_last_reload_successful"))
 }
 
+func TestMultitenantAlertmanager_loadAndSyncConfigsShouldApplyTheConfigAgainWhenSecretsChange(t *testing.T) {
+	ctx := context.Background()
+
+	secretsDir := t.TempDir()
+	secretPath := filepath.Join(secretsDir, "user1", "token")
+	require.NoError(t, os.MkdirAll(filepath.Dir(secretPath), 0700))
+	require.NoError(t, ioutil.WriteFile(secretPath, []byte("first"), 0600))
+
+	store := prepareInMemoryAlertStore()
+	require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{
+		User: "user1",
+		RawConfig: `
+route:
+  receiver: dummy
+receivers:
+  - name: dummy
+    webhook_configs:
+      - url: http://localhost
+        http_config:
+          authorization:
+            credentials:
+              secret_ref: token
+`,
+		Templates: []*alertspb.TemplateDesc{},
+	}))
+
+	cfg := mockAlertmanagerConfig(t)
+	cfg.SecretProvider = SecretProviderConfig{Backend: SecretProviderFile, Directory: secretsDir}
+	am, err := createMultitenantAlertmanager(cfg, nil, nil, store, nil, nil, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+
+	require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+	require.Contains(t, am.alertmanagers, "user1")
+	assert.Equal(t, map[string]string{"token": "first"}, am.cfgSecrets["user1"])
+	dispatcher := am.alertmanagers["user1"].dispatcher
+
+	// The config isn't applied again if nothing changed.
+	require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+	assert.Same(t, dispatcher, am.alertmanagers["user1"].dispatcher)
+
+	// The config is applied again once the secret changes.
+	require.NoError(t, ioutil.WriteFile(secretPath, []byte("second"), 0600))
+	require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+	assert.Equal(t, map[string]string{"token": "second"}, am.cfgSecrets["user1"])
+	assert.NotSame(t, dispatcher, am.alertmanagers["user1"].dispatcher)
+
+	// The last working config keeps running if the secret is removed.
+	require.NoError(t, os.Remove(secretPath))
+	require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+	assert.Equal(t, map[string]string{"token": "second"}, am.cfgSecrets["user1"])
+	assert.Equal(t, float64(0), testutil.ToFloat64(am.multitenantMetrics.lastReloadSuccessful.WithLabelValues("user1")))
+}
+
+func TestMultitenantAlertmanager_loadAndSyncConfigsShouldEnforceTheLimits(t *testing.T) {
+	templatesCfg := simpleConfigOne + `
+templates:
+- 'first.tpl'
+- 'second.tpl'
+`
+	templates := []*alertspb.TemplateDesc{
+		{Filename: "first.tpl", Body: `{{ define "t1" }}Template 1{{ end }}`},
+		{Filename: "second.tpl", Body: `{{ define "t2" }}Template 2{{ end }}`},
+	}
+
+	tests := map[string]struct {
+		limits        mockAlertManagerLimits
+		expectedError string
+	}{
+		"max config size": {
+			limits:        mockAlertManagerLimits{maxConfigSize: len(templatesCfg)},
+			expectedError: fmt.Sprintf(errConfigurationTooBig, len(templatesCfg)),
+		},
+		"max templates count": {
+			limits:        mockAlertManagerLimits{maxTemplatesCount: 1},
+			expectedError: fmt.Sprintf(errTooManyTemplates, 2, 1),
+		},
+		"max template size": {
+			limits:        mockAlertManagerLimits{maxSizeOfTemplate: 10},
+			expectedError: fmt.Sprintf(errTemplateTooBig, "first.tpl", len(templates[0].Body), 10),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := context.Background()
+			limits := testData.limits
+
+			// The config of user1 is within the limits, while the one of user2 exceeds them.
+			store := prepareInMemoryAlertStore()
+			require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{User: "user1", RawConfig: simpleConfigOne, Templates: []*alertspb.TemplateDesc{}}))
+			require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{User: "user2", RawConfig: templatesCfg, Templates: templates}))
+
+			reg := prometheus.NewPedanticRegistry()
+			am, err := createMultitenantAlertmanager(mockAlertmanagerConfig(t), nil, nil, store, nil, &limits, log.NewNopLogger(), reg)
+			require.NoError(t, err)
+
+			require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+			require.Contains(t, am.alertmanagers, "user1")
+			require.NotContains(t, am.alertmanagers, "user2")
+			assert.Contains(t, am.setConfig(alertspb.AlertConfigDesc{User: "user2", RawConfig: templatesCfg, Templates: templates}).Error(), testData.expectedError)
+
+			// The templates of the config exceeding the limits aren't stored.
+			require.False(t, fileExists(t, filepath.Join(am.getTenantDirectory("user2"), templatesDir, "first.tpl")))
+
+			// user1 keeps running the last known working config once it exceeds the limits.
+			require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{User: "user1", RawConfig: templatesCfg, Templates: templates}))
+			require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+			require.Contains(t, am.alertmanagers, "user1")
+			assert.Equal(t, simpleConfigOne, am.cfgs["user1"].RawConfig)
+
+			assert.NoError(t, testutil.GatherAndCompare(reg, bytes.NewBufferString(`
+				# HELP cortex_alertmanager_config_invalid Boolean set to 1 whenever the configuration of the user is invalid or exceeds the limits and has not been applied.
+				# TYPE cortex_alertmanager_config_invalid gauge
+				cortex_alertmanager_config_invalid{user="user1"} 1
+				cortex_alertmanager_config_invalid{user="user2"} 1
+				# HELP cortex_alertmanager_config_last_reload_successful Boolean set to 1 whenever the last configuration reload attempt was successful.
+				# TYPE cortex_alertmanager_config_last_reload_successful gauge
+				cortex_alertmanager_config_last_reload_successful{user="user1"} 0
+				cortex_alertmanager_config_last_reload_successful{user="user2"} 0
+			`), "cortex_alertmanager_config_invalid", "cortex_alertmanager_config_last_reload_successful"))
+
+			// The config of user1 is applied again once it's within the limits.
+			require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{User: "user1", RawConfig: simpleConfigTwo, Templates: []*alertspb.TemplateDesc{}}))
+			require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+			assert.Equal(t, simpleConfigTwo, am.cfgs["user1"].RawConfig)
+			assert.Equal(t, float64(0), testutil.ToFloat64(am.multitenantMetrics.configInvalid.WithLabelValues("user1")))
+		})
+	}
+}
+
+func TestMultitenantAlertmanager_loadAndSyncConfigsShouldKeepTheLastWorkingConfigWhenInvalid(t *testing.T) {
+	ctx := context.Background()
+
+	store := prepareInMemoryAlertStore()
+	require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{User: "user1", RawConfig: simpleConfigOne, Templates: []*alertspb.TemplateDesc{}}))
+
+	am, err := createMultitenantAlertmanager(mockAlertmanagerConfig(t), nil, nil, store, nil, nil, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+
+	require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+	require.Contains(t, am.alertmanagers, "user1")
+	assert.Equal(t, float64(0), testutil.ToFloat64(am.multitenantMetrics.configInvalid.WithLabelValues("user1")))
+
+	require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{User: "user1", RawConfig: "invalid", Templates: []*alertspb.TemplateDesc{}}))
+	require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+	require.Contains(t, am.alertmanagers, "user1")
+	assert.Equal(t, simpleConfigOne, am.cfgs["user1"].RawConfig)
+	assert.Equal(t, float64(1), testutil.ToFloat64(am.multitenantMetrics.configInvalid.WithLabelValues("user1")))
+}
+
 func TestMultitenantAlertmanager_FirewallShouldBlockHTTPBasedReceiversWhenEnabled(t *testing.T) {
 	tests := map[string]struct {
 		getAlertmanagerConfig func(backendURL string) string
@@ -927,12 +1080,25 @@ receivers:
 	require.NoError(t, services.StartAndAwaitRunning(ctx, am))
 	defer services.StopAndAwaitTerminated(ctx, am) //nolint:errcheck
 
-	// Request when no user configuration is present.
-	req := httptest.NewRequest("GET", externalURL.String()+"/api/v1/status", nil)
+	// The notifications count of a tenant without configuration is empty, and doesn't start the
+	// Alertmanager with the fallback configuration.
+	req := httptest.NewRequest("GET", externalURL.String()+"/api/v1/notifications/count", nil)
 	w := httptest.NewRecorder()
 
 	am.ServeHTTP(w, req.WithContext(user.InjectOrgID(req.Context(), "user1")))
 
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `[]`, w.Body.String())
+	require.Len(t, am.alertmanagers, 0)
+	_, err = store.GetAlertConfig(ctx, "user1")
+	require.Equal(t, alertspb.ErrNotFound, err)
+
+	// Request when no user configuration is present.
+	req = httptest.NewRequest("GET", externalURL.String()+"/api/v1/status", nil)
+	w = httptest.NewRecorder()
+
+	am.ServeHTTP(w, req.WithContext(user.InjectOrgID(req.Context(), "user1")))
+
 	resp := w.Result()
 
 	// It succeeds and the Alertmanager is started.
@@ -963,6 +1129,110 @@ receivers:
 	require.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
+func TestMultitenantAlertmanager_ShouldDeliverTheAlertsOfTenantsWithoutConfigViaTheFallbackConfig(t *testing.T) {
+	ctx := context.Background()
+	userID := "user-1"
+
+	// Create the webhook servers of the fallback and the tenant configurations.
+	newWebhookServer := func(received *atomic.Int64) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			received.Inc()
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	fallbackReceived, tenantReceived := atomic.NewInt64(0), atomic.NewInt64(0)
+	fallbackServer := newWebhookServer(fallbackReceived)
+	tenantServer := newWebhookServer(tenantReceived)
+
+	webhookConfig := func(url string) string {
+		return fmt.Sprintf(`
+route:
+  receiver: webhook
+  group_wait: 0s
+  group_interval: 1s
+
+receivers:
+  - name: webhook
+    webhook_configs:
+      - url: %s
+`, url)
+	}
+	fallbackCfg := webhookConfig(fallbackServer.URL)
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	store := prepareInMemoryAlertStore()
+	cfg := mockAlertmanagerConfig(t)
+	reg := prometheus.NewPedanticRegistry()
+	am, err := createMultitenantAlertmanager(cfg, []byte(fallbackCfg), nil, store, nil, overrides, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, am))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, am))
+	})
+
+	pushAlert := func(name string) {
+		alerts, err := json.Marshal([]model.Alert{{
+			Labels:   model.LabelSet{model.AlertNameLabel: model.LabelValue(name)},
+			StartsAt: time.Now().Add(-time.Minute),
+		}})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, cfg.ExternalURL.String()+"/api/v1/alerts", bytes.NewReader(alerts))
+		req.Header.Set("content-type", "application/json")
+		w := httptest.NewRecorder()
+		am.ServeHTTP(w, req.WithContext(user.InjectOrgID(req.Context(), userID)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	assertTenantsUsingFallback := func(expected int) {
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+		# HELP cortex_alertmanager_tenants_using_fallback Current number of tenants without an Alertmanager configuration running the fallback configuration.
+		# TYPE cortex_alertmanager_tenants_using_fallback gauge
+		cortex_alertmanager_tenants_using_fallback %d
+	`, expected)), "cortex_alertmanager_tenants_using_fallback"))
+	}
+
+	// The alert of the tenant without a configuration is delivered via the fallback configuration.
+	assertTenantsUsingFallback(0)
+	pushAlert("first")
+	test.Poll(t, 3*time.Second, true, func() interface{} {
+		return fallbackReceived.Load() > 0
+	})
+	assertTenantsUsingFallback(1)
+
+	// The API reports the fallback configuration as such.
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/alerts", nil)
+	w := httptest.NewRecorder()
+	am.GetUserConfig(w, req.WithContext(user.InjectOrgID(req.Context(), userID)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	userCfg := UserConfig{}
+	require.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &userCfg))
+	assert.Equal(t, fallbackCfg, userCfg.AlertmanagerConfig)
+	assert.True(t, userCfg.Fallback)
+
+	// Once the tenant uploads a configuration, its Alertmanager switches to it.
+	require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{
+		User:      userID,
+		RawConfig: webhookConfig(tenantServer.URL),
+	}))
+	require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+	assertTenantsUsingFallback(0)
+
+	fallbackReceivedBefore := fallbackReceived.Load()
+	pushAlert("second")
+	test.Poll(t, 3*time.Second, true, func() interface{} {
+		return tenantReceived.Load() > 0
+	})
+	assert.Equal(t, fallbackReceivedBefore, fallbackReceived.Load())
+}
+
 func TestMultitenantAlertmanager_InitialSyncWithSharding(t *testing.T) {
 	tc := []struct {
 		name          string
@@ -1861,6 +2131,84 @@ func TestAlertmanager_StateReplicationWithSharding_InitialSyncFromPeers(t *testi
 	}
 }
 
+func TestMultitenantAlertmanager_ShouldSyncTheStateFromTheReplicasBeforeBecomingActive(t *testing.T) {
+	ctx := context.Background()
+	ringStore := consul.NewInMemoryClient(ring.GetCodec())
+	mockStore := prepareInMemoryAlertStore()
+	clientPool := newPassthroughAlertmanagerClientPool()
+	registries := util.NewUserRegistries()
+
+	require.NoError(t, mockStore.SetAlertConfig(ctx, alertspb.AlertConfigDesc{
+		User:      "u-1",
+		RawConfig: simpleConfigOne,
+		Templates: []*alertspb.TemplateDesc{},
+	}))
+
+	newInstance := func(i int) *MultitenantAlertmanager {
+		instanceID := fmt.Sprintf("alertmanager-%d", i)
+
+		amConfig := mockAlertmanagerConfig(t)
+		amConfig.ShardingEnabled = true
+		amConfig.ShardingRing.ReplicationFactor = 2
+		amConfig.ShardingRing.InstanceID = instanceID
+		amConfig.ShardingRing.InstanceAddr = fmt.Sprintf("127.0.0.%d", i)
+		amConfig.ShardingRing.RingCheckPeriod = time.Hour
+		amConfig.PollInterval = time.Hour
+
+		reg := prometheus.NewPedanticRegistry()
+		am, err := createMultitenantAlertmanager(amConfig, nil, nil, mockStore, ringStore, nil, log.NewNopLogger(), reg)
+		require.NoError(t, err)
+
+		clientPool.setServer(amConfig.ShardingRing.InstanceAddr+":0", am)
+		am.alertmanagerClientsPool = clientPool
+		registries.AddUserRegistry(instanceID, reg)
+
+		t.Cleanup(func() {
+			require.NoError(t, services.StopAndAwaitTerminated(ctx, am))
+		})
+		return am
+	}
+
+	// Start the first replica and create a silence.
+	i1 := newInstance(1)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, i1))
+
+	i1.alertmanagersMtx.Lock()
+	silenceID, err := i1.alertmanagers["u-1"].silences.Set(&silencepb.Silence{
+		Matchers: []*silencepb.Matcher{{Name: "instance", Pattern: "prometheus-one"}},
+		Comment:  "Created for a test case.",
+		StartsAt: time.Now(),
+		EndsAt:   time.Now().Add(time.Hour),
+	})
+	i1.alertmanagersMtx.Unlock()
+	require.NoError(t, err)
+
+	// Scale up with a second replica, and wait until it's ACTIVE in the ring.
+	i2 := newInstance(2)
+	require.NoError(t, i2.StartAsync(ctx))
+	{
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		require.NoError(t, ring.WaitInstanceState(ctx, i1.ring, "alertmanager-2", ring.ACTIVE))
+	}
+
+	// The second replica has the silence as soon as it's ACTIVE, since it has read it from the first one.
+	i2.alertmanagersMtx.Lock()
+	silences, _, err := i2.alertmanagers["u-1"].silences.Query(silence.QIDs(silenceID))
+	i2.alertmanagersMtx.Unlock()
+	require.NoError(t, err)
+	require.Len(t, silences, 1)
+	assert.Equal(t, "Created for a test case.", silences[0].Comment)
+
+	// The replica is ACTIVE in the ring before it's done starting, so it's stopped once running.
+	require.NoError(t, i2.AwaitRunning(ctx))
+
+	// Only the first replica, having no other replica to read the state from, has fallen back to storage.
+	metrics := registries.BuildMetricFamiliesPerUser()
+	assert.Equal(t, float64(2), metrics.GetSumOfCounters("cortex_alertmanager_state_initial_sync_total"))
+	assert.Equal(t, float64(1), metrics.GetSumOfCounters("cortex_alertmanager_state_initial_sync_fallbacks_total"))
+}
+
 // prepareInMemoryAlertStore builds and returns an in-memory alert store.
 func prepareInMemoryAlertStore() alertstore.AlertStore {
 	return bucketclient.NewBucketAlertStore(objstore.NewInMemBucket(), nil, log.NewNopLogger())
@@ -1973,6 +2321,196 @@ receivers:
 	require.Contains(t, err.Error(), errRateLimited.Error())
 }
 
+func TestMultitenantAlertmanager_ShouldRateLimitTheNotificationsPerIntegration(t *testing.T) {
+	const (
+		userID        = "user-1"
+		notifications = 20
+	)
+	ctx := context.Background()
+
+	// Create the local HTTP servers counting the received notifications.
+	webhookCalls := atomic.NewInt64(0)
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		webhookCalls.Inc()
+	}))
+	defer webhookServer.Close()
+
+	pagerdutyCalls := atomic.NewInt64(0)
+	pagerdutyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		pagerdutyCalls.Inc()
+	}))
+	defer pagerdutyServer.Close()
+
+	store := prepareInMemoryAlertStore()
+	require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{
+		User: userID,
+		RawConfig: fmt.Sprintf(`
+route:
+  receiver: team
+
+receivers:
+  - name: team
+    webhook_configs:
+      - url: %s
+        send_resolved: false
+    pagerduty_configs:
+      - url: %s
+        routing_key: secret
+`, webhookServer.URL, pagerdutyServer.URL),
+	}))
+
+	// Only the webhook integration is rate limited, allowing a single notification at once.
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.NotificationRateLimitPerIntegration = validation.NotificationRateLimitMap{"webhook": 0.001}
+
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	reg := prometheus.NewPedanticRegistry()
+	am, err := createMultitenantAlertmanager(mockAlertmanagerConfig(t), nil, nil, store, nil, overrides, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	require.NoError(t, am.loadAndSyncConfigs(ctx, reasonPeriodic))
+
+	am.alertmanagersMtx.Lock()
+	uam := am.alertmanagers[userID]
+	am.alertmanagersMtx.Unlock()
+	require.NotNil(t, uam)
+	defer uam.StopAndWait()
+
+	// Flood the receiver, with a different alert group for each notification to not deduplicate them.
+	for i := 0; i < notifications; i++ {
+		alert := &types.Alert{
+			Alert: model.Alert{
+				Labels:   model.LabelSet{model.AlertNameLabel: model.LabelValue(fmt.Sprintf("alert-%d", i))},
+				StartsAt: time.Now().Add(-time.Minute),
+				EndsAt:   time.Now().Add(time.Hour),
+			},
+			UpdatedAt: time.Now(),
+		}
+
+		notifyCtx := notify.WithReceiverName(ctx, "team")
+		notifyCtx = notify.WithGroupKey(notifyCtx, fmt.Sprintf("group-%d", i))
+		notifyCtx = notify.WithGroupLabels(notifyCtx, alert.Labels)
+		notifyCtx = notify.WithRepeatInterval(notifyCtx, time.Hour)
+		notifyCtx = notify.WithNow(notifyCtx, time.Now())
+
+		_, _, err := uam.lastPipeline.Exec(notifyCtx, log.NewNopLogger(), alert)
+		if i == 0 {
+			require.NoError(t, err)
+		} else {
+			require.Error(t, err)
+			require.Contains(t, err.Error(), errRateLimited.Error())
+		}
+	}
+
+	assert.Equal(t, int64(1), webhookCalls.Load())
+	assert.Equal(t, int64(notifications), pagerdutyCalls.Load())
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+		# HELP cortex_alertmanager_notification_rate_limited_total Total number of rate-limited notifications per integration.
+		# TYPE cortex_alertmanager_notification_rate_limited_total counter
+		cortex_alertmanager_notification_rate_limited_total{integration="pagerduty",user="user-1"} 0
+		cortex_alertmanager_notification_rate_limited_total{integration="webhook",user="user-1"} %d
+	`, notifications-1)), "cortex_alertmanager_notification_rate_limited_total"))
+}
+
+func TestMultitenantAlertmanager_ServeHTTPWithShardingShouldProxyToTheOwner(t *testing.T) {
+	ctx := context.Background()
+	ringStore := consul.NewInMemoryClient(ring.GetCodec())
+	mockStore := prepareInMemoryAlertStore()
+	clientPool := newPassthroughAlertmanagerClientPool()
+	externalURL := flagext.URLValue{}
+	require.NoError(t, externalURL.Set("http://localhost:8080/alertmanager"))
+
+	require.NoError(t, mockStore.SetAlertConfig(ctx, alertspb.AlertConfigDesc{
+		User:      "user-1",
+		RawConfig: simpleConfigOne,
+		Templates: []*alertspb.TemplateDesc{},
+	}))
+
+	var instances []*MultitenantAlertmanager
+	var instanceIDs []string
+	var registries []*prometheus.Registry
+
+	for i := 1; i <= 2; i++ {
+		instanceID := fmt.Sprintf("alertmanager-%d", i)
+
+		amConfig := mockAlertmanagerConfig(t)
+		amConfig.ExternalURL = externalURL
+		amConfig.ShardingEnabled = true
+		amConfig.ShardingRing.ReplicationFactor = 1
+		amConfig.ShardingRing.InstanceID = instanceID
+		amConfig.ShardingRing.InstanceAddr = fmt.Sprintf("127.0.0.%d", i)
+
+		// Do not check the ring topology changes or poll in an interval in this test (we explicitly sync alertmanagers).
+		amConfig.PollInterval = time.Hour
+		amConfig.ShardingRing.RingCheckPeriod = time.Hour
+
+		reg := prometheus.NewPedanticRegistry()
+		am, err := createMultitenantAlertmanager(amConfig, nil, nil, mockStore, ringStore, nil, log.NewNopLogger(), reg)
+		require.NoError(t, err)
+		defer services.StopAndAwaitTerminated(ctx, am) //nolint:errcheck
+
+		clientPool.setServer(amConfig.ShardingRing.InstanceAddr+":0", am)
+		am.alertmanagerClientsPool = clientPool
+		am.distributor.alertmanagerClientsPool = clientPool
+
+		require.NoError(t, services.StartAndAwaitRunning(ctx, am))
+
+		instances = append(instances, am)
+		instanceIDs = append(instanceIDs, instanceID)
+		registries = append(registries, reg)
+	}
+
+	// Wait until the ring has settled, and sync the configs with the instances.
+	for _, am := range instances {
+		for _, id := range instanceIDs {
+			require.NoError(t, ring.WaitInstanceState(ctx, am.ring, id, ring.ACTIVE))
+		}
+	}
+	for _, am := range instances {
+		require.NoError(t, am.loadAndSyncConfigs(ctx, reasonRingChange))
+	}
+
+	owner, other := 0, 1
+	if !instances[owner].isUserOwned("user-1") {
+		owner, other = other, owner
+	}
+	require.True(t, instances[owner].isUserOwned("user-1"))
+	require.False(t, instances[other].isUserOwned("user-1"))
+
+	req := httptest.NewRequest(http.MethodGet, externalURL.String(), nil)
+	req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+
+	// The UI isn't supported by the distributor, but it's served by the owner of the tenant
+	// via any instance.
+	for _, am := range instances {
+		w := httptest.NewRecorder()
+		am.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	}
+
+	// The proxied requests are never proxied again.
+	{
+		proxied := req.Clone(req.Context())
+		proxied.Header.Set(proxiedRequestHeader, "true")
+
+		w := httptest.NewRecorder()
+		instances[other].ServeHTTP(w, proxied)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "the Alertmanager is not configured\n", w.Body.String())
+	}
+
+	for i, expected := range map[int]string{owner: "0", other: "1"} {
+		assert.NoError(t, testutil.GatherAndCompare(registries[i], strings.NewReader(`
+			# HELP cortex_alertmanager_distributor_proxied_requests_total Total number of requests proxied to an alertmanager owning the tenant.
+			# TYPE cortex_alertmanager_distributor_proxied_requests_total counter
+			cortex_alertmanager_distributor_proxied_requests_total `+expected+`
+		`), "cortex_alertmanager_distributor_proxied_requests_total"))
+	}
+}
+
 type passthroughAlertmanagerClient struct {
 	server alertmanagerpb.AlertmanagerServer
 }
@@ -1985,8 +2523,8 @@ func (am *passthroughAlertmanagerClient) ReadState(ctx context.Context, in *aler
 	return am.server.ReadState(ctx, in)
 }
 
-func (am *passthroughAlertmanagerClient) HandleRequest(context.Context, *httpgrpc.HTTPRequest, ...grpc.CallOption) (*httpgrpc.HTTPResponse, error) {
-	return nil, fmt.Errorf("unexpected call to HandleRequest")
+func (am *passthroughAlertmanagerClient) HandleRequest(ctx context.Context, in *httpgrpc.HTTPRequest, opts ...grpc.CallOption) (*httpgrpc.HTTPResponse, error) {
+	return am.server.HandleRequest(ctx, in)
 }
 
 func (am *passthroughAlertmanagerClient) RemoteAddress() string {
@@ -2031,6 +2569,13 @@ type mockAlertManagerLimits struct {
 	maxDispatcherAggregationGroups int
 	maxAlertsCount                 int
 	maxAlertsSizeBytes             int
+	maxSilencesCount               int
+	maxSilenceSizeBytes            int
+	blockPrivateAddresses          bool
+	blockCIDRNetworks              []flagext.CIDR
+	allowCIDRNetworks              []flagext.CIDR
+	blockHostnames                 []string
+	allowHostnames                 []string
 }
 
 func (m *mockAlertManagerLimits) AlertmanagerMaxConfigSize(tenant string) int {
@@ -2046,11 +2591,23 @@ func (m *mockAlertManagerLimits) AlertmanagerMaxTemplateSize(tenant string) int
 }
 
 func (m *mockAlertManagerLimits) AlertmanagerReceiversBlockCIDRNetworks(user string) []flagext.CIDR {
-	panic("implement me")
+	return m.blockCIDRNetworks
 }
 
 func (m *mockAlertManagerLimits) AlertmanagerReceiversBlockPrivateAddresses(user string) bool {
-	panic("implement me")
+	return m.blockPrivateAddresses
+}
+
+func (m *mockAlertManagerLimits) AlertmanagerReceiversAllowCIDRNetworks(user string) []flagext.CIDR {
+	return m.allowCIDRNetworks
+}
+
+func (m *mockAlertManagerLimits) AlertmanagerReceiversBlockHostnames(user string) []string {
+	return m.blockHostnames
+}
+
+func (m *mockAlertManagerLimits) AlertmanagerReceiversAllowHostnames(user string) []string {
+	return m.allowHostnames
 }
 
 func (m *mockAlertManagerLimits) NotificationRateLimit(_ string, integration string) rate.Limit {
@@ -2072,3 +2629,11 @@ func (m *mockAlertManagerLimits) AlertmanagerMaxAlertsCount(_ string) int {
 func (m *mockAlertManagerLimits) AlertmanagerMaxAlertsSizeBytes(_ string) int {
 	return m.maxAlertsSizeBytes
 }
+
+func (m *mockAlertManagerLimits) AlertmanagerMaxSilencesCount(_ string) int {
+	return m.maxSilencesCount
+}
+
+func (m *mockAlertManagerLimits) AlertmanagerMaxSilenceSizeBytes(_ string) int {
+	return m.maxSilenceSizeBytes
+}
@@ -0,0 +1,148 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+// NotificationsCountHours is the number of hours the notifications are counted over: the current
+// hour and the previous ones.
+const NotificationsCountHours = 24
+
+// NotificationsCount is the number of notifications sent within an hour by a replica of the
+// Alertmanager of a tenant.
+type NotificationsCount struct {
+	Sender string    `json:"sender"`
+	Hour   time.Time `json:"hour"`
+	Count  uint64    `json:"count"`
+}
+
+type notificationsCountKey struct {
+	sender string
+	hour   int64
+}
+
+// notificationCounter counts the notifications sent by the Alertmanager of a tenant by hour, over
+// the last NotificationsCountHours hours. Each replica of the Alertmanager of the tenant counts the
+// notifications it sends under its own sender ID, and replicates its counts to the other replicas,
+// which keep the highest count of each sender and hour. So the replicas converge to the same counts,
+// including the notifications sent by all of them, which can be read from a quorum of replicas.
+type notificationCounter struct {
+	sender string
+
+	mtx       sync.Mutex
+	counts    map[notificationsCountKey]uint64
+	broadcast func([]byte)
+}
+
+func newNotificationCounter() *notificationCounter {
+	return &notificationCounter{
+		// The sender ID only needs to be unique among the replicas of the Alertmanager of the tenant.
+		sender: fmt.Sprintf("%016x", rand.Uint64()),
+		counts: map[notificationsCountKey]uint64{},
+	}
+}
+
+// SetBroadcast sets the function replicating the counts to the other replicas.
+func (c *notificationCounter) SetBroadcast(f func([]byte)) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.broadcast = f
+}
+
+func (c *notificationCounter) inc(now time.Time) {
+	hour := now.Truncate(time.Hour)
+	key := notificationsCountKey{sender: c.sender, hour: hour.Unix()}
+
+	c.mtx.Lock()
+	c.counts[key]++
+	count := c.counts[key]
+	c.prune(now)
+	broadcast := c.broadcast
+	c.mtx.Unlock()
+
+	if broadcast == nil {
+		return
+	}
+	// Only the updated count is replicated, which is merged like the full counts.
+	if b, err := json.Marshal([]NotificationsCount{{Sender: c.sender, Hour: hour, Count: count}}); err == nil {
+		broadcast(b)
+	}
+}
+
+// MarshalBinary implements cluster.State.
+func (c *notificationCounter) MarshalBinary() ([]byte, error) {
+	return json.Marshal(c.list(time.Now()))
+}
+
+// Merge implements cluster.State.
+func (c *notificationCounter) Merge(b []byte) error {
+	var counts []NotificationsCount
+	if err := json.Unmarshal(b, &counts); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, count := range counts {
+		key := notificationsCountKey{sender: count.Sender, hour: count.Hour.Unix()}
+		if count.Count > c.counts[key] {
+			c.counts[key] = count.Count
+		}
+	}
+	c.prune(now)
+	return nil
+}
+
+// prune removes the counts older than the hours the notifications are counted over. It must be
+// called with the lock held.
+func (c *notificationCounter) prune(now time.Time) {
+	oldest := notificationsCountOldestHour(now)
+	for key := range c.counts {
+		if key.hour < oldest {
+			delete(c.counts, key)
+		}
+	}
+}
+
+// list returns the counts of the hours the notifications are counted over, sorted by hour and sender.
+func (c *notificationCounter) list(now time.Time) []NotificationsCount {
+	oldest := notificationsCountOldestHour(now)
+
+	c.mtx.Lock()
+	counts := make([]NotificationsCount, 0, len(c.counts))
+	for key, count := range c.counts {
+		if key.hour >= oldest {
+			counts = append(counts, NotificationsCount{Sender: key.sender, Hour: time.Unix(key.hour, 0).UTC(), Count: count})
+		}
+	}
+	c.mtx.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if !counts[i].Hour.Equal(counts[j].Hour) {
+			return counts[i].Hour.Before(counts[j].Hour)
+		}
+		return counts[i].Sender < counts[j].Sender
+	})
+	return counts
+}
+
+// ServeHTTP returns the counts in JSON format.
+func (c *notificationCounter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	util.WriteJSONResponse(w, c.list(time.Now()))
+}
+
+// notificationsCountOldestHour returns the Unix time of the oldest hour the notifications are counted over.
+func notificationsCountOldestHour(now time.Time) int64 {
+	return now.Truncate(time.Hour).Add(-(NotificationsCountHours - 1) * time.Hour).Unix()
+}
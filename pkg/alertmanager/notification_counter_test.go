@@ -0,0 +1,61 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationCounter(t *testing.T) {
+	now := time.Now().UTC()
+	hour := now.Truncate(time.Hour)
+
+	var broadcasts [][]byte
+	c := newNotificationCounter()
+	c.SetBroadcast(func(b []byte) { broadcasts = append(broadcasts, b) })
+
+	c.inc(now)
+	c.inc(now)
+
+	// Each increment replicates the updated count only.
+	require.Len(t, broadcasts, 2)
+	var broadcast []NotificationsCount
+	require.NoError(t, json.Unmarshal(broadcasts[1], &broadcast))
+	assert.Equal(t, []NotificationsCount{{Sender: c.sender, Hour: hour, Count: 2}}, broadcast)
+
+	// The counts of another replica are merged, keeping the highest count of each sender and hour,
+	// while the counts older than the hours the notifications are counted over are dropped.
+	other := newNotificationCounter()
+	other.inc(now.Add(-time.Hour))
+	require.NoError(t, c.Merge(broadcasts[0]))
+	state, err := other.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, c.Merge(state))
+	expired, err := json.Marshal([]NotificationsCount{{Sender: other.sender, Hour: hour.Add(-NotificationsCountHours * time.Hour), Count: 10}})
+	require.NoError(t, err)
+	require.NoError(t, c.Merge(expired))
+
+	expected := []NotificationsCount{
+		{Sender: other.sender, Hour: hour.Add(-time.Hour), Count: 1},
+		{Sender: c.sender, Hour: hour, Count: 2},
+	}
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/notifications/count", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var counts []NotificationsCount
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &counts))
+	assert.Equal(t, expected, counts)
+
+	// The replicas converge to the same counts.
+	state, err = c.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, other.Merge(state))
+	assert.Equal(t, expected, other.list(now))
+}
@@ -0,0 +1,166 @@
+package alertmanager
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+const (
+	// deliveryTraceIDAnnotation is the annotation of the alerts carrying their delivery trace ID,
+	// added by the Cortex ruler to a sample of the alerts it sends.
+	deliveryTraceIDAnnotation = "cortex_delivery_trace_id"
+
+	// NotificationHistorySize is the number of notifications kept in the notification history of each tenant.
+	NotificationHistorySize = 100
+)
+
+// NotifiedAlert is an alert of a notification.
+type NotifiedAlert struct {
+	Fingerprint     string `json:"fingerprint"`
+	DeliveryTraceID string `json:"delivery_trace_id,omitempty"`
+}
+
+// NotificationHistoryEntry is a notification sent to a receiver integration. The notifications
+// are recorded in the notification log by receiver and group key once sent successfully.
+type NotificationHistoryEntry struct {
+	Time            time.Time       `json:"time"`
+	Receiver        string          `json:"receiver"`
+	Integration     string          `json:"integration"`
+	GroupKey        string          `json:"group_key"`
+	Alerts          []NotifiedAlert `json:"alerts"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	Error           string          `json:"error,omitempty"`
+}
+
+// notificationHistory keeps the last notifications sent by the Alertmanager of a tenant.
+type notificationHistory struct {
+	mtx     sync.Mutex
+	entries []NotificationHistoryEntry
+	next    int
+}
+
+func newNotificationHistory() *notificationHistory {
+	return &notificationHistory{entries: make([]NotificationHistoryEntry, 0, NotificationHistorySize)}
+}
+
+func (h *notificationHistory) add(entry NotificationHistoryEntry) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if len(h.entries) < NotificationHistorySize {
+		h.entries = append(h.entries, entry)
+		return
+	}
+
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % NotificationHistorySize
+}
+
+// list returns the notifications, the most recent first.
+func (h *notificationHistory) list() []NotificationHistoryEntry {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	entries := make([]NotificationHistoryEntry, 0, len(h.entries))
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		entries = append(entries, h.entries[(h.next+i)%len(h.entries)])
+	}
+	return entries
+}
+
+// ServeHTTP returns the notifications in JSON format.
+func (h *notificationHistory) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	util.WriteJSONResponse(w, h.list())
+}
+
+// deliveryTracingNotifier records the notifications sent by the integration in the notification
+// history, and counts the ones sent successfully. The notifications of the alerts with a delivery
+// trace ID are logged and traced too.
+type deliveryTracingNotifier struct {
+	upstream    notify.Notifier
+	integration string
+	history     *notificationHistory
+	counter     *notificationCounter
+	logger      log.Logger
+}
+
+func newDeliveryTracingNotifier(upstream notify.Notifier, integration string, history *notificationHistory, counter *notificationCounter, logger log.Logger) *deliveryTracingNotifier {
+	return &deliveryTracingNotifier{
+		upstream:    upstream,
+		integration: integration,
+		history:     history,
+		counter:     counter,
+		logger:      logger,
+	}
+}
+
+func (n *deliveryTracingNotifier) Notify(ctx context.Context, alerts ...*types.Alert) (bool, error) {
+	receiver, _ := notify.ReceiverName(ctx)
+	groupKey, _ := notify.GroupKey(ctx)
+
+	notified := make([]NotifiedAlert, 0, len(alerts))
+	var traceIDs, fingerprints []string
+	for _, a := range alerts {
+		alert := NotifiedAlert{
+			Fingerprint:     a.Fingerprint().String(),
+			DeliveryTraceID: string(a.Annotations[deliveryTraceIDAnnotation]),
+		}
+		notified = append(notified, alert)
+
+		if alert.DeliveryTraceID != "" {
+			traceIDs = append(traceIDs, alert.DeliveryTraceID)
+			fingerprints = append(fingerprints, alert.Fingerprint)
+		}
+	}
+
+	var sp opentracing.Span
+	if len(traceIDs) > 0 {
+		sp, ctx = opentracing.StartSpanFromContext(ctx, "Alertmanager.Notify")
+		sp.SetTag("receiver", receiver)
+		sp.SetTag("integration", n.integration)
+		sp.SetTag("delivery_trace_ids", strings.Join(traceIDs, ","))
+		defer sp.Finish()
+	}
+
+	start := time.Now()
+	retry, err := n.upstream.Notify(ctx, alerts...)
+
+	entry := NotificationHistoryEntry{
+		Time:            start,
+		Receiver:        receiver,
+		Integration:     n.integration,
+		GroupKey:        groupKey,
+		Alerts:          notified,
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		n.counter.inc(start)
+	}
+	n.history.add(entry)
+
+	if len(traceIDs) > 0 {
+		if err != nil {
+			ext.Error.Set(sp, true)
+			sp.LogKV("error", err.Error())
+		}
+
+		level.Info(n.logger).Log("msg", "notified alerts with delivery trace", "receiver", receiver, "integration", n.integration, "group_key", groupKey,
+			"delivery_trace_ids", strings.Join(traceIDs, ","), "fingerprints", strings.Join(fingerprints, ","), "duration", time.Since(start), "err", err)
+	}
+
+	return retry, err
+}
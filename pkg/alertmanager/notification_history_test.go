@@ -0,0 +1,86 @@
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/notify"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationHistory_ShouldKeepTheLastNotifications(t *testing.T) {
+	h := newNotificationHistory()
+	for i := 0; i < NotificationHistorySize+10; i++ {
+		h.add(NotificationHistoryEntry{GroupKey: fmt.Sprintf("group-%d", i)})
+	}
+
+	entries := h.list()
+	require.Len(t, entries, NotificationHistorySize)
+	assert.Equal(t, fmt.Sprintf("group-%d", NotificationHistorySize+9), entries[0].GroupKey)
+	assert.Equal(t, "group-10", entries[NotificationHistorySize-1].GroupKey)
+}
+
+func TestDeliveryTracingNotifier(t *testing.T) {
+	traced := &types.Alert{Alert: model.Alert{
+		Labels:      model.LabelSet{"alertname": "traced"},
+		Annotations: model.LabelSet{deliveryTraceIDAnnotation: "0123456789abcdef"},
+	}}
+	untraced := &types.Alert{Alert: model.Alert{
+		Labels: model.LabelSet{"alertname": "untraced"},
+	}}
+
+	history := newNotificationHistory()
+	counter := newNotificationCounter()
+	logs := &bytes.Buffer{}
+	logger := log.NewLogfmtLogger(logs)
+
+	ctx := notify.WithReceiverName(notify.WithGroupKey(context.Background(), "group"), "receiver")
+
+	// The first notification succeeds, while the second one is rate-limited.
+	_, err := newDeliveryTracingNotifier(&mockNotifier{}, "webhook", history, counter, logger).Notify(ctx, traced, untraced)
+	require.NoError(t, err)
+	rateLimited := newRateLimitedNotifier(&mockNotifier{}, &limiter{limit: 0, burst: 0}, time.Minute, prometheus.NewCounter(prometheus.CounterOpts{}))
+	_, err = newDeliveryTracingNotifier(rateLimited, "email", history, counter, logger).Notify(ctx, untraced)
+	require.Equal(t, errRateLimited, err)
+
+	w := httptest.NewRecorder()
+	history.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/notifications", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var entries []NotificationHistoryEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "email", entries[0].Integration)
+	assert.Equal(t, errRateLimited.Error(), entries[0].Error)
+	assert.Equal(t, []NotifiedAlert{{Fingerprint: untraced.Fingerprint().String()}}, entries[0].Alerts)
+
+	assert.Equal(t, "receiver", entries[1].Receiver)
+	assert.Equal(t, "webhook", entries[1].Integration)
+	assert.Equal(t, "group", entries[1].GroupKey)
+	assert.Empty(t, entries[1].Error)
+	assert.Equal(t, []NotifiedAlert{
+		{Fingerprint: traced.Fingerprint().String(), DeliveryTraceID: "0123456789abcdef"},
+		{Fingerprint: untraced.Fingerprint().String()},
+	}, entries[1].Alerts)
+
+	// Only the successful notification has been counted.
+	counts := counter.list(time.Now())
+	require.Len(t, counts, 1)
+	assert.Equal(t, uint64(1), counts[0].Count)
+
+	// Only the notification of the alert with a delivery trace has been logged.
+	assert.Equal(t, 1, bytes.Count(logs.Bytes(), []byte("notified alerts with delivery trace")))
+	assert.Contains(t, logs.String(), "delivery_trace_ids=0123456789abcdef fingerprints="+traced.Fingerprint().String())
+}
@@ -0,0 +1,294 @@
+package alertmanager
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/alertmanager/config"
+	commoncfg "github.com/prometheus/common/config"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// SecretProviderFile reads the secrets from files.
+	SecretProviderFile = "file"
+
+	// SecretProviderEnv reads the secrets from environment variables.
+	SecretProviderEnv = "env"
+
+	// The key of the secret references in the tenants' Alertmanager configs.
+	secretRefKey = "secret_ref"
+
+	// Format of the placeholders replacing the secret references before the config is loaded.
+	secretRefPlaceholderPrefix = "__cortex_secret_ref_"
+	secretRefPlaceholderSuffix = "__"
+)
+
+var (
+	supportedSecretProviders = []string{SecretProviderFile, SecretProviderEnv}
+
+	// The secret names can't contain any underscore, so that the environment variables of
+	// different tenants never clash.
+	secretNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.-]*$`)
+
+	// The secret references are resolved only in the fields of these types.
+	secretTypes = []reflect.Type{
+		reflect.TypeOf(commoncfg.Secret("")),
+		reflect.TypeOf(config.Secret("")),
+	}
+
+	errSecretNotFound              = errors.New("secret not found")
+	errUnsupportedSecretProvider   = fmt.Errorf("unsupported secret provider backend (supported values: %s)", strings.Join(supportedSecretProviders, ", "))
+	errMissingSecretsDirectory     = errors.New("the secrets directory is required by the file secret provider")
+	errSecretProviderNotConfigured = errors.New("setting secret_ref is not allowed because no secret provider is configured")
+	errSecretRefNotAllowed         = errors.New("setting secret_ref is only allowed in the secret fields, like passwords, credentials, API keys and OAuth2 client_secret")
+)
+
+// SecretProviderConfig configures the provider of the secrets referenced by the tenants' Alertmanager configs.
+type SecretProviderConfig struct {
+	Backend   string `yaml:"backend"`
+	Directory string `yaml:"directory"`
+	EnvPrefix string `yaml:"env_prefix"`
+}
+
+// RegisterFlagsWithPrefix registers flags with prefix.
+func (cfg *SecretProviderConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.StringVar(&cfg.Backend, prefix+"backend", "", fmt.Sprintf("Backend of the secrets referenced via secret_ref in the tenants' Alertmanager configs. Supported values are: %s. If empty, the secret references are not allowed.", strings.Join(supportedSecretProviders, ", ")))
+	f.StringVar(&cfg.Directory, prefix+"directory", "", "Directory of the secrets, when the file backend is used. The secret of a tenant is read from the file <directory>/<tenant ID>/<secret name>.")
+	f.StringVar(&cfg.EnvPrefix, prefix+"env-prefix", "CORTEX_ALERTMANAGER_SECRET_", "Prefix of the environment variables of the secrets, when the env backend is used. The secret of a tenant is read from the environment variable <prefix><tenant ID>_<secret name>.")
+}
+
+// Validate config and returns error on failure
+func (cfg *SecretProviderConfig) Validate() error {
+	switch cfg.Backend {
+	case "", SecretProviderEnv:
+		return nil
+	case SecretProviderFile:
+		if cfg.Directory == "" {
+			return errMissingSecretsDirectory
+		}
+		return nil
+	default:
+		return errUnsupportedSecretProvider
+	}
+}
+
+// SecretProvider resolves the secrets referenced by the tenants' Alertmanager configs.
+type SecretProvider interface {
+	// GetSecret returns the value of the tenant's secret with the given name, or errSecretNotFound
+	// if the tenant has no such secret.
+	GetSecret(userID, name string) (string, error)
+}
+
+// NewSecretProvider returns the configured SecretProvider, or nil if no backend is configured.
+func NewSecretProvider(cfg SecretProviderConfig) (SecretProvider, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case SecretProviderFile:
+		return fileSecretProvider{dir: cfg.Directory}, nil
+	case SecretProviderEnv:
+		return envSecretProvider{prefix: cfg.EnvPrefix}, nil
+	default:
+		return nil, errUnsupportedSecretProvider
+	}
+}
+
+type fileSecretProvider struct {
+	dir string
+}
+
+func (p fileSecretProvider) GetSecret(userID, name string) (string, error) {
+	// The tenant ID is used as directory name, so it must not point outside of the secrets directory.
+	if userID == "" || userID == "." || userID == ".." || strings.ContainsAny(userID, `/\`) {
+		return "", errSecretNotFound
+	}
+
+	value, err := ioutil.ReadFile(filepath.Join(p.dir, userID, name))
+	if os.IsNotExist(err) {
+		return "", errSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// The files written by hand usually end with a newline, which is never part of the secret.
+	return strings.TrimRight(string(value), "\r\n"), nil
+}
+
+type envSecretProvider struct {
+	prefix string
+}
+
+func (p envSecretProvider) GetSecret(userID, name string) (string, error) {
+	value, ok := os.LookupEnv(p.prefix + userID + "_" + name)
+	if !ok {
+		return "", errSecretNotFound
+	}
+	return value, nil
+}
+
+// loadConfigWithSecrets loads the tenant's Alertmanager config, resolving the secret references
+// through the provider. The secrets are returned too, so that the caller can detect when they change.
+func loadConfigWithSecrets(rawCfg, userID string, provider SecretProvider) (*config.Config, map[string]string, error) {
+	if !strings.Contains(rawCfg, secretRefKey) {
+		cfg, err := config.Load(rawCfg)
+		return cfg, nil, err
+	}
+
+	// The secret references are replaced with placeholders, so that the config can be loaded.
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(rawCfg), &doc); err != nil {
+		return nil, nil, err
+	}
+
+	var names []string
+	replaced, err := replaceSecretRefs(doc, &names)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(names) == 0 {
+		cfg, err := config.Load(rawCfg)
+		return cfg, nil, err
+	}
+	if provider == nil {
+		return nil, nil, errSecretProviderNotConfigured
+	}
+
+	secrets := make(map[string]string, len(names))
+	for _, name := range names {
+		if _, ok := secrets[name]; ok {
+			continue
+		}
+
+		value, err := provider.GetSecret(userID, name)
+		if errors.Is(err, errSecretNotFound) {
+			return nil, nil, fmt.Errorf("unknown secret %q referenced by secret_ref", name)
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to read secret %q", name)
+		}
+		secrets[name] = value
+	}
+
+	out, err := yaml.Marshal(replaced)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := config.Load(string(out))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Every placeholder must end up in a secret field, otherwise the secret could be leaked
+	// through a field which isn't redacted, like an URL.
+	resolved := make([]bool, len(names))
+	resolveSecretPlaceholders(reflect.ValueOf(cfg), names, secrets, resolved)
+	for _, ok := range resolved {
+		if !ok {
+			return nil, nil, errSecretRefNotAllowed
+		}
+	}
+
+	return cfg, secrets, nil
+}
+
+// replaceSecretRefs recursively replaces the secret references in the YAML node with placeholders,
+// appending the referenced secret names to names.
+func replaceSecretRefs(node interface{}, names *[]string) (interface{}, error) {
+	var err error
+
+	switch n := node.(type) {
+	case yaml.MapSlice:
+		if len(n) == 1 && n[0].Key == secretRefKey {
+			name, ok := n[0].Value.(string)
+			if !ok || !secretNameRegexp.MatchString(name) {
+				return nil, fmt.Errorf("invalid secret name %v referenced by secret_ref: the name should match %s", n[0].Value, secretNameRegexp.String())
+			}
+
+			*names = append(*names, name)
+			return secretRefPlaceholderPrefix + strconv.Itoa(len(*names)-1) + secretRefPlaceholderSuffix, nil
+		}
+
+		for i := range n {
+			if n[i].Value, err = replaceSecretRefs(n[i].Value, names); err != nil {
+				return nil, err
+			}
+		}
+
+	case []interface{}:
+		for i := range n {
+			if n[i], err = replaceSecretRefs(n[i], names); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return node, nil
+}
+
+// resolveSecretPlaceholders recursively replaces the placeholders found in the secret fields of the
+// config with the secrets, marking which placeholders have been resolved.
+func resolveSecretPlaceholders(v reflect.Value, names []string, secrets map[string]string, resolved []bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			resolveSecretPlaceholders(v.Elem(), names, secrets, resolved)
+		}
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			// Skip unexported fields.
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			resolveSecretPlaceholders(v.Field(i), names, secrets, resolved)
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			resolveSecretPlaceholders(v.Index(i), names, secrets, resolved)
+		}
+
+	case reflect.String:
+		if !v.CanSet() || !isSecretType(v.Type()) {
+			return
+		}
+
+		idx, ok := parseSecretRefPlaceholder(v.String())
+		if !ok || idx >= len(names) {
+			return
+		}
+		v.SetString(secrets[names[idx]])
+		resolved[idx] = true
+	}
+}
+
+func isSecretType(t reflect.Type) bool {
+	for _, secretType := range secretTypes {
+		if t == secretType {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSecretRefPlaceholder(s string) (int, bool) {
+	if !strings.HasPrefix(s, secretRefPlaceholderPrefix) || !strings.HasSuffix(s, secretRefPlaceholderSuffix) {
+		return 0, false
+	}
+
+	idx, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(s, secretRefPlaceholderPrefix), secretRefPlaceholderSuffix))
+	if err != nil || idx < 0 {
+		return 0, false
+	}
+	return idx, true
+}
@@ -0,0 +1,254 @@
+package alertmanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/alertmanager/config"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigWithSecrets(t *testing.T) {
+	dir := t.TempDir()
+	writeTestSecret(t, dir, "user-1", "client-secret", "the-client-secret\n")
+	writeTestSecret(t, dir, "user-1", "token", "the-token")
+	writeTestSecret(t, dir, "user-1", "routing-key", "the-routing-key")
+	writeTestSecret(t, dir, "user-2", "other", "the-other-secret")
+
+	provider := fileSecretProvider{dir: dir}
+
+	tests := map[string]struct {
+		cfg             string
+		provider        SecretProvider
+		expectedSecrets map[string]string
+		expectedErr     string
+		check           func(t *testing.T, cfg *config.Config)
+	}{
+		"should load the config without secret references": {
+			cfg: `
+route:
+  receiver: default
+receivers:
+  - name: default
+    webhook_configs:
+      - url: http://localhost
+        http_config:
+          authorization:
+            credentials: plain
+`,
+			check: func(t *testing.T, cfg *config.Config) {
+				assert.Equal(t, commoncfg.Secret("plain"), cfg.Receivers[0].WebhookConfigs[0].HTTPConfig.Authorization.Credentials)
+			},
+		},
+		"should resolve the secret references in the HTTP and receiver configs": {
+			provider: provider,
+			cfg: `
+route:
+  receiver: default
+receivers:
+  - name: default
+    webhook_configs:
+      - url: http://localhost
+        http_config:
+          oauth2:
+            client_id: test
+            client_secret:
+              secret_ref: client-secret
+            token_url: http://example.com
+      - url: http://localhost
+        http_config:
+          authorization:
+            credentials:
+              secret_ref: token
+    pagerduty_configs:
+      - routing_key:
+          secret_ref: routing-key
+        http_config:
+          authorization:
+            credentials:
+              secret_ref: token
+`,
+			expectedSecrets: map[string]string{
+				"client-secret": "the-client-secret",
+				"token":         "the-token",
+				"routing-key":   "the-routing-key",
+			},
+			check: func(t *testing.T, cfg *config.Config) {
+				receiver := cfg.Receivers[0]
+				assert.Equal(t, commoncfg.Secret("the-client-secret"), receiver.WebhookConfigs[0].HTTPConfig.OAuth2.ClientSecret)
+				assert.Equal(t, commoncfg.Secret("the-token"), receiver.WebhookConfigs[1].HTTPConfig.Authorization.Credentials)
+				assert.Equal(t, config.Secret("the-routing-key"), receiver.PagerdutyConfigs[0].RoutingKey)
+				assert.Equal(t, commoncfg.Secret("the-token"), receiver.PagerdutyConfigs[0].HTTPConfig.Authorization.Credentials)
+			},
+		},
+		"should resolve the secret references in the global config": {
+			provider: provider,
+			cfg: `
+global:
+  http_config:
+    authorization:
+      credentials:
+        secret_ref: token
+route:
+  receiver: default
+receivers:
+  - name: default
+    webhook_configs:
+      - url: http://localhost
+`,
+			expectedSecrets: map[string]string{"token": "the-token"},
+			check: func(t *testing.T, cfg *config.Config) {
+				assert.Equal(t, commoncfg.Secret("the-token"), cfg.Receivers[0].WebhookConfigs[0].HTTPConfig.Authorization.Credentials)
+			},
+		},
+		"should fail if no secret provider is configured": {
+			cfg: `
+route:
+  receiver: default
+receivers:
+  - name: default
+    webhook_configs:
+      - url: http://localhost
+        http_config:
+          authorization:
+            credentials:
+              secret_ref: token
+`,
+			expectedErr: errSecretProviderNotConfigured.Error(),
+		},
+		"should fail if the secret doesn't exist": {
+			provider: provider,
+			cfg: `
+route:
+  receiver: default
+receivers:
+  - name: default
+    webhook_configs:
+      - url: http://localhost
+        http_config:
+          authorization:
+            credentials:
+              secret_ref: unknown
+`,
+			expectedErr: `unknown secret "unknown" referenced by secret_ref`,
+		},
+		"should fail if the secret belongs to another tenant": {
+			provider: provider,
+			cfg: `
+route:
+  receiver: default
+receivers:
+  - name: default
+    webhook_configs:
+      - url: http://localhost
+        http_config:
+          authorization:
+            credentials:
+              secret_ref: other
+`,
+			expectedErr: `unknown secret "other" referenced by secret_ref`,
+		},
+		"should fail if the secret name is invalid": {
+			provider: provider,
+			cfg: `
+route:
+  receiver: default
+receivers:
+  - name: default
+    webhook_configs:
+      - url: http://localhost
+        http_config:
+          authorization:
+            credentials:
+              secret_ref: ../user-2/other
+`,
+			expectedErr: `invalid secret name ../user-2/other referenced by secret_ref: the name should match ^[a-zA-Z0-9][a-zA-Z0-9.-]*$`,
+		},
+		"should fail if the secret is referenced by a field which is not a secret": {
+			provider: provider,
+			cfg: `
+route:
+  receiver: default
+receivers:
+  - name: default
+    webhook_configs:
+      - url: http://localhost
+        http_config:
+          oauth2:
+            client_id:
+              secret_ref: token
+            client_secret: secret
+            token_url: http://example.com
+`,
+			expectedErr: errSecretRefNotAllowed.Error(),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg, secrets, err := loadConfigWithSecrets(testData.cfg, "user-1", testData.provider)
+			if testData.expectedErr != "" {
+				require.EqualError(t, err, testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedSecrets, secrets)
+			testData.check(t, cfg)
+
+			// The secrets are never displayed.
+			assert.NotContains(t, cfg.String(), "the-")
+		})
+	}
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+	writeTestSecret(t, dir, "user-1", "secret", "value\r\n")
+
+	provider := fileSecretProvider{dir: dir}
+
+	value, err := provider.GetSecret("user-1", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+
+	_, err = provider.GetSecret("user-1", "unknown")
+	assert.Equal(t, errSecretNotFound, err)
+
+	// The tenant ID can't point outside of the tenant's directory.
+	_, err = provider.GetSecret("..", "user-1")
+	assert.Equal(t, errSecretNotFound, err)
+}
+
+func TestEnvSecretProvider(t *testing.T) {
+	require.NoError(t, os.Setenv("TEST_SECRET_user-1_secret", "value"))
+	defer os.Unsetenv("TEST_SECRET_user-1_secret") //nolint:errcheck
+
+	provider := envSecretProvider{prefix: "TEST_SECRET_"}
+
+	value, err := provider.GetSecret("user-1", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+
+	_, err = provider.GetSecret("user-2", "secret")
+	assert.Equal(t, errSecretNotFound, err)
+}
+
+func TestSecretProviderConfig_Validate(t *testing.T) {
+	assert.NoError(t, (&SecretProviderConfig{}).Validate())
+	assert.NoError(t, (&SecretProviderConfig{Backend: SecretProviderEnv}).Validate())
+	assert.NoError(t, (&SecretProviderConfig{Backend: SecretProviderFile, Directory: "/secrets"}).Validate())
+	assert.Equal(t, errMissingSecretsDirectory, (&SecretProviderConfig{Backend: SecretProviderFile}).Validate())
+	assert.Equal(t, errUnsupportedSecretProvider, (&SecretProviderConfig{Backend: "unknown"}).Validate())
+}
+
+func writeTestSecret(t *testing.T, dir, userID, name, value string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, userID), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, userID, name), []byte(value), 0600))
+}
@@ -0,0 +1,268 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/swag"
+	v2_models "github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/types"
+)
+
+const (
+	silencesLimitParam     = "limit"
+	silencesPageTokenParam = "page_token"
+	silencesMatcherParam   = "matcher"
+	silencesStateParam     = "state"
+)
+
+var silencesPageParams = []string{silencesLimitParam, silencesPageTokenParam, silencesMatcherParam, silencesStateParam}
+
+// silencesPage is the response of the silences listing with pagination or filtering.
+type silencesPage struct {
+	Silences      v2_models.GettableSilences `json:"silences"`
+	NextPageToken string                     `json:"nextPageToken,omitempty"`
+}
+
+// silencesPageRequest holds the pagination and filtering parameters of a silences listing.
+type silencesPageRequest struct {
+	limit    int
+	after    *silencesPageKey
+	matchers []*labels.Matcher
+	states   map[string]struct{}
+}
+
+// silencesPageKey is the position of a silence in the listing, sorted by end time and then ID.
+type silencesPageKey struct {
+	endsAt time.Time
+	id     string
+}
+
+func (k silencesPageKey) less(other silencesPageKey) bool {
+	if !k.endsAt.Equal(other.endsAt) {
+		return k.endsAt.Before(other.endsAt)
+	}
+	return k.id < other.id
+}
+
+func (k silencesPageKey) token() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d/%s", k.endsAt.UnixNano(), k.id)))
+}
+
+func parseSilencesPageToken(token string) (*silencesPageKey, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token")
+	}
+
+	parts := strings.SplitN(string(decoded), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid page token")
+	}
+	endsAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token")
+	}
+	return &silencesPageKey{endsAt: time.Unix(0, endsAt), id: parts[1]}, nil
+}
+
+func silenceKey(s *v2_models.GettableSilence) silencesPageKey {
+	return silencesPageKey{endsAt: time.Time(*s.EndsAt), id: *s.ID}
+}
+
+// isSilencesPageRequest returns whether the silences listing request asks for pagination or filtering.
+func isSilencesPageRequest(query url.Values) bool {
+	for _, p := range silencesPageParams {
+		if _, ok := query[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func parseSilencesPageRequest(query url.Values) (silencesPageRequest, error) {
+	req := silencesPageRequest{}
+
+	if v := query.Get(silencesLimitParam); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return req, fmt.Errorf("invalid %s parameter: must be a positive integer", silencesLimitParam)
+		}
+		req.limit = limit
+	}
+
+	if v := query.Get(silencesPageTokenParam); v != "" {
+		after, err := parseSilencesPageToken(v)
+		if err != nil {
+			return req, err
+		}
+		req.after = after
+	}
+
+	for _, v := range query[silencesMatcherParam] {
+		m, err := parseSilencesMatcher(v)
+		if err != nil {
+			return req, fmt.Errorf("invalid %s parameter %q: %s", silencesMatcherParam, v, err)
+		}
+		req.matchers = append(req.matchers, m)
+	}
+
+	for _, v := range query[silencesStateParam] {
+		switch types.SilenceState(v) {
+		case types.SilenceStateActive, types.SilenceStatePending, types.SilenceStateExpired:
+		default:
+			return req, fmt.Errorf("invalid %s parameter %q: must be one of active, pending or expired", silencesStateParam, v)
+		}
+		if req.states == nil {
+			req.states = map[string]struct{}{}
+		}
+		req.states[v] = struct{}{}
+	}
+
+	return req, nil
+}
+
+// parseSilencesMatcher parses the matcher, returning an error for the matchers with an empty
+// value which make the Alertmanager matchers parser panic.
+func parseSilencesMatcher(s string) (m *labels.Matcher, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			m, err = nil, fmt.Errorf("bad matcher format: %s", s)
+		}
+	}()
+	return labels.ParseMatcher(s)
+}
+
+// matches returns whether the silence has the state and the matchers of the request. Like the
+// filter of the Alertmanager API, a silence matches a matcher if it has the same matcher.
+func (r silencesPageRequest) matches(s *v2_models.GettableSilence) bool {
+	if r.states != nil {
+		if _, ok := r.states[*s.Status.State]; !ok {
+			return false
+		}
+	}
+
+	for _, m := range r.matchers {
+		found := false
+		for _, sm := range s.Matchers {
+			isEqual := sm.IsEqual == nil || *sm.IsEqual
+			isRegex := sm.IsRegex != nil && *sm.IsRegex
+			if *sm.Name == m.Name && *sm.Value == m.Value &&
+				isEqual == (m.Type == labels.MatchEqual || m.Type == labels.MatchRegexp) &&
+				isRegex == (m.Type == labels.MatchRegexp || m.Type == labels.MatchNotRegexp) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// page returns the silences of the page, sorted by end time and then ID, and the token of the next page.
+func (r silencesPageRequest) page(silences v2_models.GettableSilences) silencesPage {
+	result := make(v2_models.GettableSilences, 0, len(silences))
+	for _, s := range silences {
+		if r.after != nil && !r.after.less(silenceKey(s)) {
+			continue
+		}
+		if r.matches(s) {
+			result = append(result, s)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return silenceKey(result[i]).less(silenceKey(result[j]))
+	})
+
+	page := silencesPage{Silences: result}
+	if r.limit > 0 && len(result) > r.limit {
+		page.Silences = result[:r.limit]
+		page.NextPageToken = silenceKey(result[r.limit-1]).token()
+	}
+	return page
+}
+
+// silencesPaginationHandler serves the silences listing with pagination and filtering, on top of
+// the listing of all the silences of the tenant served by next. The silences are paginated once
+// they've been merged across the replicas, so that the pages are consistent whichever replicas
+// serve the requests.
+type silencesPaginationHandler struct {
+	next http.Handler
+}
+
+func (h silencesPaginationHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	pageReq, err := parseSilencesPageRequest(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The pagination and filtering parameters are not forwarded.
+	for _, p := range silencesPageParams {
+		query.Del(p)
+	}
+	listReq := req.Clone(req.Context())
+	listReq.URL.RawQuery = query.Encode()
+	listReq.RequestURI = listReq.URL.RequestURI()
+
+	rec := &bufferedResponseWriter{header: http.Header{}, code: http.StatusOK}
+	h.next.ServeHTTP(rec, listReq)
+
+	if rec.code != http.StatusOK {
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.code)
+		_, _ = w.Write(rec.body.Bytes())
+		return
+	}
+
+	silences := v2_models.GettableSilences{}
+	if err := swag.ReadJSON(rec.body.Bytes(), &silences); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode silences: %s", err), http.StatusInternalServerError)
+		return
+	}
+	for _, s := range silences {
+		if s.ID == nil || s.EndsAt == nil || s.Status == nil || s.Status.State == nil {
+			http.Error(w, "failed to decode silences: unexpected incomplete silence", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pageReq.page(silences)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// bufferedResponseWriter buffers the response of a handler.
+type bufferedResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
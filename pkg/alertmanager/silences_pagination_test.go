@@ -0,0 +1,165 @@
+package alertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/alertmanager/silence/silencepb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/alertmanager/alertspb"
+)
+
+func TestMultitenantAlertmanager_SilencesPagination(t *testing.T) {
+	const (
+		userID      = "user-1"
+		numSilences = 300
+	)
+	ctx := context.Background()
+
+	store := prepareInMemoryAlertStore()
+	require.NoError(t, store.SetAlertConfig(ctx, alertspb.AlertConfigDesc{User: userID, RawConfig: simpleConfigOne}))
+
+	cfg := mockAlertmanagerConfig(t)
+	am, err := createMultitenantAlertmanager(cfg, nil, nil, store, nil, nil, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, am))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, am))
+	})
+
+	// Create the silences, some of them ending at the same time, and expire some of them.
+	userAM := am.alertmanagers[userID]
+	endsAt := time.Now().Add(time.Hour)
+	expired := map[string]bool{}
+	for i := 0; i < numSilences; i++ {
+		team := "a"
+		if i%3 == 0 {
+			team = "b"
+		}
+		id, err := userAM.silences.Set(&silencepb.Silence{
+			Matchers: []*silencepb.Matcher{
+				{Name: "team", Pattern: team, Type: silencepb.Matcher_EQUAL},
+				{Name: "instance", Pattern: fmt.Sprintf("instance-%d", i), Type: silencepb.Matcher_EQUAL},
+			},
+			StartsAt:  time.Now(),
+			EndsAt:    endsAt.Add(time.Duration(i/4) * time.Minute),
+			CreatedBy: "test",
+			Comment:   "test",
+		})
+		require.NoError(t, err)
+
+		if i%10 == 0 {
+			require.NoError(t, userAM.silences.Expire(id))
+			expired[id] = true
+		}
+	}
+
+	listSilences := func(t *testing.T, query url.Values) (*httptest.ResponseRecorder, silencesPage) {
+		req := httptest.NewRequest(http.MethodGet, cfg.ExternalURL.String()+"/api/v2/silences?"+query.Encode(), nil)
+		w := httptest.NewRecorder()
+		am.ServeHTTP(w, req.WithContext(user.InjectOrgID(req.Context(), userID)))
+
+		page := silencesPage{}
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		}
+		return w, page
+	}
+
+	pageThrough := func(t *testing.T, query url.Values) []string {
+		var ids []string
+		var last *silencesPageKey
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, numSilences, "too many pages")
+
+			w, page := listSilences(t, query)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			require.LessOrEqual(t, len(page.Silences), 17)
+
+			for _, s := range page.Silences {
+				// The silences are sorted by end time and then ID, across the pages.
+				key := silenceKey(s)
+				if last != nil {
+					require.True(t, last.less(key), "silences out of order")
+				}
+				last = &key
+				ids = append(ids, *s.ID)
+			}
+
+			if page.NextPageToken == "" {
+				return ids
+			}
+			query.Set("page_token", page.NextPageToken)
+		}
+	}
+
+	t.Run("should page through all the silences with no duplicates or gaps", func(t *testing.T) {
+		ids := pageThrough(t, url.Values{"limit": []string{"17"}})
+		require.Len(t, ids, numSilences)
+
+		unique := map[string]struct{}{}
+		for _, id := range ids {
+			unique[id] = struct{}{}
+		}
+		assert.Len(t, unique, numSilences)
+	})
+
+	t.Run("should page through the filtered silences", func(t *testing.T) {
+		ids := pageThrough(t, url.Values{"limit": []string{"17"}, "matcher": []string{`team="b"`}, "state": []string{"active"}})
+		require.Len(t, ids, numSilences/3-numSilences/30)
+
+		for _, id := range ids {
+			assert.False(t, expired[id])
+
+			sils, _, err := userAM.silences.Query()
+			require.NoError(t, err)
+			for _, s := range sils {
+				if s.Id == id {
+					assert.Equal(t, "b", s.Matchers[0].Pattern)
+				}
+			}
+		}
+	})
+
+	t.Run("should return the matching silences in a single page without limit", func(t *testing.T) {
+		w, page := listSilences(t, url.Values{"state": []string{"expired"}})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, page.Silences, len(expired))
+		assert.Empty(t, page.NextPageToken)
+	})
+
+	t.Run("should keep the upstream response without pagination parameters", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, cfg.ExternalURL.String()+"/api/v2/silences", nil)
+		w := httptest.NewRecorder()
+		am.ServeHTTP(w, req.WithContext(user.InjectOrgID(req.Context(), userID)))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var silences []interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &silences))
+		assert.Len(t, silences, numSilences)
+	})
+
+	t.Run("should reject invalid parameters", func(t *testing.T) {
+		for _, query := range []url.Values{
+			{"limit": []string{"0"}},
+			{"limit": []string{"abc"}},
+			{"page_token": []string{"invalid"}},
+			{"matcher": []string{"team=~"}},
+			{"state": []string{"unknown"}},
+		} {
+			w, _ := listSilences(t, query)
+			assert.Equal(t, http.StatusBadRequest, w.Code, query.Encode())
+		}
+	})
+}
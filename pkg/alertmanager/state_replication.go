@@ -29,8 +29,14 @@ const (
 	syncFromStorage  = "from-storage"
 	syncUserNotFound = "user-not-found"
 	syncFailed       = "failed"
+
+	// Initial sync fallback reason label values.
+	fallbackTimeout = "timeout"
+	fallbackError   = "error"
 )
 
+var errStateNotSynced = errors.New("the state has not been synced yet")
+
 // state represents the Alertmanager silences and notification log internal state.
 type state struct {
 	services.Service
@@ -58,6 +64,7 @@ type state struct {
 	initialSyncTotal         prometheus.Counter
 	initialSyncCompleted     *prometheus.CounterVec
 	initialSyncDuration      prometheus.Histogram
+	initialSyncFallbacks     *prometheus.CounterVec
 
 	msgc chan *clusterpb.Part
 }
@@ -113,11 +120,17 @@ func newReplicatedStates(userID string, rf int, re Replicator, st alertstore.Ale
 			Help:    "Time spent syncing initial state from peers or remote storage.",
 			Buckets: prometheus.ExponentialBuckets(0.008, 4, 7),
 		}),
+		initialSyncFallbacks: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "alertmanager_state_initial_sync_fallbacks_total",
+			Help: "Number of times the initial state sync has fallen back to reading the state from storage, by reason.",
+		}, []string{"reason"}),
 	}
 	s.initialSyncCompleted.WithLabelValues(syncFromReplica)
 	s.initialSyncCompleted.WithLabelValues(syncFromStorage)
 	s.initialSyncCompleted.WithLabelValues(syncUserNotFound)
 	s.initialSyncCompleted.WithLabelValues(syncFailed)
+	s.initialSyncFallbacks.WithLabelValues(fallbackTimeout)
+	s.initialSyncFallbacks.WithLabelValues(fallbackError)
 
 	s.Service = services.NewBasicService(s.starting, s.running, nil)
 
@@ -217,6 +230,12 @@ func (s *state) starting(ctx context.Context) error {
 	}
 	s.fetchReplicaStateFailed.Inc()
 
+	if readCtx.Err() != nil {
+		s.initialSyncFallbacks.WithLabelValues(fallbackTimeout).Inc()
+	} else {
+		s.initialSyncFallbacks.WithLabelValues(fallbackError).Inc()
+	}
+
 	level.Info(s.logger).Log("msg", "state not settled; trying to read from storage", "err", err)
 
 	// Attempt to read the state from persistent storage instead.
@@ -209,6 +209,7 @@ func TestStateReplication_Settle(t *testing.T) {
 		read              readStateResult
 		storeStates       map[string]alertspb.FullStateDesc
 		results           map[string][][]byte
+		fallbackReason    string
 	}{
 		{
 			name:              "with a replication factor of <= 1, no state can be read from peers.",
@@ -276,6 +277,7 @@ func TestStateReplication_Settle(t *testing.T) {
 			name:              "when reading from replicas fails, state is read from storage.",
 			replicationFactor: 3,
 			read:              readStateResult{err: errors.New("Read Error 1")},
+			fallbackReason:    fallbackError,
 			storeStates: map[string]alertspb.FullStateDesc{
 				"user-1": {
 					State: &clusterpb.FullState{
@@ -292,6 +294,7 @@ func TestStateReplication_Settle(t *testing.T) {
 			name:              "when reading from replicas and from storage fails, still become ready.",
 			replicationFactor: 3,
 			read:              readStateResult{err: errors.New("Read Error 1")},
+			fallbackReason:    fallbackError,
 			storeStates:       map[string]alertspb.FullStateDesc{},
 			results: map[string][][]byte{
 				"key1": nil,
@@ -302,6 +305,7 @@ func TestStateReplication_Settle(t *testing.T) {
 			name:              "when reading the full state takes too long, hit timeout but become ready.",
 			replicationFactor: 3,
 			read:              readStateResult{blocking: true},
+			fallbackReason:    fallbackTimeout,
 			results: map[string][][]byte{
 				"key1": nil,
 				"key2": nil,
@@ -339,6 +343,14 @@ func TestStateReplication_Settle(t *testing.T) {
 			// Note: We don't actually test beyond Merge() here, just that all data is forwarded.
 			assert.Equal(t, tt.results["key1"], key1State.merges)
 			assert.Equal(t, tt.results["key2"], key2State.merges)
+
+			for _, reason := range []string{fallbackTimeout, fallbackError} {
+				expected := 0.0
+				if reason == tt.fallbackReason {
+					expected = 1
+				}
+				assert.Equal(t, expected, testutil.ToFloat64(s.initialSyncFallbacks.WithLabelValues(reason)), reason)
+			}
 		})
 	}
 }
@@ -26,6 +26,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/querier"
 	"github.com/cortexproject/cortex/pkg/querier/stats"
 	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/apierror"
 )
 
 const (
@@ -161,6 +162,7 @@ func NewQuerierHandler(
 	engine *promql.Engine,
 	distributor Distributor,
 	tombstonesLoader *purger.TombstonesLoader,
+	cardinalityLimits querier.CardinalityLimits,
 	reg prometheus.Registerer,
 	logger log.Logger,
 ) http.Handler {
@@ -229,7 +231,7 @@ func NewQuerierHandler(
 		InflightRequests: inflightRequests,
 	}
 	cacheGenHeaderMiddleware := getHTTPCacheGenNumberHeaderSetterMiddleware(tombstonesLoader)
-	middlewares := middleware.Merge(inst, cacheGenHeaderMiddleware)
+	middlewares := middleware.Merge(inst, cacheGenHeaderMiddleware, getHTTPDownsamplingFunctionMiddleware(), getHTTPConsistencyTokenMiddleware(), apierror.NewMiddleware())
 	router.Use(middlewares.Wrap)
 
 	// Define the prefixes for all routes
@@ -252,8 +254,10 @@ func NewQuerierHandler(
 	router.Path(path.Join(prefix, "/api/v1/query_exemplars")).Methods("GET", "POST").Handler(promRouter)
 	router.Path(path.Join(prefix, "/api/v1/labels")).Methods("GET", "POST").Handler(promRouter)
 	router.Path(path.Join(prefix, "/api/v1/label/{name}/values")).Methods("GET").Handler(promRouter)
-	router.Path(path.Join(prefix, "/api/v1/series")).Methods("GET", "POST", "DELETE").Handler(promRouter)
+	router.Path(path.Join(prefix, "/api/v1/series")).Methods("GET", "POST", "DELETE").Handler(querier.SeriesHandler(queryable, distributor, promRouter))
 	router.Path(path.Join(prefix, "/api/v1/metadata")).Methods("GET").Handler(promRouter)
+	router.Path(path.Join(prefix, "/api/v1/cardinality/label_names")).Methods("GET", "POST").Handler(querier.LabelNamesCardinalityHandler(queryable, cardinalityLimits))
+	router.Path(path.Join(prefix, "/api/v1/cardinality/label_values")).Methods("GET", "POST").Handler(querier.LabelValuesCardinalityHandler(queryable, cardinalityLimits))
 
 	// TODO(gotjosh): This custom handler is temporary until we're able to vendor the changes in:
 	// https://github.com/prometheus/prometheus/pull/7125/files
@@ -265,8 +269,10 @@ func NewQuerierHandler(
 	router.Path(path.Join(legacyPrefix, "/api/v1/query_exemplars")).Methods("GET", "POST").Handler(legacyPromRouter)
 	router.Path(path.Join(legacyPrefix, "/api/v1/labels")).Methods("GET", "POST").Handler(legacyPromRouter)
 	router.Path(path.Join(legacyPrefix, "/api/v1/label/{name}/values")).Methods("GET").Handler(legacyPromRouter)
-	router.Path(path.Join(legacyPrefix, "/api/v1/series")).Methods("GET", "POST", "DELETE").Handler(legacyPromRouter)
+	router.Path(path.Join(legacyPrefix, "/api/v1/series")).Methods("GET", "POST", "DELETE").Handler(querier.SeriesHandler(queryable, distributor, legacyPromRouter))
 	router.Path(path.Join(legacyPrefix, "/api/v1/metadata")).Methods("GET").Handler(legacyPromRouter)
+	router.Path(path.Join(legacyPrefix, "/api/v1/cardinality/label_names")).Methods("GET", "POST").Handler(querier.LabelNamesCardinalityHandler(queryable, cardinalityLimits))
+	router.Path(path.Join(legacyPrefix, "/api/v1/cardinality/label_values")).Methods("GET", "POST").Handler(querier.LabelValuesCardinalityHandler(queryable, cardinalityLimits))
 
 	// Track execution time.
 	return stats.NewWallTimeMiddleware().Wrap(router)
@@ -2,10 +2,12 @@ package api
 
 import (
 	"net/http"
+	"sync"
 
 	"github.com/weaveworks/common/middleware"
 
 	"github.com/cortexproject/cortex/pkg/chunk/purger"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
 	"github.com/cortexproject/cortex/pkg/querier/queryrange"
 	"github.com/cortexproject/cortex/pkg/tenant"
 )
@@ -27,3 +29,39 @@ func getHTTPCacheGenNumberHeaderSetterMiddleware(cacheGenNumbersLoader *purger.T
 		})
 	})
 }
+
+// middleware injecting in the request context the downsampling function signaled by the query-frontend, to let
+// the querier fetch downsampled series from the ingesters. Unknown functions are ignored.
+func getHTTPDownsamplingFunctionMiddleware() middleware.Interface {
+	return middleware.Func(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fn, err := client.ParseDownsamplingFunction(r.Header.Get(queryrange.DownsamplingFunctionHeaderName)); err == nil {
+				r = r.WithContext(client.ContextWithDownsamplingFunction(r.Context(), fn))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+}
+
+// middleware injecting in the request context the consistency token of a push sent with the query, to let the querier
+// wait for all the ingesters which may have received the push. Invalid tokens are ignored. The responses of the queries
+// which didn't get the responses of all those ingesters are marked with the degraded consistency header, so that they
+// don't get cached.
+func getHTTPConsistencyTokenMiddleware() middleware.Interface {
+	return middleware.Func(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, err := client.ParseConsistencyToken(r.Header.Get(client.ConsistencyTokenHeaderName)); err == nil {
+				// The query is fully executed before the response is written, so that the header is set in time.
+				var once sync.Once
+				ctx := client.ContextWithConsistencyToken(r.Context(), token)
+				ctx = client.ContextWithDegradedConsistencyRecorder(ctx, func() {
+					once.Do(func() {
+						w.Header().Set(client.DegradedConsistencyHeaderName, "true")
+					})
+				})
+				r = r.WithContext(ctx)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+}
@@ -41,6 +41,11 @@ var (
 		Name:      "cache_corrupt_chunks_total",
 		Help:      "Total count of corrupt chunks found in cache.",
 	})
+	putCacheWriteBackChunks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "chunk_store_put_cache_writeback_chunks_total",
+		Help:      "Total count of chunks written to the chunks cache when stored, eg. when flushed by the ingesters.",
+	})
 )
 
 // Query errors are to be treated as user errors, rather than storage errors.
@@ -65,6 +70,10 @@ type StoreConfig struct {
 
 	// When DisableIndexDeduplication is true and chunk is already there in cache, only index would be written to the store and not chunk.
 	DisableIndexDeduplication bool `yaml:"-"`
+
+	// Injected at runtime from the ingester config. When true, the chunks being stored are not
+	// written to the chunks cache.
+	DisableChunkCacheWriteBack bool `yaml:"-"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet
@@ -113,6 +122,20 @@ func newBaseStore(cfg StoreConfig, schema BaseSchema, index IndexClient, chunks
 	}, nil
 }
 
+// writeBackCacheOnPut writes the chunks being stored to the chunks cache, so that the queries of the
+// recently stored chunks hit the cache, unless disabled.
+func (c *baseStore) writeBackCacheOnPut(ctx context.Context, logger log.Logger, chunks []Chunk) {
+	if c.cfg.DisableChunkCacheWriteBack {
+		return
+	}
+
+	if err := c.fetcher.writeBackCache(ctx, chunks); err != nil {
+		level.Warn(logger).Log("msg", "could not store chunks in chunk cache", "err", err)
+		return
+	}
+	putCacheWriteBackChunks.Add(float64(len(chunks)))
+}
+
 // Stop any background goroutines (ie in the cache.)
 func (c *baseStore) Stop() {
 	c.fetcher.storage.Stop()
@@ -159,9 +182,7 @@ func (c *store) PutOne(ctx context.Context, from, through model.Time, chunk Chun
 		return err
 	}
 
-	if cacheErr := c.fetcher.writeBackCache(ctx, chunks); cacheErr != nil {
-		level.Warn(log).Log("msg", "could not store chunks in chunk cache", "err", cacheErr)
-	}
+	c.writeBackCacheOnPut(ctx, log, chunks)
 
 	writeReqs, err := c.calculateIndexEntries(chunk.UserID, from, through, chunk)
 	if err != nil {
@@ -1148,3 +1148,38 @@ func TestDisableIndexDeduplication(t *testing.T) {
 	}
 
 }
+
+func TestChunkCacheWriteBackOnPut(t *testing.T) {
+	for _, schema := range []string{"v6", "v9"} {
+		for _, disableWriteBack := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/disabled=%t", schema, disableWriteBack), func(t *testing.T) {
+				ctx := context.Background()
+				metric := labels.Labels{
+					{Name: labels.MetricName, Value: "foo"},
+					{Name: "bar", Value: "baz"},
+				}
+				chunksCache := cache.NewFifoCache("chunk-cache", cache.FifoCacheConfig{
+					MaxSizeItems: 5,
+				}, prometheus.NewRegistry(), log.NewNopLogger())
+
+				storeCfg := stores[0].configFn()
+				storeCfg.ChunkCacheConfig.Cache = chunksCache
+				storeCfg.DisableChunkCacheWriteBack = disableWriteBack
+
+				store := newTestChunkStoreConfig(t, schema, storeCfg)
+				defer store.Stop()
+
+				fooChunk := dummyChunkFor(model.Time(0).Add(15*time.Second), metric)
+				require.NoError(t, fooChunk.Encode())
+				require.NoError(t, store.Put(ctx, []Chunk{fooChunk}))
+
+				found, _, _ := chunksCache.Fetch(ctx, []string{fooChunk.ExternalKey()})
+				if disableWriteBack {
+					assert.Empty(t, found)
+				} else {
+					assert.Equal(t, []string{fooChunk.ExternalKey()}, found)
+				}
+			})
+		}
+	}
+}
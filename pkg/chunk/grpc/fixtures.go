@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"io"
+	"net"
+
+	"google.golang.org/grpc"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/testutils"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+)
+
+type fixture struct {
+	name string
+}
+
+func (f fixture) Name() string {
+	return f.name
+}
+
+// Clients returns the gRPC store clients connected to a Server backed by the in-memory storage.
+func (f fixture) Clients() (
+	indexClient chunk.IndexClient, chunkClient chunk.Client, tableClient chunk.TableClient,
+	schemaConfig chunk.SchemaConfig, closer io.Closer, err error,
+) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return
+	}
+
+	storage := chunk.NewMockStorage()
+	server := grpc.NewServer()
+	RegisterGrpcStoreServer(server, NewServer(storage, storage, storage))
+	go func() {
+		_ = server.Serve(lis)
+	}()
+
+	var cfg Config
+	flagext.DefaultValues(&cfg)
+	cfg.Address = lis.Addr().String()
+
+	schemaConfig = testutils.DefaultSchemaConfig("grpc-store")
+	storageClient, err := NewStorageClient(cfg, schemaConfig)
+	if err != nil {
+		server.Stop()
+		return
+	}
+	tClient, err := NewTableClient(cfg)
+	if err != nil {
+		storageClient.Stop()
+		server.Stop()
+		return
+	}
+
+	indexClient, chunkClient, tableClient = storageClient, storageClient, tClient
+	closer = testutils.CloserFunc(func() error {
+		storageClient.Stop()
+		tClient.Stop()
+		server.Stop()
+		return nil
+	})
+	return
+}
+
+// Fixtures for testing the gRPC store clients.
+var Fixtures = []testutils.Fixture{
+	fixture{
+		name: "grpc-store",
+	},
+}
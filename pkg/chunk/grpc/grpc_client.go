@@ -1,34 +1,119 @@
 package grpc
 
 import (
+	"context"
 	"flag"
 	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/dskit/backoff"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/grpcclient"
 )
 
 // Config for a StorageClient
 type Config struct {
-	Address string `yaml:"server_address,omitempty"`
+	Address   string         `yaml:"server_address,omitempty"`
+	Timeout   time.Duration  `yaml:"timeout"`
+	AuthToken flagext.Secret `yaml:"auth_token"`
+
+	// The backoff config of the gRPC client is the retry policy of the failed calls.
+	GRPCClientConfig grpcclient.Config `yaml:"grpc_client_config"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cfg.Address, "grpc-store.server-address", "", "Hostname or IP of the gRPC store instance.")
+	f.DurationVar(&cfg.Timeout, "grpc-store.timeout", 0, "Timeout of each call to the gRPC store, including the time to receive the whole streamed response. The calls failed because unavailable or timed out are retried according to the -grpc-store.backoff-* settings. 0 to disable the timeout.")
+	f.Var(&cfg.AuthToken, "grpc-store.auth-token", "Bearer token sent to the gRPC store in the authorization metadata of each call. The token is sent in clear text unless TLS is enabled.")
+
+	cfg.GRPCClientConfig.RegisterFlagsWithPrefix("grpc-store", f)
+}
+
+// Validate the config.
+func (cfg *Config) Validate(log log.Logger) error {
+	return cfg.GRPCClientConfig.Validate(log)
 }
 
-func connectToGrpcServer(serverAddress string) (GrpcStoreClient, *grpc.ClientConn, error) {
-	params := keepalive.ClientParameters{
-		Time:                time.Second * 20,
-		Timeout:             time.Second * 10,
-		PermitWithoutStream: true,
+func connectToGrpcServer(cfg Config) (GrpcStoreClient, *grpc.ClientConn, error) {
+	opts, err := cfg.GRPCClientConfig.DialOption(nil, nil)
+	if err != nil {
+		return nil, nil, err
 	}
-	param := grpc.WithKeepaliveParams(params)
-	cc, err := grpc.Dial(serverAddress, param, grpc.WithInsecure())
+	if cfg.AuthToken.Value != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(cfg.AuthToken.Value)))
+	}
+
+	cc, err := grpc.Dial(cfg.Address, opts...)
 	if err != nil {
-		return nil, nil, errors.Wrapf(err, "failed to dial grpc-store %s", serverAddress)
+		return nil, nil, errors.Wrapf(err, "failed to dial grpc-store %s", cfg.Address)
 	}
 	return NewGrpcStoreClient(cc), cc, nil
 }
+
+// tokenCredentials sends the bearer token with each call.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// permanentError wraps an error which must not be retried.
+type permanentError struct {
+	error
+}
+
+// doWithRetries calls f with the configured timeout, retrying it with backoff if it fails
+// because the gRPC store is unavailable or the call timed out.
+func doWithRetries(ctx context.Context, cfg Config, f func(ctx context.Context) error) error {
+	retries := backoff.New(ctx, cfg.GRPCClientConfig.BackoffConfig)
+
+	var err error
+	for retries.Ongoing() {
+		err = doWithTimeout(ctx, cfg.Timeout, f)
+		if p, ok := err.(permanentError); ok {
+			return p.error
+		}
+		if !isRetryable(ctx, err) {
+			return err
+		}
+		retries.Wait()
+	}
+
+	if err == nil {
+		err = retries.Err()
+	}
+	return err
+}
+
+func doWithTimeout(ctx context.Context, timeout time.Duration, f func(ctx context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return f(ctx)
+}
+
+func isRetryable(ctx context.Context, err error) bool {
+	// The call is not retried once the caller's context is done.
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
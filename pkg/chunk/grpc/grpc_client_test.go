@@ -2,14 +2,27 @@ package grpc
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/grafana/dskit/backoff"
+	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
 	"github.com/cortexproject/cortex/pkg/chunk/encoding"
 	prom_chunk "github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
 )
 
 // This includes test for all RPCs in
@@ -18,7 +31,9 @@ func TestGrpcStore(t *testing.T) {
 	var err error
 	cleanup, storeAddress := createTestGrpcServer(t)
 	defer cleanup()
-	cfg := Config{Address: storeAddress}
+	var cfg Config
+	flagext.DefaultValues(&cfg)
+	cfg.Address = storeAddress
 	schemaCfg := chunk.SchemaConfig{Configs: []chunk.PeriodConfig{
 		{
 			From:       chunk.DayTime{Time: 1564358400000},
@@ -178,3 +193,144 @@ func writeBatchTestData() chunk.WriteBatch {
 	}
 	return t
 }
+
+func TestTableClient_ShouldRetryTransientErrors(t *testing.T) {
+	tests := map[string]struct {
+		err              error
+		timeout          time.Duration
+		expectedErr      codes.Code
+		expectedRequests int32
+	}{
+		"should retry when the store is unavailable": {
+			err:              status.Error(codes.Unavailable, "unavailable"),
+			expectedErr:      codes.OK,
+			expectedRequests: 2,
+		},
+		"should retry when the call times out": {
+			timeout:          50 * time.Millisecond,
+			expectedErr:      codes.OK,
+			expectedRequests: 2,
+		},
+		"should not retry other errors": {
+			err:              status.Error(codes.InvalidArgument, "invalid"),
+			expectedErr:      codes.InvalidArgument,
+			expectedRequests: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			storage := chunk.NewMockStorage()
+			srv := &flakyServer{Server: NewServer(storage, storage, storage), err: testData.err}
+			addr := startTestServer(t, srv)
+
+			cfg := testConfig(addr)
+			cfg.Timeout = testData.timeout
+			client, err := NewTableClient(cfg)
+			require.NoError(t, err)
+			defer client.Stop()
+
+			_, err = client.ListTables(context.Background())
+			assert.Equal(t, testData.expectedErr, status.Code(errors.Cause(err)))
+			assert.Equal(t, testData.expectedRequests, srv.requests.Load())
+		})
+	}
+}
+
+func TestStorageClient_QueryPagesShouldStreamLargeResults(t *testing.T) {
+	storage := chunk.NewMockStorage()
+	addr := startTestServer(t, NewServer(storage, storage, storage))
+
+	client, err := NewStorageClient(testConfig(addr), chunk.SchemaConfig{})
+	require.NoError(t, err)
+	defer client.Stop()
+
+	ctx := context.Background()
+	require.NoError(t, storage.CreateTable(ctx, chunk.TableDesc{Name: "table"}))
+
+	const numRows = 2*queryIndexPageSize + 10
+	batch := client.NewWriteBatch()
+	for i := 0; i < numRows; i++ {
+		batch.Add("table", "foo", []byte(fmt.Sprintf("%05d", i)), nil)
+	}
+	require.NoError(t, client.BatchWrite(ctx, batch))
+
+	pages, rows := 0, 0
+	err = client.QueryPages(ctx, []chunk.IndexQuery{{TableName: "table", HashValue: "foo"}}, func(_ chunk.IndexQuery, batch chunk.ReadBatch) bool {
+		pages++
+		for iter := batch.Iterator(); iter.Next(); {
+			rows++
+		}
+		return true
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, numRows, rows)
+}
+
+func TestTableClient_ShouldSendTheAuthToken(t *testing.T) {
+	storage := chunk.NewMockStorage()
+	addr := startTestServer(t, NewServer(storage, storage, storage), grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if auth := md.Get("authorization"); len(auth) != 1 || auth[0] != "Bearer secret" {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		return handler(ctx, req)
+	}))
+
+	for token, expected := range map[string]codes.Code{"secret": codes.OK, "wrong": codes.Unauthenticated, "": codes.Unauthenticated} {
+		cfg := testConfig(addr)
+		cfg.AuthToken.Value = token
+		client, err := NewTableClient(cfg)
+		require.NoError(t, err)
+
+		_, err = client.ListTables(context.Background())
+		assert.Equal(t, expected, status.Code(errors.Cause(err)), token)
+		client.Stop()
+	}
+}
+
+// flakyServer fails the first ListTables call with the given error, or by not responding
+// until the call times out if no error is given.
+type flakyServer struct {
+	*Server
+
+	err      error
+	requests atomic.Int32
+}
+
+func (s *flakyServer) ListTables(ctx context.Context, req *empty.Empty) (*ListTablesResponse, error) {
+	if s.requests.Inc() == 1 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if s.err != nil && status.Code(s.err) != codes.Unavailable {
+		return nil, s.err
+	}
+	return s.Server.ListTables(ctx, req)
+}
+
+func testConfig(addr string) Config {
+	var cfg Config
+	flagext.DefaultValues(&cfg)
+	cfg.Address = addr
+	cfg.GRPCClientConfig.BackoffConfig = backoff.Config{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxRetries: 3}
+	return cfg
+}
+
+func startTestServer(t *testing.T, srv GrpcStoreServer, opts ...grpc.ServerOption) string {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	s := grpc.NewServer(opts...)
+	RegisterGrpcStoreServer(s, srv)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	return lis.Addr().String()
+}
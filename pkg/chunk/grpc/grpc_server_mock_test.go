@@ -128,7 +128,7 @@ func (s server) UpdateTable(ctx context.Context, request *UpdateTableRequest) (*
 
 // NewStorageClient returns a new StorageClient.
 func NewTestStorageClient(cfg Config, schemaCfg chunk.SchemaConfig) (*StorageClient, error) {
-	grpcClient, _, err := connectToGrpcServer(cfg.Address)
+	grpcClient, _, err := connectToGrpcServer(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -143,7 +143,7 @@ func NewTestStorageClient(cfg Config, schemaCfg chunk.SchemaConfig) (*StorageCli
 
 // NewTableClient returns a new TableClient.
 func NewTestTableClient(cfg Config) (*TableClient, error) {
-	grpcClient, _, err := connectToGrpcServer(cfg.Address)
+	grpcClient, _, err := connectToGrpcServer(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -33,16 +33,26 @@ func (s *StorageClient) NewWriteBatch() chunk.WriteBatch {
 
 func (s *StorageClient) BatchWrite(c context.Context, batch chunk.WriteBatch) error {
 	writeBatch := batch.(*WriteBatch)
-	batchWrites := &WriteIndexRequest{Writes: writeBatch.Writes}
-	_, err := s.client.WriteIndex(context.Background(), batchWrites)
-	if err != nil {
-		return errors.WithStack(err)
+	if len(writeBatch.Writes) > 0 {
+		batchWrites := &WriteIndexRequest{Writes: writeBatch.Writes}
+		err := doWithRetries(c, s.cfg, func(ctx context.Context) error {
+			_, err := s.client.WriteIndex(ctx, batchWrites)
+			return err
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
 	}
 
-	batchDeletes := &DeleteIndexRequest{Deletes: writeBatch.Deletes}
-	_, err = s.client.DeleteIndex(context.Background(), batchDeletes)
-	if err != nil {
-		return errors.WithStack(err)
+	if len(writeBatch.Deletes) > 0 {
+		batchDeletes := &DeleteIndexRequest{Deletes: writeBatch.Deletes}
+		err := doWithRetries(c, s.cfg, func(ctx context.Context) error {
+			_, err := s.client.DeleteIndex(ctx, batchDeletes)
+			return err
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
 	}
 
 	return nil
@@ -61,24 +71,33 @@ func (s *StorageClient) query(ctx context.Context, query chunk.IndexQuery, callb
 		ValueEqual:       query.ValueEqual,
 		Immutable:        query.Immutable,
 	}
-	streamer, err := s.client.QueryIndex(ctx, indexQuery)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	for {
-		readBatch, err := streamer.Recv()
-		if err == io.EOF {
-			break
-		}
+	err := doWithRetries(ctx, s.cfg, func(ctx context.Context) error {
+		streamer, err := s.client.QueryIndex(ctx, indexQuery)
 		if err != nil {
-			return errors.WithStack(err)
+			return err
 		}
-		if !callback(query, readBatch) {
-			return nil
-		}
-	}
 
-	return nil
+		received := false
+		for {
+			readBatch, err := streamer.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				// Once a page has been passed to the callback the query can't be retried,
+				// otherwise the callback would receive the same rows again.
+				if received {
+					return permanentError{err}
+				}
+				return err
+			}
+			received = true
+			if !callback(query, readBatch) {
+				return nil
+			}
+		}
+	})
+	return errors.WithStack(err)
 }
 
 func (r *QueryIndexResponse) Iterator() chunk.ReadBatchIterator {
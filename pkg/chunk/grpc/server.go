@@ -0,0 +1,200 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+)
+
+const (
+	// Max number of index rows sent in each QueryIndex response.
+	queryIndexPageSize = 1000
+
+	// Max number of chunks sent in each GetChunks response.
+	getChunksBatchSize = 100
+)
+
+// Server is a gRPC store backed by the Cortex index, chunk and table clients. It's the
+// reference implementation of the gRPC store API, and it's used to test the gRPC store
+// clients against the in-memory storage.
+type Server struct {
+	index  chunk.IndexClient
+	chunks chunk.Client
+	tables chunk.TableClient
+}
+
+// NewServer returns a new Server.
+func NewServer(index chunk.IndexClient, chunks chunk.Client, tables chunk.TableClient) *Server {
+	return &Server{
+		index:  index,
+		chunks: chunks,
+		tables: tables,
+	}
+}
+
+// WriteIndex implements GrpcStoreServer.
+func (s *Server) WriteIndex(ctx context.Context, req *WriteIndexRequest) (*empty.Empty, error) {
+	batch := s.index.NewWriteBatch()
+	for _, entry := range req.Writes {
+		batch.Add(entry.TableName, entry.HashValue, entry.RangeValue, entry.Value)
+	}
+	return &empty.Empty{}, s.index.BatchWrite(ctx, batch)
+}
+
+// DeleteIndex implements GrpcStoreServer.
+func (s *Server) DeleteIndex(ctx context.Context, req *DeleteIndexRequest) (*empty.Empty, error) {
+	batch := s.index.NewWriteBatch()
+	for _, entry := range req.Deletes {
+		batch.Delete(entry.TableName, entry.HashValue, entry.RangeValue)
+	}
+	return &empty.Empty{}, s.index.BatchWrite(ctx, batch)
+}
+
+// QueryIndex implements GrpcStoreServer. The rows are streamed in pages, so that large
+// result sets are never held in a single message.
+func (s *Server) QueryIndex(req *QueryIndexRequest, stream GrpcStore_QueryIndexServer) error {
+	query := chunk.IndexQuery{
+		TableName:        req.TableName,
+		HashValue:        req.HashValue,
+		RangeValuePrefix: req.RangeValuePrefix,
+		RangeValueStart:  req.RangeValueStart,
+		ValueEqual:       req.ValueEqual,
+		Immutable:        req.Immutable,
+	}
+
+	var sendErr error
+	err := s.index.QueryPages(stream.Context(), []chunk.IndexQuery{query}, func(_ chunk.IndexQuery, batch chunk.ReadBatch) bool {
+		resp := &QueryIndexResponse{}
+		for iter := batch.Iterator(); iter.Next(); {
+			resp.Rows = append(resp.Rows, &Row{RangeValue: iter.RangeValue(), Value: iter.Value()})
+
+			if len(resp.Rows) == queryIndexPageSize {
+				if sendErr = stream.Send(resp); sendErr != nil {
+					return false
+				}
+				resp = &QueryIndexResponse{}
+			}
+		}
+
+		if len(resp.Rows) > 0 {
+			sendErr = stream.Send(resp)
+		}
+		return sendErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// PutChunks implements GrpcStoreServer.
+func (s *Server) PutChunks(ctx context.Context, req *PutChunksRequest) (*empty.Empty, error) {
+	chunks := make([]chunk.Chunk, 0, len(req.Chunks))
+	decodeContext := chunk.NewDecodeContext()
+	for _, c := range req.Chunks {
+		parsed, err := parseChunkKey(c.Key)
+		if err != nil {
+			return nil, err
+		}
+		if err := parsed.Decode(decodeContext, c.Encoded); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		chunks = append(chunks, parsed)
+	}
+	return &empty.Empty{}, s.chunks.PutChunks(ctx, chunks)
+}
+
+// GetChunks implements GrpcStoreServer. The chunks are streamed in batches.
+func (s *Server) GetChunks(req *GetChunksRequest, stream GrpcStore_GetChunksServer) error {
+	chunks := make([]chunk.Chunk, 0, len(req.Chunks))
+	for _, c := range req.Chunks {
+		parsed, err := parseChunkKey(c.Key)
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, parsed)
+	}
+
+	fetched, err := s.chunks.GetChunks(stream.Context(), chunks)
+	if err != nil {
+		return err
+	}
+
+	resp := &GetChunksResponse{}
+	for i := range fetched {
+		buf, err := fetched[i].Encoded()
+		if err != nil {
+			return err
+		}
+		resp.Chunks = append(resp.Chunks, &Chunk{Encoded: buf, Key: fetched[i].ExternalKey()})
+
+		if len(resp.Chunks) == getChunksBatchSize || i == len(fetched)-1 {
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			resp = &GetChunksResponse{}
+		}
+	}
+	return nil
+}
+
+// DeleteChunks implements GrpcStoreServer.
+func (s *Server) DeleteChunks(ctx context.Context, req *ChunkID) (*empty.Empty, error) {
+	parsed, err := parseChunkKey(req.ChunkID)
+	if err != nil {
+		return nil, err
+	}
+	return &empty.Empty{}, s.chunks.DeleteChunk(ctx, parsed.UserID, req.ChunkID)
+}
+
+// ListTables implements GrpcStoreServer.
+func (s *Server) ListTables(ctx context.Context, _ *empty.Empty) (*ListTablesResponse, error) {
+	tables, err := s.tables.ListTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ListTablesResponse{TableNames: tables}, nil
+}
+
+// CreateTable implements GrpcStoreServer.
+func (s *Server) CreateTable(ctx context.Context, req *CreateTableRequest) (*empty.Empty, error) {
+	return &empty.Empty{}, s.tables.CreateTable(ctx, toTableDesc(req.Desc))
+}
+
+// DeleteTable implements GrpcStoreServer.
+func (s *Server) DeleteTable(ctx context.Context, req *DeleteTableRequest) (*empty.Empty, error) {
+	return &empty.Empty{}, s.tables.DeleteTable(ctx, req.TableName)
+}
+
+// DescribeTable implements GrpcStoreServer.
+func (s *Server) DescribeTable(ctx context.Context, req *DescribeTableRequest) (*DescribeTableResponse, error) {
+	desc, isActive, err := s.tables.DescribeTable(ctx, req.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return &DescribeTableResponse{Desc: fromTableDesc(desc), IsActive: isActive}, nil
+}
+
+// UpdateTable implements GrpcStoreServer.
+func (s *Server) UpdateTable(ctx context.Context, req *UpdateTableRequest) (*empty.Empty, error) {
+	return &empty.Empty{}, s.tables.UpdateTable(ctx, toTableDesc(req.Current), toTableDesc(req.Expected))
+}
+
+// parseChunkKey parses the external key of a chunk, which is prefixed by the tenant ID.
+func parseChunkKey(key string) (chunk.Chunk, error) {
+	idx := strings.Index(key, "/")
+	if idx < 0 {
+		return chunk.Chunk{}, status.Errorf(codes.InvalidArgument, "unsupported chunk key %q", key)
+	}
+
+	parsed, err := chunk.ParseExternalKey(key[:idx], key)
+	if err != nil {
+		return chunk.Chunk{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return parsed, nil
+}
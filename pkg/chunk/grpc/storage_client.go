@@ -11,6 +11,7 @@ import (
 )
 
 type StorageClient struct {
+	cfg        Config
 	schemaCfg  chunk.SchemaConfig
 	client     GrpcStoreClient
 	connection *grpc.ClientConn
@@ -18,11 +19,12 @@ type StorageClient struct {
 
 // NewStorageClient returns a new StorageClient.
 func NewStorageClient(cfg Config, schemaCfg chunk.SchemaConfig) (*StorageClient, error) {
-	grpcClient, conn, err := connectToGrpcServer(cfg.Address)
+	grpcClient, conn, err := connectToGrpcServer(cfg)
 	if err != nil {
 		return nil, err
 	}
 	client := &StorageClient{
+		cfg:        cfg,
 		schemaCfg:  schemaCfg,
 		client:     grpcClient,
 		connection: conn,
@@ -57,21 +59,20 @@ func (s *StorageClient) PutChunks(ctx context.Context, chunks []chunk.Chunk) err
 		req.Chunks = append(req.Chunks, writeChunk)
 	}
 
-	_, err := s.client.PutChunks(ctx, req)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	return nil
+	err := doWithRetries(ctx, s.cfg, func(ctx context.Context) error {
+		_, err := s.client.PutChunks(ctx, req)
+		return err
+	})
+	return errors.WithStack(err)
 }
 
 func (s *StorageClient) DeleteChunk(ctx context.Context, userID, chunkID string) error {
 	chunkInfo := &ChunkID{ChunkID: chunkID}
-	_, err := s.client.DeleteChunks(ctx, chunkInfo)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	return nil
+	err := doWithRetries(ctx, s.cfg, func(ctx context.Context) error {
+		_, err := s.client.DeleteChunks(ctx, chunkInfo)
+		return err
+	})
+	return errors.WithStack(err)
 }
 
 func (s *StorageClient) GetChunks(ctx context.Context, input []chunk.Chunk) ([]chunk.Chunk, error) {
@@ -88,31 +89,45 @@ func (s *StorageClient) GetChunks(ctx context.Context, input []chunk.Chunk) ([]c
 		chunkInfo.Key = inputInfo.ExternalKey()
 		req.Chunks = append(req.Chunks, chunkInfo)
 	}
-	streamer, err := s.client.GetChunks(ctx, req)
-	if err != nil {
-		return nil, errors.WithStack(err)
+	// The received chunks are decoded into the requested ones, so that their checksum is verified.
+	requested := make(map[string]chunk.Chunk, len(input))
+	for _, c := range input {
+		requested[c.ExternalKey()] = c
 	}
+
 	var result []chunk.Chunk
 	decodeContext := chunk.NewDecodeContext()
-	for {
-		receivedChunks, err := streamer.Recv()
-		if err == io.EOF {
-			break
-		}
+	err = doWithRetries(ctx, s.cfg, func(ctx context.Context) error {
+		// The chunks received by a failed attempt are discarded.
+		result = nil
+
+		streamer, err := s.client.GetChunks(ctx, req)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return err
 		}
-		for _, chunkResponse := range receivedChunks.GetChunks() {
-			var c chunk.Chunk
-			if chunkResponse != nil {
-				err = c.Decode(decodeContext, chunkResponse.Encoded)
-				if err != nil {
-					return result, err
+		for {
+			receivedChunks, err := streamer.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			for _, chunkResponse := range receivedChunks.GetChunks() {
+				var c chunk.Chunk
+				if chunkResponse != nil {
+					c = requested[chunkResponse.Key]
+					if err := c.Decode(decodeContext, chunkResponse.Encoded); err != nil {
+						return permanentError{err}
+					}
 				}
+				result = append(result, c)
 			}
-			result = append(result, c)
 		}
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
 
-	return result, err
+	return result, nil
 }
@@ -11,17 +11,19 @@ import (
 )
 
 type TableClient struct {
+	cfg    Config
 	client GrpcStoreClient
 	conn   *grpc.ClientConn
 }
 
 // NewTableClient returns a new TableClient.
 func NewTableClient(cfg Config) (*TableClient, error) {
-	grpcClient, conn, err := connectToGrpcServer(cfg.Address)
+	grpcClient, conn, err := connectToGrpcServer(cfg)
 	if err != nil {
 		return nil, err
 	}
 	client := &TableClient{
+		cfg:    cfg,
 		client: grpcClient,
 		conn:   conn,
 	}
@@ -29,7 +31,11 @@ func NewTableClient(cfg Config) (*TableClient, error) {
 }
 
 func (c *TableClient) ListTables(ctx context.Context) ([]string, error) {
-	tables, err := c.client.ListTables(ctx, &empty.Empty{})
+	var tables *ListTablesResponse
+	err := doWithRetries(ctx, c.cfg, func(ctx context.Context) (err error) {
+		tables, err = c.client.ListTables(ctx, &empty.Empty{})
+		return err
+	})
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -38,70 +44,70 @@ func (c *TableClient) ListTables(ctx context.Context) ([]string, error) {
 
 func (c *TableClient) DeleteTable(ctx context.Context, name string) error {
 	tableName := &DeleteTableRequest{TableName: name}
-	_, err := c.client.DeleteTable(ctx, tableName)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	return nil
+	err := doWithRetries(ctx, c.cfg, func(ctx context.Context) error {
+		_, err := c.client.DeleteTable(ctx, tableName)
+		return err
+	})
+	return errors.WithStack(err)
 }
 
 func (c *TableClient) DescribeTable(ctx context.Context, name string) (desc chunk.TableDesc, isActive bool, err error) {
 	tableName := &DescribeTableRequest{TableName: name}
-	tableDesc, err := c.client.DescribeTable(ctx, tableName)
+	var tableDesc *DescribeTableResponse
+	err = doWithRetries(ctx, c.cfg, func(ctx context.Context) (err error) {
+		tableDesc, err = c.client.DescribeTable(ctx, tableName)
+		return err
+	})
 	if err != nil {
 		return desc, false, errors.WithStack(err)
 	}
-	desc.Name = tableDesc.Desc.Name
-	desc.ProvisionedRead = tableDesc.Desc.ProvisionedRead
-	desc.ProvisionedWrite = tableDesc.Desc.ProvisionedWrite
-	desc.UseOnDemandIOMode = tableDesc.Desc.UseOnDemandIOMode
-	desc.Tags = tableDesc.Desc.Tags
-	return desc, tableDesc.IsActive, nil
+	return toTableDesc(tableDesc.Desc), tableDesc.IsActive, nil
 }
 
 func (c *TableClient) UpdateTable(ctx context.Context, current, expected chunk.TableDesc) error {
-	currentTable := &TableDesc{}
-	expectedTable := &TableDesc{}
-
-	currentTable.Name = current.Name
-	currentTable.UseOnDemandIOMode = current.UseOnDemandIOMode
-	currentTable.ProvisionedWrite = current.ProvisionedWrite
-	currentTable.ProvisionedRead = current.ProvisionedRead
-	currentTable.Tags = current.Tags
-
-	expectedTable.Name = expected.Name
-	expectedTable.UseOnDemandIOMode = expected.UseOnDemandIOMode
-	expectedTable.ProvisionedWrite = expected.ProvisionedWrite
-	expectedTable.ProvisionedRead = expected.ProvisionedRead
-	expectedTable.Tags = expected.Tags
-
 	updateTableRequest := &UpdateTableRequest{
-		Current:  currentTable,
-		Expected: expectedTable,
+		Current:  fromTableDesc(current),
+		Expected: fromTableDesc(expected),
 	}
-	_, err := c.client.UpdateTable(ctx, updateTableRequest)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	return nil
+	err := doWithRetries(ctx, c.cfg, func(ctx context.Context) error {
+		_, err := c.client.UpdateTable(ctx, updateTableRequest)
+		return err
+	})
+	return errors.WithStack(err)
 }
 
 func (c *TableClient) CreateTable(ctx context.Context, desc chunk.TableDesc) error {
-	req := &CreateTableRequest{}
-	req.Desc = &TableDesc{}
-	req.Desc.Name = desc.Name
-	req.Desc.ProvisionedRead = desc.ProvisionedRead
-	req.Desc.ProvisionedWrite = desc.ProvisionedWrite
-	req.Desc.Tags = desc.Tags
-	req.Desc.UseOnDemandIOMode = desc.UseOnDemandIOMode
-
-	_, err := c.client.CreateTable(ctx, req)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	return nil
+	req := &CreateTableRequest{Desc: fromTableDesc(desc)}
+	err := doWithRetries(ctx, c.cfg, func(ctx context.Context) error {
+		_, err := c.client.CreateTable(ctx, req)
+		return err
+	})
+	return errors.WithStack(err)
 }
 
 func (c *TableClient) Stop() {
 	c.conn.Close()
 }
+
+func fromTableDesc(desc chunk.TableDesc) *TableDesc {
+	return &TableDesc{
+		Name:              desc.Name,
+		UseOnDemandIOMode: desc.UseOnDemandIOMode,
+		ProvisionedRead:   desc.ProvisionedRead,
+		ProvisionedWrite:  desc.ProvisionedWrite,
+		Tags:              desc.Tags,
+	}
+}
+
+func toTableDesc(desc *TableDesc) chunk.TableDesc {
+	if desc == nil {
+		return chunk.TableDesc{}
+	}
+	return chunk.TableDesc{
+		Name:              desc.Name,
+		UseOnDemandIOMode: desc.UseOnDemandIOMode,
+		ProvisionedRead:   desc.ProvisionedRead,
+		ProvisionedWrite:  desc.ProvisionedWrite,
+		Tags:              desc.Tags,
+	}
+}
@@ -468,9 +468,7 @@ func (c *seriesStore) PutOne(ctx context.Context, from, through model.Time, chun
 
 	// we already have the chunk in the cache so don't write it back to the cache.
 	if writeChunk {
-		if cacheErr := c.fetcher.writeBackCache(ctx, chunks); cacheErr != nil {
-			level.Warn(log).Log("msg", "could not store chunks in chunk cache", "err", cacheErr)
-		}
+		c.writeBackCacheOnPut(ctx, log, chunks)
 	}
 
 	bufs := make([][]byte, len(keysToCache))
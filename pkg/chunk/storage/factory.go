@@ -139,6 +139,9 @@ func (cfg *Config) Validate() error {
 	if err := cfg.AWSStorageConfig.Validate(); err != nil {
 		return errors.Wrap(err, "invalid AWS Storage config")
 	}
+	if err := cfg.GrpcConfig.Validate(util_log.Logger); err != nil {
+		return errors.Wrap(err, "invalid gRPC store config")
+	}
 	return nil
 }
 
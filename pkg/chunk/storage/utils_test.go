@@ -9,6 +9,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/chunk/aws"
 	"github.com/cortexproject/cortex/pkg/chunk/cassandra"
 	"github.com/cortexproject/cortex/pkg/chunk/gcp"
+	"github.com/cortexproject/cortex/pkg/chunk/grpc"
 	"github.com/cortexproject/cortex/pkg/chunk/local"
 	"github.com/cortexproject/cortex/pkg/chunk/testutils"
 )
@@ -26,6 +27,7 @@ func forAllFixtures(t *testing.T, storageClientTest storageClientTest) {
 	fixtures = append(fixtures, gcp.Fixtures...)
 	fixtures = append(fixtures, local.Fixtures...)
 	fixtures = append(fixtures, cassandra.Fixtures()...)
+	fixtures = append(fixtures, grpc.Fixtures...)
 	fixtures = append(fixtures, Fixtures...)
 
 	for _, fixture := range fixtures {
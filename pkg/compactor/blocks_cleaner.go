@@ -24,6 +24,45 @@ import (
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 )
 
+// Rules selecting the blocks deleted by the blocks cleaner, reported in the cleanup plan.
+const (
+	// The block has aged past the retention period, and will be marked for deletion.
+	cleanupRuleRetention = "retention"
+
+	// The block has been marked for deletion longer than the deletion delay ago, and will be deleted.
+	cleanupRuleDeletionMark = "deletion-mark"
+
+	// The block is partial and has been marked for deletion, and will be deleted.
+	cleanupRulePartialBlock = "partial-block"
+)
+
+// Actions of the blocks cleaner on the blocks of the cleanup plan.
+const (
+	cleanupActionMarkForDeletion = "mark-for-deletion"
+	cleanupActionDelete          = "delete"
+)
+
+// CleanupPlan is the outcome of the blocks cleanup of a tenant computed without modifying the bucket.
+type CleanupPlan struct {
+	Tenant          string              `json:"tenant"`
+	RetentionPeriod string              `json:"retention_period"`
+	DeletionDelay   string              `json:"deletion_delay"`
+	Blocks          []*CleanupPlanBlock `json:"blocks"`
+}
+
+// CleanupPlanBlock is a block which would be deleted or marked for deletion by the blocks cleanup.
+type CleanupPlanBlock struct {
+	ID ulid.ULID `json:"block_id"`
+
+	// MinTime and MaxTime are zero for the partial blocks, whose meta.json is missing.
+	MinTime   int64 `json:"min_time"`
+	MaxTime   int64 `json:"max_time"`
+	SizeBytes int64 `json:"size_bytes"`
+
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+}
+
 type BlocksCleanerConfig struct {
 	DeletionDelay                      time.Duration
 	CleanupInterval                    time.Duration
@@ -197,31 +236,7 @@ func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID
 	}
 	c.tenantBucketIndexLastUpdate.DeleteLabelValues(userID)
 
-	var deletedBlocks, failed int
-	err := userBucket.Iter(ctx, "", func(name string) error {
-		if err := ctx.Err(); err != nil {
-			return err
-		}
-
-		id, ok := block.IsBlockDir(name)
-		if !ok {
-			return nil
-		}
-
-		err := block.Delete(ctx, userLogger, userBucket, id)
-		if err != nil {
-			failed++
-			c.blocksFailedTotal.Inc()
-			level.Warn(userLogger).Log("msg", "failed to delete block", "block", id, "err", err)
-			return nil // Continue with other blocks.
-		}
-
-		deletedBlocks++
-		c.blocksCleanedTotal.Inc()
-		level.Info(userLogger).Log("msg", "deleted block", "block", id)
-		return nil
-	})
-
+	deletedBlocks, failed, err := c.deleteUserBlocks(ctx, userBucket, userLogger, nil)
 	if err != nil {
 		return err
 	}
@@ -286,6 +301,93 @@ func (c *BlocksCleaner) deleteUserMarkedForDeletion(ctx context.Context, userID
 	return nil
 }
 
+// forceDeleteUser hard-deletes the bucket index, blocks and markers of a tenant marked for deletion in
+// a single pass, without waiting for the deletion delay and the tenant cleanup delay. The tenant must
+// have been checked to be marked for deletion by the caller. The progress is reported to the input
+// function. The markers, including the tenant deletion mark, are kept if any block fails to be deleted,
+// so that the deletion of the tenant can be retried.
+func (c *BlocksCleaner) forceDeleteUser(ctx context.Context, userID string, progress func(msg string)) error {
+	userLogger := util_log.WithUserID(userID, c.logger)
+	userBucket := bucket.NewUserBucketClient(userID, c.bucketClient, c.cfgProvider)
+
+	level.Info(userLogger).Log("msg", "force deleting tenant marked for deletion")
+
+	if err := bucketindex.DeleteIndex(ctx, c.bucketClient, userID, c.cfgProvider); err != nil {
+		return errors.Wrap(err, "failed to delete bucket index")
+	}
+	c.tenantBucketIndexLastUpdate.DeleteLabelValues(userID)
+	progress("deleted bucket index")
+
+	deletedBlocks, failed, err := c.deleteUserBlocks(ctx, userBucket, userLogger, func(id ulid.ULID, err error) {
+		if err != nil {
+			progress(fmt.Sprintf("failed to delete block %s: %s", id, err))
+		} else {
+			progress(fmt.Sprintf("deleted block %s", id))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errors.Errorf("failed to delete %d blocks", failed)
+	}
+	progress(fmt.Sprintf("deleted %d blocks", deletedBlocks))
+
+	c.tenantBlocks.DeleteLabelValues(userID)
+	c.tenantMarkedBlocks.DeleteLabelValues(userID)
+	c.tenantPartialBlocks.DeleteLabelValues(userID)
+
+	if deleted, err := bucket.DeletePrefix(ctx, userBucket, block.DebugMetas, userLogger); err != nil {
+		return errors.Wrap(err, "failed to delete "+block.DebugMetas)
+	} else if deleted > 0 {
+		progress(fmt.Sprintf("deleted %d files under %s", deleted, block.DebugMetas))
+	}
+
+	// Tenant deletion mark file is inside Markers as well.
+	deleted, err := bucket.DeletePrefix(ctx, userBucket, bucketindex.MarkersPathname, userLogger)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete marker files")
+	}
+	progress(fmt.Sprintf("deleted %d marker files", deleted))
+
+	level.Info(userLogger).Log("msg", "force deleted tenant marked for deletion", "deletedBlocks", deletedBlocks)
+	return nil
+}
+
+// deleteUserBlocks deletes all the blocks of the user, regardless of their deletion marks. The optional
+// onDelete function is called for each block once its deletion has been attempted. Returns the number of
+// deleted blocks and of blocks failed to be deleted.
+func (c *BlocksCleaner) deleteUserBlocks(ctx context.Context, userBucket objstore.Bucket, userLogger log.Logger, onDelete func(id ulid.ULID, err error)) (deleted, failed int, err error) {
+	err = userBucket.Iter(ctx, "", func(name string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		id, ok := block.IsBlockDir(name)
+		if !ok {
+			return nil
+		}
+
+		err := block.Delete(ctx, userLogger, userBucket, id)
+		if onDelete != nil {
+			onDelete(id, err)
+		}
+		if err != nil {
+			failed++
+			c.blocksFailedTotal.Inc()
+			level.Warn(userLogger).Log("msg", "failed to delete block", "block", id, "err", err)
+			return nil // Continue with other blocks.
+		}
+
+		deleted++
+		c.blocksCleanedTotal.Inc()
+		level.Info(userLogger).Log("msg", "deleted block", "block", id)
+		return nil
+	})
+
+	return deleted, failed, err
+}
+
 func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string, firstRun bool) (returnErr error) {
 	userLogger := util_log.WithUserID(userID, c.logger)
 	userBucket := bucket.NewUserBucketClient(userID, c.bucketClient, c.cfgProvider)
@@ -337,11 +439,7 @@ func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string, firstRun b
 
 	// Delete blocks marked for deletion. We iterate over a copy of deletion marks because
 	// we'll need to manipulate the index (removing blocks which get deleted).
-	for _, mark := range idx.BlockDeletionMarks.Clone() {
-		if time.Since(mark.GetDeletionTime()).Seconds() <= c.cfg.DeletionDelay.Seconds() {
-			continue
-		}
-
+	for _, mark := range listBlocksToDelete(idx, c.deletionDelay(userID)) {
 		if err := block.Delete(ctx, userLogger, userBucket, mark.ID); err != nil {
 			c.blocksFailedTotal.Inc()
 			level.Warn(userLogger).Log("msg", "failed to delete block marked for deletion", "block", mark.ID, "err", err)
@@ -377,6 +475,29 @@ func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string, firstRun b
 // cleanUserPartialBlocks delete partial blocks which are safe to be deleted. The provided partials map
 // is updated accordingly.
 func (c *BlocksCleaner) cleanUserPartialBlocks(ctx context.Context, partials map[ulid.ULID]error, idx *bucketindex.Index, userBucket objstore.InstrumentedBucket, userLogger log.Logger) {
+	for _, blockID := range listPartialBlocksToDelete(ctx, partials, userBucket, userLogger) {
+		// Hard-delete partial blocks having a deletion mark, even if the deletion threshold has not
+		// been reached yet.
+		if err := block.Delete(ctx, userLogger, userBucket, blockID); err != nil {
+			c.blocksFailedTotal.Inc()
+			level.Warn(userLogger).Log("msg", "error deleting partial block marked for deletion", "block", blockID, "err", err)
+			continue
+		}
+
+		// Remove the block from the bucket index too.
+		idx.RemoveBlock(blockID)
+		delete(partials, blockID)
+
+		c.blocksCleanedTotal.Inc()
+		level.Info(userLogger).Log("msg", "deleted partial block marked for deletion", "block", blockID)
+	}
+}
+
+// listPartialBlocksToDelete returns the partial blocks which are safe to be deleted, because their
+// meta.json is missing and they have a deletion mark.
+func listPartialBlocksToDelete(ctx context.Context, partials map[ulid.ULID]error, userBucket objstore.InstrumentedBucket, userLogger log.Logger) []ulid.ULID {
+	var result []ulid.ULID
+
 	for blockID, blockErr := range partials {
 		// We can safely delete only blocks which are partial because the meta.json is missing.
 		if !errors.Is(blockErr, bucketindex.ErrBlockMetaNotFound) {
@@ -393,21 +514,33 @@ func (c *BlocksCleaner) cleanUserPartialBlocks(ctx context.Context, partials map
 			continue
 		}
 
-		// Hard-delete partial blocks having a deletion mark, even if the deletion threshold has not
-		// been reached yet.
-		if err := block.Delete(ctx, userLogger, userBucket, blockID); err != nil {
-			c.blocksFailedTotal.Inc()
-			level.Warn(userLogger).Log("msg", "error deleting partial block marked for deletion", "block", blockID, "err", err)
-			continue
-		}
+		result = append(result, blockID)
+	}
 
-		// Remove the block from the bucket index too.
-		idx.RemoveBlock(blockID)
-		delete(partials, blockID)
+	return result
+}
 
-		c.blocksCleanedTotal.Inc()
-		level.Info(userLogger).Log("msg", "deleted partial block marked for deletion", "block", blockID)
+// deletionDelay returns the time before a block of the user marked for deletion is deleted.
+func (c *BlocksCleaner) deletionDelay(userID string) time.Duration {
+	if delay := c.cfgProvider.CompactorBlocksDeletionDelay(userID); delay > 0 {
+		return delay
 	}
+	return c.cfg.DeletionDelay
+}
+
+// listBlocksToDelete returns a copy of the deletion marks of the blocks which have been marked for
+// deletion longer than the deletion delay ago.
+func listBlocksToDelete(idx *bucketindex.Index, deletionDelay time.Duration) bucketindex.BlockDeletionMarks {
+	var result bucketindex.BlockDeletionMarks
+
+	for _, mark := range idx.BlockDeletionMarks.Clone() {
+		if time.Since(mark.GetDeletionTime()).Seconds() <= deletionDelay.Seconds() {
+			continue
+		}
+		result = append(result, mark)
+	}
+
+	return result
 }
 
 // applyUserRetentionPeriod marks blocks for deletion which have aged past the retention period.
@@ -452,3 +585,92 @@ func listBlocksOutsideRetentionPeriod(idx *bucketindex.Index, threshold time.Tim
 
 	return
 }
+
+// planUserCleanup returns the blocks which the cleanup of the user would delete or mark for deletion
+// with the given retention period, without modifying the bucket. The blocks are selected like in
+// cleanUser, except that the retention period is applied to the up-to-date bucket index.
+func (c *BlocksCleaner) planUserCleanup(ctx context.Context, userID string, retention time.Duration) (*CleanupPlan, error) {
+	userLogger := util_log.WithUserID(userID, c.logger)
+	userBucket := bucket.NewUserBucketClient(userID, c.bucketClient, c.cfgProvider)
+
+	idx, err := bucketindex.ReadIndex(ctx, c.bucketClient, userID, c.cfgProvider, c.logger)
+	if err != nil && !errors.Is(err, bucketindex.ErrIndexCorrupted) && !errors.Is(err, bucketindex.ErrIndexNotFound) {
+		return nil, err
+	}
+
+	// The updated bucket index is generated in-memory only.
+	w := bucketindex.NewUpdater(c.bucketClient, userID, c.cfgProvider, c.logger)
+	idx, partials, err := w.UpdateIndex(ctx, idx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &CleanupPlan{
+		Tenant:          userID,
+		RetentionPeriod: retention.String(),
+		DeletionDelay:   c.deletionDelay(userID).String(),
+		Blocks:          []*CleanupPlanBlock{},
+	}
+
+	blocks := make(map[ulid.ULID]*bucketindex.Block, len(idx.Blocks))
+	for _, b := range idx.Blocks {
+		blocks[b.ID] = b
+	}
+	addBlock := func(id ulid.ULID, rule, action string) error {
+		size, err := blockSizeBytes(ctx, userBucket, id)
+		if err != nil {
+			return errors.Wrapf(err, "compute size of block %s", id)
+		}
+
+		planned := &CleanupPlanBlock{ID: id, SizeBytes: size, Rule: rule, Action: action}
+		if b, ok := blocks[id]; ok {
+			planned.MinTime = b.MinTime
+			planned.MaxTime = b.MaxTime
+		}
+		plan.Blocks = append(plan.Blocks, planned)
+		return nil
+	}
+
+	// The retention period of zero is a special value indicating to never delete.
+	if retention > 0 {
+		for _, b := range listBlocksOutsideRetentionPeriod(idx, time.Now().Add(-retention)) {
+			if err := addBlock(b.ID, cleanupRuleRetention, cleanupActionMarkForDeletion); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, mark := range listBlocksToDelete(idx, c.deletionDelay(userID)) {
+		if err := addBlock(mark.ID, cleanupRuleDeletionMark, cleanupActionDelete); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, blockID := range listPartialBlocksToDelete(ctx, partials, userBucket, userLogger) {
+		if err := addBlock(blockID, cleanupRulePartialBlock, cleanupActionDelete); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// blockSizeBytes returns the total size of the objects of the block in the bucket.
+func blockSizeBytes(ctx context.Context, userBucket objstore.Bucket, blockID ulid.ULID) (int64, error) {
+	var size int64
+
+	err := userBucket.Iter(ctx, blockID.String()+"/", func(name string) error {
+		attrs, err := userBucket.Attributes(ctx, name)
+		if userBucket.IsObjNotFoundErr(err) {
+			// The object has been deleted in the meanwhile.
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		size += attrs.Size
+		return nil
+	}, objstore.WithRecursiveIter)
+
+	return size, err
+}
@@ -282,6 +282,128 @@ func TestBlocksCleaner_ShouldContinueOnBlockDeletionFailure(t *testing.T) {
 	assert.ElementsMatch(t, []ulid.ULID{block3}, idx.BlockDeletionMarks.GetULIDs())
 }
 
+func TestBlocksCleaner_ShouldApplyThePerTenantBlocksDeletionDelay(t *testing.T) {
+	bucketClient, _ := cortex_testutil.PrepareFilesystemBucket(t)
+	bucketClient = bucketindex.BucketWithGlobalMarkers(bucketClient)
+
+	// Create a block marked for deletion 2 hours ago for each user.
+	ctx := context.Background()
+	now := time.Now()
+	block1 := createTSDBBlock(t, bucketClient, "user-1", 10, 20, nil)
+	block2 := createTSDBBlock(t, bucketClient, "user-2", 10, 20, nil)
+	createDeletionMark(t, bucketClient, "user-1", block1, now.Add(-2*time.Hour))
+	createDeletionMark(t, bucketClient, "user-2", block2, now.Add(-2*time.Hour))
+
+	cfg := BlocksCleanerConfig{
+		DeletionDelay:      12 * time.Hour,
+		CleanupInterval:    time.Minute,
+		CleanupConcurrency: 1,
+	}
+
+	logger := log.NewNopLogger()
+	scanner := tsdb.NewUsersScanner(bucketClient, tsdb.AllUsers, logger)
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.userBlocksDeletionDelays["user-1"] = time.Hour
+
+	cleaner := NewBlocksCleaner(cfg, bucketClient, scanner, cfgProvider, logger, nil)
+	require.NoError(t, cleaner.cleanUsers(ctx, true))
+
+	// Only the block of the user with a shorter deletion delay has been deleted.
+	for _, tc := range []struct {
+		path           string
+		expectedExists bool
+	}{
+		{path: path.Join("user-1", block1.String(), metadata.MetaFilename), expectedExists: false},
+		{path: path.Join("user-2", block2.String(), metadata.MetaFilename), expectedExists: true},
+	} {
+		exists, err := bucketClient.Exists(ctx, tc.path)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expectedExists, exists, tc.path)
+	}
+}
+
+func TestBlocksCleaner_ForceDeleteUser(t *testing.T) {
+	const userID = "user-1"
+
+	tests := map[string]struct {
+		deleteFailures      []string
+		expectedErr         string
+		expectedMarksExists bool
+	}{
+		"should delete the blocks, bucket index and markers of the tenant": {
+			expectedMarksExists: false,
+		},
+		"should keep the markers if a block fails to be deleted": {
+			deleteFailures:      []string{path.Join(userID, "%s", metadata.MetaFilename)},
+			expectedErr:         "failed to delete 1 blocks",
+			expectedMarksExists: true,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			bucketClient, _ := cortex_testutil.PrepareFilesystemBucket(t)
+			bucketClient = bucketindex.BucketWithGlobalMarkers(bucketClient)
+
+			ctx := context.Background()
+			block1 := createTSDBBlock(t, bucketClient, userID, 10, 20, nil)
+			block2 := createTSDBBlock(t, bucketClient, userID, 20, 30, nil)
+			createDeletionMark(t, bucketClient, userID, block2, time.Now())
+
+			// Write the bucket index and mark the tenant for deletion.
+			idx, _, err := bucketindex.NewUpdater(bucketClient, userID, nil, log.NewNopLogger()).UpdateIndex(ctx, nil)
+			require.NoError(t, err)
+			require.NoError(t, bucketindex.WriteIndex(ctx, bucketClient, userID, nil, idx))
+			require.NoError(t, tsdb.WriteTenantDeletionMark(ctx, bucketClient, userID, nil, tsdb.NewTenantDeletionMark(time.Now())))
+
+			var deleteFailures []string
+			for _, failure := range testData.deleteFailures {
+				deleteFailures = append(deleteFailures, fmt.Sprintf(failure, block1.String()))
+			}
+			bucketClient = &mockBucketFailure{Bucket: bucketClient, DeleteFailures: deleteFailures}
+
+			cfg := BlocksCleanerConfig{
+				DeletionDelay:      12 * time.Hour,
+				CleanupInterval:    time.Minute,
+				CleanupConcurrency: 1,
+				TenantCleanupDelay: 6 * time.Hour,
+			}
+
+			logger := log.NewNopLogger()
+			scanner := tsdb.NewUsersScanner(bucketClient, tsdb.AllUsers, logger)
+			cleaner := NewBlocksCleaner(cfg, bucketClient, scanner, newMockConfigProvider(), logger, nil)
+
+			var progress []string
+			err = cleaner.forceDeleteUser(ctx, userID, func(msg string) {
+				progress = append(progress, msg)
+			})
+			if testData.expectedErr != "" {
+				require.EqualError(t, err, testData.expectedErr)
+				assert.Contains(t, progress, fmt.Sprintf("deleted block %s", block2.String()))
+			} else {
+				require.NoError(t, err)
+				assert.Contains(t, progress, fmt.Sprintf("deleted block %s", block1.String()))
+				assert.Contains(t, progress, fmt.Sprintf("deleted block %s", block2.String()))
+				assert.Contains(t, progress, "deleted 2 blocks")
+			}
+
+			for _, tc := range []struct {
+				path           string
+				expectedExists bool
+			}{
+				{path: path.Join(userID, bucketindex.IndexCompressedFilename), expectedExists: false},
+				{path: path.Join(userID, block2.String(), metadata.MetaFilename), expectedExists: false},
+				{path: path.Join(userID, bucketindex.BlockDeletionMarkFilepath(block2)), expectedExists: false},
+				{path: path.Join(userID, tsdb.TenantDeletionMarkPath), expectedExists: testData.expectedMarksExists},
+			} {
+				exists, err := bucketClient.Exists(ctx, tc.path)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedExists, exists, tc.path)
+			}
+		})
+	}
+}
+
 func TestBlocksCleaner_ShouldRebuildBucketIndexOnCorruptedOne(t *testing.T) {
 	const userID = "user-1"
 
@@ -653,13 +775,146 @@ func (m *mockBucketFailure) Delete(ctx context.Context, name string) error {
 	return m.Bucket.Delete(ctx, name)
 }
 
+func TestBlocksCleaner_PlanUserCleanup(t *testing.T) {
+	bucketClient, _ := cortex_testutil.PrepareFilesystemBucket(t)
+	bucketClient = bucketindex.BucketWithGlobalMarkers(bucketClient)
+
+	ctx := context.Background()
+	now := time.Now()
+	deletionDelay := 12 * time.Hour
+	ts := func(hours int) int64 {
+		return now.Add(time.Duration(hours)*time.Hour).Unix() * 1000
+	}
+
+	// Blocks spanning the retention boundary.
+	block1 := createTSDBBlock(t, bucketClient, "user-1", ts(-10), ts(-8), nil)
+	block2 := createTSDBBlock(t, bucketClient, "user-1", ts(-8), ts(-6), nil)
+	block3 := createTSDBBlock(t, bucketClient, "user-1", ts(-6), ts(-4), nil)
+
+	// Blocks marked for deletion.
+	block4 := createTSDBBlock(t, bucketClient, "user-1", ts(-20), ts(-18), nil)
+	block5 := createTSDBBlock(t, bucketClient, "user-1", ts(-4), ts(-2), nil)
+	createDeletionMark(t, bucketClient, "user-1", block4, now.Add(-deletionDelay).Add(-time.Hour)) // Block reached the deletion threshold.
+	createDeletionMark(t, bucketClient, "user-1", block5, now.Add(-deletionDelay).Add(time.Hour))  // Block hasn't reached the deletion threshold yet.
+
+	// Partial blocks.
+	block6 := ulid.MustNew(6, rand.Reader)
+	createDeletionMark(t, bucketClient, "user-1", block6, now.Add(-deletionDelay).Add(time.Hour)) // Partial block with deletion mark.
+	block7 := createTSDBBlock(t, bucketClient, "user-1", ts(-2), ts(0), nil)
+	require.NoError(t, bucketClient.Delete(ctx, path.Join("user-1", block7.String(), metadata.MetaFilename))) // Partial block without deletion mark.
+
+	cfg := BlocksCleanerConfig{
+		DeletionDelay:      deletionDelay,
+		CleanupInterval:    time.Minute,
+		CleanupConcurrency: 1,
+	}
+
+	logger := log.NewNopLogger()
+	reg := prometheus.NewPedanticRegistry()
+	scanner := tsdb.NewUsersScanner(bucketClient, tsdb.AllUsers, logger)
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.userRetentionPeriods["user-1"] = 7 * time.Hour
+
+	cleaner := NewBlocksCleaner(cfg, bucketClient, scanner, cfgProvider, logger, reg)
+
+	tests := map[string]struct {
+		retention time.Duration
+		expected  map[ulid.ULID][2]string
+	}{
+		"should plan the deletion of the blocks marked for deletion and the partial blocks if the retention is disabled": {
+			retention: 0,
+			expected: map[ulid.ULID][2]string{
+				block4: {cleanupRuleDeletionMark, cleanupActionDelete},
+				block6: {cleanupRulePartialBlock, cleanupActionDelete},
+			},
+		},
+		"should plan the blocks outside the retention period to be marked for deletion": {
+			retention: 7 * time.Hour,
+			expected: map[ulid.ULID][2]string{
+				block1: {cleanupRuleRetention, cleanupActionMarkForDeletion},
+				block4: {cleanupRuleDeletionMark, cleanupActionDelete},
+				block6: {cleanupRulePartialBlock, cleanupActionDelete},
+			},
+		},
+		"should plan more blocks to be marked for deletion with a shorter retention period": {
+			retention: 3 * time.Hour,
+			expected: map[ulid.ULID][2]string{
+				block1: {cleanupRuleRetention, cleanupActionMarkForDeletion},
+				block2: {cleanupRuleRetention, cleanupActionMarkForDeletion},
+				block3: {cleanupRuleRetention, cleanupActionMarkForDeletion},
+				block4: {cleanupRuleDeletionMark, cleanupActionDelete},
+				block6: {cleanupRulePartialBlock, cleanupActionDelete},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			plan, err := cleaner.planUserCleanup(ctx, "user-1", testData.retention)
+			require.NoError(t, err)
+
+			assert.Equal(t, "user-1", plan.Tenant)
+			assert.Equal(t, testData.retention.String(), plan.RetentionPeriod)
+			assert.Equal(t, deletionDelay.String(), plan.DeletionDelay)
+
+			actual := map[ulid.ULID][2]string{}
+			for _, b := range plan.Blocks {
+				actual[b.ID] = [2]string{b.Rule, b.Action}
+				assert.Greater(t, b.SizeBytes, int64(0), b.ID.String())
+
+				// The time range is unknown for the partial blocks.
+				if b.ID == block6 {
+					assert.Zero(t, b.MinTime)
+					assert.Zero(t, b.MaxTime)
+				} else {
+					assert.NotZero(t, b.MinTime)
+					assert.NotZero(t, b.MaxTime)
+				}
+			}
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+
+	// The plan doesn't modify the bucket.
+	for _, blockID := range []ulid.ULID{block1, block2, block3} {
+		exists, err := bucketClient.Exists(ctx, path.Join("user-1", blockID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.False(t, exists, blockID.String())
+	}
+	for _, blockID := range []ulid.ULID{block4, block6} {
+		exists, err := bucketClient.Exists(ctx, path.Join("user-1", blockID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.True(t, exists, blockID.String())
+	}
+	exists, err := bucketClient.Exists(ctx, path.Join("user-1", bucketindex.IndexCompressedFilename))
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// The cleanup does what has been planned. The retention is applied once the bucket index
+	// exists, so from the second cleanup.
+	require.NoError(t, cleaner.cleanUsers(ctx, false))
+	require.NoError(t, cleaner.cleanUsers(ctx, false))
+
+	exists, err = bucketClient.Exists(ctx, path.Join("user-1", block1.String(), metadata.DeletionMarkFilename))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	for _, blockID := range []ulid.ULID{block4, block6} {
+		exists, err := bucketClient.Exists(ctx, path.Join("user-1", blockID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.False(t, exists, blockID.String())
+	}
+}
+
 type mockConfigProvider struct {
-	userRetentionPeriods map[string]time.Duration
+	userRetentionPeriods     map[string]time.Duration
+	userBlocksDeletionDelays map[string]time.Duration
 }
 
 func newMockConfigProvider() *mockConfigProvider {
 	return &mockConfigProvider{
-		userRetentionPeriods: make(map[string]time.Duration),
+		userRetentionPeriods:     make(map[string]time.Duration),
+		userBlocksDeletionDelays: make(map[string]time.Duration),
 	}
 }
 
@@ -670,6 +925,13 @@ func (m *mockConfigProvider) CompactorBlocksRetentionPeriod(user string) time.Du
 	return 0
 }
 
+func (m *mockConfigProvider) CompactorBlocksDeletionDelay(user string) time.Duration {
+	if result, ok := m.userBlocksDeletionDelays[user]; ok {
+		return result
+	}
+	return 0
+}
+
 func (m *mockConfigProvider) S3SSEType(user string) string {
 	return ""
 }
@@ -681,3 +943,7 @@ func (m *mockConfigProvider) S3SSEKMSKeyID(userID string) string {
 func (m *mockConfigProvider) S3SSEKMSEncryptionContext(userID string) string {
 	return ""
 }
+
+func (m *mockConfigProvider) ClientSideEncryptionKeyID(userID string) string {
+	return ""
+}
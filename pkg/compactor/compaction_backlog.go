@@ -0,0 +1,109 @@
+package compactor
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+)
+
+type groupPlan struct {
+	toCompact []*metadata.Meta
+	err       error
+}
+
+// backlogTracker wraps the compact.Grouper and compact.Planner of a tenant to track its compaction
+// backlog. At the beginning of each compaction pass, when the groups are built, it plans all of them
+// and sets the backlog gauge to the number of groups having blocks to compact. The plans are then
+// served to the BucketCompactor, so that each group is planned once per pass.
+type backlogTracker struct {
+	ctx     context.Context
+	grouper compact.Grouper
+	planner compact.Planner
+	backlog prometheus.Gauge
+
+	// Plans of the groups built in the current pass, by key.
+	plansMtx sync.Mutex
+	plans    map[string]groupPlan
+}
+
+func newBacklogTracker(ctx context.Context, grouper compact.Grouper, planner compact.Planner, backlog prometheus.Gauge) *backlogTracker {
+	return &backlogTracker{
+		ctx:     ctx,
+		grouper: grouper,
+		planner: planner,
+		backlog: backlog,
+		plans:   map[string]groupPlan{},
+	}
+}
+
+// Groups implements compact.Grouper.
+func (t *backlogTracker) Groups(blocks map[ulid.ULID]*metadata.Meta) ([]*compact.Group, error) {
+	groups, err := t.grouper.Groups(blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make(map[string]groupPlan, len(groups))
+	backlog := 0
+
+	for _, g := range groups {
+		metas := make([]*metadata.Meta, 0, len(g.IDs()))
+		for _, id := range g.IDs() {
+			if meta, ok := blocks[id]; ok {
+				metas = append(metas, meta)
+			}
+		}
+		if len(metas) == 0 {
+			continue
+		}
+
+		sort.SliceStable(metas, func(i, j int) bool {
+			return metas[i].MinTime < metas[j].MinTime
+		})
+
+		toCompact, err := t.planner.Plan(t.ctx, metas)
+		if err == nil && len(toCompact) > 0 {
+			backlog++
+		}
+		plans[groupPlanKey(metas)] = groupPlan{toCompact: toCompact, err: err}
+	}
+
+	t.backlog.Set(float64(backlog))
+
+	t.plansMtx.Lock()
+	t.plans = plans
+	t.plansMtx.Unlock()
+
+	return groups, nil
+}
+
+// Plan implements compact.Planner.
+func (t *backlogTracker) Plan(ctx context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+	key := groupPlanKey(metasByMinTime)
+
+	t.plansMtx.Lock()
+	plan, ok := t.plans[key]
+	delete(t.plans, key)
+	t.plansMtx.Unlock()
+
+	// The group may have not been planned while building the groups, or its blocks may be
+	// sorted differently than expected (ie. multiple blocks with the same min time).
+	if !ok {
+		return t.planner.Plan(ctx, metasByMinTime)
+	}
+	return plan.toCompact, plan.err
+}
+
+func groupPlanKey(metasByMinTime []*metadata.Meta) string {
+	ids := make([]string, 0, len(metasByMinTime))
+	for _, meta := range metasByMinTime {
+		ids = append(ids, meta.ULID.String())
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,88 @@
+package compactor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+)
+
+func TestBacklogTracker(t *testing.T) {
+	newMeta := func(id uint64, minTime int64, shard string) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(id, nil), MinTime: minTime, MaxTime: minTime + 10},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"shard": shard}},
+		}
+	}
+
+	// Two groups: the shard 1 has blocks to compact, the shard 2 doesn't.
+	shard1 := []*metadata.Meta{newMeta(1, 0, "1"), newMeta(2, 10, "1")}
+	shard2 := []*metadata.Meta{newMeta(3, 0, "2")}
+
+	blocks := map[ulid.ULID]*metadata.Meta{}
+	for _, meta := range append(append([]*metadata.Meta{}, shard1...), shard2...) {
+		blocks[meta.ULID] = meta
+	}
+
+	grouper := &groupsMock{}
+	grouper.On("Groups", blocks).Return([]*compact.Group{
+		newGroup(t, shard1...),
+		newGroup(t, shard2...),
+	}, nil)
+
+	planner := &tsdbPlannerMock{}
+	planner.On("Plan", mock.Anything, shard1).Return(shard1, nil)
+	planner.On("Plan", mock.Anything, shard2).Return([]*metadata.Meta{}, nil)
+
+	backlog := prometheus.NewGauge(prometheus.GaugeOpts{})
+	tracker := newBacklogTracker(context.Background(), grouper, planner, backlog)
+
+	groups, err := tracker.Groups(blocks)
+	require.NoError(t, err)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, float64(1), testutil.ToFloat64(backlog))
+	planner.AssertNumberOfCalls(t, "Plan", 2)
+
+	// The plans computed while building the groups are served once.
+	toCompact, err := tracker.Plan(context.Background(), shard1)
+	require.NoError(t, err)
+	assert.Equal(t, shard1, toCompact)
+
+	toCompact, err = tracker.Plan(context.Background(), shard2)
+	require.NoError(t, err)
+	assert.Empty(t, toCompact)
+	planner.AssertNumberOfCalls(t, "Plan", 2)
+
+	// The groups planned again in the same pass are planned by the wrapped planner.
+	toCompact, err = tracker.Plan(context.Background(), shard1)
+	require.NoError(t, err)
+	assert.Equal(t, shard1, toCompact)
+	planner.AssertNumberOfCalls(t, "Plan", 3)
+}
+
+type groupsMock struct {
+	mock.Mock
+}
+
+func (m *groupsMock) Groups(blocks map[ulid.ULID]*metadata.Meta) ([]*compact.Group, error) {
+	args := m.Called(blocks)
+	return args.Get(0).([]*compact.Group), args.Error(1)
+}
+
+func newGroup(t *testing.T, metas ...*metadata.Meta) *compact.Group {
+	g, err := compact.NewGroup(nil, nil, compact.DefaultGroupKey(metas[0].Thanos), labels.FromMap(metas[0].Thanos.Labels), 0, false, false, nil, nil, nil, nil, nil, nil, nil, metadata.NoneFunc)
+	require.NoError(t, err)
+	for _, meta := range metas {
+		require.NoError(t, g.AppendMeta(meta))
+	}
+	return g
+}
@@ -0,0 +1,87 @@
+package compactor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
+)
+
+// CompactionGroupMarker is written in the bucket by the compactor while it's compacting a group
+// of blocks, to signal the other compactor replicas to not compact the same group concurrently.
+type CompactionGroupMarker struct {
+	// ID of the compactor instance compacting the group.
+	CompactorID string `json:"compactor_id"`
+
+	// Unix timestamp when the marker was last updated.
+	UpdatedTime int64 `json:"updated_time"`
+}
+
+// IsExpired returns whether the marker hasn't been updated since longer than the ttl,
+// in which case the compactor which wrote it is assumed to be not compacting the group anymore.
+func (m *CompactionGroupMarker) IsExpired(ttl time.Duration, now time.Time) bool {
+	return now.Sub(time.Unix(m.UpdatedTime, 0)) > ttl
+}
+
+// CompactionGroupMarkerFilepath returns the path, relative to the tenant's bucket location,
+// of the marker of the compaction group with the given key.
+func CompactionGroupMarkerFilepath(groupKey string) string {
+	return fmt.Sprintf("%s/compaction-group-%s-in-progress.json", bucketindex.MarkersPathname, groupKey)
+}
+
+// ReadCompactionGroupMarker returns the marker of the compaction group with the given key,
+// if it exists. If it doesn't exist, returns nil marker, and no error.
+func ReadCompactionGroupMarker(ctx context.Context, bkt objstore.BucketReader, groupKey string, logger log.Logger) (*CompactionGroupMarker, error) {
+	markerFile := CompactionGroupMarkerFilepath(groupKey)
+
+	r, err := bkt.Get(ctx, markerFile)
+	if err != nil {
+		if bkt.IsObjNotFoundErr(err) {
+			return nil, nil
+		}
+
+		return nil, errors.Wrapf(err, "failed to read compaction group marker: %s", markerFile)
+	}
+
+	mark := &CompactionGroupMarker{}
+	err = json.NewDecoder(r).Decode(mark)
+
+	// Close reader before dealing with decode error.
+	if closeErr := r.Close(); closeErr != nil {
+		level.Warn(logger).Log("msg", "failed to close bucket reader", "err", closeErr)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode compaction group marker: %s", markerFile)
+	}
+
+	return mark, nil
+}
+
+// WriteCompactionGroupMarker uploads the marker of the compaction group with the given key.
+func WriteCompactionGroupMarker(ctx context.Context, bkt objstore.Bucket, groupKey string, mark *CompactionGroupMarker) error {
+	data, err := json.Marshal(mark)
+	if err != nil {
+		return errors.Wrap(err, "serialize compaction group marker")
+	}
+
+	return errors.Wrap(bkt.Upload(ctx, CompactionGroupMarkerFilepath(groupKey), bytes.NewReader(data)), "upload compaction group marker")
+}
+
+// DeleteCompactionGroupMarker deletes the marker of the compaction group with the given key.
+// It's not an error if the marker doesn't exist.
+func DeleteCompactionGroupMarker(ctx context.Context, bkt objstore.Bucket, groupKey string) error {
+	if err := bkt.Delete(ctx, CompactionGroupMarkerFilepath(groupKey)); err != nil && !bkt.IsObjNotFoundErr(err) {
+		return errors.Wrap(err, "delete compaction group marker")
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package compactor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+func TestCompactionGroupMarker(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	// The marker doesn't exist yet.
+	mark, err := ReadCompactionGroupMarker(ctx, bkt, "0@123", log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Nil(t, mark)
+
+	now := time.Now()
+	require.NoError(t, WriteCompactionGroupMarker(ctx, bkt, "0@123", &CompactionGroupMarker{CompactorID: "compactor-1", UpdatedTime: now.Unix()}))
+	exists, err := bkt.Exists(ctx, "markers/compaction-group-0@123-in-progress.json")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	mark, err = ReadCompactionGroupMarker(ctx, bkt, "0@123", log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Equal(t, &CompactionGroupMarker{CompactorID: "compactor-1", UpdatedTime: now.Unix()}, mark)
+	assert.False(t, mark.IsExpired(time.Minute, now.Add(30*time.Second)))
+	assert.True(t, mark.IsExpired(time.Minute, now.Add(2*time.Minute)))
+
+	require.NoError(t, DeleteCompactionGroupMarker(ctx, bkt, "0@123"))
+	mark, err = ReadCompactionGroupMarker(ctx, bkt, "0@123", log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Nil(t, mark)
+
+	// Deleting a non existing marker is not an error.
+	require.NoError(t, DeleteCompactionGroupMarker(ctx, bkt, "0@123"))
+}
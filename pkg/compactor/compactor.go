@@ -10,13 +10,17 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/grafana/dskit/backoff"
 	"github.com/grafana/dskit/services"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -25,7 +29,9 @@ import (
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/extprom"
 	"github.com/thanos-io/thanos/pkg/objstore"
+	"golang.org/x/sync/semaphore"
 
 	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/storage/bucket"
@@ -34,6 +40,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 const (
@@ -45,6 +52,9 @@ var (
 	errInvalidBlockRanges = "compactor block range periods should be divisible by the previous one, but %s is not divisible by %s"
 	RingOp                = ring.NewOp([]ring.InstanceState{ring.ACTIVE}, nil)
 
+	errInvalidCompactionConcurrencyPerTenant = errors.New("the compaction concurrency per tenant must be greater than or equal to 0")
+	errInvalidTimeSharding                   = errors.New("the compactor time sharding requires the compactor sharding to be enabled")
+
 	DefaultBlocksGrouperFactory = func(ctx context.Context, cfg Config, bkt objstore.Bucket, logger log.Logger, reg prometheus.Registerer, blocksMarkedForDeletion prometheus.Counter, garbageCollectedBlocks prometheus.Counter) compact.Grouper {
 		return compact.NewDefaultGrouper(
 			logger,
@@ -102,6 +112,9 @@ type Config struct {
 	DeletionDelay         time.Duration            `yaml:"deletion_delay"`
 	TenantCleanupDelay    time.Duration            `yaml:"tenant_cleanup_delay"`
 
+	// Max number of concurrent group compactions of a single tenant, out of the CompactionConcurrency.
+	CompactionConcurrencyPerTenant int `yaml:"compaction_concurrency_per_tenant"`
+
 	// Whether the migration of block deletion marks to the global markers location is enabled.
 	BlockDeletionMarksMigrationEnabled bool `yaml:"block_deletion_marks_migration_enabled"`
 
@@ -109,8 +122,10 @@ type Config struct {
 	DisabledTenants flagext.StringSliceCSV `yaml:"disabled_tenants"`
 
 	// Compactors sharding.
-	ShardingEnabled bool       `yaml:"sharding_enabled"`
-	ShardingRing    RingConfig `yaml:"sharding_ring"`
+	ShardingEnabled          bool          `yaml:"sharding_enabled"`
+	ShardingRing             RingConfig    `yaml:"sharding_ring"`
+	GroupInProgressMarkerTTL time.Duration `yaml:"group_in_progress_marker_ttl"`
+	TimeShardingEnabled      bool          `yaml:"time_sharding_enabled"`
 
 	// No need to add options to customize the retry backoff,
 	// given the defaults should be fine, but allow to override
@@ -139,9 +154,12 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.CompactionInterval, "compactor.compaction-interval", time.Hour, "The frequency at which the compaction runs")
 	f.IntVar(&cfg.CompactionRetries, "compactor.compaction-retries", 3, "How many times to retry a failed compaction within a single compaction run.")
 	f.IntVar(&cfg.CompactionConcurrency, "compactor.compaction-concurrency", 1, "Max number of concurrent compactions running.")
+	f.IntVar(&cfg.CompactionConcurrencyPerTenant, "compactor.compaction-concurrency-per-tenant", 0, "Max number of concurrent compactions running for a single tenant. When lower than -compactor.compaction-concurrency, multiple tenants are compacted concurrently, each one running up to this number of compactions, without exceeding -compactor.compaction-concurrency overall. 0 to use -compactor.compaction-concurrency, compacting one tenant at a time.")
 	f.DurationVar(&cfg.CleanupInterval, "compactor.cleanup-interval", 15*time.Minute, "How frequently compactor should run blocks cleanup and maintenance, as well as update the bucket index.")
 	f.IntVar(&cfg.CleanupConcurrency, "compactor.cleanup-concurrency", 20, "Max number of tenants for which blocks cleanup and maintenance should run concurrently.")
 	f.BoolVar(&cfg.ShardingEnabled, "compactor.sharding-enabled", false, "Shard tenants across multiple compactor instances. Sharding is required if you run multiple compactor instances, in order to coordinate compactions and avoid race conditions leading to the same tenant blocks simultaneously compacted by different instances.")
+	f.DurationVar(&cfg.GroupInProgressMarkerTTL, "compactor.group-in-progress-marker-ttl", 15*time.Minute, "When sharding is enabled, the compactor writes a marker in the bucket while compacting a group of blocks, so that the other compactors don't compact the same group concurrently, and refreshes it periodically until the compaction is done. A marker not refreshed for longer than this period, for example because the compactor crashed, is considered expired and ignored. 0 to disable the markers.")
+	f.BoolVar(&cfg.TimeShardingEnabled, "compactor.time-sharding-enabled", false, "When sharding is enabled, also shard the compaction of each tenant by time range across the compactor instances, so that the blocks of a tenant within different time ranges of the largest block range period are compacted concurrently by different instances. Only the blocks cleanup of a tenant is still done by the instance owning the tenant.")
 	f.DurationVar(&cfg.DeletionDelay, "compactor.deletion-delay", 12*time.Hour, "Time before a block marked for deletion is deleted from bucket. "+
 		"If not 0, blocks will be marked for deletion and compactor component will permanently delete blocks marked for deletion from the bucket. "+
 		"If 0, blocks will be deleted straight away. Note that deleting blocks immediately can cause query failures.")
@@ -152,7 +170,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&cfg.DisabledTenants, "compactor.disabled-tenants", "Comma separated list of tenants that cannot be compacted by this compactor. If specified, and compactor would normally pick given tenant for compaction (via -compactor.enabled-tenants or sharding), it will be ignored instead.")
 }
 
-func (cfg *Config) Validate() error {
+func (cfg *Config) Validate(limits validation.Limits) error {
 	// Each block range period should be divisible by the previous one.
 	for i := 1; i < len(cfg.BlockRanges); i++ {
 		if cfg.BlockRanges[i]%cfg.BlockRanges[i-1] != 0 {
@@ -160,6 +178,19 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	if cfg.CompactionConcurrencyPerTenant < 0 {
+		return errInvalidCompactionConcurrencyPerTenant
+	}
+
+	if cfg.TimeShardingEnabled && !cfg.ShardingEnabled {
+		return errInvalidTimeSharding
+	}
+
+	// The blocks cut by the ingesters should be compactable.
+	if err := cortex_tsdb.ValidateBlockRanges(limits.TSDBBlockRanges, cfg.BlockRanges); err != nil {
+		return errors.Wrap(err, "invalid ingester TSDB block ranges limit")
+	}
+
 	return nil
 }
 
@@ -167,6 +198,7 @@ func (cfg *Config) Validate() error {
 type ConfigProvider interface {
 	bucket.TenantConfigProvider
 	CompactorBlocksRetentionPeriod(user string) time.Duration
+	CompactorBlocksDeletionDelay(user string) time.Duration
 }
 
 // Compactor is a multi-tenant TSDB blocks compactor based on Thanos.
@@ -218,6 +250,9 @@ type Compactor struct {
 	compactionRunInterval          prometheus.Gauge
 	blocksMarkedForDeletion        prometheus.Counter
 	garbageCollectedBlocks         prometheus.Counter
+	blocksMarkedForNoCompaction    prometheus.Counter
+	compactionGroupsSkipped        *prometheus.CounterVec
+	compactionBacklogGroups        *prometheus.GaugeVec
 
 	// TSDB syncer metrics
 	syncerMetrics *syncerMetrics
@@ -226,7 +261,14 @@ type Compactor struct {
 // NewCompactor makes a new Compactor.
 func NewCompactor(compactorCfg Config, storageCfg cortex_tsdb.BlocksStorageConfig, cfgProvider ConfigProvider, logger log.Logger, registerer prometheus.Registerer) (*Compactor, error) {
 	bucketClientFactory := func(ctx context.Context) (objstore.Bucket, error) {
-		return bucket.NewClient(ctx, storageCfg.Bucket, "compactor", logger, registerer)
+		bucketClient, err := bucket.NewClient(ctx, storageCfg.Bucket, "compactor", logger, registerer)
+		if err != nil {
+			return nil, err
+		}
+
+		// The bucket indexes written by the compactor invalidate the ones cached in the metadata cache
+		// shared with the queriers and store-gateways, if any.
+		return cortex_tsdb.CreateBucketIndexCachingBucket(storageCfg.BucketStore.MetadataCache, bucketClient, logger, extprom.WrapRegistererWith(prometheus.Labels{"component": "compactor"}, registerer))
 	}
 
 	blocksGrouperFactory := compactorCfg.BlocksGrouperFactory
@@ -315,6 +357,18 @@ func newCompactor(
 			Name: "cortex_compactor_garbage_collected_blocks_total",
 			Help: "Total number of blocks marked for deletion by compactor.",
 		}),
+		blocksMarkedForNoCompaction: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_compactor_blocks_marked_for_no_compaction_total",
+			Help: "Total number of blocks marked for no compaction by the compactor, because they're corrupted.",
+		}),
+		compactionGroupsSkipped: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_compactor_groups_skipped_total",
+			Help: "Total number of compaction groups skipped right before being compacted, because the tenant is not owned anymore by the compactor or the group is being compacted by another compactor.",
+		}, []string{"reason"}),
+		compactionBacklogGroups: promauto.With(registerer).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_compactor_tenant_compaction_backlog_groups",
+			Help: "Number of compaction groups of the tenant with blocks to compact, as planned at the beginning of the latest compaction pass.",
+		}, []string{"user"}),
 	}
 
 	if len(compactorCfg.EnabledTenants) > 0 {
@@ -498,6 +552,7 @@ func (c *Compactor) compactUsers(ctx context.Context) {
 
 	// Keep track of users owned by this shard, so that we can delete the local files for all other users.
 	ownedUsers := map[string]struct{}{}
+	var usersToCompact []string
 	for _, userID := range users {
 		// Ensure the context has not been canceled (ie. compactor shutdown has been triggered).
 		if ctx.Err() != nil {
@@ -506,12 +561,13 @@ func (c *Compactor) compactUsers(ctx context.Context) {
 		}
 
 		// Ensure the user ID belongs to our shard.
-		if owned, err := c.ownUser(userID); err != nil {
+		if owned, err := c.ownUserForCompaction(userID); err != nil {
 			c.compactionRunSkippedTenants.Inc()
 			level.Warn(c.logger).Log("msg", "unable to check if user is owned by this shard", "user", userID, "err", err)
 			continue
 		} else if !owned {
 			c.compactionRunSkippedTenants.Inc()
+			c.compactionBacklogGroups.DeleteLabelValues(userID)
 			level.Debug(c.logger).Log("msg", "skipping user because it is not owned by this shard", "user", userID)
 			continue
 		}
@@ -524,23 +580,57 @@ func (c *Compactor) compactUsers(ctx context.Context) {
 			continue
 		} else if markedForDeletion {
 			c.compactionRunSkippedTenants.Inc()
+			c.compactionBacklogGroups.DeleteLabelValues(userID)
 			level.Debug(c.logger).Log("msg", "skipping user because it is marked for deletion", "user", userID)
 			continue
 		}
 
-		level.Info(c.logger).Log("msg", "starting compaction of user blocks", "user", userID)
+		usersToCompact = append(usersToCompact, userID)
+	}
 
-		if err = c.compactUserWithRetries(ctx, userID); err != nil {
-			c.compactionRunFailedTenants.Inc()
-			compactionErrorCount++
-			level.Error(c.logger).Log("msg", "failed to compact user blocks", "user", userID, "err", err)
-			continue
+	c.prioritizeUsers(ctx, usersToCompact)
+
+	// The tenants are compacted concurrently, each one taking its share of the compaction
+	// concurrency, in the order of priority.
+	var (
+		wg          sync.WaitGroup
+		errCountMtx sync.Mutex
+		slots       = semaphore.NewWeighted(int64(c.compactorCfg.CompactionConcurrency))
+		weight      = int64(c.compactionConcurrencyPerTenant())
+	)
+
+	for _, userID := range usersToCompact {
+		// Wait for enough compaction slots, or until the context has been canceled
+		// (ie. compactor shutdown has been triggered).
+		if err := slots.Acquire(ctx, weight); err != nil {
+			level.Info(c.logger).Log("msg", "interrupting compaction of user blocks", "err", err)
+			wg.Wait()
+			return
 		}
 
-		c.compactionRunSucceededTenants.Inc()
-		level.Info(c.logger).Log("msg", "successfully compacted user blocks", "user", userID)
+		wg.Add(1)
+		go func(userID string) {
+			defer wg.Done()
+			defer slots.Release(weight)
+
+			level.Info(c.logger).Log("msg", "starting compaction of user blocks", "user", userID)
+
+			if err := c.compactUserWithRetries(ctx, userID); err != nil {
+				c.compactionRunFailedTenants.Inc()
+				errCountMtx.Lock()
+				compactionErrorCount++
+				errCountMtx.Unlock()
+				level.Error(c.logger).Log("msg", "failed to compact user blocks", "user", userID, "err", err)
+				return
+			}
+
+			c.compactionRunSucceededTenants.Inc()
+			level.Info(c.logger).Log("msg", "successfully compacted user blocks", "user", userID)
+		}(userID)
 	}
 
+	wg.Wait()
+
 	// Delete local files for unowned tenants, if there are any. This cleans up
 	// leftover local files for tenants that belong to different compactors now,
 	// or have been deleted completely.
@@ -624,6 +714,7 @@ func (c *Compactor) compactUser(ctx context.Context, userID string) error {
 			NewLabelRemoverFilter([]string{cortex_tsdb.IngesterIDExternalLabel}),
 			block.NewConsistencyDelayMetaFilter(ulogger, c.compactorCfg.ConsistencyDelay, reg),
 			ignoreDeletionMarkFilter,
+			newNoCompactMarkFilter(bucket),
 			deduplicateBlocksFilter,
 		},
 		nil,
@@ -647,27 +738,138 @@ func (c *Compactor) compactUser(ctx context.Context, userID string) error {
 		return errors.Wrap(err, "failed to create syncer")
 	}
 
+	var (
+		grouper  compact.Grouper
+		planner  compact.Planner
+		sharding groupSharding = tenantSharding{userID: userID, ownUser: c.ownUser}
+	)
+
+	if c.compactorCfg.TimeShardingEnabled {
+		// The groups are split into jobs by time range, so the groups built by the configured
+		// grouper are never compacted and their metrics are not registered.
+		timeSharding := newTimeShardingGrouper(
+			c.blocksGrouperFactory(ctx, c.compactorCfg, bucket, ulogger, prometheus.NewRegistry(), c.blocksMarkedForDeletion, c.garbageCollectedBlocks),
+			c.blocksPlanner,
+			userID,
+			c.compactorCfg.BlockRanges[len(c.compactorCfg.BlockRanges)-1].Milliseconds(),
+			c.ownJob,
+			bucket,
+			ulogger,
+			reg,
+			c.blocksMarkedForDeletion,
+			c.garbageCollectedBlocks)
+		grouper, planner, sharding = timeSharding, timeSharding, timeSharding
+	} else {
+		grouper = c.blocksGrouperFactory(ctx, c.compactorCfg, bucket, ulogger, reg, c.blocksMarkedForDeletion, c.garbageCollectedBlocks)
+		planner = c.blocksPlanner
+	}
+
+	// All the groups are planned at the beginning of each pass, to track the tenant's backlog.
+	backlogTracker := newBacklogTracker(ctx, grouper, planner, c.compactionBacklogGroups.WithLabelValues(userID))
+
+	// When sharding is enabled, the ownership of the tenant may change while the compaction is
+	// in progress, so it's checked again right before compacting each group.
+	planner = backlogTracker
+	if c.compactorCfg.ShardingEnabled {
+		shardingPlanner := newShardingAwarePlanner(planner, sharding, bucket, c.ringLifecycler.ID, c.compactorCfg.GroupInProgressMarkerTTL, ulogger, c.compactionGroupsSkipped)
+		defer shardingPlanner.close()
+		planner = shardingPlanner
+	}
+
+	// The tenants may be compacted concurrently, so each one has its own working directory.
+	compactDir := path.Join(c.compactorCfg.DataDir, "compact", userID)
+
 	compactor, err := compact.NewBucketCompactor(
 		ulogger,
 		syncer,
-		c.blocksGrouperFactory(ctx, c.compactorCfg, bucket, ulogger, reg, c.blocksMarkedForDeletion, c.garbageCollectedBlocks),
-		c.blocksPlanner,
+		backlogTracker,
+		planner,
 		c.blocksCompactor,
-		path.Join(c.compactorCfg.DataDir, "compact"),
+		compactDir,
 		bucket,
-		c.compactorCfg.CompactionConcurrency,
+		c.compactionConcurrencyPerTenant(),
 	)
 	if err != nil {
 		return errors.Wrap(err, "failed to create bucket compactor")
 	}
 
 	if err := compactor.Compact(ctx); err != nil {
+		// A corrupted block would make the compaction of the tenant fail at each attempt, so it's
+		// quarantined and the next attempt compacts the other blocks.
+		if quarantined := quarantineCorruptedBlocks(ctx, bucket, compactDir, err, ulogger, c.blocksMarkedForNoCompaction); len(quarantined) > 0 {
+			level.Warn(ulogger).Log("msg", "marked corrupted blocks for no compaction", "blocks", fmt.Sprintf("%v", quarantined))
+		}
 		return errors.Wrap(err, "compaction")
 	}
 
 	return nil
 }
 
+// compactionConcurrencyPerTenant returns the max number of concurrent group compactions of a tenant.
+func (c *Compactor) compactionConcurrencyPerTenant() int {
+	if perTenant := c.compactorCfg.CompactionConcurrencyPerTenant; perTenant > 0 && perTenant < c.compactorCfg.CompactionConcurrency {
+		return perTenant
+	}
+	return c.compactorCfg.CompactionConcurrency
+}
+
+// prioritizeUsers sorts the users by the age of their oldest level-1 block, oldest first, so
+// that the tenants lagging behind the most are compacted first. The level-1 blocks are the blocks
+// not compacted yet, whose time range is at most the smallest block range. The users whose bucket
+// index can't be read or having no level-1 blocks keep their order and are compacted last.
+func (c *Compactor) prioritizeUsers(ctx context.Context, users []string) {
+	oldest := make(map[string]int64, len(users))
+	for _, userID := range users {
+		if minTime, ok := c.oldestLevel1BlockMinTime(ctx, userID); ok {
+			oldest[userID] = minTime
+		}
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		iMinTime, iOK := oldest[users[i]]
+		jMinTime, jOK := oldest[users[j]]
+		if iOK != jOK {
+			return iOK
+		}
+		return iOK && iMinTime < jMinTime
+	})
+}
+
+// oldestLevel1BlockMinTime returns the min time of the oldest level-1 block of the user, according
+// to its bucket index, and false if there's none.
+func (c *Compactor) oldestLevel1BlockMinTime(ctx context.Context, userID string) (int64, bool) {
+	idx, err := bucketindex.ReadIndex(ctx, c.bucketClient, userID, c.cfgProvider, c.logger)
+	if err != nil {
+		if !errors.Is(err, bucketindex.ErrIndexNotFound) {
+			level.Warn(c.logger).Log("msg", "unable to read bucket index to prioritize user compaction", "user", userID, "err", err)
+		}
+		return 0, false
+	}
+
+	if len(c.compactorCfg.BlockRanges) == 0 {
+		return 0, false
+	}
+	level1Range := c.compactorCfg.BlockRanges[0].Milliseconds()
+	deleted := make(map[ulid.ULID]struct{}, len(idx.BlockDeletionMarks))
+	for _, mark := range idx.BlockDeletionMarks {
+		deleted[mark.ID] = struct{}{}
+	}
+
+	var (
+		minTime int64
+		found   bool
+	)
+	for _, b := range idx.Blocks {
+		if _, ok := deleted[b.ID]; ok || b.MaxTime-b.MinTime > level1Range {
+			continue
+		}
+		if !found || b.MinTime < minTime {
+			minTime, found = b.MinTime, true
+		}
+	}
+	return minTime, found
+}
+
 func (c *Compactor) discoverUsersWithRetries(ctx context.Context) ([]string, error) {
 	var lastErr error
 
@@ -715,10 +917,36 @@ func (c *Compactor) ownUser(userID string) (bool, error) {
 	// Hash the user ID.
 	hasher := fnv.New32a()
 	_, _ = hasher.Write([]byte(userID))
-	userHash := hasher.Sum32()
+	return c.ownHash(hasher.Sum32())
+}
+
+// ownUserForCompaction returns whether this compactor instance should compact the blocks of the user.
+// When time sharding is enabled, each compactor compacts the jobs it owns of every user.
+func (c *Compactor) ownUserForCompaction(userID string) (bool, error) {
+	if c.compactorCfg.TimeShardingEnabled {
+		return c.allowedTenants.IsAllowed(userID), nil
+	}
+	return c.ownUser(userID)
+}
+
+// ownJob returns whether this compactor instance owns the compaction job of the user for the
+// time range starting at rangeStart.
+func (c *Compactor) ownJob(userID string, rangeStart int64) (bool, error) {
+	if !c.allowedTenants.IsAllowed(userID) {
+		return false, nil
+	}
+
+	// Hash the user ID and the time range.
+	hasher := fnv.New32a()
+	_, _ = hasher.Write([]byte(userID))
+	_, _ = hasher.Write([]byte(strconv.FormatInt(rangeStart, 10)))
+	return c.ownHash(hasher.Sum32())
+}
 
-	// Check whether this compactor instance owns the user.
-	rs, err := c.ring.Get(userHash, RingOp, nil, nil, nil)
+// ownHash returns whether this compactor instance owns the hash in the ring.
+func (c *Compactor) ownHash(hash uint32) (bool, error) {
+	// Check whether this compactor instance owns the hash.
+	rs, err := c.ring.Get(hash, RingOp, nil, nil, nil)
 	if err != nil {
 		return false, err
 	}
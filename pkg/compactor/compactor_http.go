@@ -1,12 +1,24 @@
 package compactor
 
 import (
+	"fmt"
 	"html/template"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
 	"github.com/grafana/dskit/services"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/common/model"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
 
+	"github.com/cortexproject/cortex/pkg/storage/bucket"
+	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 )
 
@@ -51,3 +63,188 @@ func (c *Compactor) RingHandler(w http.ResponseWriter, req *http.Request) {
 
 	c.ring.ServeHTTP(w, req)
 }
+
+// NoCompactBlocksResponse is the response of the NoCompactBlocksHandler.
+type NoCompactBlocksResponse struct {
+	Blocks []*metadata.NoCompactMark `json:"blocks"`
+}
+
+// NoCompactBlocksHandler lists the blocks of the tenant marked for no compaction, for example
+// because they've been found corrupted by the compactor.
+func (c *Compactor) NoCompactBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	_, userBucket, ok := c.tenantBucketForHTTP(w, r)
+	if !ok {
+		return
+	}
+
+	marks, err := listNoCompactMarks(r.Context(), userBucket)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to list no-compact marks", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	util.WriteJSONResponse(w, NoCompactBlocksResponse{Blocks: marks})
+}
+
+// DeleteNoCompactBlocksHandler deletes the no-compact mark of a block of the tenant, or of all its blocks
+// if no block is specified, so that the blocks are compacted again.
+func (c *Compactor) DeleteNoCompactBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, userBucket, ok := c.tenantBucketForHTTP(w, r)
+	if !ok {
+		return
+	}
+
+	var blockIDs []ulid.ULID
+	if id, ok := mux.Vars(r)["block"]; ok {
+		blockID, err := ulid.Parse(id)
+		if err != nil {
+			http.Error(w, "invalid block ID", http.StatusBadRequest)
+			return
+		}
+
+		exists, err := userBucket.Exists(r.Context(), bucketindex.NoCompactMarkFilepath(blockID))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "the block is not marked for no compaction", http.StatusNotFound)
+			return
+		}
+		blockIDs = append(blockIDs, blockID)
+	} else {
+		marks, err := listNoCompactMarks(r.Context(), userBucket)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, mark := range marks {
+			blockIDs = append(blockIDs, mark.ID)
+		}
+	}
+
+	for _, blockID := range blockIDs {
+		if err := deleteNoCompactMark(r.Context(), userBucket, blockID); err != nil {
+			level.Error(c.logger).Log("msg", "failed to delete no-compact mark", "block", blockID, "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		level.Info(c.logger).Log("msg", "deleted no-compact mark", "user", userID, "block", blockID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CleanupPlanHandler returns the blocks of the tenant which the next blocks cleanup would delete or
+// mark for deletion, without modifying the bucket. The tenant's retention period can be overridden
+// with the retention parameter, to preview the effect of changing it.
+func (c *Compactor) CleanupPlanHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.FormValue("tenant")
+	if userID == "" {
+		http.Error(w, "missing tenant parameter", http.StatusBadRequest)
+		return
+	}
+
+	retention := c.cfgProvider.CompactorBlocksRetentionPeriod(userID)
+	if value := r.FormValue("retention"); value != "" {
+		parsed, err := model.ParseDuration(value)
+		if err != nil {
+			http.Error(w, "invalid retention parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		retention = time.Duration(parsed)
+	}
+
+	// The blocks cleaner is created when the compactor starts.
+	if c.State() != services.Running {
+		http.Error(w, "Compactor is not running yet.", http.StatusServiceUnavailable)
+		return
+	}
+
+	plan, err := c.blocksCleaner.planUserCleanup(r.Context(), userID, retention)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "failed to plan blocks cleanup", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	util.WriteJSONResponse(w, plan)
+}
+
+// ForceDeleteTenantHandler hard-deletes the blocks, markers and bucket index of a tenant already marked for
+// deletion, without waiting for the deletion delays, and streams the progress as plain text lines. The
+// deletion must be confirmed setting the confirm parameter to the tenant ID.
+func (c *Compactor) ForceDeleteTenantHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["tenant"]
+	if userID == "" {
+		http.Error(w, "missing tenant", http.StatusBadRequest)
+		return
+	}
+
+	// A tenant can only force delete its own blocks.
+	orgID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if orgID != userID {
+		http.Error(w, "the tenant doesn't match the authenticated tenant", http.StatusForbidden)
+		return
+	}
+
+	if r.FormValue("confirm") != userID {
+		http.Error(w, "the confirm parameter must be set to the tenant ID to confirm the deletion", http.StatusBadRequest)
+		return
+	}
+
+	// The bucket client and the blocks cleaner are created when the compactor starts.
+	if c.State() != services.Running {
+		http.Error(w, "Compactor is not running yet.", http.StatusServiceUnavailable)
+		return
+	}
+
+	marked, err := cortex_tsdb.TenantDeletionMarkExists(r.Context(), c.bucketClient, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !marked {
+		http.Error(w, "the tenant is not marked for deletion", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	progress := func(msg string) {
+		_, _ = fmt.Fprintln(w, msg)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if err := c.blocksCleaner.forceDeleteUser(r.Context(), userID, progress); err != nil {
+		level.Error(c.logger).Log("msg", "failed to force delete tenant", "user", userID, "err", err)
+		progress("failed: " + err.Error())
+		return
+	}
+	progress("done")
+}
+
+func (c *Compactor) tenantBucketForHTTP(w http.ResponseWriter, r *http.Request) (string, objstore.Bucket, bool) {
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", nil, false
+	}
+
+	// The bucket client is created when the compactor starts.
+	if c.State() != services.Running {
+		http.Error(w, "Compactor is not running yet.", http.StatusServiceUnavailable)
+		return "", nil, false
+	}
+
+	return userID, bucket.NewUserBucketClient(userID, c.bucketClient, c.cfgProvider), true
+}
@@ -8,16 +8,20 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
 	"github.com/grafana/dskit/services"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
@@ -31,12 +35,14 @@ import (
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact"
 	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/weaveworks/common/user"
 	"gopkg.in/yaml.v2"
 
 	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/ring/kv/consul"
 	"github.com/cortexproject/cortex/pkg/storage/bucket"
 	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
 	"github.com/cortexproject/cortex/pkg/util/concurrency"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	cortex_testutil "github.com/cortexproject/cortex/pkg/util/test"
@@ -88,6 +94,7 @@ func TestConfig_ShouldSupportCliFlags(t *testing.T) {
 func TestConfig_Validate(t *testing.T) {
 	tests := map[string]struct {
 		setup    func(cfg *Config)
+		limits   validation.Limits
 		expected string
 	}{
 		"should pass with the default config": {
@@ -106,6 +113,40 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expected: errors.Errorf(errInvalidBlockRanges, 30*time.Hour, 24*time.Hour).Error(),
 		},
+		"should fail with a negative compaction concurrency per tenant": {
+			setup: func(cfg *Config) {
+				cfg.CompactionConcurrencyPerTenant = -1
+			},
+			expected: errInvalidCompactionConcurrencyPerTenant.Error(),
+		},
+		"should fail with time sharding enabled and sharding disabled": {
+			setup: func(cfg *Config) {
+				cfg.TimeShardingEnabled = true
+			},
+			expected: errInvalidTimeSharding.Error(),
+		},
+		"should pass with time sharding and sharding enabled": {
+			setup: func(cfg *Config) {
+				cfg.ShardingEnabled = true
+				cfg.TimeShardingEnabled = true
+			},
+			expected: "",
+		},
+		"should pass with ingester TSDB block ranges dividing the smallest block range period": {
+			setup:    func(cfg *Config) {},
+			limits:   validation.Limits{TSDBBlockRanges: cortex_tsdb.DurationList{30 * time.Minute, time.Hour}},
+			expected: "",
+		},
+		"should pass with ingester TSDB block ranges matching a block range period": {
+			setup:    func(cfg *Config) {},
+			limits:   validation.Limits{TSDBBlockRanges: cortex_tsdb.DurationList{12 * time.Hour}},
+			expected: "",
+		},
+		"should fail with ingester TSDB block ranges which can't be compacted": {
+			setup:    func(cfg *Config) {},
+			limits:   validation.Limits{TSDBBlockRanges: cortex_tsdb.DurationList{6 * time.Hour}},
+			expected: "invalid ingester TSDB block ranges limit: TSDB block range period 6h0m0s can't be compacted with the compactor block ranges 2h0m0s,12h0m0s,24h0m0s, it should be a divisor of 2h0m0s or one of the compactor block ranges",
+		},
 	}
 
 	for testName, testData := range tests {
@@ -114,7 +155,7 @@ func TestConfig_Validate(t *testing.T) {
 			flagext.DefaultValues(cfg)
 			testData.setup(cfg)
 
-			if actualErr := cfg.Validate(); testData.expected != "" {
+			if actualErr := cfg.Validate(testData.limits); testData.expected != "" {
 				assert.EqualError(t, actualErr, testData.expected)
 			} else {
 				assert.NoError(t, actualErr)
@@ -938,6 +979,449 @@ func TestCompactor_ShouldCompactOnlyUsersOwnedByTheInstanceOnShardingEnabledAndM
 	}
 }
 
+func TestCompactor_ShouldCompactOnlyTimeRangesOwnedByTheInstanceOnTimeShardingEnabledAndMultipleInstancesRunning(t *testing.T) {
+	t.Parallel()
+
+	const (
+		numDays    = 16
+		blockRange = int64(2 * time.Hour / time.Millisecond)
+		jobRange   = int64(24 * time.Hour / time.Millisecond)
+	)
+
+	// A single user with two overlapping blocks per day, to vertically compact.
+	bucketClient := objstore.NewInMemBucket()
+	externalLabels := map[string]string{cortex_tsdb.TenantIDExternalLabel: "user-1"}
+	blocksByRange := map[int64][]ulid.ULID{}
+	for day := int64(0); day < numDays; day++ {
+		for i := 0; i < 2; i++ {
+			blocksByRange[day*jobRange] = append(blocksByRange[day*jobRange], createTSDBBlock(t, bucketClient, "user-1", day*jobRange, day*jobRange+blockRange, externalLabels))
+		}
+	}
+
+	// Create a shared KV Store
+	kvstore := consul.NewInMemoryClient(ring.GetCodec())
+
+	// Create two compactors
+	var compactors []*Compactor
+	var logs []*concurrency.SyncBuffer
+
+	for i := 1; i <= 2; i++ {
+		cfg := prepareConfig()
+		cfg.ShardingEnabled = true
+		cfg.TimeShardingEnabled = true
+		cfg.ShardingRing.InstanceID = fmt.Sprintf("compactor-%d", i)
+		cfg.ShardingRing.InstanceAddr = fmt.Sprintf("127.0.0.%d", i)
+		cfg.ShardingRing.WaitStabilityMinDuration = 3 * time.Second
+		cfg.ShardingRing.WaitStabilityMaxDuration = 10 * time.Second
+		cfg.ShardingRing.KVStore.Mock = kvstore
+
+		c, _, _, l, _ := prepare(t, cfg, bucketClient)
+		c.blocksCompactorFactory = DefaultBlocksCompactorFactory
+		defer services.StopAndAwaitTerminated(context.Background(), c) //nolint:errcheck
+
+		compactors = append(compactors, c)
+		logs = append(logs, l)
+	}
+
+	// Start all compactors concurrently, so that they join the ring before the first compaction run.
+	for _, c := range compactors {
+		require.NoError(t, c.StartAsync(context.Background()))
+	}
+	for _, c := range compactors {
+		require.NoError(t, c.AwaitRunning(context.Background()))
+	}
+
+	// Wait until a run has been completed on each compactor
+	for _, c := range compactors {
+		cortex_testutil.Poll(t, 20*time.Second, 1.0, func() interface{} {
+			return prom_testutil.ToFloat64(c.compactionRunsCompleted)
+		})
+	}
+
+	// Ensure that each time range has been compacted only by the instance owning it.
+	compactedRanges := make([]int, len(compactors))
+
+	for rangeStart, blockIDs := range blocksByRange {
+		for _, blockID := range blockIDs {
+			exists, err := bucketClient.Exists(context.Background(), path.Join("user-1", blockID.String(), metadata.DeletionMarkFilename))
+			require.NoError(t, err)
+			assert.True(t, exists, blockID.String())
+		}
+
+		jobKey := fmt.Sprintf("-%d-%d ", rangeStart, rangeStart+jobRange)
+		owners := 0
+
+		for i, c := range compactors {
+			owned, err := c.ownJob("user-1", rangeStart)
+			require.NoError(t, err)
+
+			compacted := false
+			for _, line := range strings.Split(logs[i].String(), "\n") {
+				if strings.Contains(line, jobKey) && strings.Contains(line, `msg="compacted blocks"`) {
+					compacted = true
+				}
+			}
+			assert.Equal(t, owned, compacted, "compactor: %d range: %d", i, rangeStart)
+
+			if owned {
+				owners++
+				compactedRanges[i]++
+			}
+		}
+		assert.Equal(t, 1, owners, "range: %d", rangeStart)
+	}
+
+	// The time ranges have been split between the compactors.
+	for i := range compactors {
+		assert.Greater(t, compactedRanges[i], 0, "compactor: %d", i)
+	}
+}
+
+func TestCompactor_ShouldCompactUsersConcurrentlyByPriority(t *testing.T) {
+	t.Parallel()
+
+	const blockRange = int64(2 * time.Hour / time.Millisecond)
+
+	// The user-1 has a large backlog of old blocks (3 groups to compact), while
+	// the user-2 has a small backlog of recent blocks (1 group to compact).
+	bucketClient := objstore.NewInMemBucket()
+	for _, shard := range []string{"1", "2", "3"} {
+		createTSDBBlock(t, bucketClient, "user-1", 0, blockRange, map[string]string{"shard": shard})
+		createTSDBBlock(t, bucketClient, "user-1", blockRange, 2*blockRange, map[string]string{"shard": shard})
+	}
+	createTSDBBlock(t, bucketClient, "user-2", 5*blockRange, 6*blockRange, nil)
+	createTSDBBlock(t, bucketClient, "user-2", 6*blockRange, 7*blockRange, nil)
+
+	cfg := prepareConfig()
+	cfg.CompactionConcurrency = 2
+	cfg.CompactionConcurrencyPerTenant = 1
+
+	c, tsdbCompactor, _, _, registry := prepare(t, cfg, bucketClient)
+
+	// Plan the compaction of each group once.
+	planned := sync.Map{}
+	planner := plannerFunc(func(_ context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+		if _, loaded := planned.LoadOrStore(metasByMinTime[0].ULID, struct{}{}); loaded {
+			return nil, nil
+		}
+		return metasByMinTime, nil
+	})
+	c.blocksCompactorFactory = func(ctx context.Context, cfg Config, logger log.Logger, reg prometheus.Registerer) (compact.Compactor, compact.Planner, error) {
+		return tsdbCompactor, planner, nil
+	}
+
+	var (
+		compactionsMtx   sync.Mutex
+		compactions      []string
+		inflight         = map[string]int{}
+		maxInflight      = map[string]int{}
+		backlogs         = map[string][]float64{}
+		user2Compacted   = make(chan struct{})
+		user2CompactOnce sync.Once
+	)
+
+	// Each group compaction of the user-1 waits until the user-2 has been compacted (or a timeout),
+	// so the user-2 is compacted in between the user-1 groups only if the users are compacted concurrently.
+	tsdbCompactor.On("Compact", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		userID := filepath.Base(filepath.Dir(args.Get(0).(string)))
+
+		compactionsMtx.Lock()
+		compactions = append(compactions, userID)
+		inflight[userID]++
+		if inflight[userID] > maxInflight[userID] {
+			maxInflight[userID] = inflight[userID]
+		}
+		backlogs[userID] = append(backlogs[userID], prom_testutil.ToFloat64(c.compactionBacklogGroups.WithLabelValues(userID)))
+		compactionsMtx.Unlock()
+
+		if userID == "user-2" {
+			user2CompactOnce.Do(func() { close(user2Compacted) })
+		} else {
+			select {
+			case <-user2Compacted:
+			case <-time.After(5 * time.Second):
+			}
+		}
+
+		compactionsMtx.Lock()
+		inflight[userID]--
+		compactionsMtx.Unlock()
+	}).Return(ulid.ULID{}, nil)
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), c))
+	})
+
+	// Wait until a run has completed.
+	cortex_testutil.Poll(t, 20*time.Second, 1.0, func() interface{} {
+		return prom_testutil.ToFloat64(c.compactionRunsCompleted)
+	})
+
+	compactionsMtx.Lock()
+	defer compactionsMtx.Unlock()
+
+	// The user-2 has been compacted while the user-1 still had groups to compact.
+	require.Len(t, compactions, 4)
+	assert.Contains(t, compactions[:3], "user-2")
+	assert.Equal(t, "user-1", compactions[3])
+
+	// The groups of a user have been compacted one at a time.
+	assert.Equal(t, map[string]int{"user-1": 1, "user-2": 1}, maxInflight)
+
+	// The backlog has been tracked for each pass, and is empty once compacted.
+	assert.Equal(t, map[string][]float64{"user-1": {3, 3, 3}, "user-2": {1}}, backlogs)
+	assert.NoError(t, prom_testutil.GatherAndCompare(registry, strings.NewReader(`
+		# HELP cortex_compactor_tenant_compaction_backlog_groups Number of compaction groups of the tenant with blocks to compact, as planned at the beginning of the latest compaction pass.
+		# TYPE cortex_compactor_tenant_compaction_backlog_groups gauge
+		cortex_compactor_tenant_compaction_backlog_groups{user="user-1"} 0
+		cortex_compactor_tenant_compaction_backlog_groups{user="user-2"} 0
+	`), "cortex_compactor_tenant_compaction_backlog_groups"))
+
+	// The user with the oldest level-1 block is prioritized, and the users without bucket index come last.
+	users := []string{"user-3", "user-2", "user-1"}
+	c.prioritizeUsers(context.Background(), users)
+	assert.Equal(t, []string{"user-1", "user-2", "user-3"}, users)
+}
+
+func TestCompactor_ShouldQuarantineCorruptedBlocksAndCompactTheOthers(t *testing.T) {
+	t.Parallel()
+
+	const blockRange = int64(2 * time.Hour / time.Millisecond)
+
+	tests := map[string]struct {
+		corrupt func(t *testing.T, bkt objstore.Bucket, blockID ulid.ULID)
+	}{
+		"corrupted index": {
+			corrupt: func(t *testing.T, bkt objstore.Bucket, blockID ulid.ULID) {
+				require.NoError(t, bkt.Upload(context.Background(), path.Join("user-1", blockID.String(), "index"), strings.NewReader("corrupted")))
+			},
+		},
+		"missing chunks file": {
+			corrupt: func(t *testing.T, bkt objstore.Bucket, blockID ulid.ULID) {
+				require.NoError(t, bkt.Delete(context.Background(), path.Join("user-1", blockID.String(), "chunks", "000001")))
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			// Three overlapping blocks to vertically compact, one of them corrupted.
+			bucketClient := objstore.NewInMemBucket()
+			externalLabels := map[string]string{cortex_tsdb.TenantIDExternalLabel: "user-1"}
+			corrupted := createTSDBBlock(t, bucketClient, "user-1", 0, blockRange, externalLabels)
+			healthy1 := createTSDBBlock(t, bucketClient, "user-1", 0, blockRange, externalLabels)
+			healthy2 := createTSDBBlock(t, bucketClient, "user-1", 0, blockRange, externalLabels)
+			testData.corrupt(t, bucketClient, corrupted)
+
+			c, _, _, logs, registry := prepare(t, prepareConfig(), bucketClient)
+			c.blocksCompactorFactory = DefaultBlocksCompactorFactory
+
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+			t.Cleanup(func() {
+				require.NoError(t, services.StopAndAwaitTerminated(context.Background(), c))
+			})
+
+			// Wait until a run has completed.
+			cortex_testutil.Poll(t, 20*time.Second, 1.0, func() interface{} {
+				return prom_testutil.ToFloat64(c.compactionRunsCompleted)
+			})
+
+			// The corrupted block has been marked for no compaction, in both the block and global markers locations.
+			for _, p := range []string{
+				path.Join("user-1", corrupted.String(), metadata.NoCompactMarkFilename),
+				path.Join("user-1", bucketindex.NoCompactMarkFilepath(corrupted)),
+			} {
+				exists, err := bucketClient.Exists(context.Background(), p)
+				require.NoError(t, err)
+				assert.True(t, exists, p)
+			}
+			assert.Contains(t, logs.String(), `msg="found corrupted block, marking it for no compaction"`)
+
+			// The other blocks have been compacted.
+			for _, blockID := range []ulid.ULID{healthy1, healthy2} {
+				exists, err := bucketClient.Exists(context.Background(), path.Join("user-1", blockID.String(), metadata.DeletionMarkFilename))
+				require.NoError(t, err)
+				assert.True(t, exists, blockID.String())
+			}
+
+			assert.NoError(t, prom_testutil.GatherAndCompare(registry, strings.NewReader(`
+				# HELP cortex_compactor_blocks_marked_for_no_compaction_total Total number of blocks marked for no compaction by the compactor, because they're corrupted.
+				# TYPE cortex_compactor_blocks_marked_for_no_compaction_total counter
+				cortex_compactor_blocks_marked_for_no_compaction_total 1
+
+				# HELP cortex_compactor_runs_completed_total Total number of compaction runs successfully completed.
+				# TYPE cortex_compactor_runs_completed_total counter
+				cortex_compactor_runs_completed_total 1
+
+				# HELP cortex_compactor_runs_failed_total Total number of compaction runs failed.
+				# TYPE cortex_compactor_runs_failed_total counter
+				cortex_compactor_runs_failed_total 0
+			`), "cortex_compactor_blocks_marked_for_no_compaction_total", "cortex_compactor_runs_completed_total", "cortex_compactor_runs_failed_total"))
+
+			// The no-compact marks can be listed and deleted via the HTTP API.
+			ctx := user.InjectOrgID(context.Background(), "user-1")
+
+			resp := httptest.NewRecorder()
+			c.NoCompactBlocksHandler(resp, httptest.NewRequest("GET", "/compactor/no-compact-blocks", nil).WithContext(ctx))
+			require.Equal(t, http.StatusOK, resp.Code)
+
+			listed := NoCompactBlocksResponse{}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &listed))
+			require.Len(t, listed.Blocks, 1)
+			assert.Equal(t, corrupted, listed.Blocks[0].ID)
+			assert.Equal(t, corruptedBlockNoCompactReason, listed.Blocks[0].Reason)
+			assert.NotZero(t, listed.Blocks[0].NoCompactTime)
+			assert.NotEmpty(t, listed.Blocks[0].Details)
+
+			resp = httptest.NewRecorder()
+			req := mux.SetURLVars(httptest.NewRequest("DELETE", "/compactor/no-compact-blocks/"+corrupted.String(), nil).WithContext(ctx), map[string]string{"block": corrupted.String()})
+			c.DeleteNoCompactBlocksHandler(resp, req)
+			require.Equal(t, http.StatusNoContent, resp.Code)
+
+			for _, p := range []string{
+				path.Join("user-1", corrupted.String(), metadata.NoCompactMarkFilename),
+				path.Join("user-1", bucketindex.NoCompactMarkFilepath(corrupted)),
+			} {
+				exists, err := bucketClient.Exists(context.Background(), p)
+				require.NoError(t, err)
+				assert.False(t, exists, p)
+			}
+
+			// Deleting a mark which doesn't exist fails.
+			resp = httptest.NewRecorder()
+			c.DeleteNoCompactBlocksHandler(resp, req)
+			require.Equal(t, http.StatusNotFound, resp.Code)
+		})
+	}
+}
+
+func TestCompactor_CleanupPlanHandler(t *testing.T) {
+	t.Parallel()
+
+	ts := func(hours int) int64 {
+		return time.Now().Add(time.Duration(hours)*time.Hour).Unix() * 1000
+	}
+
+	bucketClient := objstore.NewInMemBucket()
+	oldBlock := createTSDBBlock(t, bucketClient, "user-1", ts(-10), ts(-8), nil)
+	createTSDBBlock(t, bucketClient, "user-1", ts(-4), ts(-2), nil)
+
+	c, _, tsdbPlanner, _, _ := prepare(t, prepareConfig(), bucketClient)
+	tsdbPlanner.On("Plan", mock.Anything, mock.Anything).Return([]*metadata.Meta{}, nil)
+
+	// The parameters are validated.
+	for _, target := range []string{"/compactor/cleanup_plan", "/compactor/cleanup_plan?tenant=user-1&retention=invalid"} {
+		resp := httptest.NewRecorder()
+		c.CleanupPlanHandler(resp, httptest.NewRequest("GET", target, nil))
+		assert.Equal(t, http.StatusBadRequest, resp.Code, target)
+	}
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), c))
+	})
+
+	// The tenant has no retention period by default.
+	resp := httptest.NewRecorder()
+	c.CleanupPlanHandler(resp, httptest.NewRequest("GET", "/compactor/cleanup_plan?tenant=user-1", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	plan := CleanupPlan{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &plan))
+	assert.Equal(t, "user-1", plan.Tenant)
+	assert.Equal(t, "0s", plan.RetentionPeriod)
+	assert.Empty(t, plan.Blocks)
+
+	// The retention period can be overridden.
+	resp = httptest.NewRecorder()
+	c.CleanupPlanHandler(resp, httptest.NewRequest("GET", "/compactor/cleanup_plan?tenant=user-1&retention=6h", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	plan = CleanupPlan{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &plan))
+	assert.Equal(t, "6h0m0s", plan.RetentionPeriod)
+	require.Len(t, plan.Blocks, 1)
+	assert.Equal(t, oldBlock, plan.Blocks[0].ID)
+	assert.Equal(t, cleanupRuleRetention, plan.Blocks[0].Rule)
+	assert.Equal(t, cleanupActionMarkForDeletion, plan.Blocks[0].Action)
+
+	// The block has not been marked for deletion.
+	exists, err := bucketClient.Exists(context.Background(), path.Join("user-1", oldBlock.String(), metadata.DeletionMarkFilename))
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestCompactor_ForceDeleteTenantHandler(t *testing.T) {
+	t.Parallel()
+
+	bucketClient := objstore.NewInMemBucket()
+	block1 := createTSDBBlock(t, bucketClient, "user-1", 10, 20, nil)
+	block2 := createTSDBBlock(t, bucketClient, "user-1", 20, 30, nil)
+	createTSDBBlock(t, bucketClient, "user-2", 10, 20, nil)
+
+	c, _, tsdbPlanner, _, _ := prepare(t, prepareConfig(), bucketClient)
+	tsdbPlanner.On("Plan", mock.Anything, mock.Anything).Return([]*metadata.Meta{}, nil)
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), c))
+	})
+
+	// The bucket index has been written by the blocks cleanup at startup.
+	exists, err := bucketClient.Exists(context.Background(), path.Join("user-1", bucketindex.IndexCompressedFilename))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// Mark the tenant for deletion, once the compactor has run.
+	require.NoError(t, cortex_tsdb.WriteTenantDeletionMark(context.Background(), bucketClient, "user-1", nil, cortex_tsdb.NewTenantDeletionMark(time.Now())))
+
+	forceDeleteAs := func(orgID, userID, confirm string) *httptest.ResponseRecorder {
+		target := fmt.Sprintf("/compactor/tenant/%s/force_delete?confirm=%s", userID, confirm)
+		req := httptest.NewRequest("POST", target, nil)
+		req = mux.SetURLVars(req.WithContext(user.InjectOrgID(req.Context(), orgID)), map[string]string{"tenant": userID})
+		resp := httptest.NewRecorder()
+		c.ForceDeleteTenantHandler(resp, req)
+		return resp
+	}
+	forceDelete := func(userID, confirm string) *httptest.ResponseRecorder {
+		return forceDeleteAs(userID, userID, confirm)
+	}
+
+	// A tenant can't force delete another tenant.
+	assert.Equal(t, http.StatusForbidden, forceDeleteAs("user-2", "user-1", "user-1").Code)
+
+	// The deletion must be confirmed.
+	assert.Equal(t, http.StatusBadRequest, forceDelete("user-1", "").Code)
+	assert.Equal(t, http.StatusBadRequest, forceDelete("user-1", "user-2").Code)
+
+	// The tenant must be marked for deletion.
+	assert.Equal(t, http.StatusConflict, forceDelete("user-2", "user-2").Code)
+
+	resp := forceDelete("user-1", "user-1")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "deleted bucket index\n")
+	assert.Contains(t, resp.Body.String(), fmt.Sprintf("deleted block %s\n", block1.String()))
+	assert.Contains(t, resp.Body.String(), fmt.Sprintf("deleted block %s\n", block2.String()))
+	assert.True(t, strings.HasSuffix(resp.Body.String(), "done\n"), resp.Body.String())
+
+	// Nothing is left in the bucket for the deleted tenant, while the other tenant is untouched.
+	var remaining []string
+	require.NoError(t, bucketClient.Iter(context.Background(), "user-1/", func(name string) error {
+		remaining = append(remaining, name)
+		return nil
+	}))
+	assert.Empty(t, remaining)
+
+	exists, err = bucketClient.Exists(context.Background(), path.Join("user-2", bucketindex.IndexCompressedFilename))
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
 func createTSDBBlock(t *testing.T, bkt objstore.Bucket, userID string, minT, maxT int64, externalLabels map[string]string) ulid.ULID {
 	// Create a temporary dir for TSDB.
 	tempDir, err := ioutil.TempDir(os.TempDir(), "tsdb")
@@ -1151,6 +1635,12 @@ func (m *tsdbCompactorMock) Compact(dest string, dirs []string, open []*tsdb.Blo
 	return args.Get(0).(ulid.ULID), args.Error(1)
 }
 
+type plannerFunc func(ctx context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error)
+
+func (f plannerFunc) Plan(ctx context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+	return f(ctx, metasByMinTime)
+}
+
 type tsdbPlannerMock struct {
 	mock.Mock
 }
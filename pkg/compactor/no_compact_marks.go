@@ -0,0 +1,229 @@
+package compactor
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
+)
+
+const (
+	// corruptedBlockNoCompactReason is the reason of the no-compact marks of the blocks
+	// quarantined by the compactor because they're corrupted.
+	corruptedBlockNoCompactReason metadata.NoCompactReason = "block-corrupted"
+)
+
+var blockIDRegexp = regexp.MustCompile(`[0-7][0-9A-HJKMNP-TV-Z]{25}`)
+
+// noCompactMarkFilter filters out the blocks with a no-compact mark in the global markers location.
+type noCompactMarkFilter struct {
+	bkt objstore.InstrumentedBucketReader
+}
+
+func newNoCompactMarkFilter(bkt objstore.InstrumentedBucketReader) *noCompactMarkFilter {
+	return &noCompactMarkFilter{bkt: bkt}
+}
+
+// Filter implements block.MetadataFilter.
+func (f *noCompactMarkFilter) Filter(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced *extprom.TxGaugeVec) error {
+	return f.bkt.ReaderWithExpectedErrs(f.bkt.IsObjNotFoundErr).Iter(ctx, bucketindex.MarkersPathname+"/", func(name string) error {
+		blockID, ok := bucketindex.IsNoCompactMarkFilename(path.Base(name))
+		if !ok {
+			return nil
+		}
+
+		if _, ok := metas[blockID]; ok {
+			delete(metas, blockID)
+			synced.WithLabelValues(block.MarkedForNoCompactionMeta).Inc()
+		}
+		return nil
+	})
+}
+
+// listNoCompactMarks returns the no-compact marks of the tenant, read from the global markers location.
+func listNoCompactMarks(ctx context.Context, bkt objstore.Bucket) ([]*metadata.NoCompactMark, error) {
+	var blockIDs []ulid.ULID
+	err := bkt.Iter(ctx, bucketindex.MarkersPathname+"/", func(name string) error {
+		if blockID, ok := bucketindex.IsNoCompactMarkFilename(path.Base(name)); ok {
+			blockIDs = append(blockIDs, blockID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list no-compact marks")
+	}
+
+	marks := make([]*metadata.NoCompactMark, 0, len(blockIDs))
+	for _, blockID := range blockIDs {
+		reader, err := bkt.Get(ctx, bucketindex.NoCompactMarkFilepath(blockID))
+		if bkt.IsObjNotFoundErr(err) {
+			// The mark has been deleted in the meanwhile.
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "read no-compact mark of block %s", blockID)
+		}
+
+		mark := &metadata.NoCompactMark{}
+		content, err := ioutil.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "read no-compact mark of block %s", blockID)
+		}
+		if err := json.Unmarshal(content, mark); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal no-compact mark of block %s", blockID)
+		}
+		marks = append(marks, mark)
+	}
+
+	return marks, nil
+}
+
+// deleteNoCompactMark deletes the no-compact mark of a block, both from the block and global markers locations.
+func deleteNoCompactMark(ctx context.Context, bkt objstore.Bucket, blockID ulid.ULID) error {
+	err := bkt.Delete(ctx, path.Join(blockID.String(), metadata.NoCompactMarkFilename))
+	if err != nil && !bkt.IsObjNotFoundErr(err) {
+		return err
+	}
+
+	// The global mark is deleted explicitly too, in case the block mark was already missing.
+	err = bkt.Delete(ctx, bucketindex.NoCompactMarkFilepath(blockID))
+	if err != nil && !bkt.IsObjNotFoundErr(err) {
+		return err
+	}
+	return nil
+}
+
+// quarantineCorruptedBlocks looks for corrupted blocks among the blocks the compaction of the tenant
+// failed for, and marks them for no compaction, so that they're skipped by the next compactions. The
+// blocks are looked up by the IDs found in the compaction error, and verified from their copy in the
+// local compaction directory. Returns the IDs of the quarantined blocks.
+func quarantineCorruptedBlocks(ctx context.Context, bkt objstore.Bucket, compactDir string, compactionErr error, logger log.Logger, markedForNoCompaction prometheus.Counter) []ulid.ULID {
+	// The blocks may have not been fully downloaded on retriable errors.
+	if compact.IsRetryError(compactionErr) {
+		return nil
+	}
+
+	var quarantined []ulid.ULID
+
+	for _, match := range uniqueStrings(blockIDRegexp.FindAllString(compactionErr.Error(), -1)) {
+		blockID, err := ulid.Parse(match)
+		if err != nil {
+			continue
+		}
+
+		// The blocks are downloaded in a directory per group.
+		dirs, err := filepath.Glob(filepath.Join(compactDir, "*", blockID.String()))
+		if err != nil || len(dirs) == 0 {
+			continue
+		}
+
+		verifyErr := verifyBlock(logger, dirs[0])
+		if verifyErr == nil {
+			continue
+		}
+
+		level.Warn(logger).Log("msg", "found corrupted block, marking it for no compaction", "block", blockID, "err", verifyErr)
+		if err := block.MarkForNoCompact(ctx, logger, bkt, blockID, corruptedBlockNoCompactReason, verifyErr.Error(), markedForNoCompaction); err != nil {
+			level.Error(logger).Log("msg", "failed to mark corrupted block for no compaction", "block", blockID, "err", err)
+			continue
+		}
+
+		// The local copy of the block is not needed anymore.
+		if err := os.RemoveAll(dirs[0]); err != nil {
+			level.Warn(logger).Log("msg", "failed to remove local copy of corrupted block", "dir", dirs[0], "err", err)
+		}
+
+		quarantined = append(quarantined, blockID)
+	}
+
+	return quarantined
+}
+
+// verifyBlock returns an error if the block in the input directory can't be compacted, because
+// its index is corrupted or any of its chunks can't be read.
+func verifyBlock(logger log.Logger, dir string) error {
+	meta, err := metadata.ReadFromDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "read meta")
+	}
+
+	stats, err := block.GatherIndexHealthStats(logger, filepath.Join(dir, block.IndexFilename), meta.MinTime, meta.MaxTime)
+	if err != nil {
+		return errors.Wrap(err, "read index")
+	}
+	if err := stats.CriticalErr(); err != nil {
+		return errors.Wrap(err, "unhealthy index")
+	}
+
+	b, err := tsdb.OpenBlock(logger, dir, nil)
+	if err != nil {
+		return errors.Wrap(err, "open block")
+	}
+	defer b.Close() //nolint:errcheck
+
+	indexr, err := b.Index()
+	if err != nil {
+		return errors.Wrap(err, "open index")
+	}
+	defer indexr.Close() //nolint:errcheck
+
+	chunkr, err := b.Chunks()
+	if err != nil {
+		return errors.Wrap(err, "open chunks")
+	}
+	defer chunkr.Close() //nolint:errcheck
+
+	postings, err := indexr.Postings(index.AllPostingsKey())
+	if err != nil {
+		return errors.Wrap(err, "read postings")
+	}
+
+	var (
+		lset labels.Labels
+		chks []chunks.Meta
+	)
+	for postings.Next() {
+		if err := indexr.Series(postings.At(), &lset, &chks); err != nil {
+			return errors.Wrap(err, "read series")
+		}
+		for _, chk := range chks {
+			if _, err := chunkr.Chunk(chk.Ref); err != nil {
+				return errors.Wrapf(err, "read chunk of series %s", lset.String())
+			}
+		}
+	}
+	return errors.Wrap(postings.Err(), "iterate postings")
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	out := values[:0]
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,218 @@
+package compactor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+const (
+	groupSkippedReasonNotOwned    = "tenant-not-owned"
+	groupSkippedReasonJobNotOwned = "job-not-owned"
+	groupSkippedReasonInProgress  = "in-progress"
+)
+
+// groupSharding shards the compaction groups of a tenant across the compactor replicas.
+type groupSharding interface {
+	// groupKey returns the key of the compaction group of the blocks.
+	groupKey(metasByMinTime []*metadata.Meta) string
+
+	// ownGroup returns whether the compaction group of the blocks is owned by this compactor.
+	ownGroup(metasByMinTime []*metadata.Meta) (bool, error)
+
+	// notOwnedReason returns the reason tracked for the groups skipped because not owned.
+	notOwnedReason() string
+}
+
+// tenantSharding is the groupSharding of the tenants compacted by a single compactor replica,
+// which owns all their compaction groups.
+type tenantSharding struct {
+	userID  string
+	ownUser func(userID string) (bool, error)
+}
+
+func (s tenantSharding) groupKey(metasByMinTime []*metadata.Meta) string {
+	return compact.DefaultGroupKey(metasByMinTime[0].Thanos)
+}
+
+func (s tenantSharding) ownGroup(_ []*metadata.Meta) (bool, error) {
+	return s.ownUser(s.userID)
+}
+
+func (s tenantSharding) notOwnedReason() string {
+	return groupSkippedReasonNotOwned
+}
+
+// shardingAwarePlanner wraps a compact.Planner to avoid compacting the same group of blocks from
+// multiple compactor replicas concurrently, which may happen while the compactors ring is changing
+// (eg. during a rollout). Right before each group is compacted, it re-checks whether the group is
+// still owned by this compactor and whether another replica is compacting the group, and it keeps
+// a CompactionGroupMarker in the bucket while the group is being compacted. The markers are not
+// used if the markerTTL is 0.
+type shardingAwarePlanner struct {
+	compact.Planner
+
+	sharding    groupSharding
+	bkt         objstore.Bucket
+	compactorID string
+	markerTTL   time.Duration
+	logger      log.Logger
+
+	groupsSkipped *prometheus.CounterVec
+
+	// Keys of the groups for which this compactor has written the marker.
+	markersMtx sync.Mutex
+	markers    map[string]struct{}
+
+	heartbeatCancel context.CancelFunc
+	heartbeatDone   chan struct{}
+}
+
+func newShardingAwarePlanner(
+	planner compact.Planner,
+	sharding groupSharding,
+	bkt objstore.Bucket,
+	compactorID string,
+	markerTTL time.Duration,
+	logger log.Logger,
+	groupsSkipped *prometheus.CounterVec,
+) *shardingAwarePlanner {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := &shardingAwarePlanner{
+		Planner:         planner,
+		sharding:        sharding,
+		bkt:             bkt,
+		compactorID:     compactorID,
+		markerTTL:       markerTTL,
+		logger:          logger,
+		groupsSkipped:   groupsSkipped,
+		markers:         map[string]struct{}{},
+		heartbeatCancel: cancel,
+		heartbeatDone:   make(chan struct{}),
+	}
+
+	if markerTTL > 0 {
+		go p.heartbeat(ctx)
+	} else {
+		close(p.heartbeatDone)
+	}
+	return p
+}
+
+// Plan implements compact.Planner.
+func (p *shardingAwarePlanner) Plan(ctx context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+	toCompact, err := p.Planner.Plan(ctx, metasByMinTime)
+	if err != nil || len(metasByMinTime) == 0 {
+		return toCompact, err
+	}
+
+	groupKey := p.sharding.groupKey(metasByMinTime)
+
+	// Once there's nothing left to compact in the group, the marker is not needed anymore.
+	if len(toCompact) == 0 {
+		p.deleteMarker(ctx, groupKey)
+		return toCompact, nil
+	}
+
+	// The group may have been moved to another compactor since the compaction has been planned.
+	if owned, err := p.sharding.ownGroup(metasByMinTime); err != nil || !owned {
+		p.groupsSkipped.WithLabelValues(p.sharding.notOwnedReason()).Inc()
+		level.Info(p.logger).Log("msg", "skipping compaction group because it's not owned anymore by this compactor", "group", groupKey, "reason", p.sharding.notOwnedReason(), "err", err)
+		p.deleteMarker(ctx, groupKey)
+		return nil, nil
+	}
+
+	if p.markerTTL <= 0 {
+		return toCompact, nil
+	}
+
+	mark, err := ReadCompactionGroupMarker(ctx, p.bkt, groupKey, p.logger)
+	if err != nil {
+		return nil, err
+	}
+	if mark != nil && mark.CompactorID != p.compactorID && !mark.IsExpired(p.markerTTL, time.Now()) {
+		p.groupsSkipped.WithLabelValues(groupSkippedReasonInProgress).Inc()
+		level.Info(p.logger).Log("msg", "skipping compaction group because it's being compacted by another compactor", "group", groupKey, "compactor", mark.CompactorID)
+		return nil, nil
+	}
+
+	if err := WriteCompactionGroupMarker(ctx, p.bkt, groupKey, p.newMarker()); err != nil {
+		return nil, err
+	}
+
+	p.markersMtx.Lock()
+	p.markers[groupKey] = struct{}{}
+	p.markersMtx.Unlock()
+
+	return toCompact, nil
+}
+
+// close stops updating the markers written by this compactor and deletes them.
+func (p *shardingAwarePlanner) close() {
+	p.heartbeatCancel()
+	<-p.heartbeatDone
+
+	for _, groupKey := range p.markerKeys() {
+		p.deleteMarker(context.Background(), groupKey)
+	}
+}
+
+// heartbeat periodically updates the markers written by this compactor, so that they don't
+// expire while the compaction of their groups is in progress.
+func (p *shardingAwarePlanner) heartbeat(ctx context.Context) {
+	defer close(p.heartbeatDone)
+
+	ticker := time.NewTicker(p.markerTTL / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, groupKey := range p.markerKeys() {
+				if err := WriteCompactionGroupMarker(ctx, p.bkt, groupKey, p.newMarker()); err != nil {
+					level.Warn(p.logger).Log("msg", "failed to update compaction group marker", "group", groupKey, "err", err)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *shardingAwarePlanner) deleteMarker(ctx context.Context, groupKey string) {
+	p.markersMtx.Lock()
+	_, ok := p.markers[groupKey]
+	delete(p.markers, groupKey)
+	p.markersMtx.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if err := DeleteCompactionGroupMarker(ctx, p.bkt, groupKey); err != nil {
+		level.Warn(p.logger).Log("msg", "failed to delete compaction group marker", "group", groupKey, "err", err)
+	}
+}
+
+func (p *shardingAwarePlanner) markerKeys() []string {
+	p.markersMtx.Lock()
+	defer p.markersMtx.Unlock()
+
+	keys := make([]string, 0, len(p.markers))
+	for groupKey := range p.markers {
+		keys = append(keys, groupKey)
+	}
+	return keys
+}
+
+func (p *shardingAwarePlanner) newMarker() *CompactionGroupMarker {
+	return &CompactionGroupMarker{CompactorID: p.compactorID, UpdatedTime: time.Now().Unix()}
+}
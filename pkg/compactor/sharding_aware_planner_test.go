@@ -0,0 +1,169 @@
+package compactor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func TestShardingAwarePlanner_Plan(t *testing.T) {
+	metas := []*metadata.Meta{
+		{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil)}, Thanos: metadata.Thanos{Labels: map[string]string{"shard": "1"}}},
+		{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(2, nil)}, Thanos: metadata.Thanos{Labels: map[string]string{"shard": "1"}}},
+	}
+	groupKey := compact.DefaultGroupKey(metas[0].Thanos)
+
+	tests := map[string]struct {
+		owned           bool
+		ownedErr        error
+		existingMarker  *CompactionGroupMarker
+		expectedPlanned bool
+		expectedSkipped map[string]float64
+	}{
+		"should compact the group if the tenant is owned and there's no marker": {
+			owned:           true,
+			expectedPlanned: true,
+		},
+		"should skip the group if the tenant is not owned anymore": {
+			owned:           false,
+			expectedSkipped: map[string]float64{groupSkippedReasonNotOwned: 1},
+		},
+		"should skip the group if the ownership can't be checked": {
+			ownedErr:        errors.New("ring error"),
+			expectedSkipped: map[string]float64{groupSkippedReasonNotOwned: 1},
+		},
+		"should skip the group if it's being compacted by another compactor": {
+			owned:           true,
+			existingMarker:  &CompactionGroupMarker{CompactorID: "compactor-2", UpdatedTime: time.Now().Unix()},
+			expectedSkipped: map[string]float64{groupSkippedReasonInProgress: 1},
+		},
+		"should compact the group if the marker of another compactor is expired": {
+			owned:           true,
+			existingMarker:  &CompactionGroupMarker{CompactorID: "compactor-2", UpdatedTime: time.Now().Add(-time.Hour).Unix()},
+			expectedPlanned: true,
+		},
+		"should compact the group if the marker has been written by the same compactor": {
+			owned:           true,
+			existingMarker:  &CompactionGroupMarker{CompactorID: "compactor-1", UpdatedTime: time.Now().Unix()},
+			expectedPlanned: true,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ctx := context.Background()
+			bkt := objstore.NewInMemBucket()
+			if testData.existingMarker != nil {
+				require.NoError(t, WriteCompactionGroupMarker(ctx, bkt, groupKey, testData.existingMarker))
+			}
+
+			inner := &tsdbPlannerMock{}
+			inner.On("Plan", mock.Anything, mock.Anything).Return(metas, nil)
+
+			skipped := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "skipped"}, []string{"reason"})
+			ownUser := func(_ string) (bool, error) { return testData.owned, testData.ownedErr }
+			p := newShardingAwarePlanner(inner, tenantSharding{userID: "user-1", ownUser: ownUser}, bkt, "compactor-1", 15*time.Minute, log.NewNopLogger(), skipped)
+
+			planned, err := p.Plan(ctx, metas)
+			require.NoError(t, err)
+
+			mark, err := ReadCompactionGroupMarker(ctx, bkt, groupKey, log.NewNopLogger())
+			require.NoError(t, err)
+
+			if testData.expectedPlanned {
+				assert.Equal(t, metas, planned)
+				require.NotNil(t, mark)
+				assert.Equal(t, "compactor-1", mark.CompactorID)
+				assert.False(t, mark.IsExpired(time.Minute, time.Now()))
+			} else {
+				assert.Empty(t, planned)
+				assert.Equal(t, testData.existingMarker, mark)
+			}
+
+			for _, reason := range []string{groupSkippedReasonNotOwned, groupSkippedReasonInProgress} {
+				assert.Equal(t, testData.expectedSkipped[reason], testutil.ToFloat64(skipped.WithLabelValues(reason)))
+			}
+
+			// The markers written by the planner should be deleted once closed.
+			p.close()
+			mark, err = ReadCompactionGroupMarker(ctx, bkt, groupKey, log.NewNopLogger())
+			require.NoError(t, err)
+			if testData.expectedPlanned {
+				assert.Nil(t, mark)
+			} else {
+				assert.Equal(t, testData.existingMarker, mark)
+			}
+		})
+	}
+}
+
+func TestShardingAwarePlanner_ShouldDeleteTheMarkerOnceTheGroupIsCompacted(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	metas := []*metadata.Meta{{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil)}}}
+	groupKey := compact.DefaultGroupKey(metas[0].Thanos)
+
+	inner := &tsdbPlannerMock{}
+	inner.On("Plan", mock.Anything, mock.Anything).Return(metas, nil).Once()
+	inner.On("Plan", mock.Anything, mock.Anything).Return([]*metadata.Meta{}, nil).Once()
+
+	ownUser := func(_ string) (bool, error) { return true, nil }
+	skipped := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "skipped"}, []string{"reason"})
+	p := newShardingAwarePlanner(inner, tenantSharding{userID: "user-1", ownUser: ownUser}, bkt, "compactor-1", 15*time.Minute, log.NewNopLogger(), skipped)
+	defer p.close()
+
+	_, err := p.Plan(ctx, metas)
+	require.NoError(t, err)
+	exists, err := bkt.Exists(ctx, CompactionGroupMarkerFilepath(groupKey))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// Once there's nothing left to compact in the group, the marker should be deleted.
+	planned, err := p.Plan(ctx, metas)
+	require.NoError(t, err)
+	assert.Empty(t, planned)
+	exists, err = bkt.Exists(ctx, CompactionGroupMarkerFilepath(groupKey))
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestShardingAwarePlanner_ShouldRefreshTheMarkersWhileTheCompactionIsInProgress(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	metas := []*metadata.Meta{{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil)}}}
+	groupKey := compact.DefaultGroupKey(metas[0].Thanos)
+
+	inner := &tsdbPlannerMock{}
+	inner.On("Plan", mock.Anything, mock.Anything).Return(metas, nil)
+
+	ownUser := func(_ string) (bool, error) { return true, nil }
+	skipped := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "skipped"}, []string{"reason"})
+	p := newShardingAwarePlanner(inner, tenantSharding{userID: "user-1", ownUser: ownUser}, bkt, "compactor-1", 200*time.Millisecond, log.NewNopLogger(), skipped)
+	defer p.close()
+
+	_, err := p.Plan(ctx, metas)
+	require.NoError(t, err)
+
+	// Simulate the marker is about to expire.
+	require.NoError(t, WriteCompactionGroupMarker(ctx, bkt, groupKey, &CompactionGroupMarker{CompactorID: "compactor-1", UpdatedTime: time.Now().Add(-time.Hour).Unix()}))
+
+	test.Poll(t, time.Second, true, func() interface{} {
+		mark, err := ReadCompactionGroupMarker(ctx, bkt, groupKey, log.NewNopLogger())
+		return err == nil && mark != nil && !mark.IsExpired(time.Minute, time.Now())
+	})
+}
@@ -0,0 +1,267 @@
+package compactor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+// timeShardingJob is the compaction of the blocks of a group within a time range.
+type timeShardingJob struct {
+	key        string
+	rangeStart int64
+	rangeEnd   int64
+
+	// Number of blocks of the group following the time range of the job, up to 2.
+	following int
+}
+
+// timeShardingGrouper splits the compaction groups of a tenant into jobs, each one compacting the
+// blocks of a group within a time range of the largest block range period, so that the compaction
+// of a tenant can be spread across the compactor replicas. Each job is owned by the compactor to
+// which the hash of the tenant and time range maps in the ring, and only the jobs owned by this
+// compactor are returned.
+//
+// It also implements compact.Planner, planning each job independently from the others: the blocks
+// following the time range of a job are replaced by placeholders, so that the most recent blocks of
+// the group are still excluded from the compaction like when planning the whole group.
+type timeShardingGrouper struct {
+	grouper  compact.Grouper
+	planner  compact.Planner
+	userID   string
+	jobRange int64
+	ownJob   func(userID string, rangeStart int64) (bool, error)
+	bkt      objstore.Bucket
+	logger   log.Logger
+
+	blocksMarkedForDeletion prometheus.Counter
+	garbageCollectedBlocks  prometheus.Counter
+	compactions             *prometheus.CounterVec
+	compactionRunsStarted   *prometheus.CounterVec
+	compactionRunsCompleted *prometheus.CounterVec
+	compactionFailures      *prometheus.CounterVec
+	verticalCompactions     *prometheus.CounterVec
+
+	// Jobs of the groups built in the current pass, by block ID.
+	jobsMtx sync.Mutex
+	jobs    map[ulid.ULID]*timeShardingJob
+}
+
+// newTimeShardingGrouper makes a new timeShardingGrouper splitting the groups built by the input grouper.
+// The groups of the input grouper are not compacted, so it should not register its metrics in reg, which
+// are registered by the timeShardingGrouper instead.
+func newTimeShardingGrouper(
+	grouper compact.Grouper,
+	planner compact.Planner,
+	userID string,
+	jobRange int64,
+	ownJob func(userID string, rangeStart int64) (bool, error),
+	bkt objstore.Bucket,
+	logger log.Logger,
+	reg prometheus.Registerer,
+	blocksMarkedForDeletion prometheus.Counter,
+	garbageCollectedBlocks prometheus.Counter,
+) *timeShardingGrouper {
+	return &timeShardingGrouper{
+		grouper:                 grouper,
+		planner:                 planner,
+		userID:                  userID,
+		jobRange:                jobRange,
+		ownJob:                  ownJob,
+		bkt:                     bkt,
+		logger:                  logger,
+		blocksMarkedForDeletion: blocksMarkedForDeletion,
+		garbageCollectedBlocks:  garbageCollectedBlocks,
+		// The metrics of the compaction groups are the same of the compact.DefaultGrouper.
+		compactions: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_compact_group_compactions_total",
+			Help: "Total number of group compaction attempts that resulted in a new block.",
+		}, []string{"group"}),
+		compactionRunsStarted: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_compact_group_compaction_runs_started_total",
+			Help: "Total number of group compaction attempts.",
+		}, []string{"group"}),
+		compactionRunsCompleted: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_compact_group_compaction_runs_completed_total",
+			Help: "Total number of group completed compaction runs. This also includes compactor group runs that resulted with no compaction.",
+		}, []string{"group"}),
+		compactionFailures: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_compact_group_compactions_failures_total",
+			Help: "Total number of failed group compactions.",
+		}, []string{"group"}),
+		verticalCompactions: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_compact_group_vertical_compactions_total",
+			Help: "Total number of group compaction attempts that resulted in a new block based on overlapping blocks.",
+		}, []string{"group"}),
+		jobs: map[ulid.ULID]*timeShardingJob{},
+	}
+}
+
+// Groups implements compact.Grouper.
+func (g *timeShardingGrouper) Groups(blocks map[ulid.ULID]*metadata.Meta) ([]*compact.Group, error) {
+	groups, err := g.grouper.Groups(blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*compact.Group
+	jobs := map[ulid.ULID]*timeShardingJob{}
+
+	for _, group := range groups {
+		// Split the blocks of the group by time range.
+		metasByRange := map[int64][]*metadata.Meta{}
+		for _, id := range group.IDs() {
+			if meta, ok := blocks[id]; ok {
+				rangeStart := timeShardingRangeStart(meta.MinTime, g.jobRange)
+				metasByRange[rangeStart] = append(metasByRange[rangeStart], meta)
+			}
+		}
+
+		rangeStarts := make([]int64, 0, len(metasByRange))
+		for rangeStart := range metasByRange {
+			rangeStarts = append(rangeStarts, rangeStart)
+		}
+		sort.Slice(rangeStarts, func(i, j int) bool { return rangeStarts[i] < rangeStarts[j] })
+
+		following := 0
+		for i := len(rangeStarts) - 1; i >= 0; i-- {
+			rangeStart := rangeStarts[i]
+			metas := metasByRange[rangeStart]
+
+			job := &timeShardingJob{
+				key:        fmt.Sprintf("%s-%d-%d", group.Key(), rangeStart, rangeStart+g.jobRange),
+				rangeStart: rangeStart,
+				rangeEnd:   rangeStart + g.jobRange,
+				following:  following,
+			}
+			if following += len(metas); following > 2 {
+				following = 2
+			}
+
+			if owned, err := g.ownJob(g.userID, rangeStart); err != nil || !owned {
+				level.Debug(g.logger).Log("msg", "skipping compaction job because it's not owned by this compactor", "job", job.key, "err", err)
+				continue
+			}
+
+			jobGroup, err := compact.NewGroup(
+				log.With(g.logger, "group", fmt.Sprintf("%d@%v", group.Resolution(), group.Labels().String()), "groupKey", job.key),
+				g.bkt,
+				job.key,
+				group.Labels(),
+				group.Resolution(),
+				false, // Do not accept malformed indexes
+				true,  // Enable vertical compaction
+				g.compactions.WithLabelValues(job.key),
+				g.compactionRunsStarted.WithLabelValues(job.key),
+				g.compactionRunsCompleted.WithLabelValues(job.key),
+				g.compactionFailures.WithLabelValues(job.key),
+				g.verticalCompactions.WithLabelValues(job.key),
+				g.garbageCollectedBlocks,
+				g.blocksMarkedForDeletion,
+				metadata.NoneFunc,
+			)
+			if err != nil {
+				return nil, errors.Wrap(err, "create compaction job group")
+			}
+
+			for _, meta := range metas {
+				if err := jobGroup.AppendMeta(meta); err != nil {
+					return nil, errors.Wrap(err, "add compaction job group")
+				}
+				jobs[meta.ULID] = job
+			}
+			res = append(res, jobGroup)
+		}
+	}
+
+	g.jobsMtx.Lock()
+	g.jobs = jobs
+	g.jobsMtx.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key() < res[j].Key()
+	})
+	return res, nil
+}
+
+// Plan implements compact.Planner.
+func (g *timeShardingGrouper) Plan(ctx context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+	job := g.job(metasByMinTime)
+	if job == nil || job.following == 0 {
+		return g.planner.Plan(ctx, metasByMinTime)
+	}
+
+	metas := make([]*metadata.Meta, 0, len(metasByMinTime)+job.following)
+	metas = append(metas, metasByMinTime...)
+	placeholders := map[*metadata.Meta]struct{}{}
+	for i := 0; i < job.following; i++ {
+		placeholder := &metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: job.rangeEnd + int64(i), MaxTime: job.rangeEnd + int64(i) + 1}}
+		placeholders[placeholder] = struct{}{}
+		metas = append(metas, placeholder)
+	}
+
+	planned, err := g.planner.Plan(ctx, metas)
+	if err != nil {
+		return nil, err
+	}
+
+	toCompact := make([]*metadata.Meta, 0, len(planned))
+	for _, meta := range planned {
+		if _, ok := placeholders[meta]; !ok {
+			toCompact = append(toCompact, meta)
+		}
+	}
+	return toCompact, nil
+}
+
+// groupKey implements groupSharding.
+func (g *timeShardingGrouper) groupKey(metasByMinTime []*metadata.Meta) string {
+	if job := g.job(metasByMinTime); job != nil {
+		return job.key
+	}
+	return compact.DefaultGroupKey(metasByMinTime[0].Thanos)
+}
+
+// ownGroup implements groupSharding.
+func (g *timeShardingGrouper) ownGroup(metasByMinTime []*metadata.Meta) (bool, error) {
+	if job := g.job(metasByMinTime); job != nil {
+		return g.ownJob(g.userID, job.rangeStart)
+	}
+	return g.ownJob(g.userID, timeShardingRangeStart(metasByMinTime[0].MinTime, g.jobRange))
+}
+
+// notOwnedReason implements groupSharding.
+func (g *timeShardingGrouper) notOwnedReason() string {
+	return groupSkippedReasonJobNotOwned
+}
+
+// job returns the job of the blocks, if built in the current pass.
+func (g *timeShardingGrouper) job(metasByMinTime []*metadata.Meta) *timeShardingJob {
+	if len(metasByMinTime) == 0 {
+		return nil
+	}
+
+	g.jobsMtx.Lock()
+	defer g.jobsMtx.Unlock()
+	return g.jobs[metasByMinTime[0].ULID]
+}
+
+// timeShardingRangeStart returns the start of the time range of the given size including the timestamp.
+func timeShardingRangeStart(ts, jobRange int64) int64 {
+	if ts >= 0 {
+		return jobRange * (ts / jobRange)
+	}
+	return jobRange * ((ts - jobRange + 1) / jobRange)
+}
@@ -0,0 +1,144 @@
+package compactor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+func TestTimeShardingGrouper(t *testing.T) {
+	const (
+		hour     = int64(time.Hour / time.Millisecond)
+		jobRange = 24 * hour
+	)
+
+	newMeta := func(id uint64, minT, maxT int64) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(id, nil), MinTime: minT, MaxTime: maxT, Compaction: tsdb.BlockMetaCompaction{Level: 1}},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"shard": "1"}},
+		}
+	}
+
+	// Two non overlapping blocks per day, for 3 days.
+	var metas []*metadata.Meta
+	blocks := map[ulid.ULID]*metadata.Meta{}
+	for day := int64(0); day < 3; day++ {
+		for i := int64(0); i < 2; i++ {
+			meta := newMeta(uint64(day*2+i+1), day*jobRange+i*2*hour, day*jobRange+(i+1)*2*hour)
+			metas = append(metas, meta)
+			blocks[meta.ULID] = meta
+		}
+	}
+	groupKey := compact.DefaultGroupKey(metas[0].Thanos)
+
+	tests := map[string]struct {
+		ownedRanges     []int64
+		expectedGroups  map[string][]*metadata.Meta
+		expectedPlanned map[string][]*metadata.Meta
+	}{
+		"should split the group by time range and plan each job independently": {
+			ownedRanges: []int64{0, jobRange, 2 * jobRange},
+			expectedGroups: map[string][]*metadata.Meta{
+				fmt.Sprintf("%s-0-%d", groupKey, jobRange):                metas[0:2],
+				fmt.Sprintf("%s-%d-%d", groupKey, jobRange, 2*jobRange):   metas[2:4],
+				fmt.Sprintf("%s-%d-%d", groupKey, 2*jobRange, 3*jobRange): metas[4:6],
+			},
+			expectedPlanned: map[string][]*metadata.Meta{
+				// The blocks followed by the blocks of the next jobs are compacted,
+				// while the most recent block of the group is excluded.
+				fmt.Sprintf("%s-0-%d", groupKey, jobRange):                metas[0:2],
+				fmt.Sprintf("%s-%d-%d", groupKey, jobRange, 2*jobRange):   metas[2:4],
+				fmt.Sprintf("%s-%d-%d", groupKey, 2*jobRange, 3*jobRange): {},
+			},
+		},
+		"should return only the jobs owned by the compactor": {
+			ownedRanges: []int64{jobRange},
+			expectedGroups: map[string][]*metadata.Meta{
+				fmt.Sprintf("%s-%d-%d", groupKey, jobRange, 2*jobRange): metas[2:4],
+			},
+			expectedPlanned: map[string][]*metadata.Meta{
+				fmt.Sprintf("%s-%d-%d", groupKey, jobRange, 2*jobRange): metas[2:4],
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ownJob := func(userID string, rangeStart int64) (bool, error) {
+				assert.Equal(t, "user-1", userID)
+				for _, owned := range testData.ownedRanges {
+					if owned == rangeStart {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+
+			bkt := objstore.NewInMemBucket()
+			grouper := newTimeShardingGrouper(
+				compact.NewDefaultGrouper(log.NewNopLogger(), bkt, false, true, prometheus.NewRegistry(), nil, nil, metadata.NoneFunc),
+				compact.NewTSDBBasedPlanner(log.NewNopLogger(), []int64{2 * hour, 12 * hour, 24 * hour}),
+				"user-1",
+				jobRange,
+				ownJob,
+				bkt,
+				log.NewNopLogger(),
+				prometheus.NewRegistry(),
+				prometheus.NewCounter(prometheus.CounterOpts{}),
+				prometheus.NewCounter(prometheus.CounterOpts{}))
+
+			groups, err := grouper.Groups(blocks)
+			require.NoError(t, err)
+			require.Len(t, groups, len(testData.expectedGroups))
+
+			for _, group := range groups {
+				expected, ok := testData.expectedGroups[group.Key()]
+				require.True(t, ok, group.Key())
+
+				groupMetas := make([]*metadata.Meta, 0, len(group.IDs()))
+				for _, id := range group.IDs() {
+					groupMetas = append(groupMetas, blocks[id])
+				}
+				assert.ElementsMatch(t, expected, groupMetas)
+
+				assert.Equal(t, group.Key(), grouper.groupKey(expected))
+				owned, err := grouper.ownGroup(expected)
+				require.NoError(t, err)
+				assert.True(t, owned)
+
+				planned, err := grouper.Plan(context.Background(), expected)
+				require.NoError(t, err)
+				assert.ElementsMatch(t, testData.expectedPlanned[group.Key()], planned)
+			}
+		})
+	}
+}
+
+func TestTimeShardingRangeStart(t *testing.T) {
+	tests := []struct {
+		ts, jobRange, expected int64
+	}{
+		{ts: 0, jobRange: 10, expected: 0},
+		{ts: 9, jobRange: 10, expected: 0},
+		{ts: 10, jobRange: 10, expected: 10},
+		{ts: 25, jobRange: 10, expected: 20},
+		{ts: -1, jobRange: 10, expected: -10},
+		{ts: -10, jobRange: 10, expected: -10},
+		{ts: -11, jobRange: 10, expected: -20},
+	}
+
+	for _, testData := range tests {
+		assert.Equal(t, testData.expected, timeShardingRangeStart(testData.ts, testData.jobRange), "ts: %d", testData.ts)
+	}
+}
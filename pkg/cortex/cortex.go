@@ -47,6 +47,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/querier/tenantfederation"
 	querier_worker "github.com/cortexproject/cortex/pkg/querier/worker"
 	"github.com/cortexproject/cortex/pkg/ring"
+	"github.com/cortexproject/cortex/pkg/ring/kv"
 	"github.com/cortexproject/cortex/pkg/ring/kv/memberlist"
 	"github.com/cortexproject/cortex/pkg/ruler"
 	"github.com/cortexproject/cortex/pkg/ruler/rulestore"
@@ -54,10 +55,12 @@ import (
 	"github.com/cortexproject/cortex/pkg/storage/tsdb"
 	"github.com/cortexproject/cortex/pkg/storegateway"
 	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/usage"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/fakeauth"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/cortexproject/cortex/pkg/util/grpc/healthcheck"
+	"github.com/cortexproject/cortex/pkg/util/grpcutil"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 	"github.com/cortexproject/cortex/pkg/util/process"
 	"github.com/cortexproject/cortex/pkg/util/runtimeconfig"
@@ -65,7 +68,13 @@ import (
 )
 
 var (
-	errInvalidHTTPPrefix = errors.New("HTTP prefix should be empty or start with /")
+	errInvalidHTTPPrefix   = errors.New("HTTP prefix should be empty or start with /")
+	errEmbeddedKVMultiNode = errors.New("the embedded KV store can only be used when running Cortex as a single process with -target=all, because it can't be shared across multiple nodes")
+
+	errIngesterDirectPushMultiNode         = errors.New("the ingester direct push can only be enabled when running Cortex as a single process with -target=all, because it runs the distributor validation in the ingester process")
+	errIngesterDirectPushReplicationFactor = errors.New("the ingester direct push can only be enabled when the replication factor is 1, because the series are appended to the local ingester only")
+
+	errRulerTenantFederationDisabled = errors.New("the ruler tenant federation can only be enabled when the tenant federation is enabled too, see -tenant-federation.enabled")
 )
 
 // The design pattern for Cortex is a series of config objects, which are
@@ -94,6 +103,7 @@ type Config struct {
 
 	API              api.Config                      `yaml:"api"`
 	Server           server.Config                   `yaml:"server"`
+	GRPCMethodLimits grpcutil.MethodLimitsConfig     `yaml:"grpc_method_limits"`
 	Distributor      distributor.Config              `yaml:"distributor"`
 	Querier          querier.Config                  `yaml:"querier"`
 	IngesterClient   client.Config                   `yaml:"ingester_client"`
@@ -123,6 +133,7 @@ type Config struct {
 	RuntimeConfig       runtimeconfig.ManagerConfig                `yaml:"runtime_config"`
 	MemberlistKV        memberlist.KVConfig                        `yaml:"memberlist"`
 	QueryScheduler      scheduler.Config                           `yaml:"query_scheduler"`
+	Usage               usage.Config                               `yaml:"usage"`
 }
 
 // RegisterFlags registers flag.
@@ -143,6 +154,7 @@ func (c *Config) RegisterFlags(f *flag.FlagSet) {
 
 	c.API.RegisterFlags(f)
 	c.registerServerFlagsWithChangedDefaultValues(f)
+	c.GRPCMethodLimits.RegisterFlagsWithPrefix("server.grpc.method-limits.", f)
 	c.Distributor.RegisterFlags(f)
 	c.Querier.RegisterFlags(f)
 	c.IngesterClient.RegisterFlags(f)
@@ -172,6 +184,7 @@ func (c *Config) RegisterFlags(f *flag.FlagSet) {
 	c.RuntimeConfig.RegisterFlags(f)
 	c.MemberlistKV.RegisterFlags(f)
 	c.QueryScheduler.RegisterFlags(f)
+	c.Usage.RegisterFlags(f)
 
 	// These don't seem to have a home.
 	f.IntVar(&chunk_util.QueryParallelism, "querier.query-parallelism", 100, "Max subqueries run in parallel per higher-level query.")
@@ -188,6 +201,17 @@ func (c *Config) Validate(log log.Logger) error {
 		return errInvalidHTTPPrefix
 	}
 
+	if err := c.validateEmbeddedKVStore(); err != nil {
+		return err
+	}
+
+	if err := c.validateIngesterDirectPush(); err != nil {
+		return err
+	}
+
+	if err := c.GRPCMethodLimits.Validate(); err != nil {
+		return errors.Wrap(err, "invalid grpc_method_limits config")
+	}
 	if err := c.Schema.Validate(); err != nil {
 		return errors.Wrap(err, "invalid schema config")
 	}
@@ -224,6 +248,9 @@ func (c *Config) Validate(log log.Logger) error {
 	if err := c.Worker.Validate(log); err != nil {
 		return errors.Wrap(err, "invalid frontend_worker config")
 	}
+	if err := c.Frontend.Validate(); err != nil {
+		return errors.Wrap(err, "invalid frontend config")
+	}
 	if err := c.QueryRange.Validate(); err != nil {
 		return errors.Wrap(err, "invalid query_range config")
 	}
@@ -233,15 +260,24 @@ func (c *Config) Validate(log log.Logger) error {
 	if err := c.StoreGateway.Validate(c.LimitsConfig); err != nil {
 		return errors.Wrap(err, "invalid store-gateway config")
 	}
-	if err := c.Compactor.Validate(); err != nil {
+	if err := c.Compactor.Validate(c.LimitsConfig); err != nil {
 		return errors.Wrap(err, "invalid compactor config")
 	}
+	if err := c.Usage.Validate(); err != nil {
+		return errors.Wrap(err, "invalid usage config")
+	}
 	if err := c.AlertmanagerStorage.Validate(); err != nil {
 		return errors.Wrap(err, "invalid alertmanager storage config")
 	}
 	if err := c.Alertmanager.Validate(c.AlertmanagerStorage); err != nil {
 		return errors.Wrap(err, "invalid alertmanager config")
 	}
+	if err := c.TenantFederation.Validate(); err != nil {
+		return errors.Wrap(err, "invalid tenant-federation config")
+	}
+	if c.Ruler.TenantFederation.Enabled && !c.TenantFederation.Enabled {
+		return errRulerTenantFederationDisabled
+	}
 
 	if c.Storage.Engine == storage.StorageEngineBlocks && c.Querier.SecondStoreEngine != storage.StorageEngineChunks && len(c.Schema.Configs) > 0 {
 		level.Warn(log).Log("schema configuration is not used by the blocks storage engine, and will have no effect")
@@ -250,6 +286,47 @@ func (c *Config) Validate(log log.Logger) error {
 	return nil
 }
 
+// validateIngesterDirectPush ensures the ingester direct push is only enabled when the distributor
+// and the only replica of the ingester run within the same process.
+func (c *Config) validateIngesterDirectPush() error {
+	if !c.Ingester.DirectPushEnabled {
+		return nil
+	}
+
+	if len(c.Target) != 1 || c.Target[0] != All {
+		return errIngesterDirectPushMultiNode
+	}
+	if c.Ingester.LifecyclerConfig.RingConfig.ReplicationFactor > 1 {
+		return errIngesterDirectPushReplicationFactor
+	}
+
+	return nil
+}
+
+// validateEmbeddedKVStore ensures the embedded KV store is only used when all components run
+// within the same process, because it can't be shared with other Cortex instances.
+func (c *Config) validateEmbeddedKVStore() error {
+	if len(c.Target) == 1 && c.Target[0] == All {
+		return nil
+	}
+
+	for _, cfg := range []kv.Config{
+		c.Ingester.LifecyclerConfig.RingConfig.KVStore,
+		c.Distributor.DistributorRing.KVStore,
+		c.Distributor.HATrackerConfig.KVStore,
+		c.StoreGateway.ShardingRing.KVStore,
+		c.Compactor.ShardingRing.KVStore,
+		c.Ruler.Ring.KVStore,
+		c.Alertmanager.ShardingRing.KVStore,
+	} {
+		if cfg.Store == "embedded" || (cfg.Store == "multi" && (cfg.Multi.Primary == "embedded" || cfg.Multi.Secondary == "embedded")) {
+			return errEmbeddedKVMultiNode
+		}
+	}
+
+	return nil
+}
+
 func (c *Config) isModuleEnabled(m string) bool {
 	return util.StringsContain(c.Target, m)
 }
@@ -342,6 +419,13 @@ type Cortex struct {
 	// Queryables that the querier should use to query the long
 	// term storage. It depends on the storage engine used.
 	StoreQueryables []querier.QueryableWithFilter
+
+	// Prefetch jobs warming up the store-gateways caches through the querier.
+	// It's set only when running the blocks storage.
+	QuerierPrefetchJobs *storegateway.PrefetchJobs
+
+	// The names of the modules registered via RegisterModule.
+	customModules map[string]struct{}
 }
 
 // New makes a new Cortex.
@@ -378,6 +462,7 @@ func New(cfg Config) (*Cortex, error) {
 	}
 
 	cortex.setupThanosTracing()
+	cortex.setupGRPCMethodLimits()
 
 	if err := cortex.setupModuleManager(); err != nil {
 		return nil, err
@@ -393,6 +478,19 @@ func (t *Cortex) setupThanosTracing() {
 	t.Cfg.Server.GRPCStreamMiddleware = append(t.Cfg.Server.GRPCStreamMiddleware, ThanosTracerStreamInterceptor)
 }
 
+// setupGRPCMethodLimits appends a gRPC middleware limiting the concurrency of the configured methods.
+// The gRPC server is shared by all the modules, so the limits apply to the ingester, store-gateway and
+// querier alike.
+func (t *Cortex) setupGRPCMethodLimits() {
+	if len(t.Cfg.GRPCMethodLimits.MaxInflightRequests) == 0 {
+		return
+	}
+
+	limiter := grpcutil.NewMethodLimiter(t.Cfg.GRPCMethodLimits, prometheus.DefaultRegisterer)
+	t.Cfg.Server.GRPCMiddleware = append(t.Cfg.Server.GRPCMiddleware, limiter.UnaryServerInterceptor)
+	t.Cfg.Server.GRPCStreamMiddleware = append(t.Cfg.Server.GRPCStreamMiddleware, limiter.StreamServerInterceptor)
+}
+
 // Run starts Cortex running, and blocks until a Cortex stops.
 func (t *Cortex) Run() error {
 	// Register custom process metrics.
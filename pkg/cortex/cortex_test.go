@@ -143,6 +143,68 @@ func TestConfigValidation(t *testing.T) {
 			},
 			expectedError: errInvalidHTTPPrefix,
 		},
+		{
+			name: "should pass validation if the embedded KV store is used with target=all",
+			getTestConfig: func() *Config {
+				configuration := newDefaultConfig()
+				configuration.Ingester.LifecyclerConfig.RingConfig.KVStore.Store = "embedded"
+				return configuration
+			},
+			expectedError: nil,
+		},
+		{
+			name: "should fail validation if the embedded KV store is used by a microservice",
+			getTestConfig: func() *Config {
+				configuration := newDefaultConfig()
+				configuration.Target = []string{Ingester}
+				configuration.Ingester.LifecyclerConfig.RingConfig.KVStore.Store = "embedded"
+				return configuration
+			},
+			expectedError: errEmbeddedKVMultiNode,
+		},
+		{
+			name: "should fail validation if the embedded KV store is used as multi secondary by a microservice",
+			getTestConfig: func() *Config {
+				configuration := newDefaultConfig()
+				configuration.Target = []string{Distributor}
+				configuration.Distributor.HATrackerConfig.KVStore.Store = "multi"
+				configuration.Distributor.HATrackerConfig.KVStore.Multi.Primary = "consul"
+				configuration.Distributor.HATrackerConfig.KVStore.Multi.Secondary = "embedded"
+				return configuration
+			},
+			expectedError: errEmbeddedKVMultiNode,
+		},
+		{
+			name: "should pass validation if the ingester direct push is enabled with target=all",
+			getTestConfig: func() *Config {
+				configuration := newDefaultConfig()
+				configuration.Ingester.DirectPushEnabled = true
+				configuration.Ingester.LifecyclerConfig.RingConfig.ReplicationFactor = 1
+				return configuration
+			},
+			expectedError: nil,
+		},
+		{
+			name: "should fail validation if the ingester direct push is enabled by a microservice",
+			getTestConfig: func() *Config {
+				configuration := newDefaultConfig()
+				configuration.Target = []string{Ingester}
+				configuration.Ingester.DirectPushEnabled = true
+				configuration.Ingester.LifecyclerConfig.RingConfig.ReplicationFactor = 1
+				return configuration
+			},
+			expectedError: errIngesterDirectPushMultiNode,
+		},
+		{
+			name: "should fail validation if the ingester direct push is enabled with replication factor > 1",
+			getTestConfig: func() *Config {
+				configuration := newDefaultConfig()
+				configuration.Ingester.DirectPushEnabled = true
+				configuration.Ingester.LifecyclerConfig.RingConfig.ReplicationFactor = 3
+				return configuration
+			},
+			expectedError: errIngesterDirectPushReplicationFactor,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			err := tc.getTestConfig().Validate(nil)
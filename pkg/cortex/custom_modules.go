@@ -0,0 +1,57 @@
+package cortex
+
+import (
+	"fmt"
+
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+)
+
+var errRegisterModuleAfterRun = errors.New("custom modules must be registered before running Cortex")
+
+// RegisterModule registers a custom module, for the programs embedding Cortex. It must be called
+// after New and before Run. The module is initialized by initFn once the modules it depends on
+// have been initialized, and its service is started after and stopped before their services. The
+// initFn can return a nil service if the module has nothing to run.
+//
+// The module name can't be the name of a built-in module, like "ring" or "all", and the dependencies
+// must be already registered, either built-in or custom modules. The module always depends on the
+// API module, so that initFn can register its HTTP routes on the shared server via the API field:
+// the routes registered by API.RegisterRoute with auth enabled get the same authentication
+// middleware as the built-in routes.
+//
+// The custom modules are run when they're listed in the -target, or when a module in the
+// -target depends on them.
+func (t *Cortex) RegisterModule(name string, initFn func() (services.Service, error), deps ...string) error {
+	if t.ServiceMap != nil {
+		return errRegisterModuleAfterRun
+	}
+	if name == "" {
+		return errors.New("the custom module name can't be empty")
+	}
+	if t.ModuleManager.IsModuleRegistered(name) {
+		if _, ok := t.customModules[name]; ok {
+			return fmt.Errorf("the custom module %s is already registered", name)
+		}
+		return fmt.Errorf("the custom module name %s is reserved by a built-in module", name)
+	}
+	if initFn == nil {
+		return fmt.Errorf("the init function of the custom module %s can't be nil", name)
+	}
+	for _, dep := range deps {
+		if !t.ModuleManager.IsModuleRegistered(dep) {
+			return fmt.Errorf("the dependency %s of the custom module %s is not registered", dep, name)
+		}
+	}
+
+	t.ModuleManager.RegisterModule(name, initFn)
+	if err := t.ModuleManager.AddDependency(name, append([]string{API}, deps...)...); err != nil {
+		return err
+	}
+
+	if t.customModules == nil {
+		t.customModules = map[string]struct{}{}
+	}
+	t.customModules[name] = struct{}{}
+	return nil
+}
@@ -0,0 +1,124 @@
+package cortex
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/server"
+
+	"github.com/cortexproject/cortex/pkg/chunk/storage"
+	"github.com/cortexproject/cortex/pkg/ingester"
+	"github.com/cortexproject/cortex/pkg/ring"
+	"github.com/cortexproject/cortex/pkg/ring/kv"
+)
+
+func newCortexForCustomModules(t *testing.T) *Cortex {
+	// The server registers some metrics to the default registry.
+	savedRegistry := prometheus.DefaultRegisterer
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+	t.Cleanup(func() {
+		prometheus.DefaultRegisterer = savedRegistry
+	})
+
+	c, err := New(Config{
+		AuthEnabled: true,
+		Server: server.Config{
+			HTTPListenAddress: "localhost",
+			GRPCListenAddress: "localhost",
+		},
+		Storage: storage.Config{
+			Engine: storage.StorageEngineBlocks,
+		},
+		Ingester: ingester.Config{
+			LifecyclerConfig: ring.LifecyclerConfig{
+				RingConfig: ring.Config{
+					KVStore:           kv.Config{Store: "inmemory"},
+					ReplicationFactor: 1,
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func TestCortex_RegisterModule(t *testing.T) {
+	const billingExporter = "billing-exporter"
+
+	c := newCortexForCustomModules(t)
+
+	// A trivial module, depending on the ring and registering its own HTTP route.
+	var ringRunning bool
+	require.NoError(t, c.RegisterModule(billingExporter, func() (services.Service, error) {
+		c.API.RegisterRoute("/billing", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("billing"))
+		}), true, http.MethodGet)
+
+		return services.NewIdleService(func(context.Context) error {
+			// The module is started once its dependencies are running.
+			ringRunning = c.Ring.State() == services.Running
+			return nil
+		}, nil), nil
+	}, Ring))
+
+	serviceMap, err := c.ModuleManager.InitModuleServices(billingExporter)
+	require.NoError(t, err)
+	for _, m := range []string{billingExporter, Ring, Server} {
+		require.Contains(t, serviceMap, m)
+	}
+
+	var servs []services.Service
+	for _, s := range serviceMap {
+		servs = append(servs, s)
+	}
+	sm, err := services.NewManager(servs...)
+	require.NoError(t, err)
+	require.NoError(t, services.StartManagerAndAwaitHealthy(context.Background(), sm))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopManagerAndAwaitStopped(context.Background(), sm))
+	})
+	assert.True(t, ringRunning)
+
+	// The route of the module is served by the shared server, with the authentication middleware.
+	w := httptest.NewRecorder()
+	c.Server.HTTP.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/billing", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/billing", nil)
+	req.Header.Set("X-Scope-OrgID", "user-1")
+	w = httptest.NewRecorder()
+	c.Server.HTTP.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "billing", w.Body.String())
+}
+
+func TestCortex_RegisterModule_ShouldRejectInvalidModules(t *testing.T) {
+	initFn := func() (services.Service, error) { return nil, nil }
+
+	c := newCortexForCustomModules(t)
+	require.NoError(t, c.RegisterModule("custom", initFn))
+
+	for name, register := range map[string]func() error{
+		"built-in module name": func() error { return c.RegisterModule(Ring, initFn) },
+		"all module name":      func() error { return c.RegisterModule(All, initFn) },
+		"empty name":           func() error { return c.RegisterModule("", initFn) },
+		"already registered":   func() error { return c.RegisterModule("custom", initFn) },
+		"nil init function":    func() error { return c.RegisterModule("other", nil) },
+		"unknown dependency":   func() error { return c.RegisterModule("other", initFn, "unknown") },
+	} {
+		assert.Error(t, register(), name)
+	}
+
+	// A custom module can depend on another custom module.
+	require.NoError(t, c.RegisterModule("other", initFn, "custom"))
+
+	// The modules can't be registered once running.
+	c.ServiceMap = map[string]services.Service{}
+	assert.Equal(t, errRegisterModuleAfterRun, c.RegisterModule("late", initFn))
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/rules"
 	prom_storage "github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/thanos/pkg/objstore"
 	httpgrpc_server "github.com/weaveworks/common/httpgrpc/server"
 	"github.com/weaveworks/common/server"
 
@@ -44,7 +45,9 @@ import (
 	"github.com/cortexproject/cortex/pkg/ring/kv/memberlist"
 	"github.com/cortexproject/cortex/pkg/ruler"
 	"github.com/cortexproject/cortex/pkg/scheduler"
+	"github.com/cortexproject/cortex/pkg/storage/bucket"
 	"github.com/cortexproject/cortex/pkg/storegateway"
+	"github.com/cortexproject/cortex/pkg/usage"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 	"github.com/cortexproject/cortex/pkg/util/runtimeconfig"
 	"github.com/cortexproject/cortex/pkg/util/validation"
@@ -62,6 +65,7 @@ const (
 	DistributorService       string = "distributor-service"
 	Ingester                 string = "ingester"
 	IngesterService          string = "ingester-service"
+	IngesterDirectPush       string = "ingester-direct-push"
 	Flusher                  string = "flusher"
 	Querier                  string = "querier"
 	Queryable                string = "queryable"
@@ -83,6 +87,7 @@ const (
 	Purger                   string = "purger"
 	QueryScheduler           string = "query-scheduler"
 	TenantFederation         string = "tenant-federation"
+	Usage                    string = "usage"
 	All                      string = "all"
 )
 
@@ -211,7 +216,7 @@ func (t *Cortex) initDistributorService() (serv services.Service, err error) {
 }
 
 func (t *Cortex) initDistributor() (serv services.Service, err error) {
-	t.API.RegisterDistributor(t.Distributor, t.Cfg.Distributor)
+	t.API.RegisterDistributor(t.Distributor, t.Cfg.Distributor, t.Overrides)
 
 	return nil, nil
 }
@@ -237,7 +242,7 @@ func (t *Cortex) initTenantFederation() (serv services.Service, err error) {
 		// single tenant. This allows for a less impactful enabling of tenant
 		// federation.
 		byPassForSingleQuerier := true
-		t.QuerierQueryable = querier.NewSampleAndChunkQueryable(tenantfederation.NewQueryable(t.QuerierQueryable, byPassForSingleQuerier))
+		t.QuerierQueryable = querier.NewSampleAndChunkQueryable(tenantfederation.NewQueryable(t.QuerierQueryable, t.Cfg.TenantFederation.TenantLabelName, byPassForSingleQuerier))
 	}
 	return nil, nil
 }
@@ -302,10 +307,17 @@ func (t *Cortex) initQuerier() (serv services.Service, err error) {
 		t.QuerierEngine,
 		t.Distributor,
 		t.TombstonesLoader,
+		t.Overrides,
 		prometheus.DefaultRegisterer,
 		util_log.Logger,
 	)
 
+	// The prefetch endpoints are always registered to the default server, because they're not
+	// part of the Prometheus API.
+	if t.QuerierPrefetchJobs != nil {
+		t.API.RegisterQuerierPrefetch(t.QuerierPrefetchJobs)
+	}
+
 	// If the querier is running standalone without the query-frontend or query-scheduler, we must register it's internal
 	// HTTP handler externally and provide the external Cortex Server HTTP handler to the frontend worker
 	// to ensure requests it processes use the default middleware instrumentation.
@@ -349,6 +361,8 @@ func (t *Cortex) initQuerier() (serv services.Service, err error) {
 func (t *Cortex) initStoreQueryables() (services.Service, error) {
 	var servs []services.Service
 
+	t.Cfg.Querier.ColdBlocksMinAge = t.Cfg.StoreGateway.ColdBlocksMinAge
+
 	//nolint:golint // I prefer this form over removing 'else', because it allows q to have smaller scope.
 	if q, err := initQueryableForEngine(t.Cfg.Storage.Engine, t.Cfg, t.Store, t.Overrides, prometheus.DefaultRegisterer); err != nil {
 		return nil, fmt.Errorf("failed to initialize querier for engine '%s': %v", t.Cfg.Storage.Engine, err)
@@ -357,6 +371,18 @@ func (t *Cortex) initStoreQueryables() (services.Service, error) {
 		if s, ok := q.(services.Service); ok {
 			servs = append(servs, s)
 		}
+		if bq, ok := q.(*querier.BlocksStoreQueryable); ok {
+			t.QuerierPrefetchJobs = storegateway.NewPrefetchJobs(bq.Prefetch, t.Overrides, util_log.Logger, prometheus.WrapRegistererWith(prometheus.Labels{"component": "querier"}, prometheus.DefaultRegisterer))
+		}
+	}
+
+	// The series snapshots written by the ingesters which left the ring are merged with the ingesters data.
+	if t.Cfg.Storage.Engine == storage.StorageEngineBlocks && t.Cfg.BlocksStorage.TSDB.SeriesSnapshotTTL > 0 {
+		sq, err := querier.NewSeriesSnapshotQueryableFromConfig(t.Cfg.BlocksStorage, t.Overrides, t.Ring, util_log.Logger, prometheus.DefaultRegisterer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize the series snapshots querier: %v", err)
+		}
+		t.StoreQueryables = append(t.StoreQueryables, sq)
 	}
 
 	if t.Cfg.Querier.SecondStoreEngine != "" {
@@ -422,6 +448,7 @@ func (t *Cortex) initIngesterService() (serv services.Service, err error) {
 	t.Cfg.Ingester.LifecyclerConfig.ListenPort = t.Cfg.Server.GRPCListenPort
 	t.Cfg.Ingester.DistributorShardingStrategy = t.Cfg.Distributor.ShardingStrategy
 	t.Cfg.Ingester.DistributorShardByAllLabels = t.Cfg.Distributor.ShardByAllLabels
+	t.Cfg.Ingester.CompactorBlockRanges = t.Cfg.Compactor.BlockRanges
 	t.Cfg.Ingester.StreamTypeFn = ingesterChunkStreaming(t.RuntimeConfig)
 	t.Cfg.Ingester.InstanceLimitsFn = ingesterInstanceLimits(t.RuntimeConfig)
 	t.tsdbIngesterConfig()
@@ -440,6 +467,16 @@ func (t *Cortex) initIngester() (serv services.Service, err error) {
 	return nil, nil
 }
 
+func (t *Cortex) initIngesterDirectPush() (serv services.Service, err error) {
+	if !t.Cfg.Ingester.DirectPushEnabled {
+		return nil, nil
+	}
+
+	t.API.RegisterIngesterDirectPush(t.Distributor, t.Ingester, t.Cfg.Distributor, t.Overrides)
+
+	return nil, nil
+}
+
 func (t *Cortex) initFlusher() (serv services.Service, err error) {
 	t.tsdbIngesterConfig()
 
@@ -467,6 +504,8 @@ func (t *Cortex) initChunkStore() (serv services.Service, err error) {
 		return
 	}
 
+	t.Cfg.ChunkStore.DisableChunkCacheWriteBack = !t.Cfg.Ingester.FlushChunkCacheWriteback
+
 	t.Store, err = storage.NewStore(t.Cfg.Storage, t.Cfg.ChunkStore, t.Cfg.Schema, t.Overrides, prometheus.DefaultRegisterer, t.TombstonesLoader, util_log.Logger)
 	if err != nil {
 		return
@@ -523,11 +562,12 @@ func (t *Cortex) initQueryFrontendTripperware() (serv services.Service, err erro
 		queryrange.PrometheusResponseExtractor{},
 		t.Cfg.Schema,
 		promql.EngineOpts{
-			Logger:           util_log.Logger,
-			Reg:              prometheus.DefaultRegisterer,
-			MaxSamples:       t.Cfg.Querier.MaxSamples,
-			Timeout:          t.Cfg.Querier.Timeout,
-			EnableAtModifier: t.Cfg.Querier.AtModifierEnabled,
+			Logger:               util_log.Logger,
+			Reg:                  prometheus.DefaultRegisterer,
+			MaxSamples:           t.Cfg.Querier.MaxSamples,
+			Timeout:              t.Cfg.Querier.Timeout,
+			EnableAtModifier:     t.Cfg.Querier.AtModifierEnabled,
+			EnableNegativeOffset: t.Cfg.Querier.AtModifierEnabled,
 			NoStepSubqueryIntervalFn: func(int64) int64 {
 				return t.Cfg.Querier.DefaultEvaluationInterval.Milliseconds()
 			},
@@ -561,7 +601,7 @@ func (t *Cortex) initQueryFrontend() (serv services.Service, err error) {
 	// Wrap roundtripper into Tripperware.
 	roundTripper = t.QueryFrontendTripperware(roundTripper)
 
-	handler := transport.NewHandler(t.Cfg.Frontend.Handler, roundTripper, util_log.Logger, prometheus.DefaultRegisterer)
+	handler := transport.NewHandler(t.Cfg.Frontend.Handler, roundTripper, t.Overrides, util_log.Logger, prometheus.DefaultRegisterer)
 	t.API.RegisterQueryFrontendHandler(handler)
 
 	if frontendV1 != nil {
@@ -661,13 +701,44 @@ func (t *Cortex) initRuler() (serv services.Service, err error) {
 	rulerRegisterer := prometheus.WrapRegistererWith(prometheus.Labels{"engine": "ruler"}, prometheus.DefaultRegisterer)
 	// TODO: Consider wrapping logger to differentiate from querier module logger
 	queryable, _, engine := querier.New(t.Cfg.Querier, t.Overrides, t.Distributor, t.StoreQueryables, t.TombstonesLoader, rulerRegisterer, util_log.Logger)
+	if t.Cfg.Ruler.TenantFederation.Enabled {
+		// The federated rule groups query the series of multiple tenants at once.
+		queryable = querier.NewSampleAndChunkQueryable(tenantfederation.NewQueryable(queryable, t.Cfg.TenantFederation.TenantLabelName, true))
+	}
 
-	managerFactory := ruler.DefaultTenantManagerFactory(t.Cfg.Ruler, t.Distributor, queryable, engine, t.Overrides, prometheus.DefaultRegisterer)
-	manager, err := ruler.NewDefaultMultiTenantManager(t.Cfg.Ruler, managerFactory, prometheus.DefaultRegisterer, util_log.Logger)
+	var managerFactory ruler.ManagerFactory
+	if t.Cfg.Ruler.QueryFrontend.Address != "" {
+		// The rule queries are evaluated through the query-frontend, while the embedded querier
+		// is still used to restore the state of the alerts.
+		t.Cfg.Ruler.QueryFrontend.PrometheusHTTPPrefix = t.Cfg.API.PrometheusHTTPPrefix
+		frontendClient, err := ruler.NewFrontendClient(t.Cfg.Ruler.QueryFrontend, prometheus.DefaultRegisterer)
+		if err != nil {
+			return nil, err
+		}
+		managerFactory = ruler.FrontendTenantManagerFactory(t.Cfg.Ruler, t.Distributor, queryable, frontendClient, t.Overrides, prometheus.DefaultRegisterer)
+	} else {
+		managerFactory = ruler.DefaultTenantManagerFactory(t.Cfg.Ruler, t.Distributor, queryable, engine, t.Overrides, prometheus.DefaultRegisterer)
+	}
+	if t.Cfg.Ruler.AlertState.SnapshotInterval > 0 {
+		if !t.Cfg.Ruler.StoreConfig.IsDefaults() {
+			return nil, errors.New("the alert state snapshots require the ruler storage to be configured with -ruler-storage.*")
+		}
+		alertStateStore, err := ruler.NewAlertStateStoreFromConfig(context.Background(), t.Cfg.RulerStorage, t.Overrides, util_log.Logger, prometheus.DefaultRegisterer)
+		if err != nil {
+			return nil, err
+		}
+		managerFactory = ruler.AlertStateManagerFactory(t.Cfg.Ruler.AlertState, alertStateStore, managerFactory, prometheus.DefaultRegisterer)
+	}
+	manager, err := ruler.NewDefaultMultiTenantManager(t.Cfg.Ruler, managerFactory, t.Overrides, prometheus.DefaultRegisterer, util_log.Logger)
 	if err != nil {
 		return nil, err
 	}
 
+	var metricCollisions *ruler.MetricCollisionChecker
+	if t.Cfg.Ruler.MetricProvenance.InjectRuleGroupLabel {
+		metricCollisions = ruler.NewMetricCollisionChecker(t.Cfg.Ruler.MetricProvenance, queryable, t.Overrides, prometheus.DefaultRegisterer, util_log.Logger)
+	}
+
 	t.Ruler, err = ruler.NewRuler(
 		t.Cfg.Ruler,
 		manager,
@@ -675,6 +746,7 @@ func (t *Cortex) initRuler() (serv services.Service, err error) {
 		util_log.Logger,
 		t.RulerStorage,
 		t.Overrides,
+		metricCollisions,
 	)
 	if err != nil {
 		return
@@ -685,7 +757,8 @@ func (t *Cortex) initRuler() (serv services.Service, err error) {
 
 	// If the API is enabled, register the Ruler API
 	if t.Cfg.Ruler.EnableAPI {
-		t.API.RegisterRulerAPI(ruler.NewAPI(t.Ruler, t.RulerStorage, util_log.Logger))
+		dryRun := ruler.NewDryRunEvaluator(t.Cfg.Ruler, engine, queryable, t.Overrides, util_log.Logger)
+		t.API.RegisterRulerAPI(ruler.NewAPI(t.Ruler, t.RulerStorage, dryRun, util_log.Logger))
 	}
 
 	return t.Ruler, nil
@@ -826,6 +899,26 @@ func (t *Cortex) initQueryScheduler() (services.Service, error) {
 	return s, nil
 }
 
+func (t *Cortex) initUsage() (services.Service, error) {
+	var bucketClient objstore.Bucket
+	if t.Cfg.Storage.Engine == storage.StorageEngineBlocks {
+		var err error
+		bucketClient, err = bucket.NewClient(context.Background(), t.Cfg.BlocksStorage.Bucket, "usage", util_log.Logger, prometheus.DefaultRegisterer)
+		if err != nil {
+			return nil, errors.Wrap(err, "usage init")
+		}
+	}
+
+	// The rule store is not used if nil, which is the case in single-binary mode when the rule storage is not configured.
+	var ruleStore usage.RuleStore
+	if t.RulerStorage != nil {
+		ruleStore = t.RulerStorage
+	}
+
+	t.API.RegisterUsage(usage.NewAPI(t.Cfg.Usage, t.Distributor, ruleStore, bucketClient, t.Overrides, util_log.Logger, prometheus.DefaultRegisterer))
+	return nil, nil
+}
+
 func (t *Cortex) setupModuleManager() error {
 	mm := modules.NewManager(util_log.Logger)
 
@@ -844,6 +937,7 @@ func (t *Cortex) setupModuleManager() error {
 	mm.RegisterModule(DeleteRequestsStore, t.initDeleteRequestsStore, modules.UserInvisibleModule)
 	mm.RegisterModule(Ingester, t.initIngester)
 	mm.RegisterModule(IngesterService, t.initIngesterService, modules.UserInvisibleModule)
+	mm.RegisterModule(IngesterDirectPush, t.initIngesterDirectPush, modules.UserInvisibleModule)
 	mm.RegisterModule(Flusher, t.initFlusher)
 	mm.RegisterModule(Queryable, t.initQueryable, modules.UserInvisibleModule)
 	mm.RegisterModule(Querier, t.initQuerier)
@@ -862,6 +956,7 @@ func (t *Cortex) setupModuleManager() error {
 	mm.RegisterModule(Purger, nil)
 	mm.RegisterModule(QueryScheduler, t.initQueryScheduler)
 	mm.RegisterModule(TenantFederation, t.initTenantFederation, modules.UserInvisibleModule)
+	mm.RegisterModule(Usage, t.initUsage)
 	mm.RegisterModule(All, nil)
 
 	// Add dependencies
@@ -877,10 +972,11 @@ func (t *Cortex) setupModuleManager() error {
 		Store:                    {Overrides, DeleteRequestsStore},
 		Ingester:                 {IngesterService, API},
 		IngesterService:          {Overrides, Store, RuntimeConfig, MemberlistKV},
+		IngesterDirectPush:       {Ingester, Distributor},
 		Flusher:                  {Store, API},
 		Queryable:                {Overrides, DistributorService, Store, Ring, API, StoreQueryable, MemberlistKV},
 		Querier:                  {TenantFederation},
-		StoreQueryable:           {Overrides, Store, MemberlistKV},
+		StoreQueryable:           {Overrides, Store, MemberlistKV, Ring},
 		QueryFrontendTripperware: {API, Overrides, DeleteRequestsStore},
 		QueryFrontend:            {QueryFrontendTripperware},
 		QueryScheduler:           {API, Overrides},
@@ -895,7 +991,8 @@ func (t *Cortex) setupModuleManager() error {
 		TenantDeletion:           {Store, API, Overrides},
 		Purger:                   {ChunksPurger, TenantDeletion},
 		TenantFederation:         {Queryable},
-		All:                      {QueryFrontend, Querier, Ingester, Distributor, TableManager, Purger, StoreGateway, Ruler},
+		Usage:                    {API, DistributorService, RulerStorage, Overrides},
+		All:                      {QueryFrontend, Querier, Ingester, Distributor, IngesterDirectPush, TableManager, Purger, StoreGateway, Ruler, Usage},
 	}
 	for mod, targets := range deps {
 		if err := mm.AddDependency(mod, targets...); err != nil {
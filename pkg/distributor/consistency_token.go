@@ -0,0 +1,93 @@
+package distributor
+
+import (
+	"context"
+	"flag"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	ingester_client "github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/ring"
+)
+
+// ConsistencyTokenConfig configures the read-your-writes guarantee of the queries carrying the
+// consistency token of a push.
+type ConsistencyTokenConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	MaxWait time.Duration `yaml:"max_wait"`
+}
+
+// RegisterFlagsWithPrefix registers flags with prefix.
+func (cfg *ConsistencyTokenConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, prefix+"enabled", false, "True to return a consistency token in the "+ingester_client.ConsistencyTokenHeaderName+" header of the push responses. The queries sending the token back in the same header wait for the responses of all the ingesters which may have received the push, instead of a quorum of them, so that they see the pushed samples. If the ingesters ring has changed since the push, all the ingesters are queried. This option must be set on the distributors and on the queriers.")
+	f.DurationVar(&cfg.MaxWait, prefix+"max-wait", time.Second, "Max time a query carrying a consistency token waits for the responses of the remaining ingesters once a quorum of them responded. When expired, the responses received so far are returned, and the query response has the "+ingester_client.DegradedConsistencyHeaderName+" header, so that it doesn't get cached by the query-frontend.")
+}
+
+// recordConsistencyToken passes the consistency token of a successful push to the recorder of
+// the push, if any.
+func (d *Distributor) recordConsistencyToken(ctx context.Context, maxTimestampMs int64) {
+	if !d.cfg.ConsistencyToken.Enabled {
+		return
+	}
+	recorder := ingester_client.ConsistencyTokenRecorderFromContext(ctx)
+	if recorder == nil {
+		return
+	}
+
+	hash, err := d.ingestersRingHash()
+	if err != nil {
+		return
+	}
+	recorder(ingester_client.ConsistencyToken{MaxTimestampMs: maxTimestampMs, RingHash: hash})
+}
+
+// queryReplicationSet runs f on the ingesters of the replication set like ReplicationSet.Do(). If
+// the query carries the consistency token of a push whose samples may be in the queried time range,
+// it waits for all the ingesters for up to the configured max wait. If the ring has changed since
+// the push, all the ingesters of the ring are queried. If not all of them responded within the
+// max wait, the degraded consistency is reported to the recorder of the query, if any.
+func (d *Distributor) queryReplicationSet(ctx context.Context, replicationSet ring.ReplicationSet, fromMs int64, f func(context.Context, *ring.InstanceDesc) (interface{}, error)) ([]interface{}, error) {
+	token, ok := ingester_client.ConsistencyTokenFromContext(ctx)
+	if !d.cfg.ConsistencyToken.Enabled || !ok || fromMs > token.MaxTimestampMs {
+		return replicationSet.Do(ctx, d.cfg.ExtraQueryDelay, f)
+	}
+
+	if hash, err := d.ingestersRingHash(); err != nil || hash != token.RingHash {
+		// The ingesters which received the push may not be in the replication set anymore.
+		if all, err := d.ingestersRing.GetReplicationSetForOperation(ring.Read); err == nil {
+			replicationSet = all
+		}
+	}
+
+	d.consistencyTokenWaits.Inc()
+	results, all, err := replicationSet.DoAndWaitAll(ctx, d.cfg.ConsistencyToken.MaxWait, f)
+	if err == nil && !all {
+		d.consistencyTokenWaitTimeouts.Inc()
+		if recorder := ingester_client.DegradedConsistencyRecorderFromContext(ctx); recorder != nil {
+			recorder()
+		}
+	}
+	return results, err
+}
+
+// ingestersRingHash returns a hash of the ingesters receiving the pushes.
+func (d *Distributor) ingestersRingHash() (uint32, error) {
+	replicationSet, err := d.ingestersRing.GetReplicationSetForOperation(ring.Write)
+	if err != nil {
+		return 0, err
+	}
+
+	instances := make([]string, 0, len(replicationSet.Instances))
+	for _, instance := range replicationSet.Instances {
+		instances = append(instances, instance.Addr+"/"+instance.Zone)
+	}
+	sort.Strings(instances)
+
+	h := fnv.New32a()
+	for _, instance := range instances {
+		_, _ = h.Write([]byte(instance))
+		_, _ = h.Write([]byte{0})
+	}
+	return h.Sum32(), nil
+}
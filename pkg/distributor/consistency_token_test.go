@@ -0,0 +1,148 @@
+package distributor
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	ingester_client "github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func TestDistributor_Push_ShouldRecordTheConsistencyToken(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		ds, _, r, _ := prepare(t, prepConfig{
+			numIngesters:            3,
+			happyIngesters:          3,
+			numDistributors:         1,
+			shardByAllLabels:        true,
+			consistencyTokenEnabled: enabled,
+		})
+		defer stopAll(ds, r)
+
+		var recorded []ingester_client.ConsistencyToken
+		ctx := user.InjectOrgID(context.Background(), "user")
+		ctx = ingester_client.ContextWithConsistencyTokenRecorder(ctx, func(token ingester_client.ConsistencyToken) {
+			recorded = append(recorded, token)
+		})
+
+		_, err := ds[0].Push(ctx, makeWriteRequest(1000, 10, 0))
+		require.NoError(t, err)
+
+		if !enabled {
+			assert.Empty(t, recorded)
+			continue
+		}
+
+		expectedHash, err := ds[0].ingestersRingHash()
+		require.NoError(t, err)
+		assert.Equal(t, []ingester_client.ConsistencyToken{{MaxTimestampMs: 1009, RingHash: expectedHash}}, recorded)
+	}
+}
+
+func TestDistributor_QueryStream_ShouldWaitForAllIngestersWithAConsistencyToken(t *testing.T) {
+	tests := map[string]struct {
+		token                *ingester_client.ConsistencyToken
+		wrongRingHash        bool
+		from                 int64
+		maxWait              time.Duration
+		expectedSeries       int
+		expectedWaits        int
+		expectedWaitTimeouts int
+		expectedDegraded     bool
+	}{
+		"should return the responses of the quorum without a token": {
+			expectedSeries: 0,
+		},
+		"should wait for the lagging ingester with a token": {
+			token:          &ingester_client.ConsistencyToken{MaxTimestampMs: 1009},
+			expectedSeries: 10,
+			expectedWaits:  1,
+		},
+		"should wait for the lagging ingester with a token of a previous ring": {
+			token:          &ingester_client.ConsistencyToken{MaxTimestampMs: 1009},
+			wrongRingHash:  true,
+			expectedSeries: 10,
+			expectedWaits:  1,
+		},
+		"should not wait if the pushed samples are before the queried time range": {
+			token:          &ingester_client.ConsistencyToken{MaxTimestampMs: 1009},
+			from:           2000,
+			expectedSeries: 0,
+		},
+		"should return the responses of the quorum once the max wait has expired": {
+			token:                &ingester_client.ConsistencyToken{MaxTimestampMs: 1009},
+			maxWait:              10 * time.Millisecond,
+			expectedSeries:       0,
+			expectedWaits:        1,
+			expectedWaitTimeouts: 1,
+			expectedDegraded:     true,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ds, ingesters, r, _ := prepare(t, prepConfig{
+				numIngesters:            3,
+				happyIngesters:          3,
+				numDistributors:         1,
+				shardByAllLabels:        true,
+				consistencyTokenEnabled: true,
+				consistencyTokenMaxWait: testData.maxWait,
+			})
+			defer stopAll(ds, r)
+
+			ctx := user.InjectOrgID(context.Background(), "user")
+			_, err := ds[0].Push(ctx, makeWriteRequest(1000, 10, 0))
+			require.NoError(t, err)
+
+			// The push returns once the quorum is reached, so we wait for the last ingester.
+			for i := range ingesters {
+				test.Poll(t, time.Second, 10, func() interface{} {
+					return len(ingesters[i].series())
+				})
+			}
+
+			// Simulate the write being received only by the last ingester, which is slower to respond.
+			for i := range ingesters {
+				ingesters[i].Lock()
+				if i < len(ingesters)-1 {
+					ingesters[i].timeseries = map[uint32]*cortexpb.PreallocTimeseries{}
+				} else {
+					ingesters[i].queryDelay = 200 * time.Millisecond
+				}
+				ingesters[i].Unlock()
+			}
+
+			if testData.token != nil {
+				token := *testData.token
+				token.RingHash, err = ds[0].ingestersRingHash()
+				require.NoError(t, err)
+				if testData.wrongRingHash {
+					token.RingHash++
+				}
+				ctx = ingester_client.ContextWithConsistencyToken(ctx, token)
+			}
+
+			degraded := false
+			ctx = ingester_client.ContextWithDegradedConsistencyRecorder(ctx, func() { degraded = true })
+
+			resp, err := ds[0].QueryStream(ctx, model.Time(testData.from), math.MaxInt32, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+"))
+			require.NoError(t, err)
+			assert.Len(t, resp.Chunkseries, testData.expectedSeries)
+
+			assert.Equal(t, float64(testData.expectedWaits), testutil.ToFloat64(ds[0].consistencyTokenWaits))
+			assert.Equal(t, float64(testData.expectedWaitTimeouts), testutil.ToFloat64(ds[0].consistencyTokenWaitTimeouts))
+			assert.Equal(t, testData.expectedDegraded, degraded)
+		})
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/grafana/dskit/backoff"
 	"github.com/grafana/dskit/services"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -24,18 +27,22 @@ import (
 	"github.com/weaveworks/common/instrument"
 	"github.com/weaveworks/common/user"
 	"go.uber.org/atomic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	ingester_client "github.com/cortexproject/cortex/pkg/ingester/client"
 	"github.com/cortexproject/cortex/pkg/prom1/storage/metric"
 	"github.com/cortexproject/cortex/pkg/ring"
 	ring_client "github.com/cortexproject/cortex/pkg/ring/client"
+	"github.com/cortexproject/cortex/pkg/ring/kv"
 	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/extract"
 	"github.com/cortexproject/cortex/pkg/util/limiter"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 	util_math "github.com/cortexproject/cortex/pkg/util/math"
+	"github.com/cortexproject/cortex/pkg/util/push"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
@@ -45,8 +52,14 @@ var (
 	supportedShardingStrategies = []string{util.ShardingStrategyDefault, util.ShardingStrategyShuffle}
 
 	// Validation errors.
-	errInvalidShardingStrategy = errors.New("invalid sharding strategy")
-	errInvalidTenantShardSize  = errors.New("invalid tenant shard size, the value must be greater than 0")
+	errInvalidShardingStrategy    = errors.New("invalid sharding strategy")
+	errInvalidTenantShardSize     = errors.New("invalid tenant shard size, the value must be greater than 0")
+	errInvalidRateCoordination    = errors.New("invalid rate coordination period, the value must be greater than 0")
+	errRateCoordinationKVStore    = errors.New("the global-coordinated ingestion rate strategy doesn't support memberlist as distributors ring KV store")
+	errInvalidShadowWrite         = errors.New("invalid shadow write config, the queue size and the concurrency must be greater than 0")
+	errInvalidMinHealthyIngesters = errors.New("invalid min healthy ingesters percentage, the value must be in the range [0, 100]")
+	errInvalidPushStream          = errors.New("invalid push stream config, the message size must be greater than 0")
+	errInvalidConsistencyToken    = errors.New("invalid consistency token config, the max wait must be greater than 0")
 
 	// Distributor instance limits errors.
 	errTooManyInflightPushRequests    = errors.New("too many inflight push requests in distributor")
@@ -81,6 +94,15 @@ type Distributor struct {
 
 	// Per-user rate limiter.
 	ingestionRateLimiter *limiter.RateLimiter
+	exemplarsRateLimiter *limiter.RateLimiter
+
+	// Tracks the per-tenant rates across distributors, when the global-coordinated
+	// ingestion rate strategy is enabled (nil otherwise).
+	ingestionRateCoordinator *ingestionRateCoordinator
+
+	// Pushes the metadata to the ingesters asynchronously, when enabled (nil otherwise).
+	metadataBatcher *metadataBatcher
+	shadowWriter    *shadowWriter
 
 	// Manager for subservices (HA Tracker, distributor ring and client pool)
 	subservices        *services.Manager
@@ -91,6 +113,12 @@ type Distributor struct {
 	ingestionRate        *util_math.EwmaRate
 	inflightPushRequests atomic.Int64
 
+	// Whether the pushes are currently rejected because of too few healthy ingesters.
+	tooFewHealthyIngesters atomic.Bool
+
+	// The ingesters not supporting the push stream.
+	pushStreamSupport *pushStreamSupport
+
 	// Metrics
 	queryDuration                    *instrument.HistogramCollector
 	receivedSamples                  *prometheus.CounterVec
@@ -101,12 +129,18 @@ type Distributor struct {
 	incomingMetadata                 *prometheus.CounterVec
 	nonHASamples                     *prometheus.CounterVec
 	dedupedSamples                   *prometheus.CounterVec
+	strippedLabels                   *prometheus.CounterVec
 	labelsHistogram                  prometheus.Histogram
 	ingesterAppends                  *prometheus.CounterVec
 	ingesterAppendFailures           *prometheus.CounterVec
+	ingesterPushStreams              *prometheus.CounterVec
+	consistencyTokenWaits            prometheus.Counter
+	consistencyTokenWaitTimeouts     prometheus.Counter
+	metadataSendFailures             *prometheus.CounterVec
 	ingesterQueries                  *prometheus.CounterVec
 	ingesterQueryFailures            *prometheus.CounterVec
 	replicationFactor                prometheus.Gauge
+	tooFewHealthyIngestersRejected   prometheus.Counter
 	latestSeenSampleTimestampPerUser *prometheus.GaugeVec
 }
 
@@ -126,7 +160,8 @@ type Config struct {
 	ExtendWrites     bool   `yaml:"extend_writes"`
 
 	// Distributors ring
-	DistributorRing RingConfig `yaml:"ring"`
+	DistributorRing        RingConfig    `yaml:"ring"`
+	RateCoordinationPeriod time.Duration `yaml:"rate_coordination_period"`
 
 	// for testing and for extending the ingester by adding calls to the client
 	IngesterClientFactory ring_client.PoolFactory `yaml:"-"`
@@ -140,6 +175,23 @@ type Config struct {
 
 	// Limits for distributor
 	InstanceLimits InstanceLimits `yaml:"instance_limits"`
+
+	// Asynchronous metadata push.
+	MetadataSendPeriod  time.Duration  `yaml:"metadata_send_period"`
+	MetadataSendBackoff backoff.Config `yaml:"metadata_send_backoff"`
+
+	// Forwarding to the per-tenant shadow remote-write endpoints.
+	ShadowWrite ShadowWriteConfig `yaml:"shadow_write"`
+
+	// Fast-fail of the pushes when too many ingesters are unhealthy.
+	MinHealthyIngestersPercentage    float64       `yaml:"min_healthy_ingesters_percentage"`
+	TooFewHealthyIngestersRetryAfter time.Duration `yaml:"too_few_healthy_ingesters_retry_after"`
+
+	// Streaming of the large write requests to the ingesters.
+	PushStream PushStreamConfig `yaml:"push_stream"`
+
+	// Read-your-writes guarantee of the queries.
+	ConsistencyToken ConsistencyTokenConfig `yaml:"consistency_token"`
 }
 
 type InstanceLimits struct {
@@ -160,8 +212,20 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cfg.ShardingStrategy, "distributor.sharding-strategy", util.ShardingStrategyDefault, fmt.Sprintf("The sharding strategy to use. Supported values are: %s.", strings.Join(supportedShardingStrategies, ", ")))
 	f.BoolVar(&cfg.ExtendWrites, "distributor.extend-writes", true, "Try writing to an additional ingester in the presence of an ingester not in the ACTIVE state. It is useful to disable this along with -ingester.unregister-on-shutdown=false in order to not spread samples to extra ingesters during rolling restarts with consistent naming.")
 
+	f.DurationVar(&cfg.RateCoordinationPeriod, "distributor.rate-coordination-period", 5*time.Second, "Period at which each distributor publishes its observed per-tenant ingestion rates to the distributors ring KV store, when the global-coordinated ingestion rate strategy is enabled.")
+
 	f.Float64Var(&cfg.InstanceLimits.MaxIngestionRate, "distributor.instance-limits.max-ingestion-rate", 0, "Max ingestion rate (samples/sec) that this distributor will accept. This limit is per-distributor, not per-tenant. Additional push requests will be rejected. Current ingestion rate is computed as exponentially weighted moving average, updated every second. 0 = unlimited.")
 	f.IntVar(&cfg.InstanceLimits.MaxInflightPushRequests, "distributor.instance-limits.max-inflight-push-requests", 0, "Max inflight push requests that this distributor can handle. This limit is per-distributor, not per-tenant. Additional requests will be rejected. 0 = unlimited.")
+
+	f.DurationVar(&cfg.MetadataSendPeriod, "distributor.metadata-send-period", 0, "Period at which the received metadata is pushed to the ingesters asynchronously, aggregated across the write requests and deduplicated by tenant and metric name. Each ingester is retried independently according to the -distributor.metadata-send.backoff-* settings. 0 to push the metadata along with the series.")
+	cfg.MetadataSendBackoff.RegisterFlagsWithPrefix("distributor.metadata-send", f)
+	cfg.ShadowWrite.RegisterFlagsWithPrefix("distributor.shadow-write.", f)
+
+	f.Float64Var(&cfg.MinHealthyIngestersPercentage, "distributor.min-healthy-ingesters-percentage", 0, "Minimum percentage of healthy ingesters in the ring, in the range [0, 100], below which the push requests are rejected with 503 instead of being sent to the ingesters. An ingester is healthy if its heartbeat is not timed out, whatever its state (eg. a LEAVING ingester is healthy). When zone-awareness is enabled, the zones with the most unhealthy ingesters are not counted, up to the number of zones which can be unavailable without losing the quorum. 0 to disable.")
+	f.DurationVar(&cfg.TooFewHealthyIngestersRetryAfter, "distributor.too-few-healthy-ingesters-retry-after", 10*time.Second, "Value of the Retry-After header of the push requests rejected because of too few healthy ingesters.")
+
+	cfg.PushStream.RegisterFlagsWithPrefix("distributor.push-stream.", f)
+	cfg.ConsistencyToken.RegisterFlagsWithPrefix("distributor.consistency-token.", f)
 }
 
 // Validate config and returns error on failure
@@ -174,6 +238,31 @@ func (cfg *Config) Validate(limits validation.Limits) error {
 		return errInvalidTenantShardSize
 	}
 
+	if limits.IngestionRateStrategy == validation.GlobalCoordinatedIngestionRateStrategy {
+		if cfg.RateCoordinationPeriod <= 0 {
+			return errInvalidRateCoordination
+		}
+		if cfg.DistributorRing.KVStore.Store == "memberlist" {
+			return errRateCoordinationKVStore
+		}
+	}
+
+	if cfg.ShadowWrite.QueueSize <= 0 || cfg.ShadowWrite.Concurrency <= 0 {
+		return errInvalidShadowWrite
+	}
+
+	if cfg.MinHealthyIngestersPercentage < 0 || cfg.MinHealthyIngestersPercentage > 100 {
+		return errInvalidMinHealthyIngesters
+	}
+
+	if cfg.PushStream.ThresholdBytes > 0 && cfg.PushStream.MessageSizeBytes <= 0 {
+		return errInvalidPushStream
+	}
+
+	if cfg.ConsistencyToken.Enabled && cfg.ConsistencyToken.MaxWait <= 0 {
+		return errInvalidConsistencyToken
+	}
+
 	return cfg.HATrackerConfig.Validate()
 }
 
@@ -204,13 +293,15 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 	// Create the configured ingestion rate limit strategy (local or global). In case
 	// it's an internal dependency and can't join the distributors ring, we skip rate
 	// limiting.
-	var ingestionRateStrategy limiter.RateLimiterStrategy
+	var ingestionRateStrategy, exemplarsRateStrategy limiter.RateLimiterStrategy
 	var distributorsLifeCycler *ring.Lifecycler
 	var distributorsRing *ring.Ring
+	var rateCoordinator *ingestionRateCoordinator
 
 	if !canJoinDistributorsRing {
 		ingestionRateStrategy = newInfiniteIngestionRateStrategy()
-	} else if limits.IngestionRateStrategy() == validation.GlobalIngestionRateStrategy {
+		exemplarsRateStrategy = newInfiniteIngestionRateStrategy()
+	} else if strategy := limits.IngestionRateStrategy(); strategy == validation.GlobalIngestionRateStrategy || strategy == validation.GlobalCoordinatedIngestionRateStrategy {
 		distributorsLifeCycler, err = ring.NewLifecycler(cfg.DistributorRing.ToLifecyclerConfig(), nil, "distributor", ring.DistributorRingKey, true, reg)
 		if err != nil {
 			return nil, err
@@ -222,22 +313,38 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		}
 		subservices = append(subservices, distributorsLifeCycler, distributorsRing)
 
-		ingestionRateStrategy = newGlobalIngestionRateStrategy(limits, distributorsLifeCycler)
+		if strategy == validation.GlobalCoordinatedIngestionRateStrategy {
+			ratesClient, err := kv.NewClient(cfg.DistributorRing.KVStore, GetDistributorRatesCodec(), kv.RegistererWithKVName(reg, "distributor-rates"))
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to initialize distributor rates KV store client")
+			}
+
+			rateCoordinator = newIngestionRateCoordinator(cfg.DistributorRing.InstanceID, cfg.RateCoordinationPeriod, ratesClient, reg, log)
+			subservices = append(subservices, rateCoordinator)
+			ingestionRateStrategy = newGlobalCoordinatedIngestionRateStrategy(limits, distributorsLifeCycler, rateCoordinator)
+		} else {
+			ingestionRateStrategy = newGlobalIngestionRateStrategy(limits, distributorsLifeCycler)
+		}
+		exemplarsRateStrategy = newGlobalExemplarsRateStrategy(limits, distributorsLifeCycler)
 	} else {
 		ingestionRateStrategy = newLocalIngestionRateStrategy(limits)
+		exemplarsRateStrategy = newLocalExemplarsRateStrategy(limits)
 	}
 
 	d := &Distributor{
-		cfg:                    cfg,
-		log:                    log,
-		ingestersRing:          ingestersRing,
-		ingesterPool:           NewPool(cfg.PoolConfig, ingestersRing, cfg.IngesterClientFactory, log),
-		distributorsLifeCycler: distributorsLifeCycler,
-		distributorsRing:       distributorsRing,
-		limits:                 limits,
-		ingestionRateLimiter:   limiter.NewRateLimiter(ingestionRateStrategy, 10*time.Second),
-		HATracker:              haTracker,
-		ingestionRate:          util_math.NewEWMARate(0.2, instanceIngestionRateTickInterval),
+		cfg:                      cfg,
+		log:                      log,
+		ingestersRing:            ingestersRing,
+		ingesterPool:             NewPool(cfg.PoolConfig, ingestersRing, cfg.IngesterClientFactory, log),
+		distributorsLifeCycler:   distributorsLifeCycler,
+		distributorsRing:         distributorsRing,
+		limits:                   limits,
+		ingestionRateLimiter:     limiter.NewRateLimiter(ingestionRateStrategy, 10*time.Second),
+		exemplarsRateLimiter:     limiter.NewRateLimiter(exemplarsRateStrategy, 10*time.Second),
+		ingestionRateCoordinator: rateCoordinator,
+		pushStreamSupport:        newPushStreamSupport(),
+		HATracker:                haTracker,
+		ingestionRate:            util_math.NewEWMARate(0.2, instanceIngestionRateTickInterval),
 
 		queryDuration: instrument.NewHistogramCollector(promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
 			Namespace: "cortex",
@@ -285,6 +392,11 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 			Name:      "distributor_deduped_samples_total",
 			Help:      "The total number of deduplicated samples.",
 		}, []string{"user", "cluster"}),
+		strippedLabels: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_stripped_labels_total",
+			Help:      "The total number of labels stripped from the received series because their name is not allowed.",
+		}, []string{"user"}),
 		labelsHistogram: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
 			Namespace: "cortex",
 			Name:      "labels_per_sample",
@@ -301,6 +413,26 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 			Name:      "distributor_ingester_append_failures_total",
 			Help:      "The total number of failed batch appends sent to ingesters.",
 		}, []string{"ingester", "type"}),
+		ingesterPushStreams: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_ingester_push_streams_total",
+			Help:      "The total number of batch appends streamed to ingesters, because larger than the push stream threshold.",
+		}, []string{"ingester"}),
+		consistencyTokenWaits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_consistency_token_query_waits_total",
+			Help:      "The total number of queries to the ingesters which waited for all of them, because carrying a consistency token.",
+		}),
+		consistencyTokenWaitTimeouts: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_consistency_token_query_wait_timeouts_total",
+			Help:      "The total number of queries to the ingesters carrying a consistency token which didn't get the responses of all of them within the max wait.",
+		}),
+		metadataSendFailures: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_metadata_send_failures_total",
+			Help:      "The total number of failed asynchronous metadata pushes to ingesters, including the retried ones.",
+		}, []string{"ingester"}),
 		ingesterQueries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Namespace: "cortex",
 			Name:      "distributor_ingester_queries_total",
@@ -316,6 +448,11 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 			Name:      "distributor_replication_factor",
 			Help:      "The configured replication factor.",
 		}),
+		tooFewHealthyIngestersRejected: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_push_rejected_too_few_healthy_ingesters_total",
+			Help:      "The total number of push requests rejected because the percentage of healthy ingesters is below the configured minimum.",
+		}),
 		latestSeenSampleTimestampPerUser: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
 			Name: "cortex_distributor_latest_seen_sample_timestamp_seconds",
 			Help: "Unix timestamp of latest received sample per user.",
@@ -349,7 +486,14 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 	d.replicationFactor.Set(float64(ingestersRing.ReplicationFactor()))
 	d.activeUsers = util.NewActiveUsersCleanupWithDefaultValues(d.cleanupInactiveUser)
 
-	subservices = append(subservices, d.ingesterPool, d.activeUsers)
+	if cfg.MetadataSendPeriod > 0 {
+		d.metadataBatcher = newMetadataBatcher(cfg.MetadataSendPeriod, d.sendMetadata, log)
+		subservices = append(subservices, d.metadataBatcher)
+	}
+
+	d.shadowWriter = newShadowWriter(cfg.ShadowWrite, limits, reg, log)
+
+	subservices = append(subservices, d.ingesterPool, d.activeUsers, d.shadowWriter)
 	d.subservices, err = services.NewManager(subservices...)
 	if err != nil {
 		return nil, err
@@ -401,12 +545,15 @@ func (d *Distributor) cleanupInactiveUser(userID string) {
 	d.incomingMetadata.DeleteLabelValues(userID)
 	d.nonHASamples.DeleteLabelValues(userID)
 	d.latestSeenSampleTimestampPerUser.DeleteLabelValues(userID)
+	d.strippedLabels.DeleteLabelValues(userID)
 
 	if err := util.DeleteMatchingLabels(d.dedupedSamples, map[string]string{"user": userID}); err != nil {
 		level.Warn(d.log).Log("msg", "failed to remove cortex_distributor_deduped_samples_total metric for user", "user", userID, "err", err)
 	}
 
 	validation.DeletePerUserValidationMetrics(userID, d.log)
+	push.DeletePerUserMetrics(userID)
+	d.shadowWriter.cleanupUser(userID)
 }
 
 // Called after distributor is asked to stop via StopAsync.
@@ -469,10 +616,51 @@ func removeLabel(labelName string, labels *[]cortexpb.LabelAdapter) {
 	}
 }
 
+// Removes the labels whose name is not allowed, and returns the number of removed labels.
+func removeNotAllowedLabels(allowedLabelNames map[string]struct{}, labels *[]cortexpb.LabelAdapter) int {
+	kept := (*labels)[:0]
+	for _, l := range *labels {
+		if validation.IsLabelNameAllowed(allowedLabelNames, l.Name) {
+			kept = append(kept, l)
+		}
+	}
+
+	removed := len(*labels) - len(kept)
+	*labels = kept
+	return removed
+}
+
+// Merges the samples and exemplars of src into dst, for series collapsing onto the same labels
+// once the labels whose name is not allowed have been removed. Samples with the same timestamp
+// of a previous one are discarded. Returns the number of discarded samples.
+func mergeSeries(dst, src cortexpb.PreallocTimeseries) int {
+	merged := append(dst.Samples, src.Samples...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].TimestampMs < merged[j].TimestampMs
+	})
+
+	dst.Samples = merged[:0]
+	for _, s := range merged {
+		if n := len(dst.Samples); n > 0 && dst.Samples[n-1].TimestampMs == s.TimestampMs {
+			continue
+		}
+		dst.Samples = append(dst.Samples, s)
+	}
+
+	if len(src.Exemplars) > 0 {
+		dst.Exemplars = append(dst.Exemplars, src.Exemplars...)
+		sort.SliceStable(dst.Exemplars, func(i, j int) bool {
+			return dst.Exemplars[i].TimestampMs < dst.Exemplars[j].TimestampMs
+		})
+	}
+
+	return len(merged) - len(dst.Samples)
+}
+
 // Returns a boolean that indicates whether or not we want to remove the replica label going forward,
 // and an error that indicates whether we want to accept samples based on the cluster/replica found in ts.
 // nil for the error means accept the sample.
-func (d *Distributor) checkSample(ctx context.Context, userID, cluster, replica string) (removeReplicaLabel bool, _ error) {
+func (d *Distributor) checkSample(ctx context.Context, userID, cluster, replica string, dryRun bool) (removeReplicaLabel bool, _ error) {
 	// If the sample doesn't have either HA label, accept it.
 	// At the moment we want to accept these samples by default.
 	if cluster == "" || replica == "" {
@@ -486,7 +674,12 @@ func (d *Distributor) checkSample(ctx context.Context, userID, cluster, replica
 
 	// At this point we know we have both HA labels, we should lookup
 	// the cluster/instance here to see if we want to accept this sample.
-	err := d.HATracker.checkReplica(ctx, userID, cluster, replica, time.Now())
+	var err error
+	if dryRun {
+		err = d.HATracker.checkReplicaDryRun(userID, cluster, replica, time.Now())
+	} else {
+		err = d.HATracker.checkReplica(ctx, userID, cluster, replica, time.Now())
+	}
 	// checkReplica should only have returned an error if there was a real error talking to Consul, or if the replica labels don't match.
 	if err != nil { // Don't accept the sample.
 		return false, err
@@ -494,56 +687,158 @@ func (d *Distributor) checkSample(ctx context.Context, userID, cluster, replica
 	return true, nil
 }
 
-// Validates a single series from a write request. Will remove labels if
-// any are configured to be dropped for the user ID.
-// Returns the validated series with it's labels/samples, and any error.
-// The returned error may retain the series labels.
-func (d *Distributor) validateSeries(ts cortexpb.PreallocTimeseries, userID string, skipLabelNameValidation bool) (cortexpb.PreallocTimeseries, validation.ValidationError) {
-	d.labelsHistogram.Observe(float64(len(ts.Labels)))
-	if err := validation.ValidateLabels(d.limits, userID, ts.Labels, skipLabelNameValidation); err != nil {
+// Validates a single series from a write request, with the limits of the user
+// resolved for the request. Will remove labels if any are configured to be dropped
+// for the user ID.
+// Returns the validated series with it's labels/samples, and any error. The series
+// is validated in place, so the returned series is the given one, with only the
+// exemplars passing the validation.
+// The returned error may retain the series labels. On a dry run, the exemplars
+// rate limiter tokens are not consumed. The label names already validated for the
+// request, memoized by validatedLabelNames, are not validated again.
+func (d *Distributor) validateSeries(ts cortexpb.PreallocTimeseries, userID string, limits *validation.Overrides, skipLabelNameValidation bool, validatedLabelNames *validation.ValidatedLabelNames, now time.Time, discarded validation.DiscardedRecorder, dryRun bool) (cortexpb.PreallocTimeseries, validation.ValidationError) {
+	if !dryRun {
+		d.labelsHistogram.Observe(float64(len(ts.Labels)))
+	}
+	if err := validation.ValidateLabels(discarded, limits, userID, ts.Labels, skipLabelNameValidation, validatedLabelNames); err != nil {
 		return emptyPreallocSeries, err
 	}
 
-	var samples []cortexpb.Sample
-	if len(ts.Samples) > 0 {
-		// Only alloc when data present
-		samples = make([]cortexpb.Sample, 0, len(ts.Samples))
-		for _, s := range ts.Samples {
-			if err := validation.ValidateSample(d.limits, userID, ts.Labels, s); err != nil {
+	// The shadow limits are evaluated on the series accepted, to track the series which would be
+	// discarded by tightening the limits.
+	if reason := validation.ValidateShadowLimits(limits, userID, ts.Labels); reason != "" {
+		discarded.ShadowDiscard(reason, userID, ts.Labels)
+		if ratio := limits.ShadowLimitsLogSampleRatio(userID); !dryRun && ratio > 0 && rand.Float64() < ratio {
+			level.Info(d.log).Log("msg", "series would be discarded by the shadow limits", "user", userID, "reason", reason, "series", cortexpb.FromLabelAdaptersToLabels(ts.Labels).String())
+		}
+	}
+
+	// The samples are either all valid or the whole series is rejected, so they're
+	// not copied.
+	samples := ts.Samples
+	if len(samples) > 0 {
+		nowMs := model.TimeFromUnixNano(now.UnixNano())
+		for _, s := range samples {
+			if err := validation.ValidateSample(discarded, limits, userID, ts.Labels, s, nowMs); err != nil {
 				return emptyPreallocSeries, err
 			}
-			samples = append(samples, s)
 		}
 	}
 
-	var exemplars []cortexpb.Exemplar
-	if len(ts.Exemplars) > 0 {
+	if len(ts.Exemplars) > 0 && !limits.ExemplarsEnabled(userID) {
+		// The exemplars are dropped if disabled for the user, but we still ingest the samples.
+		discarded.DiscardedExemplars(validation.ExemplarsDisabled, userID, ts.Labels, len(ts.Exemplars))
+		if len(samples) == 0 {
+			return emptyPreallocSeries, nil
+		}
+		ts.Exemplars = nil
+	} else if len(ts.Exemplars) > 0 {
 		// Only alloc when data present
-		exemplars = make([]cortexpb.Exemplar, 0, len(ts.Exemplars))
+		exemplars := make([]cortexpb.Exemplar, 0, len(ts.Exemplars))
 		for _, e := range ts.Exemplars {
-			if err := validation.ValidateExemplar(userID, ts.Labels, e); err != nil {
+			if err := validation.ValidateExemplar(discarded, userID, ts.Labels, e); err != nil {
 				// An exemplar validation error prevents ingesting samples
 				// in the same series object. However because the current Prometheus
 				// remote write implementation only populates one or the other,
 				// there never will be any.
 				return emptyPreallocSeries, err
 			}
+
+			// Exemplars exceeding the limits are dropped, but we still ingest the samples.
+			if err := validation.ValidateExemplarLimits(discarded, limits, userID, ts.Labels, e); err != nil {
+				continue
+			}
+			if !allowN(d.exemplarsRateLimiter, now, userID, 1, dryRun) {
+				discarded.DiscardedExemplars(validation.ExemplarRateLimited, userID, ts.Labels, 1)
+				continue
+			}
+
 			exemplars = append(exemplars, e)
 		}
+
+		// Skip the series if there's nothing left to ingest.
+		if len(samples) == 0 && len(exemplars) == 0 {
+			return emptyPreallocSeries, nil
+		}
+		ts.Exemplars = exemplars
 	}
 
-	return cortexpb.PreallocTimeseries{
-			TimeSeries: &cortexpb.TimeSeries{
-				Labels:    ts.Labels,
-				Samples:   samples,
-				Exemplars: exemplars,
-			},
-		},
-		nil
+	return ts, nil
 }
 
+// validatedRequest holds the series and metadata of a write request which passed the
+// validation, together with their sharding keys.
+type validatedRequest struct {
+	seriesKeys   []uint32
+	timeseries   []cortexpb.PreallocTimeseries
+	metadataKeys []uint32
+	metadata     []*cortexpb.MetricMetadata
+}
+
+// sendFunc sends the validated series and metadata of a write request to the ingesters.
+type sendFunc func(ctx context.Context, userID string, req *cortexpb.WriteRequest, validated validatedRequest) error
+
 // Push implements client.IngesterServer
 func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+	if err := d.checkHealthyIngesters(); err != nil {
+		return nil, err
+	}
+
+	return d.push(ctx, req, d.sendToIngesters, nil)
+}
+
+// checkHealthyIngesters returns an error with status 503 if the percentage of healthy ingesters
+// is below the configured minimum, so that the push fails fast instead of waiting for the
+// replicas to time out. The error carries a Retry-After header.
+func (d *Distributor) checkHealthyIngesters() error {
+	if d.cfg.MinHealthyIngestersPercentage <= 0 {
+		return nil
+	}
+
+	healthy, total := d.ingestersRing.CountHealthyInstances()
+	if total == 0 || float64(healthy)*100 >= d.cfg.MinHealthyIngestersPercentage*float64(total) {
+		if d.tooFewHealthyIngesters.CAS(true, false) {
+			level.Info(d.log).Log("msg", "accepting push requests again because enough ingesters are healthy", "healthy", healthy, "total", total)
+		}
+		return nil
+	}
+
+	if d.tooFewHealthyIngesters.CAS(false, true) {
+		level.Warn(d.log).Log("msg", "rejecting push requests because too few ingesters are healthy", "healthy", healthy, "total", total, "min_healthy_percentage", d.cfg.MinHealthyIngestersPercentage)
+	}
+	d.tooFewHealthyIngestersRejected.Inc()
+
+	return httpgrpc.ErrorFromHTTPResponse(&httpgrpc.HTTPResponse{
+		Code: http.StatusServiceUnavailable,
+		Body: []byte(fmt.Sprintf("too few healthy ingesters (%d out of %d), the minimum is %v%%", healthy, total, d.cfg.MinHealthyIngestersPercentage)),
+		Headers: []*httpgrpc.Header{
+			{Key: "Retry-After", Values: []string{strconv.Itoa(int(d.cfg.TooFewHealthyIngestersRetryAfter.Seconds()))}},
+		},
+	})
+}
+
+// PushLocal validates the write request and enforces the limits exactly like Push, but then
+// appends the series and metadata to the given ingester push function, typically the ingester
+// running in the same process, bypassing the ring fan-out and the gRPC round trip. It must be
+// used only when the replication factor is 1.
+func (d *Distributor) PushLocal(ctx context.Context, req *cortexpb.WriteRequest, ingesterPush push.Func) (*cortexpb.WriteResponse, error) {
+	return d.push(ctx, req, func(ctx context.Context, _ string, req *cortexpb.WriteRequest, validated validatedRequest) error {
+		// The request slice is not reused, because the validated series retain its labels and
+		// the ingester reuses them once done.
+		_, err := ingesterPush(ctx, &cortexpb.WriteRequest{
+			Timeseries: validated.timeseries,
+			Metadata:   validated.metadata,
+			Source:     req.Source,
+		})
+		return err
+	}, nil)
+}
+
+// push validates the write request, enforces the limits and then sends the validated series
+// and metadata with the given send function. If report is not nil, push runs as a dry run: the
+// outcome of the validation is collected in the report and push has no side effect, neither on
+// the metrics, the rate limiters or the HA tracker.
+func (d *Distributor) push(ctx context.Context, req *cortexpb.WriteRequest, send sendFunc, report *DryRunReport) (*cortexpb.WriteResponse, error) {
 	userID, err := tenant.TenantID(ctx)
 	if err != nil {
 		return nil, err
@@ -563,10 +858,17 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 		}
 	}
 
-	now := time.Now()
-	d.activeUsers.UpdateUserTimestamp(userID, now)
+	dryRun := report != nil
+	discarded := validation.DiscardedMetricsRecorder
+	if dryRun {
+		discarded = dryRunRecorder{report: report}
+	}
+	discarded = validation.RecorderWithWarnings(discarded, validation.WarningsFromContext(ctx))
 
-	source := util.GetSourceIPsFromOutgoingCtx(ctx)
+	now := time.Now()
+	if !dryRun {
+		d.activeUsers.UpdateUserTimestamp(userID, now)
+	}
 
 	var firstPartialErr error
 	removeReplica := false
@@ -577,11 +879,13 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 		numSamples += len(ts.Samples)
 		numExemplars += len(ts.Exemplars)
 	}
-	// Count the total samples in, prior to validation or deduplication, for comparison with other metrics.
-	d.incomingSamples.WithLabelValues(userID).Add(float64(numSamples))
-	d.incomingExemplars.WithLabelValues(userID).Add(float64(numExemplars))
-	// Count the total number of metadata in.
-	d.incomingMetadata.WithLabelValues(userID).Add(float64(len(req.Metadata)))
+	if !dryRun {
+		// Count the total samples in, prior to validation or deduplication, for comparison with other metrics.
+		d.incomingSamples.WithLabelValues(userID).Add(float64(numSamples))
+		d.incomingExemplars.WithLabelValues(userID).Add(float64(numExemplars))
+		// Count the total number of metadata in.
+		d.incomingMetadata.WithLabelValues(userID).Add(float64(len(req.Metadata)))
+	}
 
 	// A WriteRequest can only contain series or metadata but not both. This might change in the future.
 	// For each timeseries or samples, we compute a hash to distribute across ingesters;
@@ -595,38 +899,66 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 
 	if d.limits.AcceptHASamples(userID) && len(req.Timeseries) > 0 {
 		cluster, replica := findHALabels(d.limits.HAReplicaLabel(userID), d.limits.HAClusterLabel(userID), req.Timeseries[0].Labels)
-		removeReplica, err = d.checkSample(ctx, userID, cluster, replica)
+		removeReplica, err = d.checkSample(ctx, userID, cluster, replica, dryRun)
 		if err != nil {
 			// Ensure the request slice is reused if the series get deduped.
 			cortexpb.ReuseSlice(req.Timeseries)
 
 			if errors.Is(err, replicasNotMatchError{}) {
 				// These samples have been deduped.
-				d.dedupedSamples.WithLabelValues(userID, cluster).Add(float64(numSamples))
+				if dryRun {
+					report.RejectedSamples[dryRunReasonHADeduplicated] += numSamples
+				} else {
+					d.dedupedSamples.WithLabelValues(userID, cluster).Add(float64(numSamples))
+				}
 				return nil, httpgrpc.Errorf(http.StatusAccepted, err.Error())
 			}
 
 			if errors.Is(err, tooManyClustersError{}) {
-				validation.DiscardedSamples.WithLabelValues(validation.TooManyHAClusters, userID).Add(float64(numSamples))
+				discarded.DiscardedSamples(validation.TooManyHAClusters, userID, nil, numSamples)
 				return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
 			}
 
 			return nil, err
 		}
 		// If there wasn't an error but removeReplica is false that means we didn't find both HA labels.
-		if !removeReplica {
+		if !removeReplica && !dryRun {
 			d.nonHASamples.WithLabelValues(userID).Add(float64(numSamples))
 		}
 	}
 
+	// If the tenant has allowed label names, the series with other label names are either rejected, or
+	// have those labels removed. In the latter case, the series collapsing onto the same labels are merged.
+	var (
+		allowedLabelNames    map[string]struct{}
+		removeNotAllowed     bool
+		validatedSeriesByKey map[string]int
+	)
+	if names := d.limits.AllowedLabelNames(userID); len(names) > 0 {
+		allowedLabelNames = make(map[string]struct{}, len(names))
+		for _, name := range names {
+			allowedLabelNames[name] = struct{}{}
+		}
+
+		if d.limits.AllowedLabelNamesAction(userID) == validation.AllowedLabelNamesActionStrip {
+			removeNotAllowed = true
+			validatedSeriesByKey = make(map[string]int, len(req.Timeseries))
+		}
+	}
+
 	latestSampleTimestampMs := int64(0)
 	defer func() {
 		// Update this metric even in case of errors.
-		if latestSampleTimestampMs > 0 {
+		if latestSampleTimestampMs > 0 && !dryRun {
 			d.latestSeenSampleTimestampPerUser.WithLabelValues(userID).Set(float64(latestSampleTimestampMs) / 1000)
 		}
 	}()
 
+	// The limits of the user are resolved once, instead of for each series.
+	limits := d.limits.ForUser(userID)
+	skipLabelNameValidation := d.cfg.SkipLabelNameValidation || req.GetSkipLabelNameValidation()
+	validatedLabelNames := &validation.ValidatedLabelNames{}
+
 	// For each timeseries, compute a hash to distribute across ingesters;
 	// check each sample and discard if outside limits.
 	for _, ts := range req.Timeseries {
@@ -635,7 +967,7 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 			latestSampleTimestampMs = util_math.Max64(latestSampleTimestampMs, ts.Samples[len(ts.Samples)-1].TimestampMs)
 		}
 
-		if mrc := d.limits.MetricRelabelConfigs(userID); len(mrc) > 0 {
+		if mrc := limits.MetricRelabelConfigs(userID); len(mrc) > 0 {
 			l := relabel.Process(cortexpb.FromLabelAdaptersToLabels(ts.Labels), mrc...)
 			ts.Labels = cortexpb.FromLabelsToLabelAdapters(l)
 		}
@@ -644,13 +976,28 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 		// storing series in Cortex. If we kept the replica label we would end up with another series for the same
 		// series we're trying to dedupe when HA tracking moves over to a different replica.
 		if removeReplica {
-			removeLabel(d.limits.HAReplicaLabel(userID), &ts.Labels)
+			removeLabel(limits.HAReplicaLabel(userID), &ts.Labels)
 		}
 
-		for _, labelName := range d.limits.DropLabels(userID) {
+		for _, labelName := range limits.DropLabels(userID) {
 			removeLabel(labelName, &ts.Labels)
 		}
 
+		if removeNotAllowed {
+			if removed := removeNotAllowedLabels(allowedLabelNames, &ts.Labels); removed > 0 && dryRun {
+				report.StrippedLabels += removed
+			} else if removed > 0 {
+				d.strippedLabels.WithLabelValues(userID).Add(float64(removed))
+			}
+		} else if allowedLabelNames != nil {
+			if err := validation.ValidateAllowedLabelNames(discarded, userID, allowedLabelNames, ts.Labels); err != nil {
+				if firstPartialErr == nil {
+					firstPartialErr = httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+				}
+				continue
+			}
+		}
+
 		if len(ts.Labels) == 0 {
 			continue
 		}
@@ -669,8 +1016,7 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 			return nil, err
 		}
 
-		skipLabelNameValidation := d.cfg.SkipLabelNameValidation || req.GetSkipLabelNameValidation()
-		validatedSeries, validationErr := d.validateSeries(ts, userID, skipLabelNameValidation)
+		validatedSeries, validationErr := d.validateSeries(ts, userID, limits, skipLabelNameValidation, validatedLabelNames, now, discarded, dryRun)
 
 		// Errors in validation are considered non-fatal, as one series in a request may contain
 		// invalid data but all the remaining series could be perfectly valid.
@@ -685,14 +1031,29 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 			continue
 		}
 
+		if validatedSeriesByKey != nil {
+			seriesKey := cortexpb.FromLabelAdaptersToLabels(validatedSeries.Labels).String()
+			if i, ok := validatedSeriesByKey[seriesKey]; ok {
+				duplicates := mergeSeries(validatedTimeseries[i], validatedSeries)
+				if duplicates > 0 {
+					discarded.DiscardedSamples(validation.StrippedLabelsDuplicateSample, userID, validatedSeries.Labels, duplicates)
+				}
+
+				validatedSamples += len(validatedSeries.Samples) - duplicates
+				validatedExemplars += len(validatedSeries.Exemplars)
+				continue
+			}
+			validatedSeriesByKey[seriesKey] = len(validatedTimeseries)
+		}
+
 		seriesKeys = append(seriesKeys, key)
 		validatedTimeseries = append(validatedTimeseries, validatedSeries)
-		validatedSamples += len(ts.Samples)
-		validatedExemplars += len(ts.Exemplars)
+		validatedSamples += len(validatedSeries.Samples)
+		validatedExemplars += len(validatedSeries.Exemplars)
 	}
 
 	for _, m := range req.Metadata {
-		err := validation.ValidateMetadata(d.limits, userID, m)
+		err := validation.ValidateMetadata(discarded, d.limits, userID, m)
 
 		if err != nil {
 			if firstPartialErr == nil {
@@ -706,9 +1067,11 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 		validatedMetadata = append(validatedMetadata, m)
 	}
 
-	d.receivedSamples.WithLabelValues(userID).Add(float64(validatedSamples))
-	d.receivedExemplars.WithLabelValues(userID).Add((float64(validatedExemplars)))
-	d.receivedMetadata.WithLabelValues(userID).Add(float64(len(validatedMetadata)))
+	if !dryRun {
+		d.receivedSamples.WithLabelValues(userID).Add(float64(validatedSamples))
+		d.receivedExemplars.WithLabelValues(userID).Add((float64(validatedExemplars)))
+		d.receivedMetadata.WithLabelValues(userID).Add(float64(len(validatedMetadata)))
+	}
 
 	if len(seriesKeys) == 0 && len(metadataKeys) == 0 {
 		// Ensure the request slice is reused if there's no series or metadata passing the validation.
@@ -718,22 +1081,59 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 	}
 
 	totalN := validatedSamples + validatedExemplars + len(validatedMetadata)
-	if !d.ingestionRateLimiter.AllowN(now, userID, totalN) {
+	if d.ingestionRateCoordinator != nil && !dryRun {
+		d.ingestionRateCoordinator.Add(userID, totalN)
+	}
+	if !allowN(d.ingestionRateLimiter, now, userID, totalN, dryRun) {
 		// Ensure the request slice is reused if the request is rate limited.
 		cortexpb.ReuseSlice(req.Timeseries)
 
-		validation.DiscardedSamples.WithLabelValues(validation.RateLimited, userID).Add(float64(validatedSamples))
-		validation.DiscardedExemplars.WithLabelValues(validation.RateLimited, userID).Add(float64(validatedExemplars))
-		validation.DiscardedMetadata.WithLabelValues(validation.RateLimited, userID).Add(float64(len(validatedMetadata)))
+		discarded.DiscardedSamples(validation.RateLimited, userID, nil, validatedSamples)
+		discarded.DiscardedExemplars(validation.RateLimited, userID, nil, validatedExemplars)
+		discarded.DiscardedMetadata(validation.RateLimited, userID, len(validatedMetadata))
 		// Return a 429 here to tell the client it is going too fast.
 		// Client may discard the data or slow down and re-send.
 		// Prometheus v2.26 added a remote-write option 'retry_on_http_429'.
 		return nil, httpgrpc.Errorf(http.StatusTooManyRequests, "ingestion rate limit (%v) exceeded while adding %d samples and %d metadata", d.ingestionRateLimiter.Limit(now, userID), validatedSamples, len(validatedMetadata))
 	}
 
-	// totalN included samples and metadata. Ingester follows this pattern when computing its ingestion rate.
-	d.ingestionRate.Add(int64(totalN))
+	if !dryRun {
+		// totalN included samples and metadata. Ingester follows this pattern when computing its ingestion rate.
+		d.ingestionRate.Add(int64(totalN))
+
+		// The validated request is forwarded before being sharded, because the shadow endpoint
+		// shards it on its own.
+		d.shadowWriter.add(userID, validatedTimeseries, validatedMetadata)
+	}
+
+	err = send(ctx, userID, req, validatedRequest{
+		seriesKeys:   seriesKeys,
+		timeseries:   validatedTimeseries,
+		metadataKeys: metadataKeys,
+		metadata:     validatedMetadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun {
+		d.recordConsistencyToken(ctx, latestSampleTimestampMs)
+	}
+	return &cortexpb.WriteResponse{}, firstPartialErr
+}
+
+// allowN reports whether n tokens may be consumed from the rate limiter. On a dry run, the tokens
+// are not consumed.
+func allowN(l *limiter.RateLimiter, now time.Time, userID string, n int, dryRun bool) bool {
+	if dryRun {
+		return l.WouldAllowN(now, userID, n)
+	}
+	return l.AllowN(now, userID, n)
+}
 
+// sendToIngesters sends the validated series and metadata to the ingesters owning them in the ring.
+func (d *Distributor) sendToIngesters(ctx context.Context, userID string, req *cortexpb.WriteRequest, validated validatedRequest) error {
+	source := util.GetSourceIPsFromOutgoingCtx(ctx)
 	subRing := d.ingestersRing
 
 	// Obtain a subring if required.
@@ -741,23 +1141,49 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 		subRing = d.ingestersRing.ShuffleShard(userID, d.limits.IngestionTenantShardSize(userID))
 	}
 
-	keys := append(seriesKeys, metadataKeys...)
-	initialMetadataIndex := len(seriesKeys)
+	metadataKeys, metadata := validated.metadataKeys, validated.metadata
+	if d.metadataBatcher != nil {
+		// The metadata is pushed asynchronously, so that the series never wait on it.
+		d.metadataBatcher.add(userID, metadata)
+		metadataKeys, metadata = nil, nil
+
+		if len(validated.seriesKeys) == 0 {
+			cortexpb.ReuseSlice(req.Timeseries)
+			return nil
+		}
+	}
 
 	op := ring.WriteNoExtend
 	if d.cfg.ExtendWrites {
 		op = ring.Write
 	}
 
-	err = ring.DoBatch(ctx, op, subRing, keys, func(ingester ring.InstanceDesc, indexes []int) error {
+	if len(metadata) > 0 && d.limits.RequireMetricMetadata(userID) {
+		// The metadata is sent before the series, so that the ingesters have received it
+		// once the samples of the same request are appended.
+		if err := d.sendMetadataToAllIngesters(ctx, subRing, op, userID, metadata, req.Source); err != nil {
+			return err
+		}
+		metadataKeys, metadata = nil, nil
+
+		if len(validated.seriesKeys) == 0 {
+			cortexpb.ReuseSlice(req.Timeseries)
+			return nil
+		}
+	}
+
+	keys := append(validated.seriesKeys, metadataKeys...)
+	initialMetadataIndex := len(validated.seriesKeys)
+
+	return ring.DoBatch(ctx, op, subRing, keys, func(ingester ring.InstanceDesc, indexes []int) error {
 		timeseries := make([]cortexpb.PreallocTimeseries, 0, len(indexes))
-		var metadata []*cortexpb.MetricMetadata
+		var ingesterMetadata []*cortexpb.MetricMetadata
 
 		for _, i := range indexes {
 			if i >= initialMetadataIndex {
-				metadata = append(metadata, validatedMetadata[i-initialMetadataIndex])
+				ingesterMetadata = append(ingesterMetadata, metadata[i-initialMetadataIndex])
 			} else {
-				timeseries = append(timeseries, validatedTimeseries[i])
+				timeseries = append(timeseries, validated.timeseries[i])
 			}
 		}
 
@@ -772,12 +1198,84 @@ func (d *Distributor) Push(ctx context.Context, req *cortexpb.WriteRequest) (*co
 		// Get clientIP(s) from Context and add it to localCtx
 		localCtx = util.AddSourceIPsToOutgoingContext(localCtx, source)
 
-		return d.send(localCtx, ingester, timeseries, metadata, req.Source)
+		return d.send(localCtx, ingester, timeseries, ingesterMetadata, req.Source)
 	}, func() { cortexpb.ReuseSlice(req.Timeseries) })
+}
+
+// sendMetadata pushes the metadata batched by the metadataBatcher to the ingesters owning it in
+// the ring. Each ingester is retried independently, so that a failing ingester never prevents
+// the others from receiving the metadata.
+func (d *Distributor) sendMetadata(ctx context.Context, userID string, metadata []*cortexpb.MetricMetadata) error {
+	subRing := d.ingestersRing
+	if d.cfg.ShardingStrategy == util.ShardingStrategyShuffle {
+		subRing = d.ingestersRing.ShuffleShard(userID, d.limits.IngestionTenantShardSize(userID))
+	}
+
+	op := ring.WriteNoExtend
+	if d.cfg.ExtendWrites {
+		op = ring.Write
+	}
+
+	if d.limits.RequireMetricMetadata(userID) {
+		return d.sendMetadataToAllIngesters(ctx, subRing, op, userID, metadata, cortexpb.API)
+	}
+
+	keys := make([]uint32, 0, len(metadata))
+	for _, m := range metadata {
+		keys = append(keys, d.tokenForMetadata(userID, m.MetricFamilyName))
+	}
+
+	return ring.DoBatch(ctx, op, subRing, keys, func(ingester ring.InstanceDesc, indexes []int) error {
+		ingesterMetadata := make([]*cortexpb.MetricMetadata, 0, len(indexes))
+		for _, i := range indexes {
+			ingesterMetadata = append(ingesterMetadata, metadata[i])
+		}
+
+		var err error
+		retries := backoff.New(ctx, d.cfg.MetadataSendBackoff)
+		for retries.Ongoing() {
+			localCtx, cancel := context.WithTimeout(ctx, d.cfg.RemoteTimeout)
+			err = d.send(user.InjectOrgID(localCtx, userID), ingester, nil, ingesterMetadata, cortexpb.API)
+			cancel()
+			if err == nil {
+				return nil
+			}
+
+			d.metadataSendFailures.WithLabelValues(ingester.Addr).Inc()
+
+			// The metadata rejected by the ingester is not retried.
+			if resp, ok := httpgrpc.HTTPResponseFromError(err); ok && resp.Code/100 == 4 {
+				return err
+			}
+			retries.Wait()
+		}
+		if err == nil {
+			err = retries.Err()
+		}
+		return err
+	}, func() {})
+}
+
+// sendMetadataToAllIngesters pushes the metadata to all the ingesters of the ring, for the tenants
+// requiring the metric metadata: the series of a metric are sharded across many ingesters, and
+// each of them rejects the samples of the metrics it has not received the metadata of.
+func (d *Distributor) sendMetadataToAllIngesters(ctx context.Context, subRing ring.ReadRing, op ring.Operation, userID string, metadata []*cortexpb.MetricMetadata, source cortexpb.WriteRequest_SourceEnum) error {
+	replicationSet, err := subRing.GetReplicationSetForOperation(op)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &cortexpb.WriteResponse{}, firstPartialErr
+
+	_, err = replicationSet.Do(ctx, 0, func(ctx context.Context, ingester *ring.InstanceDesc) (interface{}, error) {
+		localCtx, cancel := context.WithTimeout(ctx, d.cfg.RemoteTimeout)
+		defer cancel()
+
+		err := d.send(user.InjectOrgID(localCtx, userID), *ingester, nil, metadata, source)
+		if err != nil {
+			d.metadataSendFailures.WithLabelValues(ingester.Addr).Inc()
+		}
+		return nil, err
+	})
+	return err
 }
 
 func sortLabelsIfNeeded(labels []cortexpb.LabelAdapter) {
@@ -814,7 +1312,20 @@ func (d *Distributor) send(ctx context.Context, ingester ring.InstanceDesc, time
 		Metadata:   metadata,
 		Source:     source,
 	}
-	_, err = c.Push(ctx, &req)
+
+	if d.cfg.PushStream.ThresholdBytes > 0 && req.Size() > d.cfg.PushStream.ThresholdBytes && d.pushStreamSupport.isSupported(ingester.Addr, time.Now()) {
+		d.ingesterPushStreams.WithLabelValues(ingester.Addr).Inc()
+
+		err = d.pushStream(ctx, c, &req)
+		if status.Code(err) == codes.Unimplemented {
+			// The ingester doesn't support the push stream (e.g. it's running an older version).
+			level.Info(d.log).Log("msg", "ingester doesn't support the push stream, falling back to the unary push", "ingester", ingester.Addr)
+			d.pushStreamSupport.setUnsupported(ingester.Addr, time.Now())
+			_, err = c.Push(ctx, &req)
+		}
+	} else {
+		_, err = c.Push(ctx, &req)
+	}
 
 	if len(metadata) > 0 {
 		d.ingesterAppends.WithLabelValues(ingester.Addr, typeMetadata).Inc()
@@ -881,17 +1392,20 @@ func (d *Distributor) LabelValuesForLabelName(ctx context.Context, from, to mode
 	return values, nil
 }
 
-// LabelNames returns all of the label names.
-func (d *Distributor) LabelNames(ctx context.Context, from, to model.Time) ([]string, error) {
+// LabelNames returns all of the label names of the series matching the matchers. If any matcher
+// is provided and some of the ingesters don't support them, client.ErrLabelNamesMatchersNotSupported
+// is returned.
+func (d *Distributor) LabelNames(ctx context.Context, from, to model.Time, matchers ...*labels.Matcher) ([]string, error) {
 	replicationSet, err := d.GetIngestersForMetadata(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	req := &ingester_client.LabelNamesRequest{
-		StartTimestampMs: int64(from),
-		EndTimestampMs:   int64(to),
+	req, err := ingester_client.ToLabelNamesRequest(from, to, matchers)
+	if err != nil {
+		return nil, err
 	}
+
 	resps, err := d.ForReplicationSet(ctx, replicationSet, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
 		return client.LabelNames(ctx, req)
 	})
@@ -901,7 +1415,14 @@ func (d *Distributor) LabelNames(ctx context.Context, from, to model.Time) ([]st
 
 	valueSet := map[string]struct{}{}
 	for _, resp := range resps {
-		for _, v := range resp.(*ingester_client.LabelNamesResponse).LabelNames {
+		resp := resp.(*ingester_client.LabelNamesResponse)
+
+		// The ingesters not supporting the matchers ignore them, returning all the label names.
+		if len(matchers) > 0 && !resp.MatchersApplied {
+			return nil, ingester_client.ErrLabelNamesMatchersNotSupported
+		}
+
+		for _, v := range resp.LabelNames {
 			valueSet[v] = struct{}{}
 		}
 	}
@@ -952,6 +1473,86 @@ func (d *Distributor) MetricsForLabelMatchers(ctx context.Context, from, through
 	return result, nil
 }
 
+// MetricsForLabelMatchersWithTimeRange gets the metrics that match any of the matchers sets, along
+// with the time range of their in-memory samples, sorted by labels. The time ranges of the metrics
+// replicated across ingesters are merged, so that they include the samples of all the replicas.
+func (d *Distributor) MetricsForLabelMatchersWithTimeRange(ctx context.Context, from, through model.Time, matchersSet ...[]*labels.Matcher) (*ingester_client.MetricsForLabelMatchersResponse, error) {
+	replicationSet, err := d.GetIngestersForMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := ingester_client.ToMetricsForLabelMatchersWithTimeRangeRequest(from, through, matchersSet...)
+	if err != nil {
+		return nil, err
+	}
+
+	resps, err := d.ForReplicationSet(ctx, replicationSet, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
+		return client.MetricsForLabelMatchers(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type metricWithTimeRange struct {
+		metric    *cortexpb.Metric
+		timeRange ingester_client.SeriesTimeRange
+	}
+
+	metrics := map[model.Fingerprint]*metricWithTimeRange{}
+	for _, resp := range resps {
+		r := resp.(*ingester_client.MetricsForLabelMatchersResponse)
+		for i, m := range r.Metric {
+			// The ingesters not supporting the time ranges don't return them.
+			var timeRange ingester_client.SeriesTimeRange
+			if len(r.TimeRanges) == len(r.Metric) {
+				timeRange = r.TimeRanges[i]
+			}
+
+			fp := cortexpb.FromLabelAdaptersToMetric(m.Labels).Fingerprint()
+			existing, ok := metrics[fp]
+			if !ok {
+				metrics[fp] = &metricWithTimeRange{metric: m, timeRange: timeRange}
+				continue
+			}
+			existing.timeRange = mergeSeriesTimeRanges(existing.timeRange, timeRange)
+		}
+	}
+
+	result := make([]*metricWithTimeRange, 0, len(metrics))
+	for _, m := range metrics {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return labels.Compare(cortexpb.FromLabelAdaptersToLabels(result[i].metric.Labels), cortexpb.FromLabelAdaptersToLabels(result[j].metric.Labels)) < 0
+	})
+
+	merged := &ingester_client.MetricsForLabelMatchersResponse{
+		Metric:     make([]*cortexpb.Metric, 0, len(result)),
+		TimeRanges: make([]ingester_client.SeriesTimeRange, 0, len(result)),
+	}
+	for _, m := range result {
+		merged.Metric = append(merged.Metric, m.metric)
+		merged.TimeRanges = append(merged.TimeRanges, m.timeRange)
+	}
+	return merged, nil
+}
+
+// mergeSeriesTimeRanges returns the time range including both the input ones. The zero time
+// ranges, of the series without in-memory samples, are ignored.
+func mergeSeriesTimeRanges(a, b ingester_client.SeriesTimeRange) ingester_client.SeriesTimeRange {
+	if a == (ingester_client.SeriesTimeRange{}) {
+		return b
+	}
+	if b == (ingester_client.SeriesTimeRange{}) {
+		return a
+	}
+	return ingester_client.SeriesTimeRange{
+		MinTimeMs: util_math.Min64(a.MinTimeMs, b.MinTimeMs),
+		MaxTimeMs: util_math.Max64(a.MaxTimeMs, b.MaxTimeMs),
+	}
+}
+
 // MetricsMetadata returns all metric metadata of a user.
 func (d *Distributor) MetricsMetadata(ctx context.Context) ([]scrape.MetricMetadata, error) {
 	replicationSet, err := d.GetIngestersForMetadata(ctx)
@@ -992,6 +1593,33 @@ func (d *Distributor) MetricsMetadata(ctx context.Context) ([]scrape.MetricMetad
 	return result, nil
 }
 
+// IngestersMinTime returns the time of the oldest sample of the current user held by the ingesters,
+// or 0 if the ingesters hold no sample of the user.
+func (d *Distributor) IngestersMinTime(ctx context.Context) (int64, error) {
+	replicationSet, err := d.GetIngestersForMetadata(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	req := &ingester_client.LocalTimeRangeRequest{}
+	resps, err := d.ForReplicationSet(ctx, replicationSet, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
+		return client.LocalTimeRange(ctx, req)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	minTime := int64(0)
+	for _, resp := range resps {
+		r := resp.(*ingester_client.LocalTimeRangeResponse)
+		if r.MinTimeMs > 0 && (minTime == 0 || r.MinTimeMs < minTime) {
+			minTime = r.MinTimeMs
+		}
+	}
+
+	return minTime, nil
+}
+
 // UserStats returns statistics about the current user.
 func (d *Distributor) UserStats(ctx context.Context) (*UserStats, error) {
 	replicationSet, err := d.GetIngestersForMetadata(ctx)
@@ -1025,17 +1653,63 @@ func (d *Distributor) UserStats(ctx context.Context) (*UserStats, error) {
 	return totalStats, nil
 }
 
+// LabelValuesCardinality returns the number of in-memory series of the current user for each value of
+// the label, as reported by the ingesters. Like UserStats, the series counted by all the ingesters are
+// divided by the replication factor.
+func (d *Distributor) LabelValuesCardinality(ctx context.Context, labelName model.LabelName) (map[string]uint64, error) {
+	replicationSet, err := d.GetIngestersForMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure we get a successful response from all of them.
+	replicationSet.MaxErrors = 0
+
+	req := &ingester_client.LabelValuesCardinalityRequest{LabelName: string(labelName)}
+	resps, err := d.ForReplicationSet(ctx, replicationSet, func(ctx context.Context, client ingester_client.IngesterClient) (interface{}, error) {
+		return client.LabelValuesCardinality(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]uint64{}
+	for _, resp := range resps {
+		for _, item := range resp.(*ingester_client.LabelValuesCardinalityResponse).Items {
+			counts[item.LabelValue] += item.SeriesCount
+		}
+	}
+
+	replicationFactor := uint64(d.ingestersRing.ReplicationFactor())
+	for value, count := range counts {
+		counts[value] = count / replicationFactor
+	}
+
+	return counts, nil
+}
+
 // UserIDStats models ingestion statistics for one user, including the user ID
 type UserIDStats struct {
 	UserID string `json:"userID"`
 	UserStats
+
+	// The statistics of each ingester, set only if requested.
+	PerIngester []IngesterUserStats `json:"perIngester,omitempty"`
+}
+
+// IngesterUserStats models ingestion statistics for one user in one ingester.
+type IngesterUserStats struct {
+	Addr string `json:"addr"`
+	UserStats
 }
 
-// AllUserStats returns statistics about all users.
+// AllUserStats returns statistics about all users. If perIngester is true, the statistics
+// include the breakdown by ingester, sorted by number of series.
 // Note it does not divide by the ReplicationFactor like UserStats()
-func (d *Distributor) AllUserStats(ctx context.Context) ([]UserIDStats, error) {
+func (d *Distributor) AllUserStats(ctx context.Context, perIngester bool) ([]UserIDStats, error) {
 	// Add up by user, across all responses from ingesters
 	perUserTotals := make(map[string]UserStats)
+	perUserIngesters := make(map[string][]IngesterUserStats)
 
 	req := &ingester_client.UserStatsRequest{}
 	ctx = user.InjectOrgID(ctx, "1") // fake: ingester insists on having an org ID
@@ -1060,12 +1734,31 @@ func (d *Distributor) AllUserStats(ctx context.Context) ([]UserIDStats, error) {
 			s.RuleIngestionRate += u.Data.RuleIngestionRate
 			s.NumSeries += u.Data.NumSeries
 			perUserTotals[u.UserId] = s
+
+			if perIngester {
+				perUserIngesters[u.UserId] = append(perUserIngesters[u.UserId], IngesterUserStats{
+					Addr: ingester.Addr,
+					UserStats: UserStats{
+						IngestionRate:     u.Data.IngestionRate,
+						APIIngestionRate:  u.Data.ApiIngestionRate,
+						RuleIngestionRate: u.Data.RuleIngestionRate,
+						NumSeries:         u.Data.NumSeries,
+					},
+				})
+			}
 		}
 	}
 
 	// Turn aggregated map into a slice for return
 	response := make([]UserIDStats, 0, len(perUserTotals))
 	for id, stats := range perUserTotals {
+		// The hottest ingesters come first.
+		ingesters := perUserIngesters[id]
+		sort.Slice(ingesters, func(i, j int) bool {
+			return ingesters[i].NumSeries > ingesters[j].NumSeries ||
+				(ingesters[i].NumSeries == ingesters[j].NumSeries && ingesters[i].Addr < ingesters[j].Addr)
+		})
+
 		response = append(response, UserIDStats{
 			UserID: id,
 			UserStats: UserStats{
@@ -1074,6 +1767,7 @@ func (d *Distributor) AllUserStats(ctx context.Context) ([]UserIDStats, error) {
 				RuleIngestionRate: stats.RuleIngestionRate,
 				NumSeries:         stats.NumSeries,
 			},
+			PerIngester: ingesters,
 		})
 	}
 
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/grafana/dskit/backoff"
 	"github.com/grafana/dskit/services"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
@@ -26,6 +27,7 @@ import (
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/user"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 
@@ -33,6 +35,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
 	"github.com/cortexproject/cortex/pkg/prom1/storage/metric"
+	"github.com/cortexproject/cortex/pkg/querier/stats"
 	"github.com/cortexproject/cortex/pkg/ring"
 	ring_client "github.com/cortexproject/cortex/pkg/ring/client"
 	"github.com/cortexproject/cortex/pkg/ring/kv"
@@ -43,6 +46,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/cortexproject/cortex/pkg/util/limiter"
 	util_math "github.com/cortexproject/cortex/pkg/util/math"
+	"github.com/cortexproject/cortex/pkg/util/push"
 	"github.com/cortexproject/cortex/pkg/util/test"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
@@ -88,6 +92,40 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expected: nil,
 		},
+		"should fail if the rate coordination period is 0 when ingestion rate strategy = global-coordinated": {
+			initConfig: func(cfg *Config) {
+				cfg.RateCoordinationPeriod = 0
+			},
+			initLimits: func(limits *validation.Limits) {
+				limits.IngestionRateStrategy = validation.GlobalCoordinatedIngestionRateStrategy
+			},
+			expected: errInvalidRateCoordination,
+		},
+		"should fail if the distributors ring uses memberlist when ingestion rate strategy = global-coordinated": {
+			initConfig: func(cfg *Config) {
+				cfg.DistributorRing.KVStore.Store = "memberlist"
+			},
+			initLimits: func(limits *validation.Limits) {
+				limits.IngestionRateStrategy = validation.GlobalCoordinatedIngestionRateStrategy
+			},
+			expected: errRateCoordinationKVStore,
+		},
+		"should pass if the distributors ring uses consul when ingestion rate strategy = global-coordinated": {
+			initConfig: func(cfg *Config) {
+				cfg.DistributorRing.KVStore.Store = "consul"
+			},
+			initLimits: func(limits *validation.Limits) {
+				limits.IngestionRateStrategy = validation.GlobalCoordinatedIngestionRateStrategy
+			},
+			expected: nil,
+		},
+		"should fail if the shadow write concurrency is 0": {
+			initConfig: func(cfg *Config) {
+				cfg.ShadowWrite.Concurrency = 0
+			},
+			initLimits: func(_ *validation.Limits) {},
+			expected:   errInvalidShadowWrite,
+		},
 	}
 
 	for testName, testData := range tests {
@@ -265,6 +303,91 @@ func TestDistributor_Push(t *testing.T) {
 	}
 }
 
+func TestDistributor_PushLocal(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	tests := map[string]struct {
+		inputSeries    []labels.Labels
+		ingestionRate  float64
+		expectedErr    error
+		expectedSeries []labels.Labels
+	}{
+		"should append the series to the local ingester": {
+			inputSeries: []labels.Labels{
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "b"),
+			},
+			expectedSeries: []labels.Labels{
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "b"),
+			},
+		},
+		"should append only the series passing the validation": {
+			inputSeries: []labels.Labels{
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+				labels.FromStrings(model.MetricNameLabel, "foo", "999.illegal", "b"),
+			},
+			expectedErr: httpgrpc.Errorf(http.StatusBadRequest, `sample invalid label: "999.illegal" metric "foo{999.illegal=\"b\"}"`),
+			expectedSeries: []labels.Labels{
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+			},
+		},
+		"should enforce the ingestion rate limit": {
+			inputSeries: []labels.Labels{
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "b"),
+			},
+			ingestionRate: 1,
+			expectedErr:   httpgrpc.Errorf(http.StatusTooManyRequests, "ingestion rate limit (1) exceeded while adding 2 samples and 0 metadata"),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			limits := &validation.Limits{}
+			flagext.DefaultValues(limits)
+			if testData.ingestionRate > 0 {
+				limits.IngestionRate = testData.ingestionRate
+				limits.IngestionBurstSize = int(testData.ingestionRate)
+			}
+
+			ds, ingesters, r, _ := prepare(t, prepConfig{
+				numIngesters:      1,
+				happyIngesters:    1,
+				numDistributors:   1,
+				shardByAllLabels:  true,
+				limits:            limits,
+				replicationFactor: 1,
+			})
+			defer stopAll(ds, r)
+
+			var pushed []labels.Labels
+			ingesterPush := func(ctx context.Context, req *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+				userID, err := tenant.TenantID(ctx)
+				require.NoError(t, err)
+				assert.Equal(t, "user", userID)
+
+				for _, ts := range req.Timeseries {
+					pushed = append(pushed, cortexpb.FromLabelAdaptersToLabelsWithCopy(ts.Labels))
+				}
+				return &cortexpb.WriteResponse{}, nil
+			}
+
+			samples := make([]cortexpb.Sample, len(testData.inputSeries))
+			for i := range samples {
+				samples[i] = cortexpb.Sample{TimestampMs: 1000, Value: float64(i)}
+			}
+
+			_, err := ds[0].PushLocal(ctx, cortexpb.ToWriteRequest(testData.inputSeries, samples, nil, cortexpb.API), ingesterPush)
+			assert.Equal(t, testData.expectedErr, err)
+			assert.Equal(t, testData.expectedSeries, pushed)
+
+			// The series must never be sent through the ring.
+			assert.Equal(t, 0, countMockIngestersCalls(ingesters, "Push"))
+		})
+	}
+}
+
 func TestDistributor_MetricsCleanup(t *testing.T) {
 	dists, _, _, regs := prepare(t, prepConfig{
 		numDistributors: 1,
@@ -620,6 +743,72 @@ func TestDistributor_PushInstanceLimits(t *testing.T) {
 	}
 }
 
+func TestDistributor_Push_ShouldFailFastOnTooFewHealthyIngesters(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	tests := map[string]struct {
+		unhealthyIngesters int
+		expectedErr        bool
+	}{
+		"should push if enough ingesters are healthy": {
+			unhealthyIngesters: 1,
+		},
+		"should fail fast if too few ingesters are healthy": {
+			unhealthyIngesters: 2,
+			expectedErr:        true,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			distributors, _, r, regs := prepare(t, prepConfig{
+				numIngesters:     3,
+				happyIngesters:   3,
+				numDistributors:  1,
+				shardByAllLabels: true,
+			})
+			defer stopAll(distributors, r)
+
+			d := distributors[0]
+			d.cfg.MinHealthyIngestersPercentage = 50
+			d.cfg.TooFewHealthyIngestersRetryAfter = 5 * time.Second
+
+			// Make some ingesters unhealthy, timing out their heartbeat.
+			require.NoError(t, r.KVClient.CAS(context.Background(), ring.IngesterRingKey, func(in interface{}) (interface{}, bool, error) {
+				desc := in.(*ring.Desc)
+				for i := 0; i < testData.unhealthyIngesters; i++ {
+					instance := desc.Ingesters[strconv.Itoa(i)]
+					instance.Timestamp = time.Now().Add(-2 * time.Hour).Unix()
+					desc.Ingesters[strconv.Itoa(i)] = instance
+				}
+				return desc, true, nil
+			}))
+
+			test.Poll(t, time.Second, 3-testData.unhealthyIngesters, func() interface{} {
+				healthy, _ := r.CountHealthyInstances()
+				return healthy
+			})
+
+			_, err := d.Push(ctx, makeWriteRequest(0, 10, 0))
+			if !testData.expectedErr {
+				require.NoError(t, err)
+				return
+			}
+
+			resp, ok := httpgrpc.HTTPResponseFromError(err)
+			require.True(t, ok)
+			assert.Equal(t, int32(http.StatusServiceUnavailable), resp.Code)
+			assert.Equal(t, []*httpgrpc.Header{{Key: "Retry-After", Values: []string{"5"}}}, resp.Headers)
+
+			assert.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(`
+				# HELP cortex_distributor_push_rejected_too_few_healthy_ingesters_total The total number of push requests rejected because the percentage of healthy ingesters is below the configured minimum.
+				# TYPE cortex_distributor_push_rejected_too_few_healthy_ingesters_total counter
+				cortex_distributor_push_rejected_too_few_healthy_ingesters_total 1
+			`), "cortex_distributor_push_rejected_too_few_healthy_ingesters_total"))
+		})
+	}
+}
+
 func TestDistributor_PushHAInstances(t *testing.T) {
 	ctx := user.InjectOrgID(context.Background(), "user")
 
@@ -1076,6 +1265,42 @@ func TestDistributor_QueryStream_ShouldReturnErrorIfMaxChunkBytesPerQueryLimitIs
 	assert.Equal(t, err, validation.LimitError(fmt.Sprintf(limiter.ErrMaxChunkBytesHit, maxBytesLimit)))
 }
 
+func TestDistributor_QueryStream_ShouldTrackQueryStats(t *testing.T) {
+	const numSeries = 10
+
+	ds, _, r, _ := prepare(t, prepConfig{
+		numIngesters:     3,
+		happyIngesters:   3,
+		numDistributors:  1,
+		shardByAllLabels: true,
+	})
+	defer stopAll(ds, r)
+
+	ctx := user.InjectOrgID(context.Background(), "user")
+	ctx = limiter.AddQueryLimiterToContext(ctx, limiter.NewQueryLimiter(0, 0, 0))
+
+	// Each series has 1 sample, so expect 1 chunk per series when querying back.
+	writeRes, err := ds[0].Push(ctx, makeWriteRequest(0, numSeries, 0))
+	assert.Equal(t, &cortexpb.WriteResponse{}, writeRes)
+	assert.Nil(t, err)
+
+	reqStats, ctx := stats.ContextWithEmptyStats(ctx)
+	queryRes, err := ds[0].QueryStream(ctx, math.MinInt32, math.MaxInt32, labels.MustNewMatcher(labels.MatchRegexp, model.MetricNameLabel, ".+"))
+	require.NoError(t, err)
+	require.Len(t, queryRes.Chunkseries, numSeries)
+
+	numChunks := 0
+	for _, series := range queryRes.Chunkseries {
+		numChunks += len(series.Chunks)
+	}
+
+	assert.Equal(t, uint64(numSeries), reqStats.LoadFetchedSeries())
+	assert.Equal(t, uint64(numChunks), reqStats.LoadFetchedChunks())
+	assert.Equal(t, uint64(queryRes.ChunksSize()), reqStats.LoadFetchedChunkBytes())
+	assert.Greater(t, reqStats.LoadIngesterWallTime().Nanoseconds(), int64(0))
+	assert.Zero(t, reqStats.LoadStoreGatewayWallTime())
+}
+
 func TestDistributor_Push_LabelRemoval(t *testing.T) {
 	ctx := user.InjectOrgID(context.Background(), "user")
 
@@ -1165,6 +1390,217 @@ func TestDistributor_Push_LabelRemoval(t *testing.T) {
 	}
 }
 
+func TestDistributor_Push_AllowedLabelNames(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	tests := map[string]struct {
+		action                    string
+		inputSeries               []labels.Labels
+		inputSamples              []cortexpb.Sample
+		expectedErr               string
+		expectedSeries            labels.Labels
+		expectedSamples           []cortexpb.Sample
+		expectedStrippedLabels    float64
+		expectedDiscardedRejected float64
+		expectedDiscardedMerged   float64
+	}{
+		"should ingest series with allowed label names": {
+			action:          validation.AllowedLabelNamesActionReject,
+			inputSeries:     []labels.Labels{labels.FromStrings(model.MetricNameLabel, "foo", "job", "a")},
+			inputSamples:    []cortexpb.Sample{{TimestampMs: 1, Value: 1}},
+			expectedSeries:  labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+			expectedSamples: []cortexpb.Sample{{TimestampMs: 1, Value: 1}},
+		},
+		"should reject series with label names not allowed": {
+			action:                    validation.AllowedLabelNamesActionReject,
+			inputSeries:               []labels.Labels{labels.FromStrings(model.MetricNameLabel, "foo", "job", "a", "pod", "1")},
+			inputSamples:              []cortexpb.Sample{{TimestampMs: 1, Value: 1}},
+			expectedErr:               `label name not allowed: "pod" metric "foo{job=\"a\", pod=\"1\"}"`,
+			expectedDiscardedRejected: 1,
+		},
+		"should strip label names not allowed": {
+			action:                 validation.AllowedLabelNamesActionStrip,
+			inputSeries:            []labels.Labels{labels.FromStrings(model.MetricNameLabel, "foo", "instance", "b", "job", "a", "pod", "1")},
+			inputSamples:           []cortexpb.Sample{{TimestampMs: 1, Value: 1}},
+			expectedSeries:         labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+			expectedSamples:        []cortexpb.Sample{{TimestampMs: 1, Value: 1}},
+			expectedStrippedLabels: 2,
+		},
+		"should merge series collapsing onto the same labels once stripped": {
+			action: validation.AllowedLabelNamesActionStrip,
+			inputSeries: []labels.Labels{
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "a", "pod", "2"),
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "a", "pod", "1"),
+				labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+			},
+			inputSamples:            []cortexpb.Sample{{TimestampMs: 2, Value: 2}, {TimestampMs: 1, Value: 1}, {TimestampMs: 2, Value: 3}},
+			expectedSeries:          labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+			expectedSamples:         []cortexpb.Sample{{TimestampMs: 1, Value: 1}, {TimestampMs: 2, Value: 2}},
+			expectedStrippedLabels:  2,
+			expectedDiscardedMerged: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			var limits validation.Limits
+			flagext.DefaultValues(&limits)
+			limits.AllowedLabelNames = []string{"job"}
+			limits.AllowedLabelNamesAction = testData.action
+
+			ds, ingesters, r, _ := prepare(t, prepConfig{
+				numIngesters:     2,
+				happyIngesters:   2,
+				numDistributors:  1,
+				shardByAllLabels: true,
+				limits:           &limits,
+			})
+			defer stopAll(ds, r)
+
+			rejectedBefore := testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues("label_name_not_allowed", "user"))
+			mergedBefore := testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues(validation.StrippedLabelsDuplicateSample, "user"))
+
+			req := cortexpb.ToWriteRequest(testData.inputSeries, testData.inputSamples, nil, cortexpb.API)
+			_, err := ds[0].Push(ctx, req)
+			if testData.expectedErr != "" {
+				fromError, _ := status.FromError(err)
+				assert.Equal(t, testData.expectedErr, fromError.Message())
+			} else {
+				require.NoError(t, err)
+			}
+
+			for i := range ingesters {
+				timeseries := ingesters[i].series()
+				if testData.expectedSeries == nil {
+					assert.Empty(t, timeseries)
+					continue
+				}
+
+				require.Len(t, timeseries, 1)
+				for _, v := range timeseries {
+					assert.Equal(t, testData.expectedSeries, cortexpb.FromLabelAdaptersToLabels(v.Labels))
+					assert.Equal(t, testData.expectedSamples, v.Samples)
+				}
+			}
+
+			assert.Equal(t, testData.expectedStrippedLabels, testutil.ToFloat64(ds[0].strippedLabels.WithLabelValues("user")))
+			assert.Equal(t, testData.expectedDiscardedRejected, testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues("label_name_not_allowed", "user"))-rejectedBefore)
+			assert.Equal(t, testData.expectedDiscardedMerged, testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues(validation.StrippedLabelsDuplicateSample, "user"))-mergedBefore)
+		})
+	}
+}
+
+func TestDistributor_Push_ValidationWarnMode(t *testing.T) {
+	tests := map[string]struct {
+		mode                string
+		expectedErr         string
+		expectedIngested    int
+		expectedWarnings    float64
+		expectedWarnReasons []string
+		expectedDiscarded   float64
+	}{
+		"should discard the series exceeding the limit in enforce mode": {
+			mode:                validation.ValidationModeEnforce,
+			expectedErr:         `label value too long for metric: "foo{job=\"too-long-label-value\"}" label value: "too-long-label-value"`,
+			expectedWarnReasons: []string{},
+			expectedDiscarded:   1,
+		},
+		"should ingest the series exceeding the limit in warn mode": {
+			mode:                validation.ValidationModeWarn,
+			expectedIngested:    1,
+			expectedWarnings:    1,
+			expectedWarnReasons: []string{"label_value_too_long"},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			userID := "user-" + testData.mode
+			warnings := validation.NewWarnings()
+			ctx := validation.ContextWithWarnings(user.InjectOrgID(context.Background(), userID), warnings)
+
+			var limits validation.Limits
+			flagext.DefaultValues(&limits)
+			limits.MaxLabelValueLength = 10
+			limits.MaxLabelValueLengthMode = testData.mode
+
+			ds, ingesters, r, _ := prepare(t, prepConfig{
+				numIngesters:     2,
+				happyIngesters:   2,
+				numDistributors:  1,
+				shardByAllLabels: true,
+				limits:           &limits,
+			})
+			defer stopAll(ds, r)
+
+			series := []labels.Labels{labels.FromStrings(model.MetricNameLabel, "foo", "job", "too-long-label-value")}
+			req := cortexpb.ToWriteRequest(series, []cortexpb.Sample{{TimestampMs: 1, Value: 1}}, nil, cortexpb.API)
+			_, err := ds[0].Push(ctx, req)
+			if testData.expectedErr != "" {
+				fromError, _ := status.FromError(err)
+				assert.Equal(t, testData.expectedErr, fromError.Message())
+			} else {
+				require.NoError(t, err)
+			}
+
+			for i := range ingesters {
+				assert.Len(t, ingesters[i].series(), testData.expectedIngested)
+			}
+			assert.Equal(t, testData.expectedWarnReasons, warnings.Reasons())
+			assert.Equal(t, testData.expectedWarnings, testutil.ToFloat64(validation.ValidationWarnings.WithLabelValues("label_value_too_long", userID)))
+			assert.Equal(t, testData.expectedDiscarded, testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues("label_value_too_long", userID)))
+		})
+	}
+}
+
+func TestDistributor_Push_ShadowLimits(t *testing.T) {
+	const userID = "user-shadow-limits"
+	ctx := user.InjectOrgID(context.Background(), userID)
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.ShadowMaxLabelNamesPerSeries = 2
+	limits.ShadowMaxLabelValueLength = 5
+
+	ds, ingesters, r, _ := prepare(t, prepConfig{
+		numIngesters:     2,
+		happyIngesters:   2,
+		numDistributors:  1,
+		shardByAllLabels: true,
+		limits:           &limits,
+	})
+	defer stopAll(ds, r)
+
+	series := []labels.Labels{
+		labels.FromStrings(model.MetricNameLabel, "foo"),
+		labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+		labels.FromStrings(model.MetricNameLabel, "foo", "job", "b", "pod", "1"),
+		labels.FromStrings(model.MetricNameLabel, "foo", "job", "long-value"),
+	}
+	samples := make([]cortexpb.Sample, 0, len(series))
+	for i := range series {
+		samples = append(samples, cortexpb.Sample{TimestampMs: 1, Value: float64(i)})
+	}
+
+	// The series exceeding the shadow limits are ingested.
+	_, err := ds[0].Push(ctx, cortexpb.ToWriteRequest(series, samples, nil, cortexpb.API))
+	require.NoError(t, err)
+
+	for i := range ingesters {
+		assert.Len(t, ingesters[i].series(), len(series))
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(validation.ShadowDiscards.WithLabelValues("max_label_names_per_series", userID)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(validation.ShadowDiscards.WithLabelValues("label_value_too_long", userID)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues("max_label_names_per_series", userID)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues("label_value_too_long", userID)))
+
+	// The dry run reports the shadow discards, without tracking them in the metrics.
+	report, err := ds[0].DryRunPush(ctx, cortexpb.ToWriteRequest(series, samples, nil, cortexpb.API))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"max_label_names_per_series": 1, "label_value_too_long": 1}, report.ShadowDiscards)
+	assert.Equal(t, float64(1), testutil.ToFloat64(validation.ShadowDiscards.WithLabelValues("max_label_names_per_series", userID)))
+}
+
 func TestDistributor_Push_ShouldGuaranteeShardingTokenConsistencyOverTheTime(t *testing.T) {
 	ctx := user.InjectOrgID(context.Background(), "user")
 	tests := map[string]struct {
@@ -1384,6 +1820,120 @@ func TestDistributor_Push_ExemplarValidation(t *testing.T) {
 	}
 }
 
+func TestDistributor_Push_ExemplarLimits(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	// Builds a request with a single series having 1 sample and the given exemplars.
+	makeRequest := func(exemplars ...[]string) *cortexpb.WriteRequest {
+		req := makeWriteRequestExemplar([]string{model.MetricNameLabel, "test"}, 1000, nil)
+		req.Timeseries[0].Samples = []cortexpb.Sample{{Value: 1, TimestampMs: 1000}}
+		req.Timeseries[0].Exemplars = nil
+		for _, e := range exemplars {
+			req.Timeseries[0].Exemplars = append(req.Timeseries[0].Exemplars, cortexpb.Exemplar{
+				Labels:      cortexpb.FromLabelsToLabelAdapters(labels.FromStrings(e...)),
+				TimestampMs: 1000,
+			})
+		}
+		return req
+	}
+
+	tests := map[string]struct {
+		prepareConfig     func(limits *validation.Limits)
+		reqs              []*cortexpb.WriteRequest
+		expectedSamples   int
+		expectedExemplars int
+		expectedDiscarded map[string]int
+	}{
+		"should ingest all exemplars if limits are disabled": {
+			prepareConfig:     func(limits *validation.Limits) {},
+			reqs:              []*cortexpb.WriteRequest{makeRequest([]string{"a", "1", "b", "2"}, []string{"a", strings.Repeat("0", 50)})},
+			expectedSamples:   1,
+			expectedExemplars: 2,
+		},
+		"should drop exemplars with too many labels and ingest the samples": {
+			prepareConfig: func(limits *validation.Limits) {
+				limits.MaxExemplarLabels = 1
+			},
+			reqs:              []*cortexpb.WriteRequest{makeRequest([]string{"a", "1", "b", "2"}, []string{"a", "1"})},
+			expectedSamples:   1,
+			expectedExemplars: 1,
+			expectedDiscarded: map[string]int{"exemplar_max_labels": 1},
+		},
+		"should drop exemplars with too long label values and ingest the samples": {
+			prepareConfig: func(limits *validation.Limits) {
+				limits.MaxExemplarLabelValueLength = 5
+			},
+			reqs:              []*cortexpb.WriteRequest{makeRequest([]string{"a", "123456"})},
+			expectedSamples:   1,
+			expectedExemplars: 0,
+			expectedDiscarded: map[string]int{"exemplar_label_value_too_long": 1},
+		},
+		"should drop exemplars exceeding the rate limit and ingest the samples": {
+			prepareConfig: func(limits *validation.Limits) {
+				limits.MaxExemplarsPerSecond = 2
+			},
+			reqs: []*cortexpb.WriteRequest{
+				makeRequest([]string{"a", "1"}, []string{"a", "2"}, []string{"a", "3"}),
+				makeRequest([]string{"a", "4"}),
+			},
+			expectedSamples:   2,
+			expectedExemplars: 2,
+			expectedDiscarded: map[string]int{validation.ExemplarRateLimited: 2},
+		},
+		"should drop all exemplars if disabled by the feature flag and ingest the samples": {
+			prepareConfig: func(limits *validation.Limits) {
+				limits.FeatureFlags = validation.FeatureFlagsMap{validation.FeatureExemplars: false}
+			},
+			reqs:              []*cortexpb.WriteRequest{makeRequest([]string{"a", "1"}, []string{"a", "2"})},
+			expectedSamples:   1,
+			expectedExemplars: 0,
+			expectedDiscarded: map[string]int{validation.ExemplarsDisabled: 2},
+		},
+	}
+
+	for testName, tc := range tests {
+		t.Run(testName, func(t *testing.T) {
+			limits := &validation.Limits{}
+			flagext.DefaultValues(limits)
+			tc.prepareConfig(limits)
+
+			ds, _, r, regs := prepare(t, prepConfig{
+				numIngesters:     2,
+				happyIngesters:   2,
+				numDistributors:  1,
+				shardByAllLabels: true,
+				limits:           limits,
+			})
+			defer stopAll(ds, r)
+
+			// The discarded exemplars metric is global, so we track the delta.
+			discardedBefore := map[string]float64{}
+			for reason := range tc.expectedDiscarded {
+				discardedBefore[reason] = testutil.ToFloat64(validation.DiscardedExemplars.WithLabelValues(reason, "user"))
+			}
+
+			for _, req := range tc.reqs {
+				_, err := ds[0].Push(ctx, req)
+				require.NoError(t, err)
+			}
+
+			assert.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(fmt.Sprintf(`
+				# HELP cortex_distributor_received_samples_total The total number of received samples, excluding rejected and deduped samples.
+				# TYPE cortex_distributor_received_samples_total counter
+				cortex_distributor_received_samples_total{user="user"} %d
+				# HELP cortex_distributor_received_exemplars_total The total number of received exemplars, excluding rejected and deduped exemplars.
+				# TYPE cortex_distributor_received_exemplars_total counter
+				cortex_distributor_received_exemplars_total{user="user"} %d
+			`, tc.expectedSamples, tc.expectedExemplars)), "cortex_distributor_received_samples_total", "cortex_distributor_received_exemplars_total"))
+
+			for reason, expected := range tc.expectedDiscarded {
+				discarded := testutil.ToFloat64(validation.DiscardedExemplars.WithLabelValues(reason, "user")) - discardedBefore[reason]
+				assert.Equal(t, float64(expected), discarded, reason)
+			}
+		})
+	}
+}
+
 func BenchmarkDistributor_Push(b *testing.B) {
 	const (
 		numSeriesPerRequest = 1000
@@ -1391,9 +1941,10 @@ func BenchmarkDistributor_Push(b *testing.B) {
 	ctx := user.InjectOrgID(context.Background(), "user")
 
 	tests := map[string]struct {
-		prepareConfig func(limits *validation.Limits)
-		prepareSeries func() ([]labels.Labels, []cortexpb.Sample)
-		expectedErr   string
+		prepareConfig   func(limits *validation.Limits)
+		prepareSeries   func() ([]labels.Labels, []cortexpb.Sample)
+		perTenantLimits bool
+		expectedErr     string
 	}{
 		"all samples successfully pushed": {
 			prepareConfig: func(limits *validation.Limits) {},
@@ -1418,6 +1969,30 @@ func BenchmarkDistributor_Push(b *testing.B) {
 			},
 			expectedErr: "",
 		},
+		"all samples successfully pushed with per-tenant limits": {
+			prepareConfig: func(limits *validation.Limits) {},
+			prepareSeries: func() ([]labels.Labels, []cortexpb.Sample) {
+				metrics := make([]labels.Labels, numSeriesPerRequest)
+				samples := make([]cortexpb.Sample, numSeriesPerRequest)
+
+				for i := 0; i < numSeriesPerRequest; i++ {
+					lbls := labels.NewBuilder(labels.Labels{{Name: model.MetricNameLabel, Value: "foo"}})
+					for i := 0; i < 10; i++ {
+						lbls.Set(fmt.Sprintf("name_%d", i), fmt.Sprintf("value_%d", i))
+					}
+
+					metrics[i] = lbls.Labels()
+					samples[i] = cortexpb.Sample{
+						Value:       float64(i),
+						TimestampMs: time.Now().UnixNano() / int64(time.Millisecond),
+					}
+				}
+
+				return metrics, samples
+			},
+			perTenantLimits: true,
+			expectedErr:     "",
+		},
 		"ingestion rate limit reached": {
 			prepareConfig: func(limits *validation.Limits) {
 				limits.IngestionRate = 1
@@ -1621,7 +2196,13 @@ func BenchmarkDistributor_Push(b *testing.B) {
 				return &noopIngester{}, nil
 			}
 
-			overrides, err := validation.NewOverrides(limits, nil)
+			// The per-tenant limits are served under a lock, like the runtime config does.
+			var tenantLimits validation.TenantLimits
+			if testData.perTenantLimits {
+				tenantLimits = &lockedTenantLimits{limits: map[string]*validation.Limits{"user": &limits}}
+			}
+
+			overrides, err := validation.NewOverrides(limits, tenantLimits)
 			require.NoError(b, err)
 
 			// Start the distributor.
@@ -1654,6 +2235,129 @@ func BenchmarkDistributor_Push(b *testing.B) {
 	}
 }
 
+// lockedTenantLimits serves the per-tenant limits under a lock.
+type lockedTenantLimits struct {
+	mtx    sync.RWMutex
+	limits map[string]*validation.Limits
+}
+
+func (l *lockedTenantLimits) ByUserID(userID string) *validation.Limits {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.limits[userID]
+}
+
+func (l *lockedTenantLimits) AllByUserID() map[string]*validation.Limits {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.limits
+}
+
+func BenchmarkDistributor_PushLocal(b *testing.B) {
+	const (
+		numSeriesPerRequest = 1000
+	)
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	// The ingester is a no-op, so that the benchmark measures only the cost of moving
+	// the validated series from the distributor to the ingester.
+	ingesterPush := func(_ context.Context, req *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+		cortexpb.ReuseSlice(req.Timeseries)
+		return &cortexpb.WriteResponse{}, nil
+	}
+
+	// Create an in-memory KV store for the ring with 1 ingester registered.
+	kvStore := consul.NewInMemoryClient(ring.GetCodec())
+	err := kvStore.CAS(context.Background(), ring.IngesterRingKey,
+		func(_ interface{}) (interface{}, bool, error) {
+			d := &ring.Desc{}
+			d.AddIngester("ingester-1", "127.0.0.1", "", ring.GenerateTokens(128, nil), ring.ACTIVE, time.Now())
+			return d, true, nil
+		},
+	)
+	require.NoError(b, err)
+
+	ingestersRing, err := ring.New(ring.Config{
+		KVStore:           kv.Config{Mock: kvStore},
+		HeartbeatTimeout:  60 * time.Minute,
+		ReplicationFactor: 1,
+	}, ring.IngesterRingKey, ring.IngesterRingKey, nil)
+	require.NoError(b, err)
+	require.NoError(b, services.StartAndAwaitRunning(context.Background(), ingestersRing))
+	b.Cleanup(func() {
+		require.NoError(b, services.StopAndAwaitTerminated(context.Background(), ingestersRing))
+	})
+
+	test.Poll(b, time.Second, 1, func() interface{} {
+		return ingestersRing.InstancesCount()
+	})
+
+	// Prepare the distributor configuration.
+	var distributorCfg Config
+	var clientConfig client.Config
+	limits := validation.Limits{}
+	flagext.DefaultValues(&distributorCfg, &clientConfig, &limits)
+
+	limits.IngestionRate = 0 // Unlimited.
+
+	distributorCfg.ShardByAllLabels = true
+	distributorCfg.IngesterClientFactory = func(addr string) (ring_client.PoolClient, error) {
+		return &marshalingIngester{push: ingesterPush}, nil
+	}
+
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(b, err)
+
+	// Start the distributor.
+	distributor, err := New(distributorCfg, clientConfig, overrides, ingestersRing, true, nil, log.NewNopLogger())
+	require.NoError(b, err)
+	require.NoError(b, services.StartAndAwaitRunning(context.Background(), distributor))
+	b.Cleanup(func() {
+		require.NoError(b, services.StopAndAwaitTerminated(context.Background(), distributor))
+	})
+
+	// Prepare the series to remote write before starting the benchmark.
+	metrics := make([]labels.Labels, numSeriesPerRequest)
+	samples := make([]cortexpb.Sample, numSeriesPerRequest)
+
+	for i := 0; i < numSeriesPerRequest; i++ {
+		lbls := labels.NewBuilder(labels.Labels{{Name: model.MetricNameLabel, Value: "foo"}})
+		for j := 0; j < 10; j++ {
+			lbls.Set(fmt.Sprintf("name_%d", j), fmt.Sprintf("value_%d_%d", j, i))
+		}
+
+		metrics[i] = lbls.Labels()
+		samples[i] = cortexpb.Sample{
+			Value:       float64(i),
+			TimestampMs: time.Now().UnixNano() / int64(time.Millisecond),
+		}
+	}
+
+	tests := map[string]func(req *cortexpb.WriteRequest) error{
+		"through the ring": func(req *cortexpb.WriteRequest) error {
+			_, err := distributor.Push(ctx, req)
+			return err
+		},
+		"local": func(req *cortexpb.WriteRequest) error {
+			_, err := distributor.PushLocal(ctx, req, ingesterPush)
+			return err
+		},
+	}
+
+	for testName, pushFn := range tests {
+		b.Run(testName, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for n := 0; n < b.N; n++ {
+				if err := pushFn(cortexpb.ToWriteRequest(metrics, samples, nil, cortexpb.API)); err != nil {
+					b.Fatalf("no error expected but got %v", err)
+				}
+			}
+		})
+	}
+}
+
 func TestSlowQueries(t *testing.T) {
 	ctx := user.InjectOrgID(context.Background(), "user")
 	nameMatcher := mustEqualMatcher(model.MetricNameLabel, "foo")
@@ -1808,6 +2512,137 @@ func TestDistributor_MetricsForLabelMatchers(t *testing.T) {
 	}
 }
 
+func TestDistributor_MetricsForLabelMatchersWithTimeRange(t *testing.T) {
+	series1 := labels.Labels{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "200"}}
+	series2 := labels.Labels{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "500"}}
+	series3 := labels.Labels{{Name: labels.MetricName, Value: "test_2"}}
+
+	// Each series is replicated to all the ingesters, holding different samples.
+	ingesterSeries := [][]cortexpb.TimeSeries{
+		{
+			{Labels: cortexpb.FromLabelsToLabelAdapters(series1), Samples: []cortexpb.Sample{{TimestampMs: 2000}, {TimestampMs: 3000}}},
+			{Labels: cortexpb.FromLabelsToLabelAdapters(series2), Samples: []cortexpb.Sample{{TimestampMs: 5000}}},
+			{Labels: cortexpb.FromLabelsToLabelAdapters(series3), Samples: []cortexpb.Sample{{TimestampMs: 7000}}},
+		},
+		{
+			{Labels: cortexpb.FromLabelsToLabelAdapters(series1), Samples: []cortexpb.Sample{{TimestampMs: 1000}, {TimestampMs: 2000}}},
+			// The series has no in-memory samples.
+			{Labels: cortexpb.FromLabelsToLabelAdapters(series2)},
+		},
+		{
+			{Labels: cortexpb.FromLabelsToLabelAdapters(series1)},
+		},
+	}
+
+	ds, ingesters, r, _ := prepare(t, prepConfig{
+		numIngesters:      len(ingesterSeries),
+		happyIngesters:    len(ingesterSeries),
+		numDistributors:   1,
+		shardByAllLabels:  true,
+		replicationFactor: 1, // All the ingesters are queried, with no errors allowed.
+	})
+	defer stopAll(ds, r)
+
+	for i, series := range ingesterSeries {
+		ingesters[i].timeseries = map[uint32]*cortexpb.PreallocTimeseries{}
+		for j := range series {
+			ingesters[i].timeseries[uint32(j)] = &cortexpb.PreallocTimeseries{TimeSeries: &series[j]}
+		}
+	}
+
+	ctx := user.InjectOrgID(context.Background(), "test")
+	resp, err := ds[0].MetricsForLabelMatchersWithTimeRange(ctx, 0, 10000,
+		[]*labels.Matcher{mustNewMatcher(labels.MatchEqual, "status", "200")},
+		[]*labels.Matcher{mustNewMatcher(labels.MatchEqual, model.MetricNameLabel, "test_1")},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, &client.MetricsForLabelMatchersResponse{
+		Metric: []*cortexpb.Metric{
+			{Labels: cortexpb.FromLabelsToLabelAdapters(series1)},
+			{Labels: cortexpb.FromLabelsToLabelAdapters(series2)},
+		},
+		TimeRanges: []client.SeriesTimeRange{
+			{MinTimeMs: 1000, MaxTimeMs: 3000},
+			{MinTimeMs: 5000, MaxTimeMs: 5000},
+		},
+	}, resp)
+	assert.Equal(t, len(ingesterSeries), countMockIngestersCalls(ingesters, "MetricsForLabelMatchers"))
+}
+
+func TestDistributor_LabelNames(t *testing.T) {
+	const numIngesters = 5
+
+	fixtures := []labels.Labels{
+		{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "200"}},
+		{{Name: labels.MetricName, Value: "test_1"}, {Name: "instance", Value: "a"}},
+		{{Name: labels.MetricName, Value: "test_2"}, {Name: "job", Value: "b"}},
+	}
+
+	tests := map[string]struct {
+		// The number of ingesters not supporting the label names matchers, like during a rolling upgrade.
+		oldIngesters   int
+		matchers       []*labels.Matcher
+		expectedResult []string
+		expectedErr    error
+	}{
+		"should return all the label names without matchers": {
+			expectedResult: []string{labels.MetricName, "instance", "job", "status"},
+		},
+		"should return all the label names without matchers even if some ingesters don't support them": {
+			oldIngesters:   2,
+			expectedResult: []string{labels.MetricName, "instance", "job", "status"},
+		},
+		"should return the label names of the series matching the matchers": {
+			matchers:       []*labels.Matcher{mustNewMatcher(labels.MatchEqual, labels.MetricName, "test_1")},
+			expectedResult: []string{labels.MetricName, "instance", "status"},
+		},
+		"should return an error if some ingesters don't support the matchers": {
+			oldIngesters: 2,
+			matchers:     []*labels.Matcher{mustNewMatcher(labels.MatchEqual, labels.MetricName, "test_1")},
+			expectedErr:  client.ErrLabelNamesMatchersNotSupported,
+		},
+		"should return an error if no ingester supports the matchers": {
+			oldIngesters: numIngesters,
+			matchers:     []*labels.Matcher{mustNewMatcher(labels.MatchEqual, labels.MetricName, "test_1")},
+			expectedErr:  client.ErrLabelNamesMatchersNotSupported,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			now := model.Now()
+
+			ds, ingesters, r, _ := prepare(t, prepConfig{
+				numIngesters:     numIngesters,
+				happyIngesters:   numIngesters,
+				numDistributors:  1,
+				shardByAllLabels: true,
+			})
+			defer stopAll(ds, r)
+
+			for i := 0; i < testData.oldIngesters; i++ {
+				ingesters[i].labelNamesMatchersUnsupported = true
+			}
+
+			ctx := user.InjectOrgID(context.Background(), "test")
+			for _, series := range fixtures {
+				_, err := ds[0].Push(ctx, mockWriteRequest(series, 1, int64(now)))
+				require.NoError(t, err)
+			}
+
+			names, err := ds[0].LabelNames(ctx, now, now, testData.matchers...)
+			if testData.expectedErr != nil {
+				require.Equal(t, testData.expectedErr, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedResult, names)
+		})
+	}
+}
+
 func TestDistributor_MetricsMetadata(t *testing.T) {
 	const numIngesters = 5
 
@@ -1867,6 +2702,64 @@ func TestDistributor_MetricsMetadata(t *testing.T) {
 	}
 }
 
+func TestDistributor_Push_ShouldSendMetadataToAllIngestersIfRequired(t *testing.T) {
+	const numIngesters = 5
+
+	tests := map[string]struct {
+		requireMetricMetadata bool
+		metadataSendPeriod    time.Duration
+		expectedIngesters     int
+	}{
+		"should send the metadata to the ingesters owning it if the metric metadata is not required": {
+			expectedIngesters: 3,
+		},
+		"should send the metadata to all ingesters if the metric metadata is required": {
+			requireMetricMetadata: true,
+			expectedIngesters:     numIngesters,
+		},
+		"should send the batched metadata to all ingesters if the metric metadata is required": {
+			requireMetricMetadata: true,
+			metadataSendPeriod:    10 * time.Millisecond,
+			expectedIngesters:     numIngesters,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			limits := &validation.Limits{}
+			flagext.DefaultValues(limits)
+			limits.RequireMetricMetadata = testData.requireMetricMetadata
+
+			ds, ingesters, r, _ := prepare(t, prepConfig{
+				numIngesters:       numIngesters,
+				happyIngesters:     numIngesters,
+				numDistributors:    1,
+				shardByAllLabels:   true,
+				limits:             limits,
+				metadataSendPeriod: testData.metadataSendPeriod,
+			})
+			defer stopAll(ds, r)
+
+			ctx := user.InjectOrgID(context.Background(), "test")
+			_, err := ds[0].Push(ctx, makeWriteRequest(0, 1, 1))
+			require.NoError(t, err)
+
+			// The last ingester may receive the metadata after the quorum is reached.
+			test.Poll(t, time.Second, testData.expectedIngesters, func() interface{} {
+				count := 0
+				for i := range ingesters {
+					ingesters[i].Lock()
+					if len(ingesters[i].metadata) > 0 {
+						count++
+					}
+					ingesters[i].Unlock()
+				}
+				return count
+			})
+		})
+	}
+}
+
 func mustNewMatcher(t labels.MatchType, n, v string) *labels.Matcher {
 	m, err := labels.NewMatcher(t, n, v)
 	if err != nil {
@@ -1899,6 +2792,11 @@ type prepConfig struct {
 	maxInflightRequests          int
 	maxIngestionRate             float64
 	replicationFactor            int
+	metadataSendPeriod           time.Duration
+	pushStreamThreshold          int
+	pushStreamMessageSize        int
+	consistencyTokenEnabled      bool
+	consistencyTokenMaxWait      time.Duration
 }
 
 func prepare(t *testing.T, cfg prepConfig) ([]*Distributor, []mockIngester, *ring.Ring, []*prometheus.Registry) {
@@ -1987,6 +2885,16 @@ func prepare(t *testing.T, cfg prepConfig) ([]*Distributor, []mockIngester, *rin
 		distributorCfg.SkipLabelNameValidation = cfg.skipLabelNameValidation
 		distributorCfg.InstanceLimits.MaxInflightPushRequests = cfg.maxInflightRequests
 		distributorCfg.InstanceLimits.MaxIngestionRate = cfg.maxIngestionRate
+		distributorCfg.MetadataSendPeriod = cfg.metadataSendPeriod
+		distributorCfg.MetadataSendBackoff = backoff.Config{MinBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond, MaxRetries: 1000}
+		distributorCfg.PushStream.ThresholdBytes = cfg.pushStreamThreshold
+		if cfg.pushStreamMessageSize > 0 {
+			distributorCfg.PushStream.MessageSizeBytes = cfg.pushStreamMessageSize
+		}
+		distributorCfg.ConsistencyToken.Enabled = cfg.consistencyTokenEnabled
+		if cfg.consistencyTokenMaxWait > 0 {
+			distributorCfg.ConsistencyToken.MaxWait = cfg.consistencyTokenMaxWait
+		}
 
 		if cfg.shuffleShardEnabled {
 			distributorCfg.ShardingStrategy = util.ShardingStrategyShuffle
@@ -2146,6 +3054,12 @@ type mockIngester struct {
 	metadata   map[uint32]map[cortexpb.MetricMetadata]struct{}
 	queryDelay time.Duration
 	calls      map[string]int
+
+	// Simulates an ingester ignoring the label names matchers, like before they were supported.
+	labelNamesMatchersUnsupported bool
+
+	// Simulates an ingester not supporting the push stream, like before it was supported.
+	pushStreamUnsupported bool
 }
 
 func (i *mockIngester) series() map[uint32]*cortexpb.PreallocTimeseries {
@@ -2178,6 +3092,11 @@ func (i *mockIngester) Push(ctx context.Context, req *cortexpb.WriteRequest, opt
 
 	i.trackCall("Push")
 
+	return i.push(ctx, req)
+}
+
+// push must be called with the lock held.
+func (i *mockIngester) push(ctx context.Context, req *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
 	if !i.happy {
 		return nil, errFail
 	}
@@ -2228,6 +3147,54 @@ func (i *mockIngester) Push(ctx context.Context, req *cortexpb.WriteRequest, opt
 	return &cortexpb.WriteResponse{}, nil
 }
 
+func (i *mockIngester) PushStream(ctx context.Context, opts ...grpc.CallOption) (client.Ingester_PushStreamClient, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	i.trackCall("PushStream")
+
+	return &mockPushStreamClient{ctx: ctx, ingester: i}, nil
+}
+
+// mockPushStreamClient pushes each message of the stream to the mockIngester.
+type mockPushStreamClient struct {
+	grpc.ClientStream
+	ctx      context.Context
+	ingester *mockIngester
+	err      error
+}
+
+func (s *mockPushStreamClient) Send(req *cortexpb.WriteRequest) error {
+	s.ingester.Lock()
+	defer s.ingester.Unlock()
+
+	// Like gRPC, the error of an unknown method is returned once the stream is closed.
+	if s.ingester.pushStreamUnsupported {
+		return nil
+	}
+
+	s.ingester.trackCall("PushStream.Send")
+
+	if _, err := s.ingester.push(s.ctx, req); err != nil {
+		s.err = err
+		return io.EOF
+	}
+	return nil
+}
+
+func (s *mockPushStreamClient) CloseAndRecv() (*client.PushStreamResponse, error) {
+	s.ingester.Lock()
+	defer s.ingester.Unlock()
+
+	if s.ingester.pushStreamUnsupported {
+		return nil, status.Error(codes.Unimplemented, "unknown method PushStream for service cortex.Ingester")
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &client.PushStreamResponse{}, nil
+}
+
 func (i *mockIngester) Query(ctx context.Context, req *client.QueryRequest, opts ...grpc.CallOption) (*client.QueryResponse, error) {
 	time.Sleep(i.queryDelay)
 
@@ -2340,12 +3307,54 @@ func (i *mockIngester) MetricsForLabelMatchers(ctx context.Context, req *client.
 		for _, ts := range i.timeseries {
 			if match(ts.Labels, matchers) {
 				response.Metric = append(response.Metric, &cortexpb.Metric{Labels: ts.Labels})
+				if req.IncludeTimeRange {
+					var timeRange client.SeriesTimeRange
+					if len(ts.Samples) > 0 {
+						timeRange = client.SeriesTimeRange{MinTimeMs: ts.Samples[0].TimestampMs, MaxTimeMs: ts.Samples[len(ts.Samples)-1].TimestampMs}
+					}
+					response.TimeRanges = append(response.TimeRanges, timeRange)
+				}
 			}
 		}
 	}
 	return &response, nil
 }
 
+func (i *mockIngester) LabelNames(ctx context.Context, req *client.LabelNamesRequest, opts ...grpc.CallOption) (*client.LabelNamesResponse, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	i.trackCall("LabelNames")
+
+	if !i.happy {
+		return nil, errFail
+	}
+
+	_, _, matchers, err := client.FromLabelNamesRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if i.labelNamesMatchersUnsupported {
+		matchers = nil
+	}
+
+	names := map[string]struct{}{}
+	for _, ts := range i.timeseries {
+		if !match(ts.Labels, matchers) {
+			continue
+		}
+		for _, l := range ts.Labels {
+			names[l.Name] = struct{}{}
+		}
+	}
+
+	response := &client.LabelNamesResponse{MatchersApplied: !i.labelNamesMatchersUnsupported}
+	for name := range names {
+		response.LabelNames = append(response.LabelNames, name)
+	}
+	return response, nil
+}
+
 func (i *mockIngester) MetricsMetadata(ctx context.Context, req *client.MetricsMetadataRequest, opts ...grpc.CallOption) (*client.MetricsMetadataResponse, error) {
 	i.Lock()
 	defer i.Unlock()
@@ -2395,6 +3404,26 @@ func (i *noopIngester) Push(ctx context.Context, req *cortexpb.WriteRequest, opt
 	return nil, nil
 }
 
+// marshalingIngester simulates the gRPC hop between the distributor and the ingester,
+// marshaling and unmarshaling the pushed request.
+type marshalingIngester struct {
+	noopIngester
+	push push.Func
+}
+
+func (i *marshalingIngester) Push(ctx context.Context, req *cortexpb.WriteRequest, opts ...grpc.CallOption) (*cortexpb.WriteResponse, error) {
+	data, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	var received cortexpb.PreallocWriteRequest
+	if err := received.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return i.push(ctx, &received.WriteRequest)
+}
+
 type stream struct {
 	grpc.ClientStream
 	i       int
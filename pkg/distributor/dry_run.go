@@ -0,0 +1,133 @@
+package distributor
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+)
+
+const (
+	// Max number of example series reported for each rejection reason.
+	maxDryRunExamplesPerReason = 5
+
+	// The reason reported for the samples deduplicated by the HA tracker.
+	dryRunReasonHADeduplicated = "ha_deduplicated"
+)
+
+// DryRunReport is the outcome of the validation of a write request which has not been ingested.
+type DryRunReport struct {
+	AcceptedSeries    int `json:"accepted_series"`
+	AcceptedSamples   int `json:"accepted_samples"`
+	AcceptedExemplars int `json:"accepted_exemplars"`
+	AcceptedMetadata  int `json:"accepted_metadata"`
+
+	// The rejected samples, exemplars and metadata by reason. They're counted like the
+	// cortex_discarded_samples_total, cortex_discarded_exemplars_total and cortex_discarded_metadata_total
+	// metrics: for example, a series rejected because of its labels counts as a single sample.
+	RejectedSamples   map[string]int `json:"rejected_samples"`
+	RejectedExemplars map[string]int `json:"rejected_exemplars"`
+	RejectedMetadata  map[string]int `json:"rejected_metadata"`
+
+	// The number of labels which would be stripped because their name is not allowed.
+	StrippedLabels int `json:"stripped_labels"`
+
+	// The accepted series which exceeded a validation limit in warn mode, by reason.
+	Warnings map[string]int `json:"warnings"`
+
+	// The accepted series which would be discarded by the shadow limits, by reason.
+	ShadowDiscards map[string]int `json:"shadow_discards"`
+
+	// Examples of the rejected series by reason.
+	Examples map[string][]string `json:"examples"`
+}
+
+func newDryRunReport() *DryRunReport {
+	return &DryRunReport{
+		RejectedSamples:   map[string]int{},
+		RejectedExemplars: map[string]int{},
+		RejectedMetadata:  map[string]int{},
+		Warnings:          map[string]int{},
+		ShadowDiscards:    map[string]int{},
+		Examples:          map[string][]string{},
+	}
+}
+
+// accept is the sendFunc of the dry run, which records the validated series and metadata
+// instead of sending them to the ingesters.
+func (r *DryRunReport) accept(_ context.Context, _ string, req *cortexpb.WriteRequest, validated validatedRequest) error {
+	r.AcceptedSeries += len(validated.timeseries)
+	for _, ts := range validated.timeseries {
+		r.AcceptedSamples += len(ts.Samples)
+		r.AcceptedExemplars += len(ts.Exemplars)
+	}
+	r.AcceptedMetadata += len(validated.metadata)
+
+	cortexpb.ReuseSlice(req.Timeseries)
+	return nil
+}
+
+func (r *DryRunReport) addExample(reason string, series []cortexpb.LabelAdapter) {
+	if len(series) == 0 || len(r.Examples[reason]) >= maxDryRunExamplesPerReason {
+		return
+	}
+
+	// The series labels may be unsafe, so they're copied formatting them.
+	r.Examples[reason] = append(r.Examples[reason], cortexpb.FromLabelAdaptersToLabels(series).String())
+}
+
+// dryRunRecorder records the discarded samples, exemplars and metadata in the dry run report.
+type dryRunRecorder struct {
+	report *DryRunReport
+}
+
+func (r dryRunRecorder) DiscardedSamples(reason, _ string, series []cortexpb.LabelAdapter, count int) {
+	if count <= 0 {
+		return
+	}
+	r.report.RejectedSamples[reason] += count
+	r.report.addExample(reason, series)
+}
+
+func (r dryRunRecorder) DiscardedExemplars(reason, _ string, series []cortexpb.LabelAdapter, count int) {
+	if count <= 0 {
+		return
+	}
+	r.report.RejectedExemplars[reason] += count
+	r.report.addExample(reason, series)
+}
+
+func (r dryRunRecorder) DiscardedMetadata(reason, _ string, count int) {
+	if count <= 0 {
+		return
+	}
+	r.report.RejectedMetadata[reason] += count
+}
+
+func (r dryRunRecorder) ValidationWarning(reason, _ string, _ []cortexpb.LabelAdapter) {
+	r.report.Warnings[reason]++
+}
+
+func (r dryRunRecorder) ShadowDiscard(reason, _ string, _ []cortexpb.LabelAdapter) {
+	r.report.ShadowDiscards[reason]++
+}
+
+// DryRunPush validates the write request exactly like Push, running the relabeling, the HA
+// deduplication and the limits, and reports which series would be accepted or rejected. The
+// request is never sent to the ingesters, and the validation has no side effect: the metrics,
+// the rate limiters and the HA tracker are left untouched.
+func (d *Distributor) DryRunPush(ctx context.Context, req *cortexpb.WriteRequest) (*DryRunReport, error) {
+	report := newDryRunReport()
+
+	if _, err := d.push(ctx, req, report.accept, report); err != nil {
+		// The rejections are collected in the report, while any other error is returned.
+		resp, ok := httpgrpc.HTTPResponseFromError(err)
+		if !ok || (resp.Code != http.StatusAccepted && resp.Code/100 != 4) {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
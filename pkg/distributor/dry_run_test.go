@@ -0,0 +1,133 @@
+package distributor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestDistributor_DryRunPush(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	limits := &validation.Limits{}
+	flagext.DefaultValues(limits)
+	limits.MaxLabelNamesPerSeries = 3
+	limits.MaxLabelValueLength = 10
+	limits.MaxMetadataLength = 10
+	limits.DropLabels = []string{"dropped"}
+
+	ds, ingesters, r, regs := prepare(t, prepConfig{
+		numIngesters:     3,
+		happyIngesters:   3,
+		numDistributors:  1,
+		shardByAllLabels: true,
+		limits:           limits,
+	})
+	defer stopAll(ds, r)
+
+	series := []labels.Labels{
+		labels.FromStrings(model.MetricNameLabel, "foo", "job", "a"),
+		// The dropped label is removed before the validation.
+		labels.FromStrings(model.MetricNameLabel, "foo", "job", "b", "dropped", "x", "pod", "1"),
+		labels.FromStrings(model.MetricNameLabel, "foo", "999.illegal", "a"),
+		labels.FromStrings(model.MetricNameLabel, "foo", "job", "a", "pod", "1", "zone", "z"),
+		labels.FromStrings(model.MetricNameLabel, "foo", "job", "too-long-label-value"),
+		labels.FromStrings(model.MetricNameLabel, "foo", "job", "c"),
+	}
+	samples := []cortexpb.Sample{
+		{TimestampMs: now, Value: 1},
+		{TimestampMs: now, Value: 2},
+		{TimestampMs: now, Value: 3},
+		{TimestampMs: now, Value: 4},
+		{TimestampMs: now, Value: 5},
+		{TimestampMs: now + time.Hour.Milliseconds(), Value: 6},
+	}
+	metadata := []*cortexpb.MetricMetadata{
+		{MetricFamilyName: "foo", Help: "help", Type: cortexpb.COUNTER},
+		{MetricFamilyName: "foo", Help: "too long help text", Type: cortexpb.COUNTER},
+	}
+
+	// The metric is a global one, so we compare the values before and after the dry run.
+	discardedBefore := testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues("label_invalid", "user"))
+
+	report, err := ds[0].DryRunPush(ctx, cortexpb.ToWriteRequest(series, samples, metadata, cortexpb.API))
+	require.NoError(t, err)
+
+	assert.Equal(t, &DryRunReport{
+		AcceptedSeries:   2,
+		AcceptedSamples:  2,
+		AcceptedMetadata: 1,
+		RejectedSamples: map[string]int{
+			"label_invalid":              1,
+			"max_label_names_per_series": 1,
+			"label_value_too_long":       1,
+			"too_far_in_future":          1,
+		},
+		RejectedExemplars: map[string]int{},
+		RejectedMetadata: map[string]int{
+			"help_too_long": 1,
+		},
+		Warnings:       map[string]int{},
+		ShadowDiscards: map[string]int{},
+		Examples: map[string][]string{
+			"label_invalid":              {`{999.illegal="a", __name__="foo"}`},
+			"max_label_names_per_series": {`{__name__="foo", job="a", pod="1", zone="z"}`},
+			"label_value_too_long":       {`{__name__="foo", job="too-long-label-value"}`},
+			"too_far_in_future":          {`{__name__="foo", job="c"}`},
+		},
+	}, report)
+
+	// The series must never be sent to the ingesters, and the validation must have no side effect.
+	assert.Equal(t, 0, countMockIngestersCalls(ingesters, "Push"))
+	assert.Equal(t, discardedBefore, testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues("label_invalid", "user")))
+	assert.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(""), "cortex_distributor_received_samples_total", "cortex_distributor_samples_in_total"))
+}
+
+func TestDistributor_DryRunPush_ShouldNotConsumeTheIngestionRateLimit(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	limits := &validation.Limits{}
+	flagext.DefaultValues(limits)
+	limits.IngestionRate = 3
+	limits.IngestionBurstSize = 3
+
+	ds, _, r, _ := prepare(t, prepConfig{
+		numIngesters:     3,
+		happyIngesters:   3,
+		numDistributors:  1,
+		shardByAllLabels: true,
+		limits:           limits,
+	})
+	defer stopAll(ds, r)
+
+	// Repeated dry runs within the limit are always accepted.
+	for i := 0; i < 3; i++ {
+		report, err := ds[0].DryRunPush(ctx, makeWriteRequest(0, 2, 0))
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.AcceptedSamples)
+		assert.Empty(t, report.RejectedSamples)
+	}
+
+	// A dry run exceeding the limit is reported as rate limited.
+	report, err := ds[0].DryRunPush(ctx, makeWriteRequest(0, 4, 0))
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.AcceptedSamples)
+	assert.Equal(t, map[string]int{validation.RateLimited: 4}, report.RejectedSamples)
+
+	// The actual push can still consume the whole limit.
+	_, err = ds[0].Push(ctx, makeWriteRequest(0, 3, 0))
+	require.NoError(t, err)
+}
@@ -27,6 +27,7 @@ import (
 var (
 	errNegativeUpdateTimeoutJitterMax = errors.New("HA tracker max update timeout jitter shouldn't be negative")
 	errInvalidFailoverTimeout         = "HA Tracker failover timeout (%v) must be at least 1s greater than update timeout - max jitter (%v)"
+	errReplicaNotFound                = errors.New("no elected replica found for the given user and cluster")
 )
 
 type haTrackerLimits interface {
@@ -119,6 +120,7 @@ type haTracker struct {
 	replicasMarkedForDeletion prometheus.Counter
 	deletedReplicas           prometheus.Counter
 	markingForDeletionsFailed prometheus.Counter
+	forgottenReplicas         prometheus.Counter
 }
 
 // NewClusterTracker returns a new HA cluster tracker using either Consul
@@ -171,6 +173,10 @@ func newHATracker(cfg HATrackerConfig, limits haTrackerLimits, reg prometheus.Re
 			Name: "cortex_ha_tracker_replicas_cleanup_delete_failed_total",
 			Help: "Number of elected replicas that failed to be marked for deletion, or deleted.",
 		}),
+		forgottenReplicas: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ha_tracker_replicas_forgotten_total",
+			Help: "Number of elected replicas forcibly forgotten through the HA tracker API.",
+		}),
 	}
 
 	if cfg.EnableHATracker {
@@ -354,6 +360,31 @@ func (c *haTracker) cleanupOldReplicas(ctx context.Context, deadline time.Time)
 	}
 }
 
+// forgetReplica marks the elected replica for the given user and cluster as deleted, so that
+// a new replica gets elected on the next received sample. Distributors watching the KV store
+// remove the entry from memory when they get notified about the marking, while the actual
+// deletion from the KV store is done by the cleanup loop.
+func (c *haTracker) forgetReplica(ctx context.Context, userID, cluster string) error {
+	key := fmt.Sprintf("%s/%s", userID, cluster)
+
+	err := c.client.CAS(ctx, key, func(in interface{}) (out interface{}, retry bool, err error) {
+		desc, ok := in.(*ReplicaDesc)
+		if !ok || desc == nil || desc.DeletedAt > 0 {
+			return nil, false, errReplicaNotFound
+		}
+
+		desc.DeletedAt = timestamp.FromTime(time.Now())
+		return desc, true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.forgottenReplicas.Inc()
+	level.Info(c.logger).Log("msg", "forgot elected replica", "user", userID, "cluster", cluster)
+	return nil
+}
+
 // CheckReplica checks the cluster and replica against the backing KVStore and local cache in the
 // tracker c to see if we should accept the incomming sample. It will return an error if the sample
 // should not be accepted. Note that internally this function does checks against the stored values
@@ -399,8 +430,39 @@ func (c *haTracker) checkReplica(ctx context.Context, userID, cluster, replica s
 	return err
 }
 
+// checkReplicaDryRun is like checkReplica, but it checks the replica against the cached elected
+// replicas only, without ever updating the KV store: the outcome may differ from checkReplica
+// when the cache isn't up to date.
+func (c *haTracker) checkReplicaDryRun(userID, cluster, replica string, now time.Time) error {
+	// If HA tracking isn't enabled then accept the sample
+	if !c.cfg.EnableHATracker {
+		return nil
+	}
+	key := fmt.Sprintf("%s/%s", userID, cluster)
+
+	c.electedLock.RLock()
+	entry, ok := c.elected[key]
+	clusters := len(c.clusters[userID])
+	c.electedLock.RUnlock()
+
+	if !ok {
+		if limit := c.limits.MaxHAClusters(userID); limit > 0 && clusters+1 > limit {
+			return tooManyClustersError{limit: limit}
+		}
+		return nil
+	}
+
+	// The failover to another replica happens only once the failover timeout has elapsed.
+	if entry.Replica != replica && now.Sub(timestamp.Time(entry.ReceivedAt)) < c.cfg.FailoverTimeout {
+		return replicasNotMatchError{replica: replica, elected: entry.Replica}
+	}
+	return nil
+}
+
 func (c *haTracker) checkKVStore(ctx context.Context, key, replica string, now time.Time) error {
 	return c.client.CAS(ctx, key, func(in interface{}) (out interface{}, retry bool, err error) {
+		electedAt := timestamp.FromTime(now)
+
 		if desc, ok := in.(*ReplicaDesc); ok && desc.DeletedAt == 0 {
 			// We don't need to CAS and update the timestamp in the KV store if the timestamp we've received
 			// this sample at is less than updateTimeout amount of time since the timestamp in the KV store.
@@ -413,6 +475,11 @@ func (c *haTracker) checkKVStore(ctx context.Context, key, replica string, now t
 			if desc.Replica != replica && now.Sub(timestamp.Time(desc.ReceivedAt)) < c.cfg.FailoverTimeout {
 				return nil, false, replicasNotMatchError{replica: replica, elected: desc.Replica}
 			}
+
+			// Keep the election time if we're just refreshing the timestamp of the elected replica.
+			if desc.Replica == replica && desc.ElectedAt > 0 {
+				electedAt = desc.ElectedAt
+			}
 		}
 
 		// There was either invalid or no data for the key, so we now accept samples
@@ -422,6 +489,7 @@ func (c *haTracker) checkKVStore(ctx context.Context, key, replica string, now t
 			Replica:    replica,
 			ReceivedAt: timestamp.FromTime(now),
 			DeletedAt:  0,
+			ElectedAt:  electedAt,
 		}, true, nil
 	})
 }
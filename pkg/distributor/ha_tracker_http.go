@@ -1,12 +1,14 @@
 package distributor
 
 import (
+	"errors"
 	"html/template"
 	"net/http"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/prometheus/pkg/timestamp"
 
 	"github.com/cortexproject/cortex/pkg/util"
@@ -29,6 +31,7 @@ const trackerTpl = `
 					<th>Cluster</th>
 					<th>Replica</th>
 					<th>Elected Time</th>
+					<th>Last Received Time</th>
 					<th>Time Until Update</th>
 					<th>Time Until Failover</th>
 				</tr>
@@ -40,6 +43,7 @@ const trackerTpl = `
 					<td>{{ .Cluster }}</td>
 					<td>{{ .Replica }}</td>
 					<td>{{ .ElectedAt }}</td>
+					<td>{{ .ReceivedAt }}</td>
 					<td>{{ .UpdateTime }}</td>
 					<td>{{ .FailoverTime }}</td>
 				</tr>
@@ -56,12 +60,18 @@ func init() {
 }
 
 func (h *haTracker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodDelete {
+		h.deleteHandler(w, req)
+		return
+	}
+
 	h.electedLock.RLock()
 	type replica struct {
 		UserID       string        `json:"userID"`
 		Cluster      string        `json:"cluster"`
 		Replica      string        `json:"replica"`
 		ElectedAt    time.Time     `json:"electedAt"`
+		ReceivedAt   time.Time     `json:"receivedAt"`
 		UpdateTime   time.Duration `json:"updateDuration"`
 		FailoverTime time.Duration `json:"failoverDuration"`
 	}
@@ -70,11 +80,18 @@ func (h *haTracker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	for key, desc := range h.elected {
 		chunks := strings.SplitN(key, "/", 2)
 
+		// Replicas elected before the election time was tracked only have the received time.
+		electedAt := desc.ElectedAt
+		if electedAt == 0 {
+			electedAt = desc.ReceivedAt
+		}
+
 		electedReplicas = append(electedReplicas, replica{
 			UserID:       chunks[0],
 			Cluster:      chunks[1],
 			Replica:      desc.Replica,
-			ElectedAt:    timestamp.Time(desc.ReceivedAt),
+			ElectedAt:    timestamp.Time(electedAt),
+			ReceivedAt:   timestamp.Time(desc.ReceivedAt),
 			UpdateTime:   time.Until(timestamp.Time(desc.ReceivedAt).Add(h.cfg.UpdateTimeout)),
 			FailoverTime: time.Until(timestamp.Time(desc.ReceivedAt).Add(h.cfg.FailoverTimeout)),
 		})
@@ -99,3 +116,31 @@ func (h *haTracker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		Now:     time.Now(),
 	}, trackerTmpl, req)
 }
+
+// deleteHandler forcibly forgets the elected replica for the user and cluster
+// given in the request, causing a re-election on the next received sample.
+func (h *haTracker) deleteHandler(w http.ResponseWriter, req *http.Request) {
+	if !h.cfg.EnableHATracker {
+		http.Error(w, "HA tracker is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	userID := req.FormValue("user")
+	cluster := req.FormValue("cluster")
+	if userID == "" || cluster == "" {
+		http.Error(w, "both user and cluster parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.forgetReplica(req.Context(), userID, cluster)
+	if errors.Is(err, errReplicaNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		level.Error(h.logger).Log("msg", "failed to forget elected replica", "user", userID, "cluster", cluster, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
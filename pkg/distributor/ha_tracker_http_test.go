@@ -0,0 +1,118 @@
+package distributor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ring/kv"
+	"github.com/cortexproject/cortex/pkg/ring/kv/consul"
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+)
+
+func TestHATracker_ServeHTTP(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	mock := kv.PrefixClient(consul.NewInMemoryClient(GetReplicaDescCodec()), "prefix")
+	c, err := newHATracker(HATrackerConfig{
+		EnableHATracker:        true,
+		KVStore:                kv.Config{Mock: mock},
+		UpdateTimeout:          time.Second,
+		UpdateTimeoutJitterMax: 0,
+		FailoverTimeout:        2 * time.Second,
+	}, trackerLimits{maxClusters: 100}, reg, util_log.Logger)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	defer services.StopAndAwaitTerminated(context.Background(), c) //nolint:errcheck
+
+	electedAt := time.Now().Add(-5 * time.Second)
+	require.NoError(t, c.checkReplica(context.Background(), "user-1", "cluster-a", "replica-1", electedAt))
+	require.NoError(t, c.checkReplica(context.Background(), "user-2", "cluster-b", "replica-2", time.Now()))
+
+	// Refresh the received timestamp of the first replica: the election time must not change.
+	receivedAt := time.Now()
+	require.NoError(t, c.checkReplica(context.Background(), "user-1", "cluster-a", "replica-1", receivedAt))
+	checkReplicaTimestamp(t, time.Second, c, "user-1", "cluster-a", "replica-1", receivedAt)
+	checkUserClusters(t, time.Second, c, "user-2", 1)
+
+	type response struct {
+		Elected []struct {
+			UserID     string    `json:"userID"`
+			Cluster    string    `json:"cluster"`
+			Replica    string    `json:"replica"`
+			ElectedAt  time.Time `json:"electedAt"`
+			ReceivedAt time.Time `json:"receivedAt"`
+		} `json:"elected"`
+	}
+
+	list := func() response {
+		req := httptest.NewRequest(http.MethodGet, "/distributor/ha_tracker", nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res response
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		return res
+	}
+
+	res := list()
+	require.Len(t, res.Elected, 2)
+	assert.Equal(t, "user-1", res.Elected[0].UserID)
+	assert.Equal(t, "cluster-a", res.Elected[0].Cluster)
+	assert.Equal(t, "replica-1", res.Elected[0].Replica)
+	assert.Equal(t, electedAt.UnixNano()/int64(time.Millisecond), res.Elected[0].ElectedAt.UnixNano()/int64(time.Millisecond))
+	assert.Equal(t, receivedAt.UnixNano()/int64(time.Millisecond), res.Elected[0].ReceivedAt.UnixNano()/int64(time.Millisecond))
+	assert.Equal(t, "user-2", res.Elected[1].UserID)
+
+	deleteReplica := func(query string) int {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/distributor/ha_tracker?"+query, nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, deleteReplica("user=user-1"))
+	assert.Equal(t, http.StatusNotFound, deleteReplica("user=user-1&cluster=unknown"))
+	assert.Equal(t, http.StatusNoContent, deleteReplica("user=user-1&cluster=cluster-a"))
+
+	// The replica is removed from memory through the watch notification, but still in the KV store marked for deletion.
+	checkReplicaDeletionState(t, time.Second, c, "user-1", "cluster-a", false, true, true)
+	checkUserClusters(t, time.Second, c, "user-1", 0)
+
+	res = list()
+	require.Len(t, res.Elected, 1)
+	assert.Equal(t, "user-2", res.Elected[0].UserID)
+
+	// Deleting it again fails, because it has already been forgotten.
+	assert.Equal(t, http.StatusNotFound, deleteReplica("user=user-1&cluster=cluster-a"))
+
+	// A sample from another replica triggers a re-election straight away.
+	now := time.Now()
+	require.NoError(t, c.checkReplica(context.Background(), "user-1", "cluster-a", "replica-2", now))
+	checkReplicaTimestamp(t, time.Second, c, "user-1", "cluster-a", "replica-2", now)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ha_tracker_replicas_forgotten_total Number of elected replicas forcibly forgotten through the HA tracker API.
+		# TYPE cortex_ha_tracker_replicas_forgotten_total counter
+		cortex_ha_tracker_replicas_forgotten_total 1
+	`), "cortex_ha_tracker_replicas_forgotten_total"))
+}
+
+func TestHATracker_ServeHTTP_DeleteWhenDisabled(t *testing.T) {
+	c, err := newHATracker(HATrackerConfig{EnableHATracker: false}, trackerLimits{}, nil, util_log.Logger)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/distributor/ha_tracker?user=user-1&cluster=cluster-a", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -178,6 +178,47 @@ func TestCheckReplicaOverwriteTimeout(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestCheckReplicaDryRun(t *testing.T) {
+	replica1 := "replica1"
+	replica2 := "replica2"
+
+	// The test doesn't use the "inmemory" store, which is shared with the other tests.
+	codec := GetReplicaDescCodec()
+	mock := kv.PrefixClient(consul.NewInMemoryClient(codec), "prefix")
+	c, err := newHATracker(HATrackerConfig{
+		EnableHATracker:        true,
+		KVStore:                kv.Config{Mock: mock},
+		UpdateTimeout:          100 * time.Millisecond,
+		UpdateTimeoutJitterMax: 0,
+		FailoverTimeout:        time.Second,
+	}, trackerLimits{maxClusters: 1}, nil, log.NewNopLogger())
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+	defer services.StopAndAwaitTerminated(context.Background(), c) //nolint:errcheck
+
+	now := time.Now()
+
+	// An unknown cluster is accepted, but the replica isn't elected.
+	assert.NoError(t, c.checkReplicaDryRun("user", "test", replica1, now))
+	assert.NoError(t, c.checkReplicaDryRun("user", "test", replica2, now))
+	waitForClustersUpdate(t, 0, c, "user")
+
+	// Elect replica1.
+	require.NoError(t, c.checkReplica(context.Background(), "user", "test", replica1, now))
+	waitForClustersUpdate(t, 1, c, "user")
+
+	assert.NoError(t, c.checkReplicaDryRun("user", "test", replica1, now))
+	assert.True(t, errors.Is(c.checkReplicaDryRun("user", "test", replica2, now), replicasNotMatchError{}))
+	assert.True(t, errors.Is(c.checkReplicaDryRun("user", "other", replica1, now), tooManyClustersError{}))
+
+	// Once the failover timeout has elapsed, replica2 would be elected.
+	assert.NoError(t, c.checkReplicaDryRun("user", "test", replica2, now.Add(1100*time.Millisecond)))
+
+	c.electedLock.RLock()
+	defer c.electedLock.RUnlock()
+	assert.Equal(t, replica1, c.elected["user/test"].Replica)
+}
+
 func TestCheckReplicaMultiCluster(t *testing.T) {
 	replica1 := "replica1"
 	replica2 := "replica2"
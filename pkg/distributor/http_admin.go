@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -44,6 +45,37 @@ const tpl = `
 						<td align='right'>{{ printf "%.2f" .UserStats.APIIngestionRate }}</td>
 						<td align='right'>{{ printf "%.2f" .UserStats.RuleIngestionRate }}</td>
 					</tr>
+					{{ if .PerIngester }}
+					<tr>
+						<td colspan="5">
+							<details>
+								<summary>Per-ingester stats ({{ len .PerIngester }} ingesters)</summary>
+								<table border="1">
+									<thead>
+										<tr>
+											<th>Ingester</th>
+											<th># Series</th>
+											<th>Total Ingest Rate</th>
+											<th>API Ingest Rate</th>
+											<th>Rule Ingest Rate</th>
+										</tr>
+									</thead>
+									<tbody>
+										{{ range .PerIngester }}
+										<tr>
+											<td>{{ .Addr }}</td>
+											<td align='right'>{{ .UserStats.NumSeries }}</td>
+											<td align='right'>{{ printf "%.2f" .UserStats.IngestionRate }}</td>
+											<td align='right'>{{ printf "%.2f" .UserStats.APIIngestionRate }}</td>
+											<td align='right'>{{ printf "%.2f" .UserStats.RuleIngestionRate }}</td>
+										</tr>
+										{{ end }}
+									</tbody>
+								</table>
+							</details>
+						</td>
+					</tr>
+					{{ end }}
 					{{ end }}
 				</tbody>
 			</table>
@@ -67,9 +99,26 @@ func (s userStatsByTimeseries) Less(i, j int) bool {
 		(s[i].NumSeries == s[j].NumSeries && s[i].UserID < s[j].UserID)
 }
 
-// AllUserStatsHandler shows stats for all users.
+// AllUserStatsHandler shows stats for all users. The JSON response includes the stats of
+// each ingester only if the per_ingester parameter is true, while the web page always
+// includes them.
 func (d *Distributor) AllUserStatsHandler(w http.ResponseWriter, r *http.Request) {
-	stats, err := d.AllUserStats(r.Context())
+	isJSON := false
+	if encodings, found := r.Header["Accept"]; found &&
+		len(encodings) > 0 && strings.Contains(encodings[0], "json") {
+		isJSON = true
+	}
+
+	perIngester := !isJSON
+	if value := r.FormValue("per_ingester"); value != "" && isJSON {
+		var err error
+		if perIngester, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, fmt.Sprintf("invalid per_ingester parameter: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	stats, err := d.AllUserStats(r.Context(), perIngester)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -77,8 +126,7 @@ func (d *Distributor) AllUserStatsHandler(w http.ResponseWriter, r *http.Request
 
 	sort.Sort(userStatsByTimeseries(stats))
 
-	if encodings, found := r.Header["Accept"]; found &&
-		len(encodings) > 0 && strings.Contains(encodings[0], "json") {
+	if isJSON {
 		if err := json.NewEncoder(w).Encode(stats); err != nil {
 			http.Error(w, fmt.Sprintf("Error marshalling response: %v", err), http.StatusInternalServerError)
 		}
@@ -0,0 +1,103 @@
+package distributor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+)
+
+func TestDistributor_AllUserStatsHandler(t *testing.T) {
+	ds, ingesters, r, _ := prepare(t, prepConfig{
+		numIngesters:     3,
+		happyIngesters:   3,
+		numDistributors:  1,
+		shardByAllLabels: true,
+	})
+	defer stopAll(ds, r)
+
+	// Ingester 1 is the hot one for user-1.
+	ingesters[0].stats = makeUsersStatsResponse(map[string]*client.UserStatsResponse{
+		"user-1": {NumSeries: 10, IngestionRate: 3, ApiIngestionRate: 2, RuleIngestionRate: 1},
+		"user-2": {NumSeries: 5, IngestionRate: 1, ApiIngestionRate: 1},
+	})
+	ingesters[1].stats = makeUsersStatsResponse(map[string]*client.UserStatsResponse{
+		"user-1": {NumSeries: 100, IngestionRate: 30, ApiIngestionRate: 30},
+	})
+	ingesters[2].stats = makeUsersStatsResponse(map[string]*client.UserStatsResponse{
+		"user-1": {NumSeries: 10, IngestionRate: 3, ApiIngestionRate: 2, RuleIngestionRate: 1},
+		"user-2": {NumSeries: 5, IngestionRate: 1, ApiIngestionRate: 1},
+	})
+
+	expectedTotals := []UserIDStats{
+		{UserID: "user-1", UserStats: UserStats{NumSeries: 120, IngestionRate: 36, APIIngestionRate: 34, RuleIngestionRate: 2}},
+		{UserID: "user-2", UserStats: UserStats{NumSeries: 10, IngestionRate: 2, APIIngestionRate: 2}},
+	}
+
+	t.Run("should return the totals if the per-ingester stats are not requested", func(t *testing.T) {
+		assert.Equal(t, expectedTotals, getAllUserStats(t, ds[0], "/distributor/all_user_stats"))
+	})
+
+	t.Run("should return the per-ingester stats if requested", func(t *testing.T) {
+		expected := []UserIDStats{expectedTotals[0], expectedTotals[1]}
+		expected[0].PerIngester = []IngesterUserStats{
+			{Addr: "1", UserStats: UserStats{NumSeries: 100, IngestionRate: 30, APIIngestionRate: 30}},
+			{Addr: "0", UserStats: UserStats{NumSeries: 10, IngestionRate: 3, APIIngestionRate: 2, RuleIngestionRate: 1}},
+			{Addr: "2", UserStats: UserStats{NumSeries: 10, IngestionRate: 3, APIIngestionRate: 2, RuleIngestionRate: 1}},
+		}
+		expected[1].PerIngester = []IngesterUserStats{
+			{Addr: "0", UserStats: UserStats{NumSeries: 5, IngestionRate: 1, APIIngestionRate: 1}},
+			{Addr: "2", UserStats: UserStats{NumSeries: 5, IngestionRate: 1, APIIngestionRate: 1}},
+		}
+
+		assert.Equal(t, expected, getAllUserStats(t, ds[0], "/distributor/all_user_stats?per_ingester=true"))
+	})
+
+	t.Run("should reject an invalid per_ingester parameter", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/distributor/all_user_stats?per_ingester=maybe", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		ds[0].AllUserStatsHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("should render the summary and the per-ingester stats in the web page", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/distributor/all_user_stats", nil)
+		w := httptest.NewRecorder()
+		ds[0].AllUserStatsHandler(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		body, err := ioutil.ReadAll(w.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "<td>user-1</td>")
+		assert.Contains(t, string(body), "<summary>Per-ingester stats (3 ingesters)</summary>")
+		assert.Contains(t, string(body), "<summary>Per-ingester stats (2 ingesters)</summary>")
+	})
+}
+
+func makeUsersStatsResponse(stats map[string]*client.UserStatsResponse) client.UsersStatsResponse {
+	resp := client.UsersStatsResponse{}
+	for userID, s := range stats {
+		resp.Stats = append(resp.Stats, &client.UserIDStatsResponse{UserId: userID, Data: s})
+	}
+	return resp
+}
+
+func getAllUserStats(t *testing.T, d *Distributor, url string) []UserIDStats {
+	req := httptest.NewRequest("GET", url, nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	d.AllUserStatsHandler(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stats []UserIDStats
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	return stats
+}
@@ -0,0 +1,131 @@
+package distributor
+
+import (
+	"context"
+	"flag"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	ingester_client "github.com/cortexproject/cortex/pkg/ingester/client"
+)
+
+// pushStreamUnsupportedTTL is how long an ingester not supporting the push stream is sent the
+// unary push, before trying the push stream again (e.g. once it has been upgraded).
+const pushStreamUnsupportedTTL = 10 * time.Minute
+
+// PushStreamConfig configures the streaming of the large write requests to the ingesters.
+type PushStreamConfig struct {
+	ThresholdBytes   int `yaml:"threshold_bytes"`
+	MessageSizeBytes int `yaml:"message_size_bytes"`
+}
+
+// RegisterFlagsWithPrefix registers flags with prefix.
+func (cfg *PushStreamConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.IntVar(&cfg.ThresholdBytes, prefix+"threshold-bytes", 0, "Size of the series and metadata sent to an ingester by a write request above which they're streamed to the ingester in bounded-size messages, instead of being sent in a single message. The ingesters not supporting the push stream are automatically sent a single message. 0 to disable.")
+	f.IntVar(&cfg.MessageSizeBytes, prefix+"message-size-bytes", 1<<20, "Max size of each message streamed to an ingester. A series larger than this size is sent in a message on its own.")
+}
+
+// pushStreamSupport tracks the ingesters, by address, which don't support the push stream.
+type pushStreamSupport struct {
+	mtx         sync.Mutex
+	unsupported map[string]time.Time
+}
+
+func newPushStreamSupport() *pushStreamSupport {
+	return &pushStreamSupport{
+		unsupported: map[string]time.Time{},
+	}
+}
+
+func (s *pushStreamSupport) isSupported(addr string, now time.Time) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	detected, ok := s.unsupported[addr]
+	if !ok {
+		return true
+	}
+	if now.Sub(detected) >= pushStreamUnsupportedTTL {
+		delete(s.unsupported, addr)
+		return true
+	}
+	return false
+}
+
+func (s *pushStreamSupport) setUnsupported(addr string, now time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.unsupported[addr] = now
+}
+
+// pushStream streams the series of the request to the ingester in bounded-size messages. Like the
+// unary push, the first error of the series rejected by the ingester is returned.
+func (d *Distributor) pushStream(ctx context.Context, c ingester_client.IngesterClient, req *cortexpb.WriteRequest) error {
+	// Cancelling the context releases the stream if we return before it has been closed.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.PushStream(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range splitWriteRequest(req, d.cfg.PushStream.MessageSizeBytes) {
+		if err := stream.Send(msg); err != nil {
+			// The stream has been closed by the ingester, whose error is returned by CloseAndRecv().
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Errors) > 0 {
+		return httpgrpc.Errorf(int(resp.Errors[0].Code), resp.Errors[0].Message)
+	}
+	return nil
+}
+
+// splitWriteRequest splits the series of the request in requests whose size is at most maxSize
+// bytes, unless a single series is larger. The metadata is set only in the first request.
+func splitWriteRequest(req *cortexpb.WriteRequest, maxSize int) []*cortexpb.WriteRequest {
+	newRequest := func() *cortexpb.WriteRequest {
+		return &cortexpb.WriteRequest{
+			Source:                  req.Source,
+			SkipLabelNameValidation: req.SkipLabelNameValidation,
+		}
+	}
+
+	var reqs []*cortexpb.WriteRequest
+	curr := newRequest()
+	curr.Metadata = req.Metadata
+	currSize := curr.Size()
+
+	for _, ts := range req.Timeseries {
+		// Each series is encoded with its tag and length.
+		size := ts.Size()
+		size += 1 + proto.SizeVarint(uint64(size))
+
+		if len(curr.Timeseries) > 0 && currSize+size > maxSize {
+			reqs = append(reqs, curr)
+			curr = newRequest()
+			currSize = curr.Size()
+		}
+
+		curr.Timeseries = append(curr.Timeseries, ts)
+		currSize += size
+	}
+
+	return append(reqs, curr)
+}
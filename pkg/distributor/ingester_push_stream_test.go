@@ -0,0 +1,168 @@
+package distributor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func TestDistributor_Push_ShouldStreamLargeRequestsToIngesters(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	tests := map[string]struct {
+		pushStreamThreshold int
+		unsupported         bool
+		expectedStreams     int
+		expectedMessages    int
+		expectedUnaryPushes int
+	}{
+		"should send the requests below the threshold with the unary push": {
+			pushStreamThreshold: 100000,
+			expectedUnaryPushes: 2,
+		},
+		"should stream the requests above the threshold in bounded-size messages": {
+			pushStreamThreshold: 1,
+			expectedStreams:     2,
+			expectedMessages:    20,
+		},
+		"should fall back to the unary push and cache it if the ingesters don't support the push stream": {
+			pushStreamThreshold: 1,
+			unsupported:         true,
+			expectedStreams:     1,
+			expectedUnaryPushes: 2,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ds, ingesters, r, _ := prepare(t, prepConfig{
+				numIngesters:          3,
+				happyIngesters:        3,
+				numDistributors:       1,
+				shardByAllLabels:      true,
+				pushStreamThreshold:   testData.pushStreamThreshold,
+				pushStreamMessageSize: 1,
+			})
+			defer stopAll(ds, r)
+
+			for i := range ingesters {
+				ingesters[i].pushStreamUnsupported = testData.unsupported
+			}
+
+			for _, ts := range []int64{1000, 2000} {
+				_, err := ds[0].Push(ctx, makeWriteRequest(ts, 10, 0))
+				require.NoError(t, err)
+			}
+
+			// With a replication factor of 3, each ingester receives all the series. The push
+			// returns once the quorum is reached, so we wait for the last ingester.
+			for i := range ingesters {
+				test.Poll(t, time.Second, testData.expectedStreams+testData.expectedMessages+testData.expectedUnaryPushes, func() interface{} {
+					return ingesters[i].countCalls("PushStream") + ingesters[i].countCalls("PushStream.Send") + ingesters[i].countCalls("Push")
+				})
+				assert.Equal(t, testData.expectedStreams, ingesters[i].countCalls("PushStream"))
+				assert.Equal(t, testData.expectedMessages, ingesters[i].countCalls("PushStream.Send"))
+				assert.Equal(t, testData.expectedUnaryPushes, ingesters[i].countCalls("Push"))
+
+				series := ingesters[i].series()
+				require.Len(t, series, 10)
+				for _, s := range series {
+					assert.Len(t, s.Samples, 2)
+				}
+			}
+		})
+	}
+}
+
+func TestDistributor_Push_ShouldReturnTheErrorOfTheStreamedSeries(t *testing.T) {
+	ds, ingesters, r, _ := prepare(t, prepConfig{
+		numIngesters:        3,
+		happyIngesters:      0,
+		numDistributors:     1,
+		shardByAllLabels:    true,
+		pushStreamThreshold: 1,
+	})
+	defer stopAll(ds, r)
+
+	_, err := ds[0].Push(user.InjectOrgID(context.Background(), "user"), makeWriteRequest(0, 10, 0))
+	assert.EqualError(t, err, errFail.Error())
+
+	// The push returns once the quorum has failed, so we wait for the last ingester.
+	for i := range ingesters {
+		test.Poll(t, time.Second, 1, func() interface{} {
+			return ingesters[i].countCalls("PushStream")
+		})
+		assert.Equal(t, 0, ingesters[i].countCalls("Push"))
+	}
+}
+
+func TestSplitWriteRequest(t *testing.T) {
+	series := func(name string) cortexpb.PreallocTimeseries {
+		return cortexpb.PreallocTimeseries{TimeSeries: &cortexpb.TimeSeries{
+			Labels:  cortexpb.FromLabelsToLabelAdapters(labels.FromStrings(labels.MetricName, name)),
+			Samples: []cortexpb.Sample{{Value: 1, TimestampMs: 1000}},
+		}}
+	}
+
+	req := &cortexpb.WriteRequest{
+		Timeseries: []cortexpb.PreallocTimeseries{series("series_1"), series("series_2"), series("series_3")},
+		Metadata:   []*cortexpb.MetricMetadata{{MetricFamilyName: "series_1", Type: cortexpb.COUNTER}},
+		Source:     cortexpb.RULE,
+	}
+
+	// The size of each series in the request, including its tag and length, and the size of
+	// the fields set in all the requests.
+	seriesSize := (req.Size() - (&cortexpb.WriteRequest{Metadata: req.Metadata, Source: req.Source}).Size()) / len(req.Timeseries)
+	baseSize := (&cortexpb.WriteRequest{Source: req.Source}).Size()
+
+	t.Run("should not split the request smaller than the max size", func(t *testing.T) {
+		reqs := splitWriteRequest(req, req.Size())
+		require.Len(t, reqs, 1)
+		assert.Equal(t, req, reqs[0])
+	})
+
+	t.Run("should split the series and set the metadata only in the first request", func(t *testing.T) {
+		reqs := splitWriteRequest(req, baseSize+2*seriesSize)
+		require.Len(t, reqs, 2)
+
+		assert.Equal(t, req.Timeseries[:1], reqs[0].Timeseries)
+		assert.Equal(t, req.Metadata, reqs[0].Metadata)
+		assert.Equal(t, req.Timeseries[1:], reqs[1].Timeseries)
+		assert.Empty(t, reqs[1].Metadata)
+
+		for _, r := range reqs {
+			assert.Equal(t, cortexpb.RULE, r.Source)
+			assert.LessOrEqual(t, r.Size(), baseSize+2*seriesSize)
+		}
+	})
+
+	t.Run("should send the series larger than the max size in their own request", func(t *testing.T) {
+		reqs := splitWriteRequest(req, 1)
+		require.Len(t, reqs, 3)
+		for i, r := range reqs {
+			assert.Equal(t, req.Timeseries[i:i+1], r.Timeseries)
+		}
+	})
+}
+
+func TestPushStreamSupport(t *testing.T) {
+	now := time.Now()
+	s := newPushStreamSupport()
+	assert.True(t, s.isSupported("ingester-1", now))
+
+	s.setUnsupported("ingester-1", now)
+	assert.False(t, s.isSupported("ingester-1", now.Add(pushStreamUnsupportedTTL-time.Second)))
+	assert.True(t, s.isSupported("ingester-2", now))
+
+	// The push stream is tried again once the TTL has expired.
+	assert.True(t, s.isSupported("ingester-1", now.Add(pushStreamUnsupportedTTL)))
+	assert.True(t, s.isSupported("ingester-1", now))
+}
@@ -0,0 +1,236 @@
+package distributor
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/cortexproject/cortex/pkg/ring/kv"
+	"github.com/cortexproject/cortex/pkg/ring/kv/codec"
+	util_math "github.com/cortexproject/cortex/pkg/util/math"
+)
+
+const (
+	// Prefix of the KV store keys where each distributor publishes its observed rates.
+	distributorRatesKeyPrefix = "distributor-rates/"
+
+	// How much the latest period weights on the observed rates.
+	coordinatedRateAlpha = 0.5
+
+	// Tenants whose observed rate drops below this value are no longer published.
+	minCoordinatedRate = 0.01
+
+	// Published rates are considered stale (and then ignored) after this number of periods.
+	coordinatedRateStalePeriods = 3
+)
+
+// ProtoDistributorRatesFactory makes new DistributorRates.
+func ProtoDistributorRatesFactory() proto.Message {
+	return &DistributorRates{}
+}
+
+// GetDistributorRatesCodec returns the codec used to store DistributorRates in the KV store.
+func GetDistributorRatesCodec() codec.Proto {
+	return codec.NewProtoCodec("distributorRates", ProtoDistributorRatesFactory)
+}
+
+// ingestionRateCoordinator tracks the per-tenant ingestion rate observed by this distributor,
+// periodically publishes it to the KV store and watches the rates published by the other
+// distributors, so that each distributor can compute its share of the tenant limit
+// proportionally to the recent usage.
+type ingestionRateCoordinator struct {
+	services.Service
+
+	instanceID string
+	period     time.Duration
+	client     kv.Client
+	logger     log.Logger
+
+	// Rates observed by this distributor, by tenant.
+	localMtx sync.Mutex
+	local    map[string]*util_math.EwmaRate
+	current  map[string]float64
+
+	// Rates published by the other distributors, by instance ID.
+	remoteMtx     sync.RWMutex
+	remote        map[string]*DistributorRates
+	lastPublished time.Time
+
+	publishFailures prometheus.Counter
+}
+
+func newIngestionRateCoordinator(instanceID string, period time.Duration, client kv.Client, reg prometheus.Registerer, logger log.Logger) *ingestionRateCoordinator {
+	c := &ingestionRateCoordinator{
+		instanceID: instanceID,
+		period:     period,
+		client:     client,
+		logger:     logger,
+		local:      map[string]*util_math.EwmaRate{},
+		current:    map[string]float64{},
+		remote:     map[string]*DistributorRates{},
+
+		publishFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_distributor_ingestion_rate_coordination_failures_total",
+			Help: "The total number of failures while publishing the observed ingestion rates to the KV store.",
+		}),
+	}
+
+	c.Service = services.NewBasicService(nil, c.running, c.stopping)
+	return c
+}
+
+func (c *ingestionRateCoordinator) running(ctx context.Context) error {
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.watchRates(ctx)
+	}()
+
+	ticker := time.NewTicker(c.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.updateRates(ctx, time.Now())
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		}
+	}
+}
+
+func (c *ingestionRateCoordinator) stopping(_ error) error {
+	// Deletions are not notified to watchers, so the other distributors will keep
+	// our rates until they're stale, but we don't want to leave them in the KV store.
+	if err := c.client.Delete(context.Background(), c.key()); err != nil {
+		level.Warn(c.logger).Log("msg", "failed to delete the distributor rates from the KV store", "err", err)
+	}
+	return nil
+}
+
+func (c *ingestionRateCoordinator) key() string {
+	return distributorRatesKeyPrefix + c.instanceID
+}
+
+func (c *ingestionRateCoordinator) watchRates(ctx context.Context) {
+	c.client.WatchPrefix(ctx, distributorRatesKeyPrefix, func(key string, value interface{}) bool {
+		rates, ok := value.(*DistributorRates)
+		if !ok || rates == nil {
+			return true
+		}
+
+		instanceID := strings.TrimPrefix(key, distributorRatesKeyPrefix)
+		if instanceID == c.instanceID {
+			return true
+		}
+
+		c.remoteMtx.Lock()
+		c.remote[instanceID] = rates
+		c.remoteMtx.Unlock()
+		return true
+	})
+}
+
+// Add records n samples (including exemplars and metadata) received for the tenant,
+// regardless of whether they'll be rate limited or not.
+func (c *ingestionRateCoordinator) Add(tenantID string, n int) {
+	c.localMtx.Lock()
+	defer c.localMtx.Unlock()
+
+	rate, ok := c.local[tenantID]
+	if !ok {
+		rate = util_math.NewEWMARate(coordinatedRateAlpha, c.period)
+		c.local[tenantID] = rate
+	}
+	rate.Add(int64(n))
+}
+
+// updateRates must be called every period to update the rates observed by this
+// distributor and publish them to the KV store.
+func (c *ingestionRateCoordinator) updateRates(ctx context.Context, now time.Time) {
+	published := &DistributorRates{
+		UpdatedAt:   now.UnixNano() / int64(time.Millisecond),
+		TenantRates: map[string]float64{},
+	}
+
+	c.localMtx.Lock()
+	for tenantID, rate := range c.local {
+		rate.Tick()
+
+		if r := rate.Rate(); r >= minCoordinatedRate {
+			published.TenantRates[tenantID] = r
+		} else {
+			delete(c.local, tenantID)
+		}
+	}
+	c.current = published.TenantRates
+	c.localMtx.Unlock()
+
+	err := c.client.CAS(ctx, c.key(), func(_ interface{}) (out interface{}, retry bool, err error) {
+		return published, true, nil
+	})
+	if err != nil {
+		c.publishFailures.Inc()
+		level.Warn(c.logger).Log("msg", "failed to publish the distributor rates to the KV store", "err", err)
+		return
+	}
+
+	c.remoteMtx.Lock()
+	defer c.remoteMtx.Unlock()
+
+	c.lastPublished = now
+
+	// Forget about distributors which left the cluster.
+	for instanceID, rates := range c.remote {
+		if c.isStale(rates, now) {
+			delete(c.remote, instanceID)
+		}
+	}
+}
+
+func (c *ingestionRateCoordinator) isStale(rates *DistributorRates, now time.Time) bool {
+	return now.Sub(time.Unix(0, rates.UpdatedAt*int64(time.Millisecond))) > coordinatedRateStalePeriods*c.period
+}
+
+// Share returns the share of the tenant limit this distributor should admit, proportional to
+// its observed rate over the cluster-wide observed rate. It returns false if the share
+// can't be computed (e.g. the KV store is unavailable or tenant's rates are unknown).
+func (c *ingestionRateCoordinator) Share(tenantID string, now time.Time) (float64, bool) {
+	c.localMtx.Lock()
+	own := c.current[tenantID]
+	c.localMtx.Unlock()
+
+	// Distributors which haven't recently received any sample for the tenant
+	// get an even share, so that new traffic isn't rejected until the next update.
+	if own <= 0 {
+		return 0, false
+	}
+
+	c.remoteMtx.RLock()
+	defer c.remoteMtx.RUnlock()
+
+	// If we haven't been able to publish our rates recently, the KV store is
+	// likely unavailable and the other distributors rates are not reliable.
+	if now.Sub(c.lastPublished) > coordinatedRateStalePeriods*c.period {
+		return 0, false
+	}
+
+	total := own
+	for _, rates := range c.remote {
+		if !c.isStale(rates, now) {
+			total += rates.TenantRates[tenantID]
+		}
+	}
+
+	return own / total, true
+}
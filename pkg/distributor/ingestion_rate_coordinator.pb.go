@@ -0,0 +1,581 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: ingestion_rate_coordinator.proto
+
+package distributor
+
+import (
+	encoding_binary "encoding/binary"
+	fmt "fmt"
+	_ "github.com/gogo/protobuf/gogoproto"
+	proto "github.com/gogo/protobuf/proto"
+	github_com_gogo_protobuf_sortkeys "github.com/gogo/protobuf/sortkeys"
+	io "io"
+	math "math"
+	math_bits "math/bits"
+	reflect "reflect"
+	strings "strings"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
+
+// DistributorRates is published to the KV store by each distributor when the
+// global-coordinated ingestion rate strategy is enabled.
+type DistributorRates struct {
+	// Unix timestamp in milliseconds when the rates have been published.
+	UpdatedAt int64 `protobuf:"varint,1,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	// Observed ingestion rate (samples and metadata per second, including the
+	// rate limited ones) by tenant.
+	TenantRates map[string]float64 `protobuf:"bytes,2,rep,name=tenant_rates,json=tenantRates,proto3" json:"tenant_rates,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"fixed64,2,opt,name=value,proto3"`
+}
+
+func (m *DistributorRates) Reset()      { *m = DistributorRates{} }
+func (*DistributorRates) ProtoMessage() {}
+func (*DistributorRates) Descriptor() ([]byte, []int) {
+	return fileDescriptor_2893f1f5aec32aa4, []int{0}
+}
+func (m *DistributorRates) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *DistributorRates) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_DistributorRates.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *DistributorRates) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DistributorRates.Merge(m, src)
+}
+func (m *DistributorRates) XXX_Size() int {
+	return m.Size()
+}
+func (m *DistributorRates) XXX_DiscardUnknown() {
+	xxx_messageInfo_DistributorRates.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DistributorRates proto.InternalMessageInfo
+
+func (m *DistributorRates) GetUpdatedAt() int64 {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return 0
+}
+
+func (m *DistributorRates) GetTenantRates() map[string]float64 {
+	if m != nil {
+		return m.TenantRates
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*DistributorRates)(nil), "distributor.DistributorRates")
+	proto.RegisterMapType((map[string]float64)(nil), "distributor.DistributorRates.TenantRatesEntry")
+}
+
+func init() { proto.RegisterFile("ingestion_rate_coordinator.proto", fileDescriptor_2893f1f5aec32aa4) }
+
+var fileDescriptor_2893f1f5aec32aa4 = []byte{
+	// 279 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x90, 0x31, 0x4a, 0x03, 0x41,
+	0x18, 0x85, 0xe7, 0x4f, 0x50, 0xc8, 0xc4, 0x22, 0x2c, 0x16, 0x21, 0xe0, 0xcf, 0x62, 0xb5, 0x8d,
+	0x13, 0x50, 0x0b, 0xb1, 0x10, 0x14, 0x3d, 0x80, 0x8b, 0xfd, 0x32, 0x9b, 0x1d, 0xd7, 0x41, 0x9d,
+	0x09, 0xb3, 0xff, 0x0a, 0xe9, 0x3c, 0x82, 0xc7, 0xf0, 0x20, 0x16, 0x96, 0x5b, 0xa6, 0x74, 0x67,
+	0x1b, 0xcb, 0x1c, 0x41, 0x9c, 0x08, 0x91, 0x74, 0xef, 0x3d, 0xde, 0x37, 0xf3, 0xf8, 0x79, 0xac,
+	0x4d, 0xa9, 0x2a, 0xd2, 0xd6, 0x64, 0x4e, 0x92, 0xca, 0x66, 0xd6, 0xba, 0x42, 0x1b, 0x49, 0xd6,
+	0x89, 0xb9, 0xb3, 0x64, 0xa3, 0x61, 0xa1, 0x2b, 0x72, 0x3a, 0xaf, 0xc9, 0xba, 0xc9, 0x51, 0xa9,
+	0xe9, 0xa1, 0xce, 0xc5, 0xcc, 0x3e, 0x4f, 0x4b, 0x5b, 0xda, 0x69, 0xe8, 0xe4, 0xf5, 0x7d, 0x70,
+	0xc1, 0x04, 0xb5, 0x66, 0x0f, 0x3f, 0x80, 0x8f, 0xae, 0x37, 0x78, 0x2a, 0x49, 0x55, 0xd1, 0x01,
+	0xe7, 0xf5, 0xbc, 0x90, 0xa4, 0x8a, 0x4c, 0xd2, 0x18, 0x62, 0x48, 0xfa, 0xe9, 0xe0, 0x2f, 0xb9,
+	0xa4, 0xe8, 0x96, 0xef, 0x91, 0x32, 0xd2, 0x50, 0x18, 0x54, 0x8d, 0x7b, 0x71, 0x3f, 0x19, 0x1e,
+	0x0b, 0xf1, 0x6f, 0x86, 0xd8, 0x7e, 0x53, 0xdc, 0x05, 0x22, 0xe8, 0x1b, 0x43, 0x6e, 0x91, 0x0e,
+	0x69, 0x93, 0x4c, 0x2e, 0xf8, 0x68, 0xbb, 0x10, 0x8d, 0x78, 0xff, 0x51, 0x2d, 0xc2, 0xf7, 0x83,
+	0xf4, 0x57, 0x46, 0xfb, 0x7c, 0xe7, 0x45, 0x3e, 0xd5, 0x6a, 0xdc, 0x8b, 0x21, 0x81, 0x74, 0x6d,
+	0xce, 0x7b, 0x67, 0x70, 0x75, 0xda, 0xb4, 0xc8, 0x96, 0x2d, 0xb2, 0x55, 0x8b, 0xf0, 0xea, 0x11,
+	0xde, 0x3d, 0xc2, 0xa7, 0x47, 0x68, 0x3c, 0xc2, 0x97, 0x47, 0xf8, 0xf6, 0xc8, 0x56, 0x1e, 0xe1,
+	0xad, 0x43, 0xd6, 0x74, 0xc8, 0x96, 0x1d, 0xb2, 0x7c, 0x37, 0xdc, 0xe0, 0xe4, 0x67, 0x00, 0x02,
+	0xfa, 0x53, 0x4c, 0x63, 0x01, 0x00, 0x00,
+}
+
+func (this *DistributorRates) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*DistributorRates)
+	if !ok {
+		that2, ok := that.(DistributorRates)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if this.UpdatedAt != that1.UpdatedAt {
+		return false
+	}
+	if len(this.TenantRates) != len(that1.TenantRates) {
+		return false
+	}
+	for i := range this.TenantRates {
+		if this.TenantRates[i] != that1.TenantRates[i] {
+			return false
+		}
+	}
+	return true
+}
+func (this *DistributorRates) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 6)
+	s = append(s, "&distributor.DistributorRates{")
+	s = append(s, "UpdatedAt: "+fmt.Sprintf("%#v", this.UpdatedAt)+",\n")
+	keysForTenantRates := make([]string, 0, len(this.TenantRates))
+	for k, _ := range this.TenantRates {
+		keysForTenantRates = append(keysForTenantRates, k)
+	}
+	github_com_gogo_protobuf_sortkeys.Strings(keysForTenantRates)
+	mapStringForTenantRates := "map[string]float64{"
+	for _, k := range keysForTenantRates {
+		mapStringForTenantRates += fmt.Sprintf("%#v: %#v,", k, this.TenantRates[k])
+	}
+	mapStringForTenantRates += "}"
+	if this.TenantRates != nil {
+		s = append(s, "TenantRates: "+mapStringForTenantRates+",\n")
+	}
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
+func valueToGoStringIngestionRateCoordinator(v interface{}, typ string) string {
+	rv := reflect.ValueOf(v)
+	if rv.IsNil() {
+		return "nil"
+	}
+	pv := reflect.Indirect(rv).Interface()
+	return fmt.Sprintf("func(v %v) *%v { return &v } ( %#v )", typ, typ, pv)
+}
+func (m *DistributorRates) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *DistributorRates) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *DistributorRates) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.TenantRates) > 0 {
+		for k := range m.TenantRates {
+			v := m.TenantRates[k]
+			baseI := i
+			i -= 8
+			encoding_binary.LittleEndian.PutUint64(dAtA[i:], uint64(math.Float64bits(float64(v))))
+			i--
+			dAtA[i] = 0x11
+			i -= len(k)
+			copy(dAtA[i:], k)
+			i = encodeVarintIngestionRateCoordinator(dAtA, i, uint64(len(k)))
+			i--
+			dAtA[i] = 0xa
+			i = encodeVarintIngestionRateCoordinator(dAtA, i, uint64(baseI-i))
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if m.UpdatedAt != 0 {
+		i = encodeVarintIngestionRateCoordinator(dAtA, i, uint64(m.UpdatedAt))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintIngestionRateCoordinator(dAtA []byte, offset int, v uint64) int {
+	offset -= sovIngestionRateCoordinator(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *DistributorRates) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.UpdatedAt != 0 {
+		n += 1 + sovIngestionRateCoordinator(uint64(m.UpdatedAt))
+	}
+	if len(m.TenantRates) > 0 {
+		for k, v := range m.TenantRates {
+			_ = k
+			_ = v
+			mapEntrySize := 1 + len(k) + sovIngestionRateCoordinator(uint64(len(k))) + 1 + 8
+			n += mapEntrySize + 1 + sovIngestionRateCoordinator(uint64(mapEntrySize))
+		}
+	}
+	return n
+}
+
+func sovIngestionRateCoordinator(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozIngestionRateCoordinator(x uint64) (n int) {
+	return sovIngestionRateCoordinator(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (this *DistributorRates) String() string {
+	if this == nil {
+		return "nil"
+	}
+	keysForTenantRates := make([]string, 0, len(this.TenantRates))
+	for k, _ := range this.TenantRates {
+		keysForTenantRates = append(keysForTenantRates, k)
+	}
+	github_com_gogo_protobuf_sortkeys.Strings(keysForTenantRates)
+	mapStringForTenantRates := "map[string]float64{"
+	for _, k := range keysForTenantRates {
+		mapStringForTenantRates += fmt.Sprintf("%v: %v,", k, this.TenantRates[k])
+	}
+	mapStringForTenantRates += "}"
+	s := strings.Join([]string{`&DistributorRates{`,
+		`UpdatedAt:` + fmt.Sprintf("%v", this.UpdatedAt) + `,`,
+		`TenantRates:` + mapStringForTenantRates + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func valueToStringIngestionRateCoordinator(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.IsNil() {
+		return "nil"
+	}
+	pv := reflect.Indirect(rv).Interface()
+	return fmt.Sprintf("*%v", pv)
+}
+func (m *DistributorRates) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowIngestionRateCoordinator
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: DistributorRates: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: DistributorRates: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field UpdatedAt", wireType)
+			}
+			m.UpdatedAt = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIngestionRateCoordinator
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.UpdatedAt |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TenantRates", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowIngestionRateCoordinator
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthIngestionRateCoordinator
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthIngestionRateCoordinator
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.TenantRates == nil {
+				m.TenantRates = make(map[string]float64)
+			}
+			var mapkey string
+			var mapvalue float64
+			for iNdEx < postIndex {
+				entryPreIndex := iNdEx
+				var wire uint64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowIngestionRateCoordinator
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					wire |= uint64(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				fieldNum := int32(wire >> 3)
+				if fieldNum == 1 {
+					var stringLenmapkey uint64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowIngestionRateCoordinator
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						stringLenmapkey |= uint64(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					intStringLenmapkey := int(stringLenmapkey)
+					if intStringLenmapkey < 0 {
+						return ErrInvalidLengthIngestionRateCoordinator
+					}
+					postStringIndexmapkey := iNdEx + intStringLenmapkey
+					if postStringIndexmapkey < 0 {
+						return ErrInvalidLengthIngestionRateCoordinator
+					}
+					if postStringIndexmapkey > l {
+						return io.ErrUnexpectedEOF
+					}
+					mapkey = string(dAtA[iNdEx:postStringIndexmapkey])
+					iNdEx = postStringIndexmapkey
+				} else if fieldNum == 2 {
+					var mapvaluetemp uint64
+					if (iNdEx + 8) > l {
+						return io.ErrUnexpectedEOF
+					}
+					mapvaluetemp = uint64(encoding_binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+					iNdEx += 8
+					mapvalue = math.Float64frombits(mapvaluetemp)
+				} else {
+					iNdEx = entryPreIndex
+					skippy, err := skipIngestionRateCoordinator(dAtA[iNdEx:])
+					if err != nil {
+						return err
+					}
+					if skippy < 0 {
+						return ErrInvalidLengthIngestionRateCoordinator
+					}
+					if (iNdEx + skippy) < 0 {
+						return ErrInvalidLengthIngestionRateCoordinator
+					}
+					if (iNdEx + skippy) > postIndex {
+						return io.ErrUnexpectedEOF
+					}
+					iNdEx += skippy
+				}
+			}
+			m.TenantRates[mapkey] = mapvalue
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipIngestionRateCoordinator(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthIngestionRateCoordinator
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthIngestionRateCoordinator
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipIngestionRateCoordinator(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowIngestionRateCoordinator
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowIngestionRateCoordinator
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+			return iNdEx, nil
+		case 1:
+			iNdEx += 8
+			return iNdEx, nil
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowIngestionRateCoordinator
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if length < 0 {
+				return 0, ErrInvalidLengthIngestionRateCoordinator
+			}
+			iNdEx += length
+			if iNdEx < 0 {
+				return 0, ErrInvalidLengthIngestionRateCoordinator
+			}
+			return iNdEx, nil
+		case 3:
+			for {
+				var innerWire uint64
+				var start int = iNdEx
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return 0, ErrIntOverflowIngestionRateCoordinator
+					}
+					if iNdEx >= l {
+						return 0, io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					innerWire |= (uint64(b) & 0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				innerWireType := int(innerWire & 0x7)
+				if innerWireType == 4 {
+					break
+				}
+				next, err := skipIngestionRateCoordinator(dAtA[start:])
+				if err != nil {
+					return 0, err
+				}
+				iNdEx = start + next
+				if iNdEx < 0 {
+					return 0, ErrInvalidLengthIngestionRateCoordinator
+				}
+			}
+			return iNdEx, nil
+		case 4:
+			return iNdEx, nil
+		case 5:
+			iNdEx += 4
+			return iNdEx, nil
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+	}
+	panic("unreachable")
+}
+
+var (
+	ErrInvalidLengthIngestionRateCoordinator        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowIngestionRateCoordinator          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupIngestionRateCoordinator = fmt.Errorf("proto: unexpected end of group")
+)
@@ -0,0 +1,170 @@
+package distributor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ring/kv"
+	"github.com/cortexproject/cortex/pkg/ring/kv/consul"
+	"github.com/cortexproject/cortex/pkg/util/limiter"
+	"github.com/cortexproject/cortex/pkg/util/test"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestGlobalCoordinatedStrategy_UnevenTraffic(t *testing.T) {
+	const (
+		userID         = "user"
+		tenantLimit    = 1000
+		samplesPerPush = 10
+		rounds         = 20
+		measuredRounds = 10
+	)
+
+	// Each distributor receives a share of the whole tenant traffic, which is twice the limit.
+	traffic := []float64{0.90, 0.05, 0.05}
+	demand := 2 * tenantLimit
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	overrides, err := validation.NewOverrides(validation.Limits{
+		IngestionRate:      tenantLimit,
+		IngestionBurstSize: 100,
+	}, nil)
+	require.NoError(t, err)
+
+	ring := newReadLifecyclerMock()
+	ring.On("HealthyInstancesCount").Return(len(traffic))
+
+	client := consul.NewInMemoryClient(GetDistributorRatesCodec())
+
+	coordinators := make([]*ingestionRateCoordinator, len(traffic))
+	limiters := make([]*limiter.RateLimiter, len(traffic))
+	for i := range traffic {
+		coordinators[i] = newIngestionRateCoordinator(fmt.Sprintf("distributor-%d", i), time.Second, client, nil, log.NewNopLogger())
+		limiters[i] = limiter.NewRateLimiter(newGlobalCoordinatedIngestionRateStrategy(overrides, ring, coordinators[i]), time.Second)
+
+		go coordinators[i].watchRates(ctx)
+	}
+
+	start := time.Now()
+	admitted := 0
+
+	for round := 0; round < rounds; round++ {
+		// Simulate 1 second of traffic, evenly spread over time.
+		for i, share := range traffic {
+			pushes := int(float64(demand)*share) / samplesPerPush
+
+			for p := 0; p < pushes; p++ {
+				now := start.Add(time.Duration(round) * time.Second).Add(time.Duration(p) * time.Second / time.Duration(pushes))
+
+				coordinators[i].Add(userID, samplesPerPush)
+				if limiters[i].AllowN(now, userID, samplesPerPush) && round >= rounds-measuredRounds {
+					admitted += samplesPerPush
+				}
+			}
+		}
+
+		// Publish the rates and wait until all distributors have seen each other's.
+		for _, c := range coordinators {
+			c.updateRates(ctx, time.Now())
+		}
+		for _, c := range coordinators {
+			for _, other := range coordinators {
+				if c == other {
+					continue
+				}
+
+				expected := other.lastPublished.UnixNano() / int64(time.Millisecond)
+				test.Poll(t, time.Second, expected, func() interface{} {
+					c.remoteMtx.RLock()
+					defer c.remoteMtx.RUnlock()
+
+					if rates := c.remote[other.instanceID]; rates != nil {
+						return rates.UpdatedAt
+					}
+					return int64(0)
+				})
+			}
+		}
+	}
+
+	// The aggregate admitted rate should stay within 10% of the tenant limit.
+	admittedRate := float64(admitted) / measuredRounds
+	assert.InEpsilon(t, tenantLimit, admittedRate, 0.1, "admitted rate: %.2f", admittedRate)
+
+	// Each distributor should get a share of the limit proportional to its traffic.
+	for i, share := range traffic {
+		assert.InEpsilon(t, tenantLimit*share, limiters[i].Limit(start.Add(rounds*time.Second), userID), 0.1)
+	}
+}
+
+func TestGlobalCoordinatedStrategy_FallbackToGlobalStrategy(t *testing.T) {
+	overrides, err := validation.NewOverrides(validation.Limits{IngestionRate: 1000}, nil)
+	require.NoError(t, err)
+
+	ring := newReadLifecyclerMock()
+	ring.On("HealthyInstancesCount").Return(4)
+
+	t.Run("no traffic observed for the tenant", func(t *testing.T) {
+		c := newIngestionRateCoordinator("distributor-0", time.Second, consul.NewInMemoryClient(GetDistributorRatesCodec()), nil, log.NewNopLogger())
+		strategy := newGlobalCoordinatedIngestionRateStrategy(overrides, ring, c)
+
+		c.updateRates(context.Background(), time.Now())
+		assert.Equal(t, float64(250), strategy.Limit("user"))
+	})
+
+	t.Run("KV store unavailable", func(t *testing.T) {
+		c := newIngestionRateCoordinator("distributor-0", time.Second, &failingKVClient{Client: consul.NewInMemoryClient(GetDistributorRatesCodec())}, nil, log.NewNopLogger())
+		strategy := newGlobalCoordinatedIngestionRateStrategy(overrides, ring, c)
+
+		c.Add("user", 100)
+		c.updateRates(context.Background(), time.Now())
+		assert.Equal(t, float64(250), strategy.Limit("user"))
+	})
+
+	t.Run("KV store available", func(t *testing.T) {
+		c := newIngestionRateCoordinator("distributor-0", time.Second, consul.NewInMemoryClient(GetDistributorRatesCodec()), nil, log.NewNopLogger())
+		strategy := newGlobalCoordinatedIngestionRateStrategy(overrides, ring, c)
+
+		c.Add("user", 100)
+		c.updateRates(context.Background(), time.Now())
+		assert.Equal(t, float64(1000), strategy.Limit("user"))
+	})
+}
+
+func TestIngestionRateCoordinator_ShouldIgnoreStaleRates(t *testing.T) {
+	now := time.Now()
+	c := newIngestionRateCoordinator("distributor-0", time.Second, consul.NewInMemoryClient(GetDistributorRatesCodec()), nil, log.NewNopLogger())
+
+	c.Add("user", 100)
+	c.updateRates(context.Background(), now)
+
+	c.remote["distributor-1"] = &DistributorRates{
+		UpdatedAt:   now.UnixNano() / int64(time.Millisecond),
+		TenantRates: map[string]float64{"user": 300},
+	}
+	c.remote["distributor-2"] = &DistributorRates{
+		UpdatedAt:   now.Add(-time.Minute).UnixNano() / int64(time.Millisecond),
+		TenantRates: map[string]float64{"user": 1000},
+	}
+
+	share, ok := c.Share("user", now)
+	require.True(t, ok)
+	assert.Equal(t, 0.25, share)
+}
+
+type failingKVClient struct {
+	kv.Client
+}
+
+func (c *failingKVClient) CAS(_ context.Context, _ string, _ func(in interface{}) (out interface{}, retry bool, err error)) error {
+	return errors.New("KV store unavailable")
+}
@@ -1,6 +1,9 @@
 package distributor
 
 import (
+	"math"
+	"time"
+
 	"golang.org/x/time/rate"
 
 	"github.com/cortexproject/cortex/pkg/util/limiter"
@@ -58,6 +61,32 @@ func (s *globalStrategy) Burst(tenantID string) int {
 	return s.limits.IngestionBurstSize(tenantID)
 }
 
+type globalCoordinatedStrategy struct {
+	globalStrategy
+	coordinator *ingestionRateCoordinator
+}
+
+func newGlobalCoordinatedIngestionRateStrategy(limits *validation.Overrides, ring ReadLifecycler, coordinator *ingestionRateCoordinator) limiter.RateLimiterStrategy {
+	return &globalCoordinatedStrategy{
+		globalStrategy: globalStrategy{
+			limits: limits,
+			ring:   ring,
+		},
+		coordinator: coordinator,
+	}
+}
+
+func (s *globalCoordinatedStrategy) Limit(tenantID string) float64 {
+	// Fallback to evenly share the limit across distributors if the share
+	// can't be computed (e.g. the KV store is unavailable).
+	share, ok := s.coordinator.Share(tenantID, time.Now())
+	if !ok {
+		return s.globalStrategy.Limit(tenantID)
+	}
+
+	return s.limits.IngestionRate(tenantID) * share
+}
+
 type infiniteStrategy struct{}
 
 func newInfiniteIngestionRateStrategy() limiter.RateLimiterStrategy {
@@ -72,3 +101,62 @@ func (s *infiniteStrategy) Burst(tenantID string) int {
 	// Burst is ignored when limit = rate.Inf
 	return 0
 }
+
+type localExemplarsStrategy struct {
+	limits *validation.Overrides
+}
+
+func newLocalExemplarsRateStrategy(limits *validation.Overrides) limiter.RateLimiterStrategy {
+	return &localExemplarsStrategy{
+		limits: limits,
+	}
+}
+
+func (s *localExemplarsStrategy) Limit(tenantID string) float64 {
+	if limit := s.limits.MaxExemplarsPerSecond(tenantID); limit > 0 {
+		return limit
+	}
+	return float64(rate.Inf)
+}
+
+func (s *localExemplarsStrategy) Burst(tenantID string) int {
+	return exemplarsBurst(s.limits.MaxExemplarsPerSecond(tenantID))
+}
+
+type globalExemplarsStrategy struct {
+	limits *validation.Overrides
+	ring   ReadLifecycler
+}
+
+func newGlobalExemplarsRateStrategy(limits *validation.Overrides, ring ReadLifecycler) limiter.RateLimiterStrategy {
+	return &globalExemplarsStrategy{
+		limits: limits,
+		ring:   ring,
+	}
+}
+
+func (s *globalExemplarsStrategy) Limit(tenantID string) float64 {
+	limit := s.limits.MaxExemplarsPerSecond(tenantID)
+	if limit <= 0 {
+		return float64(rate.Inf)
+	}
+
+	if numDistributors := s.ring.HealthyInstancesCount(); numDistributors > 0 {
+		return limit / float64(numDistributors)
+	}
+	return limit
+}
+
+func (s *globalExemplarsStrategy) Burst(tenantID string) int {
+	// Like for the ingestion rate, the burst doesn't change for the global strategy.
+	return exemplarsBurst(s.limits.MaxExemplarsPerSecond(tenantID))
+}
+
+// exemplarsBurst returns the burst for the exemplars rate limiter, which allows
+// up to 1 second worth of exemplars. Burst is ignored when the limit is disabled.
+func exemplarsBurst(limit float64) int {
+	if limit <= 0 {
+		return 0
+	}
+	return int(math.Max(1, math.Ceil(limit)))
+}
@@ -83,6 +83,76 @@ func TestIngestionRateStrategy(t *testing.T) {
 	}
 }
 
+func TestExemplarsRateStrategy(t *testing.T) {
+	tests := map[string]struct {
+		strategy      string
+		limit         float64
+		ring          ReadLifecycler
+		expectedLimit float64
+		expectedBurst int
+	}{
+		"local rate limiter should return the configured limit with 1 second of burst": {
+			strategy:      validation.LocalIngestionRateStrategy,
+			limit:         float64(100),
+			expectedLimit: float64(100),
+			expectedBurst: 100,
+		},
+		"local rate limiter should be unlimited if the limit is disabled": {
+			strategy:      validation.LocalIngestionRateStrategy,
+			limit:         0,
+			expectedLimit: float64(rate.Inf),
+			expectedBurst: 0,
+		},
+		"global rate limiter should share the limit across the number of distributors": {
+			strategy: validation.GlobalIngestionRateStrategy,
+			limit:    float64(100),
+			ring: func() ReadLifecycler {
+				ring := newReadLifecyclerMock()
+				ring.On("HealthyInstancesCount").Return(4)
+				return ring
+			}(),
+			expectedLimit: float64(25),
+			expectedBurst: 100,
+		},
+		"global rate limiter should be unlimited if the limit is disabled": {
+			strategy:      validation.GlobalIngestionRateStrategy,
+			limit:         0,
+			ring:          newReadLifecyclerMock(),
+			expectedLimit: float64(rate.Inf),
+			expectedBurst: 0,
+		},
+		"burst should be at least 1 for a limit lower than 1": {
+			strategy:      validation.LocalIngestionRateStrategy,
+			limit:         0.5,
+			expectedLimit: 0.5,
+			expectedBurst: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			var strategy limiter.RateLimiterStrategy
+
+			overrides, err := validation.NewOverrides(validation.Limits{MaxExemplarsPerSecond: testData.limit}, nil)
+			require.NoError(t, err)
+
+			switch testData.strategy {
+			case validation.LocalIngestionRateStrategy:
+				strategy = newLocalExemplarsRateStrategy(overrides)
+			case validation.GlobalIngestionRateStrategy:
+				strategy = newGlobalExemplarsRateStrategy(overrides, testData.ring)
+			default:
+				require.Fail(t, "Unknown strategy")
+			}
+
+			assert.Equal(t, testData.expectedLimit, strategy.Limit("test"))
+			assert.Equal(t, testData.expectedBurst, strategy.Burst("test"))
+		})
+	}
+}
+
 type readLifecyclerMock struct {
 	mock.Mock
 }
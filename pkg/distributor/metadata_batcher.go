@@ -0,0 +1,86 @@
+package distributor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/grafana/dskit/services"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+)
+
+// metadataBatcher aggregates the metadata received across the write requests and pushes it
+// to the ingesters periodically, so that the series pushes never wait on the metadata ones.
+// The metadata is deduplicated by tenant and metric name, keeping the latest received.
+type metadataBatcher struct {
+	services.Service
+
+	send   func(ctx context.Context, userID string, metadata []*cortexpb.MetricMetadata) error
+	logger log.Logger
+
+	mtx     sync.Mutex
+	pending map[string]map[string]cortexpb.MetricMetadata
+}
+
+func newMetadataBatcher(period time.Duration, send func(ctx context.Context, userID string, metadata []*cortexpb.MetricMetadata) error, logger log.Logger) *metadataBatcher {
+	b := &metadataBatcher{
+		send:    send,
+		logger:  logger,
+		pending: map[string]map[string]cortexpb.MetricMetadata{},
+	}
+
+	b.Service = services.NewTimerService(period, nil, b.iteration, b.stopping)
+	return b
+}
+
+// add enqueues the metadata to be pushed at the next flush.
+func (b *metadataBatcher) add(userID string, metadata []*cortexpb.MetricMetadata) {
+	if len(metadata) == 0 {
+		return
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	byMetric, ok := b.pending[userID]
+	if !ok {
+		byMetric = make(map[string]cortexpb.MetricMetadata, len(metadata))
+		b.pending[userID] = byMetric
+	}
+	for _, m := range metadata {
+		byMetric[m.MetricFamilyName] = *m
+	}
+}
+
+func (b *metadataBatcher) iteration(ctx context.Context) error {
+	b.flush(ctx)
+	return nil
+}
+
+func (b *metadataBatcher) stopping(_ error) error {
+	// Push the pending metadata before shutting down.
+	b.flush(context.Background())
+	return nil
+}
+
+func (b *metadataBatcher) flush(ctx context.Context) {
+	b.mtx.Lock()
+	pending := b.pending
+	b.pending = map[string]map[string]cortexpb.MetricMetadata{}
+	b.mtx.Unlock()
+
+	for userID, byMetric := range pending {
+		metadata := make([]*cortexpb.MetricMetadata, 0, len(byMetric))
+		for name := range byMetric {
+			m := byMetric[name]
+			metadata = append(metadata, &m)
+		}
+
+		if err := b.send(ctx, userID, metadata); err != nil {
+			level.Warn(b.logger).Log("msg", "failed to push metadata to ingesters", "user", userID, "err", err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package distributor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func TestMetadataBatcher_ShouldDeduplicateByTenantAndMetricName(t *testing.T) {
+	sent := map[string][]cortexpb.MetricMetadata{}
+	b := newMetadataBatcher(time.Hour, func(_ context.Context, userID string, metadata []*cortexpb.MetricMetadata) error {
+		for _, m := range metadata {
+			sent[userID] = append(sent[userID], *m)
+		}
+		return nil
+	}, log.NewNopLogger())
+
+	b.add("user-1", []*cortexpb.MetricMetadata{
+		{MetricFamilyName: "foo", Help: "first", Type: cortexpb.COUNTER},
+		{MetricFamilyName: "bar", Help: "bar", Type: cortexpb.GAUGE},
+	})
+	b.add("user-1", []*cortexpb.MetricMetadata{
+		{MetricFamilyName: "foo", Help: "second", Type: cortexpb.COUNTER},
+	})
+	b.add("user-2", []*cortexpb.MetricMetadata{
+		{MetricFamilyName: "foo", Help: "other tenant", Type: cortexpb.COUNTER},
+	})
+
+	b.flush(context.Background())
+
+	assert.ElementsMatch(t, []cortexpb.MetricMetadata{
+		{MetricFamilyName: "foo", Help: "second", Type: cortexpb.COUNTER},
+		{MetricFamilyName: "bar", Help: "bar", Type: cortexpb.GAUGE},
+	}, sent["user-1"])
+	assert.ElementsMatch(t, []cortexpb.MetricMetadata{
+		{MetricFamilyName: "foo", Help: "other tenant", Type: cortexpb.COUNTER},
+	}, sent["user-2"])
+
+	// The flushed metadata is never pushed again.
+	sent = map[string][]cortexpb.MetricMetadata{}
+	b.flush(context.Background())
+	assert.Empty(t, sent)
+}
+
+func TestDistributor_MetadataBatcher_ShouldRetryFailingIngesterIndependently(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	ds, ingesters, r, _ := prepare(t, prepConfig{
+		numIngesters:       3,
+		happyIngesters:     2,
+		numDistributors:    1,
+		shardByAllLabels:   true,
+		metadataSendPeriod: 50 * time.Millisecond,
+	})
+	defer stopAll(ds, r)
+
+	// The samples are accepted even if an ingester keeps failing.
+	_, err := ds[0].Push(ctx, makeWriteRequest(0, 5, 10))
+	require.NoError(t, err)
+
+	// The healthy ingesters receive the metadata, while the failing one is retried.
+	test.Poll(t, time.Second, []int{10, 10}, func() interface{} {
+		return []int{countMockIngesterMetadata(&ingesters[0]), countMockIngesterMetadata(&ingesters[1])}
+	})
+	test.Poll(t, time.Second, true, func() interface{} {
+		return testutil.ToFloat64(ds[0].metadataSendFailures.WithLabelValues("2")) >= 2
+	})
+	assert.Equal(t, 0, countMockIngesterMetadata(&ingesters[2]))
+
+	// The metadata is delivered once the ingester recovers.
+	ingesters[2].Lock()
+	ingesters[2].happy = true
+	ingesters[2].Unlock()
+
+	test.Poll(t, time.Second, 10, func() interface{} {
+		return countMockIngesterMetadata(&ingesters[2])
+	})
+}
+
+func countMockIngesterMetadata(i *mockIngester) int {
+	i.Lock()
+	defer i.Unlock()
+
+	count := 0
+	for _, set := range i.metadata {
+		count += len(set)
+	}
+	return count
+}
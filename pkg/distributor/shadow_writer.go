@@ -0,0 +1,222 @@
+package distributor
+
+import (
+	"context"
+	"flag"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage/remote"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+)
+
+// ShadowWriteConfig configures the forwarding of the write requests to the per-tenant shadow
+// remote-write endpoints.
+type ShadowWriteConfig struct {
+	QueueSize   int           `yaml:"queue_size"`
+	Concurrency int           `yaml:"concurrency"`
+	Timeout     time.Duration `yaml:"timeout"`
+}
+
+// RegisterFlagsWithPrefix registers flags with prefix.
+func (cfg *ShadowWriteConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.IntVar(&cfg.QueueSize, prefix+"queue-size", 1000, "Max number of write requests queued to be forwarded to the shadow remote-write endpoints. The requests received while the queue is full are not forwarded.")
+	f.IntVar(&cfg.Concurrency, prefix+"concurrency", 4, "Max number of concurrent requests to the shadow remote-write endpoints.")
+	f.DurationVar(&cfg.Timeout, prefix+"timeout", 10*time.Second, "Timeout of the requests to the shadow remote-write endpoints.")
+}
+
+type shadowWriterLimits interface {
+	// ShadowWriteEndpoint returns the remote-write URL to which the tenant's write requests are
+	// forwarded, or an empty string if disabled.
+	ShadowWriteEndpoint(userID string) string
+
+	// ShadowWritePercent returns the percentage of the tenant's write requests to forward.
+	ShadowWritePercent(userID string) float64
+}
+
+type shadowWriteRequest struct {
+	userID   string
+	endpoint string
+
+	// The encoded WriteRequest.
+	data []byte
+}
+
+type shadowWriteClient struct {
+	endpoint string
+	client   remote.WriteClient
+}
+
+// shadowWriter forwards a percentage of the tenants' write requests to their shadow remote-write
+// endpoint, e.g. a secondary Cortex cluster used for migration testing. The forwarding is best
+// effort: the requests are sent asynchronously, and they're dropped if the queue is full, so
+// that the shadow endpoint never affects the primary write path.
+type shadowWriter struct {
+	services.Service
+
+	cfg    ShadowWriteConfig
+	limits shadowWriterLimits
+	logger log.Logger
+	queue  chan shadowWriteRequest
+
+	// Returns the remote-write client of the tenant. Replaceable for testing.
+	newClient func(userID, endpoint string) (remote.WriteClient, error)
+
+	clientsMtx sync.Mutex
+	clients    map[string]shadowWriteClient
+
+	sent    *prometheus.CounterVec
+	failed  *prometheus.CounterVec
+	dropped *prometheus.CounterVec
+}
+
+func newShadowWriter(cfg ShadowWriteConfig, limits shadowWriterLimits, reg prometheus.Registerer, logger log.Logger) *shadowWriter {
+	w := &shadowWriter{
+		cfg:     cfg,
+		limits:  limits,
+		logger:  logger,
+		queue:   make(chan shadowWriteRequest, cfg.QueueSize),
+		clients: map[string]shadowWriteClient{},
+
+		sent: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_shadow_write_requests_total",
+			Help:      "The total number of write requests successfully forwarded to the shadow remote-write endpoint.",
+		}, []string{"user"}),
+		failed: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_shadow_write_failures_total",
+			Help:      "The total number of write requests which failed to be forwarded to the shadow remote-write endpoint.",
+		}, []string{"user"}),
+		dropped: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "distributor_shadow_write_dropped_requests_total",
+			Help:      "The total number of write requests not forwarded to the shadow remote-write endpoint because the queue was full.",
+		}, []string{"user"}),
+	}
+	w.newClient = w.newRemoteWriteClient
+
+	w.Service = services.NewBasicService(nil, w.running, nil)
+	return w
+}
+
+// add forwards the series and metadata to the tenant's shadow endpoint, for the configured
+// percentage of the requests. It never blocks: the request is dropped if the queue is full.
+func (w *shadowWriter) add(userID string, timeseries []cortexpb.PreallocTimeseries, metadata []*cortexpb.MetricMetadata) {
+	endpoint := w.limits.ShadowWriteEndpoint(userID)
+	percent := w.limits.ShadowWritePercent(userID)
+	if endpoint == "" || percent <= 0 || (percent < 100 && rand.Float64()*100 >= percent) {
+		return
+	}
+
+	// Skip the encoding if the request would be dropped anyway.
+	if len(w.queue) >= cap(w.queue) {
+		w.dropped.WithLabelValues(userID).Inc()
+		return
+	}
+
+	// The request is encoded right away, because its buffers are reused once the request to
+	// the ingesters is done.
+	data, err := (&cortexpb.WriteRequest{Timeseries: timeseries, Metadata: metadata}).Marshal()
+	if err != nil {
+		w.failed.WithLabelValues(userID).Inc()
+		level.Warn(w.logger).Log("msg", "failed to encode the shadow write request", "user", userID, "err", err)
+		return
+	}
+
+	select {
+	case w.queue <- shadowWriteRequest{userID: userID, endpoint: endpoint, data: data}:
+	default:
+		w.dropped.WithLabelValues(userID).Inc()
+	}
+}
+
+func (w *shadowWriter) running(ctx context.Context) error {
+	wg := sync.WaitGroup{}
+	wg.Add(w.cfg.Concurrency)
+
+	for i := 0; i < w.cfg.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case req := <-w.queue:
+					w.send(ctx, req)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func (w *shadowWriter) send(ctx context.Context, req shadowWriteRequest) {
+	client, err := w.getClient(req.userID, req.endpoint)
+	if err == nil {
+		err = client.Store(ctx, snappy.Encode(nil, req.data))
+	}
+	if err != nil {
+		w.failed.WithLabelValues(req.userID).Inc()
+		level.Warn(w.logger).Log("msg", "failed to forward the write request to the shadow endpoint", "user", req.userID, "endpoint", req.endpoint, "err", err)
+		return
+	}
+	w.sent.WithLabelValues(req.userID).Inc()
+}
+
+// getClient returns the remote-write client of the tenant, creating a new one if the tenant's
+// endpoint changed.
+func (w *shadowWriter) getClient(userID, endpoint string) (remote.WriteClient, error) {
+	w.clientsMtx.Lock()
+	defer w.clientsMtx.Unlock()
+
+	if c, ok := w.clients[userID]; ok && c.endpoint == endpoint {
+		return c.client, nil
+	}
+
+	client, err := w.newClient(userID, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	w.clients[userID] = shadowWriteClient{endpoint: endpoint, client: client}
+	return client, nil
+}
+
+func (w *shadowWriter) newRemoteWriteClient(userID, endpoint string) (remote.WriteClient, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return remote.NewWriteClient("shadow-"+userID, &remote.ClientConfig{
+		URL:     &config_util.URL{URL: u},
+		Timeout: model.Duration(w.cfg.Timeout),
+		Headers: map[string]string{user.OrgIDHeaderName: userID},
+	})
+}
+
+// cleanupUser removes the client and the metrics of the tenant.
+func (w *shadowWriter) cleanupUser(userID string) {
+	w.clientsMtx.Lock()
+	delete(w.clients, userID)
+	w.clientsMtx.Unlock()
+
+	w.sent.DeleteLabelValues(userID)
+	w.failed.DeleteLabelValues(userID)
+	w.dropped.DeleteLabelValues(userID)
+}
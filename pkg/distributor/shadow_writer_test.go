@@ -0,0 +1,206 @@
+package distributor
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/golang/snappy"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+	"go.uber.org/atomic"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/test"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestShadowWriter_ShouldForwardThePercentageOfRequests(t *testing.T) {
+	const numRequests = 10000
+
+	limits := mockShadowWriterLimits{
+		"user-1": {endpoint: "http://shadow", percent: 30},
+		"user-2": {endpoint: "http://shadow", percent: 100},
+		"user-3": {endpoint: "", percent: 100},
+		"user-4": {endpoint: "http://shadow", percent: 0},
+	}
+
+	tests := map[string]struct {
+		userID   string
+		expected float64
+		delta    float64
+	}{
+		"should forward the configured percentage of the requests": {
+			userID:   "user-1",
+			expected: 0.3 * numRequests,
+			delta:    0.03 * numRequests,
+		},
+		"should forward all the requests at 100%": {
+			userID:   "user-2",
+			expected: numRequests,
+		},
+		"should not forward the requests if the endpoint is not configured": {
+			userID:   "user-3",
+			expected: 0,
+		},
+		"should not forward the requests at 0%": {
+			userID:   "user-4",
+			expected: 0,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			// The writer is not started, so that the forwarded requests are kept in the queue.
+			w := newShadowWriter(ShadowWriteConfig{QueueSize: numRequests, Concurrency: 1}, limits, nil, log.NewNopLogger())
+
+			for i := 0; i < numRequests; i++ {
+				w.add(testData.userID, makeWriteRequest(0, 1, 0).Timeseries, nil)
+			}
+
+			assert.InDelta(t, testData.expected, len(w.queue), testData.delta)
+			assert.Equal(t, float64(0), testutil.ToFloat64(w.dropped.WithLabelValues(testData.userID)))
+		})
+	}
+}
+
+func TestShadowWriter_ShouldDropRequestsWhenTheQueueIsFull(t *testing.T) {
+	limits := mockShadowWriterLimits{"user": {endpoint: "http://shadow", percent: 100}}
+
+	// The writer is not started, so that the queue is never consumed.
+	w := newShadowWriter(ShadowWriteConfig{QueueSize: 2, Concurrency: 1}, limits, nil, log.NewNopLogger())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			w.add("user", makeWriteRequest(0, 1, 0).Timeseries, nil)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "the shadow writer blocked on a full queue")
+	}
+
+	assert.Len(t, w.queue, 2)
+	assert.Equal(t, float64(8), testutil.ToFloat64(w.dropped.WithLabelValues("user")))
+}
+
+func TestShadowWriter_ShouldSendTheRequestsToTheEndpoint(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		received []cortexpb.WriteRequest
+		tenants  []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/push" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		compressed, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		data, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+
+		var req cortexpb.WriteRequest
+		require.NoError(t, req.Unmarshal(data))
+
+		mtx.Lock()
+		received = append(received, req)
+		tenants = append(tenants, r.Header.Get(user.OrgIDHeaderName))
+		mtx.Unlock()
+	}))
+	defer server.Close()
+
+	limits := mockShadowWriterLimits{
+		"user-1": {endpoint: server.URL + "/api/v1/push", percent: 100},
+		"user-2": {endpoint: server.URL + "/unknown", percent: 100},
+	}
+
+	w := newShadowWriter(ShadowWriteConfig{QueueSize: 10, Concurrency: 2, Timeout: time.Second}, limits, prometheus.NewPedanticRegistry(), log.NewNopLogger())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), w))
+	defer services.StopAndAwaitTerminated(context.Background(), w) //nolint:errcheck
+
+	w.add("user-1", makeWriteRequest(0, 2, 0).Timeseries, []*cortexpb.MetricMetadata{{MetricFamilyName: "foo", Type: cortexpb.COUNTER}})
+	w.add("user-2", makeWriteRequest(0, 2, 0).Timeseries, nil)
+
+	test.Poll(t, time.Second, []float64{1, 1}, func() interface{} {
+		return []float64{testutil.ToFloat64(w.sent.WithLabelValues("user-1")), testutil.ToFloat64(w.failed.WithLabelValues("user-2"))}
+	})
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	require.Len(t, received, 1)
+	assert.Equal(t, []string{"user-1"}, tenants)
+	assert.Len(t, received[0].Timeseries, 2)
+	assert.Equal(t, []*cortexpb.MetricMetadata{{MetricFamilyName: "foo", Type: cortexpb.COUNTER}}, received[0].Metadata)
+}
+
+func TestDistributor_Push_ShouldNotWaitOnTheShadowEndpoint(t *testing.T) {
+	// The shadow endpoint never responds until the test ends.
+	received := atomic.NewInt32(0)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Inc()
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	limits := &validation.Limits{}
+	flagext.DefaultValues(limits)
+	limits.ShadowWriteEndpoint = server.URL
+	limits.ShadowWritePercent = 100
+
+	ds, _, r, _ := prepare(t, prepConfig{
+		numIngesters:     3,
+		happyIngesters:   3,
+		numDistributors:  1,
+		shardByAllLabels: true,
+		limits:           limits,
+	})
+	defer stopAll(ds, r)
+
+	ctx := user.InjectOrgID(context.Background(), "user")
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		_, err := ds[0].Push(ctx, makeWriteRequest(int64(i), 1, 0))
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	}
+
+	// The requests have been forwarded, even if the shadow endpoint is stuck.
+	test.Poll(t, time.Second, true, func() interface{} {
+		return received.Load() > 0
+	})
+}
+
+type mockShadowWriterLimit struct {
+	endpoint string
+	percent  float64
+}
+
+type mockShadowWriterLimits map[string]mockShadowWriterLimit
+
+func (m mockShadowWriterLimits) ShadowWriteEndpoint(userID string) string {
+	return m[userID].endpoint
+}
+
+func (m mockShadowWriterLimits) ShadowWritePercent(userID string) float64 {
+	return m[userID].percent
+}
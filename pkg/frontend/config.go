@@ -21,6 +21,8 @@ type CombinedFrontendConfig struct {
 	FrontendV2 v2.Config               `yaml:",inline"`
 
 	DownstreamURL string `yaml:"downstream_url"`
+
+	MaxQueryRetriesOnQuerierFailure int `yaml:"max_query_retries_on_querier_failure"`
 }
 
 func (cfg *CombinedFrontendConfig) RegisterFlags(f *flag.FlagSet) {
@@ -29,6 +31,12 @@ func (cfg *CombinedFrontendConfig) RegisterFlags(f *flag.FlagSet) {
 	cfg.FrontendV2.RegisterFlags(f)
 
 	f.StringVar(&cfg.DownstreamURL, "frontend.downstream-url", "", "URL of downstream Prometheus.")
+	f.IntVar(&cfg.MaxQueryRetriesOnQuerierFailure, "frontend.max-query-retries-on-querier-failure", 0, "Maximum number of times a query is retried when the connection to the querier executing it is lost. The retries share the deadline of the query. 0 to disable.")
+}
+
+// Validate the config and returns an error if the validation doesn't pass.
+func (cfg *CombinedFrontendConfig) Validate() error {
+	return cfg.Handler.QueryAudit.Validate()
 }
 
 // InitFrontend initializes frontend (either V1 -- without scheduler, or V2 -- with scheduler) or no frontend at
@@ -60,7 +68,11 @@ func InitFrontend(cfg CombinedFrontendConfig, limits v1.Limits, grpcListenPort i
 		}
 
 		fr, err := v2.NewFrontend(cfg.FrontendV2, log, reg)
-		return transport.AdaptGrpcRoundTripperToHTTPRoundTripper(fr), nil, fr, err
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rt := transport.NewQuerierFailureRetry(fr, cfg.MaxQueryRetriesOnQuerierFailure, log, reg)
+		return transport.AdaptGrpcRoundTripperToHTTPRoundTripper(rt), nil, fr, nil
 
 	default:
 		// No scheduler = use original frontend.
@@ -68,6 +80,7 @@ func InitFrontend(cfg CombinedFrontendConfig, limits v1.Limits, grpcListenPort i
 		if err != nil {
 			return nil, nil, nil, err
 		}
-		return transport.AdaptGrpcRoundTripperToHTTPRoundTripper(fr), fr, nil, nil
+		rt := transport.NewQuerierFailureRetry(fr, cfg.MaxQueryRetriesOnQuerierFailure, log, reg)
+		return transport.AdaptGrpcRoundTripperToHTTPRoundTripper(rt), fr, nil, nil
 	}
 }
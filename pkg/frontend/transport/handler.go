@@ -17,25 +17,22 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/weaveworks/common/httpgrpc"
-	"github.com/weaveworks/common/httpgrpc/server"
 
 	querier_stats "github.com/cortexproject/cortex/pkg/querier/stats"
 	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/apierror"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 )
 
 const (
 	// StatusClientClosedRequest is the status code for when a client request cancellation of an http request
-	StatusClientClosedRequest = 499
+	StatusClientClosedRequest = apierror.StatusClientClosedRequest
 	ServiceTimingHeaderName   = "Server-Timing"
-)
 
-var (
-	errCanceled              = httpgrpc.Errorf(StatusClientClosedRequest, context.Canceled.Error())
-	errDeadlineExceeded      = httpgrpc.Errorf(http.StatusGatewayTimeout, context.DeadlineExceeded.Error())
-	errRequestEntityTooLarge = httpgrpc.Errorf(http.StatusRequestEntityTooLarge, "http: request body too large")
+	// QueryStatsHeaderName is the header with the statistics of the query, returned to the
+	// tenants which enabled it.
+	QueryStatsHeaderName = "X-Cortex-Query-Stats"
 )
 
 // Config for a Handler.
@@ -43,12 +40,32 @@ type HandlerConfig struct {
 	LogQueriesLongerThan time.Duration `yaml:"log_queries_longer_than"`
 	MaxBodySize          int64         `yaml:"max_body_size"`
 	QueryStatsEnabled    bool          `yaml:"query_stats_enabled"`
+
+	// Posting of the sampled query audit records to the per-tenant webhooks.
+	QueryAudit QueryAuditConfig `yaml:"query_audit"`
 }
 
 func (cfg *HandlerConfig) RegisterFlags(f *flag.FlagSet) {
-	f.DurationVar(&cfg.LogQueriesLongerThan, "frontend.log-queries-longer-than", 0, "Log queries that are slower than the specified duration. Set to 0 to disable. Set to < 0 to enable on all queries.")
+	f.DurationVar(&cfg.LogQueriesLongerThan, "frontend.log-queries-longer-than", 0, "Log queries that are slower than the specified duration. Set to 0 to disable. Set to < 0 to enable on all queries. The slow queries are logged with the component slow-query-log, their tenant and parameters, and how they have been split, sharded, served from the results cache and sent downstream.")
 	f.Int64Var(&cfg.MaxBodySize, "frontend.max-body-size", 10*1024*1024, "Max body size for downstream prometheus.")
 	f.BoolVar(&cfg.QueryStatsEnabled, "frontend.query-stats-enabled", false, "True to enable query statistics tracking. When enabled, a message with some statistics is logged for every query.")
+	cfg.QueryAudit.RegisterFlagsWithPrefix("frontend.query-audit.", f)
+}
+
+// Limits is the interface of the per-tenant limits used by the Handler.
+type Limits interface {
+	// QueryStatsHeaderEnabled returns whether the statistics of the queries are returned in the response header.
+	QueryStatsHeaderEnabled(userID string) bool
+
+	// QueryAuditSampleRatio returns the ratio of the queries whose audit record is posted to the webhook.
+	QueryAuditSampleRatio(userID string) float64
+
+	// QueryAuditWebhookURL returns the URL of the webhook the query audit records are posted to, or
+	// an empty string if disabled.
+	QueryAuditWebhookURL(userID string) string
+
+	// QueryAuditFields returns the fields included in the query audit records, or all if empty.
+	QueryAuditFields(userID string) []string
 }
 
 // Handler accepts queries and forwards them to RoundTripper. It can log slow queries,
@@ -56,7 +73,10 @@ func (cfg *HandlerConfig) RegisterFlags(f *flag.FlagSet) {
 type Handler struct {
 	cfg          HandlerConfig
 	log          log.Logger
+	slowQueryLog log.Logger
 	roundTripper http.RoundTripper
+	limits       Limits
+	auditor      *queryAuditor
 
 	// Metrics.
 	querySeconds *prometheus.CounterVec
@@ -65,12 +85,14 @@ type Handler struct {
 	activeUsers  *util.ActiveUsersCleanupService
 }
 
-// NewHandler creates a new frontend handler.
-func NewHandler(cfg HandlerConfig, roundTripper http.RoundTripper, log log.Logger, reg prometheus.Registerer) http.Handler {
+// NewHandler creates a new frontend handler. The limits are optional.
+func NewHandler(cfg HandlerConfig, roundTripper http.RoundTripper, limits Limits, logger log.Logger, reg prometheus.Registerer) http.Handler {
 	h := &Handler{
 		cfg:          cfg,
-		log:          log,
+		log:          logger,
+		slowQueryLog: log.With(logger, "component", "slow-query-log"),
 		roundTripper: roundTripper,
+		limits:       limits,
 	}
 
 	if cfg.QueryStatsEnabled {
@@ -98,23 +120,39 @@ func NewHandler(cfg HandlerConfig, roundTripper http.RoundTripper, log log.Logge
 		_ = h.activeUsers.StartAsync(context.Background())
 	}
 
+	if cfg.QueryAudit.Enabled && limits != nil {
+		h.auditor = newQueryAuditor(cfg.QueryAudit, limits, logger, reg)
+		// If the auditor stops or fail, the queued records are simply not posted.
+		_ = h.auditor.StartAsync(context.Background())
+	}
+
 	return h
 }
 
 func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	var (
-		stats       *querier_stats.Stats
-		queryString url.Values
+		stats         *querier_stats.Stats
+		frontendStats *querier_stats.FrontendStats
+		queryString   url.Values
+		auditTargets  = f.sampleQueryAudit(r.Context())
 	)
 
 	// Initialise the stats in the context and make sure it's propagated
-	// down the request chain.
-	if f.cfg.QueryStatsEnabled {
+	// down the request chain. The audited queries report their fetched series.
+	if f.cfg.QueryStatsEnabled || len(auditTargets) > 0 {
 		var ctx context.Context
 		stats, ctx = querier_stats.ContextWithEmptyStats(r.Context())
 		r = r.WithContext(ctx)
 	}
 
+	// Initialise the frontend stats in the context, so that the middlewares can report
+	// how the query has been processed to the slow query log.
+	if f.cfg.LogQueriesLongerThan > 0 {
+		var ctx context.Context
+		frontendStats, ctx = querier_stats.ContextWithEmptyFrontendStats(r.Context())
+		r = r.WithContext(ctx)
+	}
+
 	defer func() {
 		_ = r.Body.Close()
 	}()
@@ -130,6 +168,11 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		writeError(w, err)
+
+		if len(auditTargets) > 0 {
+			queryString = f.parseRequestQueryString(r, buf)
+			f.auditQuery(r, auditTargets, queryString, queryResponseTime, apierror.FromError(err).StatusCode(), stats)
+		}
 		return
 	}
 
@@ -140,37 +183,80 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if f.cfg.QueryStatsEnabled {
 		writeServiceTimingHeader(queryResponseTime, hs, stats)
+
+		if f.queryStatsHeaderEnabled(r.Context()) {
+			writeQueryStatsHeader(hs, stats)
+		}
 	}
 
-	w.WriteHeader(resp.StatusCode)
-	// we don't check for copy error as there is no much we can do at this point
-	_, _ = io.Copy(w, resp.Body)
+	if resp.StatusCode >= 400 {
+		// Normalize the error responses, which may come from different components, into
+		// Prometheus-style JSON error objects.
+		body, _ := ioutil.ReadAll(resp.Body)
+		apierror.WriteError(w, apierror.FromHTTPResponse(resp.StatusCode, body))
+	} else {
+		w.WriteHeader(resp.StatusCode)
+		// we don't check for copy error as there is no much we can do at this point
+		_, _ = io.Copy(w, resp.Body)
+	}
 
 	// Check whether we should parse the query string.
 	shouldReportSlowQuery := f.cfg.LogQueriesLongerThan > 0 && queryResponseTime > f.cfg.LogQueriesLongerThan
-	if shouldReportSlowQuery || f.cfg.QueryStatsEnabled {
+	if shouldReportSlowQuery || f.cfg.QueryStatsEnabled || len(auditTargets) > 0 {
 		queryString = f.parseRequestQueryString(r, buf)
 	}
 
 	if shouldReportSlowQuery {
-		f.reportSlowQuery(r, queryString, queryResponseTime)
+		f.reportSlowQuery(r, queryString, queryResponseTime, frontendStats)
 	}
 	if f.cfg.QueryStatsEnabled {
 		f.reportQueryStats(r, queryString, queryResponseTime, stats)
 	}
+	if len(auditTargets) > 0 {
+		f.auditQuery(r, auditTargets, queryString, queryResponseTime, resp.StatusCode, stats)
+	}
 }
 
-// reportSlowQuery reports slow queries.
-func (f *Handler) reportSlowQuery(r *http.Request, queryString url.Values, queryResponseTime time.Duration) {
+// sampleQueryAudit returns the tenants of the request whose query is audited.
+func (f *Handler) sampleQueryAudit(ctx context.Context) []queryAuditTarget {
+	if f.auditor == nil {
+		return nil
+	}
+
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil
+	}
+	return f.auditor.sample(tenantIDs)
+}
+
+// auditQuery queues the audit record of the completed query, to be posted asynchronously.
+func (f *Handler) auditQuery(r *http.Request, targets []queryAuditTarget, queryString url.Values, queryResponseTime time.Duration, status int, stats *querier_stats.Stats) {
+	tenantIDs, err := tenant.TenantIDs(r.Context())
+	if err != nil {
+		return
+	}
+	f.auditor.add(targets, tenant.JoinTenantIDs(tenantIDs), r, queryString, queryResponseTime, status, stats)
+}
+
+// reportSlowQuery reports slow queries, with their parameters and how they have been processed by the
+// middlewares. The tenant is added by the logger from the context.
+func (f *Handler) reportSlowQuery(r *http.Request, queryString url.Values, queryResponseTime time.Duration, stats *querier_stats.FrontendStats) {
 	logMessage := append([]interface{}{
 		"msg", "slow query detected",
 		"method", r.Method,
 		"host", r.Host,
 		"path", r.URL.Path,
 		"time_taken", queryResponseTime.String(),
+		"split_queries", stats.LoadSplitQueries(),
+		"sharded_queries", stats.LoadShardedQueries(),
+		"results_cache_hit_ratio", stats.LoadResultsCacheHitRatio(),
+		"downstream_requests", stats.LoadDownstreamRequests(),
+		"downstream_time", stats.LoadDownstreamTime().String(),
+		"downstream_max_time", stats.LoadDownstreamMaxTime().String(),
 	}, formatQueryString(queryString)...)
 
-	level.Info(util_log.WithContext(r.Context(), f.log)).Log(logMessage...)
+	level.Info(util_log.WithContext(r.Context(), f.slowQueryLog)).Log(logMessage...)
 }
 
 func (f *Handler) reportQueryStats(r *http.Request, queryString url.Values, queryResponseTime time.Duration, stats *querier_stats.Stats) {
@@ -181,6 +267,7 @@ func (f *Handler) reportQueryStats(r *http.Request, queryString url.Values, quer
 	userID := tenant.JoinTenantIDs(tenantIDs)
 	wallTime := stats.LoadWallTime()
 	numSeries := stats.LoadFetchedSeries()
+	numChunks := stats.LoadFetchedChunks()
 	numBytes := stats.LoadFetchedChunkBytes()
 
 	// Track stats.
@@ -198,7 +285,10 @@ func (f *Handler) reportQueryStats(r *http.Request, queryString url.Values, quer
 		"response_time", queryResponseTime,
 		"query_wall_time_seconds", wallTime.Seconds(),
 		"fetched_series_count", numSeries,
+		"fetched_chunks_count", numChunks,
 		"fetched_chunks_bytes", numBytes,
+		"ingester_wall_time_seconds", stats.LoadIngesterWallTime().Seconds(),
+		"store_gateway_wall_time_seconds", stats.LoadStoreGatewayWallTime().Seconds(),
 	}, formatQueryString(queryString)...)
 
 	level.Info(util_log.WithContext(r.Context(), f.log)).Log(logMessage...)
@@ -226,17 +316,7 @@ func formatQueryString(queryString url.Values) (fields []interface{}) {
 }
 
 func writeError(w http.ResponseWriter, err error) {
-	switch err {
-	case context.Canceled:
-		err = errCanceled
-	case context.DeadlineExceeded:
-		err = errDeadlineExceeded
-	default:
-		if util.IsRequestBodyTooLarge(err) {
-			err = errRequestEntityTooLarge
-		}
-	}
-	server.WriteError(w, err)
+	apierror.WriteError(w, err)
 }
 
 func writeServiceTimingHeader(queryResponseTime time.Duration, headers http.Header, stats *querier_stats.Stats) {
@@ -248,6 +328,40 @@ func writeServiceTimingHeader(queryResponseTime time.Duration, headers http.Head
 	}
 }
 
+// queryStatsHeaderEnabled returns whether the query stats header is enabled for all the tenants of the request.
+func (f *Handler) queryStatsHeaderEnabled(ctx context.Context) bool {
+	if f.limits == nil {
+		return false
+	}
+
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return false
+	}
+	for _, tenantID := range tenantIDs {
+		if !f.limits.QueryStatsHeaderEnabled(tenantID) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeQueryStatsHeader(headers http.Header, stats *querier_stats.Stats) {
+	if stats == nil {
+		return
+	}
+
+	parts := []string{
+		"wall_time_seconds=" + strconv.FormatFloat(stats.LoadWallTime().Seconds(), 'f', -1, 64),
+		"fetched_series_count=" + strconv.FormatUint(stats.LoadFetchedSeries(), 10),
+		"fetched_chunks_count=" + strconv.FormatUint(stats.LoadFetchedChunks(), 10),
+		"fetched_chunks_bytes=" + strconv.FormatUint(stats.LoadFetchedChunkBytes(), 10),
+		"ingester_wall_time_seconds=" + strconv.FormatFloat(stats.LoadIngesterWallTime().Seconds(), 'f', -1, 64),
+		"store_gateway_wall_time_seconds=" + strconv.FormatFloat(stats.LoadStoreGatewayWallTime().Seconds(), 'f', -1, 64),
+	}
+	headers.Set(QueryStatsHeaderName, strings.Join(parts, ", "))
+}
+
 func statsValue(name string, d time.Duration) string {
 	durationInMs := strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
 	return name + ";dur=" + durationInMs
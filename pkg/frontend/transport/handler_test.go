@@ -2,11 +2,14 @@ package transport
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
@@ -16,6 +19,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/user"
+
+	querier_stats "github.com/cortexproject/cortex/pkg/querier/stats"
+	"github.com/cortexproject/cortex/pkg/util/apierror"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 type roundTripperFunc func(*http.Request) (*http.Response, error)
@@ -26,18 +33,75 @@ func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
 
 func TestWriteError(t *testing.T) {
 	for _, test := range []struct {
-		status int
-		err    error
+		status    int
+		errorType apierror.Type
+		message   string
+		err       error
 	}{
-		{http.StatusInternalServerError, errors.New("unknown")},
-		{http.StatusGatewayTimeout, context.DeadlineExceeded},
-		{StatusClientClosedRequest, context.Canceled},
-		{http.StatusBadRequest, httpgrpc.Errorf(http.StatusBadRequest, "")},
+		{http.StatusInternalServerError, apierror.TypeInternal, "unknown", errors.New("unknown")},
+		{http.StatusGatewayTimeout, apierror.TypeTimeout, "context deadline exceeded", context.DeadlineExceeded},
+		{StatusClientClosedRequest, apierror.TypeCanceled, "context canceled", context.Canceled},
+		{http.StatusBadRequest, apierror.TypeBadData, "", httpgrpc.Errorf(http.StatusBadRequest, "")},
+		{http.StatusTooManyRequests, apierror.TypeTooManyRequests, "too many outstanding requests", httpgrpc.Errorf(http.StatusTooManyRequests, "too many outstanding requests")},
+		{http.StatusUnprocessableEntity, apierror.TypeLimitExceeded, "the query hit the max number of series limit", validation.LimitError("the query hit the max number of series limit")},
 	} {
 		t.Run(test.err.Error(), func(t *testing.T) {
 			w := httptest.NewRecorder()
 			writeError(w, test.err)
 			require.Equal(t, test.status, w.Result().StatusCode)
+			require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			require.JSONEq(t, fmt.Sprintf(`{"status":"error","errorType":%q,"error":%q}`, test.errorType, test.message), w.Body.String())
+		})
+	}
+}
+
+func TestHandler_ServeHTTP_ShouldNormalizeErrorResponses(t *testing.T) {
+	for name, tt := range map[string]struct {
+		status       int
+		body         string
+		expectedBody string
+	}{
+		"plain text error": {
+			status:       http.StatusBadRequest,
+			body:         "invalid parameter \"query\"\n",
+			expectedBody: `{"status":"error","errorType":"bad_data","error":"invalid parameter \"query\""}`,
+		},
+		"prometheus error": {
+			status:       http.StatusUnprocessableEntity,
+			body:         `{"status":"error","errorType":"execution","error":"query processing would load too many samples"}`,
+			expectedBody: `{"status":"error","errorType":"execution","error":"query processing would load too many samples"}`,
+		},
+		"typed error": {
+			status:       http.StatusUnprocessableEntity,
+			body:         `{"status":"error","errorType":"limit_exceeded","error":"the query time range exceeds the limit"}`,
+			expectedBody: `{"status":"error","errorType":"limit_exceeded","error":"the query time range exceeds the limit"}`,
+		},
+		"unavailable": {
+			status:       http.StatusServiceUnavailable,
+			body:         "no healthy querier",
+			expectedBody: `{"status":"error","errorType":"unavailable","error":"no healthy querier"}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			roundTripper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: tt.status,
+					Header:     http.Header{"Content-Type": []string{"text/plain"}, "Content-Length": []string{strconv.Itoa(len(tt.body))}},
+					Body:       io.NopCloser(strings.NewReader(tt.body)),
+				}, nil
+			})
+
+			handler := NewHandler(HandlerConfig{}, roundTripper, nil, log.NewNopLogger(), nil)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(user.InjectOrgID(context.Background(), "12345"))
+			resp := httptest.NewRecorder()
+
+			handler.ServeHTTP(resp, req)
+			require.Equal(t, tt.status, resp.Code)
+			require.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+			require.Empty(t, resp.Header().Get("Content-Length"))
+			require.JSONEq(t, tt.expectedBody, resp.Body.String())
 		})
 	}
 }
@@ -68,7 +132,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			})
 
 			reg := prometheus.NewPedanticRegistry()
-			handler := NewHandler(tt.cfg, roundTripper, log.NewNopLogger(), reg)
+			handler := NewHandler(tt.cfg, roundTripper, nil, log.NewNopLogger(), reg)
 
 			ctx := user.InjectOrgID(context.Background(), "12345")
 			req := httptest.NewRequest("GET", "/", nil)
@@ -91,3 +155,72 @@ func TestHandler_ServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_ServeHTTP_QueryStatsHeader(t *testing.T) {
+	for name, tt := range map[string]struct {
+		headerEnabled  map[string]bool
+		tenantID       string
+		expectedHeader string
+	}{
+		"header enabled for the tenant": {
+			headerEnabled:  map[string]bool{"user-1": true},
+			tenantID:       "user-1",
+			expectedHeader: "wall_time_seconds=2, fetched_series_count=3, fetched_chunks_count=4, fetched_chunks_bytes=100, ingester_wall_time_seconds=0.5, store_gateway_wall_time_seconds=1.5",
+		},
+		"header disabled for the tenant": {
+			headerEnabled:  map[string]bool{"user-1": true},
+			tenantID:       "user-2",
+			expectedHeader: "",
+		},
+		"header enabled only for some of the tenants": {
+			headerEnabled:  map[string]bool{"user-1": true},
+			tenantID:       "user-1|user-2",
+			expectedHeader: "",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			roundTripper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				stats := querier_stats.FromContext(req.Context())
+				stats.AddWallTime(2 * time.Second)
+				stats.AddFetchedSeries(3)
+				stats.AddFetchedChunks(4)
+				stats.AddFetchedChunkBytes(100)
+				stats.AddIngesterWallTime(500 * time.Millisecond)
+				stats.AddStoreGatewayWallTime(1500 * time.Millisecond)
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader("{}")),
+				}, nil
+			})
+
+			handler := NewHandler(HandlerConfig{QueryStatsEnabled: true}, roundTripper, mockLimits(tt.headerEnabled), log.NewNopLogger(), nil)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(user.InjectOrgID(context.Background(), tt.tenantID))
+			resp := httptest.NewRecorder()
+
+			handler.ServeHTTP(resp, req)
+			require.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tt.expectedHeader, resp.Header().Get(QueryStatsHeaderName))
+		})
+	}
+}
+
+type mockLimits map[string]bool
+
+func (m mockLimits) QueryStatsHeaderEnabled(userID string) bool {
+	return m[userID]
+}
+
+func (m mockLimits) QueryAuditSampleRatio(string) float64 {
+	return 0
+}
+
+func (m mockLimits) QueryAuditWebhookURL(string) string {
+	return ""
+}
+
+func (m mockLimits) QueryAuditFields(string) []string {
+	return nil
+}
@@ -0,0 +1,327 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	querier_stats "github.com/cortexproject/cortex/pkg/querier/stats"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+var errInvalidQueryAuditConfig = errors.New("invalid query audit config, the queue size, the batch size, the concurrency and the flush period must be greater than 0")
+
+// QueryAuditConfig configures the client posting the sampled query audit records to the
+// per-tenant webhooks.
+type QueryAuditConfig struct {
+	Enabled     bool                      `yaml:"enabled"`
+	QueueSize   int                       `yaml:"queue_size"`
+	BatchSize   int                       `yaml:"batch_size"`
+	FlushPeriod time.Duration             `yaml:"flush_period"`
+	Concurrency int                       `yaml:"concurrency"`
+	Timeout     time.Duration             `yaml:"timeout"`
+	Backoff     backoff.Config            `yaml:"backoff"`
+	Headers     map[string]flagext.Secret `yaml:"headers" doc:"nocli|description=Static headers added to the webhook requests, e.g. the authorization header."`
+}
+
+// RegisterFlagsWithPrefix registers flags with prefix.
+func (cfg *QueryAuditConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, prefix+"enabled", false, "Enable the posting of the sampled query audit records to the webhooks configured in the per-tenant limits.")
+	f.IntVar(&cfg.QueueSize, prefix+"queue-size", 10000, "Max number of query audit records queued to be posted to the webhooks. The records of the queries completed while the queue is full are dropped.")
+	f.IntVar(&cfg.BatchSize, prefix+"batch-size", 100, "Max number of query audit records posted to a webhook in a single request.")
+	f.DurationVar(&cfg.FlushPeriod, prefix+"flush-period", 5*time.Second, "Period at which the query audit records are posted to the webhooks, even if the batches are not full.")
+	f.IntVar(&cfg.Concurrency, prefix+"concurrency", 2, "Max number of concurrent requests to the webhooks.")
+	f.DurationVar(&cfg.Timeout, prefix+"timeout", 10*time.Second, "Timeout of the requests to the webhooks.")
+	cfg.Backoff.RegisterFlagsWithPrefix(prefix+"webhook", f)
+}
+
+// Validate the config and returns an error if the validation doesn't pass.
+func (cfg *QueryAuditConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.QueueSize <= 0 || cfg.BatchSize <= 0 || cfg.Concurrency <= 0 || cfg.FlushPeriod <= 0 {
+		return errInvalidQueryAuditConfig
+	}
+	return nil
+}
+
+// queryAuditEntry is a query audit record to post to the webhook of a tenant.
+type queryAuditEntry struct {
+	userID     string
+	webhookURL string
+	record     map[string]interface{}
+}
+
+// queryAuditTarget is a tenant whose query has been sampled for the audit.
+type queryAuditTarget struct {
+	userID     string
+	webhookURL string
+	fields     []string
+}
+
+// queryAuditor posts the audit records of a sample of the tenants' queries to their webhooks.
+// The records are posted asynchronously and in batches, and they're dropped if the queue is
+// full, so that the webhooks never delay the query responses.
+type queryAuditor struct {
+	services.Service
+
+	cfg     QueryAuditConfig
+	limits  Limits
+	logger  log.Logger
+	client  *http.Client
+	queue   chan queryAuditEntry
+	batches chan []queryAuditEntry
+
+	sent    *prometheus.CounterVec
+	failed  *prometheus.CounterVec
+	dropped *prometheus.CounterVec
+}
+
+func newQueryAuditor(cfg QueryAuditConfig, limits Limits, logger log.Logger, reg prometheus.Registerer) *queryAuditor {
+	a := &queryAuditor{
+		cfg:     cfg,
+		limits:  limits,
+		logger:  logger,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		queue:   make(chan queryAuditEntry, cfg.QueueSize),
+		batches: make(chan []queryAuditEntry),
+
+		sent: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "query_frontend_query_audit_records_sent_total",
+			Help:      "The total number of query audit records successfully posted to the webhook.",
+		}, []string{"user"}),
+		failed: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "query_frontend_query_audit_records_failed_total",
+			Help:      "The total number of query audit records which failed to be posted to the webhook, after the retries.",
+		}, []string{"user"}),
+		dropped: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Namespace: "cortex",
+			Name:      "query_frontend_query_audit_records_dropped_total",
+			Help:      "The total number of query audit records not posted to the webhook because the queue was full.",
+		}, []string{"user"}),
+	}
+
+	a.Service = services.NewBasicService(nil, a.running, nil)
+	return a
+}
+
+// sample returns the tenants whose query is audited, according to their sample ratio.
+func (a *queryAuditor) sample(userIDs []string) []queryAuditTarget {
+	var targets []queryAuditTarget
+	for _, userID := range userIDs {
+		webhookURL := a.limits.QueryAuditWebhookURL(userID)
+		ratio := a.limits.QueryAuditSampleRatio(userID)
+		if webhookURL == "" || ratio <= 0 || (ratio < 1 && rand.Float64() >= ratio) {
+			continue
+		}
+		targets = append(targets, queryAuditTarget{userID: userID, webhookURL: webhookURL, fields: a.limits.QueryAuditFields(userID)})
+	}
+	return targets
+}
+
+// add queues the audit record of the query for each of the targets. It never blocks: the
+// records are dropped if the queue is full.
+func (a *queryAuditor) add(targets []queryAuditTarget, orgID string, r *http.Request, queryString url.Values, queryResponseTime time.Duration, status int, stats *querier_stats.Stats) {
+	now := time.Now()
+
+	for _, target := range targets {
+		record := newQueryAuditRecord(target.fields, orgID, r, queryString, queryResponseTime, status, stats)
+		record["timestamp"] = now
+
+		select {
+		case a.queue <- queryAuditEntry{userID: target.userID, webhookURL: target.webhookURL, record: record}:
+		default:
+			a.dropped.WithLabelValues(target.userID).Inc()
+		}
+	}
+}
+
+// newQueryAuditRecord returns the audit record of the query with the fields in input, or all
+// the fields if empty.
+func newQueryAuditRecord(fields []string, orgID string, r *http.Request, queryString url.Values, queryResponseTime time.Duration, status int, stats *querier_stats.Stats) map[string]interface{} {
+	include := func(field string) bool {
+		return len(fields) == 0 || util.StringsContain(fields, field)
+	}
+
+	record := map[string]interface{}{}
+	if include(validation.QueryAuditFieldTenant) {
+		record["tenant"] = orgID
+	}
+	if include(validation.QueryAuditFieldQuery) {
+		record["path"] = r.URL.Path
+		record["query"] = queryString.Get("query")
+	}
+	if include(validation.QueryAuditFieldRange) {
+		for _, param := range []string{"start", "end", "step", "time"} {
+			if v := queryString.Get(param); v != "" {
+				record[param] = v
+			}
+		}
+	}
+	if include(validation.QueryAuditFieldDuration) {
+		record["duration_seconds"] = queryResponseTime.Seconds()
+	}
+	if include(validation.QueryAuditFieldStatus) {
+		record["status"] = status
+	}
+	if include(validation.QueryAuditFieldFetchedSeries) {
+		record["fetched_series"] = stats.LoadFetchedSeries()
+	}
+	return record
+}
+
+func (a *queryAuditor) running(ctx context.Context) error {
+	wg := sync.WaitGroup{}
+	wg.Add(a.cfg.Concurrency)
+
+	for i := 0; i < a.cfg.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case batch := <-a.batches:
+					a.send(ctx, batch)
+				}
+			}
+		}()
+	}
+
+	a.batch(ctx)
+	wg.Wait()
+	return nil
+}
+
+// batch groups the queued records by webhook, and hands the batches over to the senders once
+// full or at the flush period.
+func (a *queryAuditor) batch(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.FlushPeriod)
+	defer ticker.Stop()
+
+	pending := map[string][]queryAuditEntry{}
+	flush := func(webhookURL string) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case a.batches <- pending[webhookURL]:
+			delete(pending, webhookURL)
+			return true
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry := <-a.queue:
+			pending[entry.webhookURL] = append(pending[entry.webhookURL], entry)
+			if len(pending[entry.webhookURL]) >= a.cfg.BatchSize && !flush(entry.webhookURL) {
+				return
+			}
+		case <-ticker.C:
+			for webhookURL := range pending {
+				if !flush(webhookURL) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// send posts the batch to its webhook.
+func (a *queryAuditor) send(ctx context.Context, batch []queryAuditEntry) {
+	webhookURL := batch[0].webhookURL
+
+	records := make([]map[string]interface{}, 0, len(batch))
+	for _, entry := range batch {
+		records = append(records, entry.record)
+	}
+
+	body, err := json.Marshal(records)
+	if err == nil {
+		err = a.postWithRetries(ctx, webhookURL, body)
+	}
+
+	for _, entry := range batch {
+		if err != nil {
+			a.failed.WithLabelValues(entry.userID).Inc()
+		} else {
+			a.sent.WithLabelValues(entry.userID).Inc()
+		}
+	}
+	if err != nil {
+		level.Warn(a.logger).Log("msg", "failed to post the query audit records to the webhook", "webhook", webhookURL, "records", len(batch), "err", err)
+	}
+}
+
+// postWithRetries posts the encoded records to the webhook, retrying on the network errors and
+// the 5xx and 429 responses.
+func (a *queryAuditor) postWithRetries(ctx context.Context, webhookURL string, body []byte) error {
+	var lastErr error
+
+	retries := backoff.New(ctx, a.cfg.Backoff)
+	for retries.Ongoing() {
+		retryable, err := a.post(ctx, webhookURL, body)
+		if err == nil || !retryable {
+			return err
+		}
+
+		lastErr = err
+		retries.Wait()
+	}
+
+	if lastErr != nil {
+		return lastErr
+	}
+	return retries.Err()
+}
+
+// post posts the encoded records to the webhook, and returns whether the request can be retried
+// on failure.
+func (a *queryAuditor) post(ctx context.Context, webhookURL string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range a.cfg.Headers {
+		req.Header.Set(name, value.Value)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	querier_stats "github.com/cortexproject/cortex/pkg/querier/stats"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/test"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestHandler_ServeHTTP_QueryAudit(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		records []map[string]interface{}
+	)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var batch []map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		assert.LessOrEqual(t, len(batch), 2)
+
+		mtx.Lock()
+		records = append(records, batch...)
+		mtx.Unlock()
+	}))
+	defer webhook.Close()
+
+	cfg := HandlerConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.QueryAudit.Enabled = true
+	cfg.QueryAudit.BatchSize = 2
+	cfg.QueryAudit.FlushPeriod = 100 * time.Millisecond
+	cfg.QueryAudit.Headers = map[string]flagext.Secret{"Authorization": {Value: "Bearer token"}}
+
+	limits := mockQueryAuditLimits{
+		"user-1": {QueryAuditSampleRatio: 1, QueryAuditWebhookURL: webhook.URL},
+		"user-2": {QueryAuditSampleRatio: 0, QueryAuditWebhookURL: webhook.URL},
+	}
+
+	roundTripper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		querier_stats.FromContext(req.Context()).AddFetchedSeries(3)
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("{}")),
+		}, nil
+	})
+
+	handler := NewHandler(cfg, roundTripper, limits, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	defer services.StopAndAwaitTerminated(context.Background(), handler.(*Handler).auditor) //nolint:errcheck
+
+	for _, userID := range []string{"user-1", "user-1", "user-2", "user-1"} {
+		req := httptest.NewRequest("GET", "/api/v1/query_range?query=up&start=10&end=20&step=5", nil)
+		req = req.WithContext(user.InjectOrgID(context.Background(), userID))
+		resp := httptest.NewRecorder()
+
+		handler.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// The first two records are posted once the batch is full, the third one at the flush period.
+	auditor := handler.(*Handler).auditor
+	test.Poll(t, 2*time.Second, float64(3), func() interface{} {
+		return promtest.ToFloat64(auditor.sent.WithLabelValues("user-1"))
+	})
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	record := records[0]
+	assert.Equal(t, "user-1", record["tenant"])
+	assert.Equal(t, "/api/v1/query_range", record["path"])
+	assert.Equal(t, "up", record["query"])
+	assert.Equal(t, "10", record["start"])
+	assert.Equal(t, "20", record["end"])
+	assert.Equal(t, "5", record["step"])
+	assert.Equal(t, float64(http.StatusOK), record["status"])
+	assert.Equal(t, float64(3), record["fetched_series"])
+	assert.Contains(t, record, "duration_seconds")
+	assert.Contains(t, record, "timestamp")
+
+	assert.Len(t, records, 3)
+	assert.Equal(t, float64(0), promtest.ToFloat64(auditor.dropped.WithLabelValues("user-1")))
+}
+
+func TestQueryAuditor_ShouldRetryOnServerErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		statusCodes      []int
+		expectedRequests int
+		expectedSent     bool
+	}{
+		"should retry on 5xx": {
+			statusCodes:      []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK},
+			expectedRequests: 3,
+			expectedSent:     true,
+		},
+		"should not retry on 4xx": {
+			statusCodes:      []int{http.StatusBadRequest, http.StatusOK},
+			expectedRequests: 1,
+			expectedSent:     false,
+		},
+		"should give up after the max retries": {
+			statusCodes:      []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			expectedRequests: 3,
+			expectedSent:     false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			requests := 0
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(ioutil.Discard, r.Body)
+				w.WriteHeader(tc.statusCodes[requests])
+				requests++
+			}))
+			defer webhook.Close()
+
+			cfg := HandlerConfig{}
+			flagext.DefaultValues(&cfg)
+			cfg.QueryAudit.Backoff.MinBackoff = time.Millisecond
+			cfg.QueryAudit.Backoff.MaxBackoff = time.Millisecond
+			cfg.QueryAudit.Backoff.MaxRetries = 3
+
+			reg := prometheus.NewPedanticRegistry()
+			a := newQueryAuditor(cfg.QueryAudit, mockQueryAuditLimits{}, log.NewNopLogger(), reg)
+			a.send(context.Background(), []queryAuditEntry{{userID: "user-1", webhookURL: webhook.URL, record: map[string]interface{}{"query": "up"}}})
+
+			assert.Equal(t, tc.expectedRequests, requests)
+			assert.Equal(t, tc.expectedSent, promtest.ToFloat64(a.sent.WithLabelValues("user-1")) == 1)
+			assert.Equal(t, !tc.expectedSent, promtest.ToFloat64(a.failed.WithLabelValues("user-1")) == 1)
+		})
+	}
+}
+
+func TestQueryAuditor_ShouldDropTheRecordsOnQueueOverflow(t *testing.T) {
+	cfg := HandlerConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.QueryAudit.QueueSize = 1
+
+	// The auditor isn't started, so that the queue isn't consumed.
+	a := newQueryAuditor(cfg.QueryAudit, mockQueryAuditLimits{}, log.NewNopLogger(), nil)
+	targets := []queryAuditTarget{{userID: "user-1", webhookURL: "http://localhost"}}
+	req := httptest.NewRequest("GET", "/api/v1/query?query=up", nil)
+
+	for i := 0; i < 3; i++ {
+		a.add(targets, "user-1", req, req.URL.Query(), time.Second, http.StatusOK, &querier_stats.Stats{})
+	}
+
+	assert.Len(t, a.queue, 1)
+	assert.Equal(t, float64(2), promtest.ToFloat64(a.dropped.WithLabelValues("user-1")))
+}
+
+func TestNewQueryAuditRecord(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/query", nil)
+	queryString := url.Values{"query": []string{"up"}, "time": []string{"10"}}
+	stats := &querier_stats.Stats{}
+	stats.AddFetchedSeries(3)
+
+	assert.Equal(t, map[string]interface{}{
+		"tenant":           "user-1",
+		"path":             "/api/v1/query",
+		"query":            "up",
+		"time":             "10",
+		"duration_seconds": float64(2),
+		"status":           http.StatusOK,
+		"fetched_series":   uint64(3),
+	}, newQueryAuditRecord(nil, "user-1", req, queryString, 2*time.Second, http.StatusOK, stats))
+
+	assert.Equal(t, map[string]interface{}{
+		"tenant": "user-1",
+		"status": http.StatusOK,
+	}, newQueryAuditRecord([]string{validation.QueryAuditFieldTenant, validation.QueryAuditFieldStatus}, "user-1", req, queryString, 2*time.Second, http.StatusOK, stats))
+}
+
+type mockQueryAuditLimits map[string]validation.Limits
+
+func (m mockQueryAuditLimits) QueryStatsHeaderEnabled(string) bool {
+	return false
+}
+
+func (m mockQueryAuditLimits) QueryAuditSampleRatio(userID string) float64 {
+	return m[userID].QueryAuditSampleRatio
+}
+
+func (m mockQueryAuditLimits) QueryAuditWebhookURL(userID string) string {
+	return m[userID].QueryAuditWebhookURL
+}
+
+func (m mockQueryAuditLimits) QueryAuditFields(userID string) []string {
+	return m[userID].QueryAuditFields
+}
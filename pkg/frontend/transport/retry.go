@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/util/grpcutil"
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+)
+
+// Outcomes of the retries of the queries failed by a querier.
+const (
+	retryOutcomeSuccess        = "success"
+	retryOutcomeQuerierFailure = "querier_failure"
+	retryOutcomeError          = "error"
+)
+
+// querierFailureRetry retries the queries which failed because the connection to the querier
+// executing them was lost, up to a maximum number of times. Only complete responses are returned
+// by the wrapped GrpcRoundTripper, so a retried query can't have returned partial results.
+type querierFailureRetry struct {
+	next       GrpcRoundTripper
+	maxRetries int
+	log        log.Logger
+
+	retriesTotal *prometheus.CounterVec
+}
+
+// NewQuerierFailureRetry wraps the GrpcRoundTripper to retry the queries failed by a querier up
+// to maxRetries times. The queries are not retried if maxRetries is not positive.
+func NewQuerierFailureRetry(next GrpcRoundTripper, maxRetries int, log log.Logger, reg prometheus.Registerer) GrpcRoundTripper {
+	return &querierFailureRetry{
+		next:       next,
+		maxRetries: maxRetries,
+		log:        log,
+		retriesTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_querier_failure_retries_total",
+			Help: "Total number of retries of the queries failed because the connection to the querier was lost, by outcome.",
+		}, []string{"outcome"}),
+	}
+}
+
+func (r *querierFailureRetry) RoundTripGRPC(ctx context.Context, req *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
+	resp, err := r.roundTrip(ctx, req)
+
+	for retry := 1; retry <= r.maxRetries && err == nil && grpcutil.IsQuerierFailure(resp); retry++ {
+		// The retries share the context of the query, and thus its deadline.
+		if ctx.Err() != nil {
+			break
+		}
+
+		level.Warn(util_log.WithContext(ctx, r.log)).Log("msg", "retrying query failed by a querier", "retry", retry, "err", string(resp.Body))
+
+		resp, err = r.roundTrip(ctx, req)
+		switch {
+		case err != nil:
+			r.retriesTotal.WithLabelValues(retryOutcomeError).Inc()
+		case grpcutil.IsQuerierFailure(resp):
+			r.retriesTotal.WithLabelValues(retryOutcomeQuerierFailure).Inc()
+		default:
+			r.retriesTotal.WithLabelValues(retryOutcomeSuccess).Inc()
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The marker of the querier failures is internal to Cortex.
+	if grpcutil.IsQuerierFailure(resp) {
+		headers := make([]*httpgrpc.Header, 0, len(resp.Headers))
+		for _, h := range resp.Headers {
+			if h.Key != grpcutil.QuerierFailureHeader {
+				headers = append(headers, h)
+			}
+		}
+		resp.Headers = headers
+	}
+	return resp, nil
+}
+
+// roundTrip sends a copy of the request, because the wrapped GrpcRoundTripper injects the
+// tracing headers into it.
+func (r *querierFailureRetry) roundTrip(ctx context.Context, req *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
+	attempt := *req
+	attempt.Headers = append([]*httpgrpc.Header(nil), req.Headers...)
+	return r.next.RoundTripGRPC(ctx, &attempt)
+}
@@ -0,0 +1,146 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/util/grpcutil"
+)
+
+type grpcRoundTripperFunc func(context.Context, *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error)
+
+func (f grpcRoundTripperFunc) RoundTripGRPC(ctx context.Context, req *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
+	return f(ctx, req)
+}
+
+func TestQuerierFailureRetry(t *testing.T) {
+	okResponse := &httpgrpc.HTTPResponse{Code: http.StatusOK, Body: []byte("ok")}
+	querierFailure := grpcutil.QuerierFailureResponse(errors.New("connection lost"))
+
+	tests := map[string]struct {
+		maxRetries       int
+		responses        []*httpgrpc.HTTPResponse
+		errs             []error
+		expectedCode     int32
+		expectedErr      bool
+		expectedAttempts int
+		expectedMetrics  string
+	}{
+		"should not retry a successful query": {
+			maxRetries:       2,
+			responses:        []*httpgrpc.HTTPResponse{okResponse},
+			expectedCode:     http.StatusOK,
+			expectedAttempts: 1,
+		},
+		"should retry a query failed by a querier": {
+			maxRetries:       2,
+			responses:        []*httpgrpc.HTTPResponse{querierFailure, okResponse},
+			expectedCode:     http.StatusOK,
+			expectedAttempts: 2,
+			expectedMetrics: `
+				# HELP cortex_query_frontend_querier_failure_retries_total Total number of retries of the queries failed because the connection to the querier was lost, by outcome.
+				# TYPE cortex_query_frontend_querier_failure_retries_total counter
+				cortex_query_frontend_querier_failure_retries_total{outcome="success"} 1
+			`,
+		},
+		"should stop retrying after the max retries": {
+			maxRetries:       2,
+			responses:        []*httpgrpc.HTTPResponse{querierFailure, querierFailure, querierFailure, okResponse},
+			expectedCode:     http.StatusInternalServerError,
+			expectedAttempts: 3,
+			expectedMetrics: `
+				# HELP cortex_query_frontend_querier_failure_retries_total Total number of retries of the queries failed because the connection to the querier was lost, by outcome.
+				# TYPE cortex_query_frontend_querier_failure_retries_total counter
+				cortex_query_frontend_querier_failure_retries_total{outcome="querier_failure"} 2
+			`,
+		},
+		"should stop retrying on error": {
+			maxRetries:       2,
+			responses:        []*httpgrpc.HTTPResponse{querierFailure, nil},
+			errs:             []error{nil, errors.New("queue full")},
+			expectedErr:      true,
+			expectedAttempts: 2,
+			expectedMetrics: `
+				# HELP cortex_query_frontend_querier_failure_retries_total Total number of retries of the queries failed because the connection to the querier was lost, by outcome.
+				# TYPE cortex_query_frontend_querier_failure_retries_total counter
+				cortex_query_frontend_querier_failure_retries_total{outcome="error"} 1
+			`,
+		},
+		"should not retry when disabled": {
+			maxRetries:       0,
+			responses:        []*httpgrpc.HTTPResponse{querierFailure, okResponse},
+			expectedCode:     http.StatusInternalServerError,
+			expectedAttempts: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			attempts := 0
+			next := grpcRoundTripperFunc(func(_ context.Context, req *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
+				// Mimic the injection of the tracing headers by the frontends.
+				req.Headers = append(req.Headers, &httpgrpc.Header{Key: "Uber-Trace-Id", Values: []string{"trace"}})
+
+				attempts++
+				var err error
+				if len(testData.errs) >= attempts {
+					err = testData.errs[attempts-1]
+				}
+				return copyResponse(testData.responses[attempts-1]), err
+			})
+
+			reg := prometheus.NewPedanticRegistry()
+			rt := NewQuerierFailureRetry(next, testData.maxRetries, log.NewNopLogger(), reg)
+
+			req := &httpgrpc.HTTPRequest{Method: "GET", Url: "/api/v1/query"}
+			resp, err := rt.RoundTripGRPC(context.Background(), req)
+			if testData.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, testData.expectedCode, resp.Code)
+				assert.False(t, grpcutil.IsQuerierFailure(resp))
+			}
+
+			assert.Equal(t, testData.expectedAttempts, attempts)
+			assert.Empty(t, req.Headers)
+			assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(testData.expectedMetrics), "cortex_query_frontend_querier_failure_retries_total"))
+		})
+	}
+}
+
+func TestQuerierFailureRetry_ShouldNotRetryAfterTheDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	next := grpcRoundTripperFunc(func(context.Context, *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
+		attempts++
+		cancel()
+		return grpcutil.QuerierFailureResponse(errors.New("connection lost")), nil
+	})
+
+	rt := NewQuerierFailureRetry(next, 2, log.NewNopLogger(), nil)
+	resp, err := rt.RoundTripGRPC(ctx, &httpgrpc.HTTPRequest{Method: "GET", Url: "/api/v1/query"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(http.StatusInternalServerError), resp.Code)
+	assert.Equal(t, 1, attempts)
+}
+
+func copyResponse(resp *httpgrpc.HTTPResponse) *httpgrpc.HTTPResponse {
+	if resp == nil {
+		return nil
+	}
+	c := *resp
+	c.Headers = append([]*httpgrpc.Header(nil), resp.Headers...)
+	return &c
+}
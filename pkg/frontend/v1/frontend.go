@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -25,10 +26,6 @@ import (
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
-var (
-	errTooManyRequest = httpgrpc.Errorf(http.StatusTooManyRequests, "too many outstanding requests")
-)
-
 // Config for a Frontend.
 type Config struct {
 	MaxOutstandingPerTenant int           `yaml:"max_outstanding_per_tenant"`
@@ -58,6 +55,10 @@ type Frontend struct {
 	requestQueue *queue.RequestQueue
 	activeUsers  *util.ActiveUsersCleanupService
 
+	// Requests queued or dispatched to a querier, reported by the debug state.
+	requestsMtx sync.Mutex
+	requests    map[*request]struct{}
+
 	// Subservices manager.
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
@@ -73,18 +74,23 @@ type request struct {
 	enqueueTime time.Time
 	queueSpan   opentracing.Span
 	originalCtx context.Context
+	userID      string
+
+	// Set once the request is dispatched to a querier, protected by Frontend.requestsMtx.
+	querierID    string
+	dispatchTime time.Time
 
 	request  *httpgrpc.HTTPRequest
-	err      chan error
 	response chan *httpgrpc.HTTPResponse
 }
 
 // New creates a new frontend. Frontend implements service, and must be started and stopped.
 func New(cfg Config, limits Limits, log log.Logger, registerer prometheus.Registerer) (*Frontend, error) {
 	f := &Frontend{
-		cfg:    cfg,
-		log:    log,
-		limits: limits,
+		cfg:      cfg,
+		log:      log,
+		limits:   limits,
+		requests: map[*request]struct{}{},
 		queueLength: promauto.With(registerer).NewGaugeVec(prometheus.GaugeOpts{
 			Name: "cortex_query_frontend_queue_length",
 			Help: "Number of queries in the queue.",
@@ -92,7 +98,7 @@ func New(cfg Config, limits Limits, log log.Logger, registerer prometheus.Regist
 		discardedRequests: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
 			Name: "cortex_query_frontend_discarded_requests_total",
 			Help: "Total number of query requests discarded.",
-		}, []string{"user"}),
+		}, []string{"user", "reason"}),
 		queueDuration: promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
 			Name:    "cortex_query_frontend_queue_duration_seconds",
 			Help:    "Time spend by requests queued.",
@@ -100,7 +106,7 @@ func New(cfg Config, limits Limits, log log.Logger, registerer prometheus.Regist
 		}),
 	}
 
-	f.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, f.queueLength, f.discardedRequests)
+	f.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, 0, f.queueLength, f.discardedRequests)
 	f.activeUsers = util.NewActiveUsersCleanupWithDefaultValues(f.cleanupInactiveUserMetrics)
 
 	var err error
@@ -146,7 +152,9 @@ func (f *Frontend) stopping(_ error) error {
 
 func (f *Frontend) cleanupInactiveUserMetrics(user string) {
 	f.queueLength.DeleteLabelValues(user)
-	f.discardedRequests.DeleteLabelValues(user)
+	if err := util.DeleteMatchingLabels(f.discardedRequests, map[string]string{"user": user}); err != nil {
+		level.Warn(f.log).Log("msg", "failed to remove cortex_query_frontend_discarded_requests_total metric for user", "user", user, "err", err)
+	}
 }
 
 // RoundTripGRPC round trips a proto (instead of a HTTP request).
@@ -168,23 +176,33 @@ func (f *Frontend) RoundTripGRPC(ctx context.Context, req *httpgrpc.HTTPRequest)
 		// Buffer of 1 to ensure response can be written by the server side
 		// of the Process stream, even if this goroutine goes away due to
 		// client context cancellation.
-		err:      make(chan error, 1),
 		response: make(chan *httpgrpc.HTTPResponse, 1),
 	}
 
 	if err := f.queueRequest(ctx, &request); err != nil {
+		var tooManyRequests *queue.TooManyRequestsError
+		if errors.As(err, &tooManyRequests) {
+			return grpcutil.TooManyRequestsResponse(tooManyRequests.RetryAfter), nil
+		}
 		return nil, err
 	}
 
+	f.requestsMtx.Lock()
+	f.requests[&request] = struct{}{}
+	f.requestsMtx.Unlock()
+
+	defer func() {
+		f.requestsMtx.Lock()
+		delete(f.requests, &request)
+		f.requestsMtx.Unlock()
+	}()
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 
 	case resp := <-request.response:
 		return resp, nil
-
-	case err := <-request.err:
-		return nil, err
 	}
 }
 
@@ -236,6 +254,11 @@ func (f *Frontend) Process(server frontendv1pb.Frontend_ProcessServer) error {
 			continue
 		}
 
+		f.requestsMtx.Lock()
+		req.querierID = querierID
+		req.dispatchTime = time.Now()
+		f.requestsMtx.Unlock()
+
 		// Handle the stream sending & receiving on a goroutine so we can
 		// monitoring the contexts in a select and cancel things appropriately.
 		resps := make(chan *frontendv1pb.ClientToFrontend, 1)
@@ -268,9 +291,10 @@ func (f *Frontend) Process(server frontendv1pb.Frontend_ProcessServer) error {
 			return req.originalCtx.Err()
 
 		// Is there was an error handling this request due to network IO,
-		// then error out this upstream request _and_ stream.
+		// then error out this upstream request _and_ stream. The upstream
+		// request is marked as failed by the querier, so that it can be retried.
 		case err := <-errs:
-			req.err <- err
+			req.response <- grpcutil.QuerierFailureResponse(err)
 			return err
 
 		// Happy path: merge the stats and propagate the response.
@@ -329,13 +353,10 @@ func (f *Frontend) queueRequest(ctx context.Context, req *request) error {
 	maxQueriers := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, f.limits.MaxQueriersPerUser)
 
 	joinedTenantID := tenant.JoinTenantIDs(tenantIDs)
+	req.userID = joinedTenantID
 	f.activeUsers.UpdateUserTimestamp(joinedTenantID, now)
 
-	err = f.requestQueue.EnqueueRequest(joinedTenantID, req, maxQueriers, nil)
-	if err == queue.ErrTooManyRequests {
-		return errTooManyRequest
-	}
-	return err
+	return f.requestQueue.EnqueueRequest(joinedTenantID, req, queue.DefaultPriority, maxQueriers, nil)
 }
 
 // CheckReady determines if the query frontend is ready.  Function parameters/return
@@ -351,3 +372,29 @@ func (f *Frontend) CheckReady(_ context.Context) error {
 	level.Info(f.log).Log("msg", msg)
 	return errors.New(msg)
 }
+
+// DebugStateHandler returns the snapshot of the queued and dispatched requests, and of the
+// connected querier workers.
+func (f *Frontend) DebugStateHandler(w http.ResponseWriter, r *http.Request) {
+	f.requestsMtx.Lock()
+	requests := make([]queue.DebugRequestState, 0, len(f.requests))
+	for req := range f.requests {
+		state := queue.DebugRequestState{
+			UserID:     req.userID,
+			Priority:   queue.DefaultPriority,
+			URL:        req.request.GetUrl(),
+			EnqueuedAt: req.enqueueTime,
+		}
+		if !req.dispatchTime.IsZero() {
+			dispatchTime := req.dispatchTime
+			state.DispatchedAt = &dispatchTime
+			state.Querier = req.querierID
+		}
+		requests = append(requests, state)
+	}
+	f.requestsMtx.Unlock()
+
+	state := queue.NewDebugState(requests, time.Now())
+	state.QuerierWorkers = f.requestQueue.GetQuerierWorkers()
+	queue.WriteDebugState(w, r, state)
+}
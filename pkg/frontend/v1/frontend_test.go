@@ -2,10 +2,12 @@ package v1
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -22,6 +24,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/uber/jaeger-client-go"
 	"github.com/uber/jaeger-client-go/config"
+	"github.com/weaveworks/common/httpgrpc"
 	httpgrpc_server "github.com/weaveworks/common/httpgrpc/server"
 	"github.com/weaveworks/common/middleware"
 	"github.com/weaveworks/common/user"
@@ -33,6 +36,7 @@ import (
 	querier_worker "github.com/cortexproject/cortex/pkg/querier/worker"
 	"github.com/cortexproject/cortex/pkg/scheduler/queue"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/test"
 )
 
 const (
@@ -128,9 +132,9 @@ func TestFrontendCheckReady(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			f := &Frontend{
 				log: log.NewNopLogger(),
-				requestQueue: queue.NewRequestQueue(5, 0,
+				requestQueue: queue.NewRequestQueue(5, 0, 0,
 					prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
-					prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+					prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user", "reason"}),
 				),
 			}
 			for i := 0; i < tt.connectedClients; i++ {
@@ -181,6 +185,129 @@ func TestFrontendCancel(t *testing.T) {
 	testFrontend(t, defaultFrontendConfig(), handler, test, true, nil, nil)
 }
 
+func TestFrontendDebugState(t *testing.T) {
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	check := func(addr string, frontend *Frontend) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/hello", addr), nil)
+		require.NoError(t, err)
+		err = user.InjectOrgIDIntoHTTPRequest(user.InjectOrgID(context.Background(), "1"), req)
+		require.NoError(t, err)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+		}()
+
+		getState := func() queue.DebugState {
+			w := httptest.NewRecorder()
+			frontend.DebugStateHandler(w, httptest.NewRequest("GET", "/frontend/debug/state", nil))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var state queue.DebugState
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+			return state
+		}
+
+		test.Poll(t, time.Second, []queue.DebugTenantState{{UserID: "1", Inflight: 1}}, func() interface{} {
+			return getState().Tenants
+		})
+
+		state := getState()
+		require.Len(t, state.QuerierWorkers, 1)
+		require.Len(t, state.Requests, 1)
+		require.Equal(t, "/hello", state.Requests[0].URL)
+		require.NotEmpty(t, state.Requests[0].Querier)
+		require.Contains(t, state.QuerierWorkers, state.Requests[0].Querier)
+		require.NotNil(t, state.Requests[0].DispatchedAt)
+
+		close(release)
+		<-done
+
+		require.Empty(t, getState().Requests)
+	}
+	testFrontend(t, defaultFrontendConfig(), handler, check, false, nil, nil)
+}
+
+func TestFrontendRetriesOnQuerierFailure(t *testing.T) {
+	v1, err := New(defaultFrontendConfig(), limits{}, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), v1))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), v1))
+	})
+
+	// localhost:0 prevents firewall warnings on Mac OS X.
+	grpcListen, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	grpcServer := grpc.NewServer()
+	t.Cleanup(grpcServer.Stop)
+	frontendv1pb.RegisterFrontendServer(grpcServer, v1)
+	go grpcServer.Serve(grpcListen) //nolint:errcheck
+
+	conn, err := grpc.Dial(grpcListen.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	// connectQuerier connects a fake querier, and returns the stream once the querier has received a query.
+	connectQuerier := func(ctx context.Context, querierID string) frontendv1pb.Frontend_ProcessClient {
+		stream, err := frontendv1pb.NewFrontendClient(conn).Process(ctx)
+		require.NoError(t, err)
+
+		msg, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, frontendv1pb.GET_ID, msg.Type)
+		require.NoError(t, stream.Send(&frontendv1pb.ClientToFrontend{ClientID: querierID}))
+		return stream
+	}
+
+	rt := transport.NewQuerierFailureRetry(v1, 1, log.NewNopLogger(), nil)
+	ctx, cancel := context.WithTimeout(user.InjectOrgID(context.Background(), "1"), 10*time.Second)
+	defer cancel()
+
+	type result struct {
+		resp *httpgrpc.HTTPResponse
+		err  error
+	}
+	results := make(chan result, 1)
+
+	// The first querier is killed while executing the query.
+	querierCtx, killQuerier := context.WithCancel(context.Background())
+	stream := connectQuerier(querierCtx, "querier-1")
+
+	go func() {
+		resp, err := rt.RoundTripGRPC(ctx, &httpgrpc.HTTPRequest{Method: "GET", Url: query})
+		results <- result{resp: resp, err: err}
+	}()
+
+	msg, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, frontendv1pb.HTTP_REQUEST, msg.Type)
+	killQuerier()
+
+	// The query is retried on the second querier.
+	stream = connectQuerier(context.Background(), "querier-2")
+	msg, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, frontendv1pb.HTTP_REQUEST, msg.Type)
+	assert.Equal(t, query, msg.HttpRequest.Url)
+	require.NoError(t, stream.Send(&frontendv1pb.ClientToFrontend{
+		HttpResponse: &httpgrpc.HTTPResponse{Code: http.StatusOK, Body: []byte(responseBody)},
+	}))
+
+	res := <-results
+	require.NoError(t, res.err)
+	assert.Equal(t, int32(http.StatusOK), res.resp.Code)
+	assert.Equal(t, responseBody, string(res.resp.Body))
+}
+
 func TestFrontendMetricsCleanup(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte("Hello World"))
@@ -267,7 +394,7 @@ func testFrontend(t *testing.T, config Config, handler http.Handler, test func(a
 	r.PathPrefix("/").Handler(middleware.Merge(
 		middleware.AuthenticateUser,
 		middleware.Tracer{},
-	).Wrap(transport.NewHandler(handlerCfg, rt, logger, nil)))
+	).Wrap(transport.NewHandler(handlerCfg, rt, nil, logger, nil)))
 
 	httpServer := http.Server{
 		Handler: r,
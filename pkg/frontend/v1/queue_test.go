@@ -3,6 +3,7 @@ package v1
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
 	"testing"
@@ -11,6 +12,9 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/grafana/dskit/services"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/user"
@@ -35,7 +39,6 @@ func setupFrontend(t *testing.T, config Config) (*Frontend, error) {
 func testReq(ctx context.Context, reqID, user string) *request {
 	return &request{
 		originalCtx: ctx,
-		err:         make(chan error, 1),
 		request: &httpgrpc.HTTPRequest{
 			// Good enough for testing.
 			Method: user,
@@ -169,3 +172,40 @@ func (p *processServerMock) SetTrailer(md metadata.MD)      {}
 func (p *processServerMock) Context() context.Context       { return p.ctx }
 func (p *processServerMock) SendMsg(m interface{}) error    { return nil }
 func (p *processServerMock) RecvMsg(m interface{}) error    { return nil }
+
+func TestFrontendShouldReturnTooManyRequestsWhenTheTenantQueueIsFull(t *testing.T) {
+	config := Config{}
+	flagext.DefaultValues(&config)
+	config.MaxOutstandingPerTenant = 1
+
+	reg := prometheus.NewPedanticRegistry()
+	f, err := New(config, limits{}, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), f))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), f))
+	})
+
+	// No querier is connected, so the queued request of the tenant is never dequeued.
+	ctx, cancel := context.WithCancel(user.InjectOrgID(context.Background(), "1"))
+	defer cancel()
+	require.NoError(t, f.queueRequest(ctx, testReq(ctx, "1", "1")))
+
+	resp, err := f.RoundTripGRPC(ctx, &httpgrpc.HTTPRequest{Method: "GET", Url: "/api/v1/query"})
+	require.NoError(t, err)
+	require.Equal(t, int32(http.StatusTooManyRequests), resp.Code)
+	require.Len(t, resp.Headers, 1)
+	assert.Equal(t, "Retry-After", resp.Headers[0].Key)
+	assert.Equal(t, []string{"60"}, resp.Headers[0].Values)
+
+	// The requests of the other tenants are unaffected.
+	otherCtx, otherCancel := context.WithCancel(user.InjectOrgID(context.Background(), "2"))
+	defer otherCancel()
+	require.NoError(t, f.queueRequest(otherCtx, testReq(otherCtx, "2", "2")))
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_discarded_requests_total Total number of query requests discarded.
+		# TYPE cortex_query_frontend_discarded_requests_total counter
+		cortex_query_frontend_discarded_requests_total{reason="too_many_outstanding_requests",user="1"} 1
+	`), "cortex_query_frontend_discarded_requests_total"))
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/frontend/v2/frontendv2pb"
 	"github.com/cortexproject/cortex/pkg/querier/stats"
+	"github.com/cortexproject/cortex/pkg/scheduler/queue"
 	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/cortexproject/cortex/pkg/util/grpcclient"
@@ -77,6 +78,11 @@ type frontendRequest struct {
 	request      *httpgrpc.HTTPRequest
 	userID       string
 	statsEnabled bool
+	enqueueTime  time.Time
+
+	// Set once the request is enqueued to a query-scheduler, protected by requestsInProgress.mu.
+	schedulerAddr string
+	dispatchTime  time.Time
 
 	cancel context.CancelFunc
 
@@ -98,6 +104,8 @@ type enqueueResult struct {
 	status enqueueStatus
 
 	cancelCh chan<- uint64 // Channel that can be used for request cancellation. If nil, cancellation is not possible.
+
+	schedulerAddr string // Address of the scheduler the request has been enqueued to, if any.
 }
 
 // NewFrontend creates a new frontend.
@@ -176,6 +184,7 @@ func (f *Frontend) RoundTripGRPC(ctx context.Context, req *httpgrpc.HTTPRequest)
 		request:      req,
 		userID:       userID,
 		statsEnabled: stats.IsEnabled(ctx),
+		enqueueTime:  time.Now(),
 
 		cancel: cancel,
 
@@ -208,6 +217,9 @@ enqueueAgain:
 	case enqRes := <-freq.enqueue:
 		if enqRes.status == waitForResponse {
 			cancelCh = enqRes.cancelCh
+			if enqRes.schedulerAddr != "" {
+				f.requests.markDispatched(freq.queryID, enqRes.schedulerAddr)
+			}
 			break // go wait for response.
 		} else if enqRes.status == failed {
 			retries--
@@ -279,6 +291,14 @@ func (f *Frontend) CheckReady(_ context.Context) error {
 	return errors.New(msg)
 }
 
+// DebugStateHandler returns the snapshot of the requests in progress, either waiting to be
+// enqueued to a query-scheduler, or enqueued to one.
+func (f *Frontend) DebugStateHandler(w http.ResponseWriter, r *http.Request) {
+	state := queue.NewDebugState(f.requests.debugState(), time.Now())
+	state.ConnectedSchedulers = f.schedulerWorkers.getWorkersCount()
+	queue.WriteDebugState(w, r, state)
+}
+
 type requestsInProgress struct {
 	mu       sync.Mutex
 	requests map[uint64]*frontendRequest
@@ -311,6 +331,39 @@ func (r *requestsInProgress) delete(queryID uint64) {
 	delete(r.requests, queryID)
 }
 
+func (r *requestsInProgress) markDispatched(queryID uint64, schedulerAddr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req := r.requests[queryID]; req != nil {
+		req.schedulerAddr = schedulerAddr
+		req.dispatchTime = time.Now()
+	}
+}
+
+// debugState returns the state of the requests in progress.
+func (r *requestsInProgress) debugState() []queue.DebugRequestState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	requests := make([]queue.DebugRequestState, 0, len(r.requests))
+	for _, req := range r.requests {
+		state := queue.DebugRequestState{
+			UserID:     req.userID,
+			QueryID:    req.queryID,
+			URL:        req.request.GetUrl(),
+			EnqueuedAt: req.enqueueTime,
+		}
+		if !req.dispatchTime.IsZero() {
+			dispatchTime := req.dispatchTime
+			state.DispatchedAt = &dispatchTime
+			state.Scheduler = req.schedulerAddr
+		}
+		requests = append(requests, state)
+	}
+	return requests
+}
+
 func (r *requestsInProgress) get(queryID uint64) *frontendRequest {
 	r.mu.Lock()
 	defer r.mu.Unlock()
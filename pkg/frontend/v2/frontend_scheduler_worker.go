@@ -17,6 +17,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/frontend/v2/frontendv2pb"
 	"github.com/cortexproject/cortex/pkg/scheduler/schedulerpb"
 	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/grpcutil"
 )
 
 type frontendSchedulerWorkers struct {
@@ -278,7 +279,7 @@ func (w *frontendSchedulerWorker) schedulerLoop(loop schedulerpb.SchedulerForFro
 
 			switch resp.Status {
 			case schedulerpb.OK:
-				req.enqueue <- enqueueResult{status: waitForResponse, cancelCh: w.cancelCh}
+				req.enqueue <- enqueueResult{status: waitForResponse, cancelCh: w.cancelCh, schedulerAddr: w.schedulerAddr}
 				// Response will come from querier.
 
 			case schedulerpb.SHUTTING_DOWN:
@@ -298,10 +299,7 @@ func (w *frontendSchedulerWorker) schedulerLoop(loop schedulerpb.SchedulerForFro
 			case schedulerpb.TOO_MANY_REQUESTS_PER_TENANT:
 				req.enqueue <- enqueueResult{status: waitForResponse}
 				req.response <- &frontendv2pb.QueryResultRequest{
-					HttpResponse: &httpgrpc.HTTPResponse{
-						Code: http.StatusTooManyRequests,
-						Body: []byte("too many outstanding requests"),
-					},
+					HttpResponse: grpcutil.TooManyRequestsResponse(time.Duration(resp.RetryAfterSeconds) * time.Second),
 				}
 			}
 
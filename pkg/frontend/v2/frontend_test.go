@@ -2,7 +2,10 @@ package v2
 
 import (
 	"context"
+	"encoding/json"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"sync"
@@ -19,6 +22,7 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/frontend/v2/frontendv2pb"
 	"github.com/cortexproject/cortex/pkg/querier/stats"
+	"github.com/cortexproject/cortex/pkg/scheduler/queue"
 	"github.com/cortexproject/cortex/pkg/scheduler/schedulerpb"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/cortexproject/cortex/pkg/util/test"
@@ -151,6 +155,27 @@ func TestFrontendEnqueueFailure(t *testing.T) {
 	require.True(t, strings.Contains(err.Error(), "failed to enqueue request"))
 }
 
+func TestFrontendTooManyRequests(t *testing.T) {
+	f, _ := setupFrontend(t, func(f *Frontend, msg *schedulerpb.FrontendToScheduler) *schedulerpb.SchedulerToFrontend {
+		if msg.UserID == "full" {
+			return &schedulerpb.SchedulerToFrontend{Status: schedulerpb.TOO_MANY_REQUESTS_PER_TENANT, RetryAfterSeconds: 5}
+		}
+
+		go sendResponseWithDelay(f, 100*time.Millisecond, msg.UserID, msg.QueryID, &httpgrpc.HTTPResponse{Code: 200})
+		return &schedulerpb.SchedulerToFrontend{Status: schedulerpb.OK}
+	})
+
+	resp, err := f.RoundTripGRPC(user.InjectOrgID(context.Background(), "full"), &httpgrpc.HTTPRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int32(http.StatusTooManyRequests), resp.Code)
+	require.Equal(t, []*httpgrpc.Header{{Key: "Retry-After", Values: []string{"5"}}}, resp.Headers)
+
+	// The requests of the other users are unaffected.
+	resp, err = f.RoundTripGRPC(user.InjectOrgID(context.Background(), "test"), &httpgrpc.HTTPRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int32(200), resp.Code)
+}
+
 func TestFrontendCancellation(t *testing.T) {
 	f, ms := setupFrontend(t, nil)
 
@@ -177,6 +202,49 @@ func TestFrontendCancellation(t *testing.T) {
 	})
 }
 
+func TestFrontendDebugState(t *testing.T) {
+	f, _ := setupFrontend(t, func(f *Frontend, msg *schedulerpb.FrontendToScheduler) *schedulerpb.SchedulerToFrontend {
+		// Enqueued, but no response is sent until the request is canceled.
+		return &schedulerpb.SchedulerToFrontend{Status: schedulerpb.OK}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = f.RoundTripGRPC(user.InjectOrgID(ctx, "test"), &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello"})
+	}()
+
+	getState := func() queue.DebugState {
+		w := httptest.NewRecorder()
+		f.DebugStateHandler(w, httptest.NewRequest("GET", "/frontend/debug/state", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var state queue.DebugState
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+		return state
+	}
+
+	test.Poll(t, time.Second, []queue.DebugTenantState{{UserID: "test", Inflight: 1}}, func() interface{} {
+		return getState().Tenants
+	})
+
+	state := getState()
+	require.Equal(t, 1, state.ConnectedSchedulers)
+	require.Len(t, state.Requests, 1)
+	require.Equal(t, "test", state.Requests[0].UserID)
+	require.Equal(t, "/hello", state.Requests[0].URL)
+	require.Equal(t, f.cfg.SchedulerAddress, state.Requests[0].Scheduler)
+	require.NotNil(t, state.Requests[0].DispatchedAt)
+
+	cancel()
+	<-done
+
+	state = getState()
+	require.Empty(t, state.Tenants)
+	require.Empty(t, state.Requests)
+}
+
 func TestFrontendFailedCancellation(t *testing.T) {
 	f, ms := setupFrontend(t, nil)
 
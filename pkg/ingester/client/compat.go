@@ -1,6 +1,7 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/prometheus/common/model"
@@ -9,6 +10,10 @@ import (
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 )
 
+// ErrLabelNamesMatchersNotSupported is returned when the label names are requested with matchers
+// but some of the ingesters don't support them, like during a rolling upgrade.
+var ErrLabelNamesMatchersNotSupported = errors.New("some ingesters don't support the label names matchers")
+
 // ToQueryRequest builds a QueryRequest proto.
 func ToQueryRequest(from, to model.Time, matchers []*labels.Matcher) (*QueryRequest, error) {
 	ms, err := toLabelMatchers(matchers)
@@ -118,6 +123,26 @@ func ToMetricsForLabelMatchersRequest(from, to model.Time, matchers []*labels.Ma
 	}, nil
 }
 
+// ToMetricsForLabelMatchersWithTimeRangeRequest builds a MetricsForLabelMatchersRequest proto
+// for the metrics matching any of the matchers sets, including their in-memory time range.
+func ToMetricsForLabelMatchersWithTimeRangeRequest(from, to model.Time, matchersSet ...[]*labels.Matcher) (*MetricsForLabelMatchersRequest, error) {
+	reqMatchersSet := make([]*LabelMatchers, 0, len(matchersSet))
+	for _, matchers := range matchersSet {
+		ms, err := toLabelMatchers(matchers)
+		if err != nil {
+			return nil, err
+		}
+		reqMatchersSet = append(reqMatchersSet, &LabelMatchers{Matchers: ms})
+	}
+
+	return &MetricsForLabelMatchersRequest{
+		StartTimestampMs: int64(from),
+		EndTimestampMs:   int64(to),
+		MatchersSet:      reqMatchersSet,
+		IncludeTimeRange: true,
+	}, nil
+}
+
 // FromMetricsForLabelMatchersRequest unpacks a MetricsForLabelMatchersRequest proto
 func FromMetricsForLabelMatchersRequest(req *MetricsForLabelMatchersRequest) (model.Time, model.Time, [][]*labels.Matcher, error) {
 	matchersSet := make([][]*labels.Matcher, 0, len(req.MatchersSet))
@@ -172,6 +197,35 @@ func FromLabelValuesRequest(req *LabelValuesRequest) (string, int64, int64, []*l
 	return req.LabelName, req.StartTimestampMs, req.EndTimestampMs, matchers, nil
 }
 
+// ToLabelNamesRequest builds a LabelNamesRequest proto
+func ToLabelNamesRequest(from, to model.Time, matchers []*labels.Matcher) (*LabelNamesRequest, error) {
+	ms, err := toLabelMatchers(matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LabelNamesRequest{
+		StartTimestampMs: int64(from),
+		EndTimestampMs:   int64(to),
+		Matchers:         &LabelMatchers{Matchers: ms},
+	}, nil
+}
+
+// FromLabelNamesRequest unpacks a LabelNamesRequest proto
+func FromLabelNamesRequest(req *LabelNamesRequest) (int64, int64, []*labels.Matcher, error) {
+	var err error
+	var matchers []*labels.Matcher
+
+	if req.Matchers != nil {
+		matchers, err = FromLabelMatchers(req.Matchers.Matchers)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+	}
+
+	return req.StartTimestampMs, req.EndTimestampMs, matchers, nil
+}
+
 func toLabelMatchers(matchers []*labels.Matcher) ([]*LabelMatcher, error) {
 	result := make([]*LabelMatcher, 0, len(matchers))
 	for _, matcher := range matchers {
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ConsistencyTokenHeaderName is the header of the push responses carrying the consistency token
+// of the push. The queries sending it back in the same header are guaranteed to see the pushed
+// samples.
+const ConsistencyTokenHeaderName = "X-Cortex-Consistency-Token"
+
+// DegradedConsistencyHeaderName is the header of the query responses computed with degraded
+// consistency, because the query didn't get the responses of all the ingesters its consistency
+// token waited for. Such responses may miss the pushed samples.
+const DegradedConsistencyHeaderName = "X-Cortex-Degraded-Consistency"
+
+// ConsistencyToken identifies a push to the ingesters, so that a query can wait for all the
+// ingesters which may have received it.
+type ConsistencyToken struct {
+	// MaxTimestampMs is the timestamp of the most recent sample of the push.
+	MaxTimestampMs int64
+
+	// RingHash is the hash of the ingesters ring at the time of the push.
+	RingHash uint32
+}
+
+// String returns the token as sent in the ConsistencyTokenHeaderName header.
+func (t ConsistencyToken) String() string {
+	return fmt.Sprintf("%d:%08x", t.MaxTimestampMs, t.RingHash)
+}
+
+// ParseConsistencyToken parses a token formatted by ConsistencyToken.String().
+func ParseConsistencyToken(s string) (ConsistencyToken, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return ConsistencyToken{}, fmt.Errorf("invalid consistency token %q", s)
+	}
+
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ConsistencyToken{}, fmt.Errorf("invalid consistency token %q: %w", s, err)
+	}
+	hash, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return ConsistencyToken{}, fmt.Errorf("invalid consistency token %q: %w", s, err)
+	}
+
+	return ConsistencyToken{MaxTimestampMs: ts, RingHash: uint32(hash)}, nil
+}
+
+// ConsistencyTokenRecorder records the consistency token of a successful push.
+type ConsistencyTokenRecorder func(ConsistencyToken)
+
+// DegradedConsistencyRecorder records that a query has been computed with degraded consistency.
+type DegradedConsistencyRecorder func()
+
+type consistencyContextKey int
+
+const (
+	consistencyTokenContextKey consistencyContextKey = iota
+	consistencyTokenRecorderContextKey
+	degradedConsistencyRecorderContextKey
+)
+
+// ContextWithConsistencyToken returns a context requesting the query to see the samples of
+// the push identified by the token.
+func ContextWithConsistencyToken(ctx context.Context, token ConsistencyToken) context.Context {
+	return context.WithValue(ctx, consistencyTokenContextKey, token)
+}
+
+// ConsistencyTokenFromContext returns the consistency token of the query, if any.
+func ConsistencyTokenFromContext(ctx context.Context) (ConsistencyToken, bool) {
+	token, ok := ctx.Value(consistencyTokenContextKey).(ConsistencyToken)
+	return token, ok
+}
+
+// ContextWithConsistencyTokenRecorder returns a context in which the consistency token of the
+// push is passed to the recorder, when the consistency tokens are enabled.
+func ContextWithConsistencyTokenRecorder(ctx context.Context, recorder ConsistencyTokenRecorder) context.Context {
+	return context.WithValue(ctx, consistencyTokenRecorderContextKey, recorder)
+}
+
+// ConsistencyTokenRecorderFromContext returns the consistency token recorder of the push, or
+// nil if the token isn't requested.
+func ConsistencyTokenRecorderFromContext(ctx context.Context) ConsistencyTokenRecorder {
+	recorder, _ := ctx.Value(consistencyTokenRecorderContextKey).(ConsistencyTokenRecorder)
+	return recorder
+}
+
+// ContextWithDegradedConsistencyRecorder returns a context in which the queries computed with
+// degraded consistency are reported to the recorder.
+func ContextWithDegradedConsistencyRecorder(ctx context.Context, recorder DegradedConsistencyRecorder) context.Context {
+	return context.WithValue(ctx, degradedConsistencyRecorderContextKey, recorder)
+}
+
+// DegradedConsistencyRecorderFromContext returns the degraded consistency recorder of the query,
+// or nil if there's none.
+func DegradedConsistencyRecorderFromContext(ctx context.Context) DegradedConsistencyRecorder {
+	recorder, _ := ctx.Value(degradedConsistencyRecorderContextKey).(DegradedConsistencyRecorder)
+	return recorder
+}
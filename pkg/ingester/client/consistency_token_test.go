@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsistencyToken(t *testing.T) {
+	token := ConsistencyToken{MaxTimestampMs: 1234, RingHash: 0xabc}
+	assert.Equal(t, "1234:00000abc", token.String())
+
+	parsed, err := ParseConsistencyToken(token.String())
+	require.NoError(t, err)
+	assert.Equal(t, token, parsed)
+
+	for _, invalid := range []string{"", "1234", "1234:", "abc:00000abc", "1234:xyz", "1234:100000000", "1:2:3"} {
+		_, err := ParseConsistencyToken(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	_, ok := ConsistencyTokenFromContext(context.Background())
+	assert.False(t, ok)
+
+	fromCtx, ok := ConsistencyTokenFromContext(ContextWithConsistencyToken(context.Background(), token))
+	assert.True(t, ok)
+	assert.Equal(t, token, fromCtx)
+}
@@ -17,6 +17,11 @@ func (m *IngesterServerMock) Push(ctx context.Context, r *cortexpb.WriteRequest)
 	return args.Get(0).(*cortexpb.WriteResponse), args.Error(1)
 }
 
+func (m *IngesterServerMock) PushStream(s Ingester_PushStreamServer) error {
+	args := m.Called(s)
+	return args.Error(0)
+}
+
 func (m *IngesterServerMock) Query(ctx context.Context, r *QueryRequest) (*QueryResponse, error) {
 	args := m.Called(ctx, r)
 	return args.Get(0).(*QueryResponse), args.Error(1)
@@ -66,3 +71,13 @@ func (m *IngesterServerMock) TransferChunks(s Ingester_TransferChunksServer) err
 	args := m.Called(s)
 	return args.Error(0)
 }
+
+func (m *IngesterServerMock) LocalTimeRange(ctx context.Context, r *LocalTimeRangeRequest) (*LocalTimeRangeResponse, error) {
+	args := m.Called(ctx, r)
+	return args.Get(0).(*LocalTimeRangeResponse), args.Error(1)
+}
+
+func (m *IngesterServerMock) LabelValuesCardinality(ctx context.Context, r *LabelValuesCardinalityRequest) (*LabelValuesCardinalityResponse, error) {
+	args := m.Called(ctx, r)
+	return args.Get(0).(*LabelValuesCardinalityResponse), args.Error(1)
+}
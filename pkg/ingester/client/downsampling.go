@@ -0,0 +1,305 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/value"
+)
+
+// DownsamplingFunction is the function used by the querier to reconstruct the value of a downsampled
+// sample from the aggregations of the raw samples in its step interval.
+type DownsamplingFunction string
+
+const (
+	DownsamplingLast DownsamplingFunction = "last"
+	DownsamplingMin  DownsamplingFunction = "min"
+	DownsamplingMax  DownsamplingFunction = "max"
+	DownsamplingAvg  DownsamplingFunction = "avg"
+)
+
+// ParseDownsamplingFunction parses a downsampling function.
+func ParseDownsamplingFunction(s string) (DownsamplingFunction, error) {
+	switch fn := DownsamplingFunction(s); fn {
+	case DownsamplingLast, DownsamplingMin, DownsamplingMax, DownsamplingAvg:
+		return fn, nil
+	default:
+		return "", fmt.Errorf("unknown downsampling function %q", s)
+	}
+}
+
+type downsamplingContextKey int
+
+const (
+	downsamplingFunctionContextKey downsamplingContextKey = iota
+	downsamplingStepContextKey
+)
+
+// ContextWithDownsamplingFunction returns a context signaling that the query can be served with
+// downsampled samples, reconstructed with the input function.
+func ContextWithDownsamplingFunction(ctx context.Context, fn DownsamplingFunction) context.Context {
+	return context.WithValue(ctx, downsamplingFunctionContextKey, fn)
+}
+
+// DownsamplingFunctionFromContext returns the downsampling function of the query, or an empty
+// function if the query can't be served with downsampled samples.
+func DownsamplingFunctionFromContext(ctx context.Context) DownsamplingFunction {
+	fn, _ := ctx.Value(downsamplingFunctionContextKey).(DownsamplingFunction)
+	return fn
+}
+
+// ContextWithDownsamplingStep returns a context requesting the ingesters to downsample the
+// series selected with it to one sample per step.
+func ContextWithDownsamplingStep(ctx context.Context, stepMs int64) context.Context {
+	return context.WithValue(ctx, downsamplingStepContextKey, stepMs)
+}
+
+// DownsamplingStepFromContext returns the downsampling step requested in the context, or 0 if
+// the series shouldn't be downsampled.
+func DownsamplingStepFromContext(ctx context.Context) int64 {
+	step, _ := ctx.Value(downsamplingStepContextKey).(int64)
+	return step
+}
+
+// DownsampledChunkEncoding is the encoding of the chunks of downsampled samples returned by the
+// ingesters. It doesn't overlap with the encodings of the chunk package.
+const DownsampledChunkEncoding = int32(255)
+
+// DownsampledSample holds the aggregations of the raw samples of a series in a step interval.
+// The step intervals are left-open and right-closed, and aligned to the multiples of the step.
+type DownsampledSample struct {
+	// TimestampMs is the timestamp of the last raw sample in the step interval.
+	TimestampMs int64
+	Last        float64
+
+	// The aggregations of the raw samples in the step interval, excluding the stale markers.
+	Count         uint64
+	Min, Max, Sum float64
+}
+
+// Value returns the value of the sample reconstructed with the input function. The value of a
+// sample whose raw samples are all stale markers is a stale marker.
+func (s DownsampledSample) Value(fn DownsamplingFunction) float64 {
+	if s.Count == 0 {
+		return s.Last
+	}
+
+	switch fn {
+	case DownsamplingMin:
+		return s.Min
+	case DownsamplingMax:
+		return s.Max
+	case DownsamplingAvg:
+		return s.Sum / float64(s.Count)
+	default:
+		return s.Last
+	}
+}
+
+// downsamplingIntervalEnd returns the end of the step interval containing the input timestamp.
+func downsamplingIntervalEnd(ts, stepMs int64) int64 {
+	end := ts - ts%stepMs
+	if ts%stepMs > 0 {
+		end += stepMs
+	}
+	return end
+}
+
+// Downsampler aggregates the raw samples of a series into one DownsampledSample per step interval.
+type Downsampler struct {
+	stepMs      int64
+	samples     []DownsampledSample
+	intervalEnd int64
+}
+
+// NewDownsampler makes a new Downsampler.
+func NewDownsampler(stepMs int64) *Downsampler {
+	return &Downsampler{stepMs: stepMs}
+}
+
+// Add adds a raw sample. The samples must be added in timestamp order.
+func (d *Downsampler) Add(ts int64, v float64) {
+	if end := downsamplingIntervalEnd(ts, d.stepMs); len(d.samples) == 0 || end != d.intervalEnd {
+		d.samples = append(d.samples, DownsampledSample{})
+		d.intervalEnd = end
+	}
+
+	s := &d.samples[len(d.samples)-1]
+	s.TimestampMs = ts
+	s.Last = v
+
+	if value.IsStaleNaN(v) {
+		return
+	}
+
+	// Follow the PromQL semantic of min/max_over_time(), where NaN is replaced by any other value.
+	if s.Count == 0 || v > s.Max || math.IsNaN(s.Max) {
+		s.Max = v
+	}
+	if s.Count == 0 || v < s.Min || math.IsNaN(s.Min) {
+		s.Min = v
+	}
+	s.Sum += v
+	s.Count++
+}
+
+// Samples returns the downsampled samples of the raw samples added so far.
+func (d *Downsampler) Samples() []DownsampledSample {
+	return d.samples
+}
+
+// Reset resets the downsampler, to aggregate the samples of another series.
+func (d *Downsampler) Reset() {
+	d.samples = d.samples[:0]
+}
+
+// EncodeDownsampledChunk encodes the input samples into a chunk.
+func EncodeDownsampledChunk(samples []DownsampledSample) Chunk {
+	buf := make([]byte, 0, binary.MaxVarintLen64+len(samples)*(2*binary.MaxVarintLen64+8))
+	buf = appendUvarint(buf, uint64(len(samples)))
+
+	prevTs := int64(0)
+	for _, s := range samples {
+		buf = appendVarint(buf, s.TimestampMs-prevTs)
+		buf = appendUvarint(buf, s.Count)
+		buf = appendFloat(buf, s.Last)
+		if s.Count > 0 {
+			buf = appendFloat(buf, s.Min)
+			buf = appendFloat(buf, s.Max)
+			buf = appendFloat(buf, s.Sum)
+		}
+		prevTs = s.TimestampMs
+	}
+
+	chunk := Chunk{Encoding: DownsampledChunkEncoding, Data: buf}
+	if len(samples) > 0 {
+		chunk.StartTimestampMs = samples[0].TimestampMs
+		chunk.EndTimestampMs = samples[len(samples)-1].TimestampMs
+	}
+	return chunk
+}
+
+var errInvalidDownsampledChunk = errors.New("invalid downsampled chunk")
+
+// DecodeDownsampledChunk decodes the samples of a chunk encoded with EncodeDownsampledChunk.
+func DecodeDownsampledChunk(chunk Chunk) ([]DownsampledSample, error) {
+	if chunk.Encoding != DownsampledChunkEncoding {
+		return nil, fmt.Errorf("unexpected encoding %d of downsampled chunk", chunk.Encoding)
+	}
+
+	buf := chunk.Data
+	n, buf, ok := readUvarint(buf)
+	if !ok || n > uint64(len(buf)) {
+		return nil, errInvalidDownsampledChunk
+	}
+
+	samples := make([]DownsampledSample, 0, n)
+	prevTs := int64(0)
+	for i := uint64(0); i < n; i++ {
+		var (
+			s     DownsampledSample
+			delta int64
+		)
+		if delta, buf, ok = readVarint(buf); !ok {
+			return nil, errInvalidDownsampledChunk
+		}
+		if s.Count, buf, ok = readUvarint(buf); !ok {
+			return nil, errInvalidDownsampledChunk
+		}
+		if s.Last, buf, ok = readFloat(buf); !ok {
+			return nil, errInvalidDownsampledChunk
+		}
+		if s.Count > 0 {
+			if s.Min, buf, ok = readFloat(buf); !ok {
+				return nil, errInvalidDownsampledChunk
+			}
+			if s.Max, buf, ok = readFloat(buf); !ok {
+				return nil, errInvalidDownsampledChunk
+			}
+			if s.Sum, buf, ok = readFloat(buf); !ok {
+				return nil, errInvalidDownsampledChunk
+			}
+		}
+
+		s.TimestampMs = prevTs + delta
+		prevTs = s.TimestampMs
+		samples = append(samples, s)
+	}
+
+	if len(buf) > 0 {
+		return nil, errInvalidDownsampledChunk
+	}
+	return samples, nil
+}
+
+// MergeDownsampledSamples merges the downsampled samples of the same series returned by different
+// ingesters. For each step interval, the sample aggregating more raw samples is kept, because the
+// ingesters may have missed some writes.
+func MergeDownsampledSamples(stepMs int64, a, b []DownsampledSample) []DownsampledSample {
+	merged := make([]DownsampledSample, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		endA := downsamplingIntervalEnd(a[0].TimestampMs, stepMs)
+		endB := downsamplingIntervalEnd(b[0].TimestampMs, stepMs)
+
+		switch {
+		case endA < endB:
+			merged = append(merged, a[0])
+			a = a[1:]
+		case endA > endB:
+			merged = append(merged, b[0])
+			b = b[1:]
+		default:
+			if b[0].Count > a[0].Count || (b[0].Count == a[0].Count && b[0].TimestampMs > a[0].TimestampMs) {
+				merged = append(merged, b[0])
+			} else {
+				merged = append(merged, a[0])
+			}
+			a, b = a[1:], b[1:]
+		}
+	}
+
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func appendFloat(buf []byte, v float64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+	return append(buf, b[:]...)
+}
+
+func readUvarint(buf []byte) (uint64, []byte, bool) {
+	v, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return 0, buf, false
+	}
+	return v, buf[n:], true
+}
+
+func readVarint(buf []byte) (int64, []byte, bool) {
+	v, n := binary.Varint(buf)
+	if n <= 0 {
+		return 0, buf, false
+	}
+	return v, buf[n:], true
+}
+
+func readFloat(buf []byte) (float64, []byte, bool) {
+	if len(buf) < 8 {
+		return 0, buf, false
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(buf)), buf[8:], true
+}
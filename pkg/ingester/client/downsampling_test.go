@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownsampler(t *testing.T) {
+	d := NewDownsampler(10)
+	d.Add(1, 5)
+	d.Add(5, 2)
+	d.Add(10, 8)
+	d.Add(11, 3)
+	d.Add(25, math.Float64frombits(value.StaleNaN))
+	d.Add(31, 4)
+	d.Add(32, math.Float64frombits(value.StaleNaN))
+
+	samples := d.Samples()
+	require.Len(t, samples, 4)
+
+	// The step intervals are left-open and right-closed: (0, 10], (10, 20], (20, 30], (30, 40].
+	assert.Equal(t, DownsampledSample{TimestampMs: 10, Last: 8, Count: 3, Min: 2, Max: 8, Sum: 15}, samples[0])
+	assert.Equal(t, DownsampledSample{TimestampMs: 11, Last: 3, Count: 1, Min: 3, Max: 3, Sum: 3}, samples[1])
+	assert.Equal(t, int64(25), samples[2].TimestampMs)
+	assert.Equal(t, uint64(0), samples[2].Count)
+	assert.True(t, value.IsStaleNaN(samples[2].Last))
+	assert.Equal(t, int64(32), samples[3].TimestampMs)
+	assert.Equal(t, uint64(1), samples[3].Count)
+	assert.True(t, value.IsStaleNaN(samples[3].Last))
+
+	assert.Equal(t, 8.0, samples[0].Value(DownsamplingLast))
+	assert.Equal(t, 2.0, samples[0].Value(DownsamplingMin))
+	assert.Equal(t, 8.0, samples[0].Value(DownsamplingMax))
+	assert.Equal(t, 5.0, samples[0].Value(DownsamplingAvg))
+	assert.True(t, value.IsStaleNaN(samples[2].Value(DownsamplingAvg)))
+	assert.Equal(t, 4.0, samples[3].Value(DownsamplingMax))
+
+	d.Reset()
+	assert.Empty(t, d.Samples())
+}
+
+func TestDownsampledChunk_EncodeDecode(t *testing.T) {
+	samples := []DownsampledSample{
+		{TimestampMs: 1000, Last: 8, Count: 3, Min: 2, Max: 8, Sum: 15},
+		{TimestampMs: 1500, Last: 3, Count: 1, Min: 3, Max: 3, Sum: 3},
+		{TimestampMs: 2900, Last: math.Float64frombits(value.StaleNaN)},
+		{TimestampMs: 3000, Last: -1.5, Count: 2, Min: -1.5, Max: math.Inf(1), Sum: math.Inf(1)},
+	}
+
+	chunk := EncodeDownsampledChunk(samples)
+	assert.Equal(t, DownsampledChunkEncoding, chunk.Encoding)
+	assert.Equal(t, int64(1000), chunk.StartTimestampMs)
+	assert.Equal(t, int64(3000), chunk.EndTimestampMs)
+
+	decoded, err := DecodeDownsampledChunk(chunk)
+	require.NoError(t, err)
+	require.Len(t, decoded, len(samples))
+	for i := range samples {
+		assert.Equal(t, samples[i].TimestampMs, decoded[i].TimestampMs)
+		assert.Equal(t, math.Float64bits(samples[i].Last), math.Float64bits(decoded[i].Last))
+		assert.Equal(t, samples[i].Count, decoded[i].Count)
+		assert.Equal(t, samples[i].Min, decoded[i].Min)
+		assert.Equal(t, samples[i].Max, decoded[i].Max)
+		assert.Equal(t, samples[i].Sum, decoded[i].Sum)
+	}
+
+	empty, err := DecodeDownsampledChunk(EncodeDownsampledChunk(nil))
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	_, err = DecodeDownsampledChunk(Chunk{Encoding: DownsampledChunkEncoding, Data: chunk.Data[:len(chunk.Data)-1]})
+	assert.Error(t, err)
+
+	_, err = DecodeDownsampledChunk(Chunk{Encoding: 1, Data: chunk.Data})
+	assert.Error(t, err)
+}
+
+func TestMergeDownsampledSamples(t *testing.T) {
+	a := []DownsampledSample{
+		{TimestampMs: 9, Last: 1, Count: 2},
+		{TimestampMs: 19, Last: 2, Count: 2},
+		{TimestampMs: 29, Last: 3, Count: 1},
+	}
+	b := []DownsampledSample{
+		{TimestampMs: 18, Last: 4, Count: 1},
+		{TimestampMs: 30, Last: 5, Count: 2},
+		{TimestampMs: 41, Last: 6, Count: 1},
+	}
+
+	assert.Equal(t, []DownsampledSample{
+		{TimestampMs: 9, Last: 1, Count: 2},
+		{TimestampMs: 19, Last: 2, Count: 2},
+		{TimestampMs: 30, Last: 5, Count: 2},
+		{TimestampMs: 41, Last: 6, Count: 1},
+	}, MergeDownsampledSamples(10, a, b))
+}
+
+func TestDownsamplingContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, DownsamplingFunction(""), DownsamplingFunctionFromContext(ctx))
+	assert.Equal(t, int64(0), DownsamplingStepFromContext(ctx))
+
+	ctx = ContextWithDownsamplingStep(ContextWithDownsamplingFunction(ctx, DownsamplingMax), 30000)
+	assert.Equal(t, DownsamplingMax, DownsamplingFunctionFromContext(ctx))
+	assert.Equal(t, int64(30000), DownsamplingStepFromContext(ctx))
+
+	fn, err := ParseDownsamplingFunction("avg")
+	require.NoError(t, err)
+	assert.Equal(t, DownsamplingAvg, fn)
+
+	_, err = ParseDownsamplingFunction("sum")
+	assert.Error(t, err)
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +21,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/value"
 	tsdb_record "github.com/prometheus/prometheus/tsdb/record"
 	"github.com/weaveworks/common/httpgrpc"
 	"go.uber.org/atomic"
@@ -27,10 +31,12 @@ import (
 	cortex_chunk "github.com/cortexproject/cortex/pkg/chunk"
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/querier/astmapper"
 	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/storage/tsdb"
 	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/extract"
 	logutil "github.com/cortexproject/cortex/pkg/util/log"
 	util_math "github.com/cortexproject/cortex/pkg/util/math"
 	"github.com/cortexproject/cortex/pkg/util/spanlogger"
@@ -75,8 +81,13 @@ type Config struct {
 	ConcurrentFlushes int           `yaml:"concurrent_flushes"`
 	SpreadFlushes     bool          `yaml:"spread_flushes"`
 
+	// Config for the chunks cache population on flush.
+	FlushChunkCacheWriteback bool `yaml:"flush_chunk_cache_writeback"`
+
 	// Config for metadata purging.
 	MetadataRetainPeriod time.Duration `yaml:"metadata_retain_period"`
+	// Period after the startup during which the metric metadata is not required.
+	MetricMetadataStartupGracePeriod time.Duration `yaml:"metric_metadata_startup_grace_period"`
 
 	RateUpdatePeriod time.Duration `yaml:"rate_update_period"`
 
@@ -96,11 +107,17 @@ type Config struct {
 	DistributorShardingStrategy string `yaml:"-"`
 	DistributorShardByAllLabels bool   `yaml:"-"`
 
+	// Injected at runtime and read from the compactor config, required to validate
+	// the per-tenant TSDB block ranges.
+	CompactorBlockRanges tsdb.DurationList `yaml:"-"`
+
 	DefaultLimits    InstanceLimits         `yaml:"instance_limits"`
 	InstanceLimitsFn func() *InstanceLimits `yaml:"-"`
 
 	IgnoreSeriesLimitForMetricNames string `yaml:"ignore_series_limit_for_metric_names"`
 
+	DirectPushEnabled bool `yaml:"direct_push_enabled"`
+
 	// For testing, you can override the address and ID of this ingester.
 	ingesterClientFactory func(addr string, cfg client.Config) (client.HealthAndIngesterClient, error)
 }
@@ -121,8 +138,10 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.ChunkAgeJitter, "ingester.chunk-age-jitter", 0, "Range of time to subtract from -ingester.max-chunk-age to spread out flushes")
 	f.IntVar(&cfg.ConcurrentFlushes, "ingester.concurrent-flushes", 50, "Number of concurrent goroutines flushing to dynamodb.")
 	f.BoolVar(&cfg.SpreadFlushes, "ingester.spread-flushes", true, "If true, spread series flushes across the whole period of -ingester.max-chunk-age.")
+	f.BoolVar(&cfg.FlushChunkCacheWriteback, "ingester.flush-chunk-cache-writeback", true, "If true, the flushed chunks are also written to the chunks cache, so that the queries of the recently flushed chunks don't miss the cache. The writes are done in the background when the chunks cache is memcached or redis, and dropped when its write-back buffer is full. The chunks cache is also used to deduplicate the chunks flushed by the replicas, which is less effective when disabled. This feature is supported only by the chunks storage.")
 
 	f.DurationVar(&cfg.MetadataRetainPeriod, "ingester.metadata-retain-period", 10*time.Minute, "Period at which metadata we have not seen will remain in memory before being deleted.")
+	f.DurationVar(&cfg.MetricMetadataStartupGracePeriod, "ingester.metric-metadata-startup-grace-period", 5*time.Minute, "Period after the ingester startup during which the samples of the metrics without metadata are accepted, even for the tenants requiring the metric metadata. The metadata is held in memory only, and this gives the clients the time to send it again.")
 
 	f.DurationVar(&cfg.RateUpdatePeriod, "ingester.rate-update-period", 15*time.Second, "Period with which to update the per-user ingestion rates.")
 	f.BoolVar(&cfg.ActiveSeriesMetricsEnabled, "ingester.active-series-metrics-enabled", true, "Enable tracking of active series and export them as metrics.")
@@ -136,6 +155,8 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.Int64Var(&cfg.DefaultLimits.MaxInflightPushRequests, "ingester.instance-limits.max-inflight-push-requests", 0, "Max inflight push requests that this ingester can handle (across all tenants). Additional requests will be rejected. 0 = unlimited.")
 
 	f.StringVar(&cfg.IgnoreSeriesLimitForMetricNames, "ingester.ignore-series-limit-for-metric-names", "", "Comma-separated list of metric names, for which -ingester.max-series-per-metric and -ingester.max-global-series-per-metric limits will be ignored. Does not affect max-series-per-user or max-global-series-per-metric limits.")
+
+	f.BoolVar(&cfg.DirectPushEnabled, "ingester.direct-push-enabled", false, "Enable the /ingester/direct-push endpoint, which accepts remote-write requests, runs the same validation and limits of the distributor, and appends the series to this ingester bypassing the ring. Supported only when running Cortex as a single process with -target=all and replication factor 1.")
 }
 
 func (cfg *Config) getIgnoreSeriesLimitForMetricNamesMap() map[string]struct{} {
@@ -184,6 +205,9 @@ type Ingester struct {
 	usersMetadataMtx sync.RWMutex
 	usersMetadata    map[string]*userMetricsMetadata
 
+	// Time at which the ingester started, to apply the metric metadata startup grace period.
+	startedAt time.Time
+
 	// One queue per flush thread.  Fingerprint is used to
 	// pick a queue.
 	flushQueues     []*util.PriorityQueue
@@ -320,6 +344,7 @@ func (i *Ingester) starting(ctx context.Context) error {
 	}
 
 	i.startFlushLoops()
+	i.startedAt = time.Now()
 
 	return nil
 }
@@ -539,9 +564,28 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 		}
 	}
 
+	now := time.Now()
+	requireMetadata := i.requireMetricMetadata(userID, now)
+	nanHandling := i.limits.NaNHandling(userID)
+
 	for _, ts := range req.Timeseries {
+		if requireMetadata {
+			if err := i.checkMetricMetadata(userID, ts.Labels, now); err != nil {
+				i.metrics.ingestedSamplesFail.Add(float64(len(ts.Samples)))
+				validation.DiscardedSamples.WithLabelValues(missingMetricMetadata, userID).Add(float64(len(ts.Samples)))
+				if firstPartialErr == nil {
+					firstPartialErr = err.(*validationError)
+				}
+				continue
+			}
+		}
+
 		seriesSamplesIngested := 0
 		for _, s := range ts.Samples {
+			if i.dropNaNSample(nanHandling, s.Value) {
+				continue
+			}
+
 			// append() copies the memory in `ts.Labels` except on the error path
 			err := i.append(ctx, userID, ts.Labels, model.Time(s.TimestampMs), model.SampleValue(s.Value), req.Source, record)
 			if err == nil {
@@ -583,6 +627,78 @@ func (i *Ingester) Push(ctx context.Context, req *cortexpb.WriteRequest) (*corte
 	return &cortexpb.WriteResponse{}, nil
 }
 
+// PushStream implements client.IngesterServer. The series of each message are appended as soon
+// as it's received, while the errors of the series failing validation are returned once the
+// client closes the stream.
+func (i *Ingester) PushStream(stream client.Ingester_PushStreamServer) error {
+	if !i.cfg.BlocksStorageEnabled {
+		// The distributor falls back to the unary Push.
+		return status.Error(codes.Unimplemented, "push stream is supported only by the blocks storage")
+	}
+
+	if err := i.checkRunning(); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Only the first error of each status code is returned, so that the response doesn't grow with
+	// the number of failing series of the stream.
+	resp := &client.PushStreamResponse{}
+	offset := 0
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+
+		numSeries := len(req.Timeseries)
+		err = i.pushStreamMessage(ctx, req, func(idx int, err error) {
+			code := int32(partialErrorCode(err))
+			for _, e := range resp.Errors {
+				if e.Code == code {
+					resp.DroppedErrors++
+					return
+				}
+			}
+
+			// The error is turned into a string, so it no longer references `req`.
+			resp.Errors = append(resp.Errors, client.PushStreamSeriesError{
+				SeriesIndex: uint32(offset + idx),
+				Code:        code,
+				Message:     wrapWithUser(err, userID).Error(),
+			})
+		})
+		if err != nil {
+			return err
+		}
+		offset += numSeries
+	}
+}
+
+func (i *Ingester) pushStreamMessage(ctx context.Context, req *cortexpb.WriteRequest, onSeriesError func(idx int, err error)) error {
+	// Each message is accounted as an in-flight push request.
+	inflight := i.inflightPushRequests.Inc()
+	defer i.inflightPushRequests.Dec()
+
+	gl := i.getInstanceLimits()
+	if gl != nil && gl.MaxInflightPushRequests > 0 {
+		if inflight > gl.MaxInflightPushRequests {
+			return errTooManyInflightPushRequests
+		}
+	}
+
+	_, err := i.v2PushWithSeriesErrors(ctx, req, onSeriesError)
+	return err
+}
+
 // NOTE: memory for `labels` is unsafe; anything retained beyond the
 // life of this function must be copied
 func (i *Ingester) append(ctx context.Context, userID string, labels labelPairs, timestamp model.Time, value model.SampleValue, source cortexpb.WriteRequest_SourceEnum, record *WALRecord) error {
@@ -707,6 +823,55 @@ func (i *Ingester) appendMetadata(userID string, m *cortexpb.MetricMetadata) err
 	return userMetadata.add(m.GetMetricFamilyName(), m)
 }
 
+// requireMetricMetadata returns whether the samples of the metrics without metadata must be rejected
+// for the tenant. The metadata is held in memory only, so it's not required until the startup grace
+// period has elapsed, to give the clients the time to send it again.
+func (i *Ingester) requireMetricMetadata(userID string, now time.Time) bool {
+	return i.limits.RequireMetricMetadata(userID) && now.Sub(i.startedAt) >= i.cfg.MetricMetadataStartupGracePeriod
+}
+
+// Types of the NaN samples dropped on ingestion.
+const (
+	droppedNaN         = "nan"
+	droppedStaleMarker = "stale"
+)
+
+// dropNaNSample returns whether the sample must be dropped according to the NaN handling of the
+// tenant, and tracks the dropped samples. The staleness markers are told apart from the other NaN
+// values by their bit pattern.
+func (i *Ingester) dropNaNSample(nanHandling string, v float64) bool {
+	if nanHandling == "" || nanHandling == validation.NaNHandlingKeep || !math.IsNaN(v) {
+		return false
+	}
+
+	if value.IsStaleNaN(v) {
+		i.metrics.droppedNaNSamples.WithLabelValues(droppedStaleMarker).Inc()
+		return true
+	}
+	if nanHandling == validation.NaNHandlingDropAll {
+		i.metrics.droppedNaNSamples.WithLabelValues(droppedNaN).Inc()
+		return true
+	}
+	return false
+}
+
+// checkMetricMetadata returns an error if no metadata has been received for the metric of the series,
+// and its grace period has elapsed. The series without a metric name are not checked.
+func (i *Ingester) checkMetricMetadata(userID string, lbls []cortexpb.LabelAdapter, now time.Time) error {
+	metric, err := extract.UnsafeMetricNameFromLabelAdapters(lbls)
+	if err != nil {
+		return nil
+	}
+
+	userMetadata := i.getOrCreateUserMetadata(userID)
+	if userMetadata.hasMetadataOrGracePeriod(metric, now, i.limits.MetricMetadataGracePeriod(userID)) {
+		return nil
+	}
+
+	return makeMetricValidationError(missingMetricMetadata, cortexpb.FromLabelAdaptersToLabels(lbls),
+		fmt.Errorf("no metadata has been received for metric %q, while the metric metadata is required to ingest its samples", metric))
+}
+
 func (i *Ingester) getOrCreateUserMetadata(userID string) *userMetricsMetadata {
 	userMetadata := i.getUserMetadata(userID)
 	if userMetadata != nil {
@@ -789,6 +954,10 @@ func (i *Ingester) Query(ctx context.Context, req *client.QueryRequest) (*client
 	if err != nil {
 		return nil, err
 	}
+	inShard, matchers, err := queryShardFilter(matchers)
+	if err != nil {
+		return nil, err
+	}
 
 	i.metrics.queries.Inc()
 
@@ -805,6 +974,10 @@ func (i *Ingester) Query(ctx context.Context, req *client.QueryRequest) (*client
 	numSeries, numSamples := 0, 0
 	maxSamplesPerQuery := i.limits.MaxSamplesPerQuery(userID)
 	err = state.forSeriesMatching(ctx, matchers, func(ctx context.Context, _ model.Fingerprint, series *memorySeries) error {
+		if !inShard(series.metric) {
+			return nil
+		}
+
 		values, err := series.samplesForRange(from, through)
 		if err != nil {
 			return err
@@ -854,6 +1027,10 @@ func (i *Ingester) QueryStream(req *client.QueryRequest, stream client.Ingester_
 	if err != nil {
 		return err
 	}
+	inShard, matchers, err := queryShardFilter(matchers)
+	if err != nil {
+		return err
+	}
 
 	i.metrics.queries.Inc()
 
@@ -874,6 +1051,10 @@ func (i *Ingester) QueryStream(req *client.QueryRequest, stream client.Ingester_
 	// that would involve locking all the series & sorting, so until we have
 	// a better solution in the ingesters I'd rather take the hit in the queriers.
 	err = state.forSeriesMatching(stream.Context(), matchers, func(ctx context.Context, _ model.Fingerprint, series *memorySeries) error {
+		if !inShard(series.metric) {
+			return nil
+		}
+
 		chunks := make([]*desc, 0, len(series.chunkDescs))
 		for _, chunk := range series.chunkDescs {
 			if !(chunk.FirstTime.After(through) || chunk.LastTime.Before(from)) {
@@ -921,6 +1102,20 @@ func (i *Ingester) QueryStream(req *client.QueryRequest, stream client.Ingester_
 	return err
 }
 
+// queryShardFilter extracts the vertical shard of the query selected by the matchers, if any, and
+// returns the matchers without it, along with the function telling whether a series belongs to it.
+// The series not belonging to the shard are filtered out before being sent to the querier.
+func queryShardFilter(matchers []*labels.Matcher) (func(labels.Labels) bool, []*labels.Matcher, error) {
+	shard, matchers, err := astmapper.QueryShardFromMatchers(matchers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if shard == nil {
+		return func(labels.Labels) bool { return true }, matchers, nil
+	}
+	return shard.ContainsSeries, matchers, nil
+}
+
 // Query implements service.IngesterServer
 func (i *Ingester) QueryExemplars(ctx context.Context, req *client.ExemplarQueryRequest) (*client.ExemplarQueryResponse, error) {
 	if !i.cfg.BlocksStorageEnabled {
@@ -971,11 +1166,36 @@ func (i *Ingester) LabelNames(ctx context.Context, req *client.LabelNamesRequest
 	if err != nil {
 		return nil, err
 	} else if !ok {
-		return &client.LabelNamesResponse{}, nil
+		return &client.LabelNamesResponse{MatchersApplied: true}, nil
+	}
+
+	// TODO Right now we ignore start and end.
+	_, _, matchers, err := client.FromLabelNamesRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &client.LabelNamesResponse{MatchersApplied: true}
+	if len(matchers) == 0 {
+		resp.LabelNames = append(resp.LabelNames, state.index.LabelNames()...)
+		return resp, nil
+	}
+
+	names := map[string]struct{}{}
+	if err := state.forSeriesMatching(ctx, matchers, func(ctx context.Context, fp model.Fingerprint, series *memorySeries) error {
+		for _, l := range series.metric {
+			names[l.Name] = struct{}{}
+		}
+		return nil
+	}, nil, 0); err != nil {
+		return nil, err
 	}
 
-	resp := &client.LabelNamesResponse{}
-	resp.LabelNames = append(resp.LabelNames, state.index.LabelNames()...)
+	resp.LabelNames = make([]string, 0, len(names))
+	for name := range names {
+		resp.LabelNames = append(resp.LabelNames, name)
+	}
+	sort.Strings(resp.LabelNames)
 
 	return resp, nil
 }
@@ -1006,10 +1226,15 @@ func (i *Ingester) MetricsForLabelMatchers(ctx context.Context, req *client.Metr
 	}
 
 	lss := map[model.Fingerprint]labels.Labels{}
+	timeRanges := map[model.Fingerprint]client.SeriesTimeRange{}
 	for _, matchers := range matchersSet {
 		if err := state.forSeriesMatching(ctx, matchers, func(ctx context.Context, fp model.Fingerprint, series *memorySeries) error {
 			if _, ok := lss[fp]; !ok {
 				lss[fp] = series.metric
+				if req.IncludeTimeRange {
+					minTime, maxTime := series.timeRange()
+					timeRanges[fp] = client.SeriesTimeRange{MinTimeMs: int64(minTime), MaxTimeMs: int64(maxTime)}
+				}
 			}
 			return nil
 		}, nil, 0); err != nil {
@@ -1020,8 +1245,14 @@ func (i *Ingester) MetricsForLabelMatchers(ctx context.Context, req *client.Metr
 	result := &client.MetricsForLabelMatchersResponse{
 		Metric: make([]*cortexpb.Metric, 0, len(lss)),
 	}
-	for _, ls := range lss {
+	if req.IncludeTimeRange {
+		result.TimeRanges = make([]client.SeriesTimeRange, 0, len(lss))
+	}
+	for fp, ls := range lss {
 		result.Metric = append(result.Metric, &cortexpb.Metric{Labels: cortexpb.FromLabelsToLabelAdapters(ls)})
+		if req.IncludeTimeRange {
+			result.TimeRanges = append(result.TimeRanges, timeRanges[fp])
+		}
 	}
 
 	return result, nil
@@ -1079,6 +1310,24 @@ func (i *Ingester) UserStats(ctx context.Context, req *client.UserStatsRequest)
 	}, nil
 }
 
+// LocalTimeRange returns the time of the oldest sample of the current user held by the ingester.
+func (i *Ingester) LocalTimeRange(ctx context.Context, req *client.LocalTimeRangeRequest) (*client.LocalTimeRangeResponse, error) {
+	if !i.cfg.BlocksStorageEnabled {
+		return nil, status.Error(codes.Unimplemented, "local time range is supported only by the blocks storage")
+	}
+
+	return i.v2LocalTimeRange(ctx, req)
+}
+
+// LabelValuesCardinality returns the number of in-memory series of the current user for each value of a label.
+func (i *Ingester) LabelValuesCardinality(ctx context.Context, req *client.LabelValuesCardinalityRequest) (*client.LabelValuesCardinalityResponse, error) {
+	if !i.cfg.BlocksStorageEnabled {
+		return nil, status.Error(codes.Unimplemented, "label values cardinality is supported only by the blocks storage")
+	}
+
+	return i.v2LabelValuesCardinality(ctx, req)
+}
+
 // AllUserStats returns ingestion statistics for all users known to this ingester.
 func (i *Ingester) AllUserStats(ctx context.Context, req *client.UserStatsRequest) (*client.UsersStatsResponse, error) {
 	if i.cfg.BlocksStorageEnabled {
@@ -22,11 +22,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/value"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/user"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
 	promchunk "github.com/cortexproject/cortex/pkg/chunk/encoding"
@@ -243,6 +246,52 @@ func TestIngesterAppend(t *testing.T) {
 	store.checkData(t, userIDs, testData)
 }
 
+func TestIngesterMetricsForLabelMatchers_TimeRange(t *testing.T) {
+	_, ing := newDefaultTestStore(t)
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	series1 := labels.Labels{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "200"}}
+	series2 := labels.Labels{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "500"}}
+
+	ctx := user.InjectOrgID(context.Background(), "test")
+	for _, sample := range []struct {
+		lbls      labels.Labels
+		timestamp int64
+	}{{series1, 1000}, {series1, 2000}, {series1, 3000}, {series2, 5000}} {
+		req, _, _, _ := mockWriteRequest(t, sample.lbls, 1, sample.timestamp)
+		_, err := ing.Push(ctx, req)
+		require.NoError(t, err)
+	}
+
+	req := &client.MetricsForLabelMatchersRequest{
+		StartTimestampMs: math.MinInt64,
+		EndTimestampMs:   math.MaxInt64,
+		MatchersSet: []*client.LabelMatchers{{Matchers: []*client.LabelMatcher{
+			{Type: client.EQUAL, Name: model.MetricNameLabel, Value: "test_1"},
+		}}},
+	}
+
+	res, err := ing.MetricsForLabelMatchers(ctx, req)
+	require.NoError(t, err)
+	assert.Len(t, res.Metric, 2)
+	assert.Empty(t, res.TimeRanges)
+
+	req.IncludeTimeRange = true
+	res, err = ing.MetricsForLabelMatchers(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, res.Metric, 2)
+	require.Len(t, res.TimeRanges, 2)
+
+	actual := map[string]client.SeriesTimeRange{}
+	for i, m := range res.Metric {
+		actual[cortexpb.FromLabelAdaptersToLabels(m.Labels).String()] = res.TimeRanges[i]
+	}
+	assert.Equal(t, map[string]client.SeriesTimeRange{
+		series1.String(): {MinTimeMs: 1000, MaxTimeMs: 3000},
+		series2.String(): {MinTimeMs: 5000, MaxTimeMs: 5000},
+	}, actual)
+}
+
 func TestIngesterMetadataAppend(t *testing.T) {
 	for _, tc := range []struct {
 		desc              string
@@ -511,6 +560,65 @@ func TestIngesterAppendBlankLabel(t *testing.T) {
 	assert.Equal(t, expected, res)
 }
 
+func TestIngesterPushStreamUnimplemented(t *testing.T) {
+	_, ing := newDefaultTestStore(t)
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	// The distributor falls back to the unary push.
+	err := ing.PushStream(nil)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestIngesterLabelNames(t *testing.T) {
+	_, ing := newDefaultTestStore(t)
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	for _, lp := range []labelPairs{
+		{{Name: model.MetricNameLabel, Value: "test_1"}, {Name: "status", Value: "200"}},
+		{{Name: model.MetricNameLabel, Value: "test_1"}, {Name: "route", Value: "get_user"}},
+		{{Name: model.MetricNameLabel, Value: "test_2"}, {Name: "job", Value: "api"}},
+	} {
+		require.NoError(t, ing.append(ctx, userID, lp, 1, 0, cortexpb.API, nil))
+	}
+
+	tests := map[string]struct {
+		matchers []*labels.Matcher
+		expected []string
+	}{
+		"without matchers": {
+			expected: []string{model.MetricNameLabel, "job", "route", "status"},
+		},
+		"with matchers": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "test_1")},
+			expected: []string{model.MetricNameLabel, "route", "status"},
+		},
+		"with matchers selecting a single series": {
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "test_1"),
+				labels.MustNewMatcher(labels.MatchRegexp, "status", "2.."),
+			},
+			expected: []string{model.MetricNameLabel, "status"},
+		},
+		"with matchers not matching any series": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "unknown")},
+			expected: []string{},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			req, err := client.ToLabelNamesRequest(model.Earliest, model.Latest, testData.matchers)
+			require.NoError(t, err)
+
+			res, err := ing.LabelNames(ctx, req)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, testData.expected, res.LabelNames)
+			assert.True(t, res.MatchersApplied)
+		})
+	}
+}
+
 func TestIngesterUserLimitExceeded(t *testing.T) {
 	limits := defaultLimitsTestConfig()
 	limits.MaxLocalSeriesPerUser = 1
@@ -1050,6 +1158,96 @@ func TestIngesterActiveSeries(t *testing.T) {
 	}
 }
 
+func TestIngesterNaNHandling(t *testing.T) {
+	const userID = "test"
+	samples := []cortexpb.Sample{
+		{Value: 1, TimestampMs: 1},
+		{Value: math.NaN(), TimestampMs: 2},
+		{Value: math.Float64frombits(value.StaleNaN), TimestampMs: 3},
+		{Value: 4, TimestampMs: 4},
+	}
+
+	tests := map[string]struct {
+		nanHandling        string
+		expectedTimestamps []model.Time
+		expectedMetrics    string
+	}{
+		"should ingest all the samples if NaN handling is keep": {
+			nanHandling:        validation.NaNHandlingKeep,
+			expectedTimestamps: []model.Time{1, 2, 3, 4},
+		},
+		"should drop the NaN samples and the staleness markers if NaN handling is drop_all": {
+			nanHandling:        validation.NaNHandlingDropAll,
+			expectedTimestamps: []model.Time{1, 4},
+			expectedMetrics: `
+				# HELP cortex_ingester_dropped_nan_samples_total The total number of NaN samples dropped on ingestion according to the tenant's NaN handling, by type (nan or stale).
+				# TYPE cortex_ingester_dropped_nan_samples_total counter
+				cortex_ingester_dropped_nan_samples_total{type="nan"} 1
+				cortex_ingester_dropped_nan_samples_total{type="stale"} 1
+			`,
+		},
+		"should drop the staleness markers only if NaN handling is drop_stale_only": {
+			nanHandling:        validation.NaNHandlingDropStaleOnly,
+			expectedTimestamps: []model.Time{1, 2, 4},
+			expectedMetrics: `
+				# HELP cortex_ingester_dropped_nan_samples_total The total number of NaN samples dropped on ingestion according to the tenant's NaN handling, by type (nan or stale).
+				# TYPE cortex_ingester_dropped_nan_samples_total counter
+				cortex_ingester_dropped_nan_samples_total{type="stale"} 1
+			`,
+		},
+	}
+
+	for _, storage := range []string{"chunks", "blocks"} {
+		for testName, testData := range tests {
+			t.Run(fmt.Sprintf("%s: %s", storage, testName), func(t *testing.T) {
+				registry := prometheus.NewRegistry()
+
+				cfg := defaultIngesterTestConfig()
+				cfg.LifecyclerConfig.JoinAfter = 0
+
+				limits := defaultLimitsTestConfig()
+				limits.NaNHandling = testData.nanHandling
+
+				var i *Ingester
+				if storage == "chunks" {
+					_, i = newTestStore(t, cfg, defaultClientTestConfig(), limits, registry)
+				} else {
+					var err error
+					i, err = prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, "", registry)
+					require.NoError(t, err)
+					require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+				}
+				defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+				test.Poll(t, 100*time.Millisecond, ring.ACTIVE, func() interface{} {
+					return i.lifecycler.GetState()
+				})
+
+				ctx := user.InjectOrgID(context.Background(), userID)
+				_, err := i.Push(ctx, &cortexpb.WriteRequest{
+					Timeseries: []cortexpb.PreallocTimeseries{{TimeSeries: &cortexpb.TimeSeries{
+						Labels:  []cortexpb.LabelAdapter{{Name: labels.MetricName, Value: "test"}}, // Cleared and returned to the pool by the push.
+						Samples: append([]cortexpb.Sample(nil), samples...),
+					}}},
+				})
+				require.NoError(t, err)
+
+				res, _, err := runTestQuery(ctx, t, i, labels.MatchEqual, labels.MetricName, "test")
+				require.NoError(t, err)
+				require.Len(t, res, 1)
+
+				timestamps := make([]model.Time, 0, len(res[0].Values))
+				for _, v := range res[0].Values {
+					timestamps = append(timestamps, v.Timestamp)
+				}
+				assert.Equal(t, testData.expectedTimestamps, timestamps)
+
+				assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(testData.expectedMetrics), "cortex_ingester_dropped_nan_samples_total"))
+			})
+		}
+	}
+}
+
 func TestGetIgnoreSeriesLimitForMetricNamesMap(t *testing.T) {
 	cfg := Config{}
 
@@ -24,6 +24,7 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/shipper"
@@ -141,6 +142,9 @@ type userTSDB struct {
 	// Cached shipped blocks.
 	shippedBlocksMtx sync.Mutex
 	shippedBlocks    map[ulid.ULID]struct{}
+
+	// Block ranges the TSDB has been opened with.
+	blockRanges cortex_tsdb.DurationList
 }
 
 // Explicitly wrapping the tsdb.DB functions that we use.
@@ -408,6 +412,11 @@ type TSDBState struct {
 	// Number of series in memory, across all tenants.
 	seriesCount atomic.Int64
 
+	// Block ranges the TSDB of each tenant has last been opened with, kept when the TSDB is
+	// closed so that the changes of the per-tenant block ranges can be logged.
+	blockRangesMtx sync.Mutex
+	blockRanges    map[string]cortex_tsdb.DurationList
+
 	// Head compactions metrics.
 	compactionsTriggered   prometheus.Counter
 	compactionsFailed      prometheus.Counter
@@ -441,6 +450,7 @@ func newTSDBState(bucketClient objstore.Bucket, registerer prometheus.Registerer
 
 	return TSDBState{
 		dbs:                 make(map[string]*userTSDB),
+		blockRanges:         make(map[string]cortex_tsdb.DurationList),
 		bucket:              bucketClient,
 		tsdbMetrics:         newTSDBMetrics(registerer),
 		forceCompactTrigger: make(chan requestWithUsersAndCallback),
@@ -610,6 +620,8 @@ func (i *Ingester) startingV2(ctx context.Context) error {
 		servs = append(servs, closeIdleService)
 	}
 
+	i.startedAt = time.Now()
+
 	var err error
 	i.TSDBState.subservices, err = services.NewManager(servs...)
 	if err == nil {
@@ -716,6 +728,13 @@ type extendedAppender interface {
 
 // v2Push adds metrics to a block
 func (i *Ingester) v2Push(ctx context.Context, req *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+	return i.v2PushWithSeriesErrors(ctx, req, nil)
+}
+
+// v2PushWithSeriesErrors adds metrics to a block. If onSeriesError is not nil, it's called with the
+// index and the first error of each series failing validation, instead of returning the first of
+// these errors. The error references the request memory, so it must not be retained.
+func (i *Ingester) v2PushWithSeriesErrors(ctx context.Context, req *cortexpb.WriteRequest, onSeriesError func(idx int, err error)) (*cortexpb.WriteResponse, error) {
 	var firstPartialErr error
 
 	// NOTE: because we use `unsafe` in deserialisation, we must not
@@ -769,17 +788,43 @@ func (i *Ingester) v2Push(ctx context.Context, req *cortexpb.WriteRequest) (*cor
 		newValueForTimestampCount = 0
 		perUserSeriesLimitCount   = 0
 		perMetricSeriesLimitCount = 0
+		missingMetadataCount      = 0
+
+		seriesIdx        = 0
+		lastErrSeriesIdx = -1
 
 		updateFirstPartial = func(errFn func() error) {
+			if onSeriesError != nil {
+				if lastErrSeriesIdx != seriesIdx {
+					lastErrSeriesIdx = seriesIdx
+					onSeriesError(seriesIdx, errFn())
+				}
+				return
+			}
 			if firstPartialErr == nil {
 				firstPartialErr = errFn()
 			}
 		}
 	)
 
+	requireMetadata := i.requireMetricMetadata(userID, startAppend)
+	nanHandling := i.limits.NaNHandling(userID)
+
 	// Walk the samples, appending them to the users database
 	app := db.Appender(ctx).(extendedAppender)
-	for _, ts := range req.Timeseries {
+	for idx, ts := range req.Timeseries {
+		seriesIdx = idx
+
+		if requireMetadata {
+			if err := i.checkMetricMetadata(userID, ts.Labels, startAppend); err != nil {
+				missingMetadataCount += len(ts.Samples)
+				failedSamplesCount += len(ts.Samples)
+				failedExemplarsCount += len(ts.Exemplars)
+				updateFirstPartial(func() error { return err })
+				continue
+			}
+		}
+
 		// The labels must be sorted (in our case, it's guaranteed a write request
 		// has sorted labels once hit the ingester).
 
@@ -790,6 +835,10 @@ func (i *Ingester) v2Push(ctx context.Context, req *cortexpb.WriteRequest) (*cor
 		oldSucceededSamplesCount := succeededSamplesCount
 
 		for _, s := range ts.Samples {
+			if i.dropNaNSample(nanHandling, s.Value) {
+				continue
+			}
+
 			var err error
 
 			// If the cached reference exists, we try to use it.
@@ -930,6 +979,9 @@ func (i *Ingester) v2Push(ctx context.Context, req *cortexpb.WriteRequest) (*cor
 	if perMetricSeriesLimitCount > 0 {
 		validation.DiscardedSamples.WithLabelValues(perMetricSeriesLimit, userID).Add(float64(perMetricSeriesLimitCount))
 	}
+	if missingMetadataCount > 0 {
+		validation.DiscardedSamples.WithLabelValues(missingMetricMetadata, userID).Add(float64(missingMetadataCount))
+	}
 
 	// Distributor counts both samples and metadata, so for consistency ingester does the same.
 	i.ingestionRate.Add(int64(succeededSamplesCount + ingestedMetadata))
@@ -944,17 +996,21 @@ func (i *Ingester) v2Push(ctx context.Context, req *cortexpb.WriteRequest) (*cor
 	}
 
 	if firstPartialErr != nil {
-		code := http.StatusBadRequest
-		var ve *validationError
-		if errors.As(firstPartialErr, &ve) {
-			code = ve.code
-		}
-		return &cortexpb.WriteResponse{}, httpgrpc.Errorf(code, wrapWithUser(firstPartialErr, userID).Error())
+		return &cortexpb.WriteResponse{}, httpgrpc.Errorf(partialErrorCode(firstPartialErr), wrapWithUser(firstPartialErr, userID).Error())
 	}
 
 	return &cortexpb.WriteResponse{}, nil
 }
 
+// partialErrorCode returns the HTTP status code of an error of the samples failing validation.
+func partialErrorCode(err error) int {
+	var ve *validationError
+	if errors.As(err, &ve) {
+		return ve.code
+	}
+	return http.StatusBadRequest
+}
+
 func (u *userTSDB) acquireAppendLock() error {
 	u.stateMtx.RLock()
 	defer u.stateMtx.RUnlock()
@@ -993,6 +1049,10 @@ func (i *Ingester) v2Query(ctx context.Context, req *client.QueryRequest) (*clie
 	if err != nil {
 		return nil, err
 	}
+	inShard, matchers, err := queryShardFilter(matchers)
+	if err != nil {
+		return nil, err
+	}
 
 	i.metrics.queries.Inc()
 
@@ -1018,6 +1078,9 @@ func (i *Ingester) v2Query(ctx context.Context, req *client.QueryRequest) (*clie
 	result := &client.QueryResponse{}
 	for ss.Next() {
 		series := ss.At()
+		if !inShard(series.Labels()) {
+			continue
+		}
 
 		ts := cortexpb.TimeSeries{
 			Labels: cortexpb.FromLabelsToLabelAdapters(series.Labels()),
@@ -1136,6 +1199,11 @@ func (i *Ingester) v2LabelNames(ctx context.Context, req *client.LabelNamesReque
 		return nil, err
 	}
 
+	startTimestampMs, endTimestampMs, matchers, err := client.FromLabelNamesRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
 	userID, err := tenant.TenantID(ctx)
 	if err != nil {
 		return nil, err
@@ -1143,10 +1211,10 @@ func (i *Ingester) v2LabelNames(ctx context.Context, req *client.LabelNamesReque
 
 	db := i.getTSDB(userID)
 	if db == nil {
-		return &client.LabelNamesResponse{}, nil
+		return &client.LabelNamesResponse{MatchersApplied: true}, nil
 	}
 
-	mint, maxt, err := metadataQueryRange(req.StartTimestampMs, req.EndTimestampMs, db)
+	mint, maxt, err := metadataQueryRange(startTimestampMs, endTimestampMs, db)
 	if err != nil {
 		return nil, err
 	}
@@ -1157,13 +1225,14 @@ func (i *Ingester) v2LabelNames(ctx context.Context, req *client.LabelNamesReque
 	}
 	defer q.Close()
 
-	names, _, err := q.LabelNames()
+	names, _, err := q.LabelNames(matchers...)
 	if err != nil {
 		return nil, err
 	}
 
 	return &client.LabelNamesResponse{
-		LabelNames: names,
+		LabelNames:      names,
+		MatchersApplied: true,
 	}, nil
 }
 
@@ -1235,9 +1304,98 @@ func (i *Ingester) v2MetricsForLabelMatchers(ctx context.Context, req *client.Me
 		})
 	}
 
+	if req.IncludeTimeRange {
+		timeRanges, err := headSeriesTimeRanges(ctx, db.Head(), matchersSet)
+		if err != nil {
+			return nil, err
+		}
+
+		result.TimeRanges = make([]client.SeriesTimeRange, 0, len(result.Metric))
+		for _, m := range result.Metric {
+			result.TimeRanges = append(result.TimeRanges, timeRanges[cortexpb.FromLabelAdaptersToLabels(m.Labels).String()])
+		}
+	}
+
 	return result, nil
 }
 
+// headSeriesTimeRanges returns the time range of the samples in the TSDB head of the series
+// matching any of the matchers sets, by the string of their labels.
+func headSeriesTimeRanges(ctx context.Context, head *tsdb.Head, matchersSet [][]*labels.Matcher) (map[string]client.SeriesTimeRange, error) {
+	idx, err := head.Index()
+	if err != nil {
+		return nil, err
+	}
+	defer idx.Close()
+
+	chunkr, err := head.Chunks()
+	if err != nil {
+		return nil, err
+	}
+	defer chunkr.Close()
+
+	var (
+		lbls labels.Labels
+		chks []chunks.Meta
+		it   chunkenc.Iterator
+	)
+
+	timeRanges := map[string]client.SeriesTimeRange{}
+	for _, matchers := range matchersSet {
+		postings, err := tsdb.PostingsForMatchers(idx, matchers...)
+		if err != nil {
+			return nil, err
+		}
+
+		for postings.Next() {
+			// Interrupt if the context has been canceled.
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			if err := idx.Series(postings.At(), &lbls, &chks); err != nil {
+				// The series may have been garbage collected in the meanwhile.
+				if errors.Is(err, storage.ErrNotFound) {
+					continue
+				}
+				return nil, err
+			}
+			if len(chks) == 0 {
+				continue
+			}
+
+			// The head chunk is open, so its max time is the timestamp of its last sample.
+			last := chks[len(chks)-1]
+			maxTime := last.MaxTime
+			if maxTime == math.MaxInt64 {
+				chk, err := chunkr.Chunk(last.Ref)
+				if errors.Is(err, storage.ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+
+				maxTime = last.MinTime
+				it = chk.Iterator(it)
+				for it.Next() {
+					maxTime, _ = it.At()
+				}
+				if err := it.Err(); err != nil {
+					return nil, err
+				}
+			}
+
+			timeRanges[lbls.String()] = client.SeriesTimeRange{MinTimeMs: chks[0].MinTime, MaxTimeMs: maxTime}
+		}
+		if err := postings.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return timeRanges, nil
+}
+
 func (i *Ingester) v2UserStats(ctx context.Context, req *client.UserStatsRequest) (*client.UserStatsResponse, error) {
 	if err := i.checkRunning(); err != nil {
 		return nil, err
@@ -1256,6 +1414,86 @@ func (i *Ingester) v2UserStats(ctx context.Context, req *client.UserStatsRequest
 	return createUserStats(db), nil
 }
 
+func (i *Ingester) v2LocalTimeRange(ctx context.Context, req *client.LocalTimeRangeRequest) (*client.LocalTimeRangeResponse, error) {
+	if err := i.checkRunning(); err != nil {
+		return nil, err
+	}
+
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db := i.getTSDB(userID)
+	if db == nil {
+		return &client.LocalTimeRangeResponse{}, nil
+	}
+
+	minTime, err := db.StartTime()
+	if err != nil {
+		return nil, err
+	}
+
+	// The head min time is math.MaxInt64 when the head is empty.
+	if minTime == math.MaxInt64 {
+		return &client.LocalTimeRangeResponse{}, nil
+	}
+
+	return &client.LocalTimeRangeResponse{MinTimeMs: minTime}, nil
+}
+
+func (i *Ingester) v2LabelValuesCardinality(ctx context.Context, req *client.LabelValuesCardinalityRequest) (*client.LabelValuesCardinalityResponse, error) {
+	if err := i.checkRunning(); err != nil {
+		return nil, err
+	}
+
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db := i.getTSDB(userID)
+	if db == nil {
+		return &client.LabelValuesCardinalityResponse{}, nil
+	}
+
+	idx, err := db.Head().Index()
+	if err != nil {
+		return nil, err
+	}
+	defer idx.Close()
+
+	values, err := idx.LabelValues(req.LabelName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The series of each value are counted from the postings, without looking the series up.
+	resp := &client.LabelValuesCardinalityResponse{Items: make([]client.LabelValueSeriesCount, 0, len(values))}
+	for _, value := range values {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		p, err := idx.Postings(req.LabelName, value)
+		if err != nil {
+			return nil, err
+		}
+
+		count := uint64(0)
+		for p.Next() {
+			count++
+		}
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+
+		resp.Items = append(resp.Items, client.LabelValueSeriesCount{LabelValue: value, SeriesCount: count})
+	}
+
+	return resp, nil
+}
+
 func (i *Ingester) v2AllUserStats(ctx context.Context, req *client.UserStatsRequest) (*client.UsersStatsResponse, error) {
 	if err := i.checkRunning(); err != nil {
 		return nil, err
@@ -1337,7 +1575,10 @@ func (i *Ingester) v2QueryStream(req *client.QueryRequest, stream client.Ingeste
 		}
 	}
 
-	if streamType == QueryStreamChunks {
+	if req.Downsample && req.StepMs > 0 {
+		level.Debug(spanlog).Log("msg", "using v2QueryStreamDownsampled", "step_ms", req.StepMs)
+		numSeries, numSamples, err = i.v2QueryStreamDownsampled(ctx, db, int64(from), int64(through), req.StepMs, matchers, stream)
+	} else if streamType == QueryStreamChunks {
 		level.Debug(spanlog).Log("msg", "using v2QueryStreamChunks")
 		numSeries, numSamples, err = i.v2QueryStreamChunks(ctx, db, int64(from), int64(through), matchers, stream)
 	} else {
@@ -1355,6 +1596,11 @@ func (i *Ingester) v2QueryStream(req *client.QueryRequest, stream client.Ingeste
 }
 
 func (i *Ingester) v2QueryStreamSamples(ctx context.Context, db *userTSDB, from, through int64, matchers []*labels.Matcher, stream client.Ingester_QueryStreamServer) (numSeries, numSamples int, _ error) {
+	inShard, matchers, err := queryShardFilter(matchers)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	q, err := db.Querier(ctx, from, through)
 	if err != nil {
 		return 0, 0, err
@@ -1371,6 +1617,9 @@ func (i *Ingester) v2QueryStreamSamples(ctx context.Context, db *userTSDB, from,
 	batchSizeBytes := 0
 	for ss.Next() {
 		series := ss.At()
+		if !inShard(series.Labels()) {
+			continue
+		}
 
 		// convert labels to LabelAdapter
 		ts := cortexpb.TimeSeries{
@@ -1422,8 +1671,96 @@ func (i *Ingester) v2QueryStreamSamples(ctx context.Context, db *userTSDB, from,
 	return numSeries, numSamples, nil
 }
 
+// v2QueryStreamDownsampled streams the series downsampled to at most one sample per step, each series
+// with a single chunk of client.DownsampledChunkEncoding.
+func (i *Ingester) v2QueryStreamDownsampled(ctx context.Context, db *userTSDB, from, through, stepMs int64, matchers []*labels.Matcher, stream client.Ingester_QueryStreamServer) (numSeries, numSamples int, _ error) {
+	inShard, matchers, err := queryShardFilter(matchers)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	q, err := db.Querier(ctx, from, through)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer q.Close()
+
+	// It's not required to return sorted series because series are sorted by the Cortex querier.
+	ss := q.Select(false, nil, matchers...)
+	if ss.Err() != nil {
+		return 0, 0, ss.Err()
+	}
+
+	chunkSeries := make([]client.TimeSeriesChunk, 0, queryStreamBatchSize)
+	batchSizeBytes := 0
+	downsampler := client.NewDownsampler(stepMs)
+	for ss.Next() {
+		series := ss.At()
+		if !inShard(series.Labels()) {
+			continue
+		}
+
+		downsampler.Reset()
+		it := series.Iterator()
+		for it.Next() {
+			t, v := it.At()
+			downsampler.Add(t, v)
+			numSamples++
+		}
+		if err := it.Err(); err != nil {
+			return 0, 0, err
+		}
+
+		ts := client.TimeSeriesChunk{
+			Labels: cortexpb.FromLabelsToLabelAdapters(series.Labels()),
+			Chunks: []client.Chunk{client.EncodeDownsampledChunk(downsampler.Samples())},
+		}
+		numSeries++
+		tsSize := ts.Size()
+
+		if (batchSizeBytes > 0 && batchSizeBytes+tsSize > queryStreamBatchMessageSize) || len(chunkSeries) >= queryStreamBatchSize {
+			// Adding this series to the batch would make it too big,
+			// flush the data and add it to new batch instead.
+			err = client.SendQueryStream(stream, &client.QueryStreamResponse{
+				Chunkseries: chunkSeries,
+			})
+			if err != nil {
+				return 0, 0, err
+			}
+
+			batchSizeBytes = 0
+			chunkSeries = chunkSeries[:0]
+		}
+
+		chunkSeries = append(chunkSeries, ts)
+		batchSizeBytes += tsSize
+	}
+
+	// Ensure no error occurred while iterating the series set.
+	if err := ss.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	// Final flush any existing metrics
+	if batchSizeBytes != 0 {
+		err = client.SendQueryStream(stream, &client.QueryStreamResponse{
+			Chunkseries: chunkSeries,
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return numSeries, numSamples, nil
+}
+
 // v2QueryStream streams metrics from a TSDB. This implements the client.IngesterServer interface
 func (i *Ingester) v2QueryStreamChunks(ctx context.Context, db *userTSDB, from, through int64, matchers []*labels.Matcher, stream client.Ingester_QueryStreamServer) (numSeries, numSamples int, _ error) {
+	inShard, matchers, err := queryShardFilter(matchers)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	q, err := db.ChunkQuerier(ctx, from, through)
 	if err != nil {
 		return 0, 0, err
@@ -1440,6 +1777,9 @@ func (i *Ingester) v2QueryStreamChunks(ctx context.Context, db *userTSDB, from,
 	batchSizeBytes := 0
 	for ss.Next() {
 		series := ss.At()
+		if !inShard(series.Labels()) {
+			continue
+		}
 
 		// convert labels to LabelAdapter
 		ts := client.TimeSeriesChunk{
@@ -1579,13 +1919,40 @@ func (i *Ingester) getOrCreateTSDB(userID string, force bool) (*userTSDB, error)
 	return db, nil
 }
 
+// blockRanges returns the block ranges the TSDB of the user is opened with: the per-tenant
+// block ranges if set and valid, the configured ones otherwise.
+func (i *Ingester) blockRanges(userID string, userLogger log.Logger) cortex_tsdb.DurationList {
+	blockRanges := i.cfg.BlocksStorageConfig.TSDB.BlockRanges
+	if override := i.limits.TSDBBlockRanges(userID); len(override) > 0 {
+		if err := cortex_tsdb.ValidateBlockRanges(override, i.cfg.CompactorBlockRanges); err != nil {
+			level.Warn(userLogger).Log("msg", "ignoring the invalid per-tenant TSDB block ranges", "block_ranges", override.String(), "err", err)
+		} else {
+			blockRanges = override
+		}
+	}
+
+	i.TSDBState.blockRangesMtx.Lock()
+	previous, ok := i.TSDBState.blockRanges[userID]
+	i.TSDBState.blockRanges[userID] = blockRanges
+	i.TSDBState.blockRangesMtx.Unlock()
+
+	// The first time the TSDB is opened, the block ranges are compared to the configured ones.
+	if !ok {
+		previous = i.cfg.BlocksStorageConfig.TSDB.BlockRanges
+	}
+	if previous.String() != blockRanges.String() {
+		level.Info(userLogger).Log("msg", "TSDB block ranges changed", "old", previous.String(), "new", blockRanges.String())
+	}
+	return blockRanges
+}
+
 // createTSDB creates a TSDB for a given userID, and returns the created db.
 func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 	tsdbPromReg := prometheus.NewRegistry()
 	udir := i.cfg.BlocksStorageConfig.TSDB.BlocksDir(userID)
 	userLogger := logutil.WithUserID(userID, i.logger)
 
-	blockRanges := i.cfg.BlocksStorageConfig.TSDB.BlockRanges.ToMilliseconds()
+	blockRanges := i.blockRanges(userID, userLogger)
 
 	userDB := &userTSDB{
 		userID:              userID,
@@ -1596,6 +1963,8 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 
 		instanceLimitsFn:    i.getInstanceLimits,
 		instanceSeriesCount: &i.TSDBState.seriesCount,
+
+		blockRanges: blockRanges,
 	}
 
 	enableExemplars := false
@@ -1605,8 +1974,8 @@ func (i *Ingester) createTSDB(userID string) (*userTSDB, error) {
 	// Create a new user database
 	db, err := tsdb.Open(udir, userLogger, tsdbPromReg, &tsdb.Options{
 		RetentionDuration:         i.cfg.BlocksStorageConfig.TSDB.Retention.Milliseconds(),
-		MinBlockDuration:          blockRanges[0],
-		MaxBlockDuration:          blockRanges[len(blockRanges)-1],
+		MinBlockDuration:          blockRanges[0].Milliseconds(),
+		MaxBlockDuration:          blockRanges[len(blockRanges)-1].Milliseconds(),
 		NoLockfile:                true,
 		StripeSize:                i.cfg.BlocksStorageConfig.TSDB.StripeSize,
 		HeadChunksWriteBufferSize: i.cfg.BlocksStorageConfig.TSDB.HeadChunksWriteBufferSize,
@@ -2005,12 +2374,12 @@ func (i *Ingester) compactBlocks(ctx context.Context, force bool, allowed *util.
 		switch {
 		case force:
 			reason = "forced"
-			err = userDB.compactHead(i.cfg.BlocksStorageConfig.TSDB.BlockRanges[0].Milliseconds())
+			err = userDB.compactHead(userDB.blockRanges[0].Milliseconds())
 
 		case i.TSDBState.compactionIdleTimeout > 0 && userDB.isIdle(time.Now(), i.TSDBState.compactionIdleTimeout):
 			reason = "idle"
 			level.Info(i.logger).Log("msg", "TSDB is idle, forcing compaction", "user", userID)
-			err = userDB.compactHead(i.cfg.BlocksStorageConfig.TSDB.BlockRanges[0].Milliseconds())
+			err = userDB.compactHead(userDB.blockRanges[0].Milliseconds())
 
 		default:
 			reason = "regular"
@@ -2135,6 +2504,11 @@ func (i *Ingester) v2LifecyclerFlush() {
 
 	ctx := context.Background()
 
+	// The snapshot is written before the head is compacted, while the last samples are still in memory.
+	if i.cfg.BlocksStorageConfig.TSDB.SeriesSnapshotTTL > 0 && i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled() {
+		i.writeSeriesSnapshots(ctx)
+	}
+
 	i.compactBlocks(ctx, true, nil)
 	if i.cfg.BlocksStorageConfig.TSDB.IsBlocksShippingEnabled() {
 		i.shipBlocks(ctx, nil)
@@ -2143,6 +2517,76 @@ func (i *Ingester) v2LifecyclerFlush() {
 	level.Info(i.logger).Log("msg", "finished flushing and shipping TSDB blocks")
 }
 
+// writeSeriesSnapshots writes the snapshot of the last sample of each series of each user to the
+// storage. The queriers merge the snapshots with the ingesters data once this ingester left the
+// ring, until the blocks it flushed are queryable from the storage.
+func (i *Ingester) writeSeriesSnapshots(ctx context.Context) {
+	_ = concurrency.ForEachUser(ctx, i.getTSDBUsers(), i.cfg.BlocksStorageConfig.TSDB.ShipConcurrency, func(ctx context.Context, userID string) error {
+		userDB := i.getTSDB(userID)
+		if userDB == nil {
+			return nil
+		}
+
+		series, err := lastSamples(ctx, userDB)
+		if err != nil {
+			level.Warn(i.logger).Log("msg", "failed to read the last samples of the series", "user", userID, "err", err)
+			return nil
+		}
+		if len(series) == 0 {
+			return nil
+		}
+
+		if err := cortex_tsdb.WriteSeriesSnapshot(ctx, i.TSDBState.bucket, userID, i.cfg.LifecyclerConfig.ID, i.limits, series); err != nil {
+			level.Warn(i.logger).Log("msg", "failed to write the series snapshot", "user", userID, "err", err)
+			return nil
+		}
+
+		level.Info(i.logger).Log("msg", "written the series snapshot", "user", userID, "series", len(series))
+		return nil
+	})
+}
+
+// lastSamples returns the last sample of each series in the head of the user TSDB, including the
+// staleness markers.
+func lastSamples(ctx context.Context, db *userTSDB) ([]cortexpb.PreallocTimeseries, error) {
+	q, err := db.Querier(ctx, db.Head().MinTime(), db.Head().MaxTime())
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+
+	var result []cortexpb.PreallocTimeseries
+
+	ss := q.Select(false, nil, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+"))
+	for ss.Next() {
+		s := ss.At()
+
+		var (
+			it    = s.Iterator()
+			found bool
+			t     int64
+			v     float64
+		)
+		for it.Next() {
+			t, v = it.At()
+			found = true
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+
+		result = append(result, cortexpb.PreallocTimeseries{TimeSeries: &cortexpb.TimeSeries{
+			Labels:  cortexpb.FromLabelsToLabelAdapters(s.Labels().Copy()),
+			Samples: []cortexpb.Sample{{TimestampMs: t, Value: v}},
+		}})
+	}
+
+	return result, ss.Err()
+}
+
 const (
 	tenantParam = "tenant"
 	waitParam   = "wait"
@@ -45,6 +45,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/chunk/encoding"
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/querier/astmapper"
 	"github.com/cortexproject/cortex/pkg/ring"
 	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
 	"github.com/cortexproject/cortex/pkg/util"
@@ -671,6 +672,127 @@ func TestIngester_v2Push_ShouldCorrectlyTrackMetricsInMultiTenantScenario(t *tes
 	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expectedMetrics), metricNames...))
 }
 
+func TestIngester_v2Push_ShouldRejectSamplesWithoutMetricMetadataIfRequired(t *testing.T) {
+	const userID = "test"
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "foo_bucket", "le", "+Inf"),
+		labels.FromStrings(labels.MetricName, "bar"),
+	}
+	fooMetadata := &cortexpb.MetricMetadata{MetricFamilyName: "foo", Type: cortexpb.HISTOGRAM, Help: "foo"}
+
+	tests := map[string]struct {
+		requireMetricMetadata bool
+		startupGracePeriod    time.Duration
+		gracePeriod           time.Duration
+		expectedDiscarded     int
+	}{
+		"should accept the samples without metadata if the metric metadata is not required": {
+			requireMetricMetadata: false,
+			expectedDiscarded:     0,
+		},
+		"should reject the samples of the metrics without metadata if the metric metadata is required": {
+			requireMetricMetadata: true,
+			expectedDiscarded:     2,
+		},
+		"should accept the samples of the metrics without metadata during the ingester startup grace period": {
+			requireMetricMetadata: true,
+			startupGracePeriod:    time.Hour,
+			expectedDiscarded:     0,
+		},
+		"should accept the samples of the metrics without metadata during the metric grace period": {
+			requireMetricMetadata: true,
+			gracePeriod:           time.Hour,
+			expectedDiscarded:     0,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+
+			cfg := defaultIngesterTestConfig()
+			cfg.LifecyclerConfig.JoinAfter = 0
+			cfg.MetricMetadataStartupGracePeriod = testData.startupGracePeriod
+
+			limits := defaultLimitsTestConfig()
+			limits.RequireMetricMetadata = testData.requireMetricMetadata
+			limits.MetricMetadataGracePeriod = model.Duration(testData.gracePeriod)
+
+			i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, "", registry)
+			require.NoError(t, err)
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+			defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+			// Wait until the ingester is ACTIVE
+			test.Poll(t, 100*time.Millisecond, ring.ACTIVE, func() interface{} {
+				return i.lifecycler.GetState()
+			})
+
+			ctx := user.InjectOrgID(context.Background(), userID)
+
+			// The metadata of the histogram is received along with its first sample, while
+			// the metadata of the other metric is never received.
+			_, err = i.v2Push(ctx, cortexpb.ToWriteRequest(series[:1], []cortexpb.Sample{{Value: 1, TimestampMs: 9}}, []*cortexpb.MetricMetadata{fooMetadata}, cortexpb.API))
+			require.NoError(t, err)
+
+			_, err = i.v2Push(ctx, cortexpb.ToWriteRequest(series, []cortexpb.Sample{{Value: 2, TimestampMs: 10}, {Value: 2, TimestampMs: 10}}, nil, cortexpb.API))
+			if testData.expectedDiscarded == 0 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				resp, ok := httpgrpc.HTTPResponseFromError(err)
+				require.True(t, ok)
+				assert.Equal(t, int32(http.StatusBadRequest), resp.Code)
+				assert.Contains(t, string(resp.Body), `no metadata has been received for metric "bar"`)
+			}
+
+			_, err = i.v2Push(ctx, cortexpb.ToWriteRequest(series[1:], []cortexpb.Sample{{Value: 3, TimestampMs: 11}}, nil, cortexpb.API))
+			if testData.expectedDiscarded == 0 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+
+			assert.Equal(t, float64(testData.expectedDiscarded), testutil.ToFloat64(validation.DiscardedSamples.WithLabelValues(missingMetricMetadata, userID)))
+			validation.DiscardedSamples.DeleteLabelValues(missingMetricMetadata, userID)
+		})
+	}
+
+	t.Run("should reject the samples of the metrics without metadata once the metric grace period has elapsed", func(t *testing.T) {
+		const gracePeriod = 200 * time.Millisecond
+
+		cfg := defaultIngesterTestConfig()
+		cfg.LifecyclerConfig.JoinAfter = 0
+		cfg.MetricMetadataStartupGracePeriod = 0
+
+		limits := defaultLimitsTestConfig()
+		limits.RequireMetricMetadata = true
+		limits.MetricMetadataGracePeriod = model.Duration(gracePeriod)
+
+		i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, "", nil)
+		require.NoError(t, err)
+		require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+		defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+		test.Poll(t, 100*time.Millisecond, ring.ACTIVE, func() interface{} {
+			return i.lifecycler.GetState()
+		})
+
+		ctx := user.InjectOrgID(context.Background(), userID)
+		_, err = i.v2Push(ctx, cortexpb.ToWriteRequest(series[1:], []cortexpb.Sample{{Value: 1, TimestampMs: 9}}, nil, cortexpb.API))
+		require.NoError(t, err)
+
+		time.Sleep(2 * gracePeriod)
+		_, err = i.v2Push(ctx, cortexpb.ToWriteRequest(series[1:], []cortexpb.Sample{{Value: 2, TimestampMs: 10}}, nil, cortexpb.API))
+		require.Error(t, err)
+
+		// The samples are accepted again once the metadata of the metric is received.
+		_, err = i.v2Push(ctx, cortexpb.ToWriteRequest(series[1:], []cortexpb.Sample{{Value: 3, TimestampMs: 11}}, []*cortexpb.MetricMetadata{{MetricFamilyName: "bar", Type: cortexpb.GAUGE}}, cortexpb.API))
+		require.NoError(t, err)
+		validation.DiscardedSamples.DeleteLabelValues(missingMetricMetadata, userID)
+	})
+}
+
 func TestIngester_v2Push_DecreaseInactiveSeries(t *testing.T) {
 	metricLabelAdapters := []cortexpb.LabelAdapter{{Name: labels.MetricName, Value: "test"}}
 	metricLabels := cortexpb.FromLabelAdaptersToLabels(metricLabelAdapters)
@@ -1134,6 +1256,15 @@ func Test_Ingester_v2LabelNames(t *testing.T) {
 	res, err := i.v2LabelNames(ctx, &client.LabelNamesRequest{})
 	require.NoError(t, err)
 	assert.ElementsMatch(t, expected, res.LabelNames)
+	assert.True(t, res.MatchersApplied)
+
+	// Get label names of the series matching the matchers
+	req, err := client.ToLabelNamesRequest(0, model.Latest, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "test_2")})
+	require.NoError(t, err)
+	res, err = i.v2LabelNames(ctx, req)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"__name__"}, res.LabelNames)
+	assert.True(t, res.MatchersApplied)
 }
 
 func Test_Ingester_v2LabelValues(t *testing.T) {
@@ -1361,7 +1492,7 @@ func TestIngester_v2LabelNames_ShouldNotCreateTSDBIfDoesNotExists(t *testing.T)
 
 	res, err := i.v2LabelNames(ctx, req)
 	require.NoError(t, err)
-	assert.Equal(t, &client.LabelNamesResponse{}, res)
+	assert.Equal(t, &client.LabelNamesResponse{MatchersApplied: true}, res)
 
 	// Check if the TSDB has been created
 	_, tsdbCreated := i.TSDBState.dbs[userID]
@@ -1634,6 +1765,61 @@ func Test_Ingester_v2MetricsForLabelMatchers_Deduplication(t *testing.T) {
 	require.Len(t, res.GetMetric(), numSeries)
 }
 
+func Test_Ingester_v2MetricsForLabelMatchers_TimeRange(t *testing.T) {
+	i, err := prepareIngesterWithBlocksStorage(t, defaultIngesterTestConfig(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until it's ACTIVE
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	series1 := labels.Labels{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "200"}}
+	series2 := labels.Labels{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "500"}}
+	series3 := labels.Labels{{Name: labels.MetricName, Value: "test_2"}}
+
+	ctx := user.InjectOrgID(context.Background(), "test")
+	for _, sample := range []struct {
+		lbls      labels.Labels
+		timestamp int64
+	}{{series1, 1000}, {series1, 2000}, {series1, 3000}, {series2, 5000}, {series3, 7000}} {
+		req, _, _, _ := mockWriteRequest(t, sample.lbls, 1, sample.timestamp)
+		_, err := i.v2Push(ctx, req)
+		require.NoError(t, err)
+	}
+
+	req := &client.MetricsForLabelMatchersRequest{
+		StartTimestampMs: math.MinInt64,
+		EndTimestampMs:   math.MaxInt64,
+		MatchersSet: []*client.LabelMatchers{
+			{Matchers: []*client.LabelMatcher{{Type: client.EQUAL, Name: "status", Value: "200"}}},
+			{Matchers: []*client.LabelMatcher{{Type: client.EQUAL, Name: model.MetricNameLabel, Value: "test_1"}}},
+		},
+	}
+
+	res, err := i.v2MetricsForLabelMatchers(ctx, req)
+	require.NoError(t, err)
+	assert.Len(t, res.Metric, 2)
+	assert.Empty(t, res.TimeRanges)
+
+	req.IncludeTimeRange = true
+	res, err = i.v2MetricsForLabelMatchers(ctx, req)
+	require.NoError(t, err)
+	require.Len(t, res.Metric, 2)
+	require.Len(t, res.TimeRanges, 2)
+
+	actual := map[string]client.SeriesTimeRange{}
+	for i, m := range res.Metric {
+		actual[cortexpb.FromLabelAdaptersToLabels(m.Labels).String()] = res.TimeRanges[i]
+	}
+	assert.Equal(t, map[string]client.SeriesTimeRange{
+		series1.String(): {MinTimeMs: 1000, MaxTimeMs: 3000},
+		series2.String(): {MinTimeMs: 5000, MaxTimeMs: 5000},
+	}, actual)
+}
+
 func Benchmark_Ingester_v2MetricsForLabelMatchers(b *testing.B) {
 	var (
 		userID              = "test"
@@ -1717,6 +1903,68 @@ func createIngesterWithSeries(t testing.TB, userID string, numSeries, numSamples
 	return i
 }
 
+func TestIngester_v2PushStream(t *testing.T) {
+	const userID = "test"
+
+	i, err := prepareIngesterWithBlocksStorage(t, defaultIngesterTestConfig(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until it's ACTIVE.
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	serv := grpc.NewServer(grpc.StreamInterceptor(middleware.StreamServerUserHeaderInterceptor))
+	defer serv.GracefulStop()
+	client.RegisterIngesterServer(serv, i)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	go func() {
+		require.NoError(t, serv.Serve(listener))
+	}()
+
+	c, err := client.MakeIngesterClient(listener.Addr().String(), defaultClientTestConfig())
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := user.InjectOrgID(context.Background(), userID)
+	foo := labels.Labels{{Name: labels.MetricName, Value: "foo"}}
+
+	// Push a sample, so that the older ones are rejected as out of order.
+	_, err = i.v2Push(ctx, cortexpb.ToWriteRequest([]labels.Labels{foo}, []cortexpb.Sample{{Value: 1, TimestampMs: 1000}}, nil, cortexpb.API))
+	require.NoError(t, err)
+
+	stream, err := c.PushStream(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(cortexpb.ToWriteRequest(
+		[]labels.Labels{{{Name: labels.MetricName, Value: "series_1"}}, foo},
+		[]cortexpb.Sample{{Value: 1, TimestampMs: 2000}, {Value: 2, TimestampMs: 500}},
+		nil, cortexpb.API)))
+	require.NoError(t, stream.Send(cortexpb.ToWriteRequest(
+		[]labels.Labels{{{Name: labels.MetricName, Value: "series_2"}}, foo, {{Name: labels.MetricName, Value: "series_3"}}},
+		[]cortexpb.Sample{{Value: 1, TimestampMs: 2000}, {Value: 3, TimestampMs: 1000}, {Value: 1, TimestampMs: 2000}},
+		nil, cortexpb.API)))
+
+	resp, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+
+	// Only the first error of each status code is returned, while the other ones are counted. The
+	// series are indexed across all the messages of the stream.
+	assert.Equal(t, []client.PushStreamSeriesError{{
+		SeriesIndex: 1,
+		Code:        http.StatusBadRequest,
+		Message:     wrapWithUser(wrappedTSDBIngestErr(storage.ErrOutOfOrderSample, model.Time(500), cortexpb.FromLabelsToLabelAdapters(foo)), userID).Error(),
+	}}, resp.Errors)
+	assert.Equal(t, uint32(1), resp.DroppedErrors)
+
+	// The valid series have been appended.
+	assert.Equal(t, uint64(4), i.getTSDB(userID).Head().NumSeries())
+}
+
 func TestIngester_v2QueryStream(t *testing.T) {
 	// Create ingester.
 	cfg := defaultIngesterTestConfig()
@@ -1821,6 +2069,109 @@ func TestIngester_v2QueryStream(t *testing.T) {
 	t.Run("chunks", chunksTest)
 }
 
+func TestIngester_v2QueryStream_ShouldFilterTheSeriesOfTheQueryShard(t *testing.T) {
+	const (
+		numSeries = 30
+		numShards = 3
+	)
+
+	cfg := defaultIngesterTestConfig()
+	var streamType QueryStreamType
+	cfg.StreamTypeFn = func() QueryStreamType {
+		return streamType
+	}
+
+	i, err := prepareIngesterWithBlocksStorage(t, cfg, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until it's ACTIVE.
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	// Push series.
+	ctx := user.InjectOrgID(context.Background(), userID)
+	var all []string
+	for s := 0; s < numSeries; s++ {
+		lbls := labels.Labels{{Name: labels.MetricName, Value: "foo"}, {Name: "l", Value: strconv.Itoa(s)}}
+		all = append(all, lbls.String())
+		_, err = i.v2Push(ctx, writeRequestSingleSeries(lbls, []cortexpb.Sample{{Value: 1, TimestampMs: 1000}}))
+		require.NoError(t, err)
+	}
+
+	queryShard := func(t *testing.T, shard astmapper.ShardAnnotation, query func(req *client.QueryRequest) []labels.Labels) []string {
+		var result []string
+		for _, lbls := range query(&client.QueryRequest{
+			StartTimestampMs: 0,
+			EndTimestampMs:   2000,
+			Matchers: []*client.LabelMatcher{
+				{Type: client.EQUAL, Name: model.MetricNameLabel, Value: "foo"},
+				{Type: client.EQUAL, Name: astmapper.QueryShardLabel, Value: shard.String()},
+			},
+		}) {
+			assert.True(t, shard.ContainsSeries(lbls))
+			result = append(result, lbls.String())
+		}
+		return result
+	}
+
+	queries := map[string]func(req *client.QueryRequest) []labels.Labels{
+		"query": func(req *client.QueryRequest) []labels.Labels {
+			res, err := i.v2Query(ctx, req)
+			require.NoError(t, err)
+
+			var result []labels.Labels
+			for _, ts := range res.Timeseries {
+				result = append(result, cortexpb.FromLabelAdaptersToLabels(ts.Labels))
+			}
+			return result
+		},
+		"query stream samples": func(req *client.QueryRequest) []labels.Labels {
+			streamType = QueryStreamSamples
+			stream := &labelsQueryStreamServer{mockQueryStreamServer: mockQueryStreamServer{ctx: ctx}}
+			require.NoError(t, i.v2QueryStream(req, stream))
+			return stream.labels
+		},
+		"query stream chunks": func(req *client.QueryRequest) []labels.Labels {
+			streamType = QueryStreamChunks
+			stream := &labelsQueryStreamServer{mockQueryStreamServer: mockQueryStreamServer{ctx: ctx}}
+			require.NoError(t, i.v2QueryStream(req, stream))
+			return stream.labels
+		},
+	}
+
+	for name, query := range queries {
+		t.Run(name, func(t *testing.T) {
+			// Each series is returned by exactly one shard.
+			var sharded []string
+			for shard := 0; shard < numShards; shard++ {
+				series := queryShard(t, astmapper.ShardAnnotation{Shard: shard, Of: numShards}, query)
+				assert.NotEmpty(t, series)
+				sharded = append(sharded, series...)
+			}
+			assert.ElementsMatch(t, all, sharded)
+		})
+	}
+}
+
+// labelsQueryStreamServer collects the labels of the series sent by the ingester.
+type labelsQueryStreamServer struct {
+	mockQueryStreamServer
+	labels []labels.Labels
+}
+
+func (m *labelsQueryStreamServer) Send(response *client.QueryStreamResponse) error {
+	for _, ts := range response.Timeseries {
+		m.labels = append(m.labels, cortexpb.FromLabelAdaptersToLabels(ts.Labels))
+	}
+	for _, cs := range response.Chunkseries {
+		m.labels = append(m.labels, cortexpb.FromLabelAdaptersToLabels(cs.Labels))
+	}
+	return nil
+}
+
 func TestIngester_v2QueryStreamManySamples(t *testing.T) {
 	// Create ingester.
 	i, err := prepareIngesterWithBlocksStorage(t, defaultIngesterTestConfig(), nil)
@@ -1915,6 +2266,102 @@ func TestIngester_v2QueryStreamManySamples(t *testing.T) {
 	require.Equal(t, 10000+50000+samplesCount, totalSamples)
 }
 
+func TestIngester_v2QueryStreamDownsampled(t *testing.T) {
+	// Create ingester.
+	i, err := prepareIngesterWithBlocksStorage(t, defaultIngesterTestConfig(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until it's ACTIVE.
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	// Push a series with a sample every 100ms.
+	ctx := user.InjectOrgID(context.Background(), userID)
+
+	const (
+		samplesCount = 10000
+		stepMs       = 3000
+	)
+	samples := make([]cortexpb.Sample, 0, samplesCount)
+	for i := 0; i < samplesCount; i++ {
+		samples = append(samples, cortexpb.Sample{
+			Value:       float64((i * 37) % 101),
+			TimestampMs: int64(i*100 + 1),
+		})
+	}
+
+	_, err = i.v2Push(ctx, writeRequestSingleSeries(labels.Labels{{Name: labels.MetricName, Value: "foo"}}, samples))
+	require.NoError(t, err)
+
+	// Create a GRPC server used to query back the data.
+	serv := grpc.NewServer(grpc.StreamInterceptor(middleware.StreamServerUserHeaderInterceptor))
+	defer serv.GracefulStop()
+	client.RegisterIngesterServer(serv, i)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	go func() {
+		require.NoError(t, serv.Serve(listener))
+	}()
+
+	// Query back the series using GRPC streaming.
+	c, err := client.MakeIngesterClient(listener.Addr().String(), defaultClientTestConfig())
+	require.NoError(t, err)
+	defer c.Close()
+
+	s, err := c.QueryStream(ctx, &client.QueryRequest{
+		StartTimestampMs: 0,
+		EndTimestampMs:   samplesCount * 100,
+		StepMs:           stepMs,
+		Downsample:       true,
+		Matchers: []*client.LabelMatcher{{
+			Type:  client.EQUAL,
+			Name:  model.MetricNameLabel,
+			Value: "foo",
+		}},
+	})
+	require.NoError(t, err)
+
+	var chunkSeries []client.TimeSeriesChunk
+	for {
+		resp, err := s.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Zero(t, len(resp.Timeseries)) // No samples expected
+		chunkSeries = append(chunkSeries, resp.Chunkseries...)
+	}
+	require.Len(t, chunkSeries, 1)
+	require.Len(t, chunkSeries[0].Chunks, 1)
+
+	actual, err := client.DecodeDownsampledChunk(chunkSeries[0].Chunks[0])
+	require.NoError(t, err)
+
+	// Aggregate the raw samples of each step interval, which are left-open and right-closed.
+	var expected []client.DownsampledSample
+	for _, sample := range samples {
+		if len(expected) == 0 || (sample.TimestampMs-1)/stepMs != (expected[len(expected)-1].TimestampMs-1)/stepMs {
+			expected = append(expected, client.DownsampledSample{Min: sample.Value, Max: sample.Value})
+		}
+
+		e := &expected[len(expected)-1]
+		e.TimestampMs = sample.TimestampMs
+		e.Last = sample.Value
+		e.Min = math.Min(e.Min, sample.Value)
+		e.Max = math.Max(e.Max, sample.Value)
+		e.Sum += sample.Value
+		e.Count++
+	}
+
+	assert.Len(t, actual, samplesCount*100/stepMs+1)
+	assert.Equal(t, expected, actual)
+}
+
 func TestIngester_v2QueryStreamManySamplesChunks(t *testing.T) {
 	// Create ingester.
 	cfg := defaultIngesterTestConfig()
@@ -2713,6 +3160,31 @@ func TestIngester_flushing(t *testing.T) {
 			},
 		},
 
+		"ingesterShutdownWithSeriesSnapshot": {
+			setupIngester: func(cfg *Config) {
+				cfg.BlocksStorageConfig.TSDB.FlushBlocksOnShutdown = true
+				cfg.BlocksStorageConfig.TSDB.KeepUserTSDBOpenOnShutdown = true
+				cfg.BlocksStorageConfig.TSDB.SeriesSnapshotTTL = time.Minute
+			},
+			action: func(t *testing.T, i *Ingester, reg *prometheus.Registry) {
+				now := util.TimeToMillis(time.Now())
+				pushSingleSampleAtTime(t, i, now-15000)
+				pushSingleSampleAtTime(t, i, now)
+
+				// Shutdown ingester. This triggers flushing of the block, and the series snapshot.
+				require.NoError(t, services.StopAndAwaitTerminated(context.Background(), i))
+
+				verifyCompactedHead(t, i, true)
+
+				// The snapshot has the last sample of the series.
+				series, err := cortex_tsdb.ReadSeriesSnapshots(context.Background(), i.TSDBState.bucket, userID, nil, time.Now().Add(-time.Minute), log.NewNopLogger())
+				require.NoError(t, err)
+				require.Len(t, series, 1)
+				assert.Equal(t, []cortexpb.LabelAdapter{{Name: labels.MetricName, Value: "test"}}, series[0].Labels)
+				assert.Equal(t, []cortexpb.Sample{{TimestampMs: now, Value: 0}}, series[0].Samples)
+			},
+		},
+
 		"shutdownHandler": {
 			setupIngester: func(cfg *Config) {
 				cfg.BlocksStorageConfig.TSDB.FlushBlocksOnShutdown = false
@@ -3006,6 +3478,71 @@ func Test_Ingester_v2UserStats(t *testing.T) {
 	assert.Equal(t, uint64(3), res.NumSeries)
 }
 
+func Test_Ingester_v2LocalTimeRange(t *testing.T) {
+	i, err := prepareIngesterWithBlocksStorage(t, defaultIngesterTestConfig(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until it's ACTIVE
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "test")
+
+	// The ingester holds no sample of the user.
+	res, err := i.LocalTimeRange(ctx, &client.LocalTimeRangeRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.MinTimeMs)
+
+	for _, ts := range []int64{110000, 100000, 200000} {
+		req, _, _, _ := mockWriteRequest(t, labels.Labels{{Name: labels.MetricName, Value: "test"}, {Name: "ts", Value: strconv.FormatInt(ts, 10)}}, 1, ts)
+		_, err := i.v2Push(ctx, req)
+		require.NoError(t, err)
+	}
+
+	res, err = i.LocalTimeRange(ctx, &client.LocalTimeRangeRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100000), res.MinTimeMs)
+}
+
+func Test_Ingester_v2LabelValuesCardinality(t *testing.T) {
+	i, err := prepareIngesterWithBlocksStorage(t, defaultIngesterTestConfig(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	defer services.StopAndAwaitTerminated(context.Background(), i) //nolint:errcheck
+
+	// Wait until it's ACTIVE
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "test")
+
+	// The ingester holds no series of the user.
+	res, err := i.LabelValuesCardinality(ctx, &client.LabelValuesCardinalityRequest{LabelName: labels.MetricName})
+	require.NoError(t, err)
+	assert.Empty(t, res.Items)
+
+	for _, series := range []labels.Labels{
+		{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "200"}},
+		{{Name: labels.MetricName, Value: "test_1"}, {Name: "status", Value: "500"}},
+		{{Name: labels.MetricName, Value: "test_2"}, {Name: "status", Value: "200"}},
+	} {
+		req, _, _, _ := mockWriteRequest(t, series, 1, 100000)
+		_, err := i.v2Push(ctx, req)
+		require.NoError(t, err)
+	}
+
+	res, err = i.LabelValuesCardinality(ctx, &client.LabelValuesCardinalityRequest{LabelName: labels.MetricName})
+	require.NoError(t, err)
+	assert.Equal(t, []client.LabelValueSeriesCount{
+		{LabelValue: "test_1", SeriesCount: 2},
+		{LabelValue: "test_2", SeriesCount: 1},
+	}, res.Items)
+}
+
 func Test_Ingester_v2AllUserStats(t *testing.T) {
 	series := []struct {
 		user      string
@@ -3070,6 +3607,65 @@ func Test_Ingester_v2AllUserStats(t *testing.T) {
 	assert.ElementsMatch(t, expect, res.Stats)
 }
 
+func TestIngester_PerTenantTSDBBlockRanges(t *testing.T) {
+	cfg := defaultIngesterTestConfig()
+	cfg.BlocksStorageConfig.TSDB.BlockRanges = cortex_tsdb.DurationList{2 * time.Hour}
+	cfg.CompactorBlockRanges = cortex_tsdb.DurationList{2 * time.Hour, 12 * time.Hour, 24 * time.Hour}
+
+	limits := defaultLimitsTestConfig()
+	limits.TSDBBlockRanges = cortex_tsdb.DurationList{12 * time.Hour}
+
+	i, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, "", nil)
+	require.NoError(t, err)
+
+	logs := &bytes.Buffer{}
+	i.logger = log.NewLogfmtLogger(logs)
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), i))
+	t.Cleanup(func() {
+		_ = services.StopAndAwaitTerminated(context.Background(), i)
+	})
+
+	// Wait until it's ACTIVE
+	test.Poll(t, 1*time.Second, ring.ACTIVE, func() interface{} {
+		return i.lifecycler.GetState()
+	})
+
+	// The per-tenant block ranges are applied when the TSDB is opened.
+	db, err := i.getOrCreateTSDB(userID, false)
+	require.NoError(t, err)
+	assert.Equal(t, cortex_tsdb.DurationList{12 * time.Hour}, db.blockRanges)
+	assert.Contains(t, logs.String(), `msg="TSDB block ranges changed" old=2h0m0s new=12h0m0s`)
+
+	// Changing the per-tenant block ranges takes effect when the TSDB is reopened.
+	setBlockRanges := func(blockRanges cortex_tsdb.DurationList) {
+		limits.TSDBBlockRanges = blockRanges
+		i.limits, err = validation.NewOverrides(limits, nil)
+		require.NoError(t, err)
+	}
+
+	setBlockRanges(cortex_tsdb.DurationList{time.Hour})
+	assert.Equal(t, cortex_tsdb.DurationList{12 * time.Hour}, i.getTSDB(userID).blockRanges)
+
+	logs.Reset()
+	i.closeAllTSDB()
+	db, err = i.getOrCreateTSDB(userID, false)
+	require.NoError(t, err)
+	assert.Equal(t, cortex_tsdb.DurationList{time.Hour}, db.blockRanges)
+	assert.Contains(t, logs.String(), `msg="TSDB block ranges changed" old=12h0m0s new=1h0m0s`)
+
+	// The block ranges which can't be compacted are ignored.
+	setBlockRanges(cortex_tsdb.DurationList{6 * time.Hour})
+
+	logs.Reset()
+	i.closeAllTSDB()
+	db, err = i.getOrCreateTSDB(userID, false)
+	require.NoError(t, err)
+	assert.Equal(t, cortex_tsdb.DurationList{2 * time.Hour}, db.blockRanges)
+	assert.Contains(t, logs.String(), `msg="ignoring the invalid per-tenant TSDB block ranges" block_ranges=6h0m0s`)
+	assert.Contains(t, logs.String(), `msg="TSDB block ranges changed" old=1h0m0s new=2h0m0s`)
+}
+
 func TestIngesterCompactIdleBlock(t *testing.T) {
 	cfg := defaultIngesterTestConfig()
 	cfg.LifecyclerConfig.JoinAfter = 0
@@ -25,6 +25,7 @@ type ingesterMetrics struct {
 	ingestedSamplesFail     prometheus.Counter
 	ingestedExemplarsFail   prometheus.Counter
 	ingestedMetadataFail    prometheus.Counter
+	droppedNaNSamples       *prometheus.CounterVec
 	queries                 prometheus.Counter
 	queriedSamples          prometheus.Histogram
 	queriedExemplars        prometheus.Histogram
@@ -55,6 +56,7 @@ type ingesterMetrics struct {
 	seriesEnqueuedForFlush        *prometheus.CounterVec
 	seriesDequeuedOutcome         *prometheus.CounterVec
 	droppedChunks                 prometheus.Counter
+	repairedChunks                prometheus.Counter
 	oldestUnflushedChunkTimestamp prometheus.Gauge
 
 	activeSeriesPerUser *prometheus.GaugeVec
@@ -96,6 +98,10 @@ func newIngesterMetrics(r prometheus.Registerer, createMetricsConflictingWithTSD
 			Name: "cortex_ingester_ingested_samples_failures_total",
 			Help: "The total number of samples that errored on ingestion.",
 		}),
+		droppedNaNSamples: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ingester_dropped_nan_samples_total",
+			Help: "The total number of NaN samples dropped on ingestion according to the tenant's NaN handling, by type (nan or stale).",
+		}, []string{"type"}),
 		ingestedExemplarsFail: promauto.With(r).NewCounter(prometheus.CounterOpts{
 			Name: "cortex_ingester_ingested_exemplars_failures_total",
 			Help: "The total number of exemplars that errored on ingestion.",
@@ -218,6 +224,10 @@ func newIngesterMetrics(r prometheus.Registerer, createMetricsConflictingWithTSD
 			Name: "cortex_ingester_dropped_chunks_total",
 			Help: "Total number of chunks dropped from flushing because they have too few samples.",
 		}),
+		repairedChunks: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_ingester_repaired_chunks_total",
+			Help: "Total number of chunks whose time range was inverted, ending before it starts, repaired by the ingester.",
+		}),
 		oldestUnflushedChunkTimestamp: promauto.With(r).NewGauge(prometheus.GaugeOpts{
 			Name: "cortex_oldest_unflushed_chunk_timestamp_seconds",
 			Help: "Unix timestamp of the oldest unflushed chunk in the memory",
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/chunk/encoding"
 	"github.com/cortexproject/cortex/pkg/prom1/storage/metric"
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
 )
 
 const (
@@ -38,16 +40,18 @@ type memorySeries struct {
 	lastSampleValue    model.SampleValue
 
 	// Prometheus metrics.
-	createdChunks prometheus.Counter
+	createdChunks  prometheus.Counter
+	repairedChunks prometheus.Counter
 }
 
 // newMemorySeries returns a pointer to a newly allocated memorySeries for the
 // given metric.
-func newMemorySeries(m labels.Labels, createdChunks prometheus.Counter) *memorySeries {
+func newMemorySeries(m labels.Labels, createdChunks, repairedChunks prometheus.Counter) *memorySeries {
 	return &memorySeries{
-		metric:        m,
-		lastTime:      model.Earliest,
-		createdChunks: createdChunks,
+		metric:         m,
+		lastTime:       model.Earliest,
+		createdChunks:  createdChunks,
+		repairedChunks: repairedChunks,
 	}
 }
 
@@ -130,6 +134,27 @@ func firstAndLastTimes(c encoding.Chunk) (model.Time, model.Time, error) {
 func (s *memorySeries) closeHead(reason flushReason) {
 	s.chunkDescs[0].flushReason = reason
 	s.headChunkClosed = true
+	s.repairChunk(s.head())
+}
+
+// repairChunk fixes the time range of the chunk if it's inverted, ending before it starts, which
+// isn't expected but has been seen after clock jumps. The range is recomputed from the samples of
+// the chunk, or reduced to its first time if they can't be read.
+func (s *memorySeries) repairChunk(d *desc) {
+	if d.LastTime >= d.FirstTime {
+		return
+	}
+
+	first, last, err := firstAndLastTimes(d.C)
+	if err != nil || d.C.Len() == 0 || last < first {
+		first, last = d.FirstTime, d.FirstTime
+	}
+
+	level.Warn(util_log.Logger).Log("msg", "repaired chunk with inverted time range", "series", s.metric, "firstTime", d.FirstTime, "lastTime", d.LastTime, "repairedFirstTime", first, "repairedLastTime", last, "err", err)
+	d.FirstTime, d.LastTime = first, last
+	if s.repairedChunks != nil {
+		s.repairedChunks.Inc()
+	}
 }
 
 // firstTime returns the earliest known time for the series. The caller must have
@@ -139,6 +164,16 @@ func (s *memorySeries) firstTime() model.Time {
 	return s.chunkDescs[0].FirstTime
 }
 
+// timeRange returns the timestamps of the first and last in-memory samples of the
+// series, or zero if it has no chunk descriptors. The caller must have locked the
+// fingerprint of the memorySeries.
+func (s *memorySeries) timeRange() (model.Time, model.Time) {
+	if len(s.chunkDescs) == 0 {
+		return 0, 0
+	}
+	return s.firstTime(), s.head().LastTime
+}
+
 // Returns time of oldest chunk in the series, that isn't flushed. If there are
 // no chunks, or all chunks are flushed, returns 0.
 // The caller must have locked the fingerprint of the memorySeries.
@@ -205,6 +240,10 @@ func (s *memorySeries) setChunks(descs []*desc) error {
 		return fmt.Errorf("series already has chunks")
 	}
 
+	for _, d := range descs {
+		s.repairChunk(d)
+	}
+
 	s.chunkDescs = descs
 	if len(descs) > 0 {
 		s.lastTime = descs[len(descs)-1].LastTime
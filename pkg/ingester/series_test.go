@@ -0,0 +1,63 @@
+package ingester
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/chunk/encoding"
+)
+
+func TestMemorySeries_ShouldRepairTheChunksWithInvertedTimeRange(t *testing.T) {
+	newChunk := func(from model.Time, numSamples int) encoding.Chunk {
+		c := encoding.New()
+		for i := 0; i < numSamples; i++ {
+			overflow, err := c.Add(model.SamplePair{Timestamp: from + model.Time(i*1000), Value: model.SampleValue(i)})
+			require.NoError(t, err)
+			require.Nil(t, overflow)
+		}
+		return c
+	}
+
+	t.Run("chunks set from a transfer or a checkpoint", func(t *testing.T) {
+		repaired := prometheus.NewCounter(prometheus.CounterOpts{})
+		s := newMemorySeries(labels.FromStrings(labels.MetricName, "test"), prometheus.NewCounter(prometheus.CounterOpts{}), repaired)
+
+		// The range of the second chunk is inverted, while the one of the empty third chunk can't be
+		// recomputed from its samples.
+		require.NoError(t, s.setChunks([]*desc{
+			newDesc(newChunk(0, 10), 0, 9000),
+			newDesc(newChunk(10000, 10), 19000, 10000),
+			newDesc(encoding.New(), 30000, 20000),
+		}))
+
+		assert.Equal(t, model.Time(0), s.chunkDescs[0].FirstTime)
+		assert.Equal(t, model.Time(9000), s.chunkDescs[0].LastTime)
+		assert.Equal(t, model.Time(10000), s.chunkDescs[1].FirstTime)
+		assert.Equal(t, model.Time(19000), s.chunkDescs[1].LastTime)
+		assert.Equal(t, model.Time(30000), s.chunkDescs[2].FirstTime)
+		assert.Equal(t, model.Time(30000), s.chunkDescs[2].LastTime)
+		assert.Equal(t, float64(2), promtest.ToFloat64(repaired))
+	})
+
+	t.Run("head chunk closed", func(t *testing.T) {
+		repaired := prometheus.NewCounter(prometheus.CounterOpts{})
+		s := newMemorySeries(labels.FromStrings(labels.MetricName, "test"), prometheus.NewCounter(prometheus.CounterOpts{}), repaired)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, s.add(model.SamplePair{Timestamp: model.Time(i * 1000), Value: model.SampleValue(i)}))
+		}
+
+		// Simulate a clock jump having set the last time before the first one.
+		s.head().FirstTime = 50000
+		s.closeHead(reasonAged)
+
+		assert.Equal(t, model.Time(0), s.head().FirstTime)
+		assert.Equal(t, model.Time(9000), s.head().LastTime)
+		assert.Equal(t, float64(1), promtest.ToFloat64(repaired))
+	})
+}
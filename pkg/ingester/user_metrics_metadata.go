@@ -1,10 +1,12 @@
 package ingester
 
 import (
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/prometheus/pkg/labels"
+	"go.uber.org/atomic"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/util/validation"
@@ -20,14 +22,28 @@ type userMetricsMetadata struct {
 
 	mtx              sync.RWMutex
 	metricToMetadata map[string]metricMetadataSet
+
+	// Metrics whose samples have been received without metadata, tracked only if the tenant
+	// requires the metric metadata.
+	metricsWithoutMetadata map[string]*metricWithoutMetadata
+}
+
+type metricWithoutMetadata struct {
+	firstSeen time.Time
+	lastSeen  atomic.Int64 // Unix nanoseconds.
 }
 
+// metricFamilySuffixes are the suffixes of the series names of a metric family, which the
+// metadata of the family doesn't include.
+var metricFamilySuffixes = []string{"_bucket", "_sum", "_count", "_total", "_created", "_info", "_gcount", "_gsum"}
+
 func newMetadataMap(l *Limiter, m *ingesterMetrics, userID string) *userMetricsMetadata {
 	return &userMetricsMetadata{
-		metricToMetadata: map[string]metricMetadataSet{},
-		limiter:          l,
-		metrics:          m,
-		userID:           userID,
+		metricToMetadata:       map[string]metricMetadataSet{},
+		metricsWithoutMetadata: map[string]*metricWithoutMetadata{},
+		limiter:                l,
+		metrics:                m,
+		userID:                 userID,
 	}
 }
 
@@ -65,6 +81,50 @@ func (mm *userMetricsMetadata) add(metric string, metadata *cortexpb.MetricMetad
 	return nil
 }
 
+// hasMetadataOrGracePeriod returns whether the metadata of the metric has been received, or the
+// first sample of the metric without metadata has been received less than gracePeriod ago. The
+// metric name may be the name of a series of the metric family the metadata has been received for.
+func (mm *userMetricsMetadata) hasMetadataOrGracePeriod(metric string, now time.Time, gracePeriod time.Duration) bool {
+	mm.mtx.RLock()
+	if mm.hasMetadata(metric) {
+		mm.mtx.RUnlock()
+		return true
+	}
+	m, ok := mm.metricsWithoutMetadata[metric]
+	mm.mtx.RUnlock()
+
+	if !ok {
+		mm.mtx.Lock()
+		// Ensure it was not created between switching locks.
+		if m, ok = mm.metricsWithoutMetadata[metric]; !ok {
+			m = &metricWithoutMetadata{firstSeen: now}
+			// The metric name may reference the memory of the request, so it is copied.
+			mm.metricsWithoutMetadata[string([]byte(metric))] = m
+		}
+		mm.mtx.Unlock()
+	}
+
+	m.lastSeen.Store(now.UnixNano())
+	return now.Sub(m.firstSeen) < gracePeriod
+}
+
+// hasMetadata must be called with the lock held.
+func (mm *userMetricsMetadata) hasMetadata(metric string) bool {
+	if _, ok := mm.metricToMetadata[metric]; ok {
+		return true
+	}
+
+	for _, suffix := range metricFamilySuffixes {
+		if !strings.HasSuffix(metric, suffix) {
+			continue
+		}
+		if _, ok := mm.metricToMetadata[strings.TrimSuffix(metric, suffix)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 // If deadline is zero, all metadata is purged.
 func (mm *userMetricsMetadata) purge(deadline time.Time) {
 	mm.mtx.Lock()
@@ -78,6 +138,14 @@ func (mm *userMetricsMetadata) purge(deadline time.Time) {
 		}
 	}
 
+	// The metrics which have received metadata since, or no samples before the deadline, are
+	// not tracked anymore.
+	for m, w := range mm.metricsWithoutMetadata {
+		if deadline.IsZero() || mm.hasMetadata(m) || deadline.UnixNano() > w.lastSeen.Load() {
+			delete(mm.metricsWithoutMetadata, m)
+		}
+	}
+
 	mm.metrics.memMetadata.Sub(float64(deleted))
 	mm.metrics.memMetadataRemovedTotal.WithLabelValues(mm.userID).Add(float64(deleted))
 }
@@ -56,13 +56,15 @@ type userState struct {
 	memSeriesRemovedTotal prometheus.Counter
 	discardedSamples      *prometheus.CounterVec
 	createdChunks         prometheus.Counter
+	repairedChunks        prometheus.Counter
 	activeSeriesGauge     prometheus.Gauge
 }
 
 // DiscardedSamples metric labels
 const (
-	perUserSeriesLimit   = "per_user_series_limit"
-	perMetricSeriesLimit = "per_metric_series_limit"
+	perUserSeriesLimit    = "per_user_series_limit"
+	perMetricSeriesLimit  = "per_metric_series_limit"
+	missingMetricMetadata = "missing_metric_metadata"
 )
 
 func newUserStates(limiter *Limiter, cfg Config, metrics *ingesterMetrics, logger log.Logger) *userStates {
@@ -153,6 +155,7 @@ func (us *userStates) getOrCreate(userID string) *userState {
 			memSeriesRemovedTotal: us.metrics.memSeriesRemovedTotal.WithLabelValues(userID),
 			discardedSamples:      validation.DiscardedSamples.MustCurryWith(prometheus.Labels{"user": userID}),
 			createdChunks:         us.metrics.createdChunks,
+			repairedChunks:        us.metrics.repairedChunks,
 
 			activeSeries:      NewActiveSeries(),
 			activeSeriesGauge: us.metrics.activeSeriesPerUser.WithLabelValues(userID),
@@ -264,7 +267,7 @@ func (u *userState) createSeriesWithFingerprint(fp model.Fingerprint, metric lab
 	}
 
 	labels := u.index.Add(metric, fp) // Add() returns 'interned' values so the original labels are not retained
-	series := newMemorySeries(labels, u.createdChunks)
+	series := newMemorySeries(labels, u.createdChunks, u.repairedChunks)
 	u.fpToSeries.put(fp, series)
 
 	return series, nil
@@ -38,8 +38,15 @@ type WALConfig struct {
 	Dir                string        `yaml:"wal_dir"`
 	CheckpointDuration time.Duration `yaml:"checkpoint_duration"`
 	FlushOnShutdown    bool          `yaml:"flush_on_shutdown_with_wal_enabled"`
+
+	// Checkpointing by size of the WAL written since the latest checkpoint.
+	CheckpointMaxWALSize  int64         `yaml:"checkpoint_max_wal_size"`
+	CheckpointMinInterval time.Duration `yaml:"checkpoint_min_interval"`
+
 	// We always checkpoint during shutdown. This option exists for the tests.
 	checkpointDuringShutdown bool
+	// How frequently the size of the WAL is checked. This option exists for the tests.
+	walSizeCheckInterval time.Duration
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet
@@ -50,7 +57,10 @@ func (cfg *WALConfig) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.CheckpointEnabled, "ingester.checkpoint-enabled", true, "Enable checkpointing of in-memory chunks. It should always be true when using normally. Set it to false iff you are doing some small tests as there is no mechanism to delete the old WAL yet if checkpoint is disabled.")
 	f.DurationVar(&cfg.CheckpointDuration, "ingester.checkpoint-duration", 30*time.Minute, "Interval at which checkpoints should be created.")
 	f.BoolVar(&cfg.FlushOnShutdown, "ingester.flush-on-shutdown-with-wal-enabled", false, "When WAL is enabled, should chunks be flushed to long-term storage on shutdown. Useful eg. for migration to blocks engine.")
+	f.Int64Var(&cfg.CheckpointMaxWALSize, "ingester.checkpoint-max-wal-size", 0, "Max size, in bytes, of the WAL segments written since the latest checkpoint. When exceeded, a checkpoint is created before -ingester.checkpoint-duration has elapsed, bounding the WAL replayed at startup. The WAL segment the latest checkpoint is named after is replayed too, so it should be a few times the 32MiB segment size. 0 to disable.")
+	f.DurationVar(&cfg.CheckpointMinInterval, "ingester.checkpoint-min-interval", 5*time.Minute, "Minimum interval between the start of a checkpoint and the start of a checkpoint triggered by -ingester.checkpoint-max-wal-size, preventing back-to-back checkpoints while the WAL is growing fast. The checkpoints triggered by size are paced over this interval.")
 	cfg.checkpointDuringShutdown = true
+	cfg.walSizeCheckInterval = 15 * time.Second
 }
 
 // WAL interface allows us to have a no-op WAL when the WAL is disabled.
@@ -100,6 +110,7 @@ type walWrapper struct {
 	checkpointLoggedBytesTotal prometheus.Counter
 	walLoggedBytesTotal        prometheus.Counter
 	walRecordsLogged           prometheus.Counter
+	walUncheckpointedBytes     prometheus.Gauge
 }
 
 // newWAL creates a WAL object. If the WAL is disabled, then the returned WAL is a no-op WAL.
@@ -163,6 +174,10 @@ func newWAL(cfg WALConfig, userStatesFunc func() map[string]*userState, register
 		Name: "cortex_ingester_wal_logged_bytes_total",
 		Help: "Total number of bytes written to disk for WAL records.",
 	})
+	w.walUncheckpointedBytes = promauto.With(registerer).NewGauge(prometheus.GaugeOpts{
+		Name: "cortex_ingester_wal_uncheckpointed_bytes",
+		Help: "Size of the WAL segments written since the latest checkpoint, which are replayed at startup after the checkpoint.",
+	})
 
 	w.wait.Add(1)
 	go w.run()
@@ -219,18 +234,38 @@ func (w *walWrapper) run() {
 	ticker := time.NewTicker(w.cfg.CheckpointDuration)
 	defer ticker.Stop()
 
+	var sizeCheck <-chan time.Time
+	if w.cfg.walSizeCheckInterval > 0 {
+		sizeTicker := time.NewTicker(w.cfg.walSizeCheckInterval)
+		defer sizeTicker.Stop()
+		sizeCheck = sizeTicker.C
+	}
+
+	lastCheckpointStart := time.Now()
+
 	for {
 		select {
 		case <-ticker.C:
-			start := time.Now()
-			level.Info(w.logger).Log("msg", "starting checkpoint")
-			if err := w.performCheckpoint(false); err != nil {
-				level.Error(w.logger).Log("msg", "error checkpointing series", "err", err)
+			lastCheckpointStart = time.Now()
+			w.checkpoint(w.cfg.CheckpointDuration)
+		case <-sizeCheck:
+			size, err := w.uncheckpointedWALSize()
+			if err != nil {
+				level.Warn(w.logger).Log("msg", "failed to get the size of the WAL since the latest checkpoint", "err", err)
+				continue
+			}
+			w.walUncheckpointedBytes.Set(float64(size))
+
+			if w.cfg.CheckpointMaxWALSize <= 0 || size < w.cfg.CheckpointMaxWALSize || time.Since(lastCheckpointStart) < w.cfg.CheckpointMinInterval {
 				continue
 			}
-			elapsed := time.Since(start)
-			level.Info(w.logger).Log("msg", "checkpoint done", "time", elapsed.String())
-			w.checkpointDuration.Observe(elapsed.Seconds())
+
+			level.Info(w.logger).Log("msg", "WAL size since the latest checkpoint exceeds the max size", "size", size, "max_size", w.cfg.CheckpointMaxWALSize)
+			lastCheckpointStart = time.Now()
+			w.checkpoint(w.cfg.CheckpointMinInterval)
+
+			// The next checkpoint by time is due a full period after this one.
+			ticker.Reset(w.cfg.CheckpointDuration)
 		case <-w.quit:
 			if w.cfg.checkpointDuringShutdown {
 				level.Info(w.logger).Log("msg", "creating checkpoint before shutdown")
@@ -243,9 +278,60 @@ func (w *walWrapper) run() {
 	}
 }
 
+// checkpoint creates a checkpoint, writing the series over the pacing duration.
+func (w *walWrapper) checkpoint(pacing time.Duration) {
+	start := time.Now()
+	level.Info(w.logger).Log("msg", "starting checkpoint")
+	if err := w.performPacedCheckpoint(pacing, false); err != nil {
+		level.Error(w.logger).Log("msg", "error checkpointing series", "err", err)
+		return
+	}
+	elapsed := time.Since(start)
+	level.Info(w.logger).Log("msg", "checkpoint done", "time", elapsed.String())
+	w.checkpointDuration.Observe(elapsed.Seconds())
+
+	if size, err := w.uncheckpointedWALSize(); err == nil {
+		w.walUncheckpointedBytes.Set(float64(size))
+	}
+}
+
+// uncheckpointedWALSize returns the size of the WAL segments replayed after the latest
+// checkpoint, which are all the segments starting from the one the checkpoint is named
+// after, or all the segments if there's no checkpoint.
+func (w *walWrapper) uncheckpointedWALSize() (int64, error) {
+	_, lastCh, err := lastCheckpoint(w.wal.Dir())
+	if err != nil {
+		return 0, err
+	}
+
+	files, err := ioutil.ReadDir(w.wal.Dir())
+	if err != nil {
+		return 0, err
+	}
+
+	size := int64(0)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		idx, err := strconv.Atoi(f.Name())
+		if err != nil || idx < lastCh {
+			continue
+		}
+		size += f.Size()
+	}
+	return size, nil
+}
+
 const checkpointPrefix = "checkpoint."
 
-func (w *walWrapper) performCheckpoint(immediate bool) (err error) {
+func (w *walWrapper) performCheckpoint(immediate bool) error {
+	return w.performPacedCheckpoint(w.cfg.CheckpointDuration, immediate)
+}
+
+// performPacedCheckpoint creates a checkpoint, writing the series over 95% of the pacing
+// duration unless immediate.
+func (w *walWrapper) performPacedCheckpoint(pacing time.Duration, immediate bool) (err error) {
 	if !w.cfg.CheckpointEnabled {
 		return nil
 	}
@@ -321,7 +407,12 @@ func (w *walWrapper) performCheckpoint(immediate bool) (err error) {
 		return nil
 	}
 
-	perSeriesDuration := (95 * w.cfg.CheckpointDuration) / (100 * time.Duration(numSeries))
+	perSeriesDuration := (95 * pacing) / (100 * time.Duration(numSeries))
+	if perSeriesDuration <= 0 {
+		// The series can't be paced over such a short duration.
+		immediate = true
+		perSeriesDuration = time.Second
+	}
 
 	var wireChunkBuf []client.Chunk
 	var b []byte
@@ -359,7 +450,7 @@ func (w *walWrapper) performCheckpoint(immediate bool) (err error) {
 			}
 
 			if !immediate {
-				if time.Since(start) > 2*w.cfg.CheckpointDuration {
+				if time.Since(start) > 2*pacing {
 					// This could indicate a surge in number of series and continuing with
 					// the old estimation of ticker can make checkpointing run indefinitely in worst case
 					// and disk running out of space. Re-adjust the ticker might not solve the problem
@@ -19,6 +19,7 @@ import (
 	"github.com/weaveworks/common/user"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/util/test"
 )
 
 func TestWAL(t *testing.T) {
@@ -107,6 +108,75 @@ func TestWAL(t *testing.T) {
 	retrieveTestSamples(t, ing, userIDs, testData)
 }
 
+func TestCheckpointByWALSize(t *testing.T) {
+	tests := map[string]struct {
+		minInterval         time.Duration
+		expectedCheckpoints bool
+	}{
+		"should checkpoint when the WAL size exceeds the max size": {
+			minInterval:         100 * time.Millisecond,
+			expectedCheckpoints: true,
+		},
+		"should not checkpoint before the min interval has elapsed": {
+			minInterval:         100 * time.Hour,
+			expectedCheckpoints: false,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			dirname, err := ioutil.TempDir("", "cortex-wal")
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, os.RemoveAll(dirname))
+			}()
+
+			cfg := defaultIngesterTestConfig()
+			cfg.WALConfig.WALEnabled = true
+			cfg.WALConfig.CheckpointEnabled = true
+			cfg.WALConfig.Dir = dirname
+			cfg.WALConfig.CheckpointDuration = 100 * time.Hour // Basically no checkpoint by time.
+			cfg.WALConfig.CheckpointMaxWALSize = 1024
+			cfg.WALConfig.CheckpointMinInterval = testData.minInterval
+			cfg.WALConfig.checkpointDuringShutdown = false
+			cfg.WALConfig.walSizeCheckInterval = 10 * time.Millisecond
+
+			_, ing := newTestStore(t, cfg, defaultClientTestConfig(), defaultLimitsTestConfig(), nil)
+			defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+			w, ok := ing.wal.(*walWrapper)
+			require.True(t, ok)
+
+			pushTestSamples(t, ing, 100, 10, 0)
+
+			// The size of the WAL since the latest checkpoint is tracked.
+			test.Poll(t, time.Second, true, func() interface{} {
+				return prom_testutil.ToFloat64(w.walUncheckpointedBytes) > 1024
+			})
+
+			if !testData.expectedCheckpoints {
+				time.Sleep(100 * time.Millisecond)
+				require.Equal(t, float64(0), prom_testutil.ToFloat64(w.checkpointCreationTotal))
+				return
+			}
+
+			test.Poll(t, 5*time.Second, true, func() interface{} {
+				return prom_testutil.ToFloat64(w.checkpointCreationTotal) > 0
+			})
+
+			// Once checkpointed, the WAL written since the checkpoint is below the max size. The segment the
+			// first checkpoint is named after is replayed too, so it takes a second checkpoint to get there.
+			test.Poll(t, 5*time.Second, true, func() interface{} {
+				return prom_testutil.ToFloat64(w.walUncheckpointedBytes) < 1024
+			})
+
+			_, lastCh, err := lastCheckpoint(w.wal.Dir())
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, lastCh, 0)
+		})
+	}
+}
+
 func TestCheckpointRepair(t *testing.T) {
 	cfg := defaultIngesterTestConfig()
 	cfg.WALConfig.WALEnabled = true
@@ -0,0 +1,65 @@
+package astmapper
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// QueryShardLabel is a reserved label selecting the series of a vertical shard of a query, whose value
+// is in ShardLabelFmt. Unlike ShardLabel, it's not bound to the chunks storage schema: the series are
+// selected by the hash of their labels, so it's supported by any storage.
+const QueryShardLabel = "__query_shard__"
+
+// QueryShardFromMatchers extracts the vertical shard selected by the matchers, if any, and returns the
+// matchers without it.
+func QueryShardFromMatchers(matchers []*labels.Matcher) (*ShardAnnotation, []*labels.Matcher, error) {
+	for i, matcher := range matchers {
+		if matcher.Name != QueryShardLabel {
+			continue
+		}
+		if matcher.Type != labels.MatchEqual {
+			return nil, nil, fmt.Errorf("unsupported matcher type for the %s label: %s", QueryShardLabel, matcher.Type)
+		}
+
+		shard, err := ParseShard(matcher.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		remaining := make([]*labels.Matcher, 0, len(matchers)-1)
+		remaining = append(remaining, matchers[:i]...)
+		remaining = append(remaining, matchers[i+1:]...)
+		return &shard, remaining, nil
+	}
+	return nil, matchers, nil
+}
+
+// ShardQuery returns the query selecting only the series of the given vertical shard, by adding the
+// QueryShardLabel matcher to all its selectors.
+func ShardQuery(expr parser.Expr, shard ShardAnnotation) (parser.Expr, error) {
+	matcher, err := labels.NewMatcher(labels.MatchEqual, QueryShardLabel, shard.String())
+	if err != nil {
+		return nil, err
+	}
+
+	cloned, err := CloneNode(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	parser.Inspect(cloned, func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok {
+			vs.LabelMatchers = append(vs.LabelMatchers, matcher)
+		}
+		return nil
+	})
+	return cloned.(parser.Expr), nil
+}
+
+// ContainsSeries returns whether the series with the given labels belongs to the vertical shard, whose
+// series are selected by the hash of their labels.
+func (shard ShardAnnotation) ContainsSeries(lbls labels.Labels) bool {
+	return lbls.Hash()%uint64(shard.Of) == uint64(shard.Shard)
+}
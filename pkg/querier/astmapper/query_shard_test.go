@@ -0,0 +1,55 @@
+package astmapper
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardQuery(t *testing.T) {
+	expr, err := parser.ParseExpr(`sum by (pod) (rate(http_requests_total{job="api"}[5m])) + max(max_over_time(memory_bytes[1h:1m]))`)
+	require.NoError(t, err)
+
+	sharded, err := ShardQuery(expr, ShardAnnotation{Shard: 1, Of: 3})
+	require.NoError(t, err)
+	require.Equal(t,
+		`sum by(pod) (rate(http_requests_total{__query_shard__="1_of_3",job="api"}[5m])) + max(max_over_time(memory_bytes{__query_shard__="1_of_3"}[1h:1m]))`,
+		sharded.String(),
+	)
+
+	// The original query is left untouched.
+	require.Equal(t, `sum by(pod) (rate(http_requests_total{job="api"}[5m])) + max(max_over_time(memory_bytes[1h:1m]))`, expr.String())
+}
+
+func TestQueryShardFromMatchers(t *testing.T) {
+	nameMatcher := mustLabelMatcher(labels.MatchEqual, labels.MetricName, "up")
+	jobMatcher := mustLabelMatcher(labels.MatchRegexp, "job", "api.*")
+
+	t.Run("no shard matcher", func(t *testing.T) {
+		shard, matchers, err := QueryShardFromMatchers([]*labels.Matcher{nameMatcher, jobMatcher})
+		require.NoError(t, err)
+		require.Nil(t, shard)
+		require.Equal(t, []*labels.Matcher{nameMatcher, jobMatcher}, matchers)
+	})
+
+	t.Run("shard matcher", func(t *testing.T) {
+		shardMatcher := mustLabelMatcher(labels.MatchEqual, QueryShardLabel, "2_of_4")
+		shard, matchers, err := QueryShardFromMatchers([]*labels.Matcher{nameMatcher, shardMatcher, jobMatcher})
+		require.NoError(t, err)
+		require.Equal(t, &ShardAnnotation{Shard: 2, Of: 4}, shard)
+		require.Equal(t, []*labels.Matcher{nameMatcher, jobMatcher}, matchers)
+	})
+
+	t.Run("invalid shard matcher", func(t *testing.T) {
+		for _, shardMatcher := range []*labels.Matcher{
+			mustLabelMatcher(labels.MatchEqual, QueryShardLabel, "4_of_4"),
+			mustLabelMatcher(labels.MatchEqual, QueryShardLabel, "foo"),
+			mustLabelMatcher(labels.MatchRegexp, QueryShardLabel, "1_of_4"),
+		} {
+			_, _, err := QueryShardFromMatchers([]*labels.Matcher{nameMatcher, shardMatcher})
+			require.Error(t, err)
+		}
+	})
+}
@@ -1,14 +1,29 @@
 package batch
 
 import (
+	"fmt"
+
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
 	"github.com/cortexproject/cortex/pkg/chunk/encoding"
 	promchunk "github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/cortexproject/cortex/pkg/querier/series"
 )
 
+// InvalidChunkError is the error of the iterators over chunks whose time range is inverted,
+// ending before it starts, which may be created by the ingesters after clock jumps.
+type InvalidChunkError struct {
+	Fingerprint model.Fingerprint
+	From        model.Time
+	Through     model.Time
+}
+
+func (e InvalidChunkError) Error() string {
+	return fmt.Sprintf("invalid chunk of series %s: ends at %d before it starts at %d", e.Fingerprint, e.Through, e.From)
+}
+
 // GenericChunk is a generic chunk used by the batch iterator, in order to make the batch
 // iterator general purpose.
 type GenericChunk struct {
@@ -50,9 +65,13 @@ type iterator interface {
 }
 
 // NewChunkMergeIterator returns a chunkenc.Iterator that merges Cortex chunks together.
+// The iterator fails with an InvalidChunkError if any chunk has an inverted time range.
 func NewChunkMergeIterator(chunks []chunk.Chunk, _, _ model.Time) chunkenc.Iterator {
 	converted := make([]GenericChunk, len(chunks))
 	for i, c := range chunks {
+		if c.Through < c.From {
+			return series.NewErrIterator(InvalidChunkError{Fingerprint: c.Fingerprint, From: c.From, Through: c.Through})
+		}
 		converted[i] = NewGenericChunk(int64(c.From), int64(c.Through), c.Data.NewIterator)
 	}
 
@@ -1,6 +1,7 @@
 package batch
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -76,6 +77,20 @@ func TestSeekCorrectlyDealWithSinglePointChunks(t *testing.T) {
 	require.Equal(t, int64(1*time.Second/time.Millisecond), actual)
 }
 
+func TestNewChunkMergeIterator_ShouldFailOnChunksWithInvertedTimeRange(t *testing.T) {
+	valid := mkChunk(t, 0, 10, promchunk.PrometheusXorChunk)
+	inverted := mkChunk(t, model.Time(20*step/time.Millisecond), 10, promchunk.PrometheusXorChunk)
+	inverted.From, inverted.Through = inverted.Through, inverted.From
+
+	it := NewChunkMergeIterator([]chunk.Chunk{valid, inverted}, 0, 0)
+	require.False(t, it.Next())
+
+	var invalidErr InvalidChunkError
+	require.True(t, errors.As(it.Err(), &invalidErr))
+	require.Equal(t, inverted.From, invalidErr.From)
+	require.Equal(t, inverted.Through, invalidErr.Through)
+}
+
 func createChunks(b *testing.B, numChunks, numSamplesPerChunk, duplicationFactor int, enc promchunk.Encoding) []chunk.Chunk {
 	result := make([]chunk.Chunk, 0, numChunks)
 
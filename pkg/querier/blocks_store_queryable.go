@@ -57,6 +57,8 @@ const (
 var (
 	errNoStoreGatewayAddress  = errors.New("no store-gateway address configured")
 	errMaxChunksPerQueryLimit = "the query hit the max number of chunks limit while fetching chunks from store-gateways for %s (limit: %d)"
+
+	errMaxEstimatedFetchedSeriesPerQueryLimit = "the query hit the max number of estimated fetched series limit, the blocks of its time range contain up to %d series (limit: %d)"
 )
 
 // BlocksStoreSet is the interface used to get the clients to query series on a set of blocks.
@@ -66,7 +68,7 @@ type BlocksStoreSet interface {
 	// GetClientsFor returns the store gateway clients that should be used to
 	// query the set of blocks in input. The exclude parameter is the map of
 	// blocks -> store-gateway addresses that should be excluded.
-	GetClientsFor(userID string, blockIDs []ulid.ULID, exclude map[ulid.ULID][]string) (map[BlocksStoreClient][]ulid.ULID, error)
+	GetClientsFor(userID string, blocks bucketindex.Blocks, exclude map[ulid.ULID][]string) (map[BlocksStoreClient][]ulid.ULID, error)
 }
 
 // BlocksFinder is the interface used to find blocks for a given user and time range.
@@ -93,6 +95,8 @@ type BlocksStoreLimits interface {
 	bucket.TenantConfigProvider
 
 	MaxChunksPerQueryFromStore(userID string) int
+	MaxChunksPerColdQueryFromStore(userID string) int
+	MaxEstimatedFetchedSeriesPerQuery(userID string) int
 	StoreGatewayTenantShardSize(userID string) int
 }
 
@@ -131,6 +135,9 @@ type BlocksStoreQueryable struct {
 	metrics         *blocksStoreQueryableMetrics
 	limits          BlocksStoreLimits
 
+	// The min age of the cold blocks, queried with the cold limits. 0 if disabled.
+	coldBlocksMinAge time.Duration
+
 	// Subservices manager.
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
@@ -142,6 +149,7 @@ func NewBlocksStoreQueryable(
 	consistency *BlocksConsistencyChecker,
 	limits BlocksStoreLimits,
 	queryStoreAfter time.Duration,
+	coldBlocksMinAge time.Duration,
 	logger log.Logger,
 	reg prometheus.Registerer,
 ) (*BlocksStoreQueryable, error) {
@@ -160,6 +168,7 @@ func NewBlocksStoreQueryable(
 		subservicesWatcher: services.NewFailureWatcher(),
 		metrics:            newBlocksStoreQueryableMetrics(reg),
 		limits:             limits,
+		coldBlocksMinAge:   coldBlocksMinAge,
 	}
 
 	q.Service = services.NewBasicService(q.starting, q.running, q.stopping)
@@ -225,7 +234,24 @@ func NewBlocksStoreQueryableFromConfig(querierCfg Config, gatewayCfg storegatewa
 			reg.MustRegister(storesRing)
 		}
 
-		stores, err = newBlocksStoreReplicationSet(storesRing, gatewayCfg.ShardingStrategy, randomLoadBalancing, limits, querierCfg.StoreGatewayClient, logger, reg)
+		// The cold blocks are queried from the store-gateways serving them once they have been loaded
+		// there, so we wait an extra sync interval before querying them from the cold blocks ring.
+		var coldRing *ring.Ring
+		var coldBlocksMinAge time.Duration
+		if gatewayCfg.ColdBlocksMinAge > 0 {
+			coldRing, err = ring.NewWithStoreClientAndStrategy(storesRingCfg, storegateway.ColdRingNameForClient, storegateway.ColdRingKey, storesRingBackend, ring.NewIgnoreUnhealthyInstancesReplicationStrategy())
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to create store-gateway cold blocks ring client")
+			}
+
+			if reg != nil {
+				reg.MustRegister(coldRing)
+			}
+
+			coldBlocksMinAge = gatewayCfg.ColdBlocksMinAge + storageCfg.BucketStore.SyncInterval
+		}
+
+		stores, err = newBlocksStoreReplicationSet(storesRing, coldRing, coldBlocksMinAge, gatewayCfg.ShardingStrategy, randomLoadBalancing, limits, querierCfg.StoreGatewayClient, logger, reg)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to create store set")
 		}
@@ -249,7 +275,7 @@ func NewBlocksStoreQueryableFromConfig(querierCfg Config, gatewayCfg storegatewa
 		reg,
 	)
 
-	return NewBlocksStoreQueryable(stores, finder, consistency, limits, querierCfg.QueryStoreAfter, logger, reg)
+	return NewBlocksStoreQueryable(stores, finder, consistency, limits, querierCfg.QueryStoreAfter, gatewayCfg.ColdBlocksMinAge, logger, reg)
 }
 
 func (q *BlocksStoreQueryable) starting(ctx context.Context) error {
@@ -289,20 +315,45 @@ func (q *BlocksStoreQueryable) Querier(ctx context.Context, mint, maxt int64) (s
 	}
 
 	return &blocksStoreQuerier{
-		ctx:             ctx,
-		minT:            mint,
-		maxT:            maxt,
-		userID:          userID,
-		finder:          q.finder,
-		stores:          q.stores,
-		metrics:         q.metrics,
-		limits:          q.limits,
-		consistency:     q.consistency,
-		logger:          q.logger,
-		queryStoreAfter: q.queryStoreAfter,
+		ctx:              ctx,
+		minT:             mint,
+		maxT:             maxt,
+		userID:           userID,
+		finder:           q.finder,
+		stores:           q.stores,
+		metrics:          q.metrics,
+		limits:           q.limits,
+		consistency:      q.consistency,
+		logger:           q.logger,
+		queryStoreAfter:  q.queryStoreAfter,
+		coldBlocksMinAge: q.coldBlocksMinAge,
 	}, nil
 }
 
+// Prefetch looks up the series matching the request through the store-gateways, without fetching
+// their chunks, so that the store-gateways load the index headers of the queried blocks and populate
+// the index cache with the postings and series. It returns the number of series found.
+func (q *BlocksStoreQueryable) Prefetch(ctx context.Context, req storegateway.PrefetchRequest) (int, error) {
+	querier, err := q.Querier(ctx, req.MinT, req.MaxT)
+	if err != nil {
+		return 0, err
+	}
+	defer querier.Close()
+
+	seriesCount := 0
+	for _, matchers := range req.Matchers {
+		set := querier.Select(true, &storage.SelectHints{Start: req.MinT, End: req.MaxT, Func: "series"}, matchers...)
+		for set.Next() {
+			seriesCount++
+		}
+		if err := set.Err(); err != nil {
+			return seriesCount, err
+		}
+	}
+
+	return seriesCount, nil
+}
+
 type blocksStoreQuerier struct {
 	ctx         context.Context
 	minT, maxT  int64
@@ -317,6 +368,9 @@ type blocksStoreQuerier struct {
 	// If set, the querier manipulates the max time to not be greater than
 	// "now - queryStoreAfter" so that most recent blocks are not queried.
 	queryStoreAfter time.Duration
+
+	// If set, the queries reading blocks older than this age are subject to the cold limits.
+	coldBlocksMinAge time.Duration
 }
 
 // Select implements storage.Querier interface.
@@ -352,7 +406,7 @@ func (q *blocksStoreQuerier) LabelNames(matchers ...*labels.Matcher) ([]string,
 		return queriedBlocks, nil
 	}
 
-	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, queryFunc)
+	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, 0, queryFunc)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -387,7 +441,7 @@ func (q *blocksStoreQuerier) LabelValues(name string, matchers ...*labels.Matche
 		return queriedBlocks, nil
 	}
 
-	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, queryFunc)
+	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, 0, queryFunc)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -413,7 +467,7 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 		resSeriesSets     = []storage.SeriesSet(nil)
 		resWarnings       = storage.Warnings(nil)
 
-		maxChunksLimit  = q.limits.MaxChunksPerQueryFromStore(q.userID)
+		maxChunksLimit  = q.getMaxChunksLimit(minT)
 		leftChunksLimit = maxChunksLimit
 
 		resultMtx sync.Mutex
@@ -440,7 +494,7 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 		return queriedBlocks, nil
 	}
 
-	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, queryFunc)
+	err := q.queryWithConsistencyCheck(spanCtx, spanLog, minT, maxT, q.limits.MaxEstimatedFetchedSeriesPerQuery(q.userID), queryFunc)
 	if err != nil {
 		return storage.ErrSeriesSet(err)
 	}
@@ -454,7 +508,20 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 		resWarnings)
 }
 
-func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logger log.Logger, minT, maxT int64,
+// getMaxChunksLimit returns the max number of chunks which can be fetched from the store-gateways
+// by a query starting at minT.
+func (q *blocksStoreQuerier) getMaxChunksLimit(minT int64) int {
+	if storegateway.IsColdBlock(minT, time.Now(), q.coldBlocksMinAge) {
+		return q.limits.MaxChunksPerColdQueryFromStore(q.userID)
+	}
+	return q.limits.MaxChunksPerQueryFromStore(q.userID)
+}
+
+// queryWithConsistencyCheck runs queryFunc on the blocks within the time range, retrying the blocks
+// not queried on other store-gateways. If maxEstimatedSeries is greater than 0, the query is rejected
+// before querying the store-gateways when the blocks contain more series, according to their stats
+// in the bucket index.
+func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logger log.Logger, minT, maxT int64, maxEstimatedSeries int,
 	queryFunc func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error)) error {
 	// If queryStoreAfter is enabled, we do manipulate the query maxt to query samples up until
 	// now - queryStoreAfter, because the most recent time range is covered by ingesters. This
@@ -490,9 +557,17 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logg
 
 	level.Debug(logger).Log("msg", "found blocks to query", "expected", knownBlocks.String())
 
+	// The limit can't be enforced if the stats of some blocks are unknown, like in the bucket
+	// indexes written by the previous versions.
+	if maxEstimatedSeries > 0 {
+		if numSeries, ok := knownBlocks.NumSeries(); ok && numSeries > uint64(maxEstimatedSeries) {
+			return validation.LimitError(fmt.Sprintf(errMaxEstimatedFetchedSeriesPerQueryLimit, numSeries, maxEstimatedSeries))
+		}
+	}
+
 	var (
 		// At the beginning the list of blocks to query are all known blocks.
-		remainingBlocks = knownBlocks.GetULIDs()
+		remainingBlocks = knownBlocks
 		attemptedBlocks = map[ulid.ULID][]string{}
 		touchedStores   = map[string]struct{}{}
 
@@ -500,6 +575,12 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logg
 	)
 
 	for attempt := 1; attempt <= maxFetchSeriesAttempts; attempt++ {
+		// Don't retry if the context has been canceled or its deadline exceeded in the meanwhile,
+		// like when the query is about to time out.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// Find the set of store-gateway instances having the blocks. The exclude parameter is the
 		// map of blocks queried so far, with the list of store-gateway addresses for each block.
 		clients, err := q.stores.GetClientsFor(q.userID, remainingBlocks, attemptedBlocks)
@@ -546,12 +627,12 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(ctx context.Context, logg
 		level.Debug(logger).Log("msg", "consistency check failed", "attempt", attempt, "missing blocks", strings.Join(convertULIDsToString(missingBlocks), " "))
 
 		// The next attempt should just query the missing blocks.
-		remainingBlocks = missingBlocks
+		remainingBlocks = filterBlocksByIDs(knownBlocks, missingBlocks)
 	}
 
 	// We've not been able to query all expected blocks after all retries.
 	level.Warn(util_log.WithContext(ctx, logger)).Log("msg", "failed consistency check", "err", err)
-	return fmt.Errorf("consistency check failed because some blocks were not queried: %s", strings.Join(convertULIDsToString(remainingBlocks), " "))
+	return fmt.Errorf("consistency check failed because some blocks were not queried: %s", strings.Join(convertULIDsToString(remainingBlocks.GetULIDs()), " "))
 }
 
 func (q *blocksStoreQuerier) fetchSeriesFromStores(
@@ -578,6 +659,10 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(
 		reqStats      = stats.FromContext(ctx)
 	)
 
+	defer func(start time.Time) {
+		reqStats.AddStoreGatewayWallTime(time.Since(start))
+	}(time.Now())
+
 	// Concurrently fetch series from all clients.
 	for c, blockIDs := range clients {
 		// Change variables scope since it will be used in a goroutine.
@@ -666,9 +751,11 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(
 			}
 
 			numSeries := len(mySeries)
+			numChunks := countChunks(mySeries...)
 			chunkBytes := countChunkBytes(mySeries...)
 
 			reqStats.AddFetchedSeries(uint64(numSeries))
+			reqStats.AddFetchedChunks(uint64(numChunks))
 			reqStats.AddFetchedChunkBytes(uint64(chunkBytes))
 
 			level.Debug(spanLog).Log("msg", "received series from store-gateway",
@@ -937,6 +1024,20 @@ func createLabelValuesRequest(minT, maxT int64, label string, blockIDs []ulid.UL
 	return req, nil
 }
 
+// filterBlocksByIDs returns the blocks whose ID is in the input list.
+func filterBlocksByIDs(blocks bucketindex.Blocks, ids []ulid.ULID) bucketindex.Blocks {
+	res := make(bucketindex.Blocks, 0, len(ids))
+	for _, block := range blocks {
+		for _, id := range ids {
+			if block.ID == id {
+				res = append(res, block)
+				break
+			}
+		}
+	}
+	return res
+}
+
 func convertULIDsToString(ids []ulid.ULID) []string {
 	res := make([]string, len(ids))
 	for idx, id := range ids {
@@ -960,6 +1061,15 @@ func convertBlockHintsToULIDs(hints []hintspb.Block) ([]ulid.ULID, error) {
 	return res, nil
 }
 
+// countChunks returns the number of the chunks making up the provided series
+func countChunks(series ...*storepb.Series) (count int) {
+	for _, s := range series {
+		count += len(s.Chunks)
+	}
+
+	return count
+}
+
 // countChunkBytes returns the size of the chunks making up the provided series in bytes
 func countChunkBytes(series ...*storepb.Series) (count int) {
 	for _, s := range series {
@@ -30,6 +30,7 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
+	"github.com/cortexproject/cortex/pkg/storegateway"
 	"github.com/cortexproject/cortex/pkg/storegateway/storegatewaypb"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/limiter"
@@ -566,6 +567,59 @@ func TestBlocksStoreQuerier_Select(t *testing.T) {
 			queryLimiter: limiter.NewQueryLimiter(1, 0, 0),
 			expectedErr:  validation.LimitError(fmt.Sprintf(limiter.ErrMaxSeriesHit, 1)),
 		},
+		"max estimated fetched series per query limit hit before querying the store-gateways": {
+			finderResult: bucketindex.Blocks{
+				{ID: block1, NumSeries: 2},
+				{ID: block2, NumSeries: 2},
+			},
+			limits:       &blocksStoreLimitsMock{maxEstimatedFetchedSeriesPerQuery: 3},
+			queryLimiter: noOpQueryLimiter,
+			expectedErr:  validation.LimitError(fmt.Sprintf(errMaxEstimatedFetchedSeriesPerQueryLimit, 4, 3)),
+		},
+		"max estimated fetched series per query limit not hit": {
+			finderResult: bucketindex.Blocks{
+				{ID: block1, NumSeries: 2},
+				{ID: block2, NumSeries: 2},
+			},
+			storeSetResponses: []interface{}{
+				map[BlocksStoreClient][]ulid.ULID{
+					&storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedSeriesResponses: []*storepb.SeriesResponse{
+						mockSeriesResponse(labels.Labels{metricNameLabel, series1Label}, minT, 1),
+						mockHintsResponse(block1, block2),
+					}}: {block1, block2},
+				},
+			},
+			limits:       &blocksStoreLimitsMock{maxEstimatedFetchedSeriesPerQuery: 4},
+			queryLimiter: noOpQueryLimiter,
+			expectedSeries: []seriesResult{
+				{
+					lbls:   labels.New(metricNameLabel, series1Label),
+					values: []valueResult{{t: minT, v: 1}},
+				},
+			},
+		},
+		"max estimated fetched series per query limit not enforced if the stats of some blocks are unknown": {
+			finderResult: bucketindex.Blocks{
+				{ID: block1, NumSeries: 2},
+				{ID: block2},
+			},
+			storeSetResponses: []interface{}{
+				map[BlocksStoreClient][]ulid.ULID{
+					&storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedSeriesResponses: []*storepb.SeriesResponse{
+						mockSeriesResponse(labels.Labels{metricNameLabel, series1Label}, minT, 1),
+						mockHintsResponse(block1, block2),
+					}}: {block1, block2},
+				},
+			},
+			limits:       &blocksStoreLimitsMock{maxEstimatedFetchedSeriesPerQuery: 1},
+			queryLimiter: noOpQueryLimiter,
+			expectedSeries: []seriesResult{
+				{
+					lbls:   labels.New(metricNameLabel, series1Label),
+					values: []valueResult{{t: minT, v: 1}},
+				},
+			},
+		},
 		"max chunk bytes per query limit hit while fetching chunks": {
 			finderResult: bucketindex.Blocks{
 				{ID: block1},
@@ -1201,6 +1255,18 @@ func TestBlocksStoreQuerier_SelectSortedShouldHonorQueryStoreAfter(t *testing.T)
 	}
 }
 
+func TestBlocksStoreQuerier_ShouldApplyTheColdLimitsToTheColdQueries(t *testing.T) {
+	now := time.Now()
+	limits := &blocksStoreLimitsMock{maxChunksPerQuery: 10, maxChunksPerColdQuery: 100}
+
+	q := &blocksStoreQuerier{userID: "user-1", limits: limits}
+	assert.Equal(t, 10, q.getMaxChunksLimit(util.TimeToMillis(now.Add(-48*time.Hour))))
+
+	q.coldBlocksMinAge = 24 * time.Hour
+	assert.Equal(t, 10, q.getMaxChunksLimit(util.TimeToMillis(now.Add(-time.Hour))))
+	assert.Equal(t, 100, q.getMaxChunksLimit(util.TimeToMillis(now.Add(-48*time.Hour))))
+}
+
 func TestBlocksStoreQuerier_PromQLExecution(t *testing.T) {
 	block1 := ulid.MustNew(1, nil)
 	block2 := ulid.MustNew(2, nil)
@@ -1293,7 +1359,7 @@ func TestBlocksStoreQuerier_PromQLExecution(t *testing.T) {
 
 	// Instance the querier that will be executed to run the query.
 	logger := log.NewNopLogger()
-	queryable, err := NewBlocksStoreQueryable(stores, finder, NewBlocksConsistencyChecker(0, 0, logger, nil), &blocksStoreLimitsMock{}, 0, logger, nil)
+	queryable, err := NewBlocksStoreQueryable(stores, finder, NewBlocksConsistencyChecker(0, 0, logger, nil), &blocksStoreLimitsMock{}, 0, 0, logger, nil)
 	require.NoError(t, err)
 	require.NoError(t, services.StartAndAwaitRunning(context.Background(), queryable))
 	defer services.StopAndAwaitTerminated(context.Background(), queryable) // nolint:errcheck
@@ -1323,6 +1389,69 @@ func TestBlocksStoreQuerier_PromQLExecution(t *testing.T) {
 	assert.Equal(t, series2Samples, matrix[1].Points)
 }
 
+func TestBlocksStoreQueryable_Prefetch(t *testing.T) {
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+	series1 := []labelpb.ZLabel{{Name: "__name__", Value: "metric_1"}}
+	series2 := []labelpb.ZLabel{{Name: "__name__", Value: "metric_2"}}
+
+	finder := &blocksFinderMock{
+		Service: services.NewIdleService(nil, nil),
+	}
+	finder.On("GetBlocks", mock.Anything, "user-1", mock.Anything, mock.Anything).Return(bucketindex.Blocks{
+		{ID: block1},
+		{ID: block2},
+	}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), error(nil))
+
+	// Each block is queried from a different store-gateway, both returning the same series.
+	newGateway := func(addr string, block ulid.ULID) *storeGatewayClientMock {
+		return &storeGatewayClientMock{remoteAddr: addr, mockedSeriesResponses: []*storepb.SeriesResponse{
+			mockSeriesResponse(labelpb.ZLabelsToPromLabels(series1), 0, 0),
+			mockSeriesResponse(labelpb.ZLabelsToPromLabels(series2), 0, 0),
+			mockHintsResponse(block),
+		}}
+	}
+	gateway1 := newGateway("1.1.1.1", block1)
+	gateway2 := newGateway("2.2.2.2", block2)
+
+	clients := map[BlocksStoreClient][]ulid.ULID{
+		gateway1: {block1},
+		gateway2: {block2},
+	}
+	stores := &blocksStoreSetMock{
+		Service:         services.NewIdleService(nil, nil),
+		mockedResponses: []interface{}{clients, clients},
+	}
+
+	logger := log.NewNopLogger()
+	queryable, err := NewBlocksStoreQueryable(stores, finder, NewBlocksConsistencyChecker(0, 0, logger, nil), &blocksStoreLimitsMock{}, 0, 0, logger, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), queryable))
+	defer services.StopAndAwaitTerminated(context.Background(), queryable) // nolint:errcheck
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	seriesCount, err := queryable.Prefetch(ctx, storegateway.PrefetchRequest{
+		MinT: 10,
+		MaxT: 20,
+		Matchers: [][]*labels.Matcher{
+			{labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, "metric_.*")},
+			{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "metric_1")},
+		},
+	})
+	require.NoError(t, err)
+
+	// The series are deduplicated across store-gateways within each lookup.
+	assert.Equal(t, 4, seriesCount)
+
+	// The chunks should not be fetched.
+	for _, gateway := range []*storeGatewayClientMock{gateway1, gateway2} {
+		require.Len(t, gateway.seriesRequests, 2)
+		for _, req := range gateway.seriesRequests {
+			assert.True(t, req.SkipChunks)
+		}
+	}
+}
+
 type blocksStoreSetMock struct {
 	services.Service
 
@@ -1330,7 +1459,7 @@ type blocksStoreSetMock struct {
 	nextResult      int
 }
 
-func (m *blocksStoreSetMock) GetClientsFor(_ string, _ []ulid.ULID, _ map[ulid.ULID][]string) (map[BlocksStoreClient][]ulid.ULID, error) {
+func (m *blocksStoreSetMock) GetClientsFor(_ string, _ bucketindex.Blocks, _ map[ulid.ULID][]string) (map[BlocksStoreClient][]ulid.ULID, error) {
 	if m.nextResult >= len(m.mockedResponses) {
 		panic("not enough mocked results")
 	}
@@ -1363,9 +1492,14 @@ type storeGatewayClientMock struct {
 	mockedSeriesResponses     []*storepb.SeriesResponse
 	mockedLabelNamesResponse  *storepb.LabelNamesResponse
 	mockedLabelValuesResponse *storepb.LabelValuesResponse
+
+	// The received series requests.
+	seriesRequests []*storepb.SeriesRequest
 }
 
 func (m *storeGatewayClientMock) Series(ctx context.Context, in *storepb.SeriesRequest, opts ...grpc.CallOption) (storegatewaypb.StoreGateway_SeriesClient, error) {
+	m.seriesRequests = append(m.seriesRequests, in)
+
 	seriesClient := &storeGatewaySeriesClientMock{
 		mockedResponses: m.mockedSeriesResponses,
 	}
@@ -1405,14 +1539,27 @@ func (m *storeGatewaySeriesClientMock) Recv() (*storepb.SeriesResponse, error) {
 }
 
 type blocksStoreLimitsMock struct {
-	maxChunksPerQuery           int
-	storeGatewayTenantShardSize int
+	maxChunksPerQuery                 int
+	maxChunksPerColdQuery             int
+	maxEstimatedFetchedSeriesPerQuery int
+	storeGatewayTenantShardSize       int
 }
 
 func (m *blocksStoreLimitsMock) MaxChunksPerQueryFromStore(_ string) int {
 	return m.maxChunksPerQuery
 }
 
+func (m *blocksStoreLimitsMock) MaxChunksPerColdQueryFromStore(_ string) int {
+	if m.maxChunksPerColdQuery > 0 {
+		return m.maxChunksPerColdQuery
+	}
+	return m.maxChunksPerQuery
+}
+
+func (m *blocksStoreLimitsMock) MaxEstimatedFetchedSeriesPerQuery(_ string) int {
+	return m.maxEstimatedFetchedSeriesPerQuery
+}
+
 func (m *blocksStoreLimitsMock) StoreGatewayTenantShardSize(_ string) int {
 	return m.storeGatewayTenantShardSize
 }
@@ -1429,6 +1576,10 @@ func (m *blocksStoreLimitsMock) S3SSEKMSEncryptionContext(_ string) string {
 	return ""
 }
 
+func (m *blocksStoreLimitsMock) ClientSideEncryptionKeyID(_ string) string {
+	return ""
+}
+
 func mockSeriesResponse(lbls labels.Labels, timeMillis int64, value float64) *storepb.SeriesResponse {
 	// Generate a chunk containing a single value (for simplicity).
 	chunk := chunkenc.NewXORChunk()
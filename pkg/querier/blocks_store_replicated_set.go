@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/grafana/dskit/services"
@@ -14,6 +15,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/ring/client"
 	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
 	"github.com/cortexproject/cortex/pkg/storegateway"
 	"github.com/cortexproject/cortex/pkg/util"
 )
@@ -36,6 +38,11 @@ type blocksStoreReplicationSet struct {
 	balancingStrategy loadBalancingStrategy
 	limits            BlocksStoreLimits
 
+	// Ring of the store-gateways serving the cold blocks, and the min age of the blocks queried
+	// from there. Nil if the cold blocks are disabled.
+	coldRing         *ring.Ring
+	coldBlocksMinAge time.Duration
+
 	// Subservices manager.
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
@@ -43,6 +50,8 @@ type blocksStoreReplicationSet struct {
 
 func newBlocksStoreReplicationSet(
 	storesRing *ring.Ring,
+	coldRing *ring.Ring,
+	coldBlocksMinAge time.Duration,
 	shardingStrategy string,
 	balancingStrategy loadBalancingStrategy,
 	limits BlocksStoreLimits,
@@ -50,16 +59,25 @@ func newBlocksStoreReplicationSet(
 	logger log.Logger,
 	reg prometheus.Registerer,
 ) (*blocksStoreReplicationSet, error) {
+	discovery := client.NewRingServiceDiscovery(storesRing)
+	deps := []services.Service{storesRing}
+	if coldRing != nil {
+		discovery = mergeServiceDiscoveries(discovery, client.NewRingServiceDiscovery(coldRing))
+		deps = append(deps, coldRing)
+	}
+
 	s := &blocksStoreReplicationSet{
 		storesRing:        storesRing,
-		clientsPool:       newStoreGatewayClientPool(client.NewRingServiceDiscovery(storesRing), clientConfig, logger, reg),
+		clientsPool:       newStoreGatewayClientPool(discovery, clientConfig, logger, reg),
 		shardingStrategy:  shardingStrategy,
 		balancingStrategy: balancingStrategy,
 		limits:            limits,
+		coldRing:          coldRing,
+		coldBlocksMinAge:  coldBlocksMinAge,
 	}
 
 	var err error
-	s.subservices, err = services.NewManager(s.storesRing, s.clientsPool)
+	s.subservices, err = services.NewManager(append(deps, s.clientsPool)...)
 	if err != nil {
 		return nil, err
 	}
@@ -94,20 +112,32 @@ func (s *blocksStoreReplicationSet) stopping(_ error) error {
 	return services.StopManagerAndAwaitStopped(context.Background(), s.subservices)
 }
 
-func (s *blocksStoreReplicationSet) GetClientsFor(userID string, blockIDs []ulid.ULID, exclude map[ulid.ULID][]string) (map[BlocksStoreClient][]ulid.ULID, error) {
+func (s *blocksStoreReplicationSet) GetClientsFor(userID string, blocks bucketindex.Blocks, exclude map[ulid.ULID][]string) (map[BlocksStoreClient][]ulid.ULID, error) {
 	shards := map[string][]ulid.ULID{}
+	now := time.Now()
 
 	// If shuffle sharding is enabled, we should build a subring for the user,
 	// otherwise we just use the full ring.
-	var userRing ring.ReadRing
-	if s.shardingStrategy == util.ShardingStrategyShuffle {
-		userRing = storegateway.GetShuffleShardingSubring(s.storesRing, userID, s.limits)
-	} else {
-		userRing = s.storesRing
+	userRing := s.getUserRing(s.storesRing, userID)
+
+	var userColdRing ring.ReadRing
+	if s.coldRing != nil {
+		userColdRing = s.getUserRing(s.coldRing, userID)
 	}
 
 	// Find the replication set of each block we need to query.
-	for _, blockID := range blockIDs {
+	for _, block := range blocks {
+		blockID := block.ID
+
+		// The cold blocks are queried from the cold store-gateways, falling back to the other
+		// store-gateways if there's no cold store-gateway left for the block.
+		if userColdRing != nil && storegateway.IsColdBlock(block.MinTime, now, s.coldBlocksMinAge) {
+			if addr := getStoreGatewayAddr(userColdRing, blockID, exclude[blockID], s.balancingStrategy); addr != "" {
+				shards[addr] = append(shards[addr], blockID)
+				continue
+			}
+		}
+
 		// Do not reuse the same buffer across multiple Get() calls because we do retain the
 		// returned replication set.
 		bufDescs, bufHosts, bufZones := ring.MakeBuffersForGet()
@@ -141,6 +171,41 @@ func (s *blocksStoreReplicationSet) GetClientsFor(userID string, blockIDs []ulid
 	return clients, nil
 }
 
+func (s *blocksStoreReplicationSet) getUserRing(r *ring.Ring, userID string) ring.ReadRing {
+	if s.shardingStrategy == util.ShardingStrategyShuffle {
+		return storegateway.GetShuffleShardingSubring(r, userID, s.limits)
+	}
+	return r
+}
+
+// getStoreGatewayAddr returns the address of a non excluded store-gateway instance owning the block,
+// or an empty string if there's none.
+func getStoreGatewayAddr(r ring.ReadRing, blockID ulid.ULID, exclude []string, balancingStrategy loadBalancingStrategy) string {
+	bufDescs, bufHosts, bufZones := ring.MakeBuffersForGet()
+
+	set, err := r.Get(cortex_tsdb.HashBlockID(blockID), storegateway.BlocksRead, bufDescs, bufHosts, bufZones)
+	if err != nil {
+		return ""
+	}
+
+	return getNonExcludedInstanceAddr(set, exclude, balancingStrategy)
+}
+
+// mergeServiceDiscoveries returns a service discovery returning the addresses of all the input ones.
+func mergeServiceDiscoveries(discoveries ...client.PoolServiceDiscovery) client.PoolServiceDiscovery {
+	return func() ([]string, error) {
+		var addrs []string
+		for _, discovery := range discoveries {
+			res, err := discovery()
+			if err != nil {
+				return nil, err
+			}
+			addrs = append(addrs, res...)
+		}
+		return addrs, nil
+	}
+}
+
 func getNonExcludedInstanceAddr(set ring.ReplicationSet, exclude []string, balancingStrategy loadBalancingStrategy) string {
 	if balancingStrategy == randomLoadBalancing {
 		// Randomize the list of instances to not always query the same one.
@@ -18,6 +18,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/ring/kv/consul"
 	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/cortexproject/cortex/pkg/util/test"
@@ -347,7 +348,7 @@ func TestBlocksStoreReplicationSet_GetClientsFor(t *testing.T) {
 			}
 
 			reg := prometheus.NewPedanticRegistry()
-			s, err := newBlocksStoreReplicationSet(r, testData.shardingStrategy, noLoadBalancing, limits, ClientConfig{}, log.NewNopLogger(), reg)
+			s, err := newBlocksStoreReplicationSet(r, nil, 0, testData.shardingStrategy, noLoadBalancing, limits, ClientConfig{}, log.NewNopLogger(), reg)
 			require.NoError(t, err)
 			require.NoError(t, services.StartAndAwaitRunning(ctx, s))
 			defer services.StopAndAwaitTerminated(ctx, s) //nolint:errcheck
@@ -358,7 +359,7 @@ func TestBlocksStoreReplicationSet_GetClientsFor(t *testing.T) {
 				return err == nil && len(all.Instances) > 0
 			})
 
-			clients, err := s.GetClientsFor(userID, testData.queryBlocks, testData.exclude)
+			clients, err := s.GetClientsFor(userID, makeBlocksFromIDs(testData.queryBlocks...), testData.exclude)
 			assert.Equal(t, testData.expectedErr, err)
 
 			if testData.expectedErr == nil {
@@ -405,7 +406,7 @@ func TestBlocksStoreReplicationSet_GetClientsFor_ShouldSupportRandomLoadBalancin
 
 	limits := &blocksStoreLimitsMock{}
 	reg := prometheus.NewPedanticRegistry()
-	s, err := newBlocksStoreReplicationSet(r, util.ShardingStrategyDefault, randomLoadBalancing, limits, ClientConfig{}, log.NewNopLogger(), reg)
+	s, err := newBlocksStoreReplicationSet(r, nil, 0, util.ShardingStrategyDefault, randomLoadBalancing, limits, ClientConfig{}, log.NewNopLogger(), reg)
 	require.NoError(t, err)
 	require.NoError(t, services.StartAndAwaitRunning(ctx, s))
 	defer services.StopAndAwaitTerminated(ctx, s) //nolint:errcheck
@@ -421,7 +422,7 @@ func TestBlocksStoreReplicationSet_GetClientsFor_ShouldSupportRandomLoadBalancin
 	distribution := map[string]int{}
 
 	for n := 0; n < numRuns; n++ {
-		clients, err := s.GetClientsFor(userID, []ulid.ULID{block1}, nil)
+		clients, err := s.GetClientsFor(userID, bucketindex.Blocks{{ID: block1}}, nil)
 		require.NoError(t, err)
 		require.Len(t, clients, 1)
 
@@ -445,3 +446,93 @@ func getStoreGatewayClientAddrs(clients map[BlocksStoreClient][]ulid.ULID) map[s
 	}
 	return addrs
 }
+
+func makeBlocksFromIDs(ids ...ulid.ULID) bucketindex.Blocks {
+	blocks := make(bucketindex.Blocks, 0, len(ids))
+	for _, id := range ids {
+		blocks = append(blocks, &bucketindex.Block{ID: id})
+	}
+	return blocks
+}
+
+func TestBlocksStoreReplicationSet_GetClientsFor_ShouldQueryTheColdBlocksFromTheColdRing(t *testing.T) {
+	const coldBlocksMinAge = 24 * time.Hour
+
+	ctx := context.Background()
+	userID := "user-A"
+	now := time.Now()
+
+	hotBlock := &bucketindex.Block{ID: ulid.MustNew(1, nil), MinTime: util.TimeToMillis(now.Add(-time.Hour))}
+	coldBlock := &bucketindex.Block{ID: ulid.MustNew(2, nil), MinTime: util.TimeToMillis(now.Add(-2 * coldBlocksMinAge))}
+
+	tests := map[string]struct {
+		setupColdRing   func(*ring.Desc)
+		exclude         map[ulid.ULID][]string
+		expectedClients map[string][]ulid.ULID
+	}{
+		"should query the cold blocks from the cold store-gateways": {
+			setupColdRing: func(d *ring.Desc) {
+				d.AddIngester("instance-cold", "127.0.0.2", "", []uint32{1}, ring.ACTIVE, now)
+			},
+			expectedClients: map[string][]ulid.ULID{
+				"127.0.0.1": {hotBlock.ID},
+				"127.0.0.2": {coldBlock.ID},
+			},
+		},
+		"should fallback to the hot store-gateways if the cold blocks ring is empty": {
+			setupColdRing: func(d *ring.Desc) {},
+			expectedClients: map[string][]ulid.ULID{
+				"127.0.0.1": {hotBlock.ID, coldBlock.ID},
+			},
+		},
+		"should fallback to the hot store-gateways if the cold store-gateways are excluded": {
+			setupColdRing: func(d *ring.Desc) {
+				d.AddIngester("instance-cold", "127.0.0.2", "", []uint32{1}, ring.ACTIVE, now)
+			},
+			exclude: map[ulid.ULID][]string{coldBlock.ID: {"127.0.0.2"}},
+			expectedClients: map[string][]ulid.ULID{
+				"127.0.0.1": {hotBlock.ID, coldBlock.ID},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ringStore := consul.NewInMemoryClient(ring.GetCodec())
+			require.NoError(t, ringStore.CAS(ctx, "hot", func(in interface{}) (interface{}, bool, error) {
+				d := ring.NewDesc()
+				d.AddIngester("instance-hot", "127.0.0.1", "", []uint32{1}, ring.ACTIVE, now)
+				return d, true, nil
+			}))
+			require.NoError(t, ringStore.CAS(ctx, "cold", func(in interface{}) (interface{}, bool, error) {
+				d := ring.NewDesc()
+				testData.setupColdRing(d)
+				return d, true, nil
+			}))
+
+			ringCfg := ring.Config{}
+			flagext.DefaultValues(&ringCfg)
+			ringCfg.ReplicationFactor = 1
+
+			hotRing, err := ring.NewWithStoreClientAndStrategy(ringCfg, "hot", "hot", ringStore, ring.NewIgnoreUnhealthyInstancesReplicationStrategy())
+			require.NoError(t, err)
+			coldRing, err := ring.NewWithStoreClientAndStrategy(ringCfg, "cold", "cold", ringStore, ring.NewIgnoreUnhealthyInstancesReplicationStrategy())
+			require.NoError(t, err)
+
+			s, err := newBlocksStoreReplicationSet(hotRing, coldRing, coldBlocksMinAge, util.ShardingStrategyDefault, noLoadBalancing, &blocksStoreLimitsMock{}, ClientConfig{}, log.NewNopLogger(), nil)
+			require.NoError(t, err)
+			require.NoError(t, services.StartAndAwaitRunning(ctx, s))
+			defer services.StopAndAwaitTerminated(ctx, s) //nolint:errcheck
+
+			// Wait until the ring client has initialised the state.
+			test.Poll(t, time.Second, true, func() interface{} {
+				all, err := hotRing.GetAllHealthy(ring.Read)
+				return err == nil && len(all.Instances) > 0
+			})
+
+			clients, err := s.GetClientsFor(userID, bucketindex.Blocks{hotBlock, coldBlock}, testData.exclude)
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedClients, getStoreGatewayClientAddrs(clients))
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package querier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+const (
+	// The default number of label names or values returned by the cardinality endpoints.
+	defaultCardinalityLimit = 20
+
+	// The default time range analysed by the cardinality endpoints, ending now.
+	defaultCardinalityTimeRange = time.Hour
+)
+
+// CardinalityLimits is the per-tenant limits used by the cardinality analysis endpoints.
+type CardinalityLimits interface {
+	CardinalityAnalysisMaxLimit(userID string) int
+}
+
+type labelNamesCardinalityResponse struct {
+	SeriesCountTotal      int                        `json:"series_count_total"`
+	LabelNamesCount       int                        `json:"label_names_count"`
+	LabelValuesCountTotal int                        `json:"label_values_count_total"`
+	Cardinality           []labelNameCardinalityItem `json:"cardinality"`
+}
+
+type labelNameCardinalityItem struct {
+	LabelName        string `json:"label_name"`
+	LabelValuesCount int    `json:"label_values_count"`
+}
+
+type labelValuesCardinalityResponse struct {
+	SeriesCountTotal int                          `json:"series_count_total"`
+	Labels           []labelNameValuesCardinality `json:"labels"`
+}
+
+type labelNameValuesCardinality struct {
+	LabelName        string                      `json:"label_name"`
+	LabelValuesCount int                         `json:"label_values_count"`
+	SeriesCount      int                         `json:"series_count"`
+	Cardinality      []labelValueCardinalityItem `json:"cardinality"`
+}
+
+type labelValueCardinalityItem struct {
+	LabelValue  string `json:"label_value"`
+	SeriesCount int    `json:"series_count"`
+}
+
+// LabelNamesCardinalityHandler returns the label names with the highest number of values, among the
+// series of the tenant matching the optional selector in the requested time range. The series are
+// read from the queryable, which deduplicates the series replicated across ingesters and the
+// long-term storage.
+func LabelNamesCardinalityHandler(queryable storage.Queryable, limits CardinalityLimits) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseCardinalityRequest(r, limits, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		seriesCount := 0
+		valuesByName := map[string]map[string]struct{}{}
+
+		err = forEachSeriesLabels(r.Context(), queryable, req, func(lbls labels.Labels) {
+			seriesCount++
+			for _, l := range lbls {
+				values, ok := valuesByName[l.Name]
+				if !ok {
+					values = map[string]struct{}{}
+					valuesByName[l.Name] = values
+				}
+				values[l.Value] = struct{}{}
+			}
+		})
+		if err != nil {
+			writeCardinalityError(w, err)
+			return
+		}
+
+		resp := labelNamesCardinalityResponse{
+			SeriesCountTotal: seriesCount,
+			LabelNamesCount:  len(valuesByName),
+			Cardinality:      make([]labelNameCardinalityItem, 0, len(valuesByName)),
+		}
+		for name, values := range valuesByName {
+			resp.LabelValuesCountTotal += len(values)
+			resp.Cardinality = append(resp.Cardinality, labelNameCardinalityItem{LabelName: name, LabelValuesCount: len(values)})
+		}
+
+		sort.Slice(resp.Cardinality, func(i, j int) bool {
+			if resp.Cardinality[i].LabelValuesCount != resp.Cardinality[j].LabelValuesCount {
+				return resp.Cardinality[i].LabelValuesCount > resp.Cardinality[j].LabelValuesCount
+			}
+			return resp.Cardinality[i].LabelName < resp.Cardinality[j].LabelName
+		})
+		if len(resp.Cardinality) > req.limit {
+			resp.Cardinality = resp.Cardinality[:req.limit]
+		}
+
+		util.WriteJSONResponse(w, resp)
+	})
+}
+
+// LabelValuesCardinalityHandler returns, for each requested label name, the label values with the
+// highest number of series, among the series of the tenant matching the optional selector in the
+// requested time range. The series are read from the queryable, which deduplicates the series
+// replicated across ingesters and the long-term storage.
+func LabelValuesCardinalityHandler(queryable storage.Queryable, limits CardinalityLimits) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseCardinalityRequest(r, limits, true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		seriesCount := 0
+		seriesByValueByName := make(map[string]map[string]int, len(req.labelNames))
+		for _, name := range req.labelNames {
+			seriesByValueByName[name] = map[string]int{}
+		}
+
+		err = forEachSeriesLabels(r.Context(), queryable, req, func(lbls labels.Labels) {
+			seriesCount++
+			for _, l := range lbls {
+				if seriesByValue, ok := seriesByValueByName[l.Name]; ok {
+					seriesByValue[l.Value]++
+				}
+			}
+		})
+		if err != nil {
+			writeCardinalityError(w, err)
+			return
+		}
+
+		resp := labelValuesCardinalityResponse{
+			SeriesCountTotal: seriesCount,
+			Labels:           make([]labelNameValuesCardinality, 0, len(req.labelNames)),
+		}
+		for _, name := range req.labelNames {
+			seriesByValue := seriesByValueByName[name]
+			item := labelNameValuesCardinality{
+				LabelName:        name,
+				LabelValuesCount: len(seriesByValue),
+				Cardinality:      make([]labelValueCardinalityItem, 0, len(seriesByValue)),
+			}
+			for value, count := range seriesByValue {
+				item.SeriesCount += count
+				item.Cardinality = append(item.Cardinality, labelValueCardinalityItem{LabelValue: value, SeriesCount: count})
+			}
+
+			sort.Slice(item.Cardinality, func(i, j int) bool {
+				if item.Cardinality[i].SeriesCount != item.Cardinality[j].SeriesCount {
+					return item.Cardinality[i].SeriesCount > item.Cardinality[j].SeriesCount
+				}
+				return item.Cardinality[i].LabelValue < item.Cardinality[j].LabelValue
+			})
+			if len(item.Cardinality) > req.limit {
+				item.Cardinality = item.Cardinality[:req.limit]
+			}
+
+			resp.Labels = append(resp.Labels, item)
+		}
+
+		util.WriteJSONResponse(w, resp)
+	})
+}
+
+type cardinalityRequest struct {
+	start, end int64
+	matchers   []*labels.Matcher
+	labelNames []string
+	limit      int
+}
+
+func parseCardinalityRequest(r *http.Request, limits CardinalityLimits, withLabelNames bool) (cardinalityRequest, error) {
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		return cardinalityRequest{}, err
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return cardinalityRequest{}, err
+	}
+
+	req := cardinalityRequest{
+		end:   util.TimeToMillis(time.Now()),
+		limit: defaultCardinalityLimit,
+	}
+
+	if v := r.FormValue("end"); v != "" {
+		if req.end, err = util.ParseTime(v); err != nil {
+			return cardinalityRequest{}, err
+		}
+	}
+
+	req.start = req.end - defaultCardinalityTimeRange.Milliseconds()
+	if v := r.FormValue("start"); v != "" {
+		if req.start, err = util.ParseTime(v); err != nil {
+			return cardinalityRequest{}, err
+		}
+	}
+	if req.start > req.end {
+		return cardinalityRequest{}, errors.New("the start time must be before the end time")
+	}
+
+	if v := r.FormValue("selector"); v != "" {
+		if req.matchers, err = parser.ParseMetricSelector(v); err != nil {
+			return cardinalityRequest{}, err
+		}
+	} else {
+		// Select all the series of the tenant.
+		req.matchers = []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, model.MetricNameLabel, ".+")}
+	}
+
+	maxLimit := limits.CardinalityAnalysisMaxLimit(userID)
+	if v := r.FormValue("limit"); v != "" {
+		if req.limit, err = strconv.Atoi(v); err != nil || req.limit <= 0 {
+			return cardinalityRequest{}, fmt.Errorf("invalid limit %q, the value must be a positive integer", v)
+		}
+		if maxLimit > 0 && req.limit > maxLimit {
+			return cardinalityRequest{}, fmt.Errorf("the limit %d exceeds the max allowed limit %d", req.limit, maxLimit)
+		}
+	} else if maxLimit > 0 && req.limit > maxLimit {
+		// The default limit is capped to the max allowed one.
+		req.limit = maxLimit
+	}
+
+	if withLabelNames {
+		for _, name := range r.Form["label_names[]"] {
+			if !model.LabelName(name).IsValid() {
+				return cardinalityRequest{}, fmt.Errorf("invalid label name %q", name)
+			}
+			req.labelNames = append(req.labelNames, name)
+		}
+		if len(req.labelNames) == 0 {
+			return cardinalityRequest{}, errors.New("at least one label name must be specified with the label_names[] parameter")
+		}
+	}
+
+	return req, nil
+}
+
+// forEachSeriesLabels calls f with the labels of each series matching the request.
+func forEachSeriesLabels(ctx context.Context, queryable storage.Queryable, req cardinalityRequest, f func(labels.Labels)) error {
+	q, err := queryable.Querier(ctx, req.start, req.end)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	set := q.Select(true, &storage.SelectHints{Start: req.start, End: req.end, Func: "series"}, req.matchers...)
+	for set.Next() {
+		f(set.At().Labels())
+	}
+
+	return set.Err()
+}
+
+func writeCardinalityError(w http.ResponseWriter, err error) {
+	if errors.As(err, new(validation.LimitError)) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,198 @@
+package querier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/purger"
+	"github.com/cortexproject/cortex/pkg/prom1/storage/metric"
+	"github.com/cortexproject/cortex/pkg/querier/batch"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestCardinalityHandlers(t *testing.T) {
+	// The two ingesters have some series in common, which should be counted only once.
+	ingester1Series := []metric.Metric{
+		{Metric: model.Metric{model.MetricNameLabel: "up", "job": "api", "instance": "a"}},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "job": "api", "instance": "b"}},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "job": "db", "instance": "c"}},
+	}
+	ingester2Series := []metric.Metric{
+		{Metric: model.Metric{model.MetricNameLabel: "up", "job": "api", "instance": "b"}},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "job": "db", "instance": "c"}},
+		{Metric: model.Metric{model.MetricNameLabel: "requests_total", "job": "api", "instance": "d"}},
+	}
+
+	tests := map[string]struct {
+		handler          func(storage.Queryable, CardinalityLimits) http.Handler
+		params           url.Values
+		expectedStatus   int
+		expectedResponse interface{}
+	}{
+		"label names cardinality": {
+			handler:        LabelNamesCardinalityHandler,
+			params:         url.Values{},
+			expectedStatus: http.StatusOK,
+			expectedResponse: labelNamesCardinalityResponse{
+				SeriesCountTotal:      4,
+				LabelNamesCount:       3,
+				LabelValuesCountTotal: 8,
+				Cardinality: []labelNameCardinalityItem{
+					{LabelName: "instance", LabelValuesCount: 4},
+					{LabelName: "__name__", LabelValuesCount: 2},
+					{LabelName: "job", LabelValuesCount: 2},
+				},
+			},
+		},
+		"label names cardinality with selector and limit": {
+			handler:        LabelNamesCardinalityHandler,
+			params:         url.Values{"selector": []string{`{job="api"}`}, "limit": []string{"1"}},
+			expectedStatus: http.StatusOK,
+			expectedResponse: labelNamesCardinalityResponse{
+				SeriesCountTotal:      3,
+				LabelNamesCount:       3,
+				LabelValuesCountTotal: 6,
+				Cardinality: []labelNameCardinalityItem{
+					{LabelName: "instance", LabelValuesCount: 3},
+				},
+			},
+		},
+		"label names cardinality with limit exceeding the max allowed limit": {
+			handler:        LabelNamesCardinalityHandler,
+			params:         url.Values{"limit": []string{"11"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"label values cardinality": {
+			handler:        LabelValuesCardinalityHandler,
+			params:         url.Values{"label_names[]": []string{"job", "__name__"}},
+			expectedStatus: http.StatusOK,
+			expectedResponse: labelValuesCardinalityResponse{
+				SeriesCountTotal: 4,
+				Labels: []labelNameValuesCardinality{
+					{
+						LabelName:        "job",
+						LabelValuesCount: 2,
+						SeriesCount:      4,
+						Cardinality: []labelValueCardinalityItem{
+							{LabelValue: "api", SeriesCount: 3},
+							{LabelValue: "db", SeriesCount: 1},
+						},
+					}, {
+						LabelName:        "__name__",
+						LabelValuesCount: 2,
+						SeriesCount:      4,
+						Cardinality: []labelValueCardinalityItem{
+							{LabelValue: "up", SeriesCount: 3},
+							{LabelValue: "requests_total", SeriesCount: 1},
+						},
+					},
+				},
+			},
+		},
+		"label values cardinality with limit": {
+			handler:        LabelValuesCardinalityHandler,
+			params:         url.Values{"label_names[]": []string{"instance"}, "limit": []string{"2"}},
+			expectedStatus: http.StatusOK,
+			expectedResponse: labelValuesCardinalityResponse{
+				SeriesCountTotal: 4,
+				Labels: []labelNameValuesCardinality{
+					{
+						LabelName:        "instance",
+						LabelValuesCount: 4,
+						SeriesCount:      4,
+						Cardinality: []labelValueCardinalityItem{
+							{LabelValue: "a", SeriesCount: 1},
+							{LabelValue: "b", SeriesCount: 1},
+						},
+					},
+				},
+			},
+		},
+		"label values cardinality without label names": {
+			handler:        LabelValuesCardinalityHandler,
+			params:         url.Values{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			limits := defaultLimitsConfig()
+			limits.CardinalityAnalysisMaxLimit = 10
+			overrides, err := validation.NewOverrides(limits, nil)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/cardinality", strings.NewReader(testData.params.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+			rec := httptest.NewRecorder()
+
+			var matchers []*labels.Matcher
+			if selector := testData.params.Get("selector"); selector != "" {
+				matchers, err = parser.ParseMetricSelector(selector)
+				require.NoError(t, err)
+			}
+
+			// Each ingester returns the series matching the selector, with the series in common
+			// being returned by both of them.
+			ingester1 := &mockDistributor{}
+			ingester1.On("MetricsForLabelMatchers", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(filterSeries(ingester1Series, matchers), nil)
+			ingester2 := &mockDistributor{}
+			ingester2.On("MetricsForLabelMatchers", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(filterSeries(ingester2Series, matchers), nil)
+
+			cfg := Config{QueryStoreForLabels: true}
+			queryable := NewQueryable(
+				newDistributorQueryable(ingester1, false, false, nil, 0),
+				[]QueryableWithFilter{UseAlwaysQueryable(newDistributorQueryable(ingester2, false, false, nil, 0))},
+				batch.NewChunkMergeIterator, cfg, overrides, purger.NewTombstonesLoader(nil, nil))
+
+			testData.handler(queryable, overrides).ServeHTTP(rec, req)
+			require.Equal(t, testData.expectedStatus, rec.Code, rec.Body.String())
+
+			if testData.expectedStatus != http.StatusOK {
+				return
+			}
+
+			switch expected := testData.expectedResponse.(type) {
+			case labelNamesCardinalityResponse:
+				actual := labelNamesCardinalityResponse{}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+				assert.Equal(t, expected, actual)
+			case labelValuesCardinalityResponse:
+				actual := labelValuesCardinalityResponse{}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &actual))
+				assert.Equal(t, expected, actual)
+			}
+		})
+	}
+}
+
+// filterSeries returns the series matching all the input matchers, like an ingester would do.
+func filterSeries(series []metric.Metric, matchers []*labels.Matcher) []metric.Metric {
+	var filtered []metric.Metric
+
+outer:
+	for _, s := range series {
+		for _, m := range matchers {
+			if !m.Matches(string(s.Metric[model.LabelName(m.Name)])) {
+				continue outer
+			}
+		}
+		filtered = append(filtered, s)
+	}
+
+	return filtered
+}
@@ -13,6 +13,8 @@ import (
 	"github.com/cortexproject/cortex/pkg/querier/chunkstore"
 	seriesset "github.com/cortexproject/cortex/pkg/querier/series"
 	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/limiter"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 type chunkIteratorFunc func(chunks []chunk.Chunk, from, through model.Time) chunkenc.Iterator
@@ -56,7 +58,16 @@ func (q *chunkStoreQuerier) Select(_ bool, sp *storage.SelectHints, matchers ...
 		return storage.ErrSeriesSet(err)
 	}
 
-	return partitionChunks(chunks, q.mint, q.maxt, q.chunkIteratorFunc)
+	// Enforce the max chunk bytes limit, which is shared with the chunks fetched from the ingesters.
+	chunksSize := 0
+	for _, c := range chunks {
+		chunksSize += c.Data.Size()
+	}
+	if chunkBytesLimitErr := limiter.QueryLimiterFromContextWithFallback(q.ctx).AddChunkBytes(chunksSize); chunkBytesLimitErr != nil {
+		return storage.ErrSeriesSet(validation.LimitError(chunkBytesLimitErr.Error()))
+	}
+
+	return partitionChunks(chunks, q.mint, q.maxt, chunkIteratorFuncFromContext(q.ctx, q.chunkIteratorFunc))
 }
 
 // Series in the returned set are sorted alphabetically by labels.
@@ -3,16 +3,22 @@ package querier
 import (
 	"context"
 	"fmt"
+	"math"
 	"sort"
 	"testing"
 	"time"
 
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
 	promchunk "github.com/cortexproject/cortex/pkg/chunk/encoding"
+	"github.com/cortexproject/cortex/pkg/util/limiter"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 // Make sure that chunkSeries implements SeriesWithChunks
@@ -32,6 +38,53 @@ func TestChunkQueryable(t *testing.T) {
 	}
 }
 
+func TestChunkStoreQuerier_ShouldEnforceMaxChunkBytesPerQuery(t *testing.T) {
+	store, _ := makeMockChunkStore(t, 4, promchunk.PrometheusXorChunk)
+
+	storeChunksSize := 0
+	for _, c := range store.chunks {
+		storeChunksSize += c.Data.Size()
+	}
+
+	tests := map[string]struct {
+		limit              int
+		ingesterChunksSize int
+		expectedErr        error
+	}{
+		"should succeed if the store chunks are within the limit": {
+			limit: storeChunksSize,
+		},
+		"should fail if the store chunks alone exceed the limit": {
+			limit:       storeChunksSize - 1,
+			expectedErr: validation.LimitError(fmt.Sprintf(limiter.ErrMaxChunkBytesHit, storeChunksSize-1)),
+		},
+		"should fail if the ingester and store chunks combined exceed the limit": {
+			limit:              storeChunksSize,
+			ingesterChunksSize: 1,
+			expectedErr:        validation.LimitError(fmt.Sprintf(limiter.ErrMaxChunkBytesHit, storeChunksSize)),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			queryLimiter := limiter.NewQueryLimiter(0, testData.limit, 0)
+			ctx := limiter.AddQueryLimiterToContext(user.InjectOrgID(context.Background(), userID), queryLimiter)
+
+			// Simulate the chunks already fetched from the ingesters for the same query.
+			require.NoError(t, queryLimiter.AddChunkBytes(testData.ingesterChunksSize))
+
+			queryable := newChunkStoreQueryable(store, mergeChunks)
+			q, err := queryable.Querier(ctx, 0, math.MaxInt64)
+			require.NoError(t, err)
+
+			set := q.Select(true, &storage.SelectHints{Start: 0, End: math.MaxInt64}, labels.MustNewMatcher(labels.MatchEqual, model.MetricNameLabel, "foo"))
+			for set.Next() {
+			}
+			assert.Equal(t, testData.expectedErr, set.Err())
+		})
+	}
+}
+
 type mockChunkStore struct {
 	chunks []chunk.Chunk
 }
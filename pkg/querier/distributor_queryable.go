@@ -2,6 +2,8 @@ package querier
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sort"
 	"time"
 
@@ -11,11 +13,14 @@ import (
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/scrape"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
 	"github.com/cortexproject/cortex/pkg/prom1/storage/metric"
+	"github.com/cortexproject/cortex/pkg/querier/astmapper"
 	"github.com/cortexproject/cortex/pkg/querier/series"
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
 	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/chunkcompat"
@@ -30,15 +35,18 @@ type Distributor interface {
 	QueryStream(ctx context.Context, from, to model.Time, matchers ...*labels.Matcher) (*client.QueryStreamResponse, error)
 	QueryExemplars(ctx context.Context, from, to model.Time, matchers ...[]*labels.Matcher) (*client.ExemplarQueryResponse, error)
 	LabelValuesForLabelName(ctx context.Context, from, to model.Time, label model.LabelName, matchers ...*labels.Matcher) ([]string, error)
-	LabelNames(context.Context, model.Time, model.Time) ([]string, error)
+	LabelNames(ctx context.Context, from, to model.Time, matchers ...*labels.Matcher) ([]string, error)
 	MetricsForLabelMatchers(ctx context.Context, from, through model.Time, matchers ...*labels.Matcher) ([]metric.Metric, error)
+	MetricsForLabelMatchersWithTimeRange(ctx context.Context, from, through model.Time, matchersSet ...[]*labels.Matcher) (*client.MetricsForLabelMatchersResponse, error)
 	MetricsMetadata(ctx context.Context) ([]scrape.MetricMetadata, error)
+	IngestersMinTime(ctx context.Context) (int64, error)
 }
 
-func newDistributorQueryable(distributor Distributor, streaming bool, iteratorFn chunkIteratorFunc, queryIngestersWithin time.Duration) QueryableWithFilter {
+func newDistributorQueryable(distributor Distributor, streaming, lazyDecoding bool, iteratorFn chunkIteratorFunc, queryIngestersWithin time.Duration) distributorQueryable {
 	return distributorQueryable{
 		distributor:          distributor,
 		streaming:            streaming,
+		lazyDecoding:         lazyDecoding,
 		iteratorFn:           iteratorFn,
 		queryIngestersWithin: queryIngestersWithin,
 	}
@@ -47,8 +55,23 @@ func newDistributorQueryable(distributor Distributor, streaming bool, iteratorFn
 type distributorQueryable struct {
 	distributor          Distributor
 	streaming            bool
+	lazyDecoding         bool
 	iteratorFn           chunkIteratorFunc
 	queryIngestersWithin time.Duration
+
+	// The blocks finder used to extend the queryIngestersWithin period when the
+	// long-term storage has no blocks preceding it. Nil if disabled.
+	blocksFinder                     BlocksFinder
+	queryIngestersWithinMaxExtension time.Duration
+}
+
+// withQueryIngestersWithinExtension returns a copy of the queryable which extends the
+// queryIngestersWithin period by up to maxExtension when the blocks finder has no blocks
+// covering the time range preceding it.
+func (d distributorQueryable) withQueryIngestersWithinExtension(finder BlocksFinder, maxExtension time.Duration) distributorQueryable {
+	d.blocksFinder = finder
+	d.queryIngestersWithinMaxExtension = maxExtension
+	return d
 }
 
 func (d distributorQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
@@ -58,14 +81,27 @@ func (d distributorQueryable) Querier(ctx context.Context, mint, maxt int64) (st
 		mint:                 mint,
 		maxt:                 maxt,
 		streaming:            d.streaming,
+		lazyDecoding:         d.lazyDecoding,
 		chunkIterFn:          d.iteratorFn,
 		queryIngestersWithin: d.queryIngestersWithin,
+
+		blocksFinder:                     d.blocksFinder,
+		queryIngestersWithinMaxExtension: d.queryIngestersWithinMaxExtension,
 	}, nil
 }
 
 func (d distributorQueryable) UseQueryable(now time.Time, _, queryMaxT int64) bool {
-	// Include ingester only if maxt is within QueryIngestersWithin w.r.t. current time.
-	return d.queryIngestersWithin == 0 || queryMaxT >= util.TimeToMillis(now.Add(-d.queryIngestersWithin))
+	if d.queryIngestersWithin == 0 {
+		return true
+	}
+
+	// Include ingester only if maxt is within QueryIngestersWithin w.r.t. current time,
+	// or within its extension when enabled.
+	lookback := d.queryIngestersWithin
+	if d.blocksFinder != nil {
+		lookback += d.queryIngestersWithinMaxExtension
+	}
+	return queryMaxT >= util.TimeToMillis(now.Add(-lookback))
 }
 
 type distributorQuerier struct {
@@ -73,8 +109,12 @@ type distributorQuerier struct {
 	ctx                  context.Context
 	mint, maxt           int64
 	streaming            bool
+	lazyDecoding         bool
 	chunkIterFn          chunkIteratorFunc
 	queryIngestersWithin time.Duration
+
+	blocksFinder                     BlocksFinder
+	queryIngestersWithinMaxExtension time.Duration
 }
 
 // Select implements storage.Querier interface.
@@ -91,10 +131,20 @@ func (q *distributorQuerier) Select(_ bool, sp *storage.SelectHints, matchers ..
 	// Also, in the recent versions of Prometheus, we pass in the hint but with Func set to "series".
 	// See: https://github.com/prometheus/prometheus/pull/8050
 	if sp == nil || sp.Func == "series" {
+		// The ingesters filter the series of the vertical shard of the query only when querying
+		// the samples, so the series are filtered once fetched.
+		shard, matchers, err := astmapper.QueryShardFromMatchers(matchers)
+		if err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+
 		ms, err := q.distributor.MetricsForLabelMatchers(ctx, model.Time(q.mint), model.Time(q.maxt), matchers...)
 		if err != nil {
 			return storage.ErrSeriesSet(err)
 		}
+		if shard != nil {
+			return series.NewShardedSeriesSet(series.MetricsToSeriesSet(ms), shard.Shard, shard.Of)
+		}
 		return series.MetricsToSeriesSet(ms)
 	}
 
@@ -104,10 +154,21 @@ func (q *distributorQuerier) Select(_ bool, sp *storage.SelectHints, matchers ..
 	// now - queryIngestersWithin, because older time ranges are covered by the storage. This
 	// optimization is particularly important for the blocks storage where the blocks retention in the
 	// ingesters could be way higher than queryIngestersWithin.
+	var warnings storage.Warnings
 	if q.queryIngestersWithin > 0 {
 		now := time.Now()
 		origMinT := minT
-		minT = math.Max64(minT, util.TimeToMillis(now.Add(-q.queryIngestersWithin)))
+		withinMinT := util.TimeToMillis(now.Add(-q.queryIngestersWithin))
+		minT = math.Max64(minT, withinMinT)
+
+		// When the long-term storage has no blocks for part of the time range preceding the
+		// queryIngestersWithin period, the samples are fetched from the ingesters if they still hold them.
+		if origMinT < withinMinT && q.blocksFinder != nil {
+			if extendedMinT, ok := q.extendedMinTime(ctx, log, now, origMinT, maxT, withinMinT); ok {
+				minT = extendedMinT
+				warnings = append(warnings, fmt.Errorf("the long-term storage has no blocks for the time range starting at %s: the samples have been fetched from the ingesters beyond the query-ingesters-within period", util.TimeFromMillis(minT).UTC().Format(time.RFC3339)))
+			}
+		}
 
 		if origMinT != minT {
 			level.Debug(log).Log("msg", "the min time of the query to ingesters has been manipulated", "original", origMinT, "updated", minT)
@@ -120,7 +181,12 @@ func (q *distributorQuerier) Select(_ bool, sp *storage.SelectHints, matchers ..
 	}
 
 	if q.streaming {
-		return q.streamingSelect(ctx, minT, maxT, matchers)
+		// The ingesters can downsample the series only if the query has been marked as compatible
+		// with the downsampling, and only for range queries.
+		if client.DownsamplingFunctionFromContext(ctx) != "" && sp.Step > 0 {
+			ctx = client.ContextWithDownsamplingStep(ctx, sp.Step)
+		}
+		return withWarnings(q.streamingSelect(ctx, minT, maxT, matchers), warnings)
 	}
 
 	matrix, err := q.distributor.Query(ctx, model.Time(minT), model.Time(maxT), matchers...)
@@ -129,7 +195,70 @@ func (q *distributorQuerier) Select(_ bool, sp *storage.SelectHints, matchers ..
 	}
 
 	// Using MatrixToSeriesSet (and in turn NewConcreteSeriesSet), sorts the series.
-	return series.MatrixToSeriesSet(matrix)
+	return withWarnings(series.MatrixToSeriesSet(matrix), warnings)
+}
+
+// extendedMinTime returns the min time of the query to the ingesters extended beyond the
+// queryIngestersWithin period, down to the first point in time not covered by the blocks in the
+// long-term storage. The extension is bounded by queryIngestersWithinMaxExtension and by the oldest
+// sample held by the ingesters. Returns false if the time range is covered by the blocks.
+func (q *distributorQuerier) extendedMinTime(ctx context.Context, log *spanlogger.SpanLogger, now time.Time, queryMinT, queryMaxT, withinMinT int64) (int64, bool) {
+	minT := math.Max64(queryMinT, util.TimeToMillis(now.Add(-q.queryIngestersWithin-q.queryIngestersWithinMaxExtension)))
+	maxT := math.Min64(queryMaxT, withinMinT)
+
+	ingestersMinT, err := q.distributor.IngestersMinTime(ctx)
+	if err != nil {
+		level.Warn(log).Log("msg", "failed to fetch the min time of the ingesters, the query to ingesters will not be extended", "err", err)
+		return 0, false
+	}
+	if ingestersMinT == 0 || ingestersMinT > maxT {
+		return 0, false
+	}
+	minT = math.Max64(minT, ingestersMinT)
+	if minT > maxT {
+		return 0, false
+	}
+
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return 0, false
+	}
+
+	blocks, _, err := q.blocksFinder.GetBlocks(ctx, userID, minT, maxT)
+	if err != nil {
+		level.Warn(log).Log("msg", "failed to find the blocks, the query to ingesters will not be extended", "err", err)
+		return 0, false
+	}
+
+	// The blocks are sorted by MaxTime descending, while the coverage is computed from the oldest block.
+	sorted := make(bucketindex.Blocks, len(blocks))
+	copy(sorted, blocks)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].MinTime < sorted[j].MinTime
+	})
+
+	// The block max time is exclusive, so covered is the first point in time not covered by the blocks.
+	covered := minT
+	for _, b := range sorted {
+		if b.MinTime > covered {
+			break
+		}
+		covered = math.Max64(covered, b.MaxTime)
+	}
+
+	if covered > maxT {
+		return 0, false
+	}
+
+	level.Info(log).Log("msg", "the long-term storage has no blocks for part of the query time range, the query to ingesters has been extended", "query_ingesters_within_min_time", withinMinT, "updated", covered)
+	return covered, true
+}
+
+func withWarnings(set storage.SeriesSet, warnings storage.Warnings) storage.SeriesSet {
+	if len(warnings) == 0 {
+		return set
+	}
+	return series.NewSeriesSetWithWarnings(set, warnings)
 }
 
 func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int64, matchers []*labels.Matcher) storage.SeriesSet {
@@ -143,13 +272,25 @@ func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int
 		return storage.ErrSeriesSet(err)
 	}
 
+	chunkIterFn := chunkIteratorFuncFromContext(ctx, q.chunkIterFn)
+
 	sets := []storage.SeriesSet(nil)
 	if len(results.Timeseries) > 0 {
 		sets = append(sets, newTimeSeriesSeriesSet(results.Timeseries))
 	}
 
 	serieses := make([]storage.Series, 0, len(results.Chunkseries))
+	downsampled := []cortexpb.TimeSeries(nil)
 	for _, result := range results.Chunkseries {
+		var samples []cortexpb.Sample
+		result.Chunks, samples, err = decodeDownsampledChunks(ctx, result.Chunks)
+		if err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+		if len(samples) > 0 {
+			downsampled = append(downsampled, cortexpb.TimeSeries{Labels: result.Labels, Samples: samples})
+		}
+
 		// Sometimes the ingester can send series that have no data.
 		if len(result.Chunks) == 0 {
 			continue
@@ -158,6 +299,18 @@ func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int
 		ls := cortexpb.FromLabelAdaptersToLabels(result.Labels)
 		sort.Sort(ls)
 
+		if q.lazyDecoding {
+			serieses = append(serieses, &lazyChunkSeries{
+				userID:            userID,
+				labels:            ls,
+				chunks:            result.Chunks,
+				chunkIteratorFunc: chunkIterFn,
+				mint:              minT,
+				maxt:              maxT,
+			})
+			continue
+		}
+
 		chunks, err := chunkcompat.FromChunks(userID, ls, result.Chunks)
 		if err != nil {
 			return storage.ErrSeriesSet(err)
@@ -166,7 +319,7 @@ func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int
 		serieses = append(serieses, &chunkSeries{
 			labels:            ls,
 			chunks:            chunks,
-			chunkIteratorFunc: q.chunkIterFn,
+			chunkIteratorFunc: chunkIterFn,
 			mint:              minT,
 			maxt:              maxT,
 		})
@@ -176,6 +329,10 @@ func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int
 		sets = append(sets, series.NewConcreteSeriesSet(serieses))
 	}
 
+	if len(downsampled) > 0 {
+		sets = append(sets, newTimeSeriesSeriesSet(downsampled))
+	}
+
 	if len(sets) == 0 {
 		return storage.EmptySeriesSet()
 	}
@@ -186,6 +343,49 @@ func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int
 	return storage.NewMergeSeriesSet(sets, storage.ChainedSeriesMerge)
 }
 
+// decodeDownsampledChunks returns the samples reconstructed from the downsampled chunks of a series,
+// merging the ones returned by different ingesters, and the other chunks of the series.
+func decodeDownsampledChunks(ctx context.Context, chunks []client.Chunk) ([]client.Chunk, []cortexpb.Sample, error) {
+	numDownsampled := 0
+	for _, c := range chunks {
+		if c.Encoding == client.DownsampledChunkEncoding {
+			numDownsampled++
+		}
+	}
+	if numDownsampled == 0 {
+		return chunks, nil, nil
+	}
+
+	stepMs := client.DownsamplingStepFromContext(ctx)
+	if stepMs <= 0 {
+		return nil, nil, errors.New("unexpected downsampled chunk returned by the ingesters")
+	}
+
+	var (
+		other       = make([]client.Chunk, 0, len(chunks)-numDownsampled)
+		downsampled []client.DownsampledSample
+	)
+	for _, c := range chunks {
+		if c.Encoding != client.DownsampledChunkEncoding {
+			other = append(other, c)
+			continue
+		}
+
+		decoded, err := client.DecodeDownsampledChunk(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		downsampled = client.MergeDownsampledSamples(stepMs, downsampled, decoded)
+	}
+
+	fn := client.DownsamplingFunctionFromContext(ctx)
+	samples := make([]cortexpb.Sample, 0, len(downsampled))
+	for _, s := range downsampled {
+		samples = append(samples, cortexpb.Sample{TimestampMs: s.TimestampMs, Value: s.Value(fn)})
+	}
+	return other, samples, nil
+}
+
 func (q *distributorQuerier) LabelValues(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
 	lvs, err := q.distributor.LabelValuesForLabelName(q.ctx, model.Time(q.mint), model.Time(q.maxt), model.LabelName(name), matchers...)
 
@@ -193,18 +393,21 @@ func (q *distributorQuerier) LabelValues(name string, matchers ...*labels.Matche
 }
 
 func (q *distributorQuerier) LabelNames(matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
-	if len(matchers) > 0 {
-		return q.labelNamesWithMatchers(matchers...)
-	}
-
 	log, ctx := spanlogger.New(q.ctx, "distributorQuerier.LabelNames")
 	defer log.Span.Finish()
 
-	ln, err := q.distributor.LabelNames(ctx, model.Time(q.mint), model.Time(q.maxt))
+	ln, err := q.distributor.LabelNames(ctx, model.Time(q.mint), model.Time(q.maxt), matchers...)
+	if errors.Is(err, client.ErrLabelNamesMatchersNotSupported) {
+		// Some ingesters don't support the matchers yet, like during a rolling upgrade.
+		level.Debug(log).Log("msg", "falling back to the label names lookup through the series", "err", err)
+		return q.labelNamesWithMatchers(matchers...)
+	}
+
 	return ln, nil, err
 }
 
-// labelNamesWithMatchers performs the LabelNames call by calling ingester's MetricsForLabelMatchers method
+// labelNamesWithMatchers performs the LabelNames call by calling ingester's MetricsForLabelMatchers method,
+// supported by all the ingesters.
 func (q *distributorQuerier) labelNamesWithMatchers(matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
 	log, ctx := spanlogger.New(q.ctx, "distributorQuerier.labelNamesWithMatchers")
 	defer log.Span.Finish()
@@ -234,6 +437,30 @@ func (q *distributorQuerier) Close() error {
 	return nil
 }
 
+// lazyChunkSeries is a series backed by the chunks received from the ingesters, which are
+// decoded only when the series is iterated.
+type lazyChunkSeries struct {
+	userID            string
+	labels            labels.Labels
+	chunks            []client.Chunk
+	chunkIteratorFunc chunkIteratorFunc
+	mint, maxt        int64
+}
+
+func (s *lazyChunkSeries) Labels() labels.Labels {
+	return s.labels
+}
+
+// Iterator returns a new iterator of the data of the series, decoding its chunks.
+func (s *lazyChunkSeries) Iterator() chunkenc.Iterator {
+	chunks, err := chunkcompat.FromChunks(s.userID, s.labels, s.chunks)
+	if err != nil {
+		return series.NewErrIterator(err)
+	}
+
+	return s.chunkIteratorFunc(chunks, model.Time(s.mint), model.Time(s.maxt))
+}
+
 type distributorExemplarQueryable struct {
 	distributor Distributor
 }
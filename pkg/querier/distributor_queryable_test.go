@@ -2,24 +2,33 @@ package querier
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
+	"sort"
 	"testing"
 	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/scrape"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/user"
+	"go.uber.org/atomic"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
 	"github.com/cortexproject/cortex/pkg/chunk/encoding"
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
 	"github.com/cortexproject/cortex/pkg/prom1/storage/metric"
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/chunkcompat"
 )
@@ -46,7 +55,7 @@ func TestDistributorQuerier(t *testing.T) {
 		},
 		nil)
 
-	queryable := newDistributorQueryable(d, false, nil, 0)
+	queryable := newDistributorQueryable(d, false, false, nil, 0)
 	querier, err := queryable.Querier(context.Background(), mint, maxt)
 	require.NoError(t, err)
 
@@ -123,7 +132,7 @@ func TestDistributorQuerier_SelectShouldHonorQueryIngestersWithin(t *testing.T)
 				distributor.On("MetricsForLabelMatchers", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return([]metric.Metric{}, nil)
 
 				ctx := user.InjectOrgID(context.Background(), "test")
-				queryable := newDistributorQueryable(distributor, streamingEnabled, nil, testData.queryIngestersWithin)
+				queryable := newDistributorQueryable(distributor, streamingEnabled, false, nil, testData.queryIngestersWithin)
 				querier, err := queryable.Querier(ctx, testData.queryMinT, testData.queryMaxT)
 				require.NoError(t, err)
 
@@ -148,9 +157,111 @@ func TestDistributorQuerier_SelectShouldHonorQueryIngestersWithin(t *testing.T)
 	}
 }
 
+func TestDistributorQuerier_SelectShouldExtendQueryIngestersWithinWhenBlocksAreMissing(t *testing.T) {
+	now := time.Now()
+	block := func(minT, maxT time.Duration) *bucketindex.Block {
+		return &bucketindex.Block{ID: ulid.MustNew(uint64(now.Add(minT).Unix()), nil), MinTime: util.TimeToMillis(now.Add(minT)), MaxTime: util.TimeToMillis(now.Add(maxT))}
+	}
+
+	tests := map[string]struct {
+		queryMinT        time.Duration
+		queryMaxT        time.Duration
+		ingestersMinTime time.Duration
+		ingestersErr     error
+		blocks           bucketindex.Blocks
+		expectedMinT     time.Duration
+		expectedWarning  bool
+	}{
+		"should not extend the query if the blocks cover the time range preceding queryIngestersWithin": {
+			queryMinT:        -5 * time.Hour,
+			queryMaxT:        -30 * time.Minute,
+			ingestersMinTime: -4 * time.Hour,
+			blocks:           bucketindex.Blocks{block(-2*time.Hour, -50*time.Minute), block(-6*time.Hour, -2*time.Hour)},
+			expectedMinT:     -time.Hour,
+		},
+		"should extend the query up to the max extension if there are no blocks": {
+			queryMinT:        -5 * time.Hour,
+			queryMaxT:        -30 * time.Minute,
+			ingestersMinTime: -4 * time.Hour,
+			expectedMinT:     -3 * time.Hour,
+			expectedWarning:  true,
+		},
+		"should extend the query up to the oldest sample held by the ingesters": {
+			queryMinT:        -5 * time.Hour,
+			queryMaxT:        -30 * time.Minute,
+			ingestersMinTime: -90 * time.Minute,
+			expectedMinT:     -90 * time.Minute,
+			expectedWarning:  true,
+		},
+		"should extend the query up to the end of the blocks": {
+			queryMinT:        -5 * time.Hour,
+			queryMaxT:        -30 * time.Minute,
+			ingestersMinTime: -4 * time.Hour,
+			blocks:           bucketindex.Blocks{block(-4*time.Hour, -2*time.Hour)},
+			expectedMinT:     -2 * time.Hour,
+			expectedWarning:  true,
+		},
+		"should extend the query whose max time is older than queryIngestersWithin": {
+			queryMinT:        -5 * time.Hour,
+			queryMaxT:        -90 * time.Minute,
+			ingestersMinTime: -4 * time.Hour,
+			expectedMinT:     -3 * time.Hour,
+			expectedWarning:  true,
+		},
+		"should not extend the query if the ingesters hold no samples": {
+			queryMinT:    -5 * time.Hour,
+			queryMaxT:    -30 * time.Minute,
+			expectedMinT: -time.Hour,
+		},
+		"should not extend the query if the min time of the ingesters can't be fetched": {
+			queryMinT:    -5 * time.Hour,
+			queryMaxT:    -30 * time.Minute,
+			ingestersErr: errors.New("unavailable"),
+			expectedMinT: -time.Hour,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			distributor := &mockDistributor{}
+			distributor.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&client.QueryStreamResponse{}, nil)
+			var ingestersMinTime int64
+			if testData.ingestersMinTime != 0 {
+				ingestersMinTime = util.TimeToMillis(now.Add(testData.ingestersMinTime))
+			}
+			distributor.On("IngestersMinTime", mock.Anything).Return(ingestersMinTime, testData.ingestersErr)
+
+			finder := &blocksFinderMock{}
+			finder.On("GetBlocks", mock.Anything, "test", mock.Anything, mock.Anything).Return(testData.blocks, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), nil)
+
+			queryMinT, queryMaxT := util.TimeToMillis(now.Add(testData.queryMinT)), util.TimeToMillis(now.Add(testData.queryMaxT))
+			ctx := user.InjectOrgID(context.Background(), "test")
+			queryable := newDistributorQueryable(distributor, true, false, nil, time.Hour).withQueryIngestersWithinExtension(finder, 2*time.Hour)
+			require.True(t, queryable.UseQueryable(now, queryMinT, queryMaxT))
+
+			querier, err := queryable.Querier(ctx, queryMinT, queryMaxT)
+			require.NoError(t, err)
+
+			seriesSet := querier.Select(true, &storage.SelectHints{Start: queryMinT, End: queryMaxT})
+			require.NoError(t, seriesSet.Err())
+			assert.Equal(t, testData.expectedWarning, len(seriesSet.Warnings()) > 0)
+
+			var queryCalls []mock.Call
+			for _, call := range distributor.Calls {
+				if call.Method == "QueryStream" {
+					queryCalls = append(queryCalls, call)
+				}
+			}
+			require.Len(t, queryCalls, 1)
+			assert.InDelta(t, util.TimeToMillis(now.Add(testData.expectedMinT)), int64(queryCalls[0].Arguments.Get(1).(model.Time)), float64(5*time.Second.Milliseconds()))
+			assert.Equal(t, queryMaxT, int64(queryCalls[0].Arguments.Get(2).(model.Time)))
+		})
+	}
+}
+
 func TestDistributorQueryableFilter(t *testing.T) {
 	d := &mockDistributor{}
-	dq := newDistributorQueryable(d, false, nil, 1*time.Hour)
+	dq := newDistributorQueryable(d, false, false, nil, 1*time.Hour)
 
 	now := time.Now()
 
@@ -162,6 +273,11 @@ func TestDistributorQueryableFilter(t *testing.T) {
 
 	// Same query, hour+1ms later, is not sent to ingesters.
 	require.False(t, dq.UseQueryable(now.Add(time.Hour).Add(1*time.Millisecond), queryMinT, queryMaxT))
+
+	// Unless the query is within the extension of queryIngestersWithin.
+	edq := dq.withQueryIngestersWithinExtension(&blocksFinderMock{}, time.Hour)
+	require.True(t, edq.UseQueryable(now.Add(2*time.Hour), queryMinT, queryMaxT))
+	require.False(t, edq.UseQueryable(now.Add(2*time.Hour).Add(1*time.Millisecond), queryMinT, queryMaxT))
 }
 
 func TestIngesterStreaming(t *testing.T) {
@@ -196,7 +312,7 @@ func TestIngesterStreaming(t *testing.T) {
 		nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, true, mergeChunks, 0)
+	queryable := newDistributorQueryable(d, true, false, mergeChunks, 0)
 	querier, err := queryable.Querier(ctx, mint, maxt)
 	require.NoError(t, err)
 
@@ -271,25 +387,123 @@ func TestIngesterStreamingMixedResults(t *testing.T) {
 		},
 		nil)
 
-	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, true, mergeChunks, 0)
-	querier, err := queryable.Querier(ctx, mint, maxt)
-	require.NoError(t, err)
+	for _, lazyDecoding := range []bool{false, true} {
+		t.Run(fmt.Sprintf("lazy decoding=%t", lazyDecoding), func(t *testing.T) {
+			ctx := user.InjectOrgID(context.Background(), "0")
+			queryable := newDistributorQueryable(d, true, lazyDecoding, mergeChunks, 0)
+			querier, err := queryable.Querier(ctx, mint, maxt)
+			require.NoError(t, err)
 
-	seriesSet := querier.Select(true, &storage.SelectHints{Start: mint, End: maxt}, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".*"))
-	require.NoError(t, seriesSet.Err())
+			seriesSet := querier.Select(true, &storage.SelectHints{Start: mint, End: maxt}, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".*"))
+			require.NoError(t, seriesSet.Err())
 
-	require.True(t, seriesSet.Next())
-	verifySeries(t, seriesSet.At(), labels.Labels{{Name: labels.MetricName, Value: "one"}}, s1)
+			require.True(t, seriesSet.Next())
+			verifySeries(t, seriesSet.At(), labels.Labels{{Name: labels.MetricName, Value: "one"}}, s1)
 
-	require.True(t, seriesSet.Next())
-	verifySeries(t, seriesSet.At(), labels.Labels{{Name: labels.MetricName, Value: "three"}}, s1)
+			require.True(t, seriesSet.Next())
+			verifySeries(t, seriesSet.At(), labels.Labels{{Name: labels.MetricName, Value: "three"}}, s1)
 
-	require.True(t, seriesSet.Next())
-	verifySeries(t, seriesSet.At(), labels.Labels{{Name: labels.MetricName, Value: "two"}}, mergedSamplesS1S2)
+			require.True(t, seriesSet.Next())
+			verifySeries(t, seriesSet.At(), labels.Labels{{Name: labels.MetricName, Value: "two"}}, mergedSamplesS1S2)
 
-	require.False(t, seriesSet.Next())
-	require.NoError(t, seriesSet.Err())
+			require.False(t, seriesSet.Next())
+			require.NoError(t, seriesSet.Err())
+		})
+	}
+}
+
+func TestDistributorQuerier_Downsampling(t *testing.T) {
+	const (
+		step     = time.Minute
+		interval = 10 * time.Second
+	)
+
+	// Generate a counter and a gauge scraped every 10s, with a jitter which makes the number of
+	// samples in each step interval change.
+	rnd := rand.New(rand.NewSource(1))
+	end := time.Unix(6*3600, 0)
+	counter := cortexpb.TimeSeries{Labels: []cortexpb.LabelAdapter{{Name: labels.MetricName, Value: "requests_total"}}}
+	gauge := cortexpb.TimeSeries{Labels: []cortexpb.LabelAdapter{{Name: labels.MetricName, Value: "memory_bytes"}}}
+	value := 0.0
+	for ts := time.Unix(0, 0).Add(interval / 2); ts.Before(end); ts = ts.Add(interval) {
+		tsMs := util.TimeToMillis(ts.Add(time.Duration(rnd.Intn(3000)-1500) * time.Millisecond))
+		value += float64(90 + rnd.Intn(20))
+		counter.Samples = append(counter.Samples, cortexpb.Sample{TimestampMs: tsMs, Value: value})
+		gauge.Samples = append(gauge.Samples, cortexpb.Sample{TimestampMs: tsMs, Value: float64(rnd.Intn(1000))})
+	}
+
+	// The second replica misses some samples.
+	replica := func(s cortexpb.TimeSeries) cortexpb.TimeSeries {
+		r := cortexpb.TimeSeries{Labels: s.Labels}
+		for i, sample := range s.Samples {
+			if i%7 != 3 {
+				r.Samples = append(r.Samples, sample)
+			}
+		}
+		return r
+	}
+	d := &downsamplingDistributorMock{series: [][]cortexpb.TimeSeries{
+		{counter, gauge},
+		{replica(counter), replica(gauge)},
+	}}
+
+	engine := promql.NewEngine(promql.EngineOpts{
+		Logger:     log.NewNopLogger(),
+		Timeout:    10 * time.Second,
+		MaxSamples: 1e6,
+	})
+	queryable := newDistributorQueryable(d, true, false, mergeChunks, 0)
+
+	for query, tc := range map[string]struct {
+		fn           client.DownsamplingFunction
+		tolerance    float64
+		incompatible bool
+	}{
+		"memory_bytes":                       {fn: client.DownsamplingLast},
+		"max_over_time(memory_bytes[5m])":    {fn: client.DownsamplingMax},
+		"min_over_time(memory_bytes[5m])":    {fn: client.DownsamplingMin},
+		"avg_over_time(memory_bytes[5m])":    {fn: client.DownsamplingAvg, tolerance: 0.05},
+		"rate(requests_total[5m])":           {fn: client.DownsamplingLast, tolerance: 0.05},
+		"sum(increase(requests_total[10m]))": {fn: client.DownsamplingLast, tolerance: 0.05},
+		"rate(requests_total[2m])":           {fn: client.DownsamplingLast, tolerance: 0.1},
+		// A range equal to the step only selects a single downsampled sample, which isn't enough
+		// for the rate: the query-frontend doesn't signal such queries as downsampling compatible.
+		"rate(requests_total[1m])": {fn: client.DownsamplingLast, incompatible: true},
+	} {
+		t.Run(query, func(t *testing.T) {
+			run := func(ctx context.Context) promql.Matrix {
+				q, err := engine.NewRangeQuery(queryable, query, time.Unix(3600, 0), end, step)
+				require.NoError(t, err)
+				res := q.Exec(user.InjectOrgID(ctx, "user-1"))
+				require.NoError(t, res.Err)
+				matrix, err := res.Matrix()
+				require.NoError(t, err)
+				return matrix
+			}
+
+			expected := run(context.Background())
+			require.Zero(t, d.downsampledQueries.Load())
+
+			actual := run(client.ContextWithDownsamplingFunction(context.Background(), tc.fn))
+			require.NotZero(t, d.downsampledQueries.Swap(0))
+
+			if tc.incompatible {
+				require.NotEmpty(t, expected)
+				require.Empty(t, actual)
+				return
+			}
+
+			require.Len(t, actual, len(expected))
+			for i := range expected {
+				assert.Equal(t, expected[i].Metric, actual[i].Metric)
+				require.Len(t, actual[i].Points, len(expected[i].Points))
+				for j := range expected[i].Points {
+					assert.Equal(t, expected[i].Points[j].T, actual[i].Points[j].T)
+					assert.InDelta(t, expected[i].Points[j].V, actual[i].Points[j].V, tc.tolerance*math.Abs(expected[i].Points[j].V))
+				}
+			}
+		})
+	}
 }
 
 func verifySeries(t *testing.T, series storage.Series, l labels.Labels, samples []cortexpb.Sample) {
@@ -311,16 +525,34 @@ func TestDistributorQuerier_LabelNames(t *testing.T) {
 	labelNames := []string{"foo", "job"}
 
 	t.Run("with matchers", func(t *testing.T) {
+		d := &mockDistributor{}
+		d.On("LabelNames", mock.Anything, model.Time(mint), model.Time(maxt), someMatchers).
+			Return(labelNames, nil)
+
+		queryable := newDistributorQueryable(d, false, false, nil, 0)
+		querier, err := queryable.Querier(context.Background(), mint, maxt)
+		require.NoError(t, err)
+
+		names, warnings, err := querier.LabelNames(someMatchers...)
+		require.NoError(t, err)
+		assert.Empty(t, warnings)
+		assert.Equal(t, labelNames, names)
+		d.AssertNotCalled(t, "MetricsForLabelMatchers", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("with matchers not supported by some ingesters", func(t *testing.T) {
 		metrics := []metric.Metric{
 			{Metric: model.Metric{"foo": "bar"}},
 			{Metric: model.Metric{"job": "baz"}},
 			{Metric: model.Metric{"job": "baz", "foo": "boom"}},
 		}
 		d := &mockDistributor{}
+		d.On("LabelNames", mock.Anything, model.Time(mint), model.Time(maxt), someMatchers).
+			Return([]string(nil), client.ErrLabelNamesMatchersNotSupported)
 		d.On("MetricsForLabelMatchers", mock.Anything, model.Time(mint), model.Time(maxt), someMatchers).
 			Return(metrics, nil)
 
-		queryable := newDistributorQueryable(d, false, nil, 0)
+		queryable := newDistributorQueryable(d, false, false, nil, 0)
 		querier, err := queryable.Querier(context.Background(), mint, maxt)
 		require.NoError(t, err)
 
@@ -331,7 +563,7 @@ func TestDistributorQuerier_LabelNames(t *testing.T) {
 	})
 }
 
-func convertToChunks(t *testing.T, samples []cortexpb.Sample) []client.Chunk {
+func convertToChunks(t testing.TB, samples []cortexpb.Sample) []client.Chunk {
 	// We need to make sure that there is atleast one chunk present,
 	// else no series will be selected.
 	promChunk, err := encoding.NewForEncoding(encoding.Bigchunk)
@@ -371,16 +603,80 @@ func (m *mockDistributor) LabelValuesForLabelName(ctx context.Context, from, to
 	args := m.Called(ctx, from, to, lbl, matchers)
 	return args.Get(0).([]string), args.Error(1)
 }
-func (m *mockDistributor) LabelNames(ctx context.Context, from, to model.Time) ([]string, error) {
-	args := m.Called(ctx, from, to)
+func (m *mockDistributor) LabelNames(ctx context.Context, from, to model.Time, matchers ...*labels.Matcher) ([]string, error) {
+	args := m.Called(ctx, from, to, matchers)
 	return args.Get(0).([]string), args.Error(1)
 }
 func (m *mockDistributor) MetricsForLabelMatchers(ctx context.Context, from, to model.Time, matchers ...*labels.Matcher) ([]metric.Metric, error) {
 	args := m.Called(ctx, from, to, matchers)
 	return args.Get(0).([]metric.Metric), args.Error(1)
 }
+func (m *mockDistributor) MetricsForLabelMatchersWithTimeRange(ctx context.Context, from, to model.Time, matchersSet ...[]*labels.Matcher) (*client.MetricsForLabelMatchersResponse, error) {
+	args := m.Called(ctx, from, to, matchersSet)
+	return args.Get(0).(*client.MetricsForLabelMatchersResponse), args.Error(1)
+}
 
 func (m *mockDistributor) MetricsMetadata(ctx context.Context) ([]scrape.MetricMetadata, error) {
 	args := m.Called(ctx)
 	return args.Get(0).([]scrape.MetricMetadata), args.Error(1)
 }
+
+func (m *mockDistributor) IngestersMinTime(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// downsamplingDistributorMock returns the series of each ingester, downsampled if requested,
+// merging the responses of the ingesters like the distributor does.
+type downsamplingDistributorMock struct {
+	mockDistributor
+
+	series             [][]cortexpb.TimeSeries // The same series for each ingester.
+	downsampledQueries atomic.Int64
+}
+
+func (m *downsamplingDistributorMock) QueryStream(ctx context.Context, from, to model.Time, matchers ...*labels.Matcher) (*client.QueryStreamResponse, error) {
+	stepMs := client.DownsamplingStepFromContext(ctx)
+	if stepMs > 0 {
+		m.downsampledQueries.Inc()
+	}
+
+	resp := &client.QueryStreamResponse{}
+	for i, s := range m.series[0] {
+		if !labels.Selector(matchers).Matches(cortexpb.FromLabelAdaptersToLabels(s.Labels)) {
+			continue
+		}
+
+		samples := map[int64]float64{}
+		chunkSeries := client.TimeSeriesChunk{Labels: s.Labels}
+		for _, ingesterSeries := range m.series {
+			downsampler := client.NewDownsampler(stepMs)
+			for _, sample := range ingesterSeries[i].Samples {
+				if sample.TimestampMs < int64(from) || sample.TimestampMs > int64(to) {
+					continue
+				}
+				if stepMs > 0 {
+					downsampler.Add(sample.TimestampMs, sample.Value)
+				} else {
+					samples[sample.TimestampMs] = sample.Value
+				}
+			}
+			if stepMs > 0 {
+				chunkSeries.Chunks = append(chunkSeries.Chunks, client.EncodeDownsampledChunk(downsampler.Samples()))
+			}
+		}
+
+		if stepMs > 0 {
+			resp.Chunkseries = append(resp.Chunkseries, chunkSeries)
+			continue
+		}
+
+		ts := cortexpb.TimeSeries{Labels: s.Labels}
+		for t, v := range samples {
+			ts.Samples = append(ts.Samples, cortexpb.Sample{TimestampMs: t, Value: v})
+		}
+		sort.Slice(ts.Samples, func(i, j int) bool { return ts.Samples[i].TimestampMs < ts.Samples[j].TimestampMs })
+		resp.Timeseries = append(resp.Timeseries, ts)
+	}
+	return resp, nil
+}
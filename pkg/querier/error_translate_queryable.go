@@ -10,6 +10,7 @@ import (
 	"github.com/prometheus/prometheus/storage"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util/apierror"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
@@ -96,8 +97,9 @@ type errorTranslateQueryable struct {
 }
 
 func (e errorTranslateQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	fn := recordErrorFn(ctx, e.fn)
 	q, err := e.q.Querier(ctx, mint, maxt)
-	return errorTranslateQuerier{q: q, fn: e.fn}, e.fn(err)
+	return errorTranslateQuerier{q: q, fn: fn}, fn(err)
 }
 
 type errorTranslateSampleAndChunkQueryable struct {
@@ -106,13 +108,25 @@ type errorTranslateSampleAndChunkQueryable struct {
 }
 
 func (e errorTranslateSampleAndChunkQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	fn := recordErrorFn(ctx, e.fn)
 	q, err := e.q.Querier(ctx, mint, maxt)
-	return errorTranslateQuerier{q: q, fn: e.fn}, e.fn(err)
+	return errorTranslateQuerier{q: q, fn: fn}, fn(err)
 }
 
 func (e errorTranslateSampleAndChunkQueryable) ChunkQuerier(ctx context.Context, mint, maxt int64) (storage.ChunkQuerier, error) {
+	fn := recordErrorFn(ctx, e.fn)
 	q, err := e.q.ChunkQuerier(ctx, mint, maxt)
-	return errorTranslateChunkQuerier{q: q, fn: e.fn}, e.fn(err)
+	return errorTranslateChunkQuerier{q: q, fn: fn}, fn(err)
+}
+
+// recordErrorFn returns a function recording the errors in the context before translating them,
+// so that the API can respond with the error type of the original error, which is lost by the
+// translation to the few errors supported by the PromQL API.
+func recordErrorFn(ctx context.Context, fn ErrTranslateFn) ErrTranslateFn {
+	return func(err error) error {
+		apierror.RecordError(ctx, err)
+		return fn(err)
+	}
 }
 
 type errorTranslateQuerier struct {
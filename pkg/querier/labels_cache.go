@@ -0,0 +1,168 @@
+package querier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/tenant"
+)
+
+const (
+	labelsCacheMethodLabelNames  = "label_names"
+	labelsCacheMethodLabelValues = "label_values"
+)
+
+type labelsCacheMetrics struct {
+	hits   *prometheus.CounterVec
+	misses *prometheus.CounterVec
+}
+
+func newLabelsCacheMetrics(reg prometheus.Registerer) *labelsCacheMetrics {
+	return &labelsCacheMetrics{
+		hits: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_querier_label_cache_hits_total",
+			Help: "The total number of label names and values requests served from the label cache.",
+		}, []string{"method"}),
+		misses: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_querier_label_cache_misses_total",
+			Help: "The total number of label names and values requests not found in the label cache.",
+		}, []string{"method"}),
+	}
+}
+
+// labelsCacheQueryable caches the label names and values returned by the queriers of the
+// wrapped queryable, by tenant, matchers and time range. The time range is rounded to the
+// bucket, so that requests with slightly different ranges share the same cache entry. The
+// entries expire after the TTL of the cache, and are never invalidated otherwise.
+type labelsCacheQueryable struct {
+	storage.Queryable
+
+	cache   cache.Cache
+	bucket  time.Duration
+	metrics *labelsCacheMetrics
+}
+
+func newLabelsCacheQueryable(q storage.Queryable, c cache.Cache, bucket time.Duration, reg prometheus.Registerer) storage.Queryable {
+	return &labelsCacheQueryable{
+		Queryable: q,
+		cache:     c,
+		bucket:    bucket,
+		metrics:   newLabelsCacheMetrics(reg),
+	}
+}
+
+// Querier implements storage.Queryable.
+func (q *labelsCacheQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	querier, err := q.Queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &labelsCacheQuerier{
+		Querier:   querier,
+		ctx:       ctx,
+		mint:      mint,
+		maxt:      maxt,
+		queryable: q,
+	}, nil
+}
+
+type labelsCacheQuerier struct {
+	storage.Querier
+
+	ctx        context.Context
+	mint, maxt int64
+	queryable  *labelsCacheQueryable
+}
+
+// LabelNames implements storage.Querier.
+func (q *labelsCacheQuerier) LabelNames(matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	key, ok := q.cacheKey(labelsCacheMethodLabelNames, "", matchers)
+	if !ok {
+		return q.Querier.LabelNames(matchers...)
+	}
+
+	resp := &client.LabelNamesResponse{}
+	if q.fetch(labelsCacheMethodLabelNames, key, resp) {
+		return resp.LabelNames, nil, nil
+	}
+
+	names, warnings, err := q.Querier.LabelNames(matchers...)
+	if err == nil && len(warnings) == 0 {
+		q.store(key, &client.LabelNamesResponse{LabelNames: names})
+	}
+	return names, warnings, err
+}
+
+// LabelValues implements storage.Querier.
+func (q *labelsCacheQuerier) LabelValues(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	key, ok := q.cacheKey(labelsCacheMethodLabelValues, name, matchers)
+	if !ok {
+		return q.Querier.LabelValues(name, matchers...)
+	}
+
+	resp := &client.LabelValuesResponse{}
+	if q.fetch(labelsCacheMethodLabelValues, key, resp) {
+		return resp.LabelValues, nil, nil
+	}
+
+	values, warnings, err := q.Querier.LabelValues(name, matchers...)
+	if err == nil && len(warnings) == 0 {
+		q.store(key, &client.LabelValuesResponse{LabelValues: values})
+	}
+	return values, warnings, err
+}
+
+// cacheKey returns the cache key of the request, or false if the request can't be cached.
+func (q *labelsCacheQuerier) cacheKey(method, name string, matchers []*labels.Matcher) (string, bool) {
+	tenantIDs, err := tenant.TenantIDs(q.ctx)
+	if err != nil {
+		return "", false
+	}
+
+	bucket := q.queryable.bucket.Milliseconds()
+	if bucket <= 0 {
+		bucket = 1
+	}
+
+	matchersStrings := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		matchersStrings = append(matchersStrings, m.String())
+	}
+
+	key := fmt.Sprintf("%s:%s:%s:%d:%d:%s", tenant.JoinTenantIDs(tenantIDs), method, name, q.mint/bucket, q.maxt/bucket, strings.Join(matchersStrings, ","))
+	return cache.HashKey(key), true
+}
+
+type labelsCacheEntry interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+func (q *labelsCacheQuerier) fetch(method, key string, entry labelsCacheEntry) bool {
+	found, bufs, _ := q.queryable.cache.Fetch(q.ctx, []string{key})
+	if len(found) == 1 && entry.Unmarshal(bufs[0]) == nil {
+		q.queryable.metrics.hits.WithLabelValues(method).Inc()
+		return true
+	}
+
+	q.queryable.metrics.misses.WithLabelValues(method).Inc()
+	return false
+}
+
+func (q *labelsCacheQuerier) store(key string, entry labelsCacheEntry) {
+	buf, err := entry.Marshal()
+	if err != nil {
+		return
+	}
+	q.queryable.cache.Store(q.ctx, []string{key}, [][]byte{buf})
+}
@@ -0,0 +1,136 @@
+package querier
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+)
+
+func TestLabelsCacheQueryable(t *testing.T) {
+	const bucket = time.Minute
+	matcher := labels.MustNewMatcher(labels.MatchEqual, "job", "a")
+
+	setup := func(ttl time.Duration) (*labelsCacheMockQueryable, storage.Queryable, *prometheus.Registry) {
+		reg := prometheus.NewPedanticRegistry()
+		upstream := &labelsCacheMockQueryable{names: []string{"job"}, values: []string{"a"}}
+		c := cache.NewFifoCache("test", cache.FifoCacheConfig{MaxSizeItems: 100, Validity: ttl}, reg, util_log.Logger)
+		return upstream, newLabelsCacheQueryable(upstream, c, bucket, reg), reg
+	}
+
+	labelNames := func(t *testing.T, q storage.Queryable, userID string, mint, maxt int64, matchers ...*labels.Matcher) []string {
+		querier, err := q.Querier(user.InjectOrgID(context.Background(), userID), mint, maxt)
+		require.NoError(t, err)
+		names, _, err := querier.LabelNames(matchers...)
+		require.NoError(t, err)
+		return names
+	}
+
+	labelValues := func(t *testing.T, q storage.Queryable, userID string, mint, maxt int64, name string, matchers ...*labels.Matcher) []string {
+		querier, err := q.Querier(user.InjectOrgID(context.Background(), userID), mint, maxt)
+		require.NoError(t, err)
+		values, _, err := querier.LabelValues(name, matchers...)
+		require.NoError(t, err)
+		return values
+	}
+
+	t.Run("should serve the requests within the same time range bucket from the cache", func(t *testing.T) {
+		upstream, q, reg := setup(time.Hour)
+
+		assert.Equal(t, []string{"job"}, labelNames(t, q, "user-1", 0, 10*bucket.Milliseconds(), matcher))
+		assert.Equal(t, []string{"job"}, labelNames(t, q, "user-1", 1000, 10*bucket.Milliseconds()+1000, matcher))
+		assert.Equal(t, []string{"a"}, labelValues(t, q, "user-1", 0, 10*bucket.Milliseconds(), "job"))
+		assert.Equal(t, []string{"a"}, labelValues(t, q, "user-1", 2000, 10*bucket.Milliseconds()+2000, "job"))
+		assert.Equal(t, 1, upstream.labelNamesCalls)
+		assert.Equal(t, 1, upstream.labelValuesCalls)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_querier_label_cache_hits_total The total number of label names and values requests served from the label cache.
+			# TYPE cortex_querier_label_cache_hits_total counter
+			cortex_querier_label_cache_hits_total{method="label_names"} 1
+			cortex_querier_label_cache_hits_total{method="label_values"} 1
+			# HELP cortex_querier_label_cache_misses_total The total number of label names and values requests not found in the label cache.
+			# TYPE cortex_querier_label_cache_misses_total counter
+			cortex_querier_label_cache_misses_total{method="label_names"} 1
+			cortex_querier_label_cache_misses_total{method="label_values"} 1
+		`), "cortex_querier_label_cache_hits_total", "cortex_querier_label_cache_misses_total"))
+	})
+
+	t.Run("should not share the cache entries across tenants, matchers, label names and time range buckets", func(t *testing.T) {
+		upstream, q, _ := setup(time.Hour)
+
+		labelNames(t, q, "user-1", 0, bucket.Milliseconds())
+		labelNames(t, q, "user-2", 0, bucket.Milliseconds())
+		labelNames(t, q, "user-1", 0, bucket.Milliseconds(), matcher)
+		labelNames(t, q, "user-1", 0, 2*bucket.Milliseconds())
+		assert.Equal(t, 4, upstream.labelNamesCalls)
+
+		labelValues(t, q, "user-1", 0, bucket.Milliseconds(), "job")
+		labelValues(t, q, "user-1", 0, bucket.Milliseconds(), "pod")
+		assert.Equal(t, 2, upstream.labelValuesCalls)
+	})
+
+	t.Run("should query the upstream once the TTL expires", func(t *testing.T) {
+		const ttl = 100 * time.Millisecond
+		upstream, q, _ := setup(ttl)
+
+		assert.Equal(t, []string{"a"}, labelValues(t, q, "user-1", 0, bucket.Milliseconds(), "job"))
+
+		upstream.values = []string{"a", "b"}
+		assert.Equal(t, []string{"a"}, labelValues(t, q, "user-1", 0, bucket.Milliseconds(), "job"))
+		assert.Equal(t, 1, upstream.labelValuesCalls)
+
+		time.Sleep(2 * ttl)
+		assert.Equal(t, []string{"a", "b"}, labelValues(t, q, "user-1", 0, bucket.Milliseconds(), "job"))
+		assert.Equal(t, 2, upstream.labelValuesCalls)
+	})
+
+	t.Run("should not cache the responses with warnings", func(t *testing.T) {
+		upstream, q, _ := setup(time.Hour)
+		upstream.warnings = storage.Warnings{assert.AnError}
+
+		labelNames(t, q, "user-1", 0, bucket.Milliseconds())
+		labelNames(t, q, "user-1", 0, bucket.Milliseconds())
+		assert.Equal(t, 2, upstream.labelNamesCalls)
+	})
+}
+
+type labelsCacheMockQueryable struct {
+	names    []string
+	values   []string
+	warnings storage.Warnings
+
+	labelNamesCalls  int
+	labelValuesCalls int
+}
+
+func (m *labelsCacheMockQueryable) Querier(context.Context, int64, int64) (storage.Querier, error) {
+	return &labelsCacheMockQuerier{queryable: m}, nil
+}
+
+type labelsCacheMockQuerier struct {
+	storage.Querier
+
+	queryable *labelsCacheMockQueryable
+}
+
+func (m *labelsCacheMockQuerier) LabelNames(...*labels.Matcher) ([]string, storage.Warnings, error) {
+	m.queryable.labelNamesCalls++
+	return m.queryable.names, m.queryable.warnings, nil
+}
+
+func (m *labelsCacheMockQuerier) LabelValues(string, ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	m.queryable.labelValuesCalls++
+	return m.queryable.values, m.queryable.warnings, nil
+}
@@ -0,0 +1,158 @@
+package querier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"go.uber.org/atomic"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util/apierror"
+)
+
+// The share of the time left before the query deadline which is reserved to evaluate the query
+// on the series fetched so far, when the partial results on timeout are enabled.
+const partialResultsEvaluationReserve = 0.1
+
+// newPartialResultsFetchContext returns the context used to fetch the series of a query returning partial
+// results on timeout, whose deadline expires shortly before the query one. Returns a nil context if the
+// query has no deadline.
+func newPartialResultsFetchContext(queryCtx context.Context, now time.Time) (context.Context, context.CancelFunc) {
+	deadline, ok := queryCtx.Deadline()
+	if !ok {
+		return nil, nil
+	}
+
+	reserve := time.Duration(float64(deadline.Sub(now)) * partialResultsEvaluationReserve)
+	return context.WithDeadline(queryCtx, deadline.Add(-reserve))
+}
+
+// partialResultsTracker tracks the sources whose series fetching has been interrupted by the deadline
+// of the fetch context, in a single Select() call.
+type partialResultsTracker struct {
+	queryCtx context.Context
+	fetchCtx context.Context
+
+	timedOutSources atomic.Int64
+}
+
+func newPartialResultsTracker(queryCtx, fetchCtx context.Context) *partialResultsTracker {
+	return &partialResultsTracker{queryCtx: queryCtx, fetchCtx: fetchCtx}
+}
+
+// isFetchTimeout returns whether the input error has been caused by the deadline of the fetch context,
+// while the query still has time to be evaluated.
+func (t *partialResultsTracker) isFetchTimeout(err error) bool {
+	if t.fetchCtx.Err() != context.DeadlineExceeded || t.queryCtx.Err() != nil {
+		return false
+	}
+
+	// The fetching may be interrupted by a limit or a failure right before the deadline, which we
+	// don't want to hide.
+	typ := apierror.FromError(err).Type
+	return typ == apierror.TypeTimeout || typ == apierror.TypeCanceled
+}
+
+// wrapSource wraps the series set of a source, discarding the error if the series fetching
+// has been interrupted by the deadline of the fetch context.
+func (t *partialResultsTracker) wrapSource(set storage.SeriesSet) storage.SeriesSet {
+	return &partialResultsSourceSeriesSet{SeriesSet: set, tracker: t}
+}
+
+// wrapResult wraps the series set returned by Select(), adding a warning if some sources timed out.
+func (t *partialResultsTracker) wrapResult(set storage.SeriesSet) storage.SeriesSet {
+	return &partialResultsSeriesSet{SeriesSet: set, tracker: t}
+}
+
+type partialResultsSourceSeriesSet struct {
+	storage.SeriesSet
+
+	tracker *partialResultsTracker
+	checked bool
+	err     error
+}
+
+func (s *partialResultsSourceSeriesSet) Next() bool {
+	if s.SeriesSet.Next() {
+		return true
+	}
+
+	// Check the error as soon as the set is exhausted, because the warnings of the
+	// result may be read before its error.
+	s.checkErr()
+	return false
+}
+
+func (s *partialResultsSourceSeriesSet) Err() error {
+	s.checkErr()
+	return s.err
+}
+
+func (s *partialResultsSourceSeriesSet) checkErr() {
+	if s.checked {
+		return
+	}
+	s.checked = true
+
+	s.err = s.SeriesSet.Err()
+	if s.err != nil && s.tracker.isFetchTimeout(s.err) {
+		s.err = nil
+		s.tracker.timedOutSources.Inc()
+	}
+}
+
+type partialResultsSeriesSet struct {
+	storage.SeriesSet
+
+	tracker *partialResultsTracker
+}
+
+func (s *partialResultsSeriesSet) Warnings() storage.Warnings {
+	warnings := s.SeriesSet.Warnings()
+	if n := s.tracker.timedOutSources.Load(); n > 0 {
+		warnings = append(warnings, fmt.Errorf("partial results: deadline exceeded while fetching from %d sources", n))
+	}
+	return warnings
+}
+
+type partialResultsContextKey int
+
+const skipInvalidChunksContextKey partialResultsContextKey = 0
+
+// contextWithSkipInvalidChunks returns a context signaling that the chunks whose time range is
+// inverted are skipped, instead of failing the query, because the tenant accepts partial results.
+func contextWithSkipInvalidChunks(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipInvalidChunksContextKey, true)
+}
+
+// chunkIteratorFuncFromContext returns the iterator function skipping the chunks whose time range
+// is inverted if requested in the context, or the input function otherwise.
+func chunkIteratorFuncFromContext(ctx context.Context, fn chunkIteratorFunc) chunkIteratorFunc {
+	if skip, _ := ctx.Value(skipInvalidChunksContextKey).(bool); !skip {
+		return fn
+	}
+
+	return func(chunks []chunk.Chunk, from, through model.Time) chunkenc.Iterator {
+		for _, c := range chunks {
+			if c.Through < c.From {
+				return fn(validChunks(chunks), from, through)
+			}
+		}
+		return fn(chunks, from, through)
+	}
+}
+
+// validChunks returns a copy of the input chunks without the ones whose time range is inverted.
+func validChunks(chunks []chunk.Chunk) []chunk.Chunk {
+	valid := make([]chunk.Chunk, 0, len(chunks))
+	for _, c := range chunks {
+		if c.Through >= c.From {
+			valid = append(valid, c)
+		}
+	}
+	return valid
+}
@@ -20,12 +20,15 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
 	"github.com/cortexproject/cortex/pkg/chunk/purger"
+	"github.com/cortexproject/cortex/pkg/querier/astmapper"
 	"github.com/cortexproject/cortex/pkg/querier/batch"
 	"github.com/cortexproject/cortex/pkg/querier/chunkstore"
 	"github.com/cortexproject/cortex/pkg/querier/iterators"
 	"github.com/cortexproject/cortex/pkg/querier/lazyquery"
 	"github.com/cortexproject/cortex/pkg/querier/series"
+	"github.com/cortexproject/cortex/pkg/storegateway"
 	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
@@ -45,6 +48,10 @@ type Config struct {
 	QueryIngestersWithin time.Duration `yaml:"query_ingesters_within"`
 	QueryStoreForLabels  bool          `yaml:"query_store_for_labels_enabled"`
 	AtModifierEnabled    bool          `yaml:"at_modifier_enabled"`
+	LazyMergeEnabled     bool          `yaml:"lazy_merge_enabled"`
+
+	// QueryIngestersWithinMaxExtension is the max extension of QueryIngestersWithin when the blocks are missing.
+	QueryIngestersWithinMaxExtension time.Duration `yaml:"query_ingesters_within_max_extension"`
 
 	// QueryStoreAfter the time after which queries should also be sent to the store and not just ingesters.
 	QueryStoreAfter    time.Duration `yaml:"query_store_after"`
@@ -72,6 +79,13 @@ type Config struct {
 	UseSecondStoreBeforeTime flagext.Time `yaml:"use_second_store_before_time"`
 
 	ShuffleShardingIngestersLookbackPeriod time.Duration `yaml:"shuffle_sharding_ingesters_lookback_period"`
+
+	LabelCacheTTL             time.Duration `yaml:"label_cache_ttl"`
+	LabelCacheTimeRangeBucket time.Duration `yaml:"label_cache_time_range_bucket"`
+	LabelCacheMaxSizeItems    int           `yaml:"label_cache_max_size_items"`
+
+	// This config is dynamically injected because defined in the store-gateway config.
+	ColdBlocksMinAge time.Duration `yaml:"-"`
 }
 
 var (
@@ -90,8 +104,10 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.IngesterStreaming, "querier.ingester-streaming", true, "Use streaming RPCs to query ingester.")
 	f.IntVar(&cfg.MaxSamples, "querier.max-samples", 50e6, "Maximum number of samples a single query can load into memory.")
 	f.DurationVar(&cfg.QueryIngestersWithin, "querier.query-ingesters-within", 0, "Maximum lookback beyond which queries are not sent to ingester. 0 means all queries are sent to ingester.")
+	f.DurationVar(&cfg.QueryIngestersWithinMaxExtension, "querier.query-ingesters-within-max-extension", 0, "Maximum duration by which the -querier.query-ingesters-within lookback is extended for a query when the long-term storage has no blocks covering part of the time range preceding it and the ingesters still hold samples in it, for example because the blocks have not been shipped or compacted yet. The responses of the extended queries have a warning. Works only with the blocks storage. 0 to disable.")
 	f.BoolVar(&cfg.QueryStoreForLabels, "querier.query-store-for-labels-enabled", false, "Query long-term store for series, label values and label names APIs. Works only with blocks engine.")
-	f.BoolVar(&cfg.AtModifierEnabled, "querier.at-modifier-enabled", false, "Enable the @ modifier in PromQL.")
+	f.BoolVar(&cfg.AtModifierEnabled, "querier.at-modifier-enabled", false, "Enable the @ modifier and the negative offsets in PromQL.")
+	f.BoolVar(&cfg.LazyMergeEnabled, "querier.lazy-merge-enabled", false, "Lazily merge the series fetched from the ingesters and the long-term storage, decoding the chunks of each series only when its samples are read, instead of materializing all the series before handing them to the PromQL engine. This reduces the memory allocations of the queries selecting a large number of series.")
 	f.DurationVar(&cfg.MaxQueryIntoFuture, "querier.max-query-into-future", 10*time.Minute, "Maximum duration into the future you can query. 0 to disable.")
 	f.DurationVar(&cfg.DefaultEvaluationInterval, "querier.default-evaluation-interval", time.Minute, "The default evaluation interval or step size for subqueries.")
 	f.DurationVar(&cfg.QueryStoreAfter, "querier.query-store-after", 0, "The time after which a metric should be queried from storage and not just ingesters. 0 means all queries are sent to store. When running the blocks storage, if this option is enabled, the time range of the query sent to the store will be manipulated to ensure the query end is not more recent than 'now - query-store-after'.")
@@ -100,6 +116,9 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.LookbackDelta, "querier.lookback-delta", 5*time.Minute, "Time since the last sample after which a time series is considered stale and ignored by expression evaluations.")
 	f.StringVar(&cfg.SecondStoreEngine, "querier.second-store-engine", "", "Second store engine to use for querying. Empty = disabled.")
 	f.Var(&cfg.UseSecondStoreBeforeTime, "querier.use-second-store-before-time", "If specified, second store is only used for queries before this timestamp. Default value 0 means secondary store is always queried.")
+	f.DurationVar(&cfg.LabelCacheTTL, "querier.label-cache-ttl", 0, "TTL of the in-memory cache of the label names and values responses, by tenant, matchers and time range. The cached responses are not invalidated before the TTL expires. 0 to disable the cache.")
+	f.DurationVar(&cfg.LabelCacheTimeRangeBucket, "querier.label-cache-time-range-bucket", time.Minute, "The time range of the label names and values requests is rounded to this bucket to build the cache key, so that requests with slightly different time ranges share the cached response.")
+	f.IntVar(&cfg.LabelCacheMaxSizeItems, "querier.label-cache-max-size-items", 10000, "Maximum number of responses in the label names and values cache.")
 	f.DurationVar(&cfg.ShuffleShardingIngestersLookbackPeriod, "querier.shuffle-sharding-ingesters-lookback-period", 0, "When distributor's sharding strategy is shuffle-sharding and this setting is > 0, queriers fetch in-memory series from the minimum set of required ingesters, selecting only ingesters which may have received series since 'now - lookback period'. The lookback period should be greater or equal than the configured 'query store after' and 'query ingesters within'. If this setting is 0, queriers always query all ingesters (ingesters shuffle sharding on read path is disabled).")
 }
 
@@ -147,16 +166,35 @@ func NewChunkStoreQueryable(cfg Config, chunkStore chunkstore.ChunkStore) storag
 func New(cfg Config, limits *validation.Overrides, distributor Distributor, stores []QueryableWithFilter, tombstonesLoader *purger.TombstonesLoader, reg prometheus.Registerer, logger log.Logger) (storage.SampleAndChunkQueryable, storage.ExemplarQueryable, *promql.Engine) {
 	iteratorFunc := getChunksIteratorFunction(cfg)
 
-	distributorQueryable := newDistributorQueryable(distributor, cfg.IngesterStreaming, iteratorFunc, cfg.QueryIngestersWithin)
+	distributorQueryable := newDistributorQueryable(distributor, cfg.IngesterStreaming, cfg.LazyMergeEnabled, iteratorFunc, cfg.QueryIngestersWithin)
+	if cfg.QueryIngestersWithin > 0 && cfg.QueryIngestersWithinMaxExtension > 0 {
+		if finder := blocksFinderFromStores(stores); finder != nil {
+			distributorQueryable = distributorQueryable.withQueryIngestersWithinExtension(finder, cfg.QueryIngestersWithinMaxExtension)
+		} else {
+			level.Warn(logger).Log("msg", "the query ingesters within extension is enabled but not supported by the configured storage")
+		}
+	}
 
 	ns := make([]QueryableWithFilter, len(stores))
 	for ix, s := range stores {
+		// The series snapshots are only queried for the recent data.
+		if _, ok := s.(*SeriesSnapshotQueryable); ok {
+			ns[ix] = s
+			continue
+		}
+
 		ns[ix] = storeQueryable{
 			QueryableWithFilter: s,
 			QueryStoreAfter:     cfg.QueryStoreAfter,
 		}
 	}
 	queryable := NewQueryable(distributorQueryable, ns, iteratorFunc, cfg, limits, tombstonesLoader)
+	if cfg.LabelCacheTTL > 0 {
+		labelsCache := cache.NewFifoCache("label-cache", cache.FifoCacheConfig{MaxSizeItems: cfg.LabelCacheMaxSizeItems, Validity: cfg.LabelCacheTTL}, reg, logger)
+		if labelsCache != nil {
+			queryable = newLabelsCacheQueryable(queryable, labelsCache, cfg.LabelCacheTimeRangeBucket, reg)
+		}
+	}
 	exemplarQueryable := newDistributorExemplarQueryable(distributor)
 
 	lazyQueryable := storage.QueryableFunc(func(ctx context.Context, mint int64, maxt int64) (storage.Querier, error) {
@@ -168,13 +206,14 @@ func New(cfg Config, limits *validation.Overrides, distributor Distributor, stor
 	})
 
 	engine := promql.NewEngine(promql.EngineOpts{
-		Logger:             logger,
-		Reg:                reg,
-		ActiveQueryTracker: createActiveQueryTracker(cfg, logger),
-		MaxSamples:         cfg.MaxSamples,
-		Timeout:            cfg.Timeout,
-		LookbackDelta:      cfg.LookbackDelta,
-		EnableAtModifier:   cfg.AtModifierEnabled,
+		Logger:               logger,
+		Reg:                  reg,
+		ActiveQueryTracker:   createActiveQueryTracker(cfg, logger),
+		MaxSamples:           cfg.MaxSamples,
+		Timeout:              cfg.Timeout,
+		LookbackDelta:        cfg.LookbackDelta,
+		EnableAtModifier:     cfg.AtModifierEnabled,
+		EnableNegativeOffset: cfg.AtModifierEnabled,
 		NoStepSubqueryIntervalFn: func(int64) int64 {
 			return cfg.DefaultEvaluationInterval.Milliseconds()
 		},
@@ -182,6 +221,20 @@ func New(cfg Config, limits *validation.Overrides, distributor Distributor, stor
 	return NewSampleAndChunkQueryable(lazyQueryable), exemplarQueryable, engine
 }
 
+// blocksFinderFromStores returns the blocks finder of the blocks storage queryable, if any.
+func blocksFinderFromStores(stores []QueryableWithFilter) BlocksFinder {
+	for _, s := range stores {
+		q, ok := s.(alwaysTrueFilterQueryable)
+		if !ok {
+			continue
+		}
+		if bq, ok := q.Queryable.(*BlocksStoreQueryable); ok {
+			return bq.finder
+		}
+	}
+	return nil
+}
+
 // NewSampleAndChunkQueryable creates a SampleAndChunkQueryable from a
 // Queryable with a ChunkQueryable stub, that errors once it get's called.
 func NewSampleAndChunkQueryable(q storage.Queryable) storage.SampleAndChunkQueryable {
@@ -225,7 +278,13 @@ func NewQueryable(distributor QueryableWithFilter, stores []QueryableWithFilter,
 			return nil, err
 		}
 
-		ctx = limiter.AddQueryLimiterToContext(ctx, limiter.NewQueryLimiter(limits.MaxFetchedSeriesPerQuery(userID), limits.MaxFetchedChunkBytesPerQuery(userID), limits.MaxChunksPerQuery(userID)))
+		// The queries reading the cold blocks have their own chunks limit.
+		maxChunksPerQuery := limits.MaxChunksPerQuery(userID)
+		if storegateway.IsColdBlock(mint, now, cfg.ColdBlocksMinAge) {
+			maxChunksPerQuery = limits.MaxChunksPerColdQuery(userID)
+		}
+
+		ctx = limiter.AddQueryLimiterToContext(ctx, limiter.NewQueryLimiter(limits.MaxFetchedSeriesPerQuery(userID), limits.MaxFetchedChunkBytesPerQuery(userID), maxChunksPerQuery))
 
 		mint, maxt, err = validateQueryTimeRange(ctx, userID, mint, maxt, limits, cfg.MaxQueryIntoFuture)
 		if err == errEmptyTimeRange {
@@ -234,15 +293,22 @@ func NewQueryable(distributor QueryableWithFilter, stores []QueryableWithFilter,
 			return nil, err
 		}
 
+		// The tenants accepting partial results get the series of the chunks with a valid time range,
+		// instead of failing the query, if some chunks have an inverted one.
+		if limits.PartialResultsOnTimeout(userID) {
+			ctx = contextWithSkipInvalidChunks(ctx)
+		}
+
 		q := querier{
 			ctx:                 ctx,
 			mint:                mint,
 			maxt:                maxt,
-			chunkIterFn:         chunkIterFn,
+			chunkIterFn:         chunkIteratorFuncFromContext(ctx, chunkIterFn),
 			tombstonesLoader:    tombstonesLoader,
 			limits:              limits,
 			maxQueryIntoFuture:  cfg.MaxQueryIntoFuture,
 			queryStoreForLabels: cfg.QueryStoreForLabels,
+			lazyMerge:           cfg.LazyMergeEnabled,
 		}
 
 		dqr, err := distributor.Querier(ctx, mint, maxt)
@@ -252,7 +318,25 @@ func NewQueryable(distributor QueryableWithFilter, stores []QueryableWithFilter,
 
 		q.metadataQuerier = dqr
 
+		// When the partial results on timeout are enabled, the series are fetched with a context
+		// expiring shortly before the query deadline, leaving time to evaluate the query.
+		fetchCtx := ctx
+		if limits.PartialResultsOnTimeout(userID) {
+			if partialCtx, cancel := newPartialResultsFetchContext(ctx, now); partialCtx != nil {
+				fetchCtx = partialCtx
+				q.partialResultsFetchCtx = partialCtx
+				q.cancelFetch = cancel
+			}
+		}
+
 		if distributor.UseQueryable(now, mint, maxt) {
+			if fetchCtx != ctx {
+				if dqr, err = distributor.Querier(fetchCtx, mint, maxt); err != nil {
+					_ = q.Close()
+					return nil, err
+				}
+			}
+
 			q.queriers = append(q.queriers, dqr)
 		}
 
@@ -261,8 +345,9 @@ func NewQueryable(distributor QueryableWithFilter, stores []QueryableWithFilter,
 				continue
 			}
 
-			cqr, err := s.Querier(ctx, mint, maxt)
+			cqr, err := s.Querier(fetchCtx, mint, maxt)
 			if err != nil {
+				_ = q.Close()
 				return nil, err
 			}
 
@@ -288,6 +373,11 @@ type querier struct {
 	limits              *validation.Overrides
 	maxQueryIntoFuture  time.Duration
 	queryStoreForLabels bool
+	lazyMerge           bool
+
+	// Set only if the query returns partial results on timeout.
+	partialResultsFetchCtx context.Context
+	cancelFetch            context.CancelFunc
 }
 
 // Select implements storage.Querier interface.
@@ -300,6 +390,24 @@ func (q querier) Select(_ bool, sp *storage.SelectHints, matchers ...*labels.Mat
 		level.Debug(log).Log("start", util.TimeFromMillis(sp.Start).UTC().String(), "end", util.TimeFromMillis(sp.End).UTC().String(), "step", sp.Step, "matchers", matchers)
 	}
 
+	// The series of a vertical shard of the query, selected by the query-frontend, are
+	// filtered by the hash of their labels by the ingesters and the store-gateways, before
+	// being sent to the querier, and once fetched for the other sources.
+	shardMatchers := matchers
+	shard, matchers, err := astmapper.QueryShardFromMatchers(matchers)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+	selectSource := func(querier storage.Querier) storage.SeriesSet {
+		if shard == nil {
+			return querier.Select(true, sp, matchers...)
+		}
+		if pushesDownQueryShard(querier) {
+			return querier.Select(true, sp, shardMatchers...)
+		}
+		return series.NewShardedSeriesSet(querier.Select(true, sp, matchers...), shard.Shard, shard.Of)
+	}
+
 	// Kludge: Prometheus passes nil SelectHints if it is doing a 'series' operation,
 	// which needs only metadata. Here we expect that metadataQuerier querier will handle that.
 	// In Cortex it is not feasible to query entire history (with no mint/maxt), so we only ask ingesters and skip
@@ -309,7 +417,7 @@ func (q querier) Select(_ bool, sp *storage.SelectHints, matchers ...*labels.Mat
 	if (sp == nil || sp.Func == "series") && !q.queryStoreForLabels {
 		// In this case, the query time range has already been validated when the querier has been
 		// created.
-		return q.metadataQuerier.Select(true, sp, matchers...)
+		return selectSource(q.metadataQuerier)
 	}
 
 	userID, err := tenant.TenantID(ctx)
@@ -343,17 +451,34 @@ func (q querier) Select(_ bool, sp *storage.SelectHints, matchers ...*labels.Mat
 		return storage.ErrSeriesSet(limitErr)
 	}
 
+	if q.limits.RejectSelectorsWithoutRequiredLabels(userID) {
+		if err := validation.ValidateRequiredLabelMatchers(q.limits.RequiredLabelNames(userID), matchers); err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+	}
+
 	tombstones, err := q.tombstonesLoader.GetPendingTombstonesForInterval(userID, startTime, endTime)
 	if err != nil {
 		return storage.ErrSeriesSet(err)
 	}
 
+	var partialResults *partialResultsTracker
+	if q.partialResultsFetchCtx != nil {
+		partialResults = newPartialResultsTracker(q.ctx, q.partialResultsFetchCtx)
+	}
+
 	if len(q.queriers) == 1 {
-		seriesSet := q.queriers[0].Select(true, sp, matchers...)
+		seriesSet := selectSource(q.queriers[0])
 
+		if partialResults != nil {
+			seriesSet = partialResults.wrapSource(seriesSet)
+		}
 		if tombstones.Len() != 0 {
 			seriesSet = series.NewDeletedSeriesSet(seriesSet, tombstones, model.Interval{Start: startTime, End: endTime})
 		}
+		if partialResults != nil {
+			seriesSet = partialResults.wrapResult(seriesSet)
+		}
 
 		return seriesSet
 	}
@@ -361,7 +486,11 @@ func (q querier) Select(_ bool, sp *storage.SelectHints, matchers ...*labels.Mat
 	sets := make(chan storage.SeriesSet, len(q.queriers))
 	for _, querier := range q.queriers {
 		go func(querier storage.Querier) {
-			sets <- querier.Select(true, sp, matchers...)
+			set := selectSource(querier)
+			if partialResults != nil {
+				set = partialResults.wrapSource(set)
+			}
+			sets <- set
 		}(querier)
 	}
 
@@ -378,14 +507,37 @@ func (q querier) Select(_ bool, sp *storage.SelectHints, matchers ...*labels.Mat
 	// we have all the sets from different sources (chunk from store, chunks from ingesters,
 	// time series from store and time series from ingesters).
 	// mergeSeriesSets will return sorted set.
-	seriesSet := q.mergeSeriesSets(result)
+	var seriesSet storage.SeriesSet
+	if q.lazyMerge {
+		// All sets are sorted, so we can k-way merge them by labels while they're iterated,
+		// without reading them upfront. The samples of series in multiple sets are merged
+		// (and deduplicated) only when the merged series is iterated.
+		seriesSet = storage.NewMergeSeriesSet(result, storage.ChainedSeriesMerge)
+	} else {
+		seriesSet = q.mergeSeriesSets(result)
+	}
 
 	if tombstones.Len() != 0 {
 		seriesSet = series.NewDeletedSeriesSet(seriesSet, tombstones, model.Interval{Start: startTime, End: endTime})
 	}
+	if partialResults != nil {
+		seriesSet = partialResults.wrapResult(seriesSet)
+	}
 	return seriesSet
 }
 
+// pushesDownQueryShard returns whether the querier selects only the series of the vertical shard of
+// the query at their source when passed the astmapper.QueryShardLabel matcher, because the ingesters
+// and the store-gateways filter the series by the hash of their labels.
+func pushesDownQueryShard(querier storage.Querier) bool {
+	switch querier.(type) {
+	case *distributorQuerier, *blocksStoreQuerier:
+		return true
+	default:
+		return false
+	}
+}
+
 // LabelsValue implements storage.Querier.
 func (q querier) LabelValues(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
 	if !q.queryStoreForLabels {
@@ -475,7 +627,10 @@ func (q querier) LabelNames(matchers ...*labels.Matcher) ([]string, storage.Warn
 	return strutil.MergeSlices(sets...), warnings, nil
 }
 
-func (querier) Close() error {
+func (q querier) Close() error {
+	if q.cancelFetch != nil {
+		q.cancelFetch()
+	}
 	return nil
 }
 
@@ -1,10 +1,21 @@
 package querier
 
 import (
+	"context"
 	"fmt"
+	"runtime"
 	"testing"
 
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/purger"
+	"github.com/cortexproject/cortex/pkg/querier/batch"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 var result *promql.Result
@@ -36,3 +47,82 @@ func BenchmarkChunkQueryableFromTar(b *testing.B) {
 		runRangeQuery(b, query, from, through, step, store)
 	})
 }
+
+func BenchmarkQuerier_Select(b *testing.B) {
+	const (
+		numSeries  = 100000
+		numSamples = 120
+	)
+
+	// The ingesters and the store return the same series, like it happens for the most recent blocks
+	// which have been shipped to the storage while still in the ingesters.
+	ingesters := &mockDistributor{}
+	ingesters.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(generateQueryStreamResponse(b, 0, numSeries, 0, numSamples), nil)
+	store := &mockDistributor{}
+	store.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(generateQueryStreamResponse(b, 0, numSeries, 0, numSamples), nil)
+
+	overrides, err := validation.NewOverrides(defaultLimitsConfig(), nil)
+	require.NoError(b, err)
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	start, end := int64(0), int64(numSamples*15000)
+	matcher := labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "series")
+
+	for _, lazyMerge := range []bool{false, true} {
+		b.Run(fmt.Sprintf("lazy merge=%t", lazyMerge), func(b *testing.B) {
+			cfg := Config{LazyMergeEnabled: lazyMerge}
+			queryable := NewQueryable(
+				newDistributorQueryable(ingesters, true, lazyMerge, batch.NewChunkMergeIterator, 0),
+				[]QueryableWithFilter{UseAlwaysQueryable(newDistributorQueryable(store, true, lazyMerge, batch.NewChunkMergeIterator, 0))},
+				batch.NewChunkMergeIterator, cfg, overrides, purger.NewTombstonesLoader(nil, nil))
+
+			var peakHeapBytes uint64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				baseHeapBytes := heapAllocAfterGC()
+				b.StartTimer()
+
+				q, err := queryable.Querier(ctx, start, end)
+				require.NoError(b, err)
+
+				// Like the PromQL engine, we first expand the series set and then iterate the series one by one.
+				var expanded []storage.Series
+				set := q.Select(true, &storage.SelectHints{Start: start, End: end}, matcher)
+				for set.Next() {
+					expanded = append(expanded, set.At())
+				}
+				require.NoError(b, set.Err())
+				require.Len(b, expanded, numSeries)
+
+				// Measure the memory retained by the expanded series set, excluding the responses
+				// which are retained by the mocks.
+				b.StopTimer()
+				if heapBytes := heapAllocAfterGC() - baseHeapBytes; heapBytes > peakHeapBytes {
+					peakHeapBytes = heapBytes
+				}
+				b.StartTimer()
+
+				for _, s := range expanded {
+					it := s.Iterator()
+					for it.Next() {
+					}
+					require.NoError(b, it.Err())
+				}
+			}
+
+			b.ReportMetric(float64(peakHeapBytes), "peak-heap-bytes")
+		})
+	}
+}
+
+func heapAllocAfterGC() uint64 {
+	runtime.GC()
+
+	stats := runtime.MemStats{}
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
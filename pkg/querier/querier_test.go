@@ -11,9 +11,14 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/stretchr/testify/mock"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/cortexproject/cortex/pkg/chunk/purger"
 	"github.com/cortexproject/cortex/pkg/cortexpb"
@@ -32,8 +37,11 @@ import (
 	promchunk "github.com/cortexproject/cortex/pkg/chunk/encoding"
 	"github.com/cortexproject/cortex/pkg/ingester/client"
 	"github.com/cortexproject/cortex/pkg/prom1/storage/metric"
+	"github.com/cortexproject/cortex/pkg/querier/astmapper"
 	"github.com/cortexproject/cortex/pkg/querier/batch"
 	"github.com/cortexproject/cortex/pkg/querier/iterators"
+	"github.com/cortexproject/cortex/pkg/querier/stats"
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/chunkcompat"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
@@ -140,6 +148,7 @@ var (
 func TestQuerier(t *testing.T) {
 	var cfg Config
 	flagext.DefaultValues(&cfg)
+	cfg.ActiveQueryTrackerDir = t.TempDir()
 
 	const chunks = 24
 
@@ -356,6 +365,7 @@ func TestQuerier_ValidateQueryTimeRange_MaxQueryIntoFuture(t *testing.T) {
 
 	cfg := Config{}
 	flagext.DefaultValues(&cfg)
+	cfg.ActiveQueryTrackerDir = t.TempDir()
 
 	for _, ingesterStreaming := range []bool{true, false} {
 		cfg.IngesterStreaming = ingesterStreaming
@@ -437,6 +447,7 @@ func TestQuerier_ValidateQueryTimeRange_MaxQueryLength(t *testing.T) {
 		t.Run(testName, func(t *testing.T) {
 			var cfg Config
 			flagext.DefaultValues(&cfg)
+			cfg.ActiveQueryTrackerDir = t.TempDir()
 
 			limits := defaultLimitsConfig()
 			limits.MaxQueryLength = model.Duration(maxQueryLength)
@@ -474,6 +485,67 @@ func TestQuerier_ValidateQueryTimeRange_MaxQueryLength(t *testing.T) {
 	}
 }
 
+func TestQuerier_RejectSelectorsWithoutRequiredLabels(t *testing.T) {
+	tests := map[string]struct {
+		query    string
+		enabled  bool
+		expected error
+	}{
+		"should allow query with the required labels": {
+			query:   `rate(foo{cluster="c1"}[1m])`,
+			enabled: true,
+		},
+		"should allow query without a selector on the required labels": {
+			query:   "rate(foo[1m])",
+			enabled: true,
+		},
+		"should forbid query only matching the series missing a required label": {
+			query:    `rate(foo{cluster=""}[1m])`,
+			enabled:  true,
+			expected: errors.New(`expanding series: the selector cluster="" can only match the series missing the required label "cluster"`),
+		},
+		"should allow query only matching the series missing a required label if disabled": {
+			query:   `rate(foo{cluster=""}[1m])`,
+			enabled: false,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			var cfg Config
+			flagext.DefaultValues(&cfg)
+			cfg.ActiveQueryTrackerDir = t.TempDir()
+
+			limits := defaultLimitsConfig()
+			limits.RequiredLabelNames = []string{"cluster"}
+			limits.RejectSelectorsWithoutRequiredLabels = testData.enabled
+			overrides, err := validation.NewOverrides(limits, nil)
+			require.NoError(t, err)
+
+			queryables := []QueryableWithFilter{UseAlwaysQueryable(NewChunkStoreQueryable(cfg, &emptyChunkStore{}))}
+			queryable, _, _ := New(cfg, overrides, &emptyDistributor{}, queryables, purger.NewTombstonesLoader(nil, nil), nil, log.NewNopLogger())
+
+			engine := promql.NewEngine(promql.EngineOpts{
+				Logger:     log.NewNopLogger(),
+				MaxSamples: 1e6,
+				Timeout:    1 * time.Minute,
+			})
+
+			query, err := engine.NewRangeQuery(queryable, testData.query, time.Now().Add(-time.Hour), time.Now(), time.Minute)
+			require.NoError(t, err)
+
+			r := query.Exec(user.InjectOrgID(context.Background(), "test"))
+
+			if testData.expected != nil {
+				require.NotNil(t, r.Err)
+				assert.Equal(t, testData.expected.Error(), r.Err.Error())
+			} else {
+				assert.Nil(t, r.Err)
+			}
+		})
+	}
+}
+
 func TestQuerier_ValidateQueryTimeRange_MaxQueryLookback(t *testing.T) {
 	const (
 		engineLookbackDelta = 5 * time.Minute
@@ -558,6 +630,7 @@ func TestQuerier_ValidateQueryTimeRange_MaxQueryLookback(t *testing.T) {
 
 				var cfg Config
 				flagext.DefaultValues(&cfg)
+				cfg.ActiveQueryTrackerDir = t.TempDir()
 				cfg.IngesterStreaming = ingesterStreaming
 
 				limits := defaultLimitsConfig()
@@ -632,7 +705,7 @@ func TestQuerier_ValidateQueryTimeRange_MaxQueryLookback(t *testing.T) {
 
 				t.Run("label names", func(t *testing.T) {
 					distributor := &mockDistributor{}
-					distributor.On("LabelNames", mock.Anything, mock.Anything, mock.Anything).Return([]string{}, nil)
+					distributor.On("LabelNames", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return([]string{}, nil)
 
 					queryable, _, _ := New(cfg, overrides, distributor, queryables, purger.NewTombstonesLoader(nil, nil), nil, log.NewNopLogger())
 					q, err := queryable.Querier(ctx, util.TimeToMillis(testData.queryStartTime), util.TimeToMillis(testData.queryEndTime))
@@ -659,7 +732,7 @@ func TestQuerier_ValidateQueryTimeRange_MaxQueryLookback(t *testing.T) {
 						labels.MustNewMatcher(labels.MatchNotEqual, "route", "get_user"),
 					}
 					distributor := &mockDistributor{}
-					distributor.On("MetricsForLabelMatchers", mock.Anything, mock.Anything, mock.Anything, matchers).Return([]metric.Metric{}, nil)
+					distributor.On("LabelNames", mock.Anything, mock.Anything, mock.Anything, matchers).Return([]string{}, nil)
 
 					queryable, _, _ := New(cfg, overrides, distributor, queryables, purger.NewTombstonesLoader(nil, nil), nil, log.NewNopLogger())
 					q, err := queryable.Querier(ctx, util.TimeToMillis(testData.queryStartTime), util.TimeToMillis(testData.queryEndTime))
@@ -672,7 +745,7 @@ func TestQuerier_ValidateQueryTimeRange_MaxQueryLookback(t *testing.T) {
 						// Assert on the time range of the actual executed query (5s delta).
 						delta := float64(5000)
 						require.Len(t, distributor.Calls, 1)
-						assert.Equal(t, "MetricsForLabelMatchers", distributor.Calls[0].Method)
+						assert.Equal(t, "LabelNames", distributor.Calls[0].Method)
 						args := distributor.Calls[0].Arguments
 						assert.InDelta(t, util.TimeToMillis(testData.expectedMetadataStartTime), int64(args.Get(1).(model.Time)), delta)
 						assert.InDelta(t, util.TimeToMillis(testData.expectedMetadataEndTime), int64(args.Get(2).(model.Time)), delta)
@@ -781,17 +854,24 @@ func (m *errDistributor) QueryExemplars(ctx context.Context, from, to model.Time
 func (m *errDistributor) LabelValuesForLabelName(context.Context, model.Time, model.Time, model.LabelName, ...*labels.Matcher) ([]string, error) {
 	return nil, errDistributorError
 }
-func (m *errDistributor) LabelNames(context.Context, model.Time, model.Time) ([]string, error) {
+func (m *errDistributor) LabelNames(context.Context, model.Time, model.Time, ...*labels.Matcher) ([]string, error) {
 	return nil, errDistributorError
 }
 func (m *errDistributor) MetricsForLabelMatchers(ctx context.Context, from, through model.Time, matchers ...*labels.Matcher) ([]metric.Metric, error) {
 	return nil, errDistributorError
 }
+func (m *errDistributor) MetricsForLabelMatchersWithTimeRange(ctx context.Context, from, through model.Time, matchersSet ...[]*labels.Matcher) (*client.MetricsForLabelMatchersResponse, error) {
+	return nil, errDistributorError
+}
 
 func (m *errDistributor) MetricsMetadata(ctx context.Context) ([]scrape.MetricMetadata, error) {
 	return nil, errDistributorError
 }
 
+func (m *errDistributor) IngestersMinTime(ctx context.Context) (int64, error) {
+	return 0, errDistributorError
+}
+
 type emptyChunkStore struct {
 	sync.Mutex
 	called bool
@@ -828,7 +908,7 @@ func (d *emptyDistributor) LabelValuesForLabelName(context.Context, model.Time,
 	return nil, nil
 }
 
-func (d *emptyDistributor) LabelNames(context.Context, model.Time, model.Time) ([]string, error) {
+func (d *emptyDistributor) LabelNames(context.Context, model.Time, model.Time, ...*labels.Matcher) ([]string, error) {
 	return nil, nil
 }
 
@@ -836,10 +916,18 @@ func (d *emptyDistributor) MetricsForLabelMatchers(ctx context.Context, from, th
 	return nil, nil
 }
 
+func (d *emptyDistributor) MetricsForLabelMatchersWithTimeRange(ctx context.Context, from, through model.Time, matchersSet ...[]*labels.Matcher) (*client.MetricsForLabelMatchersResponse, error) {
+	return &client.MetricsForLabelMatchersResponse{}, nil
+}
+
 func (d *emptyDistributor) MetricsMetadata(ctx context.Context) ([]scrape.MetricMetadata, error) {
 	return nil, nil
 }
 
+func (d *emptyDistributor) IngestersMinTime(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
 func TestShortTermQueryToLTS(t *testing.T) {
 	testCases := []struct {
 		name                 string
@@ -892,6 +980,7 @@ func TestShortTermQueryToLTS(t *testing.T) {
 
 	cfg := Config{}
 	flagext.DefaultValues(&cfg)
+	cfg.ActiveQueryTrackerDir = t.TempDir()
 
 	for _, ingesterStreaming := range []bool{true, false} {
 		cfg.IngesterStreaming = ingesterStreaming
@@ -1008,6 +1097,519 @@ func TestConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestQuerier_LazyMergeShouldReturnTheSameResultsAsEagerMerge(t *testing.T) {
+	const (
+		numSeries  = 100
+		numSamples = 200
+	)
+
+	// The ingesters and the store return partially overlapping series, whose samples partially overlap too.
+	ingesters := &mockDistributor{}
+	ingesters.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(generateQueryStreamResponse(t, 0, numSeries, 0, numSamples), nil)
+	store := &mockDistributor{}
+	store.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(generateQueryStreamResponse(t, numSeries/2, numSeries, numSamples/2*15000, numSamples), nil)
+
+	overrides, err := validation.NewOverrides(defaultLimitsConfig(), nil)
+	require.NoError(t, err)
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	start, end := int64(0), int64(numSamples*2*15000)
+	matcher := labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "series")
+
+	type seriesResult struct {
+		labels  labels.Labels
+		samples []cortexpb.Sample
+	}
+
+	selectSeries := func(t *testing.T, lazyMerge bool) []seriesResult {
+		cfg := Config{LazyMergeEnabled: lazyMerge}
+		queryable := NewQueryable(
+			newDistributorQueryable(ingesters, true, lazyMerge, batch.NewChunkMergeIterator, 0),
+			[]QueryableWithFilter{UseAlwaysQueryable(newDistributorQueryable(store, true, lazyMerge, batch.NewChunkMergeIterator, 0))},
+			batch.NewChunkMergeIterator, cfg, overrides, purger.NewTombstonesLoader(nil, nil))
+
+		q, err := queryable.Querier(ctx, start, end)
+		require.NoError(t, err)
+
+		var results []seriesResult
+		set := q.Select(true, &storage.SelectHints{Start: start, End: end}, matcher)
+		for set.Next() {
+			result := seriesResult{labels: set.At().Labels()}
+
+			it := set.At().Iterator()
+			for it.Next() {
+				ts, v := it.At()
+				result.samples = append(result.samples, cortexpb.Sample{TimestampMs: ts, Value: v})
+			}
+			require.NoError(t, it.Err())
+
+			results = append(results, result)
+		}
+		require.NoError(t, set.Err())
+
+		return results
+	}
+
+	queryRange := func(t *testing.T, lazyMerge bool) promql.Matrix {
+		queryable, _, engine := New(Config{LazyMergeEnabled: lazyMerge, IngesterStreaming: true, BatchIterators: true, MaxSamples: 1e6, Timeout: time.Minute, LookbackDelta: 5 * time.Minute},
+			overrides, ingesters, []QueryableWithFilter{UseAlwaysQueryable(newDistributorQueryable(store, true, lazyMerge, batch.NewChunkMergeIterator, 0))},
+			purger.NewTombstonesLoader(nil, nil), nil, log.NewNopLogger())
+
+		query, err := engine.NewRangeQuery(queryable, "sum by (group) (rate(series[1m]))", util.TimeFromMillis(start), util.TimeFromMillis(end), time.Minute)
+		require.NoError(t, err)
+
+		r := query.Exec(ctx)
+		require.NoError(t, r.Err)
+
+		m, err := r.Matrix()
+		require.NoError(t, err)
+		return m
+	}
+
+	eagerSeries := selectSeries(t, false)
+	require.Len(t, eagerSeries, numSeries+numSeries/2)
+	assert.Equal(t, eagerSeries, selectSeries(t, true))
+
+	eagerMatrix := queryRange(t, false)
+	require.NotEmpty(t, eagerMatrix)
+	assert.Equal(t, eagerMatrix, queryRange(t, true))
+}
+
+func TestQuerier_PartialResultsOnTimeout(t *testing.T) {
+	const (
+		numSeries  = 10
+		numSamples = 100
+	)
+
+	start, end := int64(0), int64(numSamples*15000)
+
+	// The ingesters are fast, while the store-gateways hang until the context is done.
+	ingesters := &mockDistributor{}
+	ingesters.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(generateQueryStreamResponse(t, 0, numSeries, 0, numSamples), nil)
+	store := &mockDistributor{}
+	store.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	}).Return((*client.QueryStreamResponse)(nil), status.Error(codes.DeadlineExceeded, context.DeadlineExceeded.Error()))
+
+	for _, lazyMerge := range []bool{false, true} {
+		for _, partialResultsEnabled := range []bool{false, true} {
+			t.Run(fmt.Sprintf("lazy merge: %t, partial results: %t", lazyMerge, partialResultsEnabled), func(t *testing.T) {
+				limits := defaultLimitsConfig()
+				limits.PartialResultsOnTimeout = partialResultsEnabled
+				overrides, err := validation.NewOverrides(limits, nil)
+				require.NoError(t, err)
+
+				queryable, _, engine := New(Config{LazyMergeEnabled: lazyMerge, IngesterStreaming: true, BatchIterators: true, MaxSamples: 1e6, Timeout: time.Second, LookbackDelta: 5 * time.Minute},
+					overrides, ingesters, []QueryableWithFilter{UseAlwaysQueryable(newDistributorQueryable(store, true, lazyMerge, batch.NewChunkMergeIterator, 0))},
+					purger.NewTombstonesLoader(nil, nil), nil, log.NewNopLogger())
+
+				query, err := engine.NewRangeQuery(queryable, "sum(series)", util.TimeFromMillis(start), util.TimeFromMillis(end), time.Minute)
+				require.NoError(t, err)
+
+				r := query.Exec(user.InjectOrgID(context.Background(), "user-1"))
+				if !partialResultsEnabled {
+					require.Error(t, r.Err)
+					return
+				}
+
+				require.NoError(t, r.Err)
+				require.Len(t, r.Warnings, 1)
+				assert.EqualError(t, r.Warnings[0], "partial results: deadline exceeded while fetching from 1 sources")
+
+				// The result should contain the data of the ingesters.
+				m, err := r.Matrix()
+				require.NoError(t, err)
+				require.Len(t, m, 1)
+				assert.NotEmpty(t, m[0].Points)
+			})
+		}
+	}
+}
+
+func TestQuerier_ShouldSkipTheChunksWithInvertedTimeRangeOnlyWithPartialResults(t *testing.T) {
+	const numSamples = 10
+
+	// The chunk of the second series has an inverted time range.
+	res := generateQueryStreamResponse(t, 1, 2, 0, numSamples)
+	require.Len(t, res.Chunkseries, 2)
+	for ix := range res.Chunkseries[1].Chunks {
+		c := &res.Chunkseries[1].Chunks[ix]
+		c.StartTimestampMs, c.EndTimestampMs = c.EndTimestampMs, c.StartTimestampMs
+	}
+
+	ingesters := &mockDistributor{}
+	ingesters.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(res, nil)
+
+	start, end := int64(0), int64(numSamples*15000)
+	matcher := labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "series")
+
+	for _, partialResultsEnabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("partial results: %t", partialResultsEnabled), func(t *testing.T) {
+			limits := defaultLimitsConfig()
+			limits.PartialResultsOnTimeout = partialResultsEnabled
+			overrides, err := validation.NewOverrides(limits, nil)
+			require.NoError(t, err)
+
+			queryable := NewQueryable(newDistributorQueryable(ingesters, true, false, batch.NewChunkMergeIterator, 0), nil,
+				batch.NewChunkMergeIterator, Config{}, overrides, purger.NewTombstonesLoader(nil, nil))
+
+			q, err := queryable.Querier(user.InjectOrgID(context.Background(), "user-1"), start, end)
+			require.NoError(t, err)
+
+			set := q.Select(true, &storage.SelectHints{Start: start, End: end}, matcher)
+			require.True(t, set.Next())
+			it := set.At().Iterator()
+			numValid := 0
+			for it.Next() {
+				numValid++
+			}
+			require.NoError(t, it.Err())
+			assert.Equal(t, numSamples, numValid)
+
+			require.True(t, set.Next())
+			it = set.At().Iterator()
+			require.False(t, it.Next())
+			if partialResultsEnabled {
+				assert.NoError(t, it.Err())
+			} else {
+				var invalidErr batch.InvalidChunkError
+				assert.True(t, errors.As(it.Err(), &invalidErr))
+			}
+
+			require.False(t, set.Next())
+			require.NoError(t, set.Err())
+		})
+	}
+}
+
+func TestQuerier_ShouldSelectTheSeriesOfTheQueryShard(t *testing.T) {
+	const (
+		numSeries  = 100
+		numSamples = 10
+		numShards  = 3
+	)
+
+	// The ingesters filter the series of the shard selected by the matchers, like the store-gateways.
+	ingesters := &mockDistributor{}
+	for shard := 0; shard < numShards; shard++ {
+		shardValue := astmapper.ShardAnnotation{Shard: shard, Of: numShards}.String()
+		ingesters.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.MatchedBy(func(matchers []*labels.Matcher) bool {
+			for _, matcher := range matchers {
+				if matcher.Name == astmapper.QueryShardLabel {
+					return matcher.Value == shardValue
+				}
+			}
+			return false
+		})).Return(filterQueryStreamResponse(generateQueryStreamResponse(t, 0, numSeries, 0, numSamples), astmapper.ShardAnnotation{Shard: shard, Of: numShards}), nil)
+	}
+	ingesters.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(generateQueryStreamResponse(t, 0, numSeries, 0, numSamples), nil)
+
+	// The other sources return all the series, which are filtered by the querier.
+	var storeMatrix model.Matrix
+	for i := numSeries / 2; i < numSeries+numSeries/2; i++ {
+		ss := &model.SampleStream{Metric: model.Metric{labels.MetricName: "series", "group": model.LabelValue(strconv.Itoa(i % 10)), "id": model.LabelValue(fmt.Sprintf("%06d", i))}}
+		for s := 0; s < numSamples; s++ {
+			ss.Values = append(ss.Values, model.SamplePair{Timestamp: model.Time(s * 15000), Value: model.SampleValue(float64(i) + float64(s))})
+		}
+		storeMatrix = append(storeMatrix, ss)
+	}
+	store := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return mockQuerier{matrix: storeMatrix}, nil
+	})
+
+	overrides, err := validation.NewOverrides(defaultLimitsConfig(), nil)
+	require.NoError(t, err)
+
+	queryable := NewQueryable(
+		newDistributorQueryable(ingesters, true, false, batch.NewChunkMergeIterator, 0),
+		[]QueryableWithFilter{UseAlwaysQueryable(store)},
+		batch.NewChunkMergeIterator, Config{}, overrides, purger.NewTombstonesLoader(nil, nil))
+
+	start, end := int64(0), int64(numSamples*15000)
+	q, err := queryable.Querier(user.InjectOrgID(context.Background(), "user-1"), start, end)
+	require.NoError(t, err)
+
+	selectSeries := func(matchers ...*labels.Matcher) []string {
+		var result []string
+		set := q.Select(true, &storage.SelectHints{Start: start, End: end}, matchers...)
+		for set.Next() {
+			result = append(result, set.At().Labels().String())
+		}
+		require.NoError(t, set.Err())
+		return result
+	}
+
+	nameMatcher := labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "series")
+	all := selectSeries(nameMatcher)
+	require.Len(t, all, numSeries+numSeries/2)
+
+	// Each series is returned by exactly one shard.
+	var sharded []string
+	for shard := 0; shard < numShards; shard++ {
+		shardMatcher := labels.MustNewMatcher(labels.MatchEqual, astmapper.QueryShardLabel, astmapper.ShardAnnotation{Shard: shard, Of: numShards}.String())
+		series := selectSeries(nameMatcher, shardMatcher)
+		assert.NotEmpty(t, series)
+		sharded = append(sharded, series...)
+	}
+	assert.ElementsMatch(t, all, sharded)
+
+	// The shard matcher is sent to the ingesters, which filter the series before sending them.
+	shardedCalls := 0
+	for _, call := range ingesters.Calls {
+		for _, matcher := range call.Arguments.Get(3).([]*labels.Matcher) {
+			if matcher.Name == astmapper.QueryShardLabel {
+				shardedCalls++
+			}
+		}
+	}
+	assert.Equal(t, numShards, shardedCalls)
+}
+
+// filterQueryStreamResponse returns the series of the response belonging to the vertical shard.
+func filterQueryStreamResponse(res *client.QueryStreamResponse, shard astmapper.ShardAnnotation) *client.QueryStreamResponse {
+	filtered := &client.QueryStreamResponse{}
+	for _, ts := range res.Timeseries {
+		if shard.ContainsSeries(cortexpb.FromLabelAdaptersToLabels(ts.Labels)) {
+			filtered.Timeseries = append(filtered.Timeseries, ts)
+		}
+	}
+	for _, cs := range res.Chunkseries {
+		if shard.ContainsSeries(cortexpb.FromLabelAdaptersToLabels(cs.Labels)) {
+			filtered.Chunkseries = append(filtered.Chunkseries, cs)
+		}
+	}
+	return filtered
+}
+
+func TestQuerier_AtModifierAndNegativeOffsetWithBlocksStorage(t *testing.T) {
+	now := time.Now()
+
+	// The long-term storage only contains a sample of store_metric, while
+	// the ingesters only contain the samples of ingester_metric of the last 30m.
+	storeSampleTime := now.Add(-3*time.Hour - time.Minute)
+
+	ingesterSamples := make([]cortexpb.Sample, 0, 31)
+	for i := 30; i >= 0; i-- {
+		ingesterSamples = append(ingesterSamples, cortexpb.Sample{TimestampMs: util.TimeToMillis(now.Add(-time.Duration(i) * time.Minute)), Value: float64(i)})
+	}
+
+	tests := map[string]struct {
+		query          string
+		start, end     time.Time
+		step           time.Duration
+		expectStore    bool
+		expectIngester bool
+		expectedValues []float64
+	}{
+		"@ end() targeting data only present in the store": {
+			query:          "store_metric @ end()",
+			start:          now.Add(-12 * time.Hour),
+			end:            now.Add(-3 * time.Hour),
+			step:           time.Hour,
+			expectStore:    true,
+			expectedValues: []float64{42, 42, 42, 42, 42, 42, 42, 42, 42, 42},
+		},
+		"@ end() targeting data only present in the ingesters": {
+			query:          "ingester_metric @ end()",
+			start:          now.Add(-12 * time.Hour),
+			end:            now,
+			step:           time.Hour,
+			expectIngester: true,
+			expectedValues: []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		"negative offset targeting data only present in the ingesters": {
+			query:          "ingester_metric offset -30m",
+			start:          now.Add(-50 * time.Minute),
+			end:            now.Add(-30 * time.Minute),
+			step:           10 * time.Minute,
+			expectIngester: true,
+			expectedValues: []float64{20, 10, 0},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			block := ulid.MustNew(1, nil)
+			finder := &blocksFinderMock{
+				Service: services.NewIdleService(nil, nil),
+			}
+			finder.On("GetBlocks", mock.Anything, "user-1", mock.Anything, mock.Anything).Return(bucketindex.Blocks{
+				{ID: block},
+			}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), error(nil))
+
+			gateway := &storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedSeriesResponses: []*storepb.SeriesResponse{
+				mockSeriesResponse(labels.Labels{{Name: labels.MetricName, Value: "store_metric"}}, util.TimeToMillis(storeSampleTime), 42),
+				mockHintsResponse(block),
+			}}
+			stores := &blocksStoreSetMock{
+				Service:         services.NewIdleService(nil, nil),
+				mockedResponses: []interface{}{map[BlocksStoreClient][]ulid.ULID{gateway: {block}}},
+			}
+
+			logger := log.NewNopLogger()
+			storeQueryable, err := NewBlocksStoreQueryable(stores, finder, NewBlocksConsistencyChecker(0, 0, logger, nil), &blocksStoreLimitsMock{}, time.Hour, 0, logger, nil)
+			require.NoError(t, err)
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), storeQueryable))
+			defer services.StopAndAwaitTerminated(context.Background(), storeQueryable) // nolint:errcheck
+
+			ingesters := &mockDistributor{}
+			ingesters.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&client.QueryStreamResponse{
+				Timeseries: []cortexpb.TimeSeries{{
+					Labels:  []cortexpb.LabelAdapter{{Name: labels.MetricName, Value: "ingester_metric"}},
+					Samples: ingesterSamples,
+				}},
+			}, nil)
+
+			overrides, err := validation.NewOverrides(defaultLimitsConfig(), nil)
+			require.NoError(t, err)
+
+			cfg := Config{
+				IngesterStreaming:    true,
+				BatchIterators:       true,
+				MaxSamples:           1e6,
+				Timeout:              time.Minute,
+				LookbackDelta:        5 * time.Minute,
+				AtModifierEnabled:    true,
+				QueryIngestersWithin: 2 * time.Hour,
+				QueryStoreAfter:      time.Hour,
+			}
+			queryable, _, engine := New(cfg, overrides, ingesters, []QueryableWithFilter{UseAlwaysQueryable(storeQueryable)}, purger.NewTombstonesLoader(nil, nil), nil, logger)
+
+			query, err := engine.NewRangeQuery(queryable, testData.query, testData.start, testData.end, testData.step)
+			require.NoError(t, err)
+
+			r := query.Exec(user.InjectOrgID(context.Background(), "user-1"))
+			require.NoError(t, r.Err)
+
+			m, err := r.Matrix()
+			require.NoError(t, err)
+			require.Len(t, m, 1)
+
+			values := make([]float64, 0, len(m[0].Points))
+			for _, p := range m[0].Points {
+				values = append(values, p.V)
+			}
+			assert.Equal(t, testData.expectedValues, values)
+
+			// Only the storage holding the selected data should have been queried.
+			assert.Equal(t, testData.expectStore, len(gateway.seriesRequests) > 0)
+			if testData.expectIngester {
+				ingesters.AssertCalled(t, "QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				ingesters.AssertNotCalled(t, "QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestQuerier_QueryStatsWithBlocksStorage(t *testing.T) {
+	now := time.Now()
+
+	// The query spans both the long-term storage and the ingesters.
+	storeSample := mockSeriesResponse(labels.Labels{{Name: labels.MetricName, Value: "store_metric"}}, util.TimeToMillis(now.Add(-3*time.Hour)), 42)
+
+	block := ulid.MustNew(1, nil)
+	finder := &blocksFinderMock{
+		Service: services.NewIdleService(nil, nil),
+	}
+	finder.On("GetBlocks", mock.Anything, "user-1", mock.Anything, mock.Anything).Return(bucketindex.Blocks{
+		{ID: block},
+	}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), error(nil))
+
+	gateway := &storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedSeriesResponses: []*storepb.SeriesResponse{
+		storeSample,
+		mockHintsResponse(block),
+	}}
+	stores := &blocksStoreSetMock{
+		Service:         services.NewIdleService(nil, nil),
+		mockedResponses: []interface{}{map[BlocksStoreClient][]ulid.ULID{gateway: {block}}},
+	}
+
+	logger := log.NewNopLogger()
+	storeQueryable, err := NewBlocksStoreQueryable(stores, finder, NewBlocksConsistencyChecker(0, 0, logger, nil), &blocksStoreLimitsMock{}, time.Hour, 0, logger, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), storeQueryable))
+	defer services.StopAndAwaitTerminated(context.Background(), storeQueryable) // nolint:errcheck
+
+	// The stats of the ingesters are tracked by the distributor, so the mock reports them the same way.
+	ingesterResponse := generateQueryStreamResponse(t, 1, 2, util.TimeToMillis(now.Add(-30*time.Minute)), 10)
+	ingesterChunks := 0
+	for _, series := range ingesterResponse.Chunkseries {
+		ingesterChunks += len(series.Chunks)
+	}
+
+	ingesters := &mockDistributor{}
+	ingesters.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		reqStats := stats.FromContext(args.Get(0).(context.Context))
+		reqStats.AddFetchedSeries(uint64(len(ingesterResponse.Chunkseries) + len(ingesterResponse.Timeseries)))
+		reqStats.AddFetchedChunks(uint64(ingesterChunks))
+		reqStats.AddFetchedChunkBytes(uint64(ingesterResponse.ChunksSize()))
+		reqStats.AddIngesterWallTime(time.Second)
+	}).Return(ingesterResponse, nil)
+
+	overrides, err := validation.NewOverrides(defaultLimitsConfig(), nil)
+	require.NoError(t, err)
+
+	cfg := Config{
+		IngesterStreaming:    true,
+		BatchIterators:       true,
+		MaxSamples:           1e6,
+		Timeout:              time.Minute,
+		LookbackDelta:        5 * time.Minute,
+		QueryIngestersWithin: 2 * time.Hour,
+		QueryStoreAfter:      time.Hour,
+	}
+	queryable, _, engine := New(cfg, overrides, ingesters, []QueryableWithFilter{UseAlwaysQueryable(storeQueryable)}, purger.NewTombstonesLoader(nil, nil), nil, logger)
+
+	query, err := engine.NewRangeQuery(queryable, `{__name__=~"store_metric|series"}`, now.Add(-4*time.Hour), now, time.Minute)
+	require.NoError(t, err)
+
+	reqStats, ctx := stats.ContextWithEmptyStats(user.InjectOrgID(context.Background(), "user-1"))
+	r := query.Exec(ctx)
+	require.NoError(t, r.Err)
+
+	m, err := r.Matrix()
+	require.NoError(t, err)
+	require.Len(t, m, 3)
+
+	storeSeries := storeSample.GetSeries()
+	assert.Equal(t, uint64(1+2), reqStats.LoadFetchedSeries())
+	assert.Equal(t, uint64(1+ingesterChunks), reqStats.LoadFetchedChunks())
+	assert.Equal(t, uint64(countChunkBytes(storeSeries)+ingesterResponse.ChunksSize()), reqStats.LoadFetchedChunkBytes())
+	assert.Equal(t, time.Second, reqStats.LoadIngesterWallTime())
+	assert.Greater(t, reqStats.LoadStoreGatewayWallTime().Nanoseconds(), int64(0))
+}
+
+// generateQueryStreamResponse returns a response with numSeries series, starting from the
+// firstSeries, each one with numSamples samples 15s apart. The value of the samples depends only
+// on the series and the timestamp, so that overlapping responses agree. Every third series is returned
+// as samples, while the others as chunks.
+func generateQueryStreamResponse(t testing.TB, firstSeries, numSeries int, firstTimestampMs int64, numSamples int) *client.QueryStreamResponse {
+	res := &client.QueryStreamResponse{}
+
+	for i := firstSeries; i < firstSeries+numSeries; i++ {
+		lbls := []cortexpb.LabelAdapter{
+			{Name: labels.MetricName, Value: "series"},
+			{Name: "group", Value: strconv.Itoa(i % 10)},
+			{Name: "id", Value: fmt.Sprintf("%06d", i)},
+		}
+
+		samples := make([]cortexpb.Sample, 0, numSamples)
+		for s := 0; s < numSamples; s++ {
+			ts := firstTimestampMs + int64(s)*15000
+			samples = append(samples, cortexpb.Sample{TimestampMs: ts, Value: float64(i) + float64(ts/15000)})
+		}
+
+		if i%3 == 0 {
+			res.Timeseries = append(res.Timeseries, cortexpb.TimeSeries{Labels: lbls, Samples: samples})
+		} else {
+			res.Chunkseries = append(res.Chunkseries, client.TimeSeriesChunk{Labels: lbls, Chunks: convertToChunks(t, samples)})
+		}
+	}
+
+	return res
+}
+
 type mockQueryableWithFilter struct {
 	useQueryableCalled bool
 }
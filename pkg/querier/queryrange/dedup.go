@@ -0,0 +1,183 @@
+package queryrange
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/tenant"
+)
+
+// DeduplicationMiddlewareMetrics holds the metrics tracked by the deduplication middleware.
+type DeduplicationMiddlewareMetrics struct {
+	deduplicatedQueries *prometheus.CounterVec
+}
+
+// NewDeduplicationMiddlewareMetrics makes a new DeduplicationMiddlewareMetrics.
+func NewDeduplicationMiddlewareMetrics(registerer prometheus.Registerer) *DeduplicationMiddlewareMetrics {
+	return &DeduplicationMiddlewareMetrics{
+		deduplicatedQueries: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_deduplicated_queries_total",
+			Help: "Total number of queries which have been attached to an identical in-flight query, instead of being executed, per tenant.",
+		}, []string{"user"}),
+	}
+}
+
+func (m *DeduplicationMiddlewareMetrics) deleteUser(userID string) {
+	m.deduplicatedQueries.DeleteLabelValues(userID)
+}
+
+// NewDeduplicationMiddleware makes a new Middleware which executes only once the identical queries
+// received while one of them is in-flight: the other ones wait for the result of the in-flight query.
+// At most maxWaiters queries, 0 for no limit, wait for the same in-flight query. The in-flight query is
+// canceled only once all the queries waiting for it have been canceled.
+func NewDeduplicationMiddleware(maxWaiters int, metrics *DeduplicationMiddlewareMetrics) Middleware {
+	return MiddlewareFunc(func(next Handler) Handler {
+		return &deduplication{
+			next:       next,
+			maxWaiters: maxWaiters,
+			metrics:    metrics,
+			inflight:   map[string]*inflightQuery{},
+		}
+	})
+}
+
+type deduplication struct {
+	next       Handler
+	maxWaiters int
+	metrics    *DeduplicationMiddlewareMetrics
+
+	mtx      sync.Mutex
+	inflight map[string]*inflightQuery
+}
+
+// inflightQuery is a query being executed on behalf of all its waiters.
+type inflightQuery struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Guarded by the deduplication mutex.
+	waiters int
+
+	// Set before done is closed.
+	resp Response
+	err  error
+}
+
+func (d *deduplication) Do(ctx context.Context, r Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return d.next.Do(ctx, r)
+	}
+	userID := tenant.JoinTenantIDs(tenantIDs)
+	key := deduplicationKey(ctx, userID, r)
+
+	d.mtx.Lock()
+	q, ok := d.inflight[key]
+	if ok && d.maxWaiters > 0 && q.waiters >= d.maxWaiters {
+		// The query is executed on its own, without replacing the in-flight one.
+		d.mtx.Unlock()
+		return d.next.Do(ctx, r)
+	}
+	if ok {
+		d.metrics.deduplicatedQueries.WithLabelValues(userID).Inc()
+	} else {
+		q = d.execute(ctx, key, r)
+	}
+	q.waiters++
+	d.mtx.Unlock()
+
+	select {
+	case <-q.done:
+		return q.resp, q.err
+	case <-ctx.Done():
+		d.leave(key, q)
+		return nil, ctx.Err()
+	}
+}
+
+// execute starts the execution of the query, on behalf of its waiters. It must be called with the
+// mutex held.
+func (d *deduplication) execute(ctx context.Context, key string, r Request) *inflightQuery {
+	// The query is not canceled with the context of the request which started it, but only once all
+	// its waiters are gone.
+	execCtx, cancel := context.WithCancel(detachedContext{parent: ctx})
+	if deadline, ok := ctx.Deadline(); ok {
+		execCtx, cancel = context.WithDeadline(detachedContext{parent: ctx}, deadline)
+	}
+
+	q := &inflightQuery{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	d.inflight[key] = q
+
+	go func() {
+		defer cancel()
+
+		resp, err := d.next.Do(execCtx, r)
+
+		d.mtx.Lock()
+		if d.inflight[key] == q {
+			delete(d.inflight, key)
+		}
+		d.mtx.Unlock()
+
+		q.resp, q.err = resp, err
+		close(q.done)
+	}()
+
+	return q
+}
+
+// leave removes a canceled waiter from the query, and cancels the query if it was the last one.
+func (d *deduplication) leave(key string, q *inflightQuery) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	q.waiters--
+	if q.waiters > 0 {
+		return
+	}
+
+	// The canceled query must not be joined by the next identical queries.
+	if d.inflight[key] == q {
+		delete(d.inflight, key)
+	}
+	q.cancel()
+}
+
+// deduplicationKey returns the key identifying the identical queries of a tenant. The query is
+// normalized, so that the queries differing only by their formatting are identical. The consistency
+// token and the downsampling function carried by the context are part of the key, so that a query
+// waiting for a push doesn't join an in-flight query which may not see it, nor a query joins one
+// downsampled differently.
+func deduplicationKey(ctx context.Context, userID string, r Request) string {
+	query := r.GetQuery()
+	if expr, err := parser.ParseExpr(query); err == nil {
+		query = expr.String()
+	}
+
+	token := ""
+	if t, ok := client.ConsistencyTokenFromContext(ctx); ok {
+		token = t.String()
+	}
+	return fmt.Sprintf("%s:%s:%d:%d:%d:%t:%s:%s", userID, query, r.GetStart(), r.GetEnd(), r.GetStep(), r.GetCachingOptions().Disabled, token, client.DownsamplingFunctionFromContext(ctx))
+}
+
+// detachedContext carries the values of its parent, but is neither canceled with it nor shares its
+// deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
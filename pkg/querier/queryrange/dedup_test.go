@@ -0,0 +1,218 @@
+package queryrange
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+	"go.uber.org/atomic"
+
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+)
+
+// blockingHandler is a Handler counting its executions, which block until released or canceled.
+type blockingHandler struct {
+	executions atomic.Int32
+	canceled   atomic.Int32
+	started    chan struct{}
+	release    chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{
+		started: make(chan struct{}, 100),
+		release: make(chan struct{}),
+	}
+}
+
+func (h *blockingHandler) Do(ctx context.Context, r Request) (Response, error) {
+	h.executions.Inc()
+	h.started <- struct{}{}
+
+	select {
+	case <-h.release:
+		return &PrometheusResponse{Status: StatusSuccess, Error: r.GetQuery()}, nil
+	case <-ctx.Done():
+		h.canceled.Inc()
+		return nil, ctx.Err()
+	}
+}
+
+func TestDeduplicationMiddleware(t *testing.T) {
+	request := func(query string) Request {
+		return &PrometheusRequest{Query: query, Start: 0, End: 3600000, Step: 60000}
+	}
+
+	// run runs the requests concurrently, waiting for them to be in-flight before returning.
+	run := func(handler Handler, inner *blockingHandler, expectedExecutions int, reqs map[string]Request) map[string]chan error {
+		results := map[string]chan error{}
+		for name, req := range reqs {
+			results[name] = make(chan error, 1)
+			go func(req Request, result chan error) {
+				_, err := handler.Do(user.InjectOrgID(context.Background(), "user-1"), req)
+				result <- err
+			}(req, results[name])
+		}
+		for i := 0; i < expectedExecutions; i++ {
+			<-inner.started
+		}
+		return results
+	}
+
+	t.Run("should execute only once the identical in-flight queries", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		inner := newBlockingHandler()
+		handler := NewDeduplicationMiddleware(0, NewDeduplicationMiddlewareMetrics(reg)).Wrap(inner)
+
+		ctx := user.InjectOrgID(context.Background(), "user-1")
+		wg := sync.WaitGroup{}
+		for _, query := range []string{"sum(rate(up[5m]))", "sum(rate(up[5m]))", "sum( rate(up [5m] ) )"} {
+			wg.Add(1)
+			go func(query string) {
+				defer wg.Done()
+				resp, err := handler.Do(ctx, request(query))
+				require.NoError(t, err)
+				assert.Equal(t, StatusSuccess, resp.(*PrometheusResponse).Status)
+			}(query)
+		}
+
+		<-inner.started
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(handler.(*deduplication).metrics.deduplicatedQueries.WithLabelValues("user-1")) == 2
+		}, time.Second, time.Millisecond)
+		close(inner.release)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), inner.executions.Load())
+		assert.Empty(t, handler.(*deduplication).inflight)
+
+		// Once completed, the query is executed again.
+		_, err := handler.Do(ctx, request("sum(rate(up[5m]))"))
+		require.NoError(t, err)
+		<-inner.started
+		assert.Equal(t, int32(2), inner.executions.Load())
+	})
+
+	t.Run("should not deduplicate the queries differing by tenant, query or time range", func(t *testing.T) {
+		inner := newBlockingHandler()
+		handler := NewDeduplicationMiddleware(0, NewDeduplicationMiddlewareMetrics(nil)).Wrap(inner)
+
+		reqs := map[string]Request{
+			"query":      request("up"),
+			"other":      request("sum(up)"),
+			"other step": &PrometheusRequest{Query: "up", Start: 0, End: 3600000, Step: 30000},
+			"other end":  &PrometheusRequest{Query: "up", Start: 0, End: 7200000, Step: 60000},
+		}
+		results := run(handler, inner, len(reqs), reqs)
+
+		resultOtherTenant := make(chan error, 1)
+		go func() {
+			_, err := handler.Do(user.InjectOrgID(context.Background(), "user-2"), request("up"))
+			resultOtherTenant <- err
+		}()
+		<-inner.started
+
+		close(inner.release)
+		for _, result := range results {
+			require.NoError(t, <-result)
+		}
+		require.NoError(t, <-resultOtherTenant)
+		assert.Equal(t, int32(5), inner.executions.Load())
+	})
+
+	t.Run("should not deduplicate the identical queries carrying different consistency tokens", func(t *testing.T) {
+		inner := newBlockingHandler()
+		handler := NewDeduplicationMiddleware(0, NewDeduplicationMiddlewareMetrics(nil)).Wrap(inner)
+
+		ctx := user.InjectOrgID(context.Background(), "user-1")
+		ctxs := []context.Context{
+			ctx,
+			client.ContextWithConsistencyToken(ctx, client.ConsistencyToken{MaxTimestampMs: 1000, RingHash: 1}),
+			client.ContextWithConsistencyToken(ctx, client.ConsistencyToken{MaxTimestampMs: 2000, RingHash: 1}),
+		}
+
+		results := make(chan error, len(ctxs))
+		for _, ctx := range ctxs {
+			go func(ctx context.Context) {
+				_, err := handler.Do(ctx, request("up"))
+				results <- err
+			}(ctx)
+			// Each query is executed on its own, rather than joining the in-flight one.
+			<-inner.started
+		}
+
+		close(inner.release)
+		for range ctxs {
+			require.NoError(t, <-results)
+		}
+		assert.Equal(t, int32(3), inner.executions.Load())
+	})
+
+	t.Run("should execute on their own the queries beyond the max waiters", func(t *testing.T) {
+		inner := newBlockingHandler()
+		handler := NewDeduplicationMiddleware(2, NewDeduplicationMiddlewareMetrics(nil)).Wrap(inner)
+		ctx := user.InjectOrgID(context.Background(), "user-1")
+
+		results := make(chan error, 3)
+		for i := 0; i < 3; i++ {
+			go func() {
+				_, err := handler.Do(ctx, request("up"))
+				results <- err
+			}()
+		}
+
+		// Two queries share the first execution, while the third one is executed on its own.
+		<-inner.started
+		<-inner.started
+		close(inner.release)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, <-results)
+		}
+		assert.Equal(t, int32(2), inner.executions.Load())
+	})
+
+	t.Run("should cancel the in-flight query only once all its waiters are canceled", func(t *testing.T) {
+		inner := newBlockingHandler()
+		handler := NewDeduplicationMiddleware(0, NewDeduplicationMiddlewareMetrics(nil)).Wrap(inner)
+
+		ctx1, cancel1 := context.WithCancel(user.InjectOrgID(context.Background(), "user-1"))
+		ctx2, cancel2 := context.WithCancel(user.InjectOrgID(context.Background(), "user-1"))
+		defer cancel2()
+
+		result1 := make(chan error, 1)
+		go func() {
+			_, err := handler.Do(ctx1, request("up"))
+			result1 <- err
+		}()
+		<-inner.started
+
+		result2 := make(chan error, 1)
+		go func() {
+			_, err := handler.Do(ctx2, request("up"))
+			result2 <- err
+		}()
+		require.Eventually(t, func() bool {
+			d := handler.(*deduplication)
+			d.mtx.Lock()
+			defer d.mtx.Unlock()
+			return d.inflight[deduplicationKey(ctx2, "user-1", request("up"))].waiters == 2
+		}, time.Second, time.Millisecond)
+
+		// The first waiter, which started the query, is canceled, but the query keeps running.
+		cancel1()
+		assert.Equal(t, context.Canceled, <-result1)
+		assert.Equal(t, int32(0), inner.canceled.Load())
+
+		// The last waiter is canceled, which cancels the query.
+		cancel2()
+		assert.Equal(t, context.Canceled, <-result2)
+		require.Eventually(t, func() bool { return inner.canceled.Load() == 1 }, time.Second, time.Millisecond)
+		assert.Empty(t, handler.(*deduplication).inflight)
+	})
+}
@@ -0,0 +1,131 @@
+package queryrange
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+)
+
+// DownsamplingFunctionHeaderName is the name of the header signaling to the querier that the query can be
+// served with the series downsampled by the ingesters, and the function to reconstruct their samples with.
+const DownsamplingFunctionHeaderName = "Downsampling-Function"
+
+// The functions of the range vectors compatible with the downsampling, and the downsampling function
+// their samples should be reconstructed with. The rate of a counter only depends on the last sample
+// of each step interval, except for the extrapolation at the edges of the range.
+var downsamplingFunctionsByCall = map[string]client.DownsamplingFunction{
+	"rate":          client.DownsamplingLast,
+	"increase":      client.DownsamplingLast,
+	"max_over_time": client.DownsamplingMax,
+	"min_over_time": client.DownsamplingMin,
+	"avg_over_time": client.DownsamplingAvg,
+}
+
+// NewDownsamplingMiddleware makes a new Middleware signaling the queries, with a step of at least minStep,
+// which are compatible with the downsampling of the series in the ingesters.
+func NewDownsamplingMiddleware(minStep time.Duration) Middleware {
+	return MiddlewareFunc(func(next Handler) Handler {
+		return downsampling{
+			next:    next,
+			minStep: minStep,
+		}
+	})
+}
+
+type downsampling struct {
+	next    Handler
+	minStep time.Duration
+}
+
+func (d downsampling) Do(ctx context.Context, r Request) (Response, error) {
+	if r.GetStep() >= d.minStep.Milliseconds() {
+		if fn, ok := downsamplingFunction(r); ok {
+			ctx = client.ContextWithDownsamplingFunction(ctx, fn)
+		}
+	}
+	return d.next.Do(ctx, r)
+}
+
+// downsamplingFunction returns the function the downsampled samples of the series selected by the request
+// should be reconstructed with, and whether the request is compatible with the downsampling. It is if each
+// step interval of the series is used as a whole, with the same function, by every selector of the query.
+func downsamplingFunction(r Request) (client.DownsamplingFunction, bool) {
+	step := r.GetStep()
+	if step <= 0 || r.GetStart()%step != 0 {
+		return "", false
+	}
+
+	expr, err := parser.ParseExpr(r.GetQuery())
+	if err != nil {
+		return "", false
+	}
+
+	var (
+		fn         client.DownsamplingFunction
+		compatible = true
+	)
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		var selectorFn client.DownsamplingFunction
+
+		switch n := node.(type) {
+		case *parser.SubqueryExpr:
+			compatible = false
+
+		case *parser.MatrixSelector:
+			var call *parser.Call
+			if len(path) > 0 {
+				call, _ = path[len(path)-1].(*parser.Call)
+			}
+			if call == nil || n.Range.Milliseconds()%step != 0 {
+				compatible = false
+				break
+			}
+
+			var ok bool
+			if selectorFn, ok = downsamplingFunctionsByCall[call.Func.Name]; !ok {
+				compatible = false
+				break
+			}
+
+			// The rate of a counter needs at least two downsampled samples in its range.
+			if selectorFn == client.DownsamplingLast && n.Range.Milliseconds() < 2*step {
+				compatible = false
+			}
+
+		case *parser.VectorSelector:
+			if !isDownsamplingCompatibleSelector(n, step) {
+				compatible = false
+				break
+			}
+
+			// The vector selectors of the range vectors have been checked with their parent.
+			if len(path) > 0 {
+				if _, ok := path[len(path)-1].(*parser.MatrixSelector); ok {
+					break
+				}
+			}
+			selectorFn = client.DownsamplingLast
+		}
+
+		if selectorFn != "" {
+			if fn != "" && fn != selectorFn {
+				compatible = false
+			}
+			fn = selectorFn
+		}
+		return nil
+	})
+
+	if !compatible || fn == "" {
+		return "", false
+	}
+	return fn, true
+}
+
+// isDownsamplingCompatibleSelector returns whether the selector is evaluated at the end of the step intervals.
+func isDownsamplingCompatibleSelector(vs *parser.VectorSelector, step int64) bool {
+	return vs.Timestamp == nil && vs.StartOrEnd == 0 && vs.OriginalOffset.Milliseconds()%step == 0
+}
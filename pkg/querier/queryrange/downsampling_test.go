@@ -0,0 +1,93 @@
+package queryrange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+)
+
+func TestDownsamplingFunction(t *testing.T) {
+	for query, expected := range map[string]client.DownsamplingFunction{
+		`up`:                                         client.DownsamplingLast,
+		`sum by (job) (up)`:                          client.DownsamplingLast,
+		`up offset 1m`:                               client.DownsamplingLast,
+		`up offset 45s`:                              "",
+		`up @ 1000`:                                  "",
+		`up @ start()`:                               "",
+		`rate(http_requests_total[5m])`:              client.DownsamplingLast,
+		`sum(increase(http_requests_total[1h]))`:     client.DownsamplingLast,
+		`rate(http_requests_total[5m]) / up`:         client.DownsamplingLast,
+		`rate(http_requests_total[45s])`:             "",
+		`rate(http_requests_total[30s])`:             "",
+		`increase(http_requests_total[30s])`:         "",
+		`rate(http_requests_total[1m])`:              client.DownsamplingLast,
+		`max_over_time(memory_bytes[30s])`:           client.DownsamplingMax,
+		`irate(http_requests_total[5m])`:             "",
+		`max_over_time(memory_bytes[10m])`:           client.DownsamplingMax,
+		`min_over_time(memory_bytes[10m])`:           client.DownsamplingMin,
+		`avg(avg_over_time(memory_bytes[10m]))`:      client.DownsamplingAvg,
+		`max_over_time(memory_bytes[10m]) / up`:      "",
+		`max_over_time(rate(requests[5m])[1h:])`:     "",
+		`max_over_time(memory_bytes[10m:1m])`:        "",
+		`count_over_time(memory_bytes[10m])`:         "",
+		`vector(1)`:                                  "",
+		`invalid(`:                                   "",
+		`max_over_time(memory_bytes[10m] offset 1m)`: client.DownsamplingMax,
+	} {
+		t.Run(query, func(t *testing.T) {
+			fn, ok := downsamplingFunction(&PrometheusRequest{Start: 60000, End: 120000, Step: 30000, Query: query})
+			assert.Equal(t, expected != "", ok)
+			assert.Equal(t, expected, fn)
+		})
+	}
+
+	t.Run("start not aligned with the step", func(t *testing.T) {
+		_, ok := downsamplingFunction(&PrometheusRequest{Start: 61000, End: 121000, Step: 30000, Query: "up"})
+		assert.False(t, ok)
+	})
+}
+
+func TestDownsamplingMiddleware(t *testing.T) {
+	for name, tc := range map[string]struct {
+		step       int64
+		query      string
+		expectedFn client.DownsamplingFunction
+	}{
+		"compatible query": {
+			step:       60000,
+			query:      "max_over_time(memory_bytes[10m])",
+			expectedFn: client.DownsamplingMax,
+		},
+		"step lower than the min step": {
+			step:  15000,
+			query: "max_over_time(memory_bytes[10m])",
+		},
+		"incompatible query": {
+			step:  60000,
+			query: "irate(http_requests_total[10m])",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var actualFn client.DownsamplingFunction
+			next := HandlerFunc(func(ctx context.Context, _ Request) (Response, error) {
+				actualFn = client.DownsamplingFunctionFromContext(ctx)
+				return &PrometheusResponse{}, nil
+			})
+
+			req := &PrometheusRequest{Start: 0, End: 3600000, Step: tc.step, Query: tc.query}
+			_, err := NewDownsamplingMiddleware(30*time.Second).Wrap(next).Do(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedFn, actualFn)
+
+			// The function should be signaled to the querier with the encoded request.
+			httpReq, err := PrometheusCodec.EncodeRequest(client.ContextWithDownsamplingFunction(context.Background(), actualFn), req)
+			require.NoError(t, err)
+			assert.Equal(t, string(tc.expectedFn), httpReq.Header.Get(DownsamplingFunctionHeaderName))
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package queryrange
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+)
+
+// InstantQueryCacheConfig is the config for the instant queries cache.
+type InstantQueryCacheConfig struct {
+	CacheConfig  cache.Config  `yaml:"cache"`
+	TTL          time.Duration `yaml:"ttl"`
+	MaxStaleness time.Duration `yaml:"max_staleness"`
+	RecentWindow time.Duration `yaml:"recent_window"`
+}
+
+// RegisterFlags registers flags.
+func (cfg *InstantQueryCacheConfig) RegisterFlags(f *flag.FlagSet) {
+	cfg.CacheConfig.RegisterFlagsWithPrefix("frontend.instant-cache.", "", f)
+
+	f.DurationVar(&cfg.TTL, "frontend.instant-cache-ttl", 0, "How long the results of the instant queries are cached. 0 disables the instant queries cache.")
+	f.DurationVar(&cfg.MaxStaleness, "frontend.instant-cache-max-staleness", 10*time.Second, "The evaluation timestamps of the instant queries are rounded down to a multiple of this duration, and the queries whose timestamps are rounded to the same value share the same cached result. The cached result is evaluated at the timestamp of the first query, so it may have been evaluated up to this duration before or after the requested timestamp.")
+	f.DurationVar(&cfg.RecentWindow, "frontend.instant-cache-recent-window", 0, "The instant queries evaluated within this duration of the current time are not cached, unless all their selectors are pinned with the @ modifier, because the most recent samples may still be ingested. 0 to cache them.")
+}
+
+// Validate validates the config.
+func (cfg *InstantQueryCacheConfig) Validate() error {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+	if cfg.MaxStaleness < time.Millisecond {
+		return errors.New("frontend.instant-cache-max-staleness must be at least 1ms when the instant queries cache is enabled")
+	}
+	return cfg.CacheConfig.Validate()
+}
+
+// nonDeterministicFunctions are the PromQL functions whose result depends on the actual evaluation
+// timestamp, so that the result of the queries using them can't be shared across timestamps. The
+// date functions depend on it only when called without arguments.
+var nonDeterministicFunctions = map[string]bool{
+	"time":          true,
+	"minute":        false,
+	"hour":          false,
+	"day_of_month":  false,
+	"day_of_week":   false,
+	"days_in_month": false,
+	"month":         false,
+	"year":          false,
+}
+
+type instantQueryCacheMetrics struct {
+	hits   *prometheus.CounterVec
+	misses *prometheus.CounterVec
+}
+
+func newInstantQueryCacheMetrics(reg prometheus.Registerer) *instantQueryCacheMetrics {
+	return &instantQueryCacheMetrics{
+		hits: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_instant_query_cache_hits_total",
+			Help: "Total number of instant queries served from the instant queries cache per tenant.",
+		}, []string{"user"}),
+		misses: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_instant_query_cache_misses_total",
+			Help: "Total number of cacheable instant queries not found in the instant queries cache per tenant.",
+		}, []string{"user"}),
+	}
+}
+
+func (m *instantQueryCacheMetrics) deleteUser(userID string) {
+	m.hits.DeleteLabelValues(userID)
+	m.misses.DeleteLabelValues(userID)
+}
+
+// instantQueryCache caches the responses of the instant queries by tenant, query and evaluation
+// timestamp, rounded to the max staleness. The cached responses are served until the TTL expires.
+type instantQueryCache struct {
+	next    http.RoundTripper
+	cfg     InstantQueryCacheConfig
+	cache   cache.Cache
+	logger  log.Logger
+	metrics *instantQueryCacheMetrics
+
+	// Allows to mock the current time in tests.
+	now func() time.Time
+}
+
+func newInstantQueryCache(next http.RoundTripper, cfg InstantQueryCacheConfig, c cache.Cache, metrics *instantQueryCacheMetrics, logger log.Logger) *instantQueryCache {
+	return &instantQueryCache{
+		next:    next,
+		cfg:     cfg,
+		cache:   c,
+		logger:  logger,
+		metrics: metrics,
+		now:     time.Now,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *instantQueryCache) RoundTrip(r *http.Request) (*http.Response, error) {
+	tenantIDs, err := tenant.TenantIDs(r.Context())
+	if err != nil {
+		return c.next.RoundTrip(r)
+	}
+	userID := tenant.JoinTenantIDs(tenantIDs)
+
+	now := c.now()
+	key, ok, err := c.cacheKey(r, userID, now)
+	if err != nil || !ok {
+		return c.next.RoundTrip(r)
+	}
+
+	if resp, ok := c.fetch(r, key, now); ok {
+		c.metrics.hits.WithLabelValues(userID).Inc()
+		return resp, nil
+	}
+	c.metrics.misses.WithLabelValues(userID).Inc()
+
+	// The response is requested without compression, so that it can be served to any client.
+	r = r.Clone(r.Context())
+	r.Header.Del("Accept-Encoding")
+
+	resp, err := c.next.RoundTrip(r)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if c.shouldCacheResponse(resp, body) {
+		c.store(r, key, now, resp.Header, body)
+	}
+	return resp, nil
+}
+
+// cacheKey returns the cache key of the instant query, or false if the query can't be cached.
+func (c *instantQueryCache) cacheKey(r *http.Request, userID string, now time.Time) (string, bool, error) {
+	for _, value := range r.Header.Values(cacheControlHeader) {
+		if strings.Contains(value, noStoreValue) {
+			return "", false, nil
+		}
+	}
+
+	params, err := instantQueryParams(r)
+	if err != nil {
+		return "", false, err
+	}
+
+	ts := util.TimeToMillis(now)
+	if t := params.Get("time"); t != "" {
+		if ts, err = util.ParseTime(t); err != nil {
+			return "", false, err
+		}
+	}
+
+	query := params.Get("query")
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", false, err
+	}
+	// This resolves the start() and end() used with the @ modifier.
+	expr = promql.PreprocessExpr(expr, timestamp.Time(ts), timestamp.Time(ts))
+
+	if isNonDeterministic(expr) {
+		return "", false, nil
+	}
+	if c.cfg.RecentWindow > 0 && ts > util.TimeToMillis(now.Add(-c.cfg.RecentWindow)) && !isPinnedWithAtModifier(expr) {
+		return "", false, nil
+	}
+
+	return fmt.Sprintf("instant:%s:%s:%d", userID, query, ts/c.cfg.MaxStaleness.Milliseconds()), true, nil
+}
+
+// shouldCacheResponse returns whether the response is complete and can be served to any client.
+func (c *instantQueryCache) shouldCacheResponse(resp *http.Response, body []byte) bool {
+	for _, value := range resp.Header.Values(cacheControlHeader) {
+		if strings.Contains(value, noStoreValue) {
+			return false
+		}
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+	// The responses computed without the responses of all the ingesters may miss recent samples.
+	if resp.Header.Get(client.DegradedConsistencyHeaderName) != "" {
+		return false
+	}
+
+	// The responses with warnings, like the partial results on timeout, may be incomplete.
+	var promResp struct {
+		Status   string   `json:"status"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(body, &promResp); err != nil {
+		return false
+	}
+	return promResp.Status == StatusSuccess && len(promResp.Warnings) == 0
+}
+
+func (c *instantQueryCache) fetch(r *http.Request, key string, now time.Time) (*http.Response, bool) {
+	found, bufs, _ := c.cache.Fetch(r.Context(), []string{cache.HashKey(key)})
+	if len(found) != 1 {
+		return nil, false
+	}
+
+	var cached CachedInstantQueryResponse
+	if err := proto.Unmarshal(bufs[0], &cached); err != nil {
+		level.Error(util_log.WithContext(r.Context(), c.logger)).Log("msg", "error unmarshalling cached instant query response", "err", err)
+		return nil, false
+	}
+	if cached.Key != key || now.Sub(util.TimeFromMillis(cached.CachedAt)) >= c.cfg.TTL {
+		return nil, false
+	}
+
+	header := http.Header{}
+	for _, h := range cached.Headers {
+		header[h.Name] = h.Values
+	}
+	return &http.Response{
+		Status:        http.StatusText(http.StatusOK),
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+		Request:       r,
+	}, true
+}
+
+func (c *instantQueryCache) store(r *http.Request, key string, now time.Time, header http.Header, body []byte) {
+	cached := CachedInstantQueryResponse{
+		Key:      key,
+		CachedAt: util.TimeToMillis(now),
+		Body:     body,
+	}
+	for name, values := range header {
+		cached.Headers = append(cached.Headers, PrometheusResponseHeader{Name: name, Values: values})
+	}
+
+	buf, err := proto.Marshal(&cached)
+	if err != nil {
+		level.Error(util_log.WithContext(r.Context(), c.logger)).Log("msg", "error marshalling cached instant query response", "err", err)
+		return
+	}
+	c.cache.Store(r.Context(), []string{cache.HashKey(key)}, [][]byte{buf})
+}
+
+// instantQueryParams returns the parameters of the instant query, from both the URL and the form
+// body. The body is restored, so that the request can still be sent downstream.
+func instantQueryParams(r *http.Request) (url.Values, error) {
+	params := r.URL.Query()
+	if r.Method != http.MethodPost || r.Body == nil {
+		return params, nil
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/x-www-form-urlencoded" {
+		return params, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	// The form body takes precedence over the URL, as in http.Request.FormValue().
+	for name, values := range params {
+		form[name] = append(form[name], values...)
+	}
+	return form, nil
+}
+
+// isNonDeterministic returns whether the expression uses a non-deterministic function.
+func isNonDeterministic(expr parser.Expr) bool {
+	nonDeterministic := false
+	parser.Inspect(expr, func(n parser.Node, _ []parser.Node) error {
+		if call, ok := n.(*parser.Call); ok {
+			if always, found := nonDeterministicFunctions[call.Func.Name]; found && (always || len(call.Args) == 0) {
+				nonDeterministic = true
+			}
+		}
+		return nil
+	})
+	return nonDeterministic
+}
+
+// isPinnedWithAtModifier returns whether all the selectors and subqueries of the expression are
+// pinned to a timestamp with the @ modifier, so that its result doesn't depend on the evaluation
+// timestamp.
+func isPinnedWithAtModifier(expr parser.Expr) bool {
+	pinned := true
+	parser.Inspect(expr, func(n parser.Node, path []parser.Node) error {
+		switch e := n.(type) {
+		case *parser.VectorSelector:
+			if e.Timestamp == nil && !isWithinPinnedSubquery(path) {
+				pinned = false
+			}
+		case *parser.SubqueryExpr:
+			if e.Timestamp == nil && !isWithinPinnedSubquery(path) {
+				pinned = false
+			}
+		}
+		return nil
+	})
+	return pinned
+}
+
+func isWithinPinnedSubquery(path []parser.Node) bool {
+	for _, n := range path {
+		if s, ok := n.(*parser.SubqueryExpr); ok && s.Timestamp != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package queryrange
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+)
+
+const instantQueryResponseBody = `{"status":"success","data":{"resultType":"vector","result":[]}}`
+
+func TestInstantQueryCache_RoundTrip(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	cfg := InstantQueryCacheConfig{TTL: 5 * time.Second, MaxStaleness: 10 * time.Second}
+
+	setup := func(cfg InstantQueryCacheConfig) (*instantQueryCache, *instantQueryCacheMockRoundTripper, *prometheus.Registry) {
+		reg := prometheus.NewPedanticRegistry()
+		downstream := &instantQueryCacheMockRoundTripper{body: instantQueryResponseBody, statusCode: http.StatusOK}
+		c := cache.NewFifoCache("test", cache.FifoCacheConfig{MaxSizeItems: 100, Validity: time.Hour}, nil, log.NewNopLogger())
+		qc := newInstantQueryCache(downstream, cfg, c, newInstantQueryCacheMetrics(reg), log.NewNopLogger())
+		qc.now = func() time.Time { return now }
+		return qc, downstream, reg
+	}
+
+	query := func(t *testing.T, rt http.RoundTripper, userID string, params url.Values) string {
+		req, err := http.NewRequest(http.MethodGet, "/api/v1/query?"+params.Encode(), nil)
+		require.NoError(t, err)
+		req = req.WithContext(user.InjectOrgID(context.Background(), userID))
+
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	t.Run("should not reach the downstream on a repeated query within the TTL", func(t *testing.T) {
+		qc, downstream, reg := setup(cfg)
+		params := url.Values{"query": []string{"up"}, "time": []string{"1000000"}}
+
+		assert.Equal(t, instantQueryResponseBody, query(t, qc, "user-1", params))
+		now = now.Add(4 * time.Second)
+		assert.Equal(t, instantQueryResponseBody, query(t, qc, "user-1", params))
+		assert.Equal(t, 1, downstream.calls)
+
+		// The entry expires once the TTL has elapsed.
+		now = now.Add(time.Second)
+		query(t, qc, "user-1", params)
+		assert.Equal(t, 2, downstream.calls)
+
+		assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_query_frontend_instant_query_cache_hits_total Total number of instant queries served from the instant queries cache per tenant.
+			# TYPE cortex_query_frontend_instant_query_cache_hits_total counter
+			cortex_query_frontend_instant_query_cache_hits_total{user="user-1"} 1
+			# HELP cortex_query_frontend_instant_query_cache_misses_total Total number of cacheable instant queries not found in the instant queries cache per tenant.
+			# TYPE cortex_query_frontend_instant_query_cache_misses_total counter
+			cortex_query_frontend_instant_query_cache_misses_total{user="user-1"} 2
+		`)))
+	})
+
+	t.Run("should share the cached result across the timestamps within the max staleness", func(t *testing.T) {
+		qc, downstream, _ := setup(cfg)
+
+		query(t, qc, "user-1", url.Values{"query": []string{"up"}, "time": []string{"1000000"}})
+		query(t, qc, "user-1", url.Values{"query": []string{"up"}, "time": []string{"1000009.5"}})
+		assert.Equal(t, 1, downstream.calls)
+
+		query(t, qc, "user-1", url.Values{"query": []string{"up"}, "time": []string{"1000010"}})
+		assert.Equal(t, 2, downstream.calls)
+	})
+
+	t.Run("should not share the cached result across tenants and queries", func(t *testing.T) {
+		qc, downstream, _ := setup(cfg)
+
+		query(t, qc, "user-1", url.Values{"query": []string{"up"}})
+		query(t, qc, "user-2", url.Values{"query": []string{"up"}})
+		query(t, qc, "user-1", url.Values{"query": []string{"sum(up)"}})
+		assert.Equal(t, 3, downstream.calls)
+	})
+
+	t.Run("should bypass the cache for the queries using non-deterministic functions", func(t *testing.T) {
+		qc, downstream, _ := setup(cfg)
+
+		for _, q := range []string{"time()", "up > time() - 60", "hour()"} {
+			query(t, qc, "user-1", url.Values{"query": []string{q}})
+			query(t, qc, "user-1", url.Values{"query": []string{q}})
+		}
+		assert.Equal(t, 6, downstream.calls)
+
+		// The date functions are deterministic when called with arguments.
+		query(t, qc, "user-1", url.Values{"query": []string{"hour(timestamp(up))"}})
+		query(t, qc, "user-1", url.Values{"query": []string{"hour(timestamp(up))"}})
+		assert.Equal(t, 7, downstream.calls)
+
+		assert.Equal(t, float64(1), testutil.ToFloat64(qc.metrics.misses.WithLabelValues("user-1")))
+		assert.Equal(t, float64(1), testutil.ToFloat64(qc.metrics.hits.WithLabelValues("user-1")))
+	})
+
+	t.Run("should bypass the cache for the recent queries not pinned with the @ modifier", func(t *testing.T) {
+		recentCfg := cfg
+		recentCfg.RecentWindow = time.Minute
+		qc, downstream, _ := setup(recentCfg)
+
+		recent := url.Values{"query": []string{"up"}, "time": []string{formatUnixSeconds(now.Add(-30 * time.Second))}}
+		query(t, qc, "user-1", recent)
+		query(t, qc, "user-1", recent)
+		assert.Equal(t, 2, downstream.calls)
+
+		pinned := url.Values{"query": []string{"up @ 100 + rate(foo[1m] @ 100)"}, "time": []string{formatUnixSeconds(now.Add(-30 * time.Second))}}
+		query(t, qc, "user-1", pinned)
+		query(t, qc, "user-1", pinned)
+		assert.Equal(t, 3, downstream.calls)
+
+		old := url.Values{"query": []string{"up"}, "time": []string{formatUnixSeconds(now.Add(-2 * time.Minute))}}
+		query(t, qc, "user-1", old)
+		query(t, qc, "user-1", old)
+		assert.Equal(t, 4, downstream.calls)
+	})
+
+	t.Run("should bypass the cache if the request disables the caching", func(t *testing.T) {
+		qc, downstream, _ := setup(cfg)
+
+		for i := 0; i < 2; i++ {
+			req, err := http.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil)
+			require.NoError(t, err)
+			req.Header.Set(cacheControlHeader, noStoreValue)
+			_, err = qc.RoundTrip(req.WithContext(user.InjectOrgID(context.Background(), "user-1")))
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 2, downstream.calls)
+	})
+
+	t.Run("should not cache the failed responses and the responses with warnings", func(t *testing.T) {
+		for name, downstream := range map[string]*instantQueryCacheMockRoundTripper{
+			"failed response":        {body: `{"status":"error","errorType":"execution","error":"failed"}`, statusCode: http.StatusUnprocessableEntity},
+			"response with warnings": {body: `{"status":"success","data":{"resultType":"vector","result":[]},"warnings":["partial"]}`, statusCode: http.StatusOK},
+		} {
+			t.Run(name, func(t *testing.T) {
+				qc, _, _ := setup(cfg)
+				qc.next = downstream
+
+				assert.Equal(t, downstream.body, query(t, qc, "user-1", url.Values{"query": []string{"up"}}))
+				assert.Equal(t, downstream.body, query(t, qc, "user-1", url.Values{"query": []string{"up"}}))
+				assert.Equal(t, 2, downstream.calls)
+			})
+		}
+	})
+
+	t.Run("should cache the queries sent with a form body and preserve the body for the downstream", func(t *testing.T) {
+		qc, downstream, _ := setup(cfg)
+
+		for i := 0; i < 2; i++ {
+			req, err := http.NewRequest(http.MethodPost, "/api/v1/query", strings.NewReader("query=up&time=1000000"))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			_, err = qc.RoundTrip(req.WithContext(user.InjectOrgID(context.Background(), "user-1")))
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 1, downstream.calls)
+		assert.Equal(t, "query=up&time=1000000", downstream.lastBody)
+	})
+}
+
+func TestIsPinnedWithAtModifier(t *testing.T) {
+	for query, expected := range map[string]bool{
+		"1":                              true,
+		"up":                             false,
+		"up @ 100":                       true,
+		"up @ 100 + foo":                 false,
+		"rate(up[5m] @ 100)":             true,
+		"max_over_time(up[5m:1m] @ 100)": true,
+		"max_over_time(up[5m:1m])":       false,
+	} {
+		t.Run(query, func(t *testing.T) {
+			expr, err := parser.ParseExpr(query)
+			require.NoError(t, err)
+			assert.Equal(t, expected, isPinnedWithAtModifier(expr))
+		})
+	}
+}
+
+type instantQueryCacheMockRoundTripper struct {
+	body       string
+	statusCode int
+
+	calls    int
+	lastBody string
+}
+
+func (m *instantQueryCacheMockRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	m.calls++
+	if r.Body != nil {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		m.lastBody = string(body)
+	}
+
+	return &http.Response{
+		StatusCode: m.statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(m.body)),
+	}, nil
+}
+
+func formatUnixSeconds(t time.Time) string {
+	return encodeTime(t.UnixNano() / int64(time.Millisecond))
+}
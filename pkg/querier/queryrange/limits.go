@@ -11,6 +11,7 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/apierror"
 	"github.com/cortexproject/cortex/pkg/util/spanlogger"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
@@ -31,6 +32,40 @@ type Limits interface {
 	// MaxCacheFreshness returns the period after which results are cacheable,
 	// to prevent caching of very recent results.
 	MaxCacheFreshness(string) time.Duration
+
+	// FrontendStepAlign returns the per-tenant toggle of the step alignment.
+	FrontendStepAlign(string) string
+
+	// FrontendSplitQueries returns the per-tenant toggle of the split by interval.
+	FrontendSplitQueries(string) string
+
+	// FrontendSplitQueriesByInterval returns the per-tenant interval to split the
+	// queries by, 0 to use the query-frontend configuration.
+	FrontendSplitQueriesByInterval(string) time.Duration
+
+	// SplitQueriesTimezone returns the per-tenant IANA name of the timezone whose
+	// midnights the split queries are aligned to, empty for UTC.
+	SplitQueriesTimezone(string) string
+
+	// FrontendResultsCache returns the per-tenant toggle of the results cache.
+	FrontendResultsCache(string) string
+
+	// FrontendQuerySharding returns the per-tenant toggle of the query sharding.
+	FrontendQuerySharding(string) string
+
+	// FrontendRetries returns the per-tenant toggle of the retries.
+	FrontendRetries(string) string
+
+	// FrontendMaxRetries returns the per-tenant max number of retries, 0 to use
+	// the query-frontend configuration.
+	FrontendMaxRetries(string) int
+
+	// FrontendDownsampling returns the per-tenant toggle of the downsampling.
+	FrontendDownsampling(string) string
+
+	// QueryVerticalShardSize returns the per-tenant number of vertical shards the
+	// aggregations are split into, 0 or 1 to disable the vertical sharding.
+	QueryVerticalShardSize(string) int
 }
 
 type limitsMiddleware struct {
@@ -89,7 +124,7 @@ func (l limitsMiddleware) Do(ctx context.Context, r Request) (Response, error) {
 	if maxQueryLength := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, l.MaxQueryLength); maxQueryLength > 0 {
 		queryLen := timestamp.Time(r.GetEnd()).Sub(timestamp.Time(r.GetStart()))
 		if queryLen > maxQueryLength {
-			return nil, httpgrpc.Errorf(http.StatusBadRequest, validation.ErrQueryTooLong, queryLen, maxQueryLength)
+			return nil, apierror.Newf(apierror.TypeLimitExceeded, validation.ErrQueryTooLong, queryLen, maxQueryLength)
 		}
 	}
 
@@ -11,6 +11,7 @@ import (
 	"github.com/weaveworks/common/user"
 
 	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/apierror"
 )
 
 func TestLimitsMiddleware_MaxQueryLookback(t *testing.T) {
@@ -170,6 +171,7 @@ func TestLimitsMiddleware_MaxQueryLength(t *testing.T) {
 			if testData.expectedErr != "" {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), testData.expectedErr)
+				assert.Equal(t, apierror.TypeLimitExceeded, apierror.FromError(err).Type)
 				assert.Nil(t, res)
 				assert.Len(t, inner.Calls, 0)
 			} else {
@@ -190,6 +192,10 @@ type mockLimits struct {
 	maxQueryLookback  time.Duration
 	maxQueryLength    time.Duration
 	maxCacheFreshness time.Duration
+
+	splitQueriesTimezone string
+
+	queryVerticalShardSize int
 }
 
 func (m mockLimits) MaxQueryLookback(string) time.Duration {
@@ -208,6 +214,46 @@ func (m mockLimits) MaxCacheFreshness(string) time.Duration {
 	return m.maxCacheFreshness
 }
 
+func (mockLimits) FrontendStepAlign(string) string {
+	return ""
+}
+
+func (mockLimits) FrontendSplitQueries(string) string {
+	return ""
+}
+
+func (mockLimits) FrontendSplitQueriesByInterval(string) time.Duration {
+	return 0
+}
+
+func (m mockLimits) SplitQueriesTimezone(string) string {
+	return m.splitQueriesTimezone
+}
+
+func (mockLimits) FrontendResultsCache(string) string {
+	return ""
+}
+
+func (mockLimits) FrontendQuerySharding(string) string {
+	return ""
+}
+
+func (mockLimits) FrontendRetries(string) string {
+	return ""
+}
+
+func (mockLimits) FrontendMaxRetries(string) int {
+	return 0
+}
+
+func (mockLimits) FrontendDownsampling(string) string {
+	return ""
+}
+
+func (m mockLimits) QueryVerticalShardSize(string) int {
+	return m.queryVerticalShardSize
+}
+
 type mockHandler struct {
 	mock.Mock
 }
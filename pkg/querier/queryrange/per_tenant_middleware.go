@@ -0,0 +1,64 @@
+package queryrange
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// MiddlewareToggle returns the per-tenant toggle of a middleware, which is either enabled,
+// disabled or empty to follow the query-frontend configuration.
+type MiddlewareToggle func(userID string) string
+
+type perTenantMiddleware struct {
+	toggle           MiddlewareToggle
+	enabledByDefault bool
+
+	// The handler running the middleware, and the one skipping it.
+	wrapped Handler
+	next    Handler
+}
+
+// NewPerTenantMiddleware returns a Middleware which runs the given middleware only for the
+// requests of the tenants for which it's enabled, and skips it otherwise. The toggle is resolved
+// on each request, so that it can be changed at runtime through the limits. A request issued by
+// multiple tenants runs the middleware only if it's enabled for all of them.
+func NewPerTenantMiddleware(m Middleware, toggle MiddlewareToggle, enabledByDefault bool) Middleware {
+	return MiddlewareFunc(func(next Handler) Handler {
+		return perTenantMiddleware{
+			toggle:           toggle,
+			enabledByDefault: enabledByDefault,
+			wrapped:          m.Wrap(next),
+			next:             next,
+		}
+	})
+}
+
+func (p perTenantMiddleware) Do(ctx context.Context, r Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+
+	for _, tenantID := range tenantIDs {
+		if !p.enabled(tenantID) {
+			return p.next.Do(ctx, r)
+		}
+	}
+	return p.wrapped.Do(ctx, r)
+}
+
+func (p perTenantMiddleware) enabled(tenantID string) bool {
+	switch p.toggle(tenantID) {
+	case validation.FrontendMiddlewareEnabled:
+		return true
+	case validation.FrontendMiddlewareDisabled:
+		return false
+	default:
+		return p.enabledByDefault
+	}
+}
@@ -0,0 +1,77 @@
+package queryrange
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestPerTenantMiddleware(t *testing.T) {
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+	defer tenant.WithDefaultResolver(tenant.NewSingleResolver())
+
+	toggles := map[string]string{
+		"enabled":  validation.FrontendMiddlewareEnabled,
+		"disabled": validation.FrontendMiddlewareDisabled,
+	}
+
+	tests := map[string]struct {
+		orgID            string
+		enabledByDefault bool
+		expectedRun      bool
+	}{
+		"should run the middleware if enabled for the tenant": {
+			orgID:            "enabled",
+			enabledByDefault: false,
+			expectedRun:      true,
+		},
+		"should skip the middleware if disabled for the tenant": {
+			orgID:            "disabled",
+			enabledByDefault: true,
+			expectedRun:      false,
+		},
+		"should follow the default if the tenant has no toggle": {
+			orgID:            "other",
+			enabledByDefault: true,
+			expectedRun:      true,
+		},
+		"should run the middleware if enabled for all the tenants": {
+			orgID:            "enabled|other",
+			enabledByDefault: true,
+			expectedRun:      true,
+		},
+		"should skip the middleware if disabled for any of the tenants": {
+			orgID:            "disabled|enabled",
+			enabledByDefault: true,
+			expectedRun:      false,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			run := false
+			m := MiddlewareFunc(func(next Handler) Handler {
+				return HandlerFunc(func(ctx context.Context, r Request) (Response, error) {
+					run = true
+					return next.Do(ctx, r)
+				})
+			})
+
+			toggle := func(userID string) string { return toggles[userID] }
+			inner := HandlerFunc(func(context.Context, Request) (Response, error) {
+				return NewEmptyPrometheusResponse(), nil
+			})
+
+			ctx := user.InjectOrgID(context.Background(), testData.orgID)
+			_, err := NewPerTenantMiddleware(m, toggle, testData.enabledByDefault).Wrap(inner).Do(ctx, &PrometheusRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedRun, run)
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/weaveworks/common/httpgrpc"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/spanlogger"
 )
@@ -160,10 +161,12 @@ func (prometheusCodec) MergeResponse(responses ...Response) (Response, error) {
 	promResponses := make([]*PrometheusResponse, 0, len(responses))
 	// we need to pass on all the headers for results cache gen numbers.
 	var resultsCacheGenNumberHeaderValues []string
+	degradedConsistency := false
 
 	for _, res := range responses {
 		promResponses = append(promResponses, res.(*PrometheusResponse))
 		resultsCacheGenNumberHeaderValues = append(resultsCacheGenNumberHeaderValues, getHeaderValuesWithName(res, ResultsCacheGenNumberHeaderName)...)
+		degradedConsistency = degradedConsistency || hasDegradedConsistency(res)
 	}
 
 	// Merge the responses.
@@ -177,6 +180,17 @@ func (prometheusCodec) MergeResponse(responses ...Response) (Response, error) {
 		},
 	}
 
+	// Deduplicate the warnings, like the partial results ones, which may be returned by multiple responses.
+	seenWarnings := map[string]struct{}{}
+	for _, res := range promResponses {
+		for _, w := range res.Warnings {
+			if _, ok := seenWarnings[w]; !ok {
+				seenWarnings[w] = struct{}{}
+				response.Warnings = append(response.Warnings, w)
+			}
+		}
+	}
+
 	if len(resultsCacheGenNumberHeaderValues) != 0 {
 		response.Headers = []*PrometheusResponseHeader{{
 			Name:   ResultsCacheGenNumberHeaderName,
@@ -184,6 +198,11 @@ func (prometheusCodec) MergeResponse(responses ...Response) (Response, error) {
 		}}
 	}
 
+	// The degraded consistency must be passed on too, so that the merged response doesn't get cached.
+	if degradedConsistency {
+		response.Headers = append(response.Headers, degradedConsistencyHeader())
+	}
+
 	return &response, nil
 }
 
@@ -255,6 +274,13 @@ func (prometheusCodec) EncodeRequest(ctx context.Context, r Request) (*http.Requ
 		Header:     http.Header{},
 	}
 
+	if fn := client.DownsamplingFunctionFromContext(ctx); fn != "" {
+		req.Header.Set(DownsamplingFunctionHeaderName, string(fn))
+	}
+	if token, ok := client.ConsistencyTokenFromContext(ctx); ok {
+		req.Header.Set(client.ConsistencyTokenHeaderName, token.String())
+	}
+
 	return req.WithContext(ctx), nil
 }
 
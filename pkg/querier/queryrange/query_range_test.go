@@ -15,6 +15,7 @@ import (
 	"github.com/weaveworks/common/user"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
 )
 
 func TestRequest(t *testing.T) {
@@ -127,6 +128,49 @@ func TestMergeAPIResponses(t *testing.T) {
 			},
 		},
 
+		{
+			name: "Warnings are deduplicated.",
+			input: []Response{
+				&PrometheusResponse{
+					Data:     PrometheusData{ResultType: matrix, Result: []SampleStream{}},
+					Warnings: []string{"partial results: deadline exceeded while fetching from 1 sources"},
+				},
+				&PrometheusResponse{
+					Data:     PrometheusData{ResultType: matrix, Result: []SampleStream{}},
+					Warnings: []string{"partial results: deadline exceeded while fetching from 1 sources", "other warning"},
+				},
+			},
+			expected: &PrometheusResponse{
+				Status: StatusSuccess,
+				Data: PrometheusData{
+					ResultType: matrix,
+					Result:     []SampleStream{},
+				},
+				Warnings: []string{"partial results: deadline exceeded while fetching from 1 sources", "other warning"},
+			},
+		},
+
+		{
+			name: "Degraded consistency is passed on.",
+			input: []Response{
+				&PrometheusResponse{
+					Data: PrometheusData{ResultType: matrix, Result: []SampleStream{}},
+				},
+				&PrometheusResponse{
+					Data:    PrometheusData{ResultType: matrix, Result: []SampleStream{}},
+					Headers: []*PrometheusResponseHeader{{Name: client.DegradedConsistencyHeaderName, Values: []string{"true"}}},
+				},
+			},
+			expected: &PrometheusResponse{
+				Status: StatusSuccess,
+				Data: PrometheusData{
+					ResultType: matrix,
+					Result:     []SampleStream{},
+				},
+				Headers: []*PrometheusResponseHeader{{Name: client.DegradedConsistencyHeaderName, Values: []string{"true"}}},
+			},
+		},
+
 		{
 			name: "A single empty response shouldn't panic.",
 			input: []Response{
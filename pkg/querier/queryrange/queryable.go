@@ -9,6 +9,7 @@ import (
 	"github.com/prometheus/prometheus/storage"
 
 	"github.com/cortexproject/cortex/pkg/querier/astmapper"
+	querier_stats "github.com/cortexproject/cortex/pkg/querier/stats"
 )
 
 const (
@@ -79,6 +80,8 @@ func (q *ShardedQuerier) handleEmbeddedQuery(encoded string) storage.SeriesSet {
 		return storage.ErrSeriesSet(err)
 	}
 
+	querier_stats.FrontendStatsFromContext(q.Ctx).AddShardedQueries(len(queries))
+
 	ctx, cancel := context.WithCancel(q.Ctx)
 	defer cancel()
 
@@ -4,6 +4,7 @@
 package queryrange
 
 import (
+	bytes "bytes"
 	fmt "fmt"
 	cortexpb "github.com/cortexproject/cortex/pkg/cortexpb"
 	github_com_cortexproject_cortex_pkg_cortexpb "github.com/cortexproject/cortex/pkg/cortexpb"
@@ -180,6 +181,7 @@ type PrometheusResponse struct {
 	ErrorType string                      `protobuf:"bytes,3,opt,name=ErrorType,proto3" json:"errorType,omitempty"`
 	Error     string                      `protobuf:"bytes,4,opt,name=Error,proto3" json:"error,omitempty"`
 	Headers   []*PrometheusResponseHeader `protobuf:"bytes,5,rep,name=Headers,proto3" json:"-"`
+	Warnings  []string                    `protobuf:"bytes,6,rep,name=Warnings,proto3" json:"warnings,omitempty"`
 }
 
 func (m *PrometheusResponse) Reset()      { *m = PrometheusResponse{} }
@@ -249,6 +251,13 @@ func (m *PrometheusResponse) GetHeaders() []*PrometheusResponseHeader {
 	return nil
 }
 
+func (m *PrometheusResponse) GetWarnings() []string {
+	if m != nil {
+		return m.Warnings
+	}
+	return nil
+}
+
 type PrometheusData struct {
 	ResultType string         `protobuf:"bytes,1,opt,name=ResultType,proto3" json:"resultType"`
 	Result     []SampleStream `protobuf:"bytes,2,rep,name=Result,proto3" json:"result"`
@@ -506,6 +515,74 @@ func (m *CachingOptions) GetDisabled() bool {
 	return false
 }
 
+type CachedInstantQueryResponse struct {
+	Key string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// The time at which the response has been cached, in milliseconds.
+	CachedAt int64                      `protobuf:"varint,2,opt,name=cached_at,json=cachedAt,proto3" json:"cached_at,omitempty"`
+	Headers  []PrometheusResponseHeader `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers"`
+	Body     []byte                     `protobuf:"bytes,4,opt,name=body,proto3" json:"body,omitempty"`
+}
+
+func (m *CachedInstantQueryResponse) Reset()      { *m = CachedInstantQueryResponse{} }
+func (*CachedInstantQueryResponse) ProtoMessage() {}
+func (*CachedInstantQueryResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_79b02382e213d0b2, []int{8}
+}
+func (m *CachedInstantQueryResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *CachedInstantQueryResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_CachedInstantQueryResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *CachedInstantQueryResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CachedInstantQueryResponse.Merge(m, src)
+}
+func (m *CachedInstantQueryResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *CachedInstantQueryResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_CachedInstantQueryResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CachedInstantQueryResponse proto.InternalMessageInfo
+
+func (m *CachedInstantQueryResponse) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *CachedInstantQueryResponse) GetCachedAt() int64 {
+	if m != nil {
+		return m.CachedAt
+	}
+	return 0
+}
+
+func (m *CachedInstantQueryResponse) GetHeaders() []PrometheusResponseHeader {
+	if m != nil {
+		return m.Headers
+	}
+	return nil
+}
+
+func (m *CachedInstantQueryResponse) GetBody() []byte {
+	if m != nil {
+		return m.Body
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*PrometheusRequest)(nil), "queryrange.PrometheusRequest")
 	proto.RegisterType((*PrometheusResponseHeader)(nil), "queryrange.PrometheusResponseHeader")
@@ -515,64 +592,70 @@ func init() {
 	proto.RegisterType((*CachedResponse)(nil), "queryrange.CachedResponse")
 	proto.RegisterType((*Extent)(nil), "queryrange.Extent")
 	proto.RegisterType((*CachingOptions)(nil), "queryrange.CachingOptions")
+	proto.RegisterType((*CachedInstantQueryResponse)(nil), "queryrange.CachedInstantQueryResponse")
 }
 
 func init() { proto.RegisterFile("queryrange.proto", fileDescriptor_79b02382e213d0b2) }
 
 var fileDescriptor_79b02382e213d0b2 = []byte{
-	// 827 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x55, 0xcd, 0x8e, 0x1b, 0x45,
-	0x10, 0x76, 0xaf, 0xed, 0xb1, 0xdd, 0x1b, 0x39, 0x4b, 0x6f, 0x04, 0xe3, 0x95, 0x98, 0xb1, 0x46,
-	0x1c, 0x16, 0x29, 0x99, 0x95, 0x16, 0x71, 0x00, 0x09, 0x94, 0x0c, 0x59, 0x14, 0x7e, 0x04, 0x51,
-	0x6f, 0xc4, 0x81, 0x0b, 0x6a, 0x7b, 0x0a, 0x7b, 0x12, 0xcf, 0x4f, 0x7a, 0x7a, 0xd0, 0xfa, 0x86,
-	0xf2, 0x04, 0x1c, 0x79, 0x04, 0x90, 0x78, 0x0c, 0x0e, 0x39, 0xee, 0x31, 0xe2, 0x30, 0xb0, 0xde,
-	0x0b, 0x9a, 0x53, 0x1e, 0x01, 0xf5, 0xcf, 0x78, 0x66, 0x77, 0xb9, 0xe4, 0x62, 0x55, 0x55, 0xd7,
-	0x57, 0xf5, 0xd5, 0xd7, 0x3d, 0x65, 0xbc, 0xf7, 0xbc, 0x00, 0xbe, 0xe6, 0x2c, 0x59, 0x80, 0x9f,
-	0xf1, 0x54, 0xa4, 0x04, 0x37, 0x91, 0x83, 0x7b, 0x8b, 0x48, 0x2c, 0x8b, 0x99, 0x3f, 0x4f, 0xe3,
-	0xa3, 0x45, 0xba, 0x48, 0x8f, 0x54, 0xca, 0xac, 0xf8, 0x51, 0x79, 0xca, 0x51, 0x96, 0x86, 0x1e,
-	0x38, 0x8b, 0x34, 0x5d, 0xac, 0xa0, 0xc9, 0x0a, 0x0b, 0xce, 0x44, 0x94, 0x26, 0xe6, 0xfc, 0xa3,
-	0x56, 0xb9, 0x79, 0xca, 0x05, 0x9c, 0x65, 0x3c, 0x7d, 0x0a, 0x73, 0x61, 0xbc, 0xa3, 0xec, 0xd9,
-	0xa2, 0x3e, 0x98, 0x19, 0xc3, 0x40, 0x27, 0xd7, 0x4b, 0xb3, 0x64, 0xad, 0x8f, 0xbc, 0x17, 0x3b,
-	0xf8, 0xad, 0xc7, 0x3c, 0x8d, 0x41, 0x2c, 0xa1, 0xc8, 0x29, 0x3c, 0x2f, 0x20, 0x17, 0x84, 0xe0,
-	0x5e, 0xc6, 0xc4, 0xd2, 0x46, 0x53, 0x74, 0x38, 0xa2, 0xca, 0x26, 0x77, 0x70, 0x3f, 0x17, 0x8c,
-	0x0b, 0x7b, 0x67, 0x8a, 0x0e, 0xbb, 0x54, 0x3b, 0x64, 0x0f, 0x77, 0x21, 0x09, 0xed, 0xae, 0x8a,
-	0x49, 0x53, 0x62, 0x73, 0x01, 0x99, 0xdd, 0x53, 0x21, 0x65, 0x93, 0x4f, 0xf0, 0x40, 0x44, 0x31,
-	0xa4, 0x85, 0xb0, 0xfb, 0x53, 0x74, 0xb8, 0x7b, 0x3c, 0xf1, 0x35, 0x25, 0xbf, 0xa6, 0xe4, 0x3f,
-	0x34, 0xd3, 0x06, 0xc3, 0x97, 0xa5, 0xdb, 0xf9, 0xf5, 0x6f, 0x17, 0xd1, 0x1a, 0x23, 0x5b, 0x2b,
-	0x5d, 0x6d, 0x4b, 0xf1, 0xd1, 0x0e, 0x79, 0x84, 0xc7, 0x73, 0x36, 0x5f, 0x46, 0xc9, 0xe2, 0xdb,
-	0x4c, 0x22, 0x73, 0x7b, 0xa0, 0x6a, 0x1f, 0xf8, 0xad, 0x6b, 0xf9, 0xec, 0x4a, 0x46, 0xd0, 0x93,
-	0xc5, 0xe9, 0x35, 0x9c, 0xf7, 0x04, 0xdb, 0x6d, 0x0d, 0xf2, 0x2c, 0x4d, 0x72, 0x78, 0x04, 0x2c,
-	0x04, 0x4e, 0x26, 0xb8, 0xf7, 0x0d, 0x8b, 0x41, 0x4b, 0x11, 0xf4, 0xab, 0xd2, 0x45, 0xf7, 0xa8,
-	0x0a, 0x91, 0x77, 0xb1, 0xf5, 0x1d, 0x5b, 0x15, 0x90, 0xdb, 0x3b, 0xd3, 0x6e, 0x73, 0x68, 0x82,
-	0xde, 0xef, 0x3b, 0x98, 0xdc, 0x2c, 0x4b, 0x3c, 0x6c, 0x9d, 0x0a, 0x26, 0x8a, 0xdc, 0x94, 0xc4,
-	0x55, 0xe9, 0x5a, 0xb9, 0x8a, 0x50, 0x73, 0x42, 0x3e, 0xc7, 0xbd, 0x87, 0x4c, 0x30, 0x25, 0xf5,
-	0xb5, 0x81, 0x9a, 0x8a, 0x32, 0x23, 0x78, 0x5b, 0x0e, 0x54, 0x95, 0xee, 0x38, 0x64, 0x82, 0xdd,
-	0x4d, 0xe3, 0x48, 0x40, 0x9c, 0x89, 0x35, 0x55, 0x78, 0xf2, 0x21, 0x1e, 0x9d, 0x70, 0x9e, 0xf2,
-	0x27, 0xeb, 0x0c, 0xd4, 0x1d, 0x8d, 0x82, 0x77, 0xaa, 0xd2, 0xdd, 0x87, 0x3a, 0xd8, 0x42, 0x34,
-	0x99, 0xe4, 0x7d, 0xdc, 0x57, 0x8e, 0xba, 0xc3, 0x51, 0xb0, 0x5f, 0x95, 0xee, 0x6d, 0x05, 0x69,
-	0xa5, 0xeb, 0x0c, 0x72, 0x82, 0x07, 0x5a, 0xa8, 0xdc, 0xee, 0x4f, 0xbb, 0x87, 0xbb, 0xc7, 0xef,
-	0xfd, 0x3f, 0xd9, 0xab, 0xaa, 0xd6, 0x52, 0xd5, 0x58, 0xef, 0x05, 0xc2, 0xe3, 0xab, 0x93, 0x11,
-	0x1f, 0x63, 0x0a, 0x79, 0xb1, 0x12, 0x8a, 0xbc, 0xd6, 0x6a, 0x5c, 0x95, 0x2e, 0xe6, 0xdb, 0x28,
-	0x6d, 0x65, 0x90, 0xfb, 0xd8, 0xd2, 0x9e, 0xba, 0x8d, 0xdd, 0x63, 0xbb, 0x4d, 0xe4, 0x94, 0xc5,
-	0xd9, 0x0a, 0x4e, 0x05, 0x07, 0x16, 0x07, 0x63, 0xa3, 0x99, 0xa5, 0x2b, 0x51, 0x83, 0xf3, 0xfe,
-	0x44, 0xf8, 0x56, 0x3b, 0x91, 0x9c, 0x61, 0x6b, 0xc5, 0x66, 0xb0, 0x92, 0x57, 0x25, 0x4b, 0xee,
-	0xfb, 0xf5, 0xf7, 0xe5, 0x7f, 0x2d, 0xe3, 0x8f, 0x59, 0xc4, 0x83, 0xaf, 0x64, 0xb5, 0xbf, 0x4a,
-	0xf7, 0x8d, 0xbe, 0x4f, 0x8d, 0x7f, 0x10, 0xb2, 0x4c, 0x00, 0x97, 0x54, 0x62, 0x10, 0x3c, 0x9a,
-	0x53, 0xd3, 0x8f, 0x7c, 0x8c, 0x07, 0xb9, 0x62, 0x92, 0x9b, 0x69, 0xf6, 0x9a, 0xd6, 0x9a, 0x62,
-	0x33, 0xc5, 0x4f, 0xea, 0xb9, 0xd1, 0x1a, 0xe0, 0x3d, 0xc5, 0x63, 0xf9, 0xea, 0x21, 0xdc, 0x3e,
-	0xb9, 0x09, 0xee, 0x3e, 0x83, 0xb5, 0xd1, 0x70, 0x50, 0x95, 0xae, 0x74, 0xa9, 0xfc, 0x91, 0x5f,
-	0x26, 0x9c, 0x09, 0x48, 0x44, 0xdd, 0x88, 0xb4, 0x65, 0x3b, 0x51, 0x47, 0xc1, 0x6d, 0xd3, 0xaa,
-	0x4e, 0xa5, 0xb5, 0xe1, 0xfd, 0x81, 0xb0, 0xa5, 0x93, 0x88, 0x5b, 0xef, 0x07, 0xd9, 0xa6, 0x1b,
-	0x8c, 0xaa, 0xd2, 0xd5, 0x81, 0x7a, 0x55, 0x4c, 0xf4, 0xaa, 0x50, 0xeb, 0x43, 0xb3, 0x80, 0x24,
-	0xd4, 0x3b, 0x63, 0x8a, 0x87, 0x82, 0xb3, 0x39, 0xfc, 0x10, 0x85, 0xe6, 0xcd, 0xd5, 0x0f, 0x44,
-	0x85, 0xbf, 0x08, 0xc9, 0xa7, 0x78, 0xc8, 0xcd, 0x38, 0x66, 0x85, 0xdc, 0xb9, 0xb1, 0x42, 0x1e,
-	0x24, 0xeb, 0xe0, 0x56, 0x55, 0xba, 0xdb, 0x4c, 0xba, 0xb5, 0xbe, 0xec, 0x0d, 0xbb, 0x7b, 0x3d,
-	0xef, 0xae, 0x96, 0xa6, 0xf9, 0xf4, 0xc9, 0x01, 0x1e, 0x86, 0x51, 0xce, 0x66, 0x2b, 0x08, 0x15,
-	0xf1, 0x21, 0xdd, 0xfa, 0xc1, 0xfd, 0xf3, 0x0b, 0xa7, 0xf3, 0xea, 0xc2, 0xe9, 0xbc, 0xbe, 0x70,
-	0xd0, 0xcf, 0x1b, 0x07, 0xfd, 0xb6, 0x71, 0xd0, 0xcb, 0x8d, 0x83, 0xce, 0x37, 0x0e, 0xfa, 0x67,
-	0xe3, 0xa0, 0x7f, 0x37, 0x4e, 0xe7, 0xf5, 0xc6, 0x41, 0xbf, 0x5c, 0x3a, 0x9d, 0xf3, 0x4b, 0xa7,
-	0xf3, 0xea, 0xd2, 0xe9, 0x7c, 0xdf, 0xfa, 0x0b, 0x98, 0x59, 0x8a, 0xdb, 0x07, 0xff, 0x05, 0x00,
-	0x00, 0xff, 0xff, 0x08, 0x83, 0xd3, 0x7d, 0x29, 0x06, 0x00, 0x00,
+	// 906 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x55, 0x4d, 0x8f, 0xdb, 0x44,
+	0x18, 0x8e, 0xf3, 0xe1, 0x24, 0xef, 0xae, 0xd2, 0x30, 0x5b, 0x15, 0x27, 0x08, 0x3b, 0xb2, 0x38,
+	0x2c, 0x52, 0x9b, 0x95, 0x16, 0x71, 0x00, 0x09, 0xd4, 0x35, 0xbb, 0xa8, 0x05, 0x04, 0x65, 0xb6,
+	0x02, 0x89, 0x4b, 0x35, 0x89, 0x07, 0xc7, 0x6d, 0xfc, 0xd1, 0xf1, 0x18, 0x36, 0x37, 0xd4, 0x5f,
+	0xc0, 0x91, 0x3f, 0x80, 0xc4, 0x81, 0x9f, 0xc1, 0xa1, 0xc7, 0x3d, 0x56, 0x48, 0x18, 0x36, 0x7b,
+	0x41, 0x3e, 0xf5, 0x27, 0xa0, 0xf9, 0x70, 0xe2, 0xed, 0x72, 0xe9, 0x25, 0x7a, 0xdf, 0x77, 0x9e,
+	0xe7, 0xfd, 0x78, 0xc6, 0xf3, 0x06, 0x86, 0x4f, 0x73, 0xca, 0x56, 0x8c, 0xc4, 0x01, 0x9d, 0xa6,
+	0x2c, 0xe1, 0x09, 0x82, 0x6d, 0x64, 0x7c, 0x27, 0x08, 0xf9, 0x22, 0x9f, 0x4d, 0xe7, 0x49, 0x74,
+	0x10, 0x24, 0x41, 0x72, 0x20, 0x21, 0xb3, 0xfc, 0x7b, 0xe9, 0x49, 0x47, 0x5a, 0x8a, 0x3a, 0xb6,
+	0x83, 0x24, 0x09, 0x96, 0x74, 0x8b, 0xf2, 0x73, 0x46, 0x78, 0x98, 0xc4, 0xfa, 0xfc, 0x83, 0x5a,
+	0xba, 0x79, 0xc2, 0x38, 0x3d, 0x4b, 0x59, 0xf2, 0x98, 0xce, 0xb9, 0xf6, 0x0e, 0xd2, 0x27, 0x41,
+	0x75, 0x30, 0xd3, 0x86, 0xa6, 0x8e, 0x5e, 0x4d, 0x4d, 0xe2, 0x95, 0x3a, 0x72, 0x9f, 0x35, 0xe1,
+	0x8d, 0x07, 0x2c, 0x89, 0x28, 0x5f, 0xd0, 0x3c, 0xc3, 0xf4, 0x69, 0x4e, 0x33, 0x8e, 0x10, 0xb4,
+	0x53, 0xc2, 0x17, 0x96, 0x31, 0x31, 0xf6, 0xfb, 0x58, 0xda, 0xe8, 0x26, 0x74, 0x32, 0x4e, 0x18,
+	0xb7, 0x9a, 0x13, 0x63, 0xbf, 0x85, 0x95, 0x83, 0x86, 0xd0, 0xa2, 0xb1, 0x6f, 0xb5, 0x64, 0x4c,
+	0x98, 0x82, 0x9b, 0x71, 0x9a, 0x5a, 0x6d, 0x19, 0x92, 0x36, 0xfa, 0x08, 0xba, 0x3c, 0x8c, 0x68,
+	0x92, 0x73, 0xab, 0x33, 0x31, 0xf6, 0x77, 0x0e, 0x47, 0x53, 0xd5, 0xd2, 0xb4, 0x6a, 0x69, 0x7a,
+	0xac, 0xa7, 0xf5, 0x7a, 0xcf, 0x0b, 0xa7, 0xf1, 0xcb, 0xdf, 0x8e, 0x81, 0x2b, 0x8e, 0x28, 0x2d,
+	0x75, 0xb5, 0x4c, 0xd9, 0x8f, 0x72, 0xd0, 0x3d, 0x18, 0xcc, 0xc9, 0x7c, 0x11, 0xc6, 0xc1, 0x57,
+	0xa9, 0x60, 0x66, 0x56, 0x57, 0xe6, 0x1e, 0x4f, 0x6b, 0xd7, 0xf2, 0xc9, 0x15, 0x84, 0xd7, 0x16,
+	0xc9, 0xf1, 0x2b, 0x3c, 0xf7, 0x21, 0x58, 0x75, 0x0d, 0xb2, 0x34, 0x89, 0x33, 0x7a, 0x8f, 0x12,
+	0x9f, 0x32, 0x34, 0x82, 0xf6, 0x97, 0x24, 0xa2, 0x4a, 0x0a, 0xaf, 0x53, 0x16, 0x8e, 0x71, 0x07,
+	0xcb, 0x10, 0x7a, 0x1b, 0xcc, 0x6f, 0xc8, 0x32, 0xa7, 0x99, 0xd5, 0x9c, 0xb4, 0xb6, 0x87, 0x3a,
+	0xe8, 0xfe, 0xd5, 0x04, 0x74, 0x3d, 0x2d, 0x72, 0xc1, 0x3c, 0xe5, 0x84, 0xe7, 0x99, 0x4e, 0x09,
+	0x65, 0xe1, 0x98, 0x99, 0x8c, 0x60, 0x7d, 0x82, 0x3e, 0x85, 0xf6, 0x31, 0xe1, 0xc4, 0x6a, 0x5e,
+	0x1f, 0x68, 0x9b, 0x51, 0x20, 0xbc, 0x5b, 0x62, 0xa0, 0xb2, 0x70, 0x06, 0x3e, 0xe1, 0xe4, 0x76,
+	0x12, 0x85, 0x9c, 0x46, 0x29, 0x5f, 0x61, 0xc9, 0x47, 0xef, 0x43, 0xff, 0x84, 0xb1, 0x84, 0x3d,
+	0x5c, 0xa5, 0x54, 0xde, 0x51, 0xdf, 0x7b, 0xb3, 0x2c, 0x9c, 0x3d, 0x5a, 0x05, 0x6b, 0x8c, 0x2d,
+	0x12, 0xbd, 0x0b, 0x1d, 0xe9, 0xc8, 0x3b, 0xec, 0x7b, 0x7b, 0x65, 0xe1, 0xdc, 0x90, 0x94, 0x1a,
+	0x5c, 0x21, 0xd0, 0x09, 0x74, 0x95, 0x50, 0x99, 0xd5, 0x99, 0xb4, 0xf6, 0x77, 0x0e, 0xdf, 0xf9,
+	0xff, 0x66, 0xaf, 0xaa, 0x5a, 0x49, 0x55, 0x71, 0xd1, 0x21, 0xf4, 0xbe, 0x25, 0x2c, 0x0e, 0xe3,
+	0x20, 0xb3, 0x4c, 0x29, 0xe6, 0xad, 0xb2, 0x70, 0xd0, 0x8f, 0x3a, 0x56, 0xab, 0xbb, 0xc1, 0xb9,
+	0xcf, 0x0c, 0x18, 0x5c, 0x55, 0x03, 0x4d, 0x01, 0x30, 0xcd, 0xf2, 0x25, 0x97, 0x03, 0x2b, 0x7d,
+	0x07, 0x65, 0xe1, 0x00, 0xdb, 0x44, 0x71, 0x0d, 0x81, 0xee, 0x82, 0xa9, 0x3c, 0x79, 0x83, 0x3b,
+	0x87, 0x56, 0xbd, 0xf9, 0x53, 0x12, 0xa5, 0x4b, 0x7a, 0xca, 0x19, 0x25, 0x91, 0x37, 0xd0, 0x3a,
+	0x9b, 0x2a, 0x13, 0xd6, 0x3c, 0xf7, 0x0f, 0x03, 0x76, 0xeb, 0x40, 0x74, 0x06, 0xe6, 0x92, 0xcc,
+	0xe8, 0x52, 0x5c, 0xaf, 0x48, 0xb9, 0x37, 0xad, 0xde, 0xe4, 0xf4, 0x0b, 0x11, 0x7f, 0x40, 0x42,
+	0xe6, 0x7d, 0x2e, 0xb2, 0xfd, 0x59, 0x38, 0xaf, 0xf5, 0xa6, 0x15, 0xff, 0xc8, 0x27, 0x29, 0xa7,
+	0x4c, 0xb4, 0x12, 0x51, 0xce, 0xc2, 0x39, 0xd6, 0xf5, 0xd0, 0x87, 0xd0, 0xcd, 0x64, 0x27, 0x99,
+	0x9e, 0x66, 0xb8, 0x2d, 0xad, 0x5a, 0xdc, 0x4e, 0xf1, 0x83, 0xfc, 0x44, 0x71, 0x45, 0x70, 0x1f,
+	0xc3, 0x40, 0xbc, 0x14, 0xea, 0x6f, 0x3e, 0xd3, 0x11, 0xb4, 0x9e, 0xd0, 0x95, 0xd6, 0xb0, 0x5b,
+	0x16, 0x8e, 0x70, 0xb1, 0xf8, 0x11, 0xaf, 0x99, 0x9e, 0x71, 0x1a, 0xf3, 0xaa, 0x10, 0xaa, 0xcb,
+	0x76, 0x22, 0x8f, 0xbc, 0x1b, 0xba, 0x54, 0x05, 0xc5, 0x95, 0xe1, 0xfe, 0x6e, 0x80, 0xa9, 0x40,
+	0xc8, 0xa9, 0x76, 0x8a, 0x28, 0xd3, 0xf2, 0xfa, 0x65, 0xe1, 0xa8, 0x40, 0xb5, 0x5e, 0x46, 0x6a,
+	0xbd, 0xc8, 0x95, 0xa3, 0xba, 0xa0, 0xb1, 0xaf, 0xf6, 0xcc, 0x04, 0x7a, 0x9c, 0x91, 0x39, 0x7d,
+	0x14, 0xfa, 0xfa, 0x3b, 0xad, 0x3e, 0x2a, 0x19, 0xbe, 0xef, 0xa3, 0x8f, 0xa1, 0xc7, 0xf4, 0x38,
+	0x7a, 0xed, 0xdc, 0xbc, 0xb6, 0x76, 0x8e, 0xe2, 0x95, 0xb7, 0x5b, 0x16, 0xce, 0x06, 0x89, 0x37,
+	0xd6, 0x67, 0xed, 0x5e, 0x6b, 0xd8, 0x76, 0x6f, 0x2b, 0x69, 0xb6, 0xeb, 0x02, 0x8d, 0xa1, 0xe7,
+	0x87, 0x19, 0x99, 0x2d, 0xa9, 0x2f, 0x1b, 0xef, 0xe1, 0x8d, 0xef, 0xfe, 0x6a, 0xc0, 0x58, 0x29,
+	0x79, 0x3f, 0xce, 0x38, 0x89, 0xf9, 0xd7, 0x42, 0x99, 0x8d, 0xaa, 0xc3, 0x9a, 0xaa, 0x4a, 0xcc,
+	0xb7, 0xa0, 0x3f, 0x97, 0xf8, 0x47, 0xa4, 0x5a, 0xad, 0x3d, 0x15, 0x38, 0xe2, 0xe8, 0x18, 0xba,
+	0x0b, 0xfd, 0xba, 0x5a, 0xaf, 0xf1, 0xba, 0xd4, 0x96, 0xab, 0xa8, 0x62, 0x23, 0xcf, 0x12, 0x7f,
+	0x25, 0x55, 0xda, 0xc5, 0xd2, 0xf6, 0xee, 0x9e, 0x5f, 0xd8, 0x8d, 0x17, 0x17, 0x76, 0xe3, 0xe5,
+	0x85, 0x6d, 0xfc, 0xb4, 0xb6, 0x8d, 0xdf, 0xd6, 0xb6, 0xf1, 0x7c, 0x6d, 0x1b, 0xe7, 0x6b, 0xdb,
+	0xf8, 0x67, 0x6d, 0x1b, 0xff, 0xae, 0xed, 0xc6, 0xcb, 0xb5, 0x6d, 0xfc, 0x7c, 0x69, 0x37, 0xce,
+	0x2f, 0xed, 0xc6, 0x8b, 0x4b, 0xbb, 0xf1, 0x5d, 0xed, 0xef, 0x6d, 0x66, 0x4a, 0x0d, 0xdf, 0xfb,
+	0x6f, 0x00, 0x0c, 0x12, 0x88, 0xe1, 0x05, 0x07, 0x00, 0x00,
 }
 
 func (this *PrometheusRequest) Equal(that interface{}) bool {
@@ -688,6 +771,14 @@ func (this *PrometheusResponse) Equal(that interface{}) bool {
 			return false
 		}
 	}
+	if len(this.Warnings) != len(that1.Warnings) {
+		return false
+	}
+	for i := range this.Warnings {
+		if this.Warnings[i] != that1.Warnings[i] {
+			return false
+		}
+	}
 	return true
 }
 func (this *PrometheusData) Equal(that interface{}) bool {
@@ -848,6 +939,44 @@ func (this *CachingOptions) Equal(that interface{}) bool {
 	}
 	return true
 }
+func (this *CachedInstantQueryResponse) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*CachedInstantQueryResponse)
+	if !ok {
+		that2, ok := that.(CachedInstantQueryResponse)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if this.Key != that1.Key {
+		return false
+	}
+	if this.CachedAt != that1.CachedAt {
+		return false
+	}
+	if len(this.Headers) != len(that1.Headers) {
+		return false
+	}
+	for i := range this.Headers {
+		if !this.Headers[i].Equal(&that1.Headers[i]) {
+			return false
+		}
+	}
+	if !bytes.Equal(this.Body, that1.Body) {
+		return false
+	}
+	return true
+}
 func (this *PrometheusRequest) GoString() string {
 	if this == nil {
 		return "nil"
@@ -879,7 +1008,7 @@ func (this *PrometheusResponse) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 9)
+	s := make([]string, 0, 10)
 	s = append(s, "&queryrange.PrometheusResponse{")
 	s = append(s, "Status: "+fmt.Sprintf("%#v", this.Status)+",\n")
 	s = append(s, "Data: "+strings.Replace(this.Data.GoString(), `&`, ``, 1)+",\n")
@@ -888,6 +1017,7 @@ func (this *PrometheusResponse) GoString() string {
 	if this.Headers != nil {
 		s = append(s, "Headers: "+fmt.Sprintf("%#v", this.Headers)+",\n")
 	}
+	s = append(s, "Warnings: "+fmt.Sprintf("%#v", this.Warnings)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -967,6 +1097,25 @@ func (this *CachingOptions) GoString() string {
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
+func (this *CachedInstantQueryResponse) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 8)
+	s = append(s, "&queryrange.CachedInstantQueryResponse{")
+	s = append(s, "Key: "+fmt.Sprintf("%#v", this.Key)+",\n")
+	s = append(s, "CachedAt: "+fmt.Sprintf("%#v", this.CachedAt)+",\n")
+	if this.Headers != nil {
+		vs := make([]*PrometheusResponseHeader, len(this.Headers))
+		for i := range vs {
+			vs[i] = &this.Headers[i]
+		}
+		s = append(s, "Headers: "+fmt.Sprintf("%#v", vs)+",\n")
+	}
+	s = append(s, "Body: "+fmt.Sprintf("%#v", this.Body)+",\n")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
 func valueToGoStringQueryrange(v interface{}, typ string) string {
 	rv := reflect.ValueOf(v)
 	if rv.IsNil() {
@@ -1104,6 +1253,15 @@ func (m *PrometheusResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Warnings) > 0 {
+		for iNdEx := len(m.Warnings) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Warnings[iNdEx])
+			copy(dAtA[i:], m.Warnings[iNdEx])
+			i = encodeVarintQueryrange(dAtA, i, uint64(len(m.Warnings[iNdEx])))
+			i--
+			dAtA[i] = 0x32
+		}
+	}
 	if len(m.Headers) > 0 {
 		for iNdEx := len(m.Headers) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -1376,6 +1534,62 @@ func (m *CachingOptions) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *CachedInstantQueryResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *CachedInstantQueryResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *CachedInstantQueryResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Body) > 0 {
+		i -= len(m.Body)
+		copy(dAtA[i:], m.Body)
+		i = encodeVarintQueryrange(dAtA, i, uint64(len(m.Body)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.Headers) > 0 {
+		for iNdEx := len(m.Headers) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Headers[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintQueryrange(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if m.CachedAt != 0 {
+		i = encodeVarintQueryrange(dAtA, i, uint64(m.CachedAt))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Key) > 0 {
+		i -= len(m.Key)
+		copy(dAtA[i:], m.Key)
+		i = encodeVarintQueryrange(dAtA, i, uint64(len(m.Key)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
 func encodeVarintQueryrange(dAtA []byte, offset int, v uint64) int {
 	offset -= sovQueryrange(v)
 	base := offset
@@ -1462,6 +1676,12 @@ func (m *PrometheusResponse) Size() (n int) {
 			n += 1 + l + sovQueryrange(uint64(l))
 		}
 	}
+	if len(m.Warnings) > 0 {
+		for _, s := range m.Warnings {
+			l = len(s)
+			n += 1 + l + sovQueryrange(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -1559,6 +1779,32 @@ func (m *CachingOptions) Size() (n int) {
 	return n
 }
 
+func (m *CachedInstantQueryResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Key)
+	if l > 0 {
+		n += 1 + l + sovQueryrange(uint64(l))
+	}
+	if m.CachedAt != 0 {
+		n += 1 + sovQueryrange(uint64(m.CachedAt))
+	}
+	if len(m.Headers) > 0 {
+		for _, e := range m.Headers {
+			l = e.Size()
+			n += 1 + l + sovQueryrange(uint64(l))
+		}
+	}
+	l = len(m.Body)
+	if l > 0 {
+		n += 1 + l + sovQueryrange(uint64(l))
+	}
+	return n
+}
+
 func sovQueryrange(x uint64) (n int) {
 	return (math_bits.Len64(x|1) + 6) / 7
 }
@@ -1607,6 +1853,7 @@ func (this *PrometheusResponse) String() string {
 		`ErrorType:` + fmt.Sprintf("%v", this.ErrorType) + `,`,
 		`Error:` + fmt.Sprintf("%v", this.Error) + `,`,
 		`Headers:` + repeatedStringForHeaders + `,`,
+		`Warnings:` + fmt.Sprintf("%v", this.Warnings) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1682,6 +1929,24 @@ func (this *CachingOptions) String() string {
 	}, "")
 	return s
 }
+func (this *CachedInstantQueryResponse) String() string {
+	if this == nil {
+		return "nil"
+	}
+	repeatedStringForHeaders := "[]PrometheusResponseHeader{"
+	for _, f := range this.Headers {
+		repeatedStringForHeaders += strings.Replace(strings.Replace(f.String(), "PrometheusResponseHeader", "PrometheusResponseHeader", 1), `&`, ``, 1) + ","
+	}
+	repeatedStringForHeaders += "}"
+	s := strings.Join([]string{`&CachedInstantQueryResponse{`,
+		`Key:` + fmt.Sprintf("%v", this.Key) + `,`,
+		`CachedAt:` + fmt.Sprintf("%v", this.CachedAt) + `,`,
+		`Headers:` + repeatedStringForHeaders + `,`,
+		`Body:` + fmt.Sprintf("%v", this.Body) + `,`,
+		`}`,
+	}, "")
+	return s
+}
 func valueToStringQueryrange(v interface{}) string {
 	rv := reflect.ValueOf(v)
 	if rv.IsNil() {
@@ -2239,6 +2504,38 @@ func (m *PrometheusResponse) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Warnings", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQueryrange
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Warnings = append(m.Warnings, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipQueryrange(dAtA[iNdEx:])
@@ -2854,6 +3151,178 @@ func (m *CachingOptions) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *CachedInstantQueryResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowQueryrange
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: CachedInstantQueryResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: CachedInstantQueryResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQueryrange
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Key = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CachedAt", wireType)
+			}
+			m.CachedAt = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQueryrange
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.CachedAt |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Headers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQueryrange
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Headers = append(m.Headers, PrometheusResponseHeader{})
+			if err := m.Headers[len(m.Headers)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Body", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowQueryrange
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Body = append(m.Body[:0], dAtA[iNdEx:postIndex]...)
+			if m.Body == nil {
+				m.Body = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipQueryrange(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthQueryrange
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipQueryrange(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
@@ -17,6 +17,7 @@ import (
 	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/promql"
@@ -26,6 +27,8 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/chunk/cache"
 	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	querier_stats "github.com/cortexproject/cortex/pkg/querier/stats"
 	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	"github.com/cortexproject/cortex/pkg/util/spanlogger"
@@ -40,14 +43,25 @@ var (
 	ResultsCacheGenNumberHeaderName = "Results-Cache-Gen-Number"
 )
 
+// Reasons of the responses not cached by the results cache.
+const (
+	skippedResponseNoStore             = "no_store"
+	skippedResponseNotSuccess          = "not_success"
+	skippedResponseWarnings            = "warnings"
+	skippedResponseDegradedConsistency = "degraded_consistency"
+	skippedResponseAtModifier          = "at_modifier"
+	skippedResponseGenNumber           = "gen_number"
+)
+
 type CacheGenNumberLoader interface {
 	GetResultsCacheGenNumber(tenantIDs []string) string
 }
 
 // ResultsCacheConfig is the config for the results cache.
 type ResultsCacheConfig struct {
-	CacheConfig cache.Config `yaml:"cache"`
-	Compression string       `yaml:"compression"`
+	CacheConfig        cache.Config `yaml:"cache"`
+	Compression        string       `yaml:"compression"`
+	ExtentsCompression string       `yaml:"extents_compression"`
 }
 
 // RegisterFlags registers flags.
@@ -55,6 +69,7 @@ func (cfg *ResultsCacheConfig) RegisterFlags(f *flag.FlagSet) {
 	cfg.CacheConfig.RegisterFlagsWithPrefix("frontend.", "", f)
 
 	f.StringVar(&cfg.Compression, "frontend.compression", "", "Use compression in results cache. Supported values are: 'snappy' and '' (disable compression).")
+	f.StringVar(&cfg.ExtentsCompression, "frontend.results-cache.compression", ResultsCacheCompressionNone, fmt.Sprintf("Compression of the cached extents, applied to each results cache entry and marked in it, so that the entries written with another compression, or uncompressed by the previous versions, are still readable. Supported values are: %s.", strings.Join(resultsCacheCompressions, ", ")))
 	flagext.DeprecatedFlag(f, "frontend.cache-split-interval", "Deprecated: The maximum interval expected for each request, results will be cached per single interval. This behavior is now determined by querier.split-queries-by-interval.")
 }
 
@@ -66,6 +81,13 @@ func (cfg *ResultsCacheConfig) Validate() error {
 		return errors.Errorf("unsupported compression type: %s", cfg.Compression)
 	}
 
+	switch cfg.ExtentsCompression {
+	case ResultsCacheCompressionNone, ResultsCacheCompressionSnappy, ResultsCacheCompressionZstd, "":
+		// valid
+	default:
+		return errors.Errorf("unsupported results cache compression: %s", cfg.ExtentsCompression)
+	}
+
 	return cfg.CacheConfig.Validate()
 }
 
@@ -120,6 +142,28 @@ func (t constSplitter) GenerateCacheKey(userID string, r Request) string {
 	return fmt.Sprintf("%s:%s:%d:%d", userID, r.GetQuery(), r.GetStep(), currentInterval)
 }
 
+// timezoneSplitter is a CacheSplitter using a constant split interval, aligned to the midnights of the
+// split queries timezone of the tenants. The cache keys of the tenants splitting the queries in UTC are
+// the same generated by the constSplitter.
+type timezoneSplitter struct {
+	interval time.Duration
+	limits   Limits
+}
+
+// GenerateCacheKey generates a cache key based on the userID, Request, interval and timezone.
+func (t timezoneSplitter) GenerateCacheKey(userID string, r Request) string {
+	loc := time.UTC
+	if tenantIDs, err := tenant.TenantIDsFromOrgID(userID); err == nil {
+		loc = splitQueriesLocation(tenantIDs, t.limits)
+	}
+	if loc == time.UTC {
+		return constSplitter(t.interval).GenerateCacheKey(userID, r)
+	}
+
+	currentInterval := nextIntervalStart(r.GetStart(), t.interval, loc)
+	return fmt.Sprintf("%s:%s:%d:%d:%s", userID, r.GetQuery(), r.GetStep(), currentInterval, loc.String())
+}
+
 // ShouldCacheFn checks whether the current request should go to cache
 // or not. If not, just send the request to next handler.
 type ShouldCacheFn func(r Request) bool
@@ -137,6 +181,9 @@ type resultsCache struct {
 	merger               Merger
 	cacheGenNumberLoader CacheGenNumberLoader
 	shouldCache          ShouldCacheFn
+
+	compressionMetrics *resultsCacheCompressionMetrics
+	skippedResponses   *prometheus.CounterVec
 }
 
 // NewResultsCacheMiddleware creates results cache middleware from config.
@@ -168,6 +215,12 @@ func NewResultsCacheMiddleware(
 		c = cache.NewCacheGenNumMiddleware(c)
 	}
 
+	compressionMetrics := newResultsCacheCompressionMetrics(reg)
+	skippedResponses := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_results_cache_skipped_responses_total",
+		Help: "Total number of downstream responses not stored in the results cache, by reason.",
+	}, []string{"reason"})
+
 	return MiddlewareFunc(func(next Handler) Handler {
 		return &resultsCache{
 			logger:               logger,
@@ -181,6 +234,8 @@ func NewResultsCacheMiddleware(
 			splitter:             splitter,
 			cacheGenNumberLoader: cacheGenNumberLoader,
 			shouldCache:          shouldCache,
+			compressionMetrics:   compressionMetrics,
+			skippedResponses:     skippedResponses,
 		}
 	}), c, nil
 }
@@ -235,12 +290,32 @@ func (s resultsCache) shouldCacheResponse(ctx context.Context, req Request, r Re
 	for _, v := range headerValues {
 		if v == noStoreValue {
 			level.Debug(s.logger).Log("msg", fmt.Sprintf("%s header in response is equal to %s, not caching the response", cacheControlHeader, noStoreValue))
-			return false
+			return s.skipResponse(skippedResponseNoStore)
 		}
 	}
 
+	if promRes, ok := r.(*PrometheusResponse); ok {
+		// The responses computed from failed downstream requests may be incomplete.
+		if promRes.Status != "" && promRes.Status != StatusSuccess {
+			level.Debug(s.logger).Log("msg", "response is not successful, not caching the response", "status", promRes.Status)
+			return s.skipResponse(skippedResponseNotSuccess)
+		}
+
+		// The responses with warnings, like the partial results on timeout, may be incomplete.
+		if len(promRes.Warnings) > 0 {
+			level.Debug(s.logger).Log("msg", "response has warnings, not caching the response", "warnings", strings.Join(promRes.Warnings, "; "))
+			return s.skipResponse(skippedResponseWarnings)
+		}
+	}
+
+	// The responses computed without the responses of all the ingesters may miss recent samples.
+	if hasDegradedConsistency(r) {
+		level.Debug(s.logger).Log("msg", "response has been computed with degraded consistency, not caching the response")
+		return s.skipResponse(skippedResponseDegradedConsistency)
+	}
+
 	if !s.isAtModifierCachable(req, maxCacheTime) {
-		return false
+		return s.skipResponse(skippedResponseAtModifier)
 	}
 
 	if s.cacheGenNumberLoader == nil {
@@ -252,19 +327,27 @@ func (s resultsCache) shouldCacheResponse(ctx context.Context, req Request, r Re
 
 	if len(genNumbersFromResp) == 0 && genNumberFromCtx != "" {
 		level.Debug(s.logger).Log("msg", fmt.Sprintf("we found results cache gen number %s set in store but none in headers", genNumberFromCtx))
-		return false
+		return s.skipResponse(skippedResponseGenNumber)
 	}
 
 	for _, gen := range genNumbersFromResp {
 		if gen != genNumberFromCtx {
 			level.Debug(s.logger).Log("msg", fmt.Sprintf("inconsistency in results cache gen numbers %s (GEN-FROM-RESPONSE) != %s (GEN-FROM-STORE), not caching the response", gen, genNumberFromCtx))
-			return false
+			return s.skipResponse(skippedResponseGenNumber)
 		}
 	}
 
 	return true
 }
 
+// skipResponse tracks a response not cached because of the given reason. It always returns false.
+func (s resultsCache) skipResponse(reason string) bool {
+	if s.skippedResponses != nil {
+		s.skippedResponses.WithLabelValues(reason).Inc()
+	}
+	return false
+}
+
 var errAtModifierAfterEnd = errors.New("at modifier after end")
 
 // isAtModifierCachable returns true if the @ modifier result
@@ -329,7 +412,19 @@ func getHeaderValuesWithName(r Response, headerName string) (headerValues []stri
 	return
 }
 
+// hasDegradedConsistency returns whether the response has been computed with degraded consistency.
+func hasDegradedConsistency(r Response) bool {
+	return len(getHeaderValuesWithName(r, client.DegradedConsistencyHeaderName)) > 0
+}
+
+// degradedConsistencyHeader is the header passed on when merging responses computed with degraded consistency.
+func degradedConsistencyHeader() *PrometheusResponseHeader {
+	return &PrometheusResponseHeader{Name: client.DegradedConsistencyHeaderName, Values: []string{"true"}}
+}
+
 func (s resultsCache) handleMiss(ctx context.Context, r Request, maxCacheTime int64) (Response, []Extent, error) {
+	querier_stats.FrontendStatsFromContext(ctx).AddResultsCacheLookup(requestDuration(r), 0)
+
 	response, err := s.next.Do(ctx, r)
 	if err != nil {
 		return nil, nil, err
@@ -362,6 +457,14 @@ func (s resultsCache) handleHit(ctx context.Context, r Request, extents []Extent
 	if err != nil {
 		return nil, nil, err
 	}
+
+	// The part of the request not sent downstream is served from the cache.
+	missed := time.Duration(0)
+	for _, req := range requests {
+		missed += requestDuration(req)
+	}
+	querier_stats.FrontendStatsFromContext(ctx).AddResultsCacheLookup(requestDuration(r), requestDuration(r)-missed)
+
 	if len(requests) == 0 {
 		response, err := s.merger.MergeResponse(responses...)
 		// No downstream requests so no need to write back to the cache.
@@ -441,6 +544,11 @@ func (s resultsCache) handleHit(ctx context.Context, r Request, extents []Extent
 	return response, mergedExtents, err
 }
 
+// requestDuration returns the time range of the request.
+func requestDuration(r Request) time.Duration {
+	return time.Duration(r.GetEnd()-r.GetStart()) * time.Millisecond
+}
+
 type accumulator struct {
 	Response
 	Extent
@@ -568,7 +676,14 @@ func (s resultsCache) get(ctx context.Context, key string) ([]Extent, bool) {
 
 	log.LogFields(otlog.Int("bytes", len(bufs[0])))
 
-	if err := proto.Unmarshal(bufs[0], &resp); err != nil {
+	buf, err := decodeCachedResponse(bufs[0])
+	if err != nil {
+		level.Error(log).Log("msg", "error decoding cached value", "err", err)
+		log.Error(err)
+		return nil, false
+	}
+
+	if err := proto.Unmarshal(buf, &resp); err != nil {
 		level.Error(log).Log("msg", "error unmarshalling cached value", "err", err)
 		log.Error(err)
 		return nil, false
@@ -598,7 +713,17 @@ func (s resultsCache) put(ctx context.Context, key string, extents []Extent) {
 		return
 	}
 
-	s.cache.Store(ctx, []string{cache.HashKey(key)}, [][]byte{buf})
+	compression := s.cfg.ExtentsCompression
+	if compression == "" {
+		compression = ResultsCacheCompressionNone
+	}
+	encoded := encodeCachedResponse(compression, buf)
+	if s.compressionMetrics != nil {
+		s.compressionMetrics.rawBytes.WithLabelValues(compression).Add(float64(len(buf)))
+		s.compressionMetrics.compressedBytes.WithLabelValues(compression).Add(float64(len(encoded)))
+	}
+
+	s.cache.Store(ctx, []string{cache.HashKey(key)}, [][]byte{encoded})
 }
 
 func jaegerTraceID(ctx context.Context) string {
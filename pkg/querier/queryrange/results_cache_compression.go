@@ -0,0 +1,95 @@
+package queryrange
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Supported compressions of the results cache extents.
+const (
+	ResultsCacheCompressionNone   = "none"
+	ResultsCacheCompressionSnappy = "snappy"
+	ResultsCacheCompressionZstd   = "zstd"
+)
+
+var resultsCacheCompressions = []string{ResultsCacheCompressionNone, ResultsCacheCompressionSnappy, ResultsCacheCompressionZstd}
+
+// cachedResponseVersion1 is the first byte of the versioned cache entries, followed by the codec byte
+// and the encoded CachedResponse. The field number 0 is invalid in protobuf, so the byte can't be the
+// first one of the plain CachedResponse entries written by the previous versions.
+const cachedResponseVersion1 byte = 0x01
+
+// The codecs are persisted in the cache entries, so their values must never change.
+const (
+	cachedResponseCodecNone   byte = 0
+	cachedResponseCodecSnappy byte = 1
+	cachedResponseCodecZstd   byte = 2
+)
+
+// The zstd encoder and decoder are safe for the concurrent use of EncodeAll and DecodeAll. They
+// can only fail to be created with invalid options.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+var errInvalidCachedResponse = errors.New("invalid cached response")
+
+type resultsCacheCompressionMetrics struct {
+	rawBytes        *prometheus.CounterVec
+	compressedBytes *prometheus.CounterVec
+}
+
+func newResultsCacheCompressionMetrics(reg prometheus.Registerer) *resultsCacheCompressionMetrics {
+	return &resultsCacheCompressionMetrics{
+		rawBytes: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_results_cache_raw_bytes_total",
+			Help: "Total number of bytes of the cache entries stored in the results cache, before compression.",
+		}, []string{"compression"}),
+		compressedBytes: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_results_cache_compressed_bytes_total",
+			Help: "Total number of bytes of the cache entries stored in the results cache, after compression.",
+		}, []string{"compression"}),
+	}
+}
+
+// encodeCachedResponse compresses the marshalled CachedResponse with the given compression. The
+// uncompressed entries are stored as is, so that they can be read by the previous versions too.
+func encodeCachedResponse(compression string, buf []byte) []byte {
+	switch compression {
+	case ResultsCacheCompressionSnappy:
+		return append([]byte{cachedResponseVersion1, cachedResponseCodecSnappy}, snappy.Encode(nil, buf)...)
+	case ResultsCacheCompressionZstd:
+		return zstdEncoder.EncodeAll(buf, []byte{cachedResponseVersion1, cachedResponseCodecZstd})
+	default:
+		return buf
+	}
+}
+
+// decodeCachedResponse returns the marshalled CachedResponse of a cache entry, whatever the
+// compression it has been stored with.
+func decodeCachedResponse(buf []byte) ([]byte, error) {
+	if len(buf) == 0 || buf[0] != cachedResponseVersion1 {
+		// Plain entry, written uncompressed or by a previous version.
+		return buf, nil
+	}
+	if len(buf) < 2 {
+		return nil, errInvalidCachedResponse
+	}
+
+	switch codec := buf[1]; codec {
+	case cachedResponseCodecNone:
+		return buf[2:], nil
+	case cachedResponseCodecSnappy:
+		return snappy.Decode(nil, buf[2:])
+	case cachedResponseCodecZstd:
+		return zstdDecoder.DecodeAll(buf[2:], nil)
+	default:
+		return nil, fmt.Errorf("%w: unknown codec %d", errInvalidCachedResponse, codec)
+	}
+}
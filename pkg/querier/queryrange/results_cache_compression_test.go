@@ -0,0 +1,148 @@
+package queryrange
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+)
+
+func TestCachedResponseEncoding(t *testing.T) {
+	buf, err := proto.Marshal(&CachedResponse{
+		Key:     "key",
+		Extents: []Extent{mkExtent(10, 20)},
+	})
+	require.NoError(t, err)
+
+	for _, compression := range resultsCacheCompressions {
+		t.Run(compression, func(t *testing.T) {
+			encoded := encodeCachedResponse(compression, buf)
+			decoded, err := decodeCachedResponse(encoded)
+			require.NoError(t, err)
+			assert.Equal(t, buf, decoded)
+		})
+	}
+
+	t.Run("uncompressed entries are stored as is", func(t *testing.T) {
+		assert.Equal(t, buf, encodeCachedResponse(ResultsCacheCompressionNone, buf))
+	})
+
+	t.Run("versioned uncompressed entries are decoded", func(t *testing.T) {
+		decoded, err := decodeCachedResponse(append([]byte{cachedResponseVersion1, cachedResponseCodecNone}, buf...))
+		require.NoError(t, err)
+		assert.Equal(t, buf, decoded)
+	})
+
+	t.Run("empty entries are decoded", func(t *testing.T) {
+		decoded, err := decodeCachedResponse(nil)
+		require.NoError(t, err)
+		assert.Empty(t, decoded)
+	})
+
+	t.Run("invalid entries", func(t *testing.T) {
+		for _, invalid := range [][]byte{
+			{cachedResponseVersion1},
+			{cachedResponseVersion1, 0xff, 0x00},
+			{cachedResponseVersion1, cachedResponseCodecSnappy, 0xff, 0xff},
+			{cachedResponseVersion1, cachedResponseCodecZstd, 0xff, 0xff},
+		} {
+			_, err := decodeCachedResponse(invalid)
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestResultsCache_ShouldReadTheEntriesWrittenWithAnotherCompression(t *testing.T) {
+	c := cache.NewMockCache()
+	ctx := user.InjectOrgID(context.Background(), "1")
+
+	newResultsCache := func(compression string, reg prometheus.Registerer) (Handler, *int) {
+		calls := 0
+		rcm, _, err := NewResultsCacheMiddleware(
+			log.NewNopLogger(),
+			ResultsCacheConfig{CacheConfig: cache.Config{Cache: c}, ExtentsCompression: compression},
+			constSplitter(day),
+			mockLimits{},
+			PrometheusCodec,
+			PrometheusResponseExtractor{},
+			nil,
+			nil,
+			reg,
+		)
+		require.NoError(t, err)
+
+		return rcm.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+			calls++
+			return parsedResponse, nil
+		})), &calls
+	}
+
+	// Write the entry uncompressed, like the previous versions.
+	rc, calls := newResultsCache(ResultsCacheCompressionNone, nil)
+	resp, err := rc.Do(ctx, parsedRequest)
+	require.NoError(t, err)
+	require.Equal(t, 1, *calls)
+	require.Equal(t, parsedResponse, resp)
+
+	// Read the uncompressed entry, and overwrite it compressed with a new extent.
+	reg := prometheus.NewPedanticRegistry()
+	rc, calls = newResultsCache(ResultsCacheCompressionSnappy, reg)
+	resp, err = rc.Do(ctx, parsedRequest)
+	require.NoError(t, err)
+	require.Equal(t, 0, *calls)
+	require.Equal(t, parsedResponse, resp)
+
+	req := parsedRequest.WithStartEnd(parsedRequest.GetStart(), parsedRequest.GetEnd()+100)
+	_, err = rc.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 1, *calls)
+
+	_, bufs, _ := c.Fetch(ctx, []string{cache.HashKey(constSplitter(day).GenerateCacheKey("1", parsedRequest))})
+	require.Len(t, bufs, 1)
+	require.Equal(t, []byte{cachedResponseVersion1, cachedResponseCodecSnappy}, bufs[0][:2])
+
+	raw, err := snappy.Decode(nil, bufs[0][2:])
+	require.NoError(t, err)
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+		# HELP cortex_query_frontend_results_cache_compressed_bytes_total Total number of bytes of the cache entries stored in the results cache, after compression.
+		# TYPE cortex_query_frontend_results_cache_compressed_bytes_total counter
+		cortex_query_frontend_results_cache_compressed_bytes_total{compression="snappy"} %d
+		# HELP cortex_query_frontend_results_cache_raw_bytes_total Total number of bytes of the cache entries stored in the results cache, before compression.
+		# TYPE cortex_query_frontend_results_cache_raw_bytes_total counter
+		cortex_query_frontend_results_cache_raw_bytes_total{compression="snappy"} %d
+	`, len(bufs[0]), len(raw))), "cortex_query_frontend_results_cache_raw_bytes_total", "cortex_query_frontend_results_cache_compressed_bytes_total"))
+
+	// Read the snappy compressed entry, and overwrite it zstd compressed with a new extent.
+	rc, calls = newResultsCache(ResultsCacheCompressionZstd, nil)
+	resp, err = rc.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 0, *calls)
+	require.Equal(t, parsedResponse.Data.ResultType, resp.(*PrometheusResponse).Data.ResultType)
+
+	req = req.WithStartEnd(req.GetStart(), req.GetEnd()+100)
+	_, err = rc.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 1, *calls)
+
+	_, bufs, _ = c.Fetch(ctx, []string{cache.HashKey(constSplitter(day).GenerateCacheKey("1", parsedRequest))})
+	require.Len(t, bufs, 1)
+	require.Equal(t, []byte{cachedResponseVersion1, cachedResponseCodecZstd}, bufs[0][:2])
+
+	// Read the compressed entry with the compression disabled.
+	rc, calls = newResultsCache(ResultsCacheCompressionNone, nil)
+	resp, err = rc.Do(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, 0, *calls)
+	require.Equal(t, parsedResponse.Data.ResultType, resp.(*PrometheusResponse).Data.ResultType)
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/gogo/protobuf/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,6 +19,7 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/chunk/cache"
 	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 )
 
@@ -117,6 +121,34 @@ func TestShouldCache(t *testing.T) {
 		cacheGenNumberToInject string
 		expected               bool
 	}{
+		// Tests only for the partial responses.
+		{
+			name:     "successful response",
+			request:  &PrometheusRequest{Query: "metric"},
+			input:    Response(&PrometheusResponse{Status: StatusSuccess}),
+			expected: true,
+		},
+		{
+			name:     "not successful response",
+			request:  &PrometheusRequest{Query: "metric"},
+			input:    Response(&PrometheusResponse{Status: "error"}),
+			expected: false,
+		},
+		{
+			name:     "response with warnings",
+			request:  &PrometheusRequest{Query: "metric"},
+			input:    Response(&PrometheusResponse{Status: StatusSuccess, Warnings: []string{"partial results"}}),
+			expected: false,
+		},
+		{
+			name:    "response computed with degraded consistency",
+			request: &PrometheusRequest{Query: "metric"},
+			input: Response(&PrometheusResponse{
+				Status:  StatusSuccess,
+				Headers: []*PrometheusResponseHeader{{Name: client.DegradedConsistencyHeaderName, Values: []string{"true"}}},
+			}),
+			expected: false,
+		},
 		// Tests only for cacheControlHeader
 		{
 			name:    "does not contain the cacheControl header",
@@ -144,6 +176,14 @@ func TestShouldCache(t *testing.T) {
 			}),
 			expected: false,
 		},
+		{
+			name:    "response has warnings",
+			request: &PrometheusRequest{Query: "metric"},
+			input: Response(&PrometheusResponse{
+				Warnings: []string{"partial results: deadline exceeded while fetching from 1 sources"},
+			}),
+			expected: false,
+		},
 		{
 			name:    "cacheControl header contains extra values but still good",
 			request: &PrometheusRequest{Query: "metric"},
@@ -781,6 +821,64 @@ func TestResultsCache(t *testing.T) {
 	require.Equal(t, 2, calls)
 }
 
+func TestResultsCache_ShouldNotCachePartialResponses(t *testing.T) {
+	tests := map[string]struct {
+		response       *PrometheusResponse
+		expectedReason string
+	}{
+		"not successful response": {
+			response:       &PrometheusResponse{Status: "error", Data: parsedResponse.Data},
+			expectedReason: skippedResponseNotSuccess,
+		},
+		"response with warnings": {
+			response:       &PrometheusResponse{Status: StatusSuccess, Data: parsedResponse.Data, Warnings: []string{"partial results"}},
+			expectedReason: skippedResponseWarnings,
+		},
+		"response computed with degraded consistency": {
+			response: &PrometheusResponse{
+				Status:  StatusSuccess,
+				Data:    parsedResponse.Data,
+				Headers: []*PrometheusResponseHeader{{Name: client.DegradedConsistencyHeaderName, Values: []string{"true"}}},
+			},
+			expectedReason: skippedResponseDegradedConsistency,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := ResultsCacheConfig{
+				CacheConfig: cache.Config{
+					Cache: cache.NewMockCache(),
+				},
+			}
+			reg := prometheus.NewPedanticRegistry()
+			rcm, _, err := NewResultsCacheMiddleware(log.NewNopLogger(), cfg, constSplitter(day), mockLimits{}, PrometheusCodec, PrometheusResponseExtractor{}, nil, nil, reg)
+			require.NoError(t, err)
+
+			calls := 0
+			rc := rcm.Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+				calls++
+				return testData.response, nil
+			}))
+
+			// The response is not cached, so each request is sent downstream.
+			ctx := user.InjectOrgID(context.Background(), "1")
+			for i := 0; i < 2; i++ {
+				resp, err := rc.Do(ctx, parsedRequest)
+				require.NoError(t, err)
+				require.Equal(t, testData.response, resp)
+			}
+			require.Equal(t, 2, calls)
+
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+				# HELP cortex_query_frontend_results_cache_skipped_responses_total Total number of downstream responses not stored in the results cache, by reason.
+				# TYPE cortex_query_frontend_results_cache_skipped_responses_total counter
+				cortex_query_frontend_results_cache_skipped_responses_total{reason="%s"} 2
+			`, testData.expectedReason)), "cortex_query_frontend_results_cache_skipped_responses_total"))
+		})
+	}
+}
+
 func TestResultsCacheRecent(t *testing.T) {
 	var cfg ResultsCacheConfig
 	flagext.DefaultValues(&cfg)
@@ -953,6 +1051,30 @@ func TestConstSplitter_generateCacheKey(t *testing.T) {
 	}
 }
 
+func TestTimezoneSplitter_generateCacheKey(t *testing.T) {
+	limits := timezonesMockLimits{timezones: map[string]string{"user-rome": "Europe/Rome", "user-new-york": "America/New_York"}}
+	splitter := timezoneSplitter{interval: 24 * time.Hour, limits: limits}
+
+	rome, err := time.LoadLocation("Europe/Rome")
+	require.NoError(t, err)
+	ms := func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+
+	// The same request gets different keys in different timezones.
+	r := &PrometheusRequest{Start: ms(time.Date(2021, 3, 28, 1, 0, 0, 0, time.UTC)), Step: 10, Query: "foo{}"}
+	utcKey := splitter.GenerateCacheKey("user-utc", r)
+	romeKey := splitter.GenerateCacheKey("user-rome", r)
+	newYorkKey := splitter.GenerateCacheKey("user-new-york", r)
+	require.Equal(t, constSplitter(24*time.Hour).GenerateCacheKey("user-utc", r), utcKey)
+	require.Equal(t, fmt.Sprintf("user-rome:foo{}:10:%d:Europe/Rome", ms(time.Date(2021, 3, 29, 0, 0, 0, 0, rome))), romeKey)
+	require.NotEqual(t, strings.TrimPrefix(romeKey, "user-rome"), strings.TrimPrefix(newYorkKey, "user-new-york"))
+
+	// The requests within the same local day, including the DST transition, share the same key.
+	for _, start := range []time.Time{time.Date(2021, 3, 28, 0, 0, 0, 0, rome), time.Date(2021, 3, 28, 23, 59, 0, 0, rome)} {
+		require.Equal(t, romeKey, splitter.GenerateCacheKey("user-rome", &PrometheusRequest{Start: ms(start), Step: 10, Query: "foo{}"}))
+	}
+	require.NotEqual(t, romeKey, splitter.GenerateCacheKey("user-rome", &PrometheusRequest{Start: ms(time.Date(2021, 3, 29, 0, 0, 0, 0, rome)), Step: 10, Query: "foo{}"}))
+}
+
 func TestResultsCacheShouldCacheFunc(t *testing.T) {
 	testcases := []struct {
 		name         string
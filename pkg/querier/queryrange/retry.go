@@ -30,7 +30,7 @@ func NewRetryMiddlewareMetrics(registerer prometheus.Registerer) *RetryMiddlewar
 type retry struct {
 	log        log.Logger
 	next       Handler
-	maxRetries int
+	maxRetries func(ctx context.Context) int
 
 	metrics *RetryMiddlewareMetrics
 }
@@ -38,6 +38,12 @@ type retry struct {
 // NewRetryMiddleware returns a middleware that retries requests if they
 // fail with 500 or a non-HTTP error.
 func NewRetryMiddleware(log log.Logger, maxRetries int, metrics *RetryMiddlewareMetrics) Middleware {
+	return newRetryMiddleware(log, func(context.Context) int { return maxRetries }, metrics)
+}
+
+// newRetryMiddleware is like NewRetryMiddleware, but the max number of retries is resolved
+// on each request.
+func newRetryMiddleware(log log.Logger, maxRetries func(ctx context.Context) int, metrics *RetryMiddlewareMetrics) Middleware {
 	if metrics == nil {
 		metrics = NewRetryMiddlewareMetrics(nil)
 	}
@@ -56,8 +62,14 @@ func (r retry) Do(ctx context.Context, req Request) (Response, error) {
 	tries := 0
 	defer func() { r.metrics.retriesCount.Observe(float64(tries)) }()
 
+	maxRetries := r.maxRetries(ctx)
+	if maxRetries <= 0 {
+		// Run the request once, without retrying it.
+		maxRetries = 1
+	}
+
 	var lastErr error
-	for ; tries < r.maxRetries; tries++ {
+	for ; tries < maxRetries; tries++ {
 		if ctx.Err() != nil {
 			return nil, ctx.Err()
 		}
@@ -36,8 +36,11 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/chunk"
 	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	querier_stats "github.com/cortexproject/cortex/pkg/querier/stats"
 	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 const day = 24 * time.Hour
@@ -55,10 +58,18 @@ var (
 type Config struct {
 	SplitQueriesByInterval time.Duration `yaml:"split_queries_by_interval"`
 	AlignQueriesWithStep   bool          `yaml:"align_queries_with_step"`
+	StepAlignWarning       bool          `yaml:"step_align_warning"`
 	ResultsCacheConfig     `yaml:"results_cache"`
 	CacheResults           bool `yaml:"cache_results"`
 	MaxRetries             int  `yaml:"max_retries"`
 	ShardedQueries         bool `yaml:"parallelise_shardable_queries"`
+
+	DownsamplingMinStep time.Duration `yaml:"downsampling_min_step"`
+
+	DeduplicateQueries      bool `yaml:"deduplicate_queries"`
+	DeduplicationMaxWaiters int  `yaml:"deduplication_max_waiters"`
+
+	InstantQueryCache InstantQueryCacheConfig `yaml:"instant_query_cache"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
@@ -66,9 +77,14 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.MaxRetries, "querier.max-retries-per-request", 5, "Maximum number of retries for a single request; beyond this, the downstream error is returned.")
 	f.DurationVar(&cfg.SplitQueriesByInterval, "querier.split-queries-by-interval", 0, "Split queries by an interval and execute in parallel, 0 disables it. You should use an a multiple of 24 hours (same as the storage bucketing scheme), to avoid queriers downloading and processing the same chunks. This also determines how cache keys are chosen when result caching is enabled")
 	f.BoolVar(&cfg.AlignQueriesWithStep, "querier.align-querier-with-step", false, "Mutate incoming queries to align their start and end with their step.")
+	f.BoolVar(&cfg.StepAlignWarning, "querier.step-align-warning", false, "Add a warning to the responses of the queries whose start has been moved to align it with their step, telling by how many seconds.")
 	f.BoolVar(&cfg.CacheResults, "querier.cache-results", false, "Cache query results.")
 	f.BoolVar(&cfg.ShardedQueries, "querier.parallelise-shardable-queries", false, "Perform query parallelisations based on storage sharding configuration and query ASTs. This feature is supported only by the chunks storage engine.")
+	f.DurationVar(&cfg.DownsamplingMinStep, "querier.downsampling-min-step", 0, "Let the ingesters downsample the series queried by the range queries with a step of at least this value, when the query is compatible with the downsampling, returning at most one aggregated sample per step. 0 disables it. This feature is supported only by the blocks storage engine.")
+	f.BoolVar(&cfg.DeduplicateQueries, "frontend.deduplicate-queries", false, "Execute only once the identical range queries of a tenant received while one of them is in-flight. The other ones wait for the result of the in-flight query.")
+	f.IntVar(&cfg.DeduplicationMaxWaiters, "frontend.deduplication-max-waiters", 100, "Maximum number of queries waiting for the result of the same in-flight query, when the queries deduplication is enabled. The queries beyond this number are executed on their own. 0 to disable the limit.")
 	cfg.ResultsCacheConfig.RegisterFlags(f)
+	cfg.InstantQueryCache.RegisterFlags(f)
 }
 
 // Validate validates the config.
@@ -81,6 +97,9 @@ func (cfg *Config) Validate() error {
 			return errors.Wrap(err, "invalid ResultsCache config")
 		}
 	}
+	if err := cfg.InstantQueryCache.Validate(); err != nil {
+		return errors.Wrap(err, "invalid instant queries cache config")
+	}
 	return nil
 }
 
@@ -133,6 +152,7 @@ func (f RoundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
 }
 
 // NewTripperware returns a Tripperware configured with middlewares to limit, align, split, retry and cache requests.
+// The returned cache includes all the caches used by the Tripperware, which should be stopped once it's not used anymore.
 func NewTripperware(
 	cfg Config,
 	log log.Logger,
@@ -145,52 +165,106 @@ func NewTripperware(
 	registerer prometheus.Registerer,
 	cacheGenNumberLoader CacheGenNumberLoader,
 ) (Tripperware, cache.Cache, error) {
+	if cfg.ShardedQueries && minShardingLookback == 0 {
+		return nil, nil, errInvalidMinShardingLookback
+	}
+
 	// Per tenant query metrics.
 	queriesPerTenant := promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
 		Name: "cortex_query_frontend_queries_total",
 		Help: "Total queries sent per tenant.",
 	}, []string{"op", "user"})
 
+	var instantQueryCacheMetrics *instantQueryCacheMetrics
+	if cfg.InstantQueryCache.TTL > 0 {
+		instantQueryCacheMetrics = newInstantQueryCacheMetrics(registerer)
+	}
+
+	var deduplicationMetrics *DeduplicationMiddlewareMetrics
+	if cfg.DeduplicateQueries {
+		deduplicationMetrics = NewDeduplicationMiddlewareMetrics(registerer)
+	}
+
 	activeUsers := util.NewActiveUsersCleanupWithDefaultValues(func(user string) {
 		err := util.DeleteMatchingLabels(queriesPerTenant, map[string]string{"user": user})
 		if err != nil {
 			level.Warn(log).Log("msg", "failed to remove cortex_query_frontend_queries_total metric for user", "user", user)
 		}
+		if instantQueryCacheMetrics != nil {
+			instantQueryCacheMetrics.deleteUser(user)
+		}
+		if deduplicationMetrics != nil {
+			deduplicationMetrics.deleteUser(user)
+		}
 	})
 
 	// Metric used to keep track of each middleware execution duration.
 	metrics := NewInstrumentMiddlewareMetrics(registerer)
 
+	// The middlewares are always part of the chain, and they're run or skipped on each request
+	// according to the tenant's toggle. The results cache and the query sharding require
+	// resources, so they can be toggled per tenant only if they're enabled in the config.
 	queryRangeMiddleware := []Middleware{NewLimitsMiddleware(limits)}
-	if cfg.AlignQueriesWithStep {
-		queryRangeMiddleware = append(queryRangeMiddleware, InstrumentMiddleware("step_align", metrics), StepAlignMiddleware)
+	if cfg.DeduplicateQueries {
+		queryRangeMiddleware = append(queryRangeMiddleware, MergeMiddlewares(InstrumentMiddleware("deduplication", metrics), NewDeduplicationMiddleware(cfg.DeduplicationMaxWaiters, deduplicationMetrics)))
 	}
-	if cfg.SplitQueriesByInterval != 0 {
-		staticIntervalFn := func(_ Request) time.Duration { return cfg.SplitQueriesByInterval }
-		queryRangeMiddleware = append(queryRangeMiddleware, InstrumentMiddleware("split_by_interval", metrics), SplitByIntervalMiddleware(staticIntervalFn, limits, codec, registerer))
+	queryRangeMiddleware = append(queryRangeMiddleware, NewPerTenantMiddleware(
+		MergeMiddlewares(InstrumentMiddleware("step_align", metrics), NewStepAlignMiddleware(cfg.StepAlignWarning, NewStepAlignMiddlewareMetrics(registerer))),
+		limits.FrontendStepAlign,
+		cfg.AlignQueriesWithStep,
+	))
+
+	queryRangeMiddleware = append(queryRangeMiddleware, NewPerTenantMiddleware(
+		MergeMiddlewares(InstrumentMiddleware("downsampling", metrics), NewDownsamplingMiddleware(cfg.DownsamplingMinStep)),
+		limits.FrontendDownsampling,
+		cfg.DownsamplingMinStep > 0,
+	))
+
+	intervalFn := func(ctx context.Context, _ Request) time.Duration {
+		tenantIDs, err := tenant.TenantIDs(ctx)
+		if err != nil {
+			return cfg.SplitQueriesByInterval
+		}
+		if interval := validation.SmallestPositiveNonZeroDurationPerTenant(tenantIDs, limits.FrontendSplitQueriesByInterval); interval > 0 {
+			return interval
+		}
+		return cfg.SplitQueriesByInterval
 	}
+	queryRangeMiddleware = append(queryRangeMiddleware, NewPerTenantMiddleware(
+		MergeMiddlewares(InstrumentMiddleware("split_by_interval", metrics), SplitByIntervalMiddleware(intervalFn, limits, codec, registerer)),
+		limits.FrontendSplitQueries,
+		cfg.SplitQueriesByInterval != 0,
+	))
 
-	var c cache.Cache
+	var caches []cache.Cache
 	if cfg.CacheResults {
 		shouldCache := func(r Request) bool {
 			return !r.GetCachingOptions().Disabled
 		}
-		queryCacheMiddleware, cache, err := NewResultsCacheMiddleware(log, cfg.ResultsCacheConfig, constSplitter(cfg.SplitQueriesByInterval), limits, codec, cacheExtractor, cacheGenNumberLoader, shouldCache, registerer)
+		queryCacheMiddleware, cache, err := NewResultsCacheMiddleware(log, cfg.ResultsCacheConfig, timezoneSplitter{interval: cfg.SplitQueriesByInterval, limits: limits}, limits, codec, cacheExtractor, cacheGenNumberLoader, shouldCache, registerer)
 		if err != nil {
 			return nil, nil, err
 		}
-		c = cache
-		queryRangeMiddleware = append(queryRangeMiddleware, InstrumentMiddleware("results_cache", metrics), queryCacheMiddleware)
+		caches = append(caches, cache)
+		queryRangeMiddleware = append(queryRangeMiddleware, NewPerTenantMiddleware(
+			MergeMiddlewares(InstrumentMiddleware("results_cache", metrics), queryCacheMiddleware),
+			limits.FrontendResultsCache,
+			true,
+		))
 	}
 
-	if cfg.ShardedQueries {
-		if minShardingLookback == 0 {
-			return nil, nil, errInvalidMinShardingLookback
-		}
+	// The engine combining the sharded queries results is shared by the query sharding and the vertical
+	// sharding. Its metrics are registered only if the query sharding is enabled, because the engines
+	// of the other modules running in the same process register the same metrics.
+	if !cfg.ShardedQueries {
+		engineOpts.Reg = nil
+	}
+	engine := promql.NewEngine(engineOpts)
 
+	if cfg.ShardedQueries {
 		shardingware := NewQueryShardMiddleware(
 			log,
-			promql.NewEngine(engineOpts),
+			engine,
 			schema.Configs,
 			codec,
 			minShardingLookback,
@@ -200,12 +274,45 @@ func NewTripperware(
 
 		queryRangeMiddleware = append(
 			queryRangeMiddleware,
-			shardingware, // instrumentation is included in the sharding middleware
+			NewPerTenantMiddleware(shardingware, limits.FrontendQuerySharding, true), // instrumentation is included in the sharding middleware
 		)
 	}
 
-	if cfg.MaxRetries > 0 {
-		queryRangeMiddleware = append(queryRangeMiddleware, InstrumentMiddleware("retry", metrics), NewRetryMiddleware(log, cfg.MaxRetries, NewRetryMiddlewareMetrics(registerer)))
+	// The vertical sharding is enabled per tenant by its shard size.
+	queryRangeMiddleware = append(queryRangeMiddleware, MergeMiddlewares(
+		InstrumentMiddleware("vertical_sharding", metrics),
+		NewVerticalShardingMiddleware(limits, engine, registerer),
+	))
+
+	maxRetriesFn := func(ctx context.Context) int {
+		tenantIDs, err := tenant.TenantIDs(ctx)
+		if err != nil {
+			return cfg.MaxRetries
+		}
+		if maxRetries := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, limits.FrontendMaxRetries); maxRetries > 0 {
+			return maxRetries
+		}
+		return cfg.MaxRetries
+	}
+	queryRangeMiddleware = append(queryRangeMiddleware, NewPerTenantMiddleware(
+		MergeMiddlewares(InstrumentMiddleware("retry", metrics), newRetryMiddleware(log, maxRetriesFn, NewRetryMiddlewareMetrics(registerer))),
+		limits.FrontendRetries,
+		cfg.MaxRetries > 0,
+	))
+
+	var instantQueryCache cache.Cache
+	if cfg.InstantQueryCache.TTL > 0 {
+		c, err := cache.New(cfg.InstantQueryCache.CacheConfig, registerer, log)
+		if err != nil {
+			return nil, nil, err
+		}
+		instantQueryCache = c
+		caches = append(caches, c)
+	}
+
+	var c cache.Cache
+	if len(caches) > 0 {
+		c = cache.NewTiered(caches)
 	}
 
 	// Start cleanup. If cleaner stops or fail, we will simply not clean the metrics for inactive users.
@@ -214,6 +321,12 @@ func NewTripperware(
 		// Finally, if the user selected any query range middleware, stitch it in.
 		if len(queryRangeMiddleware) > 0 {
 			queryrange := NewRoundTripper(next, codec, queryRangeMiddleware...)
+
+			instantQuery := next
+			if instantQueryCache != nil {
+				instantQuery = newInstantQueryCache(next, cfg.InstantQueryCache, instantQueryCache, instantQueryCacheMetrics, log)
+			}
+
 			return RoundTripFunc(func(r *http.Request) (*http.Response, error) {
 				isQueryRange := strings.HasSuffix(r.URL.Path, "/query_range")
 				op := "query"
@@ -230,6 +343,9 @@ func NewTripperware(
 				activeUsers.UpdateUserTimestamp(userStr, time.Now())
 				queriesPerTenant.WithLabelValues(op, userStr).Inc()
 
+				if strings.HasSuffix(r.URL.Path, "/query") {
+					return instantQuery.RoundTrip(r)
+				}
 				if !isQueryRange {
 					return next.RoundTrip(r)
 				}
@@ -258,6 +374,10 @@ func NewRoundTripper(next http.RoundTripper, codec Codec, middlewares ...Middlew
 }
 
 func (q roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	// The consistency token is forwarded with the requests sent downstream.
+	if token, err := client.ParseConsistencyToken(r.Header.Get(client.ConsistencyTokenHeaderName)); err == nil {
+		r = r.WithContext(client.ContextWithConsistencyToken(r.Context(), token))
+	}
 
 	request, err := q.codec.DecodeRequest(r.Context(), r)
 	if err != nil {
@@ -287,7 +407,9 @@ func (q roundTripper) Do(ctx context.Context, r Request) (Response, error) {
 		return nil, httpgrpc.Errorf(http.StatusBadRequest, err.Error())
 	}
 
+	start := time.Now()
 	response, err := q.next.RoundTrip(request)
+	querier_stats.FrontendStatsFromContext(ctx).AddDownstreamRequest(time.Since(start))
 	if err != nil {
 		return nil, err
 	}
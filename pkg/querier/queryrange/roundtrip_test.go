@@ -1,22 +1,30 @@
 package queryrange
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/middleware"
 	"github.com/weaveworks/common/user"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/chunk/cache"
+	"github.com/cortexproject/cortex/pkg/frontend/transport"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 func TestRoundTrip(t *testing.T) {
@@ -95,6 +103,147 @@ func TestRoundTrip(t *testing.T) {
 	}
 }
 
+func TestRoundTrip_PerTenantMiddlewares(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests = map[string][]string{}
+	)
+
+	s := httptest.NewServer(
+		middleware.AuthenticateUser.Wrap(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID, err := user.ExtractOrgID(r.Context())
+				require.NoError(t, err)
+
+				mtx.Lock()
+				requests[userID] = append(requests[userID], r.URL.Query().Get("start"))
+				mtx.Unlock()
+
+				if strings.HasPrefix(userID, "failing") {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				_, err = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+				require.NoError(t, err)
+			}),
+		),
+	)
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	limits := perTenantMiddlewareLimits{
+		stepAlign: map[string]string{
+			"step-align": validation.FrontendMiddlewareEnabled,
+		},
+		splitQueries: map[string]string{
+			"no-split":           validation.FrontendMiddlewareDisabled,
+			"failing":            validation.FrontendMiddlewareDisabled,
+			"failing-no-retries": validation.FrontendMiddlewareDisabled,
+		},
+		splitQueriesByInterval: map[string]time.Duration{
+			"split-12h": 12 * time.Hour,
+		},
+		retries: map[string]string{
+			"failing-no-retries": validation.FrontendMiddlewareDisabled,
+		},
+	}
+
+	// All the tenants share the same tripperware, with the middlewares configured globally.
+	tw, _, err := NewTripperware(Config{SplitQueriesByInterval: day, MaxRetries: 3},
+		log.NewNopLogger(),
+		limits,
+		PrometheusCodec,
+		nil,
+		chunk.SchemaConfig{},
+		promql.EngineOpts{},
+		0,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+
+	rt := tw(singleHostRoundTripper{host: u.Host, next: http.DefaultTransport})
+
+	tests := map[string]struct {
+		expectedRequests int
+		expectedStart    string
+	}{
+		"default": {
+			expectedRequests: 3,
+			expectedStart:    "30",
+		},
+		"no-split": {
+			expectedRequests: 1,
+			expectedStart:    "30",
+		},
+		"split-12h": {
+			expectedRequests: 6,
+			expectedStart:    "30",
+		},
+		"step-align": {
+			expectedRequests: 3,
+			expectedStart:    "0",
+		},
+		"failing": {
+			expectedRequests: 3,
+			expectedStart:    "30",
+		},
+		"failing-no-retries": {
+			expectedRequests: 1,
+			expectedStart:    "30",
+		},
+	}
+
+	for userID := range tests {
+		req, err := http.NewRequest("GET", "/api/v1/query_range?query=up&start=30&end=259200&step=60", http.NoBody)
+		require.NoError(t, err)
+
+		ctx := user.InjectOrgID(context.Background(), userID)
+		req = req.WithContext(ctx)
+		require.NoError(t, user.InjectOrgIDIntoHTTPRequest(ctx, req))
+
+		resp, err := rt.RoundTrip(req)
+		if strings.HasPrefix(userID, "failing") {
+			require.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	for userID, testData := range tests {
+		assert.Len(t, requests[userID], testData.expectedRequests, userID)
+		assert.Contains(t, requests[userID], testData.expectedStart, userID)
+	}
+}
+
+type perTenantMiddlewareLimits struct {
+	mockLimits
+
+	stepAlign              map[string]string
+	splitQueries           map[string]string
+	splitQueriesByInterval map[string]time.Duration
+	retries                map[string]string
+}
+
+func (l perTenantMiddlewareLimits) FrontendStepAlign(userID string) string {
+	return l.stepAlign[userID]
+}
+
+func (l perTenantMiddlewareLimits) FrontendSplitQueries(userID string) string {
+	return l.splitQueries[userID]
+}
+
+func (l perTenantMiddlewareLimits) FrontendSplitQueriesByInterval(userID string) time.Duration {
+	return l.splitQueriesByInterval[userID]
+}
+
+func (l perTenantMiddlewareLimits) FrontendRetries(userID string) string {
+	return l.retries[userID]
+}
+
 type singleHostRoundTripper struct {
 	host string
 	next http.RoundTripper
@@ -122,3 +271,69 @@ func Test_ShardingConfigError(t *testing.T) {
 
 	require.EqualError(t, err, errInvalidMinShardingLookback.Error())
 }
+
+func TestRoundTrip_ShouldReportFrontendStatsToTheSlowQueryLog(t *testing.T) {
+	downstream := RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"status":"success","data":{"resultType":"matrix","result":[]}}`)),
+		}, nil
+	})
+
+	resultsCache, _, err := NewResultsCacheMiddleware(
+		log.NewNopLogger(),
+		ResultsCacheConfig{CacheConfig: cache.Config{Cache: cache.NewMockCache()}},
+		constSplitter(day),
+		mockLimits{},
+		PrometheusCodec,
+		PrometheusResponseExtractor{},
+		nil,
+		nil,
+		nil,
+	)
+	require.NoError(t, err)
+
+	dayIntervalFn := func(_ context.Context, _ Request) time.Duration { return day }
+	rt := NewRoundTripper(downstream, PrometheusCodec,
+		SplitByIntervalMiddleware(dayIntervalFn, mockLimits{}, PrometheusCodec, nil),
+		resultsCache,
+	)
+
+	logs := &bytes.Buffer{}
+	handler := transport.NewHandler(transport.HandlerConfig{LogQueriesLongerThan: time.Nanosecond, MaxBodySize: 1024}, rt, nil, log.NewLogfmtLogger(logs), nil)
+
+	query := func(end int) string {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/api/v1/query_range?query=up&start=0&end=%d&step=60", end), nil)
+		req = req.WithContext(user.InjectOrgID(context.Background(), "user-1"))
+		resp := httptest.NewRecorder()
+
+		logs.Reset()
+		handler.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		return logs.String()
+	}
+
+	// The first query caches the first day and a half.
+	query(129600)
+
+	// The second query, over three days, is split into 3 queries. The first one is served from the
+	// cache, the second one half from the cache and the last one isn't cached.
+	logged := query(259200)
+	for _, field := range []string{
+		"component=slow-query-log",
+		"org_id=user-1",
+		"param_query=up",
+		"param_start=0",
+		"param_end=259200",
+		"param_step=60",
+		"split_queries=3",
+		"sharded_queries=0",
+		"results_cache_hit_ratio=0.5",
+		"downstream_requests=2",
+		"downstream_time=",
+		"downstream_max_time=",
+	} {
+		assert.Contains(t, logged, field)
+	}
+}
@@ -2,13 +2,22 @@ package queryrange
 
 import (
 	"context"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/weaveworks/common/httpgrpc"
+
+	querier_stats "github.com/cortexproject/cortex/pkg/querier/stats"
+	"github.com/cortexproject/cortex/pkg/tenant"
 )
 
-type IntervalFn func(r Request) time.Duration
+// IntervalFn returns the interval to split the given request by. A non-positive interval
+// disables the split.
+type IntervalFn func(ctx context.Context, r Request) time.Duration
 
 // SplitByIntervalMiddleware creates a new Middleware that splits requests by a given interval.
 func SplitByIntervalMiddleware(interval IntervalFn, limits Limits, merger Merger, registerer prometheus.Registerer) Middleware {
@@ -38,10 +47,28 @@ type splitByInterval struct {
 }
 
 func (s splitByInterval) Do(ctx context.Context, r Request) (Response, error) {
+	interval := s.interval(ctx, r)
+	if interval <= 0 {
+		return s.next.Do(ctx, r)
+	}
+
+	// The start() and end() of the @ modifier refer to the range of the original
+	// request, so they must be resolved before the split.
+	query, err := evaluateAtModifierFunction(r.GetQuery(), r.GetStart(), r.GetEnd())
+	if err != nil {
+		return nil, err
+	}
+	r = r.WithQuery(query)
+
 	// First we're going to build new requests, one for each day, taking care
 	// to line up the boundaries with step.
-	reqs := splitQuery(r, s.interval(r))
+	loc := time.UTC
+	if tenantIDs, err := tenant.TenantIDs(ctx); err == nil {
+		loc = splitQueriesLocation(tenantIDs, s.limits)
+	}
+	reqs := splitQuery(r, interval, loc)
 	s.splitByCounter.Add(float64(len(reqs)))
+	querier_stats.FrontendStatsFromContext(ctx).AddSplitQueries(len(reqs))
 
 	reqResps, err := DoRequests(ctx, s.next, reqs, s.limits)
 	if err != nil {
@@ -60,10 +87,10 @@ func (s splitByInterval) Do(ctx context.Context, r Request) (Response, error) {
 	return response, nil
 }
 
-func splitQuery(r Request, interval time.Duration) []Request {
+func splitQuery(r Request, interval time.Duration, loc *time.Location) []Request {
 	var reqs []Request
-	for start := r.GetStart(); start < r.GetEnd(); start = nextIntervalBoundary(start, r.GetStep(), interval) + r.GetStep() {
-		end := nextIntervalBoundary(start, r.GetStep(), interval)
+	for start := r.GetStart(); start < r.GetEnd(); start = nextIntervalBoundary(start, r.GetStep(), interval, loc) + r.GetStep() {
+		end := nextIntervalBoundary(start, r.GetStep(), interval, loc)
 		if end+r.GetStep() >= r.GetEnd() {
 			end = r.GetEnd()
 		}
@@ -73,10 +100,47 @@ func splitQuery(r Request, interval time.Duration) []Request {
 	return reqs
 }
 
+// evaluateAtModifierFunction replaces the start() and end() of the @ modifiers of
+// the query with the given start and end timestamps. The query is returned as is
+// if it doesn't use them.
+func evaluateAtModifierFunction(query string, start, end int64) (string, error) {
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+
+	evaluated := false
+	parser.Inspect(expr, func(n parser.Node, _ []parser.Node) error {
+		switch e := n.(type) {
+		case *parser.VectorSelector:
+			e.Timestamp, e.StartOrEnd = evaluateAtModifier(e.Timestamp, e.StartOrEnd, start, end, &evaluated)
+		case *parser.SubqueryExpr:
+			e.Timestamp, e.StartOrEnd = evaluateAtModifier(e.Timestamp, e.StartOrEnd, start, end, &evaluated)
+		}
+		return nil
+	})
+
+	if !evaluated {
+		return query, nil
+	}
+	return expr.String(), nil
+}
+
+func evaluateAtModifier(ts *int64, startOrEnd parser.ItemType, start, end int64, evaluated *bool) (*int64, parser.ItemType) {
+	switch startOrEnd {
+	case parser.START:
+		*evaluated = true
+		return &start, 0
+	case parser.END:
+		*evaluated = true
+		return &end, 0
+	}
+	return ts, startOrEnd
+}
+
 // Round up to the step before the next interval boundary.
-func nextIntervalBoundary(t, step int64, interval time.Duration) int64 {
-	msPerInterval := int64(interval / time.Millisecond)
-	startOfNextInterval := ((t / msPerInterval) + 1) * msPerInterval
+func nextIntervalBoundary(t, step int64, interval time.Duration, loc *time.Location) int64 {
+	startOfNextInterval := nextIntervalStart(t, interval, loc)
 	// ensure that target is a multiple of steps away from the start time
 	target := startOfNextInterval - ((startOfNextInterval - t) % step)
 	if target == startOfNextInterval {
@@ -84,3 +148,64 @@ func nextIntervalBoundary(t, step int64, interval time.Duration) int64 {
 	}
 	return target
 }
+
+// nextIntervalStart returns the start of the interval following the one t belongs to. The intervals
+// are aligned to the midnights of the location: the intervals multiple of a day follow the calendar
+// days of the location, so that they are aligned to its midnights across the DST transitions, while
+// the shorter ones are aligned using the offset of the location at t.
+func nextIntervalStart(t int64, interval time.Duration, loc *time.Location) int64 {
+	msPerInterval := int64(interval / time.Millisecond)
+	if loc == nil || loc == time.UTC {
+		return ((t / msPerInterval) + 1) * msPerInterval
+	}
+
+	local := time.Unix(0, t*int64(time.Millisecond)).In(loc)
+
+	if days := int(interval / (24 * time.Hour)); interval%(24*time.Hour) == 0 {
+		year, month, day := local.Date()
+		daysSinceEpoch := int(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+		nextDay := (daysSinceEpoch/days + 1) * days
+		return time.Date(1970, 1, 1+nextDay, 0, 0, 0, 0, loc).UnixNano() / int64(time.Millisecond)
+	}
+
+	_, offsetSeconds := local.Zone()
+	offset := int64(offsetSeconds) * 1000
+	return ((t+offset)/msPerInterval+1)*msPerInterval - offset
+}
+
+// splitQueriesLocation returns the timezone the queries of the tenants are split in, which is UTC
+// unless all the tenants have the same timezone configured.
+func splitQueriesLocation(tenantIDs []string, limits Limits) *time.Location {
+	if len(tenantIDs) == 0 {
+		return time.UTC
+	}
+
+	timezone := limits.SplitQueriesTimezone(tenantIDs[0])
+	for _, tenantID := range tenantIDs[1:] {
+		if limits.SplitQueriesTimezone(tenantID) != timezone {
+			return time.UTC
+		}
+	}
+
+	return loadLocation(timezone)
+}
+
+// locations caches the loaded locations by name, since loading them requires reading the timezone database.
+var locations sync.Map
+
+// loadLocation returns the location with the given IANA name, or UTC if the name is empty or invalid.
+func loadLocation(name string) *time.Location {
+	if name == "" || name == "UTC" {
+		return time.UTC
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc = time.UTC
+	}
+	locations.Store(name, loc)
+	return loc
+}
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -51,7 +52,7 @@ func TestNextIntervalBoundary(t *testing.T) {
 		{toMs(time.Hour) + 15*seconds, 35 * seconds, 2*toMs(time.Hour) - 15*seconds, time.Hour},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			require.Equal(t, tc.out, nextIntervalBoundary(tc.in, tc.step, tc.interval))
+			require.Equal(t, tc.out, nextIntervalBoundary(tc.in, tc.step, tc.interval, time.UTC))
 		})
 	}
 }
@@ -236,12 +237,82 @@ func TestSplitQuery(t *testing.T) {
 		},
 	} {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			days := splitQuery(tc.input, tc.interval)
+			days := splitQuery(tc.input, tc.interval, time.UTC)
 			require.Equal(t, tc.expected, days)
 		})
 	}
 }
 
+func TestSplitQuery_Timezone(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	require.NoError(t, err)
+
+	ms := func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+	step := int64(time.Hour / time.Millisecond)
+
+	for name, tc := range map[string]struct {
+		start, end time.Time
+		expected   []time.Time // Start and end of each split request.
+	}{
+		"spring forward, the 28th of March lasts 23 hours": {
+			start: time.Date(2021, 3, 27, 12, 0, 0, 0, rome),
+			end:   time.Date(2021, 3, 29, 12, 0, 0, 0, rome),
+			expected: []time.Time{
+				time.Date(2021, 3, 27, 12, 0, 0, 0, rome), time.Date(2021, 3, 27, 23, 0, 0, 0, rome),
+				time.Date(2021, 3, 28, 0, 0, 0, 0, rome), time.Date(2021, 3, 28, 23, 0, 0, 0, rome),
+				time.Date(2021, 3, 29, 0, 0, 0, 0, rome), time.Date(2021, 3, 29, 12, 0, 0, 0, rome),
+			},
+		},
+		"fall back, the 31st of October lasts 25 hours": {
+			start: time.Date(2021, 10, 30, 12, 0, 0, 0, rome),
+			end:   time.Date(2021, 11, 1, 12, 0, 0, 0, rome),
+			expected: []time.Time{
+				time.Date(2021, 10, 30, 12, 0, 0, 0, rome), time.Date(2021, 10, 30, 23, 0, 0, 0, rome),
+				time.Date(2021, 10, 31, 0, 0, 0, 0, rome), time.Date(2021, 10, 31, 23, 0, 0, 0, rome),
+				time.Date(2021, 11, 1, 0, 0, 0, 0, rome), time.Date(2021, 11, 1, 12, 0, 0, 0, rome),
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := &PrometheusRequest{Start: ms(tc.start), End: ms(tc.end), Step: step, Query: "foo"}
+
+			var expected []Request
+			for i := 0; i < len(tc.expected); i += 2 {
+				expected = append(expected, &PrometheusRequest{Start: ms(tc.expected[i]), End: ms(tc.expected[i+1]), Step: step, Query: "foo"})
+			}
+			require.Equal(t, expected, splitQuery(req, 24*time.Hour, rome))
+		})
+	}
+
+	t.Run("intervals shorter than a day are aligned with the offset of the timezone", func(t *testing.T) {
+		kolkata, err := time.LoadLocation("Asia/Kolkata")
+		require.NoError(t, err)
+
+		start := time.Date(2021, 3, 1, 10, 15, 0, 0, kolkata)
+		require.Equal(t, ms(time.Date(2021, 3, 1, 12, 0, 0, 0, kolkata)), nextIntervalStart(ms(start), 2*time.Hour, kolkata))
+	})
+}
+
+func TestSplitQueriesLocation(t *testing.T) {
+	limits := timezonesMockLimits{timezones: map[string]string{"user-1": "Europe/Rome", "user-2": "Europe/Rome", "user-3": "America/New_York", "user-4": ""}}
+
+	require.Equal(t, "Europe/Rome", splitQueriesLocation([]string{"user-1"}, limits).String())
+	require.Equal(t, "Europe/Rome", splitQueriesLocation([]string{"user-1", "user-2"}, limits).String())
+	require.Equal(t, time.UTC, splitQueriesLocation([]string{"user-1", "user-3"}, limits))
+	require.Equal(t, time.UTC, splitQueriesLocation([]string{"user-4"}, limits))
+	require.Equal(t, time.UTC, splitQueriesLocation(nil, limits))
+}
+
+type timezonesMockLimits struct {
+	mockLimits
+
+	timezones map[string]string
+}
+
+func (m timezonesMockLimits) SplitQueriesTimezone(userID string) string {
+	return m.timezones[userID]
+}
+
 func TestSplitByDay(t *testing.T) {
 
 	mergedResponse, err := PrometheusCodec.MergeResponse(parsedResponse, parsedResponse)
@@ -275,7 +346,7 @@ func TestSplitByDay(t *testing.T) {
 			u, err := url.Parse(s.URL)
 			require.NoError(t, err)
 
-			interval := func(_ Request) time.Duration { return 24 * time.Hour }
+			interval := func(_ context.Context, _ Request) time.Duration { return 24 * time.Hour }
 			roundtripper := NewRoundTripper(singleHostRoundTripper{
 				host: u.Host,
 				next: http.DefaultTransport,
@@ -298,3 +369,51 @@ func TestSplitByDay(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitByInterval_AtModifier(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		queries []string
+	)
+	next := HandlerFunc(func(_ context.Context, r Request) (Response, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		queries = append(queries, r.GetQuery())
+		return &PrometheusResponse{Status: StatusSuccess, Data: PrometheusData{ResultType: matrix}}, nil
+	})
+
+	interval := func(_ context.Context, _ Request) time.Duration { return 24 * time.Hour }
+	handler := SplitByIntervalMiddleware(interval, mockLimits{}, PrometheusCodec, nil).Wrap(next)
+
+	req := &PrometheusRequest{Start: 0, End: 2 * 24 * 3600 * seconds, Step: 3600 * seconds, Query: `sum(rate(up[5m] @ end())) / up @ start()`}
+	_, err := handler.Do(user.InjectOrgID(context.Background(), "1"), req)
+	require.NoError(t, err)
+
+	// Each split request must be evaluated at the start() and end() of the original request.
+	require.Len(t, queries, 2)
+	for _, query := range queries {
+		require.Equal(t, `sum(rate(up[5m] @ 172800.000)) / up @ 0.000`, query)
+	}
+}
+
+func TestEvaluateAtModifierFunction(t *testing.T) {
+	for _, tc := range []struct {
+		query, expected string
+	}{
+		{query: `up`, expected: `up`},
+		{query: `up @ 100`, expected: `up @ 100`},
+		{query: `up @ start()`, expected: `up @ 10.000`},
+		{query: `up @ end() offset -1h`, expected: `up @ 20.000 offset -1h`},
+		{query: `min_over_time(rate(up[5m])[1h:] @ start())`, expected: `min_over_time(rate(up[5m])[1h:] @ 10.000)`},
+		{query: `sum(up @ end()) / count(up @ 15)`, expected: `sum(up @ 20.000) / count(up @ 15.000)`},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			actual, err := evaluateAtModifierFunction(tc.query, 10*seconds, 20*seconds)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+
+	_, err := evaluateAtModifierFunction(`invalid(`, 10*seconds, 20*seconds)
+	require.Error(t, err)
+}
@@ -2,22 +2,76 @@ package queryrange
 
 import (
 	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-// StepAlignMiddleware aligns the start and end of request to the step to
-// improved the cacheability of the query results.
-var StepAlignMiddleware = MiddlewareFunc(func(next Handler) Handler {
-	return stepAlign{
-		next: next,
+// StepAlignMiddlewareMetrics holds the metrics tracked by the step alignment middleware.
+type StepAlignMiddlewareMetrics struct {
+	startAdjustment prometheus.Histogram
+}
+
+// NewStepAlignMiddlewareMetrics makes a new StepAlignMiddlewareMetrics.
+func NewStepAlignMiddlewareMetrics(registerer prometheus.Registerer) *StepAlignMiddlewareMetrics {
+	return &StepAlignMiddlewareMetrics{
+		startAdjustment: promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+			Namespace: "cortex",
+			Name:      "frontend_step_align_start_adjustment_seconds",
+			Help:      "Time by which the start of the queries not aligned with their step has been moved back.",
+			Buckets:   []float64{1, 5, 15, 30, 60, 300, 900, 3600},
+		}),
 	}
-})
+}
+
+// NewStepAlignMiddleware makes a new middleware aligning the start and end of the requests to
+// the step to improve the cacheability of the query results. If warning is enabled, the responses
+// of the requests whose start has been moved are annotated with a warning telling by how much.
+func NewStepAlignMiddleware(warning bool, metrics *StepAlignMiddlewareMetrics) Middleware {
+	return MiddlewareFunc(func(next Handler) Handler {
+		return stepAlign{
+			next:    next,
+			warning: warning,
+			metrics: metrics,
+		}
+	})
+}
 
 type stepAlign struct {
-	next Handler
+	next    Handler
+	warning bool
+	metrics *StepAlignMiddlewareMetrics
 }
 
 func (s stepAlign) Do(ctx context.Context, r Request) (Response, error) {
+	// The start is never moved by more than one step.
 	start := (r.GetStart() / r.GetStep()) * r.GetStep()
 	end := (r.GetEnd() / r.GetStep()) * r.GetStep()
-	return s.next.Do(ctx, r.WithStartEnd(start, end))
+
+	resp, err := s.next.Do(ctx, r.WithStartEnd(start, end))
+
+	adjustment := time.Duration(r.GetStart()-start) * time.Millisecond
+	if adjustment <= 0 {
+		return resp, err
+	}
+
+	if s.metrics != nil {
+		s.metrics.startAdjustment.Observe(adjustment.Seconds())
+	}
+
+	promResp, ok := resp.(*PrometheusResponse)
+	if err != nil || !s.warning || !ok {
+		return resp, err
+	}
+
+	// The response is copied, so that the warning is never added to a response shared with others.
+	withWarning := *promResp
+	withWarning.Warnings = append(append([]string(nil), promResp.Warnings...), stepAlignWarning(adjustment))
+	return &withWarning, nil
+}
+
+func stepAlignWarning(adjustment time.Duration) string {
+	return fmt.Sprintf("the query has been aligned with its step, moving its start time back by %gs to improve the results cacheability", adjustment.Seconds())
 }
@@ -4,7 +4,10 @@ import (
 	"context"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -52,3 +55,61 @@ func TestStepAlign(t *testing.T) {
 		})
 	}
 }
+
+func TestStepAlign_ShouldAddWarning(t *testing.T) {
+	for testName, testData := range map[string]struct {
+		warning          bool
+		start            int64
+		expectedWarnings []string
+	}{
+		"should not add the warning if disabled": {
+			warning:          false,
+			start:            5500,
+			expectedWarnings: []string{"existing"},
+		},
+		"should not add the warning if the start is aligned": {
+			warning:          true,
+			start:            10000,
+			expectedWarnings: []string{"existing"},
+		},
+		"should add the warning if the start has been moved": {
+			warning:          true,
+			start:            5500,
+			expectedWarnings: []string{"existing", stepAlignWarning(5500 * time.Millisecond)},
+		},
+		"should move the start by less than a step": {
+			warning:          true,
+			start:            19999,
+			expectedWarnings: []string{"existing", stepAlignWarning(9999 * time.Millisecond)},
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			downstreamResp := &PrometheusResponse{Status: StatusSuccess, Warnings: []string{"existing"}}
+
+			var downstreamReq Request
+			mw := NewStepAlignMiddleware(testData.warning, NewStepAlignMiddlewareMetrics(reg)).Wrap(HandlerFunc(func(_ context.Context, req Request) (Response, error) {
+				downstreamReq = req
+				return downstreamResp, nil
+			}))
+
+			resp, err := mw.Do(context.Background(), &PrometheusRequest{Start: testData.start, End: 100000, Step: 10000})
+			require.NoError(t, err)
+			assert.Equal(t, testData.start/10000*10000, downstreamReq.GetStart())
+			assert.Equal(t, testData.expectedWarnings, resp.(*PrometheusResponse).Warnings)
+
+			// The downstream response is never modified.
+			assert.Equal(t, []string{"existing"}, downstreamResp.Warnings)
+
+			expectedAdjusted := uint64(0)
+			if testData.start%10000 != 0 {
+				expectedAdjusted = 1
+			}
+			metrics, err := reg.Gather()
+			require.NoError(t, err)
+			require.Len(t, metrics, 1)
+			assert.Equal(t, "cortex_frontend_step_align_start_adjustment_seconds", metrics[0].GetName())
+			assert.Equal(t, expectedAdjusted, metrics[0].GetMetric()[0].GetHistogram().GetSampleCount())
+		})
+	}
+}
@@ -0,0 +1,644 @@
+package queryrange
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/querier/astmapper"
+	querier_stats "github.com/cortexproject/cortex/pkg/querier/stats"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/spanlogger"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// verticalShardMergeOps are the aggregations which can be vertically sharded, and the aggregation
+// merging the results of their shards.
+var verticalShardMergeOps = map[parser.ItemType]parser.ItemType{
+	parser.SUM:   parser.SUM,
+	parser.COUNT: parser.SUM,
+	parser.MIN:   parser.MIN,
+	parser.MAX:   parser.MAX,
+}
+
+// verticalShardUnsupportedFunctions are the functions whose result depends on multiple series, or
+// which return a series when no series are selected, so that they would be returned by each shard.
+var verticalShardUnsupportedFunctions = map[string]bool{
+	"absent":             true,
+	"absent_over_time":   true,
+	"histogram_quantile": true,
+	"scalar":             true,
+	"vector":             true,
+}
+
+// NewVerticalShardingMiddleware makes a new Middleware which splits the shardable aggregations into
+// the per-tenant number of vertical shards, each one selecting the series by the hash of their labels,
+// executes them in parallel and merges their results. The aggregations combined by histogram_quantile()
+// or by binary expressions are sharded too, and their merged results are combined by the engine.
+func NewVerticalShardingMiddleware(limits Limits, engine *promql.Engine, registerer prometheus.Registerer) Middleware {
+	shardedQueries := promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_vertically_sharded_queries_total",
+		Help: "Total number of queries which have been vertically sharded.",
+	})
+	shards := promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_query_frontend_vertical_shards_total",
+		Help: "Total number of vertical shards the queries have been split into.",
+	})
+
+	return MiddlewareFunc(func(next Handler) Handler {
+		return verticalSharding{
+			next:           next,
+			limits:         limits,
+			engine:         engine,
+			shardedQueries: shardedQueries,
+			shards:         shards,
+		}
+	})
+}
+
+type verticalSharding struct {
+	next   Handler
+	limits Limits
+	engine *promql.Engine
+
+	shardedQueries prometheus.Counter
+	shards         prometheus.Counter
+}
+
+func (v verticalSharding) Do(ctx context.Context, r Request) (Response, error) {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return v.next.Do(ctx, r)
+	}
+
+	shardSize := validation.SmallestPositiveIntPerTenant(tenantIDs, v.limits.QueryVerticalShardSize)
+	if shardSize < 2 {
+		return v.next.Do(ctx, r)
+	}
+
+	expr, err := parser.ParseExpr(r.GetQuery())
+	if err != nil {
+		return v.next.Do(ctx, r)
+	}
+
+	// The shardable aggregations are merged right away, the other queries are combined by the engine.
+	if mergeOp, ok := verticalShardMergeOp(expr); ok {
+		resps, err := v.doShards(ctx, r, []parser.Expr{expr}, shardSize)
+		if err != nil {
+			return nil, err
+		}
+		return mergeVerticalShards(resps[0], mergeOp), nil
+	}
+
+	if v.engine == nil {
+		return v.next.Do(ctx, r)
+	}
+	combining, aggrs, ok := verticalShardCombiningQuery(expr)
+	if !ok {
+		return v.next.Do(ctx, r)
+	}
+
+	resps, err := v.doShards(ctx, r, aggrs, shardSize)
+	if err != nil {
+		return nil, err
+	}
+	return v.combine(ctx, r, combining, aggrs, resps)
+}
+
+// doShards executes the vertical shards of the aggregations in parallel, and returns the responses
+// of the shards of each aggregation.
+func (v verticalSharding) doShards(ctx context.Context, r Request, aggrs []parser.Expr, shardSize int) ([][]*PrometheusResponse, error) {
+	reqs := make([]Request, 0, len(aggrs)*shardSize)
+	for _, aggr := range aggrs {
+		for i := 0; i < shardSize; i++ {
+			sharded, err := astmapper.ShardQuery(aggr, astmapper.ShardAnnotation{Shard: i, Of: shardSize})
+			if err != nil {
+				return nil, err
+			}
+			reqs = append(reqs, r.WithQuery(sharded.String()))
+		}
+	}
+
+	querier_stats.FrontendStatsFromContext(ctx).AddShardedQueries(len(reqs))
+
+	log, ctx := spanlogger.New(ctx, "verticalSharding")
+	defer log.Span.Finish()
+	level.Debug(log).Log("msg", "vertically sharded query", "query", r.GetQuery(), "aggregations", len(aggrs), "shards", shardSize)
+
+	v.shardedQueries.Inc()
+	v.shards.Add(float64(len(reqs)))
+
+	reqResps, err := DoRequests(ctx, v.next, reqs, v.limits)
+	if err != nil {
+		return nil, err
+	}
+
+	// DoRequests returns the responses in no particular order, so they're matched back to their request
+	// by query, which is unique since the aggregations are.
+	index := make(map[string]int, len(reqs))
+	for i, req := range reqs {
+		index[req.GetQuery()] = i
+	}
+	resps := make([][]*PrometheusResponse, len(aggrs))
+	for i := range resps {
+		resps[i] = make([]*PrometheusResponse, shardSize)
+	}
+	for _, reqResp := range reqResps {
+		i := index[reqResp.Request.GetQuery()]
+		resps[i/shardSize][i%shardSize] = reqResp.Response.(*PrometheusResponse)
+	}
+	return resps, nil
+}
+
+// combine executes the combining query over the merged results of the vertical shards of its
+// embedded aggregations.
+func (v verticalSharding) combine(ctx context.Context, r Request, combining parser.Expr, aggrs []parser.Expr, resps [][]*PrometheusResponse) (Response, error) {
+	queryable := &verticalShardsQueryable{results: make(map[string][]SampleStream, len(aggrs))}
+	var all []*PrometheusResponse
+	for i, aggr := range aggrs {
+		mergeOp, _ := verticalShardMergeOp(aggr)
+		merged := mergeVerticalShards(resps[i], mergeOp)
+		queryable.results[aggr.String()] = withStalenessMarkers(merged.Data.Result, r)
+		all = append(all, resps[i]...)
+	}
+
+	qry, err := v.engine.NewRangeQuery(
+		queryable,
+		combining.String(),
+		util.TimeFromMillis(r.GetStart()),
+		util.TimeFromMillis(r.GetEnd()),
+		time.Duration(r.GetStep())*time.Millisecond,
+	)
+	if err != nil {
+		return nil, err
+	}
+	res := qry.Exec(ctx)
+	extracted, err := FromResult(res)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &PrometheusResponse{
+		Status: StatusSuccess,
+		Data: PrometheusData{
+			ResultType: string(res.Value.Type()),
+			Result:     extracted,
+		},
+	}
+	mergeVerticalShardsMetadata(response, all)
+	return response, nil
+}
+
+// verticalShardMergeOp returns the aggregation merging the results of the vertical shards of the
+// expression, and whether the expression can be vertically sharded. It can be if it's an aggregation
+// of series which don't depend on other series: each series is then aggregated within the shard
+// selecting it, so that the results of the shards can be aggregated again.
+func verticalShardMergeOp(expr parser.Expr) (parser.ItemType, bool) {
+	for {
+		paren, ok := expr.(*parser.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.Expr
+	}
+
+	agg, ok := expr.(*parser.AggregateExpr)
+	if !ok {
+		return 0, false
+	}
+	mergeOp, ok := verticalShardMergeOps[agg.Op]
+	if !ok {
+		return 0, false
+	}
+
+	// The nested aggregations and binary expressions combine the series across shards.
+	combinesSeries, err := astmapper.Predicate(agg.Expr, func(node parser.Node) (bool, error) {
+		switch n := node.(type) {
+		case *parser.AggregateExpr, *parser.BinaryExpr:
+			return true, nil
+		case *parser.Call:
+			return verticalShardUnsupportedFunctions[n.Func.Name], nil
+		}
+		return false, nil
+	})
+	if err != nil || combinesSeries {
+		return 0, false
+	}
+
+	if !hasVectorSelectors(agg.Expr) {
+		return 0, false
+	}
+
+	return mergeOp, astmapper.CanParallelize(agg.Expr)
+}
+
+func hasVectorSelectors(expr parser.Expr) bool {
+	hasSelectors, err := astmapper.Predicate(expr, func(node parser.Node) (bool, error) {
+		_, ok := node.(*parser.VectorSelector)
+		return ok, nil
+	})
+	return err == nil && hasSelectors
+}
+
+// verticalShardCombiningQuery returns the query combining the vertically shardable aggregations of
+// the expression, each one replaced by an embedded query selecting its merged results, and the
+// aggregations. The expression can be combined if all its selectors belong to shardable aggregations,
+// which are combined by histogram_quantile() or by binary expressions between two vectors matched
+// on labels kept by both sides. Each aggregation is then sharded independently, while the combining
+// functions and operators, which depend on multiple series, are evaluated over the merged results.
+func verticalShardCombiningQuery(expr parser.Expr) (parser.Expr, []parser.Expr, bool) {
+	cloned, err := astmapper.CloneNode(expr)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	c := &verticalShardCombiner{seen: map[string]bool{}}
+	combining, ok := c.embed(cloned.(parser.Expr))
+	if !ok || len(c.aggrs) == 0 {
+		return nil, nil, false
+	}
+	return combining, c.aggrs, true
+}
+
+type verticalShardCombiner struct {
+	aggrs []parser.Expr
+	seen  map[string]bool
+}
+
+func (c *verticalShardCombiner) embed(expr parser.Expr) (parser.Expr, bool) {
+	if _, ok := verticalShardMergeOp(expr); ok {
+		embedded, err := astmapper.VectorSquasher(expr)
+		if err != nil {
+			return nil, false
+		}
+		if key := expr.String(); !c.seen[key] {
+			c.seen[key] = true
+			c.aggrs = append(c.aggrs, expr)
+		}
+		return embedded, true
+	}
+
+	// The expressions not selecting any series, e.g. the quantile, are evaluated as is.
+	if !hasVectorSelectors(expr) {
+		return expr, true
+	}
+
+	switch n := expr.(type) {
+	case *parser.ParenExpr:
+		embedded, ok := c.embed(n.Expr)
+		n.Expr = embedded
+		return n, ok
+
+	case *parser.Call:
+		// The buckets must be kept by the aggregation to compute the quantiles of the merged results.
+		if n.Func.Name != "histogram_quantile" || !verticalShardKeepsLabels(n.Args[1], []string{model.BucketLabel}) {
+			return nil, false
+		}
+		for i, arg := range n.Args {
+			embedded, ok := c.embed(arg)
+			if !ok {
+				return nil, false
+			}
+			n.Args[i] = embedded
+		}
+		return n, true
+
+	case *parser.BinaryExpr:
+		if !verticalShardCompatibleMatching(n) {
+			return nil, false
+		}
+		lhs, ok := c.embed(n.LHS)
+		if !ok {
+			return nil, false
+		}
+		rhs, ok := c.embed(n.RHS)
+		if !ok {
+			return nil, false
+		}
+		n.LHS, n.RHS = lhs, rhs
+		return n, true
+	}
+
+	return nil, false
+}
+
+// verticalShardCompatibleMatching returns whether the series of both sides of the binary expression
+// are matched on labels kept by the aggregations of both sides.
+func verticalShardCompatibleMatching(expr *parser.BinaryExpr) bool {
+	if expr.LHS.Type() != parser.ValueTypeVector || expr.RHS.Type() != parser.ValueTypeVector {
+		return true
+	}
+
+	if expr.VectorMatching.On {
+		return verticalShardKeepsLabels(expr.LHS, expr.VectorMatching.MatchingLabels) &&
+			verticalShardKeepsLabels(expr.RHS, expr.VectorMatching.MatchingLabels)
+	}
+
+	// The series are matched on all their labels but the ignored ones, so both sides must be grouped
+	// by the same labels.
+	lhsGrouping, lhsWithout, lhsOk := verticalShardGrouping(expr.LHS)
+	rhsGrouping, rhsWithout, rhsOk := verticalShardGrouping(expr.RHS)
+	if !lhsOk || !rhsOk || lhsWithout || rhsWithout {
+		return false
+	}
+
+	ignored := expr.VectorMatching.MatchingLabels
+	lhsMatching := util.StringsMap(lhsGrouping)
+	rhsMatching := util.StringsMap(rhsGrouping)
+	for _, l := range ignored {
+		delete(lhsMatching, l)
+		delete(rhsMatching, l)
+	}
+	if len(lhsMatching) != len(rhsMatching) {
+		return false
+	}
+	for l := range lhsMatching {
+		if !rhsMatching[l] {
+			return false
+		}
+	}
+	return true
+}
+
+// verticalShardKeepsLabels returns whether the series of the expression keep all the given labels.
+func verticalShardKeepsLabels(expr parser.Expr, names []string) bool {
+	grouping, without, ok := verticalShardGrouping(expr)
+	if !ok {
+		return false
+	}
+
+	groupingMap := util.StringsMap(grouping)
+	for _, name := range names {
+		if groupingMap[name] == without {
+			return false
+		}
+	}
+	return true
+}
+
+// verticalShardGrouping returns the labels the series of the expression are grouped by, or not
+// grouped by if without is true. It returns false if they can't be determined.
+func verticalShardGrouping(expr parser.Expr) (grouping []string, without bool, ok bool) {
+	switch n := expr.(type) {
+	case *parser.ParenExpr:
+		return verticalShardGrouping(n.Expr)
+
+	case *parser.AggregateExpr:
+		return n.Grouping, n.Without, true
+
+	case *parser.Call:
+		if n.Func.Name != "histogram_quantile" {
+			return nil, false, false
+		}
+		grouping, without, ok := verticalShardGrouping(n.Args[1])
+		if !ok {
+			return nil, false, false
+		}
+
+		// The quantiles don't have the bucket label anymore.
+		if without {
+			return append([]string{model.BucketLabel}, grouping...), true, true
+		}
+		filtered := make([]string, 0, len(grouping))
+		for _, l := range grouping {
+			if l != model.BucketLabel {
+				filtered = append(filtered, l)
+			}
+		}
+		return filtered, false, true
+
+	case *parser.BinaryExpr:
+		// The series of an operation between a vector and a scalar keep the labels of the vector.
+		if n.LHS.Type() == parser.ValueTypeScalar {
+			return verticalShardGrouping(n.RHS)
+		}
+		if n.RHS.Type() == parser.ValueTypeScalar {
+			return verticalShardGrouping(n.LHS)
+		}
+
+		// The series of an operation between two vectors keep the labels of the "many" side, plus the
+		// included labels of the "one" side, or of the left side if one-to-one. The union of two vectors
+		// may have the labels of either side.
+		side := n.LHS
+		switch {
+		case n.Op == parser.LOR:
+			return nil, false, false
+		case n.VectorMatching.Card == parser.CardOneToMany:
+			side = n.RHS
+		}
+		grouping, without, ok := verticalShardGrouping(side)
+		if !ok || len(n.VectorMatching.Include) == 0 {
+			return grouping, without, ok
+		}
+		if !without {
+			return append(append([]string{}, grouping...), n.VectorMatching.Include...), false, true
+		}
+		included := util.StringsMap(n.VectorMatching.Include)
+		filtered := make([]string, 0, len(grouping))
+		for _, l := range grouping {
+			if !included[l] {
+				filtered = append(filtered, l)
+			}
+		}
+		return filtered, true, true
+	}
+
+	return nil, false, false
+}
+
+// verticalShardsQueryable is a queryable selecting the merged results of the vertical shards of the
+// aggregations embedded in a combining query.
+type verticalShardsQueryable struct {
+	// The merged results by aggregation.
+	results map[string][]SampleStream
+}
+
+// Querier implements storage.Queryable.
+func (q *verticalShardsQueryable) Querier(context.Context, int64, int64) (storage.Querier, error) {
+	return q, nil
+}
+
+// Select implements storage.Querier.
+func (q *verticalShardsQueryable) Select(_ bool, _ *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	for _, matcher := range matchers {
+		if matcher.Name != astmapper.QueryLabel {
+			continue
+		}
+
+		queries, err := astmapper.JSONCodec.Decode(matcher.Value)
+		if err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+		if len(queries) != 1 {
+			return storage.ErrSeriesSet(errors.Errorf("unexpected number of embedded queries: %d", len(queries)))
+		}
+		results, ok := q.results[queries[0]]
+		if !ok {
+			return storage.ErrSeriesSet(errors.Errorf("no results for the embedded query %s", queries[0]))
+		}
+		return NewSeriesSet(results)
+	}
+	return storage.ErrSeriesSet(errors.New(missingEmbeddedQueryMsg))
+}
+
+// LabelValues implements storage.Querier.
+func (q *verticalShardsQueryable) LabelValues(string, ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, errors.New("unimplemented")
+}
+
+// LabelNames implements storage.Querier.
+func (q *verticalShardsQueryable) LabelNames(...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, errors.New("unimplemented")
+}
+
+// Close implements storage.Querier.
+func (q *verticalShardsQueryable) Close() error {
+	return nil
+}
+
+// withStalenessMarkers returns the streams with a staleness marker at the first step following each
+// of their samples without a sample at the next step, so that the engine evaluating the combining
+// query doesn't fill the gaps with the previous samples within the lookback delta.
+func withStalenessMarkers(streams []SampleStream, r Request) []SampleStream {
+	marked := make([]SampleStream, 0, len(streams))
+	for _, stream := range streams {
+		samples := make([]cortexpb.Sample, 0, len(stream.Samples)+1)
+		for i, sample := range stream.Samples {
+			samples = append(samples, sample)
+
+			next := sample.TimestampMs + r.GetStep()
+			if next > r.GetEnd() || (i+1 < len(stream.Samples) && stream.Samples[i+1].TimestampMs <= next) {
+				continue
+			}
+			samples = append(samples, cortexpb.Sample{TimestampMs: next, Value: math.Float64frombits(value.StaleNaN)})
+		}
+		marked = append(marked, SampleStream{Labels: stream.Labels, Samples: samples})
+	}
+	return marked
+}
+
+// mergeVerticalShards merges the results of the vertical shards, aggregating the samples of the
+// series with the same labels with mergeOp.
+func mergeVerticalShards(resps []*PrometheusResponse, mergeOp parser.ItemType) *PrometheusResponse {
+	streams := map[string]*SampleStream{}
+	for _, resp := range resps {
+		for _, stream := range resp.Data.Result {
+			key := cortexpb.FromLabelAdaptersToLabels(stream.Labels).String()
+			existing, ok := streams[key]
+			if !ok {
+				streams[key] = &SampleStream{Labels: stream.Labels, Samples: stream.Samples}
+				continue
+			}
+			existing.Samples = mergeVerticalShardSamples(existing.Samples, stream.Samples, mergeOp)
+		}
+	}
+
+	keys := make([]string, 0, len(streams))
+	for key := range streams {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	response := &PrometheusResponse{
+		Status: StatusSuccess,
+		Data: PrometheusData{
+			ResultType: model.ValMatrix.String(),
+			Result:     make([]SampleStream, 0, len(streams)),
+		},
+	}
+	for _, key := range keys {
+		response.Data.Result = append(response.Data.Result, *streams[key])
+	}
+
+	mergeVerticalShardsMetadata(response, resps)
+	return response
+}
+
+// mergeVerticalShardsMetadata sets the warnings and headers of the response merging the results of
+// the vertical shards.
+func mergeVerticalShardsMetadata(response *PrometheusResponse, resps []*PrometheusResponse) {
+	// The warnings, like the partial results ones, may be returned by multiple shards.
+	seenWarnings := map[string]struct{}{}
+	for _, resp := range resps {
+		for _, w := range resp.Warnings {
+			if _, ok := seenWarnings[w]; !ok {
+				seenWarnings[w] = struct{}{}
+				response.Warnings = append(response.Warnings, w)
+			}
+		}
+	}
+
+	// The results cache generation numbers and the degraded consistency must be passed on, like when
+	// merging the split queries.
+	var genNumbers []string
+	degradedConsistency := false
+	for _, resp := range resps {
+		genNumbers = append(genNumbers, getHeaderValuesWithName(resp, ResultsCacheGenNumberHeaderName)...)
+		degradedConsistency = degradedConsistency || hasDegradedConsistency(resp)
+	}
+	if len(genNumbers) != 0 {
+		response.Headers = []*PrometheusResponseHeader{{
+			Name:   ResultsCacheGenNumberHeaderName,
+			Values: genNumbers,
+		}}
+	}
+	if degradedConsistency {
+		response.Headers = append(response.Headers, degradedConsistencyHeader())
+	}
+}
+
+// mergeVerticalShardSamples merges two series of samples sorted by timestamp, aggregating the samples
+// with the same timestamp with mergeOp.
+func mergeVerticalShardSamples(a, b []cortexpb.Sample, mergeOp parser.ItemType) []cortexpb.Sample {
+	merged := make([]cortexpb.Sample, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0].TimestampMs < b[0].TimestampMs:
+			merged = append(merged, a[0])
+			a = a[1:]
+		case a[0].TimestampMs > b[0].TimestampMs:
+			merged = append(merged, b[0])
+			b = b[1:]
+		default:
+			merged = append(merged, cortexpb.Sample{
+				TimestampMs: a[0].TimestampMs,
+				Value:       mergeVerticalShardValues(a[0].Value, b[0].Value, mergeOp),
+			})
+			a, b = a[1:], b[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+func mergeVerticalShardValues(a, b float64, mergeOp parser.ItemType) float64 {
+	switch mergeOp {
+	case parser.MIN:
+		// Like the min() aggregation, NaN is returned only if all the values are NaN.
+		if b < a || math.IsNaN(a) {
+			return b
+		}
+		return a
+	case parser.MAX:
+		if b > a || math.IsNaN(a) {
+			return b
+		}
+		return a
+	default:
+		return a + b
+	}
+}
@@ -0,0 +1,447 @@
+package queryrange
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+	"go.uber.org/atomic"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/querier/astmapper"
+	"github.com/cortexproject/cortex/pkg/querier/series"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+func TestVerticalShardMergeOp(t *testing.T) {
+	for query, expected := range map[string]parser.ItemType{
+		`sum(http_requests_total)`:                                      parser.SUM,
+		`sum by (pod) (rate(http_requests_total[5m]))`:                  parser.SUM,
+		`sum without (pod) (rate(http_requests_total[5m]))`:             parser.SUM,
+		`(sum(rate(http_requests_total[5m])))`:                          parser.SUM,
+		`count by (status) (http_requests_total)`:                       parser.SUM,
+		`min(memory_bytes)`:                                             parser.MIN,
+		`max by (pod) (max_over_time(memory_bytes[10m]))`:               parser.MAX,
+		`sum(label_replace(memory_bytes, "a", "$1", "pod", "(.*)"))`:    parser.SUM,
+		`sum(max_over_time(rate(http_requests_total[5m])[30m:1m]))`:     parser.SUM,
+		`avg(memory_bytes)`:                                             0,
+		`topk(1, memory_bytes)`:                                         0,
+		`rate(http_requests_total[5m])`:                                 0,
+		`sum(rate(http_requests_total[5m])) / sum(memory_bytes)`:        0,
+		`sum(rate(http_requests_total[5m]) * 2)`:                        0,
+		`sum(max by (pod) (memory_bytes))`:                              0,
+		`sum(vector(1))`:                                                0,
+		`sum(absent_over_time(memory_bytes[5m]))`:                       0,
+		`sum(clamp_max(memory_bytes, scalar(memory_bytes)))`:            0,
+		`sum(histogram_quantile(0.9, rate(latency_bucket[5m])))`:        0,
+		`sum by (le) (rate(latency_bucket[5m]))`:                        parser.SUM,
+		`max(sort_desc(memory_bytes))`:                                  parser.MAX,
+		`sum(quantile_over_time(0.9, memory_bytes[5m]))`:                0,
+		`count(count by (pod) (memory_bytes))`:                          0,
+		`sum(http_requests_total @ 1000)`:                               parser.SUM,
+		`max(timestamp(memory_bytes))`:                                  parser.MAX,
+		`sum(rate(http_requests_total[5m] offset 1h))`:                  parser.SUM,
+		`sum(-memory_bytes)`:                                            parser.SUM,
+		`sum(sum_over_time(memory_bytes[5m]))`:                          parser.SUM,
+		`sum(rate(http_requests_total{pod=~"1|2", status!="500"}[5m]))`: parser.SUM,
+	} {
+		t.Run(query, func(t *testing.T) {
+			expr, err := parser.ParseExpr(query)
+			require.NoError(t, err)
+
+			op, ok := verticalShardMergeOp(expr)
+			assert.Equal(t, expected != 0, ok)
+			if ok {
+				assert.Equal(t, expected, op)
+			}
+		})
+	}
+}
+
+func TestVerticalShardCombiningQuery(t *testing.T) {
+	parse := func(query string) parser.Expr {
+		expr, err := parser.ParseExpr(query)
+		require.NoError(t, err)
+		return expr
+	}
+	embedded := func(query string) string {
+		expr, err := astmapper.VectorSquasher(parse(query))
+		require.NoError(t, err)
+		return expr.String()
+	}
+
+	for query, expected := range map[string]struct {
+		combining    string
+		aggregations []string
+	}{
+		`histogram_quantile(0.99, sum by (le, service) (rate(latency_bucket[5m])))`: {
+			combining:    `histogram_quantile(0.99, ` + embedded(`sum by(le, service) (rate(latency_bucket[5m]))`) + `)`,
+			aggregations: []string{`sum by(le, service) (rate(latency_bucket[5m]))`},
+		},
+		`histogram_quantile(0.99, sum without (pod) (rate(latency_bucket[5m])))`: {
+			combining:    `histogram_quantile(0.99, ` + embedded(`sum without(pod) (rate(latency_bucket[5m]))`) + `)`,
+			aggregations: []string{`sum without(pod) (rate(latency_bucket[5m]))`},
+		},
+		`sum by (pod) (rate(errors_total[5m])) / on (pod) sum by (pod, status) (rate(requests_total[5m]))`: {
+			combining:    embedded(`sum by(pod) (rate(errors_total[5m]))`) + ` / on(pod) ` + embedded(`sum by(pod, status) (rate(requests_total[5m]))`),
+			aggregations: []string{`sum by(pod) (rate(errors_total[5m]))`, `sum by(pod, status) (rate(requests_total[5m]))`},
+		},
+		`sum by (pod, status) (rate(errors_total[5m])) / ignoring (status) sum by (pod) (rate(requests_total[5m]))`: {
+			combining:    embedded(`sum by(pod, status) (rate(errors_total[5m]))`) + ` / ignoring(status) ` + embedded(`sum by(pod) (rate(requests_total[5m]))`),
+			aggregations: []string{`sum by(pod, status) (rate(errors_total[5m]))`, `sum by(pod) (rate(requests_total[5m]))`},
+		},
+		`(sum(rate(errors_total[5m])) / sum(rate(requests_total[5m]))) * 100`: {
+			combining:    `(` + embedded(`sum(rate(errors_total[5m]))`) + ` / ` + embedded(`sum(rate(requests_total[5m]))`) + `) * 100`,
+			aggregations: []string{`sum(rate(errors_total[5m]))`, `sum(rate(requests_total[5m]))`},
+		},
+		`max(memory_bytes) - min(memory_bytes) > max(memory_bytes) / 2`: {
+			combining:    embedded(`max(memory_bytes)`) + ` - ` + embedded(`min(memory_bytes)`) + ` > ` + embedded(`max(memory_bytes)`) + ` / 2`,
+			aggregations: []string{`max(memory_bytes)`, `min(memory_bytes)`},
+		},
+		`histogram_quantile(0.9, sum by (le) (rate(latency_bucket[5m]))) > on () group_left histogram_quantile(0.5, sum by (le) (rate(latency_bucket[5m])))`: {
+			combining:    `histogram_quantile(0.9, ` + embedded(`sum by(le) (rate(latency_bucket[5m]))`) + `) > on() group_left() histogram_quantile(0.5, ` + embedded(`sum by(le) (rate(latency_bucket[5m]))`) + `)`,
+			aggregations: []string{`sum by(le) (rate(latency_bucket[5m]))`},
+		},
+		`sum by (pod) (memory_bytes) / 2`: {
+			combining:    embedded(`sum by(pod) (memory_bytes)`) + ` / 2`,
+			aggregations: []string{`sum by(pod) (memory_bytes)`},
+		},
+		`histogram_quantile(0.99, rate(latency_bucket[5m]))`:                                          {},
+		`histogram_quantile(0.99, sum by (service) (rate(latency_bucket[5m])))`:                       {},
+		`histogram_quantile(0.99, sum without (le) (rate(latency_bucket[5m])))`:                       {},
+		`histogram_quantile(scalar(sum(quantile)), sum by (le) (rate(latency_bucket[5m])))`:           {},
+		`sum by (pod) (rate(errors_total[5m])) / on (status) sum by (pod) (rate(requests_total[5m]))`: {},
+		`sum by (pod) (rate(errors_total[5m])) / sum by (status) (rate(requests_total[5m]))`:          {},
+		`sum without (pod) (rate(errors_total[5m])) / sum without (pod) (rate(requests_total[5m]))`:   {},
+		`sum(rate(errors_total[5m])) / on () rate(requests_total[5m])`:                                {},
+		`avg(memory_bytes) / max(memory_bytes)`:                                                       {},
+		`abs(sum(memory_bytes))`:                                                                      {},
+		`vector(1) + 1`:                                                                               {},
+	} {
+		t.Run(query, func(t *testing.T) {
+			expr := parse(query)
+			combining, aggrs, ok := verticalShardCombiningQuery(expr)
+			if expected.combining == "" {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, expected.combining, combining.String())
+
+			actual := make([]string, 0, len(aggrs))
+			for _, aggr := range aggrs {
+				actual = append(actual, aggr.String())
+			}
+			assert.Equal(t, expected.aggregations, actual)
+
+			// The query is not modified.
+			assert.Equal(t, parse(query).String(), expr.String())
+		})
+	}
+}
+
+func TestVerticalShardingMiddleware(t *testing.T) {
+	queryable := newVerticalShardingQueryable()
+	engine := promql.NewEngine(promql.EngineOpts{
+		Logger:     log.NewNopLogger(),
+		MaxSamples: 1e6,
+		Timeout:    time.Minute,
+	})
+
+	calls := atomic.NewInt32(0)
+	downstream := HandlerFunc(func(ctx context.Context, r Request) (Response, error) {
+		calls.Inc()
+
+		qry, err := engine.NewRangeQuery(queryable, r.GetQuery(), util.TimeFromMillis(r.GetStart()), util.TimeFromMillis(r.GetEnd()), time.Duration(r.GetStep())*time.Millisecond)
+		if err != nil {
+			return nil, err
+		}
+		extracted, err := FromResult(qry.Exec(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return &PrometheusResponse{
+			Status: StatusSuccess,
+			Data:   PrometheusData{ResultType: model.ValMatrix.String(), Result: extracted},
+		}, nil
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	request := func(query string) Request {
+		return &PrometheusRequest{Query: query, Start: 10 * 60 * 1000, End: 60 * 60 * 1000, Step: 60 * 1000}
+	}
+
+	t.Run("should return the same results of the unsharded shardable queries", func(t *testing.T) {
+		for _, query := range []string{
+			`sum(http_requests_total)`,
+			`sum(rate(http_requests_total[5m]))`,
+			`sum by (pod) (rate(http_requests_total[5m]))`,
+			`sum by (status) (increase(http_requests_total[10m]))`,
+			`sum without (pod) (rate(http_requests_total{status!="500"}[5m]))`,
+			`count(http_requests_total)`,
+			`count by (status) (rate(http_requests_total[5m]))`,
+			`min(memory_bytes)`,
+			`min by (status) (rate(http_requests_total[5m]))`,
+			`max(max_over_time(memory_bytes[10m]))`,
+			`max by (status) (memory_bytes)`,
+			`sum(max_over_time(rate(http_requests_total[5m])[15m:1m]))`,
+		} {
+			t.Run(query, func(t *testing.T) {
+				for _, shards := range []int{2, 3, 16} {
+					calls.Store(0)
+					handler := NewVerticalShardingMiddleware(mockLimits{queryVerticalShardSize: shards}, engine, nil).Wrap(downstream)
+
+					expected, err := downstream.Do(ctx, request(query))
+					require.NoError(t, err)
+					require.NotEmpty(t, expected.(*PrometheusResponse).Data.Result)
+
+					calls.Store(0)
+					actual, err := handler.Do(ctx, request(query))
+					require.NoError(t, err)
+					assert.Equal(t, int32(shards), calls.Load())
+
+					assertEqualSampleStreams(t, expected.(*PrometheusResponse).Data.Result, actual.(*PrometheusResponse).Data.Result)
+				}
+			})
+		}
+	})
+
+	t.Run("should return the same results of the unsharded combined queries", func(t *testing.T) {
+		for query, aggregations := range map[string]int{
+			`histogram_quantile(0.99, sum by (le, service) (rate(http_request_duration_seconds_bucket[5m])))`:                                  1,
+			`histogram_quantile(0.5, sum by (le) (increase(http_request_duration_seconds_bucket[10m])))`:                                       1,
+			`histogram_quantile(0.9, sum without (pod) (rate(http_request_duration_seconds_bucket[5m])))`:                                      1,
+			`sum by (pod) (rate(http_requests_total{status="500"}[5m])) / on (pod) sum by (pod) (rate(http_requests_total[5m]))`:               2,
+			`sum by (pod, status) (rate(http_requests_total[5m])) / ignoring (status) group_left sum by (pod) (rate(http_requests_total[5m]))`: 2,
+			`sum(rate(http_requests_total[5m])) / sum(memory_bytes)`:                                                                           2,
+			`(max by (status) (memory_bytes) - min by (status) (memory_bytes)) * 2`:                                                            2,
+			`sum by (status) (rate(http_requests_total[5m])) < on (status) count by (status) (memory_bytes)`:                                   2,
+			`sum(up) * 2`: 1,
+		} {
+			t.Run(query, func(t *testing.T) {
+				for _, shards := range []int{2, 3, 16} {
+					handler := NewVerticalShardingMiddleware(mockLimits{queryVerticalShardSize: shards}, engine, nil).Wrap(downstream)
+
+					expected, err := downstream.Do(ctx, request(query))
+					require.NoError(t, err)
+					require.NotEmpty(t, expected.(*PrometheusResponse).Data.Result)
+
+					calls.Store(0)
+					actual, err := handler.Do(ctx, request(query))
+					require.NoError(t, err)
+					assert.Equal(t, int32(shards*aggregations), calls.Load())
+
+					assertEqualSampleStreams(t, expected.(*PrometheusResponse).Data.Result, actual.(*PrometheusResponse).Data.Result)
+				}
+			})
+		}
+	})
+
+	t.Run("should pass through the non-shardable queries untouched", func(t *testing.T) {
+		for _, query := range []string{
+			`rate(http_requests_total[5m])`,
+			`avg(memory_bytes)`,
+			`sum(max by (pod) (memory_bytes))`,
+			`topk(2, memory_bytes)`,
+			`sum(vector(1))`,
+			`histogram_quantile(0.99, rate(http_request_duration_seconds_bucket[5m]))`,
+			`histogram_quantile(0.99, sum by (service) (rate(http_request_duration_seconds_bucket[5m])))`,
+			`sum by (pod) (rate(http_requests_total[5m])) / on (status) sum by (pod) (rate(http_requests_total[5m]))`,
+			`sum(rate(http_requests_total[5m])) / on () memory_bytes`,
+		} {
+			t.Run(query, func(t *testing.T) {
+				var received []string
+				next := HandlerFunc(func(ctx context.Context, r Request) (Response, error) {
+					received = append(received, r.GetQuery())
+					return NewEmptyPrometheusResponse(), nil
+				})
+				handler := NewVerticalShardingMiddleware(mockLimits{queryVerticalShardSize: 4}, engine, nil).Wrap(next)
+
+				_, err := handler.Do(ctx, request(query))
+				require.NoError(t, err)
+				assert.Equal(t, []string{query}, received)
+			})
+		}
+	})
+
+	t.Run("should pass through the queries if the vertical sharding is disabled", func(t *testing.T) {
+		for _, shards := range []int{0, 1} {
+			var received []string
+			next := HandlerFunc(func(ctx context.Context, r Request) (Response, error) {
+				received = append(received, r.GetQuery())
+				return NewEmptyPrometheusResponse(), nil
+			})
+			handler := NewVerticalShardingMiddleware(mockLimits{queryVerticalShardSize: shards}, engine, nil).Wrap(next)
+
+			_, err := handler.Do(ctx, request(`sum(http_requests_total)`))
+			require.NoError(t, err)
+			assert.Equal(t, []string{`sum(http_requests_total)`}, received)
+		}
+	})
+}
+
+func TestMergeVerticalShardValues(t *testing.T) {
+	assert.Equal(t, 3.0, mergeVerticalShardValues(1, 2, parser.SUM))
+	assert.Equal(t, 1.0, mergeVerticalShardValues(1, 2, parser.MIN))
+	assert.Equal(t, 1.0, mergeVerticalShardValues(math.NaN(), 1, parser.MIN))
+	assert.Equal(t, 1.0, mergeVerticalShardValues(1, math.NaN(), parser.MIN))
+	assert.Equal(t, 2.0, mergeVerticalShardValues(1, 2, parser.MAX))
+	assert.Equal(t, 1.0, mergeVerticalShardValues(math.NaN(), 1, parser.MAX))
+	assert.True(t, math.IsNaN(mergeVerticalShardValues(math.NaN(), math.NaN(), parser.MAX)))
+}
+
+func TestWithStalenessMarkers(t *testing.T) {
+	req := &PrometheusRequest{Start: 0, End: 60 * 1000, Step: 10 * 1000}
+	streams := []SampleStream{{
+		Labels: []cortexpb.LabelAdapter{{Name: "pod", Value: "1"}},
+		Samples: []cortexpb.Sample{
+			{TimestampMs: 0, Value: 1},
+			{TimestampMs: 10 * 1000, Value: 2},
+			{TimestampMs: 40 * 1000, Value: 3},
+		},
+	}, {
+		Labels: []cortexpb.LabelAdapter{{Name: "pod", Value: "2"}},
+		Samples: []cortexpb.Sample{
+			{TimestampMs: 50 * 1000, Value: 1},
+			{TimestampMs: 60 * 1000, Value: 2},
+		},
+	}}
+
+	marked := withStalenessMarkers(streams, req)
+	require.Len(t, marked, 2)
+
+	// The markers are added at the first step of each gap, up to the end of the query.
+	assert.Equal(t, streams[0].Labels, marked[0].Labels)
+	require.Len(t, marked[0].Samples, 5)
+	assert.Equal(t, []int64{0, 10 * 1000, 20 * 1000, 40 * 1000, 50 * 1000}, sampleTimestamps(marked[0].Samples))
+	assert.True(t, value.IsStaleNaN(marked[0].Samples[2].Value))
+	assert.True(t, value.IsStaleNaN(marked[0].Samples[4].Value))
+	assert.Equal(t, streams[1], marked[1])
+}
+
+func sampleTimestamps(samples []cortexpb.Sample) []int64 {
+	timestamps := make([]int64, 0, len(samples))
+	for _, s := range samples {
+		timestamps = append(timestamps, s.TimestampMs)
+	}
+	return timestamps
+}
+
+func assertEqualSampleStreams(t *testing.T, expected, actual []SampleStream) {
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		assert.Equal(t, expected[i].Labels, actual[i].Labels)
+		require.Len(t, actual[i].Samples, len(expected[i].Samples))
+		for j := range expected[i].Samples {
+			assert.Equal(t, expected[i].Samples[j].TimestampMs, actual[i].Samples[j].TimestampMs)
+			assert.InDelta(t, expected[i].Samples[j].Value, actual[i].Samples[j].Value, 1e-9)
+		}
+	}
+}
+
+// verticalShardingQueryable is an in-memory queryable selecting the series of the vertical shard, if any,
+// like the querier.
+type verticalShardingQueryable struct {
+	series []storage.Series
+}
+
+func newVerticalShardingQueryable() *verticalShardingQueryable {
+	q := &verticalShardingQueryable{}
+	for pod := 0; pod < 10; pod++ {
+		// The counters of some pods are reset, like when they're restarted.
+		resetAt := 240
+		if pod%3 == 0 {
+			resetAt = 100 + pod*5
+		}
+
+		for _, status := range []string{"200", "404", "500"} {
+			counter := make([]model.SamplePair, 0, 240)
+			gauge := make([]model.SamplePair, 0, 240)
+			for i := 0; i < 240; i++ {
+				ts := model.Time(i * 15 * 1000)
+				counter = append(counter, model.SamplePair{Timestamp: ts, Value: model.SampleValue((i % resetAt) * (pod + 1))})
+				gauge = append(gauge, model.SamplePair{Timestamp: ts, Value: model.SampleValue((i*7 + pod*13) % 100)})
+			}
+
+			q.series = append(q.series,
+				series.NewConcreteSeries(labels.FromStrings(labels.MetricName, "http_requests_total", "pod", fmt.Sprint(pod), "status", status), counter),
+				series.NewConcreteSeries(labels.FromStrings(labels.MetricName, "memory_bytes", "pod", fmt.Sprint(pod), "status", status), gauge),
+			)
+		}
+
+		// The cumulative buckets of a histogram, whose observations depend on the pod and service.
+		service := fmt.Sprint("service-", pod%2)
+		for b, le := range []string{"0.1", "0.5", "1", "+Inf"} {
+			bucket := make([]model.SamplePair, 0, 240)
+			for i := 0; i < 240; i++ {
+				ts := model.Time(i * 15 * 1000)
+				bucket = append(bucket, model.SamplePair{Timestamp: ts, Value: model.SampleValue((i % resetAt) * (b + 1) * (pod%4 + 1))})
+			}
+			q.series = append(q.series, series.NewConcreteSeries(labels.FromStrings(labels.MetricName, "http_request_duration_seconds_bucket", "pod", fmt.Sprint(pod), "service", service, "le", le), bucket))
+		}
+
+		// The samples of all the pods are missing for longer than the lookback delta.
+		up := make([]model.SamplePair, 0, 240)
+		for i := 0; i < 240; i++ {
+			if i < 120 || i >= 180 {
+				up = append(up, model.SamplePair{Timestamp: model.Time(i * 15 * 1000), Value: 1})
+			}
+		}
+		q.series = append(q.series, series.NewConcreteSeries(labels.FromStrings(labels.MetricName, "up", "pod", fmt.Sprint(pod)), up))
+	}
+	return q
+}
+
+func (q *verticalShardingQueryable) Querier(context.Context, int64, int64) (storage.Querier, error) {
+	return q, nil
+}
+
+func (q *verticalShardingQueryable) Select(_ bool, _ *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	shard, matchers, err := astmapper.QueryShardFromMatchers(matchers)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	var selected []storage.Series
+	for _, s := range q.series {
+		matches := true
+		for _, m := range matchers {
+			if !m.Matches(s.Labels().Get(m.Name)) {
+				matches = false
+			}
+		}
+		if matches {
+			selected = append(selected, s)
+		}
+	}
+
+	set := series.NewConcreteSeriesSet(selected)
+	if shard != nil {
+		set = series.NewShardedSeriesSet(set, shard.Shard, shard.Of)
+	}
+	return set
+}
+
+func (q *verticalShardingQueryable) LabelValues(string, ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, nil
+}
+
+func (q *verticalShardingQueryable) LabelNames(...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, nil
+}
+
+func (q *verticalShardingQueryable) Close() error {
+	return nil
+}
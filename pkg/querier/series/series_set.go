@@ -383,3 +383,46 @@ func (s seriesSetWithWarnings) Err() error {
 func (s seriesSetWithWarnings) Warnings() storage.Warnings {
 	return append(s.wrapped.Warnings(), s.warnings...)
 }
+
+// ShardedSeriesSet is a storage.SeriesSet returning only the series of a shard,
+// selected by the hash of their labels.
+type ShardedSeriesSet struct {
+	seriesSet storage.SeriesSet
+	shard     uint64
+	of        uint64
+}
+
+// NewShardedSeriesSet returns the series of the set whose labels hash modulo the
+// number of shards is the given shard.
+func NewShardedSeriesSet(seriesSet storage.SeriesSet, shard, of int) storage.SeriesSet {
+	return &ShardedSeriesSet{
+		seriesSet: seriesSet,
+		shard:     uint64(shard),
+		of:        uint64(of),
+	}
+}
+
+// Next implements storage.SeriesSet.
+func (s *ShardedSeriesSet) Next() bool {
+	for s.seriesSet.Next() {
+		if s.seriesSet.At().Labels().Hash()%s.of == s.shard {
+			return true
+		}
+	}
+	return false
+}
+
+// At implements storage.SeriesSet.
+func (s *ShardedSeriesSet) At() storage.Series {
+	return s.seriesSet.At()
+}
+
+// Err implements storage.SeriesSet.
+func (s *ShardedSeriesSet) Err() error {
+	return s.seriesSet.Err()
+}
+
+// Warnings implements storage.SeriesSet.
+func (s *ShardedSeriesSet) Warnings() storage.Warnings {
+	return s.seriesSet.Warnings()
+}
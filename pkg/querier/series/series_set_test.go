@@ -2,6 +2,7 @@ package series
 
 import (
 	"math/rand"
+	"strconv"
 	"testing"
 
 	"github.com/prometheus/common/model"
@@ -150,3 +151,29 @@ func TestDeletedIterator_WithSeek(t *testing.T) {
 func inbound(t model.Time, interval model.Interval) bool {
 	return interval.Start <= t && t <= interval.End
 }
+
+func TestShardedSeriesSet(t *testing.T) {
+	var all []storage.Series
+	for i := 0; i < 100; i++ {
+		all = append(all, NewConcreteSeries(labels.FromStrings("series", strconv.Itoa(i)), nil))
+	}
+
+	// Each series is returned by exactly one shard.
+	seen := map[string]int{}
+	for shard := 0; shard < 3; shard++ {
+		set := NewShardedSeriesSet(NewConcreteSeriesSet(all), shard, 3)
+		count := 0
+		for set.Next() {
+			require.Equal(t, uint64(shard), set.At().Labels().Hash()%3)
+			seen[set.At().Labels().String()]++
+			count++
+		}
+		require.NoError(t, set.Err())
+		require.NotZero(t, count)
+	}
+
+	require.Len(t, seen, len(all))
+	for _, count := range seen {
+		require.Equal(t, 1, count)
+	}
+}
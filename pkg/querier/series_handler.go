@@ -0,0 +1,166 @@
+package querier
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/apierror"
+)
+
+// The default time range of the series API, like in Prometheus.
+var (
+	seriesMinTime = time.Unix(math.MinInt64/1000+62135596801, 0).UTC()
+	seriesMaxTime = time.Unix(math.MaxInt64/1000-62135596801, 999999999).UTC()
+)
+
+type seriesWithTimeRangeResult struct {
+	Status     string            `json:"status"`
+	Data       []labels.Labels   `json:"data"`
+	TimeRanges []seriesTimeRange `json:"timeRanges"`
+	Warnings   []string          `json:"warnings,omitempty"`
+}
+
+// seriesTimeRange is the time range of the in-memory samples of a series, which is empty if
+// the series has no in-memory samples.
+type seriesTimeRange struct {
+	MinTime *model.Time `json:"minTime,omitempty"`
+	MaxTime *model.Time `json:"maxTime,omitempty"`
+}
+
+// SeriesHandler serves the series API with the next handler, unless the Cortex-specific
+// include_time_range parameter is set. In that case, the series are read from the queryable
+// like Prometheus does, and the response also includes the time range of the in-memory samples
+// of each series in the ingesters, in the timeRanges field with the same order of the series.
+func SeriesHandler(queryable storage.Queryable, d Distributor, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete || r.FormValue("include_time_range") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		include, err := strconv.ParseBool(r.FormValue("include_time_range"))
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "invalid parameter include_time_range").Error(), http.StatusBadRequest)
+			return
+		}
+		if !include {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start, end, matchersSet, err := parseSeriesRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		q, err := queryable.Querier(r.Context(), start, end)
+		if err != nil {
+			writeSeriesError(w, err)
+			return
+		}
+		defer q.Close()
+
+		hints := &storage.SelectHints{
+			Start: start,
+			End:   end,
+			Func:  "series", // There is no series function, this token is used for lookups that don't need samples.
+		}
+
+		sets := make([]storage.SeriesSet, 0, len(matchersSet))
+		for _, matchers := range matchersSet {
+			sets = append(sets, q.Select(true, hints, matchers...))
+		}
+
+		result := seriesWithTimeRangeResult{
+			Status:     statusSuccess,
+			Data:       []labels.Labels{},
+			TimeRanges: []seriesTimeRange{},
+		}
+
+		set := storage.NewMergeSeriesSet(sets, storage.ChainedSeriesMerge)
+		for set.Next() {
+			result.Data = append(result.Data, set.At().Labels())
+		}
+		if err := set.Err(); err != nil {
+			writeSeriesError(w, err)
+			return
+		}
+		for _, warning := range set.Warnings() {
+			result.Warnings = append(result.Warnings, warning.Error())
+		}
+
+		resp, err := d.MetricsForLabelMatchersWithTimeRange(r.Context(), model.Time(start), model.Time(end), matchersSet...)
+		if err != nil {
+			writeSeriesError(w, err)
+			return
+		}
+
+		timeRanges := make(map[string]client.SeriesTimeRange, len(resp.Metric))
+		for i, m := range resp.Metric {
+			timeRanges[cortexpb.FromLabelAdaptersToLabels(m.Labels).String()] = resp.TimeRanges[i]
+		}
+
+		for _, lbls := range result.Data {
+			var item seriesTimeRange
+			if timeRange, ok := timeRanges[lbls.String()]; ok && timeRange != (client.SeriesTimeRange{}) {
+				minTime, maxTime := model.Time(timeRange.MinTimeMs), model.Time(timeRange.MaxTimeMs)
+				item = seriesTimeRange{MinTime: &minTime, MaxTime: &maxTime}
+			}
+			result.TimeRanges = append(result.TimeRanges, item)
+		}
+
+		util.WriteJSONResponse(w, result)
+	})
+}
+
+func parseSeriesRequest(r *http.Request) (int64, int64, [][]*labels.Matcher, error) {
+	if err := r.ParseForm(); err != nil {
+		return 0, 0, nil, err
+	}
+	if len(r.Form["match[]"]) == 0 {
+		return 0, 0, nil, errors.New("no match[] parameter provided")
+	}
+
+	start, end := util.TimeToMillis(seriesMinTime), util.TimeToMillis(seriesMaxTime)
+	if v := r.FormValue("start"); v != "" {
+		t, err := util.ParseTime(v)
+		if err != nil {
+			return 0, 0, nil, errors.Wrap(err, "invalid parameter start")
+		}
+		start = t
+	}
+	if v := r.FormValue("end"); v != "" {
+		t, err := util.ParseTime(v)
+		if err != nil {
+			return 0, 0, nil, errors.Wrap(err, "invalid parameter end")
+		}
+		end = t
+	}
+
+	matchersSet := make([][]*labels.Matcher, 0, len(r.Form["match[]"]))
+	for _, selector := range r.Form["match[]"] {
+		matchers, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			return 0, 0, nil, errors.Wrap(err, "invalid parameter match[]")
+		}
+		matchersSet = append(matchersSet, matchers)
+	}
+
+	return start, end, matchersSet, nil
+}
+
+func writeSeriesError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), apierror.FromError(err).StatusCode())
+}
@@ -0,0 +1,123 @@
+package querier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/prom1/storage/metric"
+)
+
+func TestSeriesHandler(t *testing.T) {
+	series := []metric.Metric{
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "a"}},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "b"}},
+		{Metric: model.Metric{model.MetricNameLabel: "up", "instance": "c"}},
+	}
+
+	// The ingesters hold the in-memory samples of the first two series only, the second one having
+	// no in-memory samples left.
+	timeRanges := &client.MetricsForLabelMatchersResponse{
+		Metric: []*cortexpb.Metric{
+			{Labels: cortexpb.FromLabelsToLabelAdapters(labels.FromStrings(model.MetricNameLabel, "up", "instance", "a"))},
+			{Labels: cortexpb.FromLabelsToLabelAdapters(labels.FromStrings(model.MetricNameLabel, "up", "instance", "b"))},
+		},
+		TimeRanges: []client.SeriesTimeRange{
+			{MinTimeMs: 1000, MaxTimeMs: 3500},
+			{},
+		},
+	}
+
+	tests := map[string]struct {
+		method         string
+		params         url.Values
+		expectedStatus int
+		expectedBody   string
+	}{
+		"should include the time range of the series if requested": {
+			method:         http.MethodPost,
+			params:         url.Values{"match[]": []string{`{__name__="up"}`}, "include_time_range": []string{"true"}},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{
+				"status": "success",
+				"data": [
+					{"__name__": "up", "instance": "a"},
+					{"__name__": "up", "instance": "b"},
+					{"__name__": "up", "instance": "c"}
+				],
+				"timeRanges": [
+					{"minTime": 1, "maxTime": 3.5},
+					{},
+					{}
+				]
+			}`,
+		},
+		"should serve the request with the next handler if the time range is not requested": {
+			method:         http.MethodGet,
+			params:         url.Values{"match[]": []string{`{__name__="up"}`}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"next"`,
+		},
+		"should serve the request with the next handler if the time range is disabled": {
+			method:         http.MethodGet,
+			params:         url.Values{"match[]": []string{`{__name__="up"}`}, "include_time_range": []string{"false"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"next"`,
+		},
+		"should serve the series deletion with the next handler": {
+			method:         http.MethodDelete,
+			params:         url.Values{"match[]": []string{`{__name__="up"}`}, "include_time_range": []string{"true"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"next"`,
+		},
+		"should fail on an invalid include_time_range parameter": {
+			method:         http.MethodGet,
+			params:         url.Values{"match[]": []string{`{__name__="up"}`}, "include_time_range": []string{"yes please"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"should fail without the match[] parameter": {
+			method:         http.MethodGet,
+			params:         url.Values{"include_time_range": []string{"true"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"should fail on an invalid match[] parameter": {
+			method:         http.MethodGet,
+			params:         url.Values{"match[]": []string{`{__name__=}`}, "include_time_range": []string{"true"}},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			d := &mockDistributor{}
+			d.On("MetricsForLabelMatchers", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(series, nil)
+			d.On("MetricsForLabelMatchersWithTimeRange", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(timeRanges, nil)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`"next"`))
+			})
+
+			req := httptest.NewRequest(testData.method, "/api/v1/series?"+testData.params.Encode(), strings.NewReader(""))
+			req = req.WithContext(user.InjectOrgID(req.Context(), "user-1"))
+			rec := httptest.NewRecorder()
+
+			SeriesHandler(newDistributorQueryable(d, false, false, nil, 0), d, next).ServeHTTP(rec, req)
+			require.Equal(t, testData.expectedStatus, rec.Code, rec.Body.String())
+
+			if testData.expectedBody != "" {
+				assert.JSONEq(t, testData.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
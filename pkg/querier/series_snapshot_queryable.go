@@ -0,0 +1,176 @@
+package querier
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/querier/series"
+	"github.com/cortexproject/cortex/pkg/storage/bucket"
+	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/spanlogger"
+)
+
+// InstanceDepartures tells when an ingester left the ring the last time.
+type InstanceDepartures interface {
+	LastInstanceDeparture() time.Time
+}
+
+// SeriesSnapshotQueryable returns the last samples of the series of the ingesters which left the
+// ring, from the snapshots they wrote to the storage while flushing their blocks on shutdown. Once
+// an ingester left the ring, its recent samples aren't queryable from the ingesters anymore, and
+// they may not be queryable from the storage yet, breaking the range queries like rate(). The
+// snapshots are only queried for the TTL after an ingester left the ring, and are merged with the
+// ingesters data, regardless of -querier.query-store-after.
+type SeriesSnapshotQueryable struct {
+	bucket      objstore.Bucket
+	cfgProvider bucket.TenantConfigProvider
+	departures  InstanceDepartures
+	ttl         time.Duration
+	logger      log.Logger
+}
+
+func NewSeriesSnapshotQueryable(bkt objstore.Bucket, cfgProvider bucket.TenantConfigProvider, departures InstanceDepartures, ttl time.Duration, logger log.Logger) *SeriesSnapshotQueryable {
+	return &SeriesSnapshotQueryable{
+		bucket:      bkt,
+		cfgProvider: cfgProvider,
+		departures:  departures,
+		ttl:         ttl,
+		logger:      logger,
+	}
+}
+
+func NewSeriesSnapshotQueryableFromConfig(storageCfg cortex_tsdb.BlocksStorageConfig, cfgProvider bucket.TenantConfigProvider, departures InstanceDepartures, logger log.Logger, reg prometheus.Registerer) (*SeriesSnapshotQueryable, error) {
+	bucketClient, err := bucket.NewClient(context.Background(), storageCfg.Bucket, "querier-series-snapshots", logger, reg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create bucket client")
+	}
+
+	return NewSeriesSnapshotQueryable(bucketClient, cfgProvider, departures, storageCfg.TSDB.SeriesSnapshotTTL, logger), nil
+}
+
+// UseQueryable implements QueryableWithFilter.
+func (q *SeriesSnapshotQueryable) UseQueryable(now time.Time, _, _ int64) bool {
+	departure := q.departures.LastInstanceDeparture()
+	return !departure.IsZero() && now.Sub(departure) <= q.ttl
+}
+
+// Querier implements storage.Queryable.
+func (q *SeriesSnapshotQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	return &seriesSnapshotQuerier{ctx: ctx, queryable: q, mint: mint, maxt: maxt}, nil
+}
+
+type seriesSnapshotQuerier struct {
+	ctx        context.Context
+	queryable  *SeriesSnapshotQueryable
+	mint, maxt int64
+
+	// The snapshots are read once per query.
+	loadOnce sync.Once
+	series   []cortexpb.PreallocTimeseries
+	loadErr  error
+}
+
+func (q *seriesSnapshotQuerier) load(userID string) ([]cortexpb.PreallocTimeseries, error) {
+	q.loadOnce.Do(func() {
+		minTime := time.Now().Add(-q.queryable.ttl)
+		q.series, q.loadErr = cortex_tsdb.ReadSeriesSnapshots(q.ctx, q.queryable.bucket, userID, q.queryable.cfgProvider, minTime, q.queryable.logger)
+	})
+	return q.series, q.loadErr
+}
+
+// Select implements storage.Querier. The same series may be in the snapshots of multiple
+// ingesters, and their samples are merged.
+func (q *seriesSnapshotQuerier) Select(_ bool, sp *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	log, ctx := spanlogger.New(q.ctx, "seriesSnapshotQuerier.Select")
+	defer log.Span.Finish()
+
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	snapshots, err := q.load(userID)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	mint, maxt := q.mint, q.maxt
+	if sp != nil {
+		mint, maxt = sp.Start, sp.End
+	}
+
+	type snapshotSeries struct {
+		labels  labels.Labels
+		samples map[int64]float64
+	}
+	byLabels := map[string]*snapshotSeries{}
+
+	for _, ts := range snapshots {
+		ls := cortexpb.FromLabelAdaptersToLabels(ts.Labels)
+		if !matchesAll(ls, matchers) {
+			continue
+		}
+
+		for _, s := range ts.Samples {
+			if s.TimestampMs < mint || s.TimestampMs > maxt {
+				continue
+			}
+
+			key := ls.String()
+			entry, ok := byLabels[key]
+			if !ok {
+				entry = &snapshotSeries{labels: ls, samples: map[int64]float64{}}
+				byLabels[key] = entry
+			}
+			entry.samples[s.TimestampMs] = s.Value
+		}
+	}
+
+	result := make([]storage.Series, 0, len(byLabels))
+	for _, entry := range byLabels {
+		samples := make([]model.SamplePair, 0, len(entry.samples))
+		for t, v := range entry.samples {
+			samples = append(samples, model.SamplePair{Timestamp: model.Time(t), Value: model.SampleValue(v)})
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i].Timestamp < samples[j].Timestamp })
+
+		result = append(result, series.NewConcreteSeries(entry.labels, samples))
+	}
+
+	return series.NewConcreteSeriesSet(result)
+}
+
+func matchesAll(ls labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(ls.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// LabelValues implements storage.Querier. The labels are queried from the ingesters.
+func (q *seriesSnapshotQuerier) LabelValues(string, ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, nil
+}
+
+// LabelNames implements storage.Querier. The labels are queried from the ingesters.
+func (q *seriesSnapshotQuerier) LabelNames(...*labels.Matcher) ([]string, storage.Warnings, error) {
+	return nil, nil, nil
+}
+
+func (q *seriesSnapshotQuerier) Close() error {
+	return nil
+}
@@ -0,0 +1,153 @@
+package querier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/chunk/purger"
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+type mockInstanceDepartures struct {
+	last time.Time
+}
+
+func (m mockInstanceDepartures) LastInstanceDeparture() time.Time {
+	return m.last
+}
+
+func TestSeriesSnapshotQueryable_ShouldKeepRateContinuousAcrossAnIngesterDeparture(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	metric := labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api")
+	sample := func(ts time.Time) model.SamplePair {
+		return model.SamplePair{Timestamp: model.Time(util.TimeToMillis(ts)), Value: model.SampleValue(ts.Unix())}
+	}
+
+	// The counter is scraped every 15s. The ingester which left the ring got the samples until 20s
+	// ago, and the series has a single sample in the remaining ingesters since then.
+	departed := now.Add(-20 * time.Second)
+	remaining := model.Matrix{{Metric: util.LabelsToMetric(metric), Values: []model.SamplePair{sample(departed.Add(15 * time.Second))}}}
+
+	bkt := objstore.NewInMemBucket()
+	require.NoError(t, cortex_tsdb.WriteSeriesSnapshot(context.Background(), bkt, "user-1", "ingester-1", nil, []cortexpb.PreallocTimeseries{{TimeSeries: &cortexpb.TimeSeries{
+		Labels:  cortexpb.FromLabelsToLabelAdapters(metric),
+		Samples: []cortexpb.Sample{{TimestampMs: int64(sample(departed).Timestamp), Value: float64(sample(departed).Value)}},
+	}}}))
+
+	tests := map[string]struct {
+		snapshotsEnabled bool
+		lastDeparture    time.Time
+		expectedSeries   int
+	}{
+		"the rate of the series is missing without the series snapshots": {
+			lastDeparture:  departed,
+			expectedSeries: 0,
+		},
+		"the rate of the series is continuous with the series snapshots": {
+			snapshotsEnabled: true,
+			lastDeparture:    departed,
+			expectedSeries:   1,
+		},
+		"the series snapshots aren't queried once the TTL after the last departure expired": {
+			snapshotsEnabled: true,
+			lastDeparture:    now.Add(-time.Hour),
+			expectedSeries:   0,
+		},
+		"the series snapshots aren't queried if no ingester left the ring": {
+			snapshotsEnabled: true,
+			expectedSeries:   0,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var cfg Config
+			flagext.DefaultValues(&cfg)
+			cfg.ActiveQueryTrackerDir = t.TempDir()
+			cfg.IngesterStreaming = false
+
+			overrides, err := validation.NewOverrides(defaultLimitsConfig(), nil)
+			require.NoError(t, err)
+
+			distributor := &mockDistributor{}
+			distributor.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(remaining, nil)
+
+			stores := []QueryableWithFilter{UseAlwaysQueryable(NewChunkStoreQueryable(cfg, &emptyChunkStore{}))}
+			if tc.snapshotsEnabled {
+				stores = append(stores, NewSeriesSnapshotQueryable(bkt, nil, mockInstanceDepartures{last: tc.lastDeparture}, 5*time.Minute, log.NewNopLogger()))
+			}
+
+			queryable, _, _ := New(cfg, overrides, distributor, stores, purger.NewTombstonesLoader(nil, nil), nil, log.NewNopLogger())
+			engine := promql.NewEngine(promql.EngineOpts{
+				Logger:     log.NewNopLogger(),
+				MaxSamples: 1e6,
+				Timeout:    1 * time.Minute,
+			})
+
+			query, err := engine.NewInstantQuery(queryable, "rate(http_requests_total[1m])", now)
+			require.NoError(t, err)
+
+			r := query.Exec(user.InjectOrgID(context.Background(), "user-1"))
+			require.NoError(t, r.Err)
+
+			vector, err := r.Vector()
+			require.NoError(t, err)
+			require.Len(t, vector, tc.expectedSeries)
+			if tc.expectedSeries > 0 {
+				assert.Equal(t, labels.FromStrings("job", "api"), vector[0].Metric)
+				assert.Greater(t, vector[0].V, 0.0)
+			}
+		})
+	}
+}
+
+func TestSeriesSnapshotQuerier_Select(t *testing.T) {
+	series1 := labels.FromStrings(labels.MetricName, "up", "instance", "a")
+	series2 := labels.FromStrings(labels.MetricName, "up", "instance", "b")
+
+	// The same series is in the snapshots of two ingesters.
+	bkt := objstore.NewInMemBucket()
+	for _, ingester := range []string{"ingester-1", "ingester-2"} {
+		require.NoError(t, cortex_tsdb.WriteSeriesSnapshot(context.Background(), bkt, "user-1", ingester, nil, []cortexpb.PreallocTimeseries{
+			{TimeSeries: &cortexpb.TimeSeries{Labels: cortexpb.FromLabelsToLabelAdapters(series1), Samples: []cortexpb.Sample{{TimestampMs: 1000, Value: 1}}}},
+			{TimeSeries: &cortexpb.TimeSeries{Labels: cortexpb.FromLabelsToLabelAdapters(series2), Samples: []cortexpb.Sample{{TimestampMs: 5000, Value: 2}}}},
+		}))
+	}
+
+	queryable := NewSeriesSnapshotQueryable(bkt, nil, mockInstanceDepartures{last: time.Now()}, time.Minute, log.NewNopLogger())
+	q, err := queryable.Querier(user.InjectOrgID(context.Background(), "user-1"), 0, 2000)
+	require.NoError(t, err)
+
+	// The samples outside of the query time range are filtered out.
+	set := q.Select(true, nil, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "up"))
+	require.True(t, set.Next())
+	assert.Equal(t, series1, set.At().Labels())
+
+	it := set.At().Iterator()
+	require.True(t, it.Next())
+	ts, v := it.At()
+	assert.Equal(t, int64(1000), ts)
+	assert.Equal(t, 1.0, v)
+	assert.False(t, it.Next())
+	assert.False(t, set.Next())
+	require.NoError(t, set.Err())
+
+	// The series are filtered by the matchers.
+	set = q.Select(true, nil, labels.MustNewMatcher(labels.MatchEqual, "instance", "b"))
+	assert.False(t, set.Next())
+}
@@ -0,0 +1,146 @@
+package stats
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+var frontendCtxKey = contextKey(1)
+
+// FrontendStats holds the statistics of a query collected by the query-frontend, while splitting,
+// sharding and caching it, and sending it downstream. Unlike Stats, they're never sent over the wire.
+type FrontendStats struct {
+	splitQueries   atomic.Uint64
+	shardedQueries atomic.Uint64
+
+	resultsCacheRequestedTime atomic.Duration
+	resultsCacheHitTime       atomic.Duration
+
+	downstreamRequests atomic.Uint64
+	downstreamTime     atomic.Duration
+	downstreamMaxTime  atomic.Duration
+}
+
+// ContextWithEmptyFrontendStats returns a context with empty frontend stats.
+func ContextWithEmptyFrontendStats(ctx context.Context) (*FrontendStats, context.Context) {
+	stats := &FrontendStats{}
+	ctx = context.WithValue(ctx, frontendCtxKey, stats)
+	return stats, ctx
+}
+
+// FrontendStatsFromContext gets the FrontendStats out of the Context. Returns nil if they
+// have not been initialised in the context.
+func FrontendStatsFromContext(ctx context.Context) *FrontendStats {
+	o := ctx.Value(frontendCtxKey)
+	if o == nil {
+		return nil
+	}
+	return o.(*FrontendStats)
+}
+
+// AddSplitQueries adds the number of queries the query has been split into.
+func (s *FrontendStats) AddSplitQueries(queries int) {
+	if s == nil {
+		return
+	}
+
+	s.splitQueries.Add(uint64(queries))
+}
+
+// LoadSplitQueries returns the number of queries the query has been split into.
+func (s *FrontendStats) LoadSplitQueries() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.splitQueries.Load()
+}
+
+// AddShardedQueries adds the number of queries the query has been sharded into.
+func (s *FrontendStats) AddShardedQueries(queries int) {
+	if s == nil {
+		return
+	}
+
+	s.shardedQueries.Add(uint64(queries))
+}
+
+// LoadShardedQueries returns the number of queries the query has been sharded into.
+func (s *FrontendStats) LoadShardedQueries() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.shardedQueries.Load()
+}
+
+// AddResultsCacheLookup adds the time range of a query looked up in the results cache,
+// and the part of it found in the cache.
+func (s *FrontendStats) AddResultsCacheLookup(requested, hit time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.resultsCacheRequestedTime.Add(requested)
+	s.resultsCacheHitTime.Add(hit)
+}
+
+// LoadResultsCacheHitRatio returns the ratio of the time range of the queries looked up in the
+// results cache found in the cache, or 0 if no query has been looked up.
+func (s *FrontendStats) LoadResultsCacheHitRatio() float64 {
+	if s == nil {
+		return 0
+	}
+
+	requested := s.resultsCacheRequestedTime.Load()
+	if requested <= 0 {
+		return 0
+	}
+	return float64(s.resultsCacheHitTime.Load()) / float64(requested)
+}
+
+// AddDownstreamRequest adds a request sent downstream, and the time it took.
+func (s *FrontendStats) AddDownstreamRequest(t time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.downstreamRequests.Inc()
+	s.downstreamTime.Add(t)
+
+	for {
+		max := s.downstreamMaxTime.Load()
+		if t <= max || s.downstreamMaxTime.CAS(max, t) {
+			return
+		}
+	}
+}
+
+// LoadDownstreamRequests returns the number of requests sent downstream.
+func (s *FrontendStats) LoadDownstreamRequests() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.downstreamRequests.Load()
+}
+
+// LoadDownstreamTime returns the sum of the time taken by the requests sent downstream.
+func (s *FrontendStats) LoadDownstreamTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return s.downstreamTime.Load()
+}
+
+// LoadDownstreamMaxTime returns the time taken by the slowest request sent downstream.
+func (s *FrontendStats) LoadDownstreamMaxTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return s.downstreamMaxTime.Load()
+}
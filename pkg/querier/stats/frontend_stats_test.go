@@ -0,0 +1,43 @@
+package stats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrontendStats(t *testing.T) {
+	t.Run("add and load stats", func(t *testing.T) {
+		stats, ctx := ContextWithEmptyFrontendStats(context.Background())
+		assert.Same(t, stats, FrontendStatsFromContext(ctx))
+
+		stats.AddSplitQueries(3)
+		stats.AddShardedQueries(2)
+		stats.AddShardedQueries(2)
+		stats.AddResultsCacheLookup(2*time.Hour, time.Hour)
+		stats.AddResultsCacheLookup(2*time.Hour, 0)
+		stats.AddDownstreamRequest(2 * time.Second)
+		stats.AddDownstreamRequest(time.Second)
+
+		assert.Equal(t, uint64(3), stats.LoadSplitQueries())
+		assert.Equal(t, uint64(4), stats.LoadShardedQueries())
+		assert.Equal(t, 0.25, stats.LoadResultsCacheHitRatio())
+		assert.Equal(t, uint64(2), stats.LoadDownstreamRequests())
+		assert.Equal(t, 3*time.Second, stats.LoadDownstreamTime())
+		assert.Equal(t, 2*time.Second, stats.LoadDownstreamMaxTime())
+	})
+
+	t.Run("add and load stats nil receiver", func(t *testing.T) {
+		stats := FrontendStatsFromContext(context.Background())
+		stats.AddSplitQueries(3)
+		stats.AddResultsCacheLookup(time.Hour, time.Hour)
+		stats.AddDownstreamRequest(time.Second)
+
+		assert.Equal(t, uint64(0), stats.LoadSplitQueries())
+		assert.Equal(t, float64(0), stats.LoadResultsCacheHitRatio())
+		assert.Equal(t, uint64(0), stats.LoadDownstreamRequests())
+		assert.Equal(t, time.Duration(0), stats.LoadDownstreamMaxTime())
+	})
+}
@@ -86,6 +86,58 @@ func (s *Stats) LoadFetchedChunkBytes() uint64 {
 	return atomic.LoadUint64(&s.FetchedChunkBytes)
 }
 
+func (s *Stats) AddFetchedChunks(chunks uint64) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddUint64(&s.FetchedChunksCount, chunks)
+}
+
+func (s *Stats) LoadFetchedChunks() uint64 {
+	if s == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&s.FetchedChunksCount)
+}
+
+// AddIngesterWallTime adds some time spent fetching the series from the ingesters.
+func (s *Stats) AddIngesterWallTime(t time.Duration) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddInt64((*int64)(&s.IngesterWallTime), int64(t))
+}
+
+// LoadIngesterWallTime returns the time spent fetching the series from the ingesters.
+func (s *Stats) LoadIngesterWallTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return time.Duration(atomic.LoadInt64((*int64)(&s.IngesterWallTime)))
+}
+
+// AddStoreGatewayWallTime adds some time spent fetching the series from the store-gateways.
+func (s *Stats) AddStoreGatewayWallTime(t time.Duration) {
+	if s == nil {
+		return
+	}
+
+	atomic.AddInt64((*int64)(&s.StoreGatewayWallTime), int64(t))
+}
+
+// LoadStoreGatewayWallTime returns the time spent fetching the series from the store-gateways.
+func (s *Stats) LoadStoreGatewayWallTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	return time.Duration(atomic.LoadInt64((*int64)(&s.StoreGatewayWallTime)))
+}
+
 // Merge the provide Stats into this one.
 func (s *Stats) Merge(other *Stats) {
 	if s == nil || other == nil {
@@ -95,6 +147,9 @@ func (s *Stats) Merge(other *Stats) {
 	s.AddWallTime(other.LoadWallTime())
 	s.AddFetchedSeries(other.LoadFetchedSeries())
 	s.AddFetchedChunkBytes(other.LoadFetchedChunkBytes())
+	s.AddFetchedChunks(other.LoadFetchedChunks())
+	s.AddIngesterWallTime(other.LoadIngesterWallTime())
+	s.AddStoreGatewayWallTime(other.LoadStoreGatewayWallTime())
 }
 
 func ShouldTrackHTTPGRPCResponse(r *httpgrpc.HTTPResponse) bool {
@@ -36,6 +36,12 @@ type Stats struct {
 	FetchedSeriesCount uint64 `protobuf:"varint,2,opt,name=fetched_series_count,json=fetchedSeriesCount,proto3" json:"fetched_series_count,omitempty"`
 	// The number of bytes of the chunks fetched for the query
 	FetchedChunkBytes uint64 `protobuf:"varint,3,opt,name=fetched_chunk_bytes,json=fetchedChunkBytes,proto3" json:"fetched_chunk_bytes,omitempty"`
+	// The number of chunks fetched for the query
+	FetchedChunksCount uint64 `protobuf:"varint,4,opt,name=fetched_chunks_count,json=fetchedChunksCount,proto3" json:"fetched_chunks_count,omitempty"`
+	// The sum of the wall time spent fetching the series from the ingesters
+	IngesterWallTime time.Duration `protobuf:"bytes,5,opt,name=ingester_wall_time,json=ingesterWallTime,proto3,stdduration" json:"ingester_wall_time"`
+	// The sum of the wall time spent fetching the series from the store-gateways
+	StoreGatewayWallTime time.Duration `protobuf:"bytes,6,opt,name=store_gateway_wall_time,json=storeGatewayWallTime,proto3,stdduration" json:"store_gateway_wall_time"`
 }
 
 func (m *Stats) Reset()      { *m = Stats{} }
@@ -91,6 +97,27 @@ func (m *Stats) GetFetchedChunkBytes() uint64 {
 	return 0
 }
 
+func (m *Stats) GetFetchedChunksCount() uint64 {
+	if m != nil {
+		return m.FetchedChunksCount
+	}
+	return 0
+}
+
+func (m *Stats) GetIngesterWallTime() time.Duration {
+	if m != nil {
+		return m.IngesterWallTime
+	}
+	return 0
+}
+
+func (m *Stats) GetStoreGatewayWallTime() time.Duration {
+	if m != nil {
+		return m.StoreGatewayWallTime
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Stats)(nil), "stats.Stats")
 }
@@ -98,25 +125,29 @@ func init() {
 func init() { proto.RegisterFile("stats.proto", fileDescriptor_b4756a0aec8b9d44) }
 
 var fileDescriptor_b4756a0aec8b9d44 = []byte{
-	// 281 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x44, 0xd0, 0xb1, 0x4e, 0x83, 0x40,
-	0x1c, 0xc7, 0xf1, 0xfb, 0xab, 0x35, 0x95, 0x4e, 0xa2, 0x03, 0x76, 0xf8, 0xb7, 0x71, 0xea, 0xe2,
-	0xd5, 0xe8, 0xe8, 0x62, 0xa8, 0x4f, 0xd0, 0x3a, 0xb9, 0x10, 0xa0, 0x57, 0x20, 0x02, 0x67, 0xe0,
-	0x2e, 0xc6, 0xcd, 0x47, 0x70, 0xf4, 0x11, 0x4c, 0x7c, 0x91, 0x8e, 0x8c, 0x9d, 0x54, 0x8e, 0xc5,
-	0xb1, 0x8f, 0x60, 0xee, 0xa0, 0x71, 0xe3, 0x97, 0x0f, 0xdf, 0x4b, 0xee, 0xac, 0x41, 0x29, 0x7c,
-	0x51, 0xd2, 0xa7, 0x82, 0x0b, 0x6e, 0xf7, 0xcc, 0x18, 0x5e, 0x44, 0x89, 0x88, 0x65, 0x40, 0x43,
-	0x9e, 0x4d, 0x23, 0x1e, 0xf1, 0xa9, 0xd1, 0x40, 0xae, 0xcc, 0x32, 0xc3, 0x7c, 0xb5, 0xd5, 0x10,
-	0x23, 0xce, 0xa3, 0x94, 0xfd, 0xff, 0xb5, 0x94, 0x85, 0x2f, 0x12, 0x9e, 0xb7, 0x7e, 0xfe, 0x09,
-	0x56, 0x6f, 0xa1, 0x0f, 0xb6, 0x6f, 0xad, 0xa3, 0x67, 0x3f, 0x4d, 0x3d, 0x91, 0x64, 0xcc, 0x81,
-	0x31, 0x4c, 0x06, 0x57, 0x67, 0xb4, 0xad, 0xe9, 0xae, 0xa6, 0x77, 0x5d, 0xed, 0xf6, 0xd7, 0x5f,
-	0x23, 0xf2, 0xfe, 0x3d, 0x82, 0x79, 0x5f, 0x57, 0xf7, 0x49, 0xc6, 0xec, 0x4b, 0xeb, 0x74, 0xc5,
-	0x44, 0x18, 0xb3, 0xa5, 0x57, 0xb2, 0x22, 0x61, 0xa5, 0x17, 0x72, 0x99, 0x0b, 0x67, 0x6f, 0x0c,
-	0x93, 0x83, 0xb9, 0xdd, 0xd9, 0xc2, 0xd0, 0x4c, 0x8b, 0x4d, 0xad, 0x93, 0x5d, 0x11, 0xc6, 0x32,
-	0x7f, 0xf4, 0x82, 0x17, 0xc1, 0x4a, 0x67, 0xdf, 0x04, 0xc7, 0x1d, 0xcd, 0xb4, 0xb8, 0x1a, 0xdc,
-	0x9b, 0xaa, 0x46, 0xb2, 0xa9, 0x91, 0x6c, 0x6b, 0x84, 0x57, 0x85, 0xf0, 0xa1, 0x10, 0xd6, 0x0a,
-	0xa1, 0x52, 0x08, 0x3f, 0x0a, 0xe1, 0x57, 0x21, 0xd9, 0x2a, 0x84, 0xb7, 0x06, 0x49, 0xd5, 0x20,
-	0xd9, 0x34, 0x48, 0x1e, 0xda, 0x97, 0x0b, 0x0e, 0xcd, 0x2d, 0xae, 0xff, 0x02, 0x00, 0x00, 0xff,
-	0xff, 0x9d, 0xf1, 0x86, 0xb8, 0x56, 0x01, 0x00, 0x00,
+	// 341 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x92, 0x3f, 0x4f, 0xc2, 0x40,
+	0x18, 0xc6, 0xef, 0xe4, 0x4f, 0xf0, 0x58, 0xb4, 0x92, 0x88, 0x0c, 0x2f, 0xc4, 0x89, 0xc5, 0x62,
+	0x74, 0x74, 0x31, 0x60, 0xe2, 0x2c, 0x98, 0x98, 0xb0, 0x34, 0x6d, 0x39, 0x8e, 0x46, 0xe8, 0x99,
+	0xde, 0x35, 0x84, 0xcd, 0x0f, 0xe0, 0xe0, 0xe8, 0x47, 0xf0, 0xa3, 0x30, 0x32, 0x32, 0xa9, 0x1c,
+	0x8b, 0x23, 0x1f, 0xc1, 0xf4, 0xda, 0x0b, 0xb8, 0xb1, 0xdd, 0x9b, 0xdf, 0xfb, 0x7b, 0x9e, 0xbc,
+	0xc9, 0x91, 0xb2, 0x90, 0xae, 0x14, 0xf6, 0x4b, 0xc4, 0x25, 0xb7, 0x0a, 0x7a, 0xa8, 0x5d, 0xb0,
+	0x40, 0x8e, 0x62, 0xcf, 0xf6, 0xf9, 0xa4, 0xc5, 0x38, 0xe3, 0x2d, 0x4d, 0xbd, 0x78, 0xa8, 0x27,
+	0x3d, 0xe8, 0x57, 0x6a, 0xd5, 0x80, 0x71, 0xce, 0xc6, 0x74, 0xbb, 0x35, 0x88, 0x23, 0x57, 0x06,
+	0x3c, 0x4c, 0xf9, 0xf9, 0x5b, 0x8e, 0x14, 0x7a, 0x49, 0xb0, 0x75, 0x4b, 0x0e, 0xa7, 0xee, 0x78,
+	0xec, 0xc8, 0x60, 0x42, 0xab, 0xb8, 0x81, 0x9b, 0xe5, 0xab, 0x33, 0x3b, 0xb5, 0x6d, 0x63, 0xdb,
+	0x77, 0x99, 0xdd, 0x2e, 0xcd, 0xbf, 0xea, 0xe8, 0xe3, 0xbb, 0x8e, 0xbb, 0xa5, 0xc4, 0x7a, 0x0c,
+	0x26, 0xd4, 0xba, 0x24, 0x95, 0x21, 0x95, 0xfe, 0x88, 0x0e, 0x1c, 0x41, 0xa3, 0x80, 0x0a, 0xc7,
+	0xe7, 0x71, 0x28, 0xab, 0x07, 0x0d, 0xdc, 0xcc, 0x77, 0xad, 0x8c, 0xf5, 0x34, 0xea, 0x24, 0xc4,
+	0xb2, 0xc9, 0x89, 0x31, 0xfc, 0x51, 0x1c, 0x3e, 0x3b, 0xde, 0x4c, 0x52, 0x51, 0xcd, 0x69, 0xe1,
+	0x38, 0x43, 0x9d, 0x84, 0xb4, 0x13, 0xb0, 0xdb, 0xa0, 0xf7, 0x4d, 0x43, 0xfe, 0x5f, 0x83, 0x16,
+	0xb2, 0x86, 0x07, 0x62, 0x05, 0x21, 0xa3, 0x42, 0xd2, 0xc8, 0xd9, 0x9e, 0x57, 0xd8, 0xff, 0xbc,
+	0x23, 0xa3, 0x3f, 0x99, 0x33, 0xfb, 0xe4, 0x54, 0x48, 0x1e, 0x51, 0x87, 0xb9, 0x92, 0x4e, 0xdd,
+	0xd9, 0x4e, 0x6e, 0x71, 0xff, 0xdc, 0x8a, 0xce, 0xb8, 0x4f, 0x23, 0x4c, 0x76, 0xfb, 0x66, 0xb1,
+	0x02, 0xb4, 0x5c, 0x01, 0xda, 0xac, 0x00, 0xbf, 0x2a, 0xc0, 0x9f, 0x0a, 0xf0, 0x5c, 0x01, 0x5e,
+	0x28, 0xc0, 0x3f, 0x0a, 0xf0, 0xaf, 0x02, 0xb4, 0x51, 0x80, 0xdf, 0xd7, 0x80, 0x16, 0x6b, 0x40,
+	0xcb, 0x35, 0xa0, 0x7e, 0xfa, 0x35, 0xbc, 0xa2, 0xee, 0xbb, 0xfe, 0x1b, 0x00, 0x57, 0x64, 0x15,
+	0xbe, 0x37, 0x02, 0x00, 0x00,
 }
 
 func (this *Stats) Equal(that interface{}) bool {
@@ -147,17 +178,29 @@ func (this *Stats) Equal(that interface{}) bool {
 	if this.FetchedChunkBytes != that1.FetchedChunkBytes {
 		return false
 	}
+	if this.FetchedChunksCount != that1.FetchedChunksCount {
+		return false
+	}
+	if this.IngesterWallTime != that1.IngesterWallTime {
+		return false
+	}
+	if this.StoreGatewayWallTime != that1.StoreGatewayWallTime {
+		return false
+	}
 	return true
 }
 func (this *Stats) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 7)
+	s := make([]string, 0, 10)
 	s = append(s, "&stats.Stats{")
 	s = append(s, "WallTime: "+fmt.Sprintf("%#v", this.WallTime)+",\n")
 	s = append(s, "FetchedSeriesCount: "+fmt.Sprintf("%#v", this.FetchedSeriesCount)+",\n")
 	s = append(s, "FetchedChunkBytes: "+fmt.Sprintf("%#v", this.FetchedChunkBytes)+",\n")
+	s = append(s, "FetchedChunksCount: "+fmt.Sprintf("%#v", this.FetchedChunksCount)+",\n")
+	s = append(s, "IngesterWallTime: "+fmt.Sprintf("%#v", this.IngesterWallTime)+",\n")
+	s = append(s, "StoreGatewayWallTime: "+fmt.Sprintf("%#v", this.StoreGatewayWallTime)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -189,6 +232,27 @@ func (m *Stats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	n1, err1 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.StoreGatewayWallTime, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.StoreGatewayWallTime):])
+	if err1 != nil {
+		return 0, err1
+	}
+	i -= n1
+	i = encodeVarintStats(dAtA, i, uint64(n1))
+	i--
+	dAtA[i] = 0x32
+	n2, err2 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.IngesterWallTime, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.IngesterWallTime):])
+	if err2 != nil {
+		return 0, err2
+	}
+	i -= n2
+	i = encodeVarintStats(dAtA, i, uint64(n2))
+	i--
+	dAtA[i] = 0x2a
+	if m.FetchedChunksCount != 0 {
+		i = encodeVarintStats(dAtA, i, uint64(m.FetchedChunksCount))
+		i--
+		dAtA[i] = 0x20
+	}
 	if m.FetchedChunkBytes != 0 {
 		i = encodeVarintStats(dAtA, i, uint64(m.FetchedChunkBytes))
 		i--
@@ -199,12 +263,12 @@ func (m *Stats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i--
 		dAtA[i] = 0x10
 	}
-	n1, err1 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.WallTime, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.WallTime):])
-	if err1 != nil {
-		return 0, err1
+	n3, err3 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.WallTime, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.WallTime):])
+	if err3 != nil {
+		return 0, err3
 	}
-	i -= n1
-	i = encodeVarintStats(dAtA, i, uint64(n1))
+	i -= n3
+	i = encodeVarintStats(dAtA, i, uint64(n3))
 	i--
 	dAtA[i] = 0xa
 	return len(dAtA) - i, nil
@@ -235,6 +299,13 @@ func (m *Stats) Size() (n int) {
 	if m.FetchedChunkBytes != 0 {
 		n += 1 + sovStats(uint64(m.FetchedChunkBytes))
 	}
+	if m.FetchedChunksCount != 0 {
+		n += 1 + sovStats(uint64(m.FetchedChunksCount))
+	}
+	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.IngesterWallTime)
+	n += 1 + l + sovStats(uint64(l))
+	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.StoreGatewayWallTime)
+	n += 1 + l + sovStats(uint64(l))
 	return n
 }
 
@@ -252,6 +323,9 @@ func (this *Stats) String() string {
 		`WallTime:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.WallTime), "Duration", "duration.Duration", 1), `&`, ``, 1) + `,`,
 		`FetchedSeriesCount:` + fmt.Sprintf("%v", this.FetchedSeriesCount) + `,`,
 		`FetchedChunkBytes:` + fmt.Sprintf("%v", this.FetchedChunkBytes) + `,`,
+		`FetchedChunksCount:` + fmt.Sprintf("%v", this.FetchedChunksCount) + `,`,
+		`IngesterWallTime:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.IngesterWallTime), "Duration", "duration.Duration", 1), `&`, ``, 1) + `,`,
+		`StoreGatewayWallTime:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.StoreGatewayWallTime), "Duration", "duration.Duration", 1), `&`, ``, 1) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -364,6 +438,91 @@ func (m *Stats) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FetchedChunksCount", wireType)
+			}
+			m.FetchedChunksCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FetchedChunksCount |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field IngesterWallTime", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthStats
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthStats
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdDurationUnmarshal(&m.IngesterWallTime, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StoreGatewayWallTime", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthStats
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthStats
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdDurationUnmarshal(&m.StoreGatewayWallTime, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipStats(dAtA[iNdEx:])
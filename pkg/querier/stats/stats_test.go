@@ -59,23 +59,70 @@ func TestStats_AddFetchedChunkBytes(t *testing.T) {
 	})
 }
 
+func TestStats_AddFetchedChunks(t *testing.T) {
+	t.Run("add and load chunks", func(t *testing.T) {
+		stats, _ := ContextWithEmptyStats(context.Background())
+		stats.AddFetchedChunks(10)
+		stats.AddFetchedChunks(5)
+
+		assert.Equal(t, uint64(15), stats.LoadFetchedChunks())
+	})
+
+	t.Run("add and load chunks nil receiver", func(t *testing.T) {
+		var stats *Stats
+		stats.AddFetchedChunks(10)
+
+		assert.Equal(t, uint64(0), stats.LoadFetchedChunks())
+	})
+}
+
+func TestStats_SourcesWallTime(t *testing.T) {
+	t.Run("add and load the wall time by source", func(t *testing.T) {
+		stats, _ := ContextWithEmptyStats(context.Background())
+		stats.AddIngesterWallTime(time.Second)
+		stats.AddIngesterWallTime(time.Second)
+		stats.AddStoreGatewayWallTime(time.Millisecond)
+
+		assert.Equal(t, 2*time.Second, stats.LoadIngesterWallTime())
+		assert.Equal(t, time.Millisecond, stats.LoadStoreGatewayWallTime())
+	})
+
+	t.Run("add and load the wall time by source nil receiver", func(t *testing.T) {
+		var stats *Stats
+		stats.AddIngesterWallTime(time.Second)
+		stats.AddStoreGatewayWallTime(time.Second)
+
+		assert.Equal(t, time.Duration(0), stats.LoadIngesterWallTime())
+		assert.Equal(t, time.Duration(0), stats.LoadStoreGatewayWallTime())
+	})
+}
+
 func TestStats_Merge(t *testing.T) {
 	t.Run("merge two stats objects", func(t *testing.T) {
 		stats1 := &Stats{}
 		stats1.AddWallTime(time.Millisecond)
 		stats1.AddFetchedSeries(50)
 		stats1.AddFetchedChunkBytes(42)
+		stats1.AddFetchedChunks(5)
+		stats1.AddIngesterWallTime(time.Millisecond)
+		stats1.AddStoreGatewayWallTime(time.Millisecond)
 
 		stats2 := &Stats{}
 		stats2.AddWallTime(time.Second)
 		stats2.AddFetchedSeries(60)
 		stats2.AddFetchedChunkBytes(100)
+		stats2.AddFetchedChunks(7)
+		stats2.AddIngesterWallTime(time.Second)
+		stats2.AddStoreGatewayWallTime(2 * time.Second)
 
 		stats1.Merge(stats2)
 
 		assert.Equal(t, 1001*time.Millisecond, stats1.LoadWallTime())
 		assert.Equal(t, uint64(110), stats1.LoadFetchedSeries())
 		assert.Equal(t, uint64(142), stats1.LoadFetchedChunkBytes())
+		assert.Equal(t, uint64(12), stats1.LoadFetchedChunks())
+		assert.Equal(t, 1001*time.Millisecond, stats1.LoadIngesterWallTime())
+		assert.Equal(t, 2001*time.Millisecond, stats1.LoadStoreGatewayWallTime())
 	})
 
 	t.Run("merge two nil stats objects", func(t *testing.T) {
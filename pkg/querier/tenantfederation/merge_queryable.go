@@ -29,15 +29,15 @@ const (
 // Querier by sending of subsequent requests.
 // By setting byPassWithSingleQuerier to true the mergeQuerier gets by-passed
 // and results for request with a single querier will not contain the
-// "__tenant_id__" label. This allows a smoother transition, when enabling
+// tenantLabelName label. This allows a smoother transition, when enabling
 // tenant federation in a cluster.
-// The result contains a label "__tenant_id__" to identify the tenant ID that
-// it originally resulted from.
-// If the label "__tenant_id__" is already existing, its value is overwritten
+// The result contains a label tenantLabelName (eg. "__tenant_id__") to
+// identify the tenant ID that it originally resulted from.
+// If the label tenantLabelName is already existing, its value is overwritten
 // by the tenant ID and the previous value is exposed through a new label
 // prefixed with "original_". This behaviour is not implemented recursively.
-func NewQueryable(upstream storage.Queryable, byPassWithSingleQuerier bool) storage.Queryable {
-	return NewMergeQueryable(defaultTenantLabel, tenantQuerierCallback(upstream), byPassWithSingleQuerier)
+func NewQueryable(upstream storage.Queryable, tenantLabelName string, byPassWithSingleQuerier bool) storage.Queryable {
+	return NewMergeQueryable(tenantLabelName, tenantQuerierCallback(upstream), byPassWithSingleQuerier)
 }
 
 func tenantQuerierCallback(queryable storage.Queryable) MergeQuerierCallback {
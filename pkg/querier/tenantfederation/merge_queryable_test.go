@@ -28,6 +28,10 @@ const (
 	maxt, mint = 0, 10
 	// mockMatchersNotImplemented is a message used to indicate that the mockTenantQueryable used in the tests does not support filtering by matchers.
 	mockMatchersNotImplemented = "matchers are not implemented in the mockTenantQueryable"
+	// customTenantLabel is a custom tenant label name configured in the tests.
+	customTenantLabel = "tenant"
+	// originalCustomTenantLabel is the custom tenant label with a prefix.
+	originalCustomTenantLabel = retainExistingPrefix + customTenantLabel
 	// originalDefaultTenantLabel is the default tenant label with a prefix.
 	// It is used to prevent matcher clashes for timeseries that happen to have a label with the same name as the default tenant label.
 	originalDefaultTenantLabel = retainExistingPrefix + defaultTenantLabel
@@ -253,11 +257,17 @@ type mergeQueryableScenario struct {
 	queryable mockTenantQueryableWithFilter
 	// doNotByPassSingleQuerier determines whether the MergeQueryable is by-passed in favor of a single querier.
 	doNotByPassSingleQuerier bool
+	// tenantLabelName is the name of the tenant label. The default one is used if empty.
+	tenantLabelName string
 }
 
 func (s *mergeQueryableScenario) init() (storage.Querier, error) {
-	// initialize with default tenant label
-	q := NewQueryable(&s.queryable, !s.doNotByPassSingleQuerier)
+	// initialize with default tenant label, unless a custom one is set
+	tenantLabelName := defaultTenantLabel
+	if s.tenantLabelName != "" {
+		tenantLabelName = s.tenantLabelName
+	}
+	q := NewQueryable(&s.queryable, tenantLabelName, !s.doNotByPassSingleQuerier)
 
 	// inject tenants into context
 	ctx := context.Background()
@@ -277,6 +287,8 @@ type selectTestCase struct {
 	matchers []*labels.Matcher
 	// expectedSeriesCount is the expected number of series returned by a Select filtered by the Matchers in selector.
 	expectedSeriesCount int
+	// expectedLabels are the expected values of the given label names, in the order of the returned series.
+	expectedLabels map[string][]string
 	// expectedWarnings is a slice of storage.Warnings messages expected when querying.
 	expectedWarnings []string
 	// expectedQueryErr is the error expected when querying.
@@ -334,7 +346,7 @@ type labelValuesScenario struct {
 func TestMergeQueryable_Querier(t *testing.T) {
 	t.Run("querying without a tenant specified should error", func(t *testing.T) {
 		queryable := &mockTenantQueryableWithFilter{}
-		q := NewQueryable(queryable, false /* byPassWithSingleQuerier */)
+		q := NewQueryable(queryable, defaultTenantLabel, false /* byPassWithSingleQuerier */)
 		// Create a context with no tenant specified.
 		ctx := context.Background()
 
@@ -368,6 +380,26 @@ var (
 		},
 	}
 
+	threeTenantsWithCustomTenantLabelScenario = mergeQueryableScenario{
+		name:            "three tenants and a custom tenant label",
+		tenants:         []string{"team-a", "team-b", "team-c"},
+		tenantLabelName: customTenantLabel,
+		queryable: mockTenantQueryableWithFilter{
+			warningsByTenant: map[string]storage.Warnings{
+				"team-b": storage.Warnings([]error{errors.New("don't like them")}),
+			},
+		},
+	}
+
+	threeTenantsWithCustomTenantLabelSetScenario = mergeQueryableScenario{
+		name:            "three tenants and a custom tenant label already set",
+		tenants:         []string{"team-a", "team-b", "team-c"},
+		tenantLabelName: customTenantLabel,
+		queryable: mockTenantQueryableWithFilter{
+			extraLabels: []string{customTenantLabel, "original-value"},
+		},
+	}
+
 	threeTenantsWithWarningsScenario = mergeQueryableScenario{
 		name:    "three tenants, two with warnings",
 		tenants: []string{"team-a", "team-b", "team-c"},
@@ -459,6 +491,57 @@ func TestMergeQueryable_Select(t *testing.T) {
 				},
 			},
 		},
+		{
+			mergeQueryableScenario: threeTenantsWithCustomTenantLabelScenario,
+			selectTestCases: []selectTestCase{
+				{
+					name:                "should return all series with the custom tenant label when no matchers are provided",
+					expectedSeriesCount: 6,
+					expectedLabels:      map[string][]string{customTenantLabel: {"team-a", "team-a", "team-b", "team-b", "team-c", "team-c"}},
+					expectedWarnings:    []string{`warning querying tenant team-b: don't like them`},
+				},
+				{
+					name:                "should return only series for team-b when there is an equals matcher on the custom tenant label",
+					matchers:            []*labels.Matcher{{Name: customTenantLabel, Value: "team-b", Type: labels.MatchEqual}},
+					expectedSeriesCount: 2,
+					expectedLabels:      map[string][]string{customTenantLabel: {"team-b", "team-b"}},
+					expectedWarnings:    []string{`warning querying tenant team-b: don't like them`},
+				},
+				{
+					name:                "should not consider the default tenant label as the tenant label",
+					matchers:            []*labels.Matcher{{Name: defaultTenantLabel, Value: "team-b", Type: labels.MatchEqual}},
+					expectedSeriesCount: 0,
+					expectedWarnings:    []string{`warning querying tenant team-b: don't like them`},
+				},
+			},
+		},
+		{
+			mergeQueryableScenario: threeTenantsWithCustomTenantLabelSetScenario,
+			selectTestCases: []selectTestCase{
+				{
+					name:                "should return all series with the original value of the custom tenant label retained",
+					expectedSeriesCount: 6,
+					expectedLabels: map[string][]string{
+						customTenantLabel:         {"team-a", "team-a", "team-b", "team-b", "team-c", "team-c"},
+						originalCustomTenantLabel: {"original-value", "original-value", "original-value", "original-value", "original-value", "original-value"},
+					},
+				},
+				{
+					name:                "should return only series for team-c when there is an equals matcher on the custom tenant label",
+					matchers:            []*labels.Matcher{{Name: customTenantLabel, Value: "team-c", Type: labels.MatchEqual}},
+					expectedSeriesCount: 2,
+					expectedLabels: map[string][]string{
+						customTenantLabel:         {"team-c", "team-c"},
+						originalCustomTenantLabel: {"original-value", "original-value"},
+					},
+				},
+				{
+					name:                "should return no series when there is a not-equals matcher for the original value of the custom tenant label",
+					matchers:            []*labels.Matcher{{Name: originalCustomTenantLabel, Value: "original-value", Type: labels.MatchNotEqual}},
+					expectedSeriesCount: 0,
+				},
+			},
+		},
 		{
 			mergeQueryableScenario: threeTenantsWithWarningsScenario,
 			selectTestCases: []selectTestCase{{
@@ -494,10 +577,17 @@ func TestMergeQueryable_Select(t *testing.T) {
 					}
 
 					count := 0
+					actualLabels := map[string][]string{}
 					for seriesSet.Next() {
 						count++
+						for name := range tc.expectedLabels {
+							actualLabels[name] = append(actualLabels[name], seriesSet.At().Labels().Get(name))
+						}
 					}
 					require.Equal(t, tc.expectedSeriesCount, count)
+					for name, expected := range tc.expectedLabels {
+						assert.ElementsMatch(t, expected, actualLabels[name], "unexpected values for label '%s'", name)
+					}
 				})
 			}
 		})
@@ -545,6 +635,32 @@ func TestMergeQueryable_LabelNames(t *testing.T) {
 				expectedLabelNames: []string{defaultTenantLabel, "instance", originalDefaultTenantLabel, "tenant-team-a", "tenant-team-b", "tenant-team-c"},
 			},
 		},
+		{
+			mergeQueryableScenario: threeTenantsWithCustomTenantLabelScenario,
+			labelNamesTestCase: labelNamesTestCase{
+				name:               "should return the custom tenant label and all tenant team labels",
+				expectedLabelNames: []string{"instance", customTenantLabel, "tenant-team-a", "tenant-team-b", "tenant-team-c"},
+				expectedWarnings:   []string{`warning querying tenant team-b: don't like them`},
+			},
+		},
+		{
+			mergeQueryableScenario: threeTenantsWithCustomTenantLabelScenario,
+			labelNamesTestCase: labelNamesTestCase{
+				name: "should only query tenant-a when there is an equals matcher on the custom tenant label",
+				matchers: []*labels.Matcher{
+					{Name: customTenantLabel, Value: "team-a", Type: labels.MatchEqual},
+					labels.MustNewMatcher(labels.MatchRegexp, seriesWithLabelNames, "bar|foo"),
+				},
+				expectedLabelNames: []string{"bar", "foo", "instance", customTenantLabel, "tenant-team-a"},
+			},
+		},
+		{
+			mergeQueryableScenario: threeTenantsWithCustomTenantLabelSetScenario,
+			labelNamesTestCase: labelNamesTestCase{
+				name:               "should return the custom tenant label, all tenant team labels and the original custom tenant label",
+				expectedLabelNames: []string{"instance", originalCustomTenantLabel, customTenantLabel, "tenant-team-a", "tenant-team-b", "tenant-team-c"},
+			},
+		},
 		{
 			mergeQueryableScenario: threeTenantsWithWarningsScenario,
 			labelNamesTestCase: labelNamesTestCase{
@@ -758,6 +874,43 @@ func TestMergeQueryable_LabelValues(t *testing.T) {
 				},
 			},
 		},
+		{
+			mergeQueryableScenario: threeTenantsWithCustomTenantLabelScenario,
+			labelValuesTestCases: []labelValuesTestCase{
+				{
+					name:                "should return all tenant values for the custom tenant label",
+					labelName:           customTenantLabel,
+					expectedLabelValues: []string{"team-a", "team-b", "team-c"},
+				},
+				{
+					name:                "should return only label values for team-a and team-c when there is a not-equals matcher on the custom tenant label",
+					labelName:           customTenantLabel,
+					matchers:            []*labels.Matcher{{Name: customTenantLabel, Value: "team-b", Type: labels.MatchNotEqual}},
+					expectedLabelValues: []string{"team-a", "team-c"},
+				},
+				{
+					name:                "should return no values for the default tenant label",
+					labelName:           defaultTenantLabel,
+					expectedLabelValues: []string{},
+					expectedWarnings:    []string{`warning querying tenant team-b: don't like them`},
+				},
+			},
+		},
+		{
+			mergeQueryableScenario: threeTenantsWithCustomTenantLabelSetScenario,
+			labelValuesTestCases: []labelValuesTestCase{
+				{
+					name:                "should return all tenant values for the custom tenant label",
+					labelName:           customTenantLabel,
+					expectedLabelValues: []string{"team-a", "team-b", "team-c"},
+				},
+				{
+					name:                "should return the original value for the original custom tenant label",
+					labelName:           originalCustomTenantLabel,
+					expectedLabelValues: []string{"original-value"},
+				},
+			},
+		},
 		{
 			mergeQueryableScenario: threeTenantsWithWarningsScenario,
 			labelValuesTestCases: []labelValuesTestCase{{
@@ -873,7 +1026,7 @@ func TestTracingMergeQueryable(t *testing.T) {
 	// set a multi tenant resolver
 	tenant.WithDefaultResolver(tenant.NewMultiResolver())
 	filter := mockTenantQueryableWithFilter{}
-	q := NewQueryable(&filter, false)
+	q := NewQueryable(&filter, defaultTenantLabel, false)
 	// retrieve querier if set
 	querier, err := q.Querier(ctx, mint, maxt)
 	require.NoError(t, err)
@@ -2,13 +2,29 @@ package tenantfederation
 
 import (
 	"flag"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
 )
 
+var errInvalidTenantLabelName = errors.New("invalid tenant label name")
+
 type Config struct {
 	// Enabled switches on support for multi tenant query federation
 	Enabled bool `yaml:"enabled"`
+	// TenantLabelName is the name of the label identifying the tenant of the federated series.
+	TenantLabelName string `yaml:"tenant_label_name"`
 }
 
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.Enabled, "tenant-federation.enabled", false, "If enabled on all Cortex services, queries can be federated across multiple tenants. The tenant IDs involved need to be specified separated by a `|` character in the `X-Scope-OrgID` header (experimental).")
+	f.StringVar(&cfg.TenantLabelName, "tenant-federation.tenant-label-name", defaultTenantLabel, "The name of the label added to the series of the federated queries to identify the tenant they belong to. If a series already has a label with this name, its value is retained in a label with the same name prefixed by `original_`.")
+}
+
+// Validate the Config.
+func (cfg *Config) Validate() error {
+	if cfg.Enabled && !model.LabelName(cfg.TenantLabelName).IsValid() {
+		return errors.Wrapf(errInvalidTenantLabelName, "%q", cfg.TenantLabelName)
+	}
+	return nil
 }
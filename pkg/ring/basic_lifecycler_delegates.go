@@ -42,18 +42,22 @@ func (d *LeaveOnStoppingDelegate) OnRingInstanceHeartbeat(lifecycler *BasicLifec
 }
 
 type TokensPersistencyDelegate struct {
-	next       BasicLifecyclerDelegate
-	logger     log.Logger
-	tokensPath string
-	loadState  InstanceState
+	next              BasicLifecyclerDelegate
+	logger            log.Logger
+	tokensPath        string
+	loadState         InstanceState
+	discardOnMismatch bool
 }
 
-func NewTokensPersistencyDelegate(path string, state InstanceState, next BasicLifecyclerDelegate, logger log.Logger) *TokensPersistencyDelegate {
+// NewTokensPersistencyDelegate makes a new TokensPersistencyDelegate. If discardOnMismatch is true, the tokens
+// stored in the file by an instance with a different ID or in a different zone are not loaded.
+func NewTokensPersistencyDelegate(path string, state InstanceState, discardOnMismatch bool, next BasicLifecyclerDelegate, logger log.Logger) *TokensPersistencyDelegate {
 	return &TokensPersistencyDelegate{
-		next:       next,
-		logger:     logger,
-		tokensPath: path,
-		loadState:  state,
+		next:              next,
+		logger:            logger,
+		tokensPath:        path,
+		loadState:         state,
+		discardOnMismatch: discardOnMismatch,
 	}
 }
 
@@ -70,7 +74,7 @@ func (d *TokensPersistencyDelegate) OnRingInstanceRegister(lifecycler *BasicLife
 		return d.next.OnRingInstanceRegister(lifecycler, ringDesc, instanceExists, instanceID, instanceDesc)
 	}
 
-	tokensFromFile, err := LoadTokensFromFile(d.tokensPath)
+	tokensFromFile, err := loadTokensFromFileForInstance(d.tokensPath, lifecycler.GetInstanceID(), lifecycler.GetInstanceZone(), d.discardOnMismatch, d.logger)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			level.Error(d.logger).Log("msg", "error loading tokens from file", "err", err)
@@ -79,6 +83,11 @@ func (d *TokensPersistencyDelegate) OnRingInstanceRegister(lifecycler *BasicLife
 		return d.next.OnRingInstanceRegister(lifecycler, ringDesc, instanceExists, instanceID, instanceDesc)
 	}
 
+	// The tokens have been discarded, so new ones will be generated.
+	if len(tokensFromFile) == 0 {
+		return d.next.OnRingInstanceRegister(lifecycler, ringDesc, instanceExists, instanceID, instanceDesc)
+	}
+
 	// Signal the next delegate that the tokens have been loaded, miming the
 	// case the instance exist in the ring (which is OK because the lifecycler
 	// will correctly reconcile this case too).
@@ -94,7 +103,8 @@ func (d *TokensPersistencyDelegate) OnRingInstanceRegister(lifecycler *BasicLife
 
 func (d *TokensPersistencyDelegate) OnRingInstanceTokens(lifecycler *BasicLifecycler, tokens Tokens) {
 	if d.tokensPath != "" {
-		if err := tokens.StoreToFile(d.tokensPath); err != nil {
+		meta := newTokensFileMetadata(lifecycler.GetInstanceID(), lifecycler.GetInstanceZone(), lifecycler.GetRegisteredAt())
+		if err := tokens.StoreToFileWithMetadata(d.tokensPath, meta); err != nil {
 			level.Error(d.logger).Log("msg", "error storing tokens to disk", "path", d.tokensPath, "err", err)
 		}
 	}
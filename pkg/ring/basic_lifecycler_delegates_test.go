@@ -54,7 +54,7 @@ func TestTokensPersistencyDelegate_ShouldSkipTokensLoadingIfFileDoesNotExist(t *
 
 	logs := &concurrency.SyncBuffer{}
 	logger := log.NewLogfmtLogger(logs)
-	persistencyDelegate := NewTokensPersistencyDelegate(tokensFile.Name(), ACTIVE, testDelegate, logger)
+	persistencyDelegate := NewTokensPersistencyDelegate(tokensFile.Name(), ACTIVE, true, testDelegate, logger)
 
 	ctx := context.Background()
 	cfg := prepareBasicLifecyclerConfig()
@@ -98,7 +98,7 @@ func TestTokensPersistencyDelegate_ShouldLoadTokensFromFileIfFileExist(t *testin
 		},
 	}
 
-	persistencyDelegate := NewTokensPersistencyDelegate(tokensFile.Name(), ACTIVE, testDelegate, log.NewNopLogger())
+	persistencyDelegate := NewTokensPersistencyDelegate(tokensFile.Name(), ACTIVE, true, testDelegate, log.NewNopLogger())
 
 	ctx := context.Background()
 	cfg := prepareBasicLifecyclerConfig()
@@ -119,6 +119,61 @@ func TestTokensPersistencyDelegate_ShouldLoadTokensFromFileIfFileExist(t *testin
 	assert.Equal(t, storedTokens, actualTokens)
 }
 
+func TestTokensPersistencyDelegate_ShouldDiscardTokensStoredByAnotherInstance(t *testing.T) {
+	tests := map[string]struct {
+		discardOnMismatch bool
+		expectedTokens    Tokens
+	}{
+		"should discard the tokens if discarding is enabled": {
+			discardOnMismatch: true,
+			expectedTokens:    Tokens{1, 2, 3, 4, 5},
+		},
+		"should load the tokens if discarding is disabled": {
+			discardOnMismatch: false,
+			expectedTokens:    Tokens{6, 7, 8, 9, 10},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			tokensFile, err := ioutil.TempFile(os.TempDir(), "tokens-*")
+			require.NoError(t, err)
+			defer os.Remove(tokensFile.Name()) //nolint:errcheck
+
+			// Store some tokens to the file, as another instance.
+			require.NoError(t, Tokens{6, 7, 8, 9, 10}.StoreToFileWithMetadata(tokensFile.Name(), TokensFileMetadata{InstanceID: "another-instance"}))
+
+			testDelegate := &mockDelegate{
+				onRegister: func(lifecycler *BasicLifecycler, ringDesc Desc, instanceExists bool, instanceID string, instanceDesc InstanceDesc) (InstanceState, Tokens) {
+					if instanceExists {
+						return instanceDesc.GetState(), instanceDesc.GetTokens()
+					}
+					return JOINING, Tokens{1, 2, 3, 4, 5}
+				},
+			}
+
+			persistencyDelegate := NewTokensPersistencyDelegate(tokensFile.Name(), ACTIVE, testData.discardOnMismatch, testDelegate, log.NewNopLogger())
+
+			ctx := context.Background()
+			cfg := prepareBasicLifecyclerConfig()
+			lifecycler, _, err := prepareBasicLifecyclerWithDelegate(cfg, persistencyDelegate)
+			require.NoError(t, err)
+
+			require.NoError(t, services.StartAndAwaitRunning(ctx, lifecycler))
+			assert.Equal(t, testData.expectedTokens, lifecycler.GetTokens())
+			require.NoError(t, services.StopAndAwaitTerminated(ctx, lifecycler))
+
+			// Ensure the tokens file now stores the metadata of this instance.
+			actualTokens, actualMeta, err := LoadTokensAndMetadataFromFile(tokensFile.Name())
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedTokens, actualTokens)
+			require.NotNil(t, actualMeta)
+			assert.Equal(t, cfg.ID, actualMeta.InstanceID)
+			assert.Equal(t, cfg.Zone, actualMeta.Zone)
+		})
+	}
+}
+
 func TestTokensPersistencyDelegate_ShouldHandleTheCaseTheInstanceIsAlreadyInTheRing(t *testing.T) {
 	storedTokens := Tokens{6, 7, 8, 9, 10}
 	differentTokens := Tokens{1, 2, 3, 4, 5}
@@ -162,7 +217,7 @@ func TestTokensPersistencyDelegate_ShouldHandleTheCaseTheInstanceIsAlreadyInTheR
 				},
 			}
 
-			persistencyDelegate := NewTokensPersistencyDelegate(tokensFile.Name(), ACTIVE, testDelegate, log.NewNopLogger())
+			persistencyDelegate := NewTokensPersistencyDelegate(tokensFile.Name(), ACTIVE, true, testDelegate, log.NewNopLogger())
 
 			ctx := context.Background()
 			cfg := prepareBasicLifecyclerConfig()
@@ -208,7 +263,7 @@ func TestDelegatesChain(t *testing.T) {
 		},
 	}
 
-	chain = NewTokensPersistencyDelegate(tokensFile.Name(), ACTIVE, chain, log.NewNopLogger())
+	chain = NewTokensPersistencyDelegate(tokensFile.Name(), ACTIVE, true, chain, log.NewNopLogger())
 	chain = NewLeaveOnStoppingDelegate(chain, log.NewNopLogger())
 	chain = NewAutoForgetDelegate(time.Minute, chain, log.NewNopLogger())
 
@@ -0,0 +1,180 @@
+package ring
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/log"
+)
+
+var errRingNotEmpty = errors.New("the ring is not empty, set force=true to overwrite it")
+
+// RingExport is the portable representation of a ring descriptor, used to bootstrap the
+// ring of another cluster with the same tokens.
+type RingExport struct {
+	Instances []ExportedInstance `json:"instances"`
+}
+
+// ExportedInstance is an instance of a RingExport.
+type ExportedInstance struct {
+	ID                  string   `json:"id"`
+	Addr                string   `json:"addr"`
+	Zone                string   `json:"zone,omitempty"`
+	State               string   `json:"state"`
+	Tokens              []uint32 `json:"tokens"`
+	RegisteredTimestamp int64    `json:"registered_timestamp,omitempty"`
+}
+
+// RingImportRequest is the body of a ring import request.
+type RingImportRequest struct {
+	Ring RingExport `json:"ring"`
+
+	// AddressMapping maps the addresses of the exported instances to the addresses of
+	// the instances of this cluster. The addresses which aren't mapped are kept as is.
+	AddressMapping map[string]string `json:"address_mapping"`
+}
+
+// ExportDesc returns the portable representation of the ring descriptor, sorted by instance ID.
+func ExportDesc(d *Desc) RingExport {
+	export := RingExport{Instances: make([]ExportedInstance, 0, len(d.GetIngesters()))}
+	for id, instance := range d.GetIngesters() {
+		export.Instances = append(export.Instances, ExportedInstance{
+			ID:                  id,
+			Addr:                instance.Addr,
+			Zone:                instance.Zone,
+			State:               instance.State.String(),
+			Tokens:              instance.Tokens,
+			RegisteredTimestamp: instance.RegisteredTimestamp,
+		})
+	}
+
+	sort.Slice(export.Instances, func(i, j int) bool {
+		return export.Instances[i].ID < export.Instances[j].ID
+	})
+	return export
+}
+
+// ImportDesc builds the ring descriptor of the export, remapping the addresses of the instances
+// with the mapping. The instances get no heartbeat timestamp, so that they're unhealthy until
+// they join the ring.
+func ImportDesc(export RingExport, mapping map[string]string) (*Desc, error) {
+	d := NewDesc()
+	addrs := map[string]string{}
+	owners := map[uint32]string{}
+
+	for _, instance := range export.Instances {
+		if instance.ID == "" {
+			return nil, errors.New("instance with empty ID")
+		}
+		if _, ok := d.Ingesters[instance.ID]; ok {
+			return nil, fmt.Errorf("duplicate instance %s", instance.ID)
+		}
+
+		addr := instance.Addr
+		if mapped, ok := mapping[addr]; ok {
+			addr = mapped
+		}
+		if addr == "" {
+			return nil, fmt.Errorf("instance %s has an empty address", instance.ID)
+		}
+		if other, ok := addrs[addr]; ok {
+			return nil, fmt.Errorf("instances %s and %s have the same address %s", other, instance.ID, addr)
+		}
+		addrs[addr] = instance.ID
+
+		state, ok := InstanceState_value[instance.State]
+		if !ok {
+			return nil, fmt.Errorf("instance %s has an invalid state %q", instance.ID, instance.State)
+		}
+
+		for _, token := range instance.Tokens {
+			if other, ok := owners[token]; ok {
+				return nil, fmt.Errorf("token %d is owned by both instances %s and %s", token, other, instance.ID)
+			}
+			owners[token] = instance.ID
+		}
+
+		tokens := append([]uint32(nil), instance.Tokens...)
+		sort.Sort(Tokens(tokens))
+
+		d.Ingesters[instance.ID] = InstanceDesc{
+			Addr:                addr,
+			Zone:                instance.Zone,
+			State:               InstanceState(state),
+			Tokens:              tokens,
+			RegisteredTimestamp: instance.RegisteredTimestamp,
+		}
+	}
+
+	return d, nil
+}
+
+// ExportHandler writes the portable representation of the ring stored in the KV store.
+func (r *Ring) ExportHandler(w http.ResponseWriter, req *http.Request) {
+	desc, err := r.KVClient.Get(req.Context(), r.key)
+	if err != nil {
+		level.Error(log.WithContext(req.Context(), log.Logger)).Log("msg", "error reading the ring", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	util.WriteJSONResponse(w, ExportDesc(GetOrCreateRingDesc(desc)))
+}
+
+// ImportHandler seeds the ring stored in the KV store with the ring of the RingImportRequest
+// of the request body. It refuses to overwrite a non-empty ring, unless the force parameter is
+// set to true.
+func (r *Ring) ImportHandler(w http.ResponseWriter, req *http.Request) {
+	logger := log.WithContext(req.Context(), log.Logger)
+
+	force := false
+	if f := req.URL.Query().Get("force"); f != "" {
+		var err error
+		if force, err = strconv.ParseBool(f); err != nil {
+			http.Error(w, fmt.Sprintf("invalid force parameter: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var importReq RingImportRequest
+	if err := json.NewDecoder(req.Body).Decode(&importReq); err != nil {
+		http.Error(w, fmt.Sprintf("invalid ring import request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	desc, err := ImportDesc(importReq.Ring, importReq.AddressMapping)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid ring import request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := r.importDesc(req.Context(), desc, force); err != nil {
+		if errors.Is(err, errRingNotEmpty) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		level.Error(logger).Log("msg", "error importing the ring", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	level.Info(logger).Log("msg", "ring imported", "key", r.key, "instances", len(desc.Ingesters), "forced", force)
+	util.WriteJSONResponse(w, ExportDesc(desc))
+}
+
+func (r *Ring) importDesc(ctx context.Context, desc *Desc, force bool) error {
+	return r.KVClient.CAS(ctx, r.key, func(in interface{}) (out interface{}, retry bool, err error) {
+		if in != nil && len(in.(*Desc).GetIngesters()) > 0 && !force {
+			return nil, false, errRingNotEmpty
+		}
+		return desc, true, nil
+	})
+}
@@ -0,0 +1,138 @@
+package ring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ring/kv/consul"
+)
+
+func TestImportDesc(t *testing.T) {
+	export := RingExport{Instances: []ExportedInstance{
+		{ID: "ingester-1", Addr: "10.0.0.1:9095", Zone: "zone-a", State: "ACTIVE", Tokens: []uint32{30, 10}, RegisteredTimestamp: 100},
+		{ID: "ingester-2", Addr: "10.0.0.2:9095", Zone: "zone-b", State: "LEAVING", Tokens: []uint32{20}},
+	}}
+
+	t.Run("should remap the addresses", func(t *testing.T) {
+		d, err := ImportDesc(export, map[string]string{"10.0.0.1:9095": "10.1.0.1:9095"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]InstanceDesc{
+			"ingester-1": {Addr: "10.1.0.1:9095", Zone: "zone-a", State: ACTIVE, Tokens: []uint32{10, 30}, RegisteredTimestamp: 100},
+			"ingester-2": {Addr: "10.0.0.2:9095", Zone: "zone-b", State: LEAVING, Tokens: []uint32{20}},
+		}, d.Ingesters)
+
+		// The export of the imported ring is the same, except for the remapped addresses.
+		reexported := ExportDesc(d)
+		require.Len(t, reexported.Instances, 2)
+		assert.Equal(t, "10.1.0.1:9095", reexported.Instances[0].Addr)
+		assert.Equal(t, export.Instances[1], reexported.Instances[1])
+	})
+
+	for name, tc := range map[string]struct {
+		export  RingExport
+		mapping map[string]string
+		err     string
+	}{
+		"duplicate tokens": {
+			export: RingExport{Instances: []ExportedInstance{
+				{ID: "ingester-1", Addr: "10.0.0.1:9095", State: "ACTIVE", Tokens: []uint32{10, 20}},
+				{ID: "ingester-2", Addr: "10.0.0.2:9095", State: "ACTIVE", Tokens: []uint32{20, 30}},
+			}},
+			err: "token 20 is owned by both instances ingester-1 and ingester-2",
+		},
+		"duplicate addresses after remapping": {
+			export:  export,
+			mapping: map[string]string{"10.0.0.1:9095": "10.1.0.1:9095", "10.0.0.2:9095": "10.1.0.1:9095"},
+			err:     "instances ingester-1 and ingester-2 have the same address 10.1.0.1:9095",
+		},
+		"duplicate instances": {
+			export: RingExport{Instances: []ExportedInstance{
+				{ID: "ingester-1", Addr: "10.0.0.1:9095", State: "ACTIVE"},
+				{ID: "ingester-1", Addr: "10.0.0.2:9095", State: "ACTIVE"},
+			}},
+			err: "duplicate instance ingester-1",
+		},
+		"invalid state": {
+			export: RingExport{Instances: []ExportedInstance{
+				{ID: "ingester-1", Addr: "10.0.0.1:9095", State: "UNKNOWN"},
+			}},
+			err: `instance ingester-1 has an invalid state "UNKNOWN"`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ImportDesc(tc.export, tc.mapping)
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestRing_ExportAndImportHandlers(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{HeartbeatTimeout: time.Minute, ReplicationFactor: 1}
+
+	// Build the ring of the primary cluster.
+	primary, err := NewWithStoreClientAndStrategy(cfg, "ingester", IngesterRingKey, consul.NewInMemoryClient(GetCodec()), NewDefaultReplicationStrategy())
+	require.NoError(t, err)
+
+	d := NewDesc()
+	d.AddIngester("ingester-1", "10.0.0.1:9095", "", []uint32{10, 30}, ACTIVE, time.Unix(100, 0))
+	d.AddIngester("ingester-2", "10.0.0.2:9095", "", []uint32{20, 40}, ACTIVE, time.Unix(100, 0))
+	require.NoError(t, primary.KVClient.CAS(ctx, IngesterRingKey, func(interface{}) (interface{}, bool, error) {
+		return d, true, nil
+	}))
+
+	w := httptest.NewRecorder()
+	primary.ExportHandler(w, httptest.NewRequest(http.MethodGet, "/ring/export", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var export RingExport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Equal(t, ExportDesc(d), export)
+
+	body, err := json.Marshal(RingImportRequest{
+		Ring:           export,
+		AddressMapping: map[string]string{"10.0.0.1:9095": "10.1.0.1:9095", "10.0.0.2:9095": "10.1.0.2:9095"},
+	})
+	require.NoError(t, err)
+
+	// Import it in the ring of the standby cluster.
+	standby, err := NewWithStoreClientAndStrategy(cfg, "ingester", IngesterRingKey, consul.NewInMemoryClient(GetCodec()), NewDefaultReplicationStrategy())
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	standby.ImportHandler(w, httptest.NewRequest(http.MethodPost, "/ring/import", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	imported, err := standby.KVClient.Get(ctx, IngesterRingKey)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]InstanceDesc{
+		"ingester-1": {Addr: "10.1.0.1:9095", State: ACTIVE, Tokens: []uint32{10, 30}, RegisteredTimestamp: 100},
+		"ingester-2": {Addr: "10.1.0.2:9095", State: ACTIVE, Tokens: []uint32{20, 40}, RegisteredTimestamp: 100},
+	}, imported.(*Desc).Ingesters)
+
+	// The import refuses to overwrite the non-empty ring, unless forced.
+	w = httptest.NewRecorder()
+	standby.ImportHandler(w, httptest.NewRequest(http.MethodPost, "/ring/import", strings.NewReader(`{"ring": {"instances": []}}`)))
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	standby.ImportHandler(w, httptest.NewRequest(http.MethodPost, "/ring/import?force=true", strings.NewReader(`{"ring": {"instances": []}}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	imported, err = standby.KVClient.Get(ctx, IngesterRingKey)
+	require.NoError(t, err)
+	assert.Empty(t, imported.(*Desc).Ingesters)
+
+	// Invalid requests are rejected.
+	w = httptest.NewRecorder()
+	standby.ImportHandler(w, httptest.NewRequest(http.MethodPost, "/ring/import", strings.NewReader(`{"ring": {"instances": [{"id": "ingester-1", "addr": "10.0.0.1:9095", "state": "ACTIVE", "tokens": [1, 1]}]}}`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,392 @@
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+
+	"github.com/cortexproject/cortex/pkg/ring/kv/codec"
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+)
+
+const (
+	// indexSize is the size of the modify index prefixed to every stored value.
+	indexSize = 8
+
+	maxCASRetries = 10
+)
+
+var (
+	// How long to wait for the file lock when opening the database. Overridden in tests.
+	openTimeout = 5 * time.Second
+
+	kvBucket = []byte("kv")
+
+	// ErrLocked is returned when the database file is already opened by another process.
+	ErrLocked = errors.New("the embedded KV store file is locked by another process: the embedded KV store supports a single Cortex process only")
+
+	// The same database file can't be opened twice within the same process (the file lock
+	// would never be released), so we share a single database per path.
+	databasesMtx sync.Mutex
+	databases    = map[string]*database{}
+)
+
+// Config for a new embedded.Client.
+type Config struct {
+	Path string `yaml:"path"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet.
+func (cfg *Config) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix string) {
+	f.StringVar(&cfg.Path, prefix+"embedded.path", "./data/kv.db", "Path of the file where the embedded KV store persists its data. The embedded KV store can only be used by a single Cortex process running all the components (-target=all).")
+}
+
+// Client implements kv.Client on top of an embedded BoltDB database. It's only
+// suitable for a single process, because watches are notified through an
+// in-process notification bus.
+type Client struct {
+	codec  codec.Codec
+	db     *database
+	closed sync.Once
+}
+
+// database is a BoltDB database shared by all clients opened on the same path.
+type database struct {
+	path string
+	db   *bbolt.DB
+	refs int
+
+	// changed is closed (and replaced) whenever a write is committed,
+	// in order to wake up all watchers.
+	changedMtx sync.Mutex
+	changed    chan struct{}
+}
+
+// NewClient makes a new Client. All clients created with the same path share the same
+// underlying database, so that components running in the same process see each other.
+func NewClient(cfg Config, codec codec.Codec) (*Client, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("the embedded KV store path is required")
+	}
+
+	path, err := filepath.Abs(cfg.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve embedded KV store path")
+	}
+
+	databasesMtx.Lock()
+	defer databasesMtx.Unlock()
+
+	db, ok := databases[path]
+	if !ok {
+		if db, err = openDatabase(path); err != nil {
+			return nil, err
+		}
+		databases[path] = db
+	}
+
+	db.refs++
+	return &Client{codec: codec, db: db}, nil
+}
+
+func openDatabase(path string) (*database, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, errors.Wrap(err, "create embedded KV store directory")
+	}
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: openTimeout})
+	if errors.Is(err, bbolt.ErrTimeout) {
+		return nil, ErrLocked
+	} else if err != nil {
+		return nil, errors.Wrap(err, "open embedded KV store")
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(kvBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "initialise embedded KV store")
+	}
+
+	return &database{
+		path:    path,
+		db:      db,
+		changed: make(chan struct{}),
+	}, nil
+}
+
+// Close releases the client. The underlying database is closed once all
+// clients sharing it have been closed.
+func (c *Client) Close() error {
+	var err error
+	c.closed.Do(func() {
+		databasesMtx.Lock()
+		defer databasesMtx.Unlock()
+
+		c.db.refs--
+		if c.db.refs > 0 {
+			return
+		}
+
+		delete(databases, c.db.path)
+		err = c.db.db.Close()
+	})
+	return err
+}
+
+// changes returns a channel which is closed on the next committed write.
+func (d *database) changes() <-chan struct{} {
+	d.changedMtx.Lock()
+	defer d.changedMtx.Unlock()
+	return d.changed
+}
+
+func (d *database) notify() {
+	d.changedMtx.Lock()
+	defer d.changedMtx.Unlock()
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
+
+// get returns the raw value and modify index of the key, or nil if the key doesn't exist.
+func (d *database) get(key string) (value []byte, index uint64, err error) {
+	err = d.db.View(func(tx *bbolt.Tx) error {
+		value, index = decodeEntry(tx.Bucket(kvBucket).Get([]byte(key)))
+		return nil
+	})
+	return
+}
+
+func encodeEntry(index uint64, value []byte) []byte {
+	out := make([]byte, indexSize+len(value))
+	binary.BigEndian.PutUint64(out, index)
+	copy(out[indexSize:], value)
+	return out
+}
+
+func decodeEntry(entry []byte) ([]byte, uint64) {
+	if len(entry) < indexSize {
+		return nil, 0
+	}
+
+	// Values returned by BoltDB are only valid within the transaction.
+	value := make([]byte, len(entry)-indexSize)
+	copy(value, entry[indexSize:])
+	return value, binary.BigEndian.Uint64(entry)
+}
+
+// List implements kv.Client.
+func (c *Client) List(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := c.db.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(kvBucket).Cursor()
+		for k, _ := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = cursor.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// Get implements kv.Client.
+func (c *Client) Get(_ context.Context, key string) (interface{}, error) {
+	value, _, err := c.db.get(key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return c.codec.Decode(value)
+}
+
+// Delete implements kv.Client.
+func (c *Client) Delete(_ context.Context, key string) error {
+	err := c.db.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(kvBucket).Delete([]byte(key))
+	})
+	if err == nil {
+		c.db.notify()
+	}
+	return err
+}
+
+// CAS implements kv.Client.
+func (c *Client) CAS(ctx context.Context, key string, f func(in interface{}) (out interface{}, retry bool, err error)) error {
+	var lastErr error
+
+	for i := 0; i < maxCASRetries; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		value, index, err := c.db.get(key)
+		if err != nil {
+			level.Error(util_log.Logger).Log("msg", "error getting key", "key", key, "err", err)
+			lastErr = err
+			continue
+		}
+
+		var intermediate interface{}
+		if value != nil {
+			if intermediate, err = c.codec.Decode(value); err != nil {
+				level.Error(util_log.Logger).Log("msg", "error decoding key", "key", key, "err", err)
+				lastErr = err
+				continue
+			}
+		}
+
+		var retry bool
+		intermediate, retry, err = f(intermediate)
+		if err != nil {
+			if !retry {
+				return err
+			}
+			lastErr = err
+			continue
+		}
+
+		// Callback returning nil means it doesn't want to CAS anymore.
+		if intermediate == nil {
+			return nil
+		}
+
+		buf, err := c.codec.Encode(intermediate)
+		if err != nil {
+			level.Error(util_log.Logger).Log("msg", "error serialising value", "key", key, "err", err)
+			lastErr = err
+			continue
+		}
+
+		swapped := false
+		err = c.db.db.Update(func(tx *bbolt.Tx) error {
+			bucket := tx.Bucket(kvBucket)
+			if _, current := decodeEntry(bucket.Get([]byte(key))); current != index {
+				return nil
+			}
+
+			next, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			swapped = true
+			return bucket.Put([]byte(key), encodeEntry(next, buf))
+		})
+		if err != nil {
+			level.Error(util_log.Logger).Log("msg", "error CASing", "key", key, "err", err)
+			lastErr = err
+			continue
+		}
+		if !swapped {
+			level.Debug(util_log.Logger).Log("msg", "failed to CAS, modify index did not match", "key", key, "index", index)
+			continue
+		}
+
+		c.db.notify()
+		return nil
+	}
+
+	if lastErr != nil {
+		return lastErr
+	}
+	return fmt.Errorf("failed to CAS %s", key)
+}
+
+// WatchKey implements kv.Client. The callback is invoked with the current value
+// (if any) straight away, and then every time the value changes.
+func (c *Client) WatchKey(ctx context.Context, key string, f func(interface{}) bool) {
+	var lastIndex uint64
+
+	for {
+		// Get the notification channel before reading, so that we can't miss a change.
+		changed := c.db.changes()
+
+		value, index, err := c.db.get(key)
+		if err != nil {
+			level.Error(util_log.Logger).Log("msg", "error getting key", "key", key, "err", err)
+		} else if value != nil && index != lastIndex {
+			lastIndex = index
+
+			out, err := c.codec.Decode(value)
+			if err != nil {
+				level.Error(util_log.Logger).Log("msg", "error decoding key", "key", key, "err", err)
+			} else if !f(out) {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// WatchPrefix implements kv.Client. The callback is invoked for every key currently
+// stored under the prefix straight away, and then every time one of them changes.
+// Deletions are not notified.
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, f func(string, interface{}) bool) {
+	var lastIndex uint64
+
+	type entry struct {
+		key   string
+		value []byte
+	}
+
+	for {
+		changed := c.db.changes()
+
+		var (
+			updated  []entry
+			maxIndex = lastIndex
+		)
+		err := c.db.db.View(func(tx *bbolt.Tx) error {
+			cursor := tx.Bucket(kvBucket).Cursor()
+			for k, v := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = cursor.Next() {
+				value, index := decodeEntry(v)
+				if index <= lastIndex {
+					continue
+				}
+				if index > maxIndex {
+					maxIndex = index
+				}
+				updated = append(updated, entry{key: string(k), value: value})
+			}
+			return nil
+		})
+		if err != nil {
+			level.Error(util_log.Logger).Log("msg", "error listing prefix", "prefix", prefix, "err", err)
+		} else {
+			lastIndex = maxIndex
+
+			for _, e := range updated {
+				out, err := c.codec.Decode(e.value)
+				if err != nil {
+					level.Error(util_log.Logger).Log("msg", "error decoding key", "key", e.key, "err", err)
+					continue
+				}
+
+				if !f(e.key, out) {
+					return
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package embedded
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+
+	"github.com/cortexproject/cortex/pkg/ring/kv/codec"
+)
+
+func TestClient_ShouldPersistDataAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{Path: filepath.Join(t.TempDir(), "kv.db")}
+
+	client, err := NewClient(cfg, codec.String{})
+	require.NoError(t, err)
+
+	require.NoError(t, client.CAS(ctx, "ring", func(in interface{}) (interface{}, bool, error) {
+		return "first", true, nil
+	}))
+	require.NoError(t, client.CAS(ctx, "other", func(in interface{}) (interface{}, bool, error) {
+		return "second", true, nil
+	}))
+	require.NoError(t, client.Close())
+
+	// Re-open the database, like after a restart of the single binary.
+	client, err = NewClient(cfg, codec.String{})
+	require.NoError(t, err)
+	defer client.Close() //nolint:errcheck
+
+	value, err := client.Get(ctx, "ring")
+	require.NoError(t, err)
+	assert.Equal(t, "first", value)
+
+	keys, err := client.List(ctx, "")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"ring", "other"}, keys)
+
+	// The CAS must see the value persisted before the restart.
+	require.NoError(t, client.CAS(ctx, "ring", func(in interface{}) (interface{}, bool, error) {
+		assert.Equal(t, "first", in)
+		return "updated", true, nil
+	}))
+
+	value, err = client.Get(ctx, "ring")
+	require.NoError(t, err)
+	assert.Equal(t, "updated", value)
+}
+
+func TestClient_WatchAfterRestart(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfg := Config{Path: filepath.Join(t.TempDir(), "kv.db")}
+
+	client, err := NewClient(cfg, codec.String{})
+	require.NoError(t, err)
+	require.NoError(t, client.CAS(ctx, "prefix/a", func(in interface{}) (interface{}, bool, error) {
+		return "a-1", true, nil
+	}))
+	require.NoError(t, client.Close())
+
+	client, err = NewClient(cfg, codec.String{})
+	require.NoError(t, err)
+	defer client.Close() //nolint:errcheck
+
+	keyValues := make(chan interface{}, 10)
+	prefixValues := make(chan string, 10)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		client.WatchKey(ctx, "prefix/a", func(value interface{}) bool {
+			keyValues <- value
+			return value != "a-2"
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		client.WatchPrefix(ctx, "prefix/", func(key string, value interface{}) bool {
+			prefixValues <- fmt.Sprintf("%s=%s", key, value)
+			return value != "b-1"
+		})
+	}()
+
+	// Watchers must be notified of the value persisted before the restart straight away.
+	assert.Equal(t, "a-1", <-keyValues)
+	assert.Equal(t, "prefix/a=a-1", <-prefixValues)
+
+	require.NoError(t, client.CAS(ctx, "prefix/a", func(in interface{}) (interface{}, bool, error) {
+		return "a-2", true, nil
+	}))
+	assert.Equal(t, "a-2", <-keyValues)
+	assert.Equal(t, "prefix/a=a-2", <-prefixValues)
+
+	require.NoError(t, client.CAS(ctx, "prefix/b", func(in interface{}) (interface{}, bool, error) {
+		return "b-1", true, nil
+	}))
+	assert.Equal(t, "prefix/b=b-1", <-prefixValues)
+
+	wg.Wait()
+	require.NoError(t, ctx.Err())
+}
+
+func TestClient_ShouldShareTheDatabaseWithinTheSameProcess(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{Path: filepath.Join(t.TempDir(), "kv.db")}
+
+	first, err := NewClient(cfg, codec.String{})
+	require.NoError(t, err)
+	second, err := NewClient(cfg, codec.String{})
+	require.NoError(t, err)
+
+	require.NoError(t, first.CAS(ctx, "key", func(in interface{}) (interface{}, bool, error) {
+		return "value", true, nil
+	}))
+
+	value, err := second.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+
+	// Closing one client must not close the database for the other one.
+	require.NoError(t, first.Close())
+	require.NoError(t, first.Close())
+
+	value, err = second.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+	require.NoError(t, second.Close())
+}
+
+func TestClient_ConcurrentCAS(t *testing.T) {
+	const (
+		workers    = 10
+		increments = 20
+	)
+
+	ctx := context.Background()
+	client, err := NewClient(Config{Path: filepath.Join(t.TempDir(), "kv.db")}, codec.String{})
+	require.NoError(t, err)
+	defer client.Close() //nolint:errcheck
+
+	increment := func(in interface{}) (interface{}, bool, error) {
+		value := 0
+		if in != nil {
+			_, _ = fmt.Sscanf(in.(string), "%d", &value)
+		}
+		return fmt.Sprintf("%d", value+1), true, nil
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < increments; i++ {
+				// Conflicts are retried up to maxCASRetries times, so we retry
+				// here too in order to get a deterministic final value.
+				for client.CAS(ctx, "counter", increment) != nil {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := client.Get(ctx, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%d", workers*increments), value)
+}
+
+func TestClient_CASShouldNotOverwriteConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	client, err := NewClient(Config{Path: filepath.Join(t.TempDir(), "kv.db")}, codec.String{})
+	require.NoError(t, err)
+	defer client.Close() //nolint:errcheck
+
+	attempts := 0
+	require.NoError(t, client.CAS(ctx, "key", func(in interface{}) (interface{}, bool, error) {
+		attempts++
+		if attempts == 1 {
+			// Simulate a concurrent write between the read and the swap.
+			require.NoError(t, client.CAS(ctx, "key", func(in interface{}) (interface{}, bool, error) {
+				return "concurrent", true, nil
+			}))
+			return "stale", true, nil
+		}
+
+		assert.Equal(t, "concurrent", in)
+		return "final", true, nil
+	}))
+
+	assert.Equal(t, 2, attempts)
+	value, err := client.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "final", value)
+}
+
+func TestClient_ShouldFailIfTheDatabaseIsLockedByAnotherProcess(t *testing.T) {
+	prev := openTimeout
+	openTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { openTimeout = prev })
+
+	path := filepath.Join(t.TempDir(), "kv.db")
+
+	// Open the file without going through the shared databases, like another process would do.
+	other, err := bbolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+	defer other.Close() //nolint:errcheck
+
+	_, err = NewClient(Config{Path: path}, codec.String{})
+	assert.Equal(t, ErrLocked, err)
+}
+
+func TestClient_ShouldFailWithoutPath(t *testing.T) {
+	_, err := NewClient(Config{}, codec.String{})
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"sync"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/cortexproject/cortex/pkg/ring/kv/codec"
 	"github.com/cortexproject/cortex/pkg/ring/kv/consul"
+	"github.com/cortexproject/cortex/pkg/ring/kv/embedded"
 	"github.com/cortexproject/cortex/pkg/ring/kv/etcd"
 )
 
@@ -28,6 +30,10 @@ func withFixtures(t *testing.T, f func(*testing.T, Client)) {
 		{"etcd", func() (Client, io.Closer, error) {
 			return etcd.Mock(codec.String{})
 		}},
+		{"embedded", func() (Client, io.Closer, error) {
+			client, err := embedded.NewClient(embedded.Config{Path: filepath.Join(t.TempDir(), "kv.db")}, codec.String{})
+			return client, client, err
+		}},
 	} {
 		t.Run(fixture.name, func(t *testing.T) {
 			client, closer, err := fixture.factory()
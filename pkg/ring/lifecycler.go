@@ -48,16 +48,17 @@ type LifecyclerConfig struct {
 	RingConfig Config `yaml:"ring"`
 
 	// Config for the ingester lifecycle control
-	NumTokens            int           `yaml:"num_tokens"`
-	HeartbeatPeriod      time.Duration `yaml:"heartbeat_period"`
-	ObservePeriod        time.Duration `yaml:"observe_period"`
-	JoinAfter            time.Duration `yaml:"join_after"`
-	MinReadyDuration     time.Duration `yaml:"min_ready_duration"`
-	InfNames             []string      `yaml:"interface_names"`
-	FinalSleep           time.Duration `yaml:"final_sleep"`
-	TokensFilePath       string        `yaml:"tokens_file_path"`
-	Zone                 string        `yaml:"availability_zone"`
-	UnregisterOnShutdown bool          `yaml:"unregister_on_shutdown"`
+	NumTokens                   int           `yaml:"num_tokens"`
+	HeartbeatPeriod             time.Duration `yaml:"heartbeat_period"`
+	ObservePeriod               time.Duration `yaml:"observe_period"`
+	JoinAfter                   time.Duration `yaml:"join_after"`
+	MinReadyDuration            time.Duration `yaml:"min_ready_duration"`
+	InfNames                    []string      `yaml:"interface_names"`
+	FinalSleep                  time.Duration `yaml:"final_sleep"`
+	TokensFilePath              string        `yaml:"tokens_file_path"`
+	TokensFileDiscardOnMismatch bool          `yaml:"tokens_file_discard_on_mismatch"`
+	Zone                        string        `yaml:"availability_zone"`
+	UnregisterOnShutdown        bool          `yaml:"unregister_on_shutdown"`
 
 	// For testing, you can override the address and ID of this ingester
 	Addr string `yaml:"address" doc:"hidden"`
@@ -90,6 +91,7 @@ func (cfg *LifecyclerConfig) RegisterFlagsWithPrefix(prefix string, f *flag.Flag
 	f.DurationVar(&cfg.MinReadyDuration, prefix+"min-ready-duration", 1*time.Minute, "Minimum duration to wait before becoming ready. This is to work around race conditions with ingesters exiting and updating the ring.")
 	f.DurationVar(&cfg.FinalSleep, prefix+"final-sleep", 30*time.Second, "Duration to sleep for before exiting, to ensure metrics are scraped.")
 	f.StringVar(&cfg.TokensFilePath, prefix+"tokens-file-path", "", "File path where tokens are stored. If empty, tokens are not stored at shutdown and restored at startup.")
+	f.BoolVar(&cfg.TokensFileDiscardOnMismatch, prefix+"tokens-file-discard-on-mismatch", false, "True to discard the tokens loaded from the tokens file, and generate new ones, if the file has been stored by an instance with a different ID or in a different availability zone.")
 
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -300,7 +302,7 @@ func (i *Lifecycler) setTokens(tokens Tokens) {
 
 	i.tokens = tokens
 	if i.cfg.TokensFilePath != "" {
-		if err := i.tokens.StoreToFile(i.cfg.TokensFilePath); err != nil {
+		if err := i.tokens.StoreToFileWithMetadata(i.cfg.TokensFilePath, newTokensFileMetadata(i.ID, i.Zone, i.registeredAt)); err != nil {
 			level.Error(log.Logger).Log("msg", "error storing tokens to disk", "path", i.cfg.TokensFilePath, "err", err)
 		}
 	}
@@ -522,7 +524,7 @@ func (i *Lifecycler) initRing(ctx context.Context) error {
 	)
 
 	if i.cfg.TokensFilePath != "" {
-		tokensFromFile, err = LoadTokensFromFile(i.cfg.TokensFilePath)
+		tokensFromFile, err = loadTokensFromFileForInstance(i.cfg.TokensFilePath, i.ID, i.Zone, i.cfg.TokensFileDiscardOnMismatch, log.Logger)
 		if err != nil && !os.IsNotExist(err) {
 			level.Error(log.Logger).Log("msg", "error loading tokens from file", "err", err)
 		}
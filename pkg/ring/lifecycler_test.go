@@ -494,6 +494,108 @@ func TestTokensOnDisk(t *testing.T) {
 	}
 }
 
+func TestTokensOnDisk_DiscardOnMismatch(t *testing.T) {
+	tests := map[string]struct {
+		discardOnMismatch bool
+		expectSameTokens  bool
+	}{
+		"should load the tokens stored by another instance if discarding is disabled": {
+			discardOnMismatch: false,
+			expectSameTokens:  true,
+		},
+		"should discard the tokens stored by another instance if discarding is enabled": {
+			discardOnMismatch: true,
+			expectSameTokens:  false,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			var ringConfig Config
+			flagext.DefaultValues(&ringConfig)
+			ringConfig.KVStore.Mock = consul.NewInMemoryClient(GetCodec())
+
+			r, err := New(ringConfig, "ingester", IngesterRingKey, nil)
+			require.NoError(t, err)
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), r))
+			defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+			tokenDir, err := ioutil.TempDir(os.TempDir(), "tokens_on_disk")
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, os.RemoveAll(tokenDir))
+			}()
+
+			lifecyclerConfig := testLifecyclerConfig(ringConfig, "ing1")
+			lifecyclerConfig.NumTokens = 512
+			lifecyclerConfig.TokensFilePath = tokenDir + "/tokens"
+			lifecyclerConfig.TokensFileDiscardOnMismatch = testData.discardOnMismatch
+
+			// Start first ingester.
+			l1, err := NewLifecycler(lifecyclerConfig, &noopFlushTransferer{}, "ingester", IngesterRingKey, true, nil)
+			require.NoError(t, err)
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), l1))
+
+			// Check this ingester joined, is active, and has 512 token.
+			var expTokens []uint32
+			test.Poll(t, 1000*time.Millisecond, true, func() interface{} {
+				d, err := r.KVClient.Get(context.Background(), IngesterRingKey)
+				require.NoError(t, err)
+
+				desc, ok := d.(*Desc)
+				if ok {
+					expTokens = desc.Ingesters["ing1"].Tokens
+				}
+				return ok &&
+					len(desc.Ingesters) == 1 &&
+					desc.Ingesters["ing1"].State == ACTIVE &&
+					len(desc.Ingesters["ing1"].Tokens) == 512
+			})
+
+			require.NoError(t, services.StopAndAwaitTerminated(context.Background(), l1))
+
+			// The tokens file stores the instance metadata.
+			_, meta, err := LoadTokensAndMetadataFromFile(lifecyclerConfig.TokensFilePath)
+			require.NoError(t, err)
+			require.NotNil(t, meta)
+			assert.Equal(t, "ing1", meta.InstanceID)
+			assert.Equal(t, "zone1", meta.Zone)
+			assert.NotZero(t, meta.RegisteredTimestamp)
+
+			// Start new ingester at same token directory.
+			lifecyclerConfig.ID = "ing2"
+			l2, err := NewLifecycler(lifecyclerConfig, &noopFlushTransferer{}, "ingester", IngesterRingKey, true, nil)
+			require.NoError(t, err)
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), l2))
+			defer services.StopAndAwaitTerminated(context.Background(), l2) //nolint:errcheck
+
+			// Check this ingester joined, is active, and has 512 token.
+			var actTokens []uint32
+			test.Poll(t, 1000*time.Millisecond, true, func() interface{} {
+				d, err := r.KVClient.Get(context.Background(), IngesterRingKey)
+				require.NoError(t, err)
+				desc, ok := d.(*Desc)
+				if ok {
+					actTokens = desc.Ingesters["ing2"].Tokens
+				}
+				return ok &&
+					len(desc.Ingesters) == 1 &&
+					desc.Ingesters["ing2"].State == ACTIVE &&
+					len(desc.Ingesters["ing2"].Tokens) == 512
+			})
+
+			// Check whether the tokens have been loaded from file.
+			sort.Slice(expTokens, func(i, j int) bool { return expTokens[i] < expTokens[j] })
+			sort.Slice(actTokens, func(i, j int) bool { return actTokens[i] < actTokens[j] })
+			if testData.expectSameTokens {
+				require.Equal(t, expTokens, actTokens)
+			} else {
+				require.NotEqual(t, expTokens, actTokens)
+			}
+		})
+	}
+}
+
 // JoinInLeavingState ensures that if the lifecycler starts up and the ring already has it in a LEAVING state that it still is able to auto join
 func TestJoinInLeavingState(t *testing.T) {
 	var ringConfig Config
@@ -23,6 +23,18 @@ type ReplicationSet struct {
 // Do function f in parallel for all replicas in the set, erroring is we exceed
 // MaxErrors and returning early otherwise.
 func (r ReplicationSet) Do(ctx context.Context, delay time.Duration, f func(context.Context, *InstanceDesc) (interface{}, error)) ([]interface{}, error) {
+	results, _, err := r.do(ctx, delay, false, 0, f)
+	return results, err
+}
+
+// DoAndWaitAll is like Do, but once enough replicas succeeded it keeps waiting for the remaining
+// ones for up to maxWait, so that the results of all the replicas are returned whenever possible.
+// It also returns whether all the replicas succeeded.
+func (r ReplicationSet) DoAndWaitAll(ctx context.Context, maxWait time.Duration, f func(context.Context, *InstanceDesc) (interface{}, error)) ([]interface{}, bool, error) {
+	return r.do(ctx, 0, true, maxWait, f)
+}
+
+func (r ReplicationSet) do(ctx context.Context, delay time.Duration, waitAll bool, maxWait time.Duration, f func(context.Context, *InstanceDesc) (interface{}, error)) ([]interface{}, bool, error) {
 	type instanceResult struct {
 		res      interface{}
 		err      error
@@ -68,14 +80,16 @@ func (r ReplicationSet) Do(ctx context.Context, delay time.Duration, f func(cont
 	}
 
 	results := make([]interface{}, 0, len(r.Instances))
+	received := 0
 
 	for !tracker.succeeded() {
 		select {
 		case res := <-ch:
+			received++
 			tracker.done(res.instance, res.err)
 			if res.err != nil {
 				if tracker.failed() {
-					return nil, res.err
+					return nil, false, res.err
 				}
 
 				// force one of the delayed requests to start
@@ -87,11 +101,31 @@ func (r ReplicationSet) Do(ctx context.Context, delay time.Duration, f func(cont
 			}
 
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return nil, false, ctx.Err()
+		}
+	}
+
+	if waitAll && received < len(r.Instances) {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+
+	wait:
+		for received < len(r.Instances) {
+			select {
+			case res := <-ch:
+				received++
+				if res.err == nil {
+					results = append(results, res.res)
+				}
+			case <-timer.C:
+				break wait
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			}
 		}
 	}
 
-	return results, nil
+	return results, len(results) == len(r.Instances), nil
 }
 
 // Includes returns whether the replication set includes the replica with the provided addr.
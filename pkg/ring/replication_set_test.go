@@ -241,3 +241,55 @@ func TestReplicationSet_Do(t *testing.T) {
 		})
 	}
 }
+
+func TestReplicationSet_DoAndWaitAll(t *testing.T) {
+	// The instance "slow" responds after the others.
+	slowFunction := func(slowDelay time.Duration, slowErr error) func(context.Context, *InstanceDesc) (interface{}, error) {
+		return func(ctx context.Context, desc *InstanceDesc) (interface{}, error) {
+			if desc.Addr != "slow" {
+				return 1, nil
+			}
+
+			select {
+			case <-time.After(slowDelay):
+				return 1, slowErr
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	tests := map[string]struct {
+		f           func(context.Context, *InstanceDesc) (interface{}, error)
+		want        []interface{}
+		expectedAll bool
+	}{
+		"should wait for the slow instance within the max wait": {
+			f:           slowFunction(50*time.Millisecond, nil),
+			want:        []interface{}{1, 1, 1},
+			expectedAll: true,
+		},
+		"should return the results of the quorum once the max wait has expired": {
+			f:    slowFunction(time.Second, nil),
+			want: []interface{}{1, 1},
+		},
+		"should return the results of the quorum if the slow instance fails": {
+			f:    slowFunction(50*time.Millisecond, errFailure),
+			want: []interface{}{1, 1},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			r := ReplicationSet{
+				Instances: []InstanceDesc{{Addr: "fast-1"}, {Addr: "fast-2"}, {Addr: "slow"}},
+				MaxErrors: 1,
+			}
+
+			got, all, err := r.DoAndWaitAll(context.Background(), 200*time.Millisecond, testData.f)
+			require.NoError(t, err)
+			assert.Equal(t, testData.want, got)
+			assert.Equal(t, testData.expectedAll, all)
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -67,6 +68,13 @@ type ReadRing interface {
 	// InstancesCount returns the number of instances in the ring.
 	InstancesCount() int
 
+	// CountHealthyInstances returns the number of instances whose heartbeat is not timed out,
+	// whatever their state, and the total number of instances they have been counted from.
+	// When zone-awareness is enabled, the zones with the lowest ratio of healthy instances
+	// are not counted, up to the number of zones which can be unavailable without losing
+	// the quorum.
+	CountHealthyInstances() (healthy, total int)
+
 	// ShuffleShard returns a subring for the provided identifier (eg. a tenant ID)
 	// and size (number of instances).
 	ShuffleShard(identifier string, size int) ReadRing
@@ -179,6 +187,9 @@ type Ring struct {
 	// When did a set of instances change the last time (instance changing state or heartbeat is ignored for this timestamp).
 	lastTopologyChange time.Time
 
+	// When did an instance leave the ring the last time.
+	lastInstanceDeparture time.Time
+
 	// List of zones for which there's at least 1 instance in the ring. This list is guaranteed
 	// to be sorted alphabetically.
 	ringZones []string
@@ -323,12 +334,34 @@ func (r *Ring) updateRingState(ringDesc *Desc) {
 	r.ringInstanceByToken = ringInstanceByToken
 	r.ringZones = ringZones
 	r.lastTopologyChange = now
+	if prevRing != nil && hasDepartedInstances(prevRing, ringDesc) {
+		r.lastInstanceDeparture = now
+	}
 	if r.shuffledSubringCache != nil {
 		// Invalidate all cached subrings.
 		r.shuffledSubringCache = make(map[subringCacheKey]*Ring)
 	}
 }
 
+// hasDepartedInstances returns whether an instance of the previous ring is missing from the next one.
+func hasDepartedInstances(prev, next *Desc) bool {
+	for id := range prev.Ingesters {
+		if _, ok := next.Ingesters[id]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LastInstanceDeparture returns when an instance left the ring the last time, or the zero time if
+// no instance left the ring since it has been watched.
+func (r *Ring) LastInstanceDeparture() time.Time {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.lastInstanceDeparture
+}
+
 // Get returns n (or more) instances which form the replicas for the given key.
 func (r *Ring) Get(key uint32, op Operation, bufDescs []InstanceDesc, bufHosts, bufZones []string) (ReplicationSet, error) {
 	r.mtx.RLock()
@@ -422,6 +455,59 @@ func (r *Ring) GetAllHealthy(op Operation) (ReplicationSet, error) {
 	}, nil
 }
 
+// CountHealthyInstances implements ReadRing.
+func (r *Ring) CountHealthyInstances() (healthy, total int) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if r.ringDesc == nil || len(r.ringDesc.Ingesters) == 0 {
+		return 0, 0
+	}
+
+	type zoneCount struct {
+		healthy, total int
+	}
+
+	now := time.Now()
+	countByZone := map[string]*zoneCount{}
+	for _, instance := range r.ringDesc.Ingesters {
+		c, ok := countByZone[instance.Zone]
+		if !ok {
+			c = &zoneCount{}
+			countByZone[instance.Zone] = c
+		}
+
+		c.total++
+		if r.IsHealthy(&instance, Reporting, now) {
+			c.healthy++
+		}
+	}
+
+	counts := make([]*zoneCount, 0, len(countByZone))
+	for _, c := range countByZone {
+		counts = append(counts, c)
+	}
+
+	if r.cfg.ZoneAwarenessEnabled {
+		// Skip the zones with the lowest ratio of healthy instances which can be unavailable
+		// without losing the quorum (eg. a zone being rolled out).
+		numReplicatedZones := util_math.Min(len(counts), r.cfg.ReplicationFactor)
+		maxUnavailableZones := numReplicatedZones / 2
+
+		sort.Slice(counts, func(i, j int) bool {
+			return counts[i].healthy*counts[j].total < counts[j].healthy*counts[i].total
+		})
+		counts = counts[maxUnavailableZones:]
+	}
+
+	for _, c := range counts {
+		healthy += c.healthy
+		total += c.total
+	}
+
+	return healthy, total
+}
+
 // GetReplicationSetForOperation implements ReadRing.
 func (r *Ring) GetReplicationSetForOperation(op Operation) (ReplicationSet, error) {
 	r.mtx.RLock()
@@ -389,6 +389,78 @@ func TestRing_GetAllHealthy(t *testing.T) {
 	}
 }
 
+func TestRing_CountHealthyInstances(t *testing.T) {
+	const heartbeatTimeout = time.Minute
+	now := time.Now()
+
+	tests := map[string]struct {
+		ringInstances        map[string]InstanceDesc
+		zoneAwarenessEnabled bool
+		expectedHealthy      int
+		expectedTotal        int
+	}{
+		"should return zero on empty ring": {
+			ringInstances: nil,
+		},
+		"should count the instances with an healthy heartbeat whatever their state": {
+			ringInstances: map[string]InstanceDesc{
+				"instance-1": {Addr: "127.0.0.1", State: ACTIVE, Timestamp: now.Unix()},
+				"instance-2": {Addr: "127.0.0.2", State: PENDING, Timestamp: now.Add(-10 * time.Second).Unix()},
+				"instance-3": {Addr: "127.0.0.3", State: JOINING, Timestamp: now.Add(-20 * time.Second).Unix()},
+				"instance-4": {Addr: "127.0.0.4", State: LEAVING, Timestamp: now.Add(-30 * time.Second).Unix()},
+				"instance-5": {Addr: "127.0.0.5", State: ACTIVE, Timestamp: now.Add(-2 * time.Minute).Unix()},
+			},
+			expectedHealthy: 4,
+			expectedTotal:   5,
+		},
+		"should not count the zone with the most unhealthy instances when zone-awareness is enabled": {
+			ringInstances: map[string]InstanceDesc{
+				"instance-1": {Addr: "127.0.0.1", Zone: "zone-a", State: ACTIVE, Timestamp: now.Unix()},
+				"instance-2": {Addr: "127.0.0.2", Zone: "zone-a", State: ACTIVE, Timestamp: now.Unix()},
+				"instance-3": {Addr: "127.0.0.3", Zone: "zone-b", State: ACTIVE, Timestamp: now.Unix()},
+				"instance-4": {Addr: "127.0.0.4", Zone: "zone-b", State: LEAVING, Timestamp: now.Add(-2 * time.Minute).Unix()},
+				"instance-5": {Addr: "127.0.0.5", Zone: "zone-c", State: LEAVING, Timestamp: now.Add(-2 * time.Minute).Unix()},
+				"instance-6": {Addr: "127.0.0.6", Zone: "zone-c", State: LEAVING, Timestamp: now.Add(-2 * time.Minute).Unix()},
+			},
+			zoneAwarenessEnabled: true,
+			expectedHealthy:      3,
+			expectedTotal:        4,
+		},
+		"should count all zones when zone-awareness is disabled": {
+			ringInstances: map[string]InstanceDesc{
+				"instance-1": {Addr: "127.0.0.1", Zone: "zone-a", State: ACTIVE, Timestamp: now.Unix()},
+				"instance-2": {Addr: "127.0.0.2", Zone: "zone-a", State: ACTIVE, Timestamp: now.Unix()},
+				"instance-3": {Addr: "127.0.0.3", Zone: "zone-b", State: ACTIVE, Timestamp: now.Unix()},
+				"instance-4": {Addr: "127.0.0.4", Zone: "zone-b", State: LEAVING, Timestamp: now.Add(-2 * time.Minute).Unix()},
+				"instance-5": {Addr: "127.0.0.5", Zone: "zone-c", State: LEAVING, Timestamp: now.Add(-2 * time.Minute).Unix()},
+				"instance-6": {Addr: "127.0.0.6", Zone: "zone-c", State: LEAVING, Timestamp: now.Add(-2 * time.Minute).Unix()},
+			},
+			expectedHealthy: 3,
+			expectedTotal:   6,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			ringDesc := &Desc{Ingesters: testData.ringInstances}
+
+			ring := Ring{
+				cfg:                 Config{HeartbeatTimeout: heartbeatTimeout, ReplicationFactor: 3, ZoneAwarenessEnabled: testData.zoneAwarenessEnabled},
+				ringDesc:            ringDesc,
+				ringTokens:          ringDesc.GetTokens(),
+				ringTokensByZone:    ringDesc.getTokensByZone(),
+				ringInstanceByToken: ringDesc.getTokensInfo(),
+				ringZones:           getZones(ringDesc.getTokensByZone()),
+				strategy:            NewDefaultReplicationStrategy(),
+			}
+
+			healthy, total := ring.CountHealthyInstances()
+			assert.Equal(t, testData.expectedHealthy, healthy)
+			assert.Equal(t, testData.expectedTotal, total)
+		})
+	}
+}
+
 func TestRing_GetReplicationSetForOperation(t *testing.T) {
 	now := time.Now()
 
@@ -1970,10 +2042,13 @@ func TestRingUpdates(t *testing.T) {
 		require.InDelta(t, now.UnixNano(), time.Unix(ing.Timestamp, 0).UnixNano(), float64(1500*time.Millisecond.Nanoseconds()))
 	}
 
+	require.True(t, ring.LastInstanceDeparture().IsZero())
+
 	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), lc2))
 	test.Poll(t, 1*time.Second, 2, func() interface{} {
 		return ring.InstancesCount()
 	})
+	require.WithinDuration(t, time.Now(), ring.LastInstanceDeparture(), 2*time.Second)
 
 	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), lc1))
 	test.Poll(t, 1*time.Second, 1, func() interface{} {
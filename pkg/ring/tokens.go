@@ -3,11 +3,24 @@ package ring
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"io/ioutil"
 	"os"
 	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	// tokensFileVersion is the version of the tokens file format storing the instance metadata.
+	tokensFileVersion = 2
 )
 
+var errTokensFileChecksumMismatch = errors.New("tokens file checksum mismatch, the file may be corrupted")
+
 // Tokens is a simple list of tokens.
 type Tokens []uint32
 
@@ -34,8 +47,41 @@ func (t Tokens) Equals(other Tokens) bool {
 	return true
 }
 
-// StoreToFile stores the tokens in the given directory.
+// StoreToFile stores the tokens in the given file path, in the legacy format without the instance metadata.
 func (t Tokens) StoreToFile(tokenFilePath string) error {
+	b, err := t.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return writeTokensFile(tokenFilePath, b)
+}
+
+// StoreToFileWithMetadata stores the tokens in the given file path, along with the instance metadata
+// and a checksum of the content.
+func (t Tokens) StoreToFileWithMetadata(tokenFilePath string, meta TokensFileMetadata) error {
+	tf := tokensFileJSON{
+		Version:             tokensFileVersion,
+		InstanceID:          meta.InstanceID,
+		Zone:                meta.Zone,
+		RegisteredTimestamp: meta.RegisteredTimestamp,
+		Tokens:              t,
+	}
+
+	var err error
+	if tf.Checksum, err = tf.computeChecksum(); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(tf)
+	if err != nil {
+		return err
+	}
+
+	return writeTokensFile(tokenFilePath, b)
+}
+
+func writeTokensFile(tokenFilePath string, content []byte) error {
 	if tokenFilePath == "" {
 		return errors.New("path is empty")
 	}
@@ -54,11 +100,7 @@ func (t Tokens) StoreToFile(tokenFilePath string) error {
 		_ = f.Close()
 	}()
 
-	b, err := t.Marshal()
-	if err != nil {
-		return err
-	}
-	if _, err = f.Write(b); err != nil {
+	if _, err = f.Write(content); err != nil {
 		return err
 	}
 
@@ -72,12 +114,50 @@ func (t Tokens) StoreToFile(tokenFilePath string) error {
 
 // LoadTokensFromFile loads tokens from given file path.
 func LoadTokensFromFile(tokenFilePath string) (Tokens, error) {
+	t, _, err := LoadTokensAndMetadataFromFile(tokenFilePath)
+	return t, err
+}
+
+// LoadTokensAndMetadataFromFile loads tokens and the instance metadata from given file path. The
+// returned metadata is nil if the file has been stored in the legacy format, without metadata.
+func LoadTokensAndMetadataFromFile(tokenFilePath string) (Tokens, *TokensFileMetadata, error) {
 	b, err := ioutil.ReadFile(tokenFilePath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	tf := tokensFileJSON{}
+	if err := json.Unmarshal(b, &tf); err != nil {
+		return nil, nil, err
 	}
-	var t Tokens
-	err = t.Unmarshal(b)
+
+	var meta *TokensFileMetadata
+
+	switch tf.Version {
+	case 0:
+		// Legacy format, storing the tokens only.
+	case tokensFileVersion:
+		expected := tf.Checksum
+		tf.Checksum = 0
+
+		actual, err := tf.computeChecksum()
+		if err != nil {
+			return nil, nil, err
+		}
+		if actual != expected {
+			return nil, nil, errTokensFileChecksumMismatch
+		}
+
+		meta = &TokensFileMetadata{
+			InstanceID:          tf.InstanceID,
+			Zone:                tf.Zone,
+			RegisteredTimestamp: tf.RegisteredTimestamp,
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported tokens file version %d", tf.Version)
+	}
+
+	t := Tokens(tf.Tokens)
 
 	// Tokens may have been written to file by an older version of Cortex which
 	// doesn't guarantee sorted tokens, so we enforce sorting here.
@@ -85,7 +165,28 @@ func LoadTokensFromFile(tokenFilePath string) (Tokens, error) {
 		sort.Sort(t)
 	}
 
-	return t, err
+	return t, meta, nil
+}
+
+// loadTokensFromFileForInstance loads tokens from given file path. If the tokens have been stored by
+// a different instance or in a different zone, they're discarded when discardOnMismatch is true.
+func loadTokensFromFileForInstance(tokenFilePath, instanceID, zone string, discardOnMismatch bool, logger log.Logger) (Tokens, error) {
+	t, meta, err := LoadTokensAndMetadataFromFile(tokenFilePath)
+	if err != nil || meta == nil {
+		return t, err
+	}
+
+	if meta.InstanceID == instanceID && meta.Zone == zone {
+		return t, nil
+	}
+
+	if discardOnMismatch {
+		level.Warn(logger).Log("msg", "discarding tokens from file because they have been stored by a different instance or in a different zone, new tokens will be generated", "path", tokenFilePath, "file_instance_id", meta.InstanceID, "file_zone", meta.Zone, "instance_id", instanceID, "zone", zone)
+		return nil, nil
+	}
+
+	level.Warn(logger).Log("msg", "loading tokens from file even if they have been stored by a different instance or in a different zone", "path", tokenFilePath, "file_instance_id", meta.InstanceID, "file_zone", meta.Zone, "instance_id", instanceID, "zone", zone)
+	return t, nil
 }
 
 // Marshal encodes the tokens into JSON.
@@ -106,3 +207,41 @@ func (t *Tokens) Unmarshal(b []byte) error {
 type tokensJSON struct {
 	Tokens []uint32 `json:"tokens"`
 }
+
+// TokensFileMetadata is the instance metadata stored in the tokens file along with the tokens.
+type TokensFileMetadata struct {
+	InstanceID          string
+	Zone                string
+	RegisteredTimestamp int64
+}
+
+func newTokensFileMetadata(instanceID, zone string, registeredAt time.Time) TokensFileMetadata {
+	meta := TokensFileMetadata{InstanceID: instanceID, Zone: zone}
+	if !registeredAt.IsZero() {
+		meta.RegisteredTimestamp = registeredAt.Unix()
+	}
+	return meta
+}
+
+// tokensFileJSON is the versioned format of the tokens file. The files without version, stored
+// by older versions of Cortex, contain the tokens only.
+type tokensFileJSON struct {
+	Version             int      `json:"version,omitempty"`
+	InstanceID          string   `json:"instance_id,omitempty"`
+	Zone                string   `json:"zone,omitempty"`
+	RegisteredTimestamp int64    `json:"registered_timestamp,omitempty"`
+	Tokens              []uint32 `json:"tokens"`
+	Checksum            uint32   `json:"checksum,omitempty"`
+}
+
+// computeChecksum returns the checksum of the file content, excluding the checksum itself.
+func (tf tokensFileJSON) computeChecksum() (uint32, error) {
+	tf.Checksum = 0
+
+	b, err := json.Marshal(tf)
+	if err != nil {
+		return 0, err
+	}
+
+	return crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli)), nil
+}
@@ -5,8 +5,10 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/go-kit/kit/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -75,3 +77,101 @@ func TestLoadTokensFromFile_ShouldGuaranteeSortedTokens(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, Tokens{1, 3, 5}, actual)
 }
+
+func TestLoadTokensAndMetadataFromFile(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-tokens")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	path := filepath.Join(tmpDir, "tokens")
+	meta := TokensFileMetadata{InstanceID: "instance-1", Zone: "zone-a", RegisteredTimestamp: 1000}
+
+	t.Run("should load the tokens and metadata stored with metadata", func(t *testing.T) {
+		require.NoError(t, Tokens{1, 5, 3}.StoreToFileWithMetadata(path, meta))
+
+		actualTokens, actualMeta, err := LoadTokensAndMetadataFromFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, Tokens{1, 3, 5}, actualTokens)
+		assert.Equal(t, &meta, actualMeta)
+	})
+
+	t.Run("should load the tokens stored in the legacy format", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(`{"tokens":[3,1,2]}`), 0644))
+
+		actualTokens, actualMeta, err := LoadTokensAndMetadataFromFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, Tokens{1, 2, 3}, actualTokens)
+		assert.Nil(t, actualMeta)
+	})
+
+	t.Run("should fail if the checksum doesn't match", func(t *testing.T) {
+		require.NoError(t, Tokens{1, 2, 3}.StoreToFileWithMetadata(path, meta))
+
+		content, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(path, []byte(strings.Replace(string(content), "instance-1", "instance-2", 1)), 0644))
+
+		_, _, err = LoadTokensAndMetadataFromFile(path)
+		assert.Equal(t, errTokensFileChecksumMismatch, err)
+	})
+
+	t.Run("should fail if the version is not supported", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(`{"version":3,"tokens":[1,2,3]}`), 0644))
+
+		_, _, err := LoadTokensAndMetadataFromFile(path)
+		assert.EqualError(t, err, "unsupported tokens file version 3")
+	})
+}
+
+func TestLoadTokensFromFileForInstance(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-tokens")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	path := filepath.Join(tmpDir, "tokens")
+	require.NoError(t, Tokens{1, 2, 3}.StoreToFileWithMetadata(path, TokensFileMetadata{InstanceID: "instance-1", Zone: "zone-a"}))
+
+	tests := map[string]struct {
+		instanceID        string
+		zone              string
+		discardOnMismatch bool
+		expected          Tokens
+	}{
+		"should load the tokens stored by the same instance": {
+			instanceID:        "instance-1",
+			zone:              "zone-a",
+			discardOnMismatch: true,
+			expected:          Tokens{1, 2, 3},
+		},
+		"should discard the tokens stored by a different instance": {
+			instanceID:        "instance-2",
+			zone:              "zone-a",
+			discardOnMismatch: true,
+			expected:          nil,
+		},
+		"should discard the tokens stored in a different zone": {
+			instanceID:        "instance-1",
+			zone:              "zone-b",
+			discardOnMismatch: true,
+			expected:          nil,
+		},
+		"should load the tokens stored by a different instance if discarding is disabled": {
+			instanceID:        "instance-2",
+			zone:              "zone-b",
+			discardOnMismatch: false,
+			expected:          Tokens{1, 2, 3},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			actual, err := loadTokensFromFileForInstance(path, testData.instanceID, testData.zone, testData.discardOnMismatch, log.NewNopLogger())
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, actual)
+		})
+	}
+}
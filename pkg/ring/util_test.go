@@ -44,6 +44,10 @@ func (r *RingMock) InstancesCount() int {
 	return 0
 }
 
+func (r *RingMock) CountHealthyInstances() (healthy, total int) {
+	return 0, 0
+}
+
 func (r *RingMock) ShuffleShard(identifier string, size int) ReadRing {
 	args := r.Called(identifier, size)
 	return args.Get(0).(ReadRing)
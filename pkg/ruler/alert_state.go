@@ -0,0 +1,349 @@
+package ruler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"golang.org/x/time/rate"
+
+	"github.com/cortexproject/cortex/pkg/querier/series"
+	"github.com/cortexproject/cortex/pkg/storage/bucket"
+)
+
+const (
+	// The bucket prefix under which the alert state snapshots of all the tenants are stored.
+	alertStatePrefix = "ruler-alert-state"
+
+	alertStateSnapshotName = "snapshot.json"
+
+	// The name of the series queried by the Prometheus rules manager to restore the "for" state
+	// of the alerts.
+	alertForStateMetricName = "ALERTS_FOR_STATE"
+)
+
+// AlertStateConfig configures the snapshots of the state of the active alerts to the ruler storage,
+// restored when the rule groups are loaded again, after the rulers restart or reshard.
+type AlertStateConfig struct {
+	SnapshotInterval      time.Duration `yaml:"snapshot_interval"`
+	MaxSnapshotsPerSecond float64       `yaml:"max_snapshots_per_second"`
+}
+
+func (cfg *AlertStateConfig) RegisterFlags(f *flag.FlagSet) {
+	f.DurationVar(&cfg.SnapshotInterval, "ruler.alert-state.snapshot-interval", 0, `How frequently the state of the active alerts of each tenant is snapshotted to the ruler storage, to restore their "for" state when the rule groups are loaded again. The snapshots older than -ruler.for-outage-tolerance aren't restored. Requires an object storage backend for the ruler storage. 0 to disable.`)
+	f.Float64Var(&cfg.MaxSnapshotsPerSecond, "ruler.alert-state.max-snapshots-per-second", 10, "Maximum number of alert state snapshots written per second by each ruler, across all the tenants.")
+}
+
+// Validate the config and returns an error if the validation doesn't pass.
+func (cfg *AlertStateConfig) Validate() error {
+	if cfg.SnapshotInterval > 0 && cfg.MaxSnapshotsPerSecond <= 0 {
+		return errors.New("the max alert state snapshots per second must be greater than 0")
+	}
+	return nil
+}
+
+// AlertStateSnapshot is the state of the active alerts of a tenant at a given time.
+type AlertStateSnapshot struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Alerts    []AlertStateEntry `json:"alerts"`
+}
+
+// AlertStateEntry is the state of an active alert, identified by the labels of its
+// ALERTS_FOR_STATE series.
+type AlertStateEntry struct {
+	Labels   labels.Labels `json:"labels"`
+	ActiveAt time.Time     `json:"activeAt"`
+}
+
+// AlertStateStore stores the alert state snapshots of the tenants in the object storage.
+type AlertStateStore struct {
+	bucket      objstore.Bucket
+	cfgProvider bucket.TenantConfigProvider
+}
+
+func NewAlertStateStore(bkt objstore.Bucket, cfgProvider bucket.TenantConfigProvider) *AlertStateStore {
+	return &AlertStateStore{
+		bucket:      bucket.NewPrefixedBucketClient(bkt, alertStatePrefix),
+		cfgProvider: cfgProvider,
+	}
+}
+
+// GetSnapshot returns the last alert state snapshot of the user, or nil if there's none.
+func (s *AlertStateStore) GetSnapshot(ctx context.Context, userID string) (*AlertStateSnapshot, error) {
+	userBucket := bucket.NewUserBucketClient(userID, s.bucket, s.cfgProvider)
+
+	reader, err := userBucket.Get(ctx, alertStateSnapshotName)
+	if userBucket.IsObjNotFoundErr(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the alert state snapshot of user %s", userID)
+	}
+	defer func() { _ = reader.Close() }()
+
+	buf, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the alert state snapshot of user %s", userID)
+	}
+
+	snapshot := &AlertStateSnapshot{}
+	if err := json.Unmarshal(buf, snapshot); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode the alert state snapshot of user %s", userID)
+	}
+	return snapshot, nil
+}
+
+// SetSnapshot replaces the alert state snapshot of the user.
+func (s *AlertStateStore) SetSnapshot(ctx context.Context, userID string, snapshot *AlertStateSnapshot) error {
+	buf, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode the alert state snapshot of user %s", userID)
+	}
+
+	userBucket := bucket.NewUserBucketClient(userID, s.bucket, s.cfgProvider)
+	return errors.Wrapf(userBucket.Upload(ctx, alertStateSnapshotName, bytes.NewReader(buf)), "failed to upload the alert state snapshot of user %s", userID)
+}
+
+// AlertStateManagerFactory wraps the rules managers made by the factory, to periodically snapshot
+// the state of their active alerts to the store, and to restore it when their rule groups are loaded.
+// The snapshots are rate-limited across all the tenants, and their failures aren't fatal: the alerts
+// are then restored from the ALERTS_FOR_STATE series, like without the snapshots.
+func AlertStateManagerFactory(cfg AlertStateConfig, store *AlertStateStore, factory ManagerFactory, reg prometheus.Registerer) ManagerFactory {
+	limiter := rate.NewLimiter(rate.Limit(cfg.MaxSnapshotsPerSecond), 1)
+	snapshots := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_ruler_alert_state_snapshots_total",
+		Help: "Total number of alert state snapshots written to the ruler storage.",
+	})
+	failedSnapshots := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_ruler_alert_state_snapshots_failed_total",
+		Help: "Total number of alert state snapshots failed to be written to the ruler storage.",
+	})
+
+	return func(ctx context.Context, userID string, notifier Sender, logger log.Logger, userReg prometheus.Registerer) RulesManager {
+		restorer := &alertStateRestorer{store: store, userID: userID, logger: logger}
+
+		return &alertStateManager{
+			RulesManager:    factory(contextWithAlertStateRestorer(ctx, restorer), userID, notifier, logger, userReg),
+			ctx:             ctx,
+			userID:          userID,
+			restorer:        restorer,
+			store:           store,
+			interval:        cfg.SnapshotInterval,
+			limiter:         limiter,
+			logger:          logger,
+			snapshots:       snapshots,
+			failedSnapshots: failedSnapshots,
+			done:            make(chan struct{}),
+		}
+	}
+}
+
+// alertStateManager is a rules manager snapshotting the state of its active alerts to the store.
+type alertStateManager struct {
+	RulesManager
+
+	ctx      context.Context
+	userID   string
+	restorer *alertStateRestorer
+	store    *AlertStateStore
+	interval time.Duration
+	limiter  *rate.Limiter
+	logger   log.Logger
+
+	snapshots       prometheus.Counter
+	failedSnapshots prometheus.Counter
+
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// Whether the last written snapshot had no alerts, so that the tenants without active
+	// alerts don't write the same empty snapshot over and over.
+	lastSnapshotEmpty bool
+}
+
+func (m *alertStateManager) Run() {
+	go m.snapshotLoop()
+	m.RulesManager.Run()
+}
+
+func (m *alertStateManager) Stop() {
+	m.stopOnce.Do(func() { close(m.done) })
+	m.RulesManager.Stop()
+}
+
+func (m *alertStateManager) snapshotLoop() {
+	// The last snapshot is loaded before being replaced, because the alerts are restored after
+	// the first evaluations of the rule groups.
+	m.restorer.load(m.ctx)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.snapshot()
+		}
+	}
+}
+
+func (m *alertStateManager) snapshot() {
+	snapshot := alertStateSnapshot(m.RuleGroups(), time.Now())
+	if len(snapshot.Alerts) == 0 && m.lastSnapshotEmpty {
+		return
+	}
+
+	if err := m.limiter.Wait(m.ctx); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, m.interval)
+	defer cancel()
+
+	m.snapshots.Inc()
+	if err := m.store.SetSnapshot(ctx, m.userID, snapshot); err != nil {
+		m.failedSnapshots.Inc()
+		level.Warn(m.logger).Log("msg", "failed to snapshot the alert state", "user", m.userID, "err", err)
+		return
+	}
+	m.lastSnapshotEmpty = len(snapshot.Alerts) == 0
+}
+
+// alertStateSnapshot returns the state of the active alerts of the rule groups.
+func alertStateSnapshot(groups []*rules.Group, ts time.Time) *AlertStateSnapshot {
+	snapshot := &AlertStateSnapshot{Timestamp: ts, Alerts: []AlertStateEntry{}}
+
+	for _, g := range groups {
+		for _, rule := range g.AlertingRules() {
+			for _, alert := range rule.ActiveAlerts() {
+				// The labels are the ones of the ALERTS_FOR_STATE series of the alert.
+				lb := labels.NewBuilder(rule.Labels())
+				for _, l := range alert.Labels {
+					lb.Set(l.Name, l.Value)
+				}
+				lb.Set(labels.MetricName, alertForStateMetricName)
+				lb.Set(labels.AlertName, rule.Name())
+
+				snapshot.Alerts = append(snapshot.Alerts, AlertStateEntry{Labels: lb.Labels(), ActiveAt: alert.ActiveAt})
+			}
+		}
+	}
+	return snapshot
+}
+
+// alertStateRestorer loads the last alert state snapshot of the user once, when the rules
+// manager restores the state of the alerts.
+type alertStateRestorer struct {
+	store  *AlertStateStore
+	userID string
+	logger log.Logger
+
+	once     sync.Once
+	snapshot *AlertStateSnapshot
+}
+
+func (r *alertStateRestorer) load(ctx context.Context) *AlertStateSnapshot {
+	r.once.Do(func() {
+		snapshot, err := r.store.GetSnapshot(ctx, r.userID)
+		if err != nil {
+			level.Warn(r.logger).Log("msg", "failed to load the alert state snapshot, restoring the alerts from the ALERTS_FOR_STATE series", "user", r.userID, "err", err)
+			return
+		}
+		r.snapshot = snapshot
+	})
+	return r.snapshot
+}
+
+type alertStateRestorerContextKey struct{}
+
+func contextWithAlertStateRestorer(ctx context.Context, restorer *alertStateRestorer) context.Context {
+	return context.WithValue(ctx, alertStateRestorerContextKey{}, restorer)
+}
+
+// alertStateQueryable is the queryable used by the Prometheus rules manager to restore the "for"
+// state of the alerts, after the first evaluation of the rule groups. If the context has an alert
+// state restorer, the ALERTS_FOR_STATE series in the snapshot are preferred to the queried ones.
+type alertStateQueryable struct {
+	storage.Queryable
+}
+
+func (q alertStateQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	restorer, ok := ctx.Value(alertStateRestorerContextKey{}).(*alertStateRestorer)
+	if !ok {
+		return q.Queryable.Querier(ctx, mint, maxt)
+	}
+
+	// The snapshots older than the outage tolerance aren't restored.
+	snapshot := restorer.load(ctx)
+	if snapshot != nil && (snapshot.Timestamp.Before(model.Time(mint).Time()) || snapshot.Timestamp.After(model.Time(maxt).Time())) {
+		snapshot = nil
+	}
+
+	querier, err := q.Queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		if snapshot == nil {
+			return nil, err
+		}
+		// The alerts in the snapshot are restored even if the series can't be queried.
+		querier = storage.NoopQuerier()
+	}
+
+	if snapshot == nil {
+		return querier, nil
+	}
+	return &alertStateQuerier{Querier: querier, snapshot: snapshot}, nil
+}
+
+type alertStateQuerier struct {
+	storage.Querier
+
+	snapshot *AlertStateSnapshot
+}
+
+// Select returns the ALERTS_FOR_STATE series of the alert in the snapshot, with a single sample at
+// the snapshot time, whose value is the time the alert became active, or the queried series if the
+// alert isn't in the snapshot.
+func (q *alertStateQuerier) Select(sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	var result []storage.Series
+
+	for _, alert := range q.snapshot.Alerts {
+		if matchesAll(alert.Labels, matchers) {
+			result = append(result, series.NewConcreteSeries(alert.Labels, []model.SamplePair{{
+				Timestamp: model.TimeFromUnixNano(q.snapshot.Timestamp.UnixNano()),
+				Value:     model.SampleValue(alert.ActiveAt.Unix()),
+			}}))
+		}
+	}
+
+	if len(result) == 0 {
+		return q.Querier.Select(sortSeries, hints, matchers...)
+	}
+	return series.NewConcreteSeriesSet(result)
+}
+
+func matchesAll(ls labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(ls.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
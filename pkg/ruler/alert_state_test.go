@@ -0,0 +1,156 @@
+package ruler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	promRules "github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+)
+
+func TestAlertStateManagerFactory_ShouldRestoreThePendingAlertsAfterRestart(t *testing.T) {
+	cfg, cleanup := defaultRulerConfig(newMockRuleStore(nil))
+	defer cleanup()
+	cfg.AlertState.SnapshotInterval = 100 * time.Millisecond
+	cfg.ForGracePeriod = time.Minute
+
+	// The alerts aren't restored from the ALERTS_FOR_STATE series, which are never queried.
+	queryable := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return storage.NoopQuerier(), nil
+	})
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1e6, Timeout: time.Minute})
+	limits := ruleLimits{}
+
+	bkt := objstore.NewInMemBucket()
+	store := NewAlertStateStore(bkt, nil)
+	factory := AlertStateManagerFactory(cfg.AlertState, store, DefaultTenantManagerFactory(cfg, &recordingPusher{}, queryable, engine, limits, nil), prometheus.NewRegistry())
+
+	groups := map[string]rulespb.RuleGroupList{
+		"user1": {
+			&rulespb.RuleGroupDesc{
+				Name:      "group1",
+				Namespace: "namespace1",
+				User:      "user1",
+				Rules:     []*rulespb.RuleDesc{{Alert: "AlwaysPending", Expr: "vector(1)", For: 10 * time.Minute}},
+				Interval:  100 * time.Millisecond,
+			},
+		},
+	}
+
+	pendingAlert := func(m *DefaultMultiTenantManager) *promRules.Alert {
+		for _, g := range m.GetRules("user1") {
+			for _, rule := range g.AlertingRules() {
+				for _, alert := range rule.ActiveAlerts() {
+					if alert.State == promRules.StatePending {
+						return alert
+					}
+				}
+			}
+		}
+		return nil
+	}
+
+	// Fire the alert, and wait until its state is snapshotted.
+	manager1, err := NewDefaultMultiTenantManager(cfg, factory, limits, nil, log.NewNopLogger())
+	require.NoError(t, err)
+	manager1.SyncRuleGroups(context.Background(), groups)
+
+	require.Eventually(t, func() bool {
+		snapshot, err := store.GetSnapshot(context.Background(), "user1")
+		return pendingAlert(manager1) != nil && err == nil && snapshot != nil && len(snapshot.Alerts) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	manager1.Stop()
+
+	// The alert is aged in the snapshot, as if it had been pending for 5 minutes when the rules
+	// manager stopped.
+	snapshot, err := store.GetSnapshot(context.Background(), "user1")
+	require.NoError(t, err)
+	snapshot.Alerts[0].ActiveAt = snapshot.Alerts[0].ActiveAt.Add(-5 * time.Minute)
+	require.NoError(t, store.SetSnapshot(context.Background(), "user1", snapshot))
+
+	manager2, err := NewDefaultMultiTenantManager(cfg, factory, limits, nil, log.NewNopLogger())
+	require.NoError(t, err)
+	defer manager2.Stop()
+	manager2.SyncRuleGroups(context.Background(), groups)
+
+	// The pending timer continues from the snapshot, rather than being reset. Like the Prometheus
+	// restore, the time the rules weren't evaluated isn't counted as pending.
+	require.Eventually(t, func() bool {
+		alert := pendingAlert(manager2)
+		return alert != nil && alert.ActiveAt.Before(time.Now().Add(-4*time.Minute))
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestAlertStateQueryable(t *testing.T) {
+	ls := labels.FromStrings(labels.MetricName, alertForStateMetricName, labels.AlertName, "HighLatency", "service", "api")
+	activeAt := time.Unix(1000, 0)
+	snapshotTime := time.Unix(1600, 0)
+
+	bkt := objstore.NewInMemBucket()
+	store := NewAlertStateStore(bkt, nil)
+	require.NoError(t, store.SetSnapshot(context.Background(), "user1", &AlertStateSnapshot{
+		Timestamp: snapshotTime,
+		Alerts:    []AlertStateEntry{{Labels: ls, ActiveAt: activeAt}},
+	}))
+
+	queryable := alertStateQueryable{storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return storage.NoopQuerier(), nil
+	})}
+	matchers := []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, alertForStateMetricName),
+		labels.MustNewMatcher(labels.MatchEqual, labels.AlertName, "HighLatency"),
+		labels.MustNewMatcher(labels.MatchEqual, "service", "api"),
+	}
+
+	tests := map[string]struct {
+		mint           time.Time
+		expectedSeries bool
+	}{
+		"the snapshot within the outage tolerance is restored": {
+			mint:           snapshotTime.Add(-time.Hour),
+			expectedSeries: true,
+		},
+		"the snapshot older than the outage tolerance isn't restored": {
+			mint:           snapshotTime.Add(time.Minute),
+			expectedSeries: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			restorer := &alertStateRestorer{store: store, userID: "user1", logger: log.NewNopLogger()}
+			ctx := contextWithAlertStateRestorer(context.Background(), restorer)
+
+			q, err := queryable.Querier(ctx, int64(model.TimeFromUnixNano(tc.mint.UnixNano())), int64(model.TimeFromUnixNano(snapshotTime.Add(time.Hour).UnixNano())))
+			require.NoError(t, err)
+
+			set := q.Select(false, nil, matchers...)
+			if !tc.expectedSeries {
+				assert.False(t, set.Next())
+				return
+			}
+
+			require.True(t, set.Next())
+			assert.Equal(t, ls, set.At().Labels())
+
+			it := set.At().Iterator()
+			require.True(t, it.Next())
+			ts, v := it.At()
+			assert.Equal(t, snapshotTime.UnixNano()/int64(time.Millisecond), ts)
+			assert.Equal(t, float64(activeAt.Unix()), v)
+			assert.False(t, set.Next())
+		})
+	}
+}
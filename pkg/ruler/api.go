@@ -1,6 +1,7 @@
 package ruler
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -16,7 +17,6 @@ import (
 	"github.com/pkg/errors"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/prometheus/pkg/labels"
-	"github.com/prometheus/prometheus/pkg/rulefmt"
 	"github.com/weaveworks/common/user"
 	"gopkg.in/yaml.v3"
 
@@ -24,6 +24,7 @@ import (
 	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
 	"github.com/cortexproject/cortex/pkg/ruler/rulestore"
 	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 )
 
@@ -36,6 +37,7 @@ type response struct {
 	Data      interface{}  `json:"data"`
 	ErrorType v1.ErrorType `json:"errorType"`
 	Error     string       `json:"error"`
+	Warnings  []string     `json:"warnings,omitempty"`
 }
 
 // AlertDiscovery has info for all active alerts.
@@ -68,6 +70,10 @@ type RuleGroup struct {
 	Interval       float64   `json:"interval"`
 	LastEvaluation time.Time `json:"lastEvaluation"`
 	EvaluationTime float64   `json:"evaluationTime"`
+
+	// SkippedReason is the limit exceeded by the rule group, which isn't evaluated. It's
+	// empty for the evaluated rule groups.
+	SkippedReason string `json:"skippedReason,omitempty"`
 }
 
 type rule interface{}
@@ -86,6 +92,13 @@ type alertingRule struct {
 	Type           v1.RuleType   `json:"type"`
 	LastEvaluation time.Time     `json:"lastEvaluation"`
 	EvaluationTime float64       `json:"evaluationTime"`
+
+	// Unlike the health and the last error, the evaluation stats are kept across the
+	// successful evaluations.
+	EvaluationFailures       int64     `json:"evaluationFailures"`
+	LastFailureError         string    `json:"lastFailureError"`
+	LastFailedEvaluation     time.Time `json:"lastFailedEvaluation"`
+	LastSuccessfulEvaluation time.Time `json:"lastSuccessfulEvaluation"`
 }
 
 type recordingRule struct {
@@ -97,12 +110,27 @@ type recordingRule struct {
 	Type           v1.RuleType   `json:"type"`
 	LastEvaluation time.Time     `json:"lastEvaluation"`
 	EvaluationTime float64       `json:"evaluationTime"`
+
+	// Unlike the health and the last error, the evaluation stats are kept across the
+	// successful evaluations.
+	EvaluationFailures       int64     `json:"evaluationFailures"`
+	LastFailureError         string    `json:"lastFailureError"`
+	LastFailedEvaluation     time.Time `json:"lastFailedEvaluation"`
+	LastSuccessfulEvaluation time.Time `json:"lastSuccessfulEvaluation"`
 }
 
 func respondError(logger log.Logger, w http.ResponseWriter, msg string) {
+	respondErrorWithType(logger, w, v1.ErrServer, http.StatusInternalServerError, msg)
+}
+
+func respondInvalidRequest(logger log.Logger, w http.ResponseWriter, msg string) {
+	respondErrorWithType(logger, w, v1.ErrBadData, http.StatusBadRequest, msg)
+}
+
+func respondErrorWithType(logger log.Logger, w http.ResponseWriter, errorType v1.ErrorType, statusCode int, msg string) {
 	b, err := json.Marshal(&response{
 		Status:    "error",
-		ErrorType: v1.ErrServer,
+		ErrorType: errorType,
 		Error:     msg,
 		Data:      nil,
 	})
@@ -113,7 +141,7 @@ func respondError(logger log.Logger, w http.ResponseWriter, msg string) {
 		return
 	}
 
-	w.WriteHeader(http.StatusInternalServerError)
+	w.WriteHeader(statusCode)
 	if n, err := w.Write(b); err != nil {
 		level.Error(logger).Log("msg", "error writing response", "bytesWritten", n, "err", err)
 	}
@@ -121,21 +149,39 @@ func respondError(logger log.Logger, w http.ResponseWriter, msg string) {
 
 // API is used to handle HTTP requests for the ruler service
 type API struct {
-	ruler *Ruler
-	store rulestore.RuleStore
+	ruler  *Ruler
+	store  rulestore.RuleStore
+	dryRun *DryRunEvaluator
 
 	logger log.Logger
 }
 
-// NewAPI returns a new API struct with the provided ruler and rule store
-func NewAPI(r *Ruler, s rulestore.RuleStore, logger log.Logger) *API {
+// NewAPI returns a new API struct with the provided ruler, rule store and dry-run evaluator
+func NewAPI(r *Ruler, s rulestore.RuleStore, dryRun *DryRunEvaluator, logger log.Logger) *API {
 	return &API{
 		ruler:  r,
 		store:  s,
+		dryRun: dryRun,
 		logger: logger,
 	}
 }
 
+// skippedRuleGroups returns the rule groups of the user skipped by the rulers, because exceeding the limits.
+func (a *API) skippedRuleGroups(ctx context.Context, userID string) ([]skippedRuleGroup, error) {
+	limits := a.ruler.limits
+	if limits.RulerMaxRulesPerRuleGroup(userID) <= 0 && limits.RulerMaxRuleGroupsPerTenant(userID) <= 0 && limits.RulerMaxRulesPerTenant(userID) <= 0 {
+		return nil, nil
+	}
+
+	groups, err := a.store.ListRuleGroupsForUserAndNamespace(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	_, skipped, err := limitRuleGroups(ctx, a.store, limits, userID, groups)
+	return skipped, err
+}
+
 func (a *API) PrometheusRules(w http.ResponseWriter, req *http.Request) {
 	logger := util_log.WithContext(req.Context(), a.logger)
 	userID, err := tenant.TenantID(req.Context())
@@ -145,8 +191,14 @@ func (a *API) PrometheusRules(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	filter, err := parseRulesFilter(req)
+	if err != nil {
+		respondInvalidRequest(logger, w, err.Error())
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	rgs, err := a.ruler.GetRules(req.Context())
+	rgs, warnings, err := a.ruler.GetRules(req.Context())
 
 	if err != nil {
 		respondError(logger, w, err.Error())
@@ -156,19 +208,31 @@ func (a *API) PrometheusRules(w http.ResponseWriter, req *http.Request) {
 	groups := make([]*RuleGroup, 0, len(rgs))
 
 	for _, g := range rgs {
+		if !filter.matchesGroup(g.Group) {
+			continue
+		}
+
 		grp := RuleGroup{
 			Name:           g.Group.Name,
 			File:           g.Group.Namespace,
-			Rules:          make([]rule, len(g.ActiveRules)),
+			Rules:          make([]rule, 0, len(g.ActiveRules)),
 			Interval:       g.Group.Interval.Seconds(),
 			LastEvaluation: g.GetEvaluationTimestamp(),
 			EvaluationTime: g.GetEvaluationDuration().Seconds(),
 		}
 
-		for i, rl := range g.ActiveRules {
-			if g.ActiveRules[i].Rule.Alert != "" {
+		for _, rl := range g.ActiveRules {
+			if rl.Rule.Alert != "" {
+				if !filter.alertingRules {
+					continue
+				}
+
 				alerts := make([]*Alert, 0, len(rl.Alerts))
 				for _, a := range rl.Alerts {
+					if filter.alertsLimit > 0 && len(alerts) >= filter.alertsLimit {
+						break
+					}
+
 					alerts = append(alerts, &Alert{
 						Labels:      cortexpb.FromLabelAdaptersToLabels(a.Labels),
 						Annotations: cortexpb.FromLabelAdaptersToLabels(a.Annotations),
@@ -177,7 +241,7 @@ func (a *API) PrometheusRules(w http.ResponseWriter, req *http.Request) {
 						Value:       strconv.FormatFloat(a.Value, 'e', -1, 64),
 					})
 				}
-				grp.Rules[i] = alertingRule{
+				grp.Rules = append(grp.Rules, alertingRule{
 					State:          rl.GetState(),
 					Name:           rl.Rule.GetAlert(),
 					Query:          rl.Rule.GetExpr(),
@@ -190,9 +254,18 @@ func (a *API) PrometheusRules(w http.ResponseWriter, req *http.Request) {
 					LastEvaluation: rl.GetEvaluationTimestamp(),
 					EvaluationTime: rl.GetEvaluationDuration().Seconds(),
 					Type:           v1.RuleTypeAlerting,
-				}
+
+					EvaluationFailures:       rl.GetEvaluationFailures(),
+					LastFailureError:         rl.GetLastFailureError(),
+					LastFailedEvaluation:     rl.GetLastFailureTimestamp(),
+					LastSuccessfulEvaluation: rl.GetLastSuccessTimestamp(),
+				})
 			} else {
-				grp.Rules[i] = recordingRule{
+				if !filter.recordingRules {
+					continue
+				}
+
+				grp.Rules = append(grp.Rules, recordingRule{
 					Name:           rl.Rule.GetRecord(),
 					Query:          rl.Rule.GetExpr(),
 					Labels:         cortexpb.FromLabelAdaptersToLabels(rl.Rule.Labels),
@@ -201,20 +274,48 @@ func (a *API) PrometheusRules(w http.ResponseWriter, req *http.Request) {
 					LastEvaluation: rl.GetEvaluationTimestamp(),
 					EvaluationTime: rl.GetEvaluationDuration().Seconds(),
 					Type:           v1.RuleTypeRecording,
-				}
+
+					EvaluationFailures:       rl.GetEvaluationFailures(),
+					LastFailureError:         rl.GetLastFailureError(),
+					LastFailedEvaluation:     rl.GetLastFailureTimestamp(),
+					LastSuccessfulEvaluation: rl.GetLastSuccessTimestamp(),
+				})
 			}
 		}
 		groups = append(groups, &grp)
 	}
 
+	// The rule groups skipped because exceeding the limits aren't running on any ruler.
+	skipped, err := a.skippedRuleGroups(req.Context(), userID)
+	if err != nil {
+		level.Error(logger).Log("msg", "unable to list the skipped rule groups", "err", err, "user", userID)
+		respondError(logger, w, err.Error())
+		return
+	}
+
+	for _, s := range skipped {
+		if !filter.matchesGroup(s.group) {
+			continue
+		}
+
+		groups = append(groups, &RuleGroup{
+			Name:          s.group.Name,
+			File:          s.group.Namespace,
+			Rules:         []rule{},
+			Interval:      s.group.Interval.Seconds(),
+			SkippedReason: s.reason,
+		})
+	}
+
 	// keep data.groups are in order
 	sort.Slice(groups, func(i, j int) bool {
 		return groups[i].File < groups[j].File
 	})
 
 	b, err := json.Marshal(&response{
-		Status: "success",
-		Data:   &RuleDiscovery{RuleGroups: groups},
+		Status:   "success",
+		Data:     &RuleDiscovery{RuleGroups: groups},
+		Warnings: warnings,
 	})
 	if err != nil {
 		level.Error(logger).Log("msg", "error marshaling json response", "err", err)
@@ -228,6 +329,77 @@ func (a *API) PrometheusRules(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// rulesFilter holds the filters of the Prometheus rules API.
+type rulesFilter struct {
+	alertingRules  bool
+	recordingRules bool
+	files          map[string]struct{}
+	groups         map[string]struct{}
+
+	// Max number of alerts returned per alerting rule, 0 to return all of them.
+	alertsLimit int
+}
+
+// parseRulesFilter parses the type, file[], rule_group[] and limit parameters of the rules API request.
+func parseRulesFilter(req *http.Request) (rulesFilter, error) {
+	if err := req.ParseForm(); err != nil {
+		return rulesFilter{}, errors.Wrap(err, "error parsing form values")
+	}
+
+	filter := rulesFilter{
+		alertingRules:  true,
+		recordingRules: true,
+		files:          stringsSet(req.Form["file[]"]),
+		groups:         stringsSet(req.Form["rule_group[]"]),
+	}
+
+	switch typ := strings.ToLower(req.Form.Get("type")); typ {
+	case "":
+	case "alert":
+		filter.recordingRules = false
+	case "record":
+		filter.alertingRules = false
+	default:
+		return rulesFilter{}, errors.Errorf("invalid query parameter type='%s'", typ)
+	}
+
+	if limit := req.Form.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return rulesFilter{}, errors.Errorf("invalid query parameter limit='%s'", limit)
+		}
+		filter.alertsLimit = n
+	}
+
+	return filter, nil
+}
+
+func (f rulesFilter) matchesGroup(g *rulespb.RuleGroupDesc) bool {
+	if len(f.files) > 0 {
+		if _, ok := f.files[g.Namespace]; !ok {
+			return false
+		}
+	}
+	if len(f.groups) > 0 {
+		if _, ok := f.groups[g.Name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func stringsSet(values []string) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
 func (a *API) PrometheusAlerts(w http.ResponseWriter, req *http.Request) {
 	logger := util_log.WithContext(req.Context(), a.logger)
 	userID, err := tenant.TenantID(req.Context())
@@ -238,7 +410,7 @@ func (a *API) PrometheusAlerts(w http.ResponseWriter, req *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	rgs, err := a.ruler.GetRules(req.Context())
+	rgs, warnings, err := a.ruler.GetRules(req.Context())
 
 	if err != nil {
 		respondError(logger, w, err.Error())
@@ -264,8 +436,9 @@ func (a *API) PrometheusAlerts(w http.ResponseWriter, req *http.Request) {
 	}
 
 	b, err := json.Marshal(&response{
-		Status: "success",
-		Data:   &AlertDiscovery{Alerts: alerts},
+		Status:   "success",
+		Data:     &AlertDiscovery{Alerts: alerts},
+		Warnings: warnings,
 	})
 	if err != nil {
 		level.Error(logger).Log("msg", "error marshaling json response", "err", err)
@@ -288,6 +461,8 @@ var (
 	ErrNoRuleGroups = errors.New("no rule groups found")
 	// ErrBadRuleGroup is returned when the provided rule group can not be unmarshalled
 	ErrBadRuleGroup = errors.New("unable to decoded rule group")
+	// ErrDryRunDisabled is returned when the rule groups can't be evaluated without being stored
+	ErrDryRunDisabled = errors.New("the rule groups dry-run is not enabled")
 )
 
 func marshalAndSend(output interface{}, w http.ResponseWriter, logger log.Logger) {
@@ -413,7 +588,7 @@ func (a *API) ListRules(w http.ResponseWriter, req *http.Request) {
 
 	level.Debug(logger).Log("msg", "retrieved rule groups from rule store", "userID", userID, "num_namespaces", len(rgs))
 
-	formatted := rgs.Formatted()
+	formatted := rgs.FormattedWithSourceTenants()
 	marshalAndSend(formatted, w, logger)
 }
 
@@ -435,36 +610,31 @@ func (a *API) GetRuleGroup(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	formatted := rulespb.FromProto(rg)
+	formatted := rulespb.FromProtoWithSourceTenants(rg)
 	marshalAndSend(formatted, w, logger)
 }
 
-func (a *API) CreateRuleGroup(w http.ResponseWriter, req *http.Request) {
-	logger := util_log.WithContext(req.Context(), a.logger)
-	userID, namespace, _, err := parseRequest(req, true, false)
-	if err != nil {
-		respondError(logger, w, err.Error())
-		return
-	}
-
+// parseRuleGroup reads and validates the rule group of the request body. If it's invalid, the
+// error is written to the response and false is returned.
+func (a *API) parseRuleGroup(w http.ResponseWriter, req *http.Request, logger log.Logger, userID string) (rulespb.RuleGroup, bool) {
 	payload, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		level.Error(logger).Log("msg", "unable to read rule group payload", "err", err.Error())
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return rulespb.RuleGroup{}, false
 	}
 
 	level.Debug(logger).Log("msg", "attempting to unmarshal rulegroup", "userID", userID, "group", string(payload))
 
-	rg := rulefmt.RuleGroup{}
+	rg := rulespb.RuleGroup{}
 	err = yaml.Unmarshal(payload, &rg)
 	if err != nil {
 		level.Error(logger).Log("msg", "unable to unmarshal rule group payload", "err", err.Error())
 		http.Error(w, ErrBadRuleGroup.Error(), http.StatusBadRequest)
-		return
+		return rulespb.RuleGroup{}, false
 	}
 
-	errs := a.ruler.manager.ValidateRuleGroup(rg)
+	errs := a.ruler.manager.ValidateRuleGroup(rg.RuleGroup)
 	if len(errs) > 0 {
 		e := []string{}
 		for _, err := range errs {
@@ -473,12 +643,34 @@ func (a *API) CreateRuleGroup(w http.ResponseWriter, req *http.Request) {
 		}
 
 		http.Error(w, strings.Join(e, ", "), http.StatusBadRequest)
-		return
+		return rulespb.RuleGroup{}, false
 	}
 
 	if err := a.ruler.AssertMaxRulesPerRuleGroup(userID, len(rg.Rules)); err != nil {
 		level.Error(logger).Log("msg", "limit validation failure", "err", err.Error(), "user", userID)
 		http.Error(w, err.Error(), http.StatusBadRequest)
+		return rulespb.RuleGroup{}, false
+	}
+
+	if err := a.ruler.AssertSourceTenants(userID, rg.SourceTenants); err != nil {
+		level.Error(logger).Log("msg", "source tenants validation failure", "err", err.Error(), "user", userID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return rulespb.RuleGroup{}, false
+	}
+
+	return rg, true
+}
+
+func (a *API) CreateRuleGroup(w http.ResponseWriter, req *http.Request) {
+	logger := util_log.WithContext(req.Context(), a.logger)
+	userID, namespace, _, err := parseRequest(req, true, false)
+	if err != nil {
+		respondError(logger, w, err.Error())
+		return
+	}
+
+	rg, ok := a.parseRuleGroup(w, req, logger, userID)
+	if !ok {
 		return
 	}
 
@@ -495,7 +687,42 @@ func (a *API) CreateRuleGroup(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	rgProto := rulespb.ToProto(userID, namespace, rg)
+	if a.ruler.limits.RulerMaxRulesPerTenant(userID) > 0 {
+		if err := a.store.LoadRuleGroups(req.Context(), map[string]rulespb.RuleGroupList{userID: rgs}); err != nil {
+			level.Error(logger).Log("msg", "unable to load current rule groups for validation", "err", err.Error(), "user", userID)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The rules of the rule group being replaced aren't counted.
+		rules := len(rg.Rules)
+		for _, g := range rgs {
+			if g.Namespace != namespace || g.Name != rg.Name {
+				rules += len(g.Rules)
+			}
+		}
+
+		if err := a.ruler.AssertMaxRulesPerTenant(userID, rules); err != nil {
+			level.Error(logger).Log("msg", "limit validation failure", "err", err.Error(), "user", userID)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rgProto := rulespb.ToProtoWithSourceTenants(userID, namespace, rg)
+
+	collisions, err := a.ruler.metricCollisions.check(req.Context(), userID, rgProto)
+	if err != nil {
+		level.Error(logger).Log("msg", "unable to check the metric collisions of the rule group", "err", err.Error(), "user", userID)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(collisions) > 0 {
+		err := metricCollisionError(collisions)
+		level.Error(logger).Log("msg", "metric collision validation failure", "err", err.Error(), "user", userID)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	level.Debug(logger).Log("msg", "attempting to store rulegroup", "userID", userID, "group", rgProto.String())
 	err = a.store.SetRuleGroup(req.Context(), userID, namespace, rgProto)
@@ -508,6 +735,64 @@ func (a *API) CreateRuleGroup(w http.ResponseWriter, req *http.Request) {
 	respondAccepted(w, logger)
 }
 
+// TestRuleGroup evaluates the rule group of the request body once, at the time of the "time"
+// parameter or now, and returns the samples and alerts the rules would produce. Nothing is
+// stored and no notification is sent.
+func (a *API) TestRuleGroup(w http.ResponseWriter, req *http.Request) {
+	logger := util_log.WithContext(req.Context(), a.logger)
+	userID, _, _, err := parseRequest(req, true, false)
+	if err != nil {
+		respondError(logger, w, err.Error())
+		return
+	}
+
+	if a.dryRun == nil {
+		http.Error(w, ErrDryRunDisabled.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	ts := time.Now()
+	if t := req.URL.Query().Get("time"); t != "" {
+		ms, err := util.ParseTime(t)
+		if err != nil {
+			respondInvalidRequest(logger, w, err.Error())
+			return
+		}
+		ts = util.TimeFromMillis(ms)
+	}
+
+	rg, ok := a.parseRuleGroup(w, req, logger, userID)
+	if !ok {
+		return
+	}
+
+	group, err := a.dryRun.Evaluate(req.Context(), userID, rg, ts)
+	if err != nil {
+		level.Error(logger).Log("msg", "unable to evaluate rule group", "err", err.Error(), "user", userID)
+		if errors.Is(err, context.DeadlineExceeded) {
+			respondErrorWithType(logger, w, v1.ErrTimeout, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		respondError(logger, w, err.Error())
+		return
+	}
+
+	b, err := json.Marshal(&response{
+		Status: "success",
+		Data:   group,
+	})
+	if err != nil {
+		level.Error(logger).Log("msg", "error marshaling json response", "err", err)
+		respondError(logger, w, "unable to marshal the requested data")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if n, err := w.Write(b); err != nil {
+		level.Error(logger).Log("msg", "error writing response", "bytesWritten", n, "err", err)
+	}
+}
+
 func (a *API) DeleteNamespace(w http.ResponseWriter, req *http.Request) {
 	logger := util_log.WithContext(req.Context(), a.logger)
 
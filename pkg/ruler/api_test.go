@@ -10,10 +10,15 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/gorilla/mux"
 	"github.com/grafana/dskit/services"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/util/teststorage"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/user"
 
@@ -28,7 +33,7 @@ func TestRuler_rules(t *testing.T) {
 	defer rcleanup()
 	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
 
-	a := NewAPI(r, r.store, log.NewNopLogger())
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
 
 	req := requestFor(t, "GET", "https://localhost:8080/api/prom/api/v1/rules", nil, "user1")
 	w := httptest.NewRecorder()
@@ -85,7 +90,7 @@ func TestRuler_rules_special_characters(t *testing.T) {
 	defer rcleanup()
 	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
 
-	a := NewAPI(r, r.store, log.NewNopLogger())
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
 
 	req := requestFor(t, http.MethodGet, "https://localhost:8080/api/prom/api/v1/rules", nil, "user1")
 	w := httptest.NewRecorder()
@@ -134,6 +139,143 @@ func TestRuler_rules_special_characters(t *testing.T) {
 	require.Equal(t, string(expectedResponse), string(body))
 }
 
+func TestRuler_rules_filters(t *testing.T) {
+	rules := map[string]rulespb.RuleGroupList{
+		"user1": {
+			&rulespb.RuleGroupDesc{
+				Name:      "group1",
+				Namespace: "namespace1",
+				User:      "user1",
+				Rules: []*rulespb.RuleDesc{
+					{Record: "UP_RULE", Expr: "up"},
+					{Alert: "UP_ALERT", Expr: "up < 1"},
+				},
+				Interval: interval,
+			},
+			&rulespb.RuleGroupDesc{
+				Name:      "group2",
+				Namespace: "namespace2",
+				User:      "user1",
+				Rules: []*rulespb.RuleDesc{
+					{Alert: "DOWN_ALERT", Expr: "up == 0"},
+				},
+				Interval: interval,
+			},
+		},
+	}
+
+	cfg, cleanup := defaultRulerConfig(newMockRuleStore(rules))
+	defer cleanup()
+
+	r, rcleanup := newTestRuler(t, cfg)
+	defer rcleanup()
+	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
+
+	for name, tt := range map[string]struct {
+		query          string
+		expectedStatus int
+		expectedRules  map[string][]string
+	}{
+		"no filters": {
+			query:          "",
+			expectedStatus: http.StatusOK,
+			expectedRules:  map[string][]string{"group1": {"UP_RULE", "UP_ALERT"}, "group2": {"DOWN_ALERT"}},
+		},
+		"alerting rules only": {
+			query:          "?type=alert",
+			expectedStatus: http.StatusOK,
+			expectedRules:  map[string][]string{"group1": {"UP_ALERT"}, "group2": {"DOWN_ALERT"}},
+		},
+		"recording rules only": {
+			query:          "?type=record",
+			expectedStatus: http.StatusOK,
+			expectedRules:  map[string][]string{"group1": {"UP_RULE"}, "group2": {}},
+		},
+		"filter by file": {
+			query:          "?file[]=namespace2",
+			expectedStatus: http.StatusOK,
+			expectedRules:  map[string][]string{"group2": {"DOWN_ALERT"}},
+		},
+		"filter by rule group": {
+			query:          "?rule_group[]=group1&rule_group[]=unknown",
+			expectedStatus: http.StatusOK,
+			expectedRules:  map[string][]string{"group1": {"UP_RULE", "UP_ALERT"}},
+		},
+		"filter by file, rule group and type": {
+			query:          "?file[]=namespace1&rule_group[]=group1&type=record",
+			expectedStatus: http.StatusOK,
+			expectedRules:  map[string][]string{"group1": {"UP_RULE"}},
+		},
+		"invalid type": {
+			query:          "?type=unknown",
+			expectedStatus: http.StatusBadRequest,
+		},
+		"invalid limit": {
+			query:          "?limit=-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := requestFor(t, http.MethodGet, "https://localhost:8080/api/prom/api/v1/rules"+tt.query, nil, "user1")
+			w := httptest.NewRecorder()
+			a.PrometheusRules(w, req)
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			require.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			responseJSON := struct {
+				Status    string `json:"status"`
+				ErrorType string `json:"errorType"`
+				Data      struct {
+					Groups []struct {
+						Name  string `json:"name"`
+						Rules []struct {
+							Name string `json:"name"`
+						} `json:"rules"`
+					} `json:"groups"`
+				} `json:"data"`
+			}{}
+			require.NoError(t, json.Unmarshal(body, &responseJSON))
+
+			if tt.expectedStatus != http.StatusOK {
+				require.Equal(t, "error", responseJSON.Status)
+				require.Equal(t, "bad_data", responseJSON.ErrorType)
+				return
+			}
+
+			actualRules := map[string][]string{}
+			for _, g := range responseJSON.Data.Groups {
+				actualRules[g.Name] = []string{}
+				for _, rl := range g.Rules {
+					actualRules[g.Name] = append(actualRules[g.Name], rl.Name)
+				}
+			}
+			require.Equal(t, tt.expectedRules, actualRules)
+		})
+	}
+}
+
+func TestParseRulesFilter(t *testing.T) {
+	filter, err := parseRulesFilter(httptest.NewRequest(http.MethodGet, "/api/v1/rules?type=alert&limit=2&file[]=ns&rule_group[]=g1&rule_group[]=g2", nil))
+	require.NoError(t, err)
+	require.Equal(t, rulesFilter{
+		alertingRules: true,
+		files:         map[string]struct{}{"ns": {}},
+		groups:        map[string]struct{}{"g1": {}, "g2": {}},
+		alertsLimit:   2,
+	}, filter)
+
+	filter, err = parseRulesFilter(httptest.NewRequest(http.MethodGet, "/api/v1/rules", nil))
+	require.NoError(t, err)
+	require.Equal(t, rulesFilter{alertingRules: true, recordingRules: true}, filter)
+
+	_, err = parseRulesFilter(httptest.NewRequest(http.MethodGet, "/api/v1/rules?limit=abc", nil))
+	require.EqualError(t, err, "invalid query parameter limit='abc'")
+}
+
 func TestRuler_alerts(t *testing.T) {
 	cfg, cleanup := defaultRulerConfig(newMockRuleStore(mockRules))
 	defer cleanup()
@@ -142,7 +284,7 @@ func TestRuler_alerts(t *testing.T) {
 	defer rcleanup()
 	defer r.StopAsync()
 
-	a := NewAPI(r, r.store, log.NewNopLogger())
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
 
 	req := requestFor(t, http.MethodGet, "https://localhost:8080/api/prom/api/v1/alerts", nil, "user1")
 	w := httptest.NewRecorder()
@@ -178,7 +320,7 @@ func TestRuler_Create(t *testing.T) {
 	defer rcleanup()
 	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
 
-	a := NewAPI(r, r.store, log.NewNopLogger())
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
 
 	tc := []struct {
 		name   string
@@ -269,7 +411,7 @@ func TestRuler_DeleteNamespace(t *testing.T) {
 	defer rcleanup()
 	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
 
-	a := NewAPI(r, r.store, log.NewNopLogger())
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
 
 	router := mux.NewRouter()
 	router.Path("/api/v1/rules/{namespace}").Methods(http.MethodDelete).HandlerFunc(a.DeleteNamespace)
@@ -310,7 +452,7 @@ func TestRuler_LimitsPerGroup(t *testing.T) {
 
 	r.limits = &ruleLimits{maxRuleGroups: 1, maxRulesPerRuleGroup: 1}
 
-	a := NewAPI(r, r.store, log.NewNopLogger())
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
 
 	tc := []struct {
 		name   string
@@ -365,7 +507,7 @@ func TestRuler_RulerGroupLimits(t *testing.T) {
 
 	r.limits = &ruleLimits{maxRuleGroups: 1, maxRulesPerRuleGroup: 1}
 
-	a := NewAPI(r, r.store, log.NewNopLogger())
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
 
 	tc := []struct {
 		name   string
@@ -417,6 +559,318 @@ rules:
 	}
 }
 
+func TestRuler_RulesPerTenantLimits(t *testing.T) {
+	cfg, cleanup := defaultRulerConfig(newMockRuleStore(make(map[string]rulespb.RuleGroupList)))
+	defer cleanup()
+
+	r, rcleanup := newTestRuler(t, cfg)
+	defer rcleanup()
+	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+	r.limits = &ruleLimits{maxRuleGroups: 20, maxRulesPerRuleGroup: 15, maxRulesPerTenant: 2}
+
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
+
+	tc := []struct {
+		name   string
+		input  string
+		output string
+		status int
+	}{
+		{
+			name:   "when pushing the first group within bounds of the limit",
+			status: 202,
+			input: `
+name: test_first_group
+interval: 15s
+rules:
+- record: up_rule
+  expr: up{}
+`,
+			output: "{\"status\":\"success\",\"data\":null,\"errorType\":\"\",\"error\":\"\"}",
+		},
+		{
+			name:   "when replacing the first group, its previous rules are not counted",
+			status: 202,
+			input: `
+name: test_first_group
+interval: 15s
+rules:
+- record: up_rule
+  expr: up{}
+- record: up_rule_sum
+  expr: sum(up{})
+`,
+			output: "{\"status\":\"success\",\"data\":null,\"errorType\":\"\",\"error\":\"\"}",
+		},
+		{
+			name:   "when exceeding the rules limit with a second group",
+			status: 400,
+			input: `
+name: test_second_group_will_fail
+interval: 15s
+rules:
+- record: up_rule
+  expr: up{}
+`,
+			output: "per-user rules limit (limit: 2 actual: 3) exceeded\n",
+		},
+	}
+
+	// define once so the requests build on each other so the number of rules can be tested
+	router := mux.NewRouter()
+	router.Path("/api/v1/rules/{namespace}").Methods("POST").HandlerFunc(a.CreateRuleGroup)
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			req := requestFor(t, http.MethodPost, "https://localhost:8080/api/v1/rules/namespace", strings.NewReader(tt.input), "user1")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.output, w.Body.String())
+		})
+	}
+}
+
+func TestRuler_CreateFederatedRuleGroup(t *testing.T) {
+	cfg, cleanup := defaultRulerConfig(newMockRuleStore(make(map[string]rulespb.RuleGroupList)))
+	defer cleanup()
+	cfg.TenantFederation.Enabled = true
+
+	r, rcleanup := newTestRuler(t, cfg)
+	defer rcleanup()
+	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+	r.limits = &ruleLimits{maxRuleGroups: 20, maxRulesPerRuleGroup: 15, allowedSourceTenants: []string{"tenant-a", "tenant-b"}}
+
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
+
+	tc := []struct {
+		name   string
+		input  string
+		output string
+		status int
+	}{
+		{
+			name:   "with a source tenant not allowed",
+			status: 400,
+			input: `
+name: test
+source_tenants: [tenant-a, tenant-c]
+rules:
+- record: up_rule
+  expr: up{}
+`,
+			output: "source tenant tenant-c is not allowed for the tenant user1\n",
+		},
+		{
+			name:   "with allowed source tenants",
+			status: 202,
+			input: `
+name: test
+source_tenants: [tenant-a, tenant-b]
+rules:
+- record: up_rule
+  expr: up{}
+`,
+			output: "{\"status\":\"success\",\"data\":null,\"errorType\":\"\",\"error\":\"\"}",
+		},
+	}
+
+	router := mux.NewRouter()
+	router.Path("/api/v1/rules/{namespace}").Methods("POST").HandlerFunc(a.CreateRuleGroup)
+	router.Path("/api/v1/rules/{namespace}/{groupName}").Methods("GET").HandlerFunc(a.GetRuleGroup)
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			// POST
+			req := requestFor(t, http.MethodPost, "https://localhost:8080/api/v1/rules/namespace", strings.NewReader(tt.input), "user1")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.output, w.Body.String())
+		})
+	}
+
+	// The source tenants are returned with the rule group.
+	req := requestFor(t, http.MethodGet, "https://localhost:8080/api/v1/rules/namespace/test", nil, "user1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "name: test\nrules:\n    - record: up_rule\n      expr: up{}\nsource_tenants:\n    - tenant-a\n    - tenant-b\n", w.Body.String())
+}
+
+func TestRuler_CreateAlignedRuleGroup(t *testing.T) {
+	cfg, cleanup := defaultRulerConfig(newMockRuleStore(make(map[string]rulespb.RuleGroupList)))
+	defer cleanup()
+
+	r, rcleanup := newTestRuler(t, cfg)
+	defer rcleanup()
+	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+	r.limits = &ruleLimits{maxRuleGroups: 20, maxRulesPerRuleGroup: 15}
+
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
+
+	router := mux.NewRouter()
+	router.Path("/api/v1/rules/{namespace}").Methods("POST").HandlerFunc(a.CreateRuleGroup)
+	router.Path("/api/v1/rules/{namespace}/{groupName}").Methods("GET").HandlerFunc(a.GetRuleGroup)
+
+	req := requestFor(t, http.MethodPost, "https://localhost:8080/api/v1/rules/namespace", strings.NewReader(`
+name: test
+align_evaluation_time_on_interval: true
+rules:
+- record: up_rule
+  expr: up{}
+`), "user1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	require.Equal(t, 202, w.Code)
+
+	// The alignment is returned with the rule group.
+	req = requestFor(t, http.MethodGet, "https://localhost:8080/api/v1/rules/namespace/test", nil, "user1")
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "name: test\nrules:\n    - record: up_rule\n      expr: up{}\nalign_evaluation_time_on_interval: true\n", w.Body.String())
+}
+
+func TestRuler_TestRuleGroup(t *testing.T) {
+	cfg, cleanup := defaultRulerConfig(newMockRuleStore(make(map[string]rulespb.RuleGroupList)))
+	defer cleanup()
+
+	r, rcleanup := newTestRuler(t, cfg)
+	defer rcleanup()
+	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+	engine, _, _, _, limits, scleanup := testSetup(t, cfg)
+	defer scleanup()
+
+	// Store the series queried by the rules.
+	ts := time.Unix(1000, 0)
+	db := teststorage.New(t)
+	defer db.Close()
+
+	app := db.Appender(context.Background())
+	_, err := app.Append(0, labels.FromStrings(labels.MetricName, "up", "job", "api"), ts.UnixNano()/int64(time.Millisecond), 1)
+	require.NoError(t, err)
+	_, err = app.Append(0, labels.FromStrings(labels.MetricName, "up", "job", "db"), ts.UnixNano()/int64(time.Millisecond), 0)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	a := NewAPI(r, r.store, NewDryRunEvaluator(cfg, engine, db, limits, log.NewNopLogger()), log.NewNopLogger())
+
+	router := mux.NewRouter()
+	router.Path("/api/v1/rules/{namespace}").Methods("POST").HandlerFunc(a.CreateRuleGroup)
+	router.Path("/api/v1/rules/{namespace}/test").Methods("POST").HandlerFunc(a.TestRuleGroup)
+
+	t.Run("should evaluate the rules without storing the rule group", func(t *testing.T) {
+		req := requestFor(t, http.MethodPost, "https://localhost:8080/api/v1/rules/namespace/test?time=1000", strings.NewReader(`
+name: test
+rules:
+- record: job:up:sum
+  expr: sum by(job) (up)
+- alert: JobDown
+  expr: up == 0
+  for: 5m
+  annotations:
+    summary: "{{ $labels.job }} is down"
+- alert: JobUp
+  expr: up == 1
+`), "user1")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Status string      `json:"status"`
+			Data   DryRunGroup `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, "success", resp.Status)
+		require.Equal(t, "test", resp.Data.Name)
+		require.True(t, ts.Equal(resp.Data.EvaluationTime))
+		require.Len(t, resp.Data.Rules, 3)
+
+		recording := resp.Data.Rules[0]
+		assert.Equal(t, v1.RuleTypeRecording, recording.Type)
+		assert.Equal(t, "ok", recording.Health)
+		assert.ElementsMatch(t, []DryRunSample{
+			{Labels: labels.FromStrings(labels.MetricName, "job:up:sum", "job", "api"), Value: "1e+00"},
+			{Labels: labels.FromStrings(labels.MetricName, "job:up:sum", "job", "db"), Value: "0e+00"},
+		}, recording.Samples)
+
+		// The alert is pending, and would fire after the for-duration.
+		pending := resp.Data.Rules[1]
+		assert.Equal(t, v1.RuleTypeAlerting, pending.Type)
+		assert.Equal(t, "ok", pending.Health)
+		assert.Equal(t, float64(300), pending.Duration)
+		require.Len(t, pending.Alerts, 1)
+		assert.Equal(t, "pending", pending.Alerts[0].State)
+		assert.Equal(t, labels.FromStrings("alertname", "JobDown", "job", "db"), pending.Alerts[0].Labels)
+		assert.Equal(t, labels.FromStrings("summary", "db is down"), pending.Alerts[0].Annotations)
+		assert.True(t, ts.Equal(pending.Alerts[0].ActiveAt))
+		assert.True(t, ts.Add(5*time.Minute).Equal(pending.Alerts[0].FiresAt))
+
+		// The alert without for-duration fires right away.
+		firing := resp.Data.Rules[2]
+		require.Len(t, firing.Alerts, 1)
+		assert.Equal(t, "firing", firing.Alerts[0].State)
+		assert.Equal(t, labels.FromStrings("alertname", "JobUp", "job", "api"), firing.Alerts[0].Labels)
+
+		rgs, err := r.store.ListAllRuleGroups(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, rgs)
+	})
+
+	t.Run("should report the rules failing to evaluate", func(t *testing.T) {
+		// The series have the same labels once the job label is overridden.
+		req := requestFor(t, http.MethodPost, "https://localhost:8080/api/v1/rules/namespace/test?time=1000", strings.NewReader(`
+name: test
+rules:
+- record: up:copy
+  expr: up
+  labels:
+    job: all
+`), "user1")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"health":"err"`)
+	})
+
+	t.Run("should reject an invalid rule group", func(t *testing.T) {
+		req := requestFor(t, http.MethodPost, "https://localhost:8080/api/v1/rules/namespace/test", strings.NewReader(`
+name: test
+`), "user1")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Equal(t, "invalid rules config: rule group 'test' has no rules\n", w.Body.String())
+	})
+
+	t.Run("should reject an invalid time", func(t *testing.T) {
+		req := requestFor(t, http.MethodPost, "https://localhost:8080/api/v1/rules/namespace/test?time=invalid", strings.NewReader(`
+name: test
+rules:
+- record: job:up:sum
+  expr: sum by(job) (up)
+`), "user1")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
 func requestFor(t *testing.T, method string, url string, body io.Reader, userID string) *http.Request {
 	t.Helper()
 
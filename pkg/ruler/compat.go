@@ -3,24 +3,26 @@ package ruler
 import (
 	"context"
 	"errors"
+	"net/url"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/grafana/dskit/backoff"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/prometheus/notifier"
 	"github.com/prometheus/prometheus/pkg/exemplar"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/value"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/rules"
 	"github.com/prometheus/prometheus/storage"
-	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/user"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/querier"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
 )
 
@@ -30,8 +32,9 @@ type Pusher interface {
 }
 
 type PusherAppender struct {
-	failedWrites prometheus.Counter
+	failedWrites *prometheus.CounterVec
 	totalWrites  prometheus.Counter
+	retryCfg     WriteRetryConfig
 
 	ctx             context.Context
 	pusher          Pusher
@@ -39,9 +42,16 @@ type PusherAppender struct {
 	samples         []cortexpb.Sample
 	userID          string
 	evaluationDelay time.Duration
+	ruleGroupLabel  string
 }
 
 func (a *PusherAppender) Append(_ uint64, l labels.Labels, t int64, v float64) (uint64, error) {
+	if a.ruleGroupLabel != "" {
+		// The value is "<namespace>;<group>", like the rule_group label of the rule group metrics.
+		if namespace, group, ok := originRuleGroup(a.ctx); ok {
+			l = labels.NewBuilder(l).Set(a.ruleGroupLabel, namespace+";"+group).Labels()
+		}
+	}
 	a.labels = append(a.labels, l)
 
 	// Adapt staleness markers for ruler evaluation delay. As the upstream code
@@ -70,15 +80,11 @@ func (a *PusherAppender) AppendExemplar(_ uint64, _ labels.Labels, _ exemplar.Ex
 func (a *PusherAppender) Commit() error {
 	a.totalWrites.Inc()
 
-	// Since a.pusher is distributor, client.ReuseSlice will be called in a.pusher.Push.
-	// We shouldn't call client.ReuseSlice here.
-	_, err := a.pusher.Push(user.InjectOrgID(a.ctx, a.userID), cortexpb.ToWriteRequest(a.labels, a.samples, nil, cortexpb.RULE))
-
+	err := a.pushWithRetries()
 	if err != nil {
-		// Don't report errors that ended with 4xx HTTP status code (series limits, duplicate samples, out of order, etc.)
-		if resp, ok := httpgrpc.HTTPResponseFromError(err); !ok || resp.Code/100 != 4 {
-			a.failedWrites.Inc()
-		}
+		reason := writeFailureReason(err)
+		a.failedWrites.WithLabelValues(reason).Inc()
+		err = RuleWriteError{reason: reason, err: err}
 	}
 
 	a.labels = nil
@@ -86,6 +92,50 @@ func (a *PusherAppender) Commit() error {
 	return err
 }
 
+// pushWithRetries pushes the samples, retrying with backoff on 429 and 5xx errors. The retries
+// are given up once the next evaluation of the rule group is due.
+func (a *PusherAppender) pushWithRetries() error {
+	ctx := user.InjectOrgID(a.ctx, a.userID)
+
+	// Since a.pusher is distributor, client.ReuseSlice will be called in a.pusher.Push.
+	// We shouldn't call client.ReuseSlice here, and the request is built again at each retry.
+	_, err := a.pusher.Push(ctx, cortexpb.ToWriteRequest(a.labels, a.samples, nil, cortexpb.RULE))
+	if err == nil || a.retryCfg.MaxRetries <= 0 || writeFailureReason(err) == writeFailureValidation {
+		return err
+	}
+
+	interval, ok := originRuleGroupInterval(a.ctx)
+	if !ok || len(a.samples) == 0 {
+		return err
+	}
+
+	// The samples have the evaluation timestamp, shifted by the evaluation delay.
+	evaluationTime := a.samples[0].TimestampMs
+	for _, s := range a.samples {
+		if s.TimestampMs < evaluationTime {
+			evaluationTime = s.TimestampMs
+		}
+	}
+	nextEvaluation := util.TimeFromMillis(evaluationTime).Add(a.evaluationDelay + interval)
+
+	ctx, cancel := context.WithDeadline(ctx, nextEvaluation)
+	defer cancel()
+
+	retries := backoff.New(ctx, a.retryCfg.backoffConfig())
+	for retries.Ongoing() {
+		retries.Wait()
+		if ctx.Err() != nil {
+			break
+		}
+
+		_, err = a.pusher.Push(ctx, cortexpb.ToWriteRequest(a.labels, a.samples, nil, cortexpb.RULE))
+		if err == nil || writeFailureReason(err) == writeFailureValidation {
+			return err
+		}
+	}
+	return err
+}
+
 func (a *PusherAppender) Rollback() error {
 	a.labels = nil
 	a.samples = nil
@@ -98,17 +148,24 @@ type PusherAppendable struct {
 	userID      string
 	rulesLimits RulesLimits
 
+	retryCfg WriteRetryConfig
+
+	// Label added to the samples, set to their rule group. Empty to disable.
+	ruleGroupLabel string
+
 	totalWrites  prometheus.Counter
-	failedWrites prometheus.Counter
+	failedWrites *prometheus.CounterVec
 }
 
-func NewPusherAppendable(pusher Pusher, userID string, limits RulesLimits, totalWrites, failedWrites prometheus.Counter) *PusherAppendable {
+func NewPusherAppendable(pusher Pusher, userID string, limits RulesLimits, retryCfg WriteRetryConfig, ruleGroupLabel string, totalWrites prometheus.Counter, failedWrites *prometheus.CounterVec) *PusherAppendable {
 	return &PusherAppendable{
-		pusher:       pusher,
-		userID:       userID,
-		rulesLimits:  limits,
-		totalWrites:  totalWrites,
-		failedWrites: failedWrites,
+		pusher:         pusher,
+		userID:         userID,
+		rulesLimits:    limits,
+		retryCfg:       retryCfg,
+		ruleGroupLabel: ruleGroupLabel,
+		totalWrites:    totalWrites,
+		failedWrites:   failedWrites,
 	}
 }
 
@@ -117,11 +174,13 @@ func (t *PusherAppendable) Appender(ctx context.Context) storage.Appender {
 	return &PusherAppender{
 		failedWrites: t.failedWrites,
 		totalWrites:  t.totalWrites,
+		retryCfg:     t.retryCfg,
 
 		ctx:             ctx,
 		pusher:          t.pusher,
 		userID:          t.userID,
 		evaluationDelay: t.rulesLimits.EvaluationDelay(t.userID),
+		ruleGroupLabel:  t.ruleGroupLabel,
 	}
 }
 
@@ -131,6 +190,25 @@ type RulesLimits interface {
 	RulerTenantShardSize(userID string) int
 	RulerMaxRuleGroupsPerTenant(userID string) int
 	RulerMaxRulesPerRuleGroup(userID string) int
+	RulerNotificationQueueCapacity(userID string) int
+	RulerAllowedSourceTenants(userID string) []string
+	RulerMaxRulesPerTenant(userID string) int
+	RulerExternalLabels(userID string) labels.Labels
+	RulerExternalURL(userID string) string
+	RulerProtectExistingMetrics(userID string) bool
+	RulerDeliveryTraceSampleRatio(userID string) float64
+}
+
+// tenantExternalURL returns the external URL of the alerts of the tenant, defaulting to the
+// -ruler.external.url one.
+func tenantExternalURL(cfg Config, overrides RulesLimits, userID string) flagext.URLValue {
+	if rawURL := overrides.RulerExternalURL(userID); rawURL != "" {
+		// The URL is validated with the limits.
+		if u, err := url.Parse(rawURL); err == nil {
+			return flagext.URLValue{URL: u}
+		}
+	}
+	return cfg.ExternalURL
 }
 
 // EngineQueryFunc returns a new query function using the rules.EngineQueryFunc function
@@ -219,18 +297,36 @@ type RulesManager interface {
 	RuleGroups() []*rules.Group
 }
 
-// ManagerFactory is a function that creates new RulesManager for given user and notifier.Manager.
-type ManagerFactory func(ctx context.Context, userID string, notifier *notifier.Manager, logger log.Logger, reg prometheus.Registerer) RulesManager
+// ManagerFactory is a function that creates new RulesManager for given user and notifications Sender.
+type ManagerFactory func(ctx context.Context, userID string, notifier Sender, logger log.Logger, reg prometheus.Registerer) RulesManager
 
 func DefaultTenantManagerFactory(cfg Config, p Pusher, q storage.Queryable, engine *promql.Engine, overrides RulesLimits, reg prometheus.Registerer) ManagerFactory {
+	return newTenantManagerFactory(cfg, p, q, func(q storage.Queryable, userID string) rules.QueryFunc {
+		return EngineQueryFunc(engine, q, overrides, userID)
+	}, overrides, reg)
+}
+
+// FrontendTenantManagerFactory returns a ManagerFactory whose rules managers evaluate the rule
+// queries through the query-frontend. The queryable is only used to restore the state of the
+// alerts after a restart.
+func FrontendTenantManagerFactory(cfg Config, p Pusher, q storage.Queryable, frontend *FrontendClient, overrides RulesLimits, reg prometheus.Registerer) ManagerFactory {
+	return newTenantManagerFactory(cfg, p, q, func(_ storage.Queryable, userID string) rules.QueryFunc {
+		return frontend.QueryFunc(overrides, userID)
+	}, overrides, reg)
+}
+
+func newTenantManagerFactory(cfg Config, p Pusher, q storage.Queryable, newQueryFunc func(q storage.Queryable, userID string) rules.QueryFunc, overrides RulesLimits, reg prometheus.Registerer) ManagerFactory {
 	totalWrites := promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "cortex_ruler_write_requests_total",
 		Help: "Number of write requests to ingesters.",
 	})
-	failedWrites := promauto.With(reg).NewCounter(prometheus.CounterOpts{
+	failedWrites := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 		Name: "cortex_ruler_write_requests_failed_total",
-		Help: "Number of failed write requests to ingesters.",
-	})
+		Help: "Number of failed write requests to ingesters, after the retries.",
+	}, []string{"reason"})
+	for _, reason := range []string{writeFailureRateLimited, writeFailureValidation, writeFailureUnavailable} {
+		failedWrites.WithLabelValues(reason)
+	}
 
 	totalQueries := promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "cortex_ruler_queries_total",
@@ -253,25 +349,29 @@ func DefaultTenantManagerFactory(cfg Config, p Pusher, q storage.Queryable, engi
 	// Errors from PromQL are always "user" errors.
 	q = querier.NewErrorTranslateQueryableWithFn(q, WrapQueryableErrors)
 
-	return func(ctx context.Context, userID string, notifier *notifier.Manager, logger log.Logger, reg prometheus.Registerer) RulesManager {
+	return func(ctx context.Context, userID string, notifier Sender, logger log.Logger, reg prometheus.Registerer) RulesManager {
 		var queryTime prometheus.Counter = nil
 		if rulerQuerySeconds != nil {
 			queryTime = rulerQuerySeconds.WithLabelValues(userID)
 		}
 
-		return rules.NewManager(&rules.ManagerOptions{
-			Appendable:      NewPusherAppendable(p, userID, overrides, totalWrites, failedWrites),
-			Queryable:       q,
-			QueryFunc:       RecordAndReportRuleQueryMetrics(MetricsQueryFunc(EngineQueryFunc(engine, q, overrides, userID), totalQueries, failedQueries), queryTime, logger),
+		queryFunc := FederatedQueryFunc(newQueryFunc(q, userID), cfg.TenantFederation, overrides, userID, originSourceTenants)
+		queryFunc = RuleEvaluationStatsQueryFunc(queryFunc)
+		externalURL := tenantExternalURL(cfg, overrides, userID)
+
+		return newScheduledManager(&rules.ManagerOptions{
+			Appendable:      NewPusherAppendable(p, userID, overrides, cfg.WriteRetry, cfg.MetricProvenance.ruleGroupLabel(), totalWrites, failedWrites),
+			Queryable:       alertStateQueryable{q},
+			QueryFunc:       RecordAndReportRuleQueryMetrics(MetricsQueryFunc(queryFunc, totalQueries, failedQueries), queryTime, logger),
 			Context:         user.InjectOrgID(ctx, userID),
-			ExternalURL:     cfg.ExternalURL.URL,
-			NotifyFunc:      SendAlerts(notifier, cfg.ExternalURL.URL.String()),
+			ExternalURL:     externalURL.URL,
+			NotifyFunc:      SendAlerts(newDeliveryTracingSender(notifier, overrides, userID, logger), externalURL.String()),
 			Logger:          log.With(logger, "user", userID),
 			Registerer:      reg,
 			OutageTolerance: cfg.OutageTolerance,
 			ForGracePeriod:  cfg.ForGracePeriod,
 			ResendDelay:     cfg.ResendDelay,
-		})
+		}, cfg.EvaluationMaxJitter)
 	}
 }
 
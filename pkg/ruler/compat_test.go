@@ -12,6 +12,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/value"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/promql/parser"
@@ -19,6 +20,8 @@ import (
 	"github.com/weaveworks/common/httpgrpc"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/util"
 )
 
 type fakePusher struct {
@@ -34,7 +37,7 @@ func (p *fakePusher) Push(ctx context.Context, r *cortexpb.WriteRequest) (*corte
 
 func TestPusherAppendable(t *testing.T) {
 	pusher := &fakePusher{}
-	pa := NewPusherAppendable(pusher, "user-1", nil, prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounter(prometheus.CounterOpts{}))
+	pa := NewPusherAppendable(pusher, "user-1", nil, WriteRetryConfig{}, "", prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"reason"}))
 
 	for _, tc := range []struct {
 		name       string
@@ -117,33 +120,67 @@ func TestPusherAppendable(t *testing.T) {
 	}
 }
 
+func TestPusherAppendable_ShouldAddTheRuleGroupLabel(t *testing.T) {
+	pusher := &fakePusher{response: &cortexpb.WriteResponse{}}
+	pa := NewPusherAppendable(pusher, "user-1", &ruleLimits{}, WriteRetryConfig{}, "__rule_group__", prometheus.NewCounter(prometheus.CounterOpts{}), prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"reason"}))
+
+	t.Run("should add the label to the samples of the rule group", func(t *testing.T) {
+		ctx := promql.NewOriginContext(context.Background(), map[string]interface{}{
+			"ruleGroup": map[string]string{"file": "/rules/user-1/namespace1", "name": "group1"},
+		})
+
+		a := pa.Appender(ctx)
+		_, err := a.Append(0, labels.FromStrings(labels.MetricName, "job:up:sum", "job", "api"), 120_000, 1)
+		require.NoError(t, err)
+		require.NoError(t, a.Commit())
+
+		require.Equal(t, labels.FromStrings(labels.MetricName, "job:up:sum", "__rule_group__", "namespace1;group1", "job", "api"),
+			cortexpb.FromLabelAdaptersToLabels(pusher.request.Timeseries[0].Labels))
+	})
+
+	t.Run("should keep the labels unchanged outside a rule group", func(t *testing.T) {
+		a := pa.Appender(context.Background())
+		_, err := a.Append(0, labels.FromStrings(labels.MetricName, "job:up:sum", "job", "api"), 120_000, 1)
+		require.NoError(t, err)
+		require.NoError(t, a.Commit())
+
+		require.Equal(t, labels.FromStrings(labels.MetricName, "job:up:sum", "job", "api"),
+			cortexpb.FromLabelAdaptersToLabels(pusher.request.Timeseries[0].Labels))
+	})
+}
+
 func TestPusherErrors(t *testing.T) {
 	for name, tc := range map[string]struct {
 		returnedError    error
 		expectedWrites   int
-		expectedFailures int
+		expectedFailures map[string]int
 	}{
 		"no error": {
-			expectedWrites:   1,
-			expectedFailures: 0,
+			expectedWrites: 1,
 		},
 
 		"400 error": {
 			returnedError:    httpgrpc.Errorf(http.StatusBadRequest, "test error"),
 			expectedWrites:   1,
-			expectedFailures: 0, // 400 errors not reported as failures.
+			expectedFailures: map[string]int{writeFailureValidation: 1},
+		},
+
+		"429 error": {
+			returnedError:    httpgrpc.Errorf(http.StatusTooManyRequests, "test error"),
+			expectedWrites:   1,
+			expectedFailures: map[string]int{writeFailureRateLimited: 1},
 		},
 
 		"500 error": {
 			returnedError:    httpgrpc.Errorf(http.StatusInternalServerError, "test error"),
 			expectedWrites:   1,
-			expectedFailures: 1, // 500 errors are failures
+			expectedFailures: map[string]int{writeFailureUnavailable: 1},
 		},
 
 		"unknown error": {
 			returnedError:    errors.New("test error"),
 			expectedWrites:   1,
-			expectedFailures: 1, // unknown errors are not 400, so they are reported.
+			expectedFailures: map[string]int{writeFailureUnavailable: 1}, // unknown errors are not 4xx, so they are unavailable.
 		},
 	} {
 		t.Run(name, func(t *testing.T) {
@@ -152,9 +189,9 @@ func TestPusherErrors(t *testing.T) {
 			pusher := &fakePusher{err: tc.returnedError, response: &cortexpb.WriteResponse{}}
 
 			writes := prometheus.NewCounter(prometheus.CounterOpts{})
-			failures := prometheus.NewCounter(prometheus.CounterOpts{})
+			failures := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"reason"})
 
-			pa := NewPusherAppendable(pusher, "user-1", ruleLimits{evalDelay: 10 * time.Second}, writes, failures)
+			pa := NewPusherAppendable(pusher, "user-1", ruleLimits{evalDelay: 10 * time.Second}, WriteRetryConfig{}, "", writes, failures)
 
 			lbls, err := parser.ParseMetric("foo_bar")
 			require.NoError(t, err)
@@ -163,14 +200,115 @@ func TestPusherErrors(t *testing.T) {
 			_, err = a.Append(0, lbls, int64(model.Now()), 123456)
 			require.NoError(t, err)
 
-			require.Equal(t, tc.returnedError, a.Commit())
+			err = a.Commit()
+			if tc.returnedError == nil {
+				require.NoError(t, err)
+			} else {
+				require.True(t, errors.Is(err, tc.returnedError))
+				require.True(t, errors.As(err, &RuleWriteError{}))
+			}
 
 			require.Equal(t, tc.expectedWrites, int(testutil.ToFloat64(writes)))
-			require.Equal(t, tc.expectedFailures, int(testutil.ToFloat64(failures)))
+			for _, reason := range []string{writeFailureRateLimited, writeFailureValidation, writeFailureUnavailable} {
+				require.Equal(t, tc.expectedFailures[reason], int(testutil.ToFloat64(failures.WithLabelValues(reason))), reason)
+			}
 		})
 	}
 }
 
+func TestPusherAppender_ShouldRetryTheRetriableErrors(t *testing.T) {
+	rateLimited := httpgrpc.Errorf(http.StatusTooManyRequests, "rate limited")
+	invalid := httpgrpc.Errorf(http.StatusBadRequest, "invalid")
+	now := time.Now()
+
+	for name, tc := range map[string]struct {
+		errs             []error
+		interval         time.Duration
+		evaluationTime   time.Time
+		expectedPushes   int
+		expectedErr      error
+		expectedFailures map[string]int
+	}{
+		"should retry 429 and 5xx errors": {
+			errs:           []error{rateLimited, httpgrpc.Errorf(http.StatusServiceUnavailable, "unavailable")},
+			interval:       time.Minute,
+			evaluationTime: now,
+			expectedPushes: 3,
+		},
+		"should not retry 4xx errors": {
+			errs:             []error{invalid},
+			interval:         time.Minute,
+			evaluationTime:   now,
+			expectedPushes:   1,
+			expectedErr:      invalid,
+			expectedFailures: map[string]int{writeFailureValidation: 1},
+		},
+		"should give up after the max retries": {
+			errs:             []error{rateLimited, rateLimited, rateLimited, rateLimited, rateLimited},
+			interval:         time.Minute,
+			evaluationTime:   now,
+			expectedPushes:   4,
+			expectedErr:      rateLimited,
+			expectedFailures: map[string]int{writeFailureRateLimited: 1},
+		},
+		"should not retry once the next evaluation is due": {
+			errs:             []error{rateLimited},
+			interval:         time.Minute,
+			evaluationTime:   now.Add(-time.Minute),
+			expectedPushes:   1,
+			expectedErr:      rateLimited,
+			expectedFailures: map[string]int{writeFailureRateLimited: 1},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pusher := &sequencePusher{errs: tc.errs}
+			writes := prometheus.NewCounter(prometheus.CounterOpts{})
+			failures := prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"reason"})
+			retryCfg := WriteRetryConfig{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxRetries: 3}
+
+			intervals := newRuleGroupIntervals()
+			intervals.update(rulespb.RuleGroupList{&rulespb.RuleGroupDesc{Name: "group", Namespace: "ns", Interval: tc.interval}}, 0)
+			ctx := promql.NewOriginContext(contextWithRuleGroupIntervals(context.Background(), intervals), map[string]interface{}{
+				"ruleGroup": map[string]string{"file": "/rules/user-1/ns", "name": "group"},
+			})
+
+			pa := NewPusherAppendable(pusher, "user-1", ruleLimits{}, retryCfg, "", writes, failures)
+			a := pa.Appender(ctx)
+			_, err := a.Append(0, labels.FromStrings(labels.MetricName, "foo_bar"), util.TimeToMillis(tc.evaluationTime), 1)
+			require.NoError(t, err)
+
+			err = a.Commit()
+			if tc.expectedErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.True(t, errors.Is(err, tc.expectedErr))
+			}
+
+			require.Equal(t, tc.expectedPushes, pusher.pushes)
+			require.Equal(t, 1, int(testutil.ToFloat64(writes)))
+			for _, reason := range []string{writeFailureRateLimited, writeFailureValidation, writeFailureUnavailable} {
+				require.Equal(t, tc.expectedFailures[reason], int(testutil.ToFloat64(failures.WithLabelValues(reason))), reason)
+			}
+		})
+	}
+}
+
+// sequencePusher returns the errors in sequence, then succeeds.
+type sequencePusher struct {
+	errs   []error
+	pushes int
+}
+
+func (p *sequencePusher) Push(_ context.Context, r *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+	p.pushes++
+	cortexpb.ReuseSlice(r.Timeseries)
+
+	if p.pushes <= len(p.errs) {
+		return nil, p.errs[p.pushes-1]
+	}
+	return &cortexpb.WriteResponse{}, nil
+}
+
 func TestMetricsQueryFuncErrors(t *testing.T) {
 	for name, tc := range map[string]struct {
 		returnedError         error
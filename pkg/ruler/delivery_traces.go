@@ -0,0 +1,57 @@
+package ruler
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// deliveryTraceIDAnnotation is the annotation of the alerts carrying their delivery trace ID,
+// logged by the Cortex Alertmanager when notifying them.
+const deliveryTraceIDAnnotation = "cortex_delivery_trace_id"
+
+// deliveryTracingSender adds a delivery trace ID to a sample of the alerts sent to the
+// Alertmanager, configured by the per-tenant -ruler.delivery-trace-sample-ratio, and logs it
+// with the labels of the alert. The Alertmanager logs it with the fingerprint of the alert,
+// which is only known once the external labels have been added by the notifier.
+type deliveryTracingSender struct {
+	next   Sender
+	limits RulesLimits
+	userID string
+	logger log.Logger
+}
+
+func newDeliveryTracingSender(next Sender, limits RulesLimits, userID string, logger log.Logger) Sender {
+	return &deliveryTracingSender{
+		next:   next,
+		limits: limits,
+		userID: userID,
+		logger: log.With(logger, "user", userID),
+	}
+}
+
+func (s *deliveryTracingSender) Send(alerts ...*notifier.Alert) {
+	ratio := s.limits.RulerDeliveryTraceSampleRatio(s.userID)
+	if ratio <= 0 {
+		s.next.Send(alerts...)
+		return
+	}
+
+	for _, a := range alerts {
+		if rand.Float64() >= ratio {
+			continue
+		}
+
+		// The annotations may be shared with the alert of the rule, so they're copied.
+		traceID := fmt.Sprintf("%016x", rand.Uint64())
+		a.Annotations = labels.NewBuilder(a.Annotations).Set(deliveryTraceIDAnnotation, traceID).Labels()
+
+		level.Info(s.logger).Log("msg", "sending alert with delivery trace", "delivery_trace_id", traceID, "alert", a.Name(), "labels", a.Labels.String(), "resolved", a.Resolved())
+	}
+
+	s.next.Send(alerts...)
+}
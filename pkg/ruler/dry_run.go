@@ -0,0 +1,181 @@
+package ruler
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	promRules "github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+)
+
+// DryRunGroup is the result of the dry-run evaluation of a rule group.
+type DryRunGroup struct {
+	Name           string        `json:"name"`
+	EvaluationTime time.Time     `json:"evaluationTime"`
+	Rules          []*DryRunRule `json:"rules"`
+}
+
+// DryRunRule is the result of the dry-run evaluation of a rule. Recording rules report the
+// samples they would record, alerting rules the alerts they would send.
+type DryRunRule struct {
+	Name      string         `json:"name"`
+	Query     string         `json:"query"`
+	Type      v1.RuleType    `json:"type"`
+	Duration  float64        `json:"duration,omitempty"`
+	Samples   []DryRunSample `json:"samples,omitempty"`
+	Alerts    []DryRunAlert  `json:"alerts,omitempty"`
+	Health    string         `json:"health"`
+	LastError string         `json:"lastError,omitempty"`
+}
+
+// DryRunSample is a sample a recording rule would record.
+type DryRunSample struct {
+	Labels labels.Labels `json:"labels"`
+	Value  string        `json:"value"`
+}
+
+// DryRunAlert is an alert an alerting rule would send.
+type DryRunAlert struct {
+	Labels      labels.Labels `json:"labels"`
+	Annotations labels.Labels `json:"annotations"`
+	// State is "firing" if the alert would be sent right away, or "pending" if it
+	// would be sent at FiresAt, given that the rule keeps returning it until then.
+	State    string    `json:"state"`
+	ActiveAt time.Time `json:"activeAt"`
+	FiresAt  time.Time `json:"firesAt"`
+	Value    string    `json:"value"`
+}
+
+// DryRunEvaluator evaluates rule groups once, bypassing the rules managers: the samples of
+// the recording rules aren't stored and the alerts of the alerting rules aren't sent.
+type DryRunEvaluator struct {
+	cfg       Config
+	engine    *promql.Engine
+	queryable storage.Queryable
+	limits    RulesLimits
+	logger    log.Logger
+}
+
+// NewDryRunEvaluator returns a DryRunEvaluator querying the queryable of the ruler.
+func NewDryRunEvaluator(cfg Config, engine *promql.Engine, queryable storage.Queryable, limits RulesLimits, logger log.Logger) *DryRunEvaluator {
+	return &DryRunEvaluator{
+		cfg:       cfg,
+		engine:    engine,
+		queryable: queryable,
+		limits:    limits,
+		logger:    logger,
+	}
+}
+
+// Evaluate evaluates each rule of the group once at ts, with the evaluation delay of the tenant.
+// The rules are evaluated independently of each other, so a rule doesn't see the series the
+// previous rules of the group would record.
+func (e *DryRunEvaluator) Evaluate(ctx context.Context, userID string, rg rulespb.RuleGroup, ts time.Time) (*DryRunGroup, error) {
+	ctx, cancel := context.WithTimeout(user.InjectOrgID(ctx, userID), e.cfg.DryRunTimeout)
+	defer cancel()
+
+	sourceTenants := func(context.Context) []string { return rg.SourceTenants }
+	queryFunc := FederatedQueryFunc(EngineQueryFunc(e.engine, e.queryable, e.limits, userID), e.cfg.TenantFederation, e.limits, userID, sourceTenants)
+	group := &DryRunGroup{
+		Name:           rg.Name,
+		EvaluationTime: ts,
+		Rules:          make([]*DryRunRule, 0, len(rg.Rules)),
+	}
+
+	for _, r := range rg.Rules {
+		expr, err := parser.ParseExpr(r.Expr.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		var res *DryRunRule
+		if r.Alert.Value != "" {
+			res = e.evaluateAlertingRule(ctx, r, expr, ts, queryFunc)
+		} else {
+			res = e.evaluateRecordingRule(ctx, r, expr, ts, queryFunc)
+		}
+
+		if ctx.Err() != nil {
+			return nil, errors.Wrapf(ctx.Err(), "evaluation of the rule group %s", rg.Name)
+		}
+		group.Rules = append(group.Rules, res)
+	}
+
+	return group, nil
+}
+
+func (e *DryRunEvaluator) evaluateRecordingRule(ctx context.Context, r rulefmt.RuleNode, expr parser.Expr, ts time.Time, queryFunc promRules.QueryFunc) *DryRunRule {
+	rule := promRules.NewRecordingRule(r.Record.Value, expr, labels.FromMap(r.Labels))
+	res := &DryRunRule{
+		Name:  rule.Name(),
+		Query: rule.Query().String(),
+		Type:  v1.RuleTypeRecording,
+	}
+
+	vector, err := rule.Eval(ctx, ts, queryFunc, e.cfg.ExternalURL.URL)
+	if err != nil {
+		res.Health = string(promRules.HealthBad)
+		res.LastError = err.Error()
+		return res
+	}
+
+	res.Health = string(promRules.HealthGood)
+	for _, s := range vector {
+		res.Samples = append(res.Samples, DryRunSample{
+			Labels: s.Metric,
+			Value:  strconv.FormatFloat(s.V, 'e', -1, 64),
+		})
+	}
+	return res
+}
+
+func (e *DryRunEvaluator) evaluateAlertingRule(ctx context.Context, r rulefmt.RuleNode, expr parser.Expr, ts time.Time, queryFunc promRules.QueryFunc) *DryRunRule {
+	// The rule isn't restored, so that the evaluation doesn't return the ALERTS series.
+	rule := promRules.NewAlertingRule(
+		r.Alert.Value,
+		expr,
+		time.Duration(r.For),
+		labels.FromMap(r.Labels),
+		labels.FromMap(r.Annotations),
+		nil,
+		e.cfg.ExternalURL.String(),
+		false,
+		log.With(e.logger, "alert", r.Alert.Value),
+	)
+	res := &DryRunRule{
+		Name:     rule.Name(),
+		Query:    rule.Query().String(),
+		Type:     v1.RuleTypeAlerting,
+		Duration: rule.HoldDuration().Seconds(),
+	}
+
+	if _, err := rule.Eval(ctx, ts, queryFunc, e.cfg.ExternalURL.URL); err != nil {
+		res.Health = string(promRules.HealthBad)
+		res.LastError = err.Error()
+		return res
+	}
+
+	res.Health = string(promRules.HealthGood)
+	for _, a := range rule.ActiveAlerts() {
+		res.Alerts = append(res.Alerts, DryRunAlert{
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			State:       a.State.String(),
+			ActiveAt:    a.ActiveAt,
+			FiresAt:     a.ActiveAt.Add(rule.HoldDuration()),
+			Value:       strconv.FormatFloat(a.Value, 'e', -1, 64),
+		})
+	}
+	return res
+}
@@ -0,0 +1,359 @@
+package ruler
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+)
+
+type alignedGroupKey struct {
+	namespace string
+	name      string
+}
+
+// alignedGroups holds the rule groups of a user whose evaluation time is aligned on their
+// evaluation interval, so that they can be looked up when the rule groups are evaluated by the
+// Prometheus rules manager.
+type alignedGroups struct {
+	mtx    sync.RWMutex
+	groups map[alignedGroupKey]struct{}
+}
+
+func newAlignedGroups() *alignedGroups {
+	return &alignedGroups{groups: map[alignedGroupKey]struct{}{}}
+}
+
+func (g *alignedGroups) update(groups rulespb.RuleGroupList) {
+	aligned := map[alignedGroupKey]struct{}{}
+	for _, group := range groups {
+		if group.GetAlignEvaluationTimeOnInterval() {
+			aligned[alignedGroupKey{namespace: group.GetNamespace(), name: group.GetName()}] = struct{}{}
+		}
+	}
+
+	g.mtx.Lock()
+	g.groups = aligned
+	g.mtx.Unlock()
+}
+
+func (g *alignedGroups) contains(namespace, name string) bool {
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+
+	_, ok := g.groups[alignedGroupKey{namespace: namespace, name: name}]
+	return ok
+}
+
+type alignedGroupsContextKey struct{}
+
+func contextWithAlignedGroups(ctx context.Context, groups *alignedGroups) context.Context {
+	return context.WithValue(ctx, alignedGroupsContextKey{}, groups)
+}
+
+// scheduledManager is a rules manager evaluating each rule group at a slot within its evaluation
+// interval: the start of the interval for the rule groups aligning their evaluation time on the
+// interval and, if maxJitter is greater than 0, an offset lower than maxJitter computed from the
+// hash of the rule group for the other ones. Otherwise, the rule groups are evaluated at the offset
+// computed by the Prometheus rules manager. The rule groups are loaded by the Prometheus rules
+// manager, but evaluated by the scheduledManager, because the Prometheus one doesn't support
+// configuring the offset.
+type scheduledManager struct {
+	*rules.Manager
+
+	opts      *rules.ManagerOptions
+	aligned   *alignedGroups
+	maxJitter time.Duration
+	logger    log.Logger
+
+	mtx      sync.RWMutex
+	groups   map[string]*scheduledGroup
+	restored bool
+
+	// Closed once the manager runs, to start evaluating the rule groups.
+	block chan struct{}
+	// Closed once the manager is stopped.
+	done chan struct{}
+}
+
+// scheduledGroup is a rule group evaluated by the scheduledManager.
+type scheduledGroup struct {
+	*rules.Group
+
+	shouldRestore bool
+	done          chan struct{}
+	terminated    chan struct{}
+}
+
+func newScheduledManager(opts *rules.ManagerOptions, maxJitter time.Duration) *scheduledManager {
+	aligned, _ := opts.Context.Value(alignedGroupsContextKey{}).(*alignedGroups)
+
+	return &scheduledManager{
+		// The Prometheus rules manager sets the default metrics and group loader of the options.
+		Manager:   rules.NewManager(opts),
+		opts:      opts,
+		aligned:   aligned,
+		maxJitter: maxJitter,
+		logger:    opts.Logger,
+		groups:    map[string]*scheduledGroup{},
+		block:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Run implements RulesManager.
+func (m *scheduledManager) Run() {
+	close(m.block)
+	<-m.done
+}
+
+// Stop implements RulesManager.
+func (m *scheduledManager) Stop() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	level.Info(m.logger).Log("msg", "Stopping rule manager...")
+
+	for _, g := range m.groups {
+		g.stop()
+	}
+	close(m.done)
+
+	level.Info(m.logger).Log("msg", "Rule manager stopped")
+}
+
+// Update implements RulesManager. Like the Prometheus rules manager, the unchanged rule groups keep
+// being evaluated, the state of the changed ones is copied to the new ones, and the series of the
+// removed ones are marked stale. If loading the new rules fails, the old rule groups are kept.
+func (m *scheduledManager) Update(interval time.Duration, files []string, externalLabels labels.Labels, externalURL string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	loaded, errs := m.LoadGroups(interval, externalLabels, externalURL, files...)
+	if errs != nil {
+		for _, err := range errs {
+			level.Error(m.logger).Log("msg", "loading groups failed", "err", err)
+		}
+		return errors.New("error loading rules, previous rule set restored")
+	}
+
+	// The state of the alerts is restored from the storage only for the rule groups loaded first,
+	// like the Prometheus rules manager does.
+	shouldRestore := !m.restored
+	m.restored = true
+
+	groups := make(map[string]*scheduledGroup, len(loaded))
+	var wg sync.WaitGroup
+	for key, newg := range loaded {
+		oldg, ok := m.groups[key]
+		delete(m.groups, key)
+
+		if ok && oldg.Equals(newg) {
+			groups[key] = oldg
+			continue
+		}
+
+		if !shouldRestore {
+			for _, rule := range newg.AlertingRules() {
+				rule.SetRestored(true)
+			}
+		}
+
+		g := &scheduledGroup{
+			Group:         newg,
+			shouldRestore: shouldRestore,
+			done:          make(chan struct{}),
+			terminated:    make(chan struct{}),
+		}
+		groups[key] = g
+
+		wg.Add(1)
+		go func() {
+			if ok {
+				oldg.stop()
+				g.CopyState(oldg.Group)
+			}
+			wg.Done()
+
+			// The rule groups aren't evaluated until the manager runs, to avoid running queries
+			// against a bootstrapping storage.
+			select {
+			case <-m.block:
+				m.run(g)
+			case <-g.done:
+				close(g.terminated)
+			}
+		}()
+	}
+
+	// Stop the remaining old rule groups.
+	wg.Add(len(m.groups))
+	for key, oldg := range m.groups {
+		go func(key string, g *scheduledGroup) {
+			defer wg.Done()
+
+			g.stop()
+			go m.markStale(g, time.Now())
+
+			metrics := m.opts.Metrics
+			metrics.IterationsMissed.DeleteLabelValues(key)
+			metrics.IterationsScheduled.DeleteLabelValues(key)
+			metrics.EvalTotal.DeleteLabelValues(key)
+			metrics.EvalFailures.DeleteLabelValues(key)
+			metrics.GroupInterval.DeleteLabelValues(key)
+			metrics.GroupLastEvalTime.DeleteLabelValues(key)
+			metrics.GroupLastDuration.DeleteLabelValues(key)
+			metrics.GroupRules.DeleteLabelValues(key)
+			metrics.GroupSamples.DeleteLabelValues(key)
+		}(key, oldg)
+	}
+
+	wg.Wait()
+	m.groups = groups
+	return nil
+}
+
+// RuleGroups implements RulesManager.
+func (m *scheduledManager) RuleGroups() []*rules.Group {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	groups := make([]*rules.Group, 0, len(m.groups))
+	for _, g := range m.groups {
+		groups = append(groups, g.Group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].File() != groups[j].File() {
+			return groups[i].File() < groups[j].File()
+		}
+		return groups[i].Name() < groups[j].Name()
+	})
+	return groups
+}
+
+// run evaluates the rule group at each of its slots, until the rule group is stopped.
+func (m *scheduledManager) run(g *scheduledGroup) {
+	defer close(g.terminated)
+
+	key := rules.GroupKey(g.File(), g.Name())
+	ctx := promql.NewOriginContext(m.opts.Context, map[string]interface{}{
+		"ruleGroup": map[string]string{
+			"file": g.File(),
+			"name": g.Name(),
+		},
+	})
+
+	evalTimestamp := evaluationSlot(time.Now(), g.Interval(), m.evaluationOffset(g.Group))
+	for iterations := 0; ; iterations++ {
+		timer := time.NewTimer(time.Until(evalTimestamp))
+		select {
+		case <-timer.C:
+		case <-g.done:
+			timer.Stop()
+			return
+		}
+
+		m.opts.Metrics.IterationsScheduled.WithLabelValues(key).Inc()
+
+		start := time.Now()
+		g.Eval(ctx, evalTimestamp)
+		duration := time.Since(start)
+
+		m.opts.Metrics.IterationDuration.Observe(duration.Seconds())
+		m.opts.Metrics.GroupLastDuration.WithLabelValues(key).Set(duration.Seconds())
+		m.opts.Metrics.GroupLastEvalTime.WithLabelValues(key).Set(float64(start.UnixNano()) / 1e9)
+
+		// The state of the alerts is restored after the second evaluation, so that the recording
+		// rules the alerts may depend on have been evaluated, like the Prometheus rules manager does.
+		if g.shouldRestore && iterations == 1 {
+			g.RestoreForState(time.Now())
+			g.shouldRestore = false
+		}
+
+		// The offset is computed again for each evaluation, because the rule group may align its
+		// evaluation time on the interval, or stop doing so, without being reloaded.
+		next := evaluationSlot(evalTimestamp, g.Interval(), m.evaluationOffset(g.Group))
+		if missed := time.Since(next) / g.Interval(); missed > 0 {
+			m.opts.Metrics.IterationsMissed.WithLabelValues(key).Add(float64(missed))
+			m.opts.Metrics.IterationsScheduled.WithLabelValues(key).Add(float64(missed))
+			next = next.Add(missed * g.Interval())
+		}
+		evalTimestamp = next
+	}
+}
+
+// evaluationOffset returns the offset of the evaluation of the rule group within its interval.
+func (m *scheduledManager) evaluationOffset(g *rules.Group) time.Duration {
+	namespace, ok := ruleFileNamespace(g.File())
+	switch {
+	case ok && m.aligned != nil && m.aligned.contains(namespace, g.Name()):
+		return 0
+	case ok && m.maxJitter > 0:
+		return evaluationJitter(namespace, g.Name(), g.Interval(), m.maxJitter)
+	default:
+		// The slot preceding the Unix epoch is at the offset computed by the Prometheus rules manager.
+		return time.Duration(g.EvalTimestamp(0).UnixNano())
+	}
+}
+
+// markStale marks stale the series of the removed rule group, after 2 evaluation intervals to give
+// the renamed rules the opportunity to write their series, like the Prometheus rules manager does.
+// The series are written by an empty rule group, whose state is copied from the removed one.
+func (m *scheduledManager) markStale(g *scheduledGroup, now time.Time) {
+	select {
+	case <-time.After(2 * g.Interval()):
+	case <-m.done:
+		return
+	}
+
+	// The metrics of the empty rule group aren't registered, because the ones of the removed
+	// rule group have been deleted.
+	opts := *m.opts
+	opts.Metrics = rules.NewGroupMetrics(nil)
+
+	stale := rules.NewGroup(rules.GroupOptions{Name: g.Name(), File: g.File(), Interval: g.Interval(), Opts: &opts})
+	stale.CopyState(g.Group)
+	stale.Eval(m.opts.Context, now)
+}
+
+// stop stops evaluating the rule group, and waits for the current evaluation to complete.
+func (g *scheduledGroup) stop() {
+	close(g.done)
+	<-g.terminated
+}
+
+// evaluationJitter returns the offset of the evaluation of the rule group within its interval,
+// lower than both the interval and maxJitter.
+func evaluationJitter(namespace, name string, interval, maxJitter time.Duration) time.Duration {
+	if maxJitter > interval {
+		maxJitter = interval
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(namespace + ";" + name))
+	return time.Duration(h.Sum64() % uint64(maxJitter))
+}
+
+// evaluationSlot returns the first time after t at the offset within the evaluation interval,
+// whose boundaries are the multiples of the interval since the Unix epoch, like the ones of the
+// Prometheus rules manager.
+func evaluationSlot(t time.Time, interval, offset time.Duration) time.Time {
+	base := t.UnixNano() - t.UnixNano()%int64(interval)
+
+	slot := time.Unix(0, base+int64(offset)).UTC()
+	if !slot.After(t) {
+		slot = slot.Add(interval)
+	}
+	return slot
+}
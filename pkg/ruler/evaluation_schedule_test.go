@@ -0,0 +1,235 @@
+package ruler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/exemplar"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func TestScheduledManager_ShouldEvaluateTheRuleGroupsAtTheirSlot(t *testing.T) {
+	const (
+		interval  = 200 * time.Millisecond
+		maxJitter = 100 * time.Millisecond
+	)
+
+	file := writeRuleFile(t, "ns", `
+groups:
+  - name: aligned
+    interval: 200ms
+    rules:
+      - record: aligned:up
+        expr: up
+      - alert: AlignedAlert
+        expr: up
+  - name: jittered
+    interval: 200ms
+    rules:
+      - record: jittered:up
+        expr: up
+`)
+
+	aligned := newAlignedGroups()
+	aligned.update(rulespb.RuleGroupList{
+		&rulespb.RuleGroupDesc{Name: "aligned", Namespace: "ns", AlignEvaluationTimeOnInterval: true},
+		&rulespb.RuleGroupDesc{Name: "jittered", Namespace: "ns"},
+	})
+
+	app := &timestampsAppendable{}
+	queried := &timestampsAppendable{}
+	m := newScheduledManager(scheduledManagerOptions(contextWithAlignedGroups(context.Background(), aligned), app, queried), maxJitter)
+	require.NoError(t, m.Update(time.Minute, []string{file}, nil, ""))
+
+	go m.Run()
+	test.Poll(t, 5*time.Second, true, func() interface{} {
+		return len(app.timestamps("ALERTS")) >= 1 && len(app.timestamps("jittered:up")) >= 2
+	})
+	m.Stop()
+
+	// The samples of the recording rules, the alerts and the queries of each evaluation share the
+	// timestamp of the slot of the rule group. The alerts are written once their state has been
+	// restored, after the second evaluation.
+	alignedTimestamps := app.timestamps("aligned:up")
+	assert.Equal(t, alignedTimestamps[2:], app.timestamps("ALERTS"))
+	assert.Equal(t, alignedTimestamps[2:], app.timestamps("ALERTS_FOR_STATE"))
+	assert.Subset(t, queried.timestamps("aligned"), alignedTimestamps)
+	for _, ts := range alignedTimestamps {
+		assert.Zero(t, ts%interval.Milliseconds())
+	}
+
+	offset := evaluationJitter("ns", "jittered", interval, maxJitter).Milliseconds()
+	jitteredTimestamps := app.timestamps("jittered:up")
+	assert.Subset(t, queried.timestamps("jittered"), jitteredTimestamps)
+	for _, ts := range jitteredTimestamps {
+		assert.Equal(t, offset, ts%interval.Milliseconds())
+	}
+
+	// The consecutive evaluations are one interval apart.
+	for _, timestamps := range [][]int64{alignedTimestamps, jitteredTimestamps} {
+		for i := 1; i < len(timestamps); i++ {
+			assert.Equal(t, interval.Milliseconds(), timestamps[i]-timestamps[i-1])
+		}
+	}
+}
+
+func TestScheduledManager_ShouldMarkStaleTheSeriesOfTheRemovedRuleGroups(t *testing.T) {
+	file := writeRuleFile(t, "ns", `
+groups:
+  - name: removed
+    interval: 100ms
+    rules:
+      - record: removed:up
+        expr: up
+`)
+	empty := writeRuleFile(t, "empty", "groups: []\n")
+
+	app := &timestampsAppendable{}
+	m := newScheduledManager(scheduledManagerOptions(context.Background(), app, &timestampsAppendable{}), 0)
+	require.NoError(t, m.Update(time.Minute, []string{file}, nil, ""))
+
+	go m.Run()
+	defer m.Stop()
+
+	test.Poll(t, 5*time.Second, true, func() interface{} {
+		return len(app.timestamps("removed:up")) > 0
+	})
+
+	// The rule group is stopped without waiting for its next slot.
+	require.NoError(t, m.Update(time.Minute, []string{empty}, nil, ""))
+	assert.Empty(t, m.RuleGroups())
+
+	// The series of the removed rule group are marked stale after 2 evaluation intervals.
+	test.Poll(t, 5*time.Second, true, func() interface{} {
+		return app.stale("removed:up")
+	})
+}
+
+func TestEvaluationSlot(t *testing.T) {
+	const interval = time.Minute
+
+	base := time.Unix(0, 0).Add(1000 * interval).UTC()
+	for name, c := range map[string]struct {
+		t        time.Time
+		offset   time.Duration
+		expected time.Time
+	}{
+		"before the offset within the interval": {
+			t:        base.Add(10 * time.Second),
+			offset:   20 * time.Second,
+			expected: base.Add(20 * time.Second),
+		},
+		"after the offset within the interval": {
+			t:        base.Add(30 * time.Second),
+			offset:   20 * time.Second,
+			expected: base.Add(interval + 20*time.Second),
+		},
+		"at the slot": {
+			t:        base.Add(20 * time.Second),
+			offset:   20 * time.Second,
+			expected: base.Add(interval + 20*time.Second),
+		},
+		"aligned on the interval": {
+			t:        base.Add(30 * time.Second),
+			expected: base.Add(interval),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, evaluationSlot(c.t, interval, c.offset))
+		})
+	}
+}
+
+func writeRuleFile(t *testing.T, namespace, content string) string {
+	file := filepath.Join(t.TempDir(), namespace)
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), os.ModePerm))
+	return file
+}
+
+// scheduledManagerOptions returns the options of a rules manager whose queries return a sample of
+// value 1 at the evaluation time, which is recorded by the queried appendable under the name of the
+// rule group.
+func scheduledManagerOptions(ctx context.Context, app, queried *timestampsAppendable) *rules.ManagerOptions {
+	return &rules.ManagerOptions{
+		Appendable: app,
+		Queryable: storage.QueryableFunc(func(_ context.Context, _, _ int64) (storage.Querier, error) {
+			return storage.NoopQuerier(), nil
+		}),
+		QueryFunc: func(ctx context.Context, _ string, ts time.Time) (promql.Vector, error) {
+			_, name, _ := originRuleGroup(ctx)
+			queried.add(name, timestamp.FromTime(ts), 1)
+			return promql.Vector{{Point: promql.Point{T: timestamp.FromTime(ts), V: 1}}}, nil
+		},
+		NotifyFunc: func(context.Context, string, ...*rules.Alert) {},
+		Context:    ctx,
+		Logger:     log.NewNopLogger(),
+	}
+}
+
+// timestampsAppendable records the timestamps of the samples appended, by metric name.
+type timestampsAppendable struct {
+	mtx     sync.Mutex
+	samples map[string][]int64
+	stales  map[string]bool
+}
+
+func (a *timestampsAppendable) Appender(_ context.Context) storage.Appender {
+	return a
+}
+
+func (a *timestampsAppendable) Append(_ uint64, l labels.Labels, t int64, v float64) (uint64, error) {
+	a.add(l.Get(labels.MetricName), t, v)
+	return 0, nil
+}
+
+func (a *timestampsAppendable) AppendExemplar(_ uint64, _ labels.Labels, _ exemplar.Exemplar) (uint64, error) {
+	return 0, nil
+}
+
+func (a *timestampsAppendable) Commit() error   { return nil }
+func (a *timestampsAppendable) Rollback() error { return nil }
+
+func (a *timestampsAppendable) add(name string, t int64, v float64) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if a.samples == nil {
+		a.samples = map[string][]int64{}
+		a.stales = map[string]bool{}
+	}
+	if value.IsStaleNaN(v) {
+		a.stales[name] = true
+		return
+	}
+	a.samples[name] = append(a.samples[name], t)
+}
+
+func (a *timestampsAppendable) timestamps(name string) []int64 {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return append([]int64(nil), a.samples[name]...)
+}
+
+func (a *timestampsAppendable) stale(name string) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return a.stales[name]
+}
@@ -0,0 +1,157 @@
+package ruler
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+)
+
+// RuleEvaluationStats are the outcomes of the evaluations of a rule. Unlike the health and
+// the last error of the rule, they're kept across the successful evaluations and the rule
+// group syncs, as long as the rule is unchanged.
+type RuleEvaluationStats struct {
+	Failures    int64
+	LastError   string
+	LastFailure time.Time
+	LastSuccess time.Time
+}
+
+type ruleEvaluationKey struct {
+	namespace string
+	group     string
+	query     string
+}
+
+// ruleEvaluations holds the evaluation stats of the rules of a user. The rules are identified
+// by their group and their query, so the rules of a group sharing the same query share their
+// stats too. It exports the last successful evaluation timestamp of each rule group.
+type ruleEvaluations struct {
+	mtx   sync.Mutex
+	stats map[ruleEvaluationKey]*RuleEvaluationStats
+
+	lastSuccessDesc *prometheus.Desc
+}
+
+func newRuleEvaluations() *ruleEvaluations {
+	return &ruleEvaluations{
+		stats: map[ruleEvaluationKey]*RuleEvaluationStats{},
+		lastSuccessDesc: prometheus.NewDesc(
+			"cortex_ruler_rule_last_evaluation_success_timestamp",
+			"The oldest of the last successful evaluation timestamps of the rules of the group, in seconds. It's 0 if a rule never succeeded.",
+			[]string{"rule_group"},
+			nil,
+		),
+	}
+}
+
+func (e *ruleEvaluations) record(key ruleEvaluationKey, ts time.Time, err error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	stats, ok := e.stats[key]
+	if !ok {
+		stats = &RuleEvaluationStats{}
+		e.stats[key] = stats
+	}
+
+	if err != nil {
+		stats.Failures++
+		stats.LastError = err.Error()
+		stats.LastFailure = ts
+	} else {
+		stats.LastSuccess = ts
+	}
+}
+
+func (e *ruleEvaluations) get(namespace, group, query string) RuleEvaluationStats {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if stats, ok := e.stats[ruleEvaluationKey{namespace: namespace, group: group, query: query}]; ok {
+		return *stats
+	}
+	return RuleEvaluationStats{}
+}
+
+// prune removes the stats of the rules which aren't part of the rule groups anymore, or whose
+// query has changed.
+func (e *ruleEvaluations) prune(groups rulespb.RuleGroupList) {
+	keys := map[ruleEvaluationKey]struct{}{}
+	for _, group := range groups {
+		for _, rule := range group.GetRules() {
+			// The rules manager identifies the queries by their formatted expression.
+			query := rule.GetExpr()
+			if expr, err := parser.ParseExpr(query); err == nil {
+				query = expr.String()
+			}
+			keys[ruleEvaluationKey{namespace: group.GetNamespace(), group: group.GetName(), query: query}] = struct{}{}
+		}
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for key := range e.stats {
+		if _, ok := keys[key]; !ok {
+			delete(e.stats, key)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (e *ruleEvaluations) Describe(out chan<- *prometheus.Desc) {
+	out <- e.lastSuccessDesc
+}
+
+// Collect implements prometheus.Collector.
+func (e *ruleEvaluations) Collect(out chan<- prometheus.Metric) {
+	e.mtx.Lock()
+	lastSuccess := map[string]time.Time{}
+	for key, stats := range e.stats {
+		// The label value has the same format as the group keys of the Prometheus rules manager,
+		// so that it can be mapped like the rule_group label of the other ruler metrics.
+		group := url.PathEscape(key.namespace) + ";" + key.group
+		if last, ok := lastSuccess[group]; !ok || stats.LastSuccess.Before(last) {
+			lastSuccess[group] = stats.LastSuccess
+		}
+	}
+	e.mtx.Unlock()
+
+	for group, ts := range lastSuccess {
+		value := float64(0)
+		if !ts.IsZero() {
+			value = float64(ts.UnixNano()) / 1e9
+		}
+		out <- prometheus.MustNewConstMetric(e.lastSuccessDesc, prometheus.GaugeValue, value, group)
+	}
+}
+
+type ruleEvaluationsContextKey struct{}
+
+func contextWithRuleEvaluations(ctx context.Context, evaluations *ruleEvaluations) context.Context {
+	return context.WithValue(ctx, ruleEvaluationsContextKey{}, evaluations)
+}
+
+// RuleEvaluationStatsQueryFunc returns a query function recording the outcome of the queries
+// of the rules evaluated by the Prometheus rules manager, in the evaluation stats attached to
+// the context.
+func RuleEvaluationStatsQueryFunc(qf rules.QueryFunc) rules.QueryFunc {
+	return func(ctx context.Context, qs string, t time.Time) (promql.Vector, error) {
+		vector, err := qf(ctx, qs, t)
+
+		if evaluations, ok := ctx.Value(ruleEvaluationsContextKey{}).(*ruleEvaluations); ok {
+			if namespace, group, ok := originRuleGroup(ctx); ok {
+				evaluations.record(ruleEvaluationKey{namespace: namespace, group: group, query: qs}, t, err)
+			}
+		}
+		return vector, err
+	}
+}
@@ -0,0 +1,146 @@
+package ruler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+)
+
+func TestRuler_RuleEvaluationStats(t *testing.T) {
+	store := newMockRuleStore(map[string]rulespb.RuleGroupList{
+		"user1": {
+			&rulespb.RuleGroupDesc{
+				Name:      "group1",
+				Namespace: "namespace1",
+				User:      "user1",
+				Rules:     []*rulespb.RuleDesc{{Record: "UP_RULE", Expr: "up"}},
+				Interval:  100 * time.Millisecond,
+			},
+		},
+	})
+	cfg, cleanup := defaultRulerConfig(store)
+	defer cleanup()
+
+	// The queries fail until the flag is cleared.
+	failing := atomic.NewBool(true)
+	queryable := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		if failing.Load() {
+			return nil, errors.New("the query exceeded the limits")
+		}
+		return storage.NoopQuerier(), nil
+	})
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1e6, Timeout: time.Minute})
+	limits := ruleLimits{maxRuleGroups: 20, maxRulesPerRuleGroup: 15}
+	reg := prometheus.NewRegistry()
+
+	manager, err := NewDefaultMultiTenantManager(cfg, DefaultTenantManagerFactory(cfg, &recordingPusher{}, queryable, engine, limits, nil), limits, reg, log.NewNopLogger())
+	require.NoError(t, err)
+	r, err := NewRuler(cfg, manager, reg, log.NewNopLogger(), store, limits, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), r))
+	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+	r.syncRules(context.Background(), rulerSyncReasonInitial)
+
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
+	getRule := func() recordingRule {
+		req := requestFor(t, "GET", "https://localhost:8080/api/prom/api/v1/rules", nil, "user1")
+		w := httptest.NewRecorder()
+		a.PrometheusRules(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Data struct {
+				Groups []struct {
+					Rules []recordingRule `json:"rules"`
+				} `json:"groups"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp.Data.Groups, 1)
+		require.Len(t, resp.Data.Groups[0].Rules, 1)
+		return resp.Data.Groups[0].Rules[0]
+	}
+
+	// The failures are reported while the rule fails.
+	var failed recordingRule
+	require.Eventually(t, func() bool {
+		failed = getRule()
+		return failed.Health == "err" && failed.EvaluationFailures > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Contains(t, failed.LastError, "the query exceeded the limits")
+	assert.Contains(t, failed.LastFailureError, "the query exceeded the limits")
+	assert.False(t, failed.LastFailedEvaluation.IsZero())
+	assert.True(t, failed.LastSuccessfulEvaluation.IsZero())
+
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ruler_rule_last_evaluation_success_timestamp The oldest of the last successful evaluation timestamps of the rules of the group in seconds, or 0 if a rule never succeeded. The rule_group label is the namespace and name of the group, truncated and hashed if too long.
+		# TYPE cortex_ruler_rule_last_evaluation_success_timestamp gauge
+		cortex_ruler_rule_last_evaluation_success_timestamp{rule_group="namespace1;group1",user="user1"} 0
+	`), "cortex_ruler_rule_last_evaluation_success_timestamp"))
+
+	// Once the rule succeeds, the last error is cleared but the failures are kept.
+	failing.Store(false)
+
+	var succeeded recordingRule
+	require.Eventually(t, func() bool {
+		succeeded = getRule()
+		return succeeded.Health == "ok"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Empty(t, succeeded.LastError)
+	assert.GreaterOrEqual(t, succeeded.EvaluationFailures, failed.EvaluationFailures)
+	assert.Contains(t, succeeded.LastFailureError, "the query exceeded the limits")
+	assert.True(t, succeeded.LastSuccessfulEvaluation.After(succeeded.LastFailedEvaluation))
+
+	evaluations := manager.userRuleEvaluations["user1"]
+	assert.GreaterOrEqual(t, promtest.ToFloat64(evaluations), float64(succeeded.LastSuccessfulEvaluation.UnixNano())/1e9)
+
+	// The stats of the unchanged rules are kept across the syncs.
+	r.syncRules(context.Background(), rulerSyncReasonPeriodic)
+
+	resynced := getRule()
+	assert.GreaterOrEqual(t, resynced.EvaluationFailures, succeeded.EvaluationFailures)
+	assert.Contains(t, resynced.LastFailureError, "the query exceeded the limits")
+}
+
+func TestRuleEvaluations_Prune(t *testing.T) {
+	evaluations := newRuleEvaluations()
+	ts := time.Unix(10, 0)
+
+	evaluations.record(ruleEvaluationKey{namespace: "ns", group: "group", query: "sum(up)"}, ts, errors.New("failed"))
+	evaluations.record(ruleEvaluationKey{namespace: "ns", group: "group", query: "up"}, ts, nil)
+	evaluations.record(ruleEvaluationKey{namespace: "ns", group: "deleted", query: "up"}, ts, nil)
+
+	// The rule queries are matched by their formatted expression.
+	evaluations.prune(rulespb.RuleGroupList{
+		&rulespb.RuleGroupDesc{
+			Name:      "group",
+			Namespace: "ns",
+			Rules:     []*rulespb.RuleDesc{{Record: "up:sum", Expr: "sum ( up )"}, {Record: "up:changed", Expr: "up == 1"}},
+		},
+	})
+
+	assert.Equal(t, RuleEvaluationStats{Failures: 1, LastError: "failed", LastFailure: ts}, evaluations.get("ns", "group", "sum(up)"))
+	assert.Equal(t, RuleEvaluationStats{}, evaluations.get("ns", "group", "up"))
+	assert.Equal(t, RuleEvaluationStats{}, evaluations.get("ns", "deleted", "up"))
+}
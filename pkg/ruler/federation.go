@@ -0,0 +1,163 @@
+package ruler
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+const (
+	// allowAllSourceTenants allows the federated rule groups to query any tenant.
+	allowAllSourceTenants = "*"
+
+	errSourceTenantNotAllowed = "source tenant %s is not allowed for the tenant %s"
+)
+
+var errTenantFederationDisabled = errors.New("rule groups with source tenants are not supported, because the ruler tenant federation is disabled")
+
+// TenantFederationConfig configures the federated rule groups, querying the series of other tenants.
+type TenantFederationConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+func (cfg *TenantFederationConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "ruler.tenant-federation.enabled", false, "Enable the federated rule groups, whose rules query the series of the tenants listed in their source_tenants field instead of the tenant owning them. The results are written to the tenant owning the rule group. Requires -tenant-federation.enabled.")
+}
+
+// validateSourceTenants returns an error if the rule groups of the user aren't allowed to
+// query the source tenants.
+func validateSourceTenants(cfg TenantFederationConfig, limits RulesLimits, userID string, sourceTenants []string) error {
+	if len(sourceTenants) == 0 {
+		return nil
+	}
+	if !cfg.Enabled {
+		return errTenantFederationDisabled
+	}
+
+	allowed := limits.RulerAllowedSourceTenants(userID)
+	for _, sourceTenant := range sourceTenants {
+		if err := tenant.ValidTenantID(sourceTenant); err != nil {
+			return err
+		}
+		if sourceTenant == userID || util.StringsContain(allowed, sourceTenant) || util.StringsContain(allowed, allowAllSourceTenants) {
+			continue
+		}
+		return fmt.Errorf(errSourceTenantNotAllowed, sourceTenant, userID)
+	}
+	return nil
+}
+
+// FederatedQueryFunc returns a query function running the queries of the federated rule groups
+// over the series of their source tenants, returned by sourceTenants, and the other queries over
+// the series of the user.
+func FederatedQueryFunc(qf rules.QueryFunc, cfg TenantFederationConfig, limits RulesLimits, userID string, sourceTenants func(context.Context) []string) rules.QueryFunc {
+	return func(ctx context.Context, qs string, t time.Time) (promql.Vector, error) {
+		tenants := sourceTenants(ctx)
+		if len(tenants) == 0 {
+			return qf(ctx, qs, t)
+		}
+
+		// The limits may have changed since the rule group has been stored.
+		if err := validateSourceTenants(cfg, limits, userID, tenants); err != nil {
+			return nil, err
+		}
+
+		tenants = tenant.NormalizeTenantIDs(append([]string(nil), tenants...))
+		return qf(user.InjectOrgID(ctx, tenant.JoinTenantIDs(tenants)), qs, t)
+	}
+}
+
+type federatedGroupKey struct {
+	namespace string
+	name      string
+}
+
+// federatedGroups holds the source tenants of the federated rule groups of a user, so that
+// they can be looked up when the rule groups are evaluated by the Prometheus rules manager.
+type federatedGroups struct {
+	mtx           sync.RWMutex
+	sourceTenants map[federatedGroupKey][]string
+}
+
+func newFederatedGroups() *federatedGroups {
+	return &federatedGroups{sourceTenants: map[federatedGroupKey][]string{}}
+}
+
+func (g *federatedGroups) update(groups rulespb.RuleGroupList) {
+	sourceTenants := map[federatedGroupKey][]string{}
+	for _, group := range groups {
+		if len(group.GetSourceTenants()) > 0 {
+			sourceTenants[federatedGroupKey{namespace: group.GetNamespace(), name: group.GetName()}] = group.GetSourceTenants()
+		}
+	}
+
+	g.mtx.Lock()
+	g.sourceTenants = sourceTenants
+	g.mtx.Unlock()
+}
+
+func (g *federatedGroups) get(namespace, name string) []string {
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+	return g.sourceTenants[federatedGroupKey{namespace: namespace, name: name}]
+}
+
+type federatedGroupsContextKey struct{}
+
+func contextWithFederatedGroups(ctx context.Context, groups *federatedGroups) context.Context {
+	return context.WithValue(ctx, federatedGroupsContextKey{}, groups)
+}
+
+// originSourceTenants returns the source tenants of the rule group evaluated by the Prometheus
+// rules manager.
+func originSourceTenants(ctx context.Context) []string {
+	groups, ok := ctx.Value(federatedGroupsContextKey{}).(*federatedGroups)
+	if !ok {
+		return nil
+	}
+
+	namespace, name, ok := originRuleGroup(ctx)
+	if !ok {
+		return nil
+	}
+	return groups.get(namespace, name)
+}
+
+// originRuleGroup returns the namespace and the name of the rule group evaluated by the
+// Prometheus rules manager, which attaches the rule file and the group name to the context.
+func originRuleGroup(ctx context.Context) (string, string, bool) {
+	origin, _ := ctx.Value(promql.QueryOrigin{}).(map[string]interface{})
+	group, _ := origin["ruleGroup"].(map[string]string)
+	if group == nil {
+		return "", "", false
+	}
+
+	namespace, ok := ruleFileNamespace(group["file"])
+	if !ok {
+		return "", "", false
+	}
+	return namespace, group["name"], true
+}
+
+// ruleFileNamespace returns the namespace of the rule groups of the rule file.
+func ruleFileNamespace(file string) (string, bool) {
+	// The rule files are named after the url-encoded namespace, see mapper.MapRules().
+	namespace, err := url.PathUnescape(filepath.Base(file))
+	if err != nil {
+		return "", false
+	}
+	return namespace, true
+}
@@ -0,0 +1,224 @@
+package ruler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/teststorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/querier/tenantfederation"
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func TestValidateSourceTenants(t *testing.T) {
+	enabled := TenantFederationConfig{Enabled: true}
+
+	for name, tc := range map[string]struct {
+		cfg           TenantFederationConfig
+		allowed       []string
+		sourceTenants []string
+		err           string
+	}{
+		"no source tenants with the federation disabled": {},
+		"source tenants with the federation disabled": {
+			sourceTenants: []string{"tenant-a"},
+			err:           errTenantFederationDisabled.Error(),
+		},
+		"allowed source tenants": {
+			cfg:           enabled,
+			allowed:       []string{"tenant-a", "tenant-b"},
+			sourceTenants: []string{"tenant-b", "tenant-a"},
+		},
+		"the user itself is always allowed": {
+			cfg:           enabled,
+			sourceTenants: []string{"user-1"},
+		},
+		"any source tenant is allowed with the wildcard": {
+			cfg:           enabled,
+			allowed:       []string{allowAllSourceTenants},
+			sourceTenants: []string{"tenant-a", "tenant-c"},
+		},
+		"source tenant not allowed": {
+			cfg:           enabled,
+			allowed:       []string{"tenant-a"},
+			sourceTenants: []string{"tenant-a", "tenant-c"},
+			err:           "source tenant tenant-c is not allowed for the tenant user-1",
+		},
+		"invalid source tenant": {
+			cfg:           enabled,
+			allowed:       []string{allowAllSourceTenants},
+			sourceTenants: []string{"tenant|a"},
+			err:           "tenant ID 'tenant|a' contains unsupported character '|'",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := validateSourceTenants(tc.cfg, ruleLimits{allowedSourceTenants: tc.allowed}, "user-1", tc.sourceTenants)
+			if tc.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestFederatedRuleGroups(t *testing.T) {
+	// The federated queries span multiple tenants.
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+	defer tenant.WithDefaultResolver(tenant.NewSingleResolver())
+
+	now := time.Now()
+	dbs := map[string]*teststorage.TestStorage{}
+	for tenantID, series := range map[string][]labels.Labels{
+		"user-1":   {labels.FromStrings(labels.MetricName, "up", "job", "self")},
+		"tenant-a": {labels.FromStrings(labels.MetricName, "up", "job", "api")},
+		"tenant-b": {labels.FromStrings(labels.MetricName, "up", "job", "api"), labels.FromStrings(labels.MetricName, "up", "job", "db")},
+	} {
+		db := teststorage.New(t)
+		defer db.Close()
+
+		app := db.Appender(context.Background())
+		for _, s := range series {
+			_, err := app.Append(0, s, now.UnixNano()/int64(time.Millisecond), 1)
+			require.NoError(t, err)
+		}
+		require.NoError(t, app.Commit())
+		dbs[tenantID] = db
+	}
+
+	// Each tenant only sees its own series, like the queriers.
+	tenantQueryable := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		userID, err := user.ExtractOrgID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		db, ok := dbs[userID]
+		if !ok {
+			return storage.NoopQuerier(), nil
+		}
+		return db.Querier(ctx, mint, maxt)
+	})
+	queryable := tenantfederation.NewQueryable(tenantQueryable, "__tenant_id__", true)
+
+	cfg, cleanup := defaultRulerConfig(newMockRuleStore(nil))
+	defer cleanup()
+	cfg.TenantFederation.Enabled = true
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1e6, Timeout: time.Minute})
+	limits := ruleLimits{allowedSourceTenants: []string{"tenant-a", "tenant-b"}}
+	pusher := &recordingPusher{}
+
+	m, err := NewDefaultMultiTenantManager(cfg, DefaultTenantManagerFactory(cfg, pusher, queryable, engine, limits, nil), limits, prometheus.NewRegistry(), log.NewNopLogger())
+	require.NoError(t, err)
+	defer m.Stop()
+
+	m.SyncRuleGroups(context.Background(), map[string]rulespb.RuleGroupList{
+		"user-1": {
+			&rulespb.RuleGroupDesc{
+				Name:          "federated",
+				Namespace:     "ns/1",
+				Interval:      100 * time.Millisecond,
+				User:          "user-1",
+				Rules:         []*rulespb.RuleDesc{{Record: "federated:up:sum", Expr: "sum by(job) (up)"}},
+				SourceTenants: []string{"tenant-b", "tenant-a"},
+			},
+			&rulespb.RuleGroupDesc{
+				Name:      "local",
+				Namespace: "ns/1",
+				Interval:  100 * time.Millisecond,
+				User:      "user-1",
+				Rules:     []*rulespb.RuleDesc{{Record: "local:up:sum", Expr: "sum by(job) (up)"}},
+			},
+		},
+	})
+
+	// The federated rule group records the series of its source tenants, the other
+	// rule group the series of the user. Both are written to the user.
+	test.Poll(t, 5*time.Second, map[string]float64{
+		`{__name__="federated:up:sum", job="api"}`: 2,
+		`{__name__="federated:up:sum", job="db"}`:  1,
+		`{__name__="local:up:sum", job="self"}`:    1,
+	}, func() interface{} {
+		return pusher.samples("user-1")
+	})
+}
+
+// recordingPusher records the last value of the series pushed per tenant.
+type recordingPusher struct {
+	mtx    sync.Mutex
+	series map[string]map[string]float64
+}
+
+func (p *recordingPusher) Push(ctx context.Context, req *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+	userID, err := user.ExtractOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.series == nil {
+		p.series = map[string]map[string]float64{}
+	}
+	if p.series[userID] == nil {
+		p.series[userID] = map[string]float64{}
+	}
+	for _, ts := range req.Timeseries {
+		for _, s := range ts.Samples {
+			p.series[userID][cortexpb.FromLabelAdaptersToLabels(ts.Labels).String()] = s.Value
+		}
+	}
+	return &cortexpb.WriteResponse{}, nil
+}
+
+func (p *recordingPusher) samples(userID string) map[string]float64 {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	res := map[string]float64{}
+	for series, value := range p.series[userID] {
+		res[series] = value
+	}
+	return res
+}
+
+func TestOriginSourceTenants(t *testing.T) {
+	groups := newFederatedGroups()
+	groups.update(rulespb.RuleGroupList{
+		&rulespb.RuleGroupDesc{Name: "federated", Namespace: "ns/1", SourceTenants: []string{"tenant-a"}},
+		&rulespb.RuleGroupDesc{Name: "local", Namespace: "ns/1"},
+	})
+
+	originContext := func(file, name string) context.Context {
+		ctx := contextWithFederatedGroups(context.Background(), groups)
+		return promql.NewOriginContext(ctx, map[string]interface{}{
+			"ruleGroup": map[string]string{"file": file, "name": name},
+		})
+	}
+
+	assert.Equal(t, []string{"tenant-a"}, originSourceTenants(originContext("/rules/user-1/ns%2F1", "federated")))
+	assert.Empty(t, originSourceTenants(originContext("/rules/user-1/ns%2F1", "local")))
+	assert.Empty(t, originSourceTenants(originContext("/rules/user-1/ns", "federated")))
+	assert.Empty(t, originSourceTenants(context.Background()))
+
+	// The source tenants are looked up at each evaluation, so that they can change without
+	// restarting the rules manager.
+	groups.update(rulespb.RuleGroupList{
+		&rulespb.RuleGroupDesc{Name: "federated", Namespace: "ns/1", SourceTenants: []string{"tenant-a", "tenant-b"}},
+	})
+	assert.Equal(t, []string{"tenant-a", "tenant-b"}, originSourceTenants(originContext("/rules/user-1/ns%2F1", "federated")))
+}
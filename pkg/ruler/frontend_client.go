@@ -0,0 +1,283 @@
+package ruler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/dskit/backoff"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/user"
+	"google.golang.org/grpc"
+
+	"github.com/cortexproject/cortex/pkg/util/grpcclient"
+)
+
+// QueryFrontendConfig configures the evaluation of the rule queries through the query-frontend,
+// instead of the querier embedded in the ruler.
+type QueryFrontendConfig struct {
+	Address          string            `yaml:"address"`
+	GRPCClientConfig grpcclient.Config `yaml:"grpc_client_config"`
+	Backoff          backoff.Config    `yaml:"backoff_config"`
+
+	// The path prefix of the Prometheus API, set from the API config.
+	PrometheusHTTPPrefix string `yaml:"-"`
+}
+
+func (cfg *QueryFrontendConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.Address, "ruler.query-frontend-address", "", "Address of the query-frontend evaluating the rule queries, instead of the querier embedded in the ruler. The queries are sent over gRPC, or over HTTP if the address is an http:// or https:// URL. Empty to evaluate the rule queries in the ruler.")
+	cfg.GRPCClientConfig.RegisterFlagsWithPrefix("ruler.query-frontend-client", f)
+	cfg.Backoff.RegisterFlagsWithPrefix("ruler.query-frontend", f)
+}
+
+// Validate the config and returns an error if the validation doesn't pass.
+func (cfg *QueryFrontendConfig) Validate() error {
+	if strings.HasPrefix(cfg.Address, "http://") || strings.HasPrefix(cfg.Address, "https://") {
+		if _, err := url.Parse(cfg.Address); err != nil {
+			return errors.Wrap(err, "invalid query-frontend address")
+		}
+	}
+	return nil
+}
+
+// FrontendClient evaluates the rule queries through the query-frontend, so that they get the
+// same splitting, caching and sharding of the other queries.
+type FrontendClient struct {
+	client     httpgrpc.HTTPClient
+	queryPath  string
+	backoffCfg backoff.Config
+	close      func() error
+}
+
+// NewFrontendClient makes a new FrontendClient sending the queries to the query-frontend
+// address in the config.
+func NewFrontendClient(cfg QueryFrontendConfig, reg prometheus.Registerer) (*FrontendClient, error) {
+	c := &FrontendClient{
+		queryPath:  path.Join("/", cfg.PrometheusHTTPPrefix, "/api/v1/query"),
+		backoffCfg: cfg.Backoff,
+	}
+
+	if strings.HasPrefix(cfg.Address, "http://") || strings.HasPrefix(cfg.Address, "https://") {
+		c.client = &httpFrontendClient{address: strings.TrimSuffix(cfg.Address, "/"), client: http.DefaultClient}
+		c.close = func() error { return nil }
+		return c, nil
+	}
+
+	requestDuration := promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cortex_ruler_query_frontend_request_duration_seconds",
+		Help:    "Time spent executing the rule queries through the query-frontend.",
+		Buckets: prometheus.ExponentialBuckets(0.008, 4, 7),
+	}, []string{"operation", "status_code"})
+
+	opts, err := cfg.GRPCClientConfig.DialOption(grpcclient.Instrument(requestDuration))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(cfg.Address, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial query-frontend %s", cfg.Address)
+	}
+
+	c.client = httpgrpc.NewHTTPClient(conn)
+	c.close = conn.Close
+	return c, nil
+}
+
+// Close the connection to the query-frontend.
+func (c *FrontendClient) Close() error {
+	return c.close()
+}
+
+// QueryFunc returns a query function evaluating the instant queries of the rules of the user
+// through the query-frontend, at the evaluation timestamp altered by the evaluation delay.
+func (c *FrontendClient) QueryFunc(overrides RulesLimits, userID string) rules.QueryFunc {
+	return func(ctx context.Context, qs string, t time.Time) (promql.Vector, error) {
+		// The federated rule groups query multiple tenants, injected in the context.
+		orgID, err := user.ExtractOrgID(ctx)
+		if err != nil {
+			orgID = userID
+		}
+
+		evaluationDelay := overrides.EvaluationDelay(userID)
+		vector, err := c.instantQuery(user.InjectOrgID(ctx, orgID), orgID, qs, t.Add(-evaluationDelay))
+
+		// The query-frontend errors are wrapped like the errors of the embedded querier, so that
+		// only the internal errors are tracked as failed queries.
+		return vector, WrapQueryableErrors(err)
+	}
+}
+
+func (c *FrontendClient) instantQuery(ctx context.Context, orgID, qs string, t time.Time) (promql.Vector, error) {
+	body := url.Values{
+		"query": []string{qs},
+		"time":  []string{strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', -1, 64)},
+	}.Encode()
+
+	// The header keys are canonicalized, because the httpgrpc server doesn't.
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/x-www-form-urlencoded")
+	headers.Set("Accept", "application/json")
+	headers.Set(user.OrgIDHeaderName, orgID)
+
+	req := &httpgrpc.HTTPRequest{
+		Method: http.MethodPost,
+		Url:    c.queryPath,
+		Body:   []byte(body),
+	}
+	for key, values := range headers {
+		req.Headers = append(req.Headers, &httpgrpc.Header{Key: key, Values: values})
+	}
+
+	resp, err := c.doWithRetries(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFrontendQueryResponse(resp)
+}
+
+// doWithRetries sends the request to the query-frontend, retrying with backoff on network
+// errors, 5xx and 429 responses, like the notifications sent to the Alertmanager. The deadline
+// of the context is propagated to the query-frontend.
+func (c *FrontendClient) doWithRetries(ctx context.Context, req *httpgrpc.HTTPRequest) (*httpgrpc.HTTPResponse, error) {
+	retries := backoff.New(ctx, c.backoffCfg)
+
+	for {
+		resp, err := c.client.Handle(ctx, req)
+		if err == nil && resp.Code/100 == 5 {
+			err = httpgrpc.ErrorFromHTTPResponse(resp)
+		}
+		if !isRetriableFrontendError(resp, err) || !retries.Ongoing() {
+			return resp, err
+		}
+
+		retries.Wait()
+	}
+}
+
+func isRetriableFrontendError(resp *httpgrpc.HTTPResponse, err error) bool {
+	if err != nil {
+		if errResp, ok := httpgrpc.HTTPResponseFromError(err); ok {
+			return errResp.Code/100 == 5 || errResp.Code == http.StatusTooManyRequests
+		}
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.Code == http.StatusTooManyRequests
+}
+
+// frontendQueryResponse is the response of the Prometheus instant query API.
+type frontendQueryResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+}
+
+// decodeFrontendQueryResponse decodes the response of the Prometheus instant query API into the
+// vector expected by the rules manager. The scalars are converted to a single sample vector like
+// the rules.EngineQueryFunc does.
+func decodeFrontendQueryResponse(resp *httpgrpc.HTTPResponse) (promql.Vector, error) {
+	var res frontendQueryResponse
+	if err := json.Unmarshal(resp.Body, &res); err != nil {
+		if resp.Code/100 != 2 {
+			return nil, httpgrpc.ErrorFromHTTPResponse(resp)
+		}
+		return nil, errors.Wrap(err, "failed to decode the query-frontend response")
+	}
+
+	if resp.Code/100 != 2 || res.Status != "success" {
+		code := int(resp.Code)
+		if code/100 == 2 {
+			code = http.StatusInternalServerError
+		}
+		return nil, httpgrpc.Errorf(code, "%s", res.Error)
+	}
+
+	switch res.Data.ResultType {
+	case model.ValVector.String():
+		var vector model.Vector
+		if err := json.Unmarshal(res.Data.Result, &vector); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the query-frontend vector")
+		}
+
+		result := make(promql.Vector, 0, len(vector))
+		for _, sample := range vector {
+			result = append(result, promql.Sample{
+				Metric: labelsFromMetric(sample.Metric),
+				Point:  promql.Point{T: int64(sample.Timestamp), V: float64(sample.Value)},
+			})
+		}
+		return result, nil
+
+	case model.ValScalar.String():
+		var scalar model.Scalar
+		if err := json.Unmarshal(res.Data.Result, &scalar); err != nil {
+			return nil, errors.Wrap(err, "failed to decode the query-frontend scalar")
+		}
+		return promql.Vector{promql.Sample{
+			Metric: labels.Labels{},
+			Point:  promql.Point{T: int64(scalar.Timestamp), V: float64(scalar.Value)},
+		}}, nil
+
+	default:
+		return nil, fmt.Errorf("rule result is not a vector or scalar: %q", res.Data.ResultType)
+	}
+}
+
+func labelsFromMetric(metric model.Metric) labels.Labels {
+	ls := make([]labels.Label, 0, len(metric))
+	for name, value := range metric {
+		ls = append(ls, labels.Label{Name: string(name), Value: string(value)})
+	}
+	return labels.New(ls...)
+}
+
+// httpFrontendClient sends the requests to the query-frontend over HTTP.
+type httpFrontendClient struct {
+	address string
+	client  *http.Client
+}
+
+// Handle implements httpgrpc.HTTPClient.
+func (c *httpFrontendClient) Handle(ctx context.Context, in *httpgrpc.HTTPRequest, _ ...grpc.CallOption) (*httpgrpc.HTTPResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, in.Method, c.address+in.Url, bytes.NewReader(in.Body))
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range in.Headers {
+		for _, v := range h.Values {
+			req.Header.Add(h.Key, v)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &httpgrpc.HTTPResponse{Code: int32(resp.StatusCode), Body: body}, nil
+}
@@ -0,0 +1,366 @@
+package ruler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/teststorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	httpgrpc_server "github.com/weaveworks/common/httpgrpc/server"
+	"github.com/weaveworks/common/user"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/util/flagext"
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func TestFrontendTenantManagerFactory(t *testing.T) {
+	now := time.Now()
+	db := teststorage.New(t)
+	defer db.Close()
+
+	app := db.Appender(context.Background())
+	for _, s := range []labels.Labels{
+		labels.FromStrings(labels.MetricName, "up", "job", "api"),
+		labels.FromStrings(labels.MetricName, "up", "job", "db"),
+		labels.FromStrings(labels.MetricName, "up", "job", "db", "instance", "2"),
+	} {
+		_, err := app.Append(0, s, now.UnixNano()/int64(time.Millisecond), 1)
+		require.NoError(t, err)
+	}
+	require.NoError(t, app.Commit())
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1e6, Timeout: time.Minute})
+	groups := map[string]rulespb.RuleGroupList{
+		"user-1": {
+			&rulespb.RuleGroupDesc{
+				Name:      "group",
+				Namespace: "ns",
+				Interval:  100 * time.Millisecond,
+				User:      "user-1",
+				Rules: []*rulespb.RuleDesc{
+					{Record: "job:up:sum", Expr: "sum by(job) (up)"},
+					{Record: "up:count", Expr: "scalar(count(up))"},
+				},
+			},
+		},
+	}
+
+	for name, newAddress := range map[string]func(t *testing.T, handler http.Handler) string{
+		"gRPC": startGRPCFrontend,
+		"HTTP": startHTTPFrontend,
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg, cleanup := defaultRulerConfig(newMockRuleStore(nil))
+			defer cleanup()
+			limits := ruleLimits{}
+
+			// The local evaluation is the reference.
+			localPusher := &recordingPusher{}
+			local, err := NewDefaultMultiTenantManager(cfg, DefaultTenantManagerFactory(cfg, localPusher, db, engine, limits, nil), limits, prometheus.NewRegistry(), log.NewNopLogger())
+			require.NoError(t, err)
+			defer local.Stop()
+
+			frontend := newStubFrontend(t, db, engine)
+			cfg.QueryFrontend.Address = newAddress(t, frontend)
+			client, err := NewFrontendClient(cfg.QueryFrontend, nil)
+			require.NoError(t, err)
+			defer client.Close() //nolint:errcheck
+
+			remotePusher := &recordingPusher{}
+			remote, err := NewDefaultMultiTenantManager(cfg, FrontendTenantManagerFactory(cfg, remotePusher, db, client, limits, nil), limits, prometheus.NewRegistry(), log.NewNopLogger())
+			require.NoError(t, err)
+			defer remote.Stop()
+
+			local.SyncRuleGroups(context.Background(), groups)
+			remote.SyncRuleGroups(context.Background(), groups)
+
+			expected := map[string]float64{
+				`{__name__="job:up:sum", job="api"}`: 1,
+				`{__name__="job:up:sum", job="db"}`:  2,
+				`{__name__="up:count"}`:              3,
+			}
+			test.Poll(t, 5*time.Second, expected, func() interface{} {
+				return localPusher.samples("user-1")
+			})
+			test.Poll(t, 5*time.Second, expected, func() interface{} {
+				return remotePusher.samples("user-1")
+			})
+			assert.Greater(t, frontend.requests.Load(), int64(0))
+		})
+	}
+}
+
+func TestFrontendClient_QueryFunc(t *testing.T) {
+	now := time.Now()
+	db := teststorage.New(t)
+	defer db.Close()
+
+	app := db.Appender(context.Background())
+	_, err := app.Append(0, labels.FromStrings(labels.MetricName, "up", "job", "api"), now.UnixNano()/int64(time.Millisecond), 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1e6, Timeout: time.Minute})
+
+	for name, tc := range map[string]struct {
+		failures         []int
+		query            string
+		expectedRequests int64
+		expectedErr      string
+		expectedCode     int32
+	}{
+		"should decode the vectors": {
+			query:            "up",
+			expectedRequests: 1,
+		},
+		"should retry on 5xx and 429": {
+			failures:         []int{http.StatusServiceUnavailable, http.StatusTooManyRequests},
+			query:            "up",
+			expectedRequests: 3,
+		},
+		"should not retry on 4xx": {
+			failures:         []int{http.StatusUnprocessableEntity},
+			query:            "up",
+			expectedRequests: 1,
+			expectedErr:      "the query failed",
+			expectedCode:     http.StatusUnprocessableEntity,
+		},
+		"should give up after the max retries": {
+			failures:         []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			query:            "up",
+			expectedRequests: 4,
+			expectedErr:      "the query failed",
+			expectedCode:     http.StatusBadGateway,
+		},
+		"should return the invalid queries errors": {
+			query:            "up{",
+			expectedRequests: 1,
+			expectedErr:      "unexpected end of input",
+			expectedCode:     http.StatusBadRequest,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			frontend := newStubFrontend(t, db, engine)
+			frontend.failures = tc.failures
+
+			cfg := QueryFrontendConfig{}
+			flagext.DefaultValues(&cfg)
+			cfg.Address = startGRPCFrontend(t, frontend)
+			cfg.PrometheusHTTPPrefix = "/prometheus"
+			cfg.Backoff.MinBackoff = time.Millisecond
+			cfg.Backoff.MaxBackoff = time.Millisecond
+			cfg.Backoff.MaxRetries = 3
+
+			client, err := NewFrontendClient(cfg, nil)
+			require.NoError(t, err)
+			defer client.Close() //nolint:errcheck
+
+			// The deadline of the rule evaluation is propagated to the query-frontend.
+			ctx, cancel := context.WithTimeout(user.InjectOrgID(context.Background(), "user-1"), time.Minute)
+			defer cancel()
+
+			vector, err := client.QueryFunc(ruleLimits{evalDelay: time.Second}, "user-1")(ctx, tc.query, now.Add(time.Second))
+			assert.Equal(t, tc.expectedRequests, frontend.requests.Load())
+			assert.True(t, frontend.deadline.Load())
+
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+
+				// The errors are wrapped like the embedded querier errors.
+				qerr := QueryableError{}
+				require.True(t, errors.As(err, &qerr))
+				resp, ok := httpgrpc.HTTPResponseFromError(qerr.Unwrap())
+				require.True(t, ok)
+				assert.Equal(t, tc.expectedCode, resp.Code)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, promql.Vector{{
+				Metric: labels.FromStrings(labels.MetricName, "up", "job", "api"),
+				Point:  promql.Point{T: now.UnixNano() / int64(time.Millisecond), V: 1},
+			}}, vector)
+		})
+	}
+}
+
+func TestDecodeFrontendQueryResponse(t *testing.T) {
+	for name, tc := range map[string]struct {
+		code        int32
+		body        string
+		expected    promql.Vector
+		expectedErr string
+	}{
+		"vector": {
+			code: http.StatusOK,
+			body: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"up","job":"api"},"value":[10.5,"1"]},{"metric":{},"value":[10.5,"NaN"]}]}}`,
+			expected: promql.Vector{
+				{Metric: labels.FromStrings(labels.MetricName, "up", "job", "api"), Point: promql.Point{T: 10500, V: 1}},
+				{Metric: labels.Labels{}, Point: promql.Point{T: 10500, V: math.NaN()}},
+			},
+		},
+		"empty vector": {
+			code:     http.StatusOK,
+			body:     `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			expected: promql.Vector{},
+		},
+		"scalar": {
+			code:     http.StatusOK,
+			body:     `{"status":"success","data":{"resultType":"scalar","result":[10,"3"]}}`,
+			expected: promql.Vector{{Metric: labels.Labels{}, Point: promql.Point{T: 10000, V: 3}}},
+		},
+		"matrix": {
+			code:        http.StatusOK,
+			body:        `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+			expectedErr: `rule result is not a vector or scalar: "matrix"`,
+		},
+		"error": {
+			code:        http.StatusUnprocessableEntity,
+			body:        `{"status":"error","errorType":"execution","error":"limit exceeded"}`,
+			expectedErr: "limit exceeded",
+		},
+		"invalid body": {
+			code:        http.StatusBadRequest,
+			body:        `bad request`,
+			expectedErr: "bad request",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			vector, err := decodeFrontendQueryResponse(&httpgrpc.HTTPResponse{Code: tc.code, Body: []byte(tc.body)})
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, vector, len(tc.expected))
+			for i, sample := range tc.expected {
+				assert.Equal(t, sample.Metric, vector[i].Metric)
+				assert.Equal(t, sample.T, vector[i].T)
+				assert.Equal(t, model.SampleValue(sample.V).String(), model.SampleValue(vector[i].V).String())
+			}
+		})
+	}
+}
+
+// stubFrontend evaluates the instant queries like the Prometheus API served by the query-frontend.
+type stubFrontend struct {
+	t         *testing.T
+	queryable storage.Queryable
+	engine    *promql.Engine
+
+	// Status codes returned by the first requests.
+	failures []int
+	requests *atomic.Int64
+	deadline *atomic.Bool
+}
+
+func newStubFrontend(t *testing.T, queryable storage.Queryable, engine *promql.Engine) *stubFrontend {
+	return &stubFrontend{
+		t:         t,
+		queryable: queryable,
+		engine:    engine,
+		requests:  atomic.NewInt64(0),
+		deadline:  atomic.NewBool(false),
+	}
+}
+
+func (f *stubFrontend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	request := f.requests.Inc()
+	_, hasDeadline := r.Context().Deadline()
+	f.deadline.Store(hasDeadline)
+
+	assert.Equal(f.t, "user-1", r.Header.Get(user.OrgIDHeaderName))
+	assert.Equal(f.t, http.MethodPost, r.Method)
+	assert.True(f.t, r.URL.Path == "/api/v1/query" || r.URL.Path == "/prometheus/api/v1/query", r.URL.Path)
+
+	if int(request) <= len(f.failures) {
+		writeStubResponse(w, f.failures[request-1], map[string]interface{}{"status": "error", "errorType": "execution", "error": "the query failed"})
+		return
+	}
+
+	ts, err := strconv.ParseFloat(r.FormValue("time"), 64)
+	require.NoError(f.t, err)
+
+	query, err := f.engine.NewInstantQuery(f.queryable, r.FormValue("query"), time.Unix(0, int64(ts*1e9)))
+	if err != nil {
+		writeStubResponse(w, http.StatusBadRequest, map[string]interface{}{"status": "error", "errorType": "bad_data", "error": err.Error()})
+		return
+	}
+	defer query.Close()
+
+	res := query.Exec(r.Context())
+	if res.Err != nil {
+		writeStubResponse(w, http.StatusUnprocessableEntity, map[string]interface{}{"status": "error", "errorType": "execution", "error": res.Err.Error()})
+		return
+	}
+
+	var result interface{}
+	switch v := res.Value.(type) {
+	case promql.Vector:
+		vector := model.Vector{}
+		for _, s := range v {
+			metric := model.Metric{}
+			for _, l := range s.Metric {
+				metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+			}
+			vector = append(vector, &model.Sample{Metric: metric, Value: model.SampleValue(s.V), Timestamp: model.Time(s.T)})
+		}
+		result = vector
+	case promql.Scalar:
+		result = model.Scalar{Value: model.SampleValue(v.V), Timestamp: model.Time(v.T)}
+	}
+
+	writeStubResponse(w, http.StatusOK, map[string]interface{}{
+		"status": "success",
+		"data":   map[string]interface{}{"resultType": res.Value.Type(), "result": result},
+	})
+}
+
+func writeStubResponse(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func startGRPCFrontend(t *testing.T, handler http.Handler) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	httpgrpc.RegisterHTTPServer(server, httpgrpc_server.NewServer(handler))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String()
+}
+
+func startHTTPFrontend(t *testing.T, handler http.Handler) string {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
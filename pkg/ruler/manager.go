@@ -14,10 +14,10 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/rulefmt"
 	promRules "github.com/prometheus/prometheus/rules"
 	"github.com/weaveworks/common/user"
-	"golang.org/x/net/context/ctxhttp"
 
 	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
 )
@@ -26,6 +26,7 @@ type DefaultMultiTenantManager struct {
 	cfg            Config
 	notifierCfg    *config.Config
 	managerFactory ManagerFactory
+	limits         RulesLimits
 
 	mapper *mapper
 
@@ -35,9 +36,25 @@ type DefaultMultiTenantManager struct {
 	userManagers       map[string]RulesManager
 	userManagerMetrics *ManagerMetrics
 
+	// Per-user source tenants of the federated rule groups, guarded by userManagerMtx.
+	userFederatedGroups map[string]*federatedGroups
+
+	// Per-user rule groups whose evaluation time is aligned on their interval, guarded by userManagerMtx.
+	userAlignedGroups map[string]*alignedGroups
+
+	// Per-user evaluation stats of the rules, guarded by userManagerMtx.
+	userRuleEvaluations map[string]*ruleEvaluations
+
+	// Per-user evaluation intervals of the rule groups, guarded by userManagerMtx.
+	userRuleGroupIntervals map[string]*ruleGroupIntervals
+
+	// Per-user external labels and URL the managers were created with, guarded by userManagerMtx.
+	userExternalConfigs map[string]externalConfig
+
 	// Per-user notifiers with separate queues.
-	notifiersMtx sync.Mutex
-	notifiers    map[string]*rulerNotifier
+	notifiersMtx       sync.Mutex
+	notifiers          map[string]*rulerNotifier
+	notificationQueues *notificationQueues
 
 	managersTotal                 prometheus.Gauge
 	lastReloadSuccessful          *prometheus.GaugeVec
@@ -47,7 +64,7 @@ type DefaultMultiTenantManager struct {
 	logger                        log.Logger
 }
 
-func NewDefaultMultiTenantManager(cfg Config, managerFactory ManagerFactory, reg prometheus.Registerer, logger log.Logger) (*DefaultMultiTenantManager, error) {
+func NewDefaultMultiTenantManager(cfg Config, managerFactory ManagerFactory, limits RulesLimits, reg prometheus.Registerer, logger log.Logger) (*DefaultMultiTenantManager, error) {
 	ncfg, err := buildNotifierConfig(&cfg)
 	if err != nil {
 		return nil, err
@@ -62,10 +79,19 @@ func NewDefaultMultiTenantManager(cfg Config, managerFactory ManagerFactory, reg
 		cfg:                cfg,
 		notifierCfg:        ncfg,
 		managerFactory:     managerFactory,
+		limits:             limits,
 		notifiers:          map[string]*rulerNotifier{},
+		notificationQueues: newNotificationQueues(cfg, limits, reg),
 		mapper:             newMapper(cfg.RulePath, logger),
 		userManagers:       map[string]RulesManager{},
 		userManagerMetrics: userManagerMetrics,
+
+		userFederatedGroups: map[string]*federatedGroups{},
+		userAlignedGroups:   map[string]*alignedGroups{},
+		userRuleEvaluations: map[string]*ruleEvaluations{},
+
+		userRuleGroupIntervals: map[string]*ruleGroupIntervals{},
+		userExternalConfigs:    map[string]externalConfig{},
 		managersTotal: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
 			Namespace: "cortex",
 			Name:      "ruler_managers_total",
@@ -106,6 +132,11 @@ func (r *DefaultMultiTenantManager) SyncRuleGroups(ctx context.Context, ruleGrou
 		if _, exists := ruleGroups[userID]; !exists {
 			go mngr.Stop()
 			delete(r.userManagers, userID)
+			delete(r.userFederatedGroups, userID)
+			delete(r.userAlignedGroups, userID)
+			delete(r.userRuleEvaluations, userID)
+			delete(r.userRuleGroupIntervals, userID)
+			delete(r.userExternalConfigs, userID)
 
 			r.mapper.cleanupUser(userID)
 			r.lastReloadSuccessful.DeleteLabelValues(userID)
@@ -122,6 +153,37 @@ func (r *DefaultMultiTenantManager) SyncRuleGroups(ctx context.Context, ruleGrou
 // syncRulesToManager maps the rule files to disk, detects any changes and will create/update the
 // the users Prometheus Rules Manager.
 func (r *DefaultMultiTenantManager) syncRulesToManager(ctx context.Context, user string, groups rulespb.RuleGroupList) {
+	// The source tenants and the aligned rule groups are updated even if the rule files are
+	// unchanged, because they aren't part of the rule files.
+	federated, exists := r.userFederatedGroups[user]
+	if !exists {
+		federated = newFederatedGroups()
+		r.userFederatedGroups[user] = federated
+	}
+	federated.update(groups)
+
+	aligned, exists := r.userAlignedGroups[user]
+	if !exists {
+		aligned = newAlignedGroups()
+		r.userAlignedGroups[user] = aligned
+	}
+	aligned.update(groups)
+
+	// The evaluation stats of the rules which are unchanged are kept.
+	evaluations, exists := r.userRuleEvaluations[user]
+	if !exists {
+		evaluations = newRuleEvaluations()
+		r.userRuleEvaluations[user] = evaluations
+	}
+	evaluations.prune(groups)
+
+	intervals, exists := r.userRuleGroupIntervals[user]
+	if !exists {
+		intervals = newRuleGroupIntervals()
+		r.userRuleGroupIntervals[user] = intervals
+	}
+	intervals.update(groups, r.cfg.EvaluationInterval)
+
 	// Map the files to disk and return the file names to be passed to the users manager if they
 	// have been updated
 	update, files, err := r.mapper.MapRules(user, groups.Formatted())
@@ -131,13 +193,28 @@ func (r *DefaultMultiTenantManager) syncRulesToManager(ctx context.Context, user
 		return
 	}
 
+	externalCfg := externalConfig{
+		labels: r.limits.RulerExternalLabels(user),
+		url:    tenantExternalURL(r.cfg, r.limits, user).String(),
+	}
+
 	manager, exists := r.userManagers[user]
+	if exists && !r.userExternalConfigs[user].equal(externalCfg) {
+		// The external URL is set when the manager is created, so the manager is recreated once
+		// the external labels or URL of the tenant change. The manager is stopped first, to hand
+		// over the state of the alerts to the new one.
+		level.Info(r.logger).Log("msg", "recreating rule manager because the external labels or URL changed", "user", user)
+		manager.Stop()
+		delete(r.userManagers, user)
+		exists = false
+	}
+
 	if !exists || update {
 		level.Debug(r.logger).Log("msg", "updating rules", "user", user)
 		r.configUpdatesTotal.WithLabelValues(user).Inc()
 		if !exists {
 			level.Debug(r.logger).Log("msg", "creating rule manager for user", "user", user)
-			manager, err = r.newManager(ctx, user)
+			manager, err = r.newManager(contextWithAlignedGroups(contextWithRuleGroupIntervals(contextWithRuleEvaluations(contextWithFederatedGroups(ctx, federated), evaluations), intervals), aligned), user, externalCfg.labels)
 			if err != nil {
 				r.lastReloadSuccessful.WithLabelValues(user).Set(0)
 				level.Error(r.logger).Log("msg", "unable to create rule manager", "user", user, "err", err)
@@ -147,8 +224,9 @@ func (r *DefaultMultiTenantManager) syncRulesToManager(ctx context.Context, user
 			// Hence run it as another goroutine.
 			go manager.Run()
 			r.userManagers[user] = manager
+			r.userExternalConfigs[user] = externalCfg
 		}
-		err = manager.Update(r.cfg.EvaluationInterval, files, nil, r.cfg.ExternalURL.String())
+		err = manager.Update(r.cfg.EvaluationInterval, files, externalCfg.labels, externalCfg.url)
 		if err != nil {
 			r.lastReloadSuccessful.WithLabelValues(user).Set(0)
 			level.Error(r.logger).Log("msg", "unable to update rule manager", "user", user, "err", err)
@@ -162,8 +240,8 @@ func (r *DefaultMultiTenantManager) syncRulesToManager(ctx context.Context, user
 
 // newManager creates a prometheus rule manager wrapped with a user id
 // configured storage, appendable, notifier, and instrumentation
-func (r *DefaultMultiTenantManager) newManager(ctx context.Context, userID string) (RulesManager, error) {
-	notifier, err := r.getOrCreateNotifier(userID)
+func (r *DefaultMultiTenantManager) newManager(ctx context.Context, userID string, externalLabels labels.Labels) (RulesManager, error) {
+	notifier, err := r.getOrCreateNotifier(userID, externalLabels)
 	if err != nil {
 		return nil, err
 	}
@@ -171,23 +249,32 @@ func (r *DefaultMultiTenantManager) newManager(ctx context.Context, userID strin
 	// Create a new Prometheus registry and register it within
 	// our metrics struct for the provided user.
 	reg := prometheus.NewRegistry()
+	if evaluations, ok := r.userRuleEvaluations[userID]; ok {
+		reg.MustRegister(evaluations)
+	}
 	r.userManagerMetrics.AddUserRegistry(userID, reg)
 
 	return r.managerFactory(ctx, userID, notifier, r.logger, reg), nil
 }
 
-func (r *DefaultMultiTenantManager) getOrCreateNotifier(userID string) (*notifier.Manager, error) {
+func (r *DefaultMultiTenantManager) getOrCreateNotifier(userID string, externalLabels labels.Labels) (*rulerNotifier, error) {
 	r.notifiersMtx.Lock()
 	defer r.notifiersMtx.Unlock()
 
 	n, ok := r.notifiers[userID]
 	if ok {
-		return n.notifier, nil
+		// The external labels of the tenant may have changed since the notifier was created.
+		if !labels.Equal(n.externalLabels, externalLabels) {
+			if err := n.applyConfig(r.tenantNotifierConfig(externalLabels)); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
 	}
 
 	reg := prometheus.WrapRegistererWith(prometheus.Labels{"user": userID}, r.registry)
 	reg = prometheus.WrapRegistererWithPrefix("cortex_", reg)
-	n = newRulerNotifier(&notifier.Options{
+	n = newRulerNotifier(userID, r.notificationQueues, r.cfg.NotificationTimeout, &notifier.Options{
 		QueueCapacity: r.cfg.NotificationQueueCapacity,
 		Registerer:    reg,
 		Do: func(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
@@ -203,19 +290,41 @@ func (r *DefaultMultiTenantManager) getOrCreateNotifier(userID string) (*notifie
 			defer sp.Finish()
 			ctx = ot.ContextWithSpan(ctx, sp)
 			_ = ot.GlobalTracer().Inject(sp.Context(), ot.HTTPHeaders, ot.HTTPHeadersCarrier(req.Header))
-			return ctxhttp.Do(ctx, client, req)
+			return doWithRetries(ctx, client, req, r.cfg.Notifier.BackoffConfig)
 		},
 	}, log.With(r.logger, "user", userID))
 
 	n.run()
 
 	// This should never fail, unless there's a programming mistake.
-	if err := n.applyConfig(r.notifierCfg); err != nil {
+	if err := n.applyConfig(r.tenantNotifierConfig(externalLabels)); err != nil {
 		return nil, err
 	}
 
 	r.notifiers[userID] = n
-	return n.notifier, nil
+	return n, nil
+}
+
+// tenantNotifierConfig returns the notifier config adding the external labels of the tenant to
+// the alerts.
+func (r *DefaultMultiTenantManager) tenantNotifierConfig(externalLabels labels.Labels) *config.Config {
+	if len(externalLabels) == 0 {
+		return r.notifierCfg
+	}
+
+	cfg := *r.notifierCfg
+	cfg.GlobalConfig.ExternalLabels = externalLabels
+	return &cfg
+}
+
+// externalConfig holds the external labels and URL of the alerts of a tenant.
+type externalConfig struct {
+	labels labels.Labels
+	url    string
+}
+
+func (c externalConfig) equal(other externalConfig) bool {
+	return labels.Equal(c.labels, other.labels) && c.url == other.url
 }
 
 func (r *DefaultMultiTenantManager) GetRules(userID string) []*promRules.Group {
@@ -228,6 +337,17 @@ func (r *DefaultMultiTenantManager) GetRules(userID string) []*promRules.Group {
 	return groups
 }
 
+func (r *DefaultMultiTenantManager) GetRuleEvaluationStats(userID, namespace, group, query string) RuleEvaluationStats {
+	r.userManagerMtx.Lock()
+	evaluations, exists := r.userRuleEvaluations[userID]
+	r.userManagerMtx.Unlock()
+
+	if !exists {
+		return RuleEvaluationStats{}
+	}
+	return evaluations.get(namespace, group, query)
+}
+
 func (r *DefaultMultiTenantManager) Stop() {
 	r.notifiersMtx.Lock()
 	for _, n := range r.notifiers {
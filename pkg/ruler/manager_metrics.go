@@ -1,6 +1,13 @@
 package ruler
 
 import (
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/cortexproject/cortex/pkg/util"
@@ -22,6 +29,10 @@ type ManagerMetrics struct {
 	GroupLastDuration    *prometheus.Desc
 	GroupRules           *prometheus.Desc
 	GroupLastEvalSamples *prometheus.Desc
+
+	RulerGroupLastEvalTime     *prometheus.Desc
+	RulerGroupLastEvalDuration *prometheus.Desc
+	RulerGroupLastSuccessTime  *prometheus.Desc
 }
 
 // NewManagerMetrics returns a ManagerMetrics struct
@@ -95,6 +106,25 @@ func NewManagerMetrics() *ManagerMetrics {
 			[]string{"user", "rule_group"},
 			nil,
 		),
+
+		RulerGroupLastEvalTime: prometheus.NewDesc(
+			"cortex_ruler_rule_group_last_evaluation_timestamp_seconds",
+			"The timestamp of the last rule group evaluation in seconds. The rule_group label is the namespace and name of the group, truncated and hashed if too long.",
+			[]string{"user", "rule_group"},
+			nil,
+		),
+		RulerGroupLastEvalDuration: prometheus.NewDesc(
+			"cortex_ruler_rule_group_last_evaluation_duration_seconds",
+			"The duration of the last rule group evaluation in seconds. The rule_group label is the namespace and name of the group, truncated and hashed if too long.",
+			[]string{"user", "rule_group"},
+			nil,
+		),
+		RulerGroupLastSuccessTime: prometheus.NewDesc(
+			"cortex_ruler_rule_last_evaluation_success_timestamp",
+			"The oldest of the last successful evaluation timestamps of the rules of the group in seconds, or 0 if a rule never succeeded. The rule_group label is the namespace and name of the group, truncated and hashed if too long.",
+			[]string{"user", "rule_group"},
+			nil,
+		),
 	}
 }
 
@@ -121,6 +151,9 @@ func (m *ManagerMetrics) Describe(out chan<- *prometheus.Desc) {
 	out <- m.GroupLastDuration
 	out <- m.GroupRules
 	out <- m.GroupLastEvalSamples
+	out <- m.RulerGroupLastEvalTime
+	out <- m.RulerGroupLastEvalDuration
+	out <- m.RulerGroupLastSuccessTime
 }
 
 // Collect implements the Collector interface
@@ -143,4 +176,44 @@ func (m *ManagerMetrics) Collect(out chan<- prometheus.Metric) {
 	data.SendSumOfGaugesPerUserWithLabels(out, m.GroupLastDuration, "prometheus_rule_group_last_duration_seconds", "rule_group")
 	data.SendSumOfGaugesPerUserWithLabels(out, m.GroupRules, "prometheus_rule_group_rules", "rule_group")
 	data.SendSumOfGaugesPerUserWithLabels(out, m.GroupLastEvalSamples, "prometheus_rule_group_last_evaluation_samples", "rule_group")
+
+	data.SendMaxOfGaugesPerUserWithMappedLabels(out, m.RulerGroupLastEvalTime, "prometheus_rule_group_last_evaluation_timestamp_seconds", mapRuleGroupLabelValues, "rule_group")
+	data.SendMaxOfGaugesPerUserWithMappedLabels(out, m.RulerGroupLastEvalDuration, "prometheus_rule_group_last_duration_seconds", mapRuleGroupLabelValues, "rule_group")
+	data.SendMaxOfGaugesPerUserWithMappedLabels(out, m.RulerGroupLastSuccessTime, "cortex_ruler_rule_last_evaluation_success_timestamp", mapRuleGroupLabelValues, "rule_group")
+}
+
+// maxRuleGroupLabelLength is the max length of the rule_group label of the cortex_ruler_rule_group_* metrics.
+const maxRuleGroupLabelLength = 100
+
+func mapRuleGroupLabelValues(values []string) []string {
+	return []string{ruleGroupLabelValue(values[0])}
+}
+
+// ruleGroupLabelValue returns the "<namespace>;<group>" value of the rule_group label, from the
+// "<rules path>/<user>/<escaped namespace>;<group>" key of the group in the Prometheus rules manager.
+// Values longer than maxRuleGroupLabelLength are truncated and suffixed by the hash of the full value,
+// so that long group names don't blow up the size of the series.
+func ruleGroupLabelValue(groupKey string) string {
+	value := groupKey
+	if idx := strings.Index(groupKey, ";"); idx >= 0 {
+		namespace := filepath.Base(groupKey[:idx])
+		if unescaped, err := url.PathUnescape(namespace); err == nil {
+			namespace = unescaped
+		}
+		value = namespace + ";" + groupKey[idx+1:]
+	}
+
+	if len(value) <= maxRuleGroupLabelLength {
+		return value
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(value))
+	suffix := fmt.Sprintf("~%016x", h.Sum64())
+
+	prefix := value[:maxRuleGroupLabelLength-len(suffix)]
+	for len(prefix) > 0 && !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix + suffix
 }
@@ -2,6 +2,10 @@ package ruler
 
 import (
 	"bytes"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -130,6 +134,22 @@ cortex_prometheus_rule_group_rules{rule_group="group_one",user="user3"} 100000
 cortex_prometheus_rule_group_rules{rule_group="group_two",user="user1"} 1000
 cortex_prometheus_rule_group_rules{rule_group="group_two",user="user2"} 10000
 cortex_prometheus_rule_group_rules{rule_group="group_two",user="user3"} 100000
+# HELP cortex_ruler_rule_group_last_evaluation_duration_seconds The duration of the last rule group evaluation in seconds. The rule_group label is the namespace and name of the group, truncated and hashed if too long.
+# TYPE cortex_ruler_rule_group_last_evaluation_duration_seconds gauge
+cortex_ruler_rule_group_last_evaluation_duration_seconds{rule_group="group_one",user="user1"} 1000
+cortex_ruler_rule_group_last_evaluation_duration_seconds{rule_group="group_one",user="user2"} 10000
+cortex_ruler_rule_group_last_evaluation_duration_seconds{rule_group="group_one",user="user3"} 100000
+cortex_ruler_rule_group_last_evaluation_duration_seconds{rule_group="group_two",user="user1"} 1000
+cortex_ruler_rule_group_last_evaluation_duration_seconds{rule_group="group_two",user="user2"} 10000
+cortex_ruler_rule_group_last_evaluation_duration_seconds{rule_group="group_two",user="user3"} 100000
+# HELP cortex_ruler_rule_group_last_evaluation_timestamp_seconds The timestamp of the last rule group evaluation in seconds. The rule_group label is the namespace and name of the group, truncated and hashed if too long.
+# TYPE cortex_ruler_rule_group_last_evaluation_timestamp_seconds gauge
+cortex_ruler_rule_group_last_evaluation_timestamp_seconds{rule_group="group_one",user="user1"} 1000
+cortex_ruler_rule_group_last_evaluation_timestamp_seconds{rule_group="group_one",user="user2"} 10000
+cortex_ruler_rule_group_last_evaluation_timestamp_seconds{rule_group="group_one",user="user3"} 100000
+cortex_ruler_rule_group_last_evaluation_timestamp_seconds{rule_group="group_two",user="user1"} 1000
+cortex_ruler_rule_group_last_evaluation_timestamp_seconds{rule_group="group_two",user="user2"} 10000
+cortex_ruler_rule_group_last_evaluation_timestamp_seconds{rule_group="group_two",user="user3"} 100000
 `))
 	require.NoError(t, err)
 }
@@ -304,3 +324,44 @@ func TestMetricsArePerUser(t *testing.T) {
 		assert.True(t, foundUserLabel, "user label not found for metric %s", desc.String())
 	}
 }
+
+func TestRuleGroupLabelValue(t *testing.T) {
+	longName := strings.Repeat("a", maxRuleGroupLabelLength)
+
+	for name, tt := range map[string]struct {
+		groupKey string
+		expected string
+	}{
+		"group key from the rules manager": {
+			groupKey: "/rules/user-1/namespace;group",
+			expected: "namespace;group",
+		},
+		"escaped namespace": {
+			groupKey: "/rules/user-1/" + url.PathEscape("name/space;1") + ";group",
+			expected: "name/space;1;group",
+		},
+		"value without namespace": {
+			groupKey: "group",
+			expected: "group",
+		},
+		"long group name": {
+			groupKey: "/rules/user-1/namespace;" + longName,
+			expected: ("namespace;" + longName)[:maxRuleGroupLabelLength-17] + "~" + fmt.Sprintf("%016x", fnv64a("namespace;"+longName)),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			actual := ruleGroupLabelValue(tt.groupKey)
+			assert.Equal(t, tt.expected, actual)
+			assert.LessOrEqual(t, len(actual), maxRuleGroupLabelLength)
+		})
+	}
+
+	// Different long group names with the same prefix should get different label values.
+	assert.NotEqual(t, ruleGroupLabelValue("/rules/user-1/namespace;"+longName+"1"), ruleGroupLabelValue("/rules/user-1/namespace;"+longName+"2"))
+}
+
+func fnv64a(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
@@ -2,16 +2,23 @@ package ruler
 
 import (
 	"context"
+	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/prometheus/notifier"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
 	promRules "github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 
@@ -26,7 +33,7 @@ func TestSyncRuleGroups(t *testing.T) {
 		_ = os.RemoveAll(dir)
 	})
 
-	m, err := NewDefaultMultiTenantManager(Config{RulePath: dir}, factory, nil, log.NewNopLogger())
+	m, err := NewDefaultMultiTenantManager(Config{RulePath: dir}, factory, ruleLimits{}, nil, log.NewNopLogger())
 	require.NoError(t, err)
 
 	const user = "testUser"
@@ -105,7 +112,7 @@ func getManager(m *DefaultMultiTenantManager, user string) RulesManager {
 	return m.userManagers[user]
 }
 
-func factory(_ context.Context, _ string, _ *notifier.Manager, _ log.Logger, _ prometheus.Registerer) RulesManager {
+func factory(_ context.Context, _ string, _ Sender, _ log.Logger, _ prometheus.Registerer) RulesManager {
 	return &mockRulesManager{done: make(chan struct{})}
 }
 
@@ -131,3 +138,110 @@ func (m *mockRulesManager) Update(_ time.Duration, _ []string, _ labels.Labels,
 func (m *mockRulesManager) RuleGroups() []*promRules.Group {
 	return nil
 }
+
+func TestSyncRuleGroups_ShouldApplyTheTenantExternalLabelsAndURL(t *testing.T) {
+	type receivedAlert struct {
+		Labels       map[string]string `json:"labels"`
+		GeneratorURL string            `json:"generatorURL"`
+	}
+
+	var (
+		receivedMtx sync.Mutex
+		received    []receivedAlert
+	)
+	am := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alerts []receivedAlert
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alerts))
+
+		receivedMtx.Lock()
+		received = append(received, alerts...)
+		receivedMtx.Unlock()
+	}))
+	defer am.Close()
+
+	hasReceived := func(cluster, generatorURLPrefix string) bool {
+		receivedMtx.Lock()
+		defer receivedMtx.Unlock()
+
+		for _, a := range received {
+			if a.Labels["cluster"] == cluster && strings.HasPrefix(a.GeneratorURL, generatorURLPrefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	cfg, cleanup := defaultRulerConfig(newMockRuleStore(nil))
+	defer cleanup()
+	cfg.AlertmanagerURL = am.URL
+	cfg.AlertmanagerDiscovery = false
+	require.NoError(t, cfg.ExternalURL.Set("http://ruler.example.com"))
+	// The alerts sent before the Alertmanager is discovered are dropped, and resent. The
+	// discovery manager syncs the Alertmanagers every 5 seconds.
+	cfg.ResendDelay = 100 * time.Millisecond
+
+	queryable := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return storage.NoopQuerier(), nil
+	})
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1e6, Timeout: time.Minute})
+	limits := &externalConfigLimits{}
+	limits.set(labels.FromStrings("cluster", "eu"), "http://tenant.example.com")
+
+	m, err := NewDefaultMultiTenantManager(cfg, DefaultTenantManagerFactory(cfg, &recordingPusher{}, queryable, engine, limits, nil), limits, nil, log.NewNopLogger())
+	require.NoError(t, err)
+	defer m.Stop()
+
+	groups := map[string]rulespb.RuleGroupList{
+		"user1": {
+			&rulespb.RuleGroupDesc{
+				Name:      "group1",
+				Namespace: "namespace1",
+				User:      "user1",
+				Rules:     []*rulespb.RuleDesc{{Alert: "AlwaysFiring", Expr: "vector(1)"}},
+				Interval:  100 * time.Millisecond,
+			},
+		},
+	}
+
+	m.SyncRuleGroups(context.Background(), groups)
+	require.Eventually(t, func() bool {
+		return hasReceived("eu", "http://tenant.example.com/graph")
+	}, 15*time.Second, 50*time.Millisecond)
+
+	// The manager is recreated with the changed overrides on the next sync, and the tenant
+	// falls back to the ruler external URL.
+	limits.set(labels.FromStrings("cluster", "us"), "")
+
+	m.SyncRuleGroups(context.Background(), groups)
+	require.Eventually(t, func() bool {
+		return hasReceived("us", "http://ruler.example.com/graph")
+	}, 15*time.Second, 50*time.Millisecond)
+}
+
+// externalConfigLimits allows to change the external labels and URL of the tenant while its
+// rules are evaluated.
+type externalConfigLimits struct {
+	ruleLimits
+
+	mtx            sync.Mutex
+	externalLabels labels.Labels
+	externalURL    string
+}
+
+func (l *externalConfigLimits) set(externalLabels labels.Labels, externalURL string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.externalLabels, l.externalURL = externalLabels, externalURL
+}
+
+func (l *externalConfigLimits) RulerExternalLabels(_ string) labels.Labels {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.externalLabels
+}
+
+func (l *externalConfigLimits) RulerExternalURL(_ string) string {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.externalURL
+}
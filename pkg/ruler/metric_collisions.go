@@ -0,0 +1,198 @@
+package ruler
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+// MetricProvenanceConfig configures the label added to the samples recorded by the rules, telling
+// the rule group which recorded them apart from the series ingested otherwise.
+type MetricProvenanceConfig struct {
+	InjectRuleGroupLabel bool          `yaml:"inject_rule_group_label"`
+	RuleGroupLabelName   string        `yaml:"rule_group_label_name"`
+	CollisionsLookback   time.Duration `yaml:"collisions_lookback"`
+}
+
+func (cfg *MetricProvenanceConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.InjectRuleGroupLabel, "ruler.metric-provenance.inject-rule-group-label", false, "Add the -ruler.metric-provenance.rule-group-label-name label to the samples written by the rules, set to <namespace>;<group> of their rule group. Required by the per-tenant -ruler.protect-existing-metrics.")
+	f.StringVar(&cfg.RuleGroupLabelName, "ruler.metric-provenance.rule-group-label-name", "__rule_group__", "Name of the label added to the samples written by the rules, when -ruler.metric-provenance.inject-rule-group-label is enabled.")
+	f.DurationVar(&cfg.CollisionsLookback, "ruler.metric-provenance.collisions-lookback", time.Hour, "How far back the series are looked up to find the metrics recorded by the rules colliding with series not written by the ruler, when -ruler.protect-existing-metrics is enabled. The series written by the ruler before -ruler.metric-provenance.inject-rule-group-label was enabled are reported as colliding until they're older than the lookback.")
+}
+
+// Validate the config and returns an error if the validation doesn't pass.
+func (cfg *MetricProvenanceConfig) Validate() error {
+	if cfg.InjectRuleGroupLabel && !model.LabelName(cfg.RuleGroupLabelName).IsValid() {
+		return errors.New("invalid rule group label name")
+	}
+	return nil
+}
+
+// ruleGroupLabel returns the name of the label added to the samples written by the rules, or
+// an empty string if disabled.
+func (cfg MetricProvenanceConfig) ruleGroupLabel() string {
+	if !cfg.InjectRuleGroupLabel {
+		return ""
+	}
+	return cfg.RuleGroupLabelName
+}
+
+// metricCollisionError is the error of the recording rules whose metric collides with series
+// not written by the ruler.
+func metricCollisionError(metrics []string) error {
+	return fmt.Errorf("the metrics recorded by the rules collide with existing series not written by the ruler: %s", strings.Join(metrics, ", "))
+}
+
+type metricCollisionKey struct {
+	namespace string
+	group     string
+	metric    string
+}
+
+// MetricCollisionChecker finds the metrics recorded by the recording rules of the tenants with
+// -ruler.protect-existing-metrics, which collide with series not written by the ruler, like the
+// scraped ones. The series written by the ruler are told apart by the rule group label, so the
+// check is only enabled with -ruler.metric-provenance.inject-rule-group-label.
+type MetricCollisionChecker struct {
+	cfg       MetricProvenanceConfig
+	queryable storage.Queryable
+	limits    RulesLimits
+	logger    log.Logger
+
+	// The colliding metrics of the rule groups owned by the ruler, by user.
+	collisionsMtx sync.RWMutex
+	collisions    map[string]map[metricCollisionKey]struct{}
+
+	collidingMetrics *prometheus.GaugeVec
+}
+
+func NewMetricCollisionChecker(cfg MetricProvenanceConfig, queryable storage.Queryable, limits RulesLimits, reg prometheus.Registerer, logger log.Logger) *MetricCollisionChecker {
+	return &MetricCollisionChecker{
+		cfg:        cfg,
+		queryable:  queryable,
+		limits:     limits,
+		logger:     logger,
+		collisions: map[string]map[metricCollisionKey]struct{}{},
+		collidingMetrics: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_ruler_colliding_metrics",
+			Help: "Number of metrics recorded by the rule groups owned by the ruler, colliding with existing series not written by the ruler.",
+		}, []string{"user"}),
+	}
+}
+
+func (c *MetricCollisionChecker) enabled(userID string) bool {
+	return c != nil && c.cfg.InjectRuleGroupLabel && c.limits.RulerProtectExistingMetrics(userID)
+}
+
+// check returns the metrics recorded by the rule group colliding with existing series not written
+// by the ruler, sorted by name.
+func (c *MetricCollisionChecker) check(ctx context.Context, userID string, g *rulespb.RuleGroupDesc) ([]string, error) {
+	if !c.enabled(userID) {
+		return nil, nil
+	}
+
+	metrics := map[string]struct{}{}
+	for _, r := range g.Rules {
+		if r.Record != "" {
+			metrics[r.Record] = struct{}{}
+		}
+	}
+	if len(metrics) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	q, err := c.queryable.Querier(user.InjectOrgID(ctx, userID), util.TimeToMillis(now.Add(-c.cfg.CollisionsLookback)), util.TimeToMillis(now))
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+
+	var collisions []string
+	for metric := range metrics {
+		// The series of the metric missing the rule group label weren't written by the ruler.
+		names, _, err := q.LabelValues(labels.MetricName,
+			labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, metric),
+			labels.MustNewMatcher(labels.MatchEqual, c.cfg.RuleGroupLabelName, ""))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to look up the series of the metric %s", metric)
+		}
+		if len(names) > 0 {
+			collisions = append(collisions, metric)
+		}
+	}
+
+	sort.Strings(collisions)
+	return collisions, nil
+}
+
+// update checks the rule groups owned by the ruler, and keeps their colliding metrics to be
+// reported by the rules API.
+func (c *MetricCollisionChecker) update(ctx context.Context, ruleGroups map[string]rulespb.RuleGroupList) {
+	updated := map[string]map[metricCollisionKey]struct{}{}
+
+	for userID, groups := range ruleGroups {
+		if !c.enabled(userID) {
+			continue
+		}
+
+		collisions := map[metricCollisionKey]struct{}{}
+		for _, g := range groups {
+			metrics, err := c.check(ctx, userID, g)
+			if err != nil {
+				level.Warn(c.logger).Log("msg", "failed to check the metric collisions of the rule group", "user", userID, "namespace", g.Namespace, "group", g.Name, "err", err)
+				continue
+			}
+
+			for _, metric := range metrics {
+				level.Warn(c.logger).Log("msg", "the metric recorded by the rule group collides with existing series not written by the ruler", "user", userID, "namespace", g.Namespace, "group", g.Name, "metric", metric)
+				collisions[metricCollisionKey{namespace: g.Namespace, group: g.Name, metric: metric}] = struct{}{}
+			}
+		}
+		updated[userID] = collisions
+	}
+
+	c.collisionsMtx.Lock()
+	defer c.collisionsMtx.Unlock()
+
+	for userID := range c.collisions {
+		if _, ok := updated[userID]; !ok {
+			c.collidingMetrics.DeleteLabelValues(userID)
+		}
+	}
+	for userID, collisions := range updated {
+		c.collidingMetrics.WithLabelValues(userID).Set(float64(len(collisions)))
+	}
+	c.collisions = updated
+}
+
+// collides returns whether the metric recorded by the rule group was found colliding by the last
+// check.
+func (c *MetricCollisionChecker) collides(userID, namespace, group, metric string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.collisionsMtx.RLock()
+	defer c.collisionsMtx.RUnlock()
+
+	_, ok := c.collisions[userID][metricCollisionKey{namespace: namespace, group: group, metric: metric}]
+	return ok
+}
@@ -0,0 +1,206 @@
+package ruler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/teststorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+func newTestMetricCollisionStorage(t *testing.T) *teststorage.TestStorage {
+	db := teststorage.New(t)
+
+	// The series of job:up:sum were scraped, while the ones of job:up:max were written by the ruler.
+	ts := util.TimeToMillis(time.Now())
+	app := db.Appender(context.Background())
+	_, err := app.Append(0, labels.FromStrings(labels.MetricName, "job:up:sum", "job", "api"), ts, 1)
+	require.NoError(t, err)
+	_, err = app.Append(0, labels.FromStrings(labels.MetricName, "job:up:max", "job", "api", "__rule_group__", "namespace1;group1"), ts, 1)
+	require.NoError(t, err)
+	require.NoError(t, app.Commit())
+
+	return db
+}
+
+func TestMetricCollisionChecker_check(t *testing.T) {
+	db := newTestMetricCollisionStorage(t)
+	defer db.Close()
+
+	group := &rulespb.RuleGroupDesc{
+		Name:      "group1",
+		Namespace: "namespace1",
+		Rules: []*rulespb.RuleDesc{
+			{Record: "job:up:sum", Expr: "sum by(job) (up)"},
+			{Record: "job:up:max", Expr: "max by(job) (up)"},
+			{Record: "job:up:min", Expr: "min by(job) (up)"},
+			{Alert: "JobDown", Expr: "up == 0"},
+		},
+	}
+
+	cfg := MetricProvenanceConfig{InjectRuleGroupLabel: true, RuleGroupLabelName: "__rule_group__", CollisionsLookback: time.Hour}
+
+	tests := map[string]struct {
+		cfg      MetricProvenanceConfig
+		limits   RulesLimits
+		expected []string
+	}{
+		"should return the metrics colliding with series not written by the ruler": {
+			cfg:      cfg,
+			limits:   ruleLimits{protectExistingMetrics: true},
+			expected: []string{"job:up:sum"},
+		},
+		"should not check the metrics of the tenants without protection": {
+			cfg:    cfg,
+			limits: ruleLimits{},
+		},
+		"should not check the metrics without the rule group label": {
+			cfg:    MetricProvenanceConfig{RuleGroupLabelName: "__rule_group__", CollisionsLookback: time.Hour},
+			limits: ruleLimits{protectExistingMetrics: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := NewMetricCollisionChecker(tc.cfg, db, tc.limits, nil, log.NewNopLogger())
+
+			collisions, err := c.check(context.Background(), "user1", group)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, collisions)
+		})
+	}
+}
+
+func TestRuler_ShouldReportTheRecordingRulesWithMetricCollisions(t *testing.T) {
+	db := newTestMetricCollisionStorage(t)
+	defer db.Close()
+
+	store := newMockRuleStore(map[string]rulespb.RuleGroupList{
+		"user1": {
+			{
+				Name:      "group1",
+				Namespace: "namespace1",
+				User:      "user1",
+				Interval:  time.Minute,
+				Rules: []*rulespb.RuleDesc{
+					{Record: "job:up:sum", Expr: "sum by(job) (up)"},
+					{Record: "job:up:max", Expr: "max by(job) (up)"},
+				},
+			},
+		},
+	})
+	cfg, cleanup := defaultRulerConfig(store)
+	defer cleanup()
+	cfg.MetricProvenance = MetricProvenanceConfig{InjectRuleGroupLabel: true, RuleGroupLabelName: "__rule_group__", CollisionsLookback: time.Hour}
+
+	queryable := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return storage.NoopQuerier(), nil
+	})
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1e6, Timeout: time.Minute})
+	limits := ruleLimits{protectExistingMetrics: true}
+	reg := prometheus.NewRegistry()
+
+	manager, err := NewDefaultMultiTenantManager(cfg, DefaultTenantManagerFactory(cfg, &recordingPusher{}, queryable, engine, limits, nil), limits, reg, log.NewNopLogger())
+	require.NoError(t, err)
+	defer manager.Stop()
+
+	checker := NewMetricCollisionChecker(cfg.MetricProvenance, db, limits, reg, log.NewNopLogger())
+	r, err := NewRuler(cfg, manager, reg, log.NewNopLogger(), store, limits, checker)
+	require.NoError(t, err)
+
+	r.syncRules(context.Background(), rulerSyncReasonInitial)
+
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ruler_colliding_metrics Number of metrics recorded by the rule groups owned by the ruler, colliding with existing series not written by the ruler.
+		# TYPE cortex_ruler_colliding_metrics gauge
+		cortex_ruler_colliding_metrics{user="user1"} 1
+	`), "cortex_ruler_colliding_metrics"))
+
+	groups, err := r.getLocalRules("user1")
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Len(t, groups[0].ActiveRules, 2)
+
+	colliding := groups[0].ActiveRules[0]
+	assert.Equal(t, "job:up:sum", colliding.Rule.Record)
+	assert.Equal(t, ruleHealthDegraded, colliding.Health)
+	assert.Equal(t, metricCollisionError([]string{"job:up:sum"}).Error(), colliding.LastError)
+
+	assert.Equal(t, "job:up:max", groups[0].ActiveRules[1].Rule.Record)
+	assert.NotEqual(t, ruleHealthDegraded, groups[0].ActiveRules[1].Health)
+}
+
+func TestRuler_CreateRuleGroup_ShouldRejectTheMetricCollisions(t *testing.T) {
+	db := newTestMetricCollisionStorage(t)
+	defer db.Close()
+
+	cfg, cleanup := defaultRulerConfig(newMockRuleStore(make(map[string]rulespb.RuleGroupList)))
+	defer cleanup()
+
+	r, rcleanup := newTestRuler(t, cfg)
+	defer rcleanup()
+	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+	limits := ruleLimits{protectExistingMetrics: true}
+	r.limits = limits
+	r.metricCollisions = NewMetricCollisionChecker(MetricProvenanceConfig{InjectRuleGroupLabel: true, RuleGroupLabelName: "__rule_group__", CollisionsLookback: time.Hour}, db, limits, nil, log.NewNopLogger())
+
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
+	router := mux.NewRouter()
+	router.Path("/api/v1/rules/{namespace}").Methods("POST").HandlerFunc(a.CreateRuleGroup)
+
+	tests := map[string]struct {
+		input          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		"should reject the rule group recording a metric colliding with scraped series": {
+			input: `
+name: test
+rules:
+- record: job:up:sum
+  expr: sum by(job) (up)
+`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   metricCollisionError([]string{"job:up:sum"}).Error() + "\n",
+		},
+		"should accept the rule group recording a metric written by the ruler": {
+			input: `
+name: test
+rules:
+- record: job:up:max
+  expr: max by(job) (up)
+`,
+			expectedStatus: http.StatusAccepted,
+			expectedBody:   `{"status":"success","data":null,"errorType":"","error":""}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := requestFor(t, http.MethodPost, "https://localhost:8080/api/v1/rules/namespace", strings.NewReader(tc.input), "user1")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
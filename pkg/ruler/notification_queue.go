@@ -0,0 +1,223 @@
+package ruler
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/notifier"
+)
+
+const (
+	// Notification queue overflow policies.
+	notificationQueueDropOldest = "drop-oldest"
+	notificationQueueDropNewest = "drop-newest"
+
+	// Reasons for which notifications are dropped from the queue.
+	notificationDroppedReasonQueueFull       = "queue_full"
+	notificationDroppedReasonGlobalQueueFull = "global_queue_full"
+
+	// Max number of notifications handed over to the Prometheus notifier at once.
+	// It matches the notifier max batch size, so that each batch is sent to the
+	// Alertmanager with a single request.
+	notificationBatchSize = 64
+)
+
+var supportedNotificationQueueOverflowPolicies = []string{notificationQueueDropOldest, notificationQueueDropNewest}
+
+// notificationQueues holds the per-tenant queues of notifications to be sent to the
+// Alertmanager. Each tenant's queue is bounded by the tenant's capacity, and the total
+// number of queued notifications is bounded by the global capacity: when exceeded,
+// notifications are shed from each tenant's queue proportionally to its length, so that
+// a single tenant generating a large number of alerts doesn't affect other tenants.
+type notificationQueues struct {
+	policy         string
+	globalCapacity int
+	capacity       func(userID string) int
+
+	mtx    sync.Mutex
+	queues map[string]*notificationQueue
+	total  int
+
+	queueLength *prometheus.GaugeVec
+	dropped     *prometheus.CounterVec
+}
+
+type notificationQueue struct {
+	alerts []*notifier.Alert
+
+	// more is signalled whenever notifications are pushed to the queue.
+	more chan struct{}
+}
+
+func newNotificationQueues(cfg Config, limits RulesLimits, reg prometheus.Registerer) *notificationQueues {
+	return &notificationQueues{
+		policy:         cfg.NotificationQueueOverflowPolicy,
+		globalCapacity: cfg.NotificationQueueGlobalCapacity,
+		capacity: func(userID string) int {
+			if limits != nil {
+				if capacity := limits.RulerNotificationQueueCapacity(userID); capacity > 0 {
+					return capacity
+				}
+			}
+			return cfg.NotificationQueueCapacity
+		},
+		queues: map[string]*notificationQueue{},
+		queueLength: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_ruler_notification_queue_length",
+			Help: "Number of notifications queued to be sent to the Alertmanager.",
+		}, []string{"user"}),
+		dropped: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ruler_notifications_dropped_total",
+			Help: "Total number of notifications dropped before being sent to the Alertmanager because the queue was full.",
+		}, []string{"user", "reason"}),
+	}
+}
+
+// queue returns the queue of the given tenant, creating it if it doesn't exist.
+func (q *notificationQueues) queue(userID string) *notificationQueue {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.getOrCreateQueue(userID)
+}
+
+// Must be called with the lock held.
+func (q *notificationQueues) getOrCreateQueue(userID string) *notificationQueue {
+	uq, ok := q.queues[userID]
+	if !ok {
+		uq = &notificationQueue{more: make(chan struct{}, 1)}
+		q.queues[userID] = uq
+	}
+	return uq
+}
+
+// push enqueues the notifications to the given tenant's queue, dropping notifications
+// according to the overflow policy if the tenant's or the global capacity is exceeded.
+func (q *notificationQueues) push(userID string, alerts ...*notifier.Alert) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	uq := q.getOrCreateQueue(userID)
+	prev := len(uq.alerts)
+
+	var dropped int
+	uq.alerts, dropped = enqueue(uq.alerts, alerts, q.capacity(userID), q.policy)
+	q.total += len(uq.alerts) - prev
+	if dropped > 0 {
+		q.dropped.WithLabelValues(userID, notificationDroppedReasonQueueFull).Add(float64(dropped))
+	}
+
+	if q.globalCapacity > 0 && q.total > q.globalCapacity {
+		q.shed(q.total - q.globalCapacity)
+	}
+
+	q.queueLength.WithLabelValues(userID).Set(float64(len(uq.alerts)))
+
+	select {
+	case uq.more <- struct{}{}:
+	default:
+	}
+}
+
+// pop dequeues up to max notifications from the given tenant's queue.
+func (q *notificationQueues) pop(userID string, max int) []*notifier.Alert {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	uq, ok := q.queues[userID]
+	if !ok || len(uq.alerts) == 0 {
+		return nil
+	}
+
+	if max > len(uq.alerts) {
+		max = len(uq.alerts)
+	}
+
+	alerts := make([]*notifier.Alert, max)
+	copy(alerts, uq.alerts)
+	uq.alerts = uq.alerts[max:]
+	q.total -= max
+
+	q.queueLength.WithLabelValues(userID).Set(float64(len(uq.alerts)))
+	return alerts
+}
+
+// shed drops the given number of notifications across the tenants' queues, proportionally
+// to their length. Must be called with the lock held.
+func (q *notificationQueues) shed(excess int) {
+	type share struct {
+		userID string
+		queue  *notificationQueue
+		drop   int
+	}
+
+	shares := make([]*share, 0, len(q.queues))
+	assigned := 0
+	for userID, uq := range q.queues {
+		if len(uq.alerts) == 0 {
+			continue
+		}
+
+		s := &share{userID: userID, queue: uq, drop: excess * len(uq.alerts) / q.total}
+		shares = append(shares, s)
+		assigned += s.drop
+	}
+
+	// Assign the remainder of the integer division to the longest queues.
+	sort.Slice(shares, func(i, j int) bool {
+		li, lj := len(shares[i].queue.alerts)-shares[i].drop, len(shares[j].queue.alerts)-shares[j].drop
+		if li != lj {
+			return li > lj
+		}
+		return shares[i].userID < shares[j].userID
+	})
+	for i := 0; assigned < excess && i < len(shares); i++ {
+		if shares[i].drop < len(shares[i].queue.alerts) {
+			shares[i].drop++
+			assigned++
+		}
+	}
+
+	for _, s := range shares {
+		if s.drop == 0 {
+			continue
+		}
+
+		if q.policy == notificationQueueDropNewest {
+			s.queue.alerts = s.queue.alerts[:len(s.queue.alerts)-s.drop]
+		} else {
+			s.queue.alerts = s.queue.alerts[s.drop:]
+		}
+		q.total -= s.drop
+
+		q.dropped.WithLabelValues(s.userID, notificationDroppedReasonGlobalQueueFull).Add(float64(s.drop))
+		q.queueLength.WithLabelValues(s.userID).Set(float64(len(s.queue.alerts)))
+	}
+}
+
+// enqueue appends the incoming alerts to the queue, honoring the capacity with the given
+// overflow policy, and returns the new queue and the number of dropped alerts.
+func enqueue(queue, alerts []*notifier.Alert, capacity int, policy string) ([]*notifier.Alert, int) {
+	if policy == notificationQueueDropNewest {
+		free := capacity - len(queue)
+		if free < 0 {
+			free = 0
+		}
+		if free >= len(alerts) {
+			return append(queue, alerts...), 0
+		}
+		return append(queue, alerts[:free]...), len(alerts) - free
+	}
+
+	queue = append(queue, alerts...)
+	if capacity < 0 {
+		capacity = 0
+	}
+	if d := len(queue) - capacity; d > 0 {
+		// Copy the kept alerts, so that the dropped ones can be garbage collected.
+		return append([]*notifier.Alert(nil), queue[d:]...), d
+	}
+	return queue, 0
+}
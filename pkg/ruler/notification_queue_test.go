@@ -0,0 +1,276 @@
+package ruler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	prom_testutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+func TestNotificationQueues_ShouldHonorPerTenantCapacity(t *testing.T) {
+	tests := map[string]struct {
+		policy   string
+		expected []string
+	}{
+		"drop-oldest": {
+			policy:   notificationQueueDropOldest,
+			expected: []string{"alert-2", "alert-3", "alert-4"},
+		},
+		"drop-newest": {
+			policy:   notificationQueueDropNewest,
+			expected: []string{"alert-0", "alert-1", "alert-2"},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			q := newNotificationQueues(Config{
+				NotificationQueueCapacity:       10,
+				NotificationQueueOverflowPolicy: testData.policy,
+			}, ruleLimits{notificationQueueCapacity: 3}, reg)
+
+			// Push the alerts in two batches, to cover both the incoming and the queued alerts.
+			q.push("user-1", generateAlerts(0, 2)...)
+			q.push("user-1", generateAlerts(2, 5)...)
+			q.push("user-2", generateAlerts(0, 2)...)
+
+			assert.Equal(t, testData.expected, alertNames(q.pop("user-1", notificationBatchSize)))
+			assert.Equal(t, []string{"alert-0", "alert-1"}, alertNames(q.pop("user-2", 1), q.pop("user-2", 1)))
+			assert.Empty(t, q.pop("user-3", notificationBatchSize))
+
+			assert.NoError(t, prom_testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_ruler_notification_queue_length Number of notifications queued to be sent to the Alertmanager.
+				# TYPE cortex_ruler_notification_queue_length gauge
+				cortex_ruler_notification_queue_length{user="user-1"} 0
+				cortex_ruler_notification_queue_length{user="user-2"} 0
+
+				# HELP cortex_ruler_notifications_dropped_total Total number of notifications dropped before being sent to the Alertmanager because the queue was full.
+				# TYPE cortex_ruler_notifications_dropped_total counter
+				cortex_ruler_notifications_dropped_total{reason="queue_full",user="user-1"} 2
+			`), "cortex_ruler_notification_queue_length", "cortex_ruler_notifications_dropped_total"))
+		})
+	}
+}
+
+func TestNotificationQueues_ShouldShedProportionallyWhenGlobalCapacityIsExceeded(t *testing.T) {
+	for _, policy := range supportedNotificationQueueOverflowPolicies {
+		t.Run(policy, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			q := newNotificationQueues(Config{
+				NotificationQueueCapacity:       1000,
+				NotificationQueueGlobalCapacity: 100,
+				NotificationQueueOverflowPolicy: policy,
+			}, nil, reg)
+
+			q.push("user-1", generateAlerts(0, 80)...)
+			q.push("user-2", generateAlerts(0, 20)...)
+
+			// The 10 notifications in excess should be shed proportionally to the queue
+			// lengths (80, 20 and 10), with the remainder of the split assigned to the
+			// longest queues.
+			q.push("user-3", generateAlerts(0, 10)...)
+
+			assert.NoError(t, prom_testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_ruler_notification_queue_length Number of notifications queued to be sent to the Alertmanager.
+				# TYPE cortex_ruler_notification_queue_length gauge
+				cortex_ruler_notification_queue_length{user="user-1"} 72
+				cortex_ruler_notification_queue_length{user="user-2"} 18
+				cortex_ruler_notification_queue_length{user="user-3"} 10
+
+				# HELP cortex_ruler_notifications_dropped_total Total number of notifications dropped before being sent to the Alertmanager because the queue was full.
+				# TYPE cortex_ruler_notifications_dropped_total counter
+				cortex_ruler_notifications_dropped_total{reason="global_queue_full",user="user-1"} 8
+				cortex_ruler_notifications_dropped_total{reason="global_queue_full",user="user-2"} 2
+			`), "cortex_ruler_notification_queue_length", "cortex_ruler_notifications_dropped_total"))
+
+			// The notifications are shed according to the overflow policy.
+			user1 := alertNames(q.pop("user-1", 1000))
+			require.Len(t, user1, 72)
+			if policy == notificationQueueDropNewest {
+				assert.Equal(t, "alert-0", user1[0])
+				assert.Equal(t, "alert-71", user1[71])
+			} else {
+				assert.Equal(t, "alert-8", user1[0])
+				assert.Equal(t, "alert-79", user1[71])
+			}
+
+			// Popped notifications free up global capacity.
+			q.push("user-3", generateAlerts(10, 20)...)
+			assert.Equal(t, float64(20), prom_testutil.ToFloat64(q.queueLength.WithLabelValues("user-3")))
+			assert.Equal(t, float64(18), prom_testutil.ToFloat64(q.queueLength.WithLabelValues("user-2")))
+		})
+	}
+}
+
+func TestDoWithRetries(t *testing.T) {
+	backoffCfg := backoff.Config{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxRetries: 2}
+
+	tests := map[string]struct {
+		statusCodes      []int
+		expectedStatus   int
+		expectedRequests int
+	}{
+		"should not retry on success": {
+			statusCodes:      []int{http.StatusOK},
+			expectedStatus:   http.StatusOK,
+			expectedRequests: 1,
+		},
+		"should retry on 5xx and 429 until success": {
+			statusCodes:      []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			expectedStatus:   http.StatusOK,
+			expectedRequests: 3,
+		},
+		"should give up once the max retries are exhausted": {
+			statusCodes:      []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			expectedStatus:   http.StatusServiceUnavailable,
+			expectedRequests: 3,
+		},
+		"should not retry on 4xx": {
+			statusCodes:      []int{http.StatusBadRequest, http.StatusOK},
+			expectedStatus:   http.StatusBadRequest,
+			expectedRequests: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			requests := atomic.NewInt32(0)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The request body must be sent again on every retry.
+				body, err := ioutil.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, "alerts", string(body))
+
+				w.WriteHeader(testData.statusCodes[requests.Inc()-1])
+			}))
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL, bytes.NewReader([]byte("alerts")))
+			require.NoError(t, err)
+
+			resp, err := doWithRetries(context.Background(), ts.Client(), req, backoffCfg)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, testData.expectedStatus, resp.StatusCode)
+			assert.Equal(t, int32(testData.expectedRequests), requests.Load())
+		})
+	}
+}
+
+func TestRulerNotifier_AlertmanagerOutageShouldNotAffectOtherTenants(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests = map[string]int{}
+		received = map[string]int{}
+	)
+
+	// The Alertmanager is unavailable for user-1 only.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _, err := tenant.ExtractTenantIDFromHTTPRequest(r)
+		assert.NoError(t, err)
+
+		var alerts []json.RawMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alerts))
+
+		mtx.Lock()
+		requests[userID]++
+		if userID != "user-1" {
+			received[userID] += len(alerts)
+		}
+		mtx.Unlock()
+
+		if userID == "user-1" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	cfg, cleanup := defaultRulerConfig(newMockRuleStore(nil))
+	defer cleanup()
+
+	cfg.AlertmanagerURL = ts.URL
+	cfg.NotificationQueueCapacity = 100
+	cfg.NotificationTimeout = time.Second
+	cfg.Notifier.BackoffConfig = backoff.Config{MinBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond, MaxRetries: 2}
+
+	manager, rcleanup := newManager(t, cfg)
+	defer rcleanup()
+	defer manager.Stop()
+
+	notifiers := map[string]*rulerNotifier{}
+	for _, userID := range []string{"user-1", "user-2"} {
+		n, err := manager.getOrCreateNotifier(userID, nil)
+		require.NoError(t, err)
+		notifiers[userID] = n
+	}
+
+	// Loop until notifiers discovery syncs up
+	for _, n := range notifiers {
+		for len(n.notifier.Alertmanagers()) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// The alerts of user-1 exceed the queue capacity and are backlogged because of the outage.
+	notifiers["user-1"].Send(generateAlerts(0, 200)...)
+	notifiers["user-2"].Send(generateAlerts(0, 10)...)
+
+	// The alerts of user-2 are delivered while user-1 notifications are being retried.
+	test.Poll(t, time.Second, 10, func() interface{} {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return received["user-2"]
+	})
+
+	// Each batch of user-1 is retried with backoff, up to the max retries.
+	test.Poll(t, 5*time.Second, true, func() interface{} {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return requests["user-1"] >= 3
+	})
+
+	assert.Equal(t, float64(100), prom_testutil.ToFloat64(manager.notificationQueues.dropped.WithLabelValues("user-1", notificationDroppedReasonQueueFull)))
+	assert.Equal(t, float64(0), prom_testutil.ToFloat64(manager.notificationQueues.dropped.WithLabelValues("user-2", notificationDroppedReasonQueueFull)))
+	assert.Equal(t, float64(0), prom_testutil.ToFloat64(manager.notificationQueues.queueLength.WithLabelValues("user-2")))
+}
+
+func generateAlerts(from, to int) []*notifier.Alert {
+	alerts := make([]*notifier.Alert, 0, to-from)
+	for i := from; i < to; i++ {
+		alerts = append(alerts, &notifier.Alert{
+			Labels: labels.Labels{{Name: labels.AlertName, Value: fmt.Sprintf("alert-%d", i)}},
+		})
+	}
+	return alerts
+}
+
+func alertNames(batches ...[]*notifier.Alert) []string {
+	var names []string
+	for _, alerts := range batches {
+		for _, a := range alerts {
+			names = append(names, a.Labels.Get(labels.AlertName))
+		}
+	}
+	return names
+}
@@ -4,19 +4,26 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	gklog "github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/grafana/dskit/backoff"
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/prometheus/discovery"
 	"github.com/prometheus/prometheus/discovery/dns"
 	"github.com/prometheus/prometheus/notifier"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"golang.org/x/net/context/ctxhttp"
 
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/tls"
@@ -25,37 +32,77 @@ import (
 type NotifierConfig struct {
 	TLS       tls.ClientConfig `yaml:",inline"`
 	BasicAuth util.BasicAuth   `yaml:",inline"`
+
+	// Backoff applied when retrying failed notifications, within the notification timeout.
+	BackoffConfig backoff.Config `yaml:"backoff_config"`
 }
 
 func (cfg *NotifierConfig) RegisterFlags(f *flag.FlagSet) {
 	cfg.TLS.RegisterFlagsWithPrefix("ruler.alertmanager-client", f)
 	cfg.BasicAuth.RegisterFlagsWithPrefix("ruler.alertmanager-client.", f)
+	cfg.BackoffConfig.RegisterFlagsWithPrefix("ruler.alertmanager-client", f)
 }
 
 // rulerNotifier bundles a notifier.Manager together with an associated
 // Alertmanager service discovery manager and handles the lifecycle
-// of both actors.
+// of both actors. Notifications are queued in the tenant's queue and
+// handed over to the notifier.Manager one batch at a time.
 type rulerNotifier struct {
+	userID         string
+	queues         *notificationQueues
+	timeout        time.Duration
+	delivered      chan struct{}
+	dispatchCancel context.CancelFunc
+
 	notifier  *notifier.Manager
 	sdCancel  context.CancelFunc
 	sdManager *discovery.Manager
 	wg        sync.WaitGroup
 	logger    gklog.Logger
+
+	// External labels added to the alerts by the applied config.
+	externalLabels labels.Labels
 }
 
-func newRulerNotifier(o *notifier.Options, l gklog.Logger) *rulerNotifier {
+func newRulerNotifier(userID string, queues *notificationQueues, timeout time.Duration, o *notifier.Options, l gklog.Logger) *rulerNotifier {
 	sdCtx, sdCancel := context.WithCancel(context.Background())
-	return &rulerNotifier{
-		notifier:  notifier.NewManager(o, l),
+	rn := &rulerNotifier{
+		userID:    userID,
+		queues:    queues,
+		timeout:   timeout,
+		delivered: make(chan struct{}, 1),
 		sdCancel:  sdCancel,
 		sdManager: discovery.NewManager(sdCtx, l),
 		logger:    l,
 	}
+
+	// Signal the dispatcher once the notifier has done with a batch.
+	do := o.Do
+	o.Do = func(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+		defer func() {
+			select {
+			case rn.delivered <- struct{}{}:
+			default:
+			}
+		}()
+		return do(ctx, client, req)
+	}
+
+	rn.notifier = notifier.NewManager(o, l)
+	return rn
+}
+
+// Send enqueues the notifications to the tenant's queue.
+func (rn *rulerNotifier) Send(alerts ...*notifier.Alert) {
+	rn.queues.push(rn.userID, alerts...)
 }
 
 // run starts the notifier. This function doesn't block and returns immediately.
 func (rn *rulerNotifier) run() {
-	rn.wg.Add(2)
+	var dispatchCtx context.Context
+	dispatchCtx, rn.dispatchCancel = context.WithCancel(context.Background())
+
+	rn.wg.Add(3)
 	go func() {
 		if err := rn.sdManager.Run(); err != nil {
 			level.Error(rn.logger).Log("msg", "error starting notifier discovery manager", "err", err)
@@ -66,12 +113,63 @@ func (rn *rulerNotifier) run() {
 		rn.notifier.Run(rn.sdManager.SyncCh())
 		rn.wg.Done()
 	}()
+	go func() {
+		rn.dispatch(dispatchCtx)
+		rn.wg.Done()
+	}()
+}
+
+// dispatch hands over the notifications from the tenant's queue to the notifier.Manager,
+// waiting for each batch to be sent before handing over the next one. This way the
+// notifications pending because of a slow or unavailable Alertmanager are kept in the
+// tenant's queue, where the per-tenant and global capacities apply.
+func (rn *rulerNotifier) dispatch(ctx context.Context) {
+	queue := rn.queues.queue(rn.userID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-queue.more:
+		}
+
+		for {
+			alerts := rn.queues.pop(rn.userID, notificationBatchSize)
+			if len(alerts) == 0 {
+				break
+			}
+
+			// Clear the signal of a batch previously timed out.
+			select {
+			case <-rn.delivered:
+			default:
+			}
+
+			rn.notifier.Send(alerts...)
+
+			// The notifier drops the notifications straight away when there's no Alertmanager.
+			if len(rn.notifier.Alertmanagers()) == 0 {
+				continue
+			}
+
+			timer := time.NewTimer(rn.timeout)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-rn.delivered:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+	}
 }
 
 func (rn *rulerNotifier) applyConfig(cfg *config.Config) error {
 	if err := rn.notifier.ApplyConfig(cfg); err != nil {
 		return err
 	}
+	rn.externalLabels = cfg.GlobalConfig.ExternalLabels
 
 	sdCfgs := make(map[string]discovery.Configs)
 	for k, v := range cfg.AlertingConfig.AlertmanagerConfigs.ToMap() {
@@ -81,6 +179,7 @@ func (rn *rulerNotifier) applyConfig(cfg *config.Config) error {
 }
 
 func (rn *rulerNotifier) stop() {
+	rn.dispatchCancel()
 	rn.sdCancel()
 	rn.notifier.Stop()
 	rn.wg.Wait()
@@ -196,3 +295,37 @@ func amConfigFromURL(rulerConfig *Config, url *url.URL, apiVersion config.Alertm
 
 	return amConfig
 }
+
+// doWithRetries sends the request to the Alertmanager, retrying with backoff on network
+// errors, 5xx and 429 responses. Retries are bounded by the context, which is cancelled
+// by the notifier once the notification timeout expires.
+func doWithRetries(ctx context.Context, client *http.Client, req *http.Request, cfg backoff.Config) (*http.Response, error) {
+	retries := backoff.New(ctx, cfg)
+
+	for {
+		resp, err := ctxhttp.Do(ctx, client, req)
+		if !isRetriableNotificationError(resp, err) || !retries.Ongoing() || req.GetBody == nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		retries.Wait()
+
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+}
+
+func isRetriableNotificationError(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,83 @@
+package ruler
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/ruler/rulestore"
+)
+
+const (
+	// The reasons of the rule groups skipped by the ruler because exceeding the limits.
+	skippedReasonMaxRulesPerRuleGroup = "max_rules_per_rule_group"
+	skippedReasonMaxRuleGroups        = "max_rule_groups_per_tenant"
+	skippedReasonMaxRules             = "max_rules_per_tenant"
+)
+
+// skippedRuleGroup is a rule group which isn't evaluated, because it exceeds the limits of the user.
+type skippedRuleGroup struct {
+	group  *rulespb.RuleGroupDesc
+	reason string
+}
+
+// limitRuleGroups returns the rule groups of the user within the limits, and the skipped ones. The
+// groups must be all the rule groups of the user, as listed by the store: they're loaded if the
+// rules have to be counted.
+func limitRuleGroups(ctx context.Context, store rulestore.RuleStore, limits RulesLimits, userID string, groups rulespb.RuleGroupList) (rulespb.RuleGroupList, []skippedRuleGroup, error) {
+	maxRulesPerRuleGroup := limits.RulerMaxRulesPerRuleGroup(userID)
+	maxRuleGroups := limits.RulerMaxRuleGroupsPerTenant(userID)
+	maxRules := limits.RulerMaxRulesPerTenant(userID)
+
+	if maxRulesPerRuleGroup <= 0 && maxRuleGroups <= 0 && maxRules <= 0 {
+		return groups, nil, nil
+	}
+
+	if maxRulesPerRuleGroup > 0 || maxRules > 0 {
+		if err := store.LoadRuleGroups(ctx, map[string]rulespb.RuleGroupList{userID: groups}); err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to load rule groups for user %s", userID)
+		}
+	}
+
+	kept, skipped := applyRuleGroupsLimits(groups, maxRulesPerRuleGroup, maxRuleGroups, maxRules)
+	return kept, skipped, nil
+}
+
+// applyRuleGroupsLimits skips the rule groups exceeding the limits, in namespace and name order,
+// so that all the rulers and the API skip the same rule groups. The groups with too many rules are
+// skipped first, then the groups past the number of groups or rules of the user. A limit of 0 is
+// disabled.
+func applyRuleGroupsLimits(groups rulespb.RuleGroupList, maxRulesPerRuleGroup, maxRuleGroups, maxRules int) (rulespb.RuleGroupList, []skippedRuleGroup) {
+	sorted := make(rulespb.RuleGroupList, len(groups))
+	copy(sorted, groups)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].GetNamespace() != sorted[j].GetNamespace() {
+			return sorted[i].GetNamespace() < sorted[j].GetNamespace()
+		}
+		return sorted[i].GetName() < sorted[j].GetName()
+	})
+
+	var (
+		kept    = make(rulespb.RuleGroupList, 0, len(sorted))
+		skipped []skippedRuleGroup
+		rules   int
+	)
+
+	for _, g := range sorted {
+		switch {
+		case maxRulesPerRuleGroup > 0 && len(g.GetRules()) > maxRulesPerRuleGroup:
+			skipped = append(skipped, skippedRuleGroup{group: g, reason: skippedReasonMaxRulesPerRuleGroup})
+		case maxRuleGroups > 0 && len(kept) >= maxRuleGroups:
+			skipped = append(skipped, skippedRuleGroup{group: g, reason: skippedReasonMaxRuleGroups})
+		case maxRules > 0 && rules+len(g.GetRules()) > maxRules:
+			skipped = append(skipped, skippedRuleGroup{group: g, reason: skippedReasonMaxRules})
+		default:
+			kept = append(kept, g)
+			rules += len(g.GetRules())
+		}
+	}
+
+	return kept, skipped
+}
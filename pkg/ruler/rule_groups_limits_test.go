@@ -0,0 +1,159 @@
+package ruler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+)
+
+func TestRuler_ShouldSkipTheRuleGroupsExceedingTheLimits(t *testing.T) {
+	// The rule groups are stored out of order, to check they're skipped in namespace and name order.
+	store := newMockRuleStore(map[string]rulespb.RuleGroupList{
+		"user1": {
+			testRuleGroup("user1", "namespace3", "group1", 1),
+			testRuleGroup("user1", "namespace2", "group2", 1),
+			testRuleGroup("user1", "namespace1", "group3", 3),
+			testRuleGroup("user1", "namespace2", "group1", 2),
+			testRuleGroup("user1", "namespace1", "group2", 1),
+			testRuleGroup("user1", "namespace1", "group1", 2),
+		},
+	})
+	cfg, cleanup := defaultRulerConfig(store)
+	defer cleanup()
+
+	queryable := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return storage.NoopQuerier(), nil
+	})
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1e6, Timeout: time.Minute})
+	limits := ruleLimits{maxRuleGroups: 3, maxRulesPerRuleGroup: 2, maxRulesPerTenant: 4}
+	reg := prometheus.NewRegistry()
+
+	manager, err := NewDefaultMultiTenantManager(cfg, DefaultTenantManagerFactory(cfg, &recordingPusher{}, queryable, engine, limits, nil), limits, reg, log.NewNopLogger())
+	require.NoError(t, err)
+	defer manager.Stop()
+
+	r, err := NewRuler(cfg, manager, reg, log.NewNopLogger(), store, limits, nil)
+	require.NoError(t, err)
+
+	r.syncRules(context.Background(), rulerSyncReasonInitial)
+
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_ruler_rule_groups_skipped_total Total number of times a rule group owned by the ruler was skipped by the sync operation, because exceeding the limits of the tenant.
+		# TYPE cortex_ruler_rule_groups_skipped_total counter
+		cortex_ruler_rule_groups_skipped_total{reason="max_rule_groups_per_tenant",user="user1"} 1
+		cortex_ruler_rule_groups_skipped_total{reason="max_rules_per_rule_group",user="user1"} 1
+		cortex_ruler_rule_groups_skipped_total{reason="max_rules_per_tenant",user="user1"} 1
+	`), "cortex_ruler_rule_groups_skipped_total"))
+
+	// The rules API lists both the evaluated and the skipped rule groups.
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
+	req := requestFor(t, "GET", "https://localhost:8080/api/prom/api/v1/rules", nil, "user1")
+	w := httptest.NewRecorder()
+	a.PrometheusRules(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data struct {
+			Groups []RuleGroup `json:"groups"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	reasons := map[string]string{}
+	for _, g := range resp.Data.Groups {
+		reasons[g.File+"/"+g.Name] = g.SkippedReason
+	}
+	assert.Equal(t, map[string]string{
+		"namespace1/group1": "",
+		"namespace1/group2": "",
+		"namespace1/group3": skippedReasonMaxRulesPerRuleGroup,
+		"namespace2/group1": skippedReasonMaxRules,
+		"namespace2/group2": "",
+		"namespace3/group1": skippedReasonMaxRuleGroups,
+	}, reasons)
+}
+
+func TestApplyRuleGroupsLimits(t *testing.T) {
+	groups := rulespb.RuleGroupList{
+		testRuleGroup("user1", "namespace2", "group1", 2),
+		testRuleGroup("user1", "namespace1", "group2", 3),
+		testRuleGroup("user1", "namespace1", "group1", 1),
+		testRuleGroup("user1", "namespace3", "group1", 1),
+	}
+
+	tests := map[string]struct {
+		maxRulesPerRuleGroup int
+		maxRuleGroups        int
+		maxRules             int
+		expectedKept         []string
+		expectedSkipped      map[string]string
+	}{
+		"no limits": {
+			expectedKept:    []string{"namespace1/group1", "namespace1/group2", "namespace2/group1", "namespace3/group1"},
+			expectedSkipped: map[string]string{},
+		},
+		"max rules per rule group": {
+			maxRulesPerRuleGroup: 2,
+			expectedKept:         []string{"namespace1/group1", "namespace2/group1", "namespace3/group1"},
+			expectedSkipped:      map[string]string{"namespace1/group2": skippedReasonMaxRulesPerRuleGroup},
+		},
+		"max rule groups": {
+			maxRuleGroups:   2,
+			expectedKept:    []string{"namespace1/group1", "namespace1/group2"},
+			expectedSkipped: map[string]string{"namespace2/group1": skippedReasonMaxRuleGroups, "namespace3/group1": skippedReasonMaxRuleGroups},
+		},
+		"max rules skips the groups not fitting, but not the following ones": {
+			maxRules:        5,
+			expectedKept:    []string{"namespace1/group1", "namespace1/group2", "namespace3/group1"},
+			expectedSkipped: map[string]string{"namespace2/group1": skippedReasonMaxRules},
+		},
+		"the groups with too many rules aren't counted": {
+			maxRulesPerRuleGroup: 2,
+			maxRuleGroups:        2,
+			maxRules:             3,
+			expectedKept:         []string{"namespace1/group1", "namespace2/group1"},
+			expectedSkipped:      map[string]string{"namespace1/group2": skippedReasonMaxRulesPerRuleGroup, "namespace3/group1": skippedReasonMaxRuleGroups},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			kept, skipped := applyRuleGroupsLimits(groups, tc.maxRulesPerRuleGroup, tc.maxRuleGroups, tc.maxRules)
+
+			keptNames := []string{}
+			for _, g := range kept {
+				keptNames = append(keptNames, g.Namespace+"/"+g.Name)
+			}
+			skippedReasons := map[string]string{}
+			for _, s := range skipped {
+				skippedReasons[s.group.Namespace+"/"+s.group.Name] = s.reason
+			}
+
+			assert.Equal(t, tc.expectedKept, keptNames)
+			assert.Equal(t, tc.expectedSkipped, skippedReasons)
+		})
+	}
+}
+
+func testRuleGroup(userID, namespace, name string, rules int) *rulespb.RuleGroupDesc {
+	g := &rulespb.RuleGroupDesc{Name: name, Namespace: namespace, User: userID, Interval: time.Minute}
+	for i := 0; i < rules; i++ {
+		g.Rules = append(g.Rules, &rulespb.RuleDesc{Record: "up:sum", Expr: "sum(up)"})
+	}
+	return g
+}
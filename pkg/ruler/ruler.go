@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -46,6 +47,9 @@ var (
 	// Validation errors.
 	errInvalidShardingStrategy = errors.New("invalid sharding strategy")
 	errInvalidTenantShardSize  = errors.New("invalid tenant shard size, the value must be greater than 0")
+	errInvalidMaxJitter        = errors.New("invalid evaluation max jitter, the value must not be negative")
+
+	errInvalidNotificationQueueOverflowPolicy = errors.New("invalid notification queue overflow policy")
 )
 
 const (
@@ -60,6 +64,7 @@ const (
 	// Limit errors
 	errMaxRuleGroupsPerUserLimitExceeded        = "per-user rule groups limit (limit: %d actual: %d) exceeded"
 	errMaxRulesPerRuleGroupPerUserLimitExceeded = "per-user rules per rule group limit (limit: %d actual: %d) exceeded"
+	errMaxRulesPerUserLimitExceeded             = "per-user rules limit (limit: %d actual: %d) exceeded"
 
 	// errors
 	errListAllUser = "unable to list the ruler users"
@@ -73,6 +78,8 @@ type Config struct {
 	ClientTLSConfig grpcclient.Config `yaml:"ruler_client"`
 	// How frequently to evaluate rules by default.
 	EvaluationInterval time.Duration `yaml:"evaluation_interval"`
+	// Max offset of the evaluation of the rule groups within their evaluation interval.
+	EvaluationMaxJitter time.Duration `yaml:"evaluation_max_jitter"`
 	// How frequently to poll for updated rules.
 	PollInterval time.Duration `yaml:"poll_interval"`
 	// Rule Storage and Polling configuration.
@@ -88,8 +95,12 @@ type Config struct {
 	AlertmanagerRefreshInterval time.Duration `yaml:"alertmanager_refresh_interval"`
 	// Enables the ruler notifier to use the Alertmananger V2 API.
 	AlertmanangerEnableV2API bool `yaml:"enable_alertmanager_v2"`
-	// Capacity of the queue for notifications to be sent to the Alertmanager.
+	// Capacity of the per-tenant queue for notifications to be sent to the Alertmanager.
 	NotificationQueueCapacity int `yaml:"notification_queue_capacity"`
+	// Which notifications to drop when a per-tenant queue is full.
+	NotificationQueueOverflowPolicy string `yaml:"notification_queue_overflow_policy"`
+	// Capacity of the queues for notifications to be sent to the Alertmanager, across all tenants.
+	NotificationQueueGlobalCapacity int `yaml:"notification_queue_global_capacity"`
 	// HTTP timeout duration when sending notifications to the Alertmanager.
 	NotificationTimeout time.Duration `yaml:"notification_timeout"`
 	// Client configs for interacting with the Alertmanager
@@ -109,7 +120,8 @@ type Config struct {
 	Ring             RingConfig    `yaml:"ring"`
 	FlushCheckPeriod time.Duration `yaml:"flush_period"`
 
-	EnableAPI bool `yaml:"enable_api"`
+	EnableAPI     bool          `yaml:"enable_api"`
+	DryRunTimeout time.Duration `yaml:"dry_run_timeout"`
 
 	EnabledTenants  flagext.StringSliceCSV `yaml:"enabled_tenants"`
 	DisabledTenants flagext.StringSliceCSV `yaml:"disabled_tenants"`
@@ -117,6 +129,16 @@ type Config struct {
 	RingCheckPeriod time.Duration `yaml:"-"`
 
 	EnableQueryStats bool `yaml:"query_stats_enabled"`
+
+	TenantFederation TenantFederationConfig `yaml:"tenant_federation"`
+
+	QueryFrontend QueryFrontendConfig `yaml:"query_frontend"`
+
+	WriteRetry WriteRetryConfig `yaml:"write_retry"`
+
+	AlertState AlertStateConfig `yaml:"alert_state"`
+
+	MetricProvenance MetricProvenanceConfig `yaml:"metric_provenance"`
 }
 
 // Validate config and returns error on failure
@@ -129,12 +151,32 @@ func (cfg *Config) Validate(limits validation.Limits, log log.Logger) error {
 		return errInvalidTenantShardSize
 	}
 
+	if cfg.EvaluationMaxJitter < 0 {
+		return errInvalidMaxJitter
+	}
+
+	if !util.StringsContain(supportedNotificationQueueOverflowPolicies, cfg.NotificationQueueOverflowPolicy) {
+		return errInvalidNotificationQueueOverflowPolicy
+	}
+
 	if err := cfg.StoreConfig.Validate(); err != nil {
 		return errors.Wrap(err, "invalid storage config")
 	}
 	if err := cfg.ClientTLSConfig.Validate(log); err != nil {
 		return errors.Wrap(err, "invalid ruler gRPC client config")
 	}
+	if err := cfg.QueryFrontend.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.QueryFrontend.GRPCClientConfig.Validate(log); err != nil {
+		return errors.Wrap(err, "invalid ruler query-frontend gRPC client config")
+	}
+	if err := cfg.AlertState.Validate(); err != nil {
+		return errors.Wrap(err, "invalid ruler alert state config")
+	}
+	if err := cfg.MetricProvenance.Validate(); err != nil {
+		return errors.Wrap(err, "invalid ruler metric provenance config")
+	}
 	return nil
 }
 
@@ -151,15 +193,18 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	flagext.DeprecatedFlag(f, "ruler.num-workers", "This flag is no longer functional. For increased concurrency horizontal sharding is recommended")
 
 	cfg.ExternalURL.URL, _ = url.Parse("") // Must be non-nil
-	f.Var(&cfg.ExternalURL, "ruler.external.url", "URL of alerts return path.")
+	f.Var(&cfg.ExternalURL, "ruler.external.url", "URL of alerts return path. Can be overridden on a per-tenant basis with -ruler.tenant-external-url.")
 	f.DurationVar(&cfg.EvaluationInterval, "ruler.evaluation-interval", 1*time.Minute, "How frequently to evaluate rules")
+	f.DurationVar(&cfg.EvaluationMaxJitter, "ruler.evaluation-max-jitter", 0, "Max offset of the evaluation of the rule groups within their evaluation interval, computed from the hash of the rule group, unless the rule group aligns its evaluation time on the interval. 0 to spread the evaluations over the whole interval.")
 	f.DurationVar(&cfg.PollInterval, "ruler.poll-interval", 1*time.Minute, "How frequently to poll for rule changes")
 
 	f.StringVar(&cfg.AlertmanagerURL, "ruler.alertmanager-url", "", "Comma-separated list of URL(s) of the Alertmanager(s) to send notifications to. Each Alertmanager URL is treated as a separate group in the configuration. Multiple Alertmanagers in HA per group can be supported by using DNS resolution via -ruler.alertmanager-discovery.")
 	f.BoolVar(&cfg.AlertmanagerDiscovery, "ruler.alertmanager-discovery", false, "Use DNS SRV records to discover Alertmanager hosts.")
 	f.DurationVar(&cfg.AlertmanagerRefreshInterval, "ruler.alertmanager-refresh-interval", 1*time.Minute, "How long to wait between refreshing DNS resolutions of Alertmanager hosts.")
 	f.BoolVar(&cfg.AlertmanangerEnableV2API, "ruler.alertmanager-use-v2", false, "If enabled requests to Alertmanager will utilize the V2 API.")
-	f.IntVar(&cfg.NotificationQueueCapacity, "ruler.notification-queue-capacity", 10000, "Capacity of the queue for notifications to be sent to the Alertmanager.")
+	f.IntVar(&cfg.NotificationQueueCapacity, "ruler.notification-queue-capacity", 10000, "Capacity of the per-tenant queue for notifications to be sent to the Alertmanager. Can be overridden on a per-tenant basis with -ruler.tenant-notification-queue-capacity.")
+	f.StringVar(&cfg.NotificationQueueOverflowPolicy, "ruler.notification-queue-overflow-policy", notificationQueueDropOldest, fmt.Sprintf("Which notifications to drop when a per-tenant queue is full. Supported values are: %s.", strings.Join(supportedNotificationQueueOverflowPolicies, ", ")))
+	f.IntVar(&cfg.NotificationQueueGlobalCapacity, "ruler.notification-queue-global-capacity", 0, "Maximum number of notifications queued across all tenants. When exceeded, notifications are dropped from each tenant's queue proportionally to its length. 0 to disable.")
 	f.DurationVar(&cfg.NotificationTimeout, "ruler.notification-timeout", 10*time.Second, "HTTP timeout duration when sending notifications to the Alertmanager.")
 
 	f.DurationVar(&cfg.SearchPendingFor, "ruler.search-pending-for", 5*time.Minute, "Time to spend searching for a pending ruler when shutting down.")
@@ -168,6 +213,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.FlushCheckPeriod, "ruler.flush-period", 1*time.Minute, "Period with which to attempt to flush rule groups.")
 	f.StringVar(&cfg.RulePath, "ruler.rule-path", "/rules", "file path to store temporary rule files for the prometheus rule managers")
 	f.BoolVar(&cfg.EnableAPI, "experimental.ruler.enable-api", false, "Enable the ruler api")
+	f.DurationVar(&cfg.DryRunTimeout, "experimental.ruler.dry-run-timeout", 30*time.Second, "Timeout of the evaluation of a rule group tested through the ruler api, without storing it.")
 	f.DurationVar(&cfg.OutageTolerance, "ruler.for-outage-tolerance", time.Hour, `Max time to tolerate outage for restoring "for" state of alert.`)
 	f.DurationVar(&cfg.ForGracePeriod, "ruler.for-grace-period", 10*time.Minute, `Minimum duration between alert and restored "for" state. This is maintained only for alerts with configured "for" time greater than grace period.`)
 	f.DurationVar(&cfg.ResendDelay, "ruler.resend-delay", time.Minute, `Minimum amount of time to wait before resending an alert to Alertmanager.`)
@@ -177,6 +223,12 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 
 	f.BoolVar(&cfg.EnableQueryStats, "ruler.query-stats-enabled", false, "Report the wall time for ruler queries to complete as a per user metric and as an info level log message.")
 
+	cfg.TenantFederation.RegisterFlags(f)
+	cfg.QueryFrontend.RegisterFlags(f)
+	cfg.WriteRetry.RegisterFlags(f)
+	cfg.AlertState.RegisterFlags(f)
+	cfg.MetricProvenance.RegisterFlags(f)
+
 	cfg.RingCheckPeriod = 5 * time.Second
 }
 
@@ -187,6 +239,9 @@ type MultiTenantManager interface {
 	SyncRuleGroups(ctx context.Context, ruleGroups map[string]rulespb.RuleGroupList)
 	// GetRules fetches rules for a particular tenant (userID).
 	GetRules(userID string) []*promRules.Group
+	// GetRuleEvaluationStats returns the evaluation stats of the rule of a tenant, identified
+	// by its rule group and its query.
+	GetRuleEvaluationStats(userID, namespace, group, query string) RuleEvaluationStats
 	// Stop stops all Manager components.
 	Stop()
 	// ValidateRuleGroup validates a rulegroup
@@ -229,14 +284,18 @@ type Ruler struct {
 	manager    MultiTenantManager
 	limits     RulesLimits
 
+	// Checks the metrics recorded by the rule groups for collisions, nil if disabled.
+	metricCollisions *MetricCollisionChecker
+
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
 
 	// Pool of clients used to connect to other ruler replicas.
 	clientsPool *ring_client.Pool
 
-	ringCheckErrors prometheus.Counter
-	rulerSync       *prometheus.CounterVec
+	ringCheckErrors   prometheus.Counter
+	rulerSync         *prometheus.CounterVec
+	ruleGroupsSkipped *prometheus.CounterVec
 
 	allowedTenants *util.AllowedTenants
 
@@ -245,7 +304,7 @@ type Ruler struct {
 }
 
 // NewRuler creates a new ruler from a distributor and chunk store.
-func NewRuler(cfg Config, manager MultiTenantManager, reg prometheus.Registerer, logger log.Logger, ruleStore rulestore.RuleStore, limits RulesLimits) (*Ruler, error) {
+func NewRuler(cfg Config, manager MultiTenantManager, reg prometheus.Registerer, logger log.Logger, ruleStore rulestore.RuleStore, limits RulesLimits, metricCollisions *MetricCollisionChecker) (*Ruler, error) {
 	ruler := &Ruler{
 		cfg:            cfg,
 		store:          ruleStore,
@@ -256,6 +315,8 @@ func NewRuler(cfg Config, manager MultiTenantManager, reg prometheus.Registerer,
 		clientsPool:    newRulerClientPool(cfg.ClientTLSConfig, logger, reg),
 		allowedTenants: util.NewAllowedTenants(cfg.EnabledTenants, cfg.DisabledTenants),
 
+		metricCollisions: metricCollisions,
+
 		ringCheckErrors: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Name: "cortex_ruler_ring_check_errors_total",
 			Help: "Number of errors that have occurred when checking the ring for ownership",
@@ -265,6 +326,11 @@ func NewRuler(cfg Config, manager MultiTenantManager, reg prometheus.Registerer,
 			Name: "cortex_ruler_sync_rules_total",
 			Help: "Total number of times the ruler sync operation triggered.",
 		}, []string{"reason"}),
+
+		ruleGroupsSkipped: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_ruler_rule_groups_skipped_total",
+			Help: "Total number of times a rule group owned by the ruler was skipped by the sync operation, because exceeding the limits of the tenant.",
+		}, []string{"user", "reason"}),
 	}
 
 	if len(cfg.EnabledTenants) > 0 {
@@ -355,7 +421,8 @@ func (r *Ruler) stopping(_ error) error {
 	return nil
 }
 
-type sender interface {
+// Sender sends alerts to the Alertmanager.
+type Sender interface {
 	Send(alerts ...*notifier.Alert)
 }
 
@@ -363,7 +430,7 @@ type sender interface {
 // It filters any non-firing alerts from the input.
 //
 // Copied from Prometheus's main.go.
-func SendAlerts(n sender, externalURL string) promRules.NotifyFunc {
+func SendAlerts(n Sender, externalURL string) promRules.NotifyFunc {
 	return func(ctx context.Context, expr string, alerts ...*promRules.Alert) {
 		var res []*notifier.Alert
 
@@ -482,7 +549,8 @@ func (r *Ruler) syncRules(ctx context.Context, reason string) {
 		return
 	}
 
-	err = r.store.LoadRuleGroups(ctx, configs)
+	// The rule groups of the users with rules limits have already been loaded to enforce them.
+	err = r.store.LoadRuleGroups(ctx, unloadedRuleGroups(configs))
 	if err != nil {
 		level.Error(r.logger).Log("msg", "unable to load rules owned by this ruler", "err", err)
 		return
@@ -490,6 +558,10 @@ func (r *Ruler) syncRules(ctx context.Context, reason string) {
 
 	// This will also delete local group files for users that are no longer in 'configs' map.
 	r.manager.SyncRuleGroups(ctx, configs)
+
+	if r.metricCollisions != nil {
+		r.metricCollisions.update(ctx, configs)
+	}
 }
 
 func (r *Ruler) listRules(ctx context.Context) (result map[string]rulespb.RuleGroupList, err error) {
@@ -521,7 +593,22 @@ func (r *Ruler) listRules(ctx context.Context) (result map[string]rulespb.RuleGr
 }
 
 func (r *Ruler) listRulesNoSharding(ctx context.Context) (map[string]rulespb.RuleGroupList, error) {
-	return r.store.ListAllRuleGroups(ctx)
+	configs, err := r.store.ListAllRuleGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limitedConfigs := make(map[string]rulespb.RuleGroupList)
+	for userID, groups := range configs {
+		owned, err := r.ownedRuleGroups(ctx, userID, groups, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(owned) > 0 {
+			limitedConfigs[userID] = owned
+		}
+	}
+	return limitedConfigs, nil
 }
 
 func (r *Ruler) listRulesShardingDefault(ctx context.Context) (map[string]rulespb.RuleGroupList, error) {
@@ -532,7 +619,10 @@ func (r *Ruler) listRulesShardingDefault(ctx context.Context) (map[string]rulesp
 
 	filteredConfigs := make(map[string]rulespb.RuleGroupList)
 	for userID, groups := range configs {
-		filtered := filterRuleGroups(userID, groups, r.ring, r.lifecycler.GetInstanceAddr(), r.logger, r.ringCheckErrors)
+		filtered, err := r.ownedRuleGroups(ctx, userID, groups, r.ring)
+		if err != nil {
+			return nil, err
+		}
 		if len(filtered) > 0 {
 			filteredConfigs[userID] = filtered
 		}
@@ -590,7 +680,10 @@ func (r *Ruler) listRulesShuffleSharding(ctx context.Context) (map[string]rulesp
 					return errors.Wrapf(err, "failed to fetch rule groups for user %s", userID)
 				}
 
-				filtered := filterRuleGroups(userID, groups, userRings[userID], r.lifecycler.GetInstanceAddr(), r.logger, r.ringCheckErrors)
+				filtered, err := r.ownedRuleGroups(gctx, userID, groups, userRings[userID])
+				if err != nil {
+					return err
+				}
 				if len(filtered) == 0 {
 					continue
 				}
@@ -607,6 +700,46 @@ func (r *Ruler) listRulesShuffleSharding(ctx context.Context) (map[string]rulesp
 	return result, err
 }
 
+// ownedRuleGroups returns the rule groups of the user owned by this ruler, once the rule groups
+// exceeding the limits of the user have been skipped. The groups must be all the rule groups of the
+// user, so that all the rulers skip the same ones. The userRing is nil if sharding is disabled.
+func (r *Ruler) ownedRuleGroups(ctx context.Context, userID string, groups rulespb.RuleGroupList, userRing ring.ReadRing) (rulespb.RuleGroupList, error) {
+	groups, skipped, err := limitRuleGroups(ctx, r.store, r.limits, userID, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range skipped {
+		// The skipped rule groups are only reported by the ruler which would own them.
+		if userRing != nil {
+			if owned, err := instanceOwnsRuleGroup(userRing, s.group, r.lifecycler.GetInstanceAddr()); err != nil || !owned {
+				continue
+			}
+		}
+
+		level.Warn(r.logger).Log("msg", "rule group skipped because exceeding the limits", "user", userID, "namespace", s.group.Namespace, "group", s.group.Name, "reason", s.reason)
+		r.ruleGroupsSkipped.WithLabelValues(userID, s.reason).Inc()
+	}
+
+	if userRing == nil {
+		return groups, nil
+	}
+	return filterRuleGroups(userID, groups, userRing, r.lifecycler.GetInstanceAddr(), r.logger, r.ringCheckErrors), nil
+}
+
+// unloadedRuleGroups returns the rule groups whose rules haven't been loaded yet.
+func unloadedRuleGroups(configs map[string]rulespb.RuleGroupList) map[string]rulespb.RuleGroupList {
+	unloaded := make(map[string]rulespb.RuleGroupList, len(configs))
+	for userID, groups := range configs {
+		for _, g := range groups {
+			if len(g.GetRules()) == 0 {
+				unloaded[userID] = append(unloaded[userID], g)
+			}
+		}
+	}
+	return unloaded
+}
+
 // filterRuleGroups returns map of rule groups that given instance "owns" based on supplied ring.
 // This function only uses User, Namespace, and Name fields of individual RuleGroups.
 //
@@ -635,22 +768,43 @@ func filterRuleGroups(userID string, ruleGroups []*rulespb.RuleGroupDesc, ring r
 }
 
 // GetRules retrieves the running rules from this ruler and all running rulers in the ring if
-// sharding is enabled
-func (r *Ruler) GetRules(ctx context.Context) ([]*GroupStateDesc, error) {
+// sharding is enabled. The returned warnings are the errors of the rulers which couldn't be
+// queried, whose rule groups are missing from the partial result.
+func (r *Ruler) GetRules(ctx context.Context) ([]*GroupStateDesc, []string, error) {
 	userID, err := tenant.TenantID(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("no user id found in context")
+		return nil, nil, fmt.Errorf("no user id found in context")
 	}
 
 	if r.cfg.EnableSharding {
-		return r.getShardedRules(ctx)
+		return r.getShardedRules(ctx, userID)
 	}
 
-	return r.getLocalRules(userID)
+	groups, err := r.getLocalRules(userID)
+	return groups, nil, err
+}
+
+// groupLastEvaluation returns the start and the duration of the last evaluation of the rule group,
+// computed from the evaluations of its rules, because the rule groups evaluated by the
+// scheduledManager don't record them.
+func groupLastEvaluation(group *promRules.Group) (time.Time, time.Duration) {
+	var (
+		start    time.Time
+		duration time.Duration
+	)
+	for _, rule := range group.Rules() {
+		if ts := rule.GetEvaluationTimestamp(); !ts.IsZero() && (start.IsZero() || ts.Before(start)) {
+			start = ts
+		}
+		duration += rule.GetEvaluationDuration()
+	}
+	return start, duration
 }
 
 func (r *Ruler) getLocalRules(userID string) ([]*GroupStateDesc, error) {
 	groups := r.manager.GetRules(userID)
+	getEvaluationStats := r.manager.GetRuleEvaluationStats
+	metricCollisions := r.metricCollisions
 
 	groupDescs := make([]*GroupStateDesc, 0, len(groups))
 	prefix := filepath.Join(r.cfg.RulePath, userID) + "/"
@@ -664,6 +818,7 @@ func (r *Ruler) getLocalRules(userID string) ([]*GroupStateDesc, error) {
 			return nil, errors.Wrap(err, "unable to decode rule filename")
 		}
 
+		lastEvaluation, evaluationDuration := groupLastEvaluation(group)
 		groupDesc := &GroupStateDesc{
 			Group: &rulespb.RuleGroupDesc{
 				Name:      group.Name(),
@@ -672,8 +827,8 @@ func (r *Ruler) getLocalRules(userID string) ([]*GroupStateDesc, error) {
 				User:      userID,
 			},
 
-			EvaluationTimestamp: group.GetLastEvaluation(),
-			EvaluationDuration:  group.GetEvaluationTime(),
+			EvaluationTimestamp: lastEvaluation,
+			EvaluationDuration:  evaluationDuration,
 		}
 		for _, r := range group.Rules() {
 			lastError := ""
@@ -708,7 +863,7 @@ func (r *Ruler) getLocalRules(userID string) ([]*GroupStateDesc, error) {
 						Annotations: cortexpb.FromLabelsToLabelAdapters(rule.Annotations()),
 					},
 					State:               rule.State().String(),
-					Health:              string(rule.Health()),
+					Health:              ruleHealth(string(rule.Health()), rule.LastError()),
 					LastError:           lastError,
 					Alerts:              alerts,
 					EvaluationTimestamp: rule.GetEvaluationTimestamp(),
@@ -721,14 +876,25 @@ func (r *Ruler) getLocalRules(userID string) ([]*GroupStateDesc, error) {
 						Expr:   rule.Query().String(),
 						Labels: cortexpb.FromLabelsToLabelAdapters(rule.Labels()),
 					},
-					Health:              string(rule.Health()),
+					Health:              ruleHealth(string(rule.Health()), rule.LastError()),
 					LastError:           lastError,
 					EvaluationTimestamp: rule.GetEvaluationTimestamp(),
 					EvaluationDuration:  rule.GetEvaluationDuration(),
 				}
+				if metricCollisions.collides(userID, decodedNamespace, group.Name(), rule.Name()) {
+					ruleDesc.Health = ruleHealthDegraded
+					ruleDesc.LastError = metricCollisionError([]string{rule.Name()}).Error()
+				}
 			default:
 				return nil, errors.Errorf("failed to assert type of rule '%v'", rule.Name())
 			}
+
+			stats := getEvaluationStats(userID, decodedNamespace, group.Name(), ruleDesc.Rule.Expr)
+			ruleDesc.EvaluationFailures = stats.Failures
+			ruleDesc.LastFailureError = stats.LastError
+			ruleDesc.LastFailureTimestamp = stats.LastFailure
+			ruleDesc.LastSuccessTimestamp = stats.LastSuccess
+
 			groupDesc.ActiveRules = append(groupDesc.ActiveRules, ruleDesc)
 		}
 		groupDescs = append(groupDescs, groupDesc)
@@ -736,46 +902,103 @@ func (r *Ruler) getLocalRules(userID string) ([]*GroupStateDesc, error) {
 	return groupDescs, nil
 }
 
-func (r *Ruler) getShardedRules(ctx context.Context) ([]*GroupStateDesc, error) {
-	rulers, err := r.ring.GetReplicationSetForOperation(RingOp)
+func (r *Ruler) getShardedRules(ctx context.Context, userID string) ([]*GroupStateDesc, []string, error) {
+	// With shuffle sharding, only the rulers of the shard of the user own its rule groups.
+	var rulersRing ring.ReadRing = r.ring
+	if r.cfg.ShardingStrategy == util.ShardingStrategyShuffle {
+		if shardSize := r.limits.RulerTenantShardSize(userID); shardSize > 0 {
+			rulersRing = r.ring.ShuffleShard(userID, shardSize)
+		}
+	}
+
+	rulers, err := rulersRing.GetReplicationSetForOperation(RingOp)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	ctx, err = user.InjectIntoGRPCRequest(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to inject user ID into grpc request, %v", err)
+		return nil, nil, fmt.Errorf("unable to inject user ID into grpc request, %v", err)
 	}
 
 	var (
 		mergedMx sync.Mutex
 		merged   []*GroupStateDesc
+		warnings []string
+		lastErr  error
 	)
 
-	// Concurrently fetch rules from all rulers. Since rules are not replicated,
-	// we need all requests to succeed.
+	// Concurrently fetch rules from all rulers. Since rules are not replicated, the rule groups
+	// of the rulers which can't be queried are missing, and a warning is returned for each of them.
 	jobs := concurrency.CreateJobsFromStrings(rulers.GetAddresses())
 	err = concurrency.ForEach(ctx, jobs, len(jobs), func(ctx context.Context, job interface{}) error {
 		addr := job.(string)
 
-		grpcClient, err := r.clientsPool.GetClientFor(addr)
-		if err != nil {
-			return errors.Wrapf(err, "unable to get client for ruler %s", addr)
-		}
+		newGrps, err := r.getRulesFrom(ctx, addr)
+
+		mergedMx.Lock()
+		defer mergedMx.Unlock()
 
-		newGrps, err := grpcClient.(RulerClient).Rules(ctx, &RulesRequest{})
 		if err != nil {
-			return errors.Wrapf(err, "unable to retrieve rules from ruler %s", addr)
+			level.Warn(r.logger).Log("msg", "unable to retrieve rules from ruler", "ruler", addr, "user", userID, "err", err)
+			warnings = append(warnings, err.Error())
+			lastErr = err
+			return nil
 		}
 
-		mergedMx.Lock()
-		merged = append(merged, newGrps.Groups...)
-		mergedMx.Unlock()
-
+		merged = append(merged, newGrps...)
 		return nil
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The result is an error, rather than empty, if no ruler could be queried.
+	if len(jobs) > 0 && len(warnings) == len(jobs) {
+		return nil, nil, lastErr
+	}
 
-	return merged, err
+	sort.Strings(warnings)
+	return mergeGroupStateDescs(merged), warnings, nil
+}
+
+func (r *Ruler) getRulesFrom(ctx context.Context, addr string) ([]*GroupStateDesc, error) {
+	grpcClient, err := r.clientsPool.GetClientFor(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get client for ruler %s", addr)
+	}
+
+	resp, err := grpcClient.(RulerClient).Rules(ctx, &RulesRequest{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to retrieve rules from ruler %s", addr)
+	}
+	return resp.Groups, nil
+}
+
+// mergeGroupStateDescs merges the rule groups returned by the rulers. While the ring changes, a
+// rule group may be briefly running on two rulers, and the most recently evaluated one is kept.
+func mergeGroupStateDescs(groups []*GroupStateDesc) []*GroupStateDesc {
+	type groupKey struct {
+		namespace string
+		name      string
+	}
+
+	merged := make([]*GroupStateDesc, 0, len(groups))
+	indexes := make(map[groupKey]int, len(groups))
+
+	for _, g := range groups {
+		key := groupKey{namespace: g.Group.GetNamespace(), name: g.Group.GetName()}
+		if i, ok := indexes[key]; ok {
+			if g.EvaluationTimestamp.After(merged[i].EvaluationTimestamp) {
+				merged[i] = g
+			}
+			continue
+		}
+
+		indexes[key] = len(merged)
+		merged = append(merged, g)
+	}
+	return merged
 }
 
 // Rules implements the rules service
@@ -824,6 +1047,27 @@ func (r *Ruler) AssertMaxRulesPerRuleGroup(userID string, rules int) error {
 	return fmt.Errorf(errMaxRulesPerRuleGroupPerUserLimitExceeded, limit, rules)
 }
 
+// AssertMaxRulesPerTenant limit has not been reached compared to the current
+// number of rules across all the rule groups in input and returns an error if so.
+func (r *Ruler) AssertMaxRulesPerTenant(userID string, rules int) error {
+	limit := r.limits.RulerMaxRulesPerTenant(userID)
+
+	if limit <= 0 {
+		return nil
+	}
+
+	if rules <= limit {
+		return nil
+	}
+	return fmt.Errorf(errMaxRulesPerUserLimitExceeded, limit, rules)
+}
+
+// AssertSourceTenants returns an error if the rule groups of the user aren't allowed
+// to query the source tenants in input.
+func (r *Ruler) AssertSourceTenants(userID string, sourceTenants []string) error {
+	return validateSourceTenants(r.cfg.TenantFederation, r.limits, userID, sourceTenants)
+}
+
 func (r *Ruler) DeleteTenantConfiguration(w http.ResponseWriter, req *http.Request) {
 	logger := util_log.WithContext(req.Context(), r.logger)
 
@@ -872,7 +1116,7 @@ func (r *Ruler) ListAllRules(w http.ResponseWriter, req *http.Request) {
 		if err := r.store.LoadRuleGroups(ctx, userRules); err != nil {
 			return errors.Wrapf(err, "failed to load ruler config for user %s", userID)
 		}
-		data := map[string]map[string][]rulefmt.RuleGroup{userID: userRules[userID].Formatted()}
+		data := map[string]map[string][]rulespb.RuleGroup{userID: userRules[userID].FormattedWithSourceTenants()}
 
 		select {
 		case iter <- data:
@@ -186,13 +186,17 @@ func (m *GroupStateDesc) GetEvaluationDuration() time.Duration {
 
 // RuleStateDesc is a proto representation of a Prometheus Rule
 type RuleStateDesc struct {
-	Rule                *rulespb.RuleDesc `protobuf:"bytes,1,opt,name=rule,proto3" json:"rule,omitempty"`
-	State               string            `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
-	Health              string            `protobuf:"bytes,3,opt,name=health,proto3" json:"health,omitempty"`
-	LastError           string            `protobuf:"bytes,4,opt,name=lastError,proto3" json:"lastError,omitempty"`
-	Alerts              []*AlertStateDesc `protobuf:"bytes,5,rep,name=alerts,proto3" json:"alerts,omitempty"`
-	EvaluationTimestamp time.Time         `protobuf:"bytes,6,opt,name=evaluationTimestamp,proto3,stdtime" json:"evaluationTimestamp"`
-	EvaluationDuration  time.Duration     `protobuf:"bytes,7,opt,name=evaluationDuration,proto3,stdduration" json:"evaluationDuration"`
+	Rule                 *rulespb.RuleDesc `protobuf:"bytes,1,opt,name=rule,proto3" json:"rule,omitempty"`
+	State                string            `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	Health               string            `protobuf:"bytes,3,opt,name=health,proto3" json:"health,omitempty"`
+	LastError            string            `protobuf:"bytes,4,opt,name=lastError,proto3" json:"lastError,omitempty"`
+	Alerts               []*AlertStateDesc `protobuf:"bytes,5,rep,name=alerts,proto3" json:"alerts,omitempty"`
+	EvaluationTimestamp  time.Time         `protobuf:"bytes,6,opt,name=evaluationTimestamp,proto3,stdtime" json:"evaluationTimestamp"`
+	EvaluationDuration   time.Duration     `protobuf:"bytes,7,opt,name=evaluationDuration,proto3,stdduration" json:"evaluationDuration"`
+	EvaluationFailures   int64             `protobuf:"varint,8,opt,name=evaluationFailures,proto3" json:"evaluationFailures,omitempty"`
+	LastFailureError     string            `protobuf:"bytes,9,opt,name=lastFailureError,proto3" json:"lastFailureError,omitempty"`
+	LastFailureTimestamp time.Time         `protobuf:"bytes,10,opt,name=lastFailureTimestamp,proto3,stdtime" json:"lastFailureTimestamp"`
+	LastSuccessTimestamp time.Time         `protobuf:"bytes,11,opt,name=lastSuccessTimestamp,proto3,stdtime" json:"lastSuccessTimestamp"`
 }
 
 func (m *RuleStateDesc) Reset()      { *m = RuleStateDesc{} }
@@ -276,6 +280,34 @@ func (m *RuleStateDesc) GetEvaluationDuration() time.Duration {
 	return 0
 }
 
+func (m *RuleStateDesc) GetEvaluationFailures() int64 {
+	if m != nil {
+		return m.EvaluationFailures
+	}
+	return 0
+}
+
+func (m *RuleStateDesc) GetLastFailureError() string {
+	if m != nil {
+		return m.LastFailureError
+	}
+	return ""
+}
+
+func (m *RuleStateDesc) GetLastFailureTimestamp() time.Time {
+	if m != nil {
+		return m.LastFailureTimestamp
+	}
+	return time.Time{}
+}
+
+func (m *RuleStateDesc) GetLastSuccessTimestamp() time.Time {
+	if m != nil {
+		return m.LastSuccessTimestamp
+	}
+	return time.Time{}
+}
+
 type AlertStateDesc struct {
 	State       string                                                      `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
 	Labels      []github_com_cortexproject_cortex_pkg_cortexpb.LabelAdapter `protobuf:"bytes,2,rep,name=labels,proto3,customtype=github.com/cortexproject/cortex/pkg/cortexpb.LabelAdapter" json:"labels"`
@@ -380,50 +412,54 @@ func init() {
 func init() { proto.RegisterFile("ruler.proto", fileDescriptor_9ecbec0a4cfddea6) }
 
 var fileDescriptor_9ecbec0a4cfddea6 = []byte{
-	// 677 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x54, 0xcf, 0x4f, 0x13, 0x41,
-	0x14, 0xde, 0x29, 0x6c, 0x69, 0xa7, 0x88, 0xc9, 0x50, 0xcd, 0xda, 0x98, 0x29, 0xa9, 0x17, 0x62,
-	0xc2, 0x92, 0x20, 0x89, 0xf1, 0x80, 0x66, 0x09, 0xe8, 0xc5, 0x83, 0x59, 0xd4, 0x2b, 0x99, 0xb6,
-	0xc3, 0xb2, 0xba, 0xec, 0xac, 0x33, 0xb3, 0x0d, 0x47, 0xfe, 0x04, 0x8e, 0x9e, 0x3d, 0xf9, 0xa7,
-	0x70, 0xe4, 0x48, 0x8c, 0x41, 0x59, 0x2e, 0x1e, 0xf9, 0x13, 0xcc, 0xfc, 0x58, 0xdb, 0x2a, 0x26,
-	0x6e, 0x0c, 0x97, 0x76, 0xdf, 0xbc, 0xf7, 0x7d, 0xdf, 0xbc, 0xef, 0xcd, 0x0c, 0x6c, 0xf1, 0x3c,
-	0xa1, 0xdc, 0xcf, 0x38, 0x93, 0x0c, 0xb9, 0x3a, 0xe8, 0xac, 0x44, 0xb1, 0xdc, 0xcf, 0xfb, 0xfe,
-	0x80, 0x1d, 0xac, 0x46, 0x2c, 0x62, 0xab, 0x3a, 0xdb, 0xcf, 0xf7, 0x74, 0xa4, 0x03, 0xfd, 0x65,
-	0x50, 0x1d, 0x1c, 0x31, 0x16, 0x25, 0x74, 0x5c, 0x35, 0xcc, 0x39, 0x91, 0x31, 0x4b, 0x6d, 0xbe,
-	0xfb, 0x7b, 0x5e, 0xc6, 0x07, 0x54, 0x48, 0x72, 0x90, 0xd9, 0x82, 0x27, 0x13, 0x7a, 0x03, 0xc6,
-	0x25, 0x3d, 0xcc, 0x38, 0x7b, 0x47, 0x07, 0xd2, 0x46, 0xab, 0xd9, 0xfb, 0xa8, 0x4c, 0xf4, 0xed,
-	0x87, 0x85, 0x6e, 0xfc, 0x0b, 0x54, 0x77, 0xa5, 0x7f, 0x45, 0xd6, 0x37, 0xff, 0x06, 0xde, 0x5b,
-	0x80, 0xf3, 0xa1, 0x0a, 0x43, 0xfa, 0x21, 0xa7, 0x42, 0xf6, 0x9e, 0xc2, 0x5b, 0x36, 0x16, 0x19,
-	0x4b, 0x05, 0x45, 0x2b, 0xb0, 0x1e, 0x71, 0x96, 0x67, 0xc2, 0x03, 0x4b, 0x33, 0xcb, 0xad, 0xb5,
-	0x3b, 0xbe, 0xf1, 0xeb, 0x85, 0x5a, 0xdc, 0x91, 0x44, 0xd2, 0x2d, 0x2a, 0x06, 0xa1, 0x2d, 0xea,
-	0x7d, 0xaa, 0xc1, 0x85, 0xe9, 0x14, 0x7a, 0x08, 0x5d, 0x9d, 0xf4, 0xc0, 0x12, 0x58, 0x6e, 0xad,
-	0xb5, 0x7d, 0xa3, 0xaf, 0x64, 0x74, 0xa5, 0xc6, 0x9b, 0x12, 0xf4, 0x18, 0xce, 0x93, 0x81, 0x8c,
-	0x47, 0x74, 0x57, 0x17, 0x79, 0x35, 0xad, 0xd9, 0xb6, 0x9a, 0x0a, 0x32, 0x96, 0x6c, 0x99, 0x4a,
-	0xbd, 0x5d, 0xf4, 0x16, 0x2e, 0xd2, 0x11, 0x49, 0x72, 0x6d, 0xfb, 0xeb, 0xd2, 0x5e, 0x6f, 0x46,
-	0x4b, 0x76, 0x7c, 0x33, 0x00, 0xbf, 0x1c, 0x80, 0xff, 0xab, 0x62, 0xb3, 0x71, 0x72, 0xde, 0x75,
-	0x8e, 0xbf, 0x75, 0x41, 0x78, 0x1d, 0x01, 0xda, 0x81, 0x68, 0xbc, 0xbc, 0x65, 0xc7, 0xea, 0xcd,
-	0x6a, 0xda, 0x7b, 0x7f, 0xd0, 0x96, 0x05, 0x86, 0xf5, 0xa3, 0x62, 0xbd, 0x06, 0xde, 0xfb, 0x5a,
-	0x33, 0x2e, 0x8f, 0x3d, 0x7a, 0x00, 0x67, 0x55, 0x8b, 0xd6, 0xa2, 0xdb, 0x13, 0x16, 0xe9, 0x56,
-	0x75, 0x12, 0xb5, 0xa1, 0x2b, 0x14, 0xc2, 0xab, 0x2d, 0x81, 0xe5, 0x66, 0x68, 0x02, 0x74, 0x17,
-	0xd6, 0xf7, 0x29, 0x49, 0xe4, 0xbe, 0x6e, 0xb6, 0x19, 0xda, 0x08, 0xdd, 0x87, 0xcd, 0x84, 0x08,
-	0xb9, 0xcd, 0x39, 0xe3, 0x7a, 0xc3, 0xcd, 0x70, 0xbc, 0xa0, 0xc6, 0x4a, 0x12, 0xca, 0xa5, 0xf0,
-	0xdc, 0xa9, 0xb1, 0x06, 0x6a, 0x71, 0x62, 0xac, 0xa6, 0xe8, 0x6f, 0xf6, 0xd6, 0x6f, 0xc6, 0xde,
-	0xb9, 0xff, 0xb3, 0xf7, 0xc8, 0x85, 0x0b, 0xd3, 0x7d, 0x8c, 0xad, 0x03, 0x93, 0xd6, 0xa5, 0xb0,
-	0x9e, 0x90, 0x3e, 0x4d, 0xca, 0x73, 0xb6, 0xe8, 0x97, 0x77, 0xcc, 0x7f, 0xa9, 0xd6, 0x5f, 0x91,
-	0x98, 0x6f, 0x06, 0x4a, 0xeb, 0xcb, 0x79, 0xb7, 0xd2, 0x1d, 0x35, 0xf8, 0x60, 0x48, 0x32, 0x49,
-	0x79, 0x68, 0x55, 0xd0, 0x21, 0x6c, 0x91, 0x34, 0x65, 0x52, 0x6f, 0x53, 0x78, 0x33, 0x37, 0x2a,
-	0x3a, 0x29, 0xa5, 0xfa, 0x57, 0x3e, 0x51, 0x7d, 0x10, 0x40, 0x68, 0x02, 0x14, 0xc0, 0xa6, 0xbd,
-	0x6d, 0x44, 0x7a, 0x6e, 0x85, 0x59, 0x36, 0x0c, 0x2c, 0x90, 0xe8, 0x19, 0x6c, 0xec, 0xc5, 0x9c,
-	0x0e, 0x15, 0x43, 0x95, 0xd3, 0x30, 0xa7, 0x51, 0x81, 0x44, 0xdb, 0xb0, 0xc5, 0xa9, 0x60, 0xc9,
-	0xc8, 0x70, 0xcc, 0x55, 0xe0, 0x80, 0x25, 0x30, 0x90, 0xe8, 0x39, 0x9c, 0x57, 0x87, 0x7b, 0x57,
-	0xd0, 0x54, 0x2a, 0x9e, 0x46, 0x15, 0x1e, 0x85, 0xdc, 0xa1, 0xa9, 0x34, 0xdb, 0x19, 0x91, 0x24,
-	0x1e, 0xee, 0xe6, 0xa9, 0x8c, 0x13, 0xaf, 0x59, 0x85, 0x46, 0x03, 0xdf, 0x28, 0xdc, 0xda, 0x06,
-	0x74, 0xd5, 0xe5, 0xe5, 0x68, 0xdd, 0x7c, 0x08, 0xb4, 0x38, 0xf1, 0x86, 0x95, 0xaf, 0x6d, 0xa7,
-	0x3d, 0xbd, 0x68, 0x9e, 0xdc, 0x9e, 0xb3, 0xb9, 0x7e, 0x7a, 0x81, 0x9d, 0xb3, 0x0b, 0xec, 0x5c,
-	0x5d, 0x60, 0x70, 0x54, 0x60, 0xf0, 0xb9, 0xc0, 0xe0, 0xa4, 0xc0, 0xe0, 0xb4, 0xc0, 0xe0, 0x7b,
-	0x81, 0xc1, 0x8f, 0x02, 0x3b, 0x57, 0x05, 0x06, 0xc7, 0x97, 0xd8, 0x39, 0xbd, 0xc4, 0xce, 0xd9,
-	0x25, 0x76, 0xfa, 0x75, 0xbd, 0xbd, 0x47, 0x3f, 0x03, 0x00, 0x00, 0xff, 0xff, 0x29, 0x57, 0x9d,
-	0xdd, 0xd2, 0x06, 0x00, 0x00,
+	// 739 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x55, 0x3f, 0x4f, 0x1b, 0x3d,
+	0x18, 0x3f, 0x13, 0x12, 0x12, 0x07, 0x78, 0x5f, 0x99, 0xbc, 0xaf, 0xae, 0x51, 0xe5, 0x44, 0xe9,
+	0x12, 0x21, 0x71, 0x48, 0x14, 0xa9, 0xea, 0x40, 0xab, 0x20, 0xa0, 0x4b, 0x87, 0xea, 0x68, 0xab,
+	0x6e, 0xc8, 0x49, 0x4c, 0xb8, 0xf6, 0x38, 0x5f, 0x6d, 0x5f, 0xc4, 0xc8, 0x47, 0x60, 0xec, 0xdc,
+	0xa9, 0x1f, 0x85, 0x91, 0x11, 0x75, 0xa0, 0xe5, 0x58, 0x3a, 0x74, 0xe0, 0x23, 0x54, 0xb6, 0xef,
+	0xb8, 0x0b, 0xa4, 0x52, 0x4f, 0x15, 0x4b, 0xe2, 0xe7, 0xcf, 0xef, 0xf7, 0xf8, 0xf9, 0x3d, 0xb6,
+	0x0f, 0xd6, 0x79, 0xe4, 0x53, 0xee, 0x84, 0x9c, 0x49, 0x86, 0xca, 0xda, 0x68, 0xae, 0x8c, 0x3c,
+	0x79, 0x10, 0xf5, 0x9d, 0x01, 0x3b, 0x5c, 0x1d, 0xb1, 0x11, 0x5b, 0xd5, 0xd1, 0x7e, 0xb4, 0xaf,
+	0x2d, 0x6d, 0xe8, 0x95, 0x41, 0x35, 0xf1, 0x88, 0xb1, 0x91, 0x4f, 0xb3, 0xac, 0x61, 0xc4, 0x89,
+	0xf4, 0x58, 0x90, 0xc4, 0x5b, 0xb7, 0xe3, 0xd2, 0x3b, 0xa4, 0x42, 0x92, 0xc3, 0x30, 0x49, 0x78,
+	0x9a, 0xab, 0x37, 0x60, 0x5c, 0xd2, 0xa3, 0x90, 0xb3, 0xf7, 0x74, 0x20, 0x13, 0x6b, 0x35, 0xfc,
+	0x30, 0x4a, 0x03, 0xfd, 0x64, 0x91, 0x40, 0x37, 0xfe, 0x04, 0xaa, 0xbb, 0xd2, 0xbf, 0x22, 0xec,
+	0x9b, 0x7f, 0x03, 0xef, 0x2c, 0xc2, 0x79, 0x57, 0x99, 0x2e, 0xfd, 0x18, 0x51, 0x21, 0x3b, 0xcf,
+	0xe0, 0x42, 0x62, 0x8b, 0x90, 0x05, 0x82, 0xa2, 0x15, 0x58, 0x19, 0x71, 0x16, 0x85, 0xc2, 0x06,
+	0xed, 0x52, 0xb7, 0xbe, 0xf6, 0x9f, 0x63, 0xf4, 0x7a, 0xa1, 0x9c, 0xbb, 0x92, 0x48, 0xba, 0x45,
+	0xc5, 0xc0, 0x4d, 0x92, 0x3a, 0x9f, 0x67, 0xe0, 0xe2, 0x64, 0x08, 0x2d, 0xc3, 0xb2, 0x0e, 0xda,
+	0xa0, 0x0d, 0xba, 0xf5, 0xb5, 0x86, 0x63, 0xea, 0xab, 0x32, 0x3a, 0x53, 0xe3, 0x4d, 0x0a, 0x7a,
+	0x02, 0xe7, 0xc9, 0x40, 0x7a, 0x63, 0xba, 0xa7, 0x93, 0xec, 0x99, 0x76, 0xe9, 0x06, 0xc2, 0x35,
+	0x24, 0x2b, 0x59, 0x37, 0x99, 0x7a, 0xbb, 0xe8, 0x2d, 0x5c, 0xa2, 0x63, 0xe2, 0x47, 0x5a, 0xf6,
+	0xd7, 0xa9, 0xbc, 0x76, 0x49, 0x97, 0x6c, 0x3a, 0x66, 0x00, 0x4e, 0x3a, 0x00, 0xe7, 0x26, 0x63,
+	0xb3, 0x7a, 0x7a, 0xd1, 0xb2, 0x4e, 0xbe, 0xb5, 0x80, 0x3b, 0x8d, 0x00, 0xed, 0x42, 0x94, 0xb9,
+	0xb7, 0x92, 0xb1, 0xda, 0xb3, 0x9a, 0xf6, 0xc1, 0x1d, 0xda, 0x34, 0xc1, 0xb0, 0x7e, 0x52, 0xac,
+	0x53, 0xe0, 0x9d, 0x9f, 0xb3, 0x70, 0x61, 0xa2, 0x17, 0xf4, 0x08, 0xce, 0xaa, 0x16, 0x13, 0x89,
+	0xfe, 0xc9, 0x49, 0xa4, 0x5b, 0xd5, 0x41, 0xd4, 0x80, 0x65, 0xa1, 0x10, 0xf6, 0x4c, 0x1b, 0x74,
+	0x6b, 0xae, 0x31, 0xd0, 0xff, 0xb0, 0x72, 0x40, 0x89, 0x2f, 0x0f, 0x74, 0xb3, 0x35, 0x37, 0xb1,
+	0xd0, 0x43, 0x58, 0xf3, 0x89, 0x90, 0xdb, 0x9c, 0x33, 0xae, 0x37, 0x5c, 0x73, 0x33, 0x87, 0x1a,
+	0x2b, 0xf1, 0x29, 0x97, 0xc2, 0x2e, 0x4f, 0x8c, 0xb5, 0xa7, 0x9c, 0xb9, 0xb1, 0x9a, 0xa4, 0xdf,
+	0xc9, 0x5b, 0xb9, 0x1f, 0x79, 0xe7, 0xfe, 0x4a, 0x5e, 0xe4, 0xe4, 0x49, 0x77, 0x88, 0xe7, 0x47,
+	0x9c, 0x0a, 0xbb, 0xda, 0x06, 0xdd, 0x92, 0x3b, 0x25, 0x82, 0x96, 0xe1, 0xbf, 0x4a, 0x98, 0xc4,
+	0x36, 0x82, 0xd5, 0xb4, 0x60, 0x77, 0xfc, 0xe8, 0x1d, 0x6c, 0xe4, 0x7c, 0x99, 0x12, 0xb0, 0x80,
+	0x12, 0x53, 0x19, 0x52, 0xe6, 0xdd, 0x68, 0x30, 0xa0, 0x42, 0x64, 0xcc, 0xf5, 0xa2, 0xcc, 0xb7,
+	0x19, 0x3a, 0xc7, 0x65, 0xb8, 0x38, 0x39, 0xd7, 0xec, 0x28, 0x81, 0xfc, 0x51, 0x0a, 0x60, 0xc5,
+	0x27, 0x7d, 0xea, 0xa7, 0xf7, 0x6e, 0xc9, 0x49, 0xdf, 0x1c, 0xe7, 0xa5, 0xf2, 0xbf, 0x22, 0x1e,
+	0xdf, 0xec, 0xa9, 0x6a, 0x5f, 0x2f, 0x5a, 0x85, 0xde, 0x2c, 0x83, 0xef, 0x0d, 0x49, 0x28, 0x29,
+	0x77, 0x93, 0x2a, 0xe8, 0x08, 0xd6, 0x49, 0x10, 0x30, 0xa9, 0xc7, 0x21, 0xec, 0xd2, 0xbd, 0x16,
+	0xcd, 0x97, 0x52, 0xfd, 0xab, 0x73, 0x40, 0xf5, 0xc5, 0x00, 0xae, 0x31, 0x50, 0x0f, 0xd6, 0x92,
+	0xd7, 0x87, 0x48, 0xbb, 0x5c, 0x40, 0xf7, 0xaa, 0x81, 0xf5, 0x24, 0x7a, 0x0e, 0xab, 0xfb, 0x1e,
+	0xa7, 0x43, 0xc5, 0x50, 0xe4, 0x76, 0xcc, 0x69, 0x54, 0x4f, 0xa2, 0x6d, 0x58, 0xe7, 0x54, 0x30,
+	0x7f, 0x6c, 0x38, 0xe6, 0x0a, 0x70, 0xc0, 0x14, 0xd8, 0x93, 0x68, 0x07, 0xce, 0xab, 0xb3, 0xb0,
+	0x27, 0x68, 0x20, 0x15, 0x4f, 0xb5, 0x08, 0x8f, 0x3e, 0x45, 0x34, 0x90, 0x66, 0x3b, 0x63, 0xe2,
+	0x7b, 0xc3, 0xbd, 0x28, 0x90, 0x9e, 0x6f, 0xd7, 0x8a, 0xd0, 0x68, 0xe0, 0x1b, 0x85, 0x5b, 0xdb,
+	0x80, 0x65, 0xf5, 0x98, 0x71, 0xb4, 0x6e, 0x16, 0x02, 0x2d, 0xe5, 0xde, 0xf4, 0xf4, 0xeb, 0xd3,
+	0x6c, 0x4c, 0x3a, 0xcd, 0x27, 0xa8, 0x63, 0x6d, 0xae, 0x9f, 0x5d, 0x62, 0xeb, 0xfc, 0x12, 0x5b,
+	0xd7, 0x97, 0x18, 0x1c, 0xc7, 0x18, 0x7c, 0x89, 0x31, 0x38, 0x8d, 0x31, 0x38, 0x8b, 0x31, 0xf8,
+	0x1e, 0x63, 0xf0, 0x23, 0xc6, 0xd6, 0x75, 0x8c, 0xc1, 0xc9, 0x15, 0xb6, 0xce, 0xae, 0xb0, 0x75,
+	0x7e, 0x85, 0xad, 0x7e, 0x45, 0x6f, 0xef, 0xf1, 0xaf, 0x01, 0x00, 0x29, 0x5c, 0x85, 0x68, 0xe2,
+	0x07, 0x00, 0x00,
 }
 
 func (this *RulesRequest) Equal(that interface{}) bool {
@@ -559,6 +595,18 @@ func (this *RuleStateDesc) Equal(that interface{}) bool {
 	if this.EvaluationDuration != that1.EvaluationDuration {
 		return false
 	}
+	if this.EvaluationFailures != that1.EvaluationFailures {
+		return false
+	}
+	if this.LastFailureError != that1.LastFailureError {
+		return false
+	}
+	if !this.LastFailureTimestamp.Equal(that1.LastFailureTimestamp) {
+		return false
+	}
+	if !this.LastSuccessTimestamp.Equal(that1.LastSuccessTimestamp) {
+		return false
+	}
 	return true
 }
 func (this *AlertStateDesc) Equal(that interface{}) bool {
@@ -661,7 +709,7 @@ func (this *RuleStateDesc) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 11)
+	s := make([]string, 0, 15)
 	s = append(s, "&ruler.RuleStateDesc{")
 	if this.Rule != nil {
 		s = append(s, "Rule: "+fmt.Sprintf("%#v", this.Rule)+",\n")
@@ -674,6 +722,10 @@ func (this *RuleStateDesc) GoString() string {
 	}
 	s = append(s, "EvaluationTimestamp: "+fmt.Sprintf("%#v", this.EvaluationTimestamp)+",\n")
 	s = append(s, "EvaluationDuration: "+fmt.Sprintf("%#v", this.EvaluationDuration)+",\n")
+	s = append(s, "EvaluationFailures: "+fmt.Sprintf("%#v", this.EvaluationFailures)+",\n")
+	s = append(s, "LastFailureError: "+fmt.Sprintf("%#v", this.LastFailureError)+",\n")
+	s = append(s, "LastFailureTimestamp: "+fmt.Sprintf("%#v", this.LastFailureTimestamp)+",\n")
+	s = append(s, "LastSuccessTimestamp: "+fmt.Sprintf("%#v", this.LastSuccessTimestamp)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -929,21 +981,49 @@ func (m *RuleStateDesc) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	n4, err4 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.EvaluationDuration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.EvaluationDuration):])
+	n4, err4 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.LastSuccessTimestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.LastSuccessTimestamp):])
 	if err4 != nil {
 		return 0, err4
 	}
 	i -= n4
 	i = encodeVarintRuler(dAtA, i, uint64(n4))
 	i--
-	dAtA[i] = 0x3a
-	n5, err5 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.EvaluationTimestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.EvaluationTimestamp):])
+	dAtA[i] = 0x5a
+	n5, err5 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.LastFailureTimestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.LastFailureTimestamp):])
 	if err5 != nil {
 		return 0, err5
 	}
 	i -= n5
 	i = encodeVarintRuler(dAtA, i, uint64(n5))
 	i--
+	dAtA[i] = 0x52
+	if len(m.LastFailureError) > 0 {
+		i -= len(m.LastFailureError)
+		copy(dAtA[i:], m.LastFailureError)
+		i = encodeVarintRuler(dAtA, i, uint64(len(m.LastFailureError)))
+		i--
+		dAtA[i] = 0x4a
+	}
+	if m.EvaluationFailures != 0 {
+		i = encodeVarintRuler(dAtA, i, uint64(m.EvaluationFailures))
+		i--
+		dAtA[i] = 0x40
+	}
+	n6, err6 := github_com_gogo_protobuf_types.StdDurationMarshalTo(m.EvaluationDuration, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdDuration(m.EvaluationDuration):])
+	if err6 != nil {
+		return 0, err6
+	}
+	i -= n6
+	i = encodeVarintRuler(dAtA, i, uint64(n6))
+	i--
+	dAtA[i] = 0x3a
+	n7, err7 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.EvaluationTimestamp, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.EvaluationTimestamp):])
+	if err7 != nil {
+		return 0, err7
+	}
+	i -= n7
+	i = encodeVarintRuler(dAtA, i, uint64(n7))
+	i--
 	dAtA[i] = 0x32
 	if len(m.Alerts) > 0 {
 		for iNdEx := len(m.Alerts) - 1; iNdEx >= 0; iNdEx-- {
@@ -1015,45 +1095,45 @@ func (m *AlertStateDesc) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
-	n7, err7 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ValidUntil, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ValidUntil):])
-	if err7 != nil {
-		return 0, err7
-	}
-	i -= n7
-	i = encodeVarintRuler(dAtA, i, uint64(n7))
-	i--
-	dAtA[i] = 0x4a
-	n8, err8 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.LastSentAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.LastSentAt):])
-	if err8 != nil {
-		return 0, err8
-	}
-	i -= n8
-	i = encodeVarintRuler(dAtA, i, uint64(n8))
-	i--
-	dAtA[i] = 0x42
-	n9, err9 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ResolvedAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ResolvedAt):])
+	n9, err9 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ValidUntil, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ValidUntil):])
 	if err9 != nil {
 		return 0, err9
 	}
 	i -= n9
 	i = encodeVarintRuler(dAtA, i, uint64(n9))
 	i--
-	dAtA[i] = 0x3a
-	n10, err10 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.FiredAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.FiredAt):])
+	dAtA[i] = 0x4a
+	n10, err10 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.LastSentAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.LastSentAt):])
 	if err10 != nil {
 		return 0, err10
 	}
 	i -= n10
 	i = encodeVarintRuler(dAtA, i, uint64(n10))
 	i--
-	dAtA[i] = 0x32
-	n11, err11 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ActiveAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ActiveAt):])
+	dAtA[i] = 0x42
+	n11, err11 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ResolvedAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ResolvedAt):])
 	if err11 != nil {
 		return 0, err11
 	}
 	i -= n11
 	i = encodeVarintRuler(dAtA, i, uint64(n11))
 	i--
+	dAtA[i] = 0x3a
+	n12, err12 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.FiredAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.FiredAt):])
+	if err12 != nil {
+		return 0, err12
+	}
+	i -= n12
+	i = encodeVarintRuler(dAtA, i, uint64(n12))
+	i--
+	dAtA[i] = 0x32
+	n13, err13 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.ActiveAt, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.ActiveAt):])
+	if err13 != nil {
+		return 0, err13
+	}
+	i -= n13
+	i = encodeVarintRuler(dAtA, i, uint64(n13))
+	i--
 	dAtA[i] = 0x2a
 	if m.Value != 0 {
 		i -= 8
@@ -1189,6 +1269,17 @@ func (m *RuleStateDesc) Size() (n int) {
 	n += 1 + l + sovRuler(uint64(l))
 	l = github_com_gogo_protobuf_types.SizeOfStdDuration(m.EvaluationDuration)
 	n += 1 + l + sovRuler(uint64(l))
+	if m.EvaluationFailures != 0 {
+		n += 1 + sovRuler(uint64(m.EvaluationFailures))
+	}
+	l = len(m.LastFailureError)
+	if l > 0 {
+		n += 1 + l + sovRuler(uint64(l))
+	}
+	l = github_com_gogo_protobuf_types.SizeOfStdTime(m.LastFailureTimestamp)
+	n += 1 + l + sovRuler(uint64(l))
+	l = github_com_gogo_protobuf_types.SizeOfStdTime(m.LastSuccessTimestamp)
+	n += 1 + l + sovRuler(uint64(l))
 	return n
 }
 
@@ -1295,6 +1386,10 @@ func (this *RuleStateDesc) String() string {
 		`Alerts:` + repeatedStringForAlerts + `,`,
 		`EvaluationTimestamp:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.EvaluationTimestamp), "Timestamp", "timestamp.Timestamp", 1), `&`, ``, 1) + `,`,
 		`EvaluationDuration:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.EvaluationDuration), "Duration", "duration.Duration", 1), `&`, ``, 1) + `,`,
+		`EvaluationFailures:` + fmt.Sprintf("%v", this.EvaluationFailures) + `,`,
+		`LastFailureError:` + fmt.Sprintf("%v", this.LastFailureError) + `,`,
+		`LastFailureTimestamp:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.LastFailureTimestamp), "Timestamp", "timestamp.Timestamp", 1), `&`, ``, 1) + `,`,
+		`LastSuccessTimestamp:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.LastSuccessTimestamp), "Timestamp", "timestamp.Timestamp", 1), `&`, ``, 1) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1915,6 +2010,123 @@ func (m *RuleStateDesc) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EvaluationFailures", wireType)
+			}
+			m.EvaluationFailures = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.EvaluationFailures |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastFailureError", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRuler
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LastFailureError = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 10:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastFailureTimestamp", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRuler
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdTimeUnmarshal(&m.LastFailureTimestamp, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 11:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastSuccessTimestamp", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRuler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRuler
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRuler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdTimeUnmarshal(&m.LastSuccessTimestamp, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRuler(dAtA[iNdEx:])
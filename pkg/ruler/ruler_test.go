@@ -30,11 +30,14 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/user"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"gopkg.in/yaml.v2"
 
 	"github.com/cortexproject/cortex/pkg/chunk"
 	"github.com/cortexproject/cortex/pkg/cortexpb"
 	"github.com/cortexproject/cortex/pkg/ring"
+	ring_client "github.com/cortexproject/cortex/pkg/ring/client"
 	"github.com/cortexproject/cortex/pkg/ring/kv"
 	"github.com/cortexproject/cortex/pkg/ring/kv/consul"
 	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
@@ -75,6 +78,15 @@ type ruleLimits struct {
 	tenantShard          int
 	maxRulesPerRuleGroup int
 	maxRuleGroups        int
+
+	notificationQueueCapacity int
+	allowedSourceTenants      []string
+
+	maxRulesPerTenant int
+
+	protectExistingMetrics bool
+
+	deliveryTraceSampleRatio float64
 }
 
 func (r ruleLimits) EvaluationDelay(_ string) time.Duration {
@@ -93,6 +105,34 @@ func (r ruleLimits) RulerMaxRulesPerRuleGroup(_ string) int {
 	return r.maxRulesPerRuleGroup
 }
 
+func (r ruleLimits) RulerNotificationQueueCapacity(_ string) int {
+	return r.notificationQueueCapacity
+}
+
+func (r ruleLimits) RulerAllowedSourceTenants(_ string) []string {
+	return r.allowedSourceTenants
+}
+
+func (r ruleLimits) RulerMaxRulesPerTenant(_ string) int {
+	return r.maxRulesPerTenant
+}
+
+func (r ruleLimits) RulerExternalLabels(_ string) labels.Labels {
+	return nil
+}
+
+func (r ruleLimits) RulerExternalURL(_ string) string {
+	return ""
+}
+
+func (r ruleLimits) RulerProtectExistingMetrics(_ string) bool {
+	return r.protectExistingMetrics
+}
+
+func (r ruleLimits) RulerDeliveryTraceSampleRatio(_ string) float64 {
+	return r.deliveryTraceSampleRatio
+}
+
 func testSetup(t *testing.T, cfg Config) (*promql.Engine, storage.QueryableFunc, Pusher, log.Logger, RulesLimits, func()) {
 	dir, err := ioutil.TempDir("", filepath.Base(t.Name()))
 	assert.NoError(t, err)
@@ -124,7 +164,7 @@ func testSetup(t *testing.T, cfg Config) (*promql.Engine, storage.QueryableFunc,
 
 func newManager(t *testing.T, cfg Config) (*DefaultMultiTenantManager, func()) {
 	engine, noopQueryable, pusher, logger, overrides, cleanup := testSetup(t, cfg)
-	manager, err := NewDefaultMultiTenantManager(cfg, DefaultTenantManagerFactory(cfg, pusher, noopQueryable, engine, overrides, nil), prometheus.NewRegistry(), logger)
+	manager, err := NewDefaultMultiTenantManager(cfg, DefaultTenantManagerFactory(cfg, pusher, noopQueryable, engine, overrides, nil), overrides, prometheus.NewRegistry(), logger)
 	require.NoError(t, err)
 
 	return manager, cleanup
@@ -137,7 +177,7 @@ func newRuler(t *testing.T, cfg Config) (*Ruler, func()) {
 
 	reg := prometheus.NewRegistry()
 	managerFactory := DefaultTenantManagerFactory(cfg, pusher, noopQueryable, engine, overrides, reg)
-	manager, err := NewDefaultMultiTenantManager(cfg, managerFactory, reg, log.NewNopLogger())
+	manager, err := NewDefaultMultiTenantManager(cfg, managerFactory, overrides, reg, log.NewNopLogger())
 	require.NoError(t, err)
 
 	ruler, err := NewRuler(
@@ -147,6 +187,7 @@ func newRuler(t *testing.T, cfg Config) (*Ruler, func()) {
 		logger,
 		storage,
 		overrides,
+		nil,
 	)
 	require.NoError(t, err)
 
@@ -189,11 +230,11 @@ func TestNotifierSendsUserIDHeader(t *testing.T) {
 	defer rcleanup()
 	defer manager.Stop()
 
-	n, err := manager.getOrCreateNotifier("1")
+	n, err := manager.getOrCreateNotifier("1", nil)
 	require.NoError(t, err)
 
 	// Loop until notifier discovery syncs up
-	for len(n.Alertmanagers()) == 0 {
+	for len(n.notifier.Alertmanagers()) == 0 {
 		time.Sleep(10 * time.Millisecond)
 	}
 	n.Send(&notifier.Alert{
@@ -732,6 +773,205 @@ func TestSharding(t *testing.T) {
 	}
 }
 
+func TestRuler_GetRules_ShouldMergeTheRulesOfTheOwningRulers(t *testing.T) {
+	const (
+		user1      = "user1"
+		ruler1Addr = "1.1.1.1:9999"
+		ruler2Addr = "2.2.2.2:9999"
+		ruler3Addr = "3.3.3.3:9999"
+	)
+
+	var groups rulespb.RuleGroupList
+	for i := 1; i <= 6; i++ {
+		g := testRuleGroup(user1, "namespace", fmt.Sprintf("group-%d", i), 1)
+		g.Interval = 100 * time.Millisecond
+		groups = append(groups, g)
+	}
+	allRules := map[string]rulespb.RuleGroupList{user1: groups}
+
+	// Each ruler owns two rule groups of the user, when the shuffle sharding is disabled.
+	rulerTokens := map[string][]uint32{
+		ruler1Addr: sortTokens([]uint32{tokenForGroup(groups[0]) + 1, tokenForGroup(groups[1]) + 1}),
+		ruler2Addr: sortTokens([]uint32{tokenForGroup(groups[2]) + 1, tokenForGroup(groups[3]) + 1}),
+		ruler3Addr: sortTokens([]uint32{tokenForGroup(groups[4]) + 1, tokenForGroup(groups[5]) + 1}),
+	}
+
+	tests := map[string]struct {
+		shuffleShardSize int
+		// unreachable returns the address of the unreachable ruler, if any.
+		unreachable      func(rulersRing *ring.Ring) string
+		expectedMissing  []string
+		expectedWarnings int
+	}{
+		"all the rulers are reachable": {
+			unreachable: func(*ring.Ring) string { return "" },
+		},
+		"the unreachable ruler is outside of the shard of the user": {
+			shuffleShardSize: 2,
+			unreachable: func(rulersRing *ring.Ring) string {
+				subRing := rulersRing.ShuffleShard(user1, 2)
+				for _, addr := range []string{ruler1Addr, ruler2Addr, ruler3Addr} {
+					if !subRing.HasInstance(addr) {
+						return addr
+					}
+				}
+				return ""
+			},
+		},
+		"the rule groups of an unreachable ruler are missing": {
+			unreachable:      func(*ring.Ring) string { return ruler3Addr },
+			expectedMissing:  []string{"group-5", "group-6"},
+			expectedWarnings: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			kvStore := consul.NewInMemoryClient(ring.GetCodec())
+
+			strategy := util.ShardingStrategyDefault
+			if tc.shuffleShardSize > 0 {
+				strategy = util.ShardingStrategyShuffle
+			}
+
+			// The instance ID of each ruler is its address, to find the rulers by address.
+			setupRuler := func(addr string, forceRing *ring.Ring) *Ruler {
+				cfg, cleanup := defaultRulerConfig(newMockRuleStore(allRules))
+				t.Cleanup(cleanup)
+				cfg.RulePath = t.TempDir()
+				cfg.EnableSharding = true
+				cfg.ShardingStrategy = strategy
+				cfg.Ring.InstanceID = addr
+				cfg.Ring.InstanceAddr = strings.Split(addr, ":")[0]
+				cfg.Ring.InstancePort = 9999
+				cfg.Ring.KVStore = kv.Config{Mock: kvStore}
+				cfg.Ring.HeartbeatTimeout = time.Minute
+
+				r, cleanup := newRuler(t, cfg)
+				r.limits = ruleLimits{evalDelay: 0, tenantShard: tc.shuffleShardSize}
+				t.Cleanup(cleanup)
+				t.Cleanup(r.manager.Stop)
+
+				if forceRing != nil {
+					r.ring = forceRing
+				}
+				return r
+			}
+
+			r1 := setupRuler(ruler1Addr, nil)
+			rulersRing := r1.ring
+			require.NoError(t, services.StartAndAwaitRunning(context.Background(), rulersRing))
+			t.Cleanup(rulersRing.StopAsync)
+
+			rulers := map[string]*Ruler{
+				ruler1Addr: r1,
+				ruler2Addr: setupRuler(ruler2Addr, rulersRing),
+				ruler3Addr: setupRuler(ruler3Addr, rulersRing),
+			}
+
+			require.NoError(t, kvStore.CAS(context.Background(), ring.RulerRingKey, func(in interface{}) (out interface{}, retry bool, err error) {
+				d, _ := in.(*ring.Desc)
+				if d == nil {
+					d = ring.NewDesc()
+				}
+				for addr, tokens := range rulerTokens {
+					d.AddIngester(addr, addr, "", tokens, ring.ACTIVE, time.Now())
+				}
+				return d, true, nil
+			}))
+			// Wait a bit to make sure ruler's ring is updated.
+			time.Sleep(100 * time.Millisecond)
+
+			for _, r := range rulers {
+				r.syncRules(context.Background(), rulerSyncReasonInitial)
+			}
+
+			// All the rulers are queried through the in-memory clients, but the unreachable one.
+			reachable := map[string]*Ruler{}
+			for addr, r := range rulers {
+				if addr != tc.unreachable(rulersRing) {
+					reachable[addr] = r
+				}
+			}
+			for _, r := range rulers {
+				r.clientsPool = newMockRulerClientsPool(reachable)
+			}
+
+			expected := map[string]bool{}
+			for _, g := range groups {
+				if !util.StringsContain(tc.expectedMissing, g.Name) {
+					expected[g.Name] = true
+				}
+			}
+
+			// Any ruler returns the same rule groups, once evaluated.
+			for addr, r := range reachable {
+				ctx := user.InjectOrgID(context.Background(), user1)
+
+				require.Eventually(t, func() bool {
+					rgs, warnings, err := r.GetRules(ctx)
+					require.NoError(t, err)
+					require.Len(t, warnings, tc.expectedWarnings)
+
+					actual := map[string]bool{}
+					for _, rg := range rgs {
+						for _, rule := range rg.ActiveRules {
+							if rule.EvaluationTimestamp.IsZero() || rule.Health != string(promRules.HealthGood) {
+								return false
+							}
+						}
+						actual[rg.Group.Name] = !rg.EvaluationTimestamp.IsZero()
+					}
+					return assert.ObjectsAreEqual(expected, actual)
+				}, 5*time.Second, 50*time.Millisecond, "ruler %s", addr)
+			}
+		})
+	}
+}
+
+func TestMergeGroupStateDescs(t *testing.T) {
+	now := time.Now()
+	older := &GroupStateDesc{Group: &rulespb.RuleGroupDesc{Namespace: "namespace", Name: "group-1"}, EvaluationTimestamp: now.Add(-time.Minute)}
+	newer := &GroupStateDesc{Group: &rulespb.RuleGroupDesc{Namespace: "namespace", Name: "group-1"}, EvaluationTimestamp: now}
+	other := &GroupStateDesc{Group: &rulespb.RuleGroupDesc{Namespace: "namespace", Name: "group-2"}, EvaluationTimestamp: now.Add(-time.Minute)}
+
+	assert.Equal(t, []*GroupStateDesc{newer, other}, mergeGroupStateDescs([]*GroupStateDesc{older, other, newer}))
+	assert.Equal(t, []*GroupStateDesc{newer, other}, mergeGroupStateDescs([]*GroupStateDesc{newer, other, older}))
+}
+
+// newMockRulerClientsPool returns a pool of clients calling the in-memory rulers, by address. The
+// rulers missing from the map are unreachable.
+func newMockRulerClientsPool(rulers map[string]*Ruler) *ring_client.Pool {
+	factory := func(addr string) (ring_client.PoolClient, error) {
+		r, ok := rulers[addr]
+		if !ok {
+			return nil, fmt.Errorf("ruler %s is unreachable", addr)
+		}
+		return &mockRulerClient{ruler: r}, nil
+	}
+	return ring_client.NewPool("ruler", ring_client.PoolConfig{}, nil, factory, nil, log.NewNopLogger())
+}
+
+type mockRulerClient struct {
+	ruler *Ruler
+}
+
+func (c *mockRulerClient) Rules(ctx context.Context, in *RulesRequest, _ ...grpc.CallOption) (*RulesResponse, error) {
+	return c.ruler.Rules(ctx, in)
+}
+
+func (c *mockRulerClient) Check(context.Context, *grpc_health_v1.HealthCheckRequest, ...grpc.CallOption) (*grpc_health_v1.HealthCheckResponse, error) {
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (c *mockRulerClient) Watch(context.Context, *grpc_health_v1.HealthCheckRequest, ...grpc.CallOption) (grpc_health_v1.Health_WatchClient, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (c *mockRulerClient) Close() error {
+	return nil
+}
+
 // User shuffle shard token.
 func userToken(user string, skip int) uint32 {
 	r := rand.New(rand.NewSource(util.ShuffleShardSeed(user, "")))
@@ -759,7 +999,7 @@ func TestDeleteTenantRuleGroups(t *testing.T) {
 	obj, rs := setupRuleGroupsStore(t, ruleGroups)
 	require.Equal(t, 3, obj.GetObjectCount())
 
-	api, err := NewRuler(Config{}, nil, nil, log.NewNopLogger(), rs, nil)
+	api, err := NewRuler(Config{}, nil, nil, log.NewNopLogger(), rs, nil, nil)
 	require.NoError(t, err)
 
 	{
@@ -946,3 +1186,49 @@ func TestSendAlerts(t *testing.T) {
 		})
 	}
 }
+
+func TestDeliveryTracingSender(t *testing.T) {
+	annotations := labels.FromStrings("summary", "test")
+	newAlerts := func() []*notifier.Alert {
+		return []*notifier.Alert{
+			{Labels: labels.FromStrings(labels.AlertName, "first"), Annotations: annotations},
+			{Labels: labels.FromStrings(labels.AlertName, "second"), Annotations: annotations},
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		sampleRatio    float64
+		expectedTraced int
+	}{
+		"should not add the delivery trace ID when disabled": {
+			sampleRatio:    0,
+			expectedTraced: 0,
+		},
+		"should add the delivery trace ID to all the alerts": {
+			sampleRatio:    1,
+			expectedTraced: 2,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var sent []*notifier.Alert
+			sender := newDeliveryTracingSender(senderFunc(func(alerts ...*notifier.Alert) {
+				sent = alerts
+			}), ruleLimits{deliveryTraceSampleRatio: tc.sampleRatio}, "user1", log.NewNopLogger())
+
+			sender.Send(newAlerts()...)
+			require.Len(t, sent, 2)
+
+			traceIDs := map[string]struct{}{}
+			for _, a := range sent {
+				if traceID := a.Annotations.Get(deliveryTraceIDAnnotation); traceID != "" {
+					traceIDs[traceID] = struct{}{}
+					assert.Equal(t, "test", a.Annotations.Get("summary"))
+				}
+			}
+			assert.Len(t, traceIDs, tc.expectedTraced)
+
+			// The annotations shared with the rule are left untouched.
+			assert.Equal(t, labels.FromStrings("summary", "test"), annotations)
+		})
+	}
+}
@@ -11,6 +11,38 @@ import (
 	"github.com/cortexproject/cortex/pkg/cortexpb" //lint:ignore faillint allowed to import other protobuf
 )
 
+// RuleGroup is a formatted prometheus rulegroup with the fields specific to the cortex rule groups.
+type RuleGroup struct {
+	rulefmt.RuleGroup `yaml:",inline"`
+
+	// SourceTenants are the tenants whose series are queried by the rules of the group,
+	// instead of the tenant owning it.
+	SourceTenants []string `yaml:"source_tenants,omitempty"`
+
+	// AlignEvaluationTimeOnInterval evaluates the rules of the group at the start of each
+	// evaluation interval, instead of at an offset computed from the hash of the group.
+	AlignEvaluationTimeOnInterval bool `yaml:"align_evaluation_time_on_interval,omitempty"`
+}
+
+// ToProtoWithSourceTenants transforms a formatted cortex rulegroup to a rule group protobuf,
+// including the fields specific to the cortex rule groups.
+func ToProtoWithSourceTenants(user string, namespace string, rl RuleGroup) *RuleGroupDesc {
+	rg := ToProto(user, namespace, rl.RuleGroup)
+	rg.SourceTenants = rl.SourceTenants
+	rg.AlignEvaluationTimeOnInterval = rl.AlignEvaluationTimeOnInterval
+	return rg
+}
+
+// FromProtoWithSourceTenants generates a formatted cortex RuleGroup, including the fields specific
+// to the cortex rule groups.
+func FromProtoWithSourceTenants(rg *RuleGroupDesc) RuleGroup {
+	return RuleGroup{
+		RuleGroup:                     FromProto(rg),
+		SourceTenants:                 rg.GetSourceTenants(),
+		AlignEvaluationTimeOnInterval: rg.GetAlignEvaluationTimeOnInterval(),
+	}
+}
+
 // ToProto transforms a formatted prometheus rulegroup to a rule group protobuf
 func ToProto(user string, namespace string, rl rulefmt.RuleGroup) *RuleGroupDesc {
 	rg := RuleGroupDesc{
@@ -44,6 +44,12 @@ type RuleGroupDesc struct {
 	// to create custom `ManagerOpts` based on rule configs which can then be passed
 	// to the Prometheus Manager.
 	Options []*types.Any `protobuf:"bytes,9,rep,name=options,proto3" json:"options,omitempty"`
+	// The tenants whose series are queried by the rules of the group, instead of the
+	// tenant owning it.
+	SourceTenants []string `protobuf:"bytes,10,rep,name=source_tenants,json=sourceTenants,proto3" json:"source_tenants,omitempty"`
+	// Whether the rules of the group are evaluated at the start of each evaluation interval,
+	// instead of at an offset computed from the hash of the group.
+	AlignEvaluationTimeOnInterval bool `protobuf:"varint,11,opt,name=align_evaluation_time_on_interval,json=alignEvaluationTimeOnInterval,proto3" json:"align_evaluation_time_on_interval,omitempty"`
 }
 
 func (m *RuleGroupDesc) Reset()      { *m = RuleGroupDesc{} }
@@ -120,6 +126,20 @@ func (m *RuleGroupDesc) GetOptions() []*types.Any {
 	return nil
 }
 
+func (m *RuleGroupDesc) GetSourceTenants() []string {
+	if m != nil {
+		return m.SourceTenants
+	}
+	return nil
+}
+
+func (m *RuleGroupDesc) GetAlignEvaluationTimeOnInterval() bool {
+	if m != nil {
+		return m.AlignEvaluationTimeOnInterval
+	}
+	return false
+}
+
 // RuleDesc is a proto representation of a Prometheus Rule
 type RuleDesc struct {
 	Expr        string                                                      `protobuf:"bytes,1,opt,name=expr,proto3" json:"expr,omitempty"`
@@ -198,37 +218,41 @@ func init() {
 func init() { proto.RegisterFile("rules.proto", fileDescriptor_8e722d3e922f0937) }
 
 var fileDescriptor_8e722d3e922f0937 = []byte{
-	// 476 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x52, 0x3f, 0x6f, 0xd3, 0x40,
-	0x1c, 0xf5, 0x35, 0x8e, 0x63, 0x5f, 0x54, 0x11, 0x1d, 0x15, 0x72, 0x2b, 0x74, 0x89, 0x2a, 0x21,
-	0x65, 0xe1, 0x22, 0x15, 0x31, 0x30, 0x20, 0x94, 0xa8, 0x12, 0x52, 0xc4, 0x80, 0x3c, 0xb2, 0x9d,
-	0x9d, 0xab, 0x31, 0xb8, 0xbe, 0xd3, 0xf9, 0x8c, 0xda, 0x8d, 0x8f, 0xc0, 0xc8, 0x47, 0xe0, 0xa3,
-	0x74, 0xcc, 0x58, 0x31, 0x14, 0xe2, 0x2c, 0x8c, 0x95, 0xf8, 0x00, 0xa0, 0xfb, 0x63, 0x5a, 0xc1,
-	0x02, 0x03, 0x53, 0x7e, 0xef, 0xde, 0xbd, 0xbc, 0xf7, 0x7b, 0x67, 0x38, 0x94, 0x4d, 0xc9, 0x6a,
-	0x22, 0x24, 0x57, 0x1c, 0xf5, 0x0d, 0x38, 0x78, 0x98, 0x17, 0xea, 0x75, 0x93, 0x92, 0x8c, 0x9f,
-	0xce, 0x72, 0x9e, 0xf3, 0x99, 0x61, 0xd3, 0xe6, 0xc4, 0x20, 0x03, 0xcc, 0x64, 0x55, 0x07, 0x38,
-	0xe7, 0x3c, 0x2f, 0xd9, 0xcd, 0xad, 0x55, 0x23, 0xa9, 0x2a, 0x78, 0xe5, 0xf8, 0xfd, 0xdf, 0x79,
-	0x5a, 0x9d, 0x3b, 0xea, 0xc9, 0x2d, 0xa7, 0x8c, 0x4b, 0xc5, 0xce, 0x84, 0xe4, 0x6f, 0x58, 0xa6,
-	0x1c, 0x9a, 0x89, 0xb7, 0x79, 0x47, 0xa4, 0x6e, 0xb0, 0xd2, 0xc3, 0x1f, 0x00, 0xee, 0x26, 0x4d,
-	0xc9, 0x9e, 0x4b, 0xde, 0x88, 0x63, 0x56, 0x67, 0x08, 0x41, 0xbf, 0xa2, 0xa7, 0x2c, 0x06, 0x13,
-	0x30, 0x8d, 0x12, 0x33, 0xa3, 0xfb, 0x30, 0xd2, 0xbf, 0xb5, 0xa0, 0x19, 0x8b, 0x77, 0x0c, 0x71,
-	0x73, 0x80, 0x9e, 0xc1, 0xb0, 0xa8, 0x14, 0x93, 0xef, 0x68, 0x19, 0xf7, 0x26, 0x60, 0x3a, 0x3c,
-	0xda, 0x27, 0x36, 0x2c, 0xe9, 0xc2, 0x92, 0x63, 0xb7, 0xcc, 0x22, 0xbc, 0xb8, 0x1a, 0x7b, 0x1f,
-	0xbf, 0x8c, 0x41, 0xf2, 0x4b, 0x84, 0x1e, 0x40, 0x5b, 0x59, 0xec, 0x4f, 0x7a, 0xd3, 0xe1, 0xd1,
-	0x1d, 0x62, 0xdb, 0xd4, 0xb9, 0x74, 0xa4, 0xc4, 0xb2, 0x3a, 0x59, 0x53, 0x33, 0x19, 0x07, 0x36,
-	0x99, 0x9e, 0x11, 0x81, 0x03, 0x2e, 0xf4, 0x1f, 0xd7, 0x71, 0x64, 0xc4, 0x7b, 0x7f, 0x58, 0xcf,
-	0xab, 0xf3, 0xa4, 0xbb, 0xb4, 0xf4, 0xc3, 0xfe, 0x28, 0x58, 0xfa, 0xe1, 0x60, 0x14, 0x2e, 0xfd,
-	0x30, 0x1c, 0x45, 0x87, 0xdf, 0x77, 0x60, 0xd8, 0x39, 0x69, 0x0b, 0x5d, 0x5e, 0xb7, 0xbc, 0x9e,
-	0xd1, 0x3d, 0x18, 0x48, 0x96, 0x71, 0xb9, 0x72, 0x9b, 0x3b, 0x84, 0xf6, 0x60, 0x9f, 0x96, 0x4c,
-	0x2a, 0xb3, 0x73, 0x94, 0x58, 0x80, 0x1e, 0xc3, 0xde, 0x09, 0x97, 0xb1, 0xff, 0xf7, 0x3d, 0xe8,
-	0xfb, 0xa8, 0x82, 0x41, 0x49, 0x53, 0x56, 0xd6, 0x71, 0xdf, 0xac, 0x71, 0x97, 0x74, 0xef, 0x45,
-	0x5e, 0xe8, 0xf3, 0x97, 0xb4, 0x90, 0x8b, 0xb9, 0xd6, 0x7c, 0xbe, 0x1a, 0xff, 0xd3, 0x7b, 0x5b,
-	0xfd, 0x7c, 0x45, 0x85, 0x62, 0x32, 0x71, 0x2e, 0xe8, 0x0c, 0x0e, 0x69, 0x55, 0x71, 0x45, 0x6d,
-	0x77, 0xc1, 0x7f, 0x35, 0xbd, 0x6d, 0x65, 0xba, 0xdf, 0x5d, 0x3c, 0x5d, 0x6f, 0xb0, 0x77, 0xb9,
-	0xc1, 0xde, 0xf5, 0x06, 0x83, 0xf7, 0x2d, 0x06, 0x9f, 0x5a, 0x0c, 0x2e, 0x5a, 0x0c, 0xd6, 0x2d,
-	0x06, 0x5f, 0x5b, 0x0c, 0xbe, 0xb5, 0xd8, 0xbb, 0x6e, 0x31, 0xf8, 0xb0, 0xc5, 0xde, 0x7a, 0x8b,
-	0xbd, 0xcb, 0x2d, 0xf6, 0x5e, 0x0d, 0xcc, 0x87, 0x20, 0xd2, 0x34, 0x30, 0x85, 0x3e, 0xfa, 0x19,
-	0x00, 0x00, 0xff, 0xff, 0xa0, 0xd3, 0x9a, 0x1a, 0x78, 0x03, 0x00, 0x00,
+	// 544 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x52, 0xc1, 0x6e, 0xd3, 0x4c,
+	0x10, 0xf6, 0x26, 0x8e, 0x63, 0x6f, 0x94, 0xff, 0x8f, 0x96, 0x0a, 0xb9, 0x15, 0x6c, 0x42, 0xa5,
+	0x4a, 0xb9, 0xe0, 0x48, 0x45, 0x1c, 0x38, 0x20, 0x94, 0xa8, 0x08, 0x88, 0x90, 0x40, 0x56, 0x4f,
+	0x5c, 0xa2, 0xb5, 0xb3, 0x35, 0x06, 0x67, 0xd7, 0x5a, 0xaf, 0xab, 0xf6, 0xc6, 0x23, 0x70, 0xe4,
+	0x11, 0x78, 0x94, 0x1e, 0x73, 0xac, 0x38, 0x14, 0xe2, 0x5c, 0x38, 0x46, 0xe2, 0x05, 0xd0, 0xae,
+	0xed, 0xb4, 0x82, 0x0b, 0x1c, 0x38, 0x79, 0xbe, 0xf9, 0x66, 0x3c, 0xdf, 0x7c, 0x3b, 0xb0, 0x23,
+	0xf2, 0x84, 0x66, 0x5e, 0x2a, 0xb8, 0xe4, 0xa8, 0xa5, 0xc1, 0xde, 0xfd, 0x28, 0x96, 0x6f, 0xf3,
+	0xc0, 0x0b, 0xf9, 0x62, 0x14, 0xf1, 0x88, 0x8f, 0x34, 0x1b, 0xe4, 0x27, 0x1a, 0x69, 0xa0, 0xa3,
+	0xb2, 0x6b, 0x0f, 0x47, 0x9c, 0x47, 0x09, 0xbd, 0xae, 0x9a, 0xe7, 0x82, 0xc8, 0x98, 0xb3, 0x8a,
+	0xdf, 0xfd, 0x95, 0x27, 0xec, 0xbc, 0xa2, 0x1e, 0xdd, 0x98, 0x14, 0x72, 0x21, 0xe9, 0x59, 0x2a,
+	0xf8, 0x3b, 0x1a, 0xca, 0x0a, 0x8d, 0xd2, 0xf7, 0x51, 0x4d, 0x04, 0x55, 0x50, 0xb6, 0xee, 0x6f,
+	0x1a, 0xb0, 0xeb, 0xe7, 0x09, 0x7d, 0x26, 0x78, 0x9e, 0x1e, 0xd1, 0x2c, 0x44, 0x08, 0x9a, 0x8c,
+	0x2c, 0xa8, 0x0b, 0x06, 0x60, 0xe8, 0xf8, 0x3a, 0x46, 0x77, 0xa0, 0xa3, 0xbe, 0x59, 0x4a, 0x42,
+	0xea, 0x36, 0x34, 0x71, 0x9d, 0x40, 0x4f, 0xa0, 0x1d, 0x33, 0x49, 0xc5, 0x29, 0x49, 0xdc, 0xe6,
+	0x00, 0x0c, 0x3b, 0x87, 0xbb, 0x5e, 0x29, 0xd6, 0xab, 0xc5, 0x7a, 0x47, 0xd5, 0x32, 0x13, 0xfb,
+	0xe2, 0xaa, 0x6f, 0x7c, 0xfa, 0xda, 0x07, 0xfe, 0xb6, 0x09, 0x1d, 0xc0, 0xd2, 0x32, 0xd7, 0x1c,
+	0x34, 0x87, 0x9d, 0xc3, 0xff, 0x3d, 0x8d, 0x3c, 0xa5, 0x4b, 0x49, 0xf2, 0x4b, 0x56, 0x29, 0xcb,
+	0x33, 0x2a, 0x5c, 0xab, 0x54, 0xa6, 0x62, 0xe4, 0xc1, 0x36, 0x4f, 0xd5, 0x8f, 0x33, 0xd7, 0xd1,
+	0xcd, 0x3b, 0xbf, 0x8d, 0x1e, 0xb3, 0x73, 0xbf, 0x2e, 0x42, 0x07, 0xf0, 0xbf, 0x8c, 0xe7, 0x22,
+	0xa4, 0x33, 0x49, 0x19, 0x61, 0x32, 0x73, 0xe1, 0xa0, 0x39, 0x74, 0xfc, 0x6e, 0x99, 0x3d, 0x2e,
+	0x93, 0xe8, 0x39, 0xbc, 0x47, 0x92, 0x38, 0x62, 0x33, 0x7a, 0x4a, 0x92, 0x5c, 0x2b, 0x9f, 0xc9,
+	0x78, 0x41, 0x67, 0x9c, 0xcd, 0xb6, 0xbb, 0x76, 0x06, 0x60, 0x68, 0xfb, 0x77, 0x75, 0xe1, 0xd3,
+	0x6d, 0xdd, 0x71, 0xbc, 0xa0, 0xaf, 0xd8, 0x8b, 0xaa, 0x68, 0x6a, 0xda, 0xad, 0x9e, 0x35, 0x35,
+	0xed, 0x76, 0xcf, 0x9e, 0x9a, 0xb6, 0xdd, 0x73, 0xf6, 0x7f, 0x34, 0xa0, 0x5d, 0xaf, 0xa6, 0x76,
+	0x52, 0xaf, 0x55, 0xbb, 0xad, 0x62, 0x74, 0x1b, 0x5a, 0x82, 0x86, 0x5c, 0xcc, 0x2b, 0xab, 0x2b,
+	0x84, 0x76, 0x60, 0x8b, 0x24, 0x54, 0x48, 0x6d, 0xb2, 0xe3, 0x97, 0x00, 0x3d, 0x84, 0xcd, 0x13,
+	0x2e, 0x5c, 0xf3, 0xcf, 0x8d, 0x57, 0xf5, 0x88, 0x41, 0x2b, 0x21, 0x01, 0x4d, 0x32, 0xb7, 0xa5,
+	0x7d, 0xbb, 0xe5, 0xd5, 0x07, 0xe2, 0xbd, 0x54, 0xf9, 0xd7, 0x24, 0x16, 0x93, 0xb1, 0xea, 0xf9,
+	0x72, 0xd5, 0xff, 0xab, 0x03, 0x2b, 0xfb, 0xc7, 0x73, 0x92, 0x4a, 0x2a, 0xfc, 0x6a, 0x0a, 0x3a,
+	0x83, 0x1d, 0xc2, 0x18, 0x97, 0xa4, 0x7c, 0x2c, 0xeb, 0x9f, 0x0e, 0xbd, 0x39, 0x4a, 0x7b, 0xdf,
+	0x9d, 0x3c, 0x5e, 0xae, 0xb0, 0x71, 0xb9, 0xc2, 0xc6, 0x66, 0x85, 0xc1, 0x87, 0x02, 0x83, 0xcf,
+	0x05, 0x06, 0x17, 0x05, 0x06, 0xcb, 0x02, 0x83, 0x6f, 0x05, 0x06, 0xdf, 0x0b, 0x6c, 0x6c, 0x0a,
+	0x0c, 0x3e, 0xae, 0xb1, 0xb1, 0x5c, 0x63, 0xe3, 0x72, 0x8d, 0x8d, 0x37, 0x6d, 0x7d, 0x79, 0x69,
+	0x10, 0x58, 0xda, 0xd0, 0x07, 0x3f, 0x07, 0x00, 0xf7, 0xb8, 0x0c, 0x2c, 0xe9, 0x03, 0x00, 0x00,
 }
 
 func (this *RuleGroupDesc) Equal(that interface{}) bool {
@@ -278,6 +302,17 @@ func (this *RuleGroupDesc) Equal(that interface{}) bool {
 			return false
 		}
 	}
+	if len(this.SourceTenants) != len(that1.SourceTenants) {
+		return false
+	}
+	for i := range this.SourceTenants {
+		if this.SourceTenants[i] != that1.SourceTenants[i] {
+			return false
+		}
+	}
+	if this.AlignEvaluationTimeOnInterval != that1.AlignEvaluationTimeOnInterval {
+		return false
+	}
 	return true
 }
 func (this *RuleDesc) Equal(that interface{}) bool {
@@ -333,7 +368,7 @@ func (this *RuleGroupDesc) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 10)
+	s := make([]string, 0, 12)
 	s = append(s, "&rulespb.RuleGroupDesc{")
 	s = append(s, "Name: "+fmt.Sprintf("%#v", this.Name)+",\n")
 	s = append(s, "Namespace: "+fmt.Sprintf("%#v", this.Namespace)+",\n")
@@ -345,6 +380,8 @@ func (this *RuleGroupDesc) GoString() string {
 	if this.Options != nil {
 		s = append(s, "Options: "+fmt.Sprintf("%#v", this.Options)+",\n")
 	}
+	s = append(s, "SourceTenants: "+fmt.Sprintf("%#v", this.SourceTenants)+",\n")
+	s = append(s, "AlignEvaluationTimeOnInterval: "+fmt.Sprintf("%#v", this.AlignEvaluationTimeOnInterval)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -391,6 +428,25 @@ func (m *RuleGroupDesc) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.AlignEvaluationTimeOnInterval {
+		i--
+		if m.AlignEvaluationTimeOnInterval {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x58
+	}
+	if len(m.SourceTenants) > 0 {
+		for iNdEx := len(m.SourceTenants) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.SourceTenants[iNdEx])
+			copy(dAtA[i:], m.SourceTenants[iNdEx])
+			i = encodeVarintRules(dAtA, i, uint64(len(m.SourceTenants[iNdEx])))
+			i--
+			dAtA[i] = 0x52
+		}
+	}
 	if len(m.Options) > 0 {
 		for iNdEx := len(m.Options) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -574,6 +630,15 @@ func (m *RuleGroupDesc) Size() (n int) {
 			n += 1 + l + sovRules(uint64(l))
 		}
 	}
+	if len(m.SourceTenants) > 0 {
+		for _, s := range m.SourceTenants {
+			l = len(s)
+			n += 1 + l + sovRules(uint64(l))
+		}
+	}
+	if m.AlignEvaluationTimeOnInterval {
+		n += 2
+	}
 	return n
 }
 
@@ -639,6 +704,8 @@ func (this *RuleGroupDesc) String() string {
 		`Rules:` + repeatedStringForRules + `,`,
 		`User:` + fmt.Sprintf("%v", this.User) + `,`,
 		`Options:` + repeatedStringForOptions + `,`,
+		`SourceTenants:` + fmt.Sprintf("%v", this.SourceTenants) + `,`,
+		`AlignEvaluationTimeOnInterval:` + fmt.Sprintf("%v", this.AlignEvaluationTimeOnInterval) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -892,6 +959,58 @@ func (m *RuleGroupDesc) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 10:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SourceTenants", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRules
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRules
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRules
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.SourceTenants = append(m.SourceTenants, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AlignEvaluationTimeOnInterval", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRules
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.AlignEvaluationTimeOnInterval = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRules(dAtA[iNdEx:])
@@ -143,3 +143,17 @@ func NewRuleStore(ctx context.Context, cfg rulestore.Config, cfgProvider bucket.
 
 	return store, nil
 }
+
+// NewAlertStateStoreFromConfig returns the store of the alert state snapshots, in the object storage
+// bucket of the ruler storage.
+func NewAlertStateStoreFromConfig(ctx context.Context, cfg rulestore.Config, cfgProvider bucket.TenantConfigProvider, logger log.Logger, reg prometheus.Registerer) (*AlertStateStore, error) {
+	if cfg.Backend == configdb.Name || cfg.Backend == local.Name {
+		return nil, fmt.Errorf("the alert state snapshots require an object storage backend for the ruler storage, not %s", cfg.Backend)
+	}
+
+	bucketClient, err := bucket.NewClient(ctx, cfg.Config, "ruler-alert-state", logger, reg)
+	if err != nil {
+		return nil, err
+	}
+	return NewAlertStateStore(bucketClient, cfgProvider), nil
+}
@@ -0,0 +1,141 @@
+package ruler
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grafana/dskit/backoff"
+	"github.com/pkg/errors"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+)
+
+const (
+	// The reasons of the failed writes of the samples of the rule evaluations.
+	writeFailureRateLimited = "rate_limited"
+	writeFailureValidation  = "validation"
+	writeFailureUnavailable = "unavailable"
+
+	// ruleHealthDegraded is the health of the rules whose query succeeded, but whose samples
+	// failed to be written, or whose recorded metric collides with series not written by the ruler.
+	ruleHealthDegraded = "degraded"
+)
+
+// WriteRetryConfig configures the retries of the writes of the samples of the rule evaluations,
+// failed with a retriable error.
+type WriteRetryConfig struct {
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	MaxRetries int           `yaml:"max_retries"`
+}
+
+func (cfg *WriteRetryConfig) RegisterFlags(f *flag.FlagSet) {
+	f.DurationVar(&cfg.MinBackoff, "ruler.write-retry.min-backoff", 100*time.Millisecond, "Minimum delay before retrying the write of the samples of a rule evaluation.")
+	f.DurationVar(&cfg.MaxBackoff, "ruler.write-retry.max-backoff", time.Second, "Maximum delay before retrying the write of the samples of a rule evaluation.")
+	f.IntVar(&cfg.MaxRetries, "ruler.write-retry.max-retries", 3, "Maximum number of retries of the writes of the samples of the rule evaluations failed with a 429 or 5xx error. The retries are given up once the next evaluation of the rule group is due. 0 to disable.")
+}
+
+func (cfg WriteRetryConfig) backoffConfig() backoff.Config {
+	return backoff.Config{MinBackoff: cfg.MinBackoff, MaxBackoff: cfg.MaxBackoff, MaxRetries: cfg.MaxRetries}
+}
+
+// RuleWriteError is the error of the write of the samples of a rule evaluation. The rules
+// failing with this error are reported as degraded by the rules API.
+type RuleWriteError struct {
+	reason string
+	err    error
+}
+
+func (e RuleWriteError) Error() string {
+	return "failed to write the samples of the rule evaluation: " + e.err.Error()
+}
+
+func (e RuleWriteError) Unwrap() error {
+	return e.err
+}
+
+// writeFailureReason returns the reason of the write error.
+func writeFailureReason(err error) string {
+	resp, ok := httpgrpc.HTTPResponseFromError(err)
+	switch {
+	case ok && resp.Code == http.StatusTooManyRequests:
+		return writeFailureRateLimited
+	case ok && resp.Code/100 == 4:
+		return writeFailureValidation
+	default:
+		return writeFailureUnavailable
+	}
+}
+
+// ruleHealth returns the health of the rule reported by the rules API, which is degraded if only
+// the write of its samples failed.
+func ruleHealth(health string, lastError error) string {
+	if errors.As(lastError, &RuleWriteError{}) {
+		return ruleHealthDegraded
+	}
+	return health
+}
+
+type ruleGroupIntervalKey struct {
+	namespace string
+	name      string
+}
+
+// ruleGroupIntervals holds the evaluation intervals of the rule groups of a user, so that the
+// retries of the writes of the samples of their evaluations don't delay the next evaluation.
+type ruleGroupIntervals struct {
+	mtx       sync.RWMutex
+	intervals map[ruleGroupIntervalKey]time.Duration
+}
+
+func newRuleGroupIntervals() *ruleGroupIntervals {
+	return &ruleGroupIntervals{intervals: map[ruleGroupIntervalKey]time.Duration{}}
+}
+
+func (g *ruleGroupIntervals) update(groups rulespb.RuleGroupList, defaultInterval time.Duration) {
+	intervals := make(map[ruleGroupIntervalKey]time.Duration, len(groups))
+	for _, group := range groups {
+		interval := group.GetInterval()
+		if interval == 0 {
+			interval = defaultInterval
+		}
+		intervals[ruleGroupIntervalKey{namespace: group.GetNamespace(), name: group.GetName()}] = interval
+	}
+
+	g.mtx.Lock()
+	g.intervals = intervals
+	g.mtx.Unlock()
+}
+
+func (g *ruleGroupIntervals) get(namespace, name string) (time.Duration, bool) {
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+
+	interval, ok := g.intervals[ruleGroupIntervalKey{namespace: namespace, name: name}]
+	return interval, ok
+}
+
+type ruleGroupIntervalsContextKey struct{}
+
+func contextWithRuleGroupIntervals(ctx context.Context, intervals *ruleGroupIntervals) context.Context {
+	return context.WithValue(ctx, ruleGroupIntervalsContextKey{}, intervals)
+}
+
+// originRuleGroupInterval returns the evaluation interval of the rule group evaluated by the
+// Prometheus rules manager.
+func originRuleGroupInterval(ctx context.Context) (time.Duration, bool) {
+	intervals, ok := ctx.Value(ruleGroupIntervalsContextKey{}).(*ruleGroupIntervals)
+	if !ok {
+		return 0, false
+	}
+
+	namespace, name, ok := originRuleGroup(ctx)
+	if !ok {
+		return 0, false
+	}
+	return intervals.get(namespace, name)
+}
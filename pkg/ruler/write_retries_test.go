@@ -0,0 +1,92 @@
+package ruler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+)
+
+func TestRuler_ShouldReportTheRulesFailingToWriteAsDegraded(t *testing.T) {
+	store := newMockRuleStore(map[string]rulespb.RuleGroupList{
+		"user1": {
+			&rulespb.RuleGroupDesc{
+				Name:      "group1",
+				Namespace: "namespace1",
+				User:      "user1",
+				Rules:     []*rulespb.RuleDesc{{Record: "ONE", Expr: "vector(1)"}},
+				Interval:  100 * time.Millisecond,
+			},
+		},
+	})
+	cfg, cleanup := defaultRulerConfig(store)
+	defer cleanup()
+
+	queryable := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return storage.NoopQuerier(), nil
+	})
+	pusher := &fakePusher{err: httpgrpc.Errorf(http.StatusBadRequest, "out of bounds"), response: &cortexpb.WriteResponse{}}
+
+	engine := promql.NewEngine(promql.EngineOpts{MaxSamples: 1e6, Timeout: time.Minute})
+	limits := ruleLimits{maxRuleGroups: 20, maxRulesPerRuleGroup: 15}
+	reg := prometheus.NewRegistry()
+
+	manager, err := NewDefaultMultiTenantManager(cfg, DefaultTenantManagerFactory(cfg, pusher, queryable, engine, limits, nil), limits, reg, log.NewNopLogger())
+	require.NoError(t, err)
+	r, err := NewRuler(cfg, manager, reg, log.NewNopLogger(), store, limits, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), r))
+	defer services.StopAndAwaitTerminated(context.Background(), r) //nolint:errcheck
+
+	r.syncRules(context.Background(), rulerSyncReasonInitial)
+
+	a := NewAPI(r, r.store, nil, log.NewNopLogger())
+	var rule recordingRule
+	require.Eventually(t, func() bool {
+		req := requestFor(t, "GET", "https://localhost:8080/api/prom/api/v1/rules", nil, "user1")
+		w := httptest.NewRecorder()
+		a.PrometheusRules(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Data struct {
+				Groups []struct {
+					Rules []recordingRule `json:"rules"`
+				} `json:"groups"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Len(t, resp.Data.Groups, 1)
+		require.Len(t, resp.Data.Groups[0].Rules, 1)
+
+		rule = resp.Data.Groups[0].Rules[0]
+		return rule.Health == ruleHealthDegraded
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Contains(t, rule.LastError, "failed to write the samples of the rule evaluation")
+	assert.Contains(t, rule.LastError, "out of bounds")
+
+	// The query succeeded, so the failure isn't tracked in the evaluation stats.
+	assert.Zero(t, rule.EvaluationFailures)
+}
+
+func TestRuleHealth(t *testing.T) {
+	assert.Equal(t, "ok", ruleHealth("ok", nil))
+	assert.Equal(t, "err", ruleHealth("err", errors.New("query failed")))
+	assert.Equal(t, ruleHealthDegraded, ruleHealth("err", RuleWriteError{reason: writeFailureRateLimited, err: errors.New("rate limited")}))
+}
@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+const (
+	// Default and maximum number of tenants and requests listed by the debug state endpoints.
+	defaultDebugStateLimit = 100
+	maxDebugStateLimit     = 1000
+
+	// Maximum length of the URL of the requests listed by the debug state endpoints.
+	maxDebugStateURLLength = 1024
+)
+
+// DebugRequestState is the state of a request queued by the query-scheduler or query-frontend.
+type DebugRequestState struct {
+	UserID     string    `json:"user"`
+	QueryID    uint64    `json:"query_id,omitempty"`
+	Priority   int       `json:"priority"`
+	URL        string    `json:"url"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+
+	// Set once the request has been dispatched to a querier, or to a query-scheduler by the
+	// query-frontend using it.
+	DispatchedAt *time.Time `json:"dispatched_at,omitempty"`
+	Querier      string     `json:"querier,omitempty"`
+	Scheduler    string     `json:"scheduler,omitempty"`
+
+	// Time elapsed since the request has been enqueued.
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// DebugTenantState is the number of queued and dispatched requests of a tenant.
+type DebugTenantState struct {
+	UserID   string `json:"user"`
+	Queued   int    `json:"queued"`
+	Inflight int    `json:"inflight"`
+}
+
+// DebugState is the snapshot of the queue and dispatch state returned by the debug state
+// endpoints of the query-scheduler and query-frontend. The tenants with the most requests
+// and the requests enqueued the longest ago are listed first.
+type DebugState struct {
+	Tenants           []DebugTenantState  `json:"tenants"`
+	TenantsTruncated  bool                `json:"tenants_truncated"`
+	Requests          []DebugRequestState `json:"requests"`
+	RequestsTruncated bool                `json:"requests_truncated"`
+
+	// Number of worker connections of each querier, if the requests are dispatched to queriers.
+	QuerierWorkers map[string]int `json:"querier_workers,omitempty"`
+
+	// Number of connected query-schedulers, if the requests are dispatched to query-schedulers.
+	ConnectedSchedulers int `json:"connected_schedulers,omitempty"`
+}
+
+// NewDebugState returns the state of the requests, with the tenants counting their queued and
+// dispatched requests.
+func NewDebugState(requests []DebugRequestState, now time.Time) DebugState {
+	tenants := map[string]*DebugTenantState{}
+	for ix := range requests {
+		req := &requests[ix]
+		req.ElapsedSeconds = now.Sub(req.EnqueuedAt).Seconds()
+		if len(req.URL) > maxDebugStateURLLength {
+			req.URL = req.URL[:maxDebugStateURLLength]
+		}
+
+		tenant := tenants[req.UserID]
+		if tenant == nil {
+			tenant = &DebugTenantState{UserID: req.UserID}
+			tenants[req.UserID] = tenant
+		}
+		if req.DispatchedAt != nil {
+			tenant.Inflight++
+		} else {
+			tenant.Queued++
+		}
+	}
+
+	state := DebugState{
+		Tenants:  make([]DebugTenantState, 0, len(tenants)),
+		Requests: requests,
+	}
+	for _, tenant := range tenants {
+		state.Tenants = append(state.Tenants, *tenant)
+	}
+
+	sort.Slice(state.Tenants, func(i, j int) bool {
+		ti, tj := state.Tenants[i], state.Tenants[j]
+		if ti.Queued+ti.Inflight != tj.Queued+tj.Inflight {
+			return ti.Queued+ti.Inflight > tj.Queued+tj.Inflight
+		}
+		return ti.UserID < tj.UserID
+	})
+	sort.SliceStable(state.Requests, func(i, j int) bool {
+		return state.Requests[i].EnqueuedAt.Before(state.Requests[j].EnqueuedAt)
+	})
+
+	if state.Requests == nil {
+		state.Requests = []DebugRequestState{}
+	}
+	return state
+}
+
+// truncate limits the number of tenants and requests listed.
+func (s *DebugState) truncate(limit int) {
+	if len(s.Tenants) > limit {
+		s.Tenants = s.Tenants[:limit]
+		s.TenantsTruncated = true
+	}
+	if len(s.Requests) > limit {
+		s.Requests = s.Requests[:limit]
+		s.RequestsTruncated = true
+	}
+}
+
+// WriteDebugState writes the state in JSON format, listing up to the number of tenants and
+// requests of the limit URL parameter.
+func WriteDebugState(w http.ResponseWriter, r *http.Request, state DebugState) {
+	limit := defaultDebugStateLimit
+	if value := r.FormValue("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxDebugStateLimit {
+			http.Error(w, "invalid limit: must be between 1 and "+strconv.Itoa(maxDebugStateLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	state.truncate(limit)
+	util.WriteJSONResponse(w, state)
+}
@@ -0,0 +1,202 @@
+package queue
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DefaultPriority is the priority of the requests which have not been assigned one.
+const DefaultPriority = 0
+
+// priorityQueues holds the user queues of each priority level. The queues of the highest
+// priority with pending requests are used first, except when a lower priority has been skipped
+// too many times in a row: each priority with pending requests is guaranteed a minimum share
+// of the dequeued requests, so that it's not starved by the higher priorities.
+type priorityQueues struct {
+	// Queues of each priority level. All the levels track the same queriers. The level of the
+	// default priority is never removed, so that the new levels can copy its queriers.
+	levels map[int]*queues
+
+	// Priorities of the levels, from the highest.
+	priorities []int
+
+	// Number of requests dequeued from the other priorities since the last request dequeued
+	// from each priority, while it had pending requests.
+	skipped map[int]int
+
+	// Maximum number of requests dequeued from the other priorities in a row while a priority
+	// has pending requests, or a negative value to always dequeue from the highest priority.
+	maxSkipped int
+
+	maxUserQueueSize int
+	forgetDelay      time.Duration
+}
+
+func newPriorityQueues(maxUserQueueSize int, forgetDelay time.Duration, minPriorityShare float64) *priorityQueues {
+	maxSkipped := -1
+	if minPriorityShare > 0 {
+		maxSkipped = int(math.Ceil(1/math.Min(minPriorityShare, 1))) - 1
+	}
+
+	return &priorityQueues{
+		levels:           map[int]*queues{DefaultPriority: newUserQueues(maxUserQueueSize, forgetDelay)},
+		priorities:       []int{DefaultPriority},
+		skipped:          map[int]int{},
+		maxSkipped:       maxSkipped,
+		maxUserQueueSize: maxUserQueueSize,
+		forgetDelay:      forgetDelay,
+	}
+}
+
+// len returns the number of user queues across all the priorities.
+func (pq *priorityQueues) len() int {
+	n := 0
+	for _, level := range pq.levels {
+		n += level.len()
+	}
+	return n
+}
+
+// hasUser returns whether the user has a queue at any priority.
+func (pq *priorityQueues) hasUser(userID string) bool {
+	for _, level := range pq.levels {
+		if _, ok := level.userQueues[userID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getOrAddQueue returns the existing or new queue for the user at the priority.
+// See queues.getOrAddQueue for the meaning of maxQueriers.
+func (pq *priorityQueues) getOrAddQueue(userID string, priority, maxQueriers int) chan Request {
+	if userID == "" {
+		return nil
+	}
+
+	level := pq.levels[priority]
+	if level == nil {
+		level = newUserQueues(pq.maxUserQueueSize, pq.forgetDelay)
+		level.copyQueriers(pq.levels[DefaultPriority])
+		pq.levels[priority] = level
+
+		pq.priorities = append(pq.priorities, priority)
+		sort.Sort(sort.Reverse(sort.IntSlice(pq.priorities)))
+	}
+
+	return level.getOrAddQueue(userID, maxQueriers)
+}
+
+func (pq *priorityQueues) deleteQueue(userID string, priority int) {
+	level := pq.levels[priority]
+	if level == nil {
+		return
+	}
+
+	level.deleteQueue(userID)
+	if level.len() > 0 || priority == DefaultPriority {
+		return
+	}
+
+	delete(pq.levels, priority)
+	delete(pq.skipped, priority)
+	for ix, p := range pq.priorities {
+		if p == priority {
+			pq.priorities = append(pq.priorities[:ix], pq.priorities[ix+1:]...)
+			break
+		}
+	}
+}
+
+// getNextQueueForQuerier finds the next queue for the querier, looking up the priorities in
+// dequeue order. To support fair scheduling between users of the same priority, the client is
+// expected to pass the UserIndex returned by the previous call.
+func (pq *priorityQueues) getNextQueueForQuerier(last UserIndex, querierID string) (chan Request, string, int, UserIndex) {
+	for _, priority := range pq.dequeueOrder() {
+		lastUserIndex := last.lastForPriority(priority)
+
+		queue, userID, idx := pq.levels[priority].getNextQueueForQuerier(lastUserIndex, querierID)
+		if queue == nil {
+			continue
+		}
+
+		for _, p := range pq.priorities {
+			if p != priority && pq.levels[p].len() > 0 {
+				pq.skipped[p]++
+			}
+		}
+		delete(pq.skipped, priority)
+
+		return queue, userID, priority, last.withLast(priority, idx)
+	}
+
+	return nil, "", 0, last
+}
+
+// dequeueOrder returns the priorities in the order their queues are looked up: the priorities
+// which have been skipped too many times first, the most skipped one first, and then all the
+// priorities from the highest.
+func (pq *priorityQueues) dequeueOrder() []int {
+	if pq.maxSkipped < 0 || len(pq.priorities) == 1 {
+		return pq.priorities
+	}
+
+	var starved, others []int
+	for _, p := range pq.priorities {
+		if pq.skipped[p] >= pq.maxSkipped {
+			starved = append(starved, p)
+		} else {
+			others = append(others, p)
+		}
+	}
+	if len(starved) == 0 {
+		return pq.priorities
+	}
+
+	sort.SliceStable(starved, func(i, j int) bool {
+		return pq.skipped[starved[i]] > pq.skipped[starved[j]]
+	})
+	return append(starved, others...)
+}
+
+func (pq *priorityQueues) addQuerierConnection(querierID string) {
+	for _, level := range pq.levels {
+		level.addQuerierConnection(querierID)
+	}
+}
+
+// querierWorkers returns the number of connections of each querier.
+func (pq *priorityQueues) querierWorkers() map[string]int {
+	// All the levels track the same queriers.
+	workers := map[string]int{}
+	for querierID, querier := range pq.levels[DefaultPriority].queriers {
+		workers[querierID] = querier.connections
+	}
+	return workers
+}
+
+func (pq *priorityQueues) removeQuerierConnection(querierID string, now time.Time) {
+	for _, level := range pq.levels {
+		level.removeQuerierConnection(querierID, now)
+	}
+}
+
+func (pq *priorityQueues) notifyQuerierShutdown(querierID string) {
+	for _, level := range pq.levels {
+		level.notifyQuerierShutdown(querierID)
+	}
+}
+
+// forgetDisconnectedQueriers removes all disconnected queriers that have gone since at least
+// the forget delay. Returns the number of forgotten queriers.
+func (pq *priorityQueues) forgetDisconnectedQueriers(now time.Time) int {
+	forgotten := 0
+	for priority, level := range pq.levels {
+		// All the levels track the same queriers.
+		if n := level.forgetDisconnectedQueriers(now); priority == DefaultPriority {
+			forgotten = n
+		}
+	}
+	return forgotten
+}
@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityQueues_ShouldDequeueHigherPrioritiesFirst(t *testing.T) {
+	pq := newPriorityQueues(10, 0, 0)
+	pq.addQuerierConnection("querier-1")
+
+	enqueue(t, pq, "user-1", DefaultPriority, "low-1", "low-2")
+	enqueue(t, pq, "user-2", 10, "high-1")
+	enqueue(t, pq, "user-3", 5, "medium-1")
+	enqueue(t, pq, "user-1", 10, "high-2")
+	assert.Equal(t, []int{10, 5, DefaultPriority}, pq.priorities)
+
+	requests := dequeueAll(pq, "querier-1", FirstUser())
+	assert.Equal(t, []Request{"high-1", "high-2", "medium-1", "low-1", "low-2"}, requests)
+
+	// The levels of the other priorities have been removed once empty.
+	assert.Equal(t, []int{DefaultPriority}, pq.priorities)
+	assert.Len(t, pq.levels, 1)
+	assert.Equal(t, 0, pq.len())
+}
+
+func TestPriorityQueues_ShouldGuaranteeTheMinShareToLowerPriorities(t *testing.T) {
+	pq := newPriorityQueues(100, 0, 0.25)
+	pq.addQuerierConnection("querier-1")
+
+	for i := 0; i < 12; i++ {
+		enqueue(t, pq, "user-1", 10, fmt.Sprintf("high-%d", i))
+	}
+	enqueue(t, pq, "user-2", 5, "medium-1", "medium-2")
+	enqueue(t, pq, "user-3", DefaultPriority, "low-1", "low-2")
+
+	// Each priority with queued requests can't be skipped more than 3 times in a row.
+	requests := dequeueAll(pq, "querier-1", FirstUser())
+	assert.Equal(t, []Request{
+		"high-0", "high-1", "high-2", "medium-1", "low-1",
+		"high-3", "high-4", "medium-2", "low-2",
+		"high-5", "high-6", "high-7", "high-8", "high-9", "high-10", "high-11",
+	}, requests)
+}
+
+func TestPriorityQueues_ShouldBeFairBetweenUsersOfTheSamePriority(t *testing.T) {
+	pq := newPriorityQueues(100, 0, 0.5)
+	pq.addQuerierConnection("querier-1")
+
+	enqueue(t, pq, "user-1", 10, "high-1-a", "high-1-b")
+	enqueue(t, pq, "user-2", 10, "high-2-a", "high-2-b")
+	enqueue(t, pq, "user-1", DefaultPriority, "low-1-a", "low-1-b")
+	enqueue(t, pq, "user-2", DefaultPriority, "low-2-a", "low-2-b")
+
+	// The iteration over the users of each priority resumes where it stopped.
+	requests := dequeueAll(pq, "querier-1", FirstUser())
+	assert.Equal(t, []Request{
+		"high-1-a", "low-1-a", "high-2-a", "low-2-a",
+		"high-1-b", "low-1-b", "high-2-b", "low-2-b",
+	}, requests)
+}
+
+func TestPriorityQueues_ShouldDequeueOnlyTheUsersOfTheQuerier(t *testing.T) {
+	pq := newPriorityQueues(100, 0, 0)
+	pq.addQuerierConnection("querier-1")
+	pq.addQuerierConnection("querier-2")
+
+	// The new priority levels share the queriers of the existing ones.
+	enqueue(t, pq, "user-1", 10, "high-1")
+	require.NoError(t, isConsistent(pq.levels[10]))
+	assert.Equal(t, pq.levels[DefaultPriority].sortedQueriers, pq.levels[10].sortedQueriers)
+
+	pq.removeQuerierConnection("querier-2", time.Now())
+	pq.addQuerierConnection("querier-3")
+	for _, level := range pq.levels {
+		require.NoError(t, isConsistent(level))
+		assert.Equal(t, []string{"querier-1", "querier-3"}, level.sortedQueriers)
+	}
+
+	// Each user is handled by a single querier.
+	enqueue(t, pq, "user-2", 5, "medium-1")
+	assert.NotNil(t, pq.getOrAddQueue("user-2", 5, 1))
+
+	querierID, otherID := "querier-1", "querier-3"
+	if len(getUsersByQuerier(pq.levels[5], querierID)) == 0 {
+		querierID, otherID = otherID, querierID
+	}
+
+	requests := dequeueAll(pq, otherID, FirstUser())
+	assert.Equal(t, []Request{"high-1"}, requests)
+
+	requests = dequeueAll(pq, querierID, FirstUser())
+	assert.Equal(t, []Request{"medium-1"}, requests)
+}
+
+func enqueue(t *testing.T, pq *priorityQueues, userID string, priority int, requests ...Request) {
+	for _, req := range requests {
+		queue := pq.getOrAddQueue(userID, priority, 0)
+		require.NotNil(t, queue)
+		queue <- req
+	}
+}
+
+// dequeueAll dequeues all the requests the querier can handle, like RequestQueue.GetNextRequestForQuerier.
+func dequeueAll(pq *priorityQueues, querierID string, last UserIndex) []Request {
+	var requests []Request
+	for {
+		queue, userID, priority, idx := pq.getNextQueueForQuerier(last, querierID)
+		if queue == nil {
+			return requests
+		}
+		last = idx
+
+		requests = append(requests, <-queue)
+		if len(queue) == 0 {
+			pq.deleteQueue(userID, priority)
+		}
+	}
+}
@@ -9,11 +9,25 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/atomic"
+
+	util_math "github.com/cortexproject/cortex/pkg/util/math"
 )
 
 const (
 	// How frequently to check for disconnected queriers that should be forgotten.
 	forgetCheckPeriod = 5 * time.Second
+
+	// The dequeue rate of each user is an exponentially weighted moving average, updated every forgetCheckPeriod.
+	// The rate of the users without queued requests is forgotten once it falls below minDequeueRate.
+	dequeueRateAlpha = 0.2
+	minDequeueRate   = 0.01
+
+	// Bounds of the time after which a full user queue is expected to accept requests again.
+	minRetryAfter = time.Second
+	maxRetryAfter = time.Minute
+
+	// Reason of the discarded requests.
+	reasonTooManyRequests = "too_many_outstanding_requests"
 )
 
 var (
@@ -21,31 +35,79 @@ var (
 	ErrStopped         = errors.New("queue is stopped")
 )
 
+// TooManyRequestsError is returned when the user queue is full. It matches ErrTooManyRequests.
+type TooManyRequestsError struct {
+	// Estimated time after which the user queue can accept requests again, based on the recent
+	// dequeue rate of the user requests.
+	RetryAfter time.Duration
+}
+
+func (e *TooManyRequestsError) Error() string {
+	return ErrTooManyRequests.Error()
+}
+
+func (e *TooManyRequestsError) Is(target error) bool {
+	return target == ErrTooManyRequests
+}
+
 // UserIndex is opaque type that allows to resume iteration over users between successive calls
 // of RequestQueue.GetNextRequestForQuerier method.
 type UserIndex struct {
-	last int
+	// Index of the last user of the priority for which last queue was returned.
+	last     int
+	priority int
+
+	// Index of the last user of the other priorities, if any.
+	others map[int]int
 }
 
 // Modify index to start iteration on the same user, for which last queue was returned.
 func (ui UserIndex) ReuseLastUser() UserIndex {
 	if ui.last >= 0 {
-		return UserIndex{last: ui.last - 1}
+		ui.last--
 	}
 	return ui
 }
 
 // FirstUser returns UserIndex that starts iteration over user queues from the very first user.
 func FirstUser() UserIndex {
-	return UserIndex{last: -1}
+	return UserIndex{last: -1, priority: DefaultPriority}
+}
+
+func (ui UserIndex) lastForPriority(priority int) int {
+	if priority == ui.priority {
+		return ui.last
+	}
+	if last, ok := ui.others[priority]; ok {
+		return last
+	}
+	return -1
+}
+
+// withLast returns the index with the last user of the priority, for which last queue was returned.
+func (ui UserIndex) withLast(priority, last int) UserIndex {
+	if priority == ui.priority {
+		ui.last = last
+		return ui
+	}
+
+	others := make(map[int]int, len(ui.others)+1)
+	for p, l := range ui.others {
+		if p != priority {
+			others[p] = l
+		}
+	}
+	others[ui.priority] = ui.last
+
+	return UserIndex{last: last, priority: priority, others: others}
 }
 
 // Request stored into the queue.
 type Request interface{}
 
-// RequestQueue holds incoming requests in per-user queues. It also assigns each user specified number of queriers,
-// and when querier asks for next request to handle (using GetNextRequestForQuerier), it returns requests
-// in a fair fashion.
+// RequestQueue holds incoming requests in per-user queues of each priority. It also assigns each user specified number
+// of queriers, and when querier asks for next request to handle (using GetNextRequestForQuerier), it returns requests
+// of the highest priority first, and in a fair fashion between users of the same priority.
 type RequestQueue struct {
 	services.Service
 
@@ -53,33 +115,40 @@ type RequestQueue struct {
 
 	mtx     sync.Mutex
 	cond    *sync.Cond // Notified when request is enqueued or dequeued, or querier is disconnected.
-	queues  *queues
+	queues  *priorityQueues
 	stopped bool
 
-	queueLength       *prometheus.GaugeVec   // Per user and reason.
-	discardedRequests *prometheus.CounterVec // Per user.
+	// Recent rate of the dequeued requests of each user.
+	dequeueRates map[string]*util_math.EwmaRate
+
+	queueLength       *prometheus.GaugeVec   // Per user.
+	discardedRequests *prometheus.CounterVec // Per user and reason.
 }
 
-func NewRequestQueue(maxOutstandingPerTenant int, forgetDelay time.Duration, queueLength *prometheus.GaugeVec, discardedRequests *prometheus.CounterVec) *RequestQueue {
+// NewRequestQueue makes a new RequestQueue. MinPriorityShare is the minimum share of the dequeued requests guaranteed
+// to each priority with pending requests, or zero to always dequeue the requests of the highest priority first.
+func NewRequestQueue(maxOutstandingPerTenant int, forgetDelay time.Duration, minPriorityShare float64, queueLength *prometheus.GaugeVec, discardedRequests *prometheus.CounterVec) *RequestQueue {
 	q := &RequestQueue{
-		queues:                  newUserQueues(maxOutstandingPerTenant, forgetDelay),
+		queues:                  newPriorityQueues(maxOutstandingPerTenant, forgetDelay, minPriorityShare),
 		connectedQuerierWorkers: atomic.NewInt32(0),
+		dequeueRates:            map[string]*util_math.EwmaRate{},
 		queueLength:             queueLength,
 		discardedRequests:       discardedRequests,
 	}
 
 	q.cond = sync.NewCond(&q.mtx)
-	q.Service = services.NewTimerService(forgetCheckPeriod, nil, q.forgetDisconnectedQueriers, q.stopping).WithName("request queue")
+	q.Service = services.NewTimerService(forgetCheckPeriod, nil, q.iteration, q.stopping).WithName("request queue")
 
 	return q
 }
 
-// EnqueueRequest puts the request into the queue. MaxQueries is user-specific value that specifies how many queriers can
-// this user use (zero or negative = all queriers). It is passed to each EnqueueRequest, because it can change
-// between calls.
+// EnqueueRequest puts the request into the user queue of the priority. MaxQueries is user-specific value that specifies
+// how many queriers can this user use (zero or negative = all queriers). It is passed to each EnqueueRequest, because it
+// can change between calls. The max outstanding requests per tenant apply to each priority.
 //
 // If request is successfully enqueued, successFn is called with the lock held, before any querier can receive the request.
-func (q *RequestQueue) EnqueueRequest(userID string, req Request, maxQueriers int, successFn func()) error {
+// If the user queue is full, a *TooManyRequestsError is returned.
+func (q *RequestQueue) EnqueueRequest(userID string, req Request, priority, maxQueriers int, successFn func()) error {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
 
@@ -87,7 +156,7 @@ func (q *RequestQueue) EnqueueRequest(userID string, req Request, maxQueriers in
 		return ErrStopped
 	}
 
-	queue := q.queues.getOrAddQueue(userID, maxQueriers)
+	queue := q.queues.getOrAddQueue(userID, priority, maxQueriers)
 	if queue == nil {
 		// This can only happen if userID is "".
 		return errors.New("no queue found")
@@ -103,11 +172,32 @@ func (q *RequestQueue) EnqueueRequest(userID string, req Request, maxQueriers in
 		}
 		return nil
 	default:
-		q.discardedRequests.WithLabelValues(userID).Inc()
-		return ErrTooManyRequests
+		q.discardedRequests.WithLabelValues(userID, reasonTooManyRequests).Inc()
+		return &TooManyRequestsError{RetryAfter: q.retryAfter(userID, len(queue))}
 	}
 }
 
+// retryAfter returns the estimated time needed to dequeue the queued requests of the user,
+// based on the recent dequeue rate of the user requests.
+func (q *RequestQueue) retryAfter(userID string, queued int) time.Duration {
+	rate := 0.0
+	if r, ok := q.dequeueRates[userID]; ok {
+		rate = r.Rate()
+	}
+	if rate <= 0 {
+		return maxRetryAfter
+	}
+
+	retryAfter := time.Duration(float64(queued) / rate * float64(time.Second))
+	switch {
+	case retryAfter < minRetryAfter:
+		return minRetryAfter
+	case retryAfter > maxRetryAfter:
+		return maxRetryAfter
+	}
+	return retryAfter
+}
+
 // GetNextRequestForQuerier find next user queue and takes the next request off of it. Will block if there are no requests.
 // By passing user index from previous call of this method, querier guarantees that it iterates over all users fairly.
 // If querier finds that request from the user is already expired, it can get a request for the same user by using UserIndex.ReuseLastUser.
@@ -133,8 +223,8 @@ FindQueue:
 	}
 
 	for {
-		queue, userID, idx := q.queues.getNextQueueForQuerier(last.last, querierID)
-		last.last = idx
+		queue, userID, priority, idx := q.queues.getNextQueueForQuerier(last, querierID)
+		last = idx
 		if queue == nil {
 			break
 		}
@@ -143,10 +233,11 @@ FindQueue:
 		for {
 			request := <-queue
 			if len(queue) == 0 {
-				q.queues.deleteQueue(userID)
+				q.queues.deleteQueue(userID, priority)
 			}
 
 			q.queueLength.WithLabelValues(userID).Dec()
+			q.dequeueRate(userID).Inc()
 
 			// Tell close() we've processed a request.
 			q.cond.Broadcast()
@@ -161,6 +252,33 @@ FindQueue:
 	goto FindQueue
 }
 
+func (q *RequestQueue) dequeueRate(userID string) *util_math.EwmaRate {
+	r, ok := q.dequeueRates[userID]
+	if !ok {
+		r = util_math.NewEWMARate(dequeueRateAlpha, forgetCheckPeriod)
+		q.dequeueRates[userID] = r
+	}
+	return r
+}
+
+func (q *RequestQueue) iteration(ctx context.Context) error {
+	q.updateDequeueRates()
+	return q.forgetDisconnectedQueriers(ctx)
+}
+
+// updateDequeueRates ticks the dequeue rates, and forgets the ones of the inactive users.
+func (q *RequestQueue) updateDequeueRates() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for userID, r := range q.dequeueRates {
+		r.Tick()
+		if r.Rate() < minDequeueRate && !q.queues.hasUser(userID) {
+			delete(q.dequeueRates, userID)
+		}
+	}
+}
+
 func (q *RequestQueue) forgetDisconnectedQueriers(_ context.Context) error {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
@@ -221,3 +339,10 @@ func (q *RequestQueue) QuerierDisconnecting() {
 func (q *RequestQueue) GetConnectedQuerierWorkersMetric() float64 {
 	return float64(q.connectedQuerierWorkers.Load())
 }
+
+// GetQuerierWorkers returns the number of worker connections of each querier registered in the queue.
+func (q *RequestQueue) GetQuerierWorkers() map[string]int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.queues.querierWorkers()
+}
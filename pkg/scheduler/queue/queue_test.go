@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/grafana/dskit/services"
 	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -22,9 +24,9 @@ func BenchmarkGetNextRequest(b *testing.B) {
 	queues := make([]*RequestQueue, 0, b.N)
 
 	for n := 0; n < b.N; n++ {
-		queue := NewRequestQueue(maxOutstandingPerTenant, 0,
+		queue := NewRequestQueue(maxOutstandingPerTenant, 0, 0,
 			prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
-			prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+			prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user", "reason"}),
 		)
 		queues = append(queues, queue)
 
@@ -36,7 +38,7 @@ func BenchmarkGetNextRequest(b *testing.B) {
 			for j := 0; j < numTenants; j++ {
 				userID := strconv.Itoa(j)
 
-				err := queue.EnqueueRequest(userID, "request", 0, nil)
+				err := queue.EnqueueRequest(userID, "request", DefaultPriority, 0, nil)
 				if err != nil {
 					b.Fatal(err)
 				}
@@ -53,7 +55,7 @@ func BenchmarkGetNextRequest(b *testing.B) {
 			querier := ""
 		b:
 			// Find querier with at least one request to avoid blocking in getNextRequestForQuerier.
-			for _, q := range queues[i].queues.userQueues {
+			for _, q := range queues[i].queues.levels[DefaultPriority].userQueues {
 				for qid := range q.queriers {
 					querier = qid
 					break b
@@ -79,9 +81,9 @@ func BenchmarkQueueRequest(b *testing.B) {
 	requests := make([]string, 0, numTenants)
 
 	for n := 0; n < b.N; n++ {
-		q := NewRequestQueue(maxOutstandingPerTenant, 0,
+		q := NewRequestQueue(maxOutstandingPerTenant, 0, 0,
 			prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
-			prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+			prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user", "reason"}),
 		)
 
 		for ix := 0; ix < queriers; ix++ {
@@ -100,7 +102,7 @@ func BenchmarkQueueRequest(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		for i := 0; i < maxOutstandingPerTenant; i++ {
 			for j := 0; j < numTenants; j++ {
-				err := queues[n].EnqueueRequest(users[j], requests[j], 0, nil)
+				err := queues[n].EnqueueRequest(users[j], requests[j], DefaultPriority, 0, nil)
 				if err != nil {
 					b.Fatal(err)
 				}
@@ -112,9 +114,9 @@ func BenchmarkQueueRequest(b *testing.B) {
 func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBecauseQuerierHasBeenForgotten(t *testing.T) {
 	const forgetDelay = 3 * time.Second
 
-	queue := NewRequestQueue(1, forgetDelay,
+	queue := NewRequestQueue(1, forgetDelay, 0,
 		prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
-		prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user"}))
+		prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"user", "reason"}))
 
 	// Start the queue service.
 	ctx := context.Background()
@@ -141,7 +143,7 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBe
 
 	// Enqueue a request from an user which would be assigned to querier-1.
 	// NOTE: "user-1" hash falls in the querier-1 shard.
-	require.NoError(t, queue.EnqueueRequest("user-1", "request", 1, nil))
+	require.NoError(t, queue.EnqueueRequest("user-1", "request", DefaultPriority, 1, nil))
 
 	startTime := time.Now()
 	querier2wg.Wait()
@@ -150,3 +152,48 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBe
 	// We expect that querier-2 got the request only after querier-1 forget delay is passed.
 	assert.GreaterOrEqual(t, waitTime.Milliseconds(), forgetDelay.Milliseconds())
 }
+
+func TestRequestQueue_EnqueueRequest_ShouldReturnRetryAfterWhenTheUserQueueIsFull(t *testing.T) {
+	discardedRequests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_query_scheduler_discarded_requests_total",
+		Help: "Total number of query requests discarded.",
+	}, []string{"user", "reason"})
+
+	queue := NewRequestQueue(2, 0, 0,
+		prometheus.NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		discardedRequests)
+	queue.RegisterQuerierConnection("querier-1")
+
+	// The user queue is full, and no request of the user has been dequeued yet.
+	require.NoError(t, queue.EnqueueRequest("user-1", "request-1", DefaultPriority, 0, nil))
+	require.NoError(t, queue.EnqueueRequest("user-1", "request-2", DefaultPriority, 0, nil))
+
+	err := queue.EnqueueRequest("user-1", "request-3", DefaultPriority, 0, nil)
+	require.ErrorIs(t, err, ErrTooManyRequests)
+
+	var tooManyRequests *TooManyRequestsError
+	require.ErrorAs(t, err, &tooManyRequests)
+	assert.Equal(t, maxRetryAfter, tooManyRequests.RetryAfter)
+
+	// The requests of the other users are unaffected.
+	require.NoError(t, queue.EnqueueRequest("user-2", "request-1", DefaultPriority, 0, nil))
+
+	// The user requests are dequeued at a rate of 0.4 requests per second.
+	for i := 0; i < 2; i++ {
+		req, _, err := queue.GetNextRequestForQuerier(context.Background(), FirstUser(), "querier-1")
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("request-%d", i+1), req)
+		require.NoError(t, queue.EnqueueRequest("user-1", fmt.Sprintf("request-%d", i+3), DefaultPriority, 0, nil))
+	}
+	queue.updateDequeueRates()
+
+	err = queue.EnqueueRequest("user-1", "request-5", DefaultPriority, 0, nil)
+	require.ErrorAs(t, err, &tooManyRequests)
+	assert.Equal(t, 5*time.Second, tooManyRequests.RetryAfter)
+
+	assert.NoError(t, promtest.CollectAndCompare(discardedRequests, strings.NewReader(`
+		# HELP cortex_query_scheduler_discarded_requests_total Total number of query requests discarded.
+		# TYPE cortex_query_scheduler_discarded_requests_total counter
+		cortex_query_scheduler_discarded_requests_total{reason="too_many_outstanding_requests",user="user-1"} 2
+	`)))
+}
@@ -171,6 +171,15 @@ func (q *queues) getNextQueueForQuerier(lastUserIndex int, querierID string) (ch
 	return nil, "", uid
 }
 
+// copyQueriers copies the queriers tracked by other, which must not have any user queue yet.
+func (q *queues) copyQueriers(other *queues) {
+	for querierID, info := range other.queriers {
+		copied := *info
+		q.queriers[querierID] = &copied
+	}
+	q.sortedQueriers = append([]string(nil), other.sortedQueriers...)
+}
+
 func (q *queues) addQuerierConnection(querierID string) {
 	info := q.queriers[querierID]
 	if info != nil {
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"io"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -31,6 +32,9 @@ import (
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
+// QueryPriorityHeader is the request header lowering the tenant's query priority.
+const QueryPriorityHeader = "X-Cortex-Query-Priority"
+
 var (
 	errSchedulerIsNotRunning = errors.New("scheduler is not running")
 )
@@ -62,7 +66,8 @@ type Scheduler struct {
 	discardedRequests        *prometheus.CounterVec
 	connectedQuerierClients  prometheus.GaugeFunc
 	connectedFrontendClients prometheus.GaugeFunc
-	queueDuration            prometheus.Histogram
+	queueDuration            *prometheus.HistogramVec
+	priorityQueueLength      *prometheus.GaugeVec
 }
 
 type requestKey struct {
@@ -82,12 +87,14 @@ type connectedFrontend struct {
 type Config struct {
 	MaxOutstandingPerTenant int               `yaml:"max_outstanding_requests_per_tenant"`
 	QuerierForgetDelay      time.Duration     `yaml:"querier_forget_delay"`
+	QueryPriorityMinShare   float64           `yaml:"query_priority_min_share"`
 	GRPCClientConfig        grpcclient.Config `yaml:"grpc_client_config" doc:"description=This configures the gRPC client used to report errors back to the query-frontend."`
 }
 
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.MaxOutstandingPerTenant, "query-scheduler.max-outstanding-requests-per-tenant", 100, "Maximum number of outstanding requests per tenant per query-scheduler. In-flight requests above this limit will fail with HTTP response status code 429.")
 	f.DurationVar(&cfg.QuerierForgetDelay, "query-scheduler.querier-forget-delay", 0, "If a querier disconnects without sending notification about graceful shutdown, the query-scheduler will keep the querier in the tenant's shard until the forget delay has passed. This feature is useful to reduce the blast radius when shuffle-sharding is enabled.")
+	f.Float64Var(&cfg.QueryPriorityMinShare, "query-scheduler.query-priority-min-share", 0.1, "Minimum share of the dequeued queries guaranteed to each query priority with queued queries, so that the queries with a lower priority are not starved by the ones with a higher priority. 0 to always dequeue the queries with the highest priority first.")
 	cfg.GRPCClientConfig.RegisterFlagsWithPrefix("query-scheduler.grpc-client-config", f)
 }
 
@@ -110,14 +117,18 @@ func NewScheduler(cfg Config, limits Limits, log log.Logger, registerer promethe
 	s.discardedRequests = promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
 		Name: "cortex_query_scheduler_discarded_requests_total",
 		Help: "Total number of query requests discarded.",
-	}, []string{"user"})
-	s.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, s.queueLength, s.discardedRequests)
+	}, []string{"user", "reason"})
+	s.requestQueue = queue.NewRequestQueue(cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, cfg.QueryPriorityMinShare, s.queueLength, s.discardedRequests)
 
-	s.queueDuration = promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+	s.queueDuration = promauto.With(registerer).NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "cortex_query_scheduler_queue_duration_seconds",
 		Help:    "Time spend by requests in queue before getting picked up by a querier.",
 		Buckets: prometheus.DefBuckets,
-	})
+	}, []string{"priority"})
+	s.priorityQueueLength = promauto.With(registerer).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cortex_query_scheduler_priority_queue_length",
+		Help: "Number of queries in the queue, by priority.",
+	}, []string{"priority"})
 	s.connectedQuerierClients = promauto.With(registerer).NewGaugeFunc(prometheus.GaugeOpts{
 		Name: "cortex_query_scheduler_connected_querier_clients",
 		Help: "Number of querier worker clients currently connected to the query-scheduler.",
@@ -143,6 +154,9 @@ func NewScheduler(cfg Config, limits Limits, log log.Logger, registerer promethe
 type Limits interface {
 	// MaxQueriersPerUser returns max queriers to use per tenant, or 0 if shuffle sharding is disabled.
 	MaxQueriersPerUser(user string) int
+
+	// QueryPriority returns the priority of the tenant's queries in the queue.
+	QueryPriority(user string) int
 }
 
 type schedulerRequest struct {
@@ -151,9 +165,14 @@ type schedulerRequest struct {
 	queryID         uint64
 	request         *httpgrpc.HTTPRequest
 	statsEnabled    bool
+	priority        int
 
 	enqueueTime time.Time
 
+	// Set once the request is dispatched to a querier, protected by pendingRequestsMu.
+	querierID    string
+	dispatchTime time.Time
+
 	ctx       context.Context
 	ctxCancel context.CancelFunc
 	queueSpan opentracing.Span
@@ -197,12 +216,17 @@ func (s *Scheduler) FrontendLoop(frontend schedulerpb.SchedulerForFrontend_Front
 
 		switch msg.GetType() {
 		case schedulerpb.ENQUEUE:
+			var tooManyRequests *queue.TooManyRequestsError
+
 			err = s.enqueueRequest(frontendCtx, frontendAddress, msg)
 			switch {
 			case err == nil:
 				resp = &schedulerpb.SchedulerToFrontend{Status: schedulerpb.OK}
-			case err == queue.ErrTooManyRequests:
-				resp = &schedulerpb.SchedulerToFrontend{Status: schedulerpb.TOO_MANY_REQUESTS_PER_TENANT}
+			case errors.As(err, &tooManyRequests):
+				resp = &schedulerpb.SchedulerToFrontend{
+					Status:            schedulerpb.TOO_MANY_REQUESTS_PER_TENANT,
+					RetryAfterSeconds: grpcutil.RetryAfterSeconds(tooManyRequests.RetryAfter),
+				}
 			default:
 				resp = &schedulerpb.SchedulerToFrontend{Status: schedulerpb.ERROR, Error: err.Error()}
 			}
@@ -306,9 +330,15 @@ func (s *Scheduler) enqueueRequest(frontendContext context.Context, frontendAddr
 	}
 	maxQueriers := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, s.limits.MaxQueriersPerUser)
 
+	req.priority, err = s.queryPriority(tenantIDs, msg.HttpRequest)
+	if err != nil {
+		return err
+	}
+
 	s.activeUsers.UpdateUserTimestamp(userID, now)
-	return s.requestQueue.EnqueueRequest(userID, req, maxQueriers, func() {
+	return s.requestQueue.EnqueueRequest(userID, req, req.priority, maxQueriers, func() {
 		shouldCancel = false
+		s.priorityQueueLength.WithLabelValues(strconv.Itoa(req.priority)).Inc()
 
 		s.pendingRequestsMu.Lock()
 		defer s.pendingRequestsMu.Unlock()
@@ -316,6 +346,33 @@ func (s *Scheduler) enqueueRequest(frontendContext context.Context, frontendAddr
 	})
 }
 
+// queryPriority returns the priority of the request in the queue: the lowest priority of the tenants, lowered
+// to the one of the X-Cortex-Query-Priority header if set. The header can't raise the priority, so that the
+// clients can't jump the queue and the priorities, each one with its own queue, are bounded by the configured ones.
+func (s *Scheduler) queryPriority(tenantIDs []string, req *httpgrpc.HTTPRequest) (int, error) {
+	tenantPriority := validation.SmallestPositiveIntPerTenant(tenantIDs, s.limits.QueryPriority)
+
+	for _, h := range req.GetHeaders() {
+		if http.CanonicalHeaderKey(h.Key) != QueryPriorityHeader || len(h.Values) == 0 {
+			continue
+		}
+
+		priority, err := strconv.Atoi(h.Values[0])
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid %s header", QueryPriorityHeader)
+		}
+		if priority > tenantPriority {
+			priority = tenantPriority
+		}
+		if priority < 0 {
+			priority = 0
+		}
+		return priority, nil
+	}
+
+	return tenantPriority, nil
+}
+
 // This method doesn't do removal from the queue.
 func (s *Scheduler) cancelRequestAndRemoveFromPending(frontendAddr string, queryID uint64) {
 	s.pendingRequestsMu.Lock()
@@ -361,7 +418,9 @@ func (s *Scheduler) QuerierLoop(querier schedulerpb.SchedulerForQuerier_QuerierL
 
 		r := req.(*schedulerRequest)
 
-		s.queueDuration.Observe(time.Since(r.enqueueTime).Seconds())
+		priority := strconv.Itoa(r.priority)
+		s.priorityQueueLength.WithLabelValues(priority).Dec()
+		s.queueDuration.WithLabelValues(priority).Observe(time.Since(r.enqueueTime).Seconds())
 		r.queueSpan.Finish()
 
 		/*
@@ -384,6 +443,8 @@ func (s *Scheduler) QuerierLoop(querier schedulerpb.SchedulerForQuerier_QuerierL
 			continue
 		}
 
+		s.markRequestDispatched(r, querierID)
+
 		if err := s.forwardRequestToQuerier(querier, r); err != nil {
 			return err
 		}
@@ -392,6 +453,14 @@ func (s *Scheduler) QuerierLoop(querier schedulerpb.SchedulerForQuerier_QuerierL
 	return errSchedulerIsNotRunning
 }
 
+func (s *Scheduler) markRequestDispatched(req *schedulerRequest, querierID string) {
+	s.pendingRequestsMu.Lock()
+	defer s.pendingRequestsMu.Unlock()
+
+	req.querierID = querierID
+	req.dispatchTime = time.Now()
+}
+
 func (s *Scheduler) NotifyQuerierShutdown(_ context.Context, req *schedulerpb.NotifyQuerierShutdownRequest) (*schedulerpb.NotifyQuerierShutdownResponse, error) {
 	level.Info(s.log).Log("msg", "received shutdown notification from querier", "querier", req.GetQuerierID())
 	s.requestQueue.NotifyQuerierShutdown(req.GetQuerierID())
@@ -465,11 +534,8 @@ func (s *Scheduler) forwardErrorToFrontend(ctx context.Context, req *schedulerRe
 
 	userCtx := user.InjectOrgID(ctx, req.userID)
 	_, err = client.QueryResult(userCtx, &frontendv2pb.QueryResultRequest{
-		QueryID: req.queryID,
-		HttpResponse: &httpgrpc.HTTPResponse{
-			Code: http.StatusInternalServerError,
-			Body: []byte(requestErr.Error()),
-		},
+		QueryID:      req.queryID,
+		HttpResponse: grpcutil.QuerierFailureResponse(requestErr),
 	})
 
 	if err != nil {
@@ -512,7 +578,36 @@ func (s *Scheduler) stopping(_ error) error {
 
 func (s *Scheduler) cleanupMetricsForInactiveUser(user string) {
 	s.queueLength.DeleteLabelValues(user)
-	s.discardedRequests.DeleteLabelValues(user)
+	if err := util.DeleteMatchingLabels(s.discardedRequests, map[string]string{"user": user}); err != nil {
+		level.Warn(s.log).Log("msg", "failed to remove cortex_query_scheduler_discarded_requests_total metric for user", "user", user, "err", err)
+	}
+}
+
+// DebugStateHandler returns the snapshot of the queued and dispatched requests, and of the
+// connected querier workers.
+func (s *Scheduler) DebugStateHandler(w http.ResponseWriter, r *http.Request) {
+	s.pendingRequestsMu.Lock()
+	requests := make([]queue.DebugRequestState, 0, len(s.pendingRequests))
+	for _, req := range s.pendingRequests {
+		state := queue.DebugRequestState{
+			UserID:     req.userID,
+			QueryID:    req.queryID,
+			Priority:   req.priority,
+			URL:        req.request.GetUrl(),
+			EnqueuedAt: req.enqueueTime,
+		}
+		if !req.dispatchTime.IsZero() {
+			dispatchTime := req.dispatchTime
+			state.DispatchedAt = &dispatchTime
+			state.Querier = req.querierID
+		}
+		requests = append(requests, state)
+	}
+	s.pendingRequestsMu.Unlock()
+
+	state := queue.NewDebugState(requests, time.Now())
+	state.QuerierWorkers = s.requestQueue.GetQuerierWorkers()
+	queue.WriteDebugState(w, r, state)
 }
 
 func (s *Scheduler) getConnectedFrontendClientsMetric() float64 {
@@ -2,9 +2,11 @@ package scheduler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
@@ -21,6 +23,7 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/cortexproject/cortex/pkg/frontend/v2/frontendv2pb"
+	"github.com/cortexproject/cortex/pkg/scheduler/queue"
 	"github.com/cortexproject/cortex/pkg/scheduler/schedulerpb"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 	chunk "github.com/cortexproject/cortex/pkg/util/grpcutil"
@@ -30,11 +33,15 @@ import (
 const testMaxOutstandingPerTenant = 5
 
 func setupScheduler(t *testing.T, reg prometheus.Registerer) (*Scheduler, schedulerpb.SchedulerForFrontendClient, schedulerpb.SchedulerForQuerierClient) {
+	return setupSchedulerWithLimits(t, reg, &limits{queriers: 2})
+}
+
+func setupSchedulerWithLimits(t *testing.T, reg prometheus.Registerer, limits Limits) (*Scheduler, schedulerpb.SchedulerForFrontendClient, schedulerpb.SchedulerForQuerierClient) {
 	cfg := Config{}
 	flagext.DefaultValues(&cfg)
 	cfg.MaxOutstandingPerTenant = testMaxOutstandingPerTenant
 
-	s, err := NewScheduler(cfg, &limits{queriers: 2}, log.NewNopLogger(), reg)
+	s, err := NewScheduler(cfg, limits, log.NewNopLogger(), reg)
 	require.NoError(t, err)
 
 	server := grpc.NewServer()
@@ -343,6 +350,20 @@ func TestSchedulerMaxOutstandingRequests(t *testing.T) {
 	msg, err := fl.Recv()
 	require.NoError(t, err)
 	require.True(t, msg.Status == schedulerpb.TOO_MANY_REQUESTS_PER_TENANT)
+	// No query of the user has been dequeued yet, so the frontend is told to retry after the max delay.
+	require.Equal(t, int64(60), msg.RetryAfterSeconds)
+
+	// The queries of the other users are unaffected.
+	require.NoError(t, fl.Send(&schedulerpb.FrontendToScheduler{
+		Type:        schedulerpb.ENQUEUE,
+		QueryID:     1,
+		UserID:      "another",
+		HttpRequest: &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello"},
+	}))
+
+	msg, err = fl.Recv()
+	require.NoError(t, err)
+	require.True(t, msg.Status == schedulerpb.OK)
 }
 
 func TestSchedulerForwardsErrorToFrontend(t *testing.T) {
@@ -405,6 +426,96 @@ func TestSchedulerForwardsErrorToFrontend(t *testing.T) {
 	})
 }
 
+func TestSchedulerQueryPriority(t *testing.T) {
+	scheduler, frontendClient, querierClient := setupSchedulerWithLimits(t, nil, &limits{priorities: map[string]int{"high": 10}})
+
+	frontendLoop := initFrontendLoop(t, frontendClient, "frontend-12345")
+	frontendToScheduler(t, frontendLoop, &schedulerpb.FrontendToScheduler{
+		Type:        schedulerpb.ENQUEUE,
+		QueryID:     1,
+		UserID:      "low",
+		HttpRequest: &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello"},
+	})
+	frontendToScheduler(t, frontendLoop, &schedulerpb.FrontendToScheduler{
+		Type:        schedulerpb.ENQUEUE,
+		QueryID:     2,
+		UserID:      "high",
+		HttpRequest: &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello"},
+	})
+	// The header can't raise the priority of the tenant.
+	frontendToScheduler(t, frontendLoop, &schedulerpb.FrontendToScheduler{
+		Type:    schedulerpb.ENQUEUE,
+		QueryID: 3,
+		UserID:  "low",
+		HttpRequest: &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello", Headers: []*httpgrpc.Header{
+			{Key: QueryPriorityHeader, Values: []string{"20"}},
+		}},
+	})
+	// The header lowers the priority of the tenant.
+	frontendToScheduler(t, frontendLoop, &schedulerpb.FrontendToScheduler{
+		Type:    schedulerpb.ENQUEUE,
+		QueryID: 4,
+		UserID:  "high",
+		HttpRequest: &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello", Headers: []*httpgrpc.Header{
+			{Key: QueryPriorityHeader, Values: []string{"5"}},
+		}},
+	})
+
+	// The queries with the highest priority are dequeued first.
+	querierLoop := initQuerierLoop(t, querierClient, "querier-1")
+	for _, expected := range []uint64{2, 4, 1, 3} {
+		msg, err := querierLoop.Recv()
+		require.NoError(t, err)
+		require.Equal(t, expected, msg.QueryID)
+		require.NoError(t, querierLoop.Send(&schedulerpb.QuerierToScheduler{}))
+	}
+
+	verifyNoPendingRequestsLeft(t, scheduler)
+}
+
+func TestSchedulerQueryPriority_InvalidHeader(t *testing.T) {
+	_, frontendClient, _ := setupScheduler(t, nil)
+
+	frontendLoop := initFrontendLoop(t, frontendClient, "frontend-12345")
+	require.NoError(t, frontendLoop.Send(&schedulerpb.FrontendToScheduler{
+		Type:    schedulerpb.ENQUEUE,
+		QueryID: 1,
+		UserID:  "test",
+		HttpRequest: &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello", Headers: []*httpgrpc.Header{
+			{Key: QueryPriorityHeader, Values: []string{"high"}},
+		}},
+	}))
+
+	msg, err := frontendLoop.Recv()
+	require.NoError(t, err)
+	require.Equal(t, schedulerpb.ERROR, msg.Status)
+	require.Contains(t, msg.Error, "invalid X-Cortex-Query-Priority header")
+}
+
+func TestScheduler_queryPriority(t *testing.T) {
+	s := &Scheduler{limits: &limits{priorities: map[string]int{"high": 10}}}
+
+	for header, expected := range map[string]int{
+		"":   10,
+		"20": 10,
+		"10": 10,
+		"5":  5,
+		"0":  0,
+		"-5": 0,
+	} {
+		t.Run(header, func(t *testing.T) {
+			req := &httpgrpc.HTTPRequest{}
+			if header != "" {
+				req.Headers = []*httpgrpc.Header{{Key: QueryPriorityHeader, Values: []string{header}}}
+			}
+
+			priority, err := s.queryPriority([]string{"high"}, req)
+			require.NoError(t, err)
+			require.Equal(t, expected, priority)
+		})
+	}
+}
+
 func TestSchedulerMetrics(t *testing.T) {
 	reg := prometheus.NewPedanticRegistry()
 
@@ -429,7 +540,11 @@ func TestSchedulerMetrics(t *testing.T) {
 		# TYPE cortex_query_scheduler_queue_length gauge
 		cortex_query_scheduler_queue_length{user="another"} 1
 		cortex_query_scheduler_queue_length{user="test"} 1
-	`), "cortex_query_scheduler_queue_length"))
+
+		# HELP cortex_query_scheduler_priority_queue_length Number of queries in the queue, by priority.
+		# TYPE cortex_query_scheduler_priority_queue_length gauge
+		cortex_query_scheduler_priority_queue_length{priority="0"} 2
+	`), "cortex_query_scheduler_queue_length", "cortex_query_scheduler_priority_queue_length"))
 
 	scheduler.cleanupMetricsForInactiveUser("test")
 
@@ -440,6 +555,74 @@ func TestSchedulerMetrics(t *testing.T) {
 	`), "cortex_query_scheduler_queue_length"))
 }
 
+func TestSchedulerDebugState(t *testing.T) {
+	scheduler, frontendClient, querierClient := setupScheduler(t, nil)
+
+	frontendLoop := initFrontendLoop(t, frontendClient, "frontend-12345")
+	for _, req := range []struct {
+		queryID uint64
+		userID  string
+	}{{1, "test"}, {2, "test"}, {3, "another"}} {
+		frontendToScheduler(t, frontendLoop, &schedulerpb.FrontendToScheduler{
+			Type:        schedulerpb.ENQUEUE,
+			QueryID:     req.queryID,
+			UserID:      req.userID,
+			HttpRequest: &httpgrpc.HTTPRequest{Method: "GET", Url: fmt.Sprintf("/hello/%d", req.queryID)},
+		})
+	}
+
+	querierLoop := initQuerierLoop(t, querierClient, "querier-1")
+	msg, err := querierLoop.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), msg.QueryID)
+
+	getState := func(url string) queue.DebugState {
+		w := httptest.NewRecorder()
+		scheduler.DebugStateHandler(w, httptest.NewRequest("GET", url, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var state queue.DebugState
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &state))
+		return state
+	}
+
+	state := getState("/scheduler/debug/state")
+	require.Equal(t, []queue.DebugTenantState{
+		{UserID: "test", Queued: 1, Inflight: 1},
+		{UserID: "another", Queued: 1},
+	}, state.Tenants)
+	require.Equal(t, map[string]int{"querier-1": 1}, state.QuerierWorkers)
+	require.False(t, state.RequestsTruncated)
+	require.Len(t, state.Requests, 3)
+
+	// The requests enqueued the longest ago are listed first.
+	dispatched := state.Requests[0]
+	require.Equal(t, uint64(1), dispatched.QueryID)
+	require.Equal(t, "test", dispatched.UserID)
+	require.Equal(t, "/hello/1", dispatched.URL)
+	require.Equal(t, "querier-1", dispatched.Querier)
+	require.NotNil(t, dispatched.DispatchedAt)
+	require.False(t, dispatched.DispatchedAt.Before(dispatched.EnqueuedAt))
+
+	for _, queued := range state.Requests[1:] {
+		require.Nil(t, queued.DispatchedAt)
+		require.Empty(t, queued.Querier)
+	}
+
+	state = getState("/scheduler/debug/state?limit=1")
+	require.True(t, state.TenantsTruncated)
+	require.True(t, state.RequestsTruncated)
+	require.Equal(t, []queue.DebugTenantState{{UserID: "test", Queued: 1, Inflight: 1}}, state.Tenants)
+	require.Len(t, state.Requests, 1)
+	require.Equal(t, uint64(1), state.Requests[0].QueryID)
+
+	w := httptest.NewRecorder()
+	scheduler.DebugStateHandler(w, httptest.NewRequest("GET", "/scheduler/debug/state?limit=0", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	require.NoError(t, querierLoop.Send(&schedulerpb.QuerierToScheduler{}))
+}
+
 func initFrontendLoop(t *testing.T, client schedulerpb.SchedulerForFrontendClient, frontendAddr string) schedulerpb.SchedulerForFrontend_FrontendLoopClient {
 	loop, err := client.FrontendLoop(context.Background())
 	require.NoError(t, err)
@@ -494,13 +677,18 @@ func verifyNoPendingRequestsLeft(t *testing.T, scheduler *Scheduler) {
 }
 
 type limits struct {
-	queriers int
+	queriers   int
+	priorities map[string]int
 }
 
 func (l limits) MaxQueriersPerUser(_ string) int {
 	return l.queriers
 }
 
+func (l limits) QueryPriority(user string) int {
+	return l.priorities[user]
+}
+
 type frontendMock struct {
 	mu   sync.Mutex
 	resp map[uint64]*httpgrpc.HTTPResponse
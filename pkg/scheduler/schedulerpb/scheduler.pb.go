@@ -298,6 +298,9 @@ func (m *FrontendToScheduler) GetStatsEnabled() bool {
 type SchedulerToFrontend struct {
 	Status SchedulerToFrontendStatus `protobuf:"varint,1,opt,name=status,proto3,enum=schedulerpb.SchedulerToFrontendStatus" json:"status,omitempty"`
 	Error  string                    `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	// Used by TOO_MANY_REQUESTS_PER_TENANT. Number of seconds after which the frontend can
+	// retry to enqueue the requests of the tenant.
+	RetryAfterSeconds int64 `protobuf:"varint,3,opt,name=retryAfterSeconds,proto3" json:"retryAfterSeconds,omitempty"`
 }
 
 func (m *SchedulerToFrontend) Reset()      { *m = SchedulerToFrontend{} }
@@ -346,6 +349,13 @@ func (m *SchedulerToFrontend) GetError() string {
 	return ""
 }
 
+func (m *SchedulerToFrontend) GetRetryAfterSeconds() int64 {
+	if m != nil {
+		return m.RetryAfterSeconds
+	}
+	return 0
+}
+
 type NotifyQuerierShutdownRequest struct {
 	QuerierID string `protobuf:"bytes,1,opt,name=querierID,proto3" json:"querierID,omitempty"`
 }
@@ -438,48 +448,49 @@ func init() {
 func init() { proto.RegisterFile("scheduler.proto", fileDescriptor_2b3fc28395a6d9c5) }
 
 var fileDescriptor_2b3fc28395a6d9c5 = []byte{
-	// 650 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0xcf, 0x4f, 0x13, 0x41,
-	0x14, 0xde, 0x29, 0x6d, 0x81, 0x57, 0x94, 0x75, 0x00, 0xad, 0x0d, 0x0e, 0x4d, 0x63, 0x4c, 0x25,
-	0xb1, 0x35, 0xd5, 0x44, 0x0f, 0xc4, 0xa4, 0xc2, 0x22, 0x8d, 0xb8, 0x85, 0xe9, 0x34, 0xfe, 0xb8,
-	0x34, 0xb4, 0x1d, 0x5a, 0x02, 0xec, 0x2c, 0xb3, 0xbb, 0x92, 0xde, 0x3c, 0x7a, 0xf4, 0xcf, 0xf0,
-	0x4f, 0xf1, 0x62, 0xc2, 0x91, 0x83, 0x07, 0x59, 0x2e, 0x1e, 0xf9, 0x13, 0x0c, 0xd3, 0x6d, 0xdd,
-	0xd6, 0x16, 0xb8, 0xbd, 0xf7, 0xf6, 0xfb, 0x76, 0xde, 0xf7, 0xbd, 0x37, 0x03, 0xb3, 0x4e, 0xa3,
-	0xcd, 0x9b, 0xde, 0x01, 0x97, 0x39, 0x5b, 0x0a, 0x57, 0xe0, 0x44, 0xbf, 0x60, 0xd7, 0x53, 0x4f,
-	0x5a, 0x7b, 0x6e, 0xdb, 0xab, 0xe7, 0x1a, 0xe2, 0x30, 0xdf, 0x12, 0x2d, 0x91, 0x57, 0x98, 0xba,
-	0xb7, 0xab, 0x32, 0x95, 0xa8, 0xa8, 0xcb, 0x4d, 0x3d, 0x0f, 0xc1, 0x8f, 0xf9, 0xce, 0x67, 0x7e,
-	0x2c, 0xe4, 0xbe, 0x93, 0x6f, 0x88, 0xc3, 0x43, 0x61, 0xe5, 0xdb, 0xae, 0x6b, 0xb7, 0xa4, 0xdd,
-	0xe8, 0x07, 0x5d, 0x56, 0xa6, 0x00, 0x78, 0xdb, 0xe3, 0x72, 0x8f, 0x4b, 0x26, 0x2a, 0xbd, 0xc3,
-	0xf1, 0x22, 0x4c, 0x1f, 0x75, 0xab, 0xa5, 0xb5, 0x24, 0x4a, 0xa3, 0xec, 0x34, 0xfd, 0x57, 0xc8,
-	0xfc, 0x44, 0x80, 0xfb, 0x58, 0x26, 0x02, 0x3e, 0x4e, 0xc2, 0xe4, 0x25, 0xa6, 0x13, 0x50, 0xa2,
-	0xb4, 0x97, 0xe2, 0x17, 0x90, 0xb8, 0x3c, 0x96, 0xf2, 0x23, 0x8f, 0x3b, 0x6e, 0x32, 0x92, 0x46,
-	0xd9, 0x44, 0x61, 0x21, 0xd7, 0x6f, 0x65, 0x83, 0xb1, 0xad, 0xe0, 0x23, 0x0d, 0x23, 0x71, 0x16,
-	0x66, 0x77, 0xa5, 0xb0, 0x5c, 0x6e, 0x35, 0x8b, 0xcd, 0xa6, 0xe4, 0x8e, 0x93, 0x9c, 0x50, 0xdd,
-	0x0c, 0x97, 0xf1, 0x5d, 0x88, 0x7b, 0x8e, 0x6a, 0x37, 0xaa, 0x00, 0x41, 0x86, 0x33, 0x30, 0xe3,
-	0xb8, 0x3b, 0xae, 0x63, 0x58, 0x3b, 0xf5, 0x03, 0xde, 0x4c, 0xc6, 0xd2, 0x28, 0x3b, 0x45, 0x07,
-	0x6a, 0x99, 0xaf, 0x11, 0x98, 0x5b, 0x0f, 0xfe, 0x17, 0x76, 0xe1, 0x25, 0x44, 0xdd, 0x8e, 0xcd,
-	0x95, 0x9a, 0xdb, 0x85, 0x87, 0xb9, 0xd0, 0x70, 0x72, 0x23, 0xf0, 0xac, 0x63, 0x73, 0xaa, 0x18,
-	0xa3, 0xfa, 0x8e, 0x8c, 0xee, 0x3b, 0x64, 0xda, 0xc4, 0xa0, 0x69, 0xe3, 0x14, 0x0d, 0x99, 0x19,
-	0xbb, 0xb1, 0x99, 0xc3, 0x56, 0xc4, 0x47, 0x58, 0xb1, 0x0f, 0x73, 0xa1, 0xc9, 0xf6, 0x44, 0xe2,
-	0x57, 0x10, 0xbf, 0x84, 0x79, 0x4e, 0xe0, 0xc5, 0xa3, 0x01, 0x2f, 0x46, 0x30, 0x2a, 0x0a, 0x4d,
-	0x03, 0x16, 0x9e, 0x87, 0x18, 0x97, 0x52, 0xc8, 0xc0, 0x85, 0x6e, 0x92, 0x59, 0x81, 0x45, 0x53,
-	0xb8, 0x7b, 0xbb, 0x9d, 0x60, 0x83, 0x2a, 0x6d, 0xcf, 0x6d, 0x8a, 0x63, 0xab, 0xd7, 0xf0, 0xd5,
-	0x5b, 0xb8, 0x04, 0x0f, 0xc6, 0xb0, 0x1d, 0x5b, 0x58, 0x0e, 0x5f, 0x5e, 0x81, 0x7b, 0x63, 0xa6,
-	0x84, 0xa7, 0x20, 0x5a, 0x32, 0x4b, 0x4c, 0xd7, 0x70, 0x02, 0x26, 0x0d, 0x73, 0xbb, 0x6a, 0x54,
-	0x0d, 0x1d, 0x61, 0x80, 0xf8, 0x6a, 0xd1, 0x5c, 0x35, 0x36, 0xf5, 0xc8, 0x72, 0x03, 0xee, 0x8f,
-	0xd5, 0x85, 0xe3, 0x10, 0x29, 0xbf, 0xd5, 0x35, 0x9c, 0x86, 0x45, 0x56, 0x2e, 0xd7, 0xde, 0x15,
-	0xcd, 0x8f, 0x35, 0x6a, 0x6c, 0x57, 0x8d, 0x0a, 0xab, 0xd4, 0xb6, 0x0c, 0x5a, 0x63, 0x86, 0x59,
-	0x34, 0x99, 0x8e, 0xf0, 0x34, 0xc4, 0x0c, 0x4a, 0xcb, 0x54, 0x8f, 0xe0, 0x3b, 0x70, 0xab, 0xb2,
-	0x51, 0x65, 0xac, 0x64, 0xbe, 0xa9, 0xad, 0x95, 0xdf, 0x9b, 0xfa, 0x44, 0xe1, 0x17, 0x0a, 0xf9,
-	0xbd, 0x2e, 0x64, 0xef, 0x2a, 0x55, 0x21, 0x11, 0x84, 0x9b, 0x42, 0xd8, 0x78, 0x69, 0xc0, 0xee,
-	0xff, 0xef, 0x6b, 0x6a, 0x69, 0xdc, 0x3c, 0x02, 0x6c, 0x46, 0xcb, 0xa2, 0xa7, 0x08, 0x5b, 0xb0,
-	0x30, 0xd2, 0x32, 0xfc, 0x78, 0x80, 0x7f, 0xd5, 0x50, 0x52, 0xcb, 0x37, 0x81, 0x76, 0x27, 0x50,
-	0xb0, 0x61, 0x3e, 0xac, 0xae, 0xbf, 0x4e, 0x1f, 0x60, 0xa6, 0x17, 0x2b, 0x7d, 0xe9, 0xeb, 0xae,
-	0x56, 0x2a, 0x7d, 0xdd, 0xc2, 0x75, 0x15, 0xbe, 0x2e, 0x9e, 0x9c, 0x11, 0xed, 0xf4, 0x8c, 0x68,
-	0x17, 0x67, 0x04, 0x7d, 0xf1, 0x09, 0xfa, 0xee, 0x13, 0xf4, 0xc3, 0x27, 0xe8, 0xc4, 0x27, 0xe8,
-	0xb7, 0x4f, 0xd0, 0x1f, 0x9f, 0x68, 0x17, 0x3e, 0x41, 0xdf, 0xce, 0x89, 0x76, 0x72, 0x4e, 0xb4,
-	0xd3, 0x73, 0xa2, 0x7d, 0x0a, 0x3f, 0xbb, 0xf5, 0xb8, 0x7a, 0x18, 0x9f, 0xfd, 0x0d, 0x00, 0x00,
-	0xff, 0xff, 0x49, 0x11, 0xf9, 0x34, 0x9d, 0x05, 0x00, 0x00,
+	// 671 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0x4f, 0x4f, 0xdb, 0x4e,
+	0x10, 0xf5, 0xe6, 0x1f, 0x30, 0xe1, 0xf7, 0xc3, 0x2c, 0xd0, 0xa6, 0x11, 0x35, 0x51, 0x54, 0x55,
+	0x29, 0x6a, 0x93, 0x2a, 0xad, 0xd4, 0x1e, 0x50, 0xa5, 0x14, 0x4c, 0x89, 0x4a, 0x1d, 0x58, 0x3b,
+	0xea, 0x9f, 0x4b, 0x44, 0xe2, 0x4d, 0x82, 0x0a, 0x5e, 0xb3, 0x5e, 0x17, 0xe5, 0xd6, 0x63, 0x8f,
+	0xbd, 0xf6, 0x1b, 0xf4, 0xa3, 0xf4, 0x52, 0x89, 0x23, 0x87, 0x1e, 0x8a, 0xb9, 0xf4, 0xc8, 0x47,
+	0xa8, 0xb0, 0x9d, 0xd4, 0x81, 0x04, 0xb8, 0xcd, 0x8c, 0xdf, 0xf3, 0xce, 0xbc, 0x37, 0xbb, 0x30,
+	0xe3, 0xb4, 0xba, 0xd4, 0x74, 0xf7, 0x28, 0x2f, 0xda, 0x9c, 0x09, 0x86, 0xd3, 0x83, 0x82, 0xdd,
+	0xcc, 0x3e, 0xea, 0xec, 0x8a, 0xae, 0xdb, 0x2c, 0xb6, 0xd8, 0x7e, 0xa9, 0xc3, 0x3a, 0xac, 0xe4,
+	0x63, 0x9a, 0x6e, 0xdb, 0xcf, 0xfc, 0xc4, 0x8f, 0x02, 0x6e, 0xf6, 0x69, 0x04, 0x7e, 0x48, 0x77,
+	0x3e, 0xd1, 0x43, 0xc6, 0x3f, 0x3a, 0xa5, 0x16, 0xdb, 0xdf, 0x67, 0x56, 0xa9, 0x2b, 0x84, 0xdd,
+	0xe1, 0x76, 0x6b, 0x10, 0x04, 0xac, 0x7c, 0x19, 0xf0, 0xb6, 0x4b, 0xf9, 0x2e, 0xe5, 0x06, 0xd3,
+	0xfb, 0x87, 0xe3, 0x45, 0x98, 0x3a, 0x08, 0xaa, 0xd5, 0xb5, 0x0c, 0xca, 0xa1, 0xc2, 0x14, 0xf9,
+	0x57, 0xc8, 0xff, 0x44, 0x80, 0x07, 0x58, 0x83, 0x85, 0x7c, 0x9c, 0x81, 0x89, 0x73, 0x4c, 0x2f,
+	0xa4, 0x24, 0x48, 0x3f, 0xc5, 0xcf, 0x20, 0x7d, 0x7e, 0x2c, 0xa1, 0x07, 0x2e, 0x75, 0x44, 0x26,
+	0x96, 0x43, 0x85, 0x74, 0x79, 0xa1, 0x38, 0x68, 0x65, 0xc3, 0x30, 0xb6, 0xc2, 0x8f, 0x24, 0x8a,
+	0xc4, 0x05, 0x98, 0x69, 0x73, 0x66, 0x09, 0x6a, 0x99, 0x15, 0xd3, 0xe4, 0xd4, 0x71, 0x32, 0x71,
+	0xbf, 0x9b, 0x8b, 0x65, 0x7c, 0x0b, 0x52, 0xae, 0xe3, 0xb7, 0x9b, 0xf0, 0x01, 0x61, 0x86, 0xf3,
+	0x30, 0xed, 0x88, 0x1d, 0xe1, 0xa8, 0xd6, 0x4e, 0x73, 0x8f, 0x9a, 0x99, 0x64, 0x0e, 0x15, 0x26,
+	0xc9, 0x50, 0x2d, 0xff, 0x25, 0x06, 0x73, 0xeb, 0xe1, 0xff, 0xa2, 0x2a, 0x3c, 0x87, 0x84, 0xe8,
+	0xd9, 0xd4, 0x9f, 0xe6, 0xff, 0xf2, 0xbd, 0x62, 0xc4, 0x9c, 0xe2, 0x08, 0xbc, 0xd1, 0xb3, 0x29,
+	0xf1, 0x19, 0xa3, 0xfa, 0x8e, 0x8d, 0xee, 0x3b, 0x22, 0x5a, 0x7c, 0x58, 0xb4, 0x71, 0x13, 0x5d,
+	0x10, 0x33, 0x79, 0x63, 0x31, 0x2f, 0x4a, 0x91, 0x1a, 0x21, 0xc5, 0x37, 0x04, 0x73, 0x11, 0x6b,
+	0xfb, 0x53, 0xe2, 0x17, 0x90, 0x3a, 0xc7, 0xb9, 0x4e, 0x28, 0xc6, 0xfd, 0x21, 0x31, 0x46, 0x30,
+	0x74, 0x1f, 0x4d, 0x42, 0x16, 0x9e, 0x87, 0x24, 0xe5, 0x9c, 0xf1, 0x50, 0x86, 0x20, 0xc1, 0x0f,
+	0x61, 0x96, 0x53, 0xc1, 0x7b, 0x95, 0xb6, 0xa0, 0x5c, 0xa7, 0x2d, 0x66, 0x99, 0x81, 0xc1, 0x71,
+	0x72, 0xf9, 0x43, 0x7e, 0x05, 0x16, 0x35, 0x26, 0x76, 0xdb, 0xbd, 0x70, 0xe1, 0xf4, 0xae, 0x2b,
+	0x4c, 0x76, 0x68, 0xf5, 0xe7, 0xbb, 0x7a, 0x69, 0x97, 0xe0, 0xee, 0x18, 0xb6, 0x63, 0x33, 0xcb,
+	0xa1, 0xcb, 0x2b, 0x70, 0x7b, 0x8c, 0xa9, 0x78, 0x12, 0x12, 0x55, 0xad, 0x6a, 0xc8, 0x12, 0x4e,
+	0xc3, 0x84, 0xaa, 0x6d, 0xd7, 0xd5, 0xba, 0x2a, 0x23, 0x0c, 0x90, 0x5a, 0xad, 0x68, 0xab, 0xea,
+	0xa6, 0x1c, 0x5b, 0x6e, 0xc1, 0x9d, 0xb1, 0x2a, 0xe0, 0x14, 0xc4, 0x6a, 0xaf, 0x65, 0x09, 0xe7,
+	0x60, 0xd1, 0xa8, 0xd5, 0x1a, 0x6f, 0x2a, 0xda, 0xfb, 0x06, 0x51, 0xb7, 0xeb, 0xaa, 0x6e, 0xe8,
+	0x8d, 0x2d, 0x95, 0x34, 0x0c, 0x55, 0xab, 0x68, 0x86, 0x8c, 0xf0, 0x14, 0x24, 0x55, 0x42, 0x6a,
+	0x44, 0x8e, 0xe1, 0x59, 0xf8, 0x4f, 0xdf, 0xa8, 0x1b, 0x46, 0x55, 0x7b, 0xd5, 0x58, 0xab, 0xbd,
+	0xd5, 0xe4, 0x78, 0xf9, 0x57, 0xd4, 0x9d, 0x75, 0xc6, 0xfb, 0x37, 0xaf, 0x0e, 0xe9, 0x30, 0xdc,
+	0x64, 0xcc, 0xc6, 0x4b, 0x43, 0xe6, 0x5c, 0xbe, 0xde, 0xd9, 0xa5, 0x71, 0xee, 0x85, 0xd8, 0xbc,
+	0x54, 0x40, 0x8f, 0x11, 0xb6, 0x60, 0x61, 0xa4, 0x64, 0xf8, 0xc1, 0x10, 0xff, 0x2a, 0x53, 0xb2,
+	0xcb, 0x37, 0x81, 0x06, 0x0e, 0x94, 0x6d, 0x98, 0x8f, 0x4e, 0x37, 0x58, 0xbe, 0x77, 0x30, 0xdd,
+	0x8f, 0xfd, 0xf9, 0x72, 0xd7, 0xdd, 0xc4, 0x6c, 0xee, 0xba, 0xf5, 0x0c, 0x26, 0x7c, 0x59, 0x39,
+	0x3a, 0x51, 0xa4, 0xe3, 0x13, 0x45, 0x3a, 0x3b, 0x51, 0xd0, 0x67, 0x4f, 0x41, 0xdf, 0x3d, 0x05,
+	0xfd, 0xf0, 0x14, 0x74, 0xe4, 0x29, 0xe8, 0xb7, 0xa7, 0xa0, 0x3f, 0x9e, 0x22, 0x9d, 0x79, 0x0a,
+	0xfa, 0x7a, 0xaa, 0x48, 0x47, 0xa7, 0x8a, 0x74, 0x7c, 0xaa, 0x48, 0x1f, 0xa2, 0xaf, 0x74, 0x33,
+	0xe5, 0xbf, 0xa3, 0x4f, 0xfe, 0x0e, 0x00, 0x3e, 0x16, 0x3a, 0x8f, 0xcc, 0x05, 0x00, 0x00,
 }
 
 func (x FrontendToSchedulerType) String() string {
@@ -620,6 +631,9 @@ func (this *SchedulerToFrontend) Equal(that interface{}) bool {
 	if this.Error != that1.Error {
 		return false
 	}
+	if this.RetryAfterSeconds != that1.RetryAfterSeconds {
+		return false
+	}
 	return true
 }
 func (this *NotifyQuerierShutdownRequest) Equal(that interface{}) bool {
@@ -714,10 +728,11 @@ func (this *SchedulerToFrontend) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 6)
+	s := make([]string, 0, 7)
 	s = append(s, "&schedulerpb.SchedulerToFrontend{")
 	s = append(s, "Status: "+fmt.Sprintf("%#v", this.Status)+",\n")
 	s = append(s, "Error: "+fmt.Sprintf("%#v", this.Error)+",\n")
+	s = append(s, "RetryAfterSeconds: "+fmt.Sprintf("%#v", this.RetryAfterSeconds)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -1211,6 +1226,11 @@ func (m *SchedulerToFrontend) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.RetryAfterSeconds != 0 {
+		i = encodeVarintScheduler(dAtA, i, uint64(m.RetryAfterSeconds))
+		i--
+		dAtA[i] = 0x18
+	}
 	if len(m.Error) > 0 {
 		i -= len(m.Error)
 		copy(dAtA[i:], m.Error)
@@ -1373,6 +1393,9 @@ func (m *SchedulerToFrontend) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovScheduler(uint64(l))
 	}
+	if m.RetryAfterSeconds != 0 {
+		n += 1 + sovScheduler(uint64(m.RetryAfterSeconds))
+	}
 	return n
 }
 
@@ -1450,6 +1473,7 @@ func (this *SchedulerToFrontend) String() string {
 	s := strings.Join([]string{`&SchedulerToFrontend{`,
 		`Status:` + fmt.Sprintf("%v", this.Status) + `,`,
 		`Error:` + fmt.Sprintf("%v", this.Error) + `,`,
+		`RetryAfterSeconds:` + fmt.Sprintf("%v", this.RetryAfterSeconds) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -2049,6 +2073,25 @@ func (m *SchedulerToFrontend) Unmarshal(dAtA []byte) error {
 			}
 			m.Error = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RetryAfterSeconds", wireType)
+			}
+			m.RetryAfterSeconds = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowScheduler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RetryAfterSeconds |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipScheduler(dAtA[iNdEx:])
@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/client_golang/prometheus"
@@ -52,6 +53,11 @@ type Config struct {
 	Swift      swift.Config      `yaml:"swift"`
 	Filesystem filesystem.Config `yaml:"filesystem"`
 
+	ClientSideEncryption ClientSideEncryptionConfig `yaml:"client_side_encryption"`
+
+	LogRequestsSlowerThan    time.Duration `yaml:"log_requests_slower_than"`
+	RedactTenantInObjectKeys bool          `yaml:"redact_tenant_in_object_keys"`
+
 	// Not used internally, meant to allow callers to wrap Buckets
 	// created using this config
 	Middlewares []func(objstore.Bucket) (objstore.Bucket, error) `yaml:"-"`
@@ -77,8 +83,11 @@ func (cfg *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
 	cfg.Azure.RegisterFlagsWithPrefix(prefix, f)
 	cfg.Swift.RegisterFlagsWithPrefix(prefix, f)
 	cfg.Filesystem.RegisterFlagsWithPrefix(prefix, f)
+	cfg.ClientSideEncryption.RegisterFlagsWithPrefix(prefix, f)
 
 	f.StringVar(&cfg.Backend, prefix+"backend", "s3", fmt.Sprintf("Backend storage to use. Supported backends are: %s.", strings.Join(cfg.supportedBackends(), ", ")))
+	f.DurationVar(&cfg.LogRequestsSlowerThan, prefix+"bucket.log-requests-slower-than", 0, "If set to a value greater than 0, the requests to the bucket slower than this value are logged, with the operation and the object key. 0 to disable.")
+	f.BoolVar(&cfg.RedactTenantInObjectKeys, prefix+"bucket.redact-tenant-in-object-keys", false, "Redact the first segment of the object keys, which is the tenant ID in the blocks storage, from the traces and the logs of the bucket requests.")
 }
 
 func (cfg *Config) Validate() error {
@@ -116,7 +125,15 @@ func NewClient(ctx context.Context, cfg Config, name string, logger log.Logger,
 		return nil, err
 	}
 
-	client = objstore.NewTracingBucket(bucketWithMetrics(client, name, reg))
+	client = NewTracingBucketClient(bucketWithMetrics(client, name, reg), cfg.LogRequestsSlowerThan, cfg.RedactTenantInObjectKeys, logger)
+
+	// The client-side encryption is always wrapped, so that the upload of the objects which
+	// should be encrypted fails if no data key provider has been configured.
+	keys, err := cfg.ClientSideEncryption.dataKeyProvider()
+	if err != nil {
+		return nil, err
+	}
+	client = NewClientSideEncryptionBucketClient(client, keys)
 
 	// Wrap the client with any provided middleware
 	for _, wrap := range cfg.Middlewares {
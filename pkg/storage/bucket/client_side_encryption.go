@@ -0,0 +1,176 @@
+package bucket
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// The size of the data keys and master keys, in bytes, selecting AES-256.
+	clientSideEncryptionKeySize = 32
+)
+
+var (
+	errClientSideEncryptionNotConfigured = errors.New("the client-side encryption is enabled for the tenant but no data key provider has been configured")
+	errInvalidEncryptedDataKey           = errors.New("invalid encrypted data key")
+)
+
+type clientSideEncryptionContextKey int
+
+const clientSideEncryptionKeyIDContextKey clientSideEncryptionContextKey = 0
+
+// ContextWithClientSideEncryptionKeyID returns a context with the ID of the key which should be
+// used to encrypt client-side the objects uploaded with it.
+func ContextWithClientSideEncryptionKeyID(ctx context.Context, keyID string) context.Context {
+	return context.WithValue(ctx, clientSideEncryptionKeyIDContextKey, keyID)
+}
+
+func clientSideEncryptionKeyIDFromContext(ctx context.Context) string {
+	keyID, _ := ctx.Value(clientSideEncryptionKeyIDContextKey).(string)
+	return keyID
+}
+
+// DataKeyProvider generates and decrypts the data keys used to encrypt the objects client-side,
+// using the master key identified by the key ID. It's typically backed by a KMS.
+type DataKeyProvider interface {
+	// GenerateDataKey returns a new data key, both in plaintext and encrypted with the master key.
+	GenerateDataKey(ctx context.Context, keyID string) (plaintext, encrypted []byte, err error)
+
+	// DecryptDataKey returns the plaintext of a data key encrypted with the master key.
+	DecryptDataKey(ctx context.Context, keyID string, encrypted []byte) ([]byte, error)
+}
+
+// ClientSideEncryptionConfig configures the client-side encryption of the objects.
+type ClientSideEncryptionConfig struct {
+	KeyringFile string `yaml:"keyring_file"`
+
+	// Allow upstream callers to inject a data key provider, like one backed by a KMS.
+	// Takes precedence over the keyring file.
+	DataKeyProvider DataKeyProvider `yaml:"-"`
+}
+
+// RegisterFlagsWithPrefix registers the client-side encryption flags with the provided prefix.
+func (cfg *ClientSideEncryptionConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.StringVar(&cfg.KeyringFile, prefix+"client-side-encryption.keyring-file", "", "Path to the YAML file containing the base64 encoded 256 bits master keys, indexed by key ID, used to encrypt the data keys of the tenants with the client-side encryption enabled. It must be configured on all the components reading or writing the blocks of these tenants.")
+}
+
+// dataKeyProvider returns the configured data key provider, or nil if the client-side encryption
+// is not configured.
+func (cfg *ClientSideEncryptionConfig) dataKeyProvider() (DataKeyProvider, error) {
+	if cfg.DataKeyProvider != nil {
+		return cfg.DataKeyProvider, nil
+	}
+	if cfg.KeyringFile == "" {
+		return nil, nil
+	}
+
+	return NewKeyringDataKeyProviderFromFile(cfg.KeyringFile)
+}
+
+// KeyringDataKeyProvider is a DataKeyProvider encrypting the data keys with AES-GCM, using the
+// master keys of a local keyring.
+type KeyringDataKeyProvider struct {
+	keys map[string]cipher.AEAD
+}
+
+// NewKeyringDataKeyProvider makes a new KeyringDataKeyProvider with the input master keys, indexed by key ID.
+func NewKeyringDataKeyProvider(keys map[string][]byte) (*KeyringDataKeyProvider, error) {
+	p := &KeyringDataKeyProvider{keys: make(map[string]cipher.AEAD, len(keys))}
+
+	for keyID, key := range keys {
+		if len(key) != clientSideEncryptionKeySize {
+			return nil, fmt.Errorf("the master key %s must be %d bytes long", keyID, clientSideEncryptionKeySize)
+		}
+
+		aead, err := newAESGCM(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "master key %s", keyID)
+		}
+		p.keys[keyID] = aead
+	}
+
+	return p, nil
+}
+
+// NewKeyringDataKeyProviderFromFile makes a new KeyringDataKeyProvider loading the master keys from
+// a YAML file in the format:
+//
+//	keys:
+//	  <key ID>: <base64 encoded key>
+func NewKeyringDataKeyProviderFromFile(path string) (*KeyringDataKeyProvider, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read the client-side encryption keyring")
+	}
+
+	keyring := struct {
+		Keys map[string]string `yaml:"keys"`
+	}{}
+	if err := yaml.UnmarshalStrict(content, &keyring); err != nil {
+		return nil, errors.Wrap(err, "parse the client-side encryption keyring")
+	}
+
+	keys := make(map[string][]byte, len(keyring.Keys))
+	for keyID, encoded := range keyring.Keys {
+		if keys[keyID], err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, errors.Wrapf(err, "decode the master key %s", keyID)
+		}
+	}
+
+	return NewKeyringDataKeyProvider(keys)
+}
+
+// GenerateDataKey implements DataKeyProvider.
+func (p *KeyringDataKeyProvider) GenerateDataKey(_ context.Context, keyID string) ([]byte, []byte, error) {
+	master, ok := p.keys[keyID]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown client-side encryption key %s", keyID)
+	}
+
+	// The encrypted data key is prefixed by the random nonce used to encrypt it.
+	buf := make([]byte, clientSideEncryptionKeySize+master.NonceSize())
+	if _, err := rand.Read(buf); err != nil {
+		return nil, nil, err
+	}
+
+	plaintext, nonce := buf[:clientSideEncryptionKeySize], buf[clientSideEncryptionKeySize:]
+	encrypted := master.Seal(nonce, nonce, plaintext, []byte(keyID))
+
+	return plaintext, encrypted, nil
+}
+
+// DecryptDataKey implements DataKeyProvider.
+func (p *KeyringDataKeyProvider) DecryptDataKey(_ context.Context, keyID string, encrypted []byte) ([]byte, error) {
+	master, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown client-side encryption key %s", keyID)
+	}
+	if len(encrypted) < master.NonceSize() {
+		return nil, errInvalidEncryptedDataKey
+	}
+
+	plaintext, err := master.Open(nil, encrypted[:master.NonceSize()], encrypted[master.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, errInvalidEncryptedDataKey
+	}
+
+	return plaintext, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,624 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+// The objects encrypted client-side are made of their content split into segments, each one
+// encrypted with AES-GCM using the data key of the object. Splitting the content into segments
+// allows to decrypt a range of the object without reading it all. The nonce of each segment is the
+// nonce prefix of the object followed by the segment index (4 bytes), while the segment additional
+// data flags whether it's the last segment of the object, so that a truncated object can't be read
+// successfully.
+//
+// The objstore.Bucket doesn't support the user metadata of the objects, so the key ID, the
+// encrypted data key and the nonce prefix of each encrypted object are stored in a metadata object,
+// uploaded before the object in the clientSideEncryptionMetadataDir of its block:
+//
+//	<block ID>/index           -> <block ID>/client-side-encryption/index.json
+//	<block ID>/chunks/000001   -> <block ID>/client-side-encryption/chunks/000001.json
+const (
+	clientSideEncryptionVersion        = 1
+	clientSideEncryptionSegmentSize    = 64 * 1024
+	clientSideEncryptionNoncePrefixLen = 8
+	clientSideEncryptionTagSize        = 16
+
+	clientSideEncryptionMetadataDir = "client-side-encryption"
+
+	// The max number of metadata of the encrypted objects kept in memory, to not read them and
+	// decrypt their data key on every range request.
+	clientSideEncryptionMetadataCacheSize = 10000
+)
+
+var (
+	errInvalidClientSideEncryptionMetadata = errors.New("invalid client-side encryption metadata")
+	errTruncatedEncryptedObject            = errors.New("the client-side encrypted object is truncated")
+)
+
+// ClientSideEncryptionBucketClient is a wrapper around a objstore.Bucket encrypting, on upload, the
+// blocks index and chunks with the client-side encryption key ID set in the context, and
+// decrypting them transparently on read. The objects which haven't been encrypted client-side are
+// read as is, while the other objects, including the blocks meta.json and the bucket index, are
+// never encrypted so that the blocks can be discovered without the keys.
+type ClientSideEncryptionBucketClient struct {
+	bucket objstore.Bucket
+	keys   DataKeyProvider
+
+	ciphersMx sync.Mutex
+	ciphers   *simplelru.LRU
+}
+
+// NewClientSideEncryptionBucketClient makes a new ClientSideEncryptionBucketClient. The keys can be nil,
+// in which case the objects are read as is and the upload of an object which should be encrypted fails.
+func NewClientSideEncryptionBucketClient(bucket objstore.Bucket, keys DataKeyProvider) *ClientSideEncryptionBucketClient {
+	// The error is returned only if the size is not positive.
+	ciphers, _ := simplelru.NewLRU(clientSideEncryptionMetadataCacheSize, nil)
+
+	return &ClientSideEncryptionBucketClient{
+		bucket:  bucket,
+		keys:    keys,
+		ciphers: ciphers,
+	}
+}
+
+// Upload the contents of the reader as an object into the bucket.
+func (b *ClientSideEncryptionBucketClient) Upload(ctx context.Context, name string, r io.Reader) error {
+	b.invalidateCipher(name)
+
+	keyID := clientSideEncryptionKeyIDFromContext(ctx)
+	if keyID == "" || !isClientSideEncryptedObject(name) {
+		return b.bucket.Upload(ctx, name, r)
+	}
+	if b.keys == nil {
+		return errClientSideEncryptionNotConfigured
+	}
+
+	plaintextKey, encryptedKey, err := b.keys.GenerateDataKey(ctx, keyID)
+	if err != nil {
+		return errors.Wrapf(err, "generate the data key to encrypt %s", name)
+	}
+
+	noncePrefix := make([]byte, clientSideEncryptionNoncePrefixLen)
+	if _, err := rand.Read(noncePrefix); err != nil {
+		return errors.Wrapf(err, "encrypt %s", name)
+	}
+
+	enc, err := newEncryptingReader(r, plaintextKey, noncePrefix)
+	if err != nil {
+		return errors.Wrapf(err, "encrypt %s", name)
+	}
+
+	// The metadata is uploaded first, so that the object is never read without it.
+	metadata, err := json.Marshal(clientSideEncryptionMetadata{
+		Version:          clientSideEncryptionVersion,
+		KeyID:            keyID,
+		EncryptedDataKey: encryptedKey,
+		NoncePrefix:      noncePrefix,
+		SegmentSize:      clientSideEncryptionSegmentSize,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "marshal the client-side encryption metadata of %s", name)
+	}
+	if err := b.bucket.Upload(ctx, clientSideEncryptionMetadataName(name), bytes.NewReader(metadata)); err != nil {
+		return errors.Wrapf(err, "upload the client-side encryption metadata of %s", name)
+	}
+
+	return b.bucket.Upload(ctx, name, enc)
+}
+
+// Delete implements objstore.Bucket. The client-side encryption metadata of the object is deleted
+// after the object, so that the object is never read without it.
+func (b *ClientSideEncryptionBucketClient) Delete(ctx context.Context, name string) error {
+	b.invalidateCipher(name)
+
+	if err := b.bucket.Delete(ctx, name); err != nil || !isClientSideEncryptedObject(name) {
+		return err
+	}
+
+	if err := b.bucket.Delete(ctx, clientSideEncryptionMetadataName(name)); err != nil && !b.bucket.IsObjNotFoundErr(err) {
+		return errors.Wrapf(err, "delete the client-side encryption metadata of %s", name)
+	}
+	return nil
+}
+
+// Name implements objstore.Bucket.
+func (b *ClientSideEncryptionBucketClient) Name() string {
+	return b.bucket.Name()
+}
+
+// Close implements objstore.Bucket.
+func (b *ClientSideEncryptionBucketClient) Close() error {
+	return b.bucket.Close()
+}
+
+// Iter implements objstore.Bucket.
+func (b *ClientSideEncryptionBucketClient) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.bucket.Iter(ctx, dir, f, options...)
+}
+
+// Get implements objstore.Bucket.
+func (b *ClientSideEncryptionBucketClient) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	c, err := b.getCipher(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := b.bucket.Get(ctx, name)
+	if err != nil || c == nil {
+		return rc, err
+	}
+
+	return readCloser{Reader: newDecryptingReader(rc, c, 0, 0, -1, true), Closer: rc}, nil
+}
+
+// GetRange implements objstore.Bucket.
+func (b *ClientSideEncryptionBucketClient) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	c, err := b.getCipher(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return b.bucket.GetRange(ctx, name, off, length)
+	}
+
+	if length == 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	segmentSize := int64(c.segmentSize)
+	firstSegment := off / segmentSize
+	encryptedOff := firstSegment * (segmentSize + clientSideEncryptionTagSize)
+	encryptedLength := int64(-1)
+	if length > 0 {
+		lastSegment := (off + length - 1) / segmentSize
+		encryptedLength = (lastSegment - firstSegment + 1) * (segmentSize + clientSideEncryptionTagSize)
+	}
+
+	rc, err := b.bucket.GetRange(ctx, name, encryptedOff, encryptedLength)
+	if err != nil {
+		return nil, err
+	}
+
+	// The range is read up to the end of the object only if the length is not set.
+	return readCloser{Reader: newDecryptingReader(rc, c, uint32(firstSegment), off-firstSegment*segmentSize, length, length < 0), Closer: rc}, nil
+}
+
+// Exists implements objstore.Bucket.
+func (b *ClientSideEncryptionBucketClient) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bucket.Exists(ctx, name)
+}
+
+// IsObjNotFoundErr implements objstore.Bucket.
+func (b *ClientSideEncryptionBucketClient) IsObjNotFoundErr(err error) bool {
+	return b.bucket.IsObjNotFoundErr(errors.Cause(err))
+}
+
+// Attributes implements objstore.Bucket. The size of the encrypted objects is the size of their
+// decrypted content.
+func (b *ClientSideEncryptionBucketClient) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	c, err := b.getCipher(ctx, name)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+
+	attrs, err := b.bucket.Attributes(ctx, name)
+	if err != nil || c == nil {
+		return attrs, err
+	}
+
+	encryptedSegmentSize := int64(c.segmentSize + clientSideEncryptionTagSize)
+	numSegments := (attrs.Size + encryptedSegmentSize - 1) / encryptedSegmentSize
+	attrs.Size = attrs.Size - numSegments*clientSideEncryptionTagSize
+
+	return attrs, nil
+}
+
+// ReaderWithExpectedErrs implements objstore.Bucket.
+func (b *ClientSideEncryptionBucketClient) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.Bucket.
+func (b *ClientSideEncryptionBucketClient) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := b.bucket.(objstore.InstrumentedBucket); ok {
+		return &ClientSideEncryptionBucketClient{
+			bucket:  ib.WithExpectedErrs(fn),
+			keys:    b.keys,
+			ciphers: b.ciphers,
+		}
+	}
+
+	return b
+}
+
+// getCipher returns the cipher decrypting the object, or nil if the object is not encrypted
+// client-side.
+func (b *ClientSideEncryptionBucketClient) getCipher(ctx context.Context, name string) (*clientSideEncryptionCipher, error) {
+	if b.keys == nil || !isClientSideEncryptedObject(name) {
+		return nil, nil
+	}
+
+	b.ciphersMx.Lock()
+	cached, ok := b.ciphers.Get(name)
+	b.ciphersMx.Unlock()
+	if ok {
+		return cached.(*clientSideEncryptionCipher), nil
+	}
+
+	c, err := b.readMetadata(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read the client-side encryption metadata of %s", name)
+	}
+
+	// The blocks index and chunks are immutable, so their cipher can be cached. The unencrypted
+	// objects are cached too, to not look up their metadata again.
+	b.ciphersMx.Lock()
+	b.ciphers.Add(name, c)
+	b.ciphersMx.Unlock()
+
+	return c, nil
+}
+
+func (b *ClientSideEncryptionBucketClient) invalidateCipher(name string) {
+	b.ciphersMx.Lock()
+	b.ciphers.Remove(name)
+	b.ciphersMx.Unlock()
+}
+
+// readMetadata reads the client-side encryption metadata of the object and decrypts its data key.
+// If the object is not encrypted, it returns a nil cipher.
+func (b *ClientSideEncryptionBucketClient) readMetadata(ctx context.Context, name string) (*clientSideEncryptionCipher, error) {
+	rc, err := b.bucket.Get(ctx, clientSideEncryptionMetadataName(name))
+	if b.bucket.IsObjNotFoundErr(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close() //nolint:errcheck
+
+	var metadata clientSideEncryptionMetadata
+	if err := json.NewDecoder(rc).Decode(&metadata); err != nil {
+		return nil, errors.Wrap(errInvalidClientSideEncryptionMetadata, err.Error())
+	}
+	if metadata.Version != clientSideEncryptionVersion || metadata.SegmentSize <= 0 || len(metadata.NoncePrefix) != clientSideEncryptionNoncePrefixLen {
+		return nil, errInvalidClientSideEncryptionMetadata
+	}
+
+	plaintextKey, err := b.keys.DecryptDataKey(ctx, metadata.KeyID, metadata.EncryptedDataKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decrypt the data key with the key %s", metadata.KeyID)
+	}
+	aead, err := newAESGCM(plaintextKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientSideEncryptionCipher{
+		segmentSize: metadata.SegmentSize,
+		noncePrefix: metadata.NoncePrefix,
+		aead:        aead,
+	}, nil
+}
+
+// clientSideEncryptionMetadata is the content of the metadata object of an encrypted object.
+type clientSideEncryptionMetadata struct {
+	Version          int    `json:"version"`
+	KeyID            string `json:"key_id"`
+	EncryptedDataKey []byte `json:"encrypted_data_key"`
+	NoncePrefix      []byte `json:"nonce_prefix"`
+	SegmentSize      int    `json:"segment_size"`
+}
+
+type clientSideEncryptionCipher struct {
+	segmentSize int
+	noncePrefix []byte
+	aead        cipher.AEAD
+}
+
+// isClientSideEncryptedObject returns whether the object is a block index or chunks segment file,
+// which are the only objects encrypted client-side.
+func isClientSideEncryptedObject(name string) bool {
+	_, ok := clientSideEncryptedObjectBlockDirLen(name)
+	return ok
+}
+
+// clientSideEncryptionMetadataName returns the name of the metadata object of an object encrypted
+// client-side.
+func clientSideEncryptionMetadataName(name string) string {
+	blockDirLen, _ := clientSideEncryptedObjectBlockDirLen(name)
+	return name[:blockDirLen] + clientSideEncryptionMetadataDir + "/" + name[blockDirLen:] + ".json"
+}
+
+// clientSideEncryptedObjectBlockDirLen returns the length of the block directory prefix of the
+// object name, including the trailing slash, and whether the object is encrypted client-side.
+func clientSideEncryptedObjectBlockDirLen(name string) (int, bool) {
+	parts := strings.Split(name, "/")
+
+	var blockIDIndex int
+	switch {
+	case len(parts) >= 2 && parts[len(parts)-1] == "index":
+		blockIDIndex = len(parts) - 2
+	case len(parts) >= 3 && parts[len(parts)-2] == "chunks":
+		blockIDIndex = len(parts) - 3
+	default:
+		return 0, false
+	}
+	if !isBlockID(parts[blockIDIndex]) {
+		return 0, false
+	}
+
+	return len(strings.Join(parts[:blockIDIndex+1], "/")) + 1, true
+}
+
+func isBlockID(s string) bool {
+	_, err := ulid.Parse(s)
+	return err == nil
+}
+
+func segmentNonce(noncePrefix []byte, index uint32) []byte {
+	return appendUint32(append(make([]byte, 0, len(noncePrefix)+4), noncePrefix...), index)
+}
+
+func segmentAdditionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// encryptingReader reads the encrypted segments of the content of the underlying reader.
+type encryptingReader struct {
+	r           io.Reader
+	aead        cipher.AEAD
+	noncePrefix []byte
+	size        int64
+
+	// The segment being read, followed by the first byte of the next one if any.
+	plaintext []byte
+	buffered  int
+	index     uint32
+	done      bool
+
+	// The encrypted data not read yet.
+	sealed  []byte
+	pending []byte
+}
+
+func newEncryptingReader(r io.Reader, plaintextKey, noncePrefix []byte) (*encryptingReader, error) {
+	aead, err := newAESGCM(plaintextKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// The size of the encrypted object is known if the size of the content is. The content
+	// is made of at least one segment, even if empty.
+	size := int64(-1)
+	if plaintextSize, err := objstore.TryToGetSize(r); err == nil {
+		numSegments := (plaintextSize + clientSideEncryptionSegmentSize - 1) / clientSideEncryptionSegmentSize
+		if numSegments == 0 {
+			numSegments = 1
+		}
+		size = plaintextSize + numSegments*clientSideEncryptionTagSize
+	}
+
+	return &encryptingReader{
+		r:           r,
+		aead:        aead,
+		noncePrefix: noncePrefix,
+		size:        size,
+		plaintext:   make([]byte, clientSideEncryptionSegmentSize+1),
+	}, nil
+}
+
+// ObjectSize implements objstore.ObjectSizer.
+func (r *encryptingReader) ObjectSize() (int64, error) {
+	if r.size < 0 {
+		return 0, errors.New("the size of the content to encrypt is unknown")
+	}
+	return r.size, nil
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.encryptNextSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *encryptingReader) encryptNextSegment() error {
+	n, err := io.ReadFull(r.r, r.plaintext[r.buffered:])
+	r.buffered += n
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// The segment is the last one if the content ended before the first byte of the next one.
+	last := r.buffered <= clientSideEncryptionSegmentSize
+	segmentLen := r.buffered
+	if !last {
+		segmentLen = clientSideEncryptionSegmentSize
+	}
+
+	r.sealed = r.aead.Seal(r.sealed[:0], segmentNonce(r.noncePrefix, r.index), r.plaintext[:segmentLen], segmentAdditionalData(last))
+	r.pending = r.sealed
+	r.index++
+
+	if last {
+		r.done = true
+		r.buffered = 0
+	} else {
+		// Keep the first byte of the next segment.
+		r.plaintext[0] = r.plaintext[clientSideEncryptionSegmentSize]
+		r.buffered = 1
+	}
+
+	return nil
+}
+
+// decryptingReader reads the decrypted content of the encrypted segments read from the underlying
+// reader, starting from the segment with the input index.
+type decryptingReader struct {
+	r      io.Reader
+	cipher *clientSideEncryptionCipher
+
+	// The segment being read, followed by the first byte of the next one if any.
+	encrypted []byte
+	buffered  int
+	index     uint32
+	done      bool
+
+	// Whether the underlying reader reads up to the end of the object, so that the last segment
+	// read must be the last one of the object.
+	toEnd bool
+
+	// The number of bytes to skip from the beginning of the first segment, and the number of
+	// bytes left to read, or -1 if unlimited.
+	skip      int64
+	remaining int64
+
+	// The decrypted data not read yet.
+	opened  []byte
+	pending []byte
+}
+
+func newDecryptingReader(r io.Reader, c *clientSideEncryptionCipher, index uint32, skip, length int64, toEnd bool) *decryptingReader {
+	return &decryptingReader{
+		r:         r,
+		cipher:    c,
+		encrypted: make([]byte, c.segmentSize+clientSideEncryptionTagSize+1),
+		index:     index,
+		toEnd:     toEnd,
+		skip:      skip,
+		remaining: length,
+	}
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.decryptNextSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.remaining >= 0 && int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	if r.remaining > 0 {
+		r.remaining -= int64(n)
+	}
+	return n, nil
+}
+
+func (r *decryptingReader) decryptNextSegment() error {
+	encryptedSegmentSize := r.cipher.segmentSize + clientSideEncryptionTagSize
+
+	n, err := io.ReadFull(r.r, r.encrypted[r.buffered:])
+	r.buffered += n
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	if r.buffered == 0 {
+		// The range is beyond the end of the object.
+		if r.toEnd {
+			return errTruncatedEncryptedObject
+		}
+		r.done = true
+		return nil
+	}
+
+	segmentLen := r.buffered
+	if segmentLen > encryptedSegmentSize {
+		segmentLen = encryptedSegmentSize
+	}
+	ended := r.buffered <= encryptedSegmentSize
+
+	var (
+		plaintext []byte
+		openErr   error
+	)
+
+	nonce := segmentNonce(r.cipher.noncePrefix, r.index)
+	switch {
+	case !ended:
+		plaintext, openErr = r.cipher.aead.Open(r.opened[:0], nonce, r.encrypted[:segmentLen], segmentAdditionalData(false))
+	case r.toEnd || segmentLen < encryptedSegmentSize:
+		plaintext, openErr = r.cipher.aead.Open(r.opened[:0], nonce, r.encrypted[:segmentLen], segmentAdditionalData(true))
+	default:
+		// The range ended on a full segment, which may or may not be the last one of the object.
+		plaintext, openErr = r.cipher.aead.Open(r.opened[:0], nonce, r.encrypted[:segmentLen], segmentAdditionalData(false))
+		if openErr != nil {
+			plaintext, openErr = r.cipher.aead.Open(r.opened[:0], nonce, r.encrypted[:segmentLen], segmentAdditionalData(true))
+		}
+	}
+	if openErr != nil {
+		if ended && r.toEnd {
+			return errTruncatedEncryptedObject
+		}
+		return errors.Wrap(openErr, "decrypt the client-side encrypted object")
+	}
+
+	r.opened = plaintext
+	r.pending = plaintext
+	r.index++
+
+	if ended {
+		r.done = true
+		r.buffered = 0
+	} else {
+		// Keep the first byte of the next segment.
+		r.encrypted[0] = r.encrypted[encryptedSegmentSize]
+		r.buffered = 1
+	}
+
+	if r.skip > 0 {
+		skip := r.skip
+		if skip > int64(len(r.pending)) {
+			skip = int64(len(r.pending))
+		}
+		r.pending = r.pending[skip:]
+		r.skip -= skip
+	}
+
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
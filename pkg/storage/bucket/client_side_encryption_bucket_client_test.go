@@ -0,0 +1,312 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+const (
+	testBlockID = "01FGTZ6ZQHCAM0GT4VRWS8V1ZH"
+)
+
+func TestClientSideEncryptionBucketClient_ShouldEncryptAndDecryptTheBlocksData(t *testing.T) {
+	sizes := []int{
+		0,
+		1,
+		clientSideEncryptionSegmentSize - 1,
+		clientSideEncryptionSegmentSize,
+		clientSideEncryptionSegmentSize + 1,
+		3*clientSideEncryptionSegmentSize + 123,
+	}
+
+	for _, size := range sizes {
+		for _, name := range []string{testBlockID + "/index", "user-1/" + testBlockID + "/chunks/000001"} {
+			t.Run(fmt.Sprintf("object: %s, size: %d", name, size), func(t *testing.T) {
+				ctx := ContextWithClientSideEncryptionKeyID(context.Background(), "key-1")
+				raw := objstore.NewInMemBucket()
+				bkt := NewClientSideEncryptionBucketClient(raw, newTestKeyring(t, "key-1"))
+
+				content := make([]byte, size)
+				_, err := rand.Read(content)
+				require.NoError(t, err)
+				require.NoError(t, bkt.Upload(ctx, name, bytes.NewReader(content)))
+
+				// The object stored in the bucket should be encrypted, and its key ID stored in
+				// the metadata object.
+				stored := readObject(t, raw, name)
+				metadata := readClientSideEncryptionMetadata(t, raw, name)
+				assert.Equal(t, "key-1", metadata.KeyID)
+				assert.Len(t, metadata.NoncePrefix, clientSideEncryptionNoncePrefixLen)
+				if size > 16 {
+					assert.False(t, bytes.Contains(stored, content))
+				}
+
+				// The size of the encrypted object should have been computed in advance.
+				rawSize, err := objstore.TryToGetSize(mustNewEncryptingReader(t, bytes.NewReader(content)))
+				require.NoError(t, err)
+				assert.Equal(t, int64(len(stored)), rawSize)
+
+				assert.Equal(t, content, readObject(t, bkt, name))
+
+				attrs, err := bkt.Attributes(ctx, name)
+				require.NoError(t, err)
+				assert.Equal(t, int64(size), attrs.Size)
+
+				ranges := [][2]int64{
+					{0, -1},
+					{0, int64(size)},
+					{0, 1},
+					{int64(size / 2), -1},
+					{int64(size / 2), 10},
+					{clientSideEncryptionSegmentSize - 5, 10},
+					{clientSideEncryptionSegmentSize, clientSideEncryptionSegmentSize},
+					{int64(size) - 1, 1},
+					{int64(size) - 1, 100},
+				}
+
+				for _, r := range ranges {
+					off, length := r[0], r[1]
+					if off < 0 || off >= int64(size) {
+						continue
+					}
+
+					expected := content[off:]
+					if length >= 0 && off+length < int64(size) {
+						expected = content[off : off+length]
+					}
+
+					rc, err := bkt.GetRange(ctx, name, off, length)
+					require.NoError(t, err)
+					actual, err := ioutil.ReadAll(rc)
+					require.NoError(t, rc.Close())
+					require.NoError(t, err, "offset: %d, length: %d", off, length)
+					assert.Equal(t, expected, actual, "offset: %d, length: %d", off, length)
+				}
+			})
+		}
+	}
+}
+
+func TestClientSideEncryptionBucketClient_ShouldNotEncryptTheObjectsUsedForTheDiscovery(t *testing.T) {
+	ctx := ContextWithClientSideEncryptionKeyID(context.Background(), "key-1")
+	raw := objstore.NewInMemBucket()
+	bkt := NewClientSideEncryptionBucketClient(raw, newTestKeyring(t, "key-1"))
+
+	for _, name := range []string{
+		testBlockID + "/meta.json",
+		testBlockID + "/deletion-mark.json",
+		"bucket-index.json.gz",
+		"not-a-block/index",
+		"not-a-block/chunks/000001",
+	} {
+		require.NoError(t, bkt.Upload(ctx, name, bytes.NewReader([]byte("content"))))
+		assert.Equal(t, []byte("content"), readObject(t, raw, name), name)
+		assert.Equal(t, []byte("content"), readObject(t, bkt, name), name)
+	}
+}
+
+func TestClientSideEncryptionBucketClient_ShouldReadTheUnencryptedObjects(t *testing.T) {
+	raw := objstore.NewInMemBucket()
+	bkt := NewClientSideEncryptionBucketClient(raw, newTestKeyring(t, "key-1"))
+
+	// Objects uploaded without client-side encryption.
+	for _, content := range []string{"", "ab", "some unencrypted content"} {
+		name := testBlockID + "/chunks/000001"
+		require.NoError(t, raw.Upload(context.Background(), name, bytes.NewReader([]byte(content))))
+		bkt.invalidateCipher(name)
+
+		assert.Equal(t, []byte(content), readObject(t, bkt, name))
+
+		attrs, err := bkt.Attributes(context.Background(), name)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), attrs.Size)
+
+		if len(content) > 2 {
+			rc, err := bkt.GetRange(context.Background(), name, 1, 2)
+			require.NoError(t, err)
+			actual, err := ioutil.ReadAll(rc)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(content[1:3]), actual)
+		}
+	}
+}
+
+func TestClientSideEncryptionBucketClient_ShouldSupportTheKeyRotation(t *testing.T) {
+	raw := objstore.NewInMemBucket()
+	bkt := NewClientSideEncryptionBucketClient(raw, newTestKeyring(t, "key-1", "key-2"))
+
+	oldName := "user-1/" + testBlockID + "/index"
+	newName := "user-1/01FGV0G0A1JN9K5H0QNY0SXPE4/index"
+	require.NoError(t, bkt.Upload(ContextWithClientSideEncryptionKeyID(context.Background(), "key-1"), oldName, bytes.NewReader([]byte("old"))))
+	require.NoError(t, bkt.Upload(ContextWithClientSideEncryptionKeyID(context.Background(), "key-2"), newName, bytes.NewReader([]byte("new"))))
+
+	assert.Equal(t, []byte("old"), readObject(t, bkt, oldName))
+	assert.Equal(t, []byte("new"), readObject(t, bkt, newName))
+
+	// The objects encrypted with a key not available anymore can't be read.
+	withoutOldKey := NewClientSideEncryptionBucketClient(raw, newTestKeyring(t, "key-2"))
+	_, err := withoutOldKey.Get(context.Background(), oldName)
+	require.Error(t, err)
+	assert.Equal(t, []byte("new"), readObject(t, withoutOldKey, newName))
+}
+
+func TestClientSideEncryptionBucketClient_ShouldFailReadingATamperedObject(t *testing.T) {
+	ctx := ContextWithClientSideEncryptionKeyID(context.Background(), "key-1")
+	name := testBlockID + "/index"
+	content := make([]byte, 2*clientSideEncryptionSegmentSize)
+
+	tests := map[string]func(stored []byte) []byte{
+		"truncated to a segment boundary": func(stored []byte) []byte {
+			return stored[:len(stored)-clientSideEncryptionSegmentSize-clientSideEncryptionTagSize]
+		},
+		"truncated within a segment": func(stored []byte) []byte {
+			return stored[:len(stored)-10]
+		},
+		"modified": func(stored []byte) []byte {
+			stored[len(stored)-100] ^= 1
+			return stored
+		},
+	}
+
+	for testName, tamper := range tests {
+		t.Run(testName, func(t *testing.T) {
+			raw := objstore.NewInMemBucket()
+			bkt := NewClientSideEncryptionBucketClient(raw, newTestKeyring(t, "key-1"))
+			require.NoError(t, bkt.Upload(ctx, name, bytes.NewReader(content)))
+			require.NoError(t, raw.Upload(ctx, name, bytes.NewReader(tamper(readObject(t, raw, name)))))
+
+			rc, err := bkt.Get(ctx, name)
+			require.NoError(t, err)
+			_, err = ioutil.ReadAll(rc)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestClientSideEncryptionBucketClient_ShouldDeleteTheMetadataWithTheObject(t *testing.T) {
+	ctx := ContextWithClientSideEncryptionKeyID(context.Background(), "key-1")
+	raw := objstore.NewInMemBucket()
+	bkt := NewClientSideEncryptionBucketClient(raw, newTestKeyring(t, "key-1"))
+
+	name := "user-1/" + testBlockID + "/chunks/000001"
+	require.NoError(t, bkt.Upload(ctx, name, bytes.NewReader([]byte("content"))))
+	assert.Len(t, raw.Objects(), 2)
+	assert.Contains(t, raw.Objects(), "user-1/"+testBlockID+"/client-side-encryption/chunks/000001.json")
+
+	require.NoError(t, bkt.Delete(ctx, name))
+	assert.Empty(t, raw.Objects())
+}
+
+func TestClientSideEncryptionBucketClient_ShouldFailUploadingWithoutDataKeyProvider(t *testing.T) {
+	ctx := ContextWithClientSideEncryptionKeyID(context.Background(), "key-1")
+	bkt := NewClientSideEncryptionBucketClient(objstore.NewInMemBucket(), nil)
+
+	assert.Equal(t, errClientSideEncryptionNotConfigured, bkt.Upload(ctx, testBlockID+"/index", bytes.NewReader([]byte("content"))))
+	assert.NoError(t, bkt.Upload(ctx, testBlockID+"/meta.json", bytes.NewReader([]byte("content"))))
+	assert.NoError(t, bkt.Upload(context.Background(), testBlockID+"/index", bytes.NewReader([]byte("content"))))
+}
+
+func TestUserBucketClient_ShouldEncryptTheBlocksDataOfTheTenantsWithClientSideEncryption(t *testing.T) {
+	raw := objstore.NewInMemBucket()
+	bkt := NewClientSideEncryptionBucketClient(raw, newTestKeyring(t, "key-1"))
+
+	encrypted := NewUserBucketClient("user-1", bkt, &mockTenantConfigProvider{clientSideKeyID: "key-1"})
+	unencrypted := NewUserBucketClient("user-2", bkt, &mockTenantConfigProvider{})
+
+	require.NoError(t, encrypted.Upload(context.Background(), testBlockID+"/index", bytes.NewReader([]byte("content"))))
+	require.NoError(t, unencrypted.Upload(context.Background(), testBlockID+"/index", bytes.NewReader([]byte("content"))))
+
+	assert.Equal(t, "key-1", readClientSideEncryptionMetadata(t, raw, "user-1/"+testBlockID+"/index").KeyID)
+	assert.NotEqual(t, []byte("content"), readObject(t, raw, "user-1/"+testBlockID+"/index"))
+	assert.Equal(t, []byte("content"), readObject(t, raw, "user-2/"+testBlockID+"/index"))
+
+	exists, err := raw.Exists(context.Background(), "user-2/"+testBlockID+"/"+clientSideEncryptionMetadataDir+"/index.json")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.Equal(t, []byte("content"), readObject(t, encrypted, testBlockID+"/index"))
+	assert.Equal(t, []byte("content"), readObject(t, unencrypted, testBlockID+"/index"))
+}
+
+func TestNewKeyringDataKeyProviderFromFile(t *testing.T) {
+	key := make([]byte, clientSideEncryptionKeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir(os.TempDir(), "keyring")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint:errcheck
+
+	path := filepath.Join(dir, "keyring.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("keys:\n  key-1: "+base64.StdEncoding.EncodeToString(key)+"\n"), os.ModePerm))
+
+	keys, err := NewKeyringDataKeyProviderFromFile(path)
+	require.NoError(t, err)
+
+	plaintext, encrypted, err := keys.GenerateDataKey(context.Background(), "key-1")
+	require.NoError(t, err)
+	assert.Len(t, plaintext, clientSideEncryptionKeySize)
+	assert.NotEqual(t, plaintext, encrypted)
+
+	decrypted, err := keys.DecryptDataKey(context.Background(), "key-1", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	_, _, err = keys.GenerateDataKey(context.Background(), "unknown")
+	assert.Error(t, err)
+
+	// A key with an invalid size should be rejected.
+	require.NoError(t, ioutil.WriteFile(path, []byte("keys:\n  key-1: "+base64.StdEncoding.EncodeToString(key[:16])+"\n"), os.ModePerm))
+	_, err = NewKeyringDataKeyProviderFromFile(path)
+	assert.Error(t, err)
+}
+
+func newTestKeyring(t *testing.T, keyIDs ...string) *KeyringDataKeyProvider {
+	keys := map[string][]byte{}
+	for _, keyID := range keyIDs {
+		// Use deterministic keys, so that different keyrings share the same master keys.
+		key := bytes.Repeat([]byte(keyID[len(keyID)-1:]), clientSideEncryptionKeySize)
+		keys[keyID] = key
+	}
+
+	keyring, err := NewKeyringDataKeyProvider(keys)
+	require.NoError(t, err)
+	return keyring
+}
+
+func mustNewEncryptingReader(t *testing.T, r *bytes.Reader) *encryptingReader {
+	plaintextKey, _, err := newTestKeyring(t, "key-1").GenerateDataKey(context.Background(), "key-1")
+	require.NoError(t, err)
+
+	enc, err := newEncryptingReader(r, plaintextKey, make([]byte, clientSideEncryptionNoncePrefixLen))
+	require.NoError(t, err)
+	return enc
+}
+
+func readClientSideEncryptionMetadata(t *testing.T, bkt objstore.BucketReader, name string) clientSideEncryptionMetadata {
+	var metadata clientSideEncryptionMetadata
+	require.NoError(t, json.Unmarshal(readObject(t, bkt, clientSideEncryptionMetadataName(name)), &metadata))
+	return metadata
+}
+
+func readObject(t *testing.T, bkt objstore.BucketReader, name string) []byte {
+	rc, err := bkt.Get(context.Background(), name)
+	require.NoError(t, err)
+	defer rc.Close() //nolint:errcheck
+
+	content, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	return content
+}
@@ -22,10 +22,13 @@ type TenantConfigProvider interface {
 
 	// S3SSEKMSEncryptionContext returns the per-tenant S3 KMS-SSE key id or an empty string if not set.
 	S3SSEKMSEncryptionContext(userID string) string
+
+	// ClientSideEncryptionKeyID returns the per-tenant client-side encryption key ID or an empty string if not set.
+	ClientSideEncryptionKeyID(userID string) string
 }
 
 // SSEBucketClient is a wrapper around a objstore.BucketReader that configures the object
-// storage server-side encryption (SSE) for a given user.
+// storage server-side encryption (SSE) and the client-side encryption for a given user.
 type SSEBucketClient struct {
 	userID      string
 	bucket      objstore.Bucket
@@ -56,6 +59,14 @@ func (b *SSEBucketClient) Upload(ctx context.Context, name string, r io.Reader)
 		ctx = s3.ContextWithSSEConfig(ctx, sse)
 	}
 
+	// The client-side encryption is applied by the ClientSideEncryptionBucketClient wrapping
+	// the underlying bucket client.
+	if b.cfgProvider != nil {
+		if keyID := b.cfgProvider.ClientSideEncryptionKeyID(b.userID); keyID != "" {
+			ctx = ContextWithClientSideEncryptionKeyID(ctx, keyID)
+		}
+	}
+
 	return b.bucket.Upload(ctx, name, r)
 }
 
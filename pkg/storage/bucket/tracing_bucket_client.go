@@ -0,0 +1,315 @@
+package bucket
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/uber/jaeger-client-go"
+
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+)
+
+const (
+	opIter       = "iter"
+	opGet        = "get"
+	opGetRange   = "get_range"
+	opExists     = "exists"
+	opAttributes = "attributes"
+	opUpload     = "upload"
+	opDelete     = "delete"
+
+	// redactedTenant replaces the tenant ID in the object keys, when the redaction is enabled.
+	redactedTenant = "<tenant>"
+)
+
+// TracingBucketClient is a wrapper around a objstore.Bucket which traces each request in a span
+// carrying the operation, the object key, the range and the number of bytes read or written, and
+// logs the requests slower than a threshold. The requests are neither traced nor timed if the
+// trace of the request is not sampled and the slow requests logging is disabled.
+type TracingBucketClient struct {
+	bucket             objstore.Bucket
+	slowRequestsThresh time.Duration
+	redactTenant       bool
+	logger             log.Logger
+}
+
+// NewTracingBucketClient makes a new TracingBucketClient. The slow requests are not logged if
+// slowRequestsThresh is 0. If redactTenant is true, the first segment of the object keys, which
+// is the tenant ID in the blocks storage, is redacted from the spans and logs.
+func NewTracingBucketClient(bucket objstore.Bucket, slowRequestsThresh time.Duration, redactTenant bool, logger log.Logger) *TracingBucketClient {
+	return &TracingBucketClient{
+		bucket:             bucket,
+		slowRequestsThresh: slowRequestsThresh,
+		redactTenant:       redactTenant,
+		logger:             logger,
+	}
+}
+
+// Close implements objstore.Bucket.
+func (b *TracingBucketClient) Close() error {
+	return b.bucket.Close()
+}
+
+// Name implements objstore.Bucket.
+func (b *TracingBucketClient) Name() string {
+	return b.bucket.Name()
+}
+
+// IsObjNotFoundErr implements objstore.Bucket.
+func (b *TracingBucketClient) IsObjNotFoundErr(err error) bool {
+	return b.bucket.IsObjNotFoundErr(err)
+}
+
+// Iter implements objstore.Bucket.
+func (b *TracingBucketClient) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	ctx, req := b.startRequest(ctx, opIter, dir)
+	if req == nil {
+		return b.bucket.Iter(ctx, dir, f, options...)
+	}
+
+	err := b.bucket.Iter(ctx, dir, f, options...)
+	req.finish(ctx, err)
+	return err
+}
+
+// Get implements objstore.Bucket.
+func (b *TracingBucketClient) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	ctx, req := b.startRequest(ctx, opGet, name)
+	if req == nil {
+		return b.bucket.Get(ctx, name)
+	}
+
+	rc, err := b.bucket.Get(ctx, name)
+	if err != nil {
+		req.finish(ctx, err)
+		return nil, err
+	}
+	return &tracingReadCloser{ReadCloser: rc, ctx: ctx, req: req}, nil
+}
+
+// GetRange implements objstore.Bucket.
+func (b *TracingBucketClient) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	ctx, req := b.startRequest(ctx, opGetRange, name)
+	if req == nil {
+		return b.bucket.GetRange(ctx, name, off, length)
+	}
+
+	req.setRange(off, length)
+
+	rc, err := b.bucket.GetRange(ctx, name, off, length)
+	if err != nil {
+		req.finish(ctx, err)
+		return nil, err
+	}
+	return &tracingReadCloser{ReadCloser: rc, ctx: ctx, req: req}, nil
+}
+
+// Exists implements objstore.Bucket.
+func (b *TracingBucketClient) Exists(ctx context.Context, name string) (bool, error) {
+	ctx, req := b.startRequest(ctx, opExists, name)
+	if req == nil {
+		return b.bucket.Exists(ctx, name)
+	}
+
+	exists, err := b.bucket.Exists(ctx, name)
+	req.finish(ctx, err)
+	return exists, err
+}
+
+// Attributes implements objstore.Bucket.
+func (b *TracingBucketClient) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	ctx, req := b.startRequest(ctx, opAttributes, name)
+	if req == nil {
+		return b.bucket.Attributes(ctx, name)
+	}
+
+	attrs, err := b.bucket.Attributes(ctx, name)
+	req.finish(ctx, err)
+	return attrs, err
+}
+
+// Upload implements objstore.Bucket.
+func (b *TracingBucketClient) Upload(ctx context.Context, name string, r io.Reader) error {
+	ctx, req := b.startRequest(ctx, opUpload, name)
+	if req == nil {
+		return b.bucket.Upload(ctx, name, r)
+	}
+
+	// The reader is not wrapped, to not hide its size from the underlying client.
+	if size, err := objstore.TryToGetSize(r); err == nil {
+		req.bytes = size
+	}
+
+	err := b.bucket.Upload(ctx, name, r)
+	req.finish(ctx, err)
+	return err
+}
+
+// Delete implements objstore.Bucket.
+func (b *TracingBucketClient) Delete(ctx context.Context, name string) error {
+	ctx, req := b.startRequest(ctx, opDelete, name)
+	if req == nil {
+		return b.bucket.Delete(ctx, name)
+	}
+
+	err := b.bucket.Delete(ctx, name)
+	req.finish(ctx, err)
+	return err
+}
+
+// ReaderWithExpectedErrs implements objstore.Bucket.
+func (b *TracingBucketClient) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.Bucket.
+func (b *TracingBucketClient) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := b.bucket.(objstore.InstrumentedBucket); ok {
+		return NewTracingBucketClient(ib.WithExpectedErrs(fn), b.slowRequestsThresh, b.redactTenant, b.logger)
+	}
+
+	return b
+}
+
+// startRequest returns the request to trace and time, or nil if the trace is not sampled and the
+// slow requests logging is disabled.
+func (b *TracingBucketClient) startRequest(ctx context.Context, op, name string) (context.Context, *bucketRequest) {
+	parent := opentracing.SpanFromContext(ctx)
+	sampled := parent != nil && isSpanSampled(parent)
+	if !sampled && b.slowRequestsThresh <= 0 {
+		return ctx, nil
+	}
+
+	req := &bucketRequest{
+		client: b,
+		op:     op,
+		key:    b.objectKey(name),
+		start:  time.Now(),
+		offset: -1,
+		length: -1,
+	}
+
+	if sampled {
+		req.span, ctx = opentracing.StartSpanFromContextWithTracer(ctx, parent.Tracer(), "bucket_"+op)
+		req.span.SetTag("operation", op)
+		req.span.SetTag("object_key", req.key)
+	}
+
+	return ctx, req
+}
+
+// objectKey returns the object key to trace and log.
+func (b *TracingBucketClient) objectKey(name string) string {
+	if !b.redactTenant {
+		return name
+	}
+
+	if idx := strings.Index(name, objstore.DirDelim); idx >= 0 {
+		return redactedTenant + name[idx:]
+	}
+	return redactedTenant
+}
+
+// isSpanSampled returns whether the trace of the span is sampled. The spans of tracers other
+// than Jaeger are assumed to be sampled.
+func isSpanSampled(span opentracing.Span) bool {
+	if spanContext, ok := span.Context().(jaeger.SpanContext); ok {
+		return spanContext.IsSampled()
+	}
+	return true
+}
+
+// bucketRequest is a single request to the bucket, traced and timed.
+type bucketRequest struct {
+	client *TracingBucketClient
+	span   opentracing.Span
+	op     string
+	key    string
+	start  time.Time
+
+	// The range of GetRange requests, -1 if not set.
+	offset int64
+	length int64
+
+	// The number of bytes read or written.
+	bytes int64
+}
+
+func (r *bucketRequest) setRange(offset, length int64) {
+	r.offset = offset
+	r.length = length
+
+	if r.span != nil {
+		r.span.SetTag("offset", offset)
+		r.span.SetTag("length", length)
+	}
+}
+
+func (r *bucketRequest) finish(ctx context.Context, err error) {
+	duration := time.Since(r.start)
+
+	if r.span != nil {
+		r.span.SetTag("bytes", r.bytes)
+		if err != nil {
+			ext.Error.Set(r.span, true)
+			r.span.LogKV("err", err)
+		}
+		r.span.Finish()
+	}
+
+	if r.client.slowRequestsThresh <= 0 || duration < r.client.slowRequestsThresh {
+		return
+	}
+
+	logMessage := []interface{}{
+		"msg", "slow bucket request",
+		"operation", r.op,
+		"object_key", r.key,
+		"duration", duration,
+		"bytes", r.bytes,
+	}
+	if r.offset >= 0 {
+		logMessage = append(logMessage, "offset", r.offset, "length", r.length)
+	}
+	if err != nil {
+		logMessage = append(logMessage, "err", err)
+	}
+
+	level.Info(util_log.WithContext(ctx, r.client.logger)).Log(logMessage...)
+}
+
+// tracingReadCloser counts the bytes read from the object, and finishes the request once closed.
+type tracingReadCloser struct {
+	io.ReadCloser
+
+	ctx context.Context
+	req *bucketRequest
+	err error
+}
+
+func (t *tracingReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if t.req != nil {
+		t.req.bytes += int64(n)
+	}
+	if err != nil && err != io.EOF && t.err == nil {
+		t.err = err
+	}
+	return n, err
+}
+
+func (t *tracingReadCloser) Close() error {
+	err := t.ReadCloser.Close()
+	if t.req != nil {
+		t.req.finish(t.ctx, t.err)
+		t.req = nil
+	}
+	return err
+}
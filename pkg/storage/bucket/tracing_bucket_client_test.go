@@ -0,0 +1,120 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestTracingBucketClient_Spans(t *testing.T) {
+	for name, tt := range map[string]struct {
+		sampled      bool
+		redactTenant bool
+		expectedKey  string
+	}{
+		"sampled trace": {
+			sampled:     true,
+			expectedKey: "user-1/block/chunks/000001",
+		},
+		"sampled trace with the tenant redacted": {
+			sampled:      true,
+			redactTenant: true,
+			expectedKey:  "<tenant>/block/chunks/000001",
+		},
+		"not sampled trace": {
+			sampled: false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			reporter := jaeger.NewInMemoryReporter()
+			tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(tt.sampled), reporter)
+			defer closer.Close()
+
+			inner := objstore.NewInMemBucket()
+			require.NoError(t, inner.Upload(context.Background(), "user-1/block/chunks/000001", strings.NewReader("0123456789")))
+
+			bkt := NewTracingBucketClient(inner, 0, tt.redactTenant, log.NewNopLogger())
+
+			parent := tracer.StartSpan("parent")
+			ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+			rc, err := bkt.GetRange(ctx, "user-1/block/chunks/000001", 2, 5)
+			require.NoError(t, err)
+			data, err := ioutil.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			assert.Equal(t, "23456", string(data))
+
+			_, err = bkt.Exists(ctx, "user-1/block/chunks/000001")
+			require.NoError(t, err)
+
+			if !tt.sampled {
+				assert.Empty(t, reporter.GetSpans())
+				return
+			}
+
+			spans := reporter.GetSpans()
+			require.Len(t, spans, 2)
+
+			getRange := spans[0].(*jaeger.Span)
+			assert.Equal(t, "bucket_get_range", getRange.OperationName())
+			assert.Equal(t, opentracing.Tags{
+				"operation":  opGetRange,
+				"object_key": tt.expectedKey,
+				"offset":     int64(2),
+				"length":     int64(5),
+				"bytes":      int64(5),
+			}, getRange.Tags())
+			assert.Equal(t, parent.Context().(jaeger.SpanContext).TraceID(), getRange.SpanContext().TraceID())
+
+			exists := spans[1].(*jaeger.Span)
+			assert.Equal(t, "bucket_exists", exists.OperationName())
+			assert.Equal(t, tt.expectedKey, exists.Tags()["object_key"])
+		})
+	}
+}
+
+func TestTracingBucketClient_SlowRequestsLog(t *testing.T) {
+	inner := objstore.NewInMemBucket()
+	require.NoError(t, inner.Upload(context.Background(), "user-1/block/index", strings.NewReader("0123456789")))
+
+	t.Run("should log the requests slower than the threshold", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		bkt := NewTracingBucketClient(inner, time.Nanosecond, true, log.NewLogfmtLogger(buf))
+
+		rc, err := bkt.Get(context.Background(), "user-1/block/index")
+		require.NoError(t, err)
+		_, err = ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		_, err = bkt.Get(context.Background(), "user-1/block/missing")
+		require.Error(t, err)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+		assert.Contains(t, lines[0], `msg="slow bucket request" operation=get object_key=<tenant>/block/index`)
+		assert.Contains(t, lines[0], "bytes=10")
+		assert.Contains(t, lines[1], `msg="slow bucket request" operation=get object_key=<tenant>/block/missing`)
+		assert.Contains(t, lines[1], "err=")
+	})
+
+	t.Run("should not log the requests faster than the threshold", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		bkt := NewTracingBucketClient(inner, time.Hour, false, log.NewLogfmtLogger(buf))
+
+		_, err := bkt.Exists(context.Background(), "user-1/block/index")
+		require.NoError(t, err)
+		assert.Empty(t, buf.String())
+	})
+}
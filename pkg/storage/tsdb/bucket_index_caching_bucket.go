@@ -0,0 +1,181 @@
+package tsdb
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/thanos/pkg/cache"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+// BucketIndexCachingBucket is a wrapper around a objstore.Bucket caching the content of the bucket
+// index, keyed on its content hash. The cache maps the bucket index of each tenant to the hash of its
+// current content, and the content is cached under its hash. Uploading or deleting the bucket index
+// through this client replaces its hash in the cache, so that the content previously cached is not
+// served anymore, by any client sharing the cache, even if its TTL has not expired yet. The bucket
+// indexes updated by clients not sharing the cache are read again once the TTL has expired.
+type BucketIndexCachingBucket struct {
+	objstore.Bucket
+
+	cache   cache.Cache
+	ttl     time.Duration
+	maxSize int
+
+	requests      prometheus.Counter
+	hits          prometheus.Counter
+	invalidations prometheus.Counter
+}
+
+// NewBucketIndexCachingBucket makes a new BucketIndexCachingBucket. The bucket indexes larger than
+// maxSize are not cached.
+func NewBucketIndexCachingBucket(bkt objstore.Bucket, c cache.Cache, maxSize int, ttl time.Duration, reg prometheus.Registerer) *BucketIndexCachingBucket {
+	return &BucketIndexCachingBucket{
+		Bucket:  bkt,
+		cache:   c,
+		ttl:     ttl,
+		maxSize: maxSize,
+		requests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_index_cache_requests_total",
+			Help: "Total number of bucket index reads looked up in the metadata cache.",
+		}),
+		hits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_index_cache_hits_total",
+			Help: "Total number of bucket index reads served from the metadata cache.",
+		}),
+		invalidations: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_index_cache_invalidations_total",
+			Help: "Total number of times the content hash of a bucket index cached in the metadata cache has been replaced, because the bucket index has been uploaded, deleted or read with a different content.",
+		}),
+	}
+}
+
+// CreateBucketIndexCachingBucket wraps the bucket with a BucketIndexCachingBucket if the metadata cache
+// is configured, so that the bucket indexes uploaded through it invalidate the cached ones.
+func CreateBucketIndexCachingBucket(metadataConfig MetadataCacheConfig, bkt objstore.Bucket, logger log.Logger, reg prometheus.Registerer) (objstore.Bucket, error) {
+	metadataCache, err := createCache("metadata-cache", metadataConfig.Backend, metadataConfig.Memcached, logger, reg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "metadata-cache")
+	}
+	if metadataCache == nil {
+		return bkt, nil
+	}
+
+	return NewBucketIndexCachingBucket(bkt, cache.NewTracingCache(metadataCache), metadataConfig.BucketIndexMaxSize, metadataConfig.BucketIndexContentTTL, reg), nil
+}
+
+// Get implements objstore.Bucket.
+func (b *BucketIndexCachingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if !isBucketIndexFile(name) || b.ttl <= 0 {
+		return b.Bucket.Get(ctx, name)
+	}
+
+	b.requests.Inc()
+
+	hashKey := bucketIndexHashCacheKey(name)
+	cachedHash := b.cache.Fetch(ctx, []string{hashKey})[hashKey]
+	if len(cachedHash) > 0 {
+		contentKey := bucketIndexContentCacheKey(name, string(cachedHash))
+		if content, ok := b.cache.Fetch(ctx, []string{contentKey})[contentKey]; ok && bucketIndexContentHash(content) == string(cachedHash) {
+			b.hits.Inc()
+			return ioutil.NopCloser(bytes.NewReader(content)), nil
+		}
+	}
+
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close() //nolint:errcheck
+
+	content, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash := b.store(ctx, name, content); len(cachedHash) > 0 && hash != string(cachedHash) {
+		b.invalidations.Inc()
+	}
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+// Upload implements objstore.Bucket.
+func (b *BucketIndexCachingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if !isBucketIndexFile(name) || b.ttl <= 0 {
+		return b.Bucket.Upload(ctx, name, r)
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := b.Bucket.Upload(ctx, name, bytes.NewReader(content)); err != nil {
+		return err
+	}
+
+	b.store(ctx, name, content)
+	b.invalidations.Inc()
+	return nil
+}
+
+// Delete implements objstore.Bucket.
+func (b *BucketIndexCachingBucket) Delete(ctx context.Context, name string) error {
+	if err := b.Bucket.Delete(ctx, name); err != nil || !isBucketIndexFile(name) || b.ttl <= 0 {
+		return err
+	}
+
+	// An empty hash is never served from the cache.
+	b.cache.Store(ctx, map[string][]byte{bucketIndexHashCacheKey(name): {}}, b.ttl)
+	b.invalidations.Inc()
+	return nil
+}
+
+// ReaderWithExpectedErrs implements objstore.Bucket.
+func (b *BucketIndexCachingBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.BucketReader {
+	return b.WithExpectedErrs(fn)
+}
+
+// WithExpectedErrs implements objstore.Bucket.
+func (b *BucketIndexCachingBucket) WithExpectedErrs(fn objstore.IsOpFailureExpectedFunc) objstore.Bucket {
+	if ib, ok := b.Bucket.(objstore.InstrumentedBucket); ok {
+		res := *b
+		res.Bucket = ib.WithExpectedErrs(fn)
+		return &res
+	}
+
+	return b
+}
+
+// store caches the content of the bucket index under its hash, and returns the hash. The content
+// larger than the max size is not cached, but its hash still replaces the previous one.
+func (b *BucketIndexCachingBucket) store(ctx context.Context, name string, content []byte) string {
+	hash := bucketIndexContentHash(content)
+
+	data := map[string][]byte{bucketIndexHashCacheKey(name): []byte(hash)}
+	if b.maxSize <= 0 || len(content) <= b.maxSize {
+		data[bucketIndexContentCacheKey(name, hash)] = content
+	}
+
+	b.cache.Store(ctx, data, b.ttl)
+	return hash
+}
+
+func bucketIndexContentHash(content []byte) string {
+	return strconv.FormatUint(xxhash.Sum64(content), 16)
+}
+
+func bucketIndexHashCacheKey(name string) string {
+	return "bucket-index-hash:" + name
+}
+
+func bucketIndexContentCacheKey(name, hash string) string {
+	return "bucket-index-content:" + name + ":" + hash
+}
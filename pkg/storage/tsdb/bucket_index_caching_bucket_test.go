@@ -0,0 +1,137 @@
+package tsdb
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+)
+
+func TestBucketIndexCachingBucket_ShouldInvalidateTheCachedContentOnChange(t *testing.T) {
+	const name = "user-1/bucket-index.json.gz"
+
+	ctx := context.Background()
+	raw := objstore.NewInMemBucket()
+	c := newMockCache()
+
+	// The writer and the reader share the same cache, like the compactor and the queriers.
+	writer := NewBucketIndexCachingBucket(raw, c, 1024, time.Hour, nil)
+	reader := NewBucketIndexCachingBucket(raw, c, 1024, time.Hour, nil)
+
+	require.NoError(t, writer.Upload(ctx, name, bytes.NewReader([]byte("v1"))))
+	assert.Equal(t, "v1", readBucketIndex(t, reader, name))
+	assert.Equal(t, float64(1), testutil.ToFloat64(reader.hits))
+
+	// The bucket index updated without going through the cache is served from the cache until
+	// the TTL expires.
+	require.NoError(t, raw.Upload(ctx, name, bytes.NewReader([]byte("v2"))))
+	assert.Equal(t, "v1", readBucketIndex(t, reader, name))
+	assert.Equal(t, float64(2), testutil.ToFloat64(reader.hits))
+
+	// The bucket index uploaded through the cache changes the content hash, so the content
+	// previously cached is not served anymore.
+	require.NoError(t, writer.Upload(ctx, name, bytes.NewReader([]byte("v3"))))
+	assert.Equal(t, "v3", readBucketIndex(t, reader, name))
+	assert.Equal(t, float64(3), testutil.ToFloat64(reader.hits))
+	assert.Equal(t, float64(2), testutil.ToFloat64(writer.invalidations))
+
+	// The deleted bucket index is not served from the cache.
+	require.NoError(t, writer.Delete(ctx, name))
+	_, err := reader.Get(ctx, name)
+	assert.True(t, reader.IsObjNotFoundErr(err))
+	assert.Equal(t, float64(3), testutil.ToFloat64(reader.hits))
+	assert.Equal(t, float64(4), testutil.ToFloat64(reader.requests))
+}
+
+func TestBucketIndexCachingBucket_ShouldInvalidateTheCachedContentChangedInTheBucket(t *testing.T) {
+	const name = "user-1/bucket-index.json.gz"
+
+	ctx := context.Background()
+	raw := objstore.NewInMemBucket()
+	c := newMockCache()
+	bkt := NewBucketIndexCachingBucket(raw, c, 1024, time.Hour, nil)
+
+	require.NoError(t, raw.Upload(ctx, name, bytes.NewReader([]byte("v1"))))
+	assert.Equal(t, "v1", readBucketIndex(t, bkt, name))
+	assert.Equal(t, float64(0), testutil.ToFloat64(bkt.hits))
+
+	// Once the content has been evicted, the content read from the bucket replaces the cached hash.
+	require.NoError(t, raw.Upload(ctx, name, bytes.NewReader([]byte("v2"))))
+	c.delete(bucketIndexContentCacheKey(name, bucketIndexContentHash([]byte("v1"))))
+	assert.Equal(t, "v2", readBucketIndex(t, bkt, name))
+	assert.Equal(t, float64(1), testutil.ToFloat64(bkt.invalidations))
+
+	assert.Equal(t, "v2", readBucketIndex(t, bkt, name))
+	assert.Equal(t, float64(1), testutil.ToFloat64(bkt.hits))
+}
+
+func TestBucketIndexCachingBucket_ShouldNotCacheTheContentLargerThanTheMaxSize(t *testing.T) {
+	const name = "user-1/bucket-index.json.gz"
+
+	ctx := context.Background()
+	raw := objstore.NewInMemBucket()
+	bkt := NewBucketIndexCachingBucket(raw, newMockCache(), 2, time.Hour, nil)
+
+	require.NoError(t, bkt.Upload(ctx, name, bytes.NewReader([]byte("v1"))))
+	assert.Equal(t, "v1", readBucketIndex(t, bkt, name))
+
+	require.NoError(t, bkt.Upload(ctx, name, bytes.NewReader([]byte("large"))))
+	assert.Equal(t, "large", readBucketIndex(t, bkt, name))
+	assert.Equal(t, "large", readBucketIndex(t, bkt, name))
+	assert.Equal(t, float64(1), testutil.ToFloat64(bkt.hits))
+}
+
+func readBucketIndex(t *testing.T, bkt objstore.BucketReader, name string) string {
+	rc, err := bkt.Get(context.Background(), name)
+	require.NoError(t, err)
+	defer rc.Close() //nolint:errcheck
+
+	content, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	return string(content)
+}
+
+type mockCache struct {
+	mx   sync.Mutex
+	data map[string][]byte
+}
+
+func newMockCache() *mockCache {
+	return &mockCache{data: map[string][]byte{}}
+}
+
+func (c *mockCache) Store(_ context.Context, data map[string][]byte, _ time.Duration) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	for key, value := range data {
+		c.data[key] = value
+	}
+}
+
+func (c *mockCache) Fetch(_ context.Context, keys []string) map[string][]byte {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	found := map[string][]byte{}
+	for _, key := range keys {
+		if value, ok := c.data[key]; ok {
+			found[key] = value
+		}
+	}
+	return found
+}
+
+func (c *mockCache) delete(key string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	delete(c.data, key)
+}
@@ -83,6 +83,18 @@ type Block struct {
 	// UploadedAt is a unix timestamp (seconds precision) of when the block has been completed to be uploaded
 	// to the storage.
 	UploadedAt int64 `json:"uploaded_at"`
+
+	// NumSeries, NumSamples and NumChunks are the stats of the block in its meta.json, and IndexSizeBytes
+	// is the size of its index file. They're zero if unknown, like in the indexes written by the previous
+	// versions.
+	NumSeries      uint64 `json:"num_series,omitempty"`
+	NumSamples     uint64 `json:"num_samples,omitempty"`
+	NumChunks      uint64 `json:"num_chunks,omitempty"`
+	IndexSizeBytes int64  `json:"index_size_bytes,omitempty"`
+
+	// SizeBytes is the total size of the block files listed in its meta.json. It's zero if unknown,
+	// like in the indexes written by the previous versions.
+	SizeBytes int64 `json:"size_bytes,omitempty"`
 }
 
 // Within returns whether the block contains samples within the provided range.
@@ -96,6 +108,12 @@ func (m *Block) GetUploadedAt() time.Time {
 	return time.Unix(m.UploadedAt, 0)
 }
 
+// HasStats returns whether the stats of the block are known.
+func (m *Block) HasStats() bool {
+	// A block always has at least one series.
+	return m.NumSeries > 0
+}
+
 // ThanosMeta returns a block meta based on the known information in the index.
 // The returned meta doesn't include all original meta.json data but only a subset
 // of it.
@@ -143,7 +161,31 @@ func BlockFromThanosMeta(meta metadata.Meta) *Block {
 		MaxTime:        meta.MaxTime,
 		SegmentsFormat: segmentsFormat,
 		SegmentsNum:    segmentsNum,
+		NumSeries:      meta.Stats.NumSeries,
+		NumSamples:     meta.Stats.NumSamples,
+		NumChunks:      meta.Stats.NumChunks,
+		IndexSizeBytes: detectBlockIndexSize(meta),
+		SizeBytes:      detectBlockSize(meta),
+	}
+}
+
+func detectBlockSize(meta metadata.Meta) int64 {
+	var size int64
+	for _, file := range meta.Thanos.Files {
+		size += file.SizeBytes
+	}
+
+	return size
+}
+
+func detectBlockIndexSize(meta metadata.Meta) int64 {
+	for _, file := range meta.Thanos.Files {
+		if file.RelPath == block.IndexFilename {
+			return file.SizeBytes
+		}
 	}
+
+	return 0
 }
 
 func detectBlockSegmentsFormat(meta metadata.Meta) (string, int) {
@@ -246,6 +288,20 @@ func (s Blocks) GetULIDs() []ulid.ULID {
 	return ids
 }
 
+// NumSeries returns the sum of the number of series of the blocks, which is an upper bound of the
+// number of series a query touches when querying them, and whether the stats of all the blocks are
+// known.
+func (s Blocks) NumSeries() (uint64, bool) {
+	total := uint64(0)
+	for _, m := range s {
+		if !m.HasStats() {
+			return 0, false
+		}
+		total += m.NumSeries
+	}
+	return total, true
+}
+
 func (s Blocks) String() string {
 	b := strings.Builder{}
 
@@ -176,6 +176,34 @@ func TestBlockFromThanosMeta(t *testing.T) {
 				SegmentsNum:    3,
 			},
 		},
+		"meta.json with stats": {
+			meta: metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    blockID,
+					MinTime: 10,
+					MaxTime: 20,
+					Stats:   tsdb.BlockStats{NumSeries: 10, NumSamples: 1000, NumChunks: 100},
+				},
+				Thanos: metadata.Thanos{
+					Files: []metadata.File{
+						{RelPath: "index", SizeBytes: 1024},
+						{RelPath: "chunks/000001"},
+					},
+				},
+			},
+			expected: Block{
+				ID:             blockID,
+				MinTime:        10,
+				MaxTime:        20,
+				SegmentsFormat: SegmentsFormat1Based6Digits,
+				SegmentsNum:    1,
+				NumSeries:      10,
+				NumSamples:     1000,
+				NumChunks:      100,
+				IndexSizeBytes: 1024,
+				SizeBytes:      1024,
+			},
+		},
 		"meta.json with Files": {
 			meta: metadata.Meta{
 				BlockMeta: tsdb.BlockMeta{
@@ -210,6 +238,38 @@ func TestBlockFromThanosMeta(t *testing.T) {
 	}
 }
 
+func TestBlocks_NumSeries(t *testing.T) {
+	tests := map[string]struct {
+		blocks         Blocks
+		expectedSeries uint64
+		expectedKnown  bool
+	}{
+		"no blocks": {
+			blocks:         nil,
+			expectedSeries: 0,
+			expectedKnown:  true,
+		},
+		"all blocks with stats": {
+			blocks:         Blocks{{NumSeries: 10}, {NumSeries: 20}},
+			expectedSeries: 30,
+			expectedKnown:  true,
+		},
+		"some blocks without stats": {
+			blocks:         Blocks{{NumSeries: 10}, {}},
+			expectedSeries: 0,
+			expectedKnown:  false,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			series, known := testData.blocks.NumSeries()
+			assert.Equal(t, testData.expectedSeries, series)
+			assert.Equal(t, testData.expectedKnown, known)
+		})
+	}
+}
+
 func TestBlock_Within(t *testing.T) {
 	tests := []struct {
 		block    *Block
@@ -30,13 +30,29 @@ func BlockDeletionMarkFilepath(blockID ulid.ULID) string {
 // IsBlockDeletionMarkFilename returns whether the input filename matches the expected pattern
 // of block deletion markers stored in the markers location.
 func IsBlockDeletionMarkFilename(name string) (ulid.ULID, bool) {
+	return isBlockMarkFilename(name, metadata.DeletionMarkFilename)
+}
+
+// NoCompactMarkFilepath returns the path, relative to the tenant's bucket location,
+// of a block no-compact mark in the bucket markers location.
+func NoCompactMarkFilepath(blockID ulid.ULID) string {
+	return fmt.Sprintf("%s/%s-%s", MarkersPathname, blockID.String(), metadata.NoCompactMarkFilename)
+}
+
+// IsNoCompactMarkFilename returns whether the input filename matches the expected pattern
+// of block no-compact markers stored in the markers location.
+func IsNoCompactMarkFilename(name string) (ulid.ULID, bool) {
+	return isBlockMarkFilename(name, metadata.NoCompactMarkFilename)
+}
+
+func isBlockMarkFilename(name, markFilename string) (ulid.ULID, bool) {
 	parts := strings.SplitN(name, "-", 2)
 	if len(parts) != 2 {
 		return ulid.ULID{}, false
 	}
 
-	// Ensure the 2nd part matches the block deletion mark filename.
-	if parts[1] != metadata.DeletionMarkFilename {
+	// Ensure the 2nd part matches the block mark filename.
+	if parts[1] != markFilename {
 		return ulid.ULID{}, false
 	}
 
@@ -29,7 +29,7 @@ func BucketWithGlobalMarkers(b objstore.Bucket) objstore.Bucket {
 
 // Upload implements objstore.Bucket.
 func (b *globalMarkersBucket) Upload(ctx context.Context, name string, r io.Reader) error {
-	blockID, ok := b.isBlockDeletionMark(name)
+	globalMarkPath, ok := b.getGlobalMarkPath(name)
 	if !ok {
 		return b.parent.Upload(ctx, name, r)
 	}
@@ -46,7 +46,6 @@ func (b *globalMarkersBucket) Upload(ctx context.Context, name string, r io.Read
 	}
 
 	// Upload it to the global markers location too.
-	globalMarkPath := path.Clean(path.Join(path.Dir(name), "../", BlockDeletionMarkFilepath(blockID)))
 	return b.parent.Upload(ctx, globalMarkPath, bytes.NewBuffer(body))
 }
 
@@ -58,8 +57,7 @@ func (b *globalMarkersBucket) Delete(ctx context.Context, name string) error {
 	}
 
 	// Delete the marker in the global markers location too.
-	if blockID, ok := b.isBlockDeletionMark(name); ok {
-		globalMarkPath := path.Clean(path.Join(path.Dir(name), "../", BlockDeletionMarkFilepath(blockID)))
+	if globalMarkPath, ok := b.getGlobalMarkPath(name); ok {
 		if err := b.parent.Delete(ctx, globalMarkPath); err != nil {
 			if !b.parent.IsObjNotFoundErr(err) {
 				return err
@@ -128,12 +126,23 @@ func (b *globalMarkersBucket) ReaderWithExpectedErrs(fn objstore.IsOpFailureExpe
 	return b
 }
 
-func (b *globalMarkersBucket) isBlockDeletionMark(name string) (ulid.ULID, bool) {
-	if path.Base(name) != metadata.DeletionMarkFilename {
-		return ulid.ULID{}, false
+// getGlobalMarkPath returns the path of the marker in the global markers location, if the
+// input name is a per-block deletion or no-compact mark.
+func (b *globalMarkersBucket) getGlobalMarkPath(name string) (string, bool) {
+	var markFilepath func(ulid.ULID) string
+	switch path.Base(name) {
+	case metadata.DeletionMarkFilename:
+		markFilepath = BlockDeletionMarkFilepath
+	case metadata.NoCompactMarkFilename:
+		markFilepath = NoCompactMarkFilepath
+	default:
+		return "", false
 	}
 
-	// Parse the block ID in the path. If there's not block ID, then it's not the per-block
-	// deletion mark.
-	return block.IsBlockDir(path.Dir(name))
+	// Parse the block ID in the path. If there's not block ID, then it's not a per-block mark.
+	blockID, ok := block.IsBlockDir(path.Dir(name))
+	if !ok {
+		return "", false
+	}
+	return path.Clean(path.Join(path.Dir(name), "../", markFilepath(blockID))), true
 }
@@ -3,6 +3,7 @@ package bucketindex
 import (
 	"bytes"
 	"context"
+	"path"
 	"strings"
 	"testing"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/objstore"
 
 	"github.com/cortexproject/cortex/pkg/storage/bucket"
@@ -41,13 +43,13 @@ func TestGlobalMarkersBucket_Delete_ShouldSucceedIfDeletionMarkDoesNotExistInThe
 	require.False(t, ok)
 }
 
-func TestGlobalMarkersBucket_isBlockDeletionMark(t *testing.T) {
+func TestGlobalMarkersBucket_getGlobalMarkPath(t *testing.T) {
 	block1 := ulid.MustNew(1, nil)
 
 	tests := []struct {
-		name       string
-		expectedOk bool
-		expectedID ulid.ULID
+		name         string
+		expectedOk   bool
+		expectedPath string
 	}{
 		{
 			name:       "",
@@ -55,17 +57,28 @@ func TestGlobalMarkersBucket_isBlockDeletionMark(t *testing.T) {
 		}, {
 			name:       "deletion-mark.json",
 			expectedOk: false,
+		}, {
+			name:       "no-compact-mark.json",
+			expectedOk: false,
 		}, {
 			name:       block1.String() + "/index",
 			expectedOk: false,
 		}, {
-			name:       block1.String() + "/deletion-mark.json",
-			expectedOk: true,
-			expectedID: block1,
+			name:         block1.String() + "/deletion-mark.json",
+			expectedOk:   true,
+			expectedPath: "markers/" + block1.String() + "-deletion-mark.json",
+		}, {
+			name:         "/path/to/" + block1.String() + "/deletion-mark.json",
+			expectedOk:   true,
+			expectedPath: "/path/to/markers/" + block1.String() + "-deletion-mark.json",
 		}, {
-			name:       "/path/to/" + block1.String() + "/deletion-mark.json",
-			expectedOk: true,
-			expectedID: block1,
+			name:         block1.String() + "/no-compact-mark.json",
+			expectedOk:   true,
+			expectedPath: "markers/" + block1.String() + "-no-compact-mark.json",
+		}, {
+			name:         "/path/to/" + block1.String() + "/no-compact-mark.json",
+			expectedOk:   true,
+			expectedPath: "/path/to/markers/" + block1.String() + "-no-compact-mark.json",
 		},
 	}
 
@@ -73,13 +86,42 @@ func TestGlobalMarkersBucket_isBlockDeletionMark(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			actualID, actualOk := b.isBlockDeletionMark(tc.name)
+			actualPath, actualOk := b.getGlobalMarkPath(tc.name)
 			assert.Equal(t, tc.expectedOk, actualOk)
-			assert.Equal(t, tc.expectedID, actualID)
+			assert.Equal(t, tc.expectedPath, actualPath)
 		})
 	}
 }
 
+func TestGlobalMarkersBucket_ShouldKeepNoCompactMarksInTheGlobalLocation(t *testing.T) {
+	bkt, _ := cortex_testutil.PrepareFilesystemBucket(t)
+
+	ctx := context.Background()
+	bkt = BucketWithGlobalMarkers(bkt)
+
+	blockID := ulid.MustNew(1, nil)
+	blockPath := path.Join("user-1", blockID.String(), metadata.NoCompactMarkFilename)
+	globalPath := path.Join("user-1", NoCompactMarkFilepath(blockID))
+
+	// Upload the mark to the block location.
+	require.NoError(t, bkt.Upload(ctx, blockPath, strings.NewReader("{}")))
+
+	for _, p := range []string{blockPath, globalPath} {
+		ok, err := bkt.Exists(ctx, p)
+		require.NoError(t, err)
+		require.True(t, ok, p)
+	}
+
+	// Delete the mark from the block location.
+	require.NoError(t, bkt.Delete(ctx, blockPath))
+
+	for _, p := range []string{blockPath, globalPath} {
+		ok, err := bkt.Exists(ctx, p)
+		require.NoError(t, err)
+		require.False(t, ok, p)
+	}
+}
+
 func TestBucketWithGlobalMarkers_ShouldWorkCorrectlyWithBucketMetrics(t *testing.T) {
 	reg := prometheus.NewPedanticRegistry()
 	ctx := context.Background()
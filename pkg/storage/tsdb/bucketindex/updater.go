@@ -88,8 +88,19 @@ func (w *Updater) updateBlocks(ctx context.Context, old []*Block) (blocks []*Blo
 	// Since blocks are immutable, all blocks already existing in the index can just be copied.
 	for _, b := range old {
 		if _, ok := discovered[b.ID]; ok {
-			blocks = append(blocks, b)
 			delete(discovered, b.ID)
+
+			// The indexes written by the previous versions don't have the block stats, so we
+			// backfill them from the meta.json, keeping the old entry if it can't be read.
+			if !b.HasStats() {
+				if updated, err := w.updateBlockIndexEntry(ctx, b.ID); err == nil {
+					b = updated
+				} else {
+					level.Warn(w.logger).Log("msg", "unable to backfill the block stats when updating bucket index", "block", b.ID.String(), "err", err)
+				}
+			}
+
+			blocks = append(blocks, b)
 		}
 	}
 
@@ -3,6 +3,7 @@ package bucketindex
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"path"
 	"testing"
 	"time"
@@ -121,6 +122,46 @@ func TestUpdater_UpdateIndex_ShouldSkipBlocksWithCorruptedMeta(t *testing.T) {
 	assert.True(t, errors.Is(partials[block3.ULID], ErrBlockMetaCorrupted))
 }
 
+func TestUpdater_UpdateIndex_ShouldBackfillTheBlockStats(t *testing.T) {
+	const userID = "user-1"
+
+	bkt, _ := testutil.PrepareFilesystemBucket(t)
+
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	// Mock a block with stats in the storage.
+	bkt = BucketWithGlobalMarkers(bkt)
+	block1 := testutil.MockStorageBlock(t, bkt, userID, 10, 20)
+
+	meta := metadata.Meta{
+		BlockMeta: block1,
+		Thanos: metadata.Thanos{
+			Files: []metadata.File{{RelPath: block.IndexFilename, SizeBytes: 1024}},
+		},
+	}
+	meta.Stats = tsdb.BlockStats{NumSeries: 10, NumSamples: 1000, NumChunks: 100}
+	metaContent, err := json.Marshal(meta)
+	require.NoError(t, err)
+	require.NoError(t, bkt.Upload(ctx, path.Join(userID, block1.ULID.String(), metadata.MetaFilename), bytes.NewReader(metaContent)))
+
+	// Simulate an index written by a previous version, without the block stats.
+	old := &Index{
+		Version: IndexVersion1,
+		Blocks:  Blocks{{ID: block1.ULID, MinTime: block1.MinTime, MaxTime: block1.MaxTime}},
+	}
+
+	w := NewUpdater(bkt, userID, nil, logger)
+	idx, _, err := w.UpdateIndex(ctx, old)
+	require.NoError(t, err)
+	require.Len(t, idx.Blocks, 1)
+	assert.Equal(t, uint64(10), idx.Blocks[0].NumSeries)
+	assert.Equal(t, uint64(1000), idx.Blocks[0].NumSamples)
+	assert.Equal(t, uint64(100), idx.Blocks[0].NumChunks)
+	assert.Equal(t, int64(1024), idx.Blocks[0].IndexSizeBytes)
+	assert.Equal(t, getBlockUploadedAt(t, bkt, userID, block1.ULID), idx.Blocks[0].UploadedAt)
+}
+
 func TestUpdater_UpdateIndex_ShouldSkipCorruptedDeletionMarks(t *testing.T) {
 	const userID = "user-1"
 
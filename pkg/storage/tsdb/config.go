@@ -50,6 +50,8 @@ var (
 	errInvalidWALSegmentSizeBytes   = errors.New("invalid TSDB WAL segment size bytes")
 	errInvalidStripeSize            = errors.New("invalid TSDB stripe size")
 	errEmptyBlockranges             = errors.New("empty block ranges for TSDB")
+
+	errLocalCacheRequiresLazyLoading = errors.New("the store-gateway local cache max size requires index-header lazy loading to be enabled")
 )
 
 // BlocksStorageConfig holds the config information for the blocks storage.
@@ -97,6 +99,37 @@ func (d *DurationList) ToMilliseconds() []int64 {
 	return values
 }
 
+// ValidateBlockRanges returns an error if the TSDB blocks cut with the block ranges can't be
+// compacted by a compactor configured with the compactor block ranges: each block range should
+// either be a divisor of the smallest compactor block range, or one of the compactor block ranges.
+// The compatibility with the compactor isn't checked if the compactor block ranges are empty.
+func ValidateBlockRanges(blockRanges, compactorRanges DurationList) error {
+	for i, r := range blockRanges {
+		if r <= 0 {
+			return errors.Errorf("invalid TSDB block range period %s", r.String())
+		}
+		if i > 0 && r%blockRanges[i-1] != 0 {
+			return errors.Errorf("TSDB block range periods should be divisible by the previous one, but %s is not divisible by %s", r.String(), blockRanges[i-1].String())
+		}
+		if len(compactorRanges) == 0 || compactorRanges[0]%r == 0 {
+			continue
+		}
+
+		compatible := false
+		for _, c := range compactorRanges {
+			if c == r {
+				compatible = true
+				break
+			}
+		}
+		if !compatible {
+			return errors.Errorf("TSDB block range period %s can't be compacted with the compactor block ranges %s, it should be a divisor of %s or one of the compactor block ranges", r.String(), compactorRanges.String(), compactorRanges[0].String())
+		}
+	}
+
+	return nil
+}
+
 // RegisterFlags registers the TSDB flags
 func (cfg *BlocksStorageConfig) RegisterFlags(f *flag.FlagSet) {
 	cfg.Bucket.RegisterFlagsWithPrefix("blocks-storage.", f)
@@ -147,6 +180,9 @@ type TSDBConfig struct {
 
 	// Positive value enables experiemental support for exemplars. 0 or less to disable.
 	MaxExemplars int `yaml:"max_exemplars"`
+
+	// Positive value enables the series snapshots written by the ingesters flushing their blocks on shutdown.
+	SeriesSnapshotTTL time.Duration `yaml:"series_snapshot_ttl"`
 }
 
 // RegisterFlags registers the TSDBConfig flags.
@@ -171,6 +207,7 @@ func (cfg *TSDBConfig) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.FlushBlocksOnShutdown, "blocks-storage.tsdb.flush-blocks-on-shutdown", false, "True to flush blocks to storage on shutdown. If false, incomplete blocks will be reused after restart.")
 	f.DurationVar(&cfg.CloseIdleTSDBTimeout, "blocks-storage.tsdb.close-idle-tsdb-timeout", 0, "If TSDB has not received any data for this duration, and all blocks from TSDB have been shipped, TSDB is closed and deleted from local disk. If set to positive value, this value should be equal or higher than -querier.query-ingesters-within flag to make sure that TSDB is not closed prematurely, which could cause partial query results. 0 or negative value disables closing of idle TSDB.")
 	f.IntVar(&cfg.MaxExemplars, "blocks-storage.tsdb.max-exemplars", 0, "Enables support for exemplars in TSDB and sets the maximum number that will be stored. 0 or less means disabled.")
+	f.DurationVar(&cfg.SeriesSnapshotTTL, "blocks-storage.tsdb.series-snapshot-ttl", 0, "When greater than 0, the ingesters flushing their blocks on shutdown write a snapshot of the last sample of each series to the storage, and the queriers merge the snapshots written within this period with the ingesters data, for this period after an ingester left the ring. It keeps the range queries, like rate(), continuous until the flushed blocks are queryable from the storage. Requires -blocks-storage.tsdb.flush-blocks-on-shutdown in the ingesters. 0 to disable.")
 }
 
 // Validate the config.
@@ -235,6 +272,7 @@ type BucketStoreConfig struct {
 	MetadataCache            MetadataCacheConfig `yaml:"metadata_cache"`
 	IgnoreDeletionMarksDelay time.Duration       `yaml:"ignore_deletion_mark_delay"`
 	BucketIndex              BucketIndexConfig   `yaml:"bucket_index"`
+	LocalCache               LocalCacheConfig    `yaml:"local_cache"`
 
 	// Chunk pool.
 	MaxChunkPoolBytes           uint64 `yaml:"max_chunk_pool_bytes"`
@@ -255,6 +293,9 @@ type BucketStoreConfig struct {
 	// On the contrary, smaller value will increase baseline memory usage, but improve latency slightly.
 	// 1 will keep all in memory. Default value is the same as in Prometheus which gives a good balance.
 	PostingOffsetsInMemSampling int `yaml:"postings_offsets_in_mem_sampling" doc:"hidden"`
+
+	// If true, the bucket stores serve the cold blocks and enforce the cold queries limits. Injected internally.
+	ServeColdBlocks bool `yaml:"-"`
 }
 
 // RegisterFlags registers the BucketStore flags
@@ -263,6 +304,7 @@ func (cfg *BucketStoreConfig) RegisterFlags(f *flag.FlagSet) {
 	cfg.ChunksCache.RegisterFlagsWithPrefix(f, "blocks-storage.bucket-store.chunks-cache.")
 	cfg.MetadataCache.RegisterFlagsWithPrefix(f, "blocks-storage.bucket-store.metadata-cache.")
 	cfg.BucketIndex.RegisterFlagsWithPrefix(f, "blocks-storage.bucket-store.bucket-index.")
+	cfg.LocalCache.RegisterFlagsWithPrefix(f, "blocks-storage.bucket-store.local-cache.")
 
 	f.StringVar(&cfg.SyncDir, "blocks-storage.bucket-store.sync-dir", "tsdb-sync", "Directory to store synchronized TSDB index headers.")
 	f.DurationVar(&cfg.SyncInterval, "blocks-storage.bucket-store.sync-interval", 15*time.Minute, "How frequently to scan the bucket, or to refresh the bucket index (if enabled), in order to look for changes (new blocks shipped by ingesters and blocks deleted by retention or compaction).")
@@ -297,6 +339,9 @@ func (cfg *BucketStoreConfig) Validate() error {
 	if err != nil {
 		return errors.Wrap(err, "metadata-cache configuration")
 	}
+	if cfg.LocalCache.MaxSizeBytes > 0 && !cfg.IndexHeaderLazyLoadingEnabled {
+		return errLocalCacheRequiresLazyLoading
+	}
 	return nil
 }
 
@@ -313,3 +358,15 @@ func (cfg *BucketIndexConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix st
 	f.DurationVar(&cfg.IdleTimeout, prefix+"idle-timeout", time.Hour, "How long a unused bucket index should be cached. Once this timeout expires, the unused bucket index is removed from the in-memory cache. This option is used only by querier.")
 	f.DurationVar(&cfg.MaxStalePeriod, prefix+"max-stale-period", time.Hour, "The maximum allowed age of a bucket index (last updated) before queries start failing because the bucket index is too old. The bucket index is periodically updated by the compactor, while this check is enforced in the querier (at query time).")
 }
+
+// LocalCacheConfig configures how the store-gateway manages the blocks data
+// (index-headers) stored on the local disk.
+type LocalCacheConfig struct {
+	MaxSizeBytes  uint64        `yaml:"max_size_bytes"`
+	PrewarmPeriod time.Duration `yaml:"prewarm_period"`
+}
+
+func (cfg *LocalCacheConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix string) {
+	f.Uint64Var(&cfg.MaxSizeBytes, prefix+"max-size-bytes", 0, "Max size - in bytes - of the index-headers stored on the local disk by the store-gateway. When exceeded, the index-headers of the least recently queried blocks are removed from the local disk, and downloaded again once queried. Requires index-header lazy loading to be enabled. This option is used only by store-gateway. 0 to disable the limit.")
+	f.DurationVar(&cfg.PrewarmPeriod, prefix+"prewarm-period", 0, "If > 0, after each blocks sync the store-gateway will download the missing index-headers of the owned blocks containing samples within this period (e.g. 12h for the newest 12 hours). This option is used only by store-gateway. 0 to disable.")
+}
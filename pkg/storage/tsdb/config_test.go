@@ -115,6 +115,20 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expectedErr: errInvalidWALSegmentSizeBytes,
 		},
+		"should fail on local cache max size if index-header lazy loading is disabled": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.BucketStore.LocalCache.MaxSizeBytes = 1024
+				cfg.BucketStore.IndexHeaderLazyLoadingEnabled = false
+			},
+			expectedErr: errLocalCacheRequiresLazyLoading,
+		},
+		"should pass on local cache max size if index-header lazy loading is enabled": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.BucketStore.LocalCache.MaxSizeBytes = 1024
+				cfg.BucketStore.IndexHeaderLazyLoadingEnabled = true
+			},
+			expectedErr: nil,
+		},
 	}
 
 	for testName, testData := range tests {
@@ -1,10 +1,13 @@
 package tsdb
 
 import (
+	"context"
 	"flag"
 	"strings"
 	"time"
 
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/thanos-io/thanos/pkg/cacheutil"
 	"github.com/thanos-io/thanos/pkg/model"
 )
@@ -18,6 +21,9 @@ type MemcachedClientConfig struct {
 	MaxGetMultiConcurrency int           `yaml:"max_get_multi_concurrency"`
 	MaxGetMultiBatchSize   int           `yaml:"max_get_multi_batch_size"`
 	MaxItemSize            int           `yaml:"max_item_size"`
+
+	// Prefix added to all the keys, to use a separate namespace in a shared memcached. Injected internally.
+	KeyPrefix string `yaml:"-"`
 }
 
 func (cfg *MemcachedClientConfig) RegisterFlagsWithPrefix(f *flag.FlagSet, prefix string) {
@@ -61,3 +67,44 @@ func (cfg MemcachedClientConfig) ToMemcachedClientConfig() cacheutil.MemcachedCl
 		DNSProviderUpdateInterval: 30 * time.Second,
 	}
 }
+
+// newMemcachedClient creates a new memcached client, adding the configured prefix to the keys.
+func newMemcachedClient(logger log.Logger, name string, cfg MemcachedClientConfig, reg prometheus.Registerer) (cacheutil.MemcachedClient, error) {
+	client, err := cacheutil.NewMemcachedClientWithConfig(logger, name, cfg.ToMemcachedClientConfig(), reg)
+	if err != nil || cfg.KeyPrefix == "" {
+		return client, err
+	}
+
+	return &prefixedMemcachedClient{MemcachedClient: client, prefix: cfg.KeyPrefix}, nil
+}
+
+// prefixedMemcachedClient is a memcached client adding a prefix to all the keys.
+type prefixedMemcachedClient struct {
+	cacheutil.MemcachedClient
+
+	prefix string
+}
+
+// GetMulti implements cacheutil.MemcachedClient.
+func (c *prefixedMemcachedClient) GetMulti(ctx context.Context, keys []string) map[string][]byte {
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, c.prefix+key)
+	}
+
+	hits := c.MemcachedClient.GetMulti(ctx, prefixed)
+	if len(hits) == 0 {
+		return hits
+	}
+
+	res := make(map[string][]byte, len(hits))
+	for key, value := range hits {
+		res[strings.TrimPrefix(key, c.prefix)] = value
+	}
+	return res
+}
+
+// SetAsync implements cacheutil.MemcachedClient.
+func (c *prefixedMemcachedClient) SetAsync(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.MemcachedClient.SetAsync(ctx, c.prefix+key, value, ttl)
+}
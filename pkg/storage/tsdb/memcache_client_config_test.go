@@ -1,9 +1,12 @@
 package tsdb
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMemcachedIndexCacheConfig_GetAddresses(t *testing.T) {
@@ -36,3 +39,36 @@ func TestMemcachedIndexCacheConfig_GetAddresses(t *testing.T) {
 		})
 	}
 }
+
+func TestPrefixedMemcachedClient(t *testing.T) {
+	backend := &mockMemcachedClient{items: map[string][]byte{}}
+	client := &prefixedMemcachedClient{MemcachedClient: backend, prefix: "cold:"}
+
+	require.NoError(t, client.SetAsync(context.Background(), "key-1", []byte("value-1"), time.Minute))
+	require.NoError(t, backend.SetAsync(context.Background(), "key-2", []byte("value-2"), time.Minute))
+
+	// The keys are stored with the prefix, so that the items of the unprefixed client are never returned.
+	assert.Equal(t, map[string][]byte{"cold:key-1": []byte("value-1"), "key-2": []byte("value-2")}, backend.items)
+	assert.Equal(t, map[string][]byte{"key-1": []byte("value-1")}, client.GetMulti(context.Background(), []string{"key-1", "key-2"}))
+}
+
+type mockMemcachedClient struct {
+	items map[string][]byte
+}
+
+func (m *mockMemcachedClient) GetMulti(_ context.Context, keys []string) map[string][]byte {
+	hits := map[string][]byte{}
+	for _, key := range keys {
+		if value, ok := m.items[key]; ok {
+			hits[key] = value
+		}
+	}
+	return hits
+}
+
+func (m *mockMemcachedClient) SetAsync(_ context.Context, key string, value []byte, _ time.Duration) error {
+	m.items[key] = value
+	return nil
+}
+
+func (m *mockMemcachedClient) Stop() {}
@@ -0,0 +1,123 @@
+package tsdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/storage/bucket"
+)
+
+// Relative to user-specific prefix.
+const SeriesSnapshotsDir = "series-snapshots"
+
+const seriesSnapshotExtension = ".pb.gz"
+
+// SeriesSnapshotPath returns the path of the series snapshot written by the ingester, relative
+// to user-specific prefix.
+func SeriesSnapshotPath(instanceID string) string {
+	return path.Join(SeriesSnapshotsDir, instanceID+seriesSnapshotExtension)
+}
+
+// WriteSeriesSnapshot uploads the snapshot of the last sample of each series of the user, written
+// by an ingester flushing its blocks on shutdown. The snapshot replaces the previous one of the
+// ingester.
+func WriteSeriesSnapshot(ctx context.Context, bkt objstore.Bucket, userID, instanceID string, cfgProvider bucket.TenantConfigProvider, series []cortexpb.PreallocTimeseries) error {
+	bkt = bucket.NewUserBucketClient(userID, bkt, cfgProvider)
+
+	content, err := (&cortexpb.WriteRequest{Timeseries: series}).Marshal()
+	if err != nil {
+		return errors.Wrap(err, "marshal series snapshot")
+	}
+
+	var gzipContent bytes.Buffer
+	gzip := gzip.NewWriter(&gzipContent)
+	if _, err := gzip.Write(content); err != nil {
+		return errors.Wrap(err, "gzip series snapshot")
+	}
+	if err := gzip.Close(); err != nil {
+		return errors.Wrap(err, "close gzip series snapshot")
+	}
+
+	return errors.Wrap(bkt.Upload(ctx, SeriesSnapshotPath(instanceID), &gzipContent), "upload series snapshot")
+}
+
+// ReadSeriesSnapshots returns the series of the snapshots of the user written since minTime,
+// by any ingester. The same series may be returned by multiple snapshots.
+func ReadSeriesSnapshots(ctx context.Context, bkt objstore.Bucket, userID string, cfgProvider bucket.TenantConfigProvider, minTime time.Time, logger log.Logger) ([]cortexpb.PreallocTimeseries, error) {
+	userBkt := bucket.NewUserBucketClient(userID, bkt, cfgProvider)
+
+	var names []string
+	err := userBkt.Iter(ctx, SeriesSnapshotsDir, func(name string) error {
+		if strings.HasSuffix(name, seriesSnapshotExtension) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list series snapshots")
+	}
+
+	var series []cortexpb.PreallocTimeseries
+	for _, name := range names {
+		attrs, err := userBkt.Attributes(ctx, name)
+		if userBkt.IsObjNotFoundErr(err) {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "read series snapshot attributes: %s", name)
+		}
+
+		if attrs.LastModified.Before(minTime) {
+			continue
+		}
+
+		snapshot, err := readSeriesSnapshot(ctx, userBkt, name, logger)
+		if userBkt.IsObjNotFoundErr(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		series = append(series, snapshot...)
+	}
+
+	return series, nil
+}
+
+func readSeriesSnapshot(ctx context.Context, bkt objstore.BucketReader, name string, logger log.Logger) ([]cortexpb.PreallocTimeseries, error) {
+	reader, err := bkt.Get(ctx, name)
+	if err != nil {
+		if bkt.IsObjNotFoundErr(err) {
+			return nil, err
+		}
+		return nil, errors.Wrapf(err, "read series snapshot: %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(logger, reader, "close series snapshot reader")
+
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "gunzip series snapshot: %s", name)
+	}
+	defer runutil.CloseWithLogOnErr(logger, gzipReader, "close series snapshot gzip reader")
+
+	content, err := ioutil.ReadAll(gzipReader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read series snapshot: %s", name)
+	}
+
+	req := cortexpb.WriteRequest{}
+	if err := req.Unmarshal(content); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal series snapshot: %s", name)
+	}
+
+	return req.Timeseries, nil
+}
@@ -0,0 +1,48 @@
+package tsdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+)
+
+func TestWriteAndReadSeriesSnapshots(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	series := []cortexpb.PreallocTimeseries{{TimeSeries: &cortexpb.TimeSeries{
+		Labels:  []cortexpb.LabelAdapter{{Name: "__name__", Value: "up"}},
+		Samples: []cortexpb.Sample{{TimestampMs: 1000, Value: 1}},
+	}}}
+
+	// No snapshot.
+	actual, err := ReadSeriesSnapshots(ctx, bkt, "user-1", nil, time.Now().Add(-time.Minute), log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Empty(t, actual)
+
+	require.NoError(t, WriteSeriesSnapshot(ctx, bkt, "user-1", "ingester-1", nil, series))
+	assert.Contains(t, bkt.Objects(), "user-1/series-snapshots/ingester-1.pb.gz")
+
+	actual, err = ReadSeriesSnapshots(ctx, bkt, "user-1", nil, time.Now().Add(-time.Minute), log.NewNopLogger())
+	require.NoError(t, err)
+	require.Len(t, actual, 1)
+	assert.Equal(t, series[0].Labels, actual[0].Labels)
+	assert.Equal(t, series[0].Samples, actual[0].Samples)
+
+	// The snapshots written before the min time are ignored.
+	actual, err = ReadSeriesSnapshots(ctx, bkt, "user-1", nil, time.Now().Add(time.Minute), log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Empty(t, actual)
+
+	// The snapshots of the other users are ignored.
+	actual, err = ReadSeriesSnapshots(ctx, bkt, "user-2", nil, time.Now().Add(-time.Minute), log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Empty(t, actual)
+}
@@ -64,3 +64,25 @@ func (s *bucketStoreSeriesServer) Send(r *storepb.SeriesResponse) error {
 func (s *bucketStoreSeriesServer) Context() context.Context {
 	return s.ctx
 }
+
+// prefetchSeriesServer is a fake in-memory gRPC server which discards the series received
+// from the Thanos BucketStore.Series(), only counting them.
+type prefetchSeriesServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	storepb.Store_SeriesServer
+
+	ctx context.Context
+
+	seriesCount int
+}
+
+func (s *prefetchSeriesServer) Send(r *storepb.SeriesResponse) error {
+	if r.GetSeries() != nil {
+		s.seriesCount++
+	}
+	return nil
+}
+
+func (s *prefetchSeriesServer) Context() context.Context {
+	return s.ctx
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/gogo/protobuf/types"
 	"github.com/grafana/dskit/backoff"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
@@ -28,11 +29,13 @@ import (
 	"github.com/thanos-io/thanos/pkg/pool"
 	"github.com/thanos-io/thanos/pkg/store"
 	storecache "github.com/thanos-io/thanos/pkg/store/cache"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/logging"
 	"google.golang.org/grpc/metadata"
 
+	"github.com/cortexproject/cortex/pkg/querier/astmapper"
 	"github.com/cortexproject/cortex/pkg/storage/bucket"
 	"github.com/cortexproject/cortex/pkg/storage/tsdb"
 	util_log "github.com/cortexproject/cortex/pkg/util/log"
@@ -67,6 +70,9 @@ type BucketStores struct {
 	storesMu sync.RWMutex
 	stores   map[string]*store.BucketStore
 
+	// Manages the blocks data stored on the local disk (nil if disabled).
+	localCache *localCache
+
 	// Metrics.
 	syncTimes         prometheus.Histogram
 	syncLastSuccess   prometheus.Gauge
@@ -130,6 +136,10 @@ func NewBucketStores(cfg tsdb.BlocksStorageConfig, shardingStrategy ShardingStra
 		return nil, errors.Wrap(err, "create chunks bytes pool")
 	}
 
+	if cfg.BucketStore.LocalCache.MaxSizeBytes > 0 || cfg.BucketStore.LocalCache.PrewarmPeriod > 0 {
+		u.localCache = newLocalCache(cfg.BucketStore, logger, reg)
+	}
+
 	if reg != nil {
 		reg.MustRegister(u.bucketStoreMetrics, u.metaFetcherMetrics)
 	}
@@ -269,6 +279,12 @@ func (u *BucketStores) syncUsersBlocks(ctx context.Context, f func(context.Conte
 
 	u.deleteLocalFilesForExcludedTenants(includeUserIDs)
 
+	if u.localCache != nil {
+		u.localCache.sync(ctx, func(userID string) objstore.BucketReader {
+			return bucket.NewUserBucketClient(userID, u.bucket, u.limits)
+		}, time.Now())
+	}
+
 	return errs.Err()
 }
 
@@ -287,10 +303,32 @@ func (u *BucketStores) Series(req *storepb.SeriesRequest, srv storepb.Store_Seri
 		return nil
 	}
 
-	return store.Series(req, spanSeriesServer{
+	if u.localCache != nil && req.Hints != nil {
+		hints := &hintspb.SeriesRequestHints{}
+		if err := types.UnmarshalAny(req.Hints, hints); err == nil {
+			u.localCache.touch(userID, hints.BlockMatchers, time.Now())
+		}
+	}
+
+	srv = spanSeriesServer{
 		Store_SeriesServer: srv,
 		ctx:                spanCtx,
-	})
+	}
+
+	// The series of the vertical shard of the query selected by the querier are filtered by the hash
+	// of their labels before being sent.
+	shard, req, err := queryShardFromSeriesRequest(req)
+	if err != nil {
+		return httpgrpc.Errorf(http.StatusBadRequest, err.Error())
+	}
+	if shard != nil {
+		srv = queryShardSeriesServer{
+			Store_SeriesServer: srv,
+			shard:              *shard,
+		}
+	}
+
+	return store.Series(req, srv)
 }
 
 // LabelNames implements the Storegateway proto service.
@@ -308,6 +346,13 @@ func (u *BucketStores) LabelNames(ctx context.Context, req *storepb.LabelNamesRe
 		return &storepb.LabelNamesResponse{}, nil
 	}
 
+	if u.localCache != nil && req.Hints != nil {
+		hints := &hintspb.LabelNamesRequestHints{}
+		if err := types.UnmarshalAny(req.Hints, hints); err == nil {
+			u.localCache.touch(userID, hints.BlockMatchers, time.Now())
+		}
+	}
+
 	return store.LabelNames(ctx, req)
 }
 
@@ -326,6 +371,13 @@ func (u *BucketStores) LabelValues(ctx context.Context, req *storepb.LabelValues
 		return &storepb.LabelValuesResponse{}, nil
 	}
 
+	if u.localCache != nil && req.Hints != nil {
+		hints := &hintspb.LabelValuesRequestHints{}
+		if err := types.UnmarshalAny(req.Hints, hints); err == nil {
+			u.localCache.touch(userID, hints.BlockMatchers, time.Now())
+		}
+	}
+
 	return store.LabelValues(ctx, req)
 }
 
@@ -431,6 +483,11 @@ func (u *BucketStores) getOrCreateStore(userID string) (*store.BucketStore, erro
 		// consistency check on the querier will fail.
 	}...)
 
+	// The local cache must keep track of the blocks passing all the other filters.
+	if u.localCache != nil {
+		filters = append(filters, u.localCache.metadataFilter(userID))
+	}
+
 	modifiers := []block.MetadataModifier{
 		// Remove Cortex external labels so that they're not injected when querying blocks.
 		NewReplicaLabelRemover(userLogger, []string{
@@ -491,7 +548,7 @@ func (u *BucketStores) getOrCreateStore(userID string) (*store.BucketStore, erro
 		userBkt,
 		fetcher,
 		u.syncDirForUser(userID),
-		newChunksLimiterFactory(u.limits, userID),
+		newChunksLimiterFactory(u.limits, userID, u.cfg.BucketStore.ServeColdBlocks),
 		store.NewSeriesLimiterFactory(0), // No series limiter.
 		u.partitioner,
 		u.cfg.BucketStore.BlockSyncConcurrency,
@@ -544,6 +601,10 @@ func (u *BucketStores) deleteLocalFilesForExcludedTenants(includeUserIDs map[str
 			level.Warn(u.logger).Log("msg", "failed to close bucket store for user", "user", userID, "err", err)
 		}
 
+		if u.localCache != nil {
+			u.localCache.removeUser(userID)
+		}
+
 		userSyncDir := u.syncDirForUser(userID)
 		err = os.RemoveAll(userSyncDir)
 		if err == nil {
@@ -605,6 +666,45 @@ func (s spanSeriesServer) Context() context.Context {
 	return s.ctx
 }
 
+// queryShardFromSeriesRequest extracts the vertical shard of the query selected by the matchers of the
+// request, if any, and returns the request without its matcher.
+func queryShardFromSeriesRequest(req *storepb.SeriesRequest) (*astmapper.ShardAnnotation, *storepb.SeriesRequest, error) {
+	for i, matcher := range req.Matchers {
+		if matcher.Name != astmapper.QueryShardLabel {
+			continue
+		}
+		if matcher.Type != storepb.LabelMatcher_EQ {
+			return nil, nil, fmt.Errorf("unsupported matcher type for the %s label: %s", astmapper.QueryShardLabel, matcher.Type)
+		}
+
+		shard, err := astmapper.ParseShard(matcher.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sharded := *req
+		sharded.Matchers = make([]storepb.LabelMatcher, 0, len(req.Matchers)-1)
+		sharded.Matchers = append(sharded.Matchers, req.Matchers[:i]...)
+		sharded.Matchers = append(sharded.Matchers, req.Matchers[i+1:]...)
+		return &shard, &sharded, nil
+	}
+	return nil, req, nil
+}
+
+// queryShardSeriesServer sends only the series of the vertical shard of the query.
+type queryShardSeriesServer struct {
+	storepb.Store_SeriesServer
+
+	shard astmapper.ShardAnnotation
+}
+
+func (s queryShardSeriesServer) Send(r *storepb.SeriesResponse) error {
+	if series := r.GetSeries(); series != nil && !s.shard.ContainsSeries(series.PromLabels()) {
+		return nil
+	}
+	return s.Store_SeriesServer.Send(r)
+}
+
 type chunkLimiter struct {
 	limiter *store.Limiter
 }
@@ -618,12 +718,17 @@ func (c *chunkLimiter) Reserve(num uint64) error {
 	return nil
 }
 
-func newChunksLimiterFactory(limits *validation.Overrides, userID string) store.ChunksLimiterFactory {
+func newChunksLimiterFactory(limits *validation.Overrides, userID string, coldBlocks bool) store.ChunksLimiterFactory {
 	return func(failedCounter prometheus.Counter) store.ChunksLimiter {
 		// Since limit overrides could be live reloaded, we have to get the current user's limit
 		// each time a new limiter is instantiated.
+		limit := limits.MaxChunksPerQueryFromStore(userID)
+		if coldBlocks {
+			limit = limits.MaxChunksPerColdQueryFromStore(userID)
+		}
+
 		return &chunkLimiter{
-			limiter: store.NewLimiter(uint64(limits.MaxChunksPerQueryFromStore(userID)), failedCounter),
+			limiter: store.NewLimiter(uint64(limit), failedCounter),
 		}
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
@@ -15,6 +16,7 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/gogo/protobuf/types"
 	"github.com/oklog/ulid"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
@@ -24,16 +26,20 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block"
 	thanos_metadata "github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
 	"github.com/thanos-io/thanos/pkg/store/labelpb"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/logging"
 	"go.uber.org/atomic"
 	"google.golang.org/grpc/metadata"
 
+	"github.com/cortexproject/cortex/pkg/querier/astmapper"
 	"github.com/cortexproject/cortex/pkg/storage/bucket"
 	"github.com/cortexproject/cortex/pkg/storage/bucket/filesystem"
 	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
@@ -378,7 +384,7 @@ func testBucketStoresSeriesShouldCorrectlyQuerySeriesSpanningMultipleChunks(t *t
 	}
 }
 
-func prepareStorageConfig(t *testing.T) (cortex_tsdb.BlocksStorageConfig, func()) {
+func prepareStorageConfig(t testing.TB) (cortex_tsdb.BlocksStorageConfig, func()) {
 	tmpDir, err := ioutil.TempDir(os.TempDir(), "blocks-sync-*")
 	require.NoError(t, err)
 
@@ -393,7 +399,12 @@ func prepareStorageConfig(t *testing.T) (cortex_tsdb.BlocksStorageConfig, func()
 	return cfg, cleanup
 }
 
-func generateStorageBlock(t *testing.T, storageDir, userID string, metricName string, minT, maxT int64, step int) {
+func generateStorageBlock(t testing.TB, storageDir, userID string, metricName string, minT, maxT int64, step int) {
+	generateStorageBlockWithSeries(t, storageDir, userID, []string{metricName}, minT, maxT, step)
+}
+
+// generateStorageBlockWithSeries generates a single block with a series for each of the metric names.
+func generateStorageBlockWithSeries(t testing.TB, storageDir, userID string, metricNames []string, minT, maxT int64, step int) {
 	// Create a directory for the user (if doesn't already exist).
 	userDir := filepath.Join(storageDir, userID)
 	if _, err := os.Stat(userDir); err != nil {
@@ -414,12 +425,14 @@ func generateStorageBlock(t *testing.T, storageDir, userID string, metricName st
 		require.NoError(t, db.Close())
 	}()
 
-	series := labels.Labels{labels.Label{Name: labels.MetricName, Value: metricName}}
-
 	app := db.Appender(context.Background())
-	for ts := minT; ts < maxT; ts += int64(step) {
-		_, err = app.Append(0, series, ts, 1)
-		require.NoError(t, err)
+	for _, metricName := range metricNames {
+		series := labels.Labels{labels.Label{Name: labels.MetricName, Value: metricName}}
+
+		for ts := minT; ts < maxT; ts += int64(step) {
+			_, err = app.Append(0, series, ts, 1)
+			require.NoError(t, err)
+		}
 	}
 	require.NoError(t, app.Commit())
 
@@ -462,6 +475,121 @@ func setUserIDToGRPCContext(ctx context.Context, userID string) context.Context
 	return metadata.NewIncomingContext(ctx, metadata.Pairs(cortex_tsdb.TenantIDExternalLabel, userID))
 }
 
+func TestBucketStores_Series_ShouldFilterTheSeriesOfTheQueryShard(t *testing.T) {
+	const (
+		numBlocks = 15
+		numShards = 3
+	)
+
+	stores, blockIDs := prepareBucketStoresWithBlocks(t, numBlocks)
+
+	all, err := querySeriesOfBlocks(t, stores, blockIDs)
+	require.NoError(t, err)
+
+	// Each series is returned by exactly one shard.
+	var expected, sharded []string
+	for _, series := range all.SeriesSet {
+		expected = append(expected, series.PromLabels().String())
+	}
+	for shard := 0; shard < numShards; shard++ {
+		annotation := astmapper.ShardAnnotation{Shard: shard, Of: numShards}
+		res, err := querySeriesOfBlocks(t, stores, blockIDs, storepb.LabelMatcher{
+			Type:  storepb.LabelMatcher_EQ,
+			Name:  astmapper.QueryShardLabel,
+			Value: annotation.String(),
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, res.SeriesSet)
+
+		for _, series := range res.SeriesSet {
+			assert.True(t, annotation.ContainsSeries(series.PromLabels()))
+			sharded = append(sharded, series.PromLabels().String())
+		}
+	}
+	assert.ElementsMatch(t, expected, sharded)
+
+	t.Run("invalid shard", func(t *testing.T) {
+		stores, blockIDs := prepareBucketStoresWithBlocks(t, 1)
+
+		_, err := querySeriesOfBlocks(t, stores, blockIDs, storepb.LabelMatcher{
+			Type:  storepb.LabelMatcher_RE,
+			Name:  astmapper.QueryShardLabel,
+			Value: "1_of_3",
+		})
+		require.Error(t, err)
+
+		resp, ok := httpgrpc.HTTPResponseFromError(err)
+		require.True(t, ok)
+		assert.Equal(t, int32(http.StatusBadRequest), resp.Code)
+	})
+}
+
+const queryShardUserID = "user-1"
+
+// prepareBucketStoresWithBlocks generates the blocks, each with a series of its own and a series
+// shared by all the blocks, and returns the bucket stores serving them along with the IDs of the blocks.
+func prepareBucketStoresWithBlocks(t *testing.T, numBlocks int) (*BucketStores, []ulid.ULID) {
+	cfg, cleanup := prepareStorageConfig(t)
+	t.Cleanup(cleanup)
+
+	storageDir, err := ioutil.TempDir(os.TempDir(), "storage-*")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, os.RemoveAll(storageDir))
+	})
+
+	for i := 0; i < numBlocks; i++ {
+		generateStorageBlockWithSeries(t, storageDir, queryShardUserID, []string{"series_shared", fmt.Sprintf("series_%03d", i)}, int64(i*1000), int64((i+1)*1000), 10)
+	}
+
+	var blockIDs []ulid.ULID
+	entries, err := ioutil.ReadDir(filepath.Join(storageDir, queryShardUserID))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		if blockID, err := ulid.Parse(entry.Name()); err == nil {
+			blockIDs = append(blockIDs, blockID)
+		}
+	}
+
+	bucket, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	stores, err := NewBucketStores(cfg, NewNoShardingStrategy(), bucket, defaultLimitsOverrides(t), mockLoggingLevel(), log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, err)
+	require.NoError(t, stores.InitialSync(context.Background()))
+
+	return stores, blockIDs
+}
+
+// querySeriesOfBlocks queries the series of the given blocks, with the additional matchers.
+func querySeriesOfBlocks(t *testing.T, stores *BucketStores, blockIDs []ulid.ULID, matchers ...storepb.LabelMatcher) (*bucketStoreSeriesServer, error) {
+	blockIDValues := make([]string, 0, len(blockIDs))
+	for _, id := range blockIDs {
+		blockIDValues = append(blockIDValues, id.String())
+	}
+	anyHints, err := types.MarshalAny(&hintspb.SeriesRequestHints{BlockMatchers: []storepb.LabelMatcher{{
+		Type:  storepb.LabelMatcher_RE,
+		Name:  block.BlockIDLabel,
+		Value: strings.Join(blockIDValues, "|"),
+	}}})
+	require.NoError(t, err)
+
+	req := &storepb.SeriesRequest{
+		MinTime: 0,
+		MaxTime: int64(len(blockIDs) * 1000),
+		Matchers: append([]storepb.LabelMatcher{{
+			Type:  storepb.LabelMatcher_RE,
+			Name:  labels.MetricName,
+			Value: "series_.+",
+		}}, matchers...),
+		PartialResponseStrategy: storepb.PartialResponseStrategy_ABORT,
+		Hints:                   anyHints,
+	}
+
+	srv := newBucketStoreSeriesServer(setUserIDToGRPCContext(context.Background(), queryShardUserID))
+	return srv, stores.Series(req, srv)
+}
+
 func TestBucketStores_deleteLocalFilesForExcludedTenants(t *testing.T) {
 	const (
 		user1 = "user-1"
@@ -0,0 +1,110 @@
+package storegateway
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/extprom"
+
+	"github.com/cortexproject/cortex/pkg/ring"
+	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+const (
+	// coldBlocksCacheKeyPrefix is the prefix of the cache keys of the store-gateways serving the
+	// cold blocks, so that the cold blocks never evict the hot ones from a shared cache.
+	coldBlocksCacheKeyPrefix = "cold:"
+)
+
+// IsColdBlock returns whether the block with the given min time (milliseconds) is cold at the
+// given time. A minAge of 0 means the cold blocks are disabled.
+func IsColdBlock(minTime int64, now time.Time, minAge time.Duration) bool {
+	return minAge > 0 && minTime < util.TimeToMillis(now.Add(-minAge))
+}
+
+// coldBlocksShardingStrategy wraps a ShardingStrategy to make it aware of the store-gateway pools:
+// the store-gateways serving the cold blocks only keep the cold blocks, while the other ones only
+// keep the hot blocks, plus the cold blocks which are not available in the cold blocks pool.
+type coldBlocksShardingStrategy struct {
+	ShardingStrategy
+
+	serveColdBlocks bool
+	minAge          time.Duration
+
+	// How long the hot store-gateways keep serving a block once it becomes cold, to give the
+	// cold store-gateways enough time to load it before the queriers start querying it there.
+	handoverDelay time.Duration
+
+	// The ring of the cold store-gateways, used by the hot ones to check if a cold block is
+	// available in the cold pool. Nil on the cold store-gateways.
+	coldRing         *ring.Ring
+	shardingStrategy string
+	limits           ShardingLimits
+	logger           log.Logger
+}
+
+func newColdBlocksShardingStrategy(next ShardingStrategy, serveColdBlocks bool, minAge, handoverDelay time.Duration, coldRing *ring.Ring, shardingStrategy string, limits ShardingLimits, logger log.Logger) *coldBlocksShardingStrategy {
+	return &coldBlocksShardingStrategy{
+		ShardingStrategy: next,
+		serveColdBlocks:  serveColdBlocks,
+		minAge:           minAge,
+		handoverDelay:    handoverDelay,
+		coldRing:         coldRing,
+		shardingStrategy: shardingStrategy,
+		limits:           limits,
+		logger:           logger,
+	}
+}
+
+// FilterBlocks implements ShardingStrategy.
+func (s *coldBlocksShardingStrategy) FilterBlocks(ctx context.Context, userID string, metas map[ulid.ULID]*metadata.Meta, loaded map[ulid.ULID]struct{}, synced *extprom.TxGaugeVec) error {
+	now := time.Now()
+
+	if s.serveColdBlocks {
+		for blockID, meta := range metas {
+			if !IsColdBlock(meta.MinTime, now, s.minAge) {
+				synced.WithLabelValues(shardExcludedMeta).Inc()
+				delete(metas, blockID)
+			}
+		}
+	} else {
+		s.filterColdBlocksAvailableInColdPool(userID, metas, now, synced)
+	}
+
+	return s.ShardingStrategy.FilterBlocks(ctx, userID, metas, loaded, synced)
+}
+
+// filterColdBlocksAvailableInColdPool removes the cold blocks which can be queried from the cold
+// store-gateways, so that the hot store-gateways keep serving them when there's no cold pool.
+func (s *coldBlocksShardingStrategy) filterColdBlocksAvailableInColdPool(userID string, metas map[ulid.ULID]*metadata.Meta, now time.Time, synced *extprom.TxGaugeVec) {
+	if s.coldRing == nil {
+		return
+	}
+
+	var userRing ring.ReadRing = s.coldRing
+	if s.shardingStrategy == util.ShardingStrategyShuffle {
+		userRing = GetShuffleShardingSubring(s.coldRing, userID, s.limits)
+	}
+
+	bufDescs, bufHosts, bufZones := ring.MakeBuffersForGet()
+
+	for blockID, meta := range metas {
+		if !IsColdBlock(meta.MinTime, now.Add(-s.handoverDelay), s.minAge) {
+			continue
+		}
+
+		// The ring Get() returns an error if there's no ACTIVE instance owning the block.
+		if _, err := userRing.Get(cortex_tsdb.HashBlockID(blockID), BlocksOwnerRead, bufDescs, bufHosts, bufZones); err != nil {
+			level.Debug(s.logger).Log("msg", "cold block is kept because it's not available in the cold blocks pool", "block", blockID.String(), "err", err)
+			continue
+		}
+
+		synced.WithLabelValues(shardExcludedMeta).Inc()
+		delete(metas, blockID)
+	}
+}
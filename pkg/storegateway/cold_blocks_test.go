@@ -0,0 +1,125 @@
+package storegateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/extprom"
+
+	"github.com/cortexproject/cortex/pkg/ring"
+	"github.com/cortexproject/cortex/pkg/ring/kv/consul"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+func TestIsColdBlock(t *testing.T) {
+	now := time.Now()
+
+	assert.False(t, IsColdBlock(util.TimeToMillis(now.Add(-48*time.Hour)), now, 0))
+	assert.False(t, IsColdBlock(util.TimeToMillis(now.Add(-time.Hour)), now, 24*time.Hour))
+	assert.True(t, IsColdBlock(util.TimeToMillis(now.Add(-25*time.Hour)), now, 24*time.Hour))
+}
+
+func TestColdBlocksShardingStrategy(t *testing.T) {
+	const (
+		minAge        = 24 * time.Hour
+		handoverDelay = time.Hour
+	)
+
+	now := time.Now()
+	hotBlock := ulid.MustNew(1, nil)
+	recentColdBlock := ulid.MustNew(2, nil)
+	oldColdBlock := ulid.MustNew(3, nil)
+
+	tests := map[string]struct {
+		serveColdBlocks bool
+		setupColdRing   func(*ring.Desc)
+		expectedBlocks  []ulid.ULID
+	}{
+		"cold store-gateway should only keep the cold blocks": {
+			serveColdBlocks: true,
+			expectedBlocks:  []ulid.ULID{recentColdBlock, oldColdBlock},
+		},
+		"hot store-gateway should keep the cold blocks if there's no cold blocks ring": {
+			expectedBlocks: []ulid.ULID{hotBlock, recentColdBlock, oldColdBlock},
+		},
+		"hot store-gateway should keep the cold blocks if the cold blocks ring is empty": {
+			setupColdRing:  func(d *ring.Desc) {},
+			expectedBlocks: []ulid.ULID{hotBlock, recentColdBlock, oldColdBlock},
+		},
+		"hot store-gateway should keep the cold blocks if no cold store-gateway is ACTIVE": {
+			setupColdRing: func(d *ring.Desc) {
+				d.AddIngester("instance-1", "127.0.0.1", "", []uint32{1}, ring.JOINING, now)
+			},
+			expectedBlocks: []ulid.ULID{hotBlock, recentColdBlock, oldColdBlock},
+		},
+		"hot store-gateway should drop the cold blocks available in the cold blocks ring, after the handover delay": {
+			setupColdRing: func(d *ring.Desc) {
+				d.AddIngester("instance-1", "127.0.0.1", "", []uint32{1}, ring.ACTIVE, now)
+			},
+			expectedBlocks: []ulid.ULID{hotBlock, recentColdBlock},
+		},
+	}
+
+	for testName, testData := range tests {
+		testName := testName
+		testData := testData
+
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+
+			var coldRing *ring.Ring
+			if testData.setupColdRing != nil {
+				store := consul.NewInMemoryClient(ring.GetCodec())
+				require.NoError(t, store.CAS(ctx, ColdRingKey, func(in interface{}) (interface{}, bool, error) {
+					d := ring.NewDesc()
+					testData.setupColdRing(d)
+					return d, true, nil
+				}))
+
+				var err error
+				coldRing, err = ring.NewWithStoreClientAndStrategy(ring.Config{ReplicationFactor: 1, HeartbeatTimeout: time.Minute}, ColdRingNameForServer, ColdRingKey, store, ring.NewIgnoreUnhealthyInstancesReplicationStrategy())
+				require.NoError(t, err)
+				require.NoError(t, services.StartAndAwaitRunning(ctx, coldRing))
+				defer services.StopAndAwaitTerminated(ctx, coldRing) //nolint:errcheck
+			}
+
+			strategy := newColdBlocksShardingStrategy(NewNoShardingStrategy(), testData.serveColdBlocks, minAge, handoverDelay, coldRing, util.ShardingStrategyDefault, nil, log.NewNopLogger())
+			synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{}, []string{"state"})
+			synced.WithLabelValues(shardExcludedMeta).Set(0)
+
+			metas := map[ulid.ULID]*metadata.Meta{
+				hotBlock:        newBlockMetaWithMinTime(now.Add(-time.Hour)),
+				recentColdBlock: newBlockMetaWithMinTime(now.Add(-minAge - handoverDelay/2)),
+				oldColdBlock:    newBlockMetaWithMinTime(now.Add(-2 * minAge)),
+			}
+
+			require.NoError(t, strategy.FilterBlocks(ctx, "user-1", metas, map[ulid.ULID]struct{}{}, synced))
+
+			var actualBlocks []ulid.ULID
+			for id := range metas {
+				actualBlocks = append(actualBlocks, id)
+			}
+			assert.ElementsMatch(t, testData.expectedBlocks, actualBlocks)
+
+			synced.Submit()
+			assert.Equal(t, float64(3-len(testData.expectedBlocks)), testutil.ToFloat64(synced))
+		})
+	}
+}
+
+func newBlockMetaWithMinTime(minTime time.Time) *metadata.Meta {
+	meta := &metadata.Meta{}
+	meta.MinTime = util.TimeToMillis(minTime)
+	return meta
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -17,12 +18,14 @@ import (
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/weaveworks/common/logging"
+	"google.golang.org/grpc/metadata"
 
 	"github.com/cortexproject/cortex/pkg/ring"
 	"github.com/cortexproject/cortex/pkg/ring/kv"
 	"github.com/cortexproject/cortex/pkg/storage/bucket"
 	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
 	"github.com/cortexproject/cortex/pkg/storegateway/storegatewaypb"
+	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/validation"
 )
@@ -47,6 +50,8 @@ var (
 	// Validation errors.
 	errInvalidShardingStrategy = errors.New("invalid sharding strategy")
 	errInvalidTenantShardSize  = errors.New("invalid tenant shard size, the value must be greater than 0")
+	errColdBlocksMinAgeMissing = errors.New("serving the cold blocks requires the cold blocks min age to be greater than 0")
+	errColdBlocksNoSharding    = errors.New("the cold blocks are supported only when sharding is enabled")
 )
 
 // Config holds the store gateway config.
@@ -54,6 +59,10 @@ type Config struct {
 	ShardingEnabled  bool       `yaml:"sharding_enabled"`
 	ShardingRing     RingConfig `yaml:"sharding_ring" doc:"description=The hash ring configuration. This option is required only if blocks sharding is enabled."`
 	ShardingStrategy string     `yaml:"sharding_strategy"`
+
+	// Cold blocks.
+	ColdBlocksMinAge time.Duration `yaml:"cold_blocks_min_age"`
+	ServeColdBlocks  bool          `yaml:"serve_cold_blocks"`
 }
 
 // RegisterFlags registers the Config flags.
@@ -62,6 +71,8 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 
 	f.BoolVar(&cfg.ShardingEnabled, "store-gateway.sharding-enabled", false, "Shard blocks across multiple store gateway instances."+sharedOptionWithQuerier)
 	f.StringVar(&cfg.ShardingStrategy, "store-gateway.sharding-strategy", util.ShardingStrategyDefault, fmt.Sprintf("The sharding strategy to use. Supported values are: %s.", strings.Join(supportedShardingStrategies, ", ")))
+	f.DurationVar(&cfg.ColdBlocksMinAge, "store-gateway.cold-blocks-min-age", 0, "Blocks whose min time is older than this age are cold. The cold blocks are served by the store-gateways started with -store-gateway.serve-cold-blocks, or by the other store-gateways if the cold blocks are not available there. Requires sharding to be enabled. 0 to disable."+sharedOptionWithQuerier)
+	f.BoolVar(&cfg.ServeColdBlocks, "store-gateway.serve-cold-blocks", false, "Load and serve only the cold blocks. The store-gateway joins a separate ring, enforces the cold queries limits and uses a separate namespace in the index, chunks and metadata caches.")
 }
 
 // Validate the Config.
@@ -76,6 +87,14 @@ func (cfg *Config) Validate(limits validation.Limits) error {
 		}
 	}
 
+	if cfg.ServeColdBlocks && !cfg.ShardingEnabled {
+		return errColdBlocksNoSharding
+	}
+
+	if cfg.ServeColdBlocks && cfg.ColdBlocksMinAge <= 0 {
+		return errColdBlocksMinAgeMissing
+	}
+
 	return nil
 }
 
@@ -94,11 +113,17 @@ type StoreGateway struct {
 	ringLifecycler *ring.BasicLifecycler
 	ring           *ring.Ring
 
+	// Ring of the store gateways serving the cold blocks, watched by the other store gateways.
+	coldRing *ring.Ring
+
 	// Subservices manager (ring, lifecycler)
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
 
 	bucketSync *prometheus.CounterVec
+
+	// Prefetch requests warming up the caches.
+	prefetchJobs *PrefetchJobs
 }
 
 func NewStoreGateway(gatewayCfg Config, storageCfg cortex_tsdb.BlocksStorageConfig, limits *validation.Overrides, logLevel logging.Level, logger log.Logger, reg prometheus.Registerer) (*StoreGateway, error) {
@@ -154,16 +179,22 @@ func newStoreGateway(gatewayCfg Config, storageCfg cortex_tsdb.BlocksStorageConf
 		// chained via "next delegate").
 		delegate := ring.BasicLifecyclerDelegate(g)
 		delegate = ring.NewLeaveOnStoppingDelegate(delegate, logger)
-		delegate = ring.NewTokensPersistencyDelegate(gatewayCfg.ShardingRing.TokensFilePath, ring.JOINING, delegate, logger)
+		delegate = ring.NewTokensPersistencyDelegate(gatewayCfg.ShardingRing.TokensFilePath, ring.JOINING, gatewayCfg.ShardingRing.TokensFileDiscardOnMismatch, delegate, logger)
 		delegate = ring.NewAutoForgetDelegate(ringAutoForgetUnhealthyPeriods*gatewayCfg.ShardingRing.HeartbeatTimeout, delegate, logger)
 
-		g.ringLifecycler, err = ring.NewBasicLifecycler(lifecyclerCfg, RingNameForServer, RingKey, ringStore, delegate, logger, reg)
+		// The store gateways serving the cold blocks form their own ring.
+		ringName, ringKey := RingNameForServer, RingKey
+		if gatewayCfg.ServeColdBlocks {
+			ringName, ringKey = ColdRingNameForServer, ColdRingKey
+		}
+
+		g.ringLifecycler, err = ring.NewBasicLifecycler(lifecyclerCfg, ringName, ringKey, ringStore, delegate, logger, reg)
 		if err != nil {
 			return nil, errors.Wrap(err, "create ring lifecycler")
 		}
 
 		ringCfg := gatewayCfg.ShardingRing.ToRingConfig()
-		g.ring, err = ring.NewWithStoreClientAndStrategy(ringCfg, RingNameForServer, RingKey, ringStore, ring.NewIgnoreUnhealthyInstancesReplicationStrategy())
+		g.ring, err = ring.NewWithStoreClientAndStrategy(ringCfg, ringName, ringKey, ringStore, ring.NewIgnoreUnhealthyInstancesReplicationStrategy())
 		if err != nil {
 			return nil, errors.Wrap(err, "create ring client")
 		}
@@ -172,6 +203,18 @@ func newStoreGateway(gatewayCfg Config, storageCfg cortex_tsdb.BlocksStorageConf
 			reg.MustRegister(g.ring)
 		}
 
+		// The other store gateways keep serving the cold blocks which are not available in the cold blocks ring.
+		if gatewayCfg.ColdBlocksMinAge > 0 && !gatewayCfg.ServeColdBlocks {
+			g.coldRing, err = ring.NewWithStoreClientAndStrategy(ringCfg, ColdRingNameForServer, ColdRingKey, ringStore, ring.NewIgnoreUnhealthyInstancesReplicationStrategy())
+			if err != nil {
+				return nil, errors.Wrap(err, "create cold blocks ring client")
+			}
+
+			if reg != nil {
+				reg.MustRegister(g.coldRing)
+			}
+		}
+
 		// Instance the right strategy.
 		switch gatewayCfg.ShardingStrategy {
 		case util.ShardingStrategyDefault:
@@ -181,6 +224,20 @@ func newStoreGateway(gatewayCfg Config, storageCfg cortex_tsdb.BlocksStorageConf
 		default:
 			return nil, errInvalidShardingStrategy
 		}
+
+		if gatewayCfg.ColdBlocksMinAge > 0 {
+			// The hot store gateways keep serving a cold block for a couple of sync intervals
+			// after it has been loaded by the cold store gateways.
+			handoverDelay := 2 * storageCfg.BucketStore.SyncInterval
+			shardingStrategy = newColdBlocksShardingStrategy(shardingStrategy, gatewayCfg.ServeColdBlocks, gatewayCfg.ColdBlocksMinAge, handoverDelay, g.coldRing, gatewayCfg.ShardingStrategy, limits, logger)
+		}
+
+		if gatewayCfg.ServeColdBlocks {
+			storageCfg.BucketStore.ServeColdBlocks = true
+			storageCfg.BucketStore.IndexCache.Memcached.KeyPrefix = coldBlocksCacheKeyPrefix
+			storageCfg.BucketStore.ChunksCache.Memcached.KeyPrefix = coldBlocksCacheKeyPrefix
+			storageCfg.BucketStore.MetadataCache.Memcached.KeyPrefix = coldBlocksCacheKeyPrefix
+		}
 	} else {
 		shardingStrategy = NewNoShardingStrategy()
 	}
@@ -190,6 +247,8 @@ func newStoreGateway(gatewayCfg Config, storageCfg cortex_tsdb.BlocksStorageConf
 		return nil, errors.Wrap(err, "create bucket stores")
 	}
 
+	g.prefetchJobs = NewPrefetchJobs(g.prefetch, limits, logger, prometheus.WrapRegistererWith(prometheus.Labels{"component": "store-gateway"}, reg))
+
 	g.Service = services.NewBasicService(g.starting, g.running, g.stopping)
 
 	return g, nil
@@ -212,7 +271,12 @@ func (g *StoreGateway) starting(ctx context.Context) (err error) {
 	if g.gatewayCfg.ShardingEnabled {
 		// First of all we register the instance in the ring and wait
 		// until the lifecycler successfully started.
-		if g.subservices, err = services.NewManager(g.ringLifecycler, g.ring); err != nil {
+		deps := []services.Service{g.ringLifecycler, g.ring}
+		if g.coldRing != nil {
+			deps = append(deps, g.coldRing)
+		}
+
+		if g.subservices, err = services.NewManager(deps...); err != nil {
 			return errors.Wrap(err, "unable to start store-gateway dependencies")
 		}
 
@@ -346,6 +410,50 @@ func (g *StoreGateway) LabelValues(ctx context.Context, req *storepb.LabelValues
 	return g.stores.LabelValues(ctx, req)
 }
 
+// PrefetchHandler starts a job looking up the series matching the request in the blocks
+// of the tenant loaded by this store-gateway, in order to load their index headers and
+// populate the index cache.
+func (g *StoreGateway) PrefetchHandler(w http.ResponseWriter, r *http.Request) {
+	g.prefetchJobs.StartHandler(w, r)
+}
+
+// PrefetchStatusHandler returns the status of a prefetch job.
+func (g *StoreGateway) PrefetchStatusHandler(w http.ResponseWriter, r *http.Request) {
+	g.prefetchJobs.StatusHandler(w, r)
+}
+
+func (g *StoreGateway) prefetch(ctx context.Context, req PrefetchRequest) (int, error) {
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// The bucket stores read the tenant from the gRPC metadata.
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(cortex_tsdb.TenantIDExternalLabel, userID))
+
+	seriesCount := 0
+	for _, matchers := range req.Matchers {
+		converted, err := storepb.PromMatchersToMatchers(matchers...)
+		if err != nil {
+			return seriesCount, err
+		}
+
+		srv := &prefetchSeriesServer{ctx: ctx}
+		err = g.stores.Series(&storepb.SeriesRequest{
+			MinTime:    req.MinT,
+			MaxTime:    req.MaxT,
+			Matchers:   converted,
+			SkipChunks: true,
+		}, srv)
+		seriesCount += srv.seriesCount
+		if err != nil {
+			return seriesCount, err
+		}
+	}
+
+	return seriesCount, nil
+}
+
 func (g *StoreGateway) OnRingInstanceRegister(_ *ring.BasicLifecycler, ringDesc ring.Desc, instanceExists bool, instanceID string, instanceDesc ring.InstanceDesc) (ring.InstanceState, ring.Tokens) {
 	// When we initialize the store-gateway instance in the ring we want to start from
 	// a clean situation, so whatever is the state we set it JOINING, while we keep existing
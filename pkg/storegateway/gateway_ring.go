@@ -25,6 +25,16 @@ const (
 	// a different name to avoid clashing Prometheus metrics when running in single-binary).
 	RingNameForClient = "store-gateway-client"
 
+	// ColdRingKey is the key under which we store the ring of the store gateways serving
+	// the cold blocks in the KVStore.
+	ColdRingKey = "store-gateway-cold"
+
+	// ColdRingNameForServer is the name of the cold blocks ring used by the store gateway server.
+	ColdRingNameForServer = "store-gateway-cold"
+
+	// ColdRingNameForClient is the name of the cold blocks ring used by the store gateway client.
+	ColdRingNameForClient = "store-gateway-cold-client"
+
 	// We use a safe default instead of exposing to config option to the user
 	// in order to simplify the config.
 	RingNumTokens = 512
@@ -59,12 +69,13 @@ var (
 // is used to strip down the config to the minimum, and avoid confusion
 // to the user.
 type RingConfig struct {
-	KVStore              kv.Config     `yaml:"kvstore" doc:"description=The key-value store used to share the hash ring across multiple instances. This option needs be set both on the store-gateway and querier when running in microservices mode."`
-	HeartbeatPeriod      time.Duration `yaml:"heartbeat_period"`
-	HeartbeatTimeout     time.Duration `yaml:"heartbeat_timeout"`
-	ReplicationFactor    int           `yaml:"replication_factor"`
-	TokensFilePath       string        `yaml:"tokens_file_path"`
-	ZoneAwarenessEnabled bool          `yaml:"zone_awareness_enabled"`
+	KVStore                     kv.Config     `yaml:"kvstore" doc:"description=The key-value store used to share the hash ring across multiple instances. This option needs be set both on the store-gateway and querier when running in microservices mode."`
+	HeartbeatPeriod             time.Duration `yaml:"heartbeat_period"`
+	HeartbeatTimeout            time.Duration `yaml:"heartbeat_timeout"`
+	ReplicationFactor           int           `yaml:"replication_factor"`
+	TokensFilePath              string        `yaml:"tokens_file_path"`
+	TokensFileDiscardOnMismatch bool          `yaml:"tokens_file_discard_on_mismatch"`
+	ZoneAwarenessEnabled        bool          `yaml:"zone_awareness_enabled"`
 
 	// Wait ring stability.
 	WaitStabilityMinDuration time.Duration `yaml:"wait_stability_min_duration"`
@@ -98,6 +109,7 @@ func (cfg *RingConfig) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.HeartbeatTimeout, ringFlagsPrefix+"heartbeat-timeout", time.Minute, "The heartbeat timeout after which store gateways are considered unhealthy within the ring. 0 = never (timeout disabled)."+sharedOptionWithQuerier)
 	f.IntVar(&cfg.ReplicationFactor, ringFlagsPrefix+"replication-factor", 3, "The replication factor to use when sharding blocks."+sharedOptionWithQuerier)
 	f.StringVar(&cfg.TokensFilePath, ringFlagsPrefix+"tokens-file-path", "", "File path where tokens are stored. If empty, tokens are not stored at shutdown and restored at startup.")
+	f.BoolVar(&cfg.TokensFileDiscardOnMismatch, ringFlagsPrefix+"tokens-file-discard-on-mismatch", false, "True to discard the tokens loaded from the tokens file, and generate new ones, if the file has been stored by an instance with a different ID or in a different availability zone.")
 	f.BoolVar(&cfg.ZoneAwarenessEnabled, ringFlagsPrefix+"zone-awareness-enabled", false, "True to enable zone-awareness and replicate blocks across different availability zones.")
 
 	// Wait stability flags.
@@ -1,6 +1,7 @@
 package storegateway
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -79,6 +80,28 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expected: nil,
 		},
+		"should fail if serving the cold blocks without sharding": {
+			setup: func(cfg *Config, limits *validation.Limits) {
+				cfg.ServeColdBlocks = true
+				cfg.ColdBlocksMinAge = 24 * time.Hour
+			},
+			expected: errColdBlocksNoSharding,
+		},
+		"should fail if serving the cold blocks without the cold blocks min age": {
+			setup: func(cfg *Config, limits *validation.Limits) {
+				cfg.ShardingEnabled = true
+				cfg.ServeColdBlocks = true
+			},
+			expected: errColdBlocksMinAgeMissing,
+		},
+		"should pass if serving the cold blocks with sharding and the cold blocks min age": {
+			setup: func(cfg *Config, limits *validation.Limits) {
+				cfg.ShardingEnabled = true
+				cfg.ServeColdBlocks = true
+				cfg.ColdBlocksMinAge = 24 * time.Hour
+			},
+			expected: nil,
+		},
 	}
 
 	for testName, testData := range tests {
@@ -173,6 +196,37 @@ func TestStoreGateway_InitialSyncWithDefaultShardingEnabled(t *testing.T) {
 	}
 }
 
+func TestStoreGateway_ShouldJoinTheColdBlocksRingWhenServingTheColdBlocks(t *testing.T) {
+	ctx := context.Background()
+	gatewayCfg := mockGatewayConfig()
+	gatewayCfg.ShardingEnabled = true
+	gatewayCfg.ServeColdBlocks = true
+	gatewayCfg.ColdBlocksMinAge = 24 * time.Hour
+	storageCfg := mockStorageConfig(t)
+	ringStore := consul.NewInMemoryClient(ring.GetCodec())
+	bucketClient := &bucket.ClientMock{}
+	bucketClient.MockIter("", []string{}, nil)
+
+	g, err := newStoreGateway(gatewayCfg, storageCfg, bucketClient, ringStore, defaultLimitsOverrides(t), mockLoggingLevel(), log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, g))
+	defer services.StopAndAwaitTerminated(ctx, g) //nolint:errcheck
+
+	// The store-gateway should be registered in the cold blocks ring only.
+	coldRing, err := ringStore.Get(ctx, ColdRingKey)
+	require.NoError(t, err)
+	require.NotNil(t, coldRing)
+	assert.Contains(t, coldRing.(*ring.Desc).GetIngesters(), gatewayCfg.ShardingRing.InstanceID)
+
+	hotRing, err := ringStore.Get(ctx, RingKey)
+	require.NoError(t, err)
+	assert.Nil(t, hotRing)
+
+	// The bucket stores should enforce the cold limits and use a separate cache namespace.
+	assert.True(t, g.stores.cfg.BucketStore.ServeColdBlocks)
+	assert.Equal(t, coldBlocksCacheKeyPrefix, g.stores.cfg.BucketStore.ChunksCache.Memcached.KeyPrefix)
+}
+
 func TestStoreGateway_InitialSyncWithShardingDisabled(t *testing.T) {
 	ctx := context.Background()
 	gatewayCfg := mockGatewayConfig()
@@ -873,6 +927,94 @@ func TestStoreGateway_SeriesQueryingShouldRemoveExternalLabels(t *testing.T) {
 	}
 }
 
+func TestStoreGateway_SeriesQueryingShouldDecryptTheClientSideEncryptedBlocks(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	userID := "user-1"
+
+	localDir, err := ioutil.TempDir(os.TempDir(), "")
+	require.NoError(t, err)
+	defer os.RemoveAll(localDir) //nolint:errcheck
+
+	storageDir, err := ioutil.TempDir(os.TempDir(), "")
+	require.NoError(t, err)
+	defer os.RemoveAll(storageDir) //nolint:errcheck
+
+	// Generate a TSDB block with more series than the ones fitting an encrypted segment.
+	numSeries := 5000
+	now := time.Now()
+	minT := now.Add(-1*time.Hour).Unix() * 1000
+	maxT := now.Unix() * 1000
+	step := (maxT - minT) / int64(numSeries)
+	mockTSDB(t, path.Join(localDir, userID), numSeries, 0, minT, maxT)
+
+	keys, err := bucket.NewKeyringDataKeyProvider(map[string][]byte{"key-1": []byte("0123456789abcdef0123456789abcdef")})
+	require.NoError(t, err)
+
+	rawBucketClient, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+	bucketClient := bucket.NewClientSideEncryptionBucketClient(rawBucketClient, keys)
+
+	// Upload the block on behalf of the tenant, with the client-side encryption enabled.
+	limits := defaultLimitsConfig()
+	limits.ClientSideEncryptionKeyID = "key-1"
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	userBucketClient := bucket.NewUserBucketClient(userID, bucketClient, overrides)
+	require.NoError(t, objstore.UploadDir(ctx, logger, userBucketClient, path.Join(localDir, userID), ""))
+
+	// Ensure the block index has been encrypted.
+	var blockIDs []string
+	require.NoError(t, rawBucketClient.Iter(ctx, userID+"/", func(key string) error {
+		if id, ok := block.IsBlockDir(key); ok {
+			blockIDs = append(blockIDs, id.String())
+		}
+		return nil
+	}))
+	require.Len(t, blockIDs, 1)
+
+	rawIndex, err := ioutil.ReadFile(filepath.Join(storageDir, userID, blockIDs[0], block.IndexFilename))
+	require.NoError(t, err)
+	assert.False(t, bytes.HasPrefix(rawIndex, []byte{0xBA, 0xAA, 0xD7, 0x00}))
+	assert.FileExists(t, filepath.Join(storageDir, userID, blockIDs[0], "client-side-encryption", block.IndexFilename+".json"))
+
+	// Create a store-gateway used to query back the series from the blocks.
+	gatewayCfg := mockGatewayConfig()
+	gatewayCfg.ShardingEnabled = false
+	storageCfg := mockStorageConfig(t)
+
+	g, err := newStoreGateway(gatewayCfg, storageCfg, bucketClient, nil, overrides, mockLoggingLevel(), logger, nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, g))
+	defer services.StopAndAwaitTerminated(ctx, g) //nolint:errcheck
+
+	req := &storepb.SeriesRequest{
+		MinTime: minT,
+		MaxTime: maxT,
+		Matchers: []storepb.LabelMatcher{
+			{Type: storepb.LabelMatcher_RE, Name: "series_id", Value: ".+"},
+		},
+	}
+
+	srv := newBucketStoreSeriesServer(setUserIDToGRPCContext(ctx, userID))
+	require.NoError(t, g.Series(req, srv))
+	assert.Empty(t, srv.Warnings)
+	require.Len(t, srv.SeriesSet, numSeries)
+
+	for _, actual := range srv.SeriesSet {
+		require.Len(t, actual.Labels, 1)
+		seriesID, err := strconv.Atoi(actual.Labels[0].Value)
+		require.NoError(t, err)
+
+		samples, err := readSamplesFromChunks(actual.Chunks)
+		require.NoError(t, err)
+		assert.Equal(t, []sample{
+			{ts: minT + (step * int64(seriesID)), value: float64(seriesID)},
+		}, samples)
+	}
+}
+
 func TestStoreGateway_SeriesQueryingShouldEnforceMaxChunksPerQueryLimit(t *testing.T) {
 	const chunksQueried = 10
 
@@ -961,6 +1103,63 @@ func TestStoreGateway_SeriesQueryingShouldEnforceMaxChunksPerQueryLimit(t *testi
 	}
 }
 
+func TestStoreGateway_LabelNamesShouldApplyTheMatchers(t *testing.T) {
+	const numSeries = 10
+
+	ctx := context.Background()
+	userID := "user-1"
+
+	storageDir, err := ioutil.TempDir(os.TempDir(), "")
+	require.NoError(t, err)
+	defer os.RemoveAll(storageDir) //nolint:errcheck
+
+	now := time.Now()
+	minT := now.Add(-1*time.Hour).Unix() * 1000
+	maxT := now.Unix() * 1000
+	mockTSDB(t, path.Join(storageDir, userID), numSeries, 0, minT, maxT)
+
+	bucketClient, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	gatewayCfg := mockGatewayConfig()
+	gatewayCfg.ShardingEnabled = false
+	storageCfg := mockStorageConfig(t)
+
+	g, err := newStoreGateway(gatewayCfg, storageCfg, bucketClient, nil, defaultLimitsOverrides(t), mockLoggingLevel(), log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, g))
+	defer services.StopAndAwaitTerminated(ctx, g) //nolint:errcheck
+
+	tests := map[string]struct {
+		matchers []storepb.LabelMatcher
+		expected []string
+	}{
+		"without matchers": {
+			expected: []string{"series_id"},
+		},
+		"with matchers matching some series": {
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "series_id", Value: "1"}},
+			expected: []string{"series_id"},
+		},
+		"with matchers not matching any series": {
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "series_id", Value: "unknown"}},
+			expected: nil,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			res, err := g.LabelNames(setUserIDToGRPCContext(ctx, userID), &storepb.LabelNamesRequest{
+				Start:    minT,
+				End:      maxT,
+				Matchers: testData.matchers,
+			})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, testData.expected, res.Names)
+		})
+	}
+}
+
 func mockGatewayConfig() Config {
 	cfg := Config{}
 	flagext.DefaultValues(&cfg)
@@ -0,0 +1,442 @@
+package storegateway
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/indexheader"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/extprom"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+
+	"github.com/cortexproject/cortex/pkg/storage/tsdb"
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+)
+
+const (
+	// Blocks whose index-header has been written more recently than this period are
+	// considered loading, and never evicted.
+	localCacheLoadingGracePeriod = time.Minute
+
+	// Suffix of the temporary files written while an index-header is being built.
+	tmpFileSuffix = ".tmp"
+
+	// Suffix of the index-headers being prewarmed, renamed once completed.
+	prewarmFileSuffix = ".prewarm"
+)
+
+// localCache keeps the blocks data (index-headers) stored on the local disk by the
+// store-gateway within a size budget, evicting the least recently queried blocks, and
+// optionally prewarms the index-headers of the newest blocks after each sync.
+type localCache struct {
+	cfg         tsdb.LocalCacheConfig
+	dir         string
+	idleTimeout time.Duration
+	logger      log.Logger
+
+	mtx sync.Mutex
+	// Last time each block has been queried, by tenant.
+	lastQueried map[string]map[ulid.ULID]time.Time
+	// Blocks owned by this store-gateway, by tenant.
+	metas map[string]map[ulid.ULID]*metadata.Meta
+
+	// Metrics.
+	sizeBytes       prometheus.Gauge
+	blocks          prometheus.Gauge
+	evictions       prometheus.Counter
+	evictedBytes    prometheus.Counter
+	prewarmPending  prometheus.Gauge
+	prewarmedBlocks prometheus.Counter
+	prewarmFailures prometheus.Counter
+}
+
+func newLocalCache(cfg tsdb.BucketStoreConfig, logger log.Logger, reg prometheus.Registerer) *localCache {
+	return &localCache{
+		cfg:         cfg.LocalCache,
+		dir:         cfg.SyncDir,
+		idleTimeout: cfg.IndexHeaderLazyLoadingIdleTimeout,
+		logger:      logger,
+		lastQueried: map[string]map[ulid.ULID]time.Time{},
+		metas:       map[string]map[ulid.ULID]*metadata.Meta{},
+
+		sizeBytes: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_bucket_stores_local_cache_size_bytes",
+			Help: "Disk space used by the blocks data stored on the local disk.",
+		}),
+		blocks: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_bucket_stores_local_cache_blocks",
+			Help: "Number of blocks with data stored on the local disk.",
+		}),
+		evictions: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_stores_local_cache_evictions_total",
+			Help: "Total number of blocks whose local data has been evicted because the local cache max size was exceeded.",
+		}),
+		evictedBytes: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_stores_local_cache_evicted_bytes_total",
+			Help: "Total number of bytes evicted from the local disk because the local cache max size was exceeded.",
+		}),
+		prewarmPending: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_bucket_stores_local_cache_prewarm_pending_blocks",
+			Help: "Number of blocks whose index-header is waiting to be prewarmed.",
+		}),
+		prewarmedBlocks: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_stores_local_cache_prewarmed_blocks_total",
+			Help: "Total number of blocks whose index-header has been prewarmed.",
+		}),
+		prewarmFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_bucket_stores_local_cache_prewarm_failures_total",
+			Help: "Total number of blocks whose index-header failed to be prewarmed.",
+		}),
+	}
+}
+
+// metadataFilter returns a filter which keeps track of the blocks owned by this
+// store-gateway. It must be the last filter of the user's metadata fetcher.
+func (c *localCache) metadataFilter(userID string) block.MetadataFilter {
+	return &localCacheMetadataFilter{userID: userID, cache: c}
+}
+
+// touch records the blocks queried by the request block matchers.
+func (c *localCache) touch(userID string, matchers []storepb.LabelMatcher, now time.Time) {
+	blockIDs := blockIDsFromMatchers(matchers)
+	if len(blockIDs) == 0 {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	userBlocks := c.lastQueried[userID]
+	if userBlocks == nil {
+		userBlocks = map[ulid.ULID]time.Time{}
+		c.lastQueried[userID] = userBlocks
+	}
+
+	for _, blockID := range blockIDs {
+		userBlocks[blockID] = now
+	}
+}
+
+// removeUser forgets about the tenant, once it's not owned by this store-gateway anymore.
+func (c *localCache) removeUser(userID string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.lastQueried, userID)
+	delete(c.metas, userID)
+}
+
+// sync must be called after each blocks sync, when no block is being added to the
+// stores. It prewarms the newest blocks (if enabled) and then enforces the max size.
+func (c *localCache) sync(ctx context.Context, bucketForUser func(userID string) objstore.BucketReader, now time.Time) {
+	if c.cfg.PrewarmPeriod > 0 {
+		c.prewarm(ctx, bucketForUser, now)
+	}
+
+	blocks := c.scan()
+
+	if c.cfg.MaxSizeBytes > 0 {
+		blocks = c.evict(blocks, now)
+	}
+
+	size := int64(0)
+	for _, b := range blocks {
+		size += b.size
+	}
+	c.sizeBytes.Set(float64(size))
+	c.blocks.Set(float64(len(blocks)))
+}
+
+// localBlock holds the local disk usage of a block.
+type localBlock struct {
+	userID  string
+	blockID ulid.ULID
+
+	// Total size of the files in the block directory.
+	size int64
+
+	// Size and last modification time of the index-header. Size is 0 if there's no index-header.
+	indexHeaderSize    int64
+	indexHeaderModTime time.Time
+
+	// Whether an index-header is currently being written.
+	loading bool
+}
+
+func (b localBlock) indexHeaderPath(dir string) string {
+	return filepath.Join(dir, b.userID, b.blockID.String(), block.IndexHeaderFilename)
+}
+
+// scan returns the local disk usage of all blocks in the sync directory.
+func (c *localCache) scan() []localBlock {
+	var blocks []localBlock
+
+	users, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			level.Warn(c.logger).Log("msg", "failed to read the local cache directory", "dir", c.dir, "err", err)
+		}
+		return nil
+	}
+
+	for _, user := range users {
+		if !user.IsDir() {
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(filepath.Join(c.dir, user.Name()))
+		if err != nil {
+			level.Warn(c.logger).Log("msg", "failed to read the user local cache directory", "user", user.Name(), "err", err)
+			continue
+		}
+
+		for _, entry := range entries {
+			// Skip any directory which is not a block (eg. meta-syncer).
+			blockID, err := ulid.Parse(entry.Name())
+			if err != nil || !entry.IsDir() {
+				continue
+			}
+
+			b, err := scanBlock(filepath.Join(c.dir, user.Name(), entry.Name()))
+			if err != nil {
+				level.Warn(c.logger).Log("msg", "failed to read the block local cache directory", "user", user.Name(), "block", blockID.String(), "err", err)
+				continue
+			}
+
+			b.userID = user.Name()
+			b.blockID = blockID
+			blocks = append(blocks, b)
+		}
+	}
+
+	return blocks
+}
+
+func scanBlock(dir string) (localBlock, error) {
+	b := localBlock{}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return b, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		b.size += f.Size()
+
+		switch {
+		case f.Name() == block.IndexHeaderFilename:
+			b.indexHeaderSize = f.Size()
+			b.indexHeaderModTime = f.ModTime()
+		case strings.HasSuffix(f.Name(), tmpFileSuffix) || strings.HasSuffix(f.Name(), prewarmFileSuffix):
+			b.loading = true
+		}
+	}
+
+	return b, nil
+}
+
+// evict removes the index-headers of the least recently used blocks until the local disk
+// usage is within the max size, and returns the blocks with the updated disk usage.
+func (c *localCache) evict(blocks []localBlock, now time.Time) []localBlock {
+	size := int64(0)
+	for _, b := range blocks {
+		size += b.size
+	}
+
+	maxSize := int64(c.cfg.MaxSizeBytes)
+	if size <= maxSize {
+		return blocks
+	}
+
+	// Find the blocks which are safe to evict, and sort them by last usage.
+	candidates := make([]int, 0, len(blocks))
+	lastUsed := make(map[int]time.Time, len(blocks))
+
+	c.mtx.Lock()
+	for i, b := range blocks {
+		if b.indexHeaderSize == 0 || b.loading || now.Sub(b.indexHeaderModTime) < localCacheLoadingGracePeriod {
+			continue
+		}
+
+		// A recently queried block is likely loaded, and its index-header is still
+		// mmap-ed, so removing it wouldn't release any disk space.
+		queriedAt := c.lastQueried[b.userID][b.blockID]
+		if c.idleTimeout > 0 && now.Sub(queriedAt) < c.idleTimeout {
+			continue
+		}
+
+		used := b.indexHeaderModTime
+		if queriedAt.After(used) {
+			used = queriedAt
+		}
+
+		candidates = append(candidates, i)
+		lastUsed[i] = used
+	}
+	c.mtx.Unlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return lastUsed[candidates[i]].Before(lastUsed[candidates[j]])
+	})
+
+	for _, i := range candidates {
+		if size <= maxSize {
+			break
+		}
+
+		b := &blocks[i]
+		if err := os.Remove(b.indexHeaderPath(c.dir)); err != nil && !os.IsNotExist(err) {
+			level.Warn(c.logger).Log("msg", "failed to evict block index-header from the local disk", "user", b.userID, "block", b.blockID.String(), "err", err)
+			continue
+		}
+
+		level.Debug(c.logger).Log("msg", "evicted block index-header from the local disk", "user", b.userID, "block", b.blockID.String(), "size", b.indexHeaderSize)
+		c.evictions.Inc()
+		c.evictedBytes.Add(float64(b.indexHeaderSize))
+
+		size -= b.indexHeaderSize
+		b.size -= b.indexHeaderSize
+		b.indexHeaderSize = 0
+	}
+
+	if size > maxSize {
+		level.Warn(c.logger).Log("msg", "the local cache size exceeds the max size, but there are no more blocks which can be evicted", "size", size, "max_size", maxSize)
+	}
+
+	return blocks
+}
+
+// prewarm downloads the missing index-headers of the owned blocks containing samples
+// within the prewarm period, starting from the newest ones.
+func (c *localCache) prewarm(ctx context.Context, bucketForUser func(userID string) objstore.BucketReader, now time.Time) {
+	type job struct {
+		userID string
+		meta   *metadata.Meta
+	}
+
+	minTime := now.Add(-c.cfg.PrewarmPeriod).UnixNano() / int64(time.Millisecond)
+
+	var jobs []job
+	c.mtx.Lock()
+	for userID, metas := range c.metas {
+		for _, meta := range metas {
+			if meta.MaxTime < minTime {
+				continue
+			}
+
+			// Only prewarm blocks which have already been added to the user's store,
+			// but whose index-header is missing (eg. previously evicted).
+			blockDir := filepath.Join(c.dir, userID, meta.ULID.String())
+			if _, err := os.Stat(blockDir); err != nil {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(blockDir, block.IndexHeaderFilename)); err == nil {
+				continue
+			}
+
+			jobs = append(jobs, job{userID: userID, meta: meta})
+		}
+	}
+	c.mtx.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].meta.MaxTime > jobs[j].meta.MaxTime
+	})
+
+	c.prewarmPending.Set(float64(len(jobs)))
+	defer c.prewarmPending.Set(0)
+
+	for _, j := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := c.prewarmBlock(ctx, bucketForUser(j.userID), j.userID, j.meta.ULID); err != nil {
+			level.Warn(util_log.WithUserID(j.userID, c.logger)).Log("msg", "failed to prewarm block index-header", "block", j.meta.ULID.String(), "err", err)
+			c.prewarmFailures.Inc()
+		} else {
+			c.prewarmedBlocks.Inc()
+		}
+
+		c.prewarmPending.Dec()
+	}
+}
+
+func (c *localCache) prewarmBlock(ctx context.Context, bkt objstore.BucketReader, userID string, blockID ulid.ULID) error {
+	// The index-header may be lazy loaded by a query in the meanwhile, so we write it
+	// to a different file and atomically rename it once done.
+	path := filepath.Join(c.dir, userID, blockID.String(), block.IndexHeaderFilename)
+	if err := indexheader.WriteBinary(ctx, bkt, blockID, path+prewarmFileSuffix); err != nil {
+		_ = os.Remove(path + prewarmFileSuffix)
+		_ = os.Remove(path + prewarmFileSuffix + tmpFileSuffix)
+		return err
+	}
+
+	return os.Rename(path+prewarmFileSuffix, path)
+}
+
+// blockIDsFromMatchers returns the IDs of the blocks selected by the request block
+// matchers, as built by the querier (eg. __block_id__=~"id1|id2").
+func blockIDsFromMatchers(matchers []storepb.LabelMatcher) []ulid.ULID {
+	var blockIDs []ulid.ULID
+
+	for _, m := range matchers {
+		if m.Name != block.BlockIDLabel || (m.Type != storepb.LabelMatcher_EQ && m.Type != storepb.LabelMatcher_RE) {
+			continue
+		}
+
+		for _, value := range strings.Split(m.Value, "|") {
+			if blockID, err := ulid.Parse(value); err == nil {
+				blockIDs = append(blockIDs, blockID)
+			}
+		}
+	}
+
+	return blockIDs
+}
+
+// localCacheMetadataFilter is a block.MetadataFilter which keeps track of the user's
+// blocks that passed all the previous filters.
+type localCacheMetadataFilter struct {
+	userID string
+	cache  *localCache
+}
+
+// Filter implements block.MetadataFilter.
+func (f *localCacheMetadataFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, _ *extprom.TxGaugeVec) error {
+	owned := make(map[ulid.ULID]*metadata.Meta, len(metas))
+	for blockID, meta := range metas {
+		owned[blockID] = meta
+	}
+
+	f.cache.mtx.Lock()
+	defer f.cache.mtx.Unlock()
+
+	f.cache.metas[f.userID] = owned
+
+	// Forget about the blocks which are not owned anymore.
+	for blockID := range f.cache.lastQueried[f.userID] {
+		if _, ok := owned[blockID]; !ok {
+			delete(f.cache.lastQueried[f.userID], blockID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,257 @@
+package storegateway
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gogo/protobuf/types"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/store/hintspb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+
+	"github.com/cortexproject/cortex/pkg/storage/bucket/filesystem"
+	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
+)
+
+func TestLocalCache_ShouldEvictLeastRecentlyQueriedBlocks(t *testing.T) {
+	const userID = "user-1"
+
+	cfg, cleanup := prepareStorageConfig(t)
+	defer cleanup()
+
+	now := time.Now()
+	cfg.BucketStore.IndexHeaderLazyLoadingIdleTimeout = time.Minute
+	cfg.BucketStore.LocalCache.MaxSizeBytes = 400
+
+	var (
+		oldBlock      = ulid.MustNew(1, nil)
+		queriedBlock  = ulid.MustNew(2, nil)
+		idleBlock     = ulid.MustNew(3, nil)
+		loadingBlock  = ulid.MustNew(4, nil)
+		recentBlock   = ulid.MustNew(5, nil)
+		inFlightBlock = ulid.MustNew(6, nil)
+	)
+
+	// Each index-header is 100 bytes, so the local cache is initially 600 bytes.
+	writeIndexHeader(t, cfg.BucketStore.SyncDir, userID, oldBlock, now.Add(-3*time.Hour))
+	writeIndexHeader(t, cfg.BucketStore.SyncDir, userID, queriedBlock, now.Add(-4*time.Hour))
+	writeIndexHeader(t, cfg.BucketStore.SyncDir, userID, idleBlock, now.Add(-4*time.Hour))
+	writeIndexHeader(t, cfg.BucketStore.SyncDir, userID, loadingBlock, now.Add(-5*time.Hour))
+	writeIndexHeader(t, cfg.BucketStore.SyncDir, userID, recentBlock, now)
+	writeIndexHeader(t, cfg.BucketStore.SyncDir, userID, inFlightBlock, now.Add(-6*time.Hour))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(cfg.BucketStore.SyncDir, userID, loadingBlock.String(), block.IndexHeaderFilename+tmpFileSuffix), nil, os.ModePerm))
+
+	reg := prometheus.NewPedanticRegistry()
+	c := newLocalCache(cfg.BucketStore, log.NewNopLogger(), reg)
+
+	// The in-flight block is still within the idle timeout, while the idle one has been queried before the old one was written.
+	c.touch(userID, []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: block.BlockIDLabel, Value: inFlightBlock.String()}}, now)
+	c.touch(userID, []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: block.BlockIDLabel, Value: idleBlock.String()}}, now.Add(-3*time.Hour).Add(-time.Minute))
+	c.touch(userID, []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: block.BlockIDLabel, Value: queriedBlock.String()}}, now.Add(-2*time.Hour))
+
+	c.sync(context.Background(), nil, now)
+
+	// The idle and old blocks are the least recently used ones which can be evicted.
+	for blockID, expected := range map[ulid.ULID]bool{
+		oldBlock:      false,
+		queriedBlock:  true,
+		idleBlock:     false,
+		loadingBlock:  true,
+		recentBlock:   true,
+		inFlightBlock: true,
+	} {
+		_, err := os.Stat(filepath.Join(cfg.BucketStore.SyncDir, userID, blockID.String(), block.IndexHeaderFilename))
+		assert.Equal(t, expected, err == nil, "block: %s", blockID.String())
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(c.evictions))
+	assert.Equal(t, float64(200), testutil.ToFloat64(c.evictedBytes))
+	assert.Equal(t, float64(400), testutil.ToFloat64(c.sizeBytes))
+	assert.Equal(t, float64(6), testutil.ToFloat64(c.blocks))
+}
+
+func TestLocalCache_ShouldPrewarmNewestBlocks(t *testing.T) {
+	const (
+		userID     = "user-1"
+		metricName = "series_1"
+	)
+
+	ctx := context.Background()
+	cfg, cleanup := prepareStorageConfig(t)
+	defer cleanup()
+
+	storageDir, err := ioutil.TempDir(os.TempDir(), "storage-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(storageDir) //nolint:errcheck
+
+	// Generate an old block and a recent one.
+	now := time.Now()
+	oldMinT := now.Add(-48*time.Hour).UnixNano() / int64(time.Millisecond)
+	newMinT := now.Add(-2*time.Hour).UnixNano() / int64(time.Millisecond)
+	generateStorageBlock(t, storageDir, userID, metricName, oldMinT, oldMinT+int64(time.Hour/time.Millisecond), 60000)
+	generateStorageBlock(t, storageDir, userID, metricName, newMinT, newMinT+int64(time.Hour/time.Millisecond), 60000)
+
+	bucket, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	cfg.BucketStore.IndexHeaderLazyLoadingEnabled = true
+	cfg.BucketStore.LocalCache = cortex_tsdb.LocalCacheConfig{PrewarmPeriod: 12 * time.Hour}
+
+	reg := prometheus.NewPedanticRegistry()
+	stores, err := NewBucketStores(cfg, NewNoShardingStrategy(), bucket, defaultLimitsOverrides(t), mockLoggingLevel(), log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	require.NoError(t, stores.InitialSync(ctx))
+
+	// Simulate the index-headers have been evicted.
+	blockIDs := getBlockIDsInDir(t, filepath.Join(cfg.BucketStore.SyncDir, userID))
+	require.Len(t, blockIDs, 2)
+
+	for _, blockID := range blockIDs {
+		require.NoError(t, os.Remove(filepath.Join(cfg.BucketStore.SyncDir, userID, blockID.String(), block.IndexHeaderFilename)))
+	}
+
+	require.NoError(t, stores.SyncBlocks(ctx))
+
+	// Only the recent block should have been prewarmed.
+	prewarmed := 0
+	for _, blockID := range blockIDs {
+		if _, err := os.Stat(filepath.Join(cfg.BucketStore.SyncDir, userID, blockID.String(), block.IndexHeaderFilename)); err == nil {
+			prewarmed++
+		}
+	}
+	assert.Equal(t, 1, prewarmed)
+	assert.Equal(t, float64(1), testutil.ToFloat64(stores.localCache.prewarmedBlocks))
+	assert.Equal(t, float64(0), testutil.ToFloat64(stores.localCache.prewarmFailures))
+	assert.Equal(t, float64(0), testutil.ToFloat64(stores.localCache.prewarmPending))
+
+	// Querying the blocks should still work, lazy loading the missing index-header.
+	seriesSet, warnings, err := querySeries(stores, userID, metricName, oldMinT, now.UnixNano()/int64(time.Millisecond))
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Len(t, seriesSet, 1)
+}
+
+func TestBucketStores_ShouldTrackQueriedBlocksInLocalCache(t *testing.T) {
+	const (
+		userID     = "user-1"
+		metricName = "series_1"
+	)
+
+	ctx := context.Background()
+	cfg, cleanup := prepareStorageConfig(t)
+	defer cleanup()
+
+	storageDir, err := ioutil.TempDir(os.TempDir(), "storage-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(storageDir) //nolint:errcheck
+
+	generateStorageBlock(t, storageDir, userID, metricName, 10, 100, 15)
+
+	bucket, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	cfg.BucketStore.IndexHeaderLazyLoadingEnabled = true
+	cfg.BucketStore.LocalCache.MaxSizeBytes = 1024 * 1024
+
+	stores, err := NewBucketStores(cfg, NewNoShardingStrategy(), bucket, defaultLimitsOverrides(t), mockLoggingLevel(), log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, stores.InitialSync(ctx))
+
+	blockIDs := getBlockIDsInDir(t, filepath.Join(cfg.BucketStore.SyncDir, userID))
+	require.Len(t, blockIDs, 1)
+
+	hints, err := types.MarshalAny(&hintspb.SeriesRequestHints{
+		BlockMatchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: block.BlockIDLabel, Value: blockIDs[0].String()}},
+	})
+	require.NoError(t, err)
+
+	req := &storepb.SeriesRequest{
+		MinTime:                 10,
+		MaxTime:                 100,
+		Matchers:                []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: metricName}},
+		PartialResponseStrategy: storepb.PartialResponseStrategy_ABORT,
+		Hints:                   hints,
+	}
+
+	srv := newBucketStoreSeriesServer(setUserIDToGRPCContext(ctx, userID))
+	require.NoError(t, stores.Series(req, srv))
+	assert.Len(t, srv.SeriesSet, 1)
+
+	stores.localCache.mtx.Lock()
+	defer stores.localCache.mtx.Unlock()
+	assert.Contains(t, stores.localCache.lastQueried[userID], blockIDs[0])
+	assert.Contains(t, stores.localCache.metas[userID], blockIDs[0])
+}
+
+func TestBlockIDsFromMatchers(t *testing.T) {
+	first := ulid.MustNew(1, nil)
+	second := ulid.MustNew(2, nil)
+
+	tests := map[string]struct {
+		matchers []storepb.LabelMatcher
+		expected []ulid.ULID
+	}{
+		"no matchers": {
+			matchers: nil,
+			expected: nil,
+		},
+		"equal matcher": {
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: block.BlockIDLabel, Value: first.String()}},
+			expected: []ulid.ULID{first},
+		},
+		"regex matcher": {
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: block.BlockIDLabel, Value: first.String() + "|" + second.String()}},
+			expected: []ulid.ULID{first, second},
+		},
+		"negative matcher": {
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_NRE, Name: block.BlockIDLabel, Value: first.String()}},
+			expected: nil,
+		},
+		"other label matcher": {
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "foo", Value: first.String()}},
+			expected: nil,
+		},
+		"invalid block ID": {
+			matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: block.BlockIDLabel, Value: "foo|" + second.String()}},
+			expected: []ulid.ULID{second},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, blockIDsFromMatchers(testData.matchers))
+		})
+	}
+}
+
+func writeIndexHeader(t *testing.T, syncDir, userID string, blockID ulid.ULID, modTime time.Time) {
+	blockDir := filepath.Join(syncDir, userID, blockID.String())
+	require.NoError(t, os.MkdirAll(blockDir, os.ModePerm))
+
+	path := filepath.Join(blockDir, block.IndexHeaderFilename)
+	require.NoError(t, ioutil.WriteFile(path, make([]byte, 100), os.ModePerm))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func getBlockIDsInDir(t *testing.T, dir string) []ulid.ULID {
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+
+	var blockIDs []ulid.ULID
+	for _, entry := range entries {
+		if blockID, err := ulid.Parse(entry.Name()); err == nil && entry.IsDir() {
+			blockIDs = append(blockIDs, blockID)
+		}
+	}
+	return blockIDs
+}
@@ -0,0 +1,267 @@
+package storegateway
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/limiter"
+)
+
+const (
+	// The max time a prefetch job can run for.
+	prefetchJobTimeout = 10 * time.Minute
+
+	// How long the status of a completed prefetch job is kept.
+	prefetchJobRetention = time.Hour
+
+	// How frequently the per-tenant prefetch rate limits are reloaded.
+	prefetchRateLimitRecheckPeriod = 10 * time.Second
+)
+
+// PrefetchJobStatus is the status of a prefetch job.
+type PrefetchJobStatus string
+
+const (
+	PrefetchJobRunning   PrefetchJobStatus = "running"
+	PrefetchJobSucceeded PrefetchJobStatus = "succeeded"
+	PrefetchJobFailed    PrefetchJobStatus = "failed"
+)
+
+// PrefetchRequest is a request to warm up the caches with the series of a tenant matching any
+// of the sets of matchers in the time range.
+type PrefetchRequest struct {
+	MinT, MaxT int64
+	Matchers   [][]*labels.Matcher
+}
+
+// PrefetchFunc looks up the series matching the request, without returning them, and returns
+// the number of series found. The tenant is injected in the context.
+type PrefetchFunc func(ctx context.Context, req PrefetchRequest) (int, error)
+
+// PrefetchLimits is the per-tenant limits of the prefetch requests.
+type PrefetchLimits interface {
+	PrefetchRequestsRateLimit(userID string) float64
+	PrefetchRequestsBurstSize(userID string) int
+}
+
+// PrefetchJob is the status of a prefetch job, as returned by the prefetch API.
+type PrefetchJob struct {
+	ID          string            `json:"id"`
+	Status      PrefetchJobStatus `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	SeriesCount int               `json:"series_count"`
+	StartedAt   time.Time         `json:"started_at"`
+	FinishedAt  *time.Time        `json:"finished_at,omitempty"`
+
+	userID string
+}
+
+// PrefetchJobs runs the prefetch requests asynchronously, keeping track of their status. The
+// prefetch requests are rate limited per tenant, so that they can't be used to run queries
+// without being subject to the queries limits.
+type PrefetchJobs struct {
+	prefetch PrefetchFunc
+	limits   PrefetchLimits
+	limiter  *limiter.RateLimiter
+	logger   log.Logger
+
+	jobsMx sync.Mutex
+	jobs   map[string]*PrefetchJob
+
+	jobsTotal        *prometheus.CounterVec
+	rateLimitedTotal prometheus.Counter
+}
+
+// NewPrefetchJobs makes a new PrefetchJobs running the prefetch requests with the input function.
+func NewPrefetchJobs(prefetch PrefetchFunc, limits PrefetchLimits, logger log.Logger, reg prometheus.Registerer) *PrefetchJobs {
+	return &PrefetchJobs{
+		prefetch: prefetch,
+		limits:   limits,
+		limiter:  limiter.NewRateLimiter(prefetchRateLimiterStrategy{limits: limits}, prefetchRateLimitRecheckPeriod),
+		logger:   logger,
+		jobs:     map[string]*PrefetchJob{},
+		jobsTotal: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_prefetch_jobs_total",
+			Help: "Total number of completed prefetch jobs.",
+		}, []string{"status"}),
+		rateLimitedTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_prefetch_requests_rate_limited_total",
+			Help: "Total number of prefetch requests rejected because of the per-tenant rate limit.",
+		}),
+	}
+}
+
+// StartHandler starts a prefetch job and returns its status. The job runs in background.
+func (p *PrefetchJobs) StartHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, err := parsePrefetchRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if p.limits.PrefetchRequestsRateLimit(userID) <= 0 {
+		http.Error(w, "the prefetch requests are disabled for the tenant", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	if !p.limiter.AllowN(now, userID, 1) {
+		p.rateLimitedTotal.Inc()
+		http.Error(w, "the prefetch requests rate limit has been exceeded for the tenant", http.StatusTooManyRequests)
+		return
+	}
+
+	job := &PrefetchJob{
+		ID:        ulid.MustNew(ulid.Timestamp(now), rand.Reader).String(),
+		Status:    PrefetchJobRunning,
+		StartedAt: now,
+		userID:    userID,
+	}
+
+	p.jobsMx.Lock()
+	p.cleanupJobs(now)
+	p.jobs[job.ID] = job
+	status := *job
+	p.jobsMx.Unlock()
+
+	go p.run(job, req)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	util.WriteJSONResponse(w, status)
+}
+
+// StatusHandler returns the status of a prefetch job of the tenant.
+func (p *PrefetchJobs) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.jobsMx.Lock()
+	job, ok := p.jobs[mux.Vars(r)["id"]]
+	if ok {
+		job = copyPrefetchJob(job)
+	}
+	p.jobsMx.Unlock()
+
+	// Do not disclose whether the job exists for another tenant.
+	if !ok || job.userID != userID {
+		http.Error(w, "prefetch job not found", http.StatusNotFound)
+		return
+	}
+
+	util.WriteJSONResponse(w, job)
+}
+
+func (p *PrefetchJobs) run(job *PrefetchJob, req PrefetchRequest) {
+	ctx, cancel := context.WithTimeout(user.InjectOrgID(context.Background(), job.userID), prefetchJobTimeout)
+	defer cancel()
+
+	seriesCount, err := p.prefetch(ctx, req)
+	finishedAt := time.Now()
+
+	p.jobsMx.Lock()
+	defer p.jobsMx.Unlock()
+
+	job.SeriesCount = seriesCount
+	job.FinishedAt = &finishedAt
+	if err != nil {
+		job.Status = PrefetchJobFailed
+		job.Error = err.Error()
+		level.Warn(p.logger).Log("msg", "prefetch job failed", "user", job.userID, "job", job.ID, "err", err)
+	} else {
+		job.Status = PrefetchJobSucceeded
+		level.Info(p.logger).Log("msg", "prefetch job completed", "user", job.userID, "job", job.ID, "series", seriesCount, "duration", finishedAt.Sub(job.StartedAt))
+	}
+
+	p.jobsTotal.WithLabelValues(string(job.Status)).Inc()
+}
+
+// cleanupJobs removes the jobs completed more than the retention period ago. Must be called with the lock held.
+func (p *PrefetchJobs) cleanupJobs(now time.Time) {
+	for id, job := range p.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > prefetchJobRetention {
+			delete(p.jobs, id)
+		}
+	}
+}
+
+func copyPrefetchJob(job *PrefetchJob) *PrefetchJob {
+	c := *job
+	if job.FinishedAt != nil {
+		finishedAt := *job.FinishedAt
+		c.FinishedAt = &finishedAt
+	}
+	return &c
+}
+
+func parsePrefetchRequest(r *http.Request) (PrefetchRequest, error) {
+	if err := r.ParseForm(); err != nil {
+		return PrefetchRequest{}, err
+	}
+
+	var (
+		req PrefetchRequest
+		err error
+	)
+
+	if req.MinT, err = util.ParseTime(r.FormValue("start")); err != nil {
+		return PrefetchRequest{}, err
+	}
+	if req.MaxT, err = util.ParseTime(r.FormValue("end")); err != nil {
+		return PrefetchRequest{}, err
+	}
+	if req.MinT > req.MaxT {
+		return PrefetchRequest{}, errors.New("the start time must be before the end time")
+	}
+
+	for _, selector := range r.Form["match[]"] {
+		matchers, err := parser.ParseMetricSelector(selector)
+		if err != nil {
+			return PrefetchRequest{}, fmt.Errorf("invalid selector %q: %v", selector, err)
+		}
+		req.Matchers = append(req.Matchers, matchers)
+	}
+	if len(req.Matchers) == 0 {
+		return PrefetchRequest{}, errors.New("at least one selector must be specified with the match[] parameter")
+	}
+
+	return req, nil
+}
+
+type prefetchRateLimiterStrategy struct {
+	limits PrefetchLimits
+}
+
+func (s prefetchRateLimiterStrategy) Limit(userID string) float64 {
+	return s.limits.PrefetchRequestsRateLimit(userID)
+}
+
+func (s prefetchRateLimiterStrategy) Burst(userID string) int {
+	return s.limits.PrefetchRequestsBurstSize(userID)
+}
@@ -0,0 +1,248 @@
+package storegateway
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/storage/bucket/filesystem"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util/test"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestPrefetchJobs_StartHandler(t *testing.T) {
+	validParams := url.Values{"start": []string{"0"}, "end": []string{"3600"}, "match[]": []string{`{job="api"}`, `up`}}
+
+	tests := map[string]struct {
+		rateLimit      float64
+		params         url.Values
+		numRequests    int
+		expectedStatus int
+	}{
+		"should start the prefetch job": {
+			rateLimit:      1,
+			params:         validParams,
+			numRequests:    1,
+			expectedStatus: http.StatusAccepted,
+		},
+		"should reject the request if the prefetch is disabled for the tenant": {
+			rateLimit:      0,
+			params:         validParams,
+			numRequests:    1,
+			expectedStatus: http.StatusForbidden,
+		},
+		"should reject the request if the rate limit has been exceeded": {
+			rateLimit:      0.001,
+			params:         validParams,
+			numRequests:    2,
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		"should reject the request without selectors": {
+			rateLimit:      1,
+			params:         url.Values{"start": []string{"0"}, "end": []string{"3600"}},
+			numRequests:    1,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"should reject the request with an invalid selector": {
+			rateLimit:      1,
+			params:         url.Values{"start": []string{"0"}, "end": []string{"3600"}, "match[]": []string{`{job=`}},
+			numRequests:    1,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"should reject the request without time range": {
+			rateLimit:      1,
+			params:         url.Values{"match[]": []string{`up`}},
+			numRequests:    1,
+			expectedStatus: http.StatusBadRequest,
+		},
+		"should reject the request with the start time after the end time": {
+			rateLimit:      1,
+			params:         url.Values{"start": []string{"3600"}, "end": []string{"0"}, "match[]": []string{`up`}},
+			numRequests:    1,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			limits := defaultLimitsConfig()
+			limits.PrefetchRequestsRateLimit = testData.rateLimit
+			limits.PrefetchRequestsBurstSize = 1
+			overrides, err := validation.NewOverrides(limits, nil)
+			require.NoError(t, err)
+
+			jobs := NewPrefetchJobs(func(context.Context, PrefetchRequest) (int, error) {
+				return 0, nil
+			}, overrides, log.NewNopLogger(), nil)
+
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < testData.numRequests; i++ {
+				rec = httptest.NewRecorder()
+				jobs.StartHandler(rec, newPrefetchRequest("user-1", testData.params))
+			}
+
+			require.Equal(t, testData.expectedStatus, rec.Code, rec.Body.String())
+			if testData.expectedStatus != http.StatusAccepted {
+				return
+			}
+
+			job := PrefetchJob{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+			assert.NotEmpty(t, job.ID)
+			assert.Equal(t, PrefetchJobRunning, job.Status)
+		})
+	}
+}
+
+func TestPrefetchJobs_StatusHandler(t *testing.T) {
+	limits := defaultLimitsConfig()
+	limits.PrefetchRequestsRateLimit = 1
+	limits.PrefetchRequestsBurstSize = 10
+	overrides, err := validation.NewOverrides(limits, nil)
+	require.NoError(t, err)
+
+	reg := prometheus.NewPedanticRegistry()
+	jobs := NewPrefetchJobs(func(ctx context.Context, req PrefetchRequest) (int, error) {
+		userID, err := tenant.TenantID(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if userID == "user-2" {
+			return 5, errors.New("store-gateway unavailable")
+		}
+		return 10 * len(req.Matchers), nil
+	}, overrides, log.NewNopLogger(), reg)
+
+	startJob := func(userID string) string {
+		rec := httptest.NewRecorder()
+		jobs.StartHandler(rec, newPrefetchRequest(userID, url.Values{"start": []string{"0"}, "end": []string{"3600"}, "match[]": []string{`{job="api"}`, `up`}}))
+		require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+		job := PrefetchJob{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+		return job.ID
+	}
+
+	getJob := func(userID, jobID string) (int, PrefetchJob) {
+		req := httptest.NewRequest(http.MethodGet, "/prefetch/"+jobID, nil)
+		req = mux.SetURLVars(req.WithContext(user.InjectOrgID(req.Context(), userID)), map[string]string{"id": jobID})
+		rec := httptest.NewRecorder()
+		jobs.StatusHandler(rec, req)
+
+		job := PrefetchJob{}
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+		}
+		return rec.Code, job
+	}
+
+	succeededJobID := startJob("user-1")
+	failedJobID := startJob("user-2")
+
+	test.Poll(t, time.Second, PrefetchJobSucceeded, func() interface{} {
+		_, job := getJob("user-1", succeededJobID)
+		return job.Status
+	})
+	test.Poll(t, time.Second, PrefetchJobFailed, func() interface{} {
+		_, job := getJob("user-2", failedJobID)
+		return job.Status
+	})
+
+	code, job := getJob("user-1", succeededJobID)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 20, job.SeriesCount)
+	assert.Empty(t, job.Error)
+	assert.NotNil(t, job.FinishedAt)
+
+	code, job = getJob("user-2", failedJobID)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 5, job.SeriesCount)
+	assert.Equal(t, "store-gateway unavailable", job.Error)
+
+	// A tenant can't read the jobs of other tenants.
+	code, _ = getJob("user-2", succeededJobID)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = getJob("user-1", "unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_prefetch_jobs_total Total number of completed prefetch jobs.
+		# TYPE cortex_prefetch_jobs_total counter
+		cortex_prefetch_jobs_total{status="failed"} 1
+		cortex_prefetch_jobs_total{status="succeeded"} 1
+	`), "cortex_prefetch_jobs_total"))
+}
+
+func TestStoreGateway_PrefetchShouldLookupTheSeriesOfTheTenant(t *testing.T) {
+	const numSeries = 10
+
+	ctx := context.Background()
+	userID := "user-1"
+
+	storageDir, err := ioutil.TempDir(os.TempDir(), "")
+	require.NoError(t, err)
+	defer os.RemoveAll(storageDir) //nolint:errcheck
+
+	now := time.Now()
+	minT := now.Add(-1*time.Hour).Unix() * 1000
+	maxT := now.Unix() * 1000
+	mockTSDB(t, path.Join(storageDir, userID), numSeries, 0, minT, maxT)
+
+	bucketClient, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	gatewayCfg := mockGatewayConfig()
+	gatewayCfg.ShardingEnabled = false
+	storageCfg := mockStorageConfig(t)
+
+	g, err := newStoreGateway(gatewayCfg, storageCfg, bucketClient, nil, defaultLimitsOverrides(t), mockLoggingLevel(), log.NewNopLogger(), nil)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, g))
+	defer services.StopAndAwaitTerminated(ctx, g) //nolint:errcheck
+
+	req, err := parsePrefetchRequest(newPrefetchRequest(userID, url.Values{
+		"start":   []string{formatPrefetchTime(minT)},
+		"end":     []string{formatPrefetchTime(maxT)},
+		"match[]": []string{`{series_id=~".+"}`, `{series_id="1"}`},
+	}))
+	require.NoError(t, err)
+
+	seriesCount, err := g.prefetch(user.InjectOrgID(ctx, userID), req)
+	require.NoError(t, err)
+	assert.Equal(t, numSeries+1, seriesCount)
+
+	// The series of other tenants are not looked up.
+	seriesCount, err = g.prefetch(user.InjectOrgID(ctx, "user-2"), req)
+	require.NoError(t, err)
+	assert.Equal(t, 0, seriesCount)
+}
+
+func newPrefetchRequest(userID string, params url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/prefetch", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req.WithContext(user.InjectOrgID(req.Context(), userID))
+}
+
+func formatPrefetchTime(ms int64) string {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+}
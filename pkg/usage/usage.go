@@ -0,0 +1,369 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/alertmanager"
+	"github.com/cortexproject/cortex/pkg/distributor"
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/storage/bucket"
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
+	"github.com/cortexproject/cortex/pkg/tenant"
+	"github.com/cortexproject/cortex/pkg/util"
+	util_log "github.com/cortexproject/cortex/pkg/util/log"
+)
+
+// Sources of the usage summary, used as keys of the errors of the partial summaries.
+const (
+	sourceIngestion    = "ingestion"
+	sourceTopMetrics   = "top_metrics"
+	sourceRules        = "rules"
+	sourceAlertmanager = "alertmanager"
+	sourceStorage      = "storage"
+)
+
+var errInvalidSourceTimeout = errors.New("the usage source timeout must be greater than 0")
+
+// Config configures the per-tenant usage summary API.
+type Config struct {
+	SourceTimeout   time.Duration `yaml:"source_timeout"`
+	CacheTTL        time.Duration `yaml:"cache_ttl"`
+	TopMetricsLimit int           `yaml:"top_metrics_limit"`
+	AlertmanagerURL string        `yaml:"alertmanager_url"`
+}
+
+// RegisterFlags registers flags.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.DurationVar(&cfg.SourceTimeout, "usage.source-timeout", 5*time.Second, "Timeout of the requests to each source of the usage summary. The summary is returned without the sources timing out, and flagged as partial.")
+	f.DurationVar(&cfg.CacheTTL, "usage.cache-ttl", 30*time.Second, "How long the usage summary of a tenant is cached. The partial summaries are not cached. 0 to disable the cache.")
+	f.IntVar(&cfg.TopMetricsLimit, "usage.top-metrics-limit", 10, "Max number of metrics with the most series returned in the usage summary. 0 to not return the top metrics.")
+	f.StringVar(&cfg.AlertmanagerURL, "usage.alertmanager-url", "", "URL of the Alertmanager API the number of notifications of the tenant is read from, including the Alertmanager HTTP prefix, eg. http://alertmanager/alertmanager. If empty, the notifications are not included in the usage summary.")
+}
+
+// Validate the config and returns an error if the validation doesn't pass.
+func (cfg *Config) Validate() error {
+	if cfg.SourceTimeout <= 0 {
+		return errInvalidSourceTimeout
+	}
+	return nil
+}
+
+// Distributor is the subset of the distributor used to compute the ingestion usage.
+type Distributor interface {
+	UserStats(ctx context.Context) (*distributor.UserStats, error)
+	LabelValuesCardinality(ctx context.Context, labelName model.LabelName) (map[string]uint64, error)
+}
+
+// RuleStore is the subset of the rule store used to count the rule groups.
+type RuleStore interface {
+	ListRuleGroupsForUserAndNamespace(ctx context.Context, userID string, namespace string) (rulespb.RuleGroupList, error)
+}
+
+// Usage is the usage summary of a tenant. The sections of the sources which are not configured are
+// omitted, while the failures of the sources are reported in the errors, by source, and the summary
+// is flagged as partial.
+type Usage struct {
+	Tenant      string             `json:"tenant"`
+	GeneratedAt int64              `json:"generated_at"`
+	Ingestion   *IngestionUsage    `json:"ingestion,omitempty"`
+	TopMetrics  []MetricUsage      `json:"top_metrics,omitempty"`
+	Rules       *RulesUsage        `json:"rules,omitempty"`
+	Alerting    *AlertmanagerUsage `json:"alertmanager,omitempty"`
+	Storage     *StorageUsage      `json:"storage,omitempty"`
+	Partial     bool               `json:"partial"`
+	Errors      map[string]string  `json:"errors,omitempty"`
+}
+
+// IngestionUsage is the current ingestion of a tenant, as reported by the ingesters.
+type IngestionUsage struct {
+	IngestionRate float64 `json:"ingestion_rate"`
+	ActiveSeries  uint64  `json:"active_series"`
+}
+
+// MetricUsage is the number of in-memory series of a metric.
+type MetricUsage struct {
+	MetricName  string `json:"metric_name"`
+	SeriesCount uint64 `json:"series_count"`
+}
+
+// RulesUsage is the number of rule groups of a tenant.
+type RulesUsage struct {
+	RuleGroups int `json:"rule_groups"`
+}
+
+// AlertmanagerUsage is the number of notifications sent by the Alertmanager of a tenant over the
+// current hour and the previous alertmanager.NotificationsCountHours-1 ones.
+type AlertmanagerUsage struct {
+	Notifications24h uint64 `json:"notifications_24h"`
+}
+
+// StorageUsage is the size of the blocks of a tenant in the long-term storage, according to its
+// bucket index. The size of the blocks indexed by the previous versions is unknown, so the size is
+// a lower bound if any.
+type StorageUsage struct {
+	Blocks            int   `json:"blocks"`
+	StoredBytes       int64 `json:"stored_bytes"`
+	BlocksUnknownSize int   `json:"blocks_unknown_size"`
+}
+
+type cachedUsage struct {
+	usage   *Usage
+	expires time.Time
+}
+
+// API serves the usage summary of the tenants, aggregated from the distributor, the rule store, the
+// Alertmanager and the bucket index.
+type API struct {
+	cfg          Config
+	distributor  Distributor
+	ruleStore    RuleStore
+	bucketClient objstore.Bucket
+	cfgProvider  bucket.TenantConfigProvider
+	httpClient   *http.Client
+	logger       log.Logger
+
+	cacheMtx sync.Mutex
+	cache    map[string]cachedUsage
+
+	sourceFailures *prometheus.CounterVec
+}
+
+// NewAPI makes a new API. The rule store and the bucket client are optional, and the related sources
+// are not included in the usage summary if nil.
+func NewAPI(cfg Config, distributor Distributor, ruleStore RuleStore, bucketClient objstore.Bucket, cfgProvider bucket.TenantConfigProvider, logger log.Logger, reg prometheus.Registerer) *API {
+	return &API{
+		cfg:          cfg,
+		distributor:  distributor,
+		ruleStore:    ruleStore,
+		bucketClient: bucketClient,
+		cfgProvider:  cfgProvider,
+		httpClient:   &http.Client{},
+		logger:       logger,
+		cache:        map[string]cachedUsage{},
+		sourceFailures: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_usage_source_failures_total",
+			Help: "Total number of failures of the sources of the usage summary.",
+		}, []string{"source"}),
+	}
+}
+
+// UsageHandler returns the usage summary of the authenticated tenant.
+func (a *API) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := tenant.TenantID(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	util.WriteJSONResponse(w, a.getUsage(r.Context(), userID))
+}
+
+// getUsage returns the usage summary of the user, from the cache if not expired.
+func (a *API) getUsage(ctx context.Context, userID string) *Usage {
+	now := time.Now()
+
+	a.cacheMtx.Lock()
+	cached, ok := a.cache[userID]
+	a.cacheMtx.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.usage
+	}
+
+	usage := a.computeUsage(ctx, userID)
+	if usage.Partial || a.cfg.CacheTTL <= 0 {
+		return usage
+	}
+
+	a.cacheMtx.Lock()
+	defer a.cacheMtx.Unlock()
+
+	// Remove the expired summaries of the other users, so that the cache doesn't grow indefinitely.
+	for id, c := range a.cache {
+		if !now.Before(c.expires) {
+			delete(a.cache, id)
+		}
+	}
+	a.cache[userID] = cachedUsage{usage: usage, expires: now.Add(a.cfg.CacheTTL)}
+
+	return usage
+}
+
+// computeUsage computes the usage summary of the user, querying the sources concurrently, each one
+// with its own timeout.
+func (a *API) computeUsage(ctx context.Context, userID string) *Usage {
+	ctx = user.InjectOrgID(ctx, userID)
+	usage := &Usage{Tenant: userID, GeneratedAt: time.Now().Unix()}
+
+	sources := map[string]func(ctx context.Context) error{}
+	if a.distributor != nil {
+		sources[sourceIngestion] = func(ctx context.Context) error {
+			stats, err := a.distributor.UserStats(ctx)
+			if err != nil {
+				return err
+			}
+			usage.Ingestion = &IngestionUsage{IngestionRate: stats.IngestionRate, ActiveSeries: stats.NumSeries}
+			return nil
+		}
+
+		if a.cfg.TopMetricsLimit > 0 {
+			sources[sourceTopMetrics] = func(ctx context.Context) (err error) {
+				usage.TopMetrics, err = a.topMetrics(ctx)
+				return err
+			}
+		}
+	}
+	if a.ruleStore != nil {
+		sources[sourceRules] = func(ctx context.Context) error {
+			groups, err := a.ruleStore.ListRuleGroupsForUserAndNamespace(ctx, userID, "")
+			if err != nil {
+				return err
+			}
+			usage.Rules = &RulesUsage{RuleGroups: len(groups)}
+			return nil
+		}
+	}
+	if a.cfg.AlertmanagerURL != "" {
+		sources[sourceAlertmanager] = func(ctx context.Context) (err error) {
+			usage.Alerting, err = a.alertmanagerUsage(ctx)
+			return err
+		}
+	}
+	if a.bucketClient != nil {
+		sources[sourceStorage] = func(ctx context.Context) (err error) {
+			usage.Storage, err = a.storageUsage(ctx, userID)
+			return err
+		}
+	}
+
+	var (
+		wg     sync.WaitGroup
+		errsMx sync.Mutex
+	)
+
+	for name, fn := range sources {
+		wg.Add(1)
+		go func(name string, fn func(ctx context.Context) error) {
+			defer wg.Done()
+
+			sourceCtx, cancel := context.WithTimeout(ctx, a.cfg.SourceTimeout)
+			defer cancel()
+
+			if err := fn(sourceCtx); err != nil {
+				level.Warn(util_log.WithUserID(userID, a.logger)).Log("msg", "failed to read usage source", "source", name, "err", err)
+				a.sourceFailures.WithLabelValues(name).Inc()
+
+				errsMx.Lock()
+				if usage.Errors == nil {
+					usage.Errors = map[string]string{}
+				}
+				usage.Errors[name] = err.Error()
+				usage.Partial = true
+				errsMx.Unlock()
+			}
+		}(name, fn)
+	}
+	wg.Wait()
+
+	return usage
+}
+
+// topMetrics returns the metrics with the most in-memory series, counted by the ingesters from the
+// postings of the metric names, without fetching the series.
+func (a *API) topMetrics(ctx context.Context) ([]MetricUsage, error) {
+	counts, err := a.distributor.LabelValuesCardinality(ctx, model.MetricNameLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MetricUsage, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, MetricUsage{MetricName: name, SeriesCount: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SeriesCount != result[j].SeriesCount {
+			return result[i].SeriesCount > result[j].SeriesCount
+		}
+		return result[i].MetricName < result[j].MetricName
+	})
+
+	if len(result) > a.cfg.TopMetricsLimit {
+		result = result[:a.cfg.TopMetricsLimit]
+	}
+	return result, nil
+}
+
+// alertmanagerUsage sums the notifications counts of the Alertmanager of the tenant, which are read
+// from a quorum of its replicas when sharding is enabled.
+func (a *API) alertmanagerUsage(ctx context.Context) (*AlertmanagerUsage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(a.cfg.AlertmanagerURL, "/")+"/api/v1/notifications/count", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := user.InjectOrgIDIntoHTTPRequest(ctx, req); err != nil {
+		return nil, err
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	// The tenant has no Alertmanager configuration.
+	if resp.StatusCode == http.StatusNotFound {
+		return &AlertmanagerUsage{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from the Alertmanager: %d", resp.StatusCode)
+	}
+
+	var counts []alertmanager.NotificationsCount
+	if err := json.NewDecoder(resp.Body).Decode(&counts); err != nil {
+		return nil, errors.Wrap(err, "decode the Alertmanager notifications count")
+	}
+
+	result := &AlertmanagerUsage{}
+	for _, count := range counts {
+		result.Notifications24h += count.Count
+	}
+	return result, nil
+}
+
+// storageUsage returns the size of the blocks of the tenant according to its bucket index.
+func (a *API) storageUsage(ctx context.Context, userID string) (*StorageUsage, error) {
+	idx, err := bucketindex.ReadIndex(ctx, a.bucketClient, userID, a.cfgProvider, a.logger)
+	if errors.Is(err, bucketindex.ErrIndexNotFound) {
+		// The tenant has no blocks yet.
+		return &StorageUsage{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &StorageUsage{Blocks: len(idx.Blocks)}
+	for _, b := range idx.Blocks {
+		if b.SizeBytes == 0 {
+			result.BlocksUnknownSize++
+			continue
+		}
+		result.StoredBytes += b.SizeBytes
+	}
+	return result, nil
+}
@@ -0,0 +1,177 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/weaveworks/common/user"
+	"go.uber.org/atomic"
+
+	"github.com/cortexproject/cortex/pkg/alertmanager"
+	"github.com/cortexproject/cortex/pkg/distributor"
+	"github.com/cortexproject/cortex/pkg/ruler/rulespb"
+	"github.com/cortexproject/cortex/pkg/storage/tsdb/bucketindex"
+)
+
+type mockDistributor struct {
+	calls   atomic.Int64
+	delay   time.Duration
+	stats   *distributor.UserStats
+	metrics map[string]uint64
+}
+
+func (m *mockDistributor) UserStats(ctx context.Context) (*distributor.UserStats, error) {
+	m.calls.Inc()
+	if m.delay > 0 {
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return m.stats, nil
+}
+
+func (m *mockDistributor) LabelValuesCardinality(_ context.Context, labelName model.LabelName) (map[string]uint64, error) {
+	if labelName != model.MetricNameLabel {
+		return nil, errors.New("unexpected label name")
+	}
+	return m.metrics, nil
+}
+
+type mockRuleStore struct {
+	groups rulespb.RuleGroupList
+	err    error
+}
+
+func (m *mockRuleStore) ListRuleGroupsForUserAndNamespace(_ context.Context, userID string, namespace string) (rulespb.RuleGroupList, error) {
+	return m.groups, m.err
+}
+
+func TestAPI_UsageHandler(t *testing.T) {
+	const userID = "user-1"
+
+	// Mock the Alertmanager notifications count.
+	hour := time.Now().Truncate(time.Hour)
+	alertmanagerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/alertmanager/api/v1/notifications/count", r.URL.Path)
+		assert.Equal(t, userID, r.Header.Get(user.OrgIDHeaderName))
+
+		require.NoError(t, json.NewEncoder(w).Encode([]alertmanager.NotificationsCount{
+			{Sender: "a", Hour: hour.Add(-time.Hour), Count: 2},
+			{Sender: "a", Hour: hour, Count: 1},
+			{Sender: "b", Hour: hour, Count: 3},
+		}))
+	}))
+	t.Cleanup(alertmanagerServer.Close)
+
+	// Write the bucket index, including a block indexed by a previous version without size.
+	bkt := objstore.NewInMemBucket()
+	require.NoError(t, bucketindex.WriteIndex(context.Background(), bkt, userID, nil, &bucketindex.Index{
+		Version: bucketindex.IndexVersion1,
+		Blocks: bucketindex.Blocks{
+			{ID: ulid.MustNew(1, nil), SizeBytes: 1000},
+			{ID: ulid.MustNew(2, nil), SizeBytes: 2000},
+			{ID: ulid.MustNew(3, nil)},
+		},
+	}))
+
+	dist := &mockDistributor{
+		stats: &distributor.UserStats{IngestionRate: 100, NumSeries: 4},
+		metrics: map[string]uint64{
+			"metric_a": 1,
+			"metric_b": 2,
+			"metric_c": 1,
+		},
+	}
+	ruleStore := &mockRuleStore{groups: rulespb.RuleGroupList{{Name: "group-1"}, {Name: "group-2"}}}
+
+	cfg := Config{
+		SourceTimeout:   time.Second,
+		CacheTTL:        time.Minute,
+		TopMetricsLimit: 2,
+		AlertmanagerURL: alertmanagerServer.URL + "/alertmanager/",
+	}
+	api := NewAPI(cfg, dist, ruleStore, bkt, nil, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+	getUsage := func() Usage {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/usage", nil)
+		api.UsageHandler(resp, req.WithContext(user.InjectOrgID(req.Context(), userID)))
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		usage := Usage{}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &usage))
+		return usage
+	}
+
+	usage := getUsage()
+	assert.Equal(t, userID, usage.Tenant)
+	assert.False(t, usage.Partial)
+	assert.Empty(t, usage.Errors)
+	assert.Equal(t, &IngestionUsage{IngestionRate: 100, ActiveSeries: 4}, usage.Ingestion)
+	assert.Equal(t, []MetricUsage{{MetricName: "metric_b", SeriesCount: 2}, {MetricName: "metric_a", SeriesCount: 1}}, usage.TopMetrics)
+	assert.Equal(t, &RulesUsage{RuleGroups: 2}, usage.Rules)
+	assert.Equal(t, &AlertmanagerUsage{Notifications24h: 6}, usage.Alerting)
+	assert.Equal(t, &StorageUsage{Blocks: 3, StoredBytes: 3000, BlocksUnknownSize: 1}, usage.Storage)
+
+	// The summary is cached.
+	dist.stats = &distributor.UserStats{IngestionRate: 200, NumSeries: 4}
+	usage = getUsage()
+	assert.Equal(t, float64(100), usage.Ingestion.IngestionRate)
+	assert.Equal(t, int64(1), dist.calls.Load())
+
+	// The request must be authenticated.
+	resp := httptest.NewRecorder()
+	api.UsageHandler(resp, httptest.NewRequest("GET", "/api/v1/usage", nil))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestAPI_ShouldReturnPartialUsageOnSourceFailures(t *testing.T) {
+	const userID = "user-1"
+
+	dist := &mockDistributor{
+		delay: time.Minute,
+		stats: &distributor.UserStats{IngestionRate: 100, NumSeries: 4},
+	}
+	ruleStore := &mockRuleStore{err: errors.New("rule store unavailable")}
+
+	cfg := Config{
+		SourceTimeout: 100 * time.Millisecond,
+		CacheTTL:      time.Minute,
+	}
+
+	// The storage is not configured, so it's not included in the summary.
+	api := NewAPI(cfg, dist, ruleStore, nil, nil, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+	for i := 1; i <= 2; i++ {
+		start := time.Now()
+		usage := api.getUsage(context.Background(), userID)
+		assert.Less(t, time.Since(start).Seconds(), time.Minute.Seconds())
+
+		assert.True(t, usage.Partial)
+		assert.Equal(t, map[string]string{
+			sourceIngestion: context.DeadlineExceeded.Error(),
+			sourceRules:     "rule store unavailable",
+		}, usage.Errors)
+		assert.Nil(t, usage.Ingestion)
+		assert.Nil(t, usage.Rules)
+		assert.Nil(t, usage.Storage)
+		assert.Nil(t, usage.Alerting)
+
+		// The partial summaries are not cached.
+		assert.Equal(t, int64(i), dist.calls.Load())
+	}
+}
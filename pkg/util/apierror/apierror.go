@@ -0,0 +1,279 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gogo/status"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/weaveworks/common/httpgrpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+// StatusClientClosedRequest is the status code for when a client request cancellation of an http request.
+const StatusClientClosedRequest = 499
+
+// Type is the type of an API error, returned in the errorType field of the JSON error objects.
+// It extends the error types of the Prometheus API.
+type Type string
+
+const (
+	TypeTimeout         Type = "timeout"
+	TypeCanceled        Type = "canceled"
+	TypeExec            Type = "execution"
+	TypeBadData         Type = "bad_data"
+	TypeInternal        Type = "internal"
+	TypeUnavailable     Type = "unavailable"
+	TypeNotFound        Type = "not_found"
+	TypeLimitExceeded   Type = "limit_exceeded"
+	TypeTooManyRequests Type = "too_many_requests"
+	TypeTooLarge        Type = "too_large"
+)
+
+// The HTTP status code of each error type. An error type always has the same status code,
+// regardless of the component returning it.
+var statusCodes = map[Type]int{
+	TypeTimeout:         http.StatusGatewayTimeout,
+	TypeCanceled:        StatusClientClosedRequest,
+	TypeExec:            http.StatusUnprocessableEntity,
+	TypeBadData:         http.StatusBadRequest,
+	TypeInternal:        http.StatusInternalServerError,
+	TypeUnavailable:     http.StatusServiceUnavailable,
+	TypeNotFound:        http.StatusNotFound,
+	TypeLimitExceeded:   http.StatusUnprocessableEntity,
+	TypeTooManyRequests: http.StatusTooManyRequests,
+	TypeTooLarge:        http.StatusRequestEntityTooLarge,
+}
+
+// StatusCode returns the HTTP status code of the errors of the type.
+func (t Type) StatusCode() int {
+	if code, ok := statusCodes[t]; ok {
+		return code
+	}
+	return http.StatusInternalServerError
+}
+
+func (t Type) valid() bool {
+	_, ok := statusCodes[t]
+	return ok
+}
+
+// APIError is a typed error returned by the query APIs. It's also an httpgrpc error, whose
+// response is the JSON error object, so that it's propagated as is between the Cortex components.
+type APIError struct {
+	Type    Type
+	Message string
+}
+
+// New makes a new APIError.
+func New(typ Type, msg string) *APIError {
+	return &APIError{Type: typ, Message: msg}
+}
+
+// Newf makes a new APIError with a formatted message.
+func Newf(typ Type, format string, args ...interface{}) *APIError {
+	return New(typ, fmt.Sprintf(format, args...))
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the HTTP status code of the error.
+func (e *APIError) StatusCode() int {
+	return e.Type.StatusCode()
+}
+
+// HTTPResponse returns the HTTP response of the error, whose body is the Prometheus-style
+// JSON error object.
+func (e *APIError) HTTPResponse() *httpgrpc.HTTPResponse {
+	body, err := json.Marshal(jsonError{
+		Status:    statusError,
+		ErrorType: e.Type,
+		Error:     e.Message,
+	})
+	if err != nil {
+		body = []byte(e.Message)
+	}
+
+	return &httpgrpc.HTTPResponse{
+		Code: int32(e.StatusCode()),
+		Headers: []*httpgrpc.Header{
+			{Key: "Content-Type", Values: []string{"application/json"}},
+		},
+		Body: body,
+	}
+}
+
+// GRPCStatus implements the interface used by the gRPC status package, making the error an httpgrpc error.
+func (e *APIError) GRPCStatus() *grpcstatus.Status {
+	if se, ok := httpgrpc.ErrorFromHTTPResponse(e.HTTPResponse()).(interface{ GRPCStatus() *grpcstatus.Status }); ok {
+		return se.GRPCStatus()
+	}
+	return grpcstatus.New(codes.Internal, e.Message)
+}
+
+const statusError = "error"
+
+// jsonError is the Prometheus-style JSON error object.
+type jsonError struct {
+	Status    string `json:"status"`
+	ErrorType Type   `json:"errorType"`
+	Error     string `json:"error"`
+}
+
+// FromError returns the APIError of the input error, mapping the internal errors to their type:
+//
+//	*APIError                                         as is
+//	context.Canceled, promql.ErrQueryCanceled         canceled
+//	context.DeadlineExceeded, promql.ErrQueryTimeout  timeout
+//	validation.LimitError, chunk.QueryError           limit_exceeded
+//	promql.ErrTooManySamples                          limit_exceeded
+//	parser.ParseErrors, *parser.ParseErr              bad_data
+//	request body too large                            too_large
+//	promql.ErrStorage                                 the type of the wrapped error
+//	httpgrpc errors                                   the type of the JSON error object in the body, if any,
+//	                                                  otherwise the type of the status code
+//	gRPC errors                                       the type of the gRPC code
+//	anything else                                     internal
+//
+// The status codes of the httpgrpc errors are mapped to the types: 400 bad_data, 404 not_found,
+// 413 too_large, 422 limit_exceeded, 429 too_many_requests, 499 canceled, 503 unavailable,
+// 504 timeout, any other 4xx bad_data and any other 5xx internal.
+func FromError(err error) *APIError {
+	if err == nil {
+		return nil
+	}
+
+	var (
+		apiErr     *APIError
+		storageErr promql.ErrStorage
+		limitErr   validation.LimitError
+		queryErr   chunk.QueryError
+		samplesErr promql.ErrTooManySamples
+		canceled   promql.ErrQueryCanceled
+		timeout    promql.ErrQueryTimeout
+		parseErrs  parser.ParseErrors
+		parseErr   *parser.ParseErr
+	)
+
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &storageErr) && storageErr.Err != nil:
+		return FromError(storageErr.Err)
+	case errors.Is(err, context.Canceled), errors.As(err, &canceled):
+		return New(TypeCanceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &timeout):
+		return New(TypeTimeout, err.Error())
+	case errors.As(err, &limitErr), errors.As(err, &queryErr), errors.As(err, &samplesErr):
+		return New(TypeLimitExceeded, err.Error())
+	case errors.As(err, &parseErrs), errors.As(err, &parseErr):
+		return New(TypeBadData, err.Error())
+	case util.IsRequestBodyTooLarge(err):
+		return New(TypeTooLarge, err.Error())
+	}
+
+	if resp, ok := httpgrpc.HTTPResponseFromError(err); ok {
+		return FromHTTPResponse(int(resp.Code), resp.Body)
+	}
+	if resp, ok := httpgrpc.HTTPResponseFromError(errors.Cause(err)); ok {
+		return FromHTTPResponse(int(resp.Code), resp.Body)
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		s, ok = status.FromError(errors.Cause(err))
+	}
+	if ok {
+		// Cortex uses the HTTP status codes as gRPC codes for the httpgrpc errors.
+		if code := int(s.Code()); code >= 100 {
+			return New(typeFromStatusCode(code), s.Message())
+		}
+		return New(typeFromGRPCCode(s.Code()), s.Message())
+	}
+
+	return New(TypeInternal, err.Error())
+}
+
+// FromHTTPResponse returns the APIError of an error HTTP response. If the body is a Prometheus-style
+// JSON error object, its type and message are preserved.
+func FromHTTPResponse(code int, body []byte) *APIError {
+	var jsonErr jsonError
+	if err := json.Unmarshal(body, &jsonErr); err == nil && jsonErr.Status == statusError {
+		typ := jsonErr.ErrorType
+		if !typ.valid() {
+			typ = typeFromStatusCode(code)
+		}
+		return New(typ, jsonErr.Error)
+	}
+
+	return New(typeFromStatusCode(code), strings.TrimSpace(string(body)))
+}
+
+// WriteError writes the JSON error object of the input error to the response.
+func WriteError(w http.ResponseWriter, err error) {
+	resp := FromError(err).HTTPResponse()
+
+	w.Header().Del("Content-Length")
+	for _, h := range resp.Headers {
+		w.Header()[h.Key] = h.Values
+	}
+	w.WriteHeader(int(resp.Code))
+	_, _ = w.Write(resp.Body)
+}
+
+func typeFromStatusCode(code int) Type {
+	switch code {
+	case http.StatusBadRequest:
+		return TypeBadData
+	case http.StatusNotFound:
+		return TypeNotFound
+	case http.StatusRequestEntityTooLarge:
+		return TypeTooLarge
+	case http.StatusUnprocessableEntity:
+		return TypeLimitExceeded
+	case http.StatusTooManyRequests:
+		return TypeTooManyRequests
+	case StatusClientClosedRequest:
+		return TypeCanceled
+	case http.StatusServiceUnavailable:
+		return TypeUnavailable
+	case http.StatusGatewayTimeout:
+		return TypeTimeout
+	}
+
+	if code/100 == 4 {
+		return TypeBadData
+	}
+	return TypeInternal
+}
+
+func typeFromGRPCCode(code codes.Code) Type {
+	switch code {
+	case codes.Canceled:
+		return TypeCanceled
+	case codes.DeadlineExceeded:
+		return TypeTimeout
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return TypeBadData
+	case codes.NotFound:
+		return TypeNotFound
+	case codes.ResourceExhausted:
+		return TypeLimitExceeded
+	case codes.Unavailable:
+		return TypeUnavailable
+	default:
+		return TypeInternal
+	}
+}
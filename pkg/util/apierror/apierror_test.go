@@ -0,0 +1,245 @@
+package apierror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/status"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/cortexproject/cortex/pkg/chunk"
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestType_StatusCode(t *testing.T) {
+	for typ, expected := range map[Type]int{
+		TypeTimeout:         http.StatusGatewayTimeout,
+		TypeCanceled:        StatusClientClosedRequest,
+		TypeExec:            http.StatusUnprocessableEntity,
+		TypeBadData:         http.StatusBadRequest,
+		TypeInternal:        http.StatusInternalServerError,
+		TypeUnavailable:     http.StatusServiceUnavailable,
+		TypeNotFound:        http.StatusNotFound,
+		TypeLimitExceeded:   http.StatusUnprocessableEntity,
+		TypeTooManyRequests: http.StatusTooManyRequests,
+		TypeTooLarge:        http.StatusRequestEntityTooLarge,
+		Type("unknown"):     http.StatusInternalServerError,
+	} {
+		assert.Equal(t, expected, typ.StatusCode(), string(typ))
+	}
+}
+
+func TestFromError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err             error
+		expectedType    Type
+		expectedMessage string
+	}{
+		"api error": {
+			err:             New(TypeTooManyRequests, "too many outstanding requests"),
+			expectedType:    TypeTooManyRequests,
+			expectedMessage: "too many outstanding requests",
+		},
+		"wrapped api error": {
+			err:             errors.Wrap(New(TypeNotFound, "not found"), "wrapped"),
+			expectedType:    TypeNotFound,
+			expectedMessage: "not found",
+		},
+		"context canceled": {
+			err:             context.Canceled,
+			expectedType:    TypeCanceled,
+			expectedMessage: "context canceled",
+		},
+		"context deadline exceeded": {
+			err:             errors.Wrap(context.DeadlineExceeded, "query"),
+			expectedType:    TypeTimeout,
+			expectedMessage: "query: context deadline exceeded",
+		},
+		"promql query canceled": {
+			err:             promql.ErrQueryCanceled("query evaluation"),
+			expectedType:    TypeCanceled,
+			expectedMessage: "query was canceled in query evaluation",
+		},
+		"promql query timeout": {
+			err:             promql.ErrQueryTimeout("query evaluation"),
+			expectedType:    TypeTimeout,
+			expectedMessage: "query timed out in query evaluation",
+		},
+		"promql too many samples": {
+			err:             promql.ErrTooManySamples("query evaluation"),
+			expectedType:    TypeLimitExceeded,
+			expectedMessage: "query processing would load too many samples into memory in query evaluation",
+		},
+		"promql storage error": {
+			err:             promql.ErrStorage{Err: validation.LimitError("the query hit the max number of chunks limit")},
+			expectedType:    TypeLimitExceeded,
+			expectedMessage: "the query hit the max number of chunks limit",
+		},
+		"validation limit error": {
+			err:             validation.LimitError("the query hit the max number of series limit"),
+			expectedType:    TypeLimitExceeded,
+			expectedMessage: "the query hit the max number of series limit",
+		},
+		"chunk query error": {
+			err:             chunk.QueryError("the query hit the max number of chunks limit"),
+			expectedType:    TypeLimitExceeded,
+			expectedMessage: "the query hit the max number of chunks limit",
+		},
+		"parse errors": {
+			err:             parser.ParseErrors{{Err: errors.New("unexpected end of input")}},
+			expectedType:    TypeBadData,
+			expectedMessage: "1:1: parse error: unexpected end of input",
+		},
+		"parse error": {
+			err:             &parser.ParseErr{Err: errors.New("unexpected end of input")},
+			expectedType:    TypeBadData,
+			expectedMessage: "1:1: parse error: unexpected end of input",
+		},
+		"request body too large": {
+			err:             errors.New("http: request body too large"),
+			expectedType:    TypeTooLarge,
+			expectedMessage: "http: request body too large",
+		},
+		"httpgrpc error with plain text body": {
+			err:             httpgrpc.Errorf(http.StatusTooManyRequests, "too many outstanding requests"),
+			expectedType:    TypeTooManyRequests,
+			expectedMessage: "too many outstanding requests",
+		},
+		"httpgrpc error with JSON body": {
+			err:             New(TypeLimitExceeded, "the query time range exceeds the limit").GRPCStatus().Err(),
+			expectedType:    TypeLimitExceeded,
+			expectedMessage: "the query time range exceeds the limit",
+		},
+		"wrapped httpgrpc error": {
+			err:             errors.Wrap(httpgrpc.Errorf(http.StatusServiceUnavailable, "no healthy querier"), "query"),
+			expectedType:    TypeUnavailable,
+			expectedMessage: "no healthy querier",
+		},
+		"gRPC canceled": {
+			err:             status.Error(codes.Canceled, "canceled"),
+			expectedType:    TypeCanceled,
+			expectedMessage: "canceled",
+		},
+		"gRPC deadline exceeded": {
+			err:             status.Error(codes.DeadlineExceeded, "deadline exceeded"),
+			expectedType:    TypeTimeout,
+			expectedMessage: "deadline exceeded",
+		},
+		"gRPC invalid argument": {
+			err:             status.Error(codes.InvalidArgument, "invalid matcher"),
+			expectedType:    TypeBadData,
+			expectedMessage: "invalid matcher",
+		},
+		"gRPC failed precondition": {
+			err:             status.Error(codes.FailedPrecondition, "failed precondition"),
+			expectedType:    TypeBadData,
+			expectedMessage: "failed precondition",
+		},
+		"gRPC out of range": {
+			err:             status.Error(codes.OutOfRange, "out of range"),
+			expectedType:    TypeBadData,
+			expectedMessage: "out of range",
+		},
+		"gRPC not found": {
+			err:             status.Error(codes.NotFound, "not found"),
+			expectedType:    TypeNotFound,
+			expectedMessage: "not found",
+		},
+		"gRPC resource exhausted": {
+			err:             status.Error(codes.ResourceExhausted, "grpc: received message larger than max"),
+			expectedType:    TypeLimitExceeded,
+			expectedMessage: "grpc: received message larger than max",
+		},
+		"gRPC unavailable": {
+			err:             errors.Wrap(status.Error(codes.Unavailable, "transport is closing"), "ingester"),
+			expectedType:    TypeUnavailable,
+			expectedMessage: "transport is closing",
+		},
+		"gRPC internal": {
+			err:             status.Error(codes.Internal, "internal"),
+			expectedType:    TypeInternal,
+			expectedMessage: "internal",
+		},
+		"gRPC code used as HTTP status code": {
+			err:             status.Error(codes.Code(http.StatusUnprocessableEntity), "the query hit the max number of series limit"),
+			expectedType:    TypeLimitExceeded,
+			expectedMessage: "the query hit the max number of series limit",
+		},
+		"generic error": {
+			err:             errors.New("unknown"),
+			expectedType:    TypeInternal,
+			expectedMessage: "unknown",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			apiErr := FromError(tc.err)
+			require.NotNil(t, apiErr)
+			assert.Equal(t, tc.expectedType, apiErr.Type)
+			assert.Equal(t, tc.expectedMessage, apiErr.Message)
+		})
+	}
+
+	assert.Nil(t, FromError(nil))
+}
+
+func TestFromHTTPResponse(t *testing.T) {
+	for code, expected := range map[int]Type{
+		http.StatusBadRequest:            TypeBadData,
+		http.StatusNotFound:              TypeNotFound,
+		http.StatusRequestEntityTooLarge: TypeTooLarge,
+		http.StatusUnprocessableEntity:   TypeLimitExceeded,
+		http.StatusTooManyRequests:       TypeTooManyRequests,
+		StatusClientClosedRequest:        TypeCanceled,
+		http.StatusServiceUnavailable:    TypeUnavailable,
+		http.StatusGatewayTimeout:        TypeTimeout,
+		http.StatusMethodNotAllowed:      TypeBadData,
+		http.StatusInternalServerError:   TypeInternal,
+		http.StatusBadGateway:            TypeInternal,
+	} {
+		t.Run(fmt.Sprintf("plain text body with status code %d", code), func(t *testing.T) {
+			assert.Equal(t, New(expected, "error message"), FromHTTPResponse(code, []byte("error message\n")))
+		})
+	}
+
+	t.Run("Prometheus JSON body", func(t *testing.T) {
+		body := []byte(`{"status":"error","errorType":"execution","error":"query processing would load too many samples"}`)
+		assert.Equal(t, New(TypeExec, "query processing would load too many samples"), FromHTTPResponse(http.StatusUnprocessableEntity, body))
+	})
+
+	t.Run("JSON body with an unknown error type", func(t *testing.T) {
+		body := []byte(`{"status":"error","errorType":"unknown","error":"no healthy querier"}`)
+		assert.Equal(t, New(TypeUnavailable, "no healthy querier"), FromHTTPResponse(http.StatusServiceUnavailable, body))
+	})
+}
+
+func TestAPIError_GRPCStatus(t *testing.T) {
+	apiErr := New(TypeLimitExceeded, "the query time range exceeds the limit")
+
+	resp, ok := httpgrpc.HTTPResponseFromError(apiErr)
+	require.True(t, ok)
+	assert.Equal(t, int32(http.StatusUnprocessableEntity), resp.Code)
+	assert.JSONEq(t, `{"status":"error","errorType":"limit_exceeded","error":"the query time range exceeds the limit"}`, string(resp.Body))
+
+	// The error should survive the round trip through the httpgrpc response.
+	assert.Equal(t, apiErr, FromError(httpgrpc.ErrorFromHTTPResponse(resp)))
+}
+
+func TestWriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Length", "10")
+	WriteError(w, validation.LimitError("the query hit the max number of series limit"))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Content-Length"))
+	assert.JSONEq(t, `{"status":"error","errorType":"limit_exceeded","error":"the query hit the max number of series limit"}`, w.Body.String())
+}
@@ -0,0 +1,113 @@
+package apierror
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/weaveworks/common/middleware"
+)
+
+type contextKey int
+
+const recorderContextKey contextKey = 0
+
+// recorder keeps the first typed error returned while serving a request, so that the middleware
+// can use its type when the handler only returns a generic error response.
+type recorder struct {
+	mtx sync.Mutex
+	err *APIError
+}
+
+// RecordError records the typed error of the input error in the context, if it has been
+// injected by the middleware. Errors without a specific type are ignored.
+func RecordError(ctx context.Context, err error) {
+	r, ok := ctx.Value(recorderContextKey).(*recorder)
+	if !ok || err == nil {
+		return
+	}
+
+	apiErr := FromError(err)
+	if apiErr.Type == TypeInternal {
+		return
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.err == nil {
+		r.err = apiErr
+	}
+}
+
+func (r *recorder) recorded() *APIError {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.err
+}
+
+// NewMiddleware returns a middleware rewriting the error responses of the wrapped handler into
+// Prometheus-style JSON error objects, with the error type and status code of the errors
+// recorded with RecordError, if any, otherwise of the status code of the response.
+func NewMiddleware() middleware.Interface {
+	return middleware.Func(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &recorder{}
+			ew := &errorResponseWriter{ResponseWriter: w}
+
+			next.ServeHTTP(ew, r.WithContext(context.WithValue(r.Context(), recorderContextKey, rec)))
+
+			if ew.code == 0 {
+				return
+			}
+
+			apiErr := FromHTTPResponse(ew.code, ew.body.Bytes())
+			if recorded := rec.recorded(); recorded != nil {
+				apiErr = New(recorded.Type, apiErr.Message)
+			}
+			WriteError(w, apiErr)
+		})
+	})
+}
+
+// errorResponseWriter buffers the error responses, passing through the successful ones.
+type errorResponseWriter struct {
+	http.ResponseWriter
+
+	wroteHeader bool
+	code        int // Set only if the response is an error.
+	body        bytes.Buffer
+}
+
+func (w *errorResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if code >= 400 {
+		w.code = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *errorResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.code != 0 {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, used by the streamed responses.
+func (w *errorResponseWriter) Flush() {
+	if w.code != 0 {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,86 @@
+package apierror
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gogo/status"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+
+	"github.com/cortexproject/cortex/pkg/util/validation"
+)
+
+func TestMiddleware(t *testing.T) {
+	for name, tc := range map[string]struct {
+		handler          http.HandlerFunc
+		expectedCode     int
+		expectedBody     string
+		expectedFlushed  bool
+		expectedJSONBody bool
+	}{
+		"successful response": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = w.Write([]byte("ok"))
+				w.(http.Flusher).Flush()
+			},
+			expectedCode:    http.StatusOK,
+			expectedBody:    "ok",
+			expectedFlushed: true,
+		},
+		"plain text error": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "invalid parameter", http.StatusBadRequest)
+			},
+			expectedCode:     http.StatusBadRequest,
+			expectedBody:     `{"status":"error","errorType":"bad_data","error":"invalid parameter"}`,
+			expectedJSONBody: true,
+		},
+		"Prometheus error with a recorded limit error": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				RecordError(r.Context(), validation.LimitError("the query hit the max number of series limit"))
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = w.Write([]byte(`{"status":"error","errorType":"execution","error":"the query hit the max number of series limit"}`))
+			},
+			expectedCode:     http.StatusUnprocessableEntity,
+			expectedBody:     `{"status":"error","errorType":"limit_exceeded","error":"the query hit the max number of series limit"}`,
+			expectedJSONBody: true,
+		},
+		"Prometheus error with a recorded gRPC error": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				RecordError(r.Context(), status.Error(codes.Unavailable, "transport is closing"))
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"status":"error","errorType":"internal","error":"transport is closing"}`))
+			},
+			expectedCode:     http.StatusServiceUnavailable,
+			expectedBody:     `{"status":"error","errorType":"unavailable","error":"transport is closing"}`,
+			expectedJSONBody: true,
+		},
+		"Prometheus error with a recorded generic error": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				RecordError(r.Context(), status.Error(codes.Internal, "unknown"))
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = w.Write([]byte(`{"status":"error","errorType":"execution","error":"unknown"}`))
+			},
+			expectedCode:     http.StatusUnprocessableEntity,
+			expectedBody:     `{"status":"error","errorType":"execution","error":"unknown"}`,
+			expectedJSONBody: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewMiddleware().Wrap(tc.handler).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedFlushed, w.Flushed)
+			if tc.expectedJSONBody {
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+				assert.JSONEq(t, tc.expectedBody, w.Body.String())
+			} else {
+				assert.Equal(t, tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package grpcutil
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errInvalidMethodLimitsQueueTimeout = errors.New("the gRPC method limits queue timeout must be greater than 0")
+
+// MethodLimitsConfig configures the per-method concurrency limits of the gRPC server.
+type MethodLimitsConfig struct {
+	MaxInflightRequests map[string]int `yaml:"max_inflight_requests" doc:"nocli|description=Max number of concurrent requests served by the gRPC server per full method name, e.g. /cortex.Ingester/LabelValues. The requests exceeding the limit are queued. The methods not listed are not limited."`
+	MaxQueuedRequests   int            `yaml:"max_queued_requests"`
+	QueueTimeout        time.Duration  `yaml:"queue_timeout"`
+}
+
+// RegisterFlagsWithPrefix registers flags with prefix.
+func (cfg *MethodLimitsConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.IntVar(&cfg.MaxQueuedRequests, prefix+"max-queued-requests", 10, "Max number of requests queued per limited gRPC method, waiting for a request of the same method to complete. The requests received while the queue is full are rejected with the ResourceExhausted code.")
+	f.DurationVar(&cfg.QueueTimeout, prefix+"queue-timeout", 5*time.Second, "Max time a request to a limited gRPC method waits in the queue. The requests queued for longer are rejected with the ResourceExhausted code.")
+}
+
+// Validate the config and returns an error if the validation doesn't pass.
+func (cfg *MethodLimitsConfig) Validate() error {
+	for method, limit := range cfg.MaxInflightRequests {
+		if limit <= 0 {
+			return fmt.Errorf("the max inflight requests of the gRPC method %s must be greater than 0", method)
+		}
+	}
+	if len(cfg.MaxInflightRequests) > 0 && cfg.QueueTimeout <= 0 {
+		return errInvalidMethodLimitsQueueTimeout
+	}
+	return nil
+}
+
+// methodLimit tracks the inflight and queued requests of a limited method.
+type methodLimit struct {
+	// Buffered channel holding a token for each inflight request.
+	slots chan struct{}
+
+	// Number of queued requests.
+	queued int64
+
+	inflightGauge prometheus.Gauge
+	queuedGauge   prometheus.Gauge
+	rejected      prometheus.Counter
+}
+
+// MethodLimiter limits the number of concurrent requests served by the gRPC server per method,
+// so that a burst of requests to a method doesn't starve the requests to the other methods.
+// The requests exceeding the limit of their method are queued, up to a max number of queued
+// requests and for up to a max time, and rejected with the ResourceExhausted code otherwise.
+type MethodLimiter struct {
+	cfg     MethodLimitsConfig
+	methods map[string]*methodLimit
+}
+
+// NewMethodLimiter makes a new MethodLimiter.
+func NewMethodLimiter(cfg MethodLimitsConfig, reg prometheus.Registerer) *MethodLimiter {
+	inflight := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cortex_grpc_method_inflight_requests",
+		Help: "Number of inflight requests per limited gRPC method.",
+	}, []string{"method"})
+	queued := promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cortex_grpc_method_queued_requests",
+		Help: "Number of requests queued per limited gRPC method.",
+	}, []string{"method"})
+	rejected := promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_grpc_method_rejected_requests_total",
+		Help: "Total number of requests rejected per limited gRPC method because the queue was full or they've been queued for too long.",
+	}, []string{"method"})
+
+	l := &MethodLimiter{
+		cfg:     cfg,
+		methods: make(map[string]*methodLimit, len(cfg.MaxInflightRequests)),
+	}
+	for method, limit := range cfg.MaxInflightRequests {
+		l.methods[method] = &methodLimit{
+			slots:         make(chan struct{}, limit),
+			inflightGauge: inflight.WithLabelValues(method),
+			queuedGauge:   queued.WithLabelValues(method),
+			rejected:      rejected.WithLabelValues(method),
+		}
+	}
+	return l
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor limiting the concurrency of unary requests.
+func (l *MethodLimiter) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	release, err := l.acquire(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor returns a gRPC interceptor limiting the concurrency of streams. A stream
+// is counted as inflight until its handler returns.
+func (l *MethodLimiter) StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	release, err := l.acquire(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return handler(srv, ss)
+}
+
+// acquire waits until the request to the method can be served, and returns the function to call
+// once the request has been served.
+func (l *MethodLimiter) acquire(ctx context.Context, method string) (func(), error) {
+	m, ok := l.methods[method]
+	if !ok {
+		return func() {}, nil
+	}
+
+	release := func() {
+		<-m.slots
+		m.inflightGauge.Dec()
+	}
+
+	// Fast path: the limit has not been reached.
+	select {
+	case m.slots <- struct{}{}:
+		m.inflightGauge.Inc()
+		return release, nil
+	default:
+	}
+
+	if atomic.AddInt64(&m.queued, 1) > int64(l.cfg.MaxQueuedRequests) {
+		atomic.AddInt64(&m.queued, -1)
+		m.rejected.Inc()
+		return nil, status.Errorf(codes.ResourceExhausted, "too many concurrent requests to %s, and the queue is full", method)
+	}
+	m.queuedGauge.Inc()
+	defer func() {
+		atomic.AddInt64(&m.queued, -1)
+		m.queuedGauge.Dec()
+	}()
+
+	timer := time.NewTimer(l.cfg.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case m.slots <- struct{}{}:
+		m.inflightGauge.Inc()
+		return release, nil
+	case <-timer.C:
+		m.rejected.Inc()
+		return nil, status.Errorf(codes.ResourceExhausted, "too many concurrent requests to %s, and the request has been queued for longer than %s", method, l.cfg.QueueTimeout)
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
@@ -0,0 +1,178 @@
+package grpcutil
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cortexproject/cortex/pkg/util/test"
+)
+
+const (
+	limitedMethod   = "/cortex.Ingester/LabelValues"
+	unlimitedMethod = "/cortex.Ingester/QueryStream"
+)
+
+func TestMethodLimitsConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		cfg      MethodLimitsConfig
+		expected string
+	}{
+		"should pass with no limits": {
+			cfg: MethodLimitsConfig{},
+		},
+		"should pass with valid limits": {
+			cfg: MethodLimitsConfig{MaxInflightRequests: map[string]int{limitedMethod: 1}, QueueTimeout: time.Second},
+		},
+		"should fail on non positive limit": {
+			cfg:      MethodLimitsConfig{MaxInflightRequests: map[string]int{limitedMethod: 0}, QueueTimeout: time.Second},
+			expected: "the max inflight requests of the gRPC method /cortex.Ingester/LabelValues must be greater than 0",
+		},
+		"should fail on non positive queue timeout": {
+			cfg:      MethodLimitsConfig{MaxInflightRequests: map[string]int{limitedMethod: 1}},
+			expected: errInvalidMethodLimitsQueueTimeout.Error(),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			err := testData.cfg.Validate()
+			if testData.expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testData.expected)
+			}
+		})
+	}
+}
+
+func TestMethodLimiter_UnaryServerInterceptor(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	limiter := NewMethodLimiter(MethodLimitsConfig{
+		MaxInflightRequests: map[string]int{limitedMethod: 1},
+		MaxQueuedRequests:   1,
+		QueueTimeout:        200 * time.Millisecond,
+	}, reg)
+
+	// Start a request holding the only inflight slot until released.
+	unblock := make(chan struct{})
+	blockingHandler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-unblock
+		return "blocked", nil
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := limiter.UnaryServerInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: limitedMethod}, blockingHandler)
+		firstDone <- err
+	}()
+	test.Poll(t, time.Second, float64(1), func() interface{} {
+		return testutil.ToFloat64(limiter.methods[limitedMethod].inflightGauge)
+	})
+
+	// The requests to the other methods are not limited.
+	resp, err := limiter.UnaryServerInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: unlimitedMethod}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	// A queued request is rejected once the queue timeout expires.
+	_, err = limiter.UnaryServerInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: limitedMethod}, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// A request is rejected right away while the queue is full.
+	secondDone := make(chan error, 1)
+	go func() {
+		_, err := limiter.UnaryServerInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: limitedMethod}, handler)
+		secondDone <- err
+	}()
+	test.Poll(t, time.Second, float64(1), func() interface{} {
+		return testutil.ToFloat64(limiter.methods[limitedMethod].queuedGauge)
+	})
+
+	_, err = limiter.UnaryServerInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: limitedMethod}, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// The queued request is served once the inflight one completes.
+	close(unblock)
+	require.NoError(t, <-firstDone)
+	require.NoError(t, <-secondDone)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_grpc_method_inflight_requests Number of inflight requests per limited gRPC method.
+		# TYPE cortex_grpc_method_inflight_requests gauge
+		cortex_grpc_method_inflight_requests{method="/cortex.Ingester/LabelValues"} 0
+
+		# HELP cortex_grpc_method_queued_requests Number of requests queued per limited gRPC method.
+		# TYPE cortex_grpc_method_queued_requests gauge
+		cortex_grpc_method_queued_requests{method="/cortex.Ingester/LabelValues"} 0
+
+		# HELP cortex_grpc_method_rejected_requests_total Total number of requests rejected per limited gRPC method because the queue was full or they've been queued for too long.
+		# TYPE cortex_grpc_method_rejected_requests_total counter
+		cortex_grpc_method_rejected_requests_total{method="/cortex.Ingester/LabelValues"} 2
+	`)))
+}
+
+func TestMethodLimiter_ShouldStopWaitingOnContextCanceled(t *testing.T) {
+	limiter := NewMethodLimiter(MethodLimitsConfig{
+		MaxInflightRequests: map[string]int{limitedMethod: 1},
+		MaxQueuedRequests:   1,
+		QueueTimeout:        time.Minute,
+	}, nil)
+
+	release, err := limiter.acquire(context.Background(), limitedMethod)
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = limiter.acquire(ctx, limitedMethod)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	assert.Equal(t, int64(0), limiter.methods[limitedMethod].queued)
+}
+
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *mockServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestMethodLimiter_StreamServerInterceptor(t *testing.T) {
+	limiter := NewMethodLimiter(MethodLimitsConfig{
+		MaxInflightRequests: map[string]int{limitedMethod: 1},
+		MaxQueuedRequests:   0,
+		QueueTimeout:        time.Second,
+	}, nil)
+	stream := &mockServerStream{ctx: context.Background()}
+
+	// The stream is counted as inflight until its handler returns.
+	err := limiter.StreamServerInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: limitedMethod}, func(srv interface{}, ss grpc.ServerStream) error {
+		err := limiter.StreamServerInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: limitedMethod}, func(srv interface{}, ss grpc.ServerStream) error {
+			return nil
+		})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		return nil
+	})
+	require.NoError(t, err)
+
+	// The slot is released once the stream completes.
+	err = limiter.StreamServerInterceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: limitedMethod}, func(srv interface{}, ss grpc.ServerStream) error {
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,35 @@
+package grpcutil
+
+import (
+	"net/http"
+
+	"github.com/weaveworks/common/httpgrpc"
+)
+
+// QuerierFailureHeader marks the responses of the queries which failed because the connection
+// to the querier executing them was lost, so that the query-frontend can retry them.
+const QuerierFailureHeader = "X-Cortex-Querier-Failure"
+
+// QuerierFailureResponse returns the response of a query which failed because the connection
+// to the querier executing it was lost.
+func QuerierFailureResponse(err error) *httpgrpc.HTTPResponse {
+	return &httpgrpc.HTTPResponse{
+		Code:    http.StatusInternalServerError,
+		Headers: []*httpgrpc.Header{{Key: QuerierFailureHeader, Values: []string{"true"}}},
+		Body:    []byte(err.Error()),
+	}
+}
+
+// IsQuerierFailure returns whether the response is the one of a query which failed because the
+// connection to the querier executing it was lost.
+func IsQuerierFailure(resp *httpgrpc.HTTPResponse) bool {
+	if resp == nil {
+		return false
+	}
+	for _, h := range resp.Headers {
+		if h.Key == QuerierFailureHeader {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package grpcutil
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/weaveworks/common/httpgrpc"
+)
+
+// TooManyRequestsResponse returns the response of a query rejected because the queue of the
+// tenant is full. The Retry-After header is set to the given duration, rounded up to seconds,
+// unless it's zero.
+func TooManyRequestsResponse(retryAfter time.Duration) *httpgrpc.HTTPResponse {
+	resp := &httpgrpc.HTTPResponse{
+		Code: http.StatusTooManyRequests,
+		Body: []byte("too many outstanding requests"),
+	}
+	if retryAfter > 0 {
+		resp.Headers = []*httpgrpc.Header{{Key: "Retry-After", Values: []string{strconv.FormatInt(RetryAfterSeconds(retryAfter), 10)}}}
+	}
+	return resp
+}
+
+// RetryAfterSeconds returns the duration rounded up to seconds, as used by the Retry-After header.
+func RetryAfterSeconds(retryAfter time.Duration) int64 {
+	return int64(math.Ceil(retryAfter.Seconds()))
+}
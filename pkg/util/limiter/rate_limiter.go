@@ -47,6 +47,14 @@ func (l *RateLimiter) AllowN(now time.Time, tenantID string, n int) bool {
 	return l.getTenantLimiter(now, tenantID).AllowN(now, n)
 }
 
+// WouldAllowN reports whether n tokens may be consumed at time now, without consuming them.
+func (l *RateLimiter) WouldAllowN(now time.Time, tenantID string, n int) bool {
+	r := l.getTenantLimiter(now, tenantID).ReserveN(now, n)
+	defer r.CancelAt(now)
+
+	return r.OK() && r.DelayFrom(now) == 0
+}
+
 // Limit returns the currently configured maximum overall tokens rate.
 func (l *RateLimiter) Limit(now time.Time, tenantID string) float64 {
 	return float64(l.getTenantLimiter(now, tenantID).Limit())
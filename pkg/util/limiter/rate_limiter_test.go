@@ -127,3 +127,25 @@ func (s *staticLimitStrategy) Burst(tenantID string) int {
 
 	return tenant.burst
 }
+
+func TestRateLimiter_WouldAllowN(t *testing.T) {
+	strategy := &staticLimitStrategy{tenants: map[string]struct {
+		limit float64
+		burst int
+	}{
+		"tenant-1": {limit: 10, burst: 20},
+	}}
+
+	limiter := NewRateLimiter(strategy, 10*time.Second)
+	now := time.Now()
+
+	// The tokens are not consumed.
+	assert.Equal(t, true, limiter.WouldAllowN(now, "tenant-1", 20))
+	assert.Equal(t, true, limiter.WouldAllowN(now, "tenant-1", 20))
+	assert.Equal(t, false, limiter.WouldAllowN(now, "tenant-1", 21))
+
+	assert.Equal(t, true, limiter.AllowN(now, "tenant-1", 15))
+	assert.Equal(t, false, limiter.WouldAllowN(now, "tenant-1", 6))
+	assert.Equal(t, true, limiter.WouldAllowN(now, "tenant-1", 5))
+	assert.Equal(t, true, limiter.AllowN(now, "tenant-1", 5))
+}
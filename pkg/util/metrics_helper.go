@@ -207,6 +207,40 @@ func (d MetricFamiliesPerUser) SendSumOfGaugesPerUserWithLabels(out chan<- prome
 	}
 }
 
+// SendMaxOfGaugesPerUserWithMappedLabels provides metrics with the provided label names on a per-user basis, after
+// mapping the label values with mapFn. If different label values are mapped to the same ones, the max of the gauges
+// is sent. This function assumes that `user` is the first label on the provided metric Desc
+func (d MetricFamiliesPerUser) SendMaxOfGaugesPerUserWithMappedLabels(out chan<- prometheus.Metric, desc *prometheus.Desc, metric string, mapFn func(labelValues []string) []string, labelNames ...string) {
+	for _, userEntry := range d {
+		if userEntry.user == "" {
+			continue
+		}
+
+		mf := userEntry.metrics[metric]
+		if mf == nil {
+			continue
+		}
+
+		result := singleValueWithLabelsMap{}
+		for _, m := range mf.GetMetric() {
+			lbls, include := getLabelValues(m, labelNames)
+			if !include {
+				continue
+			}
+
+			lbls = mapFn(lbls)
+			key := getLabelsString(lbls)
+			if r, ok := result[key]; ok && r.Value >= gaugeValue(m) {
+				continue
+			}
+			result[key] = singleValueWithLabels{Value: gaugeValue(m), LabelValues: lbls}
+		}
+
+		result.prependUserLabelValue(userEntry.user)
+		result.WriteToMetricChannel(out, desc, prometheus.GaugeValue)
+	}
+}
+
 func (d MetricFamiliesPerUser) sumOfSingleValuesWithLabels(metric string, fn func(*dto.Metric) float64, labelNames []string) singleValueWithLabelsMap {
 	result := singleValueWithLabelsMap{}
 	for _, userEntry := range d {
@@ -3,6 +3,7 @@ package net
 import (
 	"context"
 	"net"
+	"strings"
 	"syscall"
 
 	"github.com/pkg/errors"
@@ -10,27 +11,56 @@ import (
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 )
 
-var errBlockedAddress = errors.New("blocked address")
+// ErrBlockedAddress is the error returned when dialing an address blocked by the firewall.
+var ErrBlockedAddress = errors.New("blocked address")
 var errInvalidAddress = errors.New("invalid address")
 
 type FirewallDialerConfigProvider interface {
 	BlockCIDRNetworks() []flagext.CIDR
 	BlockPrivateAddresses() bool
+
+	// AllowCIDRNetworks returns the network CIDRs allowed even if blocked by the other rules.
+	AllowCIDRNetworks() []flagext.CIDR
+
+	// BlockHostnames returns the hostnames to block. A hostname starting with "*." blocks its subdomains.
+	BlockHostnames() []string
+
+	// AllowHostnames returns the hostnames allowed even if blocked by the other rules, whatever
+	// address they resolve to. A hostname starting with "*." allows its subdomains.
+	AllowHostnames() []string
 }
 
 // FirewallDialer is a net dialer which integrates a firewall to block specific addresses.
+// The hostnames are checked before the DNS resolution, while the addresses are checked once
+// resolved, right before connecting, so that the DNS resolution can't be used to bypass it.
 type FirewallDialer struct {
 	parent      *net.Dialer
+	allowed     *net.Dialer
 	cfgProvider FirewallDialerConfigProvider
 }
 
 func NewFirewallDialer(cfgProvider FirewallDialerConfigProvider) *FirewallDialer {
 	d := &FirewallDialer{cfgProvider: cfgProvider}
 	d.parent = &net.Dialer{Control: d.control}
+	d.allowed = &net.Dialer{}
 	return d
 }
 
 func (d *FirewallDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: errInvalidAddress}
+	}
+
+	if net.ParseIP(host) == nil {
+		if matchesHostname(host, d.cfgProvider.AllowHostnames()) {
+			return d.allowed.DialContext(ctx, network, address)
+		}
+		if matchesHostname(host, d.cfgProvider.BlockHostnames()) {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: ErrBlockedAddress}
+		}
+	}
+
 	return d.parent.DialContext(ctx, network, address)
 }
 
@@ -49,22 +79,65 @@ func (d *FirewallDialer) control(_, address string, _ syscall.RawConn) error {
 	}
 
 	// We expect an IP as address because the DNS resolution already occurred.
+	ip := net.ParseIP(host)
+	if ip == nil || d.blocks(ip) {
+		return ErrBlockedAddress
+	}
+
+	return nil
+}
+
+// BlocksHost returns whether the connections to the host are blocked. The host names are
+// only resolved when dialing, so they're reported as blocked only if they match the blocked hostnames.
+func (d *FirewallDialer) BlocksHost(host string) bool {
 	ip := net.ParseIP(host)
 	if ip == nil {
-		return errBlockedAddress
+		return !matchesHostname(host, d.cfgProvider.AllowHostnames()) && matchesHostname(host, d.cfgProvider.BlockHostnames())
+	}
+	return d.blocks(ip)
+}
+
+func (d *FirewallDialer) blocks(ip net.IP) bool {
+	for _, cidr := range d.cfgProvider.AllowCIDRNetworks() {
+		if cidr.Value.Contains(ip) {
+			return false
+		}
 	}
 
-	if blockPrivateAddresses && (isPrivate(ip) || isLocal(ip)) {
-		return errBlockedAddress
+	if d.cfgProvider.BlockPrivateAddresses() && (isPrivate(ip) || isLocal(ip)) {
+		return true
 	}
 
-	for _, cidr := range blockCIDRNetworks {
+	for _, cidr := range d.cfgProvider.BlockCIDRNetworks() {
 		if cidr.Value.Contains(ip) {
-			return errBlockedAddress
+			return true
 		}
 	}
 
-	return nil
+	return false
+}
+
+// matchesHostname returns whether the host matches any of the hostnames, ignoring the case
+// and the trailing dot. A hostname starting with "*." matches its subdomains.
+func matchesHostname(host string, hostnames []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, h := range hostnames {
+		h = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(h), "."))
+		if h == "" {
+			continue
+		}
+
+		if strings.HasPrefix(h, "*.") {
+			if strings.HasSuffix(host, h[1:]) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+
+	return false
 }
 
 func isLocal(ip net.IP) bool {
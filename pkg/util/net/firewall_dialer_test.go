@@ -17,6 +17,8 @@ import (
 func TestFirewallDialer(t *testing.T) {
 	blockedCIDR := flagext.CIDR{}
 	require.NoError(t, blockedCIDR.Set("172.217.168.64/28"))
+	allowedCIDR := flagext.CIDR{}
+	require.NoError(t, allowedCIDR.Set("127.0.0.0/8"))
 
 	type testCase struct {
 		address       string
@@ -71,6 +73,45 @@ func TestFirewallDialer(t *testing.T) {
 				{"::ffff:172.217.168.78", true},     // IPv6 mapped v4 blocked
 			},
 		},
+		"should allow the CIDRs in the allow list even if blocked": {
+			cfg: firewallCfgProvider{
+				blockPrivateAddresses: true,
+				blockCIDRNetworks:     []flagext.CIDR{blockedCIDR},
+				allowCIDRNetworks:     []flagext.CIDR{allowedCIDR},
+			},
+			cases: []testCase{
+				{"127.0.0.1", false},
+				{"::ffff:127.0.0.1", false}, // IPv6 mapped v4 allowed
+				{"10.0.0.1", true},
+				{"172.217.168.78", true},
+			},
+		},
+		"should support blocking hostnames": {
+			cfg: firewallCfgProvider{
+				blockHostnames: []string{"localhost", "*.example.com"},
+			},
+			cases: []testCase{
+				{"localhost", true},
+				{"LOCALHOST.", true},
+				{"api.example.com", true},
+				{"a.b.example.com", true},
+				{"example.com", false},
+				{"127.0.0.1", false},
+			},
+		},
+		"should allow the hostnames in the allow list whatever address they resolve to": {
+			cfg: firewallCfgProvider{
+				blockPrivateAddresses: true,
+				blockHostnames:        []string{"*.example.com"},
+				allowHostnames:        []string{"localhost", "allowed.example.com"},
+			},
+			cases: []testCase{
+				{"localhost", false},
+				{"allowed.example.com", false},
+				{"api.example.com", true},
+				{"127.0.0.1", true},
+			},
+		},
 	}
 
 	for testName, testData := range tests {
@@ -88,11 +129,11 @@ func TestFirewallDialer(t *testing.T) {
 					}
 
 					if tc.expectBlocked {
-						assert.Error(t, err, errBlockedAddress.Error())
-						assert.Contains(t, err.Error(), errBlockedAddress.Error())
+						assert.Error(t, err, ErrBlockedAddress.Error())
+						assert.Contains(t, err.Error(), ErrBlockedAddress.Error())
 					} else {
 						// We're fine either if succeeded or triggered a different error (eg. connection refused).
-						assert.True(t, err == nil || !strings.Contains(err.Error(), errBlockedAddress.Error()))
+						assert.True(t, err == nil || !strings.Contains(err.Error(), ErrBlockedAddress.Error()))
 					}
 				})
 			}
@@ -100,6 +141,23 @@ func TestFirewallDialer(t *testing.T) {
 	}
 }
 
+func TestFirewallDialer_BlocksHost(t *testing.T) {
+	blockedCIDR := flagext.CIDR{}
+	require.NoError(t, blockedCIDR.Set("172.217.168.64/28"))
+
+	d := NewFirewallDialer(firewallCfgProvider{
+		blockCIDRNetworks: []flagext.CIDR{blockedCIDR},
+		blockHostnames:    []string{"*.internal"},
+		allowHostnames:    []string{"alerts.internal"},
+	})
+
+	assert.True(t, d.BlocksHost("172.217.168.78"))
+	assert.True(t, d.BlocksHost("api.internal"))
+	assert.False(t, d.BlocksHost("alerts.internal"))
+	assert.False(t, d.BlocksHost("example.com"))
+	assert.False(t, d.BlocksHost("10.0.0.1"))
+}
+
 func TestIsPrivate(t *testing.T) {
 	tests := []struct {
 		ip       net.IP
@@ -137,6 +195,9 @@ func TestIsPrivate(t *testing.T) {
 type firewallCfgProvider struct {
 	blockCIDRNetworks     []flagext.CIDR
 	blockPrivateAddresses bool
+	allowCIDRNetworks     []flagext.CIDR
+	blockHostnames        []string
+	allowHostnames        []string
 }
 
 func (p firewallCfgProvider) BlockCIDRNetworks() []flagext.CIDR {
@@ -146,3 +207,15 @@ func (p firewallCfgProvider) BlockCIDRNetworks() []flagext.CIDR {
 func (p firewallCfgProvider) BlockPrivateAddresses() bool {
 	return p.blockPrivateAddresses
 }
+
+func (p firewallCfgProvider) AllowCIDRNetworks() []flagext.CIDR {
+	return p.allowCIDRNetworks
+}
+
+func (p firewallCfgProvider) BlockHostnames() []string {
+	return p.blockHostnames
+}
+
+func (p firewallCfgProvider) AllowHostnames() []string {
+	return p.allowHostnames
+}
@@ -0,0 +1,102 @@
+package push
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/weaveworks/common/httpgrpc"
+	"github.com/weaveworks/common/middleware"
+
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/log"
+	"github.com/cortexproject/cortex/pkg/util/push/otlppb"
+)
+
+const otlpProtobufContentType = "application/x-protobuf"
+
+// OTLPHandler is a http.Handler which accepts OpenTelemetry protocol (OTLP) metrics
+// export requests, encoded with protobuf, and converts them to WriteRequests.
+func OTLPHandler(maxRecvMsgSize int, sourceIPs *middleware.SourceIPExtractor, push Func) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := log.WithContext(ctx, log.Logger)
+		if sourceIPs != nil {
+			source := sourceIPs.Get(r)
+			if source != "" {
+				ctx = util.AddSourceIPsToOutgoingContext(ctx, source)
+				logger = log.WithSourceIPs(source, logger)
+			}
+		}
+
+		// The OTLP JSON encoding is not supported.
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != otlpProtobufContentType {
+			http.Error(w, "unsupported content type, expected "+otlpProtobufContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var (
+			body         io.Reader = r.Body
+			expectedSize           = int(r.ContentLength)
+		)
+
+		switch r.Header.Get("Content-Encoding") {
+		case "":
+		case "gzip":
+			gzipReader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				level.Error(logger).Log("err", err.Error())
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer gzipReader.Close()
+
+			// The uncompressed size is unknown.
+			body = gzipReader
+			expectedSize = -1
+		default:
+			http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var otlpReq otlppb.ExportMetricsServiceRequest
+		if err := util.ParseProtoReader(ctx, body, expectedSize, maxRecvMsgSize, &otlpReq, util.NoCompression); err != nil {
+			level.Error(logger).Log("err", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req, err := OTLPToWriteRequest(&otlpReq)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to convert OTLP metrics", "err", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if _, err := push(ctx, req); err != nil {
+			resp, ok := httpgrpc.HTTPResponseFromError(err)
+			if !ok {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if resp.GetCode() != 202 {
+				level.Error(logger).Log("msg", "push error", "err", err)
+			}
+			writeErrorResponse(w, resp)
+			return
+		}
+
+		out, err := (&otlppb.ExportMetricsServiceResponse{}).Marshal()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", otlpProtobufContentType)
+		if _, err := w.Write(out); err != nil {
+			level.Error(logger).Log("msg", "failed to write OTLP response", "err", err)
+		}
+	})
+}
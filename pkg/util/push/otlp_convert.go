@@ -0,0 +1,396 @@
+package push
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/value"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/util/push/otlppb"
+)
+
+// Resource attributes mapped to the job and instance labels, following the
+// OpenTelemetry to Prometheus compatibility specification.
+const (
+	serviceNameAttribute       = "service.name"
+	serviceNamespaceAttribute  = "service.namespace"
+	serviceInstanceIDAttribute = "service.instance.id"
+)
+
+// Prometheus suffixes of the OTLP units. Units not listed here are used as is.
+var otlpUnits = map[string]string{
+	// Time.
+	"d":   "days",
+	"h":   "hours",
+	"min": "minutes",
+	"s":   "seconds",
+	"ms":  "milliseconds",
+	"us":  "microseconds",
+	"ns":  "nanoseconds",
+
+	// Bytes.
+	"By":   "bytes",
+	"KiBy": "kibibytes",
+	"MiBy": "mebibytes",
+	"GiBy": "gibibytes",
+	"TiBy": "tibibytes",
+	"KBy":  "kilobytes",
+	"MBy":  "megabytes",
+	"GBy":  "gigabytes",
+	"TBy":  "terabytes",
+
+	// SI.
+	"m":   "meters",
+	"V":   "volts",
+	"A":   "amperes",
+	"J":   "joules",
+	"W":   "watts",
+	"g":   "grams",
+	"Cel": "celsius",
+	"Hz":  "hertz",
+	"%":   "percent",
+}
+
+// Prometheus suffixes of the OTLP "per" units (e.g. "By/s").
+var otlpPerUnits = map[string]string{
+	"s":  "second",
+	"m":  "minute",
+	"h":  "hour",
+	"d":  "day",
+	"w":  "week",
+	"mo": "month",
+	"y":  "year",
+}
+
+// OTLPToWriteRequest converts an OTLP metrics export request to a WriteRequest, following
+// the Prometheus naming conventions. Only the cumulative aggregation temporality is supported.
+// It gets timeseries from the pool, so cortexpb.ReuseSlice() should be called when done.
+func OTLPToWriteRequest(req *otlppb.ExportMetricsServiceRequest) (*cortexpb.WriteRequest, error) {
+	c := otlpConverter{}
+
+	for _, rm := range req.ResourceMetrics {
+		resourceLabels := otlpResourceLabels(rm.Resource)
+
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if err := c.addMetric(m, resourceLabels); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return cortexpb.ToWriteRequest(c.labels, c.samples, c.metadata, cortexpb.API), nil
+}
+
+type otlpConverter struct {
+	labels   []labels.Labels
+	samples  []cortexpb.Sample
+	metadata []*cortexpb.MetricMetadata
+}
+
+func (c *otlpConverter) addMetric(m *otlppb.Metric, resourceLabels map[string]string) error {
+	var (
+		metricType cortexpb.MetricMetadata_MetricType
+		name       string
+	)
+
+	switch data := m.Data.(type) {
+	case *otlppb.Metric_Gauge:
+		metricType = cortexpb.GAUGE
+		name = otlpMetricName(m, false)
+
+		for _, p := range data.Gauge.DataPoints {
+			c.addNumberDataPoint(name, p, resourceLabels)
+		}
+
+	case *otlppb.Metric_Sum:
+		if data.Sum.AggregationTemporality != otlppb.AGGREGATION_TEMPORALITY_CUMULATIVE {
+			return otlpTemporalityError(m, data.Sum.AggregationTemporality)
+		}
+
+		// Non-monotonic sums can go up and down, so they're gauges in Prometheus.
+		metricType = cortexpb.GAUGE
+		if data.Sum.IsMonotonic {
+			metricType = cortexpb.COUNTER
+		}
+		name = otlpMetricName(m, data.Sum.IsMonotonic)
+
+		for _, p := range data.Sum.DataPoints {
+			c.addNumberDataPoint(name, p, resourceLabels)
+		}
+
+	case *otlppb.Metric_Histogram:
+		if data.Histogram.AggregationTemporality != otlppb.AGGREGATION_TEMPORALITY_CUMULATIVE {
+			return otlpTemporalityError(m, data.Histogram.AggregationTemporality)
+		}
+
+		metricType = cortexpb.HISTOGRAM
+		name = otlpMetricName(m, false)
+
+		for _, p := range data.Histogram.DataPoints {
+			if err := c.addHistogramDataPoint(name, p, resourceLabels); err != nil {
+				return err
+			}
+		}
+
+	case *otlppb.Metric_Summary:
+		metricType = cortexpb.SUMMARY
+		name = otlpMetricName(m, false)
+
+		for _, p := range data.Summary.DataPoints {
+			c.addSummaryDataPoint(name, p, resourceLabels)
+		}
+
+	default:
+		return fmt.Errorf("metric %q has an unsupported data type", m.Name)
+	}
+
+	c.metadata = append(c.metadata, &cortexpb.MetricMetadata{
+		Type:             metricType,
+		MetricFamilyName: name,
+		Help:             m.Description,
+		Unit:             m.Unit,
+	})
+
+	return nil
+}
+
+func (c *otlpConverter) addNumberDataPoint(name string, p *otlppb.NumberDataPoint, resourceLabels map[string]string) {
+	var v float64
+	switch pv := p.Value.(type) {
+	case *otlppb.NumberDataPoint_AsDouble:
+		v = pv.AsDouble
+	case *otlppb.NumberDataPoint_AsInt:
+		v = float64(pv.AsInt)
+	}
+
+	lbls := otlpLabels(p.Attributes, resourceLabels)
+	c.add(name, lbls, otlpValue(v, p.Flags), p.TimeUnixNano)
+}
+
+func (c *otlpConverter) addHistogramDataPoint(name string, p *otlppb.HistogramDataPoint, resourceLabels map[string]string) error {
+	if len(p.BucketCounts) > 0 && len(p.BucketCounts) != len(p.ExplicitBounds)+1 {
+		return fmt.Errorf("histogram %q has %d buckets but %d explicit bounds", name, len(p.BucketCounts), len(p.ExplicitBounds))
+	}
+
+	lbls := otlpLabels(p.Attributes, resourceLabels)
+
+	// OTLP buckets count the values within each bucket, while Prometheus ones are cumulative.
+	// The last bucket has no explicit bound, so it's the +Inf one.
+	cumulative := uint64(0)
+	for i := 0; i < len(p.BucketCounts)-1; i++ {
+		cumulative += p.BucketCounts[i]
+		c.add(name+"_bucket", withLabel(lbls, labels.BucketLabel, formatFloat(p.ExplicitBounds[i])), otlpValue(float64(cumulative), p.Flags), p.TimeUnixNano)
+	}
+	c.add(name+"_bucket", withLabel(lbls, labels.BucketLabel, "+Inf"), otlpValue(float64(p.Count), p.Flags), p.TimeUnixNano)
+
+	c.add(name+"_sum", lbls, otlpValue(p.Sum, p.Flags), p.TimeUnixNano)
+	c.add(name+"_count", lbls, otlpValue(float64(p.Count), p.Flags), p.TimeUnixNano)
+	return nil
+}
+
+func (c *otlpConverter) addSummaryDataPoint(name string, p *otlppb.SummaryDataPoint, resourceLabels map[string]string) {
+	lbls := otlpLabels(p.Attributes, resourceLabels)
+
+	for _, q := range p.QuantileValues {
+		c.add(name, withLabel(lbls, "quantile", formatFloat(q.Quantile)), otlpValue(q.Value, p.Flags), p.TimeUnixNano)
+	}
+
+	c.add(name+"_sum", lbls, otlpValue(p.Sum, p.Flags), p.TimeUnixNano)
+	c.add(name+"_count", lbls, otlpValue(float64(p.Count), p.Flags), p.TimeUnixNano)
+}
+
+func (c *otlpConverter) add(name string, lbls map[string]string, v float64, timeUnixNano uint64) {
+	series := labels.NewBuilder(labels.FromMap(lbls)).Set(labels.MetricName, name).Labels()
+
+	c.labels = append(c.labels, series)
+	c.samples = append(c.samples, cortexpb.Sample{
+		Value:       v,
+		TimestampMs: int64(timeUnixNano / 1e6),
+	})
+}
+
+func otlpTemporalityError(m *otlppb.Metric, temporality otlppb.AggregationTemporality) error {
+	return fmt.Errorf("metric %q has unsupported aggregation temporality %s: only cumulative temporality is supported", m.Name, temporality.String())
+}
+
+// otlpValue returns the Prometheus staleness marker if the data point has no recorded value.
+func otlpValue(v float64, flags uint32) float64 {
+	if flags&uint32(otlppb.DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0 {
+		return math.Float64frombits(value.StaleNaN)
+	}
+	return v
+}
+
+// otlpMetricName builds the Prometheus metric name, adding the unit and the "_total" (for
+// counters) suffixes if not already part of the name.
+func otlpMetricName(m *otlppb.Metric, counter bool) string {
+	tokens := strings.FieldsFunc(m.Name, func(r rune) bool { return !isAlphaNumeric(r) })
+
+	// Annotations within curly braces (e.g. "{requests}") are not units.
+	unit := m.Unit
+	if i := strings.Index(unit, "{"); i >= 0 {
+		unit = unit[:i]
+	}
+
+	mainUnit, perUnit := unit, ""
+	if i := strings.Index(unit, "/"); i >= 0 {
+		mainUnit, perUnit = unit[:i], unit[i+1:]
+	}
+
+	if mainUnit != "" && mainUnit != "1" {
+		if mapped, ok := otlpUnits[mainUnit]; ok {
+			mainUnit = mapped
+		}
+		tokens = appendNameSuffix(tokens, strings.FieldsFunc(mainUnit, func(r rune) bool { return !isAlphaNumeric(r) })...)
+	}
+
+	if perUnit != "" {
+		if mapped, ok := otlpPerUnits[perUnit]; ok {
+			perUnit = mapped
+		}
+		tokens = appendNameSuffix(tokens, append([]string{"per"}, strings.FieldsFunc(perUnit, func(r rune) bool { return !isAlphaNumeric(r) })...)...)
+	}
+
+	if counter {
+		tokens = appendNameSuffix(tokens, "total")
+	} else if m.Unit == "1" && m.GetGauge() != nil {
+		tokens = appendNameSuffix(tokens, "ratio")
+	}
+
+	name := strings.Join(tokens, "_")
+	if name != "" && isDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+// appendNameSuffix appends the suffix tokens, unless the name already ends with them.
+func appendNameSuffix(tokens []string, suffix ...string) []string {
+	if len(suffix) == 0 || len(tokens) < len(suffix) {
+		return append(tokens, suffix...)
+	}
+
+	for i, s := range suffix {
+		if tokens[len(tokens)-len(suffix)+i] != s {
+			return append(tokens, suffix...)
+		}
+	}
+	return tokens
+}
+
+// otlpResourceLabels returns the job and instance labels from the resource attributes.
+func otlpResourceLabels(resource *otlppb.Resource) map[string]string {
+	if resource == nil {
+		return nil
+	}
+
+	var name, namespace, instance string
+
+	for _, attr := range resource.Attributes {
+		switch attr.Key {
+		case serviceNameAttribute:
+			name = otlpAttributeValue(attr.Value)
+		case serviceNamespaceAttribute:
+			namespace = otlpAttributeValue(attr.Value)
+		case serviceInstanceIDAttribute:
+			instance = otlpAttributeValue(attr.Value)
+		}
+	}
+
+	out := map[string]string{}
+	if name != "" {
+		if namespace != "" {
+			name = namespace + "/" + name
+		}
+		out["job"] = name
+	}
+	if instance != "" {
+		out["instance"] = instance
+	}
+	return out
+}
+
+// otlpLabels converts the data point attributes to labels, sanitizing the names. The resource
+// labels take precedence over the data point attributes.
+func otlpLabels(attrs []*otlppb.KeyValue, resourceLabels map[string]string) map[string]string {
+	out := make(map[string]string, len(attrs)+len(resourceLabels))
+
+	for _, attr := range attrs {
+		name := sanitizeLabelName(attr.Key)
+		v := otlpAttributeValue(attr.Value)
+
+		// Different attributes may have the same sanitized name.
+		if existing, ok := out[name]; ok {
+			v = existing + ";" + v
+		}
+		out[name] = v
+	}
+
+	for name, v := range resourceLabels {
+		out[name] = v
+	}
+	return out
+}
+
+func withLabel(lbls map[string]string, name, value string) map[string]string {
+	out := make(map[string]string, len(lbls)+1)
+	for n, v := range lbls {
+		out[n] = v
+	}
+	out[name] = value
+	return out
+}
+
+func otlpAttributeValue(v *otlppb.AnyValue) string {
+	if v == nil {
+		return ""
+	}
+
+	switch av := v.Value.(type) {
+	case *otlppb.AnyValue_StringValue:
+		return av.StringValue
+	case *otlppb.AnyValue_BoolValue:
+		return strconv.FormatBool(av.BoolValue)
+	case *otlppb.AnyValue_IntValue:
+		return strconv.FormatInt(av.IntValue, 10)
+	case *otlppb.AnyValue_DoubleValue:
+		return formatFloat(av.DoubleValue)
+	case *otlppb.AnyValue_BytesValue:
+		return string(av.BytesValue)
+	default:
+		return ""
+	}
+}
+
+// sanitizeLabelName replaces the characters not allowed in label names with underscores.
+func sanitizeLabelName(name string) string {
+	out := []byte(name)
+	for i, b := range out {
+		if !isAlphaNumeric(rune(b)) && b != '_' {
+			out[i] = '_'
+		}
+	}
+
+	if len(out) > 0 && isDigit(rune(out[0])) {
+		return "key_" + string(out)
+	}
+	return string(out)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func isAlphaNumeric(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || isDigit(r)
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
@@ -0,0 +1,291 @@
+package push
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/util/push/otlppb"
+)
+
+func TestOTLPHandler(t *testing.T) {
+	const timestampMs = int64(1000)
+
+	otlpReq := &otlppb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlppb.ResourceMetrics{{
+			Resource: &otlppb.Resource{Attributes: []*otlppb.KeyValue{
+				stringAttribute("service.name", "api"),
+				stringAttribute("service.namespace", "shop"),
+				stringAttribute("service.instance.id", "host-1"),
+				stringAttribute("host.arch", "amd64"),
+			}},
+			ScopeMetrics: []*otlppb.ScopeMetrics{{
+				Metrics: []*otlppb.Metric{
+					{
+						Name:        "system.memory.usage",
+						Description: "Memory in use.",
+						Unit:        "By",
+						Data: &otlppb.Metric_Gauge{Gauge: &otlppb.Gauge{DataPoints: []*otlppb.NumberDataPoint{{
+							Attributes:   []*otlppb.KeyValue{stringAttribute("state", "used")},
+							TimeUnixNano: uint64(timestampMs * 1e6),
+							Value:        &otlppb.NumberDataPoint_AsInt{AsInt: 1024},
+						}}}},
+					},
+					{
+						Name: "http.server.requests",
+						Unit: "{requests}",
+						Data: &otlppb.Metric_Sum{Sum: &otlppb.Sum{
+							AggregationTemporality: otlppb.AGGREGATION_TEMPORALITY_CUMULATIVE,
+							IsMonotonic:            true,
+							DataPoints: []*otlppb.NumberDataPoint{{
+								Attributes: []*otlppb.KeyValue{
+									stringAttribute("http.method", "GET"),
+									{Key: "2xx", Value: &otlppb.AnyValue{Value: &otlppb.AnyValue_BoolValue{BoolValue: true}}},
+								},
+								TimeUnixNano: uint64(timestampMs * 1e6),
+								Value:        &otlppb.NumberDataPoint_AsDouble{AsDouble: 10},
+							}},
+						}},
+					},
+					{
+						Name: "queue.size",
+						Data: &otlppb.Metric_Sum{Sum: &otlppb.Sum{
+							AggregationTemporality: otlppb.AGGREGATION_TEMPORALITY_CUMULATIVE,
+							DataPoints: []*otlppb.NumberDataPoint{{
+								TimeUnixNano: uint64(timestampMs * 1e6),
+								Value:        &otlppb.NumberDataPoint_AsInt{AsInt: 3},
+							}},
+						}},
+					},
+					{
+						Name: "http.server.duration",
+						Unit: "ms",
+						Data: &otlppb.Metric_Histogram{Histogram: &otlppb.Histogram{
+							AggregationTemporality: otlppb.AGGREGATION_TEMPORALITY_CUMULATIVE,
+							DataPoints: []*otlppb.HistogramDataPoint{{
+								TimeUnixNano:   uint64(timestampMs * 1e6),
+								Count:          6,
+								Sum:            1500,
+								BucketCounts:   []uint64{1, 2, 3},
+								ExplicitBounds: []float64{100, 500.5},
+							}},
+						}},
+					},
+					{
+						Name: "rpc.latency",
+						Unit: "s",
+						Data: &otlppb.Metric_Summary{Summary: &otlppb.Summary{DataPoints: []*otlppb.SummaryDataPoint{{
+							TimeUnixNano: uint64(timestampMs * 1e6),
+							Count:        10,
+							Sum:          2,
+							QuantileValues: []*otlppb.SummaryDataPoint_ValueAtQuantile{
+								{Quantile: 0.5, Value: 0.1},
+								{Quantile: 0.99, Value: 0.9},
+							},
+						}}}},
+					},
+				},
+			}},
+		}},
+	}
+
+	expectedSeries := map[string]float64{
+		`{__name__="system_memory_usage_bytes", instance="host-1", job="shop/api", state="used"}`:                       1024,
+		`{__name__="http_server_requests_total", http_method="GET", instance="host-1", job="shop/api", key_2xx="true"}`: 10,
+		`{__name__="queue_size", instance="host-1", job="shop/api"}`:                                                    3,
+		`{__name__="http_server_duration_milliseconds_bucket", instance="host-1", job="shop/api", le="100"}`:            1,
+		`{__name__="http_server_duration_milliseconds_bucket", instance="host-1", job="shop/api", le="500.5"}`:          3,
+		`{__name__="http_server_duration_milliseconds_bucket", instance="host-1", job="shop/api", le="+Inf"}`:           6,
+		`{__name__="http_server_duration_milliseconds_sum", instance="host-1", job="shop/api"}`:                         1500,
+		`{__name__="http_server_duration_milliseconds_count", instance="host-1", job="shop/api"}`:                       6,
+		`{__name__="rpc_latency_seconds", instance="host-1", job="shop/api", quantile="0.5"}`:                           0.1,
+		`{__name__="rpc_latency_seconds", instance="host-1", job="shop/api", quantile="0.99"}`:                          0.9,
+		`{__name__="rpc_latency_seconds_sum", instance="host-1", job="shop/api"}`:                                       2,
+		`{__name__="rpc_latency_seconds_count", instance="host-1", job="shop/api"}`:                                     10,
+	}
+
+	expectedMetadata := []*cortexpb.MetricMetadata{
+		{Type: cortexpb.GAUGE, MetricFamilyName: "system_memory_usage_bytes", Help: "Memory in use.", Unit: "By"},
+		{Type: cortexpb.COUNTER, MetricFamilyName: "http_server_requests_total", Unit: "{requests}"},
+		{Type: cortexpb.GAUGE, MetricFamilyName: "queue_size"},
+		{Type: cortexpb.HISTOGRAM, MetricFamilyName: "http_server_duration_milliseconds", Unit: "ms"},
+		{Type: cortexpb.SUMMARY, MetricFamilyName: "rpc_latency_seconds", Unit: "s"},
+	}
+
+	for _, compressed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("gzip=%t", compressed), func(t *testing.T) {
+			var received *cortexpb.WriteRequest
+			handler := OTLPHandler(100000, nil, func(_ context.Context, req *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+				received = req
+				return &cortexpb.WriteResponse{}, nil
+			})
+
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, createOTLPRequest(t, otlpReq, compressed))
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+			assert.Equal(t, otlpProtobufContentType, resp.Header().Get("Content-Type"))
+			require.NotNil(t, received)
+
+			actualSeries := map[string]float64{}
+			for _, ts := range received.Timeseries {
+				require.Len(t, ts.Samples, 1)
+				assert.Equal(t, timestampMs, ts.Samples[0].TimestampMs)
+				actualSeries[cortexpb.FromLabelAdaptersToLabels(ts.Labels).String()] = ts.Samples[0].Value
+			}
+
+			assert.Equal(t, expectedSeries, actualSeries)
+			assert.Equal(t, expectedMetadata, received.Metadata)
+			assert.Equal(t, cortexpb.API, received.Source)
+		})
+	}
+}
+
+func TestOTLPHandler_ShouldConvertNoRecordedValueToStaleMarker(t *testing.T) {
+	otlpReq := &otlppb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlppb.ResourceMetrics{{
+			ScopeMetrics: []*otlppb.ScopeMetrics{{
+				Metrics: []*otlppb.Metric{{
+					Name: "temperature",
+					Unit: "Cel",
+					Data: &otlppb.Metric_Gauge{Gauge: &otlppb.Gauge{DataPoints: []*otlppb.NumberDataPoint{{
+						TimeUnixNano: 1e9,
+						Flags:        uint32(otlppb.DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK),
+					}}}},
+				}},
+			}},
+		}},
+	}
+
+	req, err := OTLPToWriteRequest(otlpReq)
+	require.NoError(t, err)
+	defer cortexpb.ReuseSlice(req.Timeseries)
+
+	require.Len(t, req.Timeseries, 1)
+	assert.Equal(t, `{__name__="temperature_celsius"}`, cortexpb.FromLabelAdaptersToLabels(req.Timeseries[0].Labels).String())
+	assert.True(t, value.IsStaleNaN(req.Timeseries[0].Samples[0].Value))
+}
+
+func TestOTLPHandler_ShouldRejectInvalidRequests(t *testing.T) {
+	deltaSum := &otlppb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlppb.ResourceMetrics{{
+			ScopeMetrics: []*otlppb.ScopeMetrics{{
+				Metrics: []*otlppb.Metric{{
+					Name: "requests",
+					Data: &otlppb.Metric_Sum{Sum: &otlppb.Sum{
+						AggregationTemporality: otlppb.AGGREGATION_TEMPORALITY_DELTA,
+						IsMonotonic:            true,
+						DataPoints:             []*otlppb.NumberDataPoint{{Value: &otlppb.NumberDataPoint_AsInt{AsInt: 1}}},
+					}},
+				}},
+			}},
+		}},
+	}
+
+	deltaHistogram := &otlppb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlppb.ResourceMetrics{{
+			ScopeMetrics: []*otlppb.ScopeMetrics{{
+				Metrics: []*otlppb.Metric{{
+					Name: "duration",
+					Data: &otlppb.Metric_Histogram{Histogram: &otlppb.Histogram{
+						AggregationTemporality: otlppb.AGGREGATION_TEMPORALITY_DELTA,
+						DataPoints:             []*otlppb.HistogramDataPoint{{Count: 1}},
+					}},
+				}},
+			}},
+		}},
+	}
+
+	invalidHistogram := &otlppb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*otlppb.ResourceMetrics{{
+			ScopeMetrics: []*otlppb.ScopeMetrics{{
+				Metrics: []*otlppb.Metric{{
+					Name: "duration",
+					Data: &otlppb.Metric_Histogram{Histogram: &otlppb.Histogram{
+						AggregationTemporality: otlppb.AGGREGATION_TEMPORALITY_CUMULATIVE,
+						DataPoints:             []*otlppb.HistogramDataPoint{{Count: 1, BucketCounts: []uint64{1}, ExplicitBounds: []float64{1}}},
+					}},
+				}},
+			}},
+		}},
+	}
+
+	jsonReq := createOTLPRequest(t, deltaSum, false)
+	jsonReq.Header.Set("Content-Type", "application/json")
+
+	tests := map[string]struct {
+		req          *http.Request
+		expectedCode int
+		expectedBody string
+	}{
+		"delta sum": {
+			req:          createOTLPRequest(t, deltaSum, false),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `metric "requests" has unsupported aggregation temporality AGGREGATION_TEMPORALITY_DELTA: only cumulative temporality is supported`,
+		},
+		"delta histogram": {
+			req:          createOTLPRequest(t, deltaHistogram, false),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `metric "duration" has unsupported aggregation temporality AGGREGATION_TEMPORALITY_DELTA: only cumulative temporality is supported`,
+		},
+		"histogram buckets not matching the explicit bounds": {
+			req:          createOTLPRequest(t, invalidHistogram, false),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `histogram "duration" has 1 buckets but 1 explicit bounds`,
+		},
+		"JSON encoding": {
+			req:          jsonReq,
+			expectedCode: http.StatusUnsupportedMediaType,
+			expectedBody: "unsupported content type, expected application/x-protobuf",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			handler := OTLPHandler(100000, nil, func(_ context.Context, _ *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+				t.Fatal("push should not be called")
+				return nil, nil
+			})
+
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, testData.req)
+			assert.Equal(t, testData.expectedCode, resp.Code)
+			assert.Equal(t, testData.expectedBody+"\n", resp.Body.String())
+		})
+	}
+}
+
+func createOTLPRequest(t *testing.T, req *otlppb.ExportMetricsServiceRequest, compressed bool) *http.Request {
+	t.Helper()
+	body, err := req.Marshal()
+	require.NoError(t, err)
+
+	if compressed {
+		buf := bytes.Buffer{}
+		writer := gzip.NewWriter(&buf)
+		_, err = writer.Write(body)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		body = buf.Bytes()
+	}
+
+	httpReq, err := http.NewRequest("POST", "http://localhost/otlp/v1/metrics", bytes.NewReader(body))
+	require.NoError(t, err)
+	httpReq.Header.Set("Content-Type", otlpProtobufContentType)
+	if compressed {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	return httpReq
+}
+
+func stringAttribute(key, value string) *otlppb.KeyValue {
+	return &otlppb.KeyValue{Key: key, Value: &otlppb.AnyValue{Value: &otlppb.AnyValue_StringValue{StringValue: value}}}
+}
@@ -1,47 +1,121 @@
 package push
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
 
+	kitlog "github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/middleware"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/tenant"
 	"github.com/cortexproject/cortex/pkg/util"
 	"github.com/cortexproject/cortex/pkg/util/log"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
+const (
+	// Max number of bytes discarded from the body of a rejected request, so that the connection
+	// can be reused. If the body is larger, the connection is closed instead.
+	maxDrainSize = 256 << 10
+
+	// ValidationWarningsHeaderName is the header listing the reasons of the validation warnings
+	// of a push request, when enabled for the tenant.
+	ValidationWarningsHeaderName = "X-Cortex-Validation-Warnings"
+)
+
+var (
+	errRequestBodyTooLarge = errors.New("request body too large")
+
+	receivedCompressedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "push_received_compressed_bytes_total",
+		Help:      "The total number of snappy-compressed bytes of the successfully pushed write requests.",
+	}, []string{"user"})
+	receivedDecompressedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "push_received_decompressed_bytes_total",
+		Help:      "The total number of decompressed bytes of the successfully pushed write requests.",
+	}, []string{"user"})
+	receivedSeriesBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cortex",
+		Name:      "push_received_series_bytes_total",
+		Help:      "The total number of bytes of the encoded series of the successfully pushed write requests.",
+	}, []string{"user"})
+)
+
+// DeletePerUserMetrics deletes the per-user metrics of the push handlers.
+func DeletePerUserMetrics(userID string) {
+	receivedCompressedBytes.DeleteLabelValues(userID)
+	receivedDecompressedBytes.DeleteLabelValues(userID)
+	receivedSeriesBytes.DeleteLabelValues(userID)
+}
+
+// Limits is the interface of the per-tenant limits enforced by the push handlers.
+type Limits interface {
+	// MaxRequestBodySize returns the max size of the uncompressed body of the push requests
+	// for the tenant, or 0 if unlimited.
+	MaxRequestBodySize(userID string) int
+
+	// ValidationWarningsHeader returns whether the push requests of the tenant are responded
+	// with the validation warnings header.
+	ValidationWarningsHeader(userID string) bool
+}
+
 // Func defines the type of the push. It is similar to http.HandlerFunc.
 type Func func(context.Context, *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error)
 
-// Handler is a http.Handler which accepts WriteRequests.
-func Handler(maxRecvMsgSize int, sourceIPs *middleware.SourceIPExtractor, push Func) http.Handler {
+// DryRunFunc defines the type of the dry run of a push, which validates the WriteRequest
+// without ingesting it and returns a report of the validation.
+type DryRunFunc func(context.Context, *cortexpb.WriteRequest) (interface{}, error)
+
+// Handler is a http.Handler which accepts WriteRequests. The limits are optional.
+func Handler(maxRecvMsgSize int, limits Limits, sourceIPs *middleware.SourceIPExtractor, push Func) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		logger := log.WithContext(ctx, log.Logger)
-		if sourceIPs != nil {
-			source := sourceIPs.Get(r)
-			if source != "" {
-				ctx = util.AddSourceIPsToOutgoingContext(ctx, source)
-				logger = log.WithSourceIPs(source, logger)
-			}
-		}
-		var req cortexpb.PreallocWriteRequest
-		err := util.ParseProtoReader(ctx, r.Body, int(r.ContentLength), maxRecvMsgSize, &req, util.RawSnappy)
-		if err != nil {
-			level.Error(logger).Log("err", err.Error())
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		ctx, logger, req, sizes, ok := parseRequest(w, r, maxRecvMsgSize, limits, sourceIPs, false)
+		if !ok {
 			return
 		}
 
-		req.SkipLabelNameValidation = false
-		if req.Source == 0 {
-			req.Source = cortexpb.API
+		var warnings *validation.Warnings
+		if limits != nil && sizes.userID != "" && limits.ValidationWarningsHeader(sizes.userID) {
+			warnings = validation.NewWarnings()
+			ctx = validation.ContextWithWarnings(ctx, warnings)
+		}
+
+		// The consistency token is recorded only if enabled in the distributor.
+		var token *client.ConsistencyToken
+		ctx = client.ContextWithConsistencyTokenRecorder(ctx, func(t client.ConsistencyToken) {
+			token = &t
+		})
+
+		_, err := push(ctx, &req.WriteRequest)
+
+		// The warnings are reported on failures too, since a part of the request may have been ingested.
+		if warnings != nil {
+			if reasons := warnings.Reasons(); len(reasons) > 0 {
+				w.Header().Set(ValidationWarningsHeaderName, strings.Join(reasons, ","))
+			}
 		}
 
-		if _, err := push(ctx, &req.WriteRequest); err != nil {
+		// The token is recorded on partial failures too, once the accepted samples have been ingested.
+		if token != nil {
+			w.Header().Set(client.ConsistencyTokenHeaderName, token.String())
+		}
+
+		if err != nil {
 			resp, ok := httpgrpc.HTTPResponseFromError(err)
 			if !ok {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -50,7 +124,237 @@ func Handler(maxRecvMsgSize int, sourceIPs *middleware.SourceIPExtractor, push F
 			if resp.GetCode() != 202 {
 				level.Error(logger).Log("msg", "push error", "err", err)
 			}
-			http.Error(w, string(resp.Body), int(resp.Code))
+			writeErrorResponse(w, resp)
+			return
+		}
+
+		if sizes.userID != "" {
+			receivedCompressedBytes.WithLabelValues(sizes.userID).Add(float64(sizes.compressed))
+			receivedDecompressedBytes.WithLabelValues(sizes.userID).Add(float64(sizes.decompressed))
+			receivedSeriesBytes.WithLabelValues(sizes.userID).Add(float64(sizes.series))
 		}
 	})
 }
+
+// DryRunHandler is a http.Handler which accepts WriteRequests like Handler, but responds
+// with the JSON encoded report returned by the dry run.
+func DryRunHandler(maxRecvMsgSize int, limits Limits, sourceIPs *middleware.SourceIPExtractor, dryRun DryRunFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, logger, req, _, ok := parseRequest(w, r, maxRecvMsgSize, limits, sourceIPs, true)
+		if !ok {
+			return
+		}
+
+		report, err := dryRun(ctx, &req.WriteRequest)
+		if err != nil {
+			level.Error(logger).Log("msg", "push dry run error", "err", err)
+			if resp, ok := httpgrpc.HTTPResponseFromError(err); ok {
+				http.Error(w, string(resp.Body), int(resp.Code))
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		util.WriteJSONResponse(w, report)
+	})
+}
+
+// writeErrorResponse writes the HTTP response carried by a push error, including its headers
+// (eg. Retry-After).
+func writeErrorResponse(w http.ResponseWriter, resp *httpgrpc.HTTPResponse) {
+	for _, h := range resp.Headers {
+		for _, v := range h.Values {
+			w.Header().Add(h.Key, v)
+		}
+	}
+	http.Error(w, string(resp.Body), int(resp.Code))
+}
+
+// parseRequest parses the snappy-compressed WriteRequest in the HTTP request body. If the
+// request can't be parsed, the error is written to the response and false is returned. The
+// requests rejected by the dry run are not tracked in the discarded requests metric. The sizes
+// of the request are added to the returned logger.
+func parseRequest(w http.ResponseWriter, r *http.Request, maxRecvMsgSize int, limits Limits, sourceIPs *middleware.SourceIPExtractor, dryRun bool) (context.Context, kitlog.Logger, *cortexpb.PreallocWriteRequest, requestSizes, bool) {
+	ctx := r.Context()
+	logger := log.WithContext(ctx, log.Logger)
+	if sourceIPs != nil {
+		source := sourceIPs.Get(r)
+		if source != "" {
+			ctx = util.AddSourceIPsToOutgoingContext(ctx, source)
+			logger = log.WithSourceIPs(source, logger)
+		}
+	}
+
+	var (
+		userID, maxBodySize = maxRequestBodySize(ctx, limits)
+		body                = io.Reader(r.Body)
+		buf                 *bytes.Buffer
+		err                 error
+	)
+
+	// The body is read here, so that its compressed size is known, unless it's rejected by
+	// ParseProtoReader without being read.
+	if r.ContentLength <= int64(maxRecvMsgSize) {
+		buf, err = readBody(r, maxRecvMsgSize, maxBodySize)
+		if errors.Is(err, errRequestBodyTooLarge) {
+			drainOrClose(w, r)
+
+			msg := fmt.Sprintf("the uncompressed request body exceeds the limit of %d bytes", maxBodySize)
+			level.Warn(logger).Log("msg", msg)
+			if !dryRun {
+				validation.DiscardedRequests.WithLabelValues(validation.RequestBodyTooLarge, userID).Inc()
+			}
+			http.Error(w, msg, http.StatusRequestEntityTooLarge)
+			return nil, nil, nil, requestSizes{}, false
+		}
+		if err != nil {
+			level.Error(logger).Log("err", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, nil, nil, requestSizes{}, false
+		}
+		body = bufferedBody{buf}
+	}
+
+	var req cortexpb.PreallocWriteRequest
+	err = util.ParseProtoReader(ctx, body, int(r.ContentLength), maxRecvMsgSize, &req, util.RawSnappy)
+	if err != nil {
+		level.Error(logger).Log("err", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, nil, requestSizes{}, false
+	}
+
+	// The body has been successfully decoded, so the length in the snappy header is the
+	// actual length of the decompressed body.
+	sizes := requestSizes{userID: userID, compressed: buf.Len()}
+	sizes.decompressed, _ = snappy.DecodedLen(buf.Bytes())
+	for _, ts := range req.Timeseries {
+		sizes.series += ts.Size()
+	}
+	logger = kitlog.With(logger, "compressed_bytes", sizes.compressed, "decompressed_bytes", sizes.decompressed, "series_bytes", sizes.series)
+
+	req.SkipLabelNameValidation = false
+	if req.Source == 0 {
+		req.Source = cortexpb.API
+	}
+
+	return ctx, logger, &req, sizes, true
+}
+
+// requestSizes are the sizes of a push request, in bytes.
+type requestSizes struct {
+	userID string
+
+	// Size of the snappy-compressed body.
+	compressed int
+
+	// Size of the decompressed body, i.e. of the encoded WriteRequest.
+	decompressed int
+
+	// Size of the encoded series, excluding the metadata and the request fields.
+	series int
+}
+
+// maxRequestBodySize returns the tenant of the request, or an empty string if missing, and
+// its max uncompressed body size, or 0 if unlimited.
+func maxRequestBodySize(ctx context.Context, limits Limits) (string, int) {
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		// The request is rejected later on, when pushed.
+		return "", 0
+	}
+	if limits == nil {
+		return userID, 0
+	}
+	return userID, limits.MaxRequestBodySize(userID)
+}
+
+// readBody reads the snappy-compressed body of the request. If maxBodySize is positive, it returns
+// errRequestBodyTooLarge as soon as it's known that the uncompressed body exceeds it. A snappy block can't
+// be decoded to more than maxBodySize bytes if it's not longer than snappy.MaxEncodedLen(maxBodySize),
+// so the body is never read past it. The decoded length stored in the block header is then
+// checked, and snappy.Decode rejects the blocks whose content doesn't match the header.
+func readBody(r *http.Request, maxRecvMsgSize, maxBodySize int) (*bytes.Buffer, error) {
+	if body, ok := r.Body.(interface{ BytesBuffer() *bytes.Buffer }); ok {
+		// The body has already been read, e.g. when received through httpgrpc.
+		buf := body.BytesBuffer()
+		return buf, checkDecodedLen(buf.Bytes(), maxBodySize)
+	}
+
+	// The max message size is enforced by the caller, so there's no need to read past it.
+	var reader io.Reader = io.LimitReader(r.Body, int64(maxRecvMsgSize)+1)
+
+	if maxBodySize > 0 {
+		// The max length of the compressed body is negative if it overflows, meaning that any
+		// body within the max message size can't exceed the limit.
+		maxCompressedSize := int64(snappy.MaxEncodedLen(maxBodySize))
+		if maxCompressedSize >= 0 && r.ContentLength > maxCompressedSize {
+			return nil, errRequestBodyTooLarge
+		}
+		if maxCompressedSize >= 0 {
+			reader = &limitedReader{r: reader, remaining: maxCompressedSize}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if r.ContentLength > 0 {
+		buf.Grow(int(r.ContentLength) + bytes.MinRead)
+	}
+	if _, err := buf.ReadFrom(reader); err != nil {
+		return nil, err
+	}
+	return buf, checkDecodedLen(buf.Bytes(), maxBodySize)
+}
+
+func checkDecodedLen(compressed []byte, maxBodySize int) error {
+	if maxBodySize <= 0 {
+		return nil
+	}
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return err
+	}
+	if size > maxBodySize {
+		return errRequestBodyTooLarge
+	}
+	return nil
+}
+
+// drainOrClose discards the unread body of a rejected request, so that the client connection
+// can be reused for the next request. If the body is too large to be discarded, the connection
+// is closed once the response is written.
+func drainOrClose(w http.ResponseWriter, r *http.Request) {
+	if _, err := io.CopyN(ioutil.Discard, r.Body, maxDrainSize); err != io.EOF {
+		w.Header().Set("Connection", "close")
+	}
+}
+
+// limitedReader is like io.LimitedReader, but fails with errRequestBodyTooLarge as soon as
+// more than the allowed bytes are read, instead of silently truncating the content.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// Read one byte more than allowed, to detect that the limit is crossed.
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, errRequestBodyTooLarge
+	}
+	return n, err
+}
+
+// bufferedBody exposes the body read by readBody to util.ParseProtoReader, which uses the
+// buffer as is instead of reading it again.
+type bufferedBody struct {
+	*bytes.Buffer
+}
+
+func (b bufferedBody) BytesBuffer() *bytes.Buffer {
+	return b.Buffer
+}
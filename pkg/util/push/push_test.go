@@ -3,24 +3,47 @@ package push
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/weaveworks/common/httpgrpc"
 	"github.com/weaveworks/common/middleware"
+	"github.com/weaveworks/common/user"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/util/validation"
 )
 
 func TestHandler_remoteWrite(t *testing.T) {
 	req := createRequest(t, createPrometheusRemoteWriteProtobuf(t))
 	resp := httptest.NewRecorder()
-	handler := Handler(100000, nil, verifyWriteRequestHandler(t, cortexpb.API))
+	handler := Handler(100000, nil, nil, verifyWriteRequestHandler(t, cortexpb.API))
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+}
+
+func TestHandler_chunkedRemoteWrite(t *testing.T) {
+	req := createRequest(t, createPrometheusRemoteWriteProtobuf(t))
+
+	// A chunked request has an unknown content length.
+	req.ContentLength = -1
+	req.Body = ioutil.NopCloser(iotest.HalfReader(req.Body))
+
+	resp := httptest.NewRecorder()
+	handler := Handler(100000, nil, nil, verifyWriteRequestHandler(t, cortexpb.API))
 	handler.ServeHTTP(resp, req)
 	assert.Equal(t, 200, resp.Code)
 }
@@ -29,7 +52,7 @@ func TestHandler_cortexWriteRequest(t *testing.T) {
 	req := createRequest(t, createCortexWriteRequestProtobuf(t, false))
 	resp := httptest.NewRecorder()
 	sourceIPs, _ := middleware.NewSourceIPs("SomeField", "(.*)")
-	handler := Handler(100000, sourceIPs, verifyWriteRequestHandler(t, cortexpb.RULE))
+	handler := Handler(100000, nil, sourceIPs, verifyWriteRequestHandler(t, cortexpb.RULE))
 	handler.ServeHTTP(resp, req)
 	assert.Equal(t, 200, resp.Code)
 }
@@ -40,12 +63,337 @@ func TestHandler_ignoresSkipLabelNameValidationIfSet(t *testing.T) {
 		createRequest(t, createCortexWriteRequestProtobuf(t, false)),
 	} {
 		resp := httptest.NewRecorder()
-		handler := Handler(100000, nil, verifyWriteRequestHandler(t, cortexpb.RULE))
+		handler := Handler(100000, nil, nil, verifyWriteRequestHandler(t, cortexpb.RULE))
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, 200, resp.Code)
+	}
+}
+
+func TestHandler_ShouldWriteTheErrorResponseHeaders(t *testing.T) {
+	req := createRequest(t, createPrometheusRemoteWriteProtobuf(t))
+	resp := httptest.NewRecorder()
+	handler := Handler(100000, nil, nil, func(context.Context, *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+		return nil, httpgrpc.ErrorFromHTTPResponse(&httpgrpc.HTTPResponse{
+			Code:    http.StatusServiceUnavailable,
+			Body:    []byte("too few healthy ingesters"),
+			Headers: []*httpgrpc.Header{{Key: "Retry-After", Values: []string{"10"}}},
+		})
+	})
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "10", resp.Header().Get("Retry-After"))
+	assert.Equal(t, "too few healthy ingesters\n", resp.Body.String())
+}
+
+func TestDryRunHandler(t *testing.T) {
+	t.Run("should respond with the JSON encoded report", func(t *testing.T) {
+		req := createRequest(t, createPrometheusRemoteWriteProtobuf(t))
+		resp := httptest.NewRecorder()
+		verify := verifyWriteRequestHandler(t, cortexpb.API)
+		handler := DryRunHandler(100000, nil, nil, func(ctx context.Context, req *cortexpb.WriteRequest) (interface{}, error) {
+			_, err := verify(ctx, req)
+			return map[string]int{"accepted_series": len(req.Timeseries)}, err
+		})
+		handler.ServeHTTP(resp, req)
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"accepted_series":1}`, resp.Body.String())
+	})
+
+	t.Run("should reject requests larger than the max message size", func(t *testing.T) {
+		req := createRequest(t, createPrometheusRemoteWriteProtobuf(t))
+		resp := httptest.NewRecorder()
+		handler := DryRunHandler(10, nil, nil, func(ctx context.Context, req *cortexpb.WriteRequest) (interface{}, error) {
+			t.Fatal("the dry run should not be called")
+			return nil, nil
+		})
 		handler.ServeHTTP(resp, req)
+		assert.Equal(t, 400, resp.Code)
+	})
+}
+
+func TestHandler_MaxRequestBodySize(t *testing.T) {
+	protobuf := createPrometheusRemoteWriteProtobuf(t)
+	limits := mockLimits{"user-1": len(protobuf), "user-2": len(protobuf) - 1}
+
+	rejected := func(userID string) float64 {
+		return testutil.ToFloat64(validation.DiscardedRequests.WithLabelValues(validation.RequestBodyTooLarge, userID))
+	}
+
+	t.Run("should accept a request whose uncompressed body is exactly the limit", func(t *testing.T) {
+		req := createTenantRequest(t, "user-1", protobuf)
+		resp := httptest.NewRecorder()
+		Handler(100000, limits, nil, verifyWriteRequestHandler(t, cortexpb.API)).ServeHTTP(resp, req)
+		assert.Equal(t, 200, resp.Code)
+	})
+
+	t.Run("should accept a request if the tenant has no limit", func(t *testing.T) {
+		req := createTenantRequest(t, "user-3", protobuf)
+		resp := httptest.NewRecorder()
+		Handler(100000, limits, nil, verifyWriteRequestHandler(t, cortexpb.API)).ServeHTTP(resp, req)
+		assert.Equal(t, 200, resp.Code)
+	})
+
+	t.Run("should reject a request whose uncompressed body is one byte over the limit", func(t *testing.T) {
+		before := rejected("user-2")
+
+		req := createTenantRequest(t, "user-2", protobuf)
+		resp := httptest.NewRecorder()
+		Handler(100000, limits, nil, failingPushHandler(t)).ServeHTTP(resp, req)
+		assert.Equal(t, 413, resp.Code)
+		assert.Contains(t, resp.Body.String(), fmt.Sprintf("limit of %d bytes", len(protobuf)-1))
+		assert.Empty(t, resp.Header().Get("Connection"))
+		assert.Equal(t, before+1, rejected("user-2"))
+	})
+
+	t.Run("should stop reading a body larger than its declared length", func(t *testing.T) {
+		before := rejected("user-1")
+
+		// The snappy block header claims a small body, but the block is much larger.
+		body := &countingReader{r: bytes.NewReader(createLargeBody(t, len(protobuf), 4*maxDrainSize))}
+		req := createTenantRequest(t, "user-1", nil)
+		req.Body = ioutil.NopCloser(body)
+		req.ContentLength = 10
+
+		resp := httptest.NewRecorder()
+		Handler(4*maxDrainSize, limits, nil, failingPushHandler(t)).ServeHTTP(resp, req)
+		assert.Equal(t, 413, resp.Code)
+		assert.Equal(t, before+1, rejected("user-1"))
+
+		// The body has been read up to the limit and drained, but not entirely.
+		assert.Less(t, body.n, 4*maxDrainSize)
+		assert.Equal(t, "close", resp.Header().Get("Connection"))
+	})
+
+	t.Run("should reject a request whose declared length exceeds the limit without reading it", func(t *testing.T) {
+		body := &countingReader{r: bytes.NewReader(createLargeBody(t, len(protobuf), 4*maxDrainSize))}
+		req := createTenantRequest(t, "user-1", nil)
+		req.Body = ioutil.NopCloser(body)
+		req.ContentLength = 4 * maxDrainSize
+
+		resp := httptest.NewRecorder()
+		Handler(4*maxDrainSize, limits, nil, failingPushHandler(t)).ServeHTTP(resp, req)
+		assert.Equal(t, 413, resp.Code)
+		assert.Equal(t, maxDrainSize, body.n)
+		assert.Equal(t, "close", resp.Header().Get("Connection"))
+	})
+
+	t.Run("should reject a chunked body exceeding the limit", func(t *testing.T) {
+		req := createTenantRequest(t, "user-1", nil)
+		req.Body = ioutil.NopCloser(iotest.HalfReader(bytes.NewReader(createLargeBody(t, len(protobuf), 1024))))
+		req.ContentLength = -1
+
+		resp := httptest.NewRecorder()
+		Handler(100000, limits, nil, failingPushHandler(t)).ServeHTTP(resp, req)
+		assert.Equal(t, 413, resp.Code)
+		assert.Empty(t, resp.Header().Get("Connection"))
+	})
+
+	t.Run("should reject a body whose snappy header lies about the uncompressed length", func(t *testing.T) {
+		encoded := snappy.Encode(nil, protobuf)
+
+		// Patch the varint header, claiming a smaller uncompressed length than the actual one.
+		require.Less(t, len(protobuf), 128)
+		encoded[0] = byte(len(protobuf) / 2)
+
+		req := createTenantRequest(t, "user-1", nil)
+		req.Body = ioutil.NopCloser(bytes.NewReader(encoded))
+		req.ContentLength = int64(len(encoded))
+
+		resp := httptest.NewRecorder()
+		Handler(100000, limits, nil, failingPushHandler(t)).ServeHTTP(resp, req)
+		assert.Equal(t, 400, resp.Code)
+	})
+
+	t.Run("should not track the requests rejected by the dry run", func(t *testing.T) {
+		before := rejected("user-2")
+
+		req := createTenantRequest(t, "user-2", protobuf)
+		resp := httptest.NewRecorder()
+		DryRunHandler(100000, limits, nil, func(ctx context.Context, req *cortexpb.WriteRequest) (interface{}, error) {
+			t.Fatal("the dry run should not be called")
+			return nil, nil
+		}).ServeHTTP(resp, req)
+		assert.Equal(t, 413, resp.Code)
+		assert.Equal(t, before, rejected("user-2"))
+	})
+}
+
+func TestHandler_ValidationWarningsHeader(t *testing.T) {
+	limits := warningsHeaderLimits{"user-1": true}
+
+	warningPush := func(ctx context.Context, _ *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+		if warnings := validation.WarningsFromContext(ctx); warnings != nil {
+			warnings.Add("label_value_too_long")
+			warnings.Add("label_name_too_long")
+		}
+		return &cortexpb.WriteResponse{}, nil
+	}
+
+	t.Run("should list the warning reasons if enabled for the tenant", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		Handler(100000, limits, nil, warningPush).ServeHTTP(resp, createTenantRequest(t, "user-1", createPrometheusRemoteWriteProtobuf(t)))
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, "label_name_too_long,label_value_too_long", resp.Header().Get(ValidationWarningsHeaderName))
+	})
+
+	t.Run("should not set the header if disabled for the tenant", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		Handler(100000, limits, nil, warningPush).ServeHTTP(resp, createTenantRequest(t, "user-2", createPrometheusRemoteWriteProtobuf(t)))
+		assert.Equal(t, 200, resp.Code)
+		assert.Empty(t, resp.Header().Values(ValidationWarningsHeaderName))
+	})
+
+	t.Run("should not set the header if there's no warning", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		Handler(100000, limits, nil, verifyWriteRequestHandler(t, cortexpb.API)).ServeHTTP(resp, createTenantRequest(t, "user-1", createPrometheusRemoteWriteProtobuf(t)))
+		assert.Equal(t, 200, resp.Code)
+		assert.Empty(t, resp.Header().Values(ValidationWarningsHeaderName))
+	})
+}
+
+func TestHandler_ConsistencyTokenHeader(t *testing.T) {
+	t.Run("should set the header if the token has been recorded", func(t *testing.T) {
+		push := func(ctx context.Context, _ *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+			client.ConsistencyTokenRecorderFromContext(ctx)(client.ConsistencyToken{MaxTimestampMs: 1000, RingHash: 1})
+			return &cortexpb.WriteResponse{}, nil
+		}
+
+		resp := httptest.NewRecorder()
+		Handler(100000, nil, nil, push).ServeHTTP(resp, createRequest(t, createPrometheusRemoteWriteProtobuf(t)))
+		assert.Equal(t, 200, resp.Code)
+		assert.Equal(t, "1000:00000001", resp.Header().Get(client.ConsistencyTokenHeaderName))
+	})
+
+	t.Run("should not set the header if the token hasn't been recorded", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		Handler(100000, nil, nil, verifyWriteRequestHandler(t, cortexpb.API)).ServeHTTP(resp, createRequest(t, createPrometheusRemoteWriteProtobuf(t)))
 		assert.Equal(t, 200, resp.Code)
+		assert.Empty(t, resp.Header().Values(client.ConsistencyTokenHeaderName))
+	})
+}
+
+func TestHandler_RequestSizeAccounting(t *testing.T) {
+	protobuf := createPrometheusRemoteWriteProtobuf(t)
+	compressed := snappy.Encode(nil, protobuf)
+
+	var req prompb.WriteRequest
+	require.NoError(t, req.Unmarshal(protobuf))
+	seriesSize := req.Timeseries[0].Size()
+
+	counters := func(userID string) []float64 {
+		return []float64{
+			testutil.ToFloat64(receivedCompressedBytes.WithLabelValues(userID)),
+			testutil.ToFloat64(receivedDecompressedBytes.WithLabelValues(userID)),
+			testutil.ToFloat64(receivedSeriesBytes.WithLabelValues(userID)),
+		}
+	}
+
+	t.Run("should account the sizes of the successfully pushed requests", func(t *testing.T) {
+		DeletePerUserMetrics("user-1")
+
+		for i := 0; i < 2; i++ {
+			resp := httptest.NewRecorder()
+			Handler(100000, nil, nil, verifyWriteRequestHandler(t, cortexpb.API)).ServeHTTP(resp, createTenantRequest(t, "user-1", protobuf))
+			require.Equal(t, 200, resp.Code)
+		}
+
+		assert.Equal(t, []float64{float64(2 * len(compressed)), float64(2 * len(protobuf)), float64(2 * seriesSize)}, counters("user-1"))
+	})
+
+	t.Run("should account the sizes of the requests received through httpgrpc", func(t *testing.T) {
+		DeletePerUserMetrics("user-1")
+
+		req := createTenantRequest(t, "user-1", nil)
+		req.Body = bytesBufferCloser{bufferedBody{bytes.NewBuffer(compressed)}}
+		req.ContentLength = int64(len(compressed))
+
+		resp := httptest.NewRecorder()
+		Handler(100000, nil, nil, verifyWriteRequestHandler(t, cortexpb.API)).ServeHTTP(resp, req)
+		require.Equal(t, 200, resp.Code)
+
+		assert.Equal(t, []float64{float64(len(compressed)), float64(len(protobuf)), float64(seriesSize)}, counters("user-1"))
+	})
+
+	t.Run("should not account the failed pushes", func(t *testing.T) {
+		DeletePerUserMetrics("user-2")
+
+		resp := httptest.NewRecorder()
+		Handler(100000, nil, nil, func(context.Context, *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+			return nil, httpgrpc.Errorf(http.StatusTooManyRequests, "rate limited")
+		}).ServeHTTP(resp, createTenantRequest(t, "user-2", protobuf))
+		require.Equal(t, http.StatusTooManyRequests, resp.Code)
+
+		assert.Equal(t, []float64{0, 0, 0}, counters("user-2"))
+	})
+}
+
+// bytesBufferCloser is like the request body of httpgrpc, which is already read in a buffer.
+type bytesBufferCloser struct {
+	bufferedBody
+}
+
+func (bytesBufferCloser) Close() error {
+	return nil
+}
+
+type mockLimits map[string]int
+
+func (m mockLimits) MaxRequestBodySize(userID string) int {
+	return m[userID]
+}
+
+func (m mockLimits) ValidationWarningsHeader(string) bool {
+	return false
+}
+
+// warningsHeaderLimits enables the validation warnings header for the tenants in the set.
+type warningsHeaderLimits map[string]bool
+
+func (warningsHeaderLimits) MaxRequestBodySize(string) int {
+	return 0
+}
+
+func (m warningsHeaderLimits) ValidationWarningsHeader(userID string) bool {
+	return m[userID]
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func failingPushHandler(t *testing.T) Func {
+	return func(context.Context, *cortexpb.WriteRequest) (*cortexpb.WriteResponse, error) {
+		t.Fatal("the push should not be called")
+		return nil, nil
 	}
 }
 
+// createLargeBody returns a snappy block of the given size, whose header claims an
+// uncompressed length of declaredLen bytes.
+func createLargeBody(t *testing.T, declaredLen, size int) []byte {
+	t.Helper()
+	body := make([]byte, size)
+	n := binary.PutUvarint(body, uint64(declaredLen))
+	for i := n; i < size; i++ {
+		body[i] = byte(i)
+	}
+	return body
+}
+
+func createTenantRequest(t *testing.T, userID string, protobuf []byte) *http.Request {
+	t.Helper()
+	req := createRequest(t, protobuf)
+	return req.WithContext(user.InjectOrgID(req.Context(), userID))
+}
+
 func verifyWriteRequestHandler(t *testing.T, expectSource cortexpb.WriteRequest_SourceEnum) func(ctx context.Context, request *cortexpb.WriteRequest) (response *cortexpb.WriteResponse, err error) {
 	t.Helper()
 	return func(ctx context.Context, request *cortexpb.WriteRequest) (response *cortexpb.WriteResponse, err error) {
@@ -69,6 +69,14 @@ func newDuplicatedLabelError(series []cortexpb.LabelAdapter, labelName string) V
 	}
 }
 
+func newLabelNameNotAllowedError(series []cortexpb.LabelAdapter, labelName string) ValidationError {
+	return &genericValidationError{
+		message: "label name not allowed: %.200q metric %.200q",
+		cause:   labelName,
+		series:  series,
+	}
+}
+
 func newLabelsNotSortedError(series []cortexpb.LabelAdapter, labelName string) ValidationError {
 	return &genericValidationError{
 		message: "labels not sorted: %.200q metric %.200q",
@@ -77,6 +85,14 @@ func newLabelsNotSortedError(series []cortexpb.LabelAdapter, labelName string) V
 	}
 }
 
+func newMissingRequiredLabelError(series []cortexpb.LabelAdapter, labelName string) ValidationError {
+	return &genericValidationError{
+		message: "missing required label: %.200q metric %.200q",
+		cause:   labelName,
+		series:  series,
+	}
+}
+
 type tooManyLabelsError struct {
 	series []cortexpb.LabelAdapter
 	limit  int
@@ -187,6 +203,24 @@ func newExemplarLabelLengthError(seriesLabels []cortexpb.LabelAdapter, exemplarL
 	}
 }
 
+func newExemplarTooManyLabelsError(seriesLabels []cortexpb.LabelAdapter, exemplarLabels []cortexpb.LabelAdapter, timestamp int64, limit int) ValidationError {
+	return &exemplarValidationError{
+		message:        "exemplar has more than " + strconv.Itoa(limit) + " labels, timestamp: %d series: %s labels: %s",
+		seriesLabels:   seriesLabels,
+		exemplarLabels: exemplarLabels,
+		timestamp:      timestamp,
+	}
+}
+
+func newExemplarLabelValueTooLongError(seriesLabels []cortexpb.LabelAdapter, exemplarLabels []cortexpb.LabelAdapter, timestamp int64, limit int) ValidationError {
+	return &exemplarValidationError{
+		message:        "exemplar label value exceeds " + strconv.Itoa(limit) + " characters, timestamp: %d series: %s labels: %s",
+		seriesLabels:   seriesLabels,
+		exemplarLabels: exemplarLabels,
+		timestamp:      timestamp,
+	}
+}
+
 // formatLabelSet formats label adapters as a metric name with labels, while preserving
 // label order, and keeping duplicates. If there are multiple "__name__" labels, only
 // first one is used as metric name, other ones will be included as regular labels.
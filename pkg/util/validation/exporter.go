@@ -6,8 +6,9 @@ import (
 
 // OverridesExporter exposes per-tenant resource limit overrides as Prometheus metrics
 type OverridesExporter struct {
-	tenantLimits TenantLimits
-	description  *prometheus.Desc
+	tenantLimits       TenantLimits
+	description        *prometheus.Desc
+	featureDescription *prometheus.Desc
 }
 
 // NewOverridesExporter creates an OverridesExporter that reads updates to per-tenant
@@ -21,11 +22,18 @@ func NewOverridesExporter(tenantLimits TenantLimits) *OverridesExporter {
 			[]string{"limit_name", "user"},
 			nil,
 		),
+		featureDescription: prometheus.NewDesc(
+			"cortex_tenant_feature_enabled",
+			"Feature flags set for tenants, with value 1 if the feature is enabled and 0 if it's disabled",
+			[]string{"feature", "user"},
+			nil,
+		),
 	}
 }
 
 func (oe *OverridesExporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- oe.description
+	ch <- oe.featureDescription
 }
 
 func (oe *OverridesExporter) Collect(ch chan<- prometheus.Metric) {
@@ -40,5 +48,18 @@ func (oe *OverridesExporter) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.MaxLocalSeriesPerMetric), "max_local_series_per_metric", tenant)
 		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.MaxGlobalSeriesPerUser), "max_global_series_per_user", tenant)
 		ch <- prometheus.MustNewConstMetric(oe.description, prometheus.GaugeValue, float64(limits.MaxGlobalSeriesPerMetric), "max_global_series_per_metric", tenant)
+
+		for _, feature := range KnownFeatureFlags() {
+			if enabled, ok := limits.FeatureFlag(feature); ok {
+				ch <- prometheus.MustNewConstMetric(oe.featureDescription, prometheus.GaugeValue, boolToFloat64(enabled), feature, tenant)
+			}
+		}
+	}
+}
+
+func boolToFloat64(b bool) float64 {
+	if b {
+		return 1
 	}
+	return 0
 }
@@ -1,10 +1,12 @@
 package validation
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestOverridesExporter_noConfig(t *testing.T) {
@@ -28,3 +30,26 @@ func TestOverridesExporter_withConfig(t *testing.T) {
 	count := testutil.CollectAndCount(exporter, "cortex_overrides")
 	assert.Greater(t, count, 0)
 }
+
+func TestOverridesExporter_withFeatureFlags(t *testing.T) {
+	tenantLimits := map[string]*Limits{
+		"tenant-a": {
+			FeatureFlags: FeatureFlagsMap{FeatureExemplars: false, FeatureQuerySharding: true},
+		},
+		"tenant-b": {
+			FrontendQuerySharding: FrontendMiddlewareDisabled,
+		},
+		"tenant-c": {},
+	}
+
+	exporter := NewOverridesExporter(newMockTenantLimits(tenantLimits))
+
+	// Only the feature flags explicitly set for a tenant are exported.
+	require.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(`
+		# HELP cortex_tenant_feature_enabled Feature flags set for tenants, with value 1 if the feature is enabled and 0 if it's disabled
+		# TYPE cortex_tenant_feature_enabled gauge
+		cortex_tenant_feature_enabled{feature="exemplars",user="tenant-a"} 0
+		cortex_tenant_feature_enabled{feature="query_sharding",user="tenant-a"} 1
+		cortex_tenant_feature_enabled{feature="query_sharding",user="tenant-b"} 0
+	`), "cortex_tenant_feature_enabled"))
+}
@@ -0,0 +1,110 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Per-tenant feature flags.
+const (
+	// FeatureQuerySharding toggles the query-frontend query sharding. If not set, it follows
+	// the query-frontend configuration.
+	FeatureQuerySharding = "query_sharding"
+
+	// FeatureExemplars toggles the ingestion of the exemplars. If not set, the exemplars are ingested.
+	FeatureExemplars = "exemplars"
+)
+
+// knownFeatureFlags is the registry of the per-tenant feature flags, with their description.
+var knownFeatureFlags = map[string]string{
+	FeatureQuerySharding: "query-frontend query sharding, requires -querier.parallelise-shardable-queries",
+	FeatureExemplars:     "ingestion of the exemplars",
+}
+
+// KnownFeatureFlags returns the names of the known feature flags, sorted.
+func KnownFeatureFlags() []string {
+	names := make([]string, 0, len(knownFeatureFlags))
+	for name := range knownFeatureFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func featureFlagsHelp() string {
+	flags := make([]string, 0, len(knownFeatureFlags))
+	for _, name := range KnownFeatureFlags() {
+		flags = append(flags, fmt.Sprintf("%s (%s)", name, knownFeatureFlags[name]))
+	}
+	return strings.Join(flags, ", ")
+}
+
+// FeatureFlagsMap holds the per-tenant feature flags, by name. The unknown feature flags are rejected.
+type FeatureFlagsMap map[string]bool
+
+// String implements flag.Value
+func (m FeatureFlagsMap) String() string {
+	out, err := json.Marshal(map[string]bool(m))
+	if err != nil {
+		return fmt.Sprintf("failed to marshal: %v", err)
+	}
+	return string(out)
+}
+
+// Set implements flag.Value
+func (m FeatureFlagsMap) Set(s string) error {
+	newMap := map[string]bool{}
+	return m.updateMap(json.Unmarshal([]byte(s), &newMap), newMap)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (m FeatureFlagsMap) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	newMap := map[string]bool{}
+	return m.updateMap(unmarshal(newMap), newMap)
+}
+
+func (m FeatureFlagsMap) updateMap(unmarshalErr error, newMap map[string]bool) error {
+	if unmarshalErr != nil {
+		return unmarshalErr
+	}
+
+	for k, v := range newMap {
+		if _, ok := knownFeatureFlags[k]; !ok {
+			return errors.Errorf("unknown feature flag: %s", k)
+		}
+		m[k] = v
+	}
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (m FeatureFlagsMap) MarshalYAML() (interface{}, error) {
+	return map[string]bool(m), nil
+}
+
+// FeatureFlag returns whether the feature is enabled, and whether the feature flag is set, either
+// in the feature flags or in the deprecated limit it replaces.
+func (l *Limits) FeatureFlag(name string) (enabled, ok bool) {
+	if enabled, ok := l.FeatureFlags[name]; ok {
+		return enabled, true
+	}
+
+	switch name {
+	case FeatureQuerySharding:
+		if l.FrontendQuerySharding != "" {
+			return l.FrontendQuerySharding == FrontendMiddlewareEnabled, true
+		}
+	}
+	return false, false
+}
+
+func (l *Limits) copyFeatureFlags(defaults FeatureFlagsMap) {
+	l.FeatureFlags = make(map[string]bool, len(defaults))
+	for k, v := range defaults {
+		l.FeatureFlags[k] = v
+	}
+}
@@ -0,0 +1,69 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// LabelsMap holds a set of label names and values, like the external labels of a tenant. On
+// command line, it's given in JSON format.
+type LabelsMap map[string]string
+
+// String implements flag.Value
+func (m LabelsMap) String() string {
+	out, err := json.Marshal(map[string]string(m))
+	if err != nil {
+		return fmt.Sprintf("failed to marshal: %v", err)
+	}
+	return string(out)
+}
+
+// Set implements flag.Value
+func (m LabelsMap) Set(s string) error {
+	newMap := map[string]string{}
+	return m.updateMap(json.Unmarshal([]byte(s), &newMap), newMap)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (m LabelsMap) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	newMap := map[string]string{}
+	return m.updateMap(unmarshal(newMap), newMap)
+}
+
+func (m LabelsMap) updateMap(unmarshalErr error, newMap map[string]string) error {
+	if unmarshalErr != nil {
+		return unmarshalErr
+	}
+
+	for k, v := range newMap {
+		if !model.LabelName(k).IsValid() {
+			return errors.Errorf("invalid label name: %s", k)
+		}
+		m[k] = v
+	}
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (m LabelsMap) MarshalYAML() (interface{}, error) {
+	return map[string]string(m), nil
+}
+
+// Labels returns the labels of the map, sorted by name.
+func (m LabelsMap) Labels() labels.Labels {
+	if len(m) == 0 {
+		return nil
+	}
+	return labels.FromMap(m)
+}
+
+func (l *Limits) copyRulerExternalLabels(defaults LabelsMap) {
+	l.RulerExternalLabels = make(map[string]string, len(defaults))
+	for k, v := range defaults {
+		l.RulerExternalLabels[k] = v
+	}
+}
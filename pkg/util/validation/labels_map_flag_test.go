@@ -0,0 +1,58 @@
+package validation
+
+import (
+	"bytes"
+	"flag"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestLabelsMap(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args     []string
+		expected LabelsMap
+		error    string
+	}{
+		"basic test": {
+			args:     []string{"-map-flag", "{\"cluster\": \"eu\", \"team\": \"a\"}"},
+			expected: LabelsMap{"cluster": "eu", "team": "a"},
+		},
+
+		"invalid label name": {
+			args:  []string{"-map-flag", "{\"1cluster\": \"eu\"}"},
+			error: "invalid value \"{\\\"1cluster\\\": \\\"eu\\\"}\" for flag -map-flag: invalid label name: 1cluster",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			v := LabelsMap{}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(&bytes.Buffer{}) // otherwise errors would go to stderr.
+			fs.Var(v, "map-flag", "Map flag, you can pass JSON into this")
+			err := fs.Parse(tc.args)
+
+			if tc.error != "" {
+				require.NotNil(t, err)
+				assert.Equal(t, tc.error, err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, v)
+			}
+		})
+	}
+}
+
+func TestLabelsMap_ShouldNotModifyTheDefaultLimits(t *testing.T) {
+	defaults := Limits{RulerExternalLabels: LabelsMap{"cluster": "eu"}}
+	SetDefaultLimitsForYAMLUnmarshalling(defaults)
+
+	var l Limits
+	require.NoError(t, yaml.Unmarshal([]byte("ruler_external_labels:\n  team: a\n"), &l))
+
+	assert.Equal(t, labels.FromStrings("cluster", "eu", "team", "a"), l.RulerExternalLabels.Labels())
+	assert.Equal(t, LabelsMap{"cluster": "eu"}, defaults.RulerExternalLabels)
+}
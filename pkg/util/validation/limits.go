@@ -5,25 +5,67 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"math"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/relabel"
 	"golang.org/x/time/rate"
 
+	cortex_tsdb "github.com/cortexproject/cortex/pkg/storage/tsdb"
 	"github.com/cortexproject/cortex/pkg/util/flagext"
 )
 
 var errMaxGlobalSeriesPerUserValidation = errors.New("The ingester.max-global-series-per-user limit is unsupported if distributor.shard-by-all-labels is disabled")
+var errInvalidShadowWritePercent = errors.New("invalid shadow write percent, the value should be between 0 and 100")
+var errInvalidFrontendMiddlewareToggle = fmt.Errorf("invalid query-frontend middleware toggle, supported values are: %s, %s or empty", FrontendMiddlewareEnabled, FrontendMiddlewareDisabled)
+var errInvalidValidationMode = fmt.Errorf("invalid validation limit mode, supported values are: %s, %s", ValidationModeEnforce, ValidationModeWarn)
+var errInvalidNaNHandling = fmt.Errorf("invalid NaN handling, supported values are: %s, %s, %s", NaNHandlingKeep, NaNHandlingDropAll, NaNHandlingDropStaleOnly)
+var errInvalidQueryAuditSampleRatio = errors.New("invalid query audit sample ratio, the value should be between 0 and 1")
+var errInvalidShadowLimitsLogSampleRatio = errors.New("invalid shadow limits log sample ratio, the value should be between 0 and 1")
+var errInvalidRulerExternalURL = errors.New("invalid ruler external URL")
+var errInvalidQueryAuditField = fmt.Errorf("invalid query audit field, supported values are: %s", strings.Join(QueryAuditFields, ", "))
 
 // Supported values for enum limits
 const (
-	LocalIngestionRateStrategy  = "local"
-	GlobalIngestionRateStrategy = "global"
+	LocalIngestionRateStrategy             = "local"
+	GlobalIngestionRateStrategy            = "global"
+	GlobalCoordinatedIngestionRateStrategy = "global-coordinated"
+
+	AllowedLabelNamesActionReject = "reject"
+	AllowedLabelNamesActionStrip  = "strip"
+
+	// Per-tenant toggles of the query-frontend middlewares. An empty toggle follows the
+	// query-frontend configuration.
+	FrontendMiddlewareEnabled  = "enabled"
+	FrontendMiddlewareDisabled = "disabled"
+
+	// Enforcement modes of the label validation limits. In warn mode, the series exceeding
+	// the limit are accepted and a warning is recorded.
+	ValidationModeEnforce = "enforce"
+	ValidationModeWarn    = "warn"
+
+	// Handling of the NaN samples in the ingesters. The staleness markers are a specific NaN.
+	NaNHandlingKeep          = "keep"
+	NaNHandlingDropAll       = "drop_all"
+	NaNHandlingDropStaleOnly = "drop_stale_only"
+
+	// Fields of the query audit records.
+	QueryAuditFieldTenant        = "tenant"
+	QueryAuditFieldQuery         = "query"
+	QueryAuditFieldRange         = "range"
+	QueryAuditFieldDuration      = "duration"
+	QueryAuditFieldStatus        = "status"
+	QueryAuditFieldFetchedSeries = "fetched_series"
 )
 
+// QueryAuditFields are the supported fields of the query audit records.
+var QueryAuditFields = []string{QueryAuditFieldTenant, QueryAuditFieldQuery, QueryAuditFieldRange, QueryAuditFieldDuration, QueryAuditFieldStatus, QueryAuditFieldFetchedSeries}
+
 // LimitError are errors that do not comply with the limits specified.
 type LimitError string
 
@@ -43,6 +85,8 @@ type Limits struct {
 	HAReplicaLabel            string              `yaml:"ha_replica_label" json:"ha_replica_label"`
 	HAMaxClusters             int                 `yaml:"ha_max_clusters" json:"ha_max_clusters"`
 	DropLabels                flagext.StringSlice `yaml:"drop_labels" json:"drop_labels"`
+	AllowedLabelNames         flagext.StringSlice `yaml:"allowed_label_names" json:"allowed_label_names"`
+	AllowedLabelNamesAction   string              `yaml:"allowed_label_names_action" json:"allowed_label_names_action"`
 	MaxLabelNameLength        int                 `yaml:"max_label_name_length" json:"max_label_name_length"`
 	MaxLabelValueLength       int                 `yaml:"max_label_value_length" json:"max_label_value_length"`
 	MaxLabelNamesPerSeries    int                 `yaml:"max_label_names_per_series" json:"max_label_names_per_series"`
@@ -53,8 +97,33 @@ type Limits struct {
 	EnforceMetadataMetricName bool                `yaml:"enforce_metadata_metric_name" json:"enforce_metadata_metric_name"`
 	EnforceMetricName         bool                `yaml:"enforce_metric_name" json:"enforce_metric_name"`
 	IngestionTenantShardSize  int                 `yaml:"ingestion_tenant_shard_size" json:"ingestion_tenant_shard_size"`
+	MaxRequestBodySize        int                 `yaml:"max_request_body_size" json:"max_request_body_size"`
+	ShadowWriteEndpoint       string              `yaml:"shadow_write_endpoint" json:"shadow_write_endpoint"`
+	ShadowWritePercent        float64             `yaml:"shadow_write_percent" json:"shadow_write_percent"`
 	MetricRelabelConfigs      []*relabel.Config   `yaml:"metric_relabel_configs,omitempty" json:"metric_relabel_configs,omitempty" doc:"nocli|description=List of metric relabel configurations. Note that in most situations, it is more effective to use metrics relabeling directly in the Prometheus server, e.g. remote_write.write_relabel_configs."`
 
+	// Enforcement modes of the label validation limits.
+	MaxLabelNameLengthMode     string `yaml:"max_label_name_length_mode" json:"max_label_name_length_mode"`
+	MaxLabelValueLengthMode    string `yaml:"max_label_value_length_mode" json:"max_label_value_length_mode"`
+	MaxLabelNamesPerSeriesMode string `yaml:"max_label_names_per_series_mode" json:"max_label_names_per_series_mode"`
+	ValidationWarningsHeader   bool   `yaml:"validation_warnings_header_enabled" json:"validation_warnings_header_enabled"`
+
+	// Shadow label validation limits, evaluated without being enforced.
+	ShadowMaxLabelNameLength     int     `yaml:"shadow_max_label_name_length" json:"shadow_max_label_name_length"`
+	ShadowMaxLabelValueLength    int     `yaml:"shadow_max_label_value_length" json:"shadow_max_label_value_length"`
+	ShadowMaxLabelNamesPerSeries int     `yaml:"shadow_max_label_names_per_series" json:"shadow_max_label_names_per_series"`
+	ShadowLimitsLogSampleRatio   float64 `yaml:"shadow_limits_log_sample_ratio" json:"shadow_limits_log_sample_ratio"`
+
+	// Label names required in the ingested series, and in the query selectors.
+	RequiredLabelNames                   flagext.StringSlice `yaml:"required_label_names" json:"required_label_names"`
+	RequiredLabelNamesMode               string              `yaml:"required_label_names_mode" json:"required_label_names_mode"`
+	RejectSelectorsWithoutRequiredLabels bool                `yaml:"reject_selectors_without_required_labels" json:"reject_selectors_without_required_labels"`
+
+	// Exemplars
+	MaxExemplarsPerSecond       float64 `yaml:"max_exemplars_per_second" json:"max_exemplars_per_second"`
+	MaxExemplarLabels           int     `yaml:"max_exemplar_labels" json:"max_exemplar_labels"`
+	MaxExemplarLabelValueLength int     `yaml:"max_exemplar_label_value_length" json:"max_exemplar_label_value_length"`
+
 	// Ingester enforced limits.
 	// Series
 	MaxSeriesPerQuery        int `yaml:"max_series_per_query" json:"max_series_per_query"`
@@ -69,10 +138,18 @@ type Limits struct {
 	MaxLocalMetadataPerMetric           int `yaml:"max_metadata_per_metric" json:"max_metadata_per_metric"`
 	MaxGlobalMetricsWithMetadataPerUser int `yaml:"max_global_metadata_per_user" json:"max_global_metadata_per_user"`
 	MaxGlobalMetadataPerMetric          int `yaml:"max_global_metadata_per_metric" json:"max_global_metadata_per_metric"`
+	// Metric metadata enforcement
+	RequireMetricMetadata     bool           `yaml:"require_metric_metadata" json:"require_metric_metadata"`
+	MetricMetadataGracePeriod model.Duration `yaml:"metric_metadata_grace_period" json:"metric_metadata_grace_period"`
+	NaNHandling               string         `yaml:"nan_handling" json:"nan_handling"`
+
+	// Ingester TSDB block ranges, empty to use the blocks storage config.
+	TSDBBlockRanges cortex_tsdb.DurationList `yaml:"tsdb_block_ranges_period" json:"tsdb_block_ranges_period"`
 
 	// Querier enforced limits.
 	MaxChunksPerQueryFromStore   int            `yaml:"max_chunks_per_query" json:"max_chunks_per_query"` // TODO Remove in Cortex 1.12.
 	MaxChunksPerQuery            int            `yaml:"max_fetched_chunks_per_query" json:"max_fetched_chunks_per_query"`
+	MaxChunksPerColdQuery        int            `yaml:"max_fetched_chunks_per_cold_query" json:"max_fetched_chunks_per_cold_query"`
 	MaxFetchedSeriesPerQuery     int            `yaml:"max_fetched_series_per_query" json:"max_fetched_series_per_query"`
 	MaxFetchedChunkBytesPerQuery int            `yaml:"max_fetched_chunk_bytes_per_query" json:"max_fetched_chunk_bytes_per_query"`
 	MaxQueryLookback             model.Duration `yaml:"max_query_lookback" json:"max_query_lookback"`
@@ -81,28 +158,80 @@ type Limits struct {
 	CardinalityLimit             int            `yaml:"cardinality_limit" json:"cardinality_limit"`
 	MaxCacheFreshness            model.Duration `yaml:"max_cache_freshness" json:"max_cache_freshness"`
 	MaxQueriersPerTenant         int            `yaml:"max_queriers_per_tenant" json:"max_queriers_per_tenant"`
+	CardinalityAnalysisMaxLimit  int            `yaml:"cardinality_analysis_max_limit" json:"cardinality_analysis_max_limit"`
+	PrefetchRequestsRateLimit    float64        `yaml:"prefetch_requests_rate_limit" json:"prefetch_requests_rate_limit"`
+	PrefetchRequestsBurstSize    int            `yaml:"prefetch_requests_burst_size" json:"prefetch_requests_burst_size"`
+	PartialResultsOnTimeout      bool           `yaml:"partial_results_on_timeout" json:"partial_results_on_timeout"`
+
+	// Querier limit estimated from the blocks stats in the bucket index.
+	MaxEstimatedFetchedSeriesPerQuery int `yaml:"max_estimated_fetched_series_per_query" json:"max_estimated_fetched_series_per_query"`
+
+	// Query-frontend middlewares.
+	FrontendStepAlign              string         `yaml:"frontend_step_align" json:"frontend_step_align"`
+	FrontendSplitQueries           string         `yaml:"frontend_split_queries" json:"frontend_split_queries"`
+	FrontendSplitQueriesByInterval model.Duration `yaml:"frontend_split_queries_by_interval" json:"frontend_split_queries_by_interval"`
+	SplitQueriesTimezone           string         `yaml:"split_queries_timezone" json:"split_queries_timezone"`
+	FrontendResultsCache           string         `yaml:"frontend_results_cache" json:"frontend_results_cache"`
+	FrontendQuerySharding          string         `yaml:"frontend_query_sharding" json:"frontend_query_sharding"` // Deprecated. Replaced by the query_sharding feature flag.
+	FrontendRetries                string         `yaml:"frontend_retries" json:"frontend_retries"`
+	FrontendMaxRetries             int            `yaml:"frontend_max_retries" json:"frontend_max_retries"`
+	FrontendDownsampling           string         `yaml:"frontend_downsampling" json:"frontend_downsampling"`
+	QueryStatsHeaderEnabled        bool           `yaml:"query_stats_header_enabled" json:"query_stats_header_enabled"`
+
+	// Query-frontend vertical sharding.
+	QueryVerticalShardSize int `yaml:"query_vertical_shard_size" json:"query_vertical_shard_size"`
+
+	// Query-frontend query audit.
+	QueryAuditSampleRatio float64                `yaml:"query_audit_sample_ratio" json:"query_audit_sample_ratio"`
+	QueryAuditWebhookURL  string                 `yaml:"query_audit_webhook_url" json:"query_audit_webhook_url"`
+	QueryAuditFields      flagext.StringSliceCSV `yaml:"query_audit_fields" json:"query_audit_fields"`
+
+	// Query-scheduler.
+	QueryPriority int `yaml:"query_priority" json:"query_priority"`
 
 	// Ruler defaults and limits.
-	RulerEvaluationDelay        model.Duration `yaml:"ruler_evaluation_delay_duration" json:"ruler_evaluation_delay_duration"`
-	RulerTenantShardSize        int            `yaml:"ruler_tenant_shard_size" json:"ruler_tenant_shard_size"`
-	RulerMaxRulesPerRuleGroup   int            `yaml:"ruler_max_rules_per_rule_group" json:"ruler_max_rules_per_rule_group"`
-	RulerMaxRuleGroupsPerTenant int            `yaml:"ruler_max_rule_groups_per_tenant" json:"ruler_max_rule_groups_per_tenant"`
+	RulerEvaluationDelay           model.Duration `yaml:"ruler_evaluation_delay_duration" json:"ruler_evaluation_delay_duration"`
+	RulerTenantShardSize           int            `yaml:"ruler_tenant_shard_size" json:"ruler_tenant_shard_size"`
+	RulerMaxRulesPerRuleGroup      int            `yaml:"ruler_max_rules_per_rule_group" json:"ruler_max_rules_per_rule_group"`
+	RulerMaxRuleGroupsPerTenant    int            `yaml:"ruler_max_rule_groups_per_tenant" json:"ruler_max_rule_groups_per_tenant"`
+	RulerNotificationQueueCapacity int            `yaml:"ruler_notification_queue_capacity" json:"ruler_notification_queue_capacity"`
+
+	// Tenants allowed to be queried by the federated rule groups.
+	RulerAllowedSourceTenants flagext.StringSlice `yaml:"ruler_allowed_source_tenants" json:"ruler_allowed_source_tenants"`
+
+	// Maximum number of rules across all the rule groups of a tenant.
+	RulerMaxRulesPerTenant int `yaml:"ruler_max_rules_per_tenant" json:"ruler_max_rules_per_tenant"`
+
+	// External labels and URL of the alerts sent by the ruler to the Alertmanager.
+	RulerExternalLabels LabelsMap `yaml:"ruler_external_labels" json:"ruler_external_labels"`
+	RulerExternalURL    string    `yaml:"ruler_external_url" json:"ruler_external_url"`
+
+	// Reject the recording rules whose metric collides with series not written by the ruler.
+	RulerProtectExistingMetrics bool `yaml:"ruler_protect_existing_metrics" json:"ruler_protect_existing_metrics"`
+
+	// Share of the alert notifications sent by the ruler with a delivery trace ID.
+	RulerDeliveryTraceSampleRatio float64 `yaml:"ruler_delivery_trace_sample_ratio" json:"ruler_delivery_trace_sample_ratio"`
 
 	// Store-gateway.
 	StoreGatewayTenantShardSize int `yaml:"store_gateway_tenant_shard_size" json:"store_gateway_tenant_shard_size"`
 
 	// Compactor.
 	CompactorBlocksRetentionPeriod model.Duration `yaml:"compactor_blocks_retention_period" json:"compactor_blocks_retention_period"`
+	CompactorBlocksDeletionDelay   model.Duration `yaml:"compactor_blocks_deletion_delay" json:"compactor_blocks_deletion_delay"`
 
 	// This config doesn't have a CLI flag registered here because they're registered in
 	// their own original config struct.
 	S3SSEType                 string `yaml:"s3_sse_type" json:"s3_sse_type" doc:"nocli|description=S3 server-side encryption type. Required to enable server-side encryption overrides for a specific tenant. If not set, the default S3 client settings are used."`
 	S3SSEKMSKeyID             string `yaml:"s3_sse_kms_key_id" json:"s3_sse_kms_key_id" doc:"nocli|description=S3 server-side encryption KMS Key ID. Ignored if the SSE type override is not set."`
 	S3SSEKMSEncryptionContext string `yaml:"s3_sse_kms_encryption_context" json:"s3_sse_kms_encryption_context" doc:"nocli|description=S3 server-side encryption KMS encryption context. If unset and the key ID override is set, the encryption context will not be provided to S3. Ignored if the SSE type override is not set."`
+	ClientSideEncryptionKeyID string `yaml:"client_side_encryption_key_id" json:"client_side_encryption_key_id" doc:"nocli|description=ID of the key used to encrypt client-side the blocks index and chunks of the tenant before uploading them to the storage. The key must be available from the data key provider of all the components reading or writing the blocks. If not set, the blocks are not encrypted client-side."`
 
 	// Alertmanager.
-	AlertmanagerReceiversBlockCIDRNetworks     flagext.CIDRSliceCSV `yaml:"alertmanager_receivers_firewall_block_cidr_networks" json:"alertmanager_receivers_firewall_block_cidr_networks"`
-	AlertmanagerReceiversBlockPrivateAddresses bool                 `yaml:"alertmanager_receivers_firewall_block_private_addresses" json:"alertmanager_receivers_firewall_block_private_addresses"`
+	AlertmanagerReceiversBlockCIDRNetworks     flagext.CIDRSliceCSV   `yaml:"alertmanager_receivers_firewall_block_cidr_networks" json:"alertmanager_receivers_firewall_block_cidr_networks"`
+	AlertmanagerReceiversBlockPrivateAddresses bool                   `yaml:"alertmanager_receivers_firewall_block_private_addresses" json:"alertmanager_receivers_firewall_block_private_addresses"`
+	AlertmanagerReceiversAllowCIDRNetworks     flagext.CIDRSliceCSV   `yaml:"alertmanager_receivers_firewall_allow_cidr_networks" json:"alertmanager_receivers_firewall_allow_cidr_networks"`
+	AlertmanagerReceiversBlockHostnames        flagext.StringSliceCSV `yaml:"alertmanager_receivers_firewall_block_hostnames" json:"alertmanager_receivers_firewall_block_hostnames"`
+	AlertmanagerReceiversAllowHostnames        flagext.StringSliceCSV `yaml:"alertmanager_receivers_firewall_allow_hostnames" json:"alertmanager_receivers_firewall_allow_hostnames"`
 
 	NotificationRateLimit               float64                  `yaml:"alertmanager_notification_rate_limit" json:"alertmanager_notification_rate_limit"`
 	NotificationRateLimitPerIntegration NotificationRateLimitMap `yaml:"alertmanager_notification_rate_limit_per_integration" json:"alertmanager_notification_rate_limit_per_integration"`
@@ -113,22 +242,49 @@ type Limits struct {
 	AlertmanagerMaxDispatcherAggregationGroups int `yaml:"alertmanager_max_dispatcher_aggregation_groups" json:"alertmanager_max_dispatcher_aggregation_groups"`
 	AlertmanagerMaxAlertsCount                 int `yaml:"alertmanager_max_alerts_count" json:"alertmanager_max_alerts_count"`
 	AlertmanagerMaxAlertsSizeBytes             int `yaml:"alertmanager_max_alerts_size_bytes" json:"alertmanager_max_alerts_size_bytes"`
+
+	AlertmanagerMaxSilencesCount    int `yaml:"alertmanager_max_silences_count" json:"alertmanager_max_silences_count"`
+	AlertmanagerMaxSilenceSizeBytes int `yaml:"alertmanager_max_silence_size_bytes" json:"alertmanager_max_silence_size_bytes"`
+
+	// Feature flags.
+	FeatureFlags FeatureFlagsMap `yaml:"feature_flags" json:"feature_flags"`
+
+	// Query-frontend step alignment opt-out.
+	DisableStepAlignment bool `yaml:"disable_step_alignment" json:"disable_step_alignment"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet
 func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.IngestionTenantShardSize, "distributor.ingestion-tenant-shard-size", 0, "The default tenant's shard size when the shuffle-sharding strategy is used. Must be set both on ingesters and distributors. When this setting is specified in the per-tenant overrides, a value of 0 disables shuffle sharding for the tenant.")
 	f.Float64Var(&l.IngestionRate, "distributor.ingestion-rate-limit", 25000, "Per-user ingestion rate limit in samples per second.")
-	f.StringVar(&l.IngestionRateStrategy, "distributor.ingestion-rate-limit-strategy", "local", "Whether the ingestion rate limit should be applied individually to each distributor instance (local), or evenly shared across the cluster (global).")
+	f.IntVar(&l.MaxRequestBodySize, "distributor.max-request-body-size", 0, "Per-user max size, in bytes, of the uncompressed body of a push request. The requests exceeding it are rejected with 413, without reading more of the body than needed to detect it. This limit is enforced in addition to -distributor.max-recv-msg-size, which applies to all users. 0 to disable.")
+	f.StringVar(&l.ShadowWriteEndpoint, "distributor.shadow-write-endpoint", "", "Remote-write URL of a secondary Cortex cluster to which a percentage of the user's write requests is forwarded, after the validation and on a best-effort basis, e.g. for migration testing. The requests are forwarded with the same tenant ID. Empty to disable.")
+	f.Float64Var(&l.ShadowWritePercent, "distributor.shadow-write-percent", 0, "Percentage (0-100) of the user's write requests forwarded to the -distributor.shadow-write-endpoint.")
+	f.StringVar(&l.IngestionRateStrategy, "distributor.ingestion-rate-limit-strategy", "local", "Whether the ingestion rate limit should be applied individually to each distributor instance (local), evenly shared across the cluster (global), or shared across the cluster proportionally to the recent per-distributor usage (global-coordinated).")
 	f.IntVar(&l.IngestionBurstSize, "distributor.ingestion-burst-size", 50000, "Per-user allowed ingestion burst size (in number of samples).")
 	f.BoolVar(&l.AcceptHASamples, "distributor.ha-tracker.enable-for-all-users", false, "Flag to enable, for all users, handling of samples with external labels identifying replicas in an HA Prometheus setup.")
 	f.StringVar(&l.HAClusterLabel, "distributor.ha-tracker.cluster", "cluster", "Prometheus label to look for in samples to identify a Prometheus HA cluster.")
 	f.StringVar(&l.HAReplicaLabel, "distributor.ha-tracker.replica", "__replica__", "Prometheus label to look for in samples to identify a Prometheus HA replica.")
 	f.IntVar(&l.HAMaxClusters, "distributor.ha-tracker.max-clusters", 0, "Maximum number of clusters that HA tracker will keep track of for single user. 0 to disable the limit.")
 	f.Var(&l.DropLabels, "distributor.drop-label", "This flag can be used to specify label names that to drop during sample ingestion within the distributor and can be repeated in order to drop multiple labels.")
+	f.Var(&l.AllowedLabelNames, "distributor.allowed-label-name", "Label name allowed in the ingested series. Can be repeated in order to allow multiple label names. The metric name is always allowed. If not set, all label names are allowed.")
+	f.StringVar(&l.AllowedLabelNamesAction, "distributor.allowed-label-names-action", AllowedLabelNamesActionReject, fmt.Sprintf("What to do with series with label names not in the allowed label names. Supported values are: %s (the series is discarded), %s (the label names are removed from the series, and the series collapsing onto the same labels are merged). Any other value is treated as %s.", AllowedLabelNamesActionReject, AllowedLabelNamesActionStrip, AllowedLabelNamesActionReject))
 	f.IntVar(&l.MaxLabelNameLength, "validation.max-length-label-name", 1024, "Maximum length accepted for label names")
 	f.IntVar(&l.MaxLabelValueLength, "validation.max-length-label-value", 2048, "Maximum length accepted for label value. This setting also applies to the metric name")
 	f.IntVar(&l.MaxLabelNamesPerSeries, "validation.max-label-names-per-series", 30, "Maximum number of label names per series.")
+	modeHelp := fmt.Sprintf("Supported values are: %s (the series exceeding the limit are discarded), %s (the series are accepted, and the warning is tracked in cortex_validation_warnings_total).", ValidationModeEnforce, ValidationModeWarn)
+	f.StringVar(&l.MaxLabelNameLengthMode, "validation.max-length-label-name-mode", ValidationModeEnforce, "Enforcement mode of -validation.max-length-label-name. "+modeHelp)
+	f.StringVar(&l.MaxLabelValueLengthMode, "validation.max-length-label-value-mode", ValidationModeEnforce, "Enforcement mode of -validation.max-length-label-value, which also applies to the metric name. "+modeHelp)
+	f.StringVar(&l.MaxLabelNamesPerSeriesMode, "validation.max-label-names-per-series-mode", ValidationModeEnforce, "Enforcement mode of -validation.max-label-names-per-series. "+modeHelp)
+	f.Var(&l.RequiredLabelNames, "validation.required-label-name", "Label name required in the ingested series. Can be repeated in order to require multiple label names. A label with an empty value is missing.")
+	f.StringVar(&l.RequiredLabelNamesMode, "validation.required-label-names-mode", ValidationModeEnforce, "Enforcement mode of -validation.required-label-name. "+modeHelp)
+	f.BoolVar(&l.RejectSelectorsWithoutRequiredLabels, "querier.reject-selectors-without-required-labels", false, "Reject the queries with a selector which can only match the series missing a label of -validation.required-label-name, like {cluster=\"\"}. Such a selector is usually a typo, like an empty template variable.")
+	f.BoolVar(&l.ValidationWarningsHeader, "validation.warnings-header-enabled", false, "Respond to the push requests with the X-Cortex-Validation-Warnings header, listing the reasons of the validation warnings of the request.")
+	shadowHelp := "The series accepted which would be discarded by the shadow limit are tracked in cortex_validation_shadow_discards_total, without being discarded. 0 to disable."
+	f.IntVar(&l.ShadowMaxLabelNameLength, "validation.shadow-max-length-label-name", 0, "Shadow limit of -validation.max-length-label-name. "+shadowHelp)
+	f.IntVar(&l.ShadowMaxLabelValueLength, "validation.shadow-max-length-label-value", 0, "Shadow limit of -validation.max-length-label-value, which also applies to the metric name. "+shadowHelp)
+	f.IntVar(&l.ShadowMaxLabelNamesPerSeries, "validation.shadow-max-label-names-per-series", 0, "Shadow limit of -validation.max-label-names-per-series. "+shadowHelp)
+	f.Float64Var(&l.ShadowLimitsLogSampleRatio, "validation.shadow-limits-log-sample-ratio", 0, "Ratio (0-1) of the series which would be discarded by the shadow limits which are logged by the distributor. 0 to disable.")
 	f.IntVar(&l.MaxMetadataLength, "validation.max-metadata-length", 1024, "Maximum length accepted for metric metadata. Metadata refers to Metric Name, HELP and UNIT.")
 	f.BoolVar(&l.RejectOldSamples, "validation.reject-old-samples", false, "Reject old samples.")
 	_ = l.RejectOldSamplesMaxAge.Set("14d")
@@ -137,6 +293,9 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&l.CreationGracePeriod, "validation.create-grace-period", "Duration which table will be created/deleted before/after it's needed; we won't accept sample from before this time.")
 	f.BoolVar(&l.EnforceMetricName, "validation.enforce-metric-name", true, "Enforce every sample has a metric name.")
 	f.BoolVar(&l.EnforceMetadataMetricName, "validation.enforce-metadata-metric-name", true, "Enforce every metadata has a metric name.")
+	f.Float64Var(&l.MaxExemplarsPerSecond, "distributor.max-exemplars-per-second", 0, "Per-user rate limit of ingested exemplars, in exemplars per second. Exemplars exceeding the limit are dropped, while the samples in the same request are still ingested. The limit is applied like the ingestion rate limit, according to -distributor.ingestion-rate-limit-strategy. 0 to disable.")
+	f.IntVar(&l.MaxExemplarLabels, "validation.max-exemplar-labels", 0, "Maximum number of label names per exemplar. Exemplars exceeding the limit are dropped, while the samples are still ingested. 0 to disable.")
+	f.IntVar(&l.MaxExemplarLabelValueLength, "validation.max-length-exemplar-label-value", 0, "Maximum length accepted for exemplar label values. Exemplars exceeding the limit are dropped, while the samples are still ingested. 0 to disable.")
 
 	f.IntVar(&l.MaxSeriesPerQuery, "ingester.max-series-per-query", 100000, "The maximum number of series for which a query can fetch samples from each ingester. This limit is enforced only in the ingesters (when querying samples not flushed to the storage yet) and it's a per-instance limit. This limit is ignored when running the Cortex blocks storage. When running Cortex with blocks storage use -querier.max-fetched-series-per-query limit instead.")
 	f.IntVar(&l.MaxSamplesPerQuery, "ingester.max-samples-per-query", 1000000, "The maximum number of samples that a query can return. This limit only applies when running the Cortex chunks storage with -querier.ingester-streaming=false.")
@@ -150,10 +309,17 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.MaxLocalMetadataPerMetric, "ingester.max-metadata-per-metric", 10, "The maximum number of metadata per metric, per ingester. 0 to disable.")
 	f.IntVar(&l.MaxGlobalMetricsWithMetadataPerUser, "ingester.max-global-metadata-per-user", 0, "The maximum number of active metrics with metadata per user, across the cluster. 0 to disable. Supported only if -distributor.shard-by-all-labels is true.")
 	f.IntVar(&l.MaxGlobalMetadataPerMetric, "ingester.max-global-metadata-per-metric", 0, "The maximum number of metadata per metric, across the cluster. 0 to disable.")
+	f.BoolVar(&l.RequireMetricMetadata, "ingester.require-metric-metadata", false, "Reject the samples of the metrics for which the ingester has not received any metadata. The metadata is sent to all the ingesters of the tenant, and it is not required until -ingester.metric-metadata-startup-grace-period has elapsed since the ingester startup.")
+	_ = l.MetricMetadataGracePeriod.Set("1m")
+	f.Var(&l.MetricMetadataGracePeriod, "ingester.metric-metadata-grace-period", "How long the samples of a metric are accepted since the first sample received without metadata, when -ingester.require-metric-metadata is enabled. It gives the time to the metadata sent after the first samples to be received.")
+	f.StringVar(&l.NaNHandling, "ingester.nan-handling", NaNHandlingKeep, fmt.Sprintf("How the ingester handles the NaN samples pushed. Supported values are: %s (the samples are ingested), %s (the NaN samples, including the staleness markers, are dropped), %s (the staleness markers are dropped, while the other NaN samples are ingested). The dropped samples are tracked in cortex_ingester_dropped_nan_samples_total and are not reported as failures.", NaNHandlingKeep, NaNHandlingDropAll, NaNHandlingDropStaleOnly))
+	f.Var(&l.TSDBBlockRanges, "ingester.tsdb-block-ranges-period", "Per-tenant TSDB blocks range period, overriding -blocks-storage.tsdb.block-ranges-period. Each range period must be a divisor of the smallest -compactor.block-ranges or one of them. The change is applied when the TSDB of the tenant is opened, at the ingester startup or after it has been closed when idle. Empty to use -blocks-storage.tsdb.block-ranges-period.")
 	f.IntVar(&l.MaxChunksPerQueryFromStore, "store.query-chunk-limit", 2e6, "Deprecated. Use -querier.max-fetched-chunks-per-query CLI flag and its respective YAML config option instead. Maximum number of chunks that can be fetched in a single query. This limit is enforced when fetching chunks from the long-term storage only. When running the Cortex chunks storage, this limit is enforced in the querier and ruler, while when running the Cortex blocks storage this limit is enforced in the querier, ruler and store-gateway. 0 to disable.")
 	f.IntVar(&l.MaxChunksPerQuery, "querier.max-fetched-chunks-per-query", 0, "Maximum number of chunks that can be fetched in a single query from ingesters and long-term storage. This limit is enforced in the querier, ruler and store-gateway. Takes precedence over the deprecated -store.query-chunk-limit. 0 to disable.")
+	f.IntVar(&l.MaxChunksPerColdQuery, "querier.max-fetched-chunks-per-cold-query", 0, "Maximum number of chunks that can be fetched in a single query reading the cold blocks, as configured via -store-gateway.cold-blocks-min-age. It replaces -querier.max-fetched-chunks-per-query and the deprecated -store.query-chunk-limit for such queries. This limit is enforced in the querier, ruler and in the store-gateways serving the cold blocks. 0 to apply the same limit of the other queries.")
 	f.IntVar(&l.MaxFetchedSeriesPerQuery, "querier.max-fetched-series-per-query", 0, "The maximum number of unique series for which a query can fetch samples from each ingesters and blocks storage. This limit is enforced in the querier only when running Cortex with blocks storage. 0 to disable")
-	f.IntVar(&l.MaxFetchedChunkBytesPerQuery, "querier.max-fetched-chunk-bytes-per-query", 0, "The maximum size of all chunks in bytes that a query can fetch from each ingester and storage. This limit is enforced in the querier and ruler only when running Cortex with blocks storage. 0 to disable.")
+	f.IntVar(&l.MaxEstimatedFetchedSeriesPerQuery, "querier.max-estimated-fetched-series-per-query", 0, "The maximum number of series a query can touch in the blocks storage, estimated before querying the store-gateways as the sum of the series of the blocks within the query time range, according to the bucket index. The estimate is an upper bound, regardless of the query matchers. This limit is enforced in the querier only when running Cortex with blocks storage, and only if the stats of all the queried blocks are known. 0 to disable")
+	f.IntVar(&l.MaxFetchedChunkBytesPerQuery, "querier.max-fetched-chunk-bytes-per-query", 0, "The maximum size of all chunks in bytes that a query can fetch from each ingester and storage. This limit is enforced in the querier and ruler. 0 to disable.")
 	f.Var(&l.MaxQueryLength, "store.max-query-length", "Limit the query time range (end - start time). This limit is enforced in the query-frontend (on the received query), in the querier (on the query possibly split by the query-frontend) and in the chunks storage. 0 to disable.")
 	f.Var(&l.MaxQueryLookback, "querier.max-query-lookback", "Limit how long back data (series and metadata) can be queried, up until <lookback> duration ago. This limit is enforced in the query-frontend, querier and ruler. If the requested time range is outside the allowed range, the request will not fail but will be manipulated to only query data within the allowed time range. 0 to disable.")
 	f.IntVar(&l.MaxQueryParallelism, "querier.max-query-parallelism", 14, "Maximum number of split queries will be scheduled in parallel by the frontend.")
@@ -162,12 +328,46 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&l.MaxCacheFreshness, "frontend.max-cache-freshness", "Most recent allowed cacheable result per-tenant, to prevent caching very recent results that might still be in flux.")
 	f.IntVar(&l.MaxQueriersPerTenant, "frontend.max-queriers-per-tenant", 0, "Maximum number of queriers that can handle requests for a single tenant. If set to 0 or value higher than number of available queriers, *all* queriers will handle requests for the tenant. Each frontend (or query-scheduler, if used) will select the same set of queriers for the same tenant (given that all queriers are connected to all frontends / query-schedulers). This option only works with queriers connecting to the query-frontend / query-scheduler, not when using downstream URL.")
 
+	f.IntVar(&l.CardinalityAnalysisMaxLimit, "querier.cardinality-analysis-max-limit", 500, "Maximum number of label names or label values which can be requested to the cardinality analysis API endpoints.")
+	f.Float64Var(&l.PrefetchRequestsRateLimit, "querier.prefetch-requests-rate-limit", 0, "Per-tenant rate limit of the prefetch requests, in requests per second, enforced locally by each querier and store-gateway. 0 to disable the prefetch endpoints.")
+	f.IntVar(&l.PrefetchRequestsBurstSize, "querier.prefetch-requests-burst-size", 1, "Per-tenant burst size of the prefetch requests.")
+	f.BoolVar(&l.PartialResultsOnTimeout, "querier.partial-results-on-timeout", false, "Return partial results instead of failing the queries which are about to hit the -querier.timeout. When enabled, the querier stops fetching the series shortly before the query deadline, evaluates the query on the series fetched so far and annotates the response with a warning. The chunks with an inverted time range are also skipped instead of failing the query.")
+
+	toggleHelp := fmt.Sprintf("Supported values are: %s, %s, or empty to follow", FrontendMiddlewareEnabled, FrontendMiddlewareDisabled)
+	f.StringVar(&l.FrontendStepAlign, "frontend.step-align", "", "Per-tenant toggle of the query-frontend alignment of the queries with their step. "+toggleHelp+" -querier.align-querier-with-step.")
+	f.BoolVar(&l.DisableStepAlignment, "frontend.disable-step-alignment", false, "Opt the tenant out of the query-frontend alignment of the queries with their step, which moves their start and end back to a multiple of the step. Takes precedence over -frontend.step-align.")
+	f.StringVar(&l.FrontendSplitQueries, "frontend.split-queries", "", "Per-tenant toggle of the query-frontend split of the queries by interval. "+toggleHelp+" -querier.split-queries-by-interval. Enabling it requires a split interval.")
+	f.Var(&l.FrontendSplitQueriesByInterval, "frontend.split-queries-by-interval", "Per-tenant interval the query-frontend splits the queries by. 0 to use -querier.split-queries-by-interval.")
+	f.StringVar(&l.SplitQueriesTimezone, "frontend.split-queries-timezone", "", "Per-tenant IANA timezone name (eg. Europe/Rome) whose midnights the query-frontend aligns the split queries to. The results cache entries are not shared between timezones. Empty to use UTC.")
+	f.StringVar(&l.FrontendResultsCache, "frontend.results-cache", "", "Per-tenant toggle of the query-frontend results cache. "+toggleHelp+" -querier.cache-results. It can be enabled only if the results cache is configured.")
+	f.StringVar(&l.FrontendQuerySharding, "frontend.query-sharding", "", "Deprecated: use the query_sharding feature flag of -limits.feature-flags instead, which takes precedence. Per-tenant toggle of the query-frontend query sharding. "+toggleHelp+" -querier.parallelise-shardable-queries. It can be enabled only if the query sharding is enabled in the query-frontend configuration.")
+	f.StringVar(&l.FrontendRetries, "frontend.retries", "", "Per-tenant toggle of the query-frontend retries of the failed queries. "+toggleHelp+" -querier.max-retries-per-request. Enabling it requires a number of max retries.")
+	f.IntVar(&l.FrontendMaxRetries, "frontend.max-retries-per-request", 0, "Per-tenant max number of retries of the failed queries in the query-frontend. 0 to use -querier.max-retries-per-request.")
+	f.StringVar(&l.FrontendDownsampling, "frontend.downsampling", "", "Per-tenant toggle of the ingesters downsampling of the series queried by the range queries compatible with it. "+toggleHelp+" -querier.downsampling-min-step. Supported only by the blocks storage.")
+	f.BoolVar(&l.QueryStatsHeaderEnabled, "frontend.query-stats-header-enabled", false, "Return the statistics of the queries in the X-Cortex-Query-Stats response header. Requires -frontend.query-stats-enabled.")
+	f.IntVar(&l.QueryVerticalShardSize, "frontend.query-vertical-shard-size", 0, "Per-tenant number of vertical shards the query-frontend splits the shardable aggregations of the range queries into (sum, count, min and max, by or without labels). The shardable aggregations combined by histogram_quantile() or by binary expressions matching the series on labels kept by both sides are sharded too. The shards select the series by the hash of their labels, filtered by the ingesters and the store-gateways, and are executed in parallel and merged by the query-frontend. The ingesters and the store-gateways must be upgraded before enabling it. 0 or 1 to disable.")
+	f.Float64Var(&l.QueryAuditSampleRatio, "frontend.query-audit.sample-ratio", 0, "Per-tenant ratio (0-1) of the completed queries whose audit record is posted to the -frontend.query-audit.webhook-url. 0 to disable.")
+	f.StringVar(&l.QueryAuditWebhookURL, "frontend.query-audit.webhook-url", "", "Per-tenant URL of the webhook the query-frontend posts the batches of sampled query audit records to, as a JSON array. Empty to disable.")
+	f.Var(&l.QueryAuditFields, "frontend.query-audit.fields", "Comma-separated list of the fields included in the per-tenant query audit records. Supported values are: "+strings.Join(QueryAuditFields, ", ")+". Empty to include all of them.")
+	f.IntVar(&l.QueryPriority, "query-scheduler.query-priority", 0, "Per-tenant priority of the queries in the query-scheduler queue. The queries with a higher priority are dequeued first, while each priority with queued queries is guaranteed the -query-scheduler.query-priority-min-share of the dequeued queries. It can be lowered per query with the X-Cortex-Query-Priority request header, down to 0.")
+
 	f.Var(&l.RulerEvaluationDelay, "ruler.evaluation-delay-duration", "Duration to delay the evaluation of rules to ensure the underlying metrics have been pushed to Cortex.")
 	f.IntVar(&l.RulerTenantShardSize, "ruler.tenant-shard-size", 0, "The default tenant's shard size when the shuffle-sharding strategy is used by ruler. When this setting is specified in the per-tenant overrides, a value of 0 disables shuffle sharding for the tenant.")
 	f.IntVar(&l.RulerMaxRulesPerRuleGroup, "ruler.max-rules-per-rule-group", 0, "Maximum number of rules per rule group per-tenant. 0 to disable.")
 	f.IntVar(&l.RulerMaxRuleGroupsPerTenant, "ruler.max-rule-groups-per-tenant", 0, "Maximum number of rule groups per-tenant. 0 to disable.")
+	f.IntVar(&l.RulerNotificationQueueCapacity, "ruler.tenant-notification-queue-capacity", 0, "Capacity of the per-tenant queue for notifications to be sent to the Alertmanager. 0 to use the -ruler.notification-queue-capacity value.")
+	f.Var(&l.RulerAllowedSourceTenants, "ruler.allowed-source-tenant", "Tenant whose series can be queried by the federated rule groups of the tenant, listing it in their source_tenants. Can be repeated in order to allow multiple tenants. Set to * to allow any tenant. The tenant itself is always allowed.")
+	f.IntVar(&l.RulerMaxRulesPerTenant, "ruler.max-rules-per-tenant", 0, "Maximum number of rules across all the rule groups per-tenant. The rule groups exceeding the ruler limits are skipped by the ruler, in namespace and name order. 0 to disable.")
+	if l.RulerExternalLabels == nil {
+		l.RulerExternalLabels = LabelsMap{}
+	}
+	f.Var(&l.RulerExternalLabels, "ruler.external-labels", "Per-tenant labels added to the alerts sent by the ruler to the Alertmanager. Value is a map, where each key is a label name and value is the label value. On command line, this map is given in JSON format.")
+	f.StringVar(&l.RulerExternalURL, "ruler.tenant-external-url", "", "Per-tenant URL of the alerts sent by the ruler to the Alertmanager, used for the generator URL of the alerts and the external URL of the alert templates. Empty to use the -ruler.external.url value.")
+	f.BoolVar(&l.RulerProtectExistingMetrics, "ruler.protect-existing-metrics", false, "Reject the rule groups whose recording rules record a metric colliding with existing series not written by the ruler, when stored through the ruler API. The rule groups already stored are periodically checked, and their colliding recording rules are reported as degraded by the rules API. Requires -ruler.metric-provenance.inject-rule-group-label.")
+	f.Float64Var(&l.RulerDeliveryTraceSampleRatio, "ruler.delivery-trace-sample-ratio", 0, "Share of the alert notifications sent by the ruler to the Alertmanager with a delivery trace ID, between 0 and 1. The trace ID is added to the alert in the cortex_delivery_trace_id annotation, and logged by the ruler and the Alertmanager along with the alert fingerprint, to correlate the alert evaluation with its delivery to the receivers. 0 to disable.")
 
 	f.Var(&l.CompactorBlocksRetentionPeriod, "compactor.blocks-retention-period", "Delete blocks containing samples older than the specified retention period. 0 to disable.")
+	f.Var(&l.CompactorBlocksDeletionDelay, "compactor.blocks-deletion-delay", "Per-tenant override of -compactor.deletion-delay, the time before a block marked for deletion is deleted from the bucket. Like -compactor.deletion-delay, it must be longer than the time the queriers and store-gateways take to discover the compacted blocks replacing the deleted ones, that is -compactor.cleanup-interval, which updates the bucket index, plus -blocks-storage.bucket-store.sync-interval, and longer than -blocks-storage.bucket-store.ignore-deletion-marks-delay, otherwise the queries may fail. 0 to use -compactor.deletion-delay.")
 
 	// Store-gateway.
 	f.IntVar(&l.StoreGatewayTenantShardSize, "store-gateway.tenant-shard-size", 0, "The default tenant's shard size when the shuffle-sharding strategy is used. Must be set when the store-gateway sharding is enabled with the shuffle-sharding strategy. When this setting is specified in the per-tenant overrides, a value of 0 disables shuffle sharding for the tenant.")
@@ -175,6 +375,9 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	// Alertmanager.
 	f.Var(&l.AlertmanagerReceiversBlockCIDRNetworks, "alertmanager.receivers-firewall-block-cidr-networks", "Comma-separated list of network CIDRs to block in Alertmanager receiver integrations.")
 	f.BoolVar(&l.AlertmanagerReceiversBlockPrivateAddresses, "alertmanager.receivers-firewall-block-private-addresses", false, "True to block private and local addresses in Alertmanager receiver integrations. It blocks private addresses defined by  RFC 1918 (IPv4 addresses) and RFC 4193 (IPv6 addresses), as well as loopback, local unicast and local multicast addresses.")
+	f.Var(&l.AlertmanagerReceiversAllowCIDRNetworks, "alertmanager.receivers-firewall-allow-cidr-networks", "Comma-separated list of network CIDRs to allow in Alertmanager receiver integrations, even if blocked by the other firewall rules.")
+	f.Var(&l.AlertmanagerReceiversBlockHostnames, "alertmanager.receivers-firewall-block-hostnames", "Comma-separated list of hostnames to block in Alertmanager receiver integrations. A hostname starting with '*.' blocks its subdomains. The hostnames are checked before the DNS resolution, while the addresses they resolve to are checked against the other firewall rules when connecting.")
+	f.Var(&l.AlertmanagerReceiversAllowHostnames, "alertmanager.receivers-firewall-allow-hostnames", "Comma-separated list of hostnames to allow in Alertmanager receiver integrations, even if blocked by the other firewall rules, whatever address they resolve to. A hostname starting with '*.' allows its subdomains.")
 
 	f.Float64Var(&l.NotificationRateLimit, "alertmanager.notification-rate-limit", 0, "Per-user rate limit for sending notifications from Alertmanager in notifications/sec. 0 = rate limit disabled. Negative value = no notifications are allowed.")
 
@@ -182,12 +385,19 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 		l.NotificationRateLimitPerIntegration = NotificationRateLimitMap{}
 	}
 	f.Var(&l.NotificationRateLimitPerIntegration, "alertmanager.notification-rate-limit-per-integration", "Per-integration notification rate limits. Value is a map, where each key is integration name and value is a rate-limit (float). On command line, this map is given in JSON format. Rate limit has the same meaning as -alertmanager.notification-rate-limit, but only applies for specific integration. Allowed integration names: "+strings.Join(allowedIntegrationNames, ", ")+".")
-	f.IntVar(&l.AlertmanagerMaxConfigSizeBytes, "alertmanager.max-config-size-bytes", 0, "Maximum size of configuration file for Alertmanager that tenant can upload via Alertmanager API. 0 = no limit.")
-	f.IntVar(&l.AlertmanagerMaxTemplatesCount, "alertmanager.max-templates-count", 0, "Maximum number of templates in tenant's Alertmanager configuration uploaded via Alertmanager API. 0 = no limit.")
-	f.IntVar(&l.AlertmanagerMaxTemplateSizeBytes, "alertmanager.max-template-size-bytes", 0, "Maximum size of single template in tenant's Alertmanager configuration uploaded via Alertmanager API. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerMaxConfigSizeBytes, "alertmanager.max-config-size-bytes", 0, "Maximum size of configuration file for Alertmanager that tenant can upload via Alertmanager API. Configurations loaded from the store are checked too, and the last working configuration is kept when they exceed it. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerMaxTemplatesCount, "alertmanager.max-templates-count", 0, "Maximum number of templates in tenant's Alertmanager configuration uploaded via Alertmanager API. Configurations loaded from the store are checked too, and the last working configuration is kept when they exceed it. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerMaxTemplateSizeBytes, "alertmanager.max-template-size-bytes", 0, "Maximum size of single template in tenant's Alertmanager configuration uploaded via Alertmanager API. Configurations loaded from the store are checked too, and the last working configuration is kept when they exceed it. 0 = no limit.")
 	f.IntVar(&l.AlertmanagerMaxDispatcherAggregationGroups, "alertmanager.max-dispatcher-aggregation-groups", 0, "Maximum number of aggregation groups in Alertmanager's dispatcher that a tenant can have. Each active aggregation group uses single goroutine. When the limit is reached, dispatcher will not dispatch alerts that belong to additional aggregation groups, but existing groups will keep working properly. 0 = no limit.")
-	f.IntVar(&l.AlertmanagerMaxAlertsCount, "alertmanager.max-alerts-count", 0, "Maximum number of alerts that a single user can have. Inserting more alerts will fail with a log message and metric increment. 0 = no limit.")
-	f.IntVar(&l.AlertmanagerMaxAlertsSizeBytes, "alertmanager.max-alerts-size-bytes", 0, "Maximum total size of alerts that a single user can have, alert size is the sum of the bytes of its labels, annotations and generatorURL. Inserting more alerts will fail with a log message and metric increment. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerMaxAlertsCount, "alertmanager.max-alerts-count", 0, "Maximum number of alerts that a single user can have. Inserting more alerts will fail with a log message and metric increment, and the requests posting them via the Alertmanager API are rejected with a 400 status code. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerMaxAlertsSizeBytes, "alertmanager.max-alerts-size-bytes", 0, "Maximum total size of alerts that a single user can have, alert size is the sum of the bytes of its labels, annotations and generatorURL. Inserting more alerts will fail with a log message and metric increment, and the requests posting them via the Alertmanager API are rejected with a 400 status code. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerMaxSilencesCount, "alertmanager.max-silences-count", 0, "Maximum number of active and pending silences that a single user can have. Creating more silences via the Alertmanager API fails with a 400 status code, while the existing silences are kept. 0 = no limit.")
+	f.IntVar(&l.AlertmanagerMaxSilenceSizeBytes, "alertmanager.max-silence-size-bytes", 0, "Maximum size of a single silence, silence size is the sum of the bytes of its matchers, comment and creator. Creating or updating a bigger silence via the Alertmanager API fails with a 400 status code. 0 = no limit.")
+
+	if l.FeatureFlags == nil {
+		l.FeatureFlags = FeatureFlagsMap{}
+	}
+	f.Var(&l.FeatureFlags, "limits.feature-flags", "Per-tenant feature flags. Value is a map, where each key is a feature flag name and value is whether the feature is enabled. On command line, this map is given in JSON format. The features whose flag is not set keep their default behavior. Known feature flags: "+featureFlagsHelp()+".")
 }
 
 // Validate the limits config and returns an error if the validation
@@ -199,9 +409,64 @@ func (l *Limits) Validate(shardByAllLabels bool) error {
 		return errMaxGlobalSeriesPerUserValidation
 	}
 
+	if l.ShadowWritePercent < 0 || l.ShadowWritePercent > 100 {
+		return errInvalidShadowWritePercent
+	}
+
+	for _, toggle := range []string{l.FrontendStepAlign, l.FrontendSplitQueries, l.FrontendResultsCache, l.FrontendQuerySharding, l.FrontendRetries, l.FrontendDownsampling} {
+		if toggle != "" && toggle != FrontendMiddlewareEnabled && toggle != FrontendMiddlewareDisabled {
+			return errInvalidFrontendMiddlewareToggle
+		}
+	}
+
+	if _, err := time.LoadLocation(l.SplitQueriesTimezone); err != nil {
+		return fmt.Errorf("invalid split queries timezone: %w", err)
+	}
+
+	for _, mode := range []string{l.MaxLabelNameLengthMode, l.MaxLabelValueLengthMode, l.MaxLabelNamesPerSeriesMode, l.RequiredLabelNamesMode} {
+		if mode != "" && mode != ValidationModeEnforce && mode != ValidationModeWarn {
+			return errInvalidValidationMode
+		}
+	}
+
+	switch l.NaNHandling {
+	case "", NaNHandlingKeep, NaNHandlingDropAll, NaNHandlingDropStaleOnly:
+		// valid
+	default:
+		return errInvalidNaNHandling
+	}
+
+	if l.QueryAuditSampleRatio < 0 || l.QueryAuditSampleRatio > 1 {
+		return errInvalidQueryAuditSampleRatio
+	}
+
+	if l.ShadowLimitsLogSampleRatio < 0 || l.ShadowLimitsLogSampleRatio > 1 {
+		return errInvalidShadowLimitsLogSampleRatio
+	}
+	for _, field := range l.QueryAuditFields {
+		if !isQueryAuditField(field) {
+			return errInvalidQueryAuditField
+		}
+	}
+
+	if l.RulerExternalURL != "" {
+		if _, err := url.Parse(l.RulerExternalURL); err != nil {
+			return errInvalidRulerExternalURL
+		}
+	}
+
 	return nil
 }
 
+func isQueryAuditField(field string) bool {
+	for _, f := range QueryAuditFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
 func (l *Limits) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// We want to set l to the defaults and then overwrite it with the input.
@@ -213,6 +478,8 @@ func (l *Limits) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		*l = *defaultLimits
 		// Make copy of default limits. Otherwise unmarshalling would modify map in default limits.
 		l.copyNotificationIntegrationLimits(defaultLimits.NotificationRateLimitPerIntegration)
+		l.copyFeatureFlags(defaultLimits.FeatureFlags)
+		l.copyRulerExternalLabels(defaultLimits.RulerExternalLabels)
 	}
 	type plain Limits
 	return unmarshal((*plain)(l))
@@ -227,6 +494,8 @@ func (l *Limits) UnmarshalJSON(data []byte) error {
 		*l = *defaultLimits
 		// Make copy of default limits. Otherwise unmarshalling would modify map in default limits.
 		l.copyNotificationIntegrationLimits(defaultLimits.NotificationRateLimitPerIntegration)
+		l.copyFeatureFlags(defaultLimits.FeatureFlags)
+		l.copyRulerExternalLabels(defaultLimits.RulerExternalLabels)
 	}
 
 	type plain Limits
@@ -280,13 +549,21 @@ func NewOverrides(defaults Limits, tenantLimits TenantLimits) (*Overrides, error
 	}, nil
 }
 
+// ForUser returns the overrides with the limits of the given user resolved once, for the
+// limits looked up repeatedly within a request. The returned overrides return the limits
+// of the given user whatever the user they're called with.
+func (o *Overrides) ForUser(userID string) *Overrides {
+	return &Overrides{defaultLimits: o.getOverridesForUser(userID)}
+}
+
 // IngestionRate returns the limit on ingester rate (samples per second).
 func (o *Overrides) IngestionRate(userID string) float64 {
 	return o.getOverridesForUser(userID).IngestionRate
 }
 
 // IngestionRateStrategy returns whether the ingestion rate limit should be individually applied
-// to each distributor instance (local) or evenly shared across the cluster (global).
+// to each distributor instance (local), evenly shared across the cluster (global) or shared
+// proportionally to the recent usage of each distributor (global-coordinated).
 func (o *Overrides) IngestionRateStrategy() string {
 	// The ingestion rate strategy can't be overridden on a per-tenant basis
 	return o.defaultLimits.IngestionRateStrategy
@@ -317,6 +594,17 @@ func (o *Overrides) DropLabels(userID string) flagext.StringSlice {
 	return o.getOverridesForUser(userID).DropLabels
 }
 
+// AllowedLabelNames returns the list of label names allowed in the series ingested for the user.
+// An empty list allows all label names.
+func (o *Overrides) AllowedLabelNames(userID string) flagext.StringSlice {
+	return o.getOverridesForUser(userID).AllowedLabelNames
+}
+
+// AllowedLabelNamesAction returns what to do with series with label names not allowed for the user.
+func (o *Overrides) AllowedLabelNamesAction(userID string) string {
+	return o.getOverridesForUser(userID).AllowedLabelNamesAction
+}
+
 // MaxLabelNameLength returns maximum length a label name can be.
 func (o *Overrides) MaxLabelNameLength(userID string) int {
 	return o.getOverridesForUser(userID).MaxLabelNameLength
@@ -333,6 +621,77 @@ func (o *Overrides) MaxLabelNamesPerSeries(userID string) int {
 	return o.getOverridesForUser(userID).MaxLabelNamesPerSeries
 }
 
+// MaxLabelNameLengthMode returns the enforcement mode of the max label name length.
+func (o *Overrides) MaxLabelNameLengthMode(userID string) string {
+	return o.getOverridesForUser(userID).MaxLabelNameLengthMode
+}
+
+// MaxLabelValueLengthMode returns the enforcement mode of the max label value length.
+func (o *Overrides) MaxLabelValueLengthMode(userID string) string {
+	return o.getOverridesForUser(userID).MaxLabelValueLengthMode
+}
+
+// MaxLabelNamesPerSeriesMode returns the enforcement mode of the max number of label names per series.
+func (o *Overrides) MaxLabelNamesPerSeriesMode(userID string) string {
+	return o.getOverridesForUser(userID).MaxLabelNamesPerSeriesMode
+}
+
+// ShadowMaxLabelNameLength returns the shadow limit of the max label name length, 0 if disabled.
+func (o *Overrides) ShadowMaxLabelNameLength(userID string) int {
+	return o.getOverridesForUser(userID).ShadowMaxLabelNameLength
+}
+
+// ShadowMaxLabelValueLength returns the shadow limit of the max label value length, 0 if disabled.
+func (o *Overrides) ShadowMaxLabelValueLength(userID string) int {
+	return o.getOverridesForUser(userID).ShadowMaxLabelValueLength
+}
+
+// ShadowMaxLabelNamesPerSeries returns the shadow limit of the max number of label names per series, 0 if disabled.
+func (o *Overrides) ShadowMaxLabelNamesPerSeries(userID string) int {
+	return o.getOverridesForUser(userID).ShadowMaxLabelNamesPerSeries
+}
+
+// ShadowLimitsLogSampleRatio returns the ratio of the series which would be discarded by the shadow limits which are logged.
+func (o *Overrides) ShadowLimitsLogSampleRatio(userID string) float64 {
+	return o.getOverridesForUser(userID).ShadowLimitsLogSampleRatio
+}
+
+// RequiredLabelNames returns the label names required in the series ingested for the user.
+func (o *Overrides) RequiredLabelNames(userID string) []string {
+	return o.getOverridesForUser(userID).RequiredLabelNames
+}
+
+// RequiredLabelNamesMode returns the enforcement mode of the required label names.
+func (o *Overrides) RequiredLabelNamesMode(userID string) string {
+	return o.getOverridesForUser(userID).RequiredLabelNamesMode
+}
+
+// RejectSelectorsWithoutRequiredLabels returns whether the queries with a selector which can only match
+// the series missing a required label are rejected for the user.
+func (o *Overrides) RejectSelectorsWithoutRequiredLabels(userID string) bool {
+	return o.getOverridesForUser(userID).RejectSelectorsWithoutRequiredLabels
+}
+
+// ValidationWarningsHeader returns whether the push requests are responded with the validation warnings header.
+func (o *Overrides) ValidationWarningsHeader(userID string) bool {
+	return o.getOverridesForUser(userID).ValidationWarningsHeader
+}
+
+// MaxExemplarsPerSecond returns the limit on the exemplars ingestion rate (exemplars per second).
+func (o *Overrides) MaxExemplarsPerSecond(userID string) float64 {
+	return o.getOverridesForUser(userID).MaxExemplarsPerSecond
+}
+
+// MaxExemplarLabels returns maximum number of label names an exemplar can have.
+func (o *Overrides) MaxExemplarLabels(userID string) int {
+	return o.getOverridesForUser(userID).MaxExemplarLabels
+}
+
+// MaxExemplarLabelValueLength returns maximum length an exemplar label value can be.
+func (o *Overrides) MaxExemplarLabelValueLength(userID string) int {
+	return o.getOverridesForUser(userID).MaxExemplarLabelValueLength
+}
+
 // MaxMetadataLength returns maximum length metadata can be. Metadata refers
 // to the Metric Name, HELP and UNIT.
 func (o *Overrides) MaxMetadataLength(userID string) int {
@@ -402,6 +761,31 @@ func (o *Overrides) MaxChunksPerQuery(userID string) int {
 	return o.getOverridesForUser(userID).MaxChunksPerQuery
 }
 
+// MaxChunksPerColdQuery returns the maximum number of chunks allowed per query reading the cold blocks.
+func (o *Overrides) MaxChunksPerColdQuery(userID string) int {
+	if value := o.getOverridesForUser(userID).MaxChunksPerColdQuery; value > 0 {
+		return value
+	}
+
+	return o.MaxChunksPerQuery(userID)
+}
+
+// MaxChunksPerColdQueryFromStore returns the maximum number of chunks allowed per query reading the
+// cold blocks, when fetching chunks from the long-term storage.
+func (o *Overrides) MaxChunksPerColdQueryFromStore(userID string) int {
+	if value := o.getOverridesForUser(userID).MaxChunksPerColdQuery; value > 0 {
+		return value
+	}
+
+	return o.MaxChunksPerQueryFromStore(userID)
+}
+
+// MaxEstimatedFetchedSeriesPerQuery returns the maximum number of series a query can touch in the
+// blocks storage, as estimated from the blocks stats.
+func (o *Overrides) MaxEstimatedFetchedSeriesPerQuery(userID string) int {
+	return o.getOverridesForUser(userID).MaxEstimatedFetchedSeriesPerQuery
+}
+
 // MaxFetchedSeriesPerQuery returns the maximum number of series allowed per query when fetching
 // chunks from ingesters and blocks storage.
 func (o *Overrides) MaxFetchedSeriesPerQuery(userID string) int {
@@ -414,6 +798,27 @@ func (o *Overrides) MaxFetchedChunkBytesPerQuery(userID string) int {
 	return o.getOverridesForUser(userID).MaxFetchedChunkBytesPerQuery
 }
 
+// CardinalityAnalysisMaxLimit returns the maximum number of label names or label values which
+// can be requested to the cardinality analysis API endpoints.
+func (o *Overrides) CardinalityAnalysisMaxLimit(userID string) int {
+	return o.getOverridesForUser(userID).CardinalityAnalysisMaxLimit
+}
+
+// PrefetchRequestsRateLimit returns the per-tenant rate limit of the prefetch requests.
+func (o *Overrides) PrefetchRequestsRateLimit(userID string) float64 {
+	return o.getOverridesForUser(userID).PrefetchRequestsRateLimit
+}
+
+// PrefetchRequestsBurstSize returns the per-tenant burst size of the prefetch requests.
+func (o *Overrides) PrefetchRequestsBurstSize(userID string) int {
+	return o.getOverridesForUser(userID).PrefetchRequestsBurstSize
+}
+
+// PartialResultsOnTimeout returns whether the queries about to time out should return partial results.
+func (o *Overrides) PartialResultsOnTimeout(userID string) bool {
+	return o.getOverridesForUser(userID).PartialResultsOnTimeout
+}
+
 // MaxQueryLookback returns the max lookback period of queries.
 func (o *Overrides) MaxQueryLookback(userID string) time.Duration {
 	return time.Duration(o.getOverridesForUser(userID).MaxQueryLookback)
@@ -430,6 +835,116 @@ func (o *Overrides) MaxCacheFreshness(userID string) time.Duration {
 	return time.Duration(o.getOverridesForUser(userID).MaxCacheFreshness)
 }
 
+// FrontendStepAlign returns the per-tenant toggle of the query-frontend step alignment, which is
+// disabled for the tenants opted out of it.
+func (o *Overrides) FrontendStepAlign(userID string) string {
+	limits := o.getOverridesForUser(userID)
+	if limits.DisableStepAlignment {
+		return FrontendMiddlewareDisabled
+	}
+	return limits.FrontendStepAlign
+}
+
+// FrontendSplitQueries returns the per-tenant toggle of the query-frontend split by interval.
+func (o *Overrides) FrontendSplitQueries(userID string) string {
+	return o.getOverridesForUser(userID).FrontendSplitQueries
+}
+
+// FrontendSplitQueriesByInterval returns the per-tenant interval the query-frontend splits the queries by.
+func (o *Overrides) FrontendSplitQueriesByInterval(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).FrontendSplitQueriesByInterval)
+}
+
+// FrontendResultsCache returns the per-tenant toggle of the query-frontend results cache.
+func (o *Overrides) FrontendResultsCache(userID string) string {
+	return o.getOverridesForUser(userID).FrontendResultsCache
+}
+
+// FrontendQuerySharding returns the per-tenant toggle of the query-frontend query sharding, from the
+// query_sharding feature flag or the deprecated frontend_query_sharding limit.
+func (o *Overrides) FrontendQuerySharding(userID string) string {
+	enabled, ok := o.FeatureFlag(userID, FeatureQuerySharding)
+	switch {
+	case !ok:
+		return ""
+	case enabled:
+		return FrontendMiddlewareEnabled
+	default:
+		return FrontendMiddlewareDisabled
+	}
+}
+
+// FrontendRetries returns the per-tenant toggle of the query-frontend retries.
+func (o *Overrides) FrontendRetries(userID string) string {
+	return o.getOverridesForUser(userID).FrontendRetries
+}
+
+// FrontendMaxRetries returns the per-tenant max number of retries of the failed queries in the query-frontend.
+func (o *Overrides) FrontendMaxRetries(userID string) int {
+	return o.getOverridesForUser(userID).FrontendMaxRetries
+}
+
+// FrontendDownsampling returns the per-tenant toggle of the ingesters downsampling signaled by the query-frontend.
+func (o *Overrides) FrontendDownsampling(userID string) string {
+	return o.getOverridesForUser(userID).FrontendDownsampling
+}
+
+// SplitQueriesTimezone returns the IANA name of the timezone the query-frontend aligns the split queries to,
+// or an empty string for UTC.
+func (o *Overrides) SplitQueriesTimezone(userID string) string {
+	return o.getOverridesForUser(userID).SplitQueriesTimezone
+}
+
+// QueryVerticalShardSize returns the per-tenant number of vertical shards the query-frontend splits the
+// shardable aggregations into.
+func (o *Overrides) QueryVerticalShardSize(userID string) int {
+	return o.getOverridesForUser(userID).QueryVerticalShardSize
+}
+
+// QueryPriority returns the priority of the tenant's queries in the query-scheduler queue.
+func (o *Overrides) QueryPriority(userID string) int {
+	return o.getOverridesForUser(userID).QueryPriority
+}
+
+// FeatureFlag returns whether the feature is enabled for the user, and whether its feature flag is set.
+func (o *Overrides) FeatureFlag(userID, name string) (enabled, ok bool) {
+	return o.getOverridesForUser(userID).FeatureFlag(name)
+}
+
+// FeatureEnabled returns whether the feature is enabled for the user, or the default value if its
+// feature flag is not set.
+func (o *Overrides) FeatureEnabled(userID, name string, defaultValue bool) bool {
+	if enabled, ok := o.FeatureFlag(userID, name); ok {
+		return enabled
+	}
+	return defaultValue
+}
+
+// ExemplarsEnabled returns whether the exemplars of the user are ingested.
+func (o *Overrides) ExemplarsEnabled(userID string) bool {
+	return o.FeatureEnabled(userID, FeatureExemplars, true)
+}
+
+// QueryStatsHeaderEnabled returns whether the query-frontend returns the statistics of the queries in the response header.
+func (o *Overrides) QueryStatsHeaderEnabled(userID string) bool {
+	return o.getOverridesForUser(userID).QueryStatsHeaderEnabled
+}
+
+// QueryAuditSampleRatio returns the ratio of the queries of a given user whose audit record is posted to the webhook.
+func (o *Overrides) QueryAuditSampleRatio(userID string) float64 {
+	return o.getOverridesForUser(userID).QueryAuditSampleRatio
+}
+
+// QueryAuditWebhookURL returns the URL of the webhook the query audit records of a given user are posted to.
+func (o *Overrides) QueryAuditWebhookURL(userID string) string {
+	return o.getOverridesForUser(userID).QueryAuditWebhookURL
+}
+
+// QueryAuditFields returns the fields included in the query audit records of a given user.
+func (o *Overrides) QueryAuditFields(userID string) []string {
+	return o.getOverridesForUser(userID).QueryAuditFields
+}
+
 // MaxQueriersPerUser returns the maximum number of queriers that can handle requests for this user.
 func (o *Overrides) MaxQueriersPerUser(userID string) int {
 	return o.getOverridesForUser(userID).MaxQueriersPerTenant
@@ -481,6 +996,42 @@ func (o *Overrides) MaxGlobalMetadataPerMetric(userID string) int {
 	return o.getOverridesForUser(userID).MaxGlobalMetadataPerMetric
 }
 
+// NaNHandling returns how the ingesters handle the NaN samples pushed by a given user.
+func (o *Overrides) NaNHandling(userID string) string {
+	return o.getOverridesForUser(userID).NaNHandling
+}
+
+// TSDBBlockRanges returns the TSDB block ranges of a given user, or an empty list to use the
+// blocks storage config.
+func (o *Overrides) TSDBBlockRanges(userID string) cortex_tsdb.DurationList {
+	return o.getOverridesForUser(userID).TSDBBlockRanges
+}
+
+// RequireMetricMetadata returns whether the samples of the metrics without metadata are rejected for a given user.
+func (o *Overrides) RequireMetricMetadata(userID string) bool {
+	return o.getOverridesForUser(userID).RequireMetricMetadata
+}
+
+// MetricMetadataGracePeriod returns how long the samples of a metric without metadata are accepted for a given user.
+func (o *Overrides) MetricMetadataGracePeriod(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).MetricMetadataGracePeriod)
+}
+
+// MaxRequestBodySize returns the max size of the uncompressed body of the push requests for a given user.
+func (o *Overrides) MaxRequestBodySize(userID string) int {
+	return o.getOverridesForUser(userID).MaxRequestBodySize
+}
+
+// ShadowWriteEndpoint returns the remote-write URL to which the write requests of a given user are forwarded.
+func (o *Overrides) ShadowWriteEndpoint(userID string) string {
+	return o.getOverridesForUser(userID).ShadowWriteEndpoint
+}
+
+// ShadowWritePercent returns the percentage of the write requests of a given user forwarded to the shadow endpoint.
+func (o *Overrides) ShadowWritePercent(userID string) float64 {
+	return o.getOverridesForUser(userID).ShadowWritePercent
+}
+
 // IngestionTenantShardSize returns the ingesters shard size for a given user.
 func (o *Overrides) IngestionTenantShardSize(userID string) int {
 	return o.getOverridesForUser(userID).IngestionTenantShardSize
@@ -496,6 +1047,12 @@ func (o *Overrides) CompactorBlocksRetentionPeriod(userID string) time.Duration
 	return time.Duration(o.getOverridesForUser(userID).CompactorBlocksRetentionPeriod)
 }
 
+// CompactorBlocksDeletionDelay returns the deletion delay of the blocks marked for deletion for a given user.
+// It returns 0 when the user has no override, in which case the compactor's deletion delay applies.
+func (o *Overrides) CompactorBlocksDeletionDelay(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).CompactorBlocksDeletionDelay)
+}
+
 // MetricRelabelConfigs returns the metric relabel configs for a given user.
 func (o *Overrides) MetricRelabelConfigs(userID string) []*relabel.Config {
 	return o.getOverridesForUser(userID).MetricRelabelConfigs
@@ -516,6 +1073,43 @@ func (o *Overrides) RulerMaxRuleGroupsPerTenant(userID string) int {
 	return o.getOverridesForUser(userID).RulerMaxRuleGroupsPerTenant
 }
 
+// RulerNotificationQueueCapacity returns the capacity of the queue for notifications to be sent to the Alertmanager for a given user.
+func (o *Overrides) RulerNotificationQueueCapacity(userID string) int {
+	return o.getOverridesForUser(userID).RulerNotificationQueueCapacity
+}
+
+// RulerAllowedSourceTenants returns the tenants which can be queried by the federated rule groups of a given user.
+func (o *Overrides) RulerAllowedSourceTenants(userID string) []string {
+	return o.getOverridesForUser(userID).RulerAllowedSourceTenants
+}
+
+// RulerMaxRulesPerTenant returns the maximum number of rules across all the rule groups of a given user.
+func (o *Overrides) RulerMaxRulesPerTenant(userID string) int {
+	return o.getOverridesForUser(userID).RulerMaxRulesPerTenant
+}
+
+// RulerExternalLabels returns the labels added to the alerts sent by the ruler for a given user.
+func (o *Overrides) RulerExternalLabels(userID string) labels.Labels {
+	return o.getOverridesForUser(userID).RulerExternalLabels.Labels()
+}
+
+// RulerExternalURL returns the external URL of the alerts sent by the ruler for a given user,
+// or an empty string to use the ruler one.
+func (o *Overrides) RulerExternalURL(userID string) string {
+	return o.getOverridesForUser(userID).RulerExternalURL
+}
+
+// RulerProtectExistingMetrics returns whether the recording rules colliding with series not
+// written by the ruler are rejected for a given user.
+func (o *Overrides) RulerProtectExistingMetrics(userID string) bool {
+	return o.getOverridesForUser(userID).RulerProtectExistingMetrics
+}
+
+// RulerDeliveryTraceSampleRatio returns the share of the alert notifications sent by the ruler with a delivery trace ID.
+func (o *Overrides) RulerDeliveryTraceSampleRatio(userID string) float64 {
+	return o.getOverridesForUser(userID).RulerDeliveryTraceSampleRatio
+}
+
 // StoreGatewayTenantShardSize returns the store-gateway shard size for a given user.
 func (o *Overrides) StoreGatewayTenantShardSize(userID string) int {
 	return o.getOverridesForUser(userID).StoreGatewayTenantShardSize
@@ -541,6 +1135,11 @@ func (o *Overrides) S3SSEKMSEncryptionContext(user string) string {
 	return o.getOverridesForUser(user).S3SSEKMSEncryptionContext
 }
 
+// ClientSideEncryptionKeyID returns the per-tenant client-side encryption key ID.
+func (o *Overrides) ClientSideEncryptionKeyID(user string) string {
+	return o.getOverridesForUser(user).ClientSideEncryptionKeyID
+}
+
 // AlertmanagerReceiversBlockCIDRNetworks returns the list of network CIDRs that should be blocked
 // in the Alertmanager receivers for the given user.
 func (o *Overrides) AlertmanagerReceiversBlockCIDRNetworks(user string) []flagext.CIDR {
@@ -553,6 +1152,24 @@ func (o *Overrides) AlertmanagerReceiversBlockPrivateAddresses(user string) bool
 	return o.getOverridesForUser(user).AlertmanagerReceiversBlockPrivateAddresses
 }
 
+// AlertmanagerReceiversAllowCIDRNetworks returns the list of network CIDRs that should be allowed
+// in the Alertmanager receivers for the given user, even if blocked by the other rules.
+func (o *Overrides) AlertmanagerReceiversAllowCIDRNetworks(user string) []flagext.CIDR {
+	return o.getOverridesForUser(user).AlertmanagerReceiversAllowCIDRNetworks
+}
+
+// AlertmanagerReceiversBlockHostnames returns the list of hostnames that should be blocked
+// in the Alertmanager receivers for the given user.
+func (o *Overrides) AlertmanagerReceiversBlockHostnames(user string) []string {
+	return o.getOverridesForUser(user).AlertmanagerReceiversBlockHostnames
+}
+
+// AlertmanagerReceiversAllowHostnames returns the list of hostnames that should be allowed
+// in the Alertmanager receivers for the given user, even if blocked by the other rules.
+func (o *Overrides) AlertmanagerReceiversAllowHostnames(user string) []string {
+	return o.getOverridesForUser(user).AlertmanagerReceiversAllowHostnames
+}
+
 // Notification limits are special. Limits are returned in following order:
 // 1. per-tenant limits for given integration
 // 2. default limits for given integration
@@ -625,6 +1242,14 @@ func (o *Overrides) AlertmanagerMaxAlertsSizeBytes(userID string) int {
 	return o.getOverridesForUser(userID).AlertmanagerMaxAlertsSizeBytes
 }
 
+func (o *Overrides) AlertmanagerMaxSilencesCount(userID string) int {
+	return o.getOverridesForUser(userID).AlertmanagerMaxSilencesCount
+}
+
+func (o *Overrides) AlertmanagerMaxSilenceSizeBytes(userID string) int {
+	return o.getOverridesForUser(userID).AlertmanagerMaxSilenceSizeBytes
+}
+
 func (o *Overrides) getOverridesForUser(userID string) *Limits {
 	if o.tenantLimits != nil {
 		l := o.tenantLimits.ByUserID(userID)
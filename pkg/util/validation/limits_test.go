@@ -2,6 +2,10 @@ package validation
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"reflect"
 	"strings"
 	"testing"
@@ -61,6 +65,71 @@ func TestLimits_Validate(t *testing.T) {
 			shardByAllLabels: true,
 			expected:         nil,
 		},
+		"invalid shadow write percent": {
+			limits:           Limits{ShadowWritePercent: 101},
+			shardByAllLabels: true,
+			expected:         errInvalidShadowWritePercent,
+		},
+		"valid query-frontend middleware toggles": {
+			limits:           Limits{FrontendStepAlign: FrontendMiddlewareEnabled, FrontendQuerySharding: FrontendMiddlewareDisabled},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"invalid query-frontend middleware toggle": {
+			limits:           Limits{FrontendResultsCache: "off"},
+			shardByAllLabels: true,
+			expected:         errInvalidFrontendMiddlewareToggle,
+		},
+		"valid validation limit modes": {
+			limits:           Limits{MaxLabelNameLengthMode: ValidationModeWarn, MaxLabelValueLengthMode: ValidationModeEnforce},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"invalid validation limit mode": {
+			limits:           Limits{MaxLabelNamesPerSeriesMode: "ignore"},
+			shardByAllLabels: true,
+			expected:         errInvalidValidationMode,
+		},
+		"valid NaN handling": {
+			limits:           Limits{NaNHandling: NaNHandlingDropStaleOnly},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"invalid NaN handling": {
+			limits:           Limits{NaNHandling: "drop"},
+			shardByAllLabels: true,
+			expected:         errInvalidNaNHandling,
+		},
+		"valid query audit config": {
+			limits:           Limits{QueryAuditSampleRatio: 0.5, QueryAuditFields: []string{QueryAuditFieldTenant, QueryAuditFieldQuery}},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"invalid query audit sample ratio": {
+			limits:           Limits{QueryAuditSampleRatio: 1.5},
+			shardByAllLabels: true,
+			expected:         errInvalidQueryAuditSampleRatio,
+		},
+		"invalid shadow limits log sample ratio": {
+			limits:           Limits{ShadowLimitsLogSampleRatio: -0.1},
+			shardByAllLabels: true,
+			expected:         errInvalidShadowLimitsLogSampleRatio,
+		},
+		"invalid query audit field": {
+			limits:           Limits{QueryAuditFields: []string{QueryAuditFieldTenant, "user"}},
+			shardByAllLabels: true,
+			expected:         errInvalidQueryAuditField,
+		},
+		"valid split queries timezone": {
+			limits:           Limits{SplitQueriesTimezone: "Europe/Rome"},
+			shardByAllLabels: true,
+			expected:         nil,
+		},
+		"invalid split queries timezone": {
+			limits:           Limits{SplitQueriesTimezone: "Mars/Olympus_Mons"},
+			shardByAllLabels: true,
+			expected:         fmt.Errorf("invalid split queries timezone: %w", errors.New("unknown time zone Mars/Olympus_Mons")),
+		},
 	}
 
 	for testName, testData := range tests {
@@ -72,6 +141,21 @@ func TestLimits_Validate(t *testing.T) {
 	}
 }
 
+func TestOverrides_FrontendStepAlign(t *testing.T) {
+	defaults := Limits{FrontendStepAlign: FrontendMiddlewareEnabled}
+	ov, err := NewOverrides(defaults, newMockTenantLimits(map[string]*Limits{
+		"opted-out": {FrontendStepAlign: FrontendMiddlewareEnabled, DisableStepAlignment: true},
+		"toggled":   {FrontendStepAlign: FrontendMiddlewareDisabled},
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, FrontendMiddlewareEnabled, ov.FrontendStepAlign("default"))
+	assert.Equal(t, FrontendMiddlewareDisabled, ov.FrontendStepAlign("toggled"))
+
+	// The opt-out takes precedence over the toggle.
+	assert.Equal(t, FrontendMiddlewareDisabled, ov.FrontendStepAlign("opted-out"))
+}
+
 func TestOverrides_MaxChunksPerQueryFromStore(t *testing.T) {
 	tests := map[string]struct {
 		setup    func(limits *Limits)
@@ -109,6 +193,40 @@ func TestOverrides_MaxChunksPerQueryFromStore(t *testing.T) {
 	}
 }
 
+func TestOverrides_MaxChunksPerColdQueryFromStore(t *testing.T) {
+	tests := map[string]struct {
+		setup    func(limits *Limits)
+		expected int
+	}{
+		"should return the limit of the other queries if the cold queries limit is unset": {
+			setup: func(limits *Limits) {
+				limits.MaxChunksPerQuery = 20
+			},
+			expected: 20,
+		},
+		"the cold queries limit should take precedence over the other limits": {
+			setup: func(limits *Limits) {
+				limits.MaxChunksPerQuery = 20
+				limits.MaxChunksPerColdQuery = 100
+			},
+			expected: 100,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			limits := Limits{}
+			flagext.DefaultValues(&limits)
+			testData.setup(&limits)
+
+			overrides, err := NewOverrides(limits, nil)
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, overrides.MaxChunksPerColdQueryFromStore("test"))
+			assert.Equal(t, testData.expected, overrides.MaxChunksPerColdQuery("test"))
+		})
+	}
+}
+
 func TestOverridesManager_GetOverrides(t *testing.T) {
 	tenantLimits := map[string]*Limits{}
 
@@ -138,6 +256,20 @@ func TestOverridesManager_GetOverrides(t *testing.T) {
 	require.Equal(t, 0, ov.MaxLabelValueLength("user2"))
 }
 
+func TestOverrides_ForUser(t *testing.T) {
+	defaults := Limits{MaxLabelValueLength: 100}
+	user1 := defaults
+	user1.MaxLabelValueLength = 150
+
+	ov, err := NewOverrides(defaults, newMockTenantLimits(map[string]*Limits{"user1": &user1}))
+	require.NoError(t, err)
+
+	// The limits of the user are returned whatever the user they're called with.
+	require.Equal(t, 150, ov.ForUser("user1").MaxLabelValueLength("user1"))
+	require.Equal(t, 150, ov.ForUser("user1").MaxLabelValueLength("user2"))
+	require.Equal(t, 100, ov.ForUser("user2").MaxLabelValueLength("user1"))
+}
+
 func TestLimitsLoadingFromYaml(t *testing.T) {
 	SetDefaultLimitsForYAMLUnmarshalling(Limits{
 		MaxLabelNameLength: 100,
@@ -557,3 +689,91 @@ testuser:
 		})
 	}
 }
+
+func TestFeatureFlagsOverrides(t *testing.T) {
+	SetDefaultLimitsForYAMLUnmarshalling(Limits{})
+
+	defaults := Limits{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+feature_flags:
+  exemplars: false
+`), &defaults))
+
+	SetDefaultLimitsForYAMLUnmarshalling(defaults)
+	t.Cleanup(func() {
+		SetDefaultLimitsForYAMLUnmarshalling(Limits{})
+	})
+
+	tenantLimits := map[string]*Limits{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+query-sharding-enabled:
+  feature_flags:
+    query_sharding: true
+deprecated-query-sharding:
+  frontend_query_sharding: disabled
+both-query-sharding:
+  frontend_query_sharding: disabled
+  feature_flags:
+    query_sharding: true
+exemplars-enabled:
+  feature_flags:
+    exemplars: true
+`), &tenantLimits))
+
+	// The default feature flags are not modified by the tenant overrides.
+	assert.Equal(t, FeatureFlagsMap{FeatureExemplars: false}, defaults.FeatureFlags)
+
+	ov, err := NewOverrides(defaults, newMockTenantLimits(tenantLimits))
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		expectedQuerySharding    string
+		expectedExemplarsEnabled bool
+	}{
+		"query-sharding-enabled": {
+			expectedQuerySharding:    FrontendMiddlewareEnabled,
+			expectedExemplarsEnabled: false,
+		},
+		"deprecated-query-sharding": {
+			expectedQuerySharding:    FrontendMiddlewareDisabled,
+			expectedExemplarsEnabled: false,
+		},
+		"both-query-sharding": {
+			expectedQuerySharding:    FrontendMiddlewareEnabled,
+			expectedExemplarsEnabled: false,
+		},
+		"exemplars-enabled": {
+			expectedQuerySharding:    "",
+			expectedExemplarsEnabled: true,
+		},
+		"no-overrides": {
+			expectedQuerySharding:    "",
+			expectedExemplarsEnabled: false,
+		},
+	}
+
+	for userID, testData := range tests {
+		t.Run(userID, func(t *testing.T) {
+			assert.Equal(t, testData.expectedQuerySharding, ov.FrontendQuerySharding(userID))
+			assert.Equal(t, testData.expectedExemplarsEnabled, ov.ExemplarsEnabled(userID))
+		})
+	}
+}
+
+func TestFeatureFlagsShouldRejectUnknownFlags(t *testing.T) {
+	limits := Limits{}
+	flagext.DefaultValues(&limits)
+
+	err := yaml.Unmarshal([]byte(`
+feature_flags:
+  unknown: true
+`), &limits)
+	require.EqualError(t, err, "unknown feature flag: unknown")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	limits.RegisterFlags(fs)
+	require.Error(t, fs.Parse([]string{`-limits.feature-flags={"unknown": true}`}))
+	require.NoError(t, fs.Parse([]string{`-limits.feature-flags={"exemplars": false}`}))
+	assert.Equal(t, FeatureFlagsMap{FeatureExemplars: false}, limits.FeatureFlags)
+}
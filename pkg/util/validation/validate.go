@@ -1,8 +1,12 @@
 package validation
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
@@ -10,6 +14,7 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/weaveworks/common/httpgrpc"
 
 	"github.com/cortexproject/cortex/pkg/cortexpb"
@@ -34,6 +39,10 @@ const (
 	// ErrQueryTooLong is used in chunk store, querier and query frontend.
 	ErrQueryTooLong = "the query time range exceeds the limit (query length: %s, limit: %s)"
 
+	// ErrSelectorWithoutRequiredLabel is the error of the selectors only matching the series
+	// missing a required label.
+	ErrSelectorWithoutRequiredLabel = "the selector %s can only match the series missing the required label %q"
+
 	missingMetricName       = "missing_metric_name"
 	invalidMetricName       = "metric_name_invalid"
 	greaterThanMaxSampleAge = "greater_than_max_sample_age"
@@ -44,11 +53,30 @@ const (
 	duplicateLabelNames     = "duplicate_label_names"
 	labelsNotSorted         = "labels_not_sorted"
 	labelValueTooLong       = "label_value_too_long"
+	labelNameNotAllowed     = "label_name_not_allowed"
+	missingRequiredLabel    = "missing_required_label"
+
+	// RequestBodyTooLarge is the reason for discarding the push requests whose uncompressed body
+	// exceeds the per-tenant limit.
+	RequestBodyTooLarge = "request_body_too_large"
+
+	// StrippedLabelsDuplicateSample is the reason for discarding samples of series collapsing onto
+	// the same labels once the label names not allowed have been stripped, when another of
+	// those series has a sample with the same timestamp.
+	StrippedLabelsDuplicateSample = "stripped_labels_duplicate_sample"
 
 	// Exemplar-specific validation reasons
-	exemplarLabelsMissing    = "exemplar_labels_missing"
-	exemplarLabelsTooLong    = "exemplar_labels_too_long"
-	exemplarTimestampInvalid = "exemplar_timestamp_invalid"
+	exemplarLabelsMissing     = "exemplar_labels_missing"
+	exemplarLabelsTooLong     = "exemplar_labels_too_long"
+	exemplarTimestampInvalid  = "exemplar_timestamp_invalid"
+	exemplarMaxLabels         = "exemplar_max_labels"
+	exemplarLabelValueTooLong = "exemplar_label_value_too_long"
+
+	// ExemplarRateLimited is the reason for discarding exemplars exceeding the per-tenant exemplars rate limit.
+	ExemplarRateLimited = "exemplar_rate_limited"
+
+	// ExemplarsDisabled is the reason for discarding the exemplars of the tenants with the exemplars feature flag disabled.
+	ExemplarsDisabled = "exemplars_disabled"
 
 	// RateLimited is one of the values for the reason to discard samples.
 	// Declared here to avoid duplication in ingester and distributor.
@@ -89,10 +117,148 @@ var DiscardedMetadata = prometheus.NewCounterVec(
 	[]string{discardReasonLabel, "user"},
 )
 
+// DiscardedRequests is a metric of the number of push requests discarded before their samples
+// could be counted, by reason.
+var DiscardedRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cortex_discarded_requests_total",
+		Help: "The total number of push requests that were discarded.",
+	},
+	[]string{discardReasonLabel, "user"},
+)
+
+// ValidationWarnings is a metric of the number of series accepted despite exceeding a
+// validation limit in warn mode, by reason.
+var ValidationWarnings = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cortex_validation_warnings_total",
+		Help: "The total number of series which exceeded a validation limit in warn mode, and were accepted.",
+	},
+	[]string{discardReasonLabel, "user"},
+)
+
+// ShadowDiscards is a metric of the number of series accepted which would have been discarded by
+// the shadow limits, by reason.
+var ShadowDiscards = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cortex_validation_shadow_discards_total",
+		Help: "The total number of series which would have been discarded by the shadow limits, and were accepted.",
+	},
+	[]string{discardReasonLabel, "user"},
+)
+
 func init() {
 	prometheus.MustRegister(DiscardedSamples)
 	prometheus.MustRegister(DiscardedExemplars)
 	prometheus.MustRegister(DiscardedMetadata)
+	prometheus.MustRegister(DiscardedRequests)
+	prometheus.MustRegister(ValidationWarnings)
+	prometheus.MustRegister(ShadowDiscards)
+}
+
+// DiscardedRecorder records the samples, exemplars and metadata discarded by the validation,
+// by reason, the series accepted despite exceeding a limit in warn mode, and the series accepted
+// which would have been discarded by the shadow limits. The series labels, when provided, must not
+// be retained.
+type DiscardedRecorder interface {
+	DiscardedSamples(reason, userID string, series []cortexpb.LabelAdapter, count int)
+	DiscardedExemplars(reason, userID string, series []cortexpb.LabelAdapter, count int)
+	DiscardedMetadata(reason, userID string, count int)
+	ValidationWarning(reason, userID string, series []cortexpb.LabelAdapter)
+	ShadowDiscard(reason, userID string, series []cortexpb.LabelAdapter)
+}
+
+// DiscardedMetricsRecorder records the discarded samples, exemplars and metadata in the
+// cortex_discarded_samples_total, cortex_discarded_exemplars_total and cortex_discarded_metadata_total metrics.
+var DiscardedMetricsRecorder DiscardedRecorder = discardedMetricsRecorder{}
+
+type discardedMetricsRecorder struct{}
+
+func (discardedMetricsRecorder) DiscardedSamples(reason, userID string, _ []cortexpb.LabelAdapter, count int) {
+	DiscardedSamples.WithLabelValues(reason, userID).Add(float64(count))
+}
+
+func (discardedMetricsRecorder) DiscardedExemplars(reason, userID string, _ []cortexpb.LabelAdapter, count int) {
+	DiscardedExemplars.WithLabelValues(reason, userID).Add(float64(count))
+}
+
+func (discardedMetricsRecorder) DiscardedMetadata(reason, userID string, count int) {
+	DiscardedMetadata.WithLabelValues(reason, userID).Add(float64(count))
+}
+
+func (discardedMetricsRecorder) ValidationWarning(reason, userID string, _ []cortexpb.LabelAdapter) {
+	ValidationWarnings.WithLabelValues(reason, userID).Inc()
+}
+
+func (discardedMetricsRecorder) ShadowDiscard(reason, userID string, _ []cortexpb.LabelAdapter) {
+	ShadowDiscards.WithLabelValues(reason, userID).Inc()
+}
+
+type warningsContextKey int
+
+const warningsKey warningsContextKey = 0
+
+// Warnings collects the reasons of the validation warnings of a push request, so that they
+// can be reported to the client. It's safe for concurrent use.
+type Warnings struct {
+	mtx     sync.Mutex
+	reasons map[string]struct{}
+}
+
+// NewWarnings makes a new empty Warnings.
+func NewWarnings() *Warnings {
+	return &Warnings{reasons: map[string]struct{}{}}
+}
+
+// Add records a warning reason.
+func (w *Warnings) Add(reason string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.reasons[reason] = struct{}{}
+}
+
+// Reasons returns the sorted warning reasons.
+func (w *Warnings) Reasons() []string {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	reasons := make([]string, 0, len(w.reasons))
+	for reason := range w.reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// ContextWithWarnings returns a context carrying the Warnings, in which the validation
+// warnings of the push request are collected.
+func ContextWithWarnings(ctx context.Context, w *Warnings) context.Context {
+	return context.WithValue(ctx, warningsKey, w)
+}
+
+// WarningsFromContext returns the Warnings carried by the context, or nil if missing.
+func WarningsFromContext(ctx context.Context) *Warnings {
+	w, _ := ctx.Value(warningsKey).(*Warnings)
+	return w
+}
+
+// RecorderWithWarnings returns a DiscardedRecorder which also collects the validation warnings
+// in w, if not nil.
+func RecorderWithWarnings(discarded DiscardedRecorder, w *Warnings) DiscardedRecorder {
+	if w == nil {
+		return discarded
+	}
+	return warningsRecorder{DiscardedRecorder: discarded, warnings: w}
+}
+
+type warningsRecorder struct {
+	DiscardedRecorder
+	warnings *Warnings
+}
+
+func (r warningsRecorder) ValidationWarning(reason, userID string, series []cortexpb.LabelAdapter) {
+	r.DiscardedRecorder.ValidationWarning(reason, userID, series)
+	r.warnings.Add(reason)
 }
 
 // SampleValidationConfig helps with getting required config to validate sample.
@@ -102,18 +268,18 @@ type SampleValidationConfig interface {
 	CreationGracePeriod(userID string) time.Duration
 }
 
-// ValidateSample returns an err if the sample is invalid.
-// The returned error may retain the provided series labels.
-func ValidateSample(cfg SampleValidationConfig, userID string, ls []cortexpb.LabelAdapter, s cortexpb.Sample) ValidationError {
-	unsafeMetricName, _ := extract.UnsafeMetricNameFromLabelAdapters(ls)
-
-	if cfg.RejectOldSamples(userID) && model.Time(s.TimestampMs) < model.Now().Add(-cfg.RejectOldSamplesMaxAge(userID)) {
-		DiscardedSamples.WithLabelValues(greaterThanMaxSampleAge, userID).Inc()
+// ValidateSample returns an err if the sample is invalid, given the time at which the
+// write request has been received. The returned error may retain the provided series labels.
+func ValidateSample(discarded DiscardedRecorder, cfg SampleValidationConfig, userID string, ls []cortexpb.LabelAdapter, s cortexpb.Sample, now model.Time) ValidationError {
+	if cfg.RejectOldSamples(userID) && model.Time(s.TimestampMs) < now.Add(-cfg.RejectOldSamplesMaxAge(userID)) {
+		discarded.DiscardedSamples(greaterThanMaxSampleAge, userID, ls, 1)
+		unsafeMetricName, _ := extract.UnsafeMetricNameFromLabelAdapters(ls)
 		return newSampleTimestampTooOldError(unsafeMetricName, s.TimestampMs)
 	}
 
-	if model.Time(s.TimestampMs) > model.Now().Add(cfg.CreationGracePeriod(userID)) {
-		DiscardedSamples.WithLabelValues(tooFarInFuture, userID).Inc()
+	if model.Time(s.TimestampMs) > now.Add(cfg.CreationGracePeriod(userID)) {
+		discarded.DiscardedSamples(tooFarInFuture, userID, ls, 1)
+		unsafeMetricName, _ := extract.UnsafeMetricNameFromLabelAdapters(ls)
 		return newSampleTimestampTooNewError(unsafeMetricName, s.TimestampMs)
 	}
 
@@ -122,14 +288,14 @@ func ValidateSample(cfg SampleValidationConfig, userID string, ls []cortexpb.Lab
 
 // ValidateExemplar returns an error if the exemplar is invalid.
 // The returned error may retain the provided series labels.
-func ValidateExemplar(userID string, ls []cortexpb.LabelAdapter, e cortexpb.Exemplar) ValidationError {
+func ValidateExemplar(discarded DiscardedRecorder, userID string, ls []cortexpb.LabelAdapter, e cortexpb.Exemplar) ValidationError {
 	if len(e.Labels) <= 0 {
-		DiscardedExemplars.WithLabelValues(exemplarLabelsMissing, userID).Inc()
+		discarded.DiscardedExemplars(exemplarLabelsMissing, userID, ls, 1)
 		return newExemplarEmtpyLabelsError(ls, []cortexpb.LabelAdapter{}, e.TimestampMs)
 	}
 
 	if e.TimestampMs == 0 {
-		DiscardedExemplars.WithLabelValues(exemplarTimestampInvalid, userID).Inc()
+		discarded.DiscardedExemplars(exemplarTimestampInvalid, userID, ls, 1)
 		return newExemplarMissingTimestampError(
 			ls,
 			e.Labels,
@@ -146,7 +312,7 @@ func ValidateExemplar(userID string, ls []cortexpb.LabelAdapter, e cortexpb.Exem
 	}
 
 	if labelSetLen > ExemplarMaxLabelSetLength {
-		DiscardedExemplars.WithLabelValues(exemplarLabelsTooLong, userID).Inc()
+		discarded.DiscardedExemplars(exemplarLabelsTooLong, userID, ls, 1)
 		return newExemplarLabelLengthError(
 			ls,
 			e.Labels,
@@ -157,64 +323,259 @@ func ValidateExemplar(userID string, ls []cortexpb.LabelAdapter, e cortexpb.Exem
 	return nil
 }
 
+// ExemplarValidationConfig helps with getting required config to validate exemplars.
+type ExemplarValidationConfig interface {
+	MaxExemplarLabels(userID string) int
+	MaxExemplarLabelValueLength(userID string) int
+}
+
+// ValidateExemplarLimits returns an error if the exemplar exceeds the per-tenant limits.
+// Unlike ValidateExemplar, exemplars exceeding a limit are expected to be dropped without
+// discarding the samples of the series they belong to.
+// The returned error may retain the provided series labels.
+func ValidateExemplarLimits(discarded DiscardedRecorder, cfg ExemplarValidationConfig, userID string, ls []cortexpb.LabelAdapter, e cortexpb.Exemplar) ValidationError {
+	if limit := cfg.MaxExemplarLabels(userID); limit > 0 && len(e.Labels) > limit {
+		discarded.DiscardedExemplars(exemplarMaxLabels, userID, ls, 1)
+		return newExemplarTooManyLabelsError(ls, e.Labels, e.TimestampMs, limit)
+	}
+
+	if limit := cfg.MaxExemplarLabelValueLength(userID); limit > 0 {
+		for _, l := range e.Labels {
+			if len(l.Value) > limit {
+				discarded.DiscardedExemplars(exemplarLabelValueTooLong, userID, ls, 1)
+				return newExemplarLabelValueTooLongError(ls, e.Labels, e.TimestampMs, limit)
+			}
+		}
+	}
+
+	return nil
+}
+
 // LabelValidationConfig helps with getting required config to validate labels.
 type LabelValidationConfig interface {
 	EnforceMetricName(userID string) bool
 	MaxLabelNamesPerSeries(userID string) int
+	MaxLabelNamesPerSeriesMode(userID string) string
 	MaxLabelNameLength(userID string) int
+	MaxLabelNameLengthMode(userID string) string
 	MaxLabelValueLength(userID string) int
+	MaxLabelValueLengthMode(userID string) string
+	RequiredLabelNames(userID string) []string
+	RequiredLabelNamesMode(userID string) string
 }
 
-// ValidateLabels returns an err if the labels are invalid.
+// ValidatedLabelNames memoizes the label names of the last series accepted by ValidateLabels
+// within a request. The series of a request mostly share the same label names, so the names
+// matching the ones of the last series accepted, at the same position, are already known to
+// be valid and sorted. It's not safe for concurrent use, and is expected to not outlive the
+// request, because the label names may reference the request buffer.
+type ValidatedLabelNames struct {
+	names []string
+}
+
+// matches returns whether the i-th label name is the same as the one of the last series accepted.
+func (v *ValidatedLabelNames) matches(i int, name string) bool {
+	return v != nil && i < len(v.names) && v.names[i] == name
+}
+
+func (v *ValidatedLabelNames) update(ls []cortexpb.LabelAdapter) {
+	v.names = v.names[:0]
+	for _, l := range ls {
+		v.names = append(v.names, l.Name)
+	}
+}
+
+// ValidateLabels returns an err if the labels are invalid. The series exceeding a limit
+// in warn mode are accepted, and a warning is recorded for each exceeded limit. The label
+// names already validated for the request are not validated again, if validated is not nil.
 // The returned error may retain the provided series labels.
-func ValidateLabels(cfg LabelValidationConfig, userID string, ls []cortexpb.LabelAdapter, skipLabelNameValidation bool) ValidationError {
+func ValidateLabels(discarded DiscardedRecorder, cfg LabelValidationConfig, userID string, ls []cortexpb.LabelAdapter, skipLabelNameValidation bool, validated *ValidatedLabelNames) ValidationError {
 	if cfg.EnforceMetricName(userID) {
 		unsafeMetricName, err := extract.UnsafeMetricNameFromLabelAdapters(ls)
 		if err != nil {
-			DiscardedSamples.WithLabelValues(missingMetricName, userID).Inc()
+			discarded.DiscardedSamples(missingMetricName, userID, ls, 1)
 			return newNoMetricNameError()
 		}
 
 		if !model.IsValidMetricName(model.LabelValue(unsafeMetricName)) {
-			DiscardedSamples.WithLabelValues(invalidMetricName, userID).Inc()
+			discarded.DiscardedSamples(invalidMetricName, userID, ls, 1)
 			return newInvalidMetricNameError(unsafeMetricName)
 		}
 	}
 
+	var warnings []string
+
 	numLabelNames := len(ls)
 	if numLabelNames > cfg.MaxLabelNamesPerSeries(userID) {
-		DiscardedSamples.WithLabelValues(maxLabelNamesPerSeries, userID).Inc()
-		return newTooManyLabelsError(ls, cfg.MaxLabelNamesPerSeries(userID))
+		if cfg.MaxLabelNamesPerSeriesMode(userID) != ValidationModeWarn {
+			discarded.DiscardedSamples(maxLabelNamesPerSeries, userID, ls, 1)
+			return newTooManyLabelsError(ls, cfg.MaxLabelNamesPerSeries(userID))
+		}
+		warnings = append(warnings, maxLabelNamesPerSeries)
 	}
 
 	maxLabelNameLength := cfg.MaxLabelNameLength(userID)
 	maxLabelValueLength := cfg.MaxLabelValueLength(userID)
+	warnLabelNameLength := cfg.MaxLabelNameLengthMode(userID) == ValidationModeWarn
+	warnLabelValueLength := cfg.MaxLabelValueLengthMode(userID) == ValidationModeWarn
+	labelNameTooLongFound, labelValueTooLongFound := false, false
 	lastLabelName := ""
-	for _, l := range ls {
-		if !skipLabelNameValidation && !model.LabelName(l.Name).IsValid() {
-			DiscardedSamples.WithLabelValues(invalidLabel, userID).Inc()
+	// The label names are known to be valid and sorted as long as all of them, so far, are
+	// the same as the ones of the last series accepted.
+	matching := true
+	for i, l := range ls {
+		matching = matching && validated.matches(i, l.Name)
+		if matching {
+			if len(l.Value) > maxLabelValueLength && !warnLabelValueLength {
+				discarded.DiscardedSamples(labelValueTooLong, userID, ls, 1)
+				return newLabelValueTooLongError(ls, l.Value)
+			}
+		} else if !skipLabelNameValidation && !model.LabelName(l.Name).IsValid() {
+			discarded.DiscardedSamples(invalidLabel, userID, ls, 1)
 			return newInvalidLabelError(ls, l.Name)
-		} else if len(l.Name) > maxLabelNameLength {
-			DiscardedSamples.WithLabelValues(labelNameTooLong, userID).Inc()
+		} else if len(l.Name) > maxLabelNameLength && !warnLabelNameLength {
+			discarded.DiscardedSamples(labelNameTooLong, userID, ls, 1)
 			return newLabelNameTooLongError(ls, l.Name)
-		} else if len(l.Value) > maxLabelValueLength {
-			DiscardedSamples.WithLabelValues(labelValueTooLong, userID).Inc()
+		} else if len(l.Value) > maxLabelValueLength && !warnLabelValueLength {
+			discarded.DiscardedSamples(labelValueTooLong, userID, ls, 1)
 			return newLabelValueTooLongError(ls, l.Value)
 		} else if cmp := strings.Compare(lastLabelName, l.Name); cmp >= 0 {
 			if cmp == 0 {
-				DiscardedSamples.WithLabelValues(duplicateLabelNames, userID).Inc()
+				discarded.DiscardedSamples(duplicateLabelNames, userID, ls, 1)
 				return newDuplicatedLabelError(ls, l.Name)
 			}
 
-			DiscardedSamples.WithLabelValues(labelsNotSorted, userID).Inc()
+			discarded.DiscardedSamples(labelsNotSorted, userID, ls, 1)
 			return newLabelsNotSortedError(ls, l.Name)
 		}
 
+		if len(l.Name) > maxLabelNameLength && !labelNameTooLongFound {
+			labelNameTooLongFound = true
+			warnings = append(warnings, labelNameTooLong)
+		}
+		if len(l.Value) > maxLabelValueLength && !labelValueTooLongFound {
+			labelValueTooLongFound = true
+			warnings = append(warnings, labelValueTooLong)
+		}
+
 		lastLabelName = l.Name
 	}
+
+	// A label with an empty value is the same as a missing label.
+	for _, name := range cfg.RequiredLabelNames(userID) {
+		if hasLabelValue(ls, name) {
+			continue
+		}
+		if cfg.RequiredLabelNamesMode(userID) != ValidationModeWarn {
+			discarded.DiscardedSamples(missingRequiredLabel, userID, ls, 1)
+			return newMissingRequiredLabelError(ls, name)
+		}
+		warnings = append(warnings, missingRequiredLabel)
+		break
+	}
+
+	if validated != nil && (!matching || len(ls) != len(validated.names)) {
+		validated.update(ls)
+	}
+
+	// The warnings are recorded only once the series is known to be accepted.
+	for _, reason := range warnings {
+		discarded.ValidationWarning(reason, userID, ls)
+	}
+	return nil
+}
+
+// ShadowLimitsConfig helps with getting the shadow limits, which are evaluated without being enforced.
+type ShadowLimitsConfig interface {
+	ShadowMaxLabelNamesPerSeries(userID string) int
+	ShadowMaxLabelNameLength(userID string) int
+	ShadowMaxLabelValueLength(userID string) int
+}
+
+// ValidateShadowLimits returns the reason the series would be discarded for by the shadow limits,
+// or an empty string if the series doesn't exceed any of them. The shadow limits set to 0 are
+// not evaluated. The series labels are expected to be valid, like after ValidateLabels.
+func ValidateShadowLimits(cfg ShadowLimitsConfig, userID string, ls []cortexpb.LabelAdapter) string {
+	maxLabelNames := cfg.ShadowMaxLabelNamesPerSeries(userID)
+	maxLabelNameLength := cfg.ShadowMaxLabelNameLength(userID)
+	maxLabelValueLength := cfg.ShadowMaxLabelValueLength(userID)
+	if maxLabelNames <= 0 && maxLabelNameLength <= 0 && maxLabelValueLength <= 0 {
+		return ""
+	}
+
+	if maxLabelNames > 0 && len(ls) > maxLabelNames {
+		return maxLabelNamesPerSeries
+	}
+
+	for _, l := range ls {
+		if maxLabelNameLength > 0 && len(l.Name) > maxLabelNameLength {
+			return labelNameTooLong
+		}
+		if maxLabelValueLength > 0 && len(l.Value) > maxLabelValueLength {
+			return labelValueTooLong
+		}
+	}
+	return ""
+}
+
+func hasLabelValue(ls []cortexpb.LabelAdapter, name string) bool {
+	for _, l := range ls {
+		if l.Name == name {
+			return l.Value != ""
+		}
+	}
+	return false
+}
+
+// ValidateRequiredLabelMatchers returns an error if a selector can only match the series missing
+// one of the required label names, like {cluster=""}. Such a selector is usually a typo, since the
+// series missing a required label are rejected on ingestion.
+func ValidateRequiredLabelMatchers(required []string, matchers []*labels.Matcher) error {
+	for _, name := range required {
+		for _, m := range matchers {
+			if m.Name == name && matchesOnlyMissingLabel(m) {
+				return LimitError(fmt.Sprintf(ErrSelectorWithoutRequiredLabel, m.String(), name))
+			}
+		}
+	}
 	return nil
 }
 
+// matchesOnlyMissingLabel returns whether the matcher only matches the series with an empty or
+// missing label.
+func matchesOnlyMissingLabel(m *labels.Matcher) bool {
+	switch m.Type {
+	case labels.MatchEqual, labels.MatchRegexp:
+		return m.Value == ""
+	case labels.MatchNotRegexp:
+		return m.Value == ".+"
+	default:
+		return false
+	}
+}
+
+// ValidateAllowedLabelNames returns an err if the series has a label name which is not in
+// the allowed ones. The metric name is always allowed.
+// The returned error may retain the provided series labels.
+func ValidateAllowedLabelNames(discarded DiscardedRecorder, userID string, allowed map[string]struct{}, ls []cortexpb.LabelAdapter) ValidationError {
+	for _, l := range ls {
+		if !IsLabelNameAllowed(allowed, l.Name) {
+			discarded.DiscardedSamples(labelNameNotAllowed, userID, ls, 1)
+			return newLabelNameNotAllowedError(ls, l.Name)
+		}
+	}
+	return nil
+}
+
+// IsLabelNameAllowed returns whether the label name is in the allowed ones. The metric name is always allowed.
+func IsLabelNameAllowed(allowed map[string]struct{}, name string) bool {
+	if name == model.MetricNameLabel {
+		return true
+	}
+	_, ok := allowed[name]
+	return ok
+}
+
 // MetadataValidationConfig helps with getting required config to validate metadata.
 type MetadataValidationConfig interface {
 	EnforceMetadataMetricName(userID string) bool
@@ -222,9 +583,9 @@ type MetadataValidationConfig interface {
 }
 
 // ValidateMetadata returns an err if a metric metadata is invalid.
-func ValidateMetadata(cfg MetadataValidationConfig, userID string, metadata *cortexpb.MetricMetadata) error {
+func ValidateMetadata(discarded DiscardedRecorder, cfg MetadataValidationConfig, userID string, metadata *cortexpb.MetricMetadata) error {
 	if cfg.EnforceMetadataMetricName(userID) && metadata.GetMetricFamilyName() == "" {
-		DiscardedMetadata.WithLabelValues(missingMetricName, userID).Inc()
+		discarded.DiscardedMetadata(missingMetricName, userID, 1)
 		return httpgrpc.Errorf(http.StatusBadRequest, errMetadataMissingMetricName)
 	}
 
@@ -247,7 +608,7 @@ func ValidateMetadata(cfg MetadataValidationConfig, userID string, metadata *cor
 	}
 
 	if reason != "" {
-		DiscardedMetadata.WithLabelValues(reason, userID).Inc()
+		discarded.DiscardedMetadata(reason, userID, 1)
 		return httpgrpc.Errorf(http.StatusBadRequest, errMetadataTooLong, metadataType, cause, metadata.GetMetricFamilyName())
 	}
 
@@ -266,4 +627,13 @@ func DeletePerUserValidationMetrics(userID string, log log.Logger) {
 	if err := util.DeleteMatchingLabels(DiscardedMetadata, filter); err != nil {
 		level.Warn(log).Log("msg", "failed to remove cortex_discarded_metadata_total metric for user", "user", userID, "err", err)
 	}
+	if err := util.DeleteMatchingLabels(DiscardedRequests, filter); err != nil {
+		level.Warn(log).Log("msg", "failed to remove cortex_discarded_requests_total metric for user", "user", userID, "err", err)
+	}
+	if err := util.DeleteMatchingLabels(ValidationWarnings, filter); err != nil {
+		level.Warn(log).Log("msg", "failed to remove cortex_validation_warnings_total metric for user", "user", userID, "err", err)
+	}
+	if err := util.DeleteMatchingLabels(ShadowDiscards, filter); err != nil {
+		level.Warn(log).Log("msg", "failed to remove cortex_validation_shadow_discards_total metric for user", "user", userID, "err", err)
+	}
 }
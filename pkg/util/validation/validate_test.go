@@ -1,6 +1,7 @@
 package validation
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 	"testing"
@@ -8,6 +9,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/weaveworks/common/httpgrpc"
@@ -17,10 +19,15 @@ import (
 )
 
 type validateLabelsCfg struct {
-	enforceMetricName      bool
-	maxLabelNamesPerSeries int
-	maxLabelNameLength     int
-	maxLabelValueLength    int
+	enforceMetricName          bool
+	maxLabelNamesPerSeries     int
+	maxLabelNamesPerSeriesMode string
+	maxLabelNameLength         int
+	maxLabelNameLengthMode     string
+	maxLabelValueLength        int
+	maxLabelValueLengthMode    string
+	requiredLabelNames         []string
+	requiredLabelNamesMode     string
 }
 
 func (v validateLabelsCfg) EnforceMetricName(userID string) bool {
@@ -39,6 +46,26 @@ func (v validateLabelsCfg) MaxLabelValueLength(userID string) int {
 	return v.maxLabelValueLength
 }
 
+func (v validateLabelsCfg) MaxLabelNamesPerSeriesMode(userID string) string {
+	return v.maxLabelNamesPerSeriesMode
+}
+
+func (v validateLabelsCfg) MaxLabelNameLengthMode(userID string) string {
+	return v.maxLabelNameLengthMode
+}
+
+func (v validateLabelsCfg) MaxLabelValueLengthMode(userID string) string {
+	return v.maxLabelValueLengthMode
+}
+
+func (v validateLabelsCfg) RequiredLabelNames(userID string) []string {
+	return v.requiredLabelNames
+}
+
+func (v validateLabelsCfg) RequiredLabelNamesMode(userID string) string {
+	return v.requiredLabelNamesMode
+}
+
 type validateMetadataCfg struct {
 	enforceMetadataMetricName bool
 	maxMetadataLength         int
@@ -120,7 +147,7 @@ func TestValidateLabels(t *testing.T) {
 			nil,
 		},
 	} {
-		err := ValidateLabels(cfg, userID, cortexpb.FromMetricsToLabelAdapters(c.metric), c.skipLabelNameValidation)
+		err := ValidateLabels(DiscardedMetricsRecorder, cfg, userID, cortexpb.FromMetricsToLabelAdapters(c.metric), c.skipLabelNameValidation, nil)
 		assert.Equal(t, c.err, err, "wrong error")
 	}
 
@@ -168,7 +195,7 @@ func TestValidateExemplars(t *testing.T) {
 	}
 
 	for _, ie := range invalidExemplars {
-		err := ValidateExemplar(userID, []cortexpb.LabelAdapter{}, ie)
+		err := ValidateExemplar(DiscardedMetricsRecorder, userID, []cortexpb.LabelAdapter{}, ie)
 		assert.NotNil(t, err)
 	}
 
@@ -193,6 +220,66 @@ func TestValidateExemplars(t *testing.T) {
 	`), "cortex_discarded_exemplars_total"))
 }
 
+type exemplarLimitsCfg struct {
+	maxExemplarLabels           int
+	maxExemplarLabelValueLength int
+}
+
+func (c exemplarLimitsCfg) MaxExemplarLabels(_ string) int {
+	return c.maxExemplarLabels
+}
+
+func (c exemplarLimitsCfg) MaxExemplarLabelValueLength(_ string) int {
+	return c.maxExemplarLabelValueLength
+}
+
+func TestValidateExemplarLimits(t *testing.T) {
+	userID := "testExemplarLimitsUser"
+	cfg := exemplarLimitsCfg{maxExemplarLabels: 2, maxExemplarLabelValueLength: 5}
+	series := []cortexpb.LabelAdapter{{Name: model.MetricNameLabel, Value: "test"}}
+
+	for _, tc := range []struct {
+		exemplar cortexpb.Exemplar
+		err      error
+	}{
+		{
+			exemplar: cortexpb.Exemplar{
+				Labels:      []cortexpb.LabelAdapter{{Name: "a", Value: "1"}, {Name: "b", Value: "12345"}},
+				TimestampMs: 1000,
+			},
+			err: nil,
+		},
+		{
+			exemplar: cortexpb.Exemplar{
+				Labels:      []cortexpb.LabelAdapter{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "c", Value: "3"}},
+				TimestampMs: 1000,
+			},
+			err: newExemplarTooManyLabelsError(series, []cortexpb.LabelAdapter{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "c", Value: "3"}}, 1000, 2),
+		},
+		{
+			exemplar: cortexpb.Exemplar{
+				Labels:      []cortexpb.LabelAdapter{{Name: "a", Value: "123456"}},
+				TimestampMs: 1000,
+			},
+			err: newExemplarLabelValueTooLongError(series, []cortexpb.LabelAdapter{{Name: "a", Value: "123456"}}, 1000, 5),
+		},
+	} {
+		err := ValidateExemplarLimits(DiscardedMetricsRecorder, cfg, userID, series, tc.exemplar)
+		assert.Equal(t, tc.err, err, "wrong error")
+	}
+
+	// Limits set to 0 are disabled.
+	assert.Nil(t, ValidateExemplarLimits(DiscardedMetricsRecorder, exemplarLimitsCfg{}, userID, series, cortexpb.Exemplar{
+		Labels:      []cortexpb.LabelAdapter{{Name: "a", Value: strings.Repeat("0", 100)}, {Name: "b", Value: "2"}, {Name: "c", Value: "3"}},
+		TimestampMs: 1000,
+	}))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(DiscardedExemplars.WithLabelValues(exemplarMaxLabels, userID)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(DiscardedExemplars.WithLabelValues(exemplarLabelValueTooLong, userID)))
+
+	DeletePerUserValidationMetrics(userID, util_log.Logger)
+}
+
 func TestValidateMetadata(t *testing.T) {
 	userID := "testUser"
 	var cfg validateMetadataCfg
@@ -231,7 +318,7 @@ func TestValidateMetadata(t *testing.T) {
 		},
 	} {
 		t.Run(c.desc, func(t *testing.T) {
-			err := ValidateMetadata(cfg, userID, c.metadata)
+			err := ValidateMetadata(DiscardedMetricsRecorder, cfg, userID, c.metadata)
 			assert.Equal(t, c.err, err, "wrong error")
 		})
 	}
@@ -258,6 +345,204 @@ func TestValidateMetadata(t *testing.T) {
 	`), "cortex_discarded_metadata_total"))
 }
 
+func TestValidateLabels_WarnMode(t *testing.T) {
+	cfg := validateLabelsCfg{
+		enforceMetricName:          true,
+		maxLabelNamesPerSeries:     2,
+		maxLabelNamesPerSeriesMode: ValidationModeWarn,
+		maxLabelNameLength:         10,
+		maxLabelNameLengthMode:     ValidationModeWarn,
+		maxLabelValueLength:        10,
+		maxLabelValueLengthMode:    ValidationModeWarn,
+	}
+	userID := "warnUser"
+	warnings := NewWarnings()
+	discarded := RecorderWithWarnings(DiscardedMetricsRecorder, warnings)
+
+	// The series exceeding the limits in warn mode are accepted.
+	assert.NoError(t, ValidateLabels(discarded, cfg, userID, []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "metric_with_a_long_name"},
+		{Name: "a", Value: "a"},
+		{Name: "label_with_a_long_name", Value: "a"},
+		{Name: "label_with_another_long_name", Value: "a"},
+	}, false, nil))
+	assert.Equal(t, []string{labelNameTooLong, labelValueTooLong, maxLabelNamesPerSeries}, warnings.Reasons())
+
+	// The other validations are still enforced, and no warning is recorded for discarded series.
+	assert.Equal(t, newLabelsNotSortedError([]cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "label_with_a_long_name", Value: "a"},
+		{Name: "a", Value: "a"},
+	}, "a"), ValidateLabels(discarded, cfg, userID, []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "label_with_a_long_name", Value: "a"},
+		{Name: "a", Value: "a"},
+	}, false, nil))
+
+	// The limits in enforce mode still discard the series.
+	cfg.maxLabelValueLengthMode = ValidationModeEnforce
+	assert.Equal(t, newLabelValueTooLongError([]cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "metric_with_a_long_name"},
+	}, "metric_with_a_long_name"), ValidateLabels(discarded, cfg, userID, []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "metric_with_a_long_name"},
+	}, false, nil))
+
+	require.NoError(t, testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(`
+			# HELP cortex_validation_warnings_total The total number of series which exceeded a validation limit in warn mode, and were accepted.
+			# TYPE cortex_validation_warnings_total counter
+			cortex_validation_warnings_total{reason="label_name_too_long",user="warnUser"} 1
+			cortex_validation_warnings_total{reason="label_value_too_long",user="warnUser"} 1
+			cortex_validation_warnings_total{reason="max_label_names_per_series",user="warnUser"} 1
+	`), "cortex_validation_warnings_total"))
+
+	DeletePerUserValidationMetrics(userID, util_log.Logger)
+
+	require.NoError(t, testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(""), "cortex_validation_warnings_total"))
+}
+
+type shadowLimitsCfg struct {
+	maxLabelNamesPerSeries int
+	maxLabelNameLength     int
+	maxLabelValueLength    int
+}
+
+func (c shadowLimitsCfg) ShadowMaxLabelNamesPerSeries(_ string) int { return c.maxLabelNamesPerSeries }
+func (c shadowLimitsCfg) ShadowMaxLabelNameLength(_ string) int     { return c.maxLabelNameLength }
+func (c shadowLimitsCfg) ShadowMaxLabelValueLength(_ string) int    { return c.maxLabelValueLength }
+
+func TestValidateShadowLimits(t *testing.T) {
+	series := []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "metric"},
+		{Name: "a", Value: "a_long_value"},
+		{Name: "a_long_name", Value: "a"},
+	}
+
+	tests := map[string]struct {
+		cfg      shadowLimitsCfg
+		expected string
+	}{
+		"should not evaluate the shadow limits if disabled": {
+			cfg:      shadowLimitsCfg{},
+			expected: "",
+		},
+		"should pass if the series doesn't exceed the shadow limits": {
+			cfg:      shadowLimitsCfg{maxLabelNamesPerSeries: 3, maxLabelNameLength: 11, maxLabelValueLength: 12},
+			expected: "",
+		},
+		"should return the max label names per series reason": {
+			cfg:      shadowLimitsCfg{maxLabelNamesPerSeries: 2, maxLabelNameLength: 5, maxLabelValueLength: 5},
+			expected: maxLabelNamesPerSeries,
+		},
+		"should return the label name too long reason": {
+			cfg:      shadowLimitsCfg{maxLabelNameLength: 8},
+			expected: labelNameTooLong,
+		},
+		"should return the label value too long reason": {
+			cfg:      shadowLimitsCfg{maxLabelValueLength: 10},
+			expected: labelValueTooLong,
+		},
+		"should return the reason of the first label exceeding a shadow limit": {
+			cfg:      shadowLimitsCfg{maxLabelNameLength: 8, maxLabelValueLength: 10},
+			expected: labelValueTooLong,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, ValidateShadowLimits(testData.cfg, "user", series))
+		})
+	}
+}
+
+func TestValidateLabels_RequiredLabelNames(t *testing.T) {
+	cfg := validateLabelsCfg{
+		maxLabelNamesPerSeries: 10,
+		maxLabelNameLength:     20,
+		maxLabelValueLength:    20,
+		requiredLabelNames:     []string{"cluster", "namespace"},
+	}
+	userID := "requiredLabelsUser"
+
+	// The series with all the required labels are accepted.
+	assert.NoError(t, ValidateLabels(DiscardedMetricsRecorder, cfg, userID, []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "cluster", Value: "c1"},
+		{Name: "namespace", Value: "ns1"},
+	}, false, nil))
+
+	// The missing label is named in the error.
+	missing := []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "cluster", Value: "c1"},
+	}
+	assert.Equal(t, newMissingRequiredLabelError(missing, "namespace"), ValidateLabels(DiscardedMetricsRecorder, cfg, userID, missing, false, nil))
+
+	// A label with an empty value is missing.
+	empty := []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "cluster", Value: ""},
+		{Name: "namespace", Value: "ns1"},
+	}
+	assert.Equal(t, newMissingRequiredLabelError(empty, "cluster"), ValidateLabels(DiscardedMetricsRecorder, cfg, userID, empty, false, nil))
+
+	// In warn mode, the series are accepted with a single warning.
+	cfg.requiredLabelNamesMode = ValidationModeWarn
+	warnings := NewWarnings()
+	assert.NoError(t, ValidateLabels(RecorderWithWarnings(DiscardedMetricsRecorder, warnings), cfg, userID, []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+	}, false, nil))
+	assert.Equal(t, []string{missingRequiredLabel}, warnings.Reasons())
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(DiscardedSamples.WithLabelValues(missingRequiredLabel, userID)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(ValidationWarnings.WithLabelValues(missingRequiredLabel, userID)))
+
+	DeletePerUserValidationMetrics(userID, util_log.Logger)
+}
+
+func TestValidateRequiredLabelMatchers(t *testing.T) {
+	required := []string{"cluster", "namespace"}
+
+	tests := map[string]struct {
+		matchers    []*labels.Matcher
+		expectedErr error
+	}{
+		"no matcher on the required labels": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, model.MetricNameLabel, "up")},
+		},
+		"matchers on the required labels values": {
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, "cluster", "c1"),
+				labels.MustNewMatcher(labels.MatchRegexp, "namespace", "ns.*"),
+				labels.MustNewMatcher(labels.MatchNotEqual, "namespace", ""),
+			},
+		},
+		"empty value matcher on a required label": {
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, model.MetricNameLabel, "up"),
+				labels.MustNewMatcher(labels.MatchEqual, "cluster", ""),
+			},
+			expectedErr: LimitError(fmt.Sprintf(ErrSelectorWithoutRequiredLabel, `cluster=""`, "cluster")),
+		},
+		"empty regexp matcher on a required label": {
+			matchers:    []*labels.Matcher{labels.MustNewMatcher(labels.MatchRegexp, "namespace", "")},
+			expectedErr: LimitError(fmt.Sprintf(ErrSelectorWithoutRequiredLabel, `namespace=~""`, "namespace")),
+		},
+		"negated non-empty regexp matcher on a required label": {
+			matchers:    []*labels.Matcher{labels.MustNewMatcher(labels.MatchNotRegexp, "namespace", ".+")},
+			expectedErr: LimitError(fmt.Sprintf(ErrSelectorWithoutRequiredLabel, `namespace!~".+"`, "namespace")),
+		},
+		"empty value matcher on another label": {
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "pod", "")},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedErr, ValidateRequiredLabelMatchers(required, tc.matchers))
+		})
+	}
+}
+
 func TestValidateLabelOrder(t *testing.T) {
 	var cfg validateLabelsCfg
 	cfg.maxLabelNameLength = 10
@@ -266,11 +551,11 @@ func TestValidateLabelOrder(t *testing.T) {
 
 	userID := "testUser"
 
-	actual := ValidateLabels(cfg, userID, []cortexpb.LabelAdapter{
+	actual := ValidateLabels(DiscardedMetricsRecorder, cfg, userID, []cortexpb.LabelAdapter{
 		{Name: model.MetricNameLabel, Value: "m"},
 		{Name: "b", Value: "b"},
 		{Name: "a", Value: "a"},
-	}, false)
+	}, false, nil)
 	expected := newLabelsNotSortedError([]cortexpb.LabelAdapter{
 		{Name: model.MetricNameLabel, Value: "m"},
 		{Name: "b", Value: "b"},
@@ -287,21 +572,21 @@ func TestValidateLabelDuplication(t *testing.T) {
 
 	userID := "testUser"
 
-	actual := ValidateLabels(cfg, userID, []cortexpb.LabelAdapter{
+	actual := ValidateLabels(DiscardedMetricsRecorder, cfg, userID, []cortexpb.LabelAdapter{
 		{Name: model.MetricNameLabel, Value: "a"},
 		{Name: model.MetricNameLabel, Value: "b"},
-	}, false)
+	}, false, nil)
 	expected := newDuplicatedLabelError([]cortexpb.LabelAdapter{
 		{Name: model.MetricNameLabel, Value: "a"},
 		{Name: model.MetricNameLabel, Value: "b"},
 	}, model.MetricNameLabel)
 	assert.Equal(t, expected, actual)
 
-	actual = ValidateLabels(cfg, userID, []cortexpb.LabelAdapter{
+	actual = ValidateLabels(DiscardedMetricsRecorder, cfg, userID, []cortexpb.LabelAdapter{
 		{Name: model.MetricNameLabel, Value: "a"},
 		{Name: "a", Value: "a"},
 		{Name: "a", Value: "a"},
-	}, false)
+	}, false, nil)
 	expected = newDuplicatedLabelError([]cortexpb.LabelAdapter{
 		{Name: model.MetricNameLabel, Value: "a"},
 		{Name: "a", Value: "a"},
@@ -309,3 +594,59 @@ func TestValidateLabelDuplication(t *testing.T) {
 	}, "a")
 	assert.Equal(t, expected, actual)
 }
+
+func TestValidateLabels_ValidatedLabelNames(t *testing.T) {
+	var cfg validateLabelsCfg
+	cfg.maxLabelNameLength = 10
+	cfg.maxLabelNamesPerSeries = 10
+	cfg.maxLabelValueLength = 10
+
+	userID := "testUser"
+	validated := &ValidatedLabelNames{}
+
+	require.NoError(t, ValidateLabels(DiscardedMetricsRecorder, cfg, userID, []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "a", Value: "a"},
+		{Name: "c", Value: "c"},
+	}, false, validated))
+	assert.Equal(t, []string{model.MetricNameLabel, "a", "c"}, validated.names)
+
+	// The label values of the series sharing the label names are still validated.
+	tooLong := []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "a", Value: "a_too_long_value"},
+	}
+	assert.Equal(t, newLabelValueTooLongError(tooLong, "a_too_long_value"), ValidateLabels(DiscardedMetricsRecorder, cfg, userID, tooLong, false, validated))
+
+	// The label names following the ones shared with the last series accepted are validated.
+	invalid := []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "a", Value: "a"},
+		{Name: "b-b", Value: "b"},
+	}
+	assert.Equal(t, newInvalidLabelError(invalid, "b-b"), ValidateLabels(DiscardedMetricsRecorder, cfg, userID, invalid, false, validated))
+
+	notSorted := []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "a", Value: "a"},
+		{Name: "c", Value: "c"},
+		{Name: "b", Value: "b"},
+	}
+	assert.Equal(t, newLabelsNotSortedError(notSorted, "b"), ValidateLabels(DiscardedMetricsRecorder, cfg, userID, notSorted, false, validated))
+
+	duplicated := []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "a", Value: "a"},
+		{Name: "a", Value: "a"},
+	}
+	assert.Equal(t, newDuplicatedLabelError(duplicated, "a"), ValidateLabels(DiscardedMetricsRecorder, cfg, userID, duplicated, false, validated))
+
+	// The series rejected don't replace the label names of the last series accepted.
+	assert.Equal(t, []string{model.MetricNameLabel, "a", "c"}, validated.names)
+
+	require.NoError(t, ValidateLabels(DiscardedMetricsRecorder, cfg, userID, []cortexpb.LabelAdapter{
+		{Name: model.MetricNameLabel, Value: "m"},
+		{Name: "b", Value: "b"},
+	}, false, validated))
+	assert.Equal(t, []string{model.MetricNameLabel, "b"}, validated.names)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/gogo/protobuf/proto"
+	descpb "github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	plugin "github.com/gogo/protobuf/protoc-gen-gogo/plugin"
+	"github.com/gogo/protobuf/vanity"
+	"github.com/gogo/protobuf/vanity/command"
+
+	_ "github.com/cortexproject/cortex/pkg/ingester/client"
+	_ "github.com/gogo/protobuf/gogoproto"
+	_ "github.com/gogo/protobuf/types"
+)
+
+func load(name, rename string) *descpb.FileDescriptorProto {
+	gz := proto.FileDescriptor(name)
+	if gz == nil {
+		panic("missing " + name)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		panic(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	fd := &descpb.FileDescriptorProto{}
+	if err := proto.Unmarshal(b, fd); err != nil {
+		panic(err)
+	}
+	if rename != "" {
+		fd.Name = proto.String(rename)
+	}
+	return fd
+}
+
+func main() {
+	desc := load("descriptor.proto", "google/protobuf/descriptor.proto")
+	gogo := load("gogo.proto", "github.com/gogo/protobuf/gogoproto/gogo.proto")
+	dur := load("google/protobuf/duration.proto", "")
+	cortexpb := load("cortex.proto", "github.com/cortexproject/cortex/pkg/cortexpb/cortex.proto")
+	target := load("ingester.proto", "")
+	fmt.Fprintln(os.Stderr, target.Dependency, cortexpb.GetName())
+
+	dur.Options.GoPackage = proto.String("github.com/golang/protobuf/ptypes/duration")
+	if os.Getenv("NOMODIFY") == "" {
+		modify(target)
+	}
+
+	req := &plugin.CodeGeneratorRequest{
+		FileToGenerate: []string{target.GetName()},
+		Parameter:      proto.String("plugins=grpc,Mgoogle/protobuf/any.proto=github.com/gogo/protobuf/types,"),
+		ProtoFile:      []*descpb.FileDescriptorProto{desc, gogo, dur, cortexpb, target},
+	}
+	files := req.GetProtoFile()
+	files = vanity.FilterFiles(files, vanity.NotGoogleProtobufDescriptorProto)
+
+	vanity.ForEachFile(files, vanity.TurnOnMarshalerAll)
+	vanity.ForEachFile(files, vanity.TurnOnSizerAll)
+	vanity.ForEachFile(files, vanity.TurnOnUnmarshalerAll)
+
+	vanity.ForEachFieldInFilesExcludingExtensions(vanity.OnlyProto2(files), vanity.TurnOffNullableForNativeTypesWithoutDefaultsOnly)
+	vanity.ForEachFile(files, vanity.TurnOffGoUnrecognizedAll)
+	vanity.ForEachFile(files, vanity.TurnOffGoUnkeyedAll)
+	vanity.ForEachFile(files, vanity.TurnOffGoSizecacheAll)
+
+	vanity.ForEachFile(files, vanity.TurnOffGoEnumPrefixAll)
+	vanity.ForEachFile(files, vanity.TurnOffGoEnumStringerAll)
+	vanity.ForEachFile(files, vanity.TurnOnEnumStringerAll)
+
+	vanity.ForEachFile(files, vanity.TurnOnEqualAll)
+	vanity.ForEachFile(files, vanity.TurnOnGoStringAll)
+	vanity.ForEachFile(files, vanity.TurnOffGoStringerAll)
+	vanity.ForEachFile(files, vanity.TurnOnStringerAll)
+
+	resp := command.Generate(req)
+	if resp.Error != nil {
+		panic(*resp.Error)
+	}
+	for _, f := range resp.File {
+		fmt.Fprintln(os.Stderr, "generated", f.GetName())
+		if err := ioutil.WriteFile(os.Args[1], []byte(f.GetContent()), 0644); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func comment(fd *descpb.FileDescriptorProto, msg, field int, text string) {
+	if fd.SourceCodeInfo == nil {
+		fd.SourceCodeInfo = &descpb.SourceCodeInfo{}
+	}
+	fd.SourceCodeInfo.Location = append(fd.SourceCodeInfo.Location, &descpb.SourceCodeInfo_Location{
+		Path:            []int32{4, int32(msg), 2, int32(field)},
+		Span:            []int32{0, 0, 0},
+		LeadingComments: proto.String(text),
+	})
+}
+
+func modify(fd *descpb.FileDescriptorProto) {
+	for _, m := range fd.MessageType {
+		if m.GetName() != "PushStreamResponse" {
+			continue
+		}
+		m.Field = append(m.Field, &descpb.FieldDescriptorProto{
+			Name:     proto.String("dropped_errors"),
+			Number:   proto.Int32(2),
+			Label:    descpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descpb.FieldDescriptorProto_TYPE_UINT32.Enum(),
+			JsonName: proto.String("droppedErrors"),
+		})
+	}
+}